@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/ops"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver"
+)
+
+const createAdminUsage = `usage: account-management create-admin [-config file] -email address
+
+Gives the account with the email the admin role. Without an account, one is created with a
+verified email and a generated password, which is printed once.
+`
+
+const revokeSessionsUsage = `usage: account-management revoke-sessions [-config file] -account-id id
+
+Ends every session of the account, like logging out everywhere. Its access tokens keep working
+until they expire.
+`
+
+const rotateJWTKeyUsage = `usage: account-management rotate-jwt-key [-file path] [-algorithm ed25519|rsa] [command]
+
+commands:
+  add      generate a key and append it to the file, the default
+  promote  move the last key to the front so it signs new tokens
+  retire   remove every key but the one that signs
+
+Reload the signing keys on every replica after each step.
+`
+
+// runCreateAdmin runs the create-admin subcommand with the arguments after "create-admin"
+func runCreateAdmin(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to the server's YAML or TOML config file, instead of CONFIG_FILE")
+	email := fs.String("email", "", "email of the admin account")
+	fs.Usage = func() { fmt.Fprint(fs.Output(), createAdminUsage) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" {
+		fs.Usage()
+		return errors.New("missing -email")
+	}
+
+	cfg, db, err := openStorage(*configFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	passwords, err := auth.NewPasswordHasher(cfg.PasswordHasherConfig())
+	if err != nil {
+		return fmt.Errorf("error configuring password hashing: %w", err)
+	}
+
+	result, err := ops.CreateAdmin(ctx, db, passwords, *email)
+	if err != nil {
+		return err
+	}
+	switch {
+	case result.AlreadyAdmin:
+		fmt.Fprintf(stdout, "%s (%s) is already an admin\n", result.Account.Email, result.Account.ID)
+	case result.Password != "":
+		fmt.Fprintf(stdout, "created admin %s (%s)\npassword: %s\nchange it after signing in, it isn't shown again\n",
+			result.Account.Email, result.Account.ID, result.Password)
+	default:
+		fmt.Fprintf(stdout, "%s (%s) is now an admin\n", result.Account.Email, result.Account.ID)
+	}
+	return nil
+}
+
+// runRevokeSessions runs the revoke-sessions subcommand with the arguments after
+// "revoke-sessions"
+func runRevokeSessions(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("revoke-sessions", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to the server's YAML or TOML config file, instead of CONFIG_FILE")
+	accountID := fs.String("account-id", "", "ID of the account")
+	fs.Usage = func() { fmt.Fprint(fs.Output(), revokeSessionsUsage) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(*accountID); err != nil {
+		fs.Usage()
+		return errors.New("-account-id must be an account ID")
+	}
+
+	cfg, db, err := openStorage(*configFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var revocations *revocation.List
+	if cfg.SignedRefreshTokens {
+		// the revocation list is in Redis, or in the memory of each replica where it can't be
+		// reached
+		if cfg.RedisURL == "" {
+			return errors.New("signed refresh tokens are revoked in each replica's memory without REDIS_URL, log the account out through the API instead")
+		}
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return fmt.Errorf("error parsing REDIS_URL: %w", err)
+		}
+		client := redis.NewClient(opts)
+		defer client.Close()
+		revocations = revocation.NewList(lockout.NewRedisStore(client), time.Duration(cfg.RefreshTokenTTLMinutes)*time.Minute)
+	}
+
+	if err := ops.RevokeSessions(ctx, db, revocations, *accountID); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "revoked the sessions of %s, its access tokens expire within %d minutes\n", *accountID, cfg.AccessTokenTTLMinutes)
+	return nil
+}
+
+// runRotateJWTKey runs the rotate-jwt-key subcommand with the arguments after "rotate-jwt-key".
+// It only edits the key file, the server reads it like migrate reads PSQL_URL.
+func runRotateJWTKey(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("rotate-jwt-key", flag.ContinueOnError)
+	path := fs.String("file", os.Getenv("JWT_SIGNING_KEY_FILE"), "signing key file, JWT_SIGNING_KEY_FILE by default")
+	algorithm := fs.String("algorithm", auth.SigningKeyEd25519, "algorithm of added keys, ed25519 or rsa")
+	fs.Usage = func() { fmt.Fprint(fs.Output(), rotateJWTKeyUsage) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return errors.New("missing signing key file: set JWT_SIGNING_KEY_FILE or pass -file")
+	}
+
+	switch command := fs.Arg(0); command {
+	case "", "add":
+		keyID, err := ops.AddSigningKey(*path, *algorithm)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "added key %s\nreload every replica, then, unless it's the only key, promote it once verifiers have fetched the JWKS\n", keyID)
+	case "promote":
+		keyID, err := ops.PromoteSigningKey(*path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "key %s signs new tokens\nreload every replica, then retire the old keys once their tokens have expired\n", keyID)
+	case "retire":
+		retired, err := ops.RetireSigningKeys(*path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "retired %d keys %v\nreload every replica\n", len(retired), retired)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown rotate-jwt-key command: %s", command)
+	}
+	return nil
+}
+
+// openStorage loads the server's config and opens its database for the admin subcommands
+func openStorage(configFile string) (*config.Config, database.Repository, error) {
+	cfg, err := config.Load(config.Overrides{ConfigFile: configFile})
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.DevMode || cfg.Storage == config.StorageMemory {
+		return nil, nil, errors.New("the data is in the server's memory with dev mode or STORAGE=memory, there's nothing to manage")
+	}
+
+	db, err := webserver.OpenStorage(*cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening database: %w", err)
+	}
+	return cfg, db, nil
+}
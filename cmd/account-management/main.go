@@ -2,45 +2,238 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/service/scheduler"
+	"github.com/austinwofford/account-management/internal/service/tracing"
 	"github.com/austinwofford/account-management/internal/webserver"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
 )
 
+const usage = `usage: account-management [command] [flags]
+
+commands:
+  serve            run the server, the default when there's no command
+  migrate          apply or revert database migrations
+  create-admin     create an admin account, or make an existing account an admin
+  revoke-sessions  end every session of an account
+  rotate-jwt-key   add, promote, or retire keys in JWT_SIGNING_KEY_FILE
+  seed             fill the database with made up accounts for development
+
+Run account-management <command> -h for the command's flags.
+`
+
 func main() {
-	// TODO: set logger default to log request IDs with every log output.
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	ctx := context.Background()
+
+	// flags without a command are the server's, as they were before there were commands
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		serve(args)
+		return
+	case "migrate":
+		// migrate runs without the server's config, only a database URL is needed
+		err = runMigrate(ctx, args, os.Stdout)
+	case "create-admin":
+		err = runCreateAdmin(ctx, args, os.Stdout)
+	case "revoke-sessions":
+		err = runRevokeSessions(ctx, args, os.Stdout)
+	case "rotate-jwt-key":
+		err = runRotateJWTKey(args, os.Stdout)
+	case "seed":
+		err = runSeed(ctx, args, os.Stdout)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		err = fmt.Errorf("unknown command: %s", command)
+	}
+	if err != nil {
+		// -h already printed the usage
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+// serve runs the server until it's sent SIGINT or SIGTERM
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	devMode := flags.Bool("dev", false, "run with an in-memory database, log-only mailer, and ephemeral JWT key (no Postgres needed)")
+	mockMode := flags.Bool("mock", false, "run as a mock identity server: dev mode plus any password is accepted for MOCK_ACCOUNTS and tokens are deterministic")
+	fixturesPath := flags.String("fixtures", "", "path to a YAML/JSON fixture scenario to load into the database on startup")
+	printRoutes := flags.Bool("routes", false, "print every route with its middleware for the current config and exit")
+	configFile := flags.String("config", "", "path to a YAML or TOML config file, instead of CONFIG_FILE (environment variables take precedence over it)")
+	printSchema := flags.Bool("config-schema", false, "print the JSON Schema of config files and exit")
+	// ExitOnError exits when parsing fails
+	_ = flags.Parse(args)
+
+	if *printSchema {
+		schema, err := config.Schema()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(schema)
+		return
+	}
+
+	// request and trace IDs are added to every log line written with a request's context. The
+	// level is LOG_LEVEL once the config is loaded.
+	logLevel := new(slog.LevelVar)
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})
+	logger := slog.New(tracing.NewLogHandler(middleware.NewLogHandler(handler)))
 	slog.SetDefault(logger)
 
-	cfg, err := config.Load()
+	overrides := config.Overrides{
+		DevMode:      *devMode,
+		MockMode:     *mockMode,
+		FixturesPath: *fixturesPath,
+		ConfigFile:   *configFile,
+	}
+	cfg, err := config.Load(overrides)
 	if err != nil {
+		// the problems are also printed one per line, they're hard to read in a JSON log line
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			fmt.Fprintln(os.Stderr, invalid)
+		}
 		logger.Error("fatal error loading config", "error", err)
 		os.Exit(1)
 	}
+	logLevel.Set(cfg.SlogLevel())
+
+	if cfg.MockMode {
+		logger.Warn("running in mock mode: any password is accepted for mock accounts", "mock_accounts", cfg.MockAccounts)
+	} else if cfg.DevMode {
+		logger.Warn("running in dev mode: data is in memory and lost on restart, tokens are invalidated on restart, and emails are only logged")
+	}
 
 	ctx := context.Background()
 
-	router, err := webserver.NewRouter(*cfg, logger)
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Endpoint:    cfg.OTLPEndpoint,
+		Headers:     cfg.OTLPHeaders,
+		ServiceName: cfg.TracingServiceName,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "fatal error setting up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	jobs := scheduler.New()
+	reloads := webserver.NewReloader(*cfg, func() (*config.Config, error) { return config.Load(overrides) }, logLevel)
+
+	certManager := webserver.NewCertManager(*cfg)
+	tlsConfig, err := webserver.NewTLSConfig(*cfg, certManager)
+	if err != nil {
+		logger.ErrorContext(ctx, "fatal error loading TLS config", "error", err)
+		os.Exit(1)
+	}
+
+	// the internal routes are served over gRPC too, on their own listener
+	grpcSrv := webserver.NewGRPCServer(*cfg, tlsConfig)
+	router, err := webserver.NewRouter(*cfg, logger, jobs, reloads, grpcSrv)
 	if err != nil {
 		logger.ErrorContext(ctx, "fatal error creating database client", "error", err)
 		os.Exit(1)
 	}
 
+	if *printRoutes {
+		routes, err := webserver.Routes(router)
+		if err == nil {
+			err = webserver.WriteRoutes(os.Stdout, routes)
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "fatal error listing routes", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	srv := webserver.NewHTTPServer(cfg.HTTPAddress, router)
+	srv.TLSConfig = tlsConfig
+
+	ln, err := webserver.Listen(ctx, *cfg)
+	if err != nil {
+		logger.ErrorContext(ctx, "fatal error starting listener", "error", err)
+		os.Exit(1)
+	}
+
+	// background cleanup runs alongside the server and is stopped with it
+	jobs.Start(ctx)
 
 	// err chan for server errors
-	errCh := make(chan error, 1)
+	errCh := make(chan error, 4)
 
 	// start the webserver in a go routine and listen for errors
 	go func() {
-		logger.InfoContext(ctx, "starting webserver", "addr", cfg.HTTPAddress)
-		errCh <- srv.ListenAndServe()
+		logger.InfoContext(ctx, "starting webserver", "addr", cfg.HTTPAddress, "tls", tlsConfig != nil,
+			"autocert", certManager != nil, "reuseport", cfg.ListenReusePort)
+		errCh <- webserver.Serve(srv, ln)
+	}()
+
+	// plain HTTP only redirects to HTTPS (and answers ACME challenges)
+	var redirectSrv *http.Server
+	if cfg.HTTPRedirectAddress != "" {
+		redirectSrv = webserver.NewRedirectServer(*cfg, certManager)
+		go func() {
+			logger.InfoContext(ctx, "starting HTTPS redirect listener", "addr", cfg.HTTPRedirectAddress)
+			errCh <- redirectSrv.ListenAndServe()
+		}()
+	}
+
+	if grpcSrv != nil {
+		grpcLn, err := net.Listen("tcp", cfg.GRPCAddress)
+		if err != nil {
+			logger.ErrorContext(ctx, "fatal error starting gRPC listener", "error", err)
+			os.Exit(1)
+		}
+		go func() {
+			logger.InfoContext(ctx, "starting gRPC listener", "addr", cfg.GRPCAddress)
+			errCh <- grpcSrv.Serve(grpcLn)
+		}()
+	}
+
+	// profiling for production incidents, on its own listener
+	debugSrv := webserver.NewDebugServer(*cfg)
+	if debugSrv != nil {
+		go func() {
+			logger.InfoContext(ctx, "starting debug listener", "addr", cfg.DebugAddress)
+			errCh <- debugSrv.ListenAndServe()
+		}()
+	}
+
+	// SIGHUP reloads the settings that can change without a restart
+	go func() {
+		for range hangups() {
+			if _, _, err := reloads.Reload(ctx); err != nil {
+				var invalid *config.ValidationError
+				if errors.As(err, &invalid) {
+					fmt.Fprintln(os.Stderr, invalid)
+				}
+				logger.ErrorContext(ctx, "error reloading config, the current one is still in use", "error", err)
+			}
+		}
 	}()
 
 	// wait for signal or fatal listen error
@@ -65,6 +258,42 @@ func main() {
 	} else {
 		logger.Info("server stopped")
 	}
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(ctx); err != nil {
+			logger.Error("error stopping HTTPS redirect listener", "err", err)
+		}
+	}
+
+	if grpcSrv != nil {
+		// calls in flight get to finish, as long as the HTTP server's shutdown left time for them
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcSrv.Stop()
+		}
+	}
+
+	if debugSrv != nil {
+		// a profile being taken would hold up the shutdown for its whole duration
+		if err := debugSrv.Close(); err != nil {
+			logger.Error("error stopping debug listener", "err", err)
+		}
+	}
+
+	// let a purge that's running finish rather than cutting it off
+	if err := jobs.Stop(ctx); err != nil {
+		logger.Error("error stopping background jobs", "err", err)
+	}
+
+	// spans of the last requests are still buffered
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("error flushing traces", "err", err)
+	}
 }
 
 // trap returns a channel that receives OS shutdown signals
@@ -75,3 +304,11 @@ func trap() <-chan os.Signal {
 
 	return ch
 }
+
+// hangups returns a channel that receives SIGHUP, the signal to reload the config
+func hangups() <-chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+
+	return ch
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	// registers the pgx driver with database/sql
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/austinwofford/account-management/internal/database/migrations"
+)
+
+const migrateUsage = `usage: account-management migrate [-database url] <command>
+
+commands:
+  up        apply every pending migration
+  down [N]  revert the last N migrations, 1 by default
+  version   print the version the database is at
+  status    list every migration and whether it's applied
+`
+
+// runMigrate runs the migrate subcommand with the arguments after "migrate"
+func runMigrate(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	databaseURL := fs.String("database", os.Getenv("PSQL_URL"), "Postgres URL, PSQL_URL by default")
+	fs.Usage = func() { fmt.Fprint(fs.Output(), migrateUsage) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing migrate command")
+	}
+	if *databaseURL == "" {
+		return errors.New("missing database URL: set PSQL_URL or pass -database")
+	}
+
+	db, err := sql.Open("pgx", *databaseURL)
+	if err != nil {
+		return fmt.Errorf("error opening database: %w", err)
+	}
+	defer db.Close()
+
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "applied %d migrations\n", applied)
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			steps, err = strconv.Atoi(fs.Arg(1))
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations to revert: %s", fs.Arg(1))
+			}
+		}
+		reverted, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "reverted %d migrations\n", reverted)
+	case "version":
+		version, dirty, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			fmt.Fprintf(stdout, "%d (dirty)\n", version)
+		} else {
+			fmt.Fprintf(stdout, "%d\n", version)
+		}
+	case "status":
+		version, dirty, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		all, err := migrations.All()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		for _, migration := range all {
+			status := "pending"
+			switch {
+			case migration.Version == version && dirty:
+				status = "dirty"
+			case migration.Version <= version:
+				status = "applied"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Name, status)
+		}
+		return w.Flush()
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command: %s", fs.Arg(0))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/austinwofford/account-management/internal/fixtures"
+)
+
+const seedUsage = `usage: account-management seed [-config file] [flags]
+
+Fills the server's database with made up accounts, each with sessions and audit events, for
+local development and load tests. The same flags always make the same data. Seeding again
+leaves existing accounts and sessions as they are but adds the audit events again.
+
+flags:
+`
+
+// runSeed runs the seed subcommand with the arguments after "seed"
+func runSeed(ctx context.Context, args []string, stdout io.Writer) error {
+	defaults := fixtures.DefaultGenerateConfig()
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to the server's YAML or TOML config file, instead of CONFIG_FILE")
+	accounts := fs.Int("accounts", defaults.Accounts, "number of accounts")
+	sessions := fs.Int("sessions", defaults.SessionsPerAccount, "sessions per account")
+	events := fs.Int("events", defaults.AuditEventsPerAccount, "audit events per account")
+	seed := fs.Uint64("seed", defaults.Seed, "picks the data, another seed makes other accounts")
+	password := fs.String("password", defaults.Password, "every account's password")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), seedUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *accounts < 0 || *sessions < 0 || *events < 0 {
+		return errors.New("-accounts, -sessions, and -events can't be negative")
+	}
+
+	scenario, err := fixtures.Generate(fixtures.GenerateConfig{
+		Accounts:              *accounts,
+		SessionsPerAccount:    *sessions,
+		AuditEventsPerAccount: *events,
+		Seed:                  *seed,
+		Password:              *password,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, db, err := openStorage(*configFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := fixtures.Load(ctx, db, *scenario); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "seeded %d accounts, %d sessions, and %d audit events\npassword: %s\n",
+		len(scenario.Accounts), len(scenario.Sessions), len(scenario.AuditEvents), *password)
+	return nil
+}
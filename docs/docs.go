@@ -2,10 +2,41 @@ package docs
 
 import (
 	"embed"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"sync"
+
+	"gopkg.in/yaml.v3"
 )
 
-//go:embed api/*
+//go:embed index.html api/* config.schema.json
 var fs embed.FS
 
+// Handler serves Swagger UI at its root, the files under api/, like the Redoc page at api/, and
+// the config file schema at config.schema.json
 var Handler = http.FileServer(http.FS(fs))
+
+// OpenAPISpec is the OpenAPI document served at /docs/api/api.yml.
+//
+//go:embed api/api.yml
+var OpenAPISpec []byte
+
+// ConfigSchema is the JSON Schema of config files, generated by config.Schema.
+//
+//go:embed config.schema.json
+var ConfigSchema []byte
+
+// OpenAPIJSON is OpenAPISpec converted to JSON, served at /docs/openapi.json for tools that
+// don't read YAML. It's converted once, on first use.
+var OpenAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	var doc any
+	if err := yaml.Unmarshal(OpenAPISpec, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing OpenAPI spec: %w", err)
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error converting OpenAPI spec to JSON: %w", err)
+	}
+	return b, nil
+})
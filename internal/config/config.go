@@ -1,23 +1,463 @@
 package config
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/secrets"
 	"github.com/caarlos0/env/v11"
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	HTTPAddress            string `env:"HTTP_ADDRESS" envDefault:":8080"`
-	DebugEnabled           bool   `env:"DEBUG_ENABLED"`
-	PostgresURL            string `env:"PSQL_URL,required"`
-	AccessTokenTTLMinutes  int    `env:"REFRESH_TOKEN_TTL_MINUTES" envDefault:"15"`
+	HTTPAddress  string `env:"HTTP_ADDRESS" envDefault:":8080"`
+	DebugEnabled bool   `env:"DEBUG_ENABLED"`
+	PostgresURL  string `env:"PSQL_URL"`
+	// PostgresReplicaURL is an optional read-only replica of PSQL_URL. Account and refresh token
+	// lookups and lists are read from it, falling back to the primary while it's unavailable.
+	PostgresReplicaURL string `env:"PSQL_REPLICA_URL"`
+	// Storage is where data is kept: database, or memory for demos that don't need one. Data in
+	// memory is lost on restart and isn't shared between replicas.
+	Storage string `env:"STORAGE" envDefault:"database"`
+	// DBDriver is the database used with STORAGE=database: postgres, or sqlite for a single
+	// instance keeping its data in the SQLitePath file.
+	DBDriver   string `env:"DB_DRIVER" envDefault:"postgres"`
+	SQLitePath string `env:"SQLITE_PATH" envDefault:"account-management.db"`
+	// AutoMigrate applies pending migrations on startup. Replicas starting together take turns.
+	AutoMigrate            bool   `env:"AUTO_MIGRATE"`
+	AccessTokenTTLMinutes  int    `env:"ACCESS_TOKEN_TTL_MINUTES" envDefault:"15"`
 	RefreshTokenTTLMinutes int    `env:"REFRESH_TOKEN_TTL_MINUTES" envDefault:"1440"`
-	JWTSecretKey           string `env:"JWT_SECRET_KEY,required"`
+	JWTSecretKey           string `env:"JWT_SECRET_KEY"`
+	// JWTEncryptionKey is an optional base64 encoded 32 byte key. When set, access tokens are
+	// issued as encrypted JWTs (JWE) so clients can't read the claims.
+	JWTEncryptionKey string `env:"JWT_ENCRYPTION_KEY"`
+	// JWTSigningKey is an optional PEM encoded RSA or Ed25519 private key, or JWTSigningKeyFile a
+	// path to one. When set, tokens are signed with it instead of JWTSecretKey and its public key
+	// is served at /.well-known/jwks.json, so other services can verify tokens without a secret.
+	// Any keys after the first only verify tokens. The file can be reloaded without a restart.
+	JWTSigningKey     string `env:"JWT_SIGNING_KEY"`
+	JWTSigningKeyFile string `env:"JWT_SIGNING_KEY_FILE"`
+	// RefreshTokenRotation makes refresh tokens single use. A rotated token is still accepted
+	// for RefreshTokenGraceSeconds so concurrent refreshes from the same client don't log it out.
+	RefreshTokenRotation     bool `env:"REFRESH_TOKEN_ROTATION"`
+	RefreshTokenGraceSeconds int  `env:"REFRESH_TOKEN_GRACE_SECONDS" envDefault:"10"`
+	// SignedRefreshTokens issues signed, self-contained refresh tokens that are validated without
+	// Postgres. Logouts and used tokens are tracked in the lockout store (Redis if configured).
+	SignedRefreshTokens bool `env:"SIGNED_REFRESH_TOKENS"`
+	// SessionCookies is cookie mode for browser clients: refresh tokens are set as HttpOnly
+	// cookies and read back on refresh and logout, with a double-submit CSRF token. Set
+	// SessionCookieDomain to the parent domain when the web app and API are on different
+	// subdomains. SessionCookieSecure should only be turned off for local development over HTTP.
+	SessionCookies        bool   `env:"SESSION_COOKIES"`
+	SessionCookieDomain   string `env:"SESSION_COOKIE_DOMAIN"`
+	SessionCookieSecure   bool   `env:"SESSION_COOKIE_SECURE" envDefault:"true"`
+	SessionCookieSameSite string `env:"SESSION_COOKIE_SAME_SITE" envDefault:"strict"`
+
+	// DebugCaptureSize is how many recent requests the debug capture keeps when DebugEnabled is
+	// set. 0 turns capturing off.
+	DebugCaptureSize int `env:"DEBUG_CAPTURE_SIZE" envDefault:"100"`
+	// DebugAddress serves pprof profiles and expvar runtime stats on their own listener when
+	// DebugEnabled is set, e.g. "127.0.0.1:6060". It has no authentication, so it has to be bound
+	// to an interface only operators can reach.
+	DebugAddress string `env:"DEBUG_ADDRESS"`
+
+	// LogLevel is the least severe level that's logged: debug, info, warn, or error
+	LogLevel string `env:"LOG_LEVEL" envDefault:"info"`
+
+	// MetricsEnabled serves Prometheus metrics at /metrics
+	MetricsEnabled bool `env:"METRICS_ENABLED" envDefault:"true"`
+
+	// Traces are exported over OTLP/HTTP when OTLPEndpoint is set, e.g.
+	// "http://otel-collector:4318". OTLPHeaders are sent with every export, e.g. "api-key=secret".
+	// TracingSampleRatio is the share of new traces that are recorded.
+	OTLPEndpoint       string            `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OTLPHeaders        map[string]string `env:"OTEL_EXPORTER_OTLP_HEADERS" envKeyValSeparator:"="`
+	TracingServiceName string            `env:"OTEL_SERVICE_NAME" envDefault:"account-management"`
+	TracingSampleRatio float64           `env:"TRACING_SAMPLE_RATIO" envDefault:"1"`
+
+	// DBHealthCheckIntervalSeconds is how often the primary database is checked for outages.
+	// After DBHealthCheckFailures failed checks in a row the service is degraded: writes get a
+	// 503 while token verification and reads keep working. 0 turns outage detection off.
+	DBHealthCheckIntervalSeconds int `env:"DB_HEALTH_CHECK_INTERVAL_SECONDS" envDefault:"5"`
+	DBHealthCheckFailures        int `env:"DB_HEALTH_CHECK_FAILURES" envDefault:"3"`
+	// DBMaxAttempts is how many times Postgres statements and transactions that failed for a
+	// transient reason (serialization failures, dropped connections, failovers) are tried. Writes
+	// are only retried when they can't have been applied. 1 doesn't retry.
+	DBMaxAttempts int `env:"DB_MAX_ATTEMPTS" envDefault:"3"`
+
+	// DevMode runs the server without any external dependencies: an in-memory
+	// database, a log-only mailer, and an ephemeral JWT key. Never use in production.
+	DevMode bool `env:"DEV_MODE"`
+	// FixturesPath is an optional YAML/JSON scenario loaded into the database on startup.
+	FixturesPath string `env:"FIXTURES_PATH"`
+
+	// MockMode is a mock identity server for teams integrating against this API. It implies
+	// dev mode, accepts any password for the MockAccounts, and issues deterministic tokens
+	// (stable account IDs, a fixed signing key) so e2e tests don't need real credentials.
+	MockMode     bool     `env:"MOCK_MODE"`
+	MockAccounts []string `env:"MOCK_ACCOUNTS" envSeparator:"," envDefault:"user@example.com,admin@example.com"`
+
+	// RedisURL is optional. When set, login lockout counters are kept in Redis so they're
+	// shared between replicas; otherwise they're kept in memory per process.
+	RedisURL               string `env:"REDIS_URL"`
+	LockoutMaxAttempts     int    `env:"LOCKOUT_MAX_ATTEMPTS" envDefault:"10"`
+	LockoutDurationMinutes int    `env:"LOCKOUT_DURATION_MINUTES" envDefault:"15"`
+
+	// CacheAccountTTLSeconds caches account lookups in Redis for that long. Writes invalidate
+	// them, but a lookup racing a write can leave a stale entry until it expires. 0 doesn't cache
+	// them. Requires RedisURL.
+	CacheAccountTTLSeconds int `env:"CACHE_ACCOUNT_TTL_SECONDS"`
+
+	// MailProvider delivers emails: log (only logs them), smtp, or sendgrid. Dev mode always
+	// logs them. MailFrom is the sender, e.g. "Account Management <no-reply@example.com>".
+	MailProvider string `env:"MAIL_PROVIDER" envDefault:"log"`
+	MailFrom     string `env:"MAIL_FROM"`
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     int    `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+	// SendGridAPIKey needs the Mail Send permission
+	SendGridAPIKey string `env:"SENDGRID_API_KEY"`
+	// MailQueueSize is how many emails can wait to be sent in the background, each tried up to
+	// MailMaxAttempts times. 0 sends them before responding.
+	MailQueueSize   int `env:"MAIL_QUEUE_SIZE" envDefault:"100"`
+	MailMaxAttempts int `env:"MAIL_MAX_ATTEMPTS" envDefault:"5"`
+
+	// AppURL is the base URL of the web app. Links in emails point to pages under it.
+	AppURL string `env:"APP_URL" envDefault:"http://localhost:8080"`
+
+	// APIVersionsDisabled are retired versions of the public API, e.g. "v1". Their routes answer
+	// 410. The OAuth and SAML routes aren't versioned and stay under /v1 either way.
+	APIVersionsDisabled []string `env:"API_VERSIONS_DISABLED" envSeparator:","`
+	// APIVersionDeprecations are the versions of the public API being retired, each deprecated
+	// from a date and optionally sunset on another, e.g. "v1=2026-10-01/2027-04-01". Their
+	// responses carry Deprecation and Sunset headers.
+	APIVersionDeprecations map[string]string `env:"API_VERSION_DEPRECATIONS" envKeyValSeparator:"="`
+
+	// OIDCIssuer is this service's public base URL, e.g. "https://accounts.example.com". Setting it
+	// turns on OpenID Connect: discovery at /.well-known/openid-configuration, ID tokens for OAuth
+	// clients granted the openid scope, and userinfo. OIDCAuthorizationURL is the web app's consent
+	// page that clients send browsers to, APP_URL/oauth/authorize by default.
+	OIDCIssuer           string `env:"OIDC_ISSUER"`
+	OIDCAuthorizationURL string `env:"OIDC_AUTHORIZATION_URL"`
+
+	// TokenExchangeTTLMinutes is how long the delegation tokens OAuth clients get by exchanging an
+	// account's access token last at most. They never outlive the token they were exchanged for.
+	TokenExchangeTTLMinutes int `env:"TOKEN_EXCHANGE_TTL_MINUTES" envDefault:"5"`
+
+	// SAMLBaseURL is this service's public base URL, e.g. "https://accounts.example.com". Setting
+	// it turns on SAML SSO: organizations configure their identity provider at
+	// /v1/orgs/{id}/saml and sign in under /v1/saml/{id}.
+	SAMLBaseURL string `env:"SAML_BASE_URL"`
+
+	// RequireEmailVerification blocks password logins until the account verifies its email
+	// with the link sent when it registered.
+	RequireEmailVerification bool `env:"REQUIRE_EMAIL_VERIFICATION" envDefault:"true"`
+
+	// NewSignInAlerts emails accounts when they log in from a device or location they haven't
+	// been used from, with a link that logs out the new session.
+	NewSignInAlerts bool `env:"NEW_SIGN_IN_ALERTS" envDefault:"false"`
+	// LocationHeader is the request header a proxy in front of the service sets to the client's
+	// coarse location, e.g. "CF-IPCountry". Empty only compares devices.
+	LocationHeader string `env:"LOCATION_HEADER"`
+
+	// TrustedDeviceDays is how long a device trusted when completing MFA skips the MFA challenge
+	// on later logins. 0 doesn't let devices be trusted.
+	TrustedDeviceDays int `env:"TRUSTED_DEVICE_DAYS" envDefault:"30"`
+
+	// TOTPIssuer is the name authenticator apps show next to the account
+	TOTPIssuer string `env:"TOTP_ISSUER" envDefault:"Account Management"`
+
+	// SMSProvider turns on phone numbers as a second factor and delivers their codes: log (only
+	// logs them) or twilio. Empty leaves it off. Dev mode always logs them.
+	SMSProvider      string `env:"SMS_PROVIDER"`
+	TwilioAccountSID string `env:"TWILIO_ACCOUNT_SID"`
+	TwilioAuthToken  string `env:"TWILIO_AUTH_TOKEN"`
+	// TwilioFrom is the Twilio phone number codes are sent from, e.g. +14155550123
+	TwilioFrom string `env:"TWILIO_FROM"`
+	// SMSCodeLength is how many digits codes sent to phones have, SMSCodeTTLSeconds how long they
+	// work, and SMSResendSeconds how long until another can be sent to the same account
+	SMSCodeLength     int `env:"SMS_CODE_LENGTH" envDefault:"6"`
+	SMSCodeTTLSeconds int `env:"SMS_CODE_TTL_SECONDS" envDefault:"300"`
+	SMSResendSeconds  int `env:"SMS_RESEND_SECONDS" envDefault:"60"`
+
+	// PasswordHashAlgorithm hashes new and changed passwords, bcrypt or argon2id. Existing hashes
+	// made with another algorithm or cost are upgraded the next time the account logs in.
+	PasswordHashAlgorithm string `env:"PASSWORD_HASH_ALGORITHM" envDefault:"bcrypt"`
+	// BcryptCost is the log2 of bcrypt's rounds
+	BcryptCost int `env:"BCRYPT_COST" envDefault:"10"`
+	// Argon2Memory is in KiB, Argon2Time is the number of passes over it, and Argon2Threads the
+	// lanes hashed in parallel
+	Argon2Memory  uint32 `env:"ARGON2_MEMORY_KIB" envDefault:"65536"`
+	Argon2Time    uint32 `env:"ARGON2_TIME" envDefault:"3"`
+	Argon2Threads uint8  `env:"ARGON2_THREADS" envDefault:"2"`
+
+	// The password policy new passwords have to follow. PasswordMaxLength can't be more than 72,
+	// the most bcrypt hashes. PasswordBannedListFile is an optional list of common passwords, one
+	// per line, that are rejected whatever their case.
+	PasswordMinLength        int    `env:"PASSWORD_MIN_LENGTH" envDefault:"8"`
+	PasswordMaxLength        int    `env:"PASSWORD_MAX_LENGTH" envDefault:"72"`
+	PasswordRequireUppercase bool   `env:"PASSWORD_REQUIRE_UPPERCASE" envDefault:"true"`
+	PasswordRequireLowercase bool   `env:"PASSWORD_REQUIRE_LOWERCASE" envDefault:"true"`
+	PasswordRequireDigit     bool   `env:"PASSWORD_REQUIRE_DIGIT" envDefault:"true"`
+	PasswordRequireSpecial   bool   `env:"PASSWORD_REQUIRE_SPECIAL" envDefault:"true"`
+	PasswordDisallowEmail    bool   `env:"PASSWORD_DISALLOW_EMAIL" envDefault:"true"`
+	PasswordBannedListFile   string `env:"PASSWORD_BANNED_LIST_FILE"`
+
+	// ChangePasswordURL is the hosted password change page that /.well-known/change-password
+	// redirects password managers to. The well-known URL 404s without it.
+	ChangePasswordURL string `env:"CHANGE_PASSWORD_URL"`
+
+	// Sign in with Apple is enabled when AppleClientID is set. The private key is the .p8
+	// "Sign in with Apple" key from the Apple developer portal.
+	AppleTeamID         string `env:"APPLE_TEAM_ID"`
+	AppleClientID       string `env:"APPLE_CLIENT_ID"`
+	AppleKeyID          string `env:"APPLE_KEY_ID"`
+	ApplePrivateKeyFile string `env:"APPLE_PRIVATE_KEY_FILE"`
+	AppleRedirectURL    string `env:"APPLE_REDIRECT_URL"`
+
+	// CaptchaSecret enables captcha verification with CaptchaProvider: turnstile, hcaptcha, or
+	// recaptcha. CaptchaVerifyURL overrides the provider's siteverify endpoint. Registering and
+	// forgot password requests then always need a solved captcha, and logins once the client
+	// IP failed CaptchaLoginFailures of them within an hour. Clients render the widget with
+	// CaptchaSiteKey.
+	CaptchaProvider      string `env:"CAPTCHA_PROVIDER" envDefault:"turnstile"`
+	CaptchaSiteKey       string `env:"CAPTCHA_SITE_KEY"`
+	CaptchaSecret        string `env:"CAPTCHA_SECRET"`
+	CaptchaVerifyURL     string `env:"CAPTCHA_VERIFY_URL"`
+	CaptchaLoginFailures int    `env:"CAPTCHA_LOGIN_FAILURES" envDefault:"3"`
+
+	// BreachedPasswordCheck checks passwords chosen on registration and password change against
+	// the Have I Been Pwned range API: off, warn (flag them in the response), or enforce (reject
+	// them). Checks that fail or take longer than HIBPTimeoutMillis let the password through.
+	BreachedPasswordCheck string `env:"BREACHED_PASSWORD_CHECK" envDefault:"off"`
+	HIBPRangeURL          string `env:"HIBP_RANGE_URL"`
+	HIBPTimeoutMillis     int    `env:"HIBP_TIMEOUT_MS" envDefault:"2000"`
+
+	// EmailAvailabilityRequireCaptcha only reveals whether an email or username is taken after a
+	// captcha is verified, so the availability checks can't be used to enumerate accounts.
+	EmailAvailabilityRequireCaptcha bool `env:"EMAIL_AVAILABILITY_REQUIRE_CAPTCHA" envDefault:"true"`
+	// EmailAvailabilityLimit is how many availability checks a client IP gets per minute
+	EmailAvailabilityLimit int `env:"EMAIL_AVAILABILITY_LIMIT" envDefault:"10"`
+
+	// IPAllowlist and IPDenylist are CIDR ranges (or single addresses) let in or kept out of
+	// every route. CountryAllowlist and CountryDenylist do the same by ISO country code, looked
+	// up in the MaxMind DB at GeoIPDBFile. When any allowlist is set only addresses on one are
+	// let in, and denylists win over allowlists. The Admin lists apply to /v1/admin on top of
+	// the global ones.
+	IPAllowlist           []string `env:"IP_ALLOWLIST" envSeparator:","`
+	IPDenylist            []string `env:"IP_DENYLIST" envSeparator:","`
+	CountryAllowlist      []string `env:"COUNTRY_ALLOWLIST" envSeparator:","`
+	CountryDenylist       []string `env:"COUNTRY_DENYLIST" envSeparator:","`
+	AdminIPAllowlist      []string `env:"ADMIN_IP_ALLOWLIST" envSeparator:","`
+	AdminIPDenylist       []string `env:"ADMIN_IP_DENYLIST" envSeparator:","`
+	AdminCountryAllowlist []string `env:"ADMIN_COUNTRY_ALLOWLIST" envSeparator:","`
+	AdminCountryDenylist  []string `env:"ADMIN_COUNTRY_DENYLIST" envSeparator:","`
+	GeoIPDBFile           string   `env:"GEOIP_DB_FILE"`
+
+	// TrustedProxies are the CIDR ranges (or single addresses) of the proxies in front of the
+	// service, like a load balancer. Requests through them are attributed to the client their
+	// X-Forwarded-For header names, for rate limits, IP filters, sign-in locations, and audit
+	// events. Without them every request is attributed to the address it came from, which behind
+	// a proxy is the proxy's.
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:","`
+
+	// RateLimitEnabled limits how often each client can call the routes in RateLimits.
+	// Buckets are kept in Redis when RedisURL is set.
+	RateLimitEnabled bool `env:"RATE_LIMIT_ENABLED" envDefault:"true"`
+	// RateLimits are token bucket limits keyed by route, e.g. "POST /v1/accounts/login=10/1m".
+	// Limits are per client IP, or per account when they end in "/account".
+	RateLimits map[string]string `env:"RATE_LIMITS" envKeyValSeparator:"=" envDefault:"POST /v1/accounts/login=10/1m,POST /v1/accounts/login/mfa=10/1m,POST /v1/accounts/register=5/1m,POST /v1/accounts/refresh=60/1m,POST /v1/accounts/password/change=5/1m/account,POST /v1/accounts/mfa/totp/verify=10/1m/account,POST /v1/accounts/login/mfa/sms=5/1m,POST /v1/accounts/mfa/sms/setup=5/1m/account,POST /v1/accounts/mfa/sms/verify=10/1m/account,POST /v1/accounts/login/magic-link=5/1m,POST /v1/accounts/login/magic-link/verify=10/1m"`
+
+	// IdempotencyWindowMinutes is how long responses to POSTs sent with an Idempotency-Key header
+	// are kept, for retries to get them again. 0 ignores the header. Responses are kept in Redis
+	// when RedisURL is set.
+	IdempotencyWindowMinutes int `env:"IDEMPOTENCY_WINDOW_MINUTES" envDefault:"60"`
+
+	// PasswordResetLimit is how many password reset emails a client IP can ask for per hour
+	PasswordResetLimit int `env:"PASSWORD_RESET_LIMIT" envDefault:"10"`
+
+	// MagicLinkLogin lets accounts log in with a single-use link emailed to them instead of their
+	// password. Links work for MagicLinkTTLMinutes, and each address can be sent MagicLinkLimit
+	// of them an hour.
+	MagicLinkLogin      bool `env:"MAGIC_LINK_LOGIN" envDefault:"false"`
+	MagicLinkTTLMinutes int  `env:"MAGIC_LINK_TTL_MINUTES" envDefault:"15"`
+	MagicLinkLimit      int  `env:"MAGIC_LINK_LIMIT" envDefault:"5"`
+
+	// DeletedAccountRetentionDays is how long deleted accounts are kept before they're purged for
+	// good. 0 keeps them forever.
+	DeletedAccountRetentionDays int `env:"DELETED_ACCOUNT_RETENTION_DAYS" envDefault:"30"`
+
+	// DeletionGracePeriodDays is how long after an account asks to be erased it's erased, unless
+	// it logs in again before then. A reminder is emailed DeletionReminderDays before the end.
+	DeletionGracePeriodDays int `env:"DELETION_GRACE_PERIOD_DAYS" envDefault:"30"`
+	DeletionReminderDays    int `env:"DELETION_REMINDER_DAYS" envDefault:"7"`
+
+	// CleanupIntervalMinutes is how often expired refresh tokens, emailed links, and audit events
+	// past AuditLogRetentionDays are purged
+	CleanupIntervalMinutes int `env:"CLEANUP_INTERVAL_MINUTES" envDefault:"60"`
+	// AuditLogRetentionDays is how long audit events are kept. 0 keeps them forever.
+	AuditLogRetentionDays int `env:"AUDIT_LOG_RETENTION_DAYS" envDefault:"365"`
+
+	// AuditLogBufferSize is how many audit events can wait to be written in the background. When
+	// it's full events are written before responding. 0 always writes them before responding.
+	AuditLogBufferSize int `env:"AUDIT_LOG_BUFFER_SIZE" envDefault:"1024"`
+
+	// WebhooksEnabled posts account events to the endpoints registered at /internal/webhooks.
+	// Turning it off stops queueing and posting them, endpoints can still be registered.
+	WebhooksEnabled bool `env:"WEBHOOKS_ENABLED" envDefault:"true"`
+
+	// OutboxBroker is where account and session events are published from the outbox: "kafka",
+	// "nats", or empty to not publish them.
+	OutboxBroker string `env:"OUTBOX_BROKER"`
+	// OutboxRetentionHours is how long events are kept in the outbox. Without a broker they're
+	// purged whether or not they were published.
+	OutboxRetentionHours int `env:"OUTBOX_RETENTION_HOURS" envDefault:"72"`
+	// KafkaBrokers are the host:port addresses to bootstrap from. KafkaTopic has to exist.
+	KafkaBrokers []string `env:"KAFKA_BROKERS" envSeparator:","`
+	KafkaTopic   string   `env:"KAFKA_TOPIC" envDefault:"account-events"`
+	// NATSSubjectPrefix is prepended to event types, e.g. accounts.account.created. A JetStream
+	// stream has to capture the subjects.
+	NATSURL           string `env:"NATS_URL" envDefault:"nats://127.0.0.1:4222"`
+	NATSSubjectPrefix string `env:"NATS_SUBJECT_PREFIX" envDefault:"accounts"`
+
+	// ListenReusePort sets SO_REUSEPORT on the listener so a new process can start accepting
+	// connections on the same address before the old one shuts down, for zero-downtime deploys.
+	ListenReusePort bool `env:"LISTEN_REUSEPORT"`
+
+	// TLS is served directly when a certificate and key are configured
+	TLSCertFile string `env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE"`
+	// TLSAutocertDomains serves TLS with certificates for these domains from an ACME CA, Let's
+	// Encrypt unless TLSAutocertDirectoryURL says otherwise. Certificates are kept in
+	// TLSAutocertCacheDir so restarts don't request new ones; replicas should share it.
+	TLSAutocertDomains      []string `env:"TLS_AUTOCERT_DOMAINS" envSeparator:","`
+	TLSAutocertEmail        string   `env:"TLS_AUTOCERT_EMAIL"`
+	TLSAutocertCacheDir     string   `env:"TLS_AUTOCERT_CACHE_DIR" envDefault:"autocert"`
+	TLSAutocertDirectoryURL string   `env:"TLS_AUTOCERT_DIRECTORY_URL"`
+	// HTTPRedirectAddress listens for plain HTTP and redirects it to HTTPS, e.g. ":80". With
+	// autocert it answers the CA's HTTP-01 challenges too.
+	HTTPRedirectAddress string `env:"HTTP_REDIRECT_ADDRESS"`
+	// MTLSClientCAFile enables client certificate authentication for internal callers. Certificates
+	// are optional at the TLS layer and only required by routes that ask for them.
+	MTLSClientCAFile string `env:"MTLS_CLIENT_CA_FILE"`
+	// MTLSClientIdentities maps client certificate SANs to internal service identities,
+	// e.g. "spiffe://internal/billing=billing,reports.internal=reporting".
+	MTLSClientIdentities map[string]string `env:"MTLS_CLIENT_IDENTITIES" envKeyValSeparator:"="`
+	// GRPCAddress serves the gRPC versions of the internal routes, e.g. ":9090". Callers need a
+	// client certificate mapped in MTLSClientIdentities, there's no HMAC signing over gRPC.
+	GRPCAddress string `env:"GRPC_ADDRESS"`
+	// InternalHMACKeys are the per-service keys for signed /internal requests, as key ID = secret,
+	// e.g. "billing=<secret>,provisioning=<secret>". The key ID is the calling service's identity.
+	InternalHMACKeys map[string]string `env:"INTERNAL_HMAC_KEYS" envKeyValSeparator:"="`
+	// MTLSBindTokens binds access tokens issued over mTLS to the client certificate.
+	MTLSBindTokens bool `env:"MTLS_BIND_TOKENS"`
+
+	// FeatureFlagDefaults are the flag values for accounts that don't override them,
+	// e.g. "new-dashboard=true,beta-search=false". Flags that aren't listed default to off.
+	FeatureFlagDefaults map[string]bool `env:"FEATURE_FLAG_DEFAULTS" envKeyValSeparator:"="`
+	// TokenFeatureFlags are the flags copied into access tokens as the "flags" claim. Keep the
+	// list short, every token carries it.
+	TokenFeatureFlags []string `env:"TOKEN_FEATURE_FLAGS"`
+	// TokenAppMetadataKeys are the app_metadata keys copied into access tokens as the
+	// "app_metadata" claim, for the accounts that have them. Like TOKEN_FEATURE_FLAGS, keep the
+	// list short.
+	TokenAppMetadataKeys []string `env:"TOKEN_APP_METADATA_KEYS"`
+
+	// Any string setting can be a secret reference instead of a value: file:///path for mounted
+	// files, vault://path#key for Vault's KV engine at VaultAddress, or awssm://name#key for AWS
+	// Secrets Manager in AWSRegion. They're resolved on startup, and re-read every
+	// SecretsRefreshSeconds when it's set. A new JWT_SECRET_KEY or JWT_SIGNING_KEY is rotated in
+	// without a restart, other settings only change on the next one.
+	SecretsRefreshSeconds int `env:"SECRETS_REFRESH_SECONDS"`
+	// VaultAddress is the Vault server vault:// references are read from with VaultToken, in the
+	// Enterprise VaultNamespace if any. VaultToken can be a file:// reference itself, like the
+	// token file the Vault agent writes.
+	VaultAddress   string `env:"VAULT_ADDR"`
+	VaultToken     string `env:"VAULT_TOKEN"`
+	VaultNamespace string `env:"VAULT_NAMESPACE"`
+	// AWSRegion is where awssm:// references are read from, signed with AWSAccessKeyID,
+	// AWSSecretAccessKey, and for temporary credentials AWSSessionToken.
+	// AWSSecretsManagerEndpoint overrides the region's endpoint.
+	AWSRegion                 string `env:"AWS_REGION"`
+	AWSAccessKeyID            string `env:"AWS_ACCESS_KEY_ID"`
+	AWSSecretAccessKey        string `env:"AWS_SECRET_ACCESS_KEY"`
+	AWSSessionToken           string `env:"AWS_SESSION_TOKEN"`
+	AWSSecretsManagerEndpoint string `env:"AWS_SECRETS_MANAGER_ENDPOINT"`
+	// SecretRefs are the references settings were resolved from, by environment variable
+	SecretRefs map[string]secrets.Reference
 }
 
-func Load() (*Config, error) {
+// Storage values
+const (
+	StorageDatabase = "database"
+	StorageMemory   = "memory"
+)
+
+// DBDriver values
+const (
+	DBDriverPostgres = "postgres"
+	DBDriverSQLite   = "sqlite"
+)
+
+// MailProvider values
+const (
+	MailProviderLog      = "log"
+	MailProviderSMTP     = "smtp"
+	MailProviderSendGrid = "sendgrid"
+)
+
+// SMSProvider values
+const (
+	SMSProviderLog    = "log"
+	SMSProviderTwilio = "twilio"
+)
+
+// CaptchaProvider values
+const (
+	CaptchaProviderTurnstile = "turnstile"
+	CaptchaProviderHCaptcha  = "hcaptcha"
+	CaptchaProviderReCAPTCHA = "recaptcha"
+)
+
+// BreachedPasswordCheck values
+const (
+	BreachedPasswordCheckOff     = "off"
+	BreachedPasswordCheckWarn    = "warn"
+	BreachedPasswordCheckEnforce = "enforce"
+)
+
+// SessionCookieSameSite values
+const (
+	SameSiteStrict = "strict"
+	SameSiteLax    = "lax"
+	SameSiteNone   = "none"
+)
+
+// MockJWTSecretKey signs tokens in mock mode when no JWT_SECRET_KEY is set. It's fixed so that
+// tokens stay valid across restarts and downstream services can verify them.
+const MockJWTSecretKey = "account-management-mock-secret-key"
+
+// Overrides are set from command line flags and take precedence over the environment.
+type Overrides struct {
+	DevMode      bool
+	MockMode     bool
+	FixturesPath string
+	// ConfigFile is a YAML or TOML config file, instead of the one in CONFIG_FILE
+	ConfigFile string
+}
+
+// Load parses the config, applies any overrides, and validates it. Settings are layered: the
+// defaults, then the config file in CONFIG_FILE if there is one, then the environment. A config
+// with problems fails with a *ValidationError listing all of them.
+func Load(overrides Overrides) (*Config, error) {
 	var cfg Config
 
 	// for local dev, default config with .env if enabled
@@ -26,16 +466,166 @@ func Load() (*Config, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error loading .env file: %w", err)
 		}
+	}
 
-		// reparse after godotenv sets the environment up
-		if err := env.Parse(&cfg); err != nil {
-			return nil, fmt.Errorf("error parsing config: %w", err)
+	environment := env.ToMap(os.Environ())
+	path := overrides.ConfigFile
+	if path == "" {
+		path = environment["CONFIG_FILE"]
+	}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range values {
+			if _, ok := environment[name]; !ok {
+				environment[name] = value
+			}
 		}
 	}
 
-	if err := env.Parse(&cfg); err != nil {
+	if err := env.ParseWithOptions(&cfg, env.Options{Environment: environment}); err != nil {
 		return nil, fmt.Errorf("error parsing config: %w", err)
 	}
 
+	if overrides.DevMode {
+		cfg.DevMode = true
+	}
+	if overrides.MockMode {
+		cfg.MockMode = true
+	}
+	if overrides.FixturesPath != "" {
+		cfg.FixturesPath = overrides.FixturesPath
+	}
+
+	if err := cfg.resolveSecrets(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if cfg.MockMode {
+		cfg.DevMode = true
+		if cfg.JWTSecretKey == "" {
+			cfg.JWTSecretKey = MockJWTSecretKey
+		}
+	}
+
+	if cfg.DevMode {
+		cfg.Storage = StorageMemory
+		// tokens only need to survive as long as the process does
+		if cfg.JWTSecretKey == "" {
+			key, err := ephemeralKey()
+			if err != nil {
+				return nil, fmt.Errorf("error generating ephemeral JWT key: %w", err)
+			}
+			cfg.JWTSecretKey = key
+		}
+	}
+
+	if cfg.OIDCIssuer != "" {
+		// clients compare the issuer exactly, so there's only one way to write it
+		cfg.OIDCIssuer = strings.TrimSuffix(cfg.OIDCIssuer, "/")
+		if cfg.OIDCAuthorizationURL == "" {
+			cfg.OIDCAuthorizationURL = strings.TrimSuffix(cfg.AppURL, "/") + "/oauth/authorize"
+		}
+	}
+	cfg.SAMLBaseURL = strings.TrimSuffix(cfg.SAMLBaseURL, "/")
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
+
+// TLSEnabled reports whether the server serves TLS itself, with a certificate file or autocert
+func (c Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || len(c.TLSAutocertDomains) > 0
+}
+
+// SecretsConfig is the secrets providers' settings for secrets.NewResolver
+func (c Config) SecretsConfig() secrets.Config {
+	return secrets.Config{
+		Vault: secrets.VaultConfig{
+			Address:   c.VaultAddress,
+			Token:     c.VaultToken,
+			Namespace: c.VaultNamespace,
+		},
+		AWS: secrets.AWSConfig{
+			Region:          c.AWSRegion,
+			AccessKeyID:     c.AWSAccessKeyID,
+			SecretAccessKey: c.AWSSecretAccessKey,
+			SessionToken:    c.AWSSessionToken,
+			Endpoint:        c.AWSSecretsManagerEndpoint,
+		},
+	}
+}
+
+// SlogLevel is LOG_LEVEL as a slog.Level, info if it isn't one
+func (c Config) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// PasswordHasherConfig is the password hashing settings for auth.NewPasswordHasher
+func (c Config) PasswordHasherConfig() auth.HasherConfig {
+	return auth.HasherConfig{
+		Algorithm:     c.PasswordHashAlgorithm,
+		BcryptCost:    c.BcryptCost,
+		Argon2Memory:  c.Argon2Memory,
+		Argon2Time:    c.Argon2Time,
+		Argon2Threads: c.Argon2Threads,
+	}
+}
+
+// PasswordPolicyConfig is the password policy for auth.NewPasswordPolicy, without the banned
+// passwords in PasswordBannedListFile
+func (c Config) PasswordPolicyConfig() auth.PasswordPolicyConfig {
+	return auth.PasswordPolicyConfig{
+		MinLength:        c.PasswordMinLength,
+		MaxLength:        c.PasswordMaxLength,
+		RequireUppercase: c.PasswordRequireUppercase,
+		RequireLowercase: c.PasswordRequireLowercase,
+		RequireDigit:     c.PasswordRequireDigit,
+		RequireSpecial:   c.PasswordRequireSpecial,
+		DisallowEmail:    c.PasswordDisallowEmail,
+	}
+}
+
+// APIVersionDeprecation is when a version of the public API was deprecated and, unless it's zero,
+// when it stops working
+type APIVersionDeprecation struct {
+	Since  time.Time
+	Sunset time.Time
+}
+
+// ParseAPIVersionDeprecations parses APIVersionDeprecations, keyed by version
+func (c Config) ParseAPIVersionDeprecations() (map[string]APIVersionDeprecation, error) {
+	result := map[string]APIVersionDeprecation{}
+	for version, dates := range c.APIVersionDeprecations {
+		since, sunset, hasSunset := strings.Cut(dates, "/")
+		var d APIVersionDeprecation
+		var err error
+		if d.Since, err = time.Parse(time.DateOnly, since); err != nil {
+			return nil, fmt.Errorf("invalid deprecation of %s %q, expected e.g. 2026-10-01 or 2026-10-01/2027-04-01", version, dates)
+		}
+		if hasSunset {
+			if d.Sunset, err = time.Parse(time.DateOnly, sunset); err != nil || !d.Sunset.After(d.Since) {
+				return nil, fmt.Errorf("invalid deprecation of %s %q, the sunset has to be a date after the deprecation", version, dates)
+			}
+		}
+		result[version] = d
+	}
+	return result, nil
+}
+
+func ephemeralKey() (string, error) {
+	b := make([]byte, 64)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Change is a setting that's different in another config
+type Change struct {
+	// Setting is the environment variable, e.g. ACCESS_TOKEN_TTL_MINUTES
+	Setting string
+	// Old and New are written the way they are in the environment
+	Old string
+	New string
+}
+
+// Diff returns the settings that are different in next, sorted by environment variable
+func (c Config) Diff(next Config) []Change {
+	old, updated := reflect.ValueOf(c), reflect.ValueOf(next)
+	var changes []Change
+	for name, s := range settings() {
+		a := s.formatValue(old.FieldByIndex(s.Field.Index))
+		b := s.formatValue(updated.FieldByIndex(s.Field.Index))
+		if a != b {
+			changes = append(changes, Change{Setting: name, Old: a, New: b})
+		}
+	}
+	slices.SortFunc(changes, func(a, b Change) int { return strings.Compare(a.Setting, b.Setting) })
+	return changes
+}
+
+// formatValue writes a field's value the way it's written in the environment. Map keys are
+// sorted so equal maps are written the same way.
+func (s setting) formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(items, s.Separator)
+	case reflect.Map:
+		pairs := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			pairs = append(pairs, fmt.Sprint(iter.Key().Interface())+s.KeyValSeparator+fmt.Sprint(iter.Value().Interface()))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, s.Separator)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
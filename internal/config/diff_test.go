@@ -0,0 +1,37 @@
+package config
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	t.Setenv("PSQL_URL", "postgres://localhost/accounts")
+	t.Setenv("JWT_SECRET_KEY", testSecret)
+	old, err := Load(Overrides{})
+	require.NoError(t, err)
+	assert.Empty(t, old.Diff(*old))
+
+	t.Setenv("ACCESS_TOKEN_TTL_MINUTES", "5")
+	t.Setenv("LOG_LEVEL", "debug")
+	// the same limits in a different order
+	t.Setenv("RATE_LIMITS", "POST /v1/accounts/register=5/1m,POST /v1/accounts/login=10/1m")
+	next, err := Load(Overrides{})
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, next.SlogLevel())
+
+	changes := old.Diff(*next)
+	require.Len(t, changes, 3)
+	assert.Equal(t, Change{Setting: "ACCESS_TOKEN_TTL_MINUTES", Old: "15", New: "5"}, changes[0])
+	assert.Equal(t, Change{Setting: "LOG_LEVEL", Old: "info", New: "debug"}, changes[1])
+	assert.Equal(t, "RATE_LIMITS", changes[2].Setting)
+	assert.Equal(t, "POST /v1/accounts/login=10/1m,POST /v1/accounts/register=5/1m", changes[2].New)
+
+	t.Setenv("RATE_LIMITS", "POST /v1/accounts/login=10/1m,POST /v1/accounts/register=5/1m")
+	reordered, err := Load(Overrides{})
+	require.NoError(t, err)
+	assert.Empty(t, next.Diff(*reordered))
+}
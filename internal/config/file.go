@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setting is one of the Config fields that's set from the environment or a config file
+type setting struct {
+	// Name is the environment variable, e.g. ACCESS_TOKEN_TTL_MINUTES. It's lowercase in config
+	// files, e.g. access_token_ttl_minutes.
+	Name  string
+	Field reflect.StructField
+	// Separator joins the items of lists and maps, KeyValSeparator the keys and values of maps
+	Separator       string
+	KeyValSeparator string
+}
+
+// settings are the Config fields by environment variable, parsed from their tags once
+var settings = sync.OnceValue(func() map[string]setting {
+	all := map[string]setting{}
+	t := reflect.TypeFor[Config]()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		if name == "" {
+			continue
+		}
+
+		s := setting{Name: name, Field: field, Separator: ",", KeyValSeparator: ":"}
+		if sep, ok := field.Tag.Lookup("envSeparator"); ok {
+			s.Separator = sep
+		}
+		if sep, ok := field.Tag.Lookup("envKeyValSeparator"); ok {
+			s.KeyValSeparator = sep
+		}
+		all[name] = s
+	}
+	return all
+})
+
+// readFile reads a YAML (.yaml, .yml, or .json) or TOML (.toml) config file into the environment
+// variables it sets. Keys are settings in any case, e.g. mail_provider for MAIL_PROVIDER. Lists
+// are arrays and maps are tables, or either can be written the way they are in the environment.
+func readFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var values map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+		err = yaml.Unmarshal(b, &values)
+	case ".toml":
+		values, err = parseTOML(string(b))
+	default:
+		return nil, fmt.Errorf("error reading config file %s: unknown format %q, it must be .yaml, .yml, .json, or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	environment := make(map[string]string, len(values))
+	var errs []error
+	for key, value := range values {
+		name := strings.ToUpper(key)
+		s, ok := settings()[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown setting %q", key))
+			continue
+		}
+		str, err := s.format(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		environment[name] = str
+	}
+	if len(errs) > 0 {
+		// map order isn't stable, the errors are
+		slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, errors.Join(errs...))
+	}
+	return environment, nil
+}
+
+// format writes a value from a config file the way it's written in the environment
+func (s setting) format(value any) (string, error) {
+	switch s.Field.Type.Kind() {
+	case reflect.Slice:
+		if items, ok := value.([]any); ok {
+			strs := make([]string, 0, len(items))
+			for _, item := range items {
+				str, err := formatScalar(item)
+				if err != nil {
+					return "", err
+				}
+				strs = append(strs, str)
+			}
+			return strings.Join(strs, s.Separator), nil
+		}
+	case reflect.Map:
+		if table, ok := value.(map[string]any); ok {
+			keys := make([]string, 0, len(table))
+			for key := range table {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			pairs := make([]string, 0, len(table))
+			for _, key := range keys {
+				str, err := formatScalar(table[key])
+				if err != nil {
+					return "", fmt.Errorf("%s: %w", key, err)
+				}
+				pairs = append(pairs, key+s.KeyValSeparator+str)
+			}
+			return strings.Join(pairs, s.Separator), nil
+		}
+	}
+	return formatScalar(value)
+}
+
+func formatScalar(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("must be a string, number, or boolean, got a %T", value)
+	}
+}
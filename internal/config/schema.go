@@ -0,0 +1,219 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// source is this package's config.go, the field comments are the settings' descriptions
+//
+//go:embed config.go
+var source string
+
+// Schema is the JSON Schema of config files, generated from the Config fields and their
+// comments. It's published at docs/config.schema.json, where editors can check files against it.
+func Schema() ([]byte, error) {
+	descriptions, err := fieldDescriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	properties := map[string]any{}
+	for _, s := range settings() {
+		property, err := s.schema()
+		if err != nil {
+			return nil, err
+		}
+		if description := descriptions[s.Field.Name]; description != "" {
+			property["description"] = description
+		}
+		properties[strings.ToLower(s.Name)] = property
+	}
+
+	b, err := json.MarshalIndent(map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "account-management config file",
+		"description":          "Settings for a YAML or TOML file passed with -config or CONFIG_FILE. Each one is the lowercase name of an environment variable, which take precedence over the file.",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           properties,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error generating config schema: %w", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// schema is the setting's JSON Schema, with its envDefault as the default
+func (s setting) schema() (map[string]any, error) {
+	property := map[string]any{"type": jsonType(s.Field.Type)}
+	switch s.Field.Type.Kind() {
+	case reflect.Slice:
+		property["items"] = map[string]any{"type": jsonType(s.Field.Type.Elem())}
+	case reflect.Map:
+		property["additionalProperties"] = map[string]any{"type": jsonType(s.Field.Type.Elem())}
+	}
+
+	def, ok := s.Field.Tag.Lookup("envDefault")
+	if !ok {
+		return property, nil
+	}
+	// the default goes through the same parsing a value from the environment would
+	v := reflect.New(s.Field.Type)
+	if err := parseInto(v.Interface(), s, def); err != nil {
+		return nil, fmt.Errorf("error parsing the default of %s: %w", s.Name, err)
+	}
+	property["default"] = v.Elem().Interface()
+	return property, nil
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64, reflect.Uint8, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "array"
+	case reflect.Map:
+		return "object"
+	default:
+		return "string"
+	}
+}
+
+// parseInto parses value, written the way it would be in the environment, into dst
+func parseInto(dst any, s setting, value string) error {
+	v := reflect.ValueOf(dst).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint8, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		items := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(value, s.Separator) {
+			elem := reflect.New(v.Type().Elem())
+			if err := parseInto(elem.Interface(), s, item); err != nil {
+				return err
+			}
+			items = reflect.Append(items, elem.Elem())
+		}
+		v.Set(items)
+	case reflect.Map:
+		entries := reflect.MakeMap(v.Type())
+		for _, pair := range strings.Split(value, s.Separator) {
+			key, val, ok := strings.Cut(pair, s.KeyValSeparator)
+			if !ok {
+				return fmt.Errorf("%q isn't a key%svalue pair", pair, s.KeyValSeparator)
+			}
+			elem := reflect.New(v.Type().Elem())
+			if err := parseInto(elem.Interface(), s, val); err != nil {
+				return err
+			}
+			entries.SetMapIndex(reflect.ValueOf(key), elem.Elem())
+		}
+		v.Set(entries)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+var identifier = regexp.MustCompile(`\b[A-Z][A-Za-z0-9]+\b`)
+
+// fieldDescriptions are the comments on the Config fields, by field name. A comment covers the
+// fields right below it, up to a blank line or the next comment. Field names in them are
+// replaced with the names of their settings.
+func fieldDescriptions() (map[string]string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "config.go", source, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config.go: %w", err)
+	}
+
+	var fields *ast.FieldList
+	ast.Inspect(file, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok && spec.Name.Name == "Config" {
+			if st, ok := spec.Type.(*ast.StructType); ok {
+				fields = st.Fields
+			}
+			return false
+		}
+		return fields == nil
+	})
+	if fields == nil {
+		return nil, fmt.Errorf("error parsing config.go: no Config struct")
+	}
+
+	names := map[string]string{}
+	for _, s := range settings() {
+		names[s.Field.Name] = strings.ToLower(s.Name)
+	}
+
+	descriptions := map[string]string{}
+	var doc *ast.CommentGroup
+	lastLine := 0
+	for _, field := range fields.List {
+		line := fset.Position(field.Pos()).Line
+		switch {
+		case field.Doc != nil:
+			doc = field.Doc
+		case line != lastLine+1:
+			doc = nil
+		}
+		lastLine = fset.Position(field.End()).Line
+
+		if doc == nil {
+			continue
+		}
+		words := identifier.FindAllString(doc.Text(), -1)
+		text := strings.Join(strings.Fields(doc.Text()), " ")
+		text = identifier.ReplaceAllStringFunc(text, func(word string) string {
+			if name, ok := names[word]; ok {
+				return name
+			}
+			return word
+		})
+		for _, name := range field.Names {
+			// the fields below a comment only share it when it's about them too
+			if field.Doc != nil || slices.Contains(words, name.Name) {
+				descriptions[name.Name] = text
+			}
+		}
+	}
+	return descriptions, nil
+}
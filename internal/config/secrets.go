@@ -0,0 +1,69 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/service/secrets"
+)
+
+// resolveSecrets replaces the string settings that are secret references with the secrets they
+// point to, remembering the references in SecretRefs. Every reference that can't be resolved is
+// reported in a *ValidationError.
+func (c *Config) resolveSecrets(ctx context.Context) error {
+	var p problems
+
+	// the Vault token is read first, the other references might need it
+	if ref, ok := secrets.ParseReference(c.VaultToken); ok && ref.Scheme == secrets.SchemeFile {
+		token, err := secrets.FileProvider{}.Fetch(ctx, ref)
+		if err != nil {
+			p.add("VAULT_TOKEN", "error resolving %s: %v", ref, err)
+		}
+		c.VaultToken = token
+	}
+
+	resolver := secrets.NewResolver(c.SecretsConfig())
+	v := reflect.ValueOf(c).Elem()
+	for name, s := range settings() {
+		if s.Field.Type.Kind() != reflect.String {
+			continue
+		}
+		field := v.FieldByIndex(s.Field.Index)
+		ref, ok := secrets.ParseReference(field.String())
+		if !ok {
+			continue
+		}
+
+		secret, err := resolver.Resolve(ctx, ref)
+		if err != nil {
+			p.add(name, "%v", err)
+			continue
+		}
+		field.SetString(secret)
+		if c.SecretRefs == nil {
+			c.SecretRefs = map[string]secrets.Reference{}
+		}
+		c.SecretRefs[name] = ref
+	}
+
+	if len(p) == 0 {
+		return nil
+	}
+	slices.SortFunc(p, func(a, b Problem) int { return strings.Compare(a.Field, b.Field) })
+	return &ValidationError{Problems: p}
+}
+
+// SecretValues are the values the settings in SecretRefs were resolved to, by environment
+// variable
+func (c Config) SecretValues() map[string]string {
+	values := make(map[string]string, len(c.SecretRefs))
+	v := reflect.ValueOf(c)
+	for name := range c.SecretRefs {
+		if s, ok := settings()[name]; ok {
+			values[name] = v.FieldByIndex(s.Field.Index).String()
+		}
+	}
+	return values
+}
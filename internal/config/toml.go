@@ -0,0 +1,407 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses the parts of TOML config files use: tables, dotted and quoted keys, strings
+// (including multi-line ones, for PEM keys), integers, floats, booleans, arrays, and inline
+// tables. Dates and arrays of tables aren't supported, no setting takes them.
+func parseTOML(src string) (map[string]any, error) {
+	p := &tomlParser{src: src}
+	root := map[string]any{}
+	if err := p.parse(root); err != nil {
+		return nil, fmt.Errorf("line %d: %w", strings.Count(src[:p.pos], "\n")+1, err)
+	}
+	return root, nil
+}
+
+type tomlParser struct {
+	src string
+	pos int
+}
+
+func (p *tomlParser) parse(root map[string]any) error {
+	table := root
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil
+		}
+
+		if p.peek() == '[' {
+			p.pos++
+			if p.peek() == '[' {
+				return errors.New("arrays of tables aren't supported")
+			}
+			p.skipBlank(false)
+			path, err := p.key()
+			if err != nil {
+				return err
+			}
+			p.skipBlank(false)
+			if !p.consume("]") {
+				return errors.New("expected ] after the table name")
+			}
+			if table, err = subtable(root, path, true); err != nil {
+				return err
+			}
+		} else if err := p.keyValue(table); err != nil {
+			return err
+		}
+
+		p.skipBlank(false)
+		if !p.eof() && !p.consume("\n") && !p.consume("\r\n") {
+			return fmt.Errorf("expected a new line, got %q", p.peek())
+		}
+	}
+}
+
+// keyValue parses key = value into table
+func (p *tomlParser) keyValue(table map[string]any) error {
+	path, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if !p.consume("=") {
+		return fmt.Errorf("expected = after %s", strings.Join(path, "."))
+	}
+	p.skipBlank(false)
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+
+	parent, err := subtable(table, path[:len(path)-1], false)
+	if err != nil {
+		return err
+	}
+	name := path[len(path)-1]
+	if _, ok := parent[name]; ok {
+		return fmt.Errorf("%s is set more than once", strings.Join(path, "."))
+	}
+	parent[name] = value
+	return nil
+}
+
+// subtable returns the table at path under table, creating it. A [header] can't repeat a table.
+func subtable(table map[string]any, path []string, header bool) (map[string]any, error) {
+	for i, name := range path {
+		existing, ok := table[name]
+		if !ok {
+			next := map[string]any{}
+			table[name] = next
+			table = next
+			continue
+		}
+		next, isTable := existing.(map[string]any)
+		if !isTable || (header && i == len(path)-1) {
+			return nil, fmt.Errorf("%s is set more than once", strings.Join(path[:i+1], "."))
+		}
+		table = next
+	}
+	return table, nil
+}
+
+// key parses a dotted key like a."b c".d
+func (p *tomlParser) key() ([]string, error) {
+	var path []string
+	for {
+		var part string
+		switch p.peek() {
+		case '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		case '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, fmt.Errorf("expected a key, got %q", p.peek())
+			}
+			part = p.src[start:p.pos]
+		}
+		path = append(path, part)
+
+		p.skipBlank(false)
+		if !p.consume(".") {
+			return path, nil
+		}
+		p.skipBlank(false)
+	}
+}
+
+func (p *tomlParser) value() (any, error) {
+	switch {
+	case p.eof():
+		return nil, errors.New("expected a value")
+	case strings.HasPrefix(p.src[p.pos:], `"""`):
+		return p.multilineString(`"""`, true)
+	case strings.HasPrefix(p.src[p.pos:], `'''`):
+		return p.multilineString(`'''`, false)
+	case p.peek() == '"':
+		return p.basicString()
+	case p.peek() == '\'':
+		return p.literalString()
+	case p.peek() == '[':
+		return p.array()
+	case p.peek() == '{':
+		return p.inlineTable()
+	}
+
+	start := p.pos
+	for !p.eof() && (isBareKeyChar(p.peek()) || strings.ContainsRune("+.:", rune(p.peek()))) {
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+	// base 0 takes TOML's 0x, 0o, and 0b prefixes and _ separators
+	if n, err := strconv.ParseInt(token, 0, 64); err == nil && !isLeadingZero(token) {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(strings.ReplaceAll(token, "_", ""), 64); err == nil && strings.ContainsAny(token, ".eE") {
+		return f, nil
+	}
+	p.pos = start
+	return nil, fmt.Errorf("unsupported value %q", token)
+}
+
+func (p *tomlParser) array() ([]any, error) {
+	p.pos++ // [
+	items := []any{}
+	for {
+		p.skipBlank(true)
+		if p.consume("]") {
+			return items, nil
+		}
+		item, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		p.skipBlank(true)
+		if p.consume("]") {
+			return items, nil
+		}
+		if !p.consume(",") {
+			return nil, errors.New("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (map[string]any, error) {
+	p.pos++ // {
+	table := map[string]any{}
+	p.skipBlank(false)
+	if p.consume("}") {
+		return table, nil
+	}
+	for {
+		p.skipBlank(false)
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.consume("}") {
+			return table, nil
+		}
+		if !p.consume(",") {
+			return nil, errors.New("expected , or } in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++ // '
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", errors.New("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++ // "
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", errors.New("unterminated string")
+		}
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// multilineString parses a multi-line basic or literal string. A new line right after the
+// opening quotes isn't part of it, and in basic strings a \ at the end of a line joins it to the
+// next.
+func (p *tomlParser) multilineString(quotes string, basic bool) (string, error) {
+	p.pos += len(quotes)
+	if !p.consume("\n") {
+		p.consume("\r\n")
+	}
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", errors.New("unterminated string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], quotes) {
+			p.pos += len(quotes)
+			// up to two quotes right before the closing ones are part of the string
+			for i := 0; i < 2 && !p.eof() && p.peek() == quotes[0]; i++ {
+				b.WriteByte(quotes[0])
+				p.pos++
+			}
+			return b.String(), nil
+		}
+
+		c := p.peek()
+		if basic && c == '\\' {
+			rest := strings.TrimLeft(p.src[p.pos+1:], " \t\r")
+			if strings.HasPrefix(rest, "\n") {
+				p.pos = len(p.src) - len(strings.TrimLeft(rest, " \t\r\n"))
+				continue
+			}
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+}
+
+func (p *tomlParser) escape(b *strings.Builder) error {
+	p.pos++ // \
+	if p.eof() {
+		return errors.New("unterminated string")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte('\x1b')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			return errors.New("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return errors.New("invalid unicode escape")
+		}
+		b.WriteRune(rune(code))
+		p.pos += size
+	default:
+		return fmt.Errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// skipBlank skips spaces, tabs, and comments, and new lines too with newlines set
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case newlines && (c == '\n' || c == '\r'):
+			p.pos++
+		case c == '#':
+			if end := strings.IndexByte(p.src[p.pos:], '\n'); end >= 0 {
+				p.pos += end
+			} else {
+				p.pos = len(p.src)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) consume(s string) bool {
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// isLeadingZero reports whether a decimal integer has leading zeros, which TOML doesn't allow
+// and ParseInt would read as octal
+func isLeadingZero(token string) bool {
+	digits := strings.TrimLeft(token, "+-")
+	return len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9'
+}
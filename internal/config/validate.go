@@ -0,0 +1,454 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/featureflags"
+	"github.com/austinwofford/account-management/internal/service/ipfilter"
+	"github.com/austinwofford/account-management/internal/service/metadata"
+	"github.com/austinwofford/account-management/internal/service/ratelimit"
+)
+
+const (
+	// MaxAccessTokenTTLMinutes is a day. Access tokens can't be revoked one by one, so they're
+	// kept short and refreshed.
+	MaxAccessTokenTTLMinutes = 24 * 60
+	// MaxRefreshTokenTTLMinutes is a year
+	MaxRefreshTokenTTLMinutes = 365 * 24 * 60
+	// MaxIdempotencyWindowMinutes is a day. Kept responses can hold tokens, so they aren't kept
+	// for longer than a client could plausibly still be retrying.
+	MaxIdempotencyWindowMinutes = 24 * 60
+
+	// MinSecretLength and MinSecretEntropyBits are what shared secrets like JWT_SECRET_KEY need
+	// to be hard to guess, e.g. from `openssl rand -base64 32`
+	MinSecretLength      = 32
+	MinSecretEntropyBits = 96
+)
+
+// Problem is one thing wrong with the config
+type Problem struct {
+	// Field is the environment variable, or variables, the problem is with
+	Field   string
+	Message string
+}
+
+// ValidationError is every problem Validate found, so they can all be fixed at once
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if len(e.Problems) == 1 {
+		b.WriteString("invalid config, 1 problem:")
+	} else {
+		fmt.Fprintf(&b, "invalid config, %d problems:", len(e.Problems))
+	}
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  - %s: %s", p.Field, p.Message)
+	}
+	return b.String()
+}
+
+type problems []Problem
+
+func (p *problems) add(field, format string, args ...any) {
+	*p = append(*p, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the config and returns a *ValidationError listing every problem, or nil when
+// there are none. Load validates the config after the defaults for dev and mock mode are applied.
+func (c Config) Validate() error {
+	var p problems
+
+	// required settings, dev mode has an in-memory database and an ephemeral key
+	if !c.DevMode {
+		if c.Storage == StorageDatabase && c.DBDriver == DBDriverPostgres && c.PostgresURL == "" {
+			p.add("PSQL_URL", "is required")
+		}
+		// a signing key signs every token, so the secret isn't needed with one
+		if c.JWTSecretKey == "" && c.JWTSigningKey == "" && c.JWTSigningKeyFile == "" {
+			p.add("JWT_SECRET_KEY", "JWT_SECRET_KEY, JWT_SIGNING_KEY, or JWT_SIGNING_KEY_FILE is required")
+		}
+	}
+
+	// tokens
+	if c.AccessTokenTTLMinutes < 1 || c.AccessTokenTTLMinutes > MaxAccessTokenTTLMinutes {
+		p.add("ACCESS_TOKEN_TTL_MINUTES", "must be between 1 and %d (a day), got %d", MaxAccessTokenTTLMinutes, c.AccessTokenTTLMinutes)
+	}
+	if c.RefreshTokenTTLMinutes < 1 || c.RefreshTokenTTLMinutes > MaxRefreshTokenTTLMinutes {
+		p.add("REFRESH_TOKEN_TTL_MINUTES", "must be between 1 and %d (a year), got %d", MaxRefreshTokenTTLMinutes, c.RefreshTokenTTLMinutes)
+	} else if c.RefreshTokenTTLMinutes < c.AccessTokenTTLMinutes {
+		p.add("REFRESH_TOKEN_TTL_MINUTES", "must be at least ACCESS_TOKEN_TTL_MINUTES (%d), got %d", c.AccessTokenTTLMinutes, c.RefreshTokenTTLMinutes)
+	}
+	if c.TokenExchangeTTLMinutes < 1 {
+		p.add("TOKEN_EXCHANGE_TTL_MINUTES", "must be at least 1, got %d", c.TokenExchangeTTLMinutes)
+	} else if c.AccessTokenTTLMinutes >= 1 && c.TokenExchangeTTLMinutes > c.AccessTokenTTLMinutes {
+		p.add("TOKEN_EXCHANGE_TTL_MINUTES", "can't be more than ACCESS_TOKEN_TTL_MINUTES (%d), got %d", c.AccessTokenTTLMinutes, c.TokenExchangeTTLMinutes)
+	}
+	if c.RefreshTokenGraceSeconds < 0 {
+		p.add("REFRESH_TOKEN_GRACE_SECONDS", "can't be negative")
+	}
+	// dev mode keys only live as long as the process, and the mock key is public on purpose
+	if c.JWTSecretKey != "" && !c.DevMode {
+		if msg := weakSecret(c.JWTSecretKey); msg != "" {
+			p.add("JWT_SECRET_KEY", "%s", msg)
+		}
+	}
+	if c.JWTEncryptionKey != "" {
+		if _, err := auth.DecodeEncryptionKey(c.JWTEncryptionKey); err != nil {
+			p.add("JWT_ENCRYPTION_KEY", "must be a base64 encoded %d byte key: %v", auth.EncryptionKeySize, err)
+		}
+	}
+	if c.JWTSigningKey != "" && c.JWTSigningKeyFile != "" {
+		p.add("JWT_SIGNING_KEY", "only one of JWT_SIGNING_KEY and JWT_SIGNING_KEY_FILE can be set")
+	}
+
+	// secrets
+	if c.SecretsRefreshSeconds < 0 {
+		p.add("SECRETS_REFRESH_SECONDS", "can't be negative")
+	}
+	checkURL(&p, "VAULT_ADDR", c.VaultAddress, "https", "http")
+	checkURL(&p, "AWS_SECRETS_MANAGER_ENDPOINT", c.AWSSecretsManagerEndpoint, "https", "http")
+
+	// TLS and listeners
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		p.add("TLS_CERT_FILE", "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.TLSCertFile != "" && len(c.TLSAutocertDomains) > 0 {
+		p.add("TLS_CERT_FILE", "only one of TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS can be set")
+	}
+	checkURL(&p, "TLS_AUTOCERT_DIRECTORY_URL", c.TLSAutocertDirectoryURL, "https", "http")
+	if c.MTLSClientCAFile != "" && !c.TLSEnabled() {
+		p.add("MTLS_CLIENT_CA_FILE", "requires TLS_CERT_FILE and TLS_KEY_FILE, or TLS_AUTOCERT_DOMAINS")
+	}
+	if c.HTTPRedirectAddress != "" && !c.TLSEnabled() {
+		p.add("HTTP_REDIRECT_ADDRESS", "requires TLS_CERT_FILE and TLS_KEY_FILE, or TLS_AUTOCERT_DOMAINS")
+	}
+	if c.GRPCAddress != "" && (c.MTLSClientCAFile == "" || len(c.MTLSClientIdentities) == 0) {
+		p.add("GRPC_ADDRESS", "requires MTLS_CLIENT_CA_FILE and MTLS_CLIENT_IDENTITIES, gRPC callers authenticate with client certificates")
+	}
+	for keyID, secret := range c.InternalHMACKeys {
+		if msg := weakSecret(secret); msg != "" {
+			p.add("INTERNAL_HMAC_KEYS", "the secret for %q %s", keyID, msg)
+		}
+	}
+
+	// debugging and observability
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		p.add("LOG_LEVEL", "must be debug, info, warn, or error, got %q", c.LogLevel)
+	}
+	if c.DebugAddress != "" && !c.DebugEnabled {
+		p.add("DEBUG_ADDRESS", "requires DEBUG_ENABLED")
+	}
+	if c.DebugCaptureSize < 0 {
+		p.add("DEBUG_CAPTURE_SIZE", "can't be negative")
+	}
+	checkURL(&p, "OTEL_EXPORTER_OTLP_ENDPOINT", c.OTLPEndpoint, "https", "http")
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		p.add("TRACING_SAMPLE_RATIO", "must be between 0 and 1")
+	}
+
+	// storage
+	switch c.Storage {
+	case StorageDatabase, StorageMemory:
+	default:
+		p.add("STORAGE", "must be database or memory, got %q", c.Storage)
+	}
+	switch c.DBDriver {
+	case DBDriverPostgres:
+	case DBDriverSQLite:
+		if c.SQLitePath == "" {
+			p.add("SQLITE_PATH", "is required when DB_DRIVER is sqlite")
+		}
+	default:
+		p.add("DB_DRIVER", "must be postgres or sqlite, got %q", c.DBDriver)
+	}
+	checkPostgresURL(&p, "PSQL_URL", c.PostgresURL)
+	checkPostgresURL(&p, "PSQL_REPLICA_URL", c.PostgresReplicaURL)
+	if c.PostgresReplicaURL != "" && c.DBDriver != DBDriverPostgres {
+		p.add("PSQL_REPLICA_URL", "requires DB_DRIVER postgres")
+	}
+	if c.DBMaxAttempts < 1 {
+		p.add("DB_MAX_ATTEMPTS", "must be at least 1")
+	}
+	if c.DBHealthCheckIntervalSeconds < 0 {
+		p.add("DB_HEALTH_CHECK_INTERVAL_SECONDS", "can't be negative")
+	}
+	checkURL(&p, "REDIS_URL", c.RedisURL, "redis", "rediss", "unix")
+	if c.CacheAccountTTLSeconds < 0 {
+		p.add("CACHE_ACCOUNT_TTL_SECONDS", "can't be negative")
+	}
+	if c.CacheAccountTTLSeconds > 0 && c.RedisURL == "" {
+		p.add("CACHE_ACCOUNT_TTL_SECONDS", "requires REDIS_URL")
+	}
+
+	// login and lockout
+	if c.LockoutMaxAttempts <= 0 {
+		p.add("LOCKOUT_MAX_ATTEMPTS", "must be positive")
+	}
+	if c.LockoutDurationMinutes <= 0 {
+		p.add("LOCKOUT_DURATION_MINUTES", "must be positive")
+	}
+	if c.TrustedDeviceDays < 0 {
+		p.add("TRUSTED_DEVICE_DAYS", "can't be negative")
+	}
+	if c.EmailAvailabilityLimit <= 0 {
+		p.add("EMAIL_AVAILABILITY_LIMIT", "must be positive")
+	}
+	if c.PasswordResetLimit <= 0 {
+		p.add("PASSWORD_RESET_LIMIT", "must be positive")
+	}
+	if c.MagicLinkTTLMinutes <= 0 || c.MagicLinkTTLMinutes > 24*60 {
+		p.add("MAGIC_LINK_TTL_MINUTES", "must be between 1 and %d (a day), got %d", 24*60, c.MagicLinkTTLMinutes)
+	}
+	if c.MagicLinkLimit <= 0 {
+		p.add("MAGIC_LINK_LIMIT", "must be positive")
+	}
+
+	// URLs
+	checkURL(&p, "APP_URL", c.AppURL, "https", "http")
+	checkURL(&p, "CHANGE_PASSWORD_URL", c.ChangePasswordURL, "https", "http")
+	checkURL(&p, "APPLE_REDIRECT_URL", c.AppleRedirectURL, "https", "http")
+	if c.AppleClientID != "" && (c.AppleTeamID == "" || c.AppleKeyID == "" || c.ApplePrivateKeyFile == "") {
+		p.add("APPLE_CLIENT_ID", "requires APPLE_TEAM_ID, APPLE_KEY_ID, and APPLE_PRIVATE_KEY_FILE")
+	}
+	if c.OIDCIssuer != "" {
+		if !isBaseURL(c.OIDCIssuer) {
+			p.add("OIDC_ISSUER", "must be an http(s) URL without a query or fragment")
+		}
+		// clients verify ID tokens with the keys at /.well-known/jwks.json, there are none for the
+		// shared secret
+		if c.JWTSigningKey == "" && c.JWTSigningKeyFile == "" {
+			p.add("OIDC_ISSUER", "requires JWT_SIGNING_KEY or JWT_SIGNING_KEY_FILE")
+		}
+	}
+	checkURL(&p, "OIDC_AUTHORIZATION_URL", c.OIDCAuthorizationURL, "https", "http")
+	if c.SAMLBaseURL != "" && !isBaseURL(c.SAMLBaseURL) {
+		p.add("SAML_BASE_URL", "must be an http(s) URL without a query or fragment")
+	}
+
+	// email and SMS
+	switch c.MailProvider {
+	case MailProviderLog:
+	case MailProviderSMTP:
+		if c.SMTPHost == "" || c.MailFrom == "" {
+			p.add("MAIL_PROVIDER", "SMTP_HOST and MAIL_FROM are required when MAIL_PROVIDER is smtp")
+		}
+	case MailProviderSendGrid:
+		if c.SendGridAPIKey == "" || c.MailFrom == "" {
+			p.add("MAIL_PROVIDER", "SENDGRID_API_KEY and MAIL_FROM are required when MAIL_PROVIDER is sendgrid")
+		}
+	default:
+		p.add("MAIL_PROVIDER", "must be log, smtp, or sendgrid, got %q", c.MailProvider)
+	}
+	if c.MailQueueSize < 0 {
+		p.add("MAIL_QUEUE_SIZE", "can't be negative")
+	}
+	if c.MailMaxAttempts <= 0 {
+		p.add("MAIL_MAX_ATTEMPTS", "must be positive")
+	}
+	switch c.SMSProvider {
+	case "", SMSProviderLog:
+	case SMSProviderTwilio:
+		if c.TwilioAccountSID == "" || c.TwilioAuthToken == "" || c.TwilioFrom == "" {
+			p.add("SMS_PROVIDER", "TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN, and TWILIO_FROM are required when SMS_PROVIDER is twilio")
+		}
+	default:
+		p.add("SMS_PROVIDER", "must be log or twilio, got %q", c.SMSProvider)
+	}
+	if c.SMSCodeLength < 4 || c.SMSCodeLength > 10 {
+		p.add("SMS_CODE_LENGTH", "must be between 4 and 10")
+	}
+	if c.SMSCodeTTLSeconds <= 0 || c.SMSCodeTTLSeconds > 60*60 {
+		p.add("SMS_CODE_TTL_SECONDS", "must be between 1 and %d (an hour), got %d", 60*60, c.SMSCodeTTLSeconds)
+	}
+	if c.SMSResendSeconds < 0 {
+		p.add("SMS_RESEND_SECONDS", "can't be negative")
+	}
+
+	// abuse prevention
+	switch c.CaptchaProvider {
+	case CaptchaProviderTurnstile, CaptchaProviderHCaptcha, CaptchaProviderReCAPTCHA:
+	default:
+		p.add("CAPTCHA_PROVIDER", "must be turnstile, hcaptcha, or recaptcha, got %q", c.CaptchaProvider)
+	}
+	if c.CaptchaSecret != "" && c.CaptchaSiteKey == "" {
+		p.add("CAPTCHA_SITE_KEY", "is required when CAPTCHA_SECRET is set")
+	}
+	checkURL(&p, "CAPTCHA_VERIFY_URL", c.CaptchaVerifyURL, "https", "http")
+	if c.CaptchaLoginFailures <= 0 {
+		p.add("CAPTCHA_LOGIN_FAILURES", "must be positive")
+	}
+	for name, list := range map[string][]string{
+		"IP_ALLOWLIST":       c.IPAllowlist,
+		"IP_DENYLIST":        c.IPDenylist,
+		"ADMIN_IP_ALLOWLIST": c.AdminIPAllowlist,
+		"ADMIN_IP_DENYLIST":  c.AdminIPDenylist,
+		"TRUSTED_PROXIES":    c.TrustedProxies,
+	} {
+		if _, err := ipfilter.ParsePrefixes(list); err != nil {
+			p.add(name, "%v", err)
+		}
+	}
+	countryRules := len(c.CountryAllowlist) + len(c.CountryDenylist) + len(c.AdminCountryAllowlist) + len(c.AdminCountryDenylist)
+	if countryRules > 0 && c.GeoIPDBFile == "" {
+		p.add("GEOIP_DB_FILE", "is required by COUNTRY_ALLOWLIST, COUNTRY_DENYLIST, ADMIN_COUNTRY_ALLOWLIST, and ADMIN_COUNTRY_DENYLIST")
+	}
+	if _, err := ratelimit.ParseRules(c.RateLimits); err != nil {
+		p.add("RATE_LIMITS", "%v", err)
+	}
+	if _, err := c.ParseAPIVersionDeprecations(); err != nil {
+		p.add("API_VERSION_DEPRECATIONS", "%v", err)
+	}
+	if c.IdempotencyWindowMinutes < 0 || c.IdempotencyWindowMinutes > MaxIdempotencyWindowMinutes {
+		p.add("IDEMPOTENCY_WINDOW_MINUTES", "must be between 0 and %d (a day), got %d", MaxIdempotencyWindowMinutes, c.IdempotencyWindowMinutes)
+	}
+
+	// passwords
+	if err := c.PasswordPolicyConfig().Validate(); err != nil {
+		p.add("PASSWORD_MIN_LENGTH", "password policy: %v", err)
+	}
+	if err := c.PasswordHasherConfig().Validate(); err != nil {
+		p.add("PASSWORD_HASH_ALGORITHM", "password hashing: %v", err)
+	}
+	switch c.BreachedPasswordCheck {
+	case BreachedPasswordCheckOff, BreachedPasswordCheckWarn, BreachedPasswordCheckEnforce:
+	default:
+		p.add("BREACHED_PASSWORD_CHECK", "must be off, warn, or enforce, got %q", c.BreachedPasswordCheck)
+	}
+	checkURL(&p, "HIBP_RANGE_URL", c.HIBPRangeURL, "https", "http")
+	if c.HIBPTimeoutMillis <= 0 {
+		p.add("HIBP_TIMEOUT_MS", "must be positive")
+	}
+
+	// sessions
+	switch c.SessionCookieSameSite {
+	case SameSiteStrict, SameSiteLax:
+	case SameSiteNone:
+		// browsers drop SameSite=None cookies that aren't Secure
+		if !c.SessionCookieSecure {
+			p.add("SESSION_COOKIE_SAME_SITE", "none requires SESSION_COOKIE_SECURE")
+		}
+	default:
+		p.add("SESSION_COOKIE_SAME_SITE", "must be strict, lax, or none, got %q", c.SessionCookieSameSite)
+	}
+
+	// background jobs and events
+	if c.DeletedAccountRetentionDays < 0 {
+		p.add("DELETED_ACCOUNT_RETENTION_DAYS", "can't be negative")
+	}
+	if c.DeletionGracePeriodDays <= 0 {
+		p.add("DELETION_GRACE_PERIOD_DAYS", "must be positive")
+	}
+	if c.DeletionReminderDays < 0 || c.DeletionReminderDays >= c.DeletionGracePeriodDays {
+		p.add("DELETION_REMINDER_DAYS", "must be at least 0 and less than DELETION_GRACE_PERIOD_DAYS")
+	}
+	if c.CleanupIntervalMinutes <= 0 {
+		p.add("CLEANUP_INTERVAL_MINUTES", "must be positive")
+	}
+	if c.AuditLogRetentionDays < 0 {
+		p.add("AUDIT_LOG_RETENTION_DAYS", "can't be negative")
+	}
+	if c.AuditLogBufferSize < 0 {
+		p.add("AUDIT_LOG_BUFFER_SIZE", "can't be negative")
+	}
+	switch c.OutboxBroker {
+	case "", "nats":
+	case "kafka":
+		if len(c.KafkaBrokers) == 0 {
+			p.add("KAFKA_BROKERS", "is required when OUTBOX_BROKER is kafka")
+		}
+	default:
+		p.add("OUTBOX_BROKER", "must be kafka or nats, got %q", c.OutboxBroker)
+	}
+	if c.OutboxRetentionHours <= 0 {
+		p.add("OUTBOX_RETENTION_HOURS", "must be positive")
+	}
+	for _, name := range c.TokenFeatureFlags {
+		if !featureflags.ValidName(name) {
+			p.add("TOKEN_FEATURE_FLAGS", "invalid feature flag name %q", name)
+		}
+	}
+	for _, key := range c.TokenAppMetadataKeys {
+		if !metadata.ValidKey(key) {
+			p.add("TOKEN_APP_METADATA_KEYS", "invalid metadata key %q", key)
+		}
+	}
+
+	if len(p) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: p}
+}
+
+// checkURL adds a problem when value is set and isn't an absolute URL with one of the schemes
+func checkURL(p *problems, field, value string, schemes ...string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || !slices.Contains(schemes, u.Scheme) || (u.Host == "" && u.Scheme != "unix") {
+		p.add(field, "must be a URL starting with %s://, got %q", strings.Join(schemes, ":// or "), redactURL(value))
+	}
+}
+
+// checkPostgresURL is checkURL for connection strings, which can also be written as keyword/value
+// pairs like "host=localhost dbname=accounts"
+func checkPostgresURL(p *problems, field, value string) {
+	if strings.Contains(value, "://") {
+		checkURL(p, field, value, "postgres", "postgresql")
+	}
+}
+
+// isBaseURL reports whether s is an http(s) URL other URLs can be built on
+func isBaseURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" && u.RawQuery == "" && u.Fragment == ""
+}
+
+// redactURL keeps passwords in connection URLs out of the report
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "<unparseable>"
+	}
+	return u.Redacted()
+}
+
+// weakSecret describes what's wrong with a shared secret that's too short or too predictable to
+// be safe, or returns "" for a good one
+func weakSecret(secret string) string {
+	if len(secret) < MinSecretLength {
+		return fmt.Sprintf("must be at least %d characters, got %d", MinSecretLength, len(secret))
+	}
+	if bits := entropyBits(secret); bits < MinSecretEntropyBits {
+		return fmt.Sprintf("is too predictable (about %.0f bits of entropy, at least %d are needed), use a random value like `openssl rand -base64 32`", bits, MinSecretEntropyBits)
+	}
+	return ""
+}
+
+// entropyBits estimates the entropy of s from how often each character appears in it. It's
+// generous, it only catches secrets with too few distinct characters like "aaaa…" or "1212…".
+func entropyBits(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	var perChar float64
+	for _, count := range counts {
+		f := float64(count) / float64(n)
+		perChar -= f * math.Log2(f)
+	}
+	return perChar * float64(n)
+}
@@ -8,26 +8,47 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
 )
 
 type Account struct {
-	ID           string    `db:"id"`
-	Email        string    `db:"email"`
-	PasswordHash string    `db:"password_hash" json:"-"`
-	CreatedAt    time.Time `db:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at"`
+	ID              string       `db:"id"`
+	Email           string       `db:"email"`
+	Username        string       `db:"username"`
+	PasswordHash    string       `db:"password_hash" json:"-"`
+	PreferredLocale string       `db:"preferred_locale"`
+	DisplayName     string       `db:"display_name"`
+	GivenName       string       `db:"given_name"`
+	FamilyName      string       `db:"family_name"`
+	Timezone        string       `db:"timezone"`
+	AvatarURL       string       `db:"avatar_url"`
+	Tags            StringArray  `db:"tags"`
+	FeatureFlags    FeatureFlags `db:"feature_flags"`
+	UserMetadata    Metadata     `db:"user_metadata"`
+	AppMetadata     Metadata     `db:"app_metadata"`
+	FrozenAt        *time.Time   `db:"frozen_at"`
+	VerifiedAt      *time.Time   `db:"verified_at"`
+	CreatedAt       time.Time    `db:"created_at"`
+	UpdatedAt       time.Time    `db:"updated_at"`
 }
 
 type AccountCreationParams struct {
-	Email        string `db:"email" json:"-"`
-	PasswordHash string `db:"password_hash" json:"-"`
+	Email           string `db:"email" json:"-"`
+	Username        string `db:"username" json:"-"`
+	PasswordHash    string `db:"password_hash" json:"-"`
+	PreferredLocale string `db:"preferred_locale" json:"-"`
+	// Verified creates the account with its email already verified, for emails vouched for
+	// some other way (e.g. by an identity provider)
+	Verified bool `db:"verified" json:"-"`
 }
 
 var (
 	ErrAccountNotFound      = errors.New("an account with this email was not found")
 	ErrAccountAlreadyExists = errors.New("account with this email already exists")
+	ErrUsernameTaken        = errors.New("an account with this username already exists")
 
-	duplicateEmailConstraint = "accounts_email_key"
+	duplicateEmailConstraint    = "accounts_email_key"
+	duplicateUsernameConstraint = "accounts_username_key"
 )
 
 func uniqueConstraint(err error) (string, bool) {
@@ -39,11 +60,17 @@ func uniqueConstraint(err error) (string, bool) {
 }
 
 func (d *DB) CreateAccount(ctx context.Context, params AccountCreationParams) (*Account, error) {
-	rows, err := d.client.NamedQueryContext(ctx, createAccountSQL, params)
+	ctx, span := startSpan(ctx, "CreateAccount")
+	defer span.End()
+
+	rows, err := sqlx.NamedQueryContext(ctx, d.client, createAccountSQL, params)
 	if err != nil {
 		// Check for unique constraint violation
-		if c, _ := uniqueConstraint(err); c == duplicateEmailConstraint {
+		switch c, _ := uniqueConstraint(err); c {
+		case duplicateEmailConstraint:
 			return nil, ErrAccountAlreadyExists
+		case duplicateUsernameConstraint:
+			return nil, ErrUsernameTaken
 		}
 		return nil, fmt.Errorf("error executing create account query: %w", err)
 	}
@@ -61,8 +88,28 @@ func (d *DB) CreateAccount(ctx context.Context, params AccountCreationParams) (*
 }
 
 func (d *DB) GetAccount(ctx context.Context, email string) (*Account, error) {
+	ctx, span := startSpan(ctx, "GetAccount")
+	defer span.End()
+
+	var result Account
+	err := d.reader().GetContext(ctx, &result, getAccountSQL, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error getting account: %w", err)
+	}
+
+	return &result, nil
+}
+
+// GetAccountByUsername returns the account with the username, compared regardless of case
+func (d *DB) GetAccountByUsername(ctx context.Context, username string) (*Account, error) {
+	ctx, span := startSpan(ctx, "GetAccountByUsername")
+	defer span.End()
+
 	var result Account
-	err := d.client.GetContext(ctx, &result, getAccountSQL, email)
+	err := d.reader().GetContext(ctx, &result, getAccountByUsernameSQL, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrAccountNotFound
@@ -73,13 +120,125 @@ func (d *DB) GetAccount(ctx context.Context, email string) (*Account, error) {
 	return &result, nil
 }
 
+func (d *DB) GetAccountByID(ctx context.Context, id string) (*Account, error) {
+	ctx, span := startSpan(ctx, "GetAccountByID")
+	defer span.End()
+
+	var result Account
+	err := d.client.GetContext(ctx, &result, getAccountByIDSQL, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error getting account: %w", err)
+	}
+
+	return &result, nil
+}
+
+// GetAccountsByIDs returns the accounts that exist out of ids, in no particular order
+func (d *DB) GetAccountsByIDs(ctx context.Context, ids []string) ([]Account, error) {
+	ctx, span := startSpan(ctx, "GetAccountsByIDs")
+	defer span.End()
+
+	var result []Account
+	err := d.client.SelectContext(ctx, &result, getAccountsByIDsSQL, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error getting accounts by ID: %w", err)
+	}
+	return result, nil
+}
+
+// GetAccountsByEmails returns the accounts that exist out of emails, in no particular order
+func (d *DB) GetAccountsByEmails(ctx context.Context, emails []string) ([]Account, error) {
+	ctx, span := startSpan(ctx, "GetAccountsByEmails")
+	defer span.End()
+
+	var result []Account
+	err := d.client.SelectContext(ctx, &result, getAccountsByEmailsSQL, emails)
+	if err != nil {
+		return nil, fmt.Errorf("error getting accounts by email: %w", err)
+	}
+	return result, nil
+}
+
+// UpdatePassword replaces the account's password and deletes its refresh tokens, so every
+// session has to log in again with the new password
+func (d *DB) UpdatePassword(ctx context.Context, id, passwordHash string) (*Account, error) {
+	ctx, span := startSpan(ctx, "UpdatePassword")
+	defer span.End()
+
+	var result Account
+	err := d.client.GetContext(ctx, &result, updatePasswordSQL, id, passwordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error updating password: %w", err)
+	}
+	return &result, nil
+}
+
+// RehashPassword replaces the account's password hash with a new hash of the same password, e.g.
+// made with stronger parameters. Nothing changes if the hash isn't oldHash anymore because the
+// password was changed in the meantime. Sessions aren't ended since the password is the same.
+func (d *DB) RehashPassword(ctx context.Context, id, oldHash, newHash string) error {
+	ctx, span := startSpan(ctx, "RehashPassword")
+	defer span.End()
+
+	_, err := d.client.ExecContext(ctx, rehashPasswordSQL, id, oldHash, newHash)
+	if err != nil {
+		return fmt.Errorf("error rehashing password: %w", err)
+	}
+	return nil
+}
+
 var (
 	createAccountSQL = `
-		INSERT INTO accounts (email, password_hash)
-		VALUES (:email, :password_hash)
-		RETURNING id, email, password_hash, created_at, updated_at;`
+		WITH account AS (
+			INSERT INTO accounts (email, username, password_hash, preferred_locale, verified_at)
+			VALUES (:email, :username, :password_hash, :preferred_locale, CASE WHEN :verified THEN NOW() END)
+			RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		), outbox_event AS (` + insertAccountOutboxEventSQL(OutboxEventAccountCreated, "account") + `
+		)
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM account;`
 
 	getAccountSQL = `
-		SELECT id, email, password_hash, created_at, updated_at
-		FROM accounts WHERE email = $1;`
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM accounts WHERE email = $1 AND deleted_at IS NULL;`
+
+	getAccountByUsernameSQL = `
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM accounts WHERE lower(username) = lower($1) AND username <> '' AND deleted_at IS NULL;`
+
+	getAccountByIDSQL = `
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM accounts WHERE id = $1 AND deleted_at IS NULL;`
+
+	getAccountsByIDsSQL = `
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM accounts WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL;`
+
+	getAccountsByEmailsSQL = `
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM accounts WHERE email = ANY($1::text[]) AND deleted_at IS NULL;`
+
+	updatePasswordSQL = `
+		WITH deleted_refresh_tokens AS (
+			DELETE FROM refresh_tokens WHERE account_id = $1
+		), account AS (
+			UPDATE accounts
+			SET password_hash = $2, updated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		), outbox_event AS (` + insertAccountOutboxEventSQL(OutboxEventAccountPasswordChanged, "account") + `
+		)
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM account;`
+
+	rehashPasswordSQL = `
+		UPDATE accounts
+		SET password_hash = $3
+		WHERE id = $1 AND password_hash = $2 AND deleted_at IS NULL;`
 )
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
@@ -20,13 +21,17 @@ func setupTestDB(t *testing.T) *DB {
 	db, err := sqlx.Connect("pgx", dbURL)
 	require.NoError(t, err)
 
+	// bring the schema up to date so tests don't depend on someone having migrated
+	_, err = (&DB{pool: db, client: db}).Migrate(context.Background())
+	require.NoError(t, err)
+
 	// Clean up any existing test data
 	_, err = db.Exec("DELETE FROM accounts WHERE email LIKE '%@test.com'")
 	if err != nil {
 		t.Fatal("Failed to clean test data:", err)
 	}
 
-	return &DB{client: db}
+	return &DB{pool: db, client: db}
 }
 
 func TestCreateAccount(t *testing.T) {
@@ -86,7 +91,7 @@ func TestCreateAccount(t *testing.T) {
 	}
 
 	t.Cleanup(func() {
-		_, err := db.client.Exec("DELETE FROM accounts WHERE email = 'testerbob@test.com'")
+		_, err := db.pool.Exec("DELETE FROM accounts WHERE email = 'testerbob@test.com'")
 		require.NoError(t, err)
 		require.NoError(t, db.Close())
 	})
@@ -152,8 +157,67 @@ func TestGetAccount(t *testing.T) {
 	}
 
 	t.Cleanup(func() {
-		_, err := db.client.Exec("DELETE FROM accounts WHERE email = 'gettest@test.com'")
+		_, err := db.pool.Exec("DELETE FROM accounts WHERE email = 'gettest@test.com'")
 		require.NoError(t, err)
 		require.NoError(t, db.Close())
 	})
 }
+
+func TestUpdatePassword(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "passwordtest@test.com",
+		PasswordHash: "old-password-hash",
+	})
+	require.NoError(t, err)
+
+	err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "password-test-refresh-token",
+		AccountID: testAccount.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	updated, err := db.UpdatePassword(ctx, testAccount.ID, "new-password-hash")
+	require.NoError(t, err)
+	assert.Equal(t, "new-password-hash", updated.PasswordHash)
+
+	_, err = db.GetRefreshToken(ctx, "password-test-refresh-token")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	_, err = db.UpdatePassword(ctx, "00000000-0000-0000-0000-000000000000", "hash")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestRehashPassword(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "rehashtest@test.com",
+		PasswordHash: "old-password-hash",
+	})
+	require.NoError(t, err)
+
+	err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "rehash-test-refresh-token",
+		AccountID: testAccount.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, db.RehashPassword(ctx, testAccount.ID, "old-password-hash", "rehashed"))
+	// the password changed since the old hash was read
+	require.NoError(t, db.RehashPassword(ctx, testAccount.ID, "old-password-hash", "stale"))
+
+	account, err := db.GetAccountByID(ctx, testAccount.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "rehashed", account.PasswordHash)
+
+	_, err = db.GetRefreshToken(ctx, "rehash-test-refresh-token")
+	assert.NoError(t, err, "rehashing keeps sessions")
+}
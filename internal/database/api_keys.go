@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a long-lived key an account issued for machine-to-machine access
+type APIKey struct {
+	ID        string `db:"id"`
+	AccountID string `db:"account_id"`
+	Name      string `db:"name"`
+	// Prefix is the start of the key, kept so the key can be recognized. The whole key is only
+	// stored as KeyHash.
+	Prefix  string      `db:"prefix"`
+	KeyHash string      `db:"key_hash"`
+	Scopes  StringArray `db:"scopes"`
+	// ExpiresAt is nil for keys that don't expire
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+type CreateAPIKeyParams struct {
+	AccountID string
+	Name      string
+	Prefix    string
+	KeyHash   string
+	Scopes    []string
+	// ExpiresAt is optional, the zero time never expires
+	ExpiresAt time.Time
+}
+
+func (d *DB) CreateAPIKey(ctx context.Context, params CreateAPIKeyParams) (*APIKey, error) {
+	ctx, span := startSpan(ctx, "CreateAPIKey")
+	defer span.End()
+
+	scopes := params.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	var result APIKey
+	err := d.client.GetContext(ctx, &result, createAPIKeySQL,
+		params.AccountID, params.Name, params.Prefix, params.KeyHash, scopes, nullTime(params.ExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("error creating api key: %w", err)
+	}
+	return &result, nil
+}
+
+// ListAPIKeys returns the account's API keys, newest first. Expired keys are included.
+func (d *DB) ListAPIKeys(ctx context.Context, accountID string) ([]APIKey, error) {
+	ctx, span := startSpan(ctx, "ListAPIKeys")
+	defer span.End()
+
+	var result []APIKey
+	err := d.reader().SelectContext(ctx, &result, listAPIKeysSQL, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing api keys: %w", err)
+	}
+	return result, nil
+}
+
+// GetAPIKeyByHash returns the key with the hash, whether or not it has expired
+func (d *DB) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	ctx, span := startSpan(ctx, "GetAPIKeyByHash")
+	defer span.End()
+
+	var result APIKey
+	err := d.client.GetContext(ctx, &result, getAPIKeyByHashSQL, keyHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("error getting api key: %w", err)
+	}
+	return &result, nil
+}
+
+// TouchAPIKey records that the key was used at the given time
+func (d *DB) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	ctx, span := startSpan(ctx, "TouchAPIKey")
+	defer span.End()
+
+	if _, err := d.client.ExecContext(ctx, touchAPIKeySQL, id, at); err != nil {
+		return fmt.Errorf("error touching api key: %w", err)
+	}
+	return nil
+}
+
+// DeleteAPIKey revokes one of the account's API keys. It returns ErrAPIKeyNotFound if the
+// account has no such key.
+func (d *DB) DeleteAPIKey(ctx context.Context, accountID, id string) error {
+	ctx, span := startSpan(ctx, "DeleteAPIKey")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, deleteAPIKeySQL, accountID, id)
+	if err != nil {
+		return fmt.Errorf("error deleting api key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+const apiKeyColumns = `id, account_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at`
+
+var (
+	createAPIKeySQL = `
+		INSERT INTO api_keys (account_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + apiKeyColumns + `;`
+
+	listAPIKeysSQL = `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE account_id = $1
+		ORDER BY created_at DESC, id DESC;`
+
+	getAPIKeyByHashSQL = `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE key_hash = $1;`
+
+	touchAPIKeySQL = `
+		UPDATE api_keys
+		SET last_used_at = $2
+		WHERE id = $1;`
+
+	deleteAPIKeySQL = `
+		DELETE FROM api_keys
+		WHERE account_id = $1 AND id = $2;`
+)
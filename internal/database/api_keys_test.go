@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "apikeystest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	first, err := db.CreateAPIKey(ctx, CreateAPIKeyParams{
+		AccountID: testAccount.ID,
+		Name:      "ci",
+		Prefix:    "amk_first",
+		KeyHash:   "first-hash",
+		Scopes:    []string{"account:read"},
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, StringArray{"account:read"}, first.Scopes)
+	require.NotNil(t, first.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*first.ExpiresAt))
+	assert.Nil(t, first.LastUsedAt)
+
+	second, err := db.CreateAPIKey(ctx, CreateAPIKeyParams{
+		AccountID: testAccount.ID,
+		Name:      "backup",
+		Prefix:    "amk_second",
+		KeyHash:   "second-hash",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, second.Scopes)
+	assert.Nil(t, second.ExpiresAt)
+
+	keys, err := db.ListAPIKeys(ctx, testAccount.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, second.ID, keys[0].ID)
+
+	got, err := db.GetAPIKeyByHash(ctx, "first-hash")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, got.ID)
+	_, err = db.GetAPIKeyByHash(ctx, "unknown-hash")
+	require.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+	usedAt := time.Now().Truncate(time.Microsecond)
+	require.NoError(t, db.TouchAPIKey(ctx, first.ID, usedAt))
+	got, err = db.GetAPIKeyByHash(ctx, "first-hash")
+	require.NoError(t, err)
+	require.NotNil(t, got.LastUsedAt)
+	assert.True(t, usedAt.Equal(*got.LastUsedAt))
+
+	// another account's key isn't found
+	require.ErrorIs(t, db.DeleteAPIKey(ctx, "00000000-0000-0000-0000-000000000000", first.ID), ErrAPIKeyNotFound)
+	require.NoError(t, db.DeleteAPIKey(ctx, testAccount.ID, first.ID))
+	require.ErrorIs(t, db.DeleteAPIKey(ctx, testAccount.ID, first.ID), ErrAPIKeyNotFound)
+
+	// deleting the account revokes its keys
+	require.NoError(t, db.DeleteAccount(ctx, testAccount.ID))
+	_, err = db.GetAPIKeyByHash(ctx, "second-hash")
+	require.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Audit event types. These are returned to clients so keep them stable.
+const (
+	AuditEventAccountCreated = "account_created"
+	AuditEventLogin          = "login"
+	AuditEventLoginFailed    = "login_failed"
+	AuditEventTokenRefreshed = "token_refreshed"
+	AuditEventLogout         = "logout"
+	AuditEventLogoutAll      = "logout_all"
+	AuditEventSessionRevoked = "session_revoked"
+	AuditEventNewSignIn      = "new_sign_in"
+	AuditEventMagicLinkSent  = "magic_link_sent"
+	AuditEventIdentityLinked = "identity_linked"
+
+	AuditEventEmailChangeRequested = "email_change_requested"
+	AuditEventEmailChangeCancelled = "email_change_cancelled"
+	AuditEventEmailChanged         = "email_changed"
+
+	AuditEventAccountFrozen   = "account_frozen"
+	AuditEventAccountUnfrozen = "account_unfrozen"
+
+	AuditEventEmailVerified   = "email_verified"
+	AuditEventPasswordReset   = "password_reset"
+	AuditEventPasswordChanged = "password_changed"
+
+	AuditEventProfileUpdated = "profile_updated"
+	AuditEventAccountDeleted = "account_deleted"
+
+	// the account asking to be erased once the grace period is over, logging in again before then
+	// cancelling it, and the erasure itself
+	AuditEventDeletionRequested = "deletion_requested"
+	AuditEventDeletionCancelled = "deletion_cancelled"
+	AuditEventAccountErased     = "account_erased"
+
+	// AuditEventMetadataChanged is the account's user_metadata or app_metadata changing. It has
+	// an actor when an admin changed it.
+	AuditEventMetadataChanged = "metadata_changed"
+
+	AuditEventMFAEnabled             = "mfa_enabled"
+	AuditEventRecoveryCodesGenerated = "mfa_recovery_codes_generated"
+	AuditEventRecoveryCodeUsed       = "mfa_recovery_code_used"
+	AuditEventMFAPhoneVerified       = "mfa_phone_verified"
+	AuditEventDeviceTrusted          = "device_trusted"
+	AuditEventTrustedDeviceRemoved   = "trusted_device_removed"
+
+	// AuditEventRoleAssigned is an account being given a role, which is in the details
+	AuditEventRoleAssigned = "role_assigned"
+
+	AuditEventAPIKeyCreated = "api_key_created"
+	AuditEventAPIKeyRevoked = "api_key_revoked"
+
+	// AuditEventRequestBlocked is a request from a client IP the IP filter doesn't let in. It
+	// has no account.
+	AuditEventRequestBlocked = "request_blocked"
+
+	// admin actions through the internal API. The callers are services rather than accounts
+	// so these have no actor.
+	AuditEventTagsChanged         = "tags_changed"
+	AuditEventFeatureFlagsChanged = "feature_flags_changed"
+
+	// AuditEventConfigReloaded is the service's settings being changed without a restart. It has
+	// no account, and the settings that changed are in the details.
+	AuditEventConfigReloaded = "config_reloaded"
+	// AuditEventLogLevelChanged is an admin changing the log level. It has no account, the admin
+	// is the actor and the old and new levels are in the details.
+	AuditEventLogLevelChanged = "log_level_changed"
+)
+
+type AuditEvent struct {
+	ID        string    `db:"id"`
+	AccountID string    `db:"account_id"`
+	EventType string    `db:"event_type"`
+	ActorID   string    `db:"actor_id"`
+	IPAddress string    `db:"ip_address"`
+	UserAgent string    `db:"user_agent"`
+	RequestID string    `db:"request_id"`
+	Details   string    `db:"details"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type CreateAuditEventParams struct {
+	AccountID string `db:"account_id"`
+	EventType string `db:"event_type"`
+	// ActorID is who performed the action. Empty when it's the account itself.
+	ActorID   string `db:"actor_id"`
+	IPAddress string `db:"ip_address"`
+	UserAgent string `db:"user_agent"`
+	RequestID string `db:"request_id"`
+	// Details say more about events that need it, e.g. which settings a config reload changed
+	Details string `db:"details"`
+}
+
+// ListAuditEventsParams pages through events newest first
+type ListAuditEventsParams struct {
+	// AccountID optionally restricts events to one account's. Leave it empty for every
+	// account's, including failed logins for emails without an account.
+	AccountID string
+	// EventType optionally restricts events to one type
+	EventType string
+	Keyset
+	// Since and Until optionally restrict events to created_at >= Since and created_at < Until.
+	Since time.Time
+	Until time.Time
+}
+
+func (d *DB) CreateAuditEvent(ctx context.Context, params CreateAuditEventParams) error {
+	ctx, span := startSpan(ctx, "CreateAuditEvent")
+	defer span.End()
+
+	_, err := d.client.NamedExecContext(ctx, createAuditEventSQL, params)
+	if err != nil {
+		return fmt.Errorf("error creating audit event: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) ListAuditEvents(ctx context.Context, params ListAuditEventsParams) ([]AuditEvent, error) {
+	ctx, span := startSpan(ctx, "ListAuditEvents")
+	defer span.End()
+
+	beforeCreatedAt, beforeID, limit := params.args()
+	var result []AuditEvent
+	err := d.reader().SelectContext(ctx, &result, listAuditEventsSQL,
+		nullString(params.AccountID),
+		beforeCreatedAt,
+		beforeID,
+		limit,
+		nullTime(params.Since),
+		nullTime(params.Until),
+		nullString(params.EventType),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing audit events: %w", err)
+	}
+	return result, nil
+}
+
+// PurgeAuditEvents deletes the audit events created before the cutoff and returns how many were
+// deleted
+func (d *DB) PurgeAuditEvents(ctx context.Context, createdBefore time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "PurgeAuditEvents")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, purgeAuditEventsSQL, createdBefore)
+	if err != nil {
+		return 0, fmt.Errorf("error purging audit events: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error purging audit events: %w", err)
+	}
+	return n, nil
+}
+
+var (
+	createAuditEventSQL = `
+		INSERT INTO audit_events (account_id, event_type, actor_id, ip_address, user_agent, request_id, details)
+		VALUES (NULLIF(:account_id, '')::uuid, :event_type, NULLIF(:actor_id, '')::uuid, :ip_address, :user_agent, :request_id, NULLIF(:details, ''));`
+
+	listAuditEventsSQL = `
+		SELECT id, COALESCE(account_id::text, '') AS account_id, event_type, COALESCE(actor_id::text, '') AS actor_id,
+			COALESCE(ip_address, '') AS ip_address, COALESCE(user_agent, '') AS user_agent,
+			COALESCE(request_id, '') AS request_id, COALESCE(details, '') AS details, created_at
+		FROM audit_events
+		WHERE ($1::uuid IS NULL OR account_id = $1)
+			AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3::uuid))
+			AND ($5::timestamptz IS NULL OR created_at >= $5)
+			AND ($6::timestamptz IS NULL OR created_at < $6)
+			AND ($7::text IS NULL OR event_type = $7)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4;`
+
+	purgeAuditEventsSQL = `
+		DELETE FROM audit_events WHERE created_at < $1;`
+)
+
+// nullTime maps the zero time to NULL for optional query parameters
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// nullString passes "" as NULL, e.g. so an empty ID isn't cast to uuid
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,307 @@
+// Package cache keeps the service's hottest lookup, accounts by email, in Redis in front of a
+// database.Repository.
+//
+// Lookups read through the cache and fill it on a miss; writes go to the database and then
+// delete the entries they change. A lookup racing a write can still put back what it read before
+// the write, so entries can be stale until they expire and TTLs should stay short. Redis being
+// slow or down only costs the lookups their cache: they fall back to the database.
+//
+// Logins check the password hash and whether the account is frozen, which a stale entry could
+// get wrong: an old password would keep working, or a frozen account could log in. They look the
+// account up with database.WithUncachedReads and skip the cache.
+//
+// Refresh tokens aren't cached. Invalidating is best effort, and a cached token that a logout,
+// password change, or freeze failed to invalidate would keep working until it expired.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/redis/go-redis/v9"
+)
+
+// CacheAccount is the cache, as passed to Config.Observe
+const CacheAccount = "account"
+
+// Lookup results, as passed to Config.Observe
+const (
+	ResultHit   = "hit"
+	ResultMiss  = "miss"
+	ResultError = "error"
+)
+
+type Config struct {
+	// AccountTTL is how long entries are kept. 0 doesn't cache them.
+	AccountTTL time.Duration
+	// Timeout bounds every call to Redis so a slow Redis falls back to the database quickly
+	Timeout time.Duration
+	// Observe is called with the cache and result of every lookup, for metrics. Optional.
+	Observe func(cache, result string)
+}
+
+func DefaultConfig() Config {
+	return Config{
+		AccountTTL: time.Minute,
+		Timeout:    100 * time.Millisecond,
+	}
+}
+
+// DB is a database.Repository caching GetAccount. Everything else goes straight to the wrapped
+// Repository.
+type DB struct {
+	database.Repository
+	client redis.UniversalClient
+	cfg    Config
+	// tx is what a transaction changed, on the Repository WithTx gives its fn
+	tx *txChanges
+}
+
+// txChanges are the entries a transaction changed. They're deleted when it changes them, and
+// again once it's over, since lookups outside it still read the old rows until it commits.
+type txChanges struct {
+	accounts map[string]bool
+}
+
+func (c *txChanges) empty() bool {
+	return len(c.accounts) == 0
+}
+
+func New(repo database.Repository, client redis.UniversalClient, cfg Config) *DB {
+	if cfg.Observe == nil {
+		cfg.Observe = func(cache, result string) {}
+	}
+	return &DB{Repository: repo, client: client, cfg: cfg}
+}
+
+// accountKey holds an account by its email, and accountIDKey the email it's cached under so
+// writes by ID can find it
+func accountKey(email string) string { return "cache:account:email:" + email }
+func accountIDKey(id string) string  { return "cache:account:id:" + id }
+
+// WithTx runs fn in a transaction. Lookups in it use the cache until it changes something
+// cached, then go to the database so they see its changes. They don't fill the cache with rows
+// that might be rolled back.
+func (d *DB) WithTx(ctx context.Context, fn func(tx database.Repository) error) error {
+	if d.tx != nil {
+		// nested in our own transaction, which cleans up when it's over
+		return d.Repository.WithTx(ctx, func(tx database.Repository) error {
+			return fn(&DB{Repository: tx, client: d.client, cfg: d.cfg, tx: d.tx})
+		})
+	}
+
+	changes := &txChanges{accounts: map[string]bool{}}
+	err := d.Repository.WithTx(ctx, func(tx database.Repository) error {
+		return fn(&DB{Repository: tx, client: d.client, cfg: d.cfg, tx: changes})
+	})
+
+	for id := range changes.accounts {
+		d.invalidateAccount(ctx, id)
+	}
+	return err
+}
+
+func (d *DB) GetAccount(ctx context.Context, email string) (*database.Account, error) {
+	if d.cfg.AccountTTL == 0 || database.UncachedReads(ctx) {
+		return d.Repository.GetAccount(ctx, email)
+	}
+
+	var cached database.Account
+	if d.lookup(ctx, CacheAccount, accountKey(email), &cached) {
+		return &cached, nil
+	}
+
+	account, err := d.Repository.GetAccount(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	d.fill(ctx, func(pipe redis.Pipeliner, value []byte) {
+		pipe.Set(ctx, accountKey(account.Email), value, d.cfg.AccountTTL)
+		pipe.Set(ctx, accountIDKey(account.ID), account.Email, d.cfg.AccountTTL)
+	}, account)
+	return account, nil
+}
+
+func (d *DB) UpdatePassword(ctx context.Context, id, passwordHash string) (*database.Account, error) {
+	account, err := d.Repository.UpdatePassword(ctx, id, passwordHash)
+	d.invalidateAccount(ctx, id)
+	return account, err
+}
+
+func (d *DB) RehashPassword(ctx context.Context, id, oldHash, newHash string) error {
+	err := d.Repository.RehashPassword(ctx, id, oldHash, newHash)
+	d.invalidateAccount(ctx, id)
+	return err
+}
+
+func (d *DB) AddAccountTags(ctx context.Context, id string, tags []string) (*database.Account, error) {
+	account, err := d.Repository.AddAccountTags(ctx, id, tags)
+	d.invalidateAccount(ctx, id)
+	return account, err
+}
+
+func (d *DB) RemoveAccountTag(ctx context.Context, id, tag string) (*database.Account, error) {
+	account, err := d.Repository.RemoveAccountTag(ctx, id, tag)
+	d.invalidateAccount(ctx, id)
+	return account, err
+}
+
+func (d *DB) UpdateAccountFeatureFlags(ctx context.Context, id string, set map[string]bool, unset []string) (*database.Account, error) {
+	account, err := d.Repository.UpdateAccountFeatureFlags(ctx, id, set, unset)
+	d.invalidateAccount(ctx, id)
+	return account, err
+}
+
+func (d *DB) UpdateAccountProfile(ctx context.Context, id string, params database.UpdateAccountProfileParams) (*database.Account, error) {
+	account, err := d.Repository.UpdateAccountProfile(ctx, id, params)
+	d.invalidateAccount(ctx, id)
+	return account, err
+}
+
+func (d *DB) UpdateAccountMetadata(ctx context.Context, id string, params database.UpdateAccountMetadataParams) (*database.Account, error) {
+	account, err := d.Repository.UpdateAccountMetadata(ctx, id, params)
+	d.invalidateAccount(ctx, id)
+	return account, err
+}
+
+func (d *DB) DeleteAccount(ctx context.Context, id string) error {
+	err := d.Repository.DeleteAccount(ctx, id)
+	d.invalidateAccount(ctx, id)
+	return err
+}
+
+func (d *DB) EraseAccount(ctx context.Context, id string) error {
+	err := d.Repository.EraseAccount(ctx, id)
+	d.invalidateAccount(ctx, id)
+	return err
+}
+
+func (d *DB) FreezeAccount(ctx context.Context, id string) (*database.Account, error) {
+	account, err := d.Repository.FreezeAccount(ctx, id)
+	d.invalidateAccount(ctx, id)
+	return account, err
+}
+
+func (d *DB) UnfreezeAccount(ctx context.Context, id, passwordHash string) (*database.Account, error) {
+	account, err := d.Repository.UnfreezeAccount(ctx, id, passwordHash)
+	d.invalidateAccount(ctx, id)
+	return account, err
+}
+
+func (d *DB) VerifyAccount(ctx context.Context, id string) (*database.Account, error) {
+	account, err := d.Repository.VerifyAccount(ctx, id)
+	d.invalidateAccount(ctx, id)
+	return account, err
+}
+
+func (d *DB) ResetPassword(ctx context.Context, id, passwordHash string) (*database.Account, error) {
+	account, err := d.Repository.ResetPassword(ctx, id, passwordHash)
+	d.invalidateAccount(ctx, id)
+	return account, err
+}
+
+func (d *DB) CompleteEmailChange(ctx context.Context, id string) (*database.EmailChange, error) {
+	change, err := d.Repository.CompleteEmailChange(ctx, id)
+	if change != nil {
+		d.invalidateAccount(ctx, change.AccountID)
+	}
+	return change, err
+}
+
+// lookup reads key into dest and reports whether it was there. Errors count as misses.
+func (d *DB) lookup(ctx context.Context, cache, key string, dest any) bool {
+	// a transaction that changed something reads its own changes from the database
+	if d.tx != nil && !d.tx.empty() {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	value, err := d.client.Get(ctx, key).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+		d.cfg.Observe(cache, ResultMiss)
+		return false
+	case err != nil:
+		d.cfg.Observe(cache, ResultError)
+		return false
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(dest); err != nil {
+		// written by a version with different fields, it's replaced on the way back
+		d.cfg.Observe(cache, ResultMiss)
+		return false
+	}
+	d.cfg.Observe(cache, ResultHit)
+	return true
+}
+
+// fill caches what a lookup read from the database with set. Outside of transactions only, rows
+// read in one could still be rolled back. gob rather than JSON keeps fields like the password
+// hash that aren't serialized in responses.
+func (d *DB) fill(ctx context.Context, set func(pipe redis.Pipeliner, value []byte), v any) {
+	if d.tx != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		slog.ErrorContext(ctx, "error encoding cache entry", "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), d.cfg.Timeout)
+	defer cancel()
+
+	// the lookup already counted Redis being down
+	_, _ = d.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		set(pipe, buf.Bytes())
+		return nil
+	})
+}
+
+// invalidateAccount deletes the account's entry, under whichever email it was cached
+func (d *DB) invalidateAccount(ctx context.Context, id string) {
+	if d.cfg.AccountTTL == 0 {
+		return
+	}
+	if d.tx != nil {
+		d.tx.accounts[id] = true
+	}
+
+	ctx, cancel := d.invalidationContext(ctx)
+	defer cancel()
+
+	keys := []string{accountIDKey(id)}
+	email, err := d.client.Get(ctx, accountIDKey(id)).Result()
+	switch {
+	case err == nil:
+		keys = append(keys, accountKey(email))
+	case !errors.Is(err, redis.Nil):
+		slog.WarnContext(ctx, "error invalidating cached account, it can be stale until it expires",
+			"account_id", id, "error", err)
+		return
+	}
+	d.delete(ctx, keys...)
+}
+
+// invalidationContext outlives the request, the write already happened even if the client is
+// gone
+func (d *DB) invalidationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), d.cfg.Timeout)
+}
+
+func (d *DB) delete(ctx context.Context, keys ...string) {
+	if err := d.client.Del(ctx, keys...).Err(); err != nil {
+		slog.WarnContext(ctx, "error invalidating cache entries, they can be stale until they expire",
+			"keys", len(keys), "error", err)
+	}
+}
+
+var _ database.Repository = (*DB)(nil)
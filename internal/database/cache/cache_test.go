@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDB counts the lookups that reach the database
+type countingDB struct {
+	*database.MemoryDB
+	accountLookups      int
+	refreshTokenLookups int
+}
+
+func (c *countingDB) GetAccount(ctx context.Context, email string) (*database.Account, error) {
+	c.accountLookups++
+	return c.MemoryDB.GetAccount(ctx, email)
+}
+
+func (c *countingDB) GetRefreshToken(ctx context.Context, token string) (*database.RefreshToken, error) {
+	c.refreshTokenLookups++
+	return c.MemoryDB.GetRefreshToken(ctx, token)
+}
+
+func setupCache(t *testing.T) (*DB, *countingDB, *miniredis.Miniredis, map[string]int) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	db := &countingDB{MemoryDB: database.NewMemoryDB()}
+	results := map[string]int{}
+	cfg := DefaultConfig()
+	cfg.Observe = func(cache, result string) { results[cache+" "+result]++ }
+
+	return New(db, client, cfg), db, mr, results
+}
+
+func createAccount(t *testing.T, db database.Repository, email string) *database.Account {
+	t.Helper()
+
+	account, err := db.CreateAccount(context.Background(), database.AccountCreationParams{
+		Email:        email,
+		PasswordHash: "hash",
+	})
+	require.NoError(t, err)
+	return account
+}
+
+func TestGetAccount(t *testing.T) {
+	ctx := context.Background()
+	cached, db, mr, results := setupCache(t)
+	account := createAccount(t, cached, "test@example.com")
+
+	for range 3 {
+		found, err := cached.GetAccount(ctx, "test@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, found.ID)
+		// responses leave it out, the cache can't
+		assert.Equal(t, "hash", found.PasswordHash)
+	}
+	assert.Equal(t, 1, db.accountLookups)
+	assert.Equal(t, map[string]int{"account miss": 1, "account hit": 2}, results)
+	assert.Equal(t, time.Minute, mr.TTL(accountKey("test@example.com")))
+
+	// missing accounts aren't cached, they can be created any time
+	_, err := cached.GetAccount(ctx, "missing@example.com")
+	require.ErrorIs(t, err, database.ErrAccountNotFound)
+	assert.False(t, mr.Exists(accountKey("missing@example.com")))
+
+	t.Run("writes invalidate it", func(t *testing.T) {
+		_, err := cached.UpdatePassword(ctx, account.ID, "new-hash")
+		require.NoError(t, err)
+
+		found, err := cached.GetAccount(ctx, "test@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "new-hash", found.PasswordHash)
+		assert.Equal(t, 3, db.accountLookups, "with the missing account's")
+	})
+
+	t.Run("an email change invalidates the old email", func(t *testing.T) {
+		change, err := cached.CreateEmailChange(ctx, database.CreateEmailChangeParams{
+			AccountID:       account.ID,
+			NewEmail:        "new@example.com",
+			OldTokenHash:    "old",
+			NewTokenHash:    "new",
+			CancelTokenHash: "cancel",
+			ExpiresAt:       time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+		_, err = cached.ConfirmEmailChange(ctx, change.ID, database.EmailChangeSideOld)
+		require.NoError(t, err)
+		_, err = cached.ConfirmEmailChange(ctx, change.ID, database.EmailChangeSideNew)
+		require.NoError(t, err)
+
+		_, err = cached.GetAccount(ctx, "test@example.com")
+		require.NoError(t, err)
+		_, err = cached.CompleteEmailChange(ctx, change.ID)
+		require.NoError(t, err)
+
+		_, err = cached.GetAccount(ctx, "test@example.com")
+		require.ErrorIs(t, err, database.ErrAccountNotFound)
+	})
+}
+
+func TestUncachedReads(t *testing.T) {
+	ctx := context.Background()
+	cached, db, mr, results := setupCache(t)
+	account := createAccount(t, cached, "test@example.com")
+
+	// a stale entry, as if invalidating it after a password change had failed
+	_, err := cached.GetAccount(ctx, "test@example.com")
+	require.NoError(t, err)
+	_, err = db.MemoryDB.UpdatePassword(ctx, account.ID, "new-hash")
+	require.NoError(t, err)
+
+	found, err := cached.GetAccount(database.WithUncachedReads(ctx), "test@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "new-hash", found.PasswordHash)
+	assert.Equal(t, 2, db.accountLookups)
+	assert.Equal(t, map[string]int{"account miss": 1}, results)
+
+	// and it doesn't fill the cache with what it read
+	stale, err := cached.GetAccount(ctx, "test@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "hash", stale.PasswordHash)
+	assert.True(t, mr.Exists(accountKey("test@example.com")))
+}
+
+func TestRefreshTokensArentCached(t *testing.T) {
+	ctx := context.Background()
+	cached, db, mr, results := setupCache(t)
+	account := createAccount(t, cached, "test@example.com")
+
+	require.NoError(t, cached.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     "token-1",
+		AccountID: account.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+	for range 2 {
+		found, err := cached.GetRefreshToken(ctx, "token-1")
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, found.AccountID)
+	}
+	assert.Equal(t, 2, db.refreshTokenLookups)
+	assert.Empty(t, mr.Keys())
+	assert.Empty(t, results)
+
+	// so a logout is seen right away, even with Redis down
+	mr.Close()
+	require.NoError(t, cached.DeleteRefreshTokensByAccount(ctx, account.ID))
+	_, err := cached.GetRefreshToken(ctx, "token-1")
+	require.ErrorIs(t, err, database.ErrRefreshTokenNotFound)
+}
+
+func TestTransactions(t *testing.T) {
+	ctx := context.Background()
+	cached, db, mr, _ := setupCache(t)
+	account := createAccount(t, cached, "test@example.com")
+
+	_, err := cached.GetAccount(ctx, "test@example.com")
+	require.NoError(t, err)
+
+	err = cached.WithTx(ctx, func(tx database.Repository) error {
+		// unchanged yet, so the cache still answers
+		_, err := tx.GetAccount(ctx, "test@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, 1, db.accountLookups)
+
+		_, err = tx.UpdatePassword(ctx, account.ID, "new-hash")
+		require.NoError(t, err)
+
+		// and now the transaction's own change is read
+		found, err := tx.GetAccount(ctx, "test@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "new-hash", found.PasswordHash)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// what the transaction read isn't cached, it could have been rolled back
+	assert.False(t, mr.Exists(accountKey("test@example.com")))
+
+	found, err := cached.GetAccount(ctx, "test@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "new-hash", found.PasswordHash)
+}
+
+func TestRedisDown(t *testing.T) {
+	ctx := context.Background()
+	cached, db, mr, results := setupCache(t)
+	account := createAccount(t, cached, "test@example.com")
+	mr.Close()
+
+	found, err := cached.GetAccount(ctx, "test@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, found.ID)
+	assert.Equal(t, 1, db.accountLookups)
+	assert.Equal(t, 1, results["account error"])
+
+	// writes still go through
+	_, err = cached.UpdatePassword(ctx, account.ID, "new-hash")
+	require.NoError(t, err)
+}
@@ -2,46 +2,204 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
+	"github.com/austinwofford/account-management/internal/database/migrations"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 )
 
 type DB struct {
-	client *sqlx.DB
+	pool *sqlx.DB
+	// client runs the queries: the pool, or the transaction of a DB handed out by WithTx
+	client querier
+	// tx is the transaction client is, nil outside of WithTx
+	tx *sqlx.Tx
+	// retry is how the transactions of inTx are retried, the pool's statements are retried by
+	// client
+	retry RetryConfig
+	// replica is where reader sends reads, nil without DBConfig.ReplicaURL
+	replica *replica
+}
+
+// querier is what *sqlx.DB and *sqlx.Tx have in common
+type querier interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+	NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error)
 }
 
 func (d *DB) Close() error {
-	return d.client.Close()
+	if d.replica != nil {
+		return errors.Join(d.pool.Close(), d.replica.pool.Close())
+	}
+	return d.pool.Close()
+}
+
+type DBConfig struct {
+	// URL is the Postgres connection string
+	URL string
+	// Tracer is told about every query, e.g. to record how long they take. Optional.
+	Tracer pgx.QueryTracer
+	// Retry defaults to DefaultRetryConfig
+	Retry *RetryConfig
+	// ReplicaURL is an optional read-only replica. Account and refresh token lookups and lists
+	// are read from it, and everything else from URL.
+	ReplicaURL string
+	// ReplicaTracer is Tracer for the replica's queries. Optional.
+	ReplicaTracer pgx.QueryTracer
+	// OnReplicaFallback is told when a read meant for the replica goes to the primary, with one
+	// of the Fallback reasons. Optional.
+	OnReplicaFallback func(reason string)
 }
 
 func NewDB(connString string) (*DB, error) {
+	return NewDBWithConfig(DBConfig{URL: connString})
+}
+
+func NewDBWithConfig(cfg DBConfig) (*DB, error) {
 	ctx := context.Background()
 
-	pgxCfg, err := pgxpool.ParseConfig(connString)
+	client, err := openPool(ctx, cfg.URL, cfg.Tracer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.PingContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	retry := DefaultRetryConfig()
+	if cfg.Retry != nil {
+		retry = *cfg.Retry
+	}
+
+	db := &DB{
+		pool:   client,
+		client: retryingQuerier{querier: client, cfg: retry},
+		retry:  retry,
+	}
+
+	if cfg.ReplicaURL != "" {
+		replicaClient, err := openPool(ctx, cfg.ReplicaURL, cfg.ReplicaTracer)
+		if err != nil {
+			_ = client.Close()
+			return nil, fmt.Errorf("error opening read replica: %w", err)
+		}
+		db.replica = &replica{pool: replicaClient, client: replicaClient, onFallback: cfg.OnReplicaFallback}
+
+		// the primary can serve reads until the replica is back, so it isn't needed to start
+		if err := replicaClient.PingContext(ctx); err != nil {
+			slog.Warn("read replica unavailable, reading from the primary", "error", err)
+			db.replica.markDown(time.Now())
+		}
+	}
+
+	return db, nil
+}
+
+// openPool opens a connection pool to the database at url without connecting yet
+func openPool(ctx context.Context, url string, tracer pgx.QueryTracer) (*sqlx.DB, error) {
+	pgxCfg, err := pgxpool.ParseConfig(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse connection string: %w", err)
 	}
+	tracers := queryTracers{spanErrorTracer{}}
+	if tracer != nil {
+		tracers = append(tracers, tracer)
+	}
+	pgxCfg.ConnConfig.Tracer = tracers
 
-	pool, err := pgxpool.New(ctx, pgxCfg.ConnString())
+	pool, err := pgxpool.NewWithConfig(ctx, pgxCfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create db connection pool: %w", err)
 	}
 
-	client := sqlx.NewDb(stdlib.OpenDBFromPool(pool), "pgx")
+	return sqlx.NewDb(stdlib.OpenDBFromPool(pool), "pgx"), nil
+}
+
+func (d *DB) HealthCheck(ctx context.Context) error {
+	return d.pool.PingContext(ctx)
+}
+
+// WithTx runs fn in a transaction, committed if fn returns nil and rolled back otherwise. Every
+// query of the Repository fn is given runs in the transaction, including the ones that already
+// use their own. Calling WithTx on it runs in the same transaction too. It isn't retried, fn
+// can do more than run queries.
+func (d *DB) WithTx(ctx context.Context, fn func(tx Repository) error) error {
+	return d.transact(ctx, func(tx *sqlx.Tx) error {
+		return fn(&DB{pool: d.pool, client: tx, tx: tx, retry: d.retry, replica: d.replica})
+	})
+}
+
+// inTx runs fn in a transaction, committed if it returns nil. Within WithTx it runs in WithTx's
+// transaction, which is committed or rolled back by WithTx. Otherwise the transaction is retried
+// when it was rolled back for a transient reason, so fn can't do anything but run queries.
+func (d *DB) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	if d.tx != nil {
+		return fn(d.tx)
+	}
+	return d.retry.do(ctx, false, func() error {
+		return d.transact(ctx, fn)
+	})
+}
+
+// transact runs fn in a transaction once, or in WithTx's
+func (d *DB) transact(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	if d.tx != nil {
+		return fn(d.tx)
+	}
 
-	err = client.PingContext(ctx)
+	tx, err := d.pool.BeginTxx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
 	}
 
-	return &DB{
-		client: client,
-	}, nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
 }
 
-func (d *DB) HealthCheck(ctx context.Context) error {
-	return d.client.PingContext(ctx)
+// Migrate applies the embedded migrations the database doesn't have yet and returns how many were
+// applied
+func (d *DB) Migrate(ctx context.Context) (int, error) {
+	m, err := migrations.New(d.pool.DB)
+	if err != nil {
+		return 0, err
+	}
+	return m.Up(ctx)
+}
+
+// CheckMigrations returns an error when the database is missing embedded migrations or a
+// migration failed partway through. A newer version is fine, it's a rolled back deploy.
+func (d *DB) CheckMigrations(ctx context.Context) error {
+	m, err := migrations.New(d.pool.DB)
+	if err != nil {
+		return err
+	}
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("database is dirty at version %d", version)
+	}
+	if version < m.Latest() {
+		return fmt.Errorf("database is at version %d, the migrations go up to %d", version, m.Latest())
+	}
+	return nil
 }
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrDeletionRequestNotFound = errors.New("deletion request not found")
+	// ErrDeletionAlreadyRequested is a deletion request for an account that already has one
+	ErrDeletionAlreadyRequested = errors.New("deletion already requested")
+)
+
+// DeletionRequest is an account asking to be erased once EraseAt has passed, see EraseAccount
+type DeletionRequest struct {
+	AccountID      string     `db:"account_id"`
+	EraseAt        time.Time  `db:"erase_at"`
+	ReminderSentAt *time.Time `db:"reminder_sent_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+// CreateDeletionRequest schedules the account to be erased at eraseAt. It fails with
+// ErrDeletionAlreadyRequested if the account has a request pending, or ErrAccountNotFound.
+func (d *DB) CreateDeletionRequest(ctx context.Context, accountID string, eraseAt time.Time) (*DeletionRequest, error) {
+	ctx, span := startSpan(ctx, "CreateDeletionRequest")
+	defer span.End()
+
+	var result DeletionRequest
+	err := d.client.GetContext(ctx, &result, createDeletionRequestSQL, accountID, eraseAt)
+	if err == nil {
+		return &result, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error creating deletion request: %w", err)
+	}
+
+	// nothing was inserted, either because there's no such account or it already has a request
+	if _, err := d.GetAccountByID(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return nil, ErrDeletionAlreadyRequested
+}
+
+func (d *DB) GetDeletionRequest(ctx context.Context, accountID string) (*DeletionRequest, error) {
+	ctx, span := startSpan(ctx, "GetDeletionRequest")
+	defer span.End()
+
+	var result DeletionRequest
+	if err := d.client.GetContext(ctx, &result, getDeletionRequestSQL, accountID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDeletionRequestNotFound
+		}
+		return nil, fmt.Errorf("error getting deletion request: %w", err)
+	}
+	return &result, nil
+}
+
+// CancelDeletionRequest deletes the account's pending deletion request and returns it, or fails
+// with ErrDeletionRequestNotFound
+func (d *DB) CancelDeletionRequest(ctx context.Context, accountID string) (*DeletionRequest, error) {
+	ctx, span := startSpan(ctx, "CancelDeletionRequest")
+	defer span.End()
+
+	var result DeletionRequest
+	if err := d.client.GetContext(ctx, &result, cancelDeletionRequestSQL, accountID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDeletionRequestNotFound
+		}
+		return nil, fmt.Errorf("error cancelling deletion request: %w", err)
+	}
+	return &result, nil
+}
+
+// ListDueDeletionRequests returns up to limit requests to be erased before the cutoff, the
+// earliest first
+func (d *DB) ListDueDeletionRequests(ctx context.Context, eraseBefore time.Time, limit int) ([]DeletionRequest, error) {
+	ctx, span := startSpan(ctx, "ListDueDeletionRequests")
+	defer span.End()
+
+	result := []DeletionRequest{}
+	if err := d.client.SelectContext(ctx, &result, listDueDeletionRequestsSQL, eraseBefore, limit); err != nil {
+		return nil, fmt.Errorf("error listing due deletion requests: %w", err)
+	}
+	return result, nil
+}
+
+// ListDeletionRemindersDue returns up to limit requests to be erased before the cutoff that
+// haven't been sent a reminder, the earliest first
+func (d *DB) ListDeletionRemindersDue(ctx context.Context, eraseBefore time.Time, limit int) ([]DeletionRequest, error) {
+	ctx, span := startSpan(ctx, "ListDeletionRemindersDue")
+	defer span.End()
+
+	result := []DeletionRequest{}
+	if err := d.client.SelectContext(ctx, &result, listDeletionRemindersDueSQL, eraseBefore, limit); err != nil {
+		return nil, fmt.Errorf("error listing due deletion reminders: %w", err)
+	}
+	return result, nil
+}
+
+func (d *DB) MarkDeletionReminderSent(ctx context.Context, accountID string, at time.Time) error {
+	ctx, span := startSpan(ctx, "MarkDeletionReminderSent")
+	defer span.End()
+
+	if _, err := d.client.ExecContext(ctx, markDeletionReminderSentSQL, accountID, at); err != nil {
+		return fmt.Errorf("error marking deletion reminder sent: %w", err)
+	}
+	return nil
+}
+
+var (
+	createDeletionRequestSQL = `
+		INSERT INTO account_deletion_requests (account_id, erase_at)
+		SELECT id, $2 FROM accounts WHERE id = $1 AND deleted_at IS NULL
+		ON CONFLICT (account_id) DO NOTHING
+		RETURNING account_id, erase_at, reminder_sent_at, created_at;`
+
+	getDeletionRequestSQL = `
+		SELECT account_id, erase_at, reminder_sent_at, created_at
+		FROM account_deletion_requests
+		WHERE account_id = $1;`
+
+	cancelDeletionRequestSQL = `
+		DELETE FROM account_deletion_requests
+		WHERE account_id = $1
+		RETURNING account_id, erase_at, reminder_sent_at, created_at;`
+
+	listDueDeletionRequestsSQL = `
+		SELECT account_id, erase_at, reminder_sent_at, created_at
+		FROM account_deletion_requests
+		WHERE erase_at < $1
+		ORDER BY erase_at
+		LIMIT $2;`
+
+	listDeletionRemindersDueSQL = `
+		SELECT account_id, erase_at, reminder_sent_at, created_at
+		FROM account_deletion_requests
+		WHERE erase_at < $1 AND reminder_sent_at IS NULL
+		ORDER BY erase_at
+		LIMIT $2;`
+
+	markDeletionReminderSentSQL = `
+		UPDATE account_deletion_requests
+		SET reminder_sent_at = $2
+		WHERE account_id = $1;`
+)
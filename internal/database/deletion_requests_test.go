@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeletionRequests(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "deletionrequest@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	eraseAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	request, err := db.CreateDeletionRequest(ctx, account.ID, eraseAt)
+	require.NoError(t, err)
+	assert.True(t, eraseAt.Equal(request.EraseAt))
+	assert.Nil(t, request.ReminderSentAt)
+
+	_, err = db.CreateDeletionRequest(ctx, account.ID, eraseAt)
+	require.ErrorIs(t, err, ErrDeletionAlreadyRequested)
+	_, err = db.CreateDeletionRequest(ctx, "00000000-0000-0000-0000-000000000000", eraseAt)
+	require.ErrorIs(t, err, ErrAccountNotFound)
+
+	// due for a reminder within two hours, but not for erasure yet
+	reminders, err := db.ListDeletionRemindersDue(ctx, time.Now().Add(2*time.Hour), 100)
+	require.NoError(t, err)
+	assert.Contains(t, deletionRequestAccountIDs(reminders), account.ID)
+	due, err := db.ListDueDeletionRequests(ctx, time.Now(), 100)
+	require.NoError(t, err)
+	assert.NotContains(t, deletionRequestAccountIDs(due), account.ID)
+
+	require.NoError(t, db.MarkDeletionReminderSent(ctx, account.ID, time.Now()))
+	reminders, err = db.ListDeletionRemindersDue(ctx, time.Now().Add(2*time.Hour), 100)
+	require.NoError(t, err)
+	assert.NotContains(t, deletionRequestAccountIDs(reminders), account.ID)
+
+	cancelled, err := db.CancelDeletionRequest(ctx, account.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, cancelled.ReminderSentAt)
+	_, err = db.CancelDeletionRequest(ctx, account.ID)
+	require.ErrorIs(t, err, ErrDeletionRequestNotFound)
+	_, err = db.GetDeletionRequest(ctx, account.ID)
+	require.ErrorIs(t, err, ErrDeletionRequestNotFound)
+
+	// a cancelled request isn't carried out
+	require.ErrorIs(t, db.EraseAccount(ctx, account.ID), ErrDeletionRequestNotFound)
+	_, err = db.GetAccountByID(ctx, account.ID)
+	require.NoError(t, err)
+}
+
+func TestEraseAccount(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "erase@test.com", Username: "erase_me", PasswordHash: "hash"})
+	require.NoError(t, err)
+	_, err = db.CreateDeletionRequest(ctx, account.ID, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, db.CreateAuditEvent(ctx, CreateAuditEventParams{
+		AccountID: account.ID,
+		EventType: AuditEventLogin,
+		IPAddress: "203.0.113.7",
+		UserAgent: "Firefox",
+	}))
+
+	require.NoError(t, db.EraseAccount(ctx, account.ID))
+	require.ErrorIs(t, db.EraseAccount(ctx, account.ID), ErrDeletionRequestNotFound, "the request is gone once it's carried out")
+
+	_, err = db.GetAccountByID(ctx, account.ID)
+	require.ErrorIs(t, err, ErrAccountNotFound)
+	_, err = db.GetDeletionRequest(ctx, account.ID)
+	require.ErrorIs(t, err, ErrDeletionRequestNotFound)
+
+	// the email and username are free again
+	_, err = db.CreateAccount(ctx, AccountCreationParams{Email: account.Email, Username: "erase_me", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	// the audit trail still points at the account, without where it was used from
+	events, err := db.ListAuditEvents(ctx, ListAuditEventsParams{AccountID: account.ID, Keyset: Keyset{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Empty(t, events[0].IPAddress)
+	assert.Empty(t, events[0].UserAgent)
+
+	// and it's never purged
+	_, err = db.PurgeDeletedAccounts(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	events, err = db.ListAuditEvents(ctx, ListAuditEventsParams{AccountID: account.ID, Keyset: Keyset{Limit: 10}})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func deletionRequestAccountIDs(requests []DeletionRequest) []string {
+	ids := make([]string, len(requests))
+	for i, request := range requests {
+		ids[i] = request.AccountID
+	}
+	return ids
+}
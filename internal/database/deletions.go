@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DeleteAccount soft deletes the account. It's treated as not found from then on and its email
+// can be registered again, but the row is kept until PurgeDeletedAccounts removes it. Its
+// sessions, linked identities, and outstanding emailed links are deleted right away.
+func (d *DB) DeleteAccount(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "DeleteAccount")
+	defer span.End()
+
+	var deletedID string
+	if err := d.client.GetContext(ctx, &deletedID, deleteAccountSQL, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAccountNotFound
+		}
+		return fmt.Errorf("error deleting account: %w", err)
+	}
+	return nil
+}
+
+// PurgeDeletedAccounts permanently deletes accounts soft deleted before the cutoff and returns
+// how many were purged. Their audit events are kept without the account. Erased accounts are
+// kept for their audit events.
+func (d *DB) PurgeDeletedAccounts(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "PurgeDeletedAccounts")
+	defer span.End()
+
+	var n int64
+	if err := d.client.GetContext(ctx, &n, purgeDeletedAccountsSQL, deletedBefore); err != nil {
+		return 0, fmt.Errorf("error purging deleted accounts: %w", err)
+	}
+	return n, nil
+}
+
+// EraseAccount carries out the account's deletion request, anonymizing the account for good.
+// What it logs in with and could still be sent is deleted like DeleteAccount does, along with
+// its organization memberships and roles, and every personal field is cleared. Its email becomes
+// <id>@erased.invalid. The row is kept, erased and soft deleted, so its audit events still point
+// at it, though without their IP addresses and user agents. Soft deleted accounts can be erased
+// too. It fails with ErrDeletionRequestNotFound if the request is gone, e.g. because logging in
+// cancelled it.
+func (d *DB) EraseAccount(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "EraseAccount")
+	defer span.End()
+
+	return d.inTx(ctx, func(tx *sqlx.Tx) error {
+		// taking the request first means a login cancelling it at the same time either wins or
+		// waits for the erasure
+		var requestID string
+		if err := tx.GetContext(ctx, &requestID, takeDeletionRequestSQL, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrDeletionRequestNotFound
+			}
+			return fmt.Errorf("error erasing account: %w", err)
+		}
+
+		var erasedID string
+		if err := tx.GetContext(ctx, &erasedID, eraseAccountSQL, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error erasing account: %w", err)
+		}
+		return nil
+	})
+}
+
+var (
+	// deleteAccountDataSQL are the CTEs deleting everything the account $1 logs in with or
+	// could still be sent, shared by deleting and erasing it
+	deleteAccountDataSQL = `deleted_refresh_tokens AS (
+			DELETE FROM refresh_tokens WHERE account_id = $1
+		), deleted_identities AS (
+			DELETE FROM account_identities WHERE account_id = $1
+		), deleted_email_changes AS (
+			DELETE FROM email_changes WHERE account_id = $1
+		), deleted_freeze_tokens AS (
+			DELETE FROM account_freeze_tokens WHERE account_id = $1
+		), deleted_verifications AS (
+			DELETE FROM email_verifications WHERE account_id = $1
+		), deleted_reset_tokens AS (
+			DELETE FROM password_reset_tokens WHERE account_id = $1
+		), deleted_mfa_secrets AS (
+			DELETE FROM mfa_secrets WHERE account_id = $1
+		), deleted_mfa_recovery_codes AS (
+			DELETE FROM mfa_recovery_codes WHERE account_id = $1
+		), deleted_mfa_phones AS (
+			DELETE FROM mfa_phones WHERE account_id = $1
+		), deleted_api_keys AS (
+			DELETE FROM api_keys WHERE account_id = $1
+		), deleted_oauth_authorization_codes AS (
+			DELETE FROM oauth_authorization_codes WHERE account_id = $1
+		), deleted_federated_identities AS (
+			DELETE FROM federated_identities WHERE account_id = $1
+		), deleted_known_devices AS (
+			DELETE FROM known_devices WHERE account_id = $1
+		), deleted_trusted_devices AS (
+			DELETE FROM trusted_devices WHERE account_id = $1
+		)`
+
+	deleteAccountSQL = `
+		WITH ` + deleteAccountDataSQL + `, account AS (
+			UPDATE accounts
+			SET deleted_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, email
+		), outbox_event AS (` + insertAccountOutboxEventSQL(OutboxEventAccountDeleted, "account") + `
+		)
+		SELECT id FROM account;`
+
+	purgeDeletedAccountsSQL = `
+		WITH purged AS (
+			DELETE FROM accounts WHERE deleted_at < $1 AND erased_at IS NULL
+			RETURNING id, email
+		), outbox_event AS (` + insertAccountOutboxEventSQL(OutboxEventAccountPurged, "purged") + `
+		)
+		SELECT COUNT(*) FROM purged;`
+
+	takeDeletionRequestSQL = `
+		DELETE FROM account_deletion_requests WHERE account_id = $1
+		RETURNING account_id;`
+
+	eraseAccountSQL = `
+		WITH ` + deleteAccountDataSQL + `, deleted_organization_memberships AS (
+			DELETE FROM organization_members WHERE account_id = $1
+		), deleted_roles AS (
+			DELETE FROM account_roles WHERE account_id = $1
+		), scrubbed_audit_events AS (
+			UPDATE audit_events SET ip_address = NULL, user_agent = NULL WHERE account_id = $1
+		), account AS (
+			UPDATE accounts
+			SET email = id::text || '@erased.invalid', username = '', password_hash = '', display_name = '',
+				given_name = '', family_name = '', timezone = '', avatar_url = '', tags = '{}',
+				feature_flags = '{}', user_metadata = '{}', app_metadata = '{}',
+				deleted_at = COALESCE(deleted_at, NOW()), erased_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND erased_at IS NULL
+			RETURNING id, email
+		), outbox_event AS (` + insertAccountOutboxEventSQL(OutboxEventAccountErased, "account") + `
+		)
+		SELECT id FROM account;`
+)
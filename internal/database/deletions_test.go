@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountDeletions(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "deletetest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "delete-test-refresh-token",
+		AccountID: testAccount.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	err = db.DeleteAccount(ctx, testAccount.ID)
+	require.NoError(t, err)
+
+	err = db.DeleteAccount(ctx, testAccount.ID)
+	require.ErrorIs(t, err, ErrAccountNotFound)
+
+	_, err = db.GetAccount(ctx, testAccount.Email)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+	_, err = db.GetAccountByID(ctx, testAccount.ID)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+	_, err = db.GetRefreshToken(ctx, "delete-test-refresh-token")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	// the email can be registered again while the deleted account is kept
+	reregistered, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        testAccount.Email,
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, testAccount.ID, reregistered.ID)
+
+	purged, err := db.PurgeDeletedAccounts(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	purged, err = db.PurgeDeletedAccounts(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, int64(1))
+
+	_, err = db.GetAccount(ctx, testAccount.Email)
+	require.NoError(t, err, "only deleted accounts are purged")
+}
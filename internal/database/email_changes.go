@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrEmailChangeNotFound = errors.New("email change not found")
+
+// EmailChangeSide is which address is confirming an email change
+type EmailChangeSide string
+
+const (
+	EmailChangeSideOld EmailChangeSide = "old"
+	EmailChangeSideNew EmailChangeSide = "new"
+)
+
+type EmailChange struct {
+	ID              string     `db:"id"`
+	AccountID       string     `db:"account_id"`
+	NewEmail        string     `db:"new_email"`
+	OldTokenHash    string     `db:"old_token_hash"`
+	NewTokenHash    string     `db:"new_token_hash"`
+	CancelTokenHash string     `db:"cancel_token_hash"`
+	OldConfirmedAt  *time.Time `db:"old_confirmed_at"`
+	NewConfirmedAt  *time.Time `db:"new_confirmed_at"`
+	ExpiresAt       time.Time  `db:"expires_at"`
+	CreatedAt       time.Time  `db:"created_at"`
+}
+
+// Confirmed reports whether both addresses have confirmed the change
+func (e *EmailChange) Confirmed() bool {
+	return e.OldConfirmedAt != nil && e.NewConfirmedAt != nil
+}
+
+type CreateEmailChangeParams struct {
+	AccountID       string    `db:"account_id"`
+	NewEmail        string    `db:"new_email"`
+	OldTokenHash    string    `db:"old_token_hash"`
+	NewTokenHash    string    `db:"new_token_hash"`
+	CancelTokenHash string    `db:"cancel_token_hash"`
+	ExpiresAt       time.Time `db:"expires_at"`
+}
+
+// CreateEmailChange starts an email change, replacing any pending change for the account
+func (d *DB) CreateEmailChange(ctx context.Context, params CreateEmailChangeParams) (*EmailChange, error) {
+	ctx, span := startSpan(ctx, "CreateEmailChange")
+	defer span.End()
+
+	rows, err := sqlx.NamedQueryContext(ctx, d.client, createEmailChangeSQL, params)
+	if err != nil {
+		return nil, fmt.Errorf("error creating email change: %w", err)
+	}
+	defer rows.Close()
+
+	var result EmailChange
+	if !rows.Next() {
+		return nil, sql.ErrNoRows
+	}
+	if err := rows.StructScan(&result); err != nil {
+		return nil, fmt.Errorf("error scanning created email change: %w", err)
+	}
+
+	return &result, nil
+}
+
+// GetEmailChangeByTokenHash finds the change any of the emailed tokens belongs to
+func (d *DB) GetEmailChangeByTokenHash(ctx context.Context, tokenHash string) (*EmailChange, error) {
+	ctx, span := startSpan(ctx, "GetEmailChangeByTokenHash")
+	defer span.End()
+
+	var result EmailChange
+	err := d.client.GetContext(ctx, &result, getEmailChangeByTokenHashSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEmailChangeNotFound
+		}
+		return nil, fmt.Errorf("error getting email change: %w", err)
+	}
+	return &result, nil
+}
+
+// ConfirmEmailChange records the confirmation from one side. Confirming twice is a no-op.
+func (d *DB) ConfirmEmailChange(ctx context.Context, id string, side EmailChangeSide) (*EmailChange, error) {
+	ctx, span := startSpan(ctx, "ConfirmEmailChange")
+	defer span.End()
+
+	query := confirmOldEmailChangeSQL
+	if side == EmailChangeSideNew {
+		query = confirmNewEmailChangeSQL
+	}
+
+	var result EmailChange
+	err := d.client.GetContext(ctx, &result, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEmailChangeNotFound
+		}
+		return nil, fmt.Errorf("error confirming email change: %w", err)
+	}
+	return &result, nil
+}
+
+// CompleteEmailChange switches the account to the new email and removes the pending change.
+// The new email was confirmed so the account counts as verified. It returns
+// ErrAccountAlreadyExists if the new email was taken in the meantime. It returns the completed
+// change.
+func (d *DB) CompleteEmailChange(ctx context.Context, id string) (*EmailChange, error) {
+	ctx, span := startSpan(ctx, "CompleteEmailChange")
+	defer span.End()
+
+	var change EmailChange
+	err := d.inTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &change, deleteEmailChangeReturningSQL, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrEmailChangeNotFound
+			}
+			return fmt.Errorf("error deleting email change: %w", err)
+		}
+
+		if !change.Confirmed() {
+			return fmt.Errorf("error completing email change: not confirmed by both addresses")
+		}
+
+		if _, err := tx.ExecContext(ctx, updateAccountEmailSQL, change.AccountID, change.NewEmail); err != nil {
+			if c, _ := uniqueConstraint(err); c == duplicateEmailConstraint {
+				return ErrAccountAlreadyExists
+			}
+			return fmt.Errorf("error updating account email: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+func (d *DB) DeleteEmailChange(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "DeleteEmailChange")
+	defer span.End()
+
+	_, err := d.client.ExecContext(ctx, deleteEmailChangeSQL, id)
+	if err != nil {
+		return fmt.Errorf("error deleting email change: %w", err)
+	}
+	return nil
+}
+
+const emailChangeColumns = `id, account_id, new_email, old_token_hash, new_token_hash, cancel_token_hash,
+		old_confirmed_at, new_confirmed_at, expires_at, created_at`
+
+var (
+	createEmailChangeSQL = `
+		INSERT INTO email_changes (account_id, new_email, old_token_hash, new_token_hash, cancel_token_hash, expires_at)
+		VALUES (:account_id, :new_email, :old_token_hash, :new_token_hash, :cancel_token_hash, :expires_at)
+		ON CONFLICT (account_id)
+		DO UPDATE SET
+			new_email = EXCLUDED.new_email,
+			old_token_hash = EXCLUDED.old_token_hash,
+			new_token_hash = EXCLUDED.new_token_hash,
+			cancel_token_hash = EXCLUDED.cancel_token_hash,
+			old_confirmed_at = NULL,
+			new_confirmed_at = NULL,
+			expires_at = EXCLUDED.expires_at,
+			created_at = NOW()
+		RETURNING ` + emailChangeColumns + `;`
+
+	getEmailChangeByTokenHashSQL = `
+		SELECT ` + emailChangeColumns + `
+		FROM email_changes
+		WHERE old_token_hash = $1 OR new_token_hash = $1 OR cancel_token_hash = $1;`
+
+	confirmOldEmailChangeSQL = `
+		UPDATE email_changes SET old_confirmed_at = COALESCE(old_confirmed_at, NOW())
+		WHERE id = $1
+		RETURNING ` + emailChangeColumns + `;`
+
+	confirmNewEmailChangeSQL = `
+		UPDATE email_changes SET new_confirmed_at = COALESCE(new_confirmed_at, NOW())
+		WHERE id = $1
+		RETURNING ` + emailChangeColumns + `;`
+
+	deleteEmailChangeReturningSQL = `
+		DELETE FROM email_changes WHERE id = $1
+		RETURNING ` + emailChangeColumns + `;`
+
+	deleteEmailChangeSQL = `
+		DELETE FROM email_changes WHERE id = $1;`
+
+	updateAccountEmailSQL = `
+		WITH account AS (
+			UPDATE accounts SET email = $2, verified_at = COALESCE(verified_at, NOW()), updated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, email
+		)` + insertAccountOutboxEventSQL(OutboxEventAccountEmailChanged, "account") + `;`
+)
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// FeatureFlags are an account's overrides of the default feature flags, stored as a JSONB object
+type FeatureFlags map[string]bool
+
+func (f *FeatureFlags) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("error scanning feature flags: unexpected type %T", src)
+	}
+
+	result := FeatureFlags{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("error scanning feature flags: %w", err)
+	}
+	*f = result
+	return nil
+}
+
+// UpdateAccountFeatureFlags sets the flags in set and removes the overrides in unset, leaving
+// the account's other flags as they are
+func (d *DB) UpdateAccountFeatureFlags(ctx context.Context, id string, set map[string]bool, unset []string) (*Account, error) {
+	ctx, span := startSpan(ctx, "UpdateAccountFeatureFlags")
+	defer span.End()
+
+	if set == nil {
+		set = map[string]bool{}
+	}
+	if unset == nil {
+		unset = []string{}
+	}
+
+	setJSON, err := json.Marshal(set)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding feature flags: %w", err)
+	}
+
+	var result Account
+	err = d.client.GetContext(ctx, &result, updateAccountFeatureFlagsSQL, id, string(setJSON), unset)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error updating account feature flags: %w", err)
+	}
+	return &result, nil
+}
+
+var (
+	updateAccountFeatureFlagsSQL = `
+		UPDATE accounts
+		SET feature_flags = (feature_flags - $3::text[]) || $2::jsonb, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at;`
+)
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateAccountFeatureFlags(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "flagtest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, FeatureFlags{}, testAccount.FeatureFlags)
+
+	updated, err := db.UpdateAccountFeatureFlags(ctx, testAccount.ID, map[string]bool{"new-dashboard": true, "exports": false}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, FeatureFlags{"new-dashboard": true, "exports": false}, updated.FeatureFlags)
+
+	updated, err = db.UpdateAccountFeatureFlags(ctx, testAccount.ID, nil, []string{"exports"})
+	require.NoError(t, err)
+	assert.Equal(t, FeatureFlags{"new-dashboard": true}, updated.FeatureFlags)
+
+	actual, err := db.GetAccountByID(ctx, testAccount.ID)
+	require.NoError(t, err)
+	assert.Equal(t, updated.FeatureFlags, actual.FeatureFlags)
+
+	_, err = db.UpdateAccountFeatureFlags(ctx, "00000000-0000-0000-0000-000000000000", map[string]bool{"exports": true}, nil)
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrFreezeTokenNotFound = errors.New("freeze token not found")
+
+// FreezeTokenPurpose is what following an emailed freeze link does
+type FreezeTokenPurpose string
+
+const (
+	FreezeTokenPurposeFreeze   FreezeTokenPurpose = "freeze"
+	FreezeTokenPurposeUnfreeze FreezeTokenPurpose = "unfreeze"
+)
+
+type FreezeToken struct {
+	TokenHash string             `db:"token_hash"`
+	AccountID string             `db:"account_id"`
+	Purpose   FreezeTokenPurpose `db:"purpose"`
+	ExpiresAt time.Time          `db:"expires_at"`
+	CreatedAt time.Time          `db:"created_at"`
+}
+
+type CreateFreezeTokenParams struct {
+	TokenHash string             `db:"token_hash"`
+	AccountID string             `db:"account_id"`
+	Purpose   FreezeTokenPurpose `db:"purpose"`
+	ExpiresAt time.Time          `db:"expires_at"`
+}
+
+func (d *DB) CreateFreezeToken(ctx context.Context, params CreateFreezeTokenParams) error {
+	ctx, span := startSpan(ctx, "CreateFreezeToken")
+	defer span.End()
+
+	_, err := d.client.NamedExecContext(ctx, createFreezeTokenSQL, params)
+	if err != nil {
+		return fmt.Errorf("error creating freeze token: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetFreezeToken(ctx context.Context, tokenHash string) (*FreezeToken, error) {
+	ctx, span := startSpan(ctx, "GetFreezeToken")
+	defer span.End()
+
+	var result FreezeToken
+	err := d.client.GetContext(ctx, &result, getFreezeTokenSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFreezeTokenNotFound
+		}
+		return nil, fmt.Errorf("error getting freeze token: %w", err)
+	}
+	return &result, nil
+}
+
+// FreezeAccount freezes the account and deletes its refresh tokens, ending every session, its
+// trusted devices, and any outstanding freeze links. Freezing a frozen account keeps the
+// original FrozenAt.
+func (d *DB) FreezeAccount(ctx context.Context, id string) (*Account, error) {
+	ctx, span := startSpan(ctx, "FreezeAccount")
+	defer span.End()
+
+	var result Account
+	err := d.client.GetContext(ctx, &result, freezeAccountSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error freezing account: %w", err)
+	}
+	return &result, nil
+}
+
+// UnfreezeAccount unfreezes the account and deletes its outstanding freeze links. passwordHash
+// replaces the account's password unless it's empty.
+func (d *DB) UnfreezeAccount(ctx context.Context, id, passwordHash string) (*Account, error) {
+	ctx, span := startSpan(ctx, "UnfreezeAccount")
+	defer span.End()
+
+	var result Account
+	err := d.client.GetContext(ctx, &result, unfreezeAccountSQL, id, passwordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error unfreezing account: %w", err)
+	}
+	return &result, nil
+}
+
+var (
+	createFreezeTokenSQL = `
+		INSERT INTO account_freeze_tokens (token_hash, account_id, purpose, expires_at)
+		VALUES (:token_hash, :account_id, :purpose, :expires_at);`
+
+	getFreezeTokenSQL = `
+		SELECT token_hash, account_id, purpose, expires_at, created_at
+		FROM account_freeze_tokens
+		WHERE token_hash = $1;`
+
+	freezeAccountSQL = `
+		WITH deleted_refresh_tokens AS (
+			DELETE FROM refresh_tokens WHERE account_id = $1
+		), deleted_freeze_tokens AS (
+			DELETE FROM account_freeze_tokens WHERE account_id = $1
+		), deleted_trusted_devices AS (
+			DELETE FROM trusted_devices WHERE account_id = $1
+		), account AS (
+			UPDATE accounts
+			SET frozen_at = COALESCE(frozen_at, NOW()), updated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		), newly_frozen AS (
+			-- NOW() is when the transaction started, so only accounts frozen just now
+			SELECT id, email FROM account WHERE frozen_at = NOW()
+		), outbox_event AS (` + insertAccountOutboxEventSQL(OutboxEventAccountFrozen, "newly_frozen") + `
+		)
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM account;`
+
+	unfreezeAccountSQL = `
+		WITH deleted_freeze_tokens AS (
+			DELETE FROM account_freeze_tokens WHERE account_id = $1
+		), account AS (
+			UPDATE accounts
+			SET frozen_at = NULL, password_hash = COALESCE(NULLIF($2, ''), password_hash), updated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		), outbox_event AS (` + insertAccountOutboxEventSQL(OutboxEventAccountUnfrozen, "account") + `
+		)
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM account;`
+)
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountFreezes(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "freezetest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, testAccount.FrozenAt)
+
+	err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "freeze-test-refresh-token",
+		AccountID: testAccount.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	err = db.CreateFreezeToken(ctx, CreateFreezeTokenParams{
+		TokenHash: "freeze-test-token-hash",
+		AccountID: testAccount.ID,
+		Purpose:   FreezeTokenPurposeFreeze,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	token, err := db.GetFreezeToken(ctx, "freeze-test-token-hash")
+	require.NoError(t, err)
+	assert.Equal(t, testAccount.ID, token.AccountID)
+	assert.Equal(t, FreezeTokenPurposeFreeze, token.Purpose)
+
+	frozen, err := db.FreezeAccount(ctx, testAccount.ID)
+	require.NoError(t, err)
+	require.NotNil(t, frozen.FrozenAt)
+
+	_, err = db.GetRefreshToken(ctx, "freeze-test-refresh-token")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+	_, err = db.GetFreezeToken(ctx, "freeze-test-token-hash")
+	assert.ErrorIs(t, err, ErrFreezeTokenNotFound)
+
+	unfrozen, err := db.UnfreezeAccount(ctx, testAccount.ID, "new-password-hash")
+	require.NoError(t, err)
+	assert.Nil(t, unfrozen.FrozenAt)
+	assert.Equal(t, "new-password-hash", unfrozen.PasswordHash)
+
+	_, err = db.FreezeAccount(ctx, "00000000-0000-0000-0000-000000000000")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const IdentityProviderApple = "apple"
+
+// AccountIdentity links an account to a user at an external identity provider
+type AccountIdentity struct {
+	ID        string    `db:"id"`
+	AccountID string    `db:"account_id"`
+	Provider  string    `db:"provider"`
+	Subject   string    `db:"subject"`
+	Email     string    `db:"email"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type CreateAccountIdentityParams struct {
+	AccountID string `db:"account_id"`
+	Provider  string `db:"provider"`
+	Subject   string `db:"subject"`
+	Email     string `db:"email"`
+	Name      string `db:"name"`
+}
+
+var (
+	ErrAccountIdentityNotFound      = errors.New("account identity not found")
+	ErrAccountIdentityAlreadyExists = errors.New("account identity already exists")
+
+	duplicateIdentityConstraint = "account_identities_provider_subject_key"
+)
+
+func (d *DB) CreateAccountIdentity(ctx context.Context, params CreateAccountIdentityParams) (*AccountIdentity, error) {
+	ctx, span := startSpan(ctx, "CreateAccountIdentity")
+	defer span.End()
+
+	var result AccountIdentity
+	err := d.client.GetContext(ctx, &result, createAccountIdentitySQL,
+		params.AccountID, params.Provider, params.Subject, params.Email, params.Name)
+	if err != nil {
+		if c, _ := uniqueConstraint(err); c == duplicateIdentityConstraint {
+			return nil, ErrAccountIdentityAlreadyExists
+		}
+		return nil, fmt.Errorf("error creating account identity: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (d *DB) GetAccountIdentity(ctx context.Context, provider, subject string) (*AccountIdentity, error) {
+	ctx, span := startSpan(ctx, "GetAccountIdentity")
+	defer span.End()
+
+	var result AccountIdentity
+	err := d.client.GetContext(ctx, &result, getAccountIdentitySQL, provider, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountIdentityNotFound
+		}
+		return nil, fmt.Errorf("error getting account identity: %w", err)
+	}
+
+	return &result, nil
+}
+
+var (
+	createAccountIdentitySQL = `
+		INSERT INTO account_identities (account_id, provider, subject, email, name)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))
+		RETURNING id, account_id, provider, subject, COALESCE(email, '') AS email, COALESCE(name, '') AS name, created_at;`
+
+	getAccountIdentitySQL = `
+		SELECT id, account_id, provider, subject, COALESCE(email, '') AS email, COALESCE(name, '') AS name, created_at
+		FROM account_identities WHERE provider = $1 AND subject = $2;`
+)
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountIdentities(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "identitytest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		// identities are removed by the cascade
+		_, err := db.pool.Exec("DELETE FROM accounts WHERE email = 'identitytest@test.com'")
+		require.NoError(t, err)
+	})
+
+	params := CreateAccountIdentityParams{
+		AccountID: testAccount.ID,
+		Provider:  IdentityProviderApple,
+		Subject:   "001234.identitytest",
+		Email:     "identitytest@test.com",
+	}
+
+	created, err := db.CreateAccountIdentity(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, testAccount.ID, created.AccountID)
+	assert.Empty(t, created.Name)
+
+	_, err = db.CreateAccountIdentity(ctx, params)
+	require.ErrorIs(t, err, ErrAccountIdentityAlreadyExists)
+
+	actual, err := db.GetAccountIdentity(ctx, IdentityProviderApple, "001234.identitytest")
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, actual.ID)
+	assert.Equal(t, "identitytest@test.com", actual.Email)
+
+	_, err = db.GetAccountIdentity(ctx, IdentityProviderApple, "unknown")
+	require.ErrorIs(t, err, ErrAccountIdentityNotFound)
+}
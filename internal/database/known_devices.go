@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrKnownDeviceNotFound = errors.New("known device not found")
+	// ErrKnownDeviceExists is a device another login from it recorded first
+	ErrKnownDeviceExists = errors.New("known device already exists")
+)
+
+// KnownDevice is a device and coarse location an account has logged in from. A login from one
+// it doesn't know yet is a new sign-in its owner is told about.
+type KnownDevice struct {
+	ID        string `db:"id"`
+	AccountID string `db:"account_id"`
+	// DeviceHash identifies the device by its user agent, Location is e.g. a country code
+	DeviceHash string `db:"device_hash"`
+	Location   string `db:"location"`
+	// IPAddress and UserAgent are of the last login from the device
+	IPAddress string `db:"ip_address"`
+	UserAgent string `db:"user_agent"`
+	// SessionID is the session the first login from the device started, which following the
+	// revoke link in the new sign-in email logs out. RevokeTokenHash is empty when no email was
+	// sent.
+	SessionID       string    `db:"session_id"`
+	RevokeTokenHash string    `db:"revoke_token_hash"`
+	CreatedAt       time.Time `db:"created_at"`
+	LastSeenAt      time.Time `db:"last_seen_at"`
+}
+
+type CreateKnownDeviceParams struct {
+	AccountID       string
+	DeviceHash      string
+	Location        string
+	IPAddress       string
+	UserAgent       string
+	SessionID       string
+	RevokeTokenHash string
+}
+
+type TouchKnownDeviceParams struct {
+	AccountID  string
+	DeviceHash string
+	Location   string
+	IPAddress  string
+	UserAgent  string
+	At         time.Time
+}
+
+// CreateKnownDevice records a device the account logged in from. It returns
+// ErrKnownDeviceExists when a login racing this one already did.
+func (d *DB) CreateKnownDevice(ctx context.Context, params CreateKnownDeviceParams) (*KnownDevice, error) {
+	ctx, span := startSpan(ctx, "CreateKnownDevice")
+	defer span.End()
+
+	var result KnownDevice
+	err := d.client.GetContext(ctx, &result, createKnownDeviceSQL,
+		params.AccountID, params.DeviceHash, params.Location, params.IPAddress, params.UserAgent,
+		params.SessionID, params.RevokeTokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrKnownDeviceExists
+		}
+		return nil, fmt.Errorf("error creating known device: %w", err)
+	}
+	return &result, nil
+}
+
+// TouchKnownDevice records another login from a known device. It returns
+// ErrKnownDeviceNotFound if the account hasn't logged in from the device and location before.
+func (d *DB) TouchKnownDevice(ctx context.Context, params TouchKnownDeviceParams) error {
+	ctx, span := startSpan(ctx, "TouchKnownDevice")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, touchKnownDeviceSQL,
+		params.AccountID, params.DeviceHash, params.Location, params.IPAddress, params.UserAgent, params.At)
+	if err != nil {
+		return fmt.Errorf("error touching known device: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrKnownDeviceNotFound
+	}
+	return nil
+}
+
+// CountKnownDevices returns how many devices the account has logged in from
+func (d *DB) CountKnownDevices(ctx context.Context, accountID string) (int, error) {
+	ctx, span := startSpan(ctx, "CountKnownDevices")
+	defer span.End()
+
+	var n int
+	if err := d.client.GetContext(ctx, &n, countKnownDevicesSQL, accountID); err != nil {
+		return 0, fmt.Errorf("error counting known devices: %w", err)
+	}
+	return n, nil
+}
+
+func (d *DB) GetKnownDeviceByRevokeTokenHash(ctx context.Context, tokenHash string) (*KnownDevice, error) {
+	ctx, span := startSpan(ctx, "GetKnownDeviceByRevokeTokenHash")
+	defer span.End()
+
+	var result KnownDevice
+	err := d.client.GetContext(ctx, &result, getKnownDeviceByRevokeTokenHashSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrKnownDeviceNotFound
+		}
+		return nil, fmt.Errorf("error getting known device: %w", err)
+	}
+	return &result, nil
+}
+
+// DeleteKnownDevice forgets a device, so the next login from it is a new sign-in again
+func (d *DB) DeleteKnownDevice(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "DeleteKnownDevice")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, deleteKnownDeviceSQL, id)
+	if err != nil {
+		return fmt.Errorf("error deleting known device: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrKnownDeviceNotFound
+	}
+	return nil
+}
+
+const knownDeviceColumns = `id, account_id, device_hash, location, ip_address, user_agent, session_id,
+		COALESCE(revoke_token_hash, '') AS revoke_token_hash, created_at, last_seen_at`
+
+var (
+	createKnownDeviceSQL = `
+		INSERT INTO known_devices (account_id, device_hash, location, ip_address, user_agent, session_id, revoke_token_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		ON CONFLICT (account_id, device_hash, location) DO NOTHING
+		RETURNING ` + knownDeviceColumns + `;`
+
+	touchKnownDeviceSQL = `
+		UPDATE known_devices
+		SET ip_address = $4, user_agent = $5, last_seen_at = $6
+		WHERE account_id = $1 AND device_hash = $2 AND location = $3;`
+
+	countKnownDevicesSQL = `
+		SELECT COUNT(*) FROM known_devices WHERE account_id = $1;`
+
+	getKnownDeviceByRevokeTokenHashSQL = `
+		SELECT ` + knownDeviceColumns + `
+		FROM known_devices
+		WHERE revoke_token_hash = $1;`
+
+	deleteKnownDeviceSQL = `
+		DELETE FROM known_devices WHERE id = $1;`
+)
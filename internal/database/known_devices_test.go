@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnownDevices(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "knowndevices@test.com"})
+	require.NoError(t, err)
+
+	count, err := db.CountKnownDevices(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	params := TouchKnownDeviceParams{
+		AccountID:  account.ID,
+		DeviceHash: "laptop",
+		Location:   "NL",
+		IPAddress:  "203.0.113.7",
+		UserAgent:  "Firefox",
+		At:         time.Now().Add(time.Minute).Truncate(time.Second),
+	}
+	require.ErrorIs(t, db.TouchKnownDevice(ctx, params), ErrKnownDeviceNotFound)
+
+	device, err := db.CreateKnownDevice(ctx, CreateKnownDeviceParams{
+		AccountID:       account.ID,
+		DeviceHash:      "laptop",
+		Location:        "NL",
+		IPAddress:       "203.0.113.7",
+		UserAgent:       "Firefox",
+		SessionID:       "session-1",
+		RevokeTokenHash: "revoke-hash",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "session-1", device.SessionID)
+
+	// a racing login from the same device
+	_, err = db.CreateKnownDevice(ctx, CreateKnownDeviceParams{
+		AccountID:  account.ID,
+		DeviceHash: "laptop",
+		Location:   "NL",
+	})
+	require.ErrorIs(t, err, ErrKnownDeviceExists)
+
+	// the same device somewhere else is another one, without a revoke link
+	_, err = db.CreateKnownDevice(ctx, CreateKnownDeviceParams{
+		AccountID:  account.ID,
+		DeviceHash: "laptop",
+		Location:   "US",
+	})
+	require.NoError(t, err)
+	count, err = db.CountKnownDevices(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	params.IPAddress = "203.0.113.8"
+	require.NoError(t, db.TouchKnownDevice(ctx, params))
+
+	got, err := db.GetKnownDeviceByRevokeTokenHash(ctx, "revoke-hash")
+	require.NoError(t, err)
+	assert.Equal(t, device.ID, got.ID)
+	assert.Equal(t, "203.0.113.8", got.IPAddress)
+	assert.True(t, params.At.Equal(got.LastSeenAt))
+	_, err = db.GetKnownDeviceByRevokeTokenHash(ctx, "unknown-hash")
+	require.ErrorIs(t, err, ErrKnownDeviceNotFound)
+
+	require.NoError(t, db.DeleteKnownDevice(ctx, device.ID))
+	require.ErrorIs(t, db.DeleteKnownDevice(ctx, device.ID), ErrKnownDeviceNotFound)
+	_, err = db.GetKnownDeviceByRevokeTokenHash(ctx, "revoke-hash")
+	require.ErrorIs(t, err, ErrKnownDeviceNotFound)
+
+	// deleting the account deletes its known devices
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	count, err = db.CountKnownDevices(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
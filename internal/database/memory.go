@@ -0,0 +1,2530 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryDB is an in-memory stand-in for DB. It's meant for local development
+// and demos where running Postgres isn't worth it. Nothing is persisted.
+type MemoryDB struct {
+	mu sync.RWMutex
+	memoryData
+	// txMu is held for the length of WithTx, so transactions run one at a time
+	txMu sync.Mutex
+	// relayMu is held while relaying, like the advisory lock
+	relayMu   sync.Mutex
+	timeNow   func() time.Time
+	accountID func(email string) string
+}
+
+// memoryData is everything MemoryDB stores, split out so WithTx can put it back
+type memoryData struct {
+	accounts      map[string]Account // keyed by ID
+	accountIDs    map[string]string  // email -> ID
+	refreshTokens map[string]RefreshToken
+	auditEvents   []AuditEvent
+	identities    map[string]AccountIdentity        // keyed by provider|subject
+	emailChanges  map[string]EmailChange            // keyed by ID
+	freezeTokens  map[string]FreezeToken            // keyed by token hash
+	verifications map[string]EmailVerification      // keyed by token hash
+	resetTokens   map[string]PasswordResetToken     // keyed by token hash
+	mfaSecrets    map[string]MFASecret              // keyed by account ID
+	recoveryCodes map[string]string                 // account IDs keyed by account ID|code hash
+	mfaPhones     map[string]MFAPhone               // keyed by account ID
+	trusted       map[string]TrustedDevice          // trusted devices keyed by ID
+	deleted       map[string]deletedAccount         // soft deleted accounts keyed by ID
+	deletions     map[string]DeletionRequest        // deletion requests keyed by account ID
+	organizations map[string]Organization           // keyed by ID
+	orgMembers    map[string]OrganizationMember     // keyed by organization ID|account ID
+	invitations   map[string]OrganizationInvitation // keyed by token hash
+	roles         map[string]Role                   // keyed by name
+	accountRoles  map[string]map[string]bool        // role names keyed by account ID
+	webhooks      map[string]WebhookEndpoint        // keyed by ID
+	deliveries    map[string]WebhookDelivery        // keyed by ID
+	revoked       map[string]time.Time              // revoked access token expiries keyed by token ID
+	apiKeys       map[string]APIKey                 // keyed by ID
+	knownDevices  map[string]KnownDevice            // keyed by ID
+	oauthClients  map[string]OAuthClient            // keyed by ID
+	oauthCodes    map[string]OAuthAuthorizationCode // keyed by code hash
+	samlConfigs   map[string]OrganizationSAMLConfig // keyed by organization ID
+	federated     map[string]FederatedIdentity      // keyed by organization ID|subject
+	outbox        []OutboxEvent                     // in sequence order
+	outboxSeq     int64
+}
+
+// clone copies d deep enough that changing one doesn't change the other. Stored values are
+// replaced rather than modified, except for the account roles and the slices.
+func (d memoryData) clone() memoryData {
+	c := d
+	c.accounts = maps.Clone(d.accounts)
+	c.accountIDs = maps.Clone(d.accountIDs)
+	c.refreshTokens = maps.Clone(d.refreshTokens)
+	c.auditEvents = slices.Clone(d.auditEvents)
+	c.identities = maps.Clone(d.identities)
+	c.emailChanges = maps.Clone(d.emailChanges)
+	c.freezeTokens = maps.Clone(d.freezeTokens)
+	c.verifications = maps.Clone(d.verifications)
+	c.resetTokens = maps.Clone(d.resetTokens)
+	c.mfaSecrets = maps.Clone(d.mfaSecrets)
+	c.recoveryCodes = maps.Clone(d.recoveryCodes)
+	c.mfaPhones = maps.Clone(d.mfaPhones)
+	c.deleted = maps.Clone(d.deleted)
+	c.deletions = maps.Clone(d.deletions)
+	c.organizations = maps.Clone(d.organizations)
+	c.orgMembers = maps.Clone(d.orgMembers)
+	c.invitations = maps.Clone(d.invitations)
+	c.roles = maps.Clone(d.roles)
+	c.accountRoles = make(map[string]map[string]bool, len(d.accountRoles))
+	for id, roles := range d.accountRoles {
+		c.accountRoles[id] = maps.Clone(roles)
+	}
+	c.webhooks = maps.Clone(d.webhooks)
+	c.deliveries = maps.Clone(d.deliveries)
+	c.revoked = maps.Clone(d.revoked)
+	c.apiKeys = maps.Clone(d.apiKeys)
+	c.knownDevices = maps.Clone(d.knownDevices)
+	c.trusted = maps.Clone(d.trusted)
+	c.oauthClients = maps.Clone(d.oauthClients)
+	c.oauthCodes = maps.Clone(d.oauthCodes)
+	c.samlConfigs = maps.Clone(d.samlConfigs)
+	c.federated = maps.Clone(d.federated)
+	c.outbox = slices.Clone(d.outbox)
+	return c
+}
+
+type deletedAccount struct {
+	account   Account
+	deletedAt time.Time
+	// erased accounts are never purged, like erased_at
+	erased bool
+}
+
+type MemoryDBConfig struct {
+	// AccountID generates the ID for a new account. Defaults to a random UUID.
+	AccountID func(email string) string
+}
+
+func NewMemoryDB() *MemoryDB {
+	return NewMemoryDBWithConfig(MemoryDBConfig{})
+}
+
+func NewMemoryDBWithConfig(cfg MemoryDBConfig) *MemoryDB {
+	accountID := cfg.AccountID
+	if accountID == nil {
+		accountID = func(string) string { return uuid.NewString() }
+	}
+
+	return &MemoryDB{
+		memoryData: memoryData{
+			accounts:      map[string]Account{},
+			accountIDs:    map[string]string{},
+			refreshTokens: map[string]RefreshToken{},
+			identities:    map[string]AccountIdentity{},
+			emailChanges:  map[string]EmailChange{},
+			freezeTokens:  map[string]FreezeToken{},
+			verifications: map[string]EmailVerification{},
+			resetTokens:   map[string]PasswordResetToken{},
+			mfaSecrets:    map[string]MFASecret{},
+			recoveryCodes: map[string]string{},
+			mfaPhones:     map[string]MFAPhone{},
+			deleted:       map[string]deletedAccount{},
+			deletions:     map[string]DeletionRequest{},
+			organizations: map[string]Organization{},
+			orgMembers:    map[string]OrganizationMember{},
+			invitations:   map[string]OrganizationInvitation{},
+			// mirror the roles the migrations create
+			roles: map[string]Role{
+				RoleAdmin: {
+					Name:        RoleAdmin,
+					Description: "Manages accounts through the admin endpoints",
+					Permissions: StringArray{"accounts:read", "accounts:write"},
+					CreatedAt:   time.Now(),
+				},
+			},
+			accountRoles: map[string]map[string]bool{},
+			webhooks:     map[string]WebhookEndpoint{},
+			deliveries:   map[string]WebhookDelivery{},
+			revoked:      map[string]time.Time{},
+			apiKeys:      map[string]APIKey{},
+			knownDevices: map[string]KnownDevice{},
+			trusted:      map[string]TrustedDevice{},
+			oauthClients: map[string]OAuthClient{},
+			oauthCodes:   map[string]OAuthAuthorizationCode{},
+			samlConfigs:  map[string]OrganizationSAMLConfig{},
+			federated:    map[string]FederatedIdentity{},
+		},
+		timeNow:   time.Now,
+		accountID: accountID,
+	}
+}
+
+func (m *MemoryDB) Close() error {
+	return nil
+}
+
+func (m *MemoryDB) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// WithTx runs fn and puts back what was stored before if it returns an error. Transactions run
+// one at a time but aren't isolated: changes made outside of fn while it runs are undone with it.
+func (m *MemoryDB) WithTx(ctx context.Context, fn func(tx Repository) error) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	m.mu.RLock()
+	before := m.memoryData.clone()
+	m.mu.RUnlock()
+
+	if err := fn(memoryTx{m}); err != nil {
+		m.mu.Lock()
+		m.memoryData = before
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// memoryTx is the MemoryDB handed to WithTx's fn
+type memoryTx struct {
+	*MemoryDB
+}
+
+// WithTx runs fn in the transaction already running
+func (tx memoryTx) WithTx(ctx context.Context, fn func(tx Repository) error) error {
+	return fn(tx)
+}
+
+func (m *MemoryDB) CreateAccount(ctx context.Context, params AccountCreationParams) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accountIDs[params.Email]; ok {
+		return nil, ErrAccountAlreadyExists
+	}
+	if m.usernameTaken(params.Username, "") {
+		return nil, ErrUsernameTaken
+	}
+
+	now := m.timeNow()
+	account := Account{
+		ID:              m.accountID(params.Email),
+		Email:           params.Email,
+		Username:        params.Username,
+		PasswordHash:    params.PasswordHash,
+		PreferredLocale: params.PreferredLocale,
+		Tags:            StringArray{},
+		FeatureFlags:    FeatureFlags{},
+		UserMetadata:    Metadata{},
+		AppMetadata:     Metadata{},
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	// mirror the column default
+	if account.PreferredLocale == "" {
+		account.PreferredLocale = "en"
+	}
+	if params.Verified {
+		account.VerifiedAt = &now
+	}
+
+	m.accounts[account.ID] = account
+	m.accountIDs[account.Email] = account.ID
+	m.addAccountOutboxEvent(OutboxEventAccountCreated, account)
+
+	return &account, nil
+}
+
+func (m *MemoryDB) GetAccount(ctx context.Context, email string) (*Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.accountIDs[email]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	account := m.accounts[id]
+	return &account, nil
+}
+
+func (m *MemoryDB) GetAccountByUsername(ctx context.Context, username string) (*Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if username == "" {
+		return nil, ErrAccountNotFound
+	}
+	for _, account := range m.accounts {
+		if strings.EqualFold(account.Username, username) {
+			return &account, nil
+		}
+	}
+	return nil, ErrAccountNotFound
+}
+
+// usernameTaken reports whether an account other than exceptID has username, like the unique
+// index on lower(username)
+func (m *MemoryDB) usernameTaken(username, exceptID string) bool {
+	if username == "" {
+		return false
+	}
+	for id, account := range m.accounts {
+		if id != exceptID && strings.EqualFold(account.Username, username) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryDB) GetAccountByID(ctx context.Context, id string) (*Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	return &account, nil
+}
+
+func (m *MemoryDB) GetAccountsByIDs(ctx context.Context, ids []string) ([]Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Account
+	for _, id := range ids {
+		if account, ok := m.accounts[id]; ok {
+			result = append(result, account)
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryDB) GetAccountsByEmails(ctx context.Context, emails []string) ([]Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Account
+	for _, email := range emails {
+		if id, ok := m.accountIDs[email]; ok {
+			result = append(result, m.accounts[id])
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryDB) AddAccountTags(ctx context.Context, id string, tags []string) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	// build a new slice rather than appending so accounts handed out earlier don't change
+	set := map[string]bool{}
+	for _, t := range account.Tags {
+		set[t] = true
+	}
+	for _, t := range tags {
+		set[t] = true
+	}
+	merged := make(StringArray, 0, len(set))
+	for t := range set {
+		merged = append(merged, t)
+	}
+	sort.Strings(merged)
+
+	account.Tags = merged
+	account.UpdatedAt = m.timeNow()
+	m.accounts[id] = account
+
+	return &account, nil
+}
+
+func (m *MemoryDB) RemoveAccountTag(ctx context.Context, id, tag string) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	remaining := StringArray{}
+	for _, t := range account.Tags {
+		if t != tag {
+			remaining = append(remaining, t)
+		}
+	}
+
+	account.Tags = remaining
+	account.UpdatedAt = m.timeNow()
+	m.accounts[id] = account
+
+	return &account, nil
+}
+
+func (m *MemoryDB) ListAccounts(ctx context.Context, params ListAccountsParams) ([]Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Account
+	for _, a := range m.accounts {
+		if params.Tag != "" && !slices.Contains(a.Tags, params.Tag) {
+			continue
+		}
+		if !params.includes(a.CreatedAt, a.ID) {
+			continue
+		}
+		result = append(result, a)
+	}
+
+	return page(result, params.Keyset, func(a Account) (time.Time, string) { return a.CreatedAt, a.ID }), nil
+}
+
+func (m *MemoryDB) UpdateAccountFeatureFlags(ctx context.Context, id string, set map[string]bool, unset []string) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	// copy rather than update in place so accounts handed out earlier don't change
+	flags := maps.Clone(account.FeatureFlags)
+	if flags == nil {
+		flags = FeatureFlags{}
+	}
+	for _, name := range unset {
+		delete(flags, name)
+	}
+	maps.Copy(flags, set)
+
+	account.FeatureFlags = flags
+	account.UpdatedAt = m.timeNow()
+	m.accounts[id] = account
+
+	return &account, nil
+}
+
+func (m *MemoryDB) UpdateAccountProfile(ctx context.Context, id string, params UpdateAccountProfileParams) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	if params.DisplayName != nil {
+		account.DisplayName = *params.DisplayName
+	}
+	if params.GivenName != nil {
+		account.GivenName = *params.GivenName
+	}
+	if params.FamilyName != nil {
+		account.FamilyName = *params.FamilyName
+	}
+	if params.PreferredLocale != nil {
+		account.PreferredLocale = *params.PreferredLocale
+	}
+	if params.Timezone != nil {
+		account.Timezone = *params.Timezone
+	}
+	if params.AvatarURL != nil {
+		account.AvatarURL = *params.AvatarURL
+	}
+	if params.Username != nil {
+		if m.usernameTaken(*params.Username, id) {
+			return nil, ErrUsernameTaken
+		}
+		account.Username = *params.Username
+	}
+	account.UpdatedAt = m.timeNow()
+	m.accounts[id] = account
+
+	return &account, nil
+}
+
+func (m *MemoryDB) UpdateAccountMetadata(ctx context.Context, id string, params UpdateAccountMetadataParams) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	// Apply copies, so accounts handed out earlier don't change
+	account.UserMetadata = account.UserMetadata.Apply(params.SetUserMetadata, params.UnsetUserMetadata)
+	account.AppMetadata = account.AppMetadata.Apply(params.SetAppMetadata, params.UnsetAppMetadata)
+	account.UpdatedAt = m.timeNow()
+	m.accounts[id] = account
+
+	return &account, nil
+}
+
+func (m *MemoryDB) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign key on refresh_tokens.account_id
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return fmt.Errorf("error creating refresh token: account %q does not exist", params.AccountID)
+	}
+
+	sessionID := params.SessionID
+	if sessionID == "" {
+		sessionID = uuid.NewString()
+		m.addOutboxEvent(OutboxEventSessionStarted, params.AccountID, map[string]string{
+			"account_id": params.AccountID,
+			"session_id": sessionID,
+		})
+	}
+
+	m.refreshTokens[params.Token] = RefreshToken{
+		Token:     params.Token,
+		AccountID: params.AccountID,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: m.timeNow(),
+		SessionID: sessionID,
+		IPAddress: params.IPAddress,
+		UserAgent: params.UserAgent,
+		Scopes:    append(StringArray{}, params.Scopes...),
+	}
+
+	return nil
+}
+
+func (m *MemoryDB) GetRefreshToken(ctx context.Context, token string) (*RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result, ok := m.refreshTokens[token]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	return &result, nil
+}
+
+func (m *MemoryDB) RotateRefreshToken(ctx context.Context, token string, at time.Time) (*RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result, ok := m.refreshTokens[token]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	if result.RotatedAt == nil {
+		result.RotatedAt = &at
+		m.refreshTokens[token] = result
+	}
+
+	return &result, nil
+}
+
+func (m *MemoryDB) DeleteRefreshTokensByAccount(ctx context.Context, accountID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	revoked := false
+	for token, rt := range m.refreshTokens {
+		if rt.AccountID == accountID {
+			delete(m.refreshTokens, token)
+			revoked = true
+		}
+	}
+	if revoked {
+		m.addOutboxEvent(OutboxEventSessionsRevoked, accountID, map[string]string{"account_id": accountID})
+	}
+
+	return nil
+}
+
+func (m *MemoryDB) DeleteRefreshTokenByToken(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.refreshTokens, token)
+
+	return nil
+}
+
+func (m *MemoryDB) ListSessions(ctx context.Context, accountID string, now time.Time) ([]Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tokens []RefreshToken
+	for _, rt := range m.refreshTokens {
+		if rt.AccountID == accountID {
+			tokens = append(tokens, rt)
+		}
+	}
+
+	return groupSessions(tokens, now), nil
+}
+
+func (m *MemoryDB) DeleteSession(ctx context.Context, accountID, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	for token, rt := range m.refreshTokens {
+		if rt.AccountID == accountID && rt.SessionID == sessionID {
+			delete(m.refreshTokens, token)
+			found = true
+		}
+	}
+	if !found {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (m *MemoryDB) CountActiveRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, rt := range m.refreshTokens {
+		if rt.ExpiresAt.After(now) && rt.RotatedAt == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *MemoryDB) PurgeExpiredRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for token, rt := range m.refreshTokens {
+		if !rt.ExpiresAt.After(now) {
+			delete(m.refreshTokens, token)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *MemoryDB) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	_, err := m.ClaimAccessToken(ctx, tokenID, expiresAt)
+	return err
+}
+
+func (m *MemoryDB) ClaimAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.timeNow()
+	for id, tokenExpiresAt := range m.revoked {
+		if !tokenExpiresAt.After(now) {
+			delete(m.revoked, id)
+		}
+	}
+	if _, ok := m.revoked[tokenID]; ok {
+		return false, nil
+	}
+	m.revoked[tokenID] = expiresAt
+	return true, nil
+}
+
+func (m *MemoryDB) AccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	expiresAt, ok := m.revoked[tokenID]
+	return ok && expiresAt.After(m.timeNow()), nil
+}
+
+func (m *MemoryDB) CreateAuditEvent(ctx context.Context, params CreateAuditEventParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.auditEvents = append(m.auditEvents, AuditEvent{
+		ID:        uuid.NewString(),
+		AccountID: params.AccountID,
+		EventType: params.EventType,
+		ActorID:   params.ActorID,
+		IPAddress: params.IPAddress,
+		UserAgent: params.UserAgent,
+		RequestID: params.RequestID,
+		Details:   params.Details,
+		CreatedAt: m.timeNow(),
+	})
+
+	return nil
+}
+
+func (m *MemoryDB) ListAuditEvents(ctx context.Context, params ListAuditEventsParams) ([]AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []AuditEvent
+	for _, e := range m.auditEvents {
+		if params.AccountID != "" && e.AccountID != params.AccountID {
+			continue
+		}
+		if params.EventType != "" && e.EventType != params.EventType {
+			continue
+		}
+		if !params.includes(e.CreatedAt, e.ID) {
+			continue
+		}
+		if !params.Since.IsZero() && e.CreatedAt.Before(params.Since) {
+			continue
+		}
+		if !params.Until.IsZero() && !e.CreatedAt.Before(params.Until) {
+			continue
+		}
+		result = append(result, e)
+	}
+
+	return page(result, params.Keyset, func(e AuditEvent) (time.Time, string) { return e.CreatedAt, e.ID }), nil
+}
+
+func (m *MemoryDB) PurgeAuditEvents(ctx context.Context, createdBefore time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.auditEvents[:0]
+	for _, e := range m.auditEvents {
+		if !e.CreatedAt.Before(createdBefore) {
+			kept = append(kept, e)
+		}
+	}
+	purged := int64(len(m.auditEvents) - len(kept))
+	clear(m.auditEvents[len(kept):])
+	m.auditEvents = kept
+	return purged, nil
+}
+
+func (m *MemoryDB) CreateAccountIdentity(ctx context.Context, params CreateAccountIdentityParams) (*AccountIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign key on account_identities.account_id
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return nil, fmt.Errorf("error creating account identity: account %q does not exist", params.AccountID)
+	}
+
+	key := params.Provider + "|" + params.Subject
+	if _, ok := m.identities[key]; ok {
+		return nil, ErrAccountIdentityAlreadyExists
+	}
+
+	identity := AccountIdentity{
+		ID:        uuid.NewString(),
+		AccountID: params.AccountID,
+		Provider:  params.Provider,
+		Subject:   params.Subject,
+		Email:     params.Email,
+		Name:      params.Name,
+		CreatedAt: m.timeNow(),
+	}
+	m.identities[key] = identity
+
+	return &identity, nil
+}
+
+func (m *MemoryDB) GetAccountIdentity(ctx context.Context, provider, subject string) (*AccountIdentity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	identity, ok := m.identities[provider+"|"+subject]
+	if !ok {
+		return nil, ErrAccountIdentityNotFound
+	}
+
+	return &identity, nil
+}
+
+func (m *MemoryDB) CreateEmailChange(ctx context.Context, params CreateEmailChangeParams) (*EmailChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return nil, fmt.Errorf("error creating email change: account %q does not exist", params.AccountID)
+	}
+
+	// one pending change per account
+	for id, change := range m.emailChanges {
+		if change.AccountID == params.AccountID {
+			delete(m.emailChanges, id)
+		}
+	}
+
+	change := EmailChange{
+		ID:              uuid.NewString(),
+		AccountID:       params.AccountID,
+		NewEmail:        params.NewEmail,
+		OldTokenHash:    params.OldTokenHash,
+		NewTokenHash:    params.NewTokenHash,
+		CancelTokenHash: params.CancelTokenHash,
+		ExpiresAt:       params.ExpiresAt,
+		CreatedAt:       m.timeNow(),
+	}
+	m.emailChanges[change.ID] = change
+
+	return &change, nil
+}
+
+func (m *MemoryDB) GetEmailChangeByTokenHash(ctx context.Context, tokenHash string) (*EmailChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, change := range m.emailChanges {
+		if change.OldTokenHash == tokenHash || change.NewTokenHash == tokenHash || change.CancelTokenHash == tokenHash {
+			return &change, nil
+		}
+	}
+
+	return nil, ErrEmailChangeNotFound
+}
+
+func (m *MemoryDB) ConfirmEmailChange(ctx context.Context, id string, side EmailChangeSide) (*EmailChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	change, ok := m.emailChanges[id]
+	if !ok {
+		return nil, ErrEmailChangeNotFound
+	}
+
+	now := m.timeNow()
+	if side == EmailChangeSideNew && change.NewConfirmedAt == nil {
+		change.NewConfirmedAt = &now
+	}
+	if side == EmailChangeSideOld && change.OldConfirmedAt == nil {
+		change.OldConfirmedAt = &now
+	}
+	m.emailChanges[id] = change
+
+	return &change, nil
+}
+
+func (m *MemoryDB) CompleteEmailChange(ctx context.Context, id string) (*EmailChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	change, ok := m.emailChanges[id]
+	if !ok {
+		return nil, ErrEmailChangeNotFound
+	}
+	delete(m.emailChanges, id)
+
+	if !change.Confirmed() {
+		return nil, fmt.Errorf("error completing email change: not confirmed by both addresses")
+	}
+	if _, ok := m.accountIDs[change.NewEmail]; ok {
+		return nil, ErrAccountAlreadyExists
+	}
+
+	account, ok := m.accounts[change.AccountID]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+	delete(m.accountIDs, account.Email)
+
+	account.Email = change.NewEmail
+	account.UpdatedAt = m.timeNow()
+	if account.VerifiedAt == nil {
+		account.VerifiedAt = &account.UpdatedAt
+	}
+	m.accounts[account.ID] = account
+	m.accountIDs[account.Email] = account.ID
+	m.addAccountOutboxEvent(OutboxEventAccountEmailChanged, account)
+
+	return &change, nil
+}
+
+func (m *MemoryDB) DeleteEmailChange(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.emailChanges, id)
+	return nil
+}
+
+func (m *MemoryDB) CreateFreezeToken(ctx context.Context, params CreateFreezeTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return fmt.Errorf("error creating freeze token: account %q does not exist", params.AccountID)
+	}
+
+	m.freezeTokens[params.TokenHash] = FreezeToken{
+		TokenHash: params.TokenHash,
+		AccountID: params.AccountID,
+		Purpose:   params.Purpose,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: m.timeNow(),
+	}
+	return nil
+}
+
+func (m *MemoryDB) GetFreezeToken(ctx context.Context, tokenHash string) (*FreezeToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	token, ok := m.freezeTokens[tokenHash]
+	if !ok {
+		return nil, ErrFreezeTokenNotFound
+	}
+	return &token, nil
+}
+
+func (m *MemoryDB) FreezeAccount(ctx context.Context, id string) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	m.deleteFreezeTokens(id)
+	m.deleteTrustedDevices(id)
+	for token, rt := range m.refreshTokens {
+		if rt.AccountID == id {
+			delete(m.refreshTokens, token)
+		}
+	}
+
+	now := m.timeNow()
+	if account.FrozenAt == nil {
+		account.FrozenAt = &now
+		m.addAccountOutboxEvent(OutboxEventAccountFrozen, account)
+	}
+	account.UpdatedAt = now
+	m.accounts[id] = account
+
+	return &account, nil
+}
+
+func (m *MemoryDB) UnfreezeAccount(ctx context.Context, id, passwordHash string) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	m.deleteFreezeTokens(id)
+
+	account.FrozenAt = nil
+	if passwordHash != "" {
+		account.PasswordHash = passwordHash
+	}
+	account.UpdatedAt = m.timeNow()
+	m.accounts[id] = account
+	m.addAccountOutboxEvent(OutboxEventAccountUnfrozen, account)
+
+	return &account, nil
+}
+
+// deleteFreezeTokens must be called with the lock held
+func (m *MemoryDB) deleteFreezeTokens(accountID string) {
+	for hash, token := range m.freezeTokens {
+		if token.AccountID == accountID {
+			delete(m.freezeTokens, hash)
+		}
+	}
+}
+
+func (m *MemoryDB) CreateEmailVerification(ctx context.Context, params CreateEmailVerificationParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return fmt.Errorf("error creating email verification: account %q does not exist", params.AccountID)
+	}
+
+	m.verifications[params.TokenHash] = EmailVerification{
+		TokenHash: params.TokenHash,
+		AccountID: params.AccountID,
+		Email:     params.Email,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: m.timeNow(),
+	}
+	return nil
+}
+
+func (m *MemoryDB) GetEmailVerification(ctx context.Context, tokenHash string) (*EmailVerification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	verification, ok := m.verifications[tokenHash]
+	if !ok {
+		return nil, ErrEmailVerificationNotFound
+	}
+	return &verification, nil
+}
+
+func (m *MemoryDB) VerifyAccount(ctx context.Context, id string) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	for hash, verification := range m.verifications {
+		if verification.AccountID == id {
+			delete(m.verifications, hash)
+		}
+	}
+
+	now := m.timeNow()
+	if account.VerifiedAt == nil {
+		m.dropUnverifiedFederation(id)
+		account.VerifiedAt = &now
+		m.addAccountOutboxEvent(OutboxEventAccountVerified, account)
+	}
+	account.UpdatedAt = now
+	m.accounts[id] = account
+
+	return &account, nil
+}
+
+func (m *MemoryDB) PurgeExpiredEmailVerifications(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for hash, verification := range m.verifications {
+		if !verification.ExpiresAt.After(now) {
+			delete(m.verifications, hash)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *MemoryDB) CreatePasswordResetToken(ctx context.Context, params CreatePasswordResetTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return fmt.Errorf("error creating password reset token: account %q does not exist", params.AccountID)
+	}
+
+	m.resetTokens[params.TokenHash] = PasswordResetToken{
+		TokenHash: params.TokenHash,
+		AccountID: params.AccountID,
+		Email:     params.Email,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: m.timeNow(),
+	}
+	return nil
+}
+
+func (m *MemoryDB) GetPasswordResetToken(ctx context.Context, tokenHash string) (*PasswordResetToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	token, ok := m.resetTokens[tokenHash]
+	if !ok {
+		return nil, ErrPasswordResetTokenNotFound
+	}
+	return &token, nil
+}
+
+// dropUnverifiedFederation mirrors dropUnverifiedFederationSQL for an account that's being
+// verified. The caller holds the lock.
+func (m *MemoryDB) dropUnverifiedFederation(accountID string) {
+	for key, identity := range m.federated {
+		if identity.AccountID != accountID {
+			continue
+		}
+		delete(m.federated, key)
+		memberKey := identity.OrganizationID + "|" + accountID
+		if member, ok := m.orgMembers[memberKey]; ok && member.Role != OrganizationRoleOwner {
+			delete(m.orgMembers, memberKey)
+		}
+	}
+}
+
+func (m *MemoryDB) ResetPassword(ctx context.Context, id, passwordHash string) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	for hash, token := range m.resetTokens {
+		if token.AccountID == id {
+			delete(m.resetTokens, hash)
+		}
+	}
+	for token, rt := range m.refreshTokens {
+		if rt.AccountID == id {
+			delete(m.refreshTokens, token)
+		}
+	}
+
+	now := m.timeNow()
+	account.PasswordHash = passwordHash
+	if account.VerifiedAt == nil {
+		m.dropUnverifiedFederation(id)
+		account.VerifiedAt = &now
+	}
+	account.UpdatedAt = now
+	m.accounts[id] = account
+	m.addAccountOutboxEvent(OutboxEventAccountPasswordChanged, account)
+
+	return &account, nil
+}
+
+func (m *MemoryDB) PurgeExpiredPasswordResetTokens(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for hash, token := range m.resetTokens {
+		if !token.ExpiresAt.After(now) {
+			delete(m.resetTokens, hash)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *MemoryDB) UpdatePassword(ctx context.Context, id, passwordHash string) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	for token, rt := range m.refreshTokens {
+		if rt.AccountID == id {
+			delete(m.refreshTokens, token)
+		}
+	}
+
+	account.PasswordHash = passwordHash
+	account.UpdatedAt = m.timeNow()
+	m.accounts[id] = account
+	m.addAccountOutboxEvent(OutboxEventAccountPasswordChanged, account)
+
+	return &account, nil
+}
+
+func (m *MemoryDB) RehashPassword(ctx context.Context, id, oldHash, newHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok || account.PasswordHash != oldHash {
+		return nil
+	}
+	account.PasswordHash = newHash
+	m.accounts[id] = account
+	return nil
+}
+
+func (m *MemoryDB) DeleteAccount(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	delete(m.accounts, id)
+	delete(m.accountIDs, account.Email)
+	m.deleted[id] = deletedAccount{account: account, deletedAt: m.timeNow()}
+	m.addAccountOutboxEvent(OutboxEventAccountDeleted, account)
+	m.deleteAccountData(id)
+
+	return nil
+}
+
+// deleteAccountData deletes what the account logs in with or could still be sent, mirroring
+// deleteAccountDataSQL
+func (m *MemoryDB) deleteAccountData(id string) {
+	for token, rt := range m.refreshTokens {
+		if rt.AccountID == id {
+			delete(m.refreshTokens, token)
+		}
+	}
+	for key, identity := range m.identities {
+		if identity.AccountID == id {
+			delete(m.identities, key)
+		}
+	}
+	for changeID, change := range m.emailChanges {
+		if change.AccountID == id {
+			delete(m.emailChanges, changeID)
+		}
+	}
+	m.deleteFreezeTokens(id)
+	for hash, verification := range m.verifications {
+		if verification.AccountID == id {
+			delete(m.verifications, hash)
+		}
+	}
+	for hash, token := range m.resetTokens {
+		if token.AccountID == id {
+			delete(m.resetTokens, hash)
+		}
+	}
+	delete(m.mfaSecrets, id)
+	m.deleteMFARecoveryCodes(id)
+	delete(m.mfaPhones, id)
+	for keyID, key := range m.apiKeys {
+		if key.AccountID == id {
+			delete(m.apiKeys, keyID)
+		}
+	}
+	for hash, code := range m.oauthCodes {
+		if code.AccountID == id {
+			delete(m.oauthCodes, hash)
+		}
+	}
+	for key, identity := range m.federated {
+		if identity.AccountID == id {
+			delete(m.federated, key)
+		}
+	}
+	for deviceID, device := range m.knownDevices {
+		if device.AccountID == id {
+			delete(m.knownDevices, deviceID)
+		}
+	}
+	m.deleteTrustedDevices(id)
+}
+
+func (m *MemoryDB) PurgeDeletedAccounts(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for id, d := range m.deleted {
+		if !d.deletedAt.Before(deletedBefore) || d.erased {
+			continue
+		}
+		delete(m.deleted, id)
+		purged++
+		m.addAccountOutboxEvent(OutboxEventAccountPurged, d.account)
+
+		// mirror ON DELETE SET NULL and CASCADE, unless a new account got the same (deterministic) ID
+		if _, ok := m.accounts[id]; ok {
+			continue
+		}
+		for i := range m.auditEvents {
+			if m.auditEvents[i].AccountID == id {
+				m.auditEvents[i].AccountID = ""
+			}
+		}
+		for key, member := range m.orgMembers {
+			if member.AccountID == id {
+				delete(m.orgMembers, key)
+			}
+		}
+		delete(m.accountRoles, id)
+		delete(m.deletions, id)
+	}
+
+	return purged, nil
+}
+
+func (m *MemoryDB) EraseAccount(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.deletions[id]; !ok {
+		return ErrDeletionRequestNotFound
+	}
+
+	now := m.timeNow()
+	erased := deletedAccount{deletedAt: now, erased: true}
+	if account, ok := m.accounts[id]; ok {
+		delete(m.accounts, id)
+		delete(m.accountIDs, account.Email)
+		erased.account = account
+	} else if d, ok := m.deleted[id]; ok && !d.erased {
+		erased.account, erased.deletedAt = d.account, d.deletedAt
+	} else {
+		return ErrAccountNotFound
+	}
+
+	delete(m.deletions, id)
+	m.deleteAccountData(id)
+	for key, member := range m.orgMembers {
+		if member.AccountID == id {
+			delete(m.orgMembers, key)
+		}
+	}
+	delete(m.accountRoles, id)
+	for i := range m.auditEvents {
+		if m.auditEvents[i].AccountID == id {
+			m.auditEvents[i].IPAddress = ""
+			m.auditEvents[i].UserAgent = ""
+		}
+	}
+
+	erased.account = Account{
+		ID:              id,
+		Email:           id + "@erased.invalid",
+		PreferredLocale: erased.account.PreferredLocale,
+		Tags:            StringArray{},
+		FeatureFlags:    FeatureFlags{},
+		UserMetadata:    Metadata{},
+		AppMetadata:     Metadata{},
+		FrozenAt:        erased.account.FrozenAt,
+		VerifiedAt:      erased.account.VerifiedAt,
+		CreatedAt:       erased.account.CreatedAt,
+		UpdatedAt:       now,
+	}
+	m.deleted[id] = erased
+	m.addAccountOutboxEvent(OutboxEventAccountErased, erased.account)
+
+	return nil
+}
+
+func (m *MemoryDB) CreateDeletionRequest(ctx context.Context, accountID string, eraseAt time.Time) (*DeletionRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[accountID]; !ok {
+		return nil, ErrAccountNotFound
+	}
+	if _, ok := m.deletions[accountID]; ok {
+		return nil, ErrDeletionAlreadyRequested
+	}
+
+	request := DeletionRequest{AccountID: accountID, EraseAt: eraseAt, CreatedAt: m.timeNow()}
+	m.deletions[accountID] = request
+	return &request, nil
+}
+
+func (m *MemoryDB) GetDeletionRequest(ctx context.Context, accountID string) (*DeletionRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	request, ok := m.deletions[accountID]
+	if !ok {
+		return nil, ErrDeletionRequestNotFound
+	}
+	return &request, nil
+}
+
+func (m *MemoryDB) CancelDeletionRequest(ctx context.Context, accountID string) (*DeletionRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, ok := m.deletions[accountID]
+	if !ok {
+		return nil, ErrDeletionRequestNotFound
+	}
+	delete(m.deletions, accountID)
+	return &request, nil
+}
+
+func (m *MemoryDB) ListDueDeletionRequests(ctx context.Context, eraseBefore time.Time, limit int) ([]DeletionRequest, error) {
+	return m.listDeletionRequests(eraseBefore, limit, func(DeletionRequest) bool { return true }), nil
+}
+
+func (m *MemoryDB) ListDeletionRemindersDue(ctx context.Context, eraseBefore time.Time, limit int) ([]DeletionRequest, error) {
+	return m.listDeletionRequests(eraseBefore, limit, func(r DeletionRequest) bool { return r.ReminderSentAt == nil }), nil
+}
+
+// listDeletionRequests returns up to limit requests to be erased before the cutoff that keep
+// matches, the earliest first
+func (m *MemoryDB) listDeletionRequests(eraseBefore time.Time, limit int, keep func(DeletionRequest) bool) []DeletionRequest {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []DeletionRequest{}
+	for _, request := range m.deletions {
+		if request.EraseAt.Before(eraseBefore) && keep(request) {
+			result = append(result, request)
+		}
+	}
+	slices.SortFunc(result, func(a, b DeletionRequest) int { return a.EraseAt.Compare(b.EraseAt) })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func (m *MemoryDB) MarkDeletionReminderSent(ctx context.Context, accountID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if request, ok := m.deletions[accountID]; ok {
+		request.ReminderSentAt = &at
+		m.deletions[accountID] = request
+	}
+	return nil
+}
+
+func (m *MemoryDB) SetMFASecret(ctx context.Context, accountID, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.mfaSecrets[accountID]; ok && existing.EnabledAt != nil {
+		return ErrMFAAlreadyEnabled
+	}
+
+	now := m.timeNow()
+	m.mfaSecrets[accountID] = MFASecret{
+		AccountID: accountID,
+		Secret:    secret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return nil
+}
+
+func (m *MemoryDB) GetMFASecret(ctx context.Context, accountID string) (*MFASecret, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	secret, ok := m.mfaSecrets[accountID]
+	if !ok {
+		return nil, ErrMFASecretNotFound
+	}
+	return &secret, nil
+}
+
+func (m *MemoryDB) EnableMFA(ctx context.Context, accountID string, step int64) (*MFASecret, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, ok := m.mfaSecrets[accountID]
+	if !ok || secret.EnabledAt != nil {
+		return nil, ErrMFASecretNotFound
+	}
+
+	now := m.timeNow()
+	secret.EnabledAt = &now
+	secret.LastUsedStep = step
+	secret.UpdatedAt = now
+	m.mfaSecrets[accountID] = secret
+
+	return &secret, nil
+}
+
+func (m *MemoryDB) UseMFAStep(ctx context.Context, accountID string, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, ok := m.mfaSecrets[accountID]
+	if !ok || secret.EnabledAt == nil || secret.LastUsedStep >= step {
+		return ErrMFACodeUsed
+	}
+
+	secret.LastUsedStep = step
+	secret.UpdatedAt = m.timeNow()
+	m.mfaSecrets[accountID] = secret
+	return nil
+}
+
+func (m *MemoryDB) SetMFAPhone(ctx context.Context, accountID, phoneNumber string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign key on mfa_phones.account_id
+	if _, ok := m.accounts[accountID]; !ok {
+		return fmt.Errorf("error setting MFA phone: account %q does not exist", accountID)
+	}
+
+	existing, ok := m.mfaPhones[accountID]
+	if ok && existing.VerifiedAt != nil {
+		return ErrMFAPhoneAlreadyVerified
+	}
+
+	now := m.timeNow()
+	m.mfaPhones[accountID] = MFAPhone{
+		AccountID:   accountID,
+		PhoneNumber: phoneNumber,
+		// the last code's sent time is kept so a new number doesn't skip the resend throttle
+		CodeSentAt: existing.CodeSentAt,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	return nil
+}
+
+func (m *MemoryDB) GetMFAPhone(ctx context.Context, accountID string) (*MFAPhone, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	phone, ok := m.mfaPhones[accountID]
+	if !ok {
+		return nil, ErrMFAPhoneNotFound
+	}
+	return &phone, nil
+}
+
+func (m *MemoryDB) VerifyMFAPhone(ctx context.Context, accountID string) (*MFAPhone, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	phone, ok := m.mfaPhones[accountID]
+	if !ok || phone.VerifiedAt != nil {
+		return nil, ErrMFAPhoneNotFound
+	}
+
+	now := m.timeNow()
+	phone.VerifiedAt = &now
+	phone.UpdatedAt = now
+	m.mfaPhones[accountID] = phone
+	return &phone, nil
+}
+
+func (m *MemoryDB) SetMFAPhoneCode(ctx context.Context, params SetMFAPhoneCodeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	phone, ok := m.mfaPhones[params.AccountID]
+	if !ok || (phone.CodeSentAt != nil && phone.CodeSentAt.After(params.LastSentBefore)) {
+		return ErrMFAPhoneCodeThrottled
+	}
+
+	phone.CodeHash = &params.CodeHash
+	phone.CodeSentAt = &params.SentAt
+	phone.CodeExpiresAt = &params.ExpiresAt
+	phone.UpdatedAt = m.timeNow()
+	m.mfaPhones[params.AccountID] = phone
+	return nil
+}
+
+func (m *MemoryDB) UseMFAPhoneCode(ctx context.Context, accountID, codeHash string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	phone, ok := m.mfaPhones[accountID]
+	if !ok || phone.CodeHash == nil || *phone.CodeHash != codeHash || !phone.CodeExpiresAt.After(now) {
+		return ErrMFAPhoneCodeInvalid
+	}
+
+	phone.CodeHash = nil
+	phone.CodeExpiresAt = nil
+	phone.UpdatedAt = m.timeNow()
+	m.mfaPhones[accountID] = phone
+	return nil
+}
+
+func (m *MemoryDB) ReplaceMFARecoveryCodes(ctx context.Context, accountID string, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign key on mfa_recovery_codes.account_id
+	if _, ok := m.accounts[accountID]; !ok {
+		return fmt.Errorf("error creating MFA recovery codes: account %q does not exist", accountID)
+	}
+
+	m.deleteMFARecoveryCodes(accountID)
+	for _, hash := range codeHashes {
+		m.recoveryCodes[accountID+"|"+hash] = accountID
+	}
+	return nil
+}
+
+func (m *MemoryDB) UseMFARecoveryCode(ctx context.Context, accountID, codeHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := accountID + "|" + codeHash
+	if _, ok := m.recoveryCodes[key]; !ok {
+		return ErrMFARecoveryCodeNotFound
+	}
+	delete(m.recoveryCodes, key)
+	return nil
+}
+
+func (m *MemoryDB) CountMFARecoveryCodes(ctx context.Context, accountID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int
+	for _, id := range m.recoveryCodes {
+		if id == accountID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// deleteMFARecoveryCodes must be called with the lock held
+func (m *MemoryDB) deleteMFARecoveryCodes(accountID string) {
+	for key, id := range m.recoveryCodes {
+		if id == accountID {
+			delete(m.recoveryCodes, key)
+		}
+	}
+}
+
+func (m *MemoryDB) CreateTrustedDevice(ctx context.Context, params CreateTrustedDeviceParams) (*TrustedDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign key on trusted_devices.account_id
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return nil, fmt.Errorf("error creating trusted device: account %q does not exist", params.AccountID)
+	}
+
+	now := m.timeNow()
+	device := TrustedDevice{
+		ID:         uuid.NewString(),
+		AccountID:  params.AccountID,
+		DeviceHash: params.DeviceHash,
+		IPAddress:  params.IPAddress,
+		UserAgent:  params.UserAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  params.ExpiresAt,
+	}
+	m.trusted[device.ID] = device
+
+	return &device, nil
+}
+
+func (m *MemoryDB) UseTrustedDevice(ctx context.Context, params UseTrustedDeviceParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device, ok := m.trusted[params.ID]
+	if !ok || device.AccountID != params.AccountID || device.DeviceHash != params.DeviceHash || !device.ExpiresAt.After(params.At) {
+		return ErrTrustedDeviceNotFound
+	}
+	device.LastUsedAt = params.At
+	m.trusted[params.ID] = device
+	return nil
+}
+
+func (m *MemoryDB) ListTrustedDevices(ctx context.Context, accountID string, now time.Time) ([]TrustedDevice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []TrustedDevice
+	for _, device := range m.trusted {
+		if device.AccountID == accountID && device.ExpiresAt.After(now) {
+			result = append(result, device)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].LastUsedAt.Equal(result[j].LastUsedAt) {
+			return result[i].LastUsedAt.After(result[j].LastUsedAt)
+		}
+		return result[i].ID > result[j].ID
+	})
+	return result, nil
+}
+
+func (m *MemoryDB) DeleteTrustedDevice(ctx context.Context, accountID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if device, ok := m.trusted[id]; !ok || device.AccountID != accountID {
+		return ErrTrustedDeviceNotFound
+	}
+	delete(m.trusted, id)
+	return nil
+}
+
+func (m *MemoryDB) DeleteTrustedDevices(ctx context.Context, accountID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deleteTrustedDevices(accountID), nil
+}
+
+// deleteTrustedDevices must be called with the lock held
+func (m *MemoryDB) deleteTrustedDevices(accountID string) int64 {
+	var n int64
+	for id, device := range m.trusted {
+		if device.AccountID == accountID {
+			delete(m.trusted, id)
+			n++
+		}
+	}
+	return n
+}
+
+func (m *MemoryDB) PurgeExpiredTrustedDevices(ctx context.Context, now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for id, device := range m.trusted {
+		if !device.ExpiresAt.After(now) {
+			delete(m.trusted, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryDB) CreateOrganization(ctx context.Context, name, ownerID string) (*Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign key on organization_members.account_id
+	if _, ok := m.accounts[ownerID]; !ok {
+		return nil, fmt.Errorf("error creating organization: account %q does not exist", ownerID)
+	}
+
+	now := m.timeNow()
+	org := Organization{
+		ID:        uuid.NewString(),
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.organizations[org.ID] = org
+	m.orgMembers[org.ID+"|"+ownerID] = OrganizationMember{
+		OrganizationID: org.ID,
+		AccountID:      ownerID,
+		Role:           OrganizationRoleOwner,
+		CreatedAt:      now,
+	}
+
+	return &org, nil
+}
+
+func (m *MemoryDB) GetOrganization(ctx context.Context, id string) (*Organization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	org, ok := m.organizations[id]
+	if !ok {
+		return nil, ErrOrganizationNotFound
+	}
+	return &org, nil
+}
+
+func (m *MemoryDB) ListAccountOrganizations(ctx context.Context, accountID string) ([]Organization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []Organization{}
+	for _, member := range m.orgMembers {
+		if member.AccountID == accountID {
+			result = append(result, m.organizations[member.OrganizationID])
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+func (m *MemoryDB) GetOrganizationMember(ctx context.Context, organizationID, accountID string) (*OrganizationMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	member, ok := m.orgMembers[organizationID+"|"+accountID]
+	if !ok {
+		return nil, ErrNotOrganizationMember
+	}
+	return &member, nil
+}
+
+func (m *MemoryDB) CreateRole(ctx context.Context, name, description string, permissions []string) (*Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roles[name]; ok {
+		return nil, ErrRoleAlreadyExists
+	}
+
+	permissions = slices.Clone(permissions)
+	slices.Sort(permissions)
+	role := Role{
+		Name:        name,
+		Description: description,
+		Permissions: slices.Compact(permissions),
+		CreatedAt:   m.timeNow(),
+	}
+	if role.Permissions == nil {
+		role.Permissions = StringArray{}
+	}
+	m.roles[name] = role
+
+	return &role, nil
+}
+
+func (m *MemoryDB) GetRole(ctx context.Context, name string) (*Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	role, ok := m.roles[name]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+	return &role, nil
+}
+
+func (m *MemoryDB) AssignRole(ctx context.Context, accountID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roles[role]; !ok {
+		return ErrRoleNotFound
+	}
+	// mirror the foreign key on account_roles.account_id
+	if _, ok := m.accounts[accountID]; !ok {
+		return fmt.Errorf("error assigning role: account %q does not exist", accountID)
+	}
+
+	if m.accountRoles[accountID] == nil {
+		m.accountRoles[accountID] = map[string]bool{}
+	}
+	m.accountRoles[accountID][role] = true
+	return nil
+}
+
+func (m *MemoryDB) UnassignRole(ctx context.Context, accountID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.accountRoles[accountID], role)
+	return nil
+}
+
+func (m *MemoryDB) GetAccountRoles(ctx context.Context, accountID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	roles := slices.Sorted(maps.Keys(m.accountRoles[accountID]))
+	if roles == nil {
+		roles = []string{}
+	}
+	return roles, nil
+}
+
+func (m *MemoryDB) CreateOrganizationInvitation(ctx context.Context, params CreateOrganizationInvitationParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign key on organization_invitations.organization_id
+	if _, ok := m.organizations[params.OrganizationID]; !ok {
+		return fmt.Errorf("error creating organization invitation: organization %q does not exist", params.OrganizationID)
+	}
+
+	m.invitations[params.TokenHash] = OrganizationInvitation{
+		TokenHash:      params.TokenHash,
+		OrganizationID: params.OrganizationID,
+		Email:          params.Email,
+		Role:           params.Role,
+		ExpiresAt:      params.ExpiresAt,
+		CreatedAt:      m.timeNow(),
+	}
+	return nil
+}
+
+func (m *MemoryDB) GetOrganizationInvitation(ctx context.Context, tokenHash string) (*OrganizationInvitation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	invitation, ok := m.invitations[tokenHash]
+	if !ok {
+		return nil, ErrOrganizationInvitationNotFound
+	}
+	return &invitation, nil
+}
+
+func (m *MemoryDB) AcceptOrganizationInvitation(ctx context.Context, tokenHash, accountID string) (*OrganizationMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	invitation, ok := m.invitations[tokenHash]
+	if !ok {
+		return nil, ErrOrganizationInvitationNotFound
+	}
+	// mirror the foreign key on organization_members.account_id
+	if _, ok := m.accounts[accountID]; !ok {
+		return nil, fmt.Errorf("error accepting organization invitation: account %q does not exist", accountID)
+	}
+	delete(m.invitations, tokenHash)
+
+	key := invitation.OrganizationID + "|" + accountID
+	member, ok := m.orgMembers[key]
+	if !ok {
+		member = OrganizationMember{
+			OrganizationID: invitation.OrganizationID,
+			AccountID:      accountID,
+			Role:           invitation.Role,
+			CreatedAt:      m.timeNow(),
+		}
+		m.orgMembers[key] = member
+	}
+	return &member, nil
+}
+
+func (m *MemoryDB) AddOrganizationMember(ctx context.Context, organizationID, accountID, role string) (*OrganizationMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign keys on organization_members
+	if _, ok := m.organizations[organizationID]; !ok {
+		return nil, fmt.Errorf("error adding organization member: organization %q does not exist", organizationID)
+	}
+	if _, ok := m.accounts[accountID]; !ok {
+		return nil, fmt.Errorf("error adding organization member: account %q does not exist", accountID)
+	}
+
+	key := organizationID + "|" + accountID
+	member, ok := m.orgMembers[key]
+	if !ok {
+		member = OrganizationMember{
+			OrganizationID: organizationID,
+			AccountID:      accountID,
+			Role:           role,
+			CreatedAt:      m.timeNow(),
+		}
+		m.orgMembers[key] = member
+	}
+	return &member, nil
+}
+
+func (m *MemoryDB) CreateWebhookEndpoint(ctx context.Context, params CreateWebhookEndpointParams) (*WebhookEndpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	endpoint := WebhookEndpoint{
+		ID:         uuid.NewString(),
+		URL:        params.URL,
+		Secret:     params.Secret,
+		EventTypes: slices.Clone(params.EventTypes),
+		CreatedAt:  m.timeNow(),
+	}
+	m.webhooks[endpoint.ID] = endpoint
+
+	return &endpoint, nil
+}
+
+func (m *MemoryDB) GetWebhookEndpoint(ctx context.Context, id string) (*WebhookEndpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	endpoint, ok := m.webhooks[id]
+	if !ok {
+		return nil, ErrWebhookEndpointNotFound
+	}
+	return &endpoint, nil
+}
+
+func (m *MemoryDB) ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := slices.Collect(maps.Values(m.webhooks))
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+func (m *MemoryDB) DeleteWebhookEndpoint(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[id]; !ok {
+		return ErrWebhookEndpointNotFound
+	}
+	delete(m.webhooks, id)
+
+	// mirror ON DELETE CASCADE
+	for deliveryID, delivery := range m.deliveries {
+		if delivery.EndpointID == id {
+			delete(m.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDB) CreateWebhookDeliveries(ctx context.Context, eventType, payload string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.timeNow()
+	var count int64
+	for _, endpoint := range m.webhooks {
+		if !slices.Contains(endpoint.EventTypes, eventType) {
+			continue
+		}
+		delivery := WebhookDelivery{
+			ID:            uuid.NewString(),
+			EndpointID:    endpoint.ID,
+			EventType:     eventType,
+			Payload:       payload,
+			Status:        WebhookDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+		m.deliveries[delivery.ID] = delivery
+		count++
+	}
+	return count, nil
+}
+
+func (m *MemoryDB) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.Status == WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for i := range due {
+		due[i].NextAttemptAt = now.Add(lease)
+		m.deliveries[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (m *MemoryDB) RecordWebhookAttempt(ctx context.Context, id string, attempt WebhookAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery, ok := m.deliveries[id]
+	if !ok {
+		return nil
+	}
+	delivery.Status = attempt.Status
+	delivery.Attempts++
+	delivery.NextAttemptAt = attempt.NextAttemptAt
+	delivery.LastStatusCode = attempt.LastStatusCode
+	delivery.LastError = attempt.LastError
+	delivery.DeliveredAt = nil
+	if attempt.Status == WebhookDeliveryDelivered {
+		at := attempt.At
+		delivery.DeliveredAt = &at
+	}
+	m.deliveries[id] = delivery
+
+	return nil
+}
+
+func (m *MemoryDB) GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	delivery, ok := m.deliveries[id]
+	if !ok {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return &delivery, nil
+}
+
+func (m *MemoryDB) ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.EndpointID == params.EndpointID && params.includes(delivery.CreatedAt, delivery.ID) {
+			result = append(result, delivery)
+		}
+	}
+
+	return page(result, params.Keyset, func(d WebhookDelivery) (time.Time, string) { return d.CreatedAt, d.ID }), nil
+}
+
+func (m *MemoryDB) ReplayWebhookDelivery(ctx context.Context, id string, now time.Time) (*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery, ok := m.deliveries[id]
+	if !ok {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	delivery.Status = WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now
+	m.deliveries[id] = delivery
+
+	return &delivery, nil
+}
+
+func (m *MemoryDB) CreateAPIKey(ctx context.Context, params CreateAPIKeyParams) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign key on api_keys.account_id
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return nil, fmt.Errorf("error creating api key: account %q does not exist", params.AccountID)
+	}
+	for _, key := range m.apiKeys {
+		if key.KeyHash == params.KeyHash {
+			return nil, fmt.Errorf("error creating api key: duplicate key hash")
+		}
+	}
+
+	key := APIKey{
+		ID:        uuid.NewString(),
+		AccountID: params.AccountID,
+		Name:      params.Name,
+		Prefix:    params.Prefix,
+		KeyHash:   params.KeyHash,
+		Scopes:    append(StringArray{}, params.Scopes...),
+		ExpiresAt: nullTime(params.ExpiresAt),
+		CreatedAt: m.timeNow(),
+	}
+	m.apiKeys[key.ID] = key
+
+	return &key, nil
+}
+
+func (m *MemoryDB) ListAPIKeys(ctx context.Context, accountID string) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []APIKey
+	for _, key := range m.apiKeys {
+		if key.AccountID == accountID {
+			result = append(result, key)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.After(result[j].CreatedAt)
+		}
+		return result[i].ID > result[j].ID
+	})
+	return result, nil
+}
+
+func (m *MemoryDB) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.KeyHash == keyHash {
+			return &key, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (m *MemoryDB) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, ok := m.apiKeys[id]; ok {
+		key.LastUsedAt = &at
+		m.apiKeys[id] = key
+	}
+	return nil
+}
+
+func (m *MemoryDB) DeleteAPIKey(ctx context.Context, accountID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok || key.AccountID != accountID {
+		return ErrAPIKeyNotFound
+	}
+	delete(m.apiKeys, id)
+	return nil
+}
+
+func (m *MemoryDB) CreateKnownDevice(ctx context.Context, params CreateKnownDeviceParams) (*KnownDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign key on known_devices.account_id
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return nil, fmt.Errorf("error creating known device: account %q does not exist", params.AccountID)
+	}
+	if m.findKnownDevice(params.AccountID, params.DeviceHash, params.Location) != "" {
+		return nil, ErrKnownDeviceExists
+	}
+
+	now := m.timeNow()
+	device := KnownDevice{
+		ID:              uuid.NewString(),
+		AccountID:       params.AccountID,
+		DeviceHash:      params.DeviceHash,
+		Location:        params.Location,
+		IPAddress:       params.IPAddress,
+		UserAgent:       params.UserAgent,
+		SessionID:       params.SessionID,
+		RevokeTokenHash: params.RevokeTokenHash,
+		CreatedAt:       now,
+		LastSeenAt:      now,
+	}
+	m.knownDevices[device.ID] = device
+
+	return &device, nil
+}
+
+func (m *MemoryDB) TouchKnownDevice(ctx context.Context, params TouchKnownDeviceParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.findKnownDevice(params.AccountID, params.DeviceHash, params.Location)
+	if id == "" {
+		return ErrKnownDeviceNotFound
+	}
+	device := m.knownDevices[id]
+	device.IPAddress = params.IPAddress
+	device.UserAgent = params.UserAgent
+	device.LastSeenAt = params.At
+	m.knownDevices[id] = device
+	return nil
+}
+
+// findKnownDevice returns the ID of the account's device, or "" if there's none. It must be
+// called with the lock held.
+func (m *MemoryDB) findKnownDevice(accountID, deviceHash, location string) string {
+	for id, device := range m.knownDevices {
+		if device.AccountID == accountID && device.DeviceHash == deviceHash && device.Location == location {
+			return id
+		}
+	}
+	return ""
+}
+
+func (m *MemoryDB) CountKnownDevices(ctx context.Context, accountID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n := 0
+	for _, device := range m.knownDevices {
+		if device.AccountID == accountID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryDB) GetKnownDeviceByRevokeTokenHash(ctx context.Context, tokenHash string) (*KnownDevice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, device := range m.knownDevices {
+		if tokenHash != "" && device.RevokeTokenHash == tokenHash {
+			return &device, nil
+		}
+	}
+	return nil, ErrKnownDeviceNotFound
+}
+
+func (m *MemoryDB) DeleteKnownDevice(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.knownDevices[id]; !ok {
+		return ErrKnownDeviceNotFound
+	}
+	delete(m.knownDevices, id)
+	return nil
+}
+
+func (m *MemoryDB) CreateOAuthClient(ctx context.Context, params CreateOAuthClientParams) (*OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client := OAuthClient{
+		ID:           uuid.NewString(),
+		Name:         params.Name,
+		SecretHash:   nullString(params.SecretHash),
+		RedirectURIs: append(StringArray{}, params.RedirectURIs...),
+		GrantTypes:   append(StringArray{}, params.GrantTypes...),
+		Scopes:       append(StringArray{}, params.Scopes...),
+		CreatedAt:    m.timeNow(),
+	}
+	m.oauthClients[client.ID] = client
+
+	return &client, nil
+}
+
+func (m *MemoryDB) GetOAuthClient(ctx context.Context, id string) (*OAuthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	client, ok := m.oauthClients[id]
+	if !ok {
+		return nil, ErrOAuthClientNotFound
+	}
+	return &client, nil
+}
+
+func (m *MemoryDB) ListOAuthClients(ctx context.Context) ([]OAuthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := slices.Collect(maps.Values(m.oauthClients))
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.After(result[j].CreatedAt)
+		}
+		return result[i].ID > result[j].ID
+	})
+	return result, nil
+}
+
+func (m *MemoryDB) DeleteOAuthClient(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.oauthClients[id]; !ok {
+		return ErrOAuthClientNotFound
+	}
+	delete(m.oauthClients, id)
+	// mirror ON DELETE CASCADE
+	for hash, code := range m.oauthCodes {
+		if code.ClientID == id {
+			delete(m.oauthCodes, hash)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDB) CreateOAuthAuthorizationCode(ctx context.Context, params CreateOAuthAuthorizationCodeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign keys on oauth_authorization_codes
+	if _, ok := m.oauthClients[params.ClientID]; !ok {
+		return fmt.Errorf("error creating oauth authorization code: client %q does not exist", params.ClientID)
+	}
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return fmt.Errorf("error creating oauth authorization code: account %q does not exist", params.AccountID)
+	}
+	if _, ok := m.oauthCodes[params.CodeHash]; ok {
+		return fmt.Errorf("error creating oauth authorization code: duplicate code hash")
+	}
+
+	now := m.timeNow()
+	for hash, code := range m.oauthCodes {
+		if !code.ExpiresAt.After(now) {
+			delete(m.oauthCodes, hash)
+		}
+	}
+
+	m.oauthCodes[params.CodeHash] = OAuthAuthorizationCode{
+		CodeHash:      params.CodeHash,
+		ClientID:      params.ClientID,
+		AccountID:     params.AccountID,
+		RedirectURI:   params.RedirectURI,
+		Scopes:        append(StringArray{}, params.Scopes...),
+		CodeChallenge: params.CodeChallenge,
+		Nonce:         params.Nonce,
+		AuthTime:      params.AuthTime,
+		ExpiresAt:     params.ExpiresAt,
+		CreatedAt:     now,
+	}
+	return nil
+}
+
+func (m *MemoryDB) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (*OAuthAuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	code, ok := m.oauthCodes[codeHash]
+	if !ok || !code.ExpiresAt.After(m.timeNow()) {
+		return nil, ErrOAuthAuthorizationCodeNotFound
+	}
+	delete(m.oauthCodes, codeHash)
+	return &code, nil
+}
+
+func (m *MemoryDB) SetOrganizationSAMLConfig(ctx context.Context, params SetOrganizationSAMLConfigParams) (*OrganizationSAMLConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign key on organization_saml_configs.organization_id
+	if _, ok := m.organizations[params.OrganizationID]; !ok {
+		return nil, fmt.Errorf("error setting organization saml config: organization %q does not exist", params.OrganizationID)
+	}
+
+	now := m.timeNow()
+	config, ok := m.samlConfigs[params.OrganizationID]
+	if !ok {
+		config = OrganizationSAMLConfig{OrganizationID: params.OrganizationID, CreatedAt: now}
+	}
+	config.IdPEntityID = params.IdPEntityID
+	config.IdPMetadata = params.IdPMetadata
+	config.UpdatedAt = now
+	m.samlConfigs[params.OrganizationID] = config
+
+	return &config, nil
+}
+
+func (m *MemoryDB) GetOrganizationSAMLConfig(ctx context.Context, organizationID string) (*OrganizationSAMLConfig, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	config, ok := m.samlConfigs[organizationID]
+	if !ok {
+		return nil, ErrOrganizationSAMLConfigNotFound
+	}
+	return &config, nil
+}
+
+func (m *MemoryDB) DeleteOrganizationSAMLConfig(ctx context.Context, organizationID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.samlConfigs[organizationID]; !ok {
+		return ErrOrganizationSAMLConfigNotFound
+	}
+	delete(m.samlConfigs, organizationID)
+	return nil
+}
+
+func (m *MemoryDB) CreateFederatedIdentity(ctx context.Context, params CreateFederatedIdentityParams) (*FederatedIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// mirror the foreign keys on federated_identities
+	if _, ok := m.accounts[params.AccountID]; !ok {
+		return nil, fmt.Errorf("error creating federated identity: account %q does not exist", params.AccountID)
+	}
+	if _, ok := m.organizations[params.OrganizationID]; !ok {
+		return nil, fmt.Errorf("error creating federated identity: organization %q does not exist", params.OrganizationID)
+	}
+
+	key := params.OrganizationID + "|" + params.Subject
+	if _, ok := m.federated[key]; ok {
+		return nil, ErrFederatedIdentityAlreadyExists
+	}
+
+	identity := FederatedIdentity{
+		ID:             uuid.NewString(),
+		AccountID:      params.AccountID,
+		OrganizationID: params.OrganizationID,
+		Subject:        params.Subject,
+		Email:          params.Email,
+		CreatedAt:      m.timeNow(),
+	}
+	m.federated[key] = identity
+
+	return &identity, nil
+}
+
+func (m *MemoryDB) GetFederatedIdentity(ctx context.Context, organizationID, subject string) (*FederatedIdentity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	identity, ok := m.federated[organizationID+"|"+subject]
+	if !ok {
+		return nil, ErrFederatedIdentityNotFound
+	}
+	return &identity, nil
+}
+
+// addAccountOutboxEvent must be called with the lock held
+func (m *MemoryDB) addAccountOutboxEvent(eventType string, account Account) {
+	m.addOutboxEvent(eventType, account.ID, map[string]string{
+		"account_id": account.ID,
+		"email":      account.Email,
+	})
+}
+
+// addOutboxEvent must be called with the lock held
+func (m *MemoryDB) addOutboxEvent(eventType, accountID string, payload map[string]string) {
+	encoded, _ := json.Marshal(payload)
+	m.outboxSeq++
+	m.outbox = append(m.outbox, OutboxEvent{
+		ID:        uuid.NewString(),
+		Sequence:  m.outboxSeq,
+		EventType: eventType,
+		AccountID: accountID,
+		Payload:   string(encoded),
+		CreatedAt: m.timeNow(),
+	})
+}
+
+func (m *MemoryDB) RelayOutboxEvents(ctx context.Context, limit int, publish func(ctx context.Context, events []OutboxEvent) error) (int, error) {
+	if !m.relayMu.TryLock() {
+		return 0, nil
+	}
+	defer m.relayMu.Unlock()
+
+	// publish without the lock so it doesn't hold up everything else
+	m.mu.RLock()
+	var events []OutboxEvent
+	for _, e := range m.outbox {
+		if e.PublishedAt == nil {
+			events = append(events, e)
+			if len(events) == limit {
+				break
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(events) == 0 {
+		return 0, nil
+	}
+	if err := publish(ctx, events); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.timeNow()
+	published := map[string]bool{}
+	for _, e := range events {
+		published[e.ID] = true
+	}
+	for i := range m.outbox {
+		if published[m.outbox[i].ID] {
+			m.outbox[i].PublishedAt = &now
+		}
+	}
+	return len(events), nil
+}
+
+func (m *MemoryDB) PurgeOutboxEvents(ctx context.Context, createdBefore time.Time, unpublished bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.outbox)
+	m.outbox = slices.DeleteFunc(m.outbox, func(e OutboxEvent) bool {
+		return e.CreatedAt.Before(createdBefore) && (e.PublishedAt != nil || unpublished)
+	})
+	return int64(before - len(m.outbox)), nil
+}
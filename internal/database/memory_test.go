@@ -0,0 +1,1647 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryDBAccounts(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	created, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "memory@test.com",
+		PasswordHash: "hashed-password",
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, "en", created.PreferredLocale)
+	assert.NotZero(t, created.CreatedAt)
+
+	_, err = db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "memory@test.com",
+		PasswordHash: "hashed-password",
+	})
+	require.ErrorIs(t, err, ErrAccountAlreadyExists)
+
+	actual, err := db.GetAccount(ctx, "memory@test.com")
+	require.NoError(t, err)
+	assert.Equal(t, *created, *actual)
+
+	_, err = db.GetAccount(ctx, "nonexistent@test.com")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestMemoryDBRefreshTokens(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "memorytokens@test.com",
+		PasswordHash: "hashed-password",
+	})
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "token-1",
+		AccountID: account.ID,
+		ExpiresAt: expiresAt,
+	}))
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "token-2",
+		AccountID: account.ID,
+		ExpiresAt: expiresAt,
+	}))
+
+	// foreign key is enforced
+	err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "token-invalid",
+		AccountID: "non-existent-account-id",
+		ExpiresAt: expiresAt,
+	})
+	require.Error(t, err)
+
+	token, err := db.GetRefreshToken(ctx, "token-1")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, token.AccountID)
+	assert.Equal(t, expiresAt, token.ExpiresAt)
+	assert.Nil(t, token.RotatedAt)
+
+	rotatedAt := time.Now()
+	rotated, err := db.RotateRefreshToken(ctx, "token-1", rotatedAt)
+	require.NoError(t, err)
+	require.NotNil(t, rotated.RotatedAt)
+	assert.Equal(t, rotatedAt, *rotated.RotatedAt)
+	// rotating again keeps the first rotation time
+	again, err := db.RotateRefreshToken(ctx, "token-1", rotatedAt.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, rotatedAt, *again.RotatedAt)
+	_, err = db.RotateRefreshToken(ctx, "token-unknown", rotatedAt)
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	// rotated and expired tokens aren't active
+	active, err := db.CountActiveRefreshTokens(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), active)
+	active, err = db.CountActiveRefreshTokens(ctx, expiresAt)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), active)
+
+	// deleting by token leaves the account's other tokens
+	require.NoError(t, db.DeleteRefreshTokenByToken(ctx, "token-1"))
+	require.NoError(t, db.DeleteRefreshTokenByToken(ctx, "token-unknown"))
+	_, err = db.GetRefreshToken(ctx, "token-1")
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+	_, err = db.GetRefreshToken(ctx, "token-2")
+	require.NoError(t, err)
+
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "token-1",
+		AccountID: account.ID,
+		ExpiresAt: expiresAt,
+	}))
+	require.NoError(t, db.DeleteRefreshTokensByAccount(ctx, account.ID))
+
+	_, err = db.GetRefreshToken(ctx, "token-1")
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+	_, err = db.GetRefreshToken(ctx, "token-2")
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+}
+
+func TestMemoryDBSessions(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	now := time.Now()
+	db.timeNow = func() time.Time { return now }
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "memorysessions@test.com"})
+	require.NoError(t, err)
+
+	expiresAt := now.Add(time.Hour)
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "laptop-1",
+		AccountID: account.ID,
+		ExpiresAt: expiresAt,
+		IPAddress: "203.0.113.1",
+		UserAgent: "laptop",
+	}))
+	laptop, err := db.GetRefreshToken(ctx, "laptop-1")
+	require.NoError(t, err)
+	require.NotEmpty(t, laptop.SessionID)
+
+	// refreshing continues the session from wherever the client is now
+	now = now.Add(time.Minute)
+	_, err = db.RotateRefreshToken(ctx, "laptop-1", now)
+	require.NoError(t, err)
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "laptop-2",
+		AccountID: account.ID,
+		ExpiresAt: expiresAt,
+		SessionID: laptop.SessionID,
+		IPAddress: "203.0.113.2",
+		UserAgent: "laptop",
+	}))
+
+	now = now.Add(time.Minute)
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "phone-1",
+		AccountID: account.ID,
+		ExpiresAt: expiresAt,
+		UserAgent: "phone",
+	}))
+
+	sessions, err := db.ListSessions(ctx, account.ID, now)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "phone", sessions[0].UserAgent)
+	assert.Equal(t, laptop.SessionID, sessions[1].ID)
+	assert.Equal(t, "203.0.113.2", sessions[1].IPAddress)
+	assert.Equal(t, laptop.CreatedAt, sessions[1].CreatedAt)
+	assert.Equal(t, laptop.CreatedAt.Add(time.Minute), sessions[1].LastUsedAt)
+
+	// sessions without a usable token aren't listed
+	sessions, err = db.ListSessions(ctx, account.ID, expiresAt)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	require.NoError(t, db.DeleteSession(ctx, account.ID, laptop.SessionID))
+	require.ErrorIs(t, db.DeleteSession(ctx, account.ID, laptop.SessionID), ErrSessionNotFound)
+	_, err = db.GetRefreshToken(ctx, "laptop-2")
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	// other accounts' sessions can't be deleted
+	phone, err := db.GetRefreshToken(ctx, "phone-1")
+	require.NoError(t, err)
+	require.ErrorIs(t, db.DeleteSession(ctx, "other-account-id", phone.SessionID), ErrSessionNotFound)
+
+	sessions, err = db.ListSessions(ctx, account.ID, now)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, phone.SessionID, sessions[0].ID)
+}
+
+func TestMemoryDBRevokedAccessTokens(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+	now := time.Now()
+	db.timeNow = func() time.Time { return now }
+
+	require.NoError(t, db.RevokeAccessToken(ctx, "revoked", now.Add(time.Minute)))
+	require.NoError(t, db.RevokeAccessToken(ctx, "expired", now))
+
+	revoked, err := db.AccessTokenRevoked(ctx, "revoked")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = db.AccessTokenRevoked(ctx, "expired")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	revoked, err = db.AccessTokenRevoked(ctx, "unknown")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	claimed, err := db.ClaimAccessToken(ctx, "claimed", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = db.ClaimAccessToken(ctx, "claimed", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed, "a token can only be claimed once")
+	claimed, err = db.ClaimAccessToken(ctx, "revoked", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed, "revoked tokens can't be claimed")
+
+	// expired revocations are cleaned up on the next one
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, db.RevokeAccessToken(ctx, "another", now.Add(time.Minute)))
+	assert.Len(t, db.revoked, 1)
+}
+
+func TestMemoryDBAccountIdentities(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "identity@test.com"})
+	require.NoError(t, err)
+
+	params := CreateAccountIdentityParams{
+		AccountID: account.ID,
+		Provider:  IdentityProviderApple,
+		Subject:   "001234.abcd",
+		Email:     "identity@test.com",
+		Name:      "Test User",
+	}
+
+	created, err := db.CreateAccountIdentity(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, created.AccountID)
+
+	_, err = db.CreateAccountIdentity(ctx, params)
+	require.ErrorIs(t, err, ErrAccountIdentityAlreadyExists)
+
+	actual, err := db.GetAccountIdentity(ctx, IdentityProviderApple, "001234.abcd")
+	require.NoError(t, err)
+	assert.Equal(t, *created, *actual)
+
+	_, err = db.GetAccountIdentity(ctx, IdentityProviderApple, "unknown")
+	require.ErrorIs(t, err, ErrAccountIdentityNotFound)
+
+	params.AccountID = "missing-account"
+	params.Subject = "other"
+	_, err = db.CreateAccountIdentity(ctx, params)
+	require.Error(t, err)
+}
+
+func TestMemoryDBEmailChanges(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "old@test.com"})
+	require.NoError(t, err)
+	_, err = db.CreateAccount(ctx, AccountCreationParams{Email: "taken@test.com"})
+	require.NoError(t, err)
+
+	newChange := func(newEmail, suffix string) *EmailChange {
+		change, err := db.CreateEmailChange(ctx, CreateEmailChangeParams{
+			AccountID:       account.ID,
+			NewEmail:        newEmail,
+			OldTokenHash:    "old-" + suffix,
+			NewTokenHash:    "new-" + suffix,
+			CancelTokenHash: "cancel-" + suffix,
+			ExpiresAt:       time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+		return change
+	}
+
+	first := newChange("first@test.com", "1")
+	second := newChange("new@test.com", "2")
+
+	// the second request replaced the first
+	_, err = db.GetEmailChangeByTokenHash(ctx, "old-1")
+	require.ErrorIs(t, err, ErrEmailChangeNotFound)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	for _, hash := range []string{"old-2", "new-2", "cancel-2"} {
+		found, err := db.GetEmailChangeByTokenHash(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, second.ID, found.ID)
+	}
+
+	// not confirmed by both sides yet
+	confirmed, err := db.ConfirmEmailChange(ctx, second.ID, EmailChangeSideNew)
+	require.NoError(t, err)
+	assert.False(t, confirmed.Confirmed())
+	_, err = db.CompleteEmailChange(ctx, second.ID)
+	require.Error(t, err)
+
+	second = newChange("new@test.com", "3")
+	_, err = db.ConfirmEmailChange(ctx, second.ID, EmailChangeSideNew)
+	require.NoError(t, err)
+	confirmed, err = db.ConfirmEmailChange(ctx, second.ID, EmailChangeSideOld)
+	require.NoError(t, err)
+	assert.True(t, confirmed.Confirmed())
+
+	completed, err := db.CompleteEmailChange(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, completed.AccountID)
+
+	updated, err := db.GetAccountByID(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new@test.com", updated.Email)
+	_, err = db.GetAccount(ctx, "old@test.com")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+
+	// the new email was taken in the meantime
+	taken := newChange("taken@test.com", "4")
+	_, err = db.ConfirmEmailChange(ctx, taken.ID, EmailChangeSideNew)
+	require.NoError(t, err)
+	_, err = db.ConfirmEmailChange(ctx, taken.ID, EmailChangeSideOld)
+	require.NoError(t, err)
+	_, err = db.CompleteEmailChange(ctx, taken.ID)
+	require.ErrorIs(t, err, ErrAccountAlreadyExists)
+}
+
+func TestMemoryDBAccountTags(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := NewMemoryDB()
+	db.timeNow = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	ctx := context.Background()
+
+	older, err := db.CreateAccount(ctx, AccountCreationParams{Email: "older@test.com"})
+	require.NoError(t, err)
+	newer, err := db.CreateAccount(ctx, AccountCreationParams{Email: "newer@test.com"})
+	require.NoError(t, err)
+	assert.Empty(t, older.Tags)
+
+	tagged, err := db.AddAccountTags(ctx, older.ID, []string{"enterprise", "beta"})
+	require.NoError(t, err)
+	assert.Equal(t, StringArray{"beta", "enterprise"}, tagged.Tags)
+
+	tagged, err = db.AddAccountTags(ctx, older.ID, []string{"beta", "vip"})
+	require.NoError(t, err)
+	assert.Equal(t, StringArray{"beta", "enterprise", "vip"}, tagged.Tags)
+
+	_, err = db.AddAccountTags(ctx, newer.ID, []string{"beta"})
+	require.NoError(t, err)
+
+	untagged, err := db.RemoveAccountTag(ctx, older.ID, "enterprise")
+	require.NoError(t, err)
+	assert.Equal(t, StringArray{"beta", "vip"}, untagged.Tags)
+	// the earlier result isn't changed underneath the caller
+	assert.Equal(t, StringArray{"beta", "enterprise", "vip"}, tagged.Tags)
+
+	_, err = db.AddAccountTags(ctx, "missing", []string{"beta"})
+	require.ErrorIs(t, err, ErrAccountNotFound)
+	_, err = db.RemoveAccountTag(ctx, "missing", "beta")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+
+	all, err := db.ListAccounts(ctx, ListAccountsParams{})
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, newer.ID, all[0].ID)
+
+	vip, err := db.ListAccounts(ctx, ListAccountsParams{Tag: "vip"})
+	require.NoError(t, err)
+	require.Len(t, vip, 1)
+	assert.Equal(t, older.ID, vip[0].ID)
+
+	page, err := db.ListAccounts(ctx, ListAccountsParams{Tag: "beta", Keyset: Keyset{Limit: 1}})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, newer.ID, page[0].ID)
+
+	page, err = db.ListAccounts(ctx, ListAccountsParams{
+		Tag: "beta",
+		Keyset: Keyset{
+			BeforeCreatedAt: page[0].CreatedAt,
+			BeforeID:        page[0].ID,
+			Limit:           1,
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, older.ID, page[0].ID)
+}
+
+func TestMemoryDBAccountFeatureFlags(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "flags@test.com"})
+	require.NoError(t, err)
+	assert.Empty(t, account.FeatureFlags)
+
+	updated, err := db.UpdateAccountFeatureFlags(ctx, account.ID, map[string]bool{"new-dashboard": true, "exports": false}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, FeatureFlags{"new-dashboard": true, "exports": false}, updated.FeatureFlags)
+
+	again, err := db.UpdateAccountFeatureFlags(ctx, account.ID, map[string]bool{"beta-search": true}, []string{"exports"})
+	require.NoError(t, err)
+	assert.Equal(t, FeatureFlags{"new-dashboard": true, "beta-search": true}, again.FeatureFlags)
+	// the earlier result isn't changed underneath the caller
+	assert.Equal(t, FeatureFlags{"new-dashboard": true, "exports": false}, updated.FeatureFlags)
+
+	_, err = db.UpdateAccountFeatureFlags(ctx, "missing", map[string]bool{"exports": true}, nil)
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestMemoryDBAccountProfile(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "profile@test.com", PreferredLocale: "en"})
+	require.NoError(t, err)
+	assert.Empty(t, account.DisplayName)
+
+	name, timezone := "Ada", "Europe/London"
+	updated, err := db.UpdateAccountProfile(ctx, account.ID, UpdateAccountProfileParams{DisplayName: &name, Timezone: &timezone})
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", updated.DisplayName)
+	assert.Equal(t, "Europe/London", updated.Timezone)
+	assert.Equal(t, "en", updated.PreferredLocale)
+	assert.False(t, updated.UpdatedAt.Before(account.UpdatedAt))
+
+	// nil fields are left alone, empty ones cleared
+	locale, empty := "de", ""
+	again, err := db.UpdateAccountProfile(ctx, account.ID, UpdateAccountProfileParams{PreferredLocale: &locale, DisplayName: &empty})
+	require.NoError(t, err)
+	assert.Empty(t, again.DisplayName)
+	assert.Equal(t, "Europe/London", again.Timezone)
+	assert.Equal(t, "de", again.PreferredLocale)
+
+	actual, err := db.GetAccountByID(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, again.Timezone, actual.Timezone)
+	assert.Equal(t, again.PreferredLocale, actual.PreferredLocale)
+
+	_, err = db.UpdateAccountProfile(ctx, "missing", UpdateAccountProfileParams{DisplayName: &name})
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestMemoryDBAccountUsername(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "username@test.com", Username: "Ada_L"})
+	require.NoError(t, err)
+	assert.Equal(t, "Ada_L", account.Username)
+	other, err := db.CreateAccount(ctx, AccountCreationParams{Email: "username-other@test.com"})
+	require.NoError(t, err)
+	assert.Empty(t, other.Username)
+
+	// usernames are compared regardless of case
+	found, err := db.GetAccountByUsername(ctx, "ada_l")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, found.ID)
+	_, err = db.GetAccountByUsername(ctx, "")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+
+	_, err = db.CreateAccount(ctx, AccountCreationParams{Email: "username-taken@test.com", Username: "ADA_L"})
+	require.ErrorIs(t, err, ErrUsernameTaken)
+	taken := "ada_L"
+	_, err = db.UpdateAccountProfile(ctx, other.ID, UpdateAccountProfileParams{Username: &taken})
+	require.ErrorIs(t, err, ErrUsernameTaken)
+
+	// changing the case of its own username, and accounts without one, don't conflict
+	renamed := "ADA_L"
+	updated, err := db.UpdateAccountProfile(ctx, account.ID, UpdateAccountProfileParams{Username: &renamed})
+	require.NoError(t, err)
+	assert.Equal(t, "ADA_L", updated.Username)
+	_, err = db.CreateAccount(ctx, AccountCreationParams{Email: "username-third@test.com"})
+	require.NoError(t, err)
+
+	// a deleted account's username can be taken again
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	_, err = db.GetAccountByUsername(ctx, "ada_l")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+	updated, err = db.UpdateAccountProfile(ctx, other.ID, UpdateAccountProfileParams{Username: &taken})
+	require.NoError(t, err)
+	assert.Equal(t, "ada_L", updated.Username)
+}
+
+func TestMemoryDBAccountMetadata(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "metadata@test.com"})
+	require.NoError(t, err)
+	assert.Empty(t, account.UserMetadata)
+	assert.Empty(t, account.AppMetadata)
+
+	updated, err := db.UpdateAccountMetadata(ctx, account.ID, UpdateAccountMetadataParams{
+		SetUserMetadata: Metadata{"theme": json.RawMessage(`"dark"`)},
+		SetAppMetadata:  Metadata{"plan": json.RawMessage(`"pro"`), "seats": json.RawMessage(`5`)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Metadata{"theme": json.RawMessage(`"dark"`)}, updated.UserMetadata)
+	assert.Equal(t, Metadata{"plan": json.RawMessage(`"pro"`), "seats": json.RawMessage(`5`)}, updated.AppMetadata)
+
+	again, err := db.UpdateAccountMetadata(ctx, account.ID, UpdateAccountMetadataParams{
+		SetUserMetadata:  Metadata{"language": json.RawMessage(`"en"`)},
+		UnsetAppMetadata: []string{"seats"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Metadata{"theme": json.RawMessage(`"dark"`), "language": json.RawMessage(`"en"`)}, again.UserMetadata)
+	assert.Equal(t, Metadata{"plan": json.RawMessage(`"pro"`)}, again.AppMetadata)
+	// the earlier result isn't changed underneath the caller
+	assert.Equal(t, Metadata{"plan": json.RawMessage(`"pro"`), "seats": json.RawMessage(`5`)}, updated.AppMetadata)
+
+	actual, err := db.GetAccountByID(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, again.UserMetadata, actual.UserMetadata)
+	assert.Equal(t, again.AppMetadata, actual.AppMetadata)
+
+	_, err = db.UpdateAccountMetadata(ctx, "missing", UpdateAccountMetadataParams{UnsetUserMetadata: []string{"theme"}})
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestMemoryDBAccountFreezes(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "freeze@test.com", PasswordHash: "old-hash"})
+	require.NoError(t, err)
+	assert.Nil(t, account.FrozenAt)
+
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "rt", AccountID: account.ID, ExpiresAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, db.CreateFreezeToken(ctx, CreateFreezeTokenParams{
+		TokenHash: "freeze-hash",
+		AccountID: account.ID,
+		Purpose:   FreezeTokenPurposeFreeze,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+
+	token, err := db.GetFreezeToken(ctx, "freeze-hash")
+	require.NoError(t, err)
+	assert.Equal(t, FreezeTokenPurposeFreeze, token.Purpose)
+
+	frozen, err := db.FreezeAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.NotNil(t, frozen.FrozenAt)
+
+	_, err = db.GetRefreshToken(ctx, "rt")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound, "sessions should end")
+	_, err = db.GetFreezeToken(ctx, "freeze-hash")
+	assert.ErrorIs(t, err, ErrFreezeTokenNotFound, "freeze links should be used up")
+
+	again, err := db.FreezeAccount(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, frozen.FrozenAt, again.FrozenAt, "refreezing keeps the original time")
+
+	require.NoError(t, db.CreateFreezeToken(ctx, CreateFreezeTokenParams{
+		TokenHash: "unfreeze-hash",
+		AccountID: account.ID,
+		Purpose:   FreezeTokenPurposeUnfreeze,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+
+	unfrozen, err := db.UnfreezeAccount(ctx, account.ID, "new-hash")
+	require.NoError(t, err)
+	assert.Nil(t, unfrozen.FrozenAt)
+	assert.Equal(t, "new-hash", unfrozen.PasswordHash)
+	_, err = db.GetFreezeToken(ctx, "unfreeze-hash")
+	assert.ErrorIs(t, err, ErrFreezeTokenNotFound)
+
+	// an empty hash keeps the password
+	unfrozen, err = db.UnfreezeAccount(ctx, account.ID, "")
+	require.NoError(t, err)
+	assert.Equal(t, "new-hash", unfrozen.PasswordHash)
+
+	_, err = db.FreezeAccount(ctx, "missing")
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestMemoryDBEmailVerifications(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "verify@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	assert.Nil(t, account.VerifiedAt)
+
+	require.NoError(t, db.CreateEmailVerification(ctx, CreateEmailVerificationParams{
+		TokenHash: "verify-hash",
+		AccountID: account.ID,
+		Email:     account.Email,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+
+	verification, err := db.GetEmailVerification(ctx, "verify-hash")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, verification.AccountID)
+	assert.Equal(t, "verify@test.com", verification.Email)
+
+	verified, err := db.VerifyAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.NotNil(t, verified.VerifiedAt)
+
+	_, err = db.GetEmailVerification(ctx, "verify-hash")
+	assert.ErrorIs(t, err, ErrEmailVerificationNotFound, "verification links should be used up")
+
+	again, err := db.VerifyAccount(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, verified.VerifiedAt, again.VerifiedAt, "reverifying keeps the original time")
+
+	preverified, err := db.CreateAccount(ctx, AccountCreationParams{Email: "apple@test.com", Verified: true})
+	require.NoError(t, err)
+	assert.NotNil(t, preverified.VerifiedAt)
+
+	_, err = db.VerifyAccount(ctx, "missing")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestMemoryDBPasswordResets(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "reset@test.com", PasswordHash: "old-hash"})
+	require.NoError(t, err)
+
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "rt", AccountID: account.ID, ExpiresAt: time.Now().Add(time.Hour)}))
+	for _, hash := range []string{"reset-hash", "other-reset-hash"} {
+		require.NoError(t, db.CreatePasswordResetToken(ctx, CreatePasswordResetTokenParams{
+			TokenHash: hash,
+			AccountID: account.ID,
+			Email:     account.Email,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}))
+	}
+
+	token, err := db.GetPasswordResetToken(ctx, "reset-hash")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, token.AccountID)
+	assert.Equal(t, "reset@test.com", token.Email)
+
+	reset, err := db.ResetPassword(ctx, account.ID, "new-hash")
+	require.NoError(t, err)
+	assert.Equal(t, "new-hash", reset.PasswordHash)
+	assert.NotNil(t, reset.VerifiedAt, "the emailed link verifies the address")
+
+	_, err = db.GetRefreshToken(ctx, "rt")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound, "sessions should end")
+	_, err = db.GetPasswordResetToken(ctx, "other-reset-hash")
+	assert.ErrorIs(t, err, ErrPasswordResetTokenNotFound, "every reset link should be used up")
+
+	_, err = db.ResetPassword(ctx, "missing", "hash")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "rt-2", AccountID: account.ID, ExpiresAt: time.Now().Add(time.Hour)}))
+	changed, err := db.UpdatePassword(ctx, account.ID, "changed-hash")
+	require.NoError(t, err)
+	assert.Equal(t, "changed-hash", changed.PasswordHash)
+	_, err = db.GetRefreshToken(ctx, "rt-2")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound, "changing the password ends sessions too")
+
+	_, err = db.UpdatePassword(ctx, "missing", "hash")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "rt-3", AccountID: account.ID, ExpiresAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, db.RehashPassword(ctx, account.ID, "changed-hash", "rehashed"))
+	require.NoError(t, db.RehashPassword(ctx, account.ID, "changed-hash", "stale"), "a stale old hash changes nothing")
+	rehashed, err := db.GetAccountByID(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "rehashed", rehashed.PasswordHash)
+	_, err = db.GetRefreshToken(ctx, "rt-3")
+	assert.NoError(t, err, "rehashing keeps sessions")
+}
+
+func TestMemoryDBAccountDeletions(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	now := time.Now()
+	db.timeNow = func() time.Time { return now }
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "delete@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "rt", AccountID: account.ID, ExpiresAt: now.Add(time.Hour)}))
+	require.NoError(t, db.CreateAuditEvent(ctx, CreateAuditEventParams{AccountID: account.ID, EventType: AuditEventLogin}))
+
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	require.ErrorIs(t, db.DeleteAccount(ctx, account.ID), ErrAccountNotFound)
+
+	_, err = db.GetAccount(ctx, "delete@test.com")
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+	_, err = db.GetAccountByID(ctx, account.ID)
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+	_, err = db.GetRefreshToken(ctx, "rt")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	purged, err := db.PurgeDeletedAccounts(ctx, now)
+	require.NoError(t, err)
+	assert.Zero(t, purged, "still within the retention period")
+
+	purged, err = db.PurgeDeletedAccounts(ctx, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	events, err := db.ListAuditEvents(ctx, ListAuditEventsParams{AccountID: account.ID, Keyset: Keyset{Limit: 10}})
+	require.NoError(t, err)
+	assert.Empty(t, events, "purged accounts' events are kept without the account")
+}
+
+func TestMemoryDBMFASecrets(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "mfa@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	_, err = db.GetMFASecret(ctx, account.ID)
+	require.ErrorIs(t, err, ErrMFASecretNotFound)
+
+	require.NoError(t, db.SetMFASecret(ctx, account.ID, "FIRSTSECRET"))
+	require.NoError(t, db.SetMFASecret(ctx, account.ID, "SECONDSECRET"), "pending secrets are replaced")
+
+	secret, err := db.GetMFASecret(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "SECONDSECRET", secret.Secret)
+	assert.Nil(t, secret.EnabledAt)
+
+	require.ErrorIs(t, db.UseMFAStep(ctx, account.ID, 10), ErrMFACodeUsed, "pending secrets can't log in")
+
+	enabled, err := db.EnableMFA(ctx, account.ID, 10)
+	require.NoError(t, err)
+	assert.NotNil(t, enabled.EnabledAt)
+	assert.Equal(t, int64(10), enabled.LastUsedStep)
+
+	_, err = db.EnableMFA(ctx, account.ID, 11)
+	require.ErrorIs(t, err, ErrMFASecretNotFound)
+	require.ErrorIs(t, db.SetMFASecret(ctx, account.ID, "THIRDSECRET"), ErrMFAAlreadyEnabled)
+
+	require.ErrorIs(t, db.UseMFAStep(ctx, account.ID, 10), ErrMFACodeUsed)
+	require.NoError(t, db.UseMFAStep(ctx, account.ID, 11))
+	require.ErrorIs(t, db.UseMFAStep(ctx, account.ID, 11), ErrMFACodeUsed)
+
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	_, err = db.GetMFASecret(ctx, account.ID)
+	require.ErrorIs(t, err, ErrMFASecretNotFound)
+}
+
+func TestMemoryDBMFARecoveryCodes(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "recovery@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	other, err := db.CreateAccount(ctx, AccountCreationParams{Email: "other@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	require.NoError(t, db.ReplaceMFARecoveryCodes(ctx, account.ID, []string{"hash-1", "hash-2", "hash-3"}))
+	require.NoError(t, db.ReplaceMFARecoveryCodes(ctx, other.ID, []string{"hash-1"}))
+
+	count, err := db.CountMFARecoveryCodes(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	require.ErrorIs(t, db.UseMFARecoveryCode(ctx, other.ID, "hash-2"), ErrMFARecoveryCodeNotFound, "codes only work for their account")
+	require.NoError(t, db.UseMFARecoveryCode(ctx, account.ID, "hash-2"))
+	require.ErrorIs(t, db.UseMFARecoveryCode(ctx, account.ID, "hash-2"), ErrMFARecoveryCodeNotFound, "codes work once")
+
+	require.NoError(t, db.ReplaceMFARecoveryCodes(ctx, account.ID, []string{"hash-1", "hash-4"}))
+	require.ErrorIs(t, db.UseMFARecoveryCode(ctx, account.ID, "hash-3"), ErrMFARecoveryCodeNotFound, "replaced codes stop working")
+
+	count, err = db.CountMFARecoveryCodes(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	count, err = db.CountMFARecoveryCodes(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	count, err = db.CountMFARecoveryCodes(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestMemoryDBMFAPhones(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "phone@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	_, err = db.GetMFAPhone(ctx, account.ID)
+	require.ErrorIs(t, err, ErrMFAPhoneNotFound)
+	require.ErrorIs(t, db.SetMFAPhoneCode(ctx, SetMFAPhoneCodeParams{AccountID: account.ID, CodeHash: "hash"}), ErrMFAPhoneCodeThrottled, "no phone to send to")
+
+	require.NoError(t, db.SetMFAPhone(ctx, account.ID, "+14155550100"))
+	require.NoError(t, db.SetMFAPhone(ctx, account.ID, "+14155550123"), "pending numbers are replaced")
+
+	phone, err := db.GetMFAPhone(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "+14155550123", phone.PhoneNumber)
+	assert.Nil(t, phone.VerifiedAt)
+
+	now := time.Now()
+	send := func(hash string, sentAt time.Time) error {
+		return db.SetMFAPhoneCode(ctx, SetMFAPhoneCodeParams{
+			AccountID:      account.ID,
+			CodeHash:       hash,
+			SentAt:         sentAt,
+			ExpiresAt:      sentAt.Add(5 * time.Minute),
+			LastSentBefore: sentAt.Add(-time.Minute),
+		})
+	}
+	require.NoError(t, send("hash-1", now))
+	require.ErrorIs(t, send("hash-2", now.Add(30*time.Second)), ErrMFAPhoneCodeThrottled)
+	require.ErrorIs(t, db.UseMFAPhoneCode(ctx, account.ID, "hash-2", now), ErrMFAPhoneCodeInvalid)
+
+	// a new number doesn't skip the throttle
+	require.NoError(t, db.SetMFAPhone(ctx, account.ID, "+14155550123"))
+	require.ErrorIs(t, send("hash-2", now.Add(30*time.Second)), ErrMFAPhoneCodeThrottled)
+	require.ErrorIs(t, db.UseMFAPhoneCode(ctx, account.ID, "hash-1", now), ErrMFAPhoneCodeInvalid, "a new number forgets the code")
+
+	require.NoError(t, send("hash-2", now.Add(time.Minute)))
+	require.ErrorIs(t, db.UseMFAPhoneCode(ctx, account.ID, "hash-2", now.Add(10*time.Minute)), ErrMFAPhoneCodeInvalid, "expired")
+	require.NoError(t, db.UseMFAPhoneCode(ctx, account.ID, "hash-2", now.Add(2*time.Minute)))
+	require.ErrorIs(t, db.UseMFAPhoneCode(ctx, account.ID, "hash-2", now.Add(2*time.Minute)), ErrMFAPhoneCodeInvalid, "codes work once")
+
+	verified, err := db.VerifyMFAPhone(ctx, account.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, verified.VerifiedAt)
+	_, err = db.VerifyMFAPhone(ctx, account.ID)
+	require.ErrorIs(t, err, ErrMFAPhoneNotFound)
+	require.ErrorIs(t, db.SetMFAPhone(ctx, account.ID, "+14155550199"), ErrMFAPhoneAlreadyVerified)
+
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	_, err = db.GetMFAPhone(ctx, account.ID)
+	require.ErrorIs(t, err, ErrMFAPhoneNotFound)
+}
+
+func TestMemoryDBOrganizations(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	owner, err := db.CreateAccount(ctx, AccountCreationParams{Email: "owner@test.com"})
+	require.NoError(t, err)
+	other, err := db.CreateAccount(ctx, AccountCreationParams{Email: "other@test.com"})
+	require.NoError(t, err)
+
+	org, err := db.CreateOrganization(ctx, "Acme", owner.ID)
+	require.NoError(t, err)
+
+	got, err := db.GetOrganization(ctx, org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, org, got)
+
+	member, err := db.GetOrganizationMember(ctx, org.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleOwner, member.Role)
+
+	_, err = db.GetOrganizationMember(ctx, org.ID, other.ID)
+	require.ErrorIs(t, err, ErrNotOrganizationMember)
+
+	orgs, err := db.ListAccountOrganizations(ctx, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []Organization{*org}, orgs)
+	orgs, err = db.ListAccountOrganizations(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Empty(t, orgs)
+	_, err = db.GetOrganization(ctx, "missing")
+	require.ErrorIs(t, err, ErrOrganizationNotFound)
+
+	// purging the account removes its memberships
+	require.NoError(t, db.DeleteAccount(ctx, owner.ID))
+	_, err = db.PurgeDeletedAccounts(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	_, err = db.GetOrganizationMember(ctx, org.ID, owner.ID)
+	require.ErrorIs(t, err, ErrNotOrganizationMember)
+}
+
+func TestMemoryDBRoles(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "admin@test.com"})
+	require.NoError(t, err)
+
+	roles, err := db.GetAccountRoles(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+
+	admin, err := db.GetRole(ctx, RoleAdmin)
+	require.NoError(t, err)
+	assert.NotEmpty(t, admin.Permissions)
+
+	support, err := db.CreateRole(ctx, "support", "Helps customers", []string{"accounts:read", "accounts:read"})
+	require.NoError(t, err)
+	assert.Equal(t, StringArray{"accounts:read"}, support.Permissions)
+	_, err = db.CreateRole(ctx, "support", "", nil)
+	require.ErrorIs(t, err, ErrRoleAlreadyExists)
+
+	require.NoError(t, db.AssignRole(ctx, account.ID, "support"))
+	require.NoError(t, db.AssignRole(ctx, account.ID, RoleAdmin))
+	// assigning a role twice is fine
+	require.NoError(t, db.AssignRole(ctx, account.ID, RoleAdmin))
+	require.ErrorIs(t, db.AssignRole(ctx, account.ID, "missing"), ErrRoleNotFound)
+
+	roles, err = db.GetAccountRoles(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{RoleAdmin, "support"}, roles)
+
+	require.NoError(t, db.UnassignRole(ctx, account.ID, "support"))
+	roles, err = db.GetAccountRoles(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{RoleAdmin}, roles)
+
+	// purging the account removes its roles
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	_, err = db.PurgeDeletedAccounts(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	roles, err = db.GetAccountRoles(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+}
+
+func TestMemoryDBOrganizationInvitations(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	owner, err := db.CreateAccount(ctx, AccountCreationParams{Email: "owner@test.com"})
+	require.NoError(t, err)
+	invited, err := db.CreateAccount(ctx, AccountCreationParams{Email: "invited@test.com"})
+	require.NoError(t, err)
+	org, err := db.CreateOrganization(ctx, "Acme", owner.ID)
+	require.NoError(t, err)
+
+	invite := func(tokenHash, email string) {
+		require.NoError(t, db.CreateOrganizationInvitation(ctx, CreateOrganizationInvitationParams{
+			TokenHash:      tokenHash,
+			OrganizationID: org.ID,
+			Email:          email,
+			Role:           OrganizationRoleAdmin,
+			ExpiresAt:      time.Now().Add(time.Hour),
+		}))
+	}
+
+	invite("hash", invited.Email)
+	invitation, err := db.GetOrganizationInvitation(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, org.ID, invitation.OrganizationID)
+	assert.Equal(t, invited.Email, invitation.Email)
+
+	member, err := db.AcceptOrganizationInvitation(ctx, "hash", invited.ID)
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleAdmin, member.Role)
+
+	// accepting uses the invitation up
+	_, err = db.GetOrganizationInvitation(ctx, "hash")
+	require.ErrorIs(t, err, ErrOrganizationInvitationNotFound)
+	_, err = db.AcceptOrganizationInvitation(ctx, "hash", invited.ID)
+	require.ErrorIs(t, err, ErrOrganizationInvitationNotFound)
+
+	// members keep their role
+	invite("owner-hash", owner.Email)
+	member, err = db.AcceptOrganizationInvitation(ctx, "owner-hash", owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleOwner, member.Role)
+}
+
+func TestMemoryDBWebhooks(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	endpoint, err := db.CreateWebhookEndpoint(ctx, CreateWebhookEndpointParams{
+		URL:        "https://example.com/hook",
+		Secret:     "secret",
+		EventTypes: []string{"account.created"},
+	})
+	require.NoError(t, err)
+
+	n, err := db.CreateWebhookDeliveries(ctx, "account.created", `{"id":"1"}`)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	n, err = db.CreateWebhookDeliveries(ctx, "unsubscribed", `{}`)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	now := time.Now().Add(time.Second)
+	claimed, err := db.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	// held until the lease runs out
+	again, err := db.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+
+	require.NoError(t, db.RecordWebhookAttempt(ctx, claimed[0].ID, WebhookAttempt{
+		Status:        WebhookDeliveryFailed,
+		NextAttemptAt: now,
+		LastError:     "connection refused",
+		At:            now,
+	}))
+	got, err := db.GetWebhookDelivery(ctx, claimed[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookDeliveryFailed, got.Status)
+	assert.Equal(t, 1, got.Attempts)
+	assert.Nil(t, got.DeliveredAt)
+
+	replayed, err := db.ReplayWebhookDelivery(ctx, got.ID, now)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookDeliveryPending, replayed.Status)
+	assert.Zero(t, replayed.Attempts)
+
+	require.NoError(t, db.DeleteWebhookEndpoint(ctx, endpoint.ID))
+	require.ErrorIs(t, db.DeleteWebhookEndpoint(ctx, endpoint.ID), ErrWebhookEndpointNotFound)
+	_, err = db.GetWebhookDelivery(ctx, got.ID)
+	require.ErrorIs(t, err, ErrWebhookDeliveryNotFound)
+}
+
+func TestMemoryDBAPIKeys(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "memoryapikeys@test.com"})
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	first, err := db.CreateAPIKey(ctx, CreateAPIKeyParams{
+		AccountID: account.ID,
+		Name:      "ci",
+		Prefix:    "amk_first",
+		KeyHash:   "first-hash",
+		Scopes:    []string{"account:read"},
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, StringArray{"account:read"}, first.Scopes)
+	require.NotNil(t, first.ExpiresAt)
+	assert.WithinDuration(t, expiresAt, *first.ExpiresAt, time.Millisecond)
+
+	second, err := db.CreateAPIKey(ctx, CreateAPIKeyParams{AccountID: account.ID, Name: "backup", Prefix: "amk_second", KeyHash: "second-hash"})
+	require.NoError(t, err)
+	assert.Empty(t, second.Scopes)
+	assert.Nil(t, second.ExpiresAt)
+
+	keys, err := db.ListAPIKeys(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	usedAt := time.Now()
+	require.NoError(t, db.TouchAPIKey(ctx, first.ID, usedAt))
+	got, err := db.GetAPIKeyByHash(ctx, "first-hash")
+	require.NoError(t, err)
+	require.NotNil(t, got.LastUsedAt)
+	assert.WithinDuration(t, usedAt, *got.LastUsedAt, time.Millisecond)
+	_, err = db.GetAPIKeyByHash(ctx, "unknown-hash")
+	require.ErrorIs(t, err, ErrAPIKeyNotFound)
+
+	require.ErrorIs(t, db.DeleteAPIKey(ctx, "other-account", first.ID), ErrAPIKeyNotFound)
+	require.NoError(t, db.DeleteAPIKey(ctx, account.ID, first.ID))
+	require.ErrorIs(t, db.DeleteAPIKey(ctx, account.ID, first.ID), ErrAPIKeyNotFound)
+
+	// deleting the account revokes its keys
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	_, err = db.GetAPIKeyByHash(ctx, "second-hash")
+	require.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
+
+func TestMemoryDBOAuth(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "memoryoauth@test.com"})
+	require.NoError(t, err)
+
+	confidential, err := db.CreateOAuthClient(ctx, CreateOAuthClientParams{
+		Name:         "reporting",
+		SecretHash:   "secret-hash",
+		RedirectURIs: []string{"https://reporting.example.com/callback"},
+		GrantTypes:   []string{"client_credentials", "authorization_code"},
+		Scopes:       []string{"account:read"},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, confidential.SecretHash)
+	assert.Equal(t, StringArray{"client_credentials", "authorization_code"}, confidential.GrantTypes)
+
+	public, err := db.CreateOAuthClient(ctx, CreateOAuthClientParams{Name: "mobile", GrantTypes: []string{"authorization_code"}})
+	require.NoError(t, err)
+	assert.Nil(t, public.SecretHash)
+	assert.Empty(t, public.RedirectURIs)
+
+	got, err := db.GetOAuthClient(ctx, confidential.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StringArray{"https://reporting.example.com/callback"}, got.RedirectURIs)
+	_, err = db.GetOAuthClient(ctx, "unknown")
+	require.ErrorIs(t, err, ErrOAuthClientNotFound)
+
+	clients, err := db.ListOAuthClients(ctx)
+	require.NoError(t, err)
+	assert.Len(t, clients, 2)
+
+	authTime := time.Now().Add(-time.Minute)
+	codeParams := CreateOAuthAuthorizationCodeParams{
+		CodeHash:      "code-hash",
+		ClientID:      public.ID,
+		AccountID:     account.ID,
+		RedirectURI:   "com.example.app:/callback",
+		Scopes:        []string{"account:read"},
+		CodeChallenge: "challenge",
+		Nonce:         "nonce",
+		AuthTime:      authTime,
+		ExpiresAt:     time.Now().Add(10 * time.Minute),
+	}
+	require.NoError(t, db.CreateOAuthAuthorizationCode(ctx, codeParams))
+	code, err := db.ConsumeOAuthAuthorizationCode(ctx, "code-hash")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, code.AccountID)
+	assert.Equal(t, StringArray{"account:read"}, code.Scopes)
+	assert.Equal(t, "nonce", code.Nonce)
+	assert.WithinDuration(t, authTime, code.AuthTime, time.Millisecond)
+	_, err = db.ConsumeOAuthAuthorizationCode(ctx, "code-hash")
+	require.ErrorIs(t, err, ErrOAuthAuthorizationCodeNotFound)
+
+	expired := codeParams
+	expired.CodeHash = "expired-hash"
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	require.NoError(t, db.CreateOAuthAuthorizationCode(ctx, expired))
+	_, err = db.ConsumeOAuthAuthorizationCode(ctx, "expired-hash")
+	require.ErrorIs(t, err, ErrOAuthAuthorizationCodeNotFound)
+
+	// deleting the client deletes its codes
+	codeParams.CodeHash = "deleted-client-hash"
+	require.NoError(t, db.CreateOAuthAuthorizationCode(ctx, codeParams))
+	require.NoError(t, db.DeleteOAuthClient(ctx, public.ID))
+	require.ErrorIs(t, db.DeleteOAuthClient(ctx, public.ID), ErrOAuthClientNotFound)
+	_, err = db.ConsumeOAuthAuthorizationCode(ctx, "deleted-client-hash")
+	require.ErrorIs(t, err, ErrOAuthAuthorizationCodeNotFound)
+
+	// and deleting the account deletes the codes it approved
+	codeParams.CodeHash = "deleted-account-hash"
+	codeParams.ClientID = confidential.ID
+	require.NoError(t, db.CreateOAuthAuthorizationCode(ctx, codeParams))
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	_, err = db.ConsumeOAuthAuthorizationCode(ctx, "deleted-account-hash")
+	require.ErrorIs(t, err, ErrOAuthAuthorizationCodeNotFound)
+}
+
+func TestMemoryDBSAML(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	owner, err := db.CreateAccount(ctx, AccountCreationParams{Email: "owner@test.com"})
+	require.NoError(t, err)
+	member, err := db.CreateAccount(ctx, AccountCreationParams{Email: "member@test.com"})
+	require.NoError(t, err)
+	org, err := db.CreateOrganization(ctx, "Acme", owner.ID)
+	require.NoError(t, err)
+
+	// adding a member keeps the role an existing member already has
+	added, err := db.AddOrganizationMember(ctx, org.ID, member.ID, OrganizationRoleMember)
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleMember, added.Role)
+	added, err = db.AddOrganizationMember(ctx, org.ID, owner.ID, OrganizationRoleMember)
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleOwner, added.Role)
+
+	_, err = db.GetOrganizationSAMLConfig(ctx, org.ID)
+	require.ErrorIs(t, err, ErrOrganizationSAMLConfigNotFound)
+
+	config, err := db.SetOrganizationSAMLConfig(ctx, SetOrganizationSAMLConfigParams{
+		OrganizationID: org.ID,
+		IdPEntityID:    "https://idp.example.com",
+		IdPMetadata:    "<EntityDescriptor/>",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.example.com", config.IdPEntityID)
+
+	// setting it again replaces it
+	_, err = db.SetOrganizationSAMLConfig(ctx, SetOrganizationSAMLConfigParams{
+		OrganizationID: org.ID,
+		IdPEntityID:    "https://other-idp.example.com",
+		IdPMetadata:    "<EntityDescriptor/>",
+	})
+	require.NoError(t, err)
+	got, err := db.GetOrganizationSAMLConfig(ctx, org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "https://other-idp.example.com", got.IdPEntityID)
+
+	identity, err := db.CreateFederatedIdentity(ctx, CreateFederatedIdentityParams{
+		AccountID:      member.ID,
+		OrganizationID: org.ID,
+		Subject:        "member-name-id",
+		Email:          "member@test.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, member.ID, identity.AccountID)
+
+	_, err = db.CreateFederatedIdentity(ctx, CreateFederatedIdentityParams{
+		AccountID:      owner.ID,
+		OrganizationID: org.ID,
+		Subject:        "member-name-id",
+	})
+	require.ErrorIs(t, err, ErrFederatedIdentityAlreadyExists)
+
+	gotIdentity, err := db.GetFederatedIdentity(ctx, org.ID, "member-name-id")
+	require.NoError(t, err)
+	assert.Equal(t, identity.ID, gotIdentity.ID)
+	assert.Equal(t, "member@test.com", gotIdentity.Email)
+	_, err = db.GetFederatedIdentity(ctx, org.ID, "unknown-name-id")
+	require.ErrorIs(t, err, ErrFederatedIdentityNotFound)
+
+	require.NoError(t, db.DeleteOrganizationSAMLConfig(ctx, org.ID))
+	require.ErrorIs(t, db.DeleteOrganizationSAMLConfig(ctx, org.ID), ErrOrganizationSAMLConfigNotFound)
+
+	// deleting the account deletes its federated identities
+	require.NoError(t, db.DeleteAccount(ctx, member.ID))
+	_, err = db.GetFederatedIdentity(ctx, org.ID, "member-name-id")
+	require.ErrorIs(t, err, ErrFederatedIdentityNotFound)
+}
+
+func TestMemoryDBVerifyingDropsFederatedIdentities(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	owner, err := db.CreateAccount(ctx, AccountCreationParams{Email: "owner@test.com", Verified: true})
+	require.NoError(t, err)
+	org, err := db.CreateOrganization(ctx, "Acme", owner.ID)
+	require.NoError(t, err)
+
+	// accounts an IdP signed in as before their email was verified
+	link := func(t *testing.T, email string) *Account {
+		account, err := db.CreateAccount(ctx, AccountCreationParams{Email: email})
+		require.NoError(t, err)
+		_, err = db.AddOrganizationMember(ctx, org.ID, account.ID, OrganizationRoleMember)
+		require.NoError(t, err)
+		_, err = db.CreateFederatedIdentity(ctx, CreateFederatedIdentityParams{AccountID: account.ID, OrganizationID: org.ID, Subject: email})
+		require.NoError(t, err)
+		return account
+	}
+	verified := link(t, "verified@test.com")
+	reset := link(t, "reset@test.com")
+
+	_, err = db.VerifyAccount(ctx, verified.ID)
+	require.NoError(t, err)
+	_, err = db.ResetPassword(ctx, reset.ID, "new-hash")
+	require.NoError(t, err)
+
+	for _, account := range []*Account{verified, reset} {
+		_, err = db.GetFederatedIdentity(ctx, org.ID, account.Email)
+		require.ErrorIs(t, err, ErrFederatedIdentityNotFound, account.Email)
+		_, err = db.GetOrganizationMember(ctx, org.ID, account.ID)
+		require.ErrorIs(t, err, ErrNotOrganizationMember, account.Email)
+	}
+
+	// links made once the email is verified stay
+	_, err = db.CreateFederatedIdentity(ctx, CreateFederatedIdentityParams{AccountID: owner.ID, OrganizationID: org.ID, Subject: "owner"})
+	require.NoError(t, err)
+	_, err = db.ResetPassword(ctx, owner.ID, "new-hash")
+	require.NoError(t, err)
+	_, err = db.GetFederatedIdentity(ctx, org.ID, "owner")
+	require.NoError(t, err)
+}
+
+func TestMemoryDBKnownDevices(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "test@test.com"})
+	require.NoError(t, err)
+
+	count, err := db.CountKnownDevices(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	params := TouchKnownDeviceParams{
+		AccountID:  account.ID,
+		DeviceHash: "laptop",
+		Location:   "NL",
+		IPAddress:  "203.0.113.7",
+		UserAgent:  "Firefox",
+		At:         time.Now().Add(time.Minute).Truncate(time.Second),
+	}
+	require.ErrorIs(t, db.TouchKnownDevice(ctx, params), ErrKnownDeviceNotFound)
+
+	device, err := db.CreateKnownDevice(ctx, CreateKnownDeviceParams{
+		AccountID:       account.ID,
+		DeviceHash:      "laptop",
+		Location:        "NL",
+		IPAddress:       "203.0.113.7",
+		UserAgent:       "Firefox",
+		SessionID:       "session-1",
+		RevokeTokenHash: "revoke-hash",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "session-1", device.SessionID)
+
+	// a racing login from the same device
+	_, err = db.CreateKnownDevice(ctx, CreateKnownDeviceParams{
+		AccountID:  account.ID,
+		DeviceHash: "laptop",
+		Location:   "NL",
+	})
+	require.ErrorIs(t, err, ErrKnownDeviceExists)
+
+	// the same device somewhere else is another one, without a revoke link
+	_, err = db.CreateKnownDevice(ctx, CreateKnownDeviceParams{
+		AccountID:  account.ID,
+		DeviceHash: "laptop",
+		Location:   "US",
+	})
+	require.NoError(t, err)
+	count, err = db.CountKnownDevices(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	params.IPAddress = "203.0.113.8"
+	require.NoError(t, db.TouchKnownDevice(ctx, params))
+
+	got, err := db.GetKnownDeviceByRevokeTokenHash(ctx, "revoke-hash")
+	require.NoError(t, err)
+	assert.Equal(t, device.ID, got.ID)
+	assert.Equal(t, "203.0.113.8", got.IPAddress)
+	assert.True(t, params.At.Equal(got.LastSeenAt))
+	_, err = db.GetKnownDeviceByRevokeTokenHash(ctx, "unknown-hash")
+	require.ErrorIs(t, err, ErrKnownDeviceNotFound)
+
+	require.NoError(t, db.DeleteKnownDevice(ctx, device.ID))
+	require.ErrorIs(t, db.DeleteKnownDevice(ctx, device.ID), ErrKnownDeviceNotFound)
+	_, err = db.GetKnownDeviceByRevokeTokenHash(ctx, "revoke-hash")
+	require.ErrorIs(t, err, ErrKnownDeviceNotFound)
+
+	// deleting the account deletes its known devices
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	count, err = db.CountKnownDevices(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestMemoryDBTrustedDevices(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "test@test.com"})
+	require.NoError(t, err)
+	other, err := db.CreateAccount(ctx, AccountCreationParams{Email: "other@test.com"})
+	require.NoError(t, err)
+
+	now := time.Now().Truncate(time.Second)
+	device, err := db.CreateTrustedDevice(ctx, CreateTrustedDeviceParams{
+		AccountID:  account.ID,
+		DeviceHash: "laptop",
+		IPAddress:  "203.0.113.7",
+		UserAgent:  "Firefox",
+		ExpiresAt:  now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "laptop", device.DeviceHash)
+	expired, err := db.CreateTrustedDevice(ctx, CreateTrustedDeviceParams{
+		AccountID:  account.ID,
+		DeviceHash: "phone",
+		ExpiresAt:  now.Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	use := UseTrustedDeviceParams{ID: device.ID, AccountID: account.ID, DeviceHash: "laptop", At: now.Add(time.Minute)}
+	require.NoError(t, db.UseTrustedDevice(ctx, use))
+
+	// another device, another account, or after it expired
+	require.ErrorIs(t, db.UseTrustedDevice(ctx, UseTrustedDeviceParams{ID: device.ID, AccountID: account.ID, DeviceHash: "phone", At: now}), ErrTrustedDeviceNotFound)
+	require.ErrorIs(t, db.UseTrustedDevice(ctx, UseTrustedDeviceParams{ID: device.ID, AccountID: other.ID, DeviceHash: "laptop", At: now}), ErrTrustedDeviceNotFound)
+	require.ErrorIs(t, db.UseTrustedDevice(ctx, UseTrustedDeviceParams{ID: device.ID, AccountID: account.ID, DeviceHash: "laptop", At: now.Add(time.Hour)}), ErrTrustedDeviceNotFound)
+
+	devices, err := db.ListTrustedDevices(ctx, account.ID, now)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, device.ID, devices[0].ID)
+	assert.True(t, use.At.Equal(devices[0].LastUsedAt))
+
+	require.ErrorIs(t, db.DeleteTrustedDevice(ctx, other.ID, device.ID), ErrTrustedDeviceNotFound)
+	require.NoError(t, db.DeleteTrustedDevice(ctx, account.ID, device.ID))
+	require.ErrorIs(t, db.DeleteTrustedDevice(ctx, account.ID, device.ID), ErrTrustedDeviceNotFound)
+
+	purged, err := db.PurgeExpiredTrustedDevices(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	require.ErrorIs(t, db.DeleteTrustedDevice(ctx, account.ID, expired.ID), ErrTrustedDeviceNotFound)
+
+	// freezing the account stops trusting its devices
+	_, err = db.CreateTrustedDevice(ctx, CreateTrustedDeviceParams{AccountID: account.ID, DeviceHash: "laptop", ExpiresAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	_, err = db.FreezeAccount(ctx, account.ID)
+	require.NoError(t, err)
+	deleted, err := db.DeleteTrustedDevices(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	_, err = db.CreateTrustedDevice(ctx, CreateTrustedDeviceParams{AccountID: other.ID, DeviceHash: "laptop", ExpiresAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	deleted, err = db.DeleteTrustedDevices(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
+
+func TestMemoryDBOutbox(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "outbox@test.com"})
+	require.NoError(t, err)
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "token", AccountID: account.ID}))
+	// refreshes continue the session
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{Token: "refreshed", AccountID: account.ID, SessionID: "session"}))
+	_, err = db.FreezeAccount(ctx, account.ID)
+	require.NoError(t, err)
+	// already frozen
+	_, err = db.FreezeAccount(ctx, account.ID)
+	require.NoError(t, err)
+
+	var types []string
+	n, err := db.RelayOutboxEvents(ctx, 10, func(ctx context.Context, events []OutboxEvent) error {
+		for _, e := range events {
+			types = append(types, e.EventType)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{OutboxEventAccountCreated, OutboxEventSessionStarted, OutboxEventAccountFrozen}, types)
+
+	n, err = db.RelayOutboxEvents(ctx, 10, func(ctx context.Context, events []OutboxEvent) error { return nil })
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	purged, err := db.PurgeOutboxEvents(ctx, time.Now().Add(time.Minute), false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+}
+
+func TestMemoryDBPurges(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+	now := time.Now()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "memorypurges@test.com",
+		PasswordHash: "hashed-password",
+	})
+	require.NoError(t, err)
+
+	for name, expiresAt := range map[string]time.Time{"active": now.Add(time.Hour), "expired": now.Add(-time.Hour)} {
+		require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+			Token:     "token-" + name,
+			AccountID: account.ID,
+			ExpiresAt: expiresAt,
+		}))
+		require.NoError(t, db.CreateEmailVerification(ctx, CreateEmailVerificationParams{
+			TokenHash: "verification-" + name,
+			AccountID: account.ID,
+			Email:     account.Email,
+			ExpiresAt: expiresAt,
+		}))
+		require.NoError(t, db.CreatePasswordResetToken(ctx, CreatePasswordResetTokenParams{
+			TokenHash: "reset-" + name,
+			AccountID: account.ID,
+			Email:     account.Email,
+			ExpiresAt: expiresAt,
+		}))
+	}
+
+	purged, err := db.PurgeExpiredRefreshTokens(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	_, err = db.GetRefreshToken(ctx, "token-expired")
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+	_, err = db.GetRefreshToken(ctx, "token-active")
+	require.NoError(t, err)
+
+	purged, err = db.PurgeExpiredEmailVerifications(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	_, err = db.GetEmailVerification(ctx, "verification-expired")
+	require.ErrorIs(t, err, ErrEmailVerificationNotFound)
+	_, err = db.GetEmailVerification(ctx, "verification-active")
+	require.NoError(t, err)
+
+	purged, err = db.PurgeExpiredPasswordResetTokens(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	_, err = db.GetPasswordResetToken(ctx, "reset-expired")
+	require.ErrorIs(t, err, ErrPasswordResetTokenNotFound)
+	_, err = db.GetPasswordResetToken(ctx, "reset-active")
+	require.NoError(t, err)
+
+	// nothing left to purge
+	purged, err = db.PurgeExpiredRefreshTokens(ctx, now)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	require.NoError(t, db.CreateAuditEvent(ctx, CreateAuditEventParams{AccountID: account.ID, EventType: AuditEventLogin}))
+	purged, err = db.PurgeAuditEvents(ctx, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = db.PurgeAuditEvents(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	events, err := db.ListAuditEvents(ctx, ListAuditEventsParams{AccountID: account.ID})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestMemoryDBDeletionRequests(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "erase@test.com", Username: "erase_me", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	request, err := db.CreateDeletionRequest(ctx, account.ID, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Nil(t, request.ReminderSentAt)
+	_, err = db.CreateDeletionRequest(ctx, account.ID, time.Now())
+	require.ErrorIs(t, err, ErrDeletionAlreadyRequested)
+	_, err = db.CreateDeletionRequest(ctx, "missing", time.Now())
+	require.ErrorIs(t, err, ErrAccountNotFound)
+
+	reminders, err := db.ListDeletionRemindersDue(ctx, time.Now().Add(2*time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, reminders, 1)
+	due, err := db.ListDueDeletionRequests(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+	require.NoError(t, db.MarkDeletionReminderSent(ctx, account.ID, time.Now()))
+	reminders, err = db.ListDeletionRemindersDue(ctx, time.Now().Add(2*time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, reminders)
+
+	_, err = db.CancelDeletionRequest(ctx, account.ID)
+	require.NoError(t, err)
+	_, err = db.CancelDeletionRequest(ctx, account.ID)
+	require.ErrorIs(t, err, ErrDeletionRequestNotFound)
+	require.ErrorIs(t, db.EraseAccount(ctx, account.ID), ErrDeletionRequestNotFound, "a cancelled request isn't carried out")
+	_, err = db.GetAccountByID(ctx, account.ID)
+	require.NoError(t, err)
+
+	// erasing keeps the account for its audit events, without where it was used from
+	_, err = db.CreateDeletionRequest(ctx, account.ID, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, db.CreateAuditEvent(ctx, CreateAuditEventParams{
+		AccountID: account.ID,
+		EventType: AuditEventLogin,
+		IPAddress: "203.0.113.7",
+		UserAgent: "Firefox",
+	}))
+	require.NoError(t, db.EraseAccount(ctx, account.ID))
+	require.ErrorIs(t, db.EraseAccount(ctx, account.ID), ErrDeletionRequestNotFound, "the request is gone once it's carried out")
+
+	_, err = db.GetAccountByID(ctx, account.ID)
+	require.ErrorIs(t, err, ErrAccountNotFound)
+	_, err = db.GetDeletionRequest(ctx, account.ID)
+	require.ErrorIs(t, err, ErrDeletionRequestNotFound)
+	_, err = db.CreateAccount(ctx, AccountCreationParams{Email: "erase@test.com", Username: "erase_me"})
+	require.NoError(t, err)
+
+	purged, err := db.PurgeDeletedAccounts(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+	events, err := db.ListAuditEvents(ctx, ListAuditEventsParams{AccountID: account.ID, Keyset: Keyset{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Empty(t, events[0].IPAddress)
+	assert.Empty(t, events[0].UserAgent)
+}
+
+func TestMemoryDBWithTx(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+
+	var account *Account
+	err := db.WithTx(ctx, func(tx Repository) error {
+		var err error
+		account, err = tx.CreateAccount(ctx, AccountCreationParams{
+			Email:        "committed@test.com",
+			PasswordHash: "hashed-password",
+		})
+		if err != nil {
+			return err
+		}
+		return tx.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+			Token:     "committed-token",
+			AccountID: account.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+	})
+	require.NoError(t, err)
+	_, err = db.GetAccount(ctx, "committed@test.com")
+	require.NoError(t, err)
+	_, err = db.GetRefreshToken(ctx, "committed-token")
+	require.NoError(t, err)
+
+	// everything fn did is undone, including what a nested WithTx did
+	errRollback := errors.New("rollback")
+	err = db.WithTx(ctx, func(tx Repository) error {
+		if _, err := tx.CreateAccount(ctx, AccountCreationParams{
+			Email:        "rolledback@test.com",
+			PasswordHash: "hashed-password",
+		}); err != nil {
+			return err
+		}
+		if err := tx.AssignRole(ctx, account.ID, RoleAdmin); err != nil {
+			return err
+		}
+		if err := tx.WithTx(ctx, func(tx Repository) error {
+			_, err := tx.RotateRefreshToken(ctx, "committed-token", time.Now())
+			return err
+		}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	_, err = db.GetAccount(ctx, "rolledback@test.com")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+	roles, err := db.GetAccountRoles(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+	token, err := db.GetRefreshToken(ctx, "committed-token")
+	require.NoError(t, err)
+	assert.Nil(t, token.RotatedAt)
+
+	// only the committed transaction's events are left in the outbox
+	var events []OutboxEvent
+	_, err = db.RelayOutboxEvents(ctx, 10, func(ctx context.Context, e []OutboxEvent) error {
+		events = e
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, OutboxEventAccountCreated, events[0].EventType)
+	assert.Equal(t, OutboxEventSessionStarted, events[1].EventType)
+	assert.Equal(t, account.ID, events[0].AccountID)
+}
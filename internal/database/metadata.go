@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// Metadata is a JSON object integrating applications keep on an account, stored as JSONB. The
+// values are kept as the JSON they were set to.
+type Metadata map[string]json.RawMessage
+
+func (m *Metadata) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("error scanning metadata: unexpected type %T", src)
+	}
+
+	result := Metadata{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("error scanning metadata: %w", err)
+	}
+	*m = result
+	return nil
+}
+
+// Apply returns a copy of the metadata with the keys in set set and the keys in unset removed
+func (m Metadata) Apply(set Metadata, unset []string) Metadata {
+	result := maps.Clone(m)
+	if result == nil {
+		result = Metadata{}
+	}
+	for _, key := range unset {
+		delete(result, key)
+	}
+	maps.Copy(result, set)
+	return result
+}
+
+// UpdateAccountMetadataParams are the changes to an account's metadata. The keys in the Set
+// objects replace the account's values, and the keys in the Unset lists are removed. The rest
+// are left as they are.
+type UpdateAccountMetadataParams struct {
+	SetUserMetadata   Metadata
+	UnsetUserMetadata []string
+	SetAppMetadata    Metadata
+	UnsetAppMetadata  []string
+}
+
+// UpdateAccountMetadata changes the account's user and app metadata
+func (d *DB) UpdateAccountMetadata(ctx context.Context, id string, params UpdateAccountMetadataParams) (*Account, error) {
+	ctx, span := startSpan(ctx, "UpdateAccountMetadata")
+	defer span.End()
+
+	setUser, setApp := params.SetUserMetadata, params.SetAppMetadata
+	if setUser == nil {
+		setUser = Metadata{}
+	}
+	if setApp == nil {
+		setApp = Metadata{}
+	}
+	unsetUser, unsetApp := params.UnsetUserMetadata, params.UnsetAppMetadata
+	if unsetUser == nil {
+		unsetUser = []string{}
+	}
+	if unsetApp == nil {
+		unsetApp = []string{}
+	}
+
+	setUserJSON, err := json.Marshal(setUser)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding user metadata: %w", err)
+	}
+	setAppJSON, err := json.Marshal(setApp)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding app metadata: %w", err)
+	}
+
+	var result Account
+	err = d.client.GetContext(ctx, &result, updateAccountMetadataSQL, id, string(setUserJSON), unsetUser, string(setAppJSON), unsetApp)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error updating account metadata: %w", err)
+	}
+	return &result, nil
+}
+
+var (
+	updateAccountMetadataSQL = `
+		UPDATE accounts
+		SET user_metadata = (user_metadata - $3::text[]) || $2::jsonb,
+			app_metadata = (app_metadata - $5::text[]) || $4::jsonb,
+			updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at;`
+)
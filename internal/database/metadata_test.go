@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateAccountMetadata(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "metadatatest@test.com"})
+	require.NoError(t, err)
+	assert.Empty(t, account.UserMetadata)
+	assert.Empty(t, account.AppMetadata)
+
+	updated, err := db.UpdateAccountMetadata(ctx, account.ID, UpdateAccountMetadataParams{
+		SetUserMetadata: Metadata{"theme": json.RawMessage(`"dark"`)},
+		SetAppMetadata:  Metadata{"plan": json.RawMessage(`"pro"`), "seats": json.RawMessage(`5`)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Metadata{"theme": json.RawMessage(`"dark"`)}, updated.UserMetadata)
+	assert.Equal(t, Metadata{"plan": json.RawMessage(`"pro"`), "seats": json.RawMessage(`5`)}, updated.AppMetadata)
+	assert.False(t, updated.UpdatedAt.Before(account.UpdatedAt))
+
+	// keys that aren't set or unset are left alone
+	again, err := db.UpdateAccountMetadata(ctx, account.ID, UpdateAccountMetadataParams{
+		SetUserMetadata:  Metadata{"address": json.RawMessage(`{"city": "London"}`)},
+		UnsetAppMetadata: []string{"seats"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, json.RawMessage(`"dark"`), again.UserMetadata["theme"])
+	assert.JSONEq(t, `{"city": "London"}`, string(again.UserMetadata["address"]))
+	assert.Equal(t, Metadata{"plan": json.RawMessage(`"pro"`)}, again.AppMetadata)
+
+	actual, err := db.GetAccountByID(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, again.UserMetadata, actual.UserMetadata)
+	assert.Equal(t, again.AppMetadata, actual.AppMetadata)
+
+	_, err = db.UpdateAccountMetadata(ctx, "00000000-0000-0000-0000-000000000000", UpdateAccountMetadataParams{UnsetUserMetadata: []string{"theme"}})
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrMFASecretNotFound = errors.New("MFA secret not found")
+	ErrMFAAlreadyEnabled = errors.New("MFA is already enabled")
+	ErrMFACodeUsed       = errors.New("MFA code was already used")
+
+	ErrMFARecoveryCodeNotFound = errors.New("MFA recovery code not found")
+)
+
+type MFASecret struct {
+	AccountID string `db:"account_id"`
+	Secret    string `db:"secret"`
+	// EnabledAt is nil until a code from the secret is verified
+	EnabledAt    *time.Time `db:"enabled_at"`
+	LastUsedStep int64      `db:"last_used_step"`
+	CreatedAt    time.Time  `db:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at"`
+}
+
+// SetMFASecret stores a pending TOTP secret for the account, replacing any earlier pending one.
+// It returns ErrMFAAlreadyEnabled instead of replacing an enabled secret.
+func (d *DB) SetMFASecret(ctx context.Context, accountID, secret string) error {
+	ctx, span := startSpan(ctx, "SetMFASecret")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, setMFASecretSQL, accountID, secret)
+	if err != nil {
+		return fmt.Errorf("error setting MFA secret: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error setting MFA secret: %w", err)
+	}
+	if n == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+func (d *DB) GetMFASecret(ctx context.Context, accountID string) (*MFASecret, error) {
+	ctx, span := startSpan(ctx, "GetMFASecret")
+	defer span.End()
+
+	var result MFASecret
+	err := d.client.GetContext(ctx, &result, getMFASecretSQL, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFASecretNotFound
+		}
+		return nil, fmt.Errorf("error getting MFA secret: %w", err)
+	}
+	return &result, nil
+}
+
+// EnableMFA enables the account's pending secret once a code from it (at step) is verified
+func (d *DB) EnableMFA(ctx context.Context, accountID string, step int64) (*MFASecret, error) {
+	ctx, span := startSpan(ctx, "EnableMFA")
+	defer span.End()
+
+	var result MFASecret
+	err := d.client.GetContext(ctx, &result, enableMFASQL, accountID, step)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFASecretNotFound
+		}
+		return nil, fmt.Errorf("error enabling MFA: %w", err)
+	}
+	return &result, nil
+}
+
+// UseMFAStep records that the code for step was used. It returns ErrMFACodeUsed when a code from
+// that step or a later one was already accepted, so every code works once.
+func (d *DB) UseMFAStep(ctx context.Context, accountID string, step int64) error {
+	ctx, span := startSpan(ctx, "UseMFAStep")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, useMFAStepSQL, accountID, step)
+	if err != nil {
+		return fmt.Errorf("error using MFA code: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error using MFA code: %w", err)
+	}
+	if n == 0 {
+		return ErrMFACodeUsed
+	}
+	return nil
+}
+
+// ReplaceMFARecoveryCodes replaces the account's recovery codes with the hashed codeHashes, so
+// the codes it had before stop working
+func (d *DB) ReplaceMFARecoveryCodes(ctx context.Context, accountID string, codeHashes []string) error {
+	ctx, span := startSpan(ctx, "ReplaceMFARecoveryCodes")
+	defer span.End()
+
+	return d.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, deleteMFARecoveryCodesSQL, accountID); err != nil {
+			return fmt.Errorf("error deleting MFA recovery codes: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, createMFARecoveryCodesSQL, accountID, codeHashes); err != nil {
+			return fmt.Errorf("error creating MFA recovery codes: %w", err)
+		}
+		return nil
+	})
+}
+
+// UseMFARecoveryCode burns one of the account's recovery codes. It returns
+// ErrMFARecoveryCodeNotFound if the account has no such code, including one that was used.
+func (d *DB) UseMFARecoveryCode(ctx context.Context, accountID, codeHash string) error {
+	ctx, span := startSpan(ctx, "UseMFARecoveryCode")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, useMFARecoveryCodeSQL, accountID, codeHash)
+	if err != nil {
+		return fmt.Errorf("error using MFA recovery code: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error using MFA recovery code: %w", err)
+	}
+	if n == 0 {
+		return ErrMFARecoveryCodeNotFound
+	}
+	return nil
+}
+
+// CountMFARecoveryCodes returns how many unused recovery codes the account has
+func (d *DB) CountMFARecoveryCodes(ctx context.Context, accountID string) (int, error) {
+	ctx, span := startSpan(ctx, "CountMFARecoveryCodes")
+	defer span.End()
+
+	var count int
+	if err := d.client.GetContext(ctx, &count, countMFARecoveryCodesSQL, accountID); err != nil {
+		return 0, fmt.Errorf("error counting MFA recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+var (
+	setMFASecretSQL = `
+		INSERT INTO mfa_secrets (account_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (account_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW(), updated_at = NOW()
+		WHERE mfa_secrets.enabled_at IS NULL;`
+
+	getMFASecretSQL = `
+		SELECT account_id, secret, enabled_at, last_used_step, created_at, updated_at
+		FROM mfa_secrets
+		WHERE account_id = $1;`
+
+	enableMFASQL = `
+		UPDATE mfa_secrets
+		SET enabled_at = NOW(), last_used_step = $2, updated_at = NOW()
+		WHERE account_id = $1 AND enabled_at IS NULL
+		RETURNING account_id, secret, enabled_at, last_used_step, created_at, updated_at;`
+
+	useMFAStepSQL = `
+		UPDATE mfa_secrets
+		SET last_used_step = $2, updated_at = NOW()
+		WHERE account_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2;`
+
+	deleteMFARecoveryCodesSQL = `
+		DELETE FROM mfa_recovery_codes WHERE account_id = $1;`
+
+	createMFARecoveryCodesSQL = `
+		INSERT INTO mfa_recovery_codes (account_id, code_hash)
+		SELECT $1, UNNEST($2::text[]);`
+
+	useMFARecoveryCodeSQL = `
+		DELETE FROM mfa_recovery_codes WHERE account_id = $1 AND code_hash = $2;`
+
+	countMFARecoveryCodesSQL = `
+		SELECT COUNT(*) FROM mfa_recovery_codes WHERE account_id = $1;`
+)
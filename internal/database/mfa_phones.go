@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrMFAPhoneNotFound        = errors.New("MFA phone not found")
+	ErrMFAPhoneAlreadyVerified = errors.New("MFA phone is already verified")
+	// ErrMFAPhoneCodeThrottled is a code sent again before the last one can be replaced
+	ErrMFAPhoneCodeThrottled = errors.New("MFA phone code was sent too recently")
+	// ErrMFAPhoneCodeInvalid is a code that's wrong, expired, or already used
+	ErrMFAPhoneCodeInvalid = errors.New("MFA phone code is invalid")
+)
+
+// MFAPhone is a phone number an account gets one-time codes on as a second factor
+type MFAPhone struct {
+	AccountID   string `db:"account_id"`
+	PhoneNumber string `db:"phone_number"`
+	// VerifiedAt is nil until a code sent to the number is entered
+	VerifiedAt *time.Time `db:"verified_at"`
+	// CodeHash is the hash of the last code sent until it's used or replaced
+	CodeHash      *string    `db:"code_hash"`
+	CodeExpiresAt *time.Time `db:"code_expires_at"`
+	CodeSentAt    *time.Time `db:"code_sent_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"`
+}
+
+type SetMFAPhoneCodeParams struct {
+	AccountID string
+	CodeHash  string
+	SentAt    time.Time
+	ExpiresAt time.Time
+	// LastSentBefore throttles resends: the code is only replaced when the last one was sent
+	// before it
+	LastSentBefore time.Time
+}
+
+// SetMFAPhone stores a pending phone number for the account, replacing any earlier pending one
+// and its code. It returns ErrMFAPhoneAlreadyVerified instead of replacing a verified number.
+func (d *DB) SetMFAPhone(ctx context.Context, accountID, phoneNumber string) error {
+	ctx, span := startSpan(ctx, "SetMFAPhone")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, setMFAPhoneSQL, accountID, phoneNumber)
+	if err != nil {
+		return fmt.Errorf("error setting MFA phone: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error setting MFA phone: %w", err)
+	}
+	if n == 0 {
+		return ErrMFAPhoneAlreadyVerified
+	}
+	return nil
+}
+
+func (d *DB) GetMFAPhone(ctx context.Context, accountID string) (*MFAPhone, error) {
+	ctx, span := startSpan(ctx, "GetMFAPhone")
+	defer span.End()
+
+	var result MFAPhone
+	err := d.client.GetContext(ctx, &result, getMFAPhoneSQL, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFAPhoneNotFound
+		}
+		return nil, fmt.Errorf("error getting MFA phone: %w", err)
+	}
+	return &result, nil
+}
+
+// VerifyMFAPhone marks the account's pending phone number verified, once a code sent to it was
+// entered. It returns ErrMFAPhoneNotFound if there's no pending number.
+func (d *DB) VerifyMFAPhone(ctx context.Context, accountID string) (*MFAPhone, error) {
+	ctx, span := startSpan(ctx, "VerifyMFAPhone")
+	defer span.End()
+
+	var result MFAPhone
+	err := d.client.GetContext(ctx, &result, verifyMFAPhoneSQL, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFAPhoneNotFound
+		}
+		return nil, fmt.Errorf("error verifying MFA phone: %w", err)
+	}
+	return &result, nil
+}
+
+// SetMFAPhoneCode replaces the code sent to the account's phone number. It returns
+// ErrMFAPhoneCodeThrottled when the last code was sent after params.LastSentBefore, or the
+// account has no phone number.
+func (d *DB) SetMFAPhoneCode(ctx context.Context, params SetMFAPhoneCodeParams) error {
+	ctx, span := startSpan(ctx, "SetMFAPhoneCode")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, setMFAPhoneCodeSQL,
+		params.AccountID, params.CodeHash, params.SentAt, params.ExpiresAt, params.LastSentBefore)
+	if err != nil {
+		return fmt.Errorf("error setting MFA phone code: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error setting MFA phone code: %w", err)
+	}
+	if n == 0 {
+		return ErrMFAPhoneCodeThrottled
+	}
+	return nil
+}
+
+// UseMFAPhoneCode burns the code sent to the account's phone number if codeHash matches it and
+// it hasn't expired at now. It returns ErrMFAPhoneCodeInvalid otherwise, so every code works
+// once.
+func (d *DB) UseMFAPhoneCode(ctx context.Context, accountID, codeHash string, now time.Time) error {
+	ctx, span := startSpan(ctx, "UseMFAPhoneCode")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, useMFAPhoneCodeSQL, accountID, codeHash, now)
+	if err != nil {
+		return fmt.Errorf("error using MFA phone code: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error using MFA phone code: %w", err)
+	}
+	if n == 0 {
+		return ErrMFAPhoneCodeInvalid
+	}
+	return nil
+}
+
+const mfaPhoneColumns = `account_id, phone_number, verified_at, code_hash, code_expires_at, code_sent_at, created_at, updated_at`
+
+var (
+	// the last code's sent time is kept so a new number doesn't skip the resend throttle
+	setMFAPhoneSQL = `
+		INSERT INTO mfa_phones (account_id, phone_number)
+		VALUES ($1, $2)
+		ON CONFLICT (account_id) DO UPDATE
+		SET phone_number = EXCLUDED.phone_number, code_hash = NULL, code_expires_at = NULL,
+			created_at = NOW(), updated_at = NOW()
+		WHERE mfa_phones.verified_at IS NULL;`
+
+	getMFAPhoneSQL = `
+		SELECT ` + mfaPhoneColumns + `
+		FROM mfa_phones
+		WHERE account_id = $1;`
+
+	verifyMFAPhoneSQL = `
+		UPDATE mfa_phones
+		SET verified_at = NOW(), updated_at = NOW()
+		WHERE account_id = $1 AND verified_at IS NULL
+		RETURNING ` + mfaPhoneColumns + `;`
+
+	setMFAPhoneCodeSQL = `
+		UPDATE mfa_phones
+		SET code_hash = $2, code_sent_at = $3, code_expires_at = $4, updated_at = NOW()
+		WHERE account_id = $1 AND (code_sent_at IS NULL OR code_sent_at <= $5);`
+
+	useMFAPhoneCodeSQL = `
+		UPDATE mfa_phones
+		SET code_hash = NULL, code_expires_at = NULL, updated_at = NOW()
+		WHERE account_id = $1 AND code_hash = $2 AND code_expires_at > $3;`
+)
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFAPhones(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "mfaphone@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	_, err = db.GetMFAPhone(ctx, account.ID)
+	require.ErrorIs(t, err, ErrMFAPhoneNotFound)
+	require.ErrorIs(t, db.SetMFAPhoneCode(ctx, SetMFAPhoneCodeParams{AccountID: account.ID, CodeHash: "hash"}), ErrMFAPhoneCodeThrottled, "no phone to send to")
+
+	require.NoError(t, db.SetMFAPhone(ctx, account.ID, "+14155550100"))
+	require.NoError(t, db.SetMFAPhone(ctx, account.ID, "+14155550123"), "pending numbers are replaced")
+
+	phone, err := db.GetMFAPhone(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "+14155550123", phone.PhoneNumber)
+	assert.Nil(t, phone.VerifiedAt)
+
+	now := time.Now()
+	send := func(hash string, sentAt time.Time) error {
+		return db.SetMFAPhoneCode(ctx, SetMFAPhoneCodeParams{
+			AccountID:      account.ID,
+			CodeHash:       hash,
+			SentAt:         sentAt,
+			ExpiresAt:      sentAt.Add(5 * time.Minute),
+			LastSentBefore: sentAt.Add(-time.Minute),
+		})
+	}
+	require.NoError(t, send("hash-1", now))
+	require.ErrorIs(t, send("hash-2", now.Add(30*time.Second)), ErrMFAPhoneCodeThrottled)
+	require.ErrorIs(t, db.UseMFAPhoneCode(ctx, account.ID, "hash-2", now), ErrMFAPhoneCodeInvalid)
+
+	// a new number doesn't skip the throttle
+	require.NoError(t, db.SetMFAPhone(ctx, account.ID, "+14155550123"))
+	require.ErrorIs(t, send("hash-2", now.Add(30*time.Second)), ErrMFAPhoneCodeThrottled)
+	require.ErrorIs(t, db.UseMFAPhoneCode(ctx, account.ID, "hash-1", now), ErrMFAPhoneCodeInvalid, "a new number forgets the code")
+
+	require.NoError(t, send("hash-2", now.Add(time.Minute)))
+	require.ErrorIs(t, db.UseMFAPhoneCode(ctx, account.ID, "hash-2", now.Add(10*time.Minute)), ErrMFAPhoneCodeInvalid, "expired")
+	require.NoError(t, db.UseMFAPhoneCode(ctx, account.ID, "hash-2", now.Add(2*time.Minute)))
+	require.ErrorIs(t, db.UseMFAPhoneCode(ctx, account.ID, "hash-2", now.Add(2*time.Minute)), ErrMFAPhoneCodeInvalid, "codes work once")
+
+	verified, err := db.VerifyMFAPhone(ctx, account.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, verified.VerifiedAt)
+	_, err = db.VerifyMFAPhone(ctx, account.ID)
+	require.ErrorIs(t, err, ErrMFAPhoneNotFound)
+	require.ErrorIs(t, db.SetMFAPhone(ctx, account.ID, "+14155550199"), ErrMFAPhoneAlreadyVerified)
+
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	_, err = db.GetMFAPhone(ctx, account.ID)
+	require.ErrorIs(t, err, ErrMFAPhoneNotFound)
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFASecrets(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "mfatest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	_, err = db.GetMFASecret(ctx, testAccount.ID)
+	require.ErrorIs(t, err, ErrMFASecretNotFound)
+
+	err = db.SetMFASecret(ctx, testAccount.ID, "FIRSTSECRET")
+	require.NoError(t, err)
+	err = db.SetMFASecret(ctx, testAccount.ID, "SECONDSECRET")
+	require.NoError(t, err)
+
+	secret, err := db.GetMFASecret(ctx, testAccount.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "SECONDSECRET", secret.Secret)
+	assert.Nil(t, secret.EnabledAt)
+
+	enabled, err := db.EnableMFA(ctx, testAccount.ID, 10)
+	require.NoError(t, err)
+	assert.NotNil(t, enabled.EnabledAt)
+	assert.Equal(t, int64(10), enabled.LastUsedStep)
+
+	_, err = db.EnableMFA(ctx, testAccount.ID, 11)
+	require.ErrorIs(t, err, ErrMFASecretNotFound)
+
+	err = db.SetMFASecret(ctx, testAccount.ID, "THIRDSECRET")
+	require.ErrorIs(t, err, ErrMFAAlreadyEnabled)
+
+	err = db.UseMFAStep(ctx, testAccount.ID, 10)
+	require.ErrorIs(t, err, ErrMFACodeUsed)
+	err = db.UseMFAStep(ctx, testAccount.ID, 11)
+	require.NoError(t, err)
+	err = db.UseMFAStep(ctx, testAccount.ID, 11)
+	require.ErrorIs(t, err, ErrMFACodeUsed)
+}
+
+func TestMFARecoveryCodes(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "recoverycodes@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	err = db.ReplaceMFARecoveryCodes(ctx, testAccount.ID, []string{"hash-1", "hash-2", "hash-3"})
+	require.NoError(t, err)
+
+	count, err := db.CountMFARecoveryCodes(ctx, testAccount.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	err = db.UseMFARecoveryCode(ctx, testAccount.ID, "hash-2")
+	require.NoError(t, err)
+	err = db.UseMFARecoveryCode(ctx, testAccount.ID, "hash-2")
+	require.ErrorIs(t, err, ErrMFARecoveryCodeNotFound)
+
+	count, err = db.CountMFARecoveryCodes(ctx, testAccount.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	err = db.ReplaceMFARecoveryCodes(ctx, testAccount.ID, []string{"hash-1", "hash-4"})
+	require.NoError(t, err)
+	err = db.UseMFARecoveryCode(ctx, testAccount.ID, "hash-3")
+	require.ErrorIs(t, err, ErrMFARecoveryCodeNotFound)
+
+	count, err = db.CountMFARecoveryCodes(ctx, testAccount.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	err = db.DeleteAccount(ctx, testAccount.ID)
+	require.NoError(t, err)
+	count, err = db.CountMFARecoveryCodes(ctx, testAccount.ID)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
@@ -0,0 +1 @@
+ALTER TABLE accounts ADD COLUMN preferred_locale VARCHAR(35) NOT NULL DEFAULT 'en';
@@ -0,0 +1,13 @@
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- nullable and SET NULL so the audit trail survives account deletion
+    account_id UUID REFERENCES accounts(id) ON DELETE SET NULL,
+    event_type VARCHAR(64) NOT NULL,
+    actor_id UUID,
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    request_id VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_events_account_id_created_at ON audit_events(account_id, created_at DESC, id DESC);
@@ -0,0 +1,14 @@
+CREATE TABLE account_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    -- external identity provider, e.g. 'apple'
+    provider VARCHAR(64) NOT NULL,
+    -- the provider's stable user ID ("sub" claim)
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    name VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT account_identities_provider_subject_key UNIQUE (provider, subject)
+);
+
+CREATE INDEX idx_account_identities_account_id ON account_identities(account_id);
@@ -0,0 +1,17 @@
+-- pending email changes. The change only takes effect once both the old and the new
+-- address confirm it, and the old address can cancel it.
+CREATE TABLE email_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    new_email VARCHAR(255) NOT NULL,
+    -- only SHA-256 hashes of the emailed tokens are stored
+    old_token_hash VARCHAR(64) NOT NULL UNIQUE,
+    new_token_hash VARCHAR(64) NOT NULL UNIQUE,
+    cancel_token_hash VARCHAR(64) NOT NULL UNIQUE,
+    old_confirmed_at TIMESTAMPTZ,
+    new_confirmed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- one pending change per account, a new request replaces the old one
+    CONSTRAINT email_changes_account_id_key UNIQUE (account_id)
+);
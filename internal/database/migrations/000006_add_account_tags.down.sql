@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS accounts_tags_idx;
+ALTER TABLE accounts DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,4 @@
+-- free-form labels set by admins, e.g. "beta" or "enterprise"
+ALTER TABLE accounts ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX accounts_tags_idx ON accounts USING GIN (tags);
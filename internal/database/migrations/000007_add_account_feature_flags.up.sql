@@ -0,0 +1,2 @@
+-- per-account overrides of the deployment's default feature flags, e.g. {"new-dashboard": true}
+ALTER TABLE accounts ADD COLUMN feature_flags JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+-- set when a refresh token is exchanged with rotation enabled. Rotated tokens are only
+-- accepted for a short grace period afterwards.
+ALTER TABLE refresh_tokens ADD COLUMN rotated_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS account_freeze_tokens;
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS frozen_at;
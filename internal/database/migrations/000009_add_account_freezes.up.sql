@@ -0,0 +1,14 @@
+-- a frozen account can't log in until it's unfrozen with a link emailed to it
+ALTER TABLE accounts ADD COLUMN frozen_at TIMESTAMPTZ;
+
+-- emailed freeze and unfreeze links
+CREATE TABLE account_freeze_tokens (
+    -- only SHA-256 hashes of the emailed tokens are stored
+    token_hash VARCHAR(64) PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    purpose VARCHAR(16) NOT NULL CHECK (purpose IN ('freeze', 'unfreeze')),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX account_freeze_tokens_account_id_idx ON account_freeze_tokens (account_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS email_verifications;
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS verified_at;
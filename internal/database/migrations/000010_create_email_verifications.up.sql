@@ -0,0 +1,18 @@
+-- accounts can't log in with a password until their email is verified
+ALTER TABLE accounts ADD COLUMN verified_at TIMESTAMPTZ;
+
+-- accounts from before verification existed keep working
+UPDATE accounts SET verified_at = created_at;
+
+-- emailed verification links
+CREATE TABLE email_verifications (
+    -- only SHA-256 hashes of the emailed tokens are stored
+    token_hash VARCHAR(64) PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    -- the address the link was sent to, so a link doesn't verify an address changed since
+    email VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX email_verifications_account_id_idx ON email_verifications (account_id);
@@ -0,0 +1,12 @@
+-- emailed password reset links. They're single use: resetting deletes every link of the account.
+CREATE TABLE password_reset_tokens (
+    -- only SHA-256 hashes of the emailed tokens are stored
+    token_hash VARCHAR(64) PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    -- the address the link was sent to, so a link doesn't work after the email changes
+    email VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX password_reset_tokens_account_id_idx ON password_reset_tokens (account_id);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS accounts_deleted_at_idx;
+
+-- emails are only unique again without the deleted accounts
+DELETE FROM accounts WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS accounts_email_key;
+ALTER TABLE accounts ADD CONSTRAINT accounts_email_key UNIQUE (email);
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS deleted_at;
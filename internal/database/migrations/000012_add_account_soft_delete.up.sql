@@ -0,0 +1,8 @@
+-- deleted accounts are kept until the retention period ends, then purged
+ALTER TABLE accounts ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- a deleted account's email can be registered again
+ALTER TABLE accounts DROP CONSTRAINT accounts_email_key;
+CREATE UNIQUE INDEX accounts_email_key ON accounts (email) WHERE deleted_at IS NULL;
+
+CREATE INDEX accounts_deleted_at_idx ON accounts (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,11 @@
+-- TOTP secrets. A secret is pending until a code from it is verified, which enables MFA.
+CREATE TABLE mfa_secrets (
+    account_id UUID PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    -- base32 TOTP secret. It has to be readable to check codes, so it can't be hashed.
+    secret VARCHAR(64) NOT NULL,
+    enabled_at TIMESTAMPTZ,
+    -- the time step of the last accepted code, so a code can't be used twice
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
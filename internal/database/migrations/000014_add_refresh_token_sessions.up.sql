@@ -0,0 +1,8 @@
+-- refresh tokens issued by refreshing keep the session of the token they replace, so a
+-- session is every token since a login. Existing tokens each become their own session.
+ALTER TABLE refresh_tokens ADD COLUMN session_id UUID NOT NULL DEFAULT gen_random_uuid();
+-- the client the token was issued to, shown when listing sessions
+ALTER TABLE refresh_tokens ADD COLUMN ip_address VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens(session_id);
@@ -0,0 +1,8 @@
+-- access tokens revoked before they expire, by their jti. Rows are only needed until the
+-- token expires and are cleaned up on the next revocation after that.
+CREATE TABLE revoked_access_tokens (
+    token_id VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_revoked_access_tokens_expires_at ON revoked_access_tokens(expires_at);
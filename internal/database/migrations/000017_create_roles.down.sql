@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS account_roles;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,26 @@
+-- roles grant accounts access to the service's own endpoints, unlike organization roles which
+-- are per organization
+CREATE TABLE roles (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- what each role is allowed to do
+CREATE TABLE permissions (
+    role_name VARCHAR(64) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    name VARCHAR(128) NOT NULL,
+    PRIMARY KEY (role_name, name)
+);
+
+CREATE TABLE account_roles (
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    role_name VARCHAR(64) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (account_id, role_name)
+);
+
+CREATE INDEX idx_account_roles_role_name ON account_roles(role_name);
+
+INSERT INTO roles (name, description) VALUES ('admin', 'Manages accounts through the admin endpoints');
+INSERT INTO permissions (role_name, name) VALUES ('admin', 'accounts:read'), ('admin', 'accounts:write');
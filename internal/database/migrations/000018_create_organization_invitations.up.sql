@@ -0,0 +1,12 @@
+-- emailed invitations to join an organization, the link's token is only stored hashed
+CREATE TABLE organization_invitations (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    -- the role the invited account gets, 'admin' or 'member'
+    role VARCHAR(32) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_organization_invitations_organization_id ON organization_invitations(organization_id);
@@ -0,0 +1,2 @@
+-- for listing every account's events newest first
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at DESC, id DESC);
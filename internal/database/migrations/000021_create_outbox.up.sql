@@ -0,0 +1,16 @@
+-- account and token changes written in the same statement as the change itself, so an event is
+-- published if and only if the change was committed
+CREATE TABLE outbox (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- the order events are published in
+    sequence BIGINT GENERATED ALWAYS AS IDENTITY,
+    event_type VARCHAR(64) NOT NULL,
+    -- no foreign key, events outlive purged accounts
+    account_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_outbox_unpublished ON outbox(sequence) WHERE published_at IS NULL;
+CREATE INDEX idx_outbox_created_at ON outbox(created_at);
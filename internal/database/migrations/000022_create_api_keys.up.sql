@@ -0,0 +1,17 @@
+-- long-lived keys accounts issue for machine-to-machine access. Only the prefix is kept in the
+-- clear, so a key can be told apart in listings; the whole key is stored as its SHA-256.
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    -- what the key is allowed to do, e.g. 'account:read'
+    scopes TEXT[] NOT NULL,
+    -- NULL keys don't expire
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_keys_account_id_created_at ON api_keys(account_id, created_at DESC);
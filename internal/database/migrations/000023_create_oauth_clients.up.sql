@@ -0,0 +1,30 @@
+-- applications registered to get tokens from the OAuth 2.0 endpoints. The client ID is the id.
+CREATE TABLE oauth_clients (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    -- SHA-256 of the client secret. NULL for public clients, which can't keep one.
+    secret_hash VARCHAR(64),
+    -- where authorization codes may be sent, matched exactly
+    redirect_uris TEXT[] NOT NULL,
+    -- 'client_credentials' and/or 'authorization_code'
+    grant_types TEXT[] NOT NULL,
+    -- the most the client can be granted
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- codes an account approved a client for, traded for an access token once. Expired codes are
+-- cleaned up when the next one is created.
+CREATE TABLE oauth_authorization_codes (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    -- PKCE (RFC 7636). Only S256 is supported.
+    code_challenge VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_oauth_authorization_codes_expires_at ON oauth_authorization_codes(expires_at);
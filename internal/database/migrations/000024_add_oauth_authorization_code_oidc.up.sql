@@ -0,0 +1,4 @@
+-- OpenID Connect: the nonce the client sent with the authorization request, echoed in the ID
+-- token, and when the account authenticated, its auth_time claim
+ALTER TABLE oauth_authorization_codes ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
+ALTER TABLE oauth_authorization_codes ADD COLUMN auth_time TIMESTAMPTZ NOT NULL DEFAULT NOW();
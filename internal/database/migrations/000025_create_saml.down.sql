@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS federated_identities;
+DROP TABLE IF EXISTS organization_saml_configs;
@@ -0,0 +1,22 @@
+-- the SAML identity provider each organization signs its members in with
+CREATE TABLE organization_saml_configs (
+    organization_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    idp_entity_id TEXT NOT NULL,
+    -- the IdP's metadata XML, with its SSO URL and signing certificates
+    idp_metadata TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- accounts signed in through an organization's IdP, by the NameID the IdP sent
+CREATE TABLE federated_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT federated_identities_organization_id_subject_key UNIQUE (organization_id, subject)
+);
+
+CREATE INDEX idx_federated_identities_account_id ON federated_identities(account_id);
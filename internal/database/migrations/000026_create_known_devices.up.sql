@@ -0,0 +1,18 @@
+-- devices and coarse locations accounts have logged in from, so a login from a new one can be
+-- told to the account's owner
+CREATE TABLE known_devices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    -- a hash of the user agent without version numbers
+    device_hash TEXT NOT NULL,
+    -- e.g. a country code, empty when it isn't known
+    location TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    -- the session the new sign-in email's revoke link logs out
+    session_id TEXT NOT NULL,
+    revoke_token_hash TEXT UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT known_devices_account_id_device_hash_location_key UNIQUE (account_id, device_hash, location)
+);
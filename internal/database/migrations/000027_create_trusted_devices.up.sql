@@ -0,0 +1,15 @@
+-- devices accounts completed MFA on and chose to trust, so logins from them skip the MFA
+-- challenge until they expire
+CREATE TABLE trusted_devices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    -- a hash of the user agent without version numbers
+    device_hash TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX trusted_devices_account_id_idx ON trusted_devices (account_id);
@@ -0,0 +1,7 @@
+-- single-use codes that complete the MFA login step in place of a TOTP code, stored hashed
+CREATE TABLE mfa_recovery_codes (
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (account_id, code_hash)
+);
@@ -0,0 +1,13 @@
+-- phone numbers accounts get one-time codes on by text message or voice call, as a second
+-- factor, and the last code sent to each
+CREATE TABLE mfa_phones (
+    account_id UUID PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    -- E.164, e.g. +14155550123
+    phone_number TEXT NOT NULL,
+    verified_at TIMESTAMPTZ,
+    code_hash TEXT,
+    code_expires_at TIMESTAMPTZ,
+    code_sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+-- more about events that need it, e.g. which settings a config reload changed
+ALTER TABLE audit_events ADD COLUMN details TEXT;
@@ -0,0 +1,5 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE accounts DROP COLUMN IF EXISTS timezone;
+ALTER TABLE accounts DROP COLUMN IF EXISTS family_name;
+ALTER TABLE accounts DROP COLUMN IF EXISTS given_name;
+ALTER TABLE accounts DROP COLUMN IF EXISTS display_name;
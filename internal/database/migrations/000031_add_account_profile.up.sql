@@ -0,0 +1,7 @@
+-- optional profile the account fills in itself, empty until it does
+ALTER TABLE accounts ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN given_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN family_name TEXT NOT NULL DEFAULT '';
+-- IANA time zone, e.g. Europe/Berlin
+ALTER TABLE accounts ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
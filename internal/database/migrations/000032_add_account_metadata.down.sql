@@ -0,0 +1,2 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS app_metadata;
+ALTER TABLE accounts DROP COLUMN IF EXISTS user_metadata;
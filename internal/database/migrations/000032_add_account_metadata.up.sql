@@ -0,0 +1,4 @@
+-- JSON objects integrating applications keep on the account. The account can change its
+-- user_metadata, app_metadata only changes through the internal and admin APIs.
+ALTER TABLE accounts ADD COLUMN user_metadata JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE accounts ADD COLUMN app_metadata JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS accounts_username_key;
+ALTER TABLE accounts DROP COLUMN IF EXISTS username;
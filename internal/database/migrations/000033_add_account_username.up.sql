@@ -0,0 +1,4 @@
+-- optional name to log in with besides the email, empty until the account picks one. Usernames
+-- are unique regardless of case, and a deleted account's username can be taken again.
+ALTER TABLE accounts ADD COLUMN username TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX accounts_username_key ON accounts (lower(username)) WHERE username <> '' AND deleted_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS erased_at;
+DROP TABLE IF EXISTS account_deletion_requests;
@@ -0,0 +1,13 @@
+-- accounts that asked to be erased, once the grace period is over. Logging in again before then
+-- cancels the request.
+CREATE TABLE account_deletion_requests (
+    account_id UUID PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    erase_at TIMESTAMPTZ NOT NULL,
+    reminder_sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX account_deletion_requests_erase_at_idx ON account_deletion_requests (erase_at);
+
+-- erased accounts are anonymized rather than purged so their audit events keep pointing at them
+ALTER TABLE accounts ADD COLUMN erased_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+-- scopes the session's access tokens are restricted to, empty doesn't restrict them
+ALTER TABLE refresh_tokens ADD COLUMN scopes TEXT[] NOT NULL DEFAULT '{}';
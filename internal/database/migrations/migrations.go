@@ -0,0 +1,267 @@
+// Package migrations has the database schema as numbered SQL migrations embedded in the binary.
+//
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql like golang-migrate's,
+// and the applied version is kept in its schema_migrations table, so databases migrated with the
+// migrate CLI keep working and either can apply the next migration.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// lockID is the advisory lock held while migrating so replicas starting together don't race
+const lockID = 7_311_000
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one step of the schema
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// All returns the embedded migrations in version order
+func All() ([]Migration, error) {
+	return parse(files)
+}
+
+func parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("error reading migrations: %s isn't named <version>_<name>.up|down.sql", entry.Name())
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error reading migrations: %s: %w", entry.Name(), err)
+		}
+
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migrations: %w", err)
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("error reading migrations: version %d is both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("error reading migrations: version %d needs both an up and a down file", m.Version)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// Migrator applies migrations to a Postgres database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New returns a migrator for the embedded migrations
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Version returns the version the database is at, 0 before any migration. A dirty version is one
+// the migrate CLI failed partway through; it has to be fixed by hand.
+func (m *Migrator) Version(ctx context.Context) (uint, bool, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("error connecting to database: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, createVersionTableSQL); err != nil {
+		return 0, false, fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+	return version(ctx, conn)
+}
+
+// Latest returns the version the newest migration leaves the database at
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every migration the database doesn't have yet and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn, current uint) error {
+		for _, migration := range m.migrations {
+			if migration.Version <= current {
+				continue
+			}
+			if err := apply(ctx, conn, migration.Up, migration.Version); err != nil {
+				return fmt.Errorf("error applying migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts up to steps migrations, newest first, and returns how many were reverted
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.locked(ctx, func(conn *sql.Conn, current uint) error {
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if migration.Version > current {
+				continue
+			}
+
+			var previous uint
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			if err := apply(ctx, conn, migration.Down, previous); err != nil {
+				return fmt.Errorf("error reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// locked runs fn on one connection holding the migration lock, with the version the database is at
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, current uint) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, lockSQL, lockID); err != nil {
+		return fmt.Errorf("error locking migrations: %w", err)
+	}
+	// the session ends with the connection anyway, this just hands it back to the pool clean
+	defer func() { _, _ = conn.ExecContext(context.WithoutCancel(ctx), unlockSQL, lockID) }()
+
+	if _, err := conn.ExecContext(ctx, createVersionTableSQL); err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	current, dirty, err := version(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("database is dirty at version %d: fix the schema by hand, then set schema_migrations.dirty to false", current)
+	}
+	if current > 0 && !m.known(current) && current < m.migrations[len(m.migrations)-1].Version {
+		return fmt.Errorf("database is at version %d, which isn't one of the migrations", current)
+	}
+
+	return fn(conn, current)
+}
+
+func (m *Migrator) known(version uint) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func version(ctx context.Context, conn *sql.Conn) (uint, bool, error) {
+	var v int64
+	var dirty bool
+	err := conn.QueryRowContext(ctx, getVersionSQL).Scan(&v, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	return uint(v), dirty, nil
+}
+
+// apply runs a migration and records the version it leaves the database at in one transaction,
+// so a failed migration leaves nothing behind
+func apply(ctx context.Context, conn *sql.Conn, statements string, version uint) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, clearVersionSQL); err != nil {
+		return fmt.Errorf("error updating schema_migrations: %w", err)
+	}
+	if version > 0 {
+		if _, err := tx.ExecContext(ctx, setVersionSQL, int64(version)); err != nil {
+			return fmt.Errorf("error updating schema_migrations: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+var (
+	lockSQL   = `SELECT pg_advisory_lock($1);`
+	unlockSQL = `SELECT pg_advisory_unlock($1);`
+
+	// the same table golang-migrate uses
+	createVersionTableSQL = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT NOT NULL PRIMARY KEY,
+			dirty BOOLEAN NOT NULL
+		);`
+
+	getVersionSQL = `
+		SELECT version, dirty FROM schema_migrations LIMIT 1;`
+
+	clearVersionSQL = `
+		DELETE FROM schema_migrations;`
+
+	setVersionSQL = `
+		INSERT INTO schema_migrations (version, dirty) VALUES ($1, false);`
+)
@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAll(t *testing.T) {
+	migrations, err := All()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	// versions go up one at a time so a missing file stands out
+	for i, m := range migrations {
+		assert.Equal(t, uint(i+1), m.Version, m.Name)
+		assert.NotEmpty(t, m.Up, m.Name)
+		assert.NotEmpty(t, m.Down, m.Name)
+	}
+}
+
+func TestParse(t *testing.T) {
+	file := func(contents string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(contents)} }
+
+	tests := []struct {
+		name        string
+		files       fstest.MapFS
+		expected    []Migration
+		expectedErr string
+	}{
+		{
+			name: "sorted by version",
+			files: fstest.MapFS{
+				"000010_add_tags.up.sql":      file("up 10"),
+				"000010_add_tags.down.sql":    file("down 10"),
+				"000002_init_schema.up.sql":   file("up 2"),
+				"000002_init_schema.down.sql": file("down 2"),
+			},
+			expected: []Migration{
+				{Version: 2, Name: "init_schema", Up: "up 2", Down: "down 2"},
+				{Version: 10, Name: "add_tags", Up: "up 10", Down: "down 10"},
+			},
+		},
+		{
+			name: "missing down",
+			files: fstest.MapFS{
+				"000001_init_schema.up.sql": file("up"),
+			},
+			expectedErr: "needs both an up and a down file",
+		},
+		{
+			name: "two names for one version",
+			files: fstest.MapFS{
+				"000001_init_schema.up.sql": file("up"),
+				"000001_other.down.sql":     file("down"),
+			},
+			expectedErr: "is both",
+		},
+		{
+			name: "badly named",
+			files: fstest.MapFS{
+				"init_schema.sql": file("up"),
+			},
+			expectedErr: "isn't named",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := parse(tt.files)
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, migrations)
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrOAuthClientNotFound            = errors.New("oauth client not found")
+	ErrOAuthAuthorizationCodeNotFound = errors.New("oauth authorization code not found")
+)
+
+// OAuthClient is an application registered to get tokens from the OAuth 2.0 endpoints. Its ID
+// is the client ID.
+type OAuthClient struct {
+	ID   string `db:"id"`
+	Name string `db:"name"`
+	// SecretHash is nil for public clients, which authenticate with PKCE alone
+	SecretHash   *string     `db:"secret_hash"`
+	RedirectURIs StringArray `db:"redirect_uris"`
+	GrantTypes   StringArray `db:"grant_types"`
+	Scopes       StringArray `db:"scopes"`
+	CreatedAt    time.Time   `db:"created_at"`
+}
+
+type CreateOAuthClientParams struct {
+	Name string
+	// SecretHash is optional, empty registers a public client
+	SecretHash   string
+	RedirectURIs []string
+	GrantTypes   []string
+	Scopes       []string
+}
+
+// OAuthAuthorizationCode is an account's approval of a client, waiting to be traded for an
+// access token
+type OAuthAuthorizationCode struct {
+	CodeHash      string      `db:"code_hash"`
+	ClientID      string      `db:"client_id"`
+	AccountID     string      `db:"account_id"`
+	RedirectURI   string      `db:"redirect_uri"`
+	Scopes        StringArray `db:"scopes"`
+	CodeChallenge string      `db:"code_challenge"`
+	// Nonce and AuthTime go into the OpenID Connect ID token
+	Nonce     string    `db:"nonce"`
+	AuthTime  time.Time `db:"auth_time"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type CreateOAuthAuthorizationCodeParams struct {
+	CodeHash      string
+	ClientID      string
+	AccountID     string
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	// Nonce is optional
+	Nonce     string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+}
+
+func (d *DB) CreateOAuthClient(ctx context.Context, params CreateOAuthClientParams) (*OAuthClient, error) {
+	ctx, span := startSpan(ctx, "CreateOAuthClient")
+	defer span.End()
+
+	var result OAuthClient
+	err := d.client.GetContext(ctx, &result, createOAuthClientSQL, params.Name, nullString(params.SecretHash),
+		nonNilStrings(params.RedirectURIs), nonNilStrings(params.GrantTypes), nonNilStrings(params.Scopes))
+	if err != nil {
+		return nil, fmt.Errorf("error creating oauth client: %w", err)
+	}
+	return &result, nil
+}
+
+func (d *DB) GetOAuthClient(ctx context.Context, id string) (*OAuthClient, error) {
+	ctx, span := startSpan(ctx, "GetOAuthClient")
+	defer span.End()
+
+	var result OAuthClient
+	err := d.client.GetContext(ctx, &result, getOAuthClientSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOAuthClientNotFound
+		}
+		return nil, fmt.Errorf("error getting oauth client: %w", err)
+	}
+	return &result, nil
+}
+
+// ListOAuthClients returns every registered client, newest first
+func (d *DB) ListOAuthClients(ctx context.Context) ([]OAuthClient, error) {
+	ctx, span := startSpan(ctx, "ListOAuthClients")
+	defer span.End()
+
+	var result []OAuthClient
+	if err := d.reader().SelectContext(ctx, &result, listOAuthClientsSQL); err != nil {
+		return nil, fmt.Errorf("error listing oauth clients: %w", err)
+	}
+	return result, nil
+}
+
+// DeleteOAuthClient removes the client along with its unused authorization codes. Access tokens
+// already issued to it stay valid until they expire.
+func (d *DB) DeleteOAuthClient(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "DeleteOAuthClient")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, deleteOAuthClientSQL, id)
+	if err != nil {
+		return fmt.Errorf("error deleting oauth client: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+// CreateOAuthAuthorizationCode stores a code and cleans up any that expired unused
+func (d *DB) CreateOAuthAuthorizationCode(ctx context.Context, params CreateOAuthAuthorizationCodeParams) error {
+	ctx, span := startSpan(ctx, "CreateOAuthAuthorizationCode")
+	defer span.End()
+
+	_, err := d.client.ExecContext(ctx, createOAuthAuthorizationCodeSQL, params.CodeHash, params.ClientID,
+		params.AccountID, params.RedirectURI, nonNilStrings(params.Scopes), params.CodeChallenge, params.Nonce, params.AuthTime,
+		params.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating oauth authorization code: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOAuthAuthorizationCode deletes and returns the code so it can only be used once. It
+// returns ErrOAuthAuthorizationCodeNotFound for unknown, used, or expired codes.
+func (d *DB) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (*OAuthAuthorizationCode, error) {
+	ctx, span := startSpan(ctx, "ConsumeOAuthAuthorizationCode")
+	defer span.End()
+
+	var result OAuthAuthorizationCode
+	err := d.client.GetContext(ctx, &result, consumeOAuthAuthorizationCodeSQL, codeHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOAuthAuthorizationCodeNotFound
+		}
+		return nil, fmt.Errorf("error consuming oauth authorization code: %w", err)
+	}
+	return &result, nil
+}
+
+// nonNilStrings keeps NOT NULL array columns from being written as NULL
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+const (
+	oauthClientColumns = `id, name, secret_hash, redirect_uris, grant_types, scopes, created_at`
+
+	oauthAuthorizationCodeColumns = `code_hash, client_id, account_id, redirect_uri, scopes, code_challenge, nonce, auth_time,
+		expires_at, created_at`
+)
+
+var (
+	createOAuthClientSQL = `
+		INSERT INTO oauth_clients (name, secret_hash, redirect_uris, grant_types, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + oauthClientColumns + `;`
+
+	getOAuthClientSQL = `
+		SELECT ` + oauthClientColumns + `
+		FROM oauth_clients
+		WHERE id = $1;`
+
+	listOAuthClientsSQL = `
+		SELECT ` + oauthClientColumns + `
+		FROM oauth_clients
+		ORDER BY created_at DESC, id DESC;`
+
+	deleteOAuthClientSQL = `
+		DELETE FROM oauth_clients WHERE id = $1;`
+
+	createOAuthAuthorizationCodeSQL = `
+		WITH expired AS (
+			DELETE FROM oauth_authorization_codes WHERE expires_at <= NOW()
+		)
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, account_id, redirect_uri, scopes, code_challenge, nonce, auth_time, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`
+
+	consumeOAuthAuthorizationCodeSQL = `
+		DELETE FROM oauth_authorization_codes
+		WHERE code_hash = $1 AND expires_at > NOW()
+		RETURNING ` + oauthAuthorizationCodeColumns + `;`
+)
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuth(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "oauthtest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	confidential, err := db.CreateOAuthClient(ctx, CreateOAuthClientParams{
+		Name:         "reporting",
+		SecretHash:   "secret-hash",
+		RedirectURIs: []string{"https://reporting.example.com/callback"},
+		GrantTypes:   []string{"client_credentials", "authorization_code"},
+		Scopes:       []string{"account:read"},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, confidential.SecretHash)
+	assert.Equal(t, "secret-hash", *confidential.SecretHash)
+	assert.Equal(t, StringArray{"client_credentials", "authorization_code"}, confidential.GrantTypes)
+
+	public, err := db.CreateOAuthClient(ctx, CreateOAuthClientParams{
+		Name:         "mobile",
+		RedirectURIs: []string{"com.example.app:/callback"},
+		GrantTypes:   []string{"authorization_code"},
+		Scopes:       []string{"account:read"},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, public.SecretHash)
+
+	got, err := db.GetOAuthClient(ctx, confidential.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "reporting", got.Name)
+	_, err = db.GetOAuthClient(ctx, "00000000-0000-0000-0000-000000000000")
+	require.ErrorIs(t, err, ErrOAuthClientNotFound)
+
+	clients, err := db.ListOAuthClients(ctx)
+	require.NoError(t, err)
+	require.Len(t, clients, 2)
+	assert.Equal(t, public.ID, clients[0].ID)
+
+	authTime := time.Now().Add(-time.Minute)
+	codeParams := CreateOAuthAuthorizationCodeParams{
+		CodeHash:      "code-hash",
+		ClientID:      public.ID,
+		AccountID:     testAccount.ID,
+		RedirectURI:   "com.example.app:/callback",
+		Scopes:        []string{"account:read"},
+		CodeChallenge: "challenge",
+		Nonce:         "nonce",
+		AuthTime:      authTime,
+		ExpiresAt:     time.Now().Add(10 * time.Minute),
+	}
+	require.NoError(t, db.CreateOAuthAuthorizationCode(ctx, codeParams))
+
+	code, err := db.ConsumeOAuthAuthorizationCode(ctx, "code-hash")
+	require.NoError(t, err)
+	assert.Equal(t, public.ID, code.ClientID)
+	assert.Equal(t, testAccount.ID, code.AccountID)
+	assert.Equal(t, StringArray{"account:read"}, code.Scopes)
+	assert.Equal(t, "nonce", code.Nonce)
+	assert.WithinDuration(t, authTime, code.AuthTime, time.Millisecond)
+	assert.Equal(t, "challenge", code.CodeChallenge)
+	// codes are single use
+	_, err = db.ConsumeOAuthAuthorizationCode(ctx, "code-hash")
+	require.ErrorIs(t, err, ErrOAuthAuthorizationCodeNotFound)
+
+	expired := codeParams
+	expired.CodeHash = "expired-hash"
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	require.NoError(t, db.CreateOAuthAuthorizationCode(ctx, expired))
+	_, err = db.ConsumeOAuthAuthorizationCode(ctx, "expired-hash")
+	require.ErrorIs(t, err, ErrOAuthAuthorizationCodeNotFound)
+
+	// deleting the client deletes its codes
+	codeParams.CodeHash = "deleted-client-hash"
+	require.NoError(t, db.CreateOAuthAuthorizationCode(ctx, codeParams))
+	require.NoError(t, db.DeleteOAuthClient(ctx, public.ID))
+	require.ErrorIs(t, db.DeleteOAuthClient(ctx, public.ID), ErrOAuthClientNotFound)
+	_, err = db.ConsumeOAuthAuthorizationCode(ctx, "deleted-client-hash")
+	require.ErrorIs(t, err, ErrOAuthAuthorizationCodeNotFound)
+
+	// and deleting the account deletes the codes it approved
+	codeParams.CodeHash = "deleted-account-hash"
+	codeParams.ClientID = confidential.ID
+	require.NoError(t, db.CreateOAuthAuthorizationCode(ctx, codeParams))
+	require.NoError(t, db.DeleteAccount(ctx, testAccount.ID))
+	_, err = db.ConsumeOAuthAuthorizationCode(ctx, "deleted-account-hash")
+	require.ErrorIs(t, err, ErrOAuthAuthorizationCodeNotFound)
+}
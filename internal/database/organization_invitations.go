@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrOrganizationInvitationNotFound = errors.New("organization invitation not found")
+
+// OrganizationInvitation is an emailed invitation to join an organization
+type OrganizationInvitation struct {
+	TokenHash      string `db:"token_hash"`
+	OrganizationID string `db:"organization_id"`
+	// Email is the address the invitation was sent to
+	Email string `db:"email"`
+	// Role is the role the invited account gets
+	Role      string    `db:"role"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type CreateOrganizationInvitationParams struct {
+	TokenHash      string    `db:"token_hash"`
+	OrganizationID string    `db:"organization_id"`
+	Email          string    `db:"email"`
+	Role           string    `db:"role"`
+	ExpiresAt      time.Time `db:"expires_at"`
+}
+
+func (d *DB) CreateOrganizationInvitation(ctx context.Context, params CreateOrganizationInvitationParams) error {
+	ctx, span := startSpan(ctx, "CreateOrganizationInvitation")
+	defer span.End()
+
+	_, err := d.client.NamedExecContext(ctx, createOrganizationInvitationSQL, params)
+	if err != nil {
+		return fmt.Errorf("error creating organization invitation: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetOrganizationInvitation(ctx context.Context, tokenHash string) (*OrganizationInvitation, error) {
+	ctx, span := startSpan(ctx, "GetOrganizationInvitation")
+	defer span.End()
+
+	var result OrganizationInvitation
+	err := d.client.GetContext(ctx, &result, getOrganizationInvitationSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationInvitationNotFound
+		}
+		return nil, fmt.Errorf("error getting organization invitation: %w", err)
+	}
+	return &result, nil
+}
+
+// AcceptOrganizationInvitation uses up the invitation, making the account a member of its
+// organization with its role. An account that's already a member keeps the role it has.
+func (d *DB) AcceptOrganizationInvitation(ctx context.Context, tokenHash, accountID string) (*OrganizationMember, error) {
+	ctx, span := startSpan(ctx, "AcceptOrganizationInvitation")
+	defer span.End()
+
+	var result OrganizationMember
+	err := d.client.GetContext(ctx, &result, acceptOrganizationInvitationSQL, tokenHash, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationInvitationNotFound
+		}
+		return nil, fmt.Errorf("error accepting organization invitation: %w", err)
+	}
+	return &result, nil
+}
+
+var (
+	createOrganizationInvitationSQL = `
+		INSERT INTO organization_invitations (token_hash, organization_id, email, role, expires_at)
+		VALUES (:token_hash, :organization_id, :email, :role, :expires_at);`
+
+	getOrganizationInvitationSQL = `
+		SELECT token_hash, organization_id, email, role, expires_at, created_at
+		FROM organization_invitations
+		WHERE token_hash = $1;`
+
+	// the statement's snapshot doesn't see the row added inserts, so an existing membership is
+	// only returned by the second half
+	acceptOrganizationInvitationSQL = `
+		WITH invitation AS (
+			DELETE FROM organization_invitations WHERE token_hash = $1
+			RETURNING organization_id, role
+		), added AS (
+			INSERT INTO organization_members (organization_id, account_id, role)
+			SELECT organization_id, $2, role FROM invitation
+			ON CONFLICT (organization_id, account_id) DO NOTHING
+			RETURNING organization_id, account_id, role, created_at
+		)
+		SELECT organization_id, account_id, role, created_at FROM added
+		UNION ALL
+		SELECT m.organization_id, m.account_id, m.role, m.created_at
+		FROM organization_members m
+		JOIN invitation i ON i.organization_id = m.organization_id
+		WHERE m.account_id = $2;`
+)
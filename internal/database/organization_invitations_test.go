@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizationInvitations(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	owner, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "inviteowner@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+	invited, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "invited@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	org, err := db.CreateOrganization(ctx, "Acme", owner.ID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = db.pool.Exec("DELETE FROM organizations WHERE id = $1", org.ID)
+	})
+
+	invite := func(tokenHash, email string) {
+		require.NoError(t, db.CreateOrganizationInvitation(ctx, CreateOrganizationInvitationParams{
+			TokenHash:      tokenHash,
+			OrganizationID: org.ID,
+			Email:          email,
+			Role:           OrganizationRoleAdmin,
+			ExpiresAt:      time.Now().Add(time.Hour),
+		}))
+	}
+
+	invite("test-invitation-hash", invited.Email)
+	invitation, err := db.GetOrganizationInvitation(ctx, "test-invitation-hash")
+	require.NoError(t, err)
+	assert.Equal(t, org.ID, invitation.OrganizationID)
+	assert.Equal(t, OrganizationRoleAdmin, invitation.Role)
+
+	member, err := db.AcceptOrganizationInvitation(ctx, "test-invitation-hash", invited.ID)
+	require.NoError(t, err)
+	assert.Equal(t, invited.ID, member.AccountID)
+	assert.Equal(t, OrganizationRoleAdmin, member.Role)
+
+	_, err = db.GetOrganizationInvitation(ctx, "test-invitation-hash")
+	require.ErrorIs(t, err, ErrOrganizationInvitationNotFound)
+	_, err = db.AcceptOrganizationInvitation(ctx, "test-invitation-hash", invited.ID)
+	require.ErrorIs(t, err, ErrOrganizationInvitationNotFound)
+
+	// an existing member keeps their role
+	invite("test-owner-invitation-hash", owner.Email)
+	member, err = db.AcceptOrganizationInvitation(ctx, "test-owner-invitation-hash", owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleOwner, member.Role)
+}
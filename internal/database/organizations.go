@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Roles an account can have in an organization
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+// Organization is a tenant that accounts belong to as members
+type Organization struct {
+	ID        string    `db:"id"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// OrganizationMember is an account's membership of an organization
+type OrganizationMember struct {
+	OrganizationID string    `db:"organization_id"`
+	AccountID      string    `db:"account_id"`
+	Role           string    `db:"role"`
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+var (
+	ErrOrganizationNotFound  = errors.New("organization not found")
+	ErrNotOrganizationMember = errors.New("account is not a member of the organization")
+)
+
+// CreateOrganization creates an organization with the account as its owner
+func (d *DB) CreateOrganization(ctx context.Context, name, ownerID string) (*Organization, error) {
+	ctx, span := startSpan(ctx, "CreateOrganization")
+	defer span.End()
+
+	var result Organization
+	err := d.client.GetContext(ctx, &result, createOrganizationSQL, name, ownerID, OrganizationRoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("error creating organization: %w", err)
+	}
+	return &result, nil
+}
+
+func (d *DB) GetOrganization(ctx context.Context, id string) (*Organization, error) {
+	ctx, span := startSpan(ctx, "GetOrganization")
+	defer span.End()
+
+	var result Organization
+	err := d.client.GetContext(ctx, &result, getOrganizationSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("error getting organization: %w", err)
+	}
+	return &result, nil
+}
+
+// ListAccountOrganizations returns the organizations the account is a member of, oldest first
+func (d *DB) ListAccountOrganizations(ctx context.Context, accountID string) ([]Organization, error) {
+	ctx, span := startSpan(ctx, "ListAccountOrganizations")
+	defer span.End()
+
+	result := []Organization{}
+	err := d.client.SelectContext(ctx, &result, listAccountOrganizationsSQL, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing account organizations: %w", err)
+	}
+	return result, nil
+}
+
+// GetOrganizationMember returns the account's membership of the organization, or
+// ErrNotOrganizationMember if it isn't a member (or the organization doesn't exist)
+func (d *DB) GetOrganizationMember(ctx context.Context, organizationID, accountID string) (*OrganizationMember, error) {
+	ctx, span := startSpan(ctx, "GetOrganizationMember")
+	defer span.End()
+
+	var result OrganizationMember
+	err := d.client.GetContext(ctx, &result, getOrganizationMemberSQL, organizationID, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotOrganizationMember
+		}
+		return nil, fmt.Errorf("error getting organization member: %w", err)
+	}
+	return &result, nil
+}
+
+// AddOrganizationMember adds the account to the organization with the role. An account that's
+// already a member keeps the role it has, and that membership is returned.
+func (d *DB) AddOrganizationMember(ctx context.Context, organizationID, accountID, role string) (*OrganizationMember, error) {
+	ctx, span := startSpan(ctx, "AddOrganizationMember")
+	defer span.End()
+
+	var result OrganizationMember
+	err := d.client.GetContext(ctx, &result, addOrganizationMemberSQL, organizationID, accountID, role)
+	if err != nil {
+		return nil, fmt.Errorf("error adding organization member: %w", err)
+	}
+	return &result, nil
+}
+
+var (
+	createOrganizationSQL = `
+		WITH organization AS (
+			INSERT INTO organizations (name)
+			VALUES ($1)
+			RETURNING id, name, created_at, updated_at
+		), owner AS (
+			INSERT INTO organization_members (organization_id, account_id, role)
+			SELECT id, $2, $3 FROM organization
+		)
+		SELECT id, name, created_at, updated_at FROM organization;`
+
+	getOrganizationSQL = `
+		SELECT id, name, created_at, updated_at
+		FROM organizations WHERE id = $1;`
+
+	listAccountOrganizationsSQL = `
+		SELECT o.id, o.name, o.created_at, o.updated_at
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.account_id = $1
+		ORDER BY o.created_at, o.id;`
+
+	getOrganizationMemberSQL = `
+		SELECT organization_id, account_id, role, created_at
+		FROM organization_members WHERE organization_id = $1 AND account_id = $2;`
+
+	// like acceptOrganizationInvitationSQL, an existing membership is only returned by the
+	// second half
+	addOrganizationMemberSQL = `
+		WITH added AS (
+			INSERT INTO organization_members (organization_id, account_id, role)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (organization_id, account_id) DO NOTHING
+			RETURNING organization_id, account_id, role, created_at
+		)
+		SELECT organization_id, account_id, role, created_at FROM added
+		UNION ALL
+		SELECT organization_id, account_id, role, created_at
+		FROM organization_members WHERE organization_id = $1 AND account_id = $2;`
+)
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizations(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	owner, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "orgowner@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+	other, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "orgother@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	org, err := db.CreateOrganization(ctx, "Acme", owner.ID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = db.pool.Exec("DELETE FROM organizations WHERE id = $1", org.ID)
+	})
+	assert.NotEmpty(t, org.ID)
+	assert.Equal(t, "Acme", org.Name)
+
+	got, err := db.GetOrganization(ctx, org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, org.ID, got.ID)
+
+	member, err := db.GetOrganizationMember(ctx, org.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleOwner, member.Role)
+
+	_, err = db.GetOrganizationMember(ctx, org.ID, other.ID)
+	require.ErrorIs(t, err, ErrNotOrganizationMember)
+
+	orgs, err := db.ListAccountOrganizations(ctx, owner.ID)
+	require.NoError(t, err)
+	require.Len(t, orgs, 1)
+	assert.Equal(t, org.ID, orgs[0].ID)
+	orgs, err = db.ListAccountOrganizations(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Empty(t, orgs)
+
+	_, err = db.GetOrganization(ctx, uuid.NewString())
+	require.ErrorIs(t, err, ErrOrganizationNotFound)
+}
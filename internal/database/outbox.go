@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Outbox event types. They're written in the same statement as the change they describe, so
+// downstream systems see an event if and only if the change was committed. These are part of the
+// event contract so keep them stable.
+const (
+	OutboxEventAccountCreated         = "account.created"
+	OutboxEventAccountVerified        = "account.verified"
+	OutboxEventAccountPasswordChanged = "account.password_changed"
+	OutboxEventAccountEmailChanged    = "account.email_changed"
+	OutboxEventAccountFrozen          = "account.frozen"
+	OutboxEventAccountUnfrozen        = "account.unfrozen"
+	OutboxEventAccountDeleted         = "account.deleted"
+	OutboxEventAccountPurged          = "account.purged"
+	OutboxEventAccountErased          = "account.erased"
+	// OutboxEventSessionStarted is a login, not a refresh
+	OutboxEventSessionStarted = "session.started"
+	// OutboxEventSessionsRevoked is every session of the account ending at once
+	OutboxEventSessionsRevoked = "sessions.revoked"
+)
+
+// outboxRelayLock is the advisory lock held while relaying so only one replica publishes at a
+// time and events go out in order
+const outboxRelayLock = 7_311_001
+
+// OutboxEvent is a change waiting to be, or already, published to the message broker
+type OutboxEvent struct {
+	ID        string `db:"id"`
+	Sequence  int64  `db:"sequence"`
+	EventType string `db:"event_type"`
+	AccountID string `db:"account_id"`
+	// Payload is a JSON object with the account_id and what else the event type needs
+	Payload     string     `db:"payload"`
+	CreatedAt   time.Time  `db:"created_at"`
+	PublishedAt *time.Time `db:"published_at"`
+}
+
+// RelayOutboxEvents hands up to limit of the oldest unpublished events to publish, in order, and
+// marks them published if it returns nil. Nothing is marked when it errors so they're handed
+// over again next time, which means events can be published more than once. It returns how many
+// events were published; 0 when there were none or another replica is relaying.
+func (d *DB) RelayOutboxEvents(ctx context.Context, limit int, publish func(ctx context.Context, events []OutboxEvent) error) (int, error) {
+	ctx, span := startSpan(ctx, "RelayOutboxEvents")
+	defer span.End()
+
+	var relayed int
+	err := d.inTx(ctx, func(tx *sqlx.Tx) error {
+		var locked bool
+		if err := tx.GetContext(ctx, &locked, lockOutboxRelaySQL, outboxRelayLock); err != nil {
+			return fmt.Errorf("error locking outbox: %w", err)
+		}
+		if !locked {
+			return nil
+		}
+
+		var events []OutboxEvent
+		if err := tx.SelectContext(ctx, &events, listUnpublishedOutboxEventsSQL, limit); err != nil {
+			return fmt.Errorf("error listing outbox events: %w", err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		if err := publish(ctx, events); err != nil {
+			return err
+		}
+
+		ids := make([]string, len(events))
+		for i, e := range events {
+			ids[i] = e.ID
+		}
+		if _, err := tx.ExecContext(ctx, markOutboxEventsPublishedSQL, ids); err != nil {
+			return fmt.Errorf("error marking outbox events published: %w", err)
+		}
+		relayed = len(events)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return relayed, nil
+}
+
+// PurgeOutboxEvents deletes published events created before the cutoff and returns how many
+// were deleted. With unpublished it deletes the ones that weren't published too, for when
+// nothing is relaying them.
+func (d *DB) PurgeOutboxEvents(ctx context.Context, createdBefore time.Time, unpublished bool) (int64, error) {
+	ctx, span := startSpan(ctx, "PurgeOutboxEvents")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, purgeOutboxEventsSQL, createdBefore, unpublished)
+	if err != nil {
+		return 0, fmt.Errorf("error purging outbox events: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error purging outbox events: %w", err)
+	}
+	return n, nil
+}
+
+// insertAccountOutboxEventSQL adds an account event to the outbox for every row of source, a CTE
+// returning the accounts' id and email. Use it as a CTE of the statement making the change.
+func insertAccountOutboxEventSQL(eventType, source string) string {
+	return `
+			INSERT INTO outbox (event_type, account_id, payload)
+			SELECT '` + eventType + `', id, jsonb_build_object('account_id', id, 'email', email)
+			FROM ` + source
+}
+
+var (
+	lockOutboxRelaySQL = `
+		SELECT pg_try_advisory_xact_lock($1);`
+
+	listUnpublishedOutboxEventsSQL = `
+		SELECT id, sequence, event_type, account_id, payload::text AS payload, created_at, published_at
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY sequence
+		LIMIT $1;`
+
+	markOutboxEventsPublishedSQL = `
+		UPDATE outbox SET published_at = NOW()
+		WHERE id = ANY($1::uuid[]);`
+
+	purgeOutboxEventsSQL = `
+		DELETE FROM outbox
+		WHERE created_at < $1 AND (published_at IS NOT NULL OR $2);`
+)
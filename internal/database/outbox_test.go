@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	// publish whatever earlier tests left behind
+	for {
+		n, err := db.RelayOutboxEvents(ctx, 1000, func(ctx context.Context, events []OutboxEvent) error { return nil })
+		require.NoError(t, err)
+		if n == 0 {
+			break
+		}
+	}
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "outbox@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+	_, err = db.VerifyAccount(ctx, account.ID)
+	require.NoError(t, err)
+	// already verified, so no event
+	_, err = db.VerifyAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+
+	// failed publishes leave the events for next time
+	_, err = db.RelayOutboxEvents(ctx, 10, func(ctx context.Context, events []OutboxEvent) error {
+		return errors.New("broker unavailable")
+	})
+	require.Error(t, err)
+
+	var published []OutboxEvent
+	n, err := db.RelayOutboxEvents(ctx, 10, func(ctx context.Context, events []OutboxEvent) error {
+		published = events
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	var types []string
+	for _, e := range published {
+		assert.Equal(t, account.ID, e.AccountID)
+		types = append(types, e.EventType)
+	}
+	assert.Equal(t, []string{OutboxEventAccountCreated, OutboxEventAccountVerified, OutboxEventAccountDeleted}, types)
+	assert.JSONEq(t, `{"account_id":"`+account.ID+`","email":"outbox@test.com"}`, published[0].Payload)
+
+	n, err = db.RelayOutboxEvents(ctx, 10, func(ctx context.Context, events []OutboxEvent) error { return nil })
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	purged, err := db.PurgeOutboxEvents(ctx, time.Now().Add(time.Minute), false)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, int64(3))
+}
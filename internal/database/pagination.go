@@ -0,0 +1,55 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// Keyset pages through rows newest first, ordered by created_at then id. The first page leaves
+// Before unset, the next one sets it to the CreatedAt and ID of the last row of the previous
+// page. Unlike OFFSET, pages stay consistent while rows are added and deep pages are as cheap
+// as the first with an index on (created_at, id).
+type Keyset struct {
+	BeforeCreatedAt time.Time
+	BeforeID        string
+	// Limit is the most rows returned, 0 for all of them
+	Limit int
+}
+
+// args are the query parameters for a "($1::timestamptz IS NULL OR (created_at, id) < ($1,
+// $2::uuid))" condition, NULL on the first page, and "LIMIT $3", NULL for no limit
+func (k Keyset) args() (*time.Time, *string, *int) {
+	var limit *int
+	if k.Limit > 0 {
+		limit = &k.Limit
+	}
+	return nullTime(k.BeforeCreatedAt), nullString(k.BeforeID), limit
+}
+
+// includes reports whether a row with createdAt and id belongs after the cursor
+func (k Keyset) includes(createdAt time.Time, id string) bool {
+	return k.BeforeCreatedAt.IsZero() || keysetBefore(createdAt, id, k.BeforeCreatedAt, k.BeforeID)
+}
+
+// keysetBefore reports whether (createdAt, id) sorts before (beforeCreatedAt, beforeID)
+func keysetBefore(createdAt time.Time, id string, beforeCreatedAt time.Time, beforeID string) bool {
+	if createdAt.Equal(beforeCreatedAt) {
+		return id < beforeID
+	}
+	return createdAt.Before(beforeCreatedAt)
+}
+
+// page sorts rows newest first and cuts them to the keyset's limit, for MemoryDB to match
+// ORDER BY created_at DESC, id DESC LIMIT n. key returns a row's created_at and id.
+func page[T any](rows []T, k Keyset, key func(T) (time.Time, string)) []T {
+	sort.Slice(rows, func(i, j int) bool {
+		iCreatedAt, iID := key(rows[i])
+		jCreatedAt, jID := key(rows[j])
+		return keysetBefore(jCreatedAt, jID, iCreatedAt, iID)
+	})
+
+	if k.Limit > 0 && len(rows) > k.Limit {
+		rows = rows[:k.Limit]
+	}
+	return rows
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrPasswordResetTokenNotFound = errors.New("password reset token not found")
+
+type PasswordResetToken struct {
+	TokenHash string `db:"token_hash"`
+	AccountID string `db:"account_id"`
+	// Email is the address the link was sent to
+	Email     string    `db:"email"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type CreatePasswordResetTokenParams struct {
+	TokenHash string    `db:"token_hash"`
+	AccountID string    `db:"account_id"`
+	Email     string    `db:"email"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+func (d *DB) CreatePasswordResetToken(ctx context.Context, params CreatePasswordResetTokenParams) error {
+	ctx, span := startSpan(ctx, "CreatePasswordResetToken")
+	defer span.End()
+
+	_, err := d.client.NamedExecContext(ctx, createPasswordResetTokenSQL, params)
+	if err != nil {
+		return fmt.Errorf("error creating password reset token: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetPasswordResetToken(ctx context.Context, tokenHash string) (*PasswordResetToken, error) {
+	ctx, span := startSpan(ctx, "GetPasswordResetToken")
+	defer span.End()
+
+	var result PasswordResetToken
+	err := d.client.GetContext(ctx, &result, getPasswordResetTokenSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPasswordResetTokenNotFound
+		}
+		return nil, fmt.Errorf("error getting password reset token: %w", err)
+	}
+	return &result, nil
+}
+
+// ResetPassword replaces the account's password and deletes its refresh tokens, ending every
+// session, and its outstanding reset links. The link was emailed to the account, so its email
+// counts as verified too, with the same effect on federated identities as VerifyAccount.
+func (d *DB) ResetPassword(ctx context.Context, id, passwordHash string) (*Account, error) {
+	ctx, span := startSpan(ctx, "ResetPassword")
+	defer span.End()
+
+	var result Account
+	err := d.client.GetContext(ctx, &result, resetPasswordSQL, id, passwordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error resetting password: %w", err)
+	}
+	return &result, nil
+}
+
+// PurgeExpiredPasswordResetTokens deletes the reset links that expired before now and returns
+// how many were deleted
+func (d *DB) PurgeExpiredPasswordResetTokens(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "PurgeExpiredPasswordResetTokens")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, purgeExpiredPasswordResetTokensSQL, now)
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired password reset tokens: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired password reset tokens: %w", err)
+	}
+	return n, nil
+}
+
+var (
+	createPasswordResetTokenSQL = `
+		INSERT INTO password_reset_tokens (token_hash, account_id, email, expires_at)
+		VALUES (:token_hash, :account_id, :email, :expires_at);`
+
+	getPasswordResetTokenSQL = `
+		SELECT token_hash, account_id, email, expires_at, created_at
+		FROM password_reset_tokens
+		WHERE token_hash = $1;`
+
+	resetPasswordSQL = `
+		WITH ` + dropUnverifiedFederationSQL + `, deleted_refresh_tokens AS (
+			DELETE FROM refresh_tokens WHERE account_id = $1
+		), deleted_reset_tokens AS (
+			DELETE FROM password_reset_tokens WHERE account_id = $1
+		), account AS (
+			UPDATE accounts
+			SET password_hash = $2, verified_at = COALESCE(verified_at, NOW()), updated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		), outbox_event AS (` + insertAccountOutboxEventSQL(OutboxEventAccountPasswordChanged, "account") + `
+		)
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM account;`
+
+	purgeExpiredPasswordResetTokensSQL = `
+		DELETE FROM password_reset_tokens WHERE expires_at <= $1;`
+)
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordResets(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "resettest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "reset-test-refresh-token",
+		AccountID: testAccount.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	err = db.CreatePasswordResetToken(ctx, CreatePasswordResetTokenParams{
+		TokenHash: "reset-test-token-hash",
+		AccountID: testAccount.ID,
+		Email:     testAccount.Email,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	token, err := db.GetPasswordResetToken(ctx, "reset-test-token-hash")
+	require.NoError(t, err)
+	assert.Equal(t, testAccount.ID, token.AccountID)
+	assert.Equal(t, testAccount.Email, token.Email)
+
+	reset, err := db.ResetPassword(ctx, testAccount.ID, "new-password-hash")
+	require.NoError(t, err)
+	assert.Equal(t, "new-password-hash", reset.PasswordHash)
+	assert.NotNil(t, reset.VerifiedAt)
+
+	_, err = db.GetRefreshToken(ctx, "reset-test-refresh-token")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+	_, err = db.GetPasswordResetToken(ctx, "reset-test-token-hash")
+	assert.ErrorIs(t, err, ErrPasswordResetTokenNotFound)
+
+	_, err = db.ResetPassword(ctx, "00000000-0000-0000-0000-000000000000", "hash")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
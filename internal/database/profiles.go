@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// UpdateAccountProfileParams are the profile fields to change. Nil fields are left as they are
+// and empty ones are cleared.
+type UpdateAccountProfileParams struct {
+	DisplayName     *string
+	GivenName       *string
+	FamilyName      *string
+	PreferredLocale *string
+	Timezone        *string
+	AvatarURL       *string
+	// Username fails with ErrUsernameTaken when another account has it, in any case
+	Username *string
+}
+
+// UpdateAccountProfile changes the account's profile and bumps its updated_at, even when
+// nothing in params is different
+func (d *DB) UpdateAccountProfile(ctx context.Context, id string, params UpdateAccountProfileParams) (*Account, error) {
+	ctx, span := startSpan(ctx, "UpdateAccountProfile")
+	defer span.End()
+
+	var result Account
+	err := d.client.GetContext(ctx, &result, updateAccountProfileSQL, id,
+		params.DisplayName, params.GivenName, params.FamilyName, params.PreferredLocale, params.Timezone, params.AvatarURL, params.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		if c, _ := uniqueConstraint(err); c == duplicateUsernameConstraint {
+			return nil, ErrUsernameTaken
+		}
+		return nil, fmt.Errorf("error updating account profile: %w", err)
+	}
+	return &result, nil
+}
+
+var (
+	updateAccountProfileSQL = `
+		UPDATE accounts
+		SET display_name = COALESCE($2, display_name),
+			given_name = COALESCE($3, given_name),
+			family_name = COALESCE($4, family_name),
+			preferred_locale = COALESCE($5, preferred_locale),
+			timezone = COALESCE($6, timezone),
+			avatar_url = COALESCE($7, avatar_url),
+			username = COALESCE($8, username),
+			updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at;`
+)
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateAccountProfile(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "profiletest@test.com", PreferredLocale: "en"})
+	require.NoError(t, err)
+	assert.Empty(t, account.DisplayName)
+
+	name, timezone := "Ada", "Europe/London"
+	updated, err := db.UpdateAccountProfile(ctx, account.ID, UpdateAccountProfileParams{DisplayName: &name, Timezone: &timezone})
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", updated.DisplayName)
+	assert.Equal(t, "Europe/London", updated.Timezone)
+	assert.Equal(t, "en", updated.PreferredLocale)
+	assert.False(t, updated.UpdatedAt.Before(account.UpdatedAt))
+
+	// nil fields are left alone, empty ones cleared
+	locale, empty := "de", ""
+	again, err := db.UpdateAccountProfile(ctx, account.ID, UpdateAccountProfileParams{PreferredLocale: &locale, DisplayName: &empty})
+	require.NoError(t, err)
+	assert.Empty(t, again.DisplayName)
+	assert.Equal(t, "Europe/London", again.Timezone)
+	assert.Equal(t, "de", again.PreferredLocale)
+
+	actual, err := db.GetAccountByID(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, again.Timezone, actual.Timezone)
+	assert.Equal(t, again.PreferredLocale, actual.PreferredLocale)
+
+	_, err = db.UpdateAccountProfile(ctx, "00000000-0000-0000-0000-000000000000", UpdateAccountProfileParams{DisplayName: &name})
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
+
+func TestAccountUsername(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "usernametest@test.com", Username: "Ada_L"})
+	require.NoError(t, err)
+	assert.Equal(t, "Ada_L", account.Username)
+	other, err := db.CreateAccount(ctx, AccountCreationParams{Email: "usernametest-other@test.com"})
+	require.NoError(t, err)
+	assert.Empty(t, other.Username)
+
+	// usernames are compared regardless of case
+	found, err := db.GetAccountByUsername(ctx, "ada_l")
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, found.ID)
+	_, err = db.GetAccountByUsername(ctx, "")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+
+	_, err = db.CreateAccount(ctx, AccountCreationParams{Email: "usernametest-taken@test.com", Username: "ADA_L"})
+	require.ErrorIs(t, err, ErrUsernameTaken)
+	taken := "ada_L"
+	_, err = db.UpdateAccountProfile(ctx, other.ID, UpdateAccountProfileParams{Username: &taken})
+	require.ErrorIs(t, err, ErrUsernameTaken)
+
+	// changing the case of its own username, and accounts without one, don't conflict
+	renamed := "ADA_L"
+	updated, err := db.UpdateAccountProfile(ctx, account.ID, UpdateAccountProfileParams{Username: &renamed})
+	require.NoError(t, err)
+	assert.Equal(t, "ADA_L", updated.Username)
+	_, err = db.CreateAccount(ctx, AccountCreationParams{Email: "usernametest-third@test.com"})
+	require.NoError(t, err)
+
+	// a deleted account's username can be taken again
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+	_, err = db.GetAccountByUsername(ctx, "ada_l")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+	updated, err = db.UpdateAccountProfile(ctx, other.ID, UpdateAccountProfileParams{Username: &taken})
+	require.NoError(t, err)
+	assert.Equal(t, "ada_L", updated.Username)
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// replicaCooldown is how long reads stay on the primary after the replica failed one
+const replicaCooldown = 5 * time.Second
+
+// Reasons a read meant for the replica went to the primary, passed to DBConfig.OnReplicaFallback
+const (
+	// FallbackUnavailable is a read skipping the replica during the cooldown after it failed
+	FallbackUnavailable = "unavailable"
+	// FallbackError is a read that failed on the replica
+	FallbackError = "error"
+	// FallbackNotFound is a row the replica didn't have, which it may not have caught up on yet
+	FallbackNotFound = "not_found"
+)
+
+// replica is a read-only copy of the primary that reads are sent to while it's working
+type replica struct {
+	pool   *sqlx.DB
+	client querier
+	// downUntil is when the cooldown after a failed read ends, in Unix nanoseconds
+	downUntil atomic.Int64
+	// onFallback is DBConfig.OnReplicaFallback, it can be nil
+	onFallback func(reason string)
+}
+
+func (r *replica) available(now time.Time) bool {
+	return now.UnixNano() >= r.downUntil.Load()
+}
+
+func (r *replica) markDown(now time.Time) {
+	r.downUntil.Store(now.Add(replicaCooldown).UnixNano())
+}
+
+func (r *replica) fallback(reason string) {
+	if r.onFallback != nil {
+		r.onFallback(reason)
+	}
+}
+
+// reader is what reads that can be served by the replica run on: the replica when there is one,
+// otherwise the primary. Within WithTx they run in the transaction.
+func (d *DB) reader() querier {
+	if d.tx != nil || d.replica == nil {
+		return d.client
+	}
+	return replicaQuerier{querier: d.client, replica: d.replica}
+}
+
+// replicaQuerier sends reads to the replica and falls back to the primary when it's cooling down
+// after a failure or fails. A row the replica doesn't have is looked for on the primary too, since
+// it may have been written moments ago. Anything else goes to the primary.
+type replicaQuerier struct {
+	querier
+	replica *replica
+}
+
+func (q replicaQuerier) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	return q.read(ctx, func(client querier) error {
+		return client.GetContext(ctx, dest, query, args...)
+	})
+}
+
+func (q replicaQuerier) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	return q.read(ctx, func(client querier) error {
+		// rows are appended to dest, the replica can have added some before failing
+		slice := reflect.ValueOf(dest).Elem()
+		slice.Set(reflect.Zero(slice.Type()))
+		return client.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+func (q replicaQuerier) read(ctx context.Context, fn func(client querier) error) error {
+	if !q.replica.available(time.Now()) {
+		q.replica.fallback(FallbackUnavailable)
+		return fn(q.querier)
+	}
+
+	err := fn(q.replica.client)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		q.replica.fallback(FallbackNotFound)
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// the primary wouldn't have been any faster
+		return err
+	default:
+		slog.WarnContext(ctx, "read replica failed, reading from the primary", "cooldown", replicaCooldown, "error", err)
+		q.replica.markDown(time.Now())
+		q.replica.fallback(FallbackError)
+	}
+	return fn(q.querier)
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQuerier answers reads with err, or with rows when err is nil
+type fakeQuerier struct {
+	querier
+	rows  []string
+	err   error
+	reads int
+}
+
+func (f *fakeQuerier) GetContext(_ context.Context, dest any, _ string, _ ...any) error {
+	f.reads++
+	if f.err != nil {
+		return f.err
+	}
+	*dest.(*string) = f.rows[0]
+	return nil
+}
+
+func (f *fakeQuerier) SelectContext(_ context.Context, dest any, _ string, _ ...any) error {
+	f.reads++
+	*dest.(*[]string) = append(*dest.(*[]string), f.rows...)
+	return f.err
+}
+
+func setupReplica(t *testing.T) (*DB, *fakeQuerier, *fakeQuerier, map[string]int) {
+	t.Helper()
+
+	primary := &fakeQuerier{rows: []string{"primary"}}
+	replicaClient := &fakeQuerier{rows: []string{"replica"}}
+	fallbacks := map[string]int{}
+	db := &DB{
+		client: primary,
+		replica: &replica{
+			client:     replicaClient,
+			onFallback: func(reason string) { fallbacks[reason]++ },
+		},
+	}
+	return db, primary, replicaClient, fallbacks
+}
+
+func TestReplicaReads(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reads go to the replica", func(t *testing.T) {
+		db, primary, _, fallbacks := setupReplica(t)
+
+		var row string
+		require.NoError(t, db.reader().GetContext(ctx, &row, getAccountSQL))
+		assert.Equal(t, "replica", row)
+		assert.Zero(t, primary.reads)
+		assert.Empty(t, fallbacks)
+	})
+
+	t.Run("rows the replica doesn't have yet are read from the primary", func(t *testing.T) {
+		db, _, replicaClient, fallbacks := setupReplica(t)
+		replicaClient.err = sql.ErrNoRows
+
+		var row string
+		require.NoError(t, db.reader().GetContext(ctx, &row, getAccountSQL))
+		assert.Equal(t, "primary", row)
+		assert.Equal(t, map[string]int{FallbackNotFound: 1}, fallbacks)
+		assert.True(t, db.replica.available(time.Now()), "a missing row isn't a failure")
+	})
+
+	t.Run("a failing replica is skipped until it cools down", func(t *testing.T) {
+		db, primary, replicaClient, fallbacks := setupReplica(t)
+		replicaClient.err = errors.New("connection refused")
+
+		var rows []string
+		require.NoError(t, db.reader().SelectContext(ctx, &rows, listSessionsSQL))
+		// what the replica returned before failing is dropped
+		assert.Equal(t, []string{"primary"}, rows)
+
+		rows = nil
+		require.NoError(t, db.reader().SelectContext(ctx, &rows, listSessionsSQL))
+		assert.Equal(t, []string{"primary"}, rows)
+		assert.Equal(t, 1, replicaClient.reads)
+		assert.Equal(t, 2, primary.reads)
+		assert.Equal(t, map[string]int{FallbackError: 1, FallbackUnavailable: 1}, fallbacks)
+
+		assert.True(t, db.replica.available(time.Now().Add(replicaCooldown)))
+	})
+
+	t.Run("a canceled read isn't repeated", func(t *testing.T) {
+		db, primary, replicaClient, _ := setupReplica(t)
+		replicaClient.err = context.Canceled
+
+		var row string
+		require.ErrorIs(t, db.reader().GetContext(ctx, &row, getAccountSQL), context.Canceled)
+		assert.Zero(t, primary.reads)
+	})
+
+	t.Run("transactions read their own writes", func(t *testing.T) {
+		db, _, _, _ := setupReplica(t)
+		tx := &DB{client: &fakeQuerier{rows: []string{"tx"}}, tx: &sqlx.Tx{}, replica: db.replica}
+
+		var row string
+		require.NoError(t, tx.reader().GetContext(ctx, &row, getAccountSQL))
+		assert.Equal(t, "tx", row)
+	})
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Repository is everything the service stores. DB keeps it in Postgres, SQLiteDB in a SQLite file
+// for single instance deployments, and MemoryDB in the process, for tests and demos. Handlers depend on the narrower interfaces of their packages, which
+// both satisfy.
+type Repository interface {
+	Close() error
+	HealthCheck(ctx context.Context) error
+	// WithTx runs fn in a transaction, committed if fn returns nil. fn has to use the Repository
+	// it's given for its changes to be part of the transaction.
+	WithTx(ctx context.Context, fn func(tx Repository) error) error
+
+	// accounts
+	CreateAccount(ctx context.Context, params AccountCreationParams) (*Account, error)
+	GetAccount(ctx context.Context, email string) (*Account, error)
+	GetAccountByUsername(ctx context.Context, username string) (*Account, error)
+	GetAccountByID(ctx context.Context, id string) (*Account, error)
+	GetAccountsByIDs(ctx context.Context, ids []string) ([]Account, error)
+	GetAccountsByEmails(ctx context.Context, emails []string) ([]Account, error)
+	ListAccounts(ctx context.Context, params ListAccountsParams) ([]Account, error)
+	UpdatePassword(ctx context.Context, id, passwordHash string) (*Account, error)
+	RehashPassword(ctx context.Context, id, oldHash, newHash string) error
+	AddAccountTags(ctx context.Context, id string, tags []string) (*Account, error)
+	RemoveAccountTag(ctx context.Context, id, tag string) (*Account, error)
+	UpdateAccountFeatureFlags(ctx context.Context, id string, set map[string]bool, unset []string) (*Account, error)
+	UpdateAccountProfile(ctx context.Context, id string, params UpdateAccountProfileParams) (*Account, error)
+	UpdateAccountMetadata(ctx context.Context, id string, params UpdateAccountMetadataParams) (*Account, error)
+	DeleteAccount(ctx context.Context, id string) error
+	PurgeDeletedAccounts(ctx context.Context, deletedBefore time.Time) (int64, error)
+	EraseAccount(ctx context.Context, id string) error
+
+	// deletion requests
+	CreateDeletionRequest(ctx context.Context, accountID string, eraseAt time.Time) (*DeletionRequest, error)
+	GetDeletionRequest(ctx context.Context, accountID string) (*DeletionRequest, error)
+	CancelDeletionRequest(ctx context.Context, accountID string) (*DeletionRequest, error)
+	ListDueDeletionRequests(ctx context.Context, eraseBefore time.Time, limit int) ([]DeletionRequest, error)
+	ListDeletionRemindersDue(ctx context.Context, eraseBefore time.Time, limit int) ([]DeletionRequest, error)
+	MarkDeletionReminderSent(ctx context.Context, accountID string, at time.Time) error
+
+	// refresh tokens and sessions
+	CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) error
+	GetRefreshToken(ctx context.Context, token string) (*RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, token string, at time.Time) (*RefreshToken, error)
+	DeleteRefreshTokensByAccount(ctx context.Context, accountID string) error
+	DeleteRefreshTokenByToken(ctx context.Context, token string) error
+	CountActiveRefreshTokens(ctx context.Context, now time.Time) (int64, error)
+	PurgeExpiredRefreshTokens(ctx context.Context, now time.Time) (int64, error)
+	ListSessions(ctx context.Context, accountID string, now time.Time) ([]Session, error)
+	DeleteSession(ctx context.Context, accountID, sessionID string) error
+	RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	ClaimAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error)
+	AccessTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+
+	// known devices
+	CreateKnownDevice(ctx context.Context, params CreateKnownDeviceParams) (*KnownDevice, error)
+	TouchKnownDevice(ctx context.Context, params TouchKnownDeviceParams) error
+	CountKnownDevices(ctx context.Context, accountID string) (int, error)
+	GetKnownDeviceByRevokeTokenHash(ctx context.Context, tokenHash string) (*KnownDevice, error)
+	DeleteKnownDevice(ctx context.Context, id string) error
+
+	// audit events
+	CreateAuditEvent(ctx context.Context, params CreateAuditEventParams) error
+	ListAuditEvents(ctx context.Context, params ListAuditEventsParams) ([]AuditEvent, error)
+	PurgeAuditEvents(ctx context.Context, createdBefore time.Time) (int64, error)
+
+	// linked identities
+	CreateAccountIdentity(ctx context.Context, params CreateAccountIdentityParams) (*AccountIdentity, error)
+	GetAccountIdentity(ctx context.Context, provider, subject string) (*AccountIdentity, error)
+
+	// emailed links
+	CreateEmailChange(ctx context.Context, params CreateEmailChangeParams) (*EmailChange, error)
+	GetEmailChangeByTokenHash(ctx context.Context, tokenHash string) (*EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, id string, side EmailChangeSide) (*EmailChange, error)
+	CompleteEmailChange(ctx context.Context, id string) (*EmailChange, error)
+	DeleteEmailChange(ctx context.Context, id string) error
+	CreateFreezeToken(ctx context.Context, params CreateFreezeTokenParams) error
+	GetFreezeToken(ctx context.Context, tokenHash string) (*FreezeToken, error)
+	FreezeAccount(ctx context.Context, id string) (*Account, error)
+	UnfreezeAccount(ctx context.Context, id, passwordHash string) (*Account, error)
+	CreateEmailVerification(ctx context.Context, params CreateEmailVerificationParams) error
+	GetEmailVerification(ctx context.Context, tokenHash string) (*EmailVerification, error)
+	VerifyAccount(ctx context.Context, id string) (*Account, error)
+	PurgeExpiredEmailVerifications(ctx context.Context, now time.Time) (int64, error)
+	CreatePasswordResetToken(ctx context.Context, params CreatePasswordResetTokenParams) error
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (*PasswordResetToken, error)
+	ResetPassword(ctx context.Context, id, passwordHash string) (*Account, error)
+	PurgeExpiredPasswordResetTokens(ctx context.Context, now time.Time) (int64, error)
+
+	// two-factor authentication
+	SetMFASecret(ctx context.Context, accountID, secret string) error
+	GetMFASecret(ctx context.Context, accountID string) (*MFASecret, error)
+	EnableMFA(ctx context.Context, accountID string, step int64) (*MFASecret, error)
+	UseMFAStep(ctx context.Context, accountID string, step int64) error
+	ReplaceMFARecoveryCodes(ctx context.Context, accountID string, codeHashes []string) error
+	UseMFARecoveryCode(ctx context.Context, accountID, codeHash string) error
+	CountMFARecoveryCodes(ctx context.Context, accountID string) (int, error)
+	SetMFAPhone(ctx context.Context, accountID, phoneNumber string) error
+	GetMFAPhone(ctx context.Context, accountID string) (*MFAPhone, error)
+	VerifyMFAPhone(ctx context.Context, accountID string) (*MFAPhone, error)
+	SetMFAPhoneCode(ctx context.Context, params SetMFAPhoneCodeParams) error
+	UseMFAPhoneCode(ctx context.Context, accountID, codeHash string, now time.Time) error
+	CreateTrustedDevice(ctx context.Context, params CreateTrustedDeviceParams) (*TrustedDevice, error)
+	UseTrustedDevice(ctx context.Context, params UseTrustedDeviceParams) error
+	ListTrustedDevices(ctx context.Context, accountID string, now time.Time) ([]TrustedDevice, error)
+	DeleteTrustedDevice(ctx context.Context, accountID, id string) error
+	DeleteTrustedDevices(ctx context.Context, accountID string) (int64, error)
+	PurgeExpiredTrustedDevices(ctx context.Context, now time.Time) (int64, error)
+
+	// organizations
+	CreateOrganization(ctx context.Context, name, ownerID string) (*Organization, error)
+	GetOrganization(ctx context.Context, id string) (*Organization, error)
+	ListAccountOrganizations(ctx context.Context, accountID string) ([]Organization, error)
+	GetOrganizationMember(ctx context.Context, organizationID, accountID string) (*OrganizationMember, error)
+	CreateOrganizationInvitation(ctx context.Context, params CreateOrganizationInvitationParams) error
+	GetOrganizationInvitation(ctx context.Context, tokenHash string) (*OrganizationInvitation, error)
+	AcceptOrganizationInvitation(ctx context.Context, tokenHash, accountID string) (*OrganizationMember, error)
+	AddOrganizationMember(ctx context.Context, organizationID, accountID, role string) (*OrganizationMember, error)
+
+	// saml
+	SetOrganizationSAMLConfig(ctx context.Context, params SetOrganizationSAMLConfigParams) (*OrganizationSAMLConfig, error)
+	GetOrganizationSAMLConfig(ctx context.Context, organizationID string) (*OrganizationSAMLConfig, error)
+	DeleteOrganizationSAMLConfig(ctx context.Context, organizationID string) error
+	CreateFederatedIdentity(ctx context.Context, params CreateFederatedIdentityParams) (*FederatedIdentity, error)
+	GetFederatedIdentity(ctx context.Context, organizationID, subject string) (*FederatedIdentity, error)
+
+	// roles
+	CreateRole(ctx context.Context, name, description string, permissions []string) (*Role, error)
+	GetRole(ctx context.Context, name string) (*Role, error)
+	AssignRole(ctx context.Context, accountID, role string) error
+	UnassignRole(ctx context.Context, accountID, role string) error
+	GetAccountRoles(ctx context.Context, accountID string) ([]string, error)
+
+	// webhooks
+	CreateWebhookEndpoint(ctx context.Context, params CreateWebhookEndpointParams) (*WebhookEndpoint, error)
+	GetWebhookEndpoint(ctx context.Context, id string) (*WebhookEndpoint, error)
+	ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, id string) error
+	CreateWebhookDeliveries(ctx context.Context, eventType, payload string) (int64, error)
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id string, attempt WebhookAttempt) error
+	GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, id string, now time.Time) (*WebhookDelivery, error)
+
+	// api keys
+	CreateAPIKey(ctx context.Context, params CreateAPIKeyParams) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, accountID string) ([]APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+	DeleteAPIKey(ctx context.Context, accountID, id string) error
+
+	// oauth
+	CreateOAuthClient(ctx context.Context, params CreateOAuthClientParams) (*OAuthClient, error)
+	GetOAuthClient(ctx context.Context, id string) (*OAuthClient, error)
+	ListOAuthClients(ctx context.Context) ([]OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, id string) error
+	CreateOAuthAuthorizationCode(ctx context.Context, params CreateOAuthAuthorizationCodeParams) error
+	ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (*OAuthAuthorizationCode, error)
+
+	// outbox
+	RelayOutboxEvents(ctx context.Context, limit int, publish func(ctx context.Context, events []OutboxEvent) error) (int, error)
+	PurgeOutboxEvents(ctx context.Context, createdBefore time.Time, unpublished bool) (int64, error)
+}
+
+var (
+	_ Repository = (*DB)(nil)
+	_ Repository = (*SQLiteDB)(nil)
+	_ Repository = (*MemoryDB)(nil)
+)
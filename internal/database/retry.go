@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// RetryConfig is how DB retries statements and transactions that failed for a transient reason:
+// a serialization failure or deadlock, a dropped connection, or the primary failing over.
+type RetryConfig struct {
+	// MaxAttempts includes the first one. 1 doesn't retry.
+	MaxAttempts int
+	// BaseDelay is the longest wait before the first retry, doubling for each one after up to
+	// MaxDelay. Waits are picked at random up to that so replicas don't retry in lockstep.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts: 3,
+		BaseDelay:   50 * time.Millisecond,
+		MaxDelay:    time.Second,
+	}
+}
+
+// do runs fn until it succeeds, fails for good, runs out of attempts, or ctx is done. idempotent
+// says whether fn can safely run twice. If not, it's only retried when the database is known not
+// to have applied it.
+func (c RetryConfig) do(ctx context.Context, idempotent bool, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= c.MaxAttempts || !retryable(err, idempotent) {
+			return err
+		}
+
+		wait := c.backoff(attempt)
+		slog.WarnContext(ctx, "transient database error, retrying", "attempt", attempt, "retry_in", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// backoff is how long to wait before the attempt after the given one
+func (c RetryConfig) backoff(attempt int) time.Duration {
+	wait := c.BaseDelay
+	for i := 1; i < attempt && wait < c.MaxDelay; i++ {
+		wait *= 2
+	}
+	wait = min(wait, c.MaxDelay)
+	if wait <= 0 {
+		return 0
+	}
+	return rand.N(wait) + 1
+}
+
+// retryable reports whether err is transient. Statements that aren't idempotent are only retried
+// when they can't have been applied: they never reached the server, or the server rolled them
+// back. A connection lost after sending one leaves it unknown whether it committed.
+func retryable(err error, idempotent bool) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// the connection failed before anything was sent
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "40001", pgErr.Code == "40P01":
+			// serialization_failure and deadlock_detected roll the statement back
+			return true
+		case pgErr.Code == "57P03":
+			// cannot_connect_now, the server is starting up or failing over
+			return true
+		case strings.HasPrefix(pgErr.Code, "08"), pgErr.Code == "57P01", pgErr.Code == "57P02":
+			// connection exceptions, admin_shutdown, and crash_shutdown can hit a statement
+			// partway through
+			return idempotent
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return idempotent && (errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.As(err, &netErr))
+}
+
+// readOnly reports whether query only reads, so running it twice is harmless. Statements that
+// write, including ones with RETURNING, don't start with SELECT.
+func readOnly(query string) bool {
+	fields := strings.Fields(query)
+	return len(fields) > 0 && strings.EqualFold(fields[0], "SELECT")
+}
+
+// retryingQuerier retries the pool's statements. Statements in a transaction aren't retried on
+// their own, the transaction is retried as a whole.
+type retryingQuerier struct {
+	querier
+	cfg RetryConfig
+}
+
+func (q retryingQuerier) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	return q.cfg.do(ctx, readOnly(query), func() error {
+		return q.querier.GetContext(ctx, dest, query, args...)
+	})
+}
+
+func (q retryingQuerier) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	return q.cfg.do(ctx, readOnly(query), func() error {
+		// rows are appended to dest, a failed attempt can have added some
+		slice := reflect.ValueOf(dest).Elem()
+		slice.Set(reflect.Zero(slice.Type()))
+		return q.querier.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+func (q retryingQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var result sql.Result
+	err := q.cfg.do(ctx, readOnly(query), func() error {
+		var err error
+		result, err = q.querier.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+func (q retryingQuerier) NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error) {
+	var result sql.Result
+	err := q.cfg.do(ctx, readOnly(query), func() error {
+		var err error
+		result, err = q.querier.NamedExecContext(ctx, query, arg)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+// notSentError is how pgx reports a statement that never left the client
+type notSentError struct{}
+
+func (notSentError) Error() string     { return "failed to connect" }
+func (notSentError) SafeToRetry() bool { return true }
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		idempotent bool
+		write      bool
+	}{
+		{name: "not sent", err: fmt.Errorf("error creating account: %w", notSentError{}), idempotent: true, write: true},
+		{name: "serialization failure", err: &pgconn.PgError{Code: "40001"}, idempotent: true, write: true},
+		{name: "deadlock", err: &pgconn.PgError{Code: "40P01"}, idempotent: true, write: true},
+		{name: "failing over", err: &pgconn.PgError{Code: "57P03"}, idempotent: true, write: true},
+		{name: "terminated", err: &pgconn.PgError{Code: "57P01"}, idempotent: true},
+		{name: "connection exception", err: &pgconn.PgError{Code: "08006"}, idempotent: true},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), idempotent: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, idempotent: true},
+		{name: "unique violation", err: &pgconn.PgError{Code: "23505"}},
+		{name: "no rows", err: sql.ErrNoRows},
+		{name: "canceled", err: context.Canceled},
+		{name: "timed out", err: fmt.Errorf("error getting account: %w", context.DeadlineExceeded)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.idempotent, retryable(tt.err, true), "idempotent")
+			assert.Equal(t, tt.write, retryable(tt.err, false), "write")
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	assert.True(t, readOnly(getAccountSQL))
+	assert.True(t, readOnly("select 1"))
+	assert.False(t, readOnly(createAccountSQL))
+	assert.False(t, readOnly(`
+		WITH deleted AS (DELETE FROM refresh_tokens RETURNING account_id) SELECT count(*) FROM deleted;`))
+	assert.False(t, readOnly(""))
+}
+
+func TestRetryConfigDo(t *testing.T) {
+	ctx := context.Background()
+	cfg := RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	reset := fmt.Errorf("read: %w", syscall.ECONNRESET)
+
+	t.Run("succeeds after transient errors", func(t *testing.T) {
+		attempts := 0
+		err := cfg.do(ctx, true, func() error {
+			attempts++
+			if attempts < 3 {
+				return reset
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("gives up after MaxAttempts", func(t *testing.T) {
+		attempts := 0
+		err := cfg.do(ctx, true, func() error {
+			attempts++
+			return reset
+		})
+		assert.ErrorIs(t, err, syscall.ECONNRESET)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("writes aren't retried when they could have been applied", func(t *testing.T) {
+		attempts := 0
+		err := cfg.do(ctx, false, func() error {
+			attempts++
+			return reset
+		})
+		assert.ErrorIs(t, err, syscall.ECONNRESET)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		attempts := 0
+		err := RetryConfig{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}.do(ctx, true, func() error {
+			attempts++
+			cancel()
+			return reset
+		})
+		assert.ErrorIs(t, err, syscall.ECONNRESET)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("the zero value doesn't retry", func(t *testing.T) {
+		attempts := 0
+		err := RetryConfig{}.do(ctx, true, func() error {
+			attempts++
+			return reset
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	cfg := RetryConfig{BaseDelay: 10 * time.Millisecond, MaxDelay: 30 * time.Millisecond}
+	for range 100 {
+		assert.LessOrEqual(t, cfg.backoff(1), 10*time.Millisecond)
+		assert.LessOrEqual(t, cfg.backoff(2), 20*time.Millisecond)
+		assert.LessOrEqual(t, cfg.backoff(10), 30*time.Millisecond)
+		assert.Positive(t, cfg.backoff(1))
+	}
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RevokeAccessToken records the access token with the ID as revoked until it expires. Revoking
+// a token twice keeps the first revocation. Revocations of tokens that have expired since are
+// cleaned up along the way.
+func (d *DB) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ctx, span := startSpan(ctx, "RevokeAccessToken")
+	defer span.End()
+
+	_, err := d.client.ExecContext(ctx, revokeAccessTokenSQL, tokenID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error revoking access token: %w", err)
+	}
+	return nil
+}
+
+// ClaimAccessToken revokes the access token with the ID like RevokeAccessToken, and reports
+// whether it was this call that did. Of any number of calls racing each other for the same ID,
+// only one claims it, which makes single-use tokens single use.
+func (d *DB) ClaimAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	ctx, span := startSpan(ctx, "ClaimAccessToken")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, revokeAccessTokenSQL, tokenID, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("error claiming access token: %w", err)
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error claiming access token: %w", err)
+	}
+	return claimed == 1, nil
+}
+
+// AccessTokenRevoked reports whether the access token with the ID was revoked and hasn't
+// expired yet
+func (d *DB) AccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	ctx, span := startSpan(ctx, "AccessTokenRevoked")
+	defer span.End()
+
+	var revoked bool
+	err := d.client.GetContext(ctx, &revoked, accessTokenRevokedSQL, tokenID)
+	if err != nil {
+		return false, fmt.Errorf("error checking access token revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+var (
+	revokeAccessTokenSQL = `
+		WITH expired AS (
+			DELETE FROM revoked_access_tokens WHERE expires_at <= NOW()
+		)
+		INSERT INTO revoked_access_tokens (token_id, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (token_id) DO NOTHING;`
+
+	accessTokenRevokedSQL = `
+		SELECT EXISTS (
+			SELECT 1 FROM revoked_access_tokens
+			WHERE token_id = $1 AND expires_at > NOW()
+		);`
+)
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokedAccessTokens(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	tokenID := uuid.NewString()
+	revoked, err := db.AccessTokenRevoked(ctx, tokenID)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, db.RevokeAccessToken(ctx, tokenID, time.Now().Add(time.Hour)))
+	// revoking it again is fine
+	require.NoError(t, db.RevokeAccessToken(ctx, tokenID, time.Now().Add(time.Hour)))
+
+	revoked, err = db.AccessTokenRevoked(ctx, tokenID)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	// only one claim of a token succeeds
+	claimedID := uuid.NewString()
+	claimed, err := db.ClaimAccessToken(ctx, claimedID, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = db.ClaimAccessToken(ctx, claimedID, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	// expired tokens aren't revoked anymore, they're rejected for expiring
+	expiredID := uuid.NewString()
+	require.NoError(t, db.RevokeAccessToken(ctx, expiredID, time.Now().Add(-time.Minute)))
+	revoked, err = db.AccessTokenRevoked(ctx, expiredID)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RoleAdmin is the role the admin endpoints require. The migrations create it.
+const RoleAdmin = "admin"
+
+// Role grants the accounts that have it a set of permissions
+type Role struct {
+	Name        string      `db:"name"`
+	Description string      `db:"description"`
+	Permissions StringArray `db:"permissions"`
+	CreatedAt   time.Time   `db:"created_at"`
+}
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleAlreadyExists = errors.New("role already exists")
+
+	duplicateRoleConstraint = "roles_pkey"
+)
+
+// CreateRole creates a role with the permissions
+func (d *DB) CreateRole(ctx context.Context, name, description string, permissions []string) (*Role, error) {
+	ctx, span := startSpan(ctx, "CreateRole")
+	defer span.End()
+
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	var result Role
+	err := d.client.GetContext(ctx, &result, createRoleSQL, name, description, permissions)
+	if err != nil {
+		if c, _ := uniqueConstraint(err); c == duplicateRoleConstraint {
+			return nil, ErrRoleAlreadyExists
+		}
+		return nil, fmt.Errorf("error creating role: %w", err)
+	}
+	return &result, nil
+}
+
+func (d *DB) GetRole(ctx context.Context, name string) (*Role, error) {
+	ctx, span := startSpan(ctx, "GetRole")
+	defer span.End()
+
+	var result Role
+	err := d.client.GetContext(ctx, &result, getRoleSQL, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, fmt.Errorf("error getting role: %w", err)
+	}
+	return &result, nil
+}
+
+// AssignRole gives the account the role, or returns ErrRoleNotFound if there's no such role.
+// It's not an error if the account already has it.
+func (d *DB) AssignRole(ctx context.Context, accountID, role string) error {
+	ctx, span := startSpan(ctx, "AssignRole")
+	defer span.End()
+
+	var found bool
+	if err := d.client.GetContext(ctx, &found, assignRoleSQL, accountID, role); err != nil {
+		return fmt.Errorf("error assigning role: %w", err)
+	}
+	if !found {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// UnassignRole takes the role away from the account. It's not an error if it doesn't have it.
+func (d *DB) UnassignRole(ctx context.Context, accountID, role string) error {
+	ctx, span := startSpan(ctx, "UnassignRole")
+	defer span.End()
+
+	if _, err := d.client.ExecContext(ctx, unassignRoleSQL, accountID, role); err != nil {
+		return fmt.Errorf("error unassigning role: %w", err)
+	}
+	return nil
+}
+
+// GetAccountRoles returns the names of the account's roles, sorted
+func (d *DB) GetAccountRoles(ctx context.Context, accountID string) ([]string, error) {
+	ctx, span := startSpan(ctx, "GetAccountRoles")
+	defer span.End()
+
+	roles := []string{}
+	if err := d.client.SelectContext(ctx, &roles, getAccountRolesSQL, accountID); err != nil {
+		return nil, fmt.Errorf("error getting account roles: %w", err)
+	}
+	return roles, nil
+}
+
+var (
+	createRoleSQL = `
+		WITH role AS (
+			INSERT INTO roles (name, description)
+			VALUES ($1, $2)
+			RETURNING name, description, created_at
+		), granted AS (
+			INSERT INTO permissions (role_name, name)
+			SELECT role.name, permission FROM role, UNNEST($3::text[]) AS permission
+			ON CONFLICT DO NOTHING
+		)
+		SELECT name, description, ARRAY(SELECT DISTINCT UNNEST($3::text[]) ORDER BY 1) AS permissions, created_at
+		FROM role;`
+
+	getRoleSQL = `
+		SELECT r.name, r.description, r.created_at,
+			ARRAY(SELECT p.name FROM permissions p WHERE p.role_name = r.name ORDER BY p.name) AS permissions
+		FROM roles r WHERE r.name = $1;`
+
+	assignRoleSQL = `
+		WITH role AS (
+			SELECT name FROM roles WHERE name = $2
+		), assigned AS (
+			INSERT INTO account_roles (account_id, role_name)
+			SELECT $1, name FROM role
+			ON CONFLICT DO NOTHING
+		)
+		SELECT EXISTS (SELECT 1 FROM role);`
+
+	unassignRoleSQL = `
+		DELETE FROM account_roles WHERE account_id = $1 AND role_name = $2;`
+
+	getAccountRolesSQL = `
+		SELECT role_name FROM account_roles WHERE account_id = $1 ORDER BY role_name;`
+)
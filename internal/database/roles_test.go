@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoles(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "roles@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	// the migrations create the admin role
+	admin, err := db.GetRole(ctx, RoleAdmin)
+	require.NoError(t, err)
+	assert.NotEmpty(t, admin.Permissions)
+
+	role, err := db.CreateRole(ctx, "test-support", "Helps customers", []string{"accounts:write", "accounts:read"})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = db.pool.Exec("DELETE FROM roles WHERE name = $1", role.Name)
+	})
+	assert.Equal(t, StringArray{"accounts:read", "accounts:write"}, role.Permissions)
+
+	_, err = db.CreateRole(ctx, "test-support", "", nil)
+	require.ErrorIs(t, err, ErrRoleAlreadyExists)
+
+	got, err := db.GetRole(ctx, "test-support")
+	require.NoError(t, err)
+	assert.Equal(t, role.Permissions, got.Permissions)
+
+	require.NoError(t, db.AssignRole(ctx, account.ID, "test-support"))
+	require.NoError(t, db.AssignRole(ctx, account.ID, "test-support"))
+	require.ErrorIs(t, db.AssignRole(ctx, account.ID, "missing"), ErrRoleNotFound)
+
+	roles, err := db.GetAccountRoles(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test-support"}, roles)
+
+	require.NoError(t, db.UnassignRole(ctx, account.ID, "test-support"))
+	roles, err = db.GetAccountRoles(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+
+	_, err = db.GetRole(ctx, "missing")
+	require.ErrorIs(t, err, ErrRoleNotFound)
+}
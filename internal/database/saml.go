@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OrganizationSAMLConfig is the SAML identity provider an organization's members sign in with
+type OrganizationSAMLConfig struct {
+	OrganizationID string `db:"organization_id"`
+	IdPEntityID    string `db:"idp_entity_id"`
+	// IdPMetadata is the IdP's metadata XML, with its SSO URL and signing certificates
+	IdPMetadata string    `db:"idp_metadata"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+type SetOrganizationSAMLConfigParams struct {
+	OrganizationID string
+	IdPEntityID    string
+	IdPMetadata    string
+}
+
+// FederatedIdentity links an account to the subject (NameID) an organization's IdP signs it in as
+type FederatedIdentity struct {
+	ID             string    `db:"id"`
+	AccountID      string    `db:"account_id"`
+	OrganizationID string    `db:"organization_id"`
+	Subject        string    `db:"subject"`
+	Email          string    `db:"email"`
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+type CreateFederatedIdentityParams struct {
+	AccountID      string
+	OrganizationID string
+	Subject        string
+	Email          string
+}
+
+var (
+	ErrOrganizationSAMLConfigNotFound = errors.New("organization saml config not found")
+	ErrFederatedIdentityNotFound      = errors.New("federated identity not found")
+	ErrFederatedIdentityAlreadyExists = errors.New("federated identity already exists")
+
+	duplicateFederatedIdentityConstraint = "federated_identities_organization_id_subject_key"
+)
+
+// SetOrganizationSAMLConfig creates or replaces the organization's SAML config
+func (d *DB) SetOrganizationSAMLConfig(ctx context.Context, params SetOrganizationSAMLConfigParams) (*OrganizationSAMLConfig, error) {
+	ctx, span := startSpan(ctx, "SetOrganizationSAMLConfig")
+	defer span.End()
+
+	var result OrganizationSAMLConfig
+	err := d.client.GetContext(ctx, &result, setOrganizationSAMLConfigSQL,
+		params.OrganizationID, params.IdPEntityID, params.IdPMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("error setting organization saml config: %w", err)
+	}
+	return &result, nil
+}
+
+func (d *DB) GetOrganizationSAMLConfig(ctx context.Context, organizationID string) (*OrganizationSAMLConfig, error) {
+	ctx, span := startSpan(ctx, "GetOrganizationSAMLConfig")
+	defer span.End()
+
+	var result OrganizationSAMLConfig
+	err := d.client.GetContext(ctx, &result, getOrganizationSAMLConfigSQL, organizationID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationSAMLConfigNotFound
+		}
+		return nil, fmt.Errorf("error getting organization saml config: %w", err)
+	}
+	return &result, nil
+}
+
+// DeleteOrganizationSAMLConfig turns SAML sign in off for the organization. Its federated
+// identities are kept so accounts are linked again if it's turned back on.
+func (d *DB) DeleteOrganizationSAMLConfig(ctx context.Context, organizationID string) error {
+	ctx, span := startSpan(ctx, "DeleteOrganizationSAMLConfig")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, deleteOrganizationSAMLConfigSQL, organizationID)
+	if err != nil {
+		return fmt.Errorf("error deleting organization saml config: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrOrganizationSAMLConfigNotFound
+	}
+	return nil
+}
+
+func (d *DB) CreateFederatedIdentity(ctx context.Context, params CreateFederatedIdentityParams) (*FederatedIdentity, error) {
+	ctx, span := startSpan(ctx, "CreateFederatedIdentity")
+	defer span.End()
+
+	var result FederatedIdentity
+	err := d.client.GetContext(ctx, &result, createFederatedIdentitySQL,
+		params.AccountID, params.OrganizationID, params.Subject, params.Email)
+	if err != nil {
+		if c, _ := uniqueConstraint(err); c == duplicateFederatedIdentityConstraint {
+			return nil, ErrFederatedIdentityAlreadyExists
+		}
+		return nil, fmt.Errorf("error creating federated identity: %w", err)
+	}
+	return &result, nil
+}
+
+// GetFederatedIdentity returns the identity the organization's IdP signs in as the subject
+func (d *DB) GetFederatedIdentity(ctx context.Context, organizationID, subject string) (*FederatedIdentity, error) {
+	ctx, span := startSpan(ctx, "GetFederatedIdentity")
+	defer span.End()
+
+	var result FederatedIdentity
+	err := d.client.GetContext(ctx, &result, getFederatedIdentitySQL, organizationID, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFederatedIdentityNotFound
+		}
+		return nil, fmt.Errorf("error getting federated identity: %w", err)
+	}
+	return &result, nil
+}
+
+const federatedIdentityColumns = `id, account_id, organization_id, subject, COALESCE(email, '') AS email, created_at`
+
+// dropUnverifiedFederationSQL are CTEs that unlink account $1 from the IdPs that signed it in
+// and take it out of their organizations, if its email isn't verified yet. They go in the
+// statements that verify the email: an organization's IdP can sign in as any address, so an
+// account it signed in as before the address was proven has to be handed over without it.
+var dropUnverifiedFederationSQL = `
+		unverified AS (
+			SELECT id FROM accounts WHERE id = $1 AND verified_at IS NULL
+		), dropped_identities AS (
+			DELETE FROM federated_identities WHERE account_id IN (SELECT id FROM unverified)
+			RETURNING organization_id
+		), dropped_memberships AS (
+			DELETE FROM organization_members
+			WHERE account_id = $1 AND role <> '` + OrganizationRoleOwner + `'
+				AND organization_id IN (SELECT organization_id FROM dropped_identities)
+		)`
+
+var (
+	setOrganizationSAMLConfigSQL = `
+		INSERT INTO organization_saml_configs (organization_id, idp_entity_id, idp_metadata)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id) DO UPDATE
+		SET idp_entity_id = EXCLUDED.idp_entity_id, idp_metadata = EXCLUDED.idp_metadata, updated_at = NOW()
+		RETURNING organization_id, idp_entity_id, idp_metadata, created_at, updated_at;`
+
+	getOrganizationSAMLConfigSQL = `
+		SELECT organization_id, idp_entity_id, idp_metadata, created_at, updated_at
+		FROM organization_saml_configs WHERE organization_id = $1;`
+
+	deleteOrganizationSAMLConfigSQL = `
+		DELETE FROM organization_saml_configs WHERE organization_id = $1;`
+
+	createFederatedIdentitySQL = `
+		INSERT INTO federated_identities (account_id, organization_id, subject, email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING ` + federatedIdentityColumns + `;`
+
+	getFederatedIdentitySQL = `
+		SELECT ` + federatedIdentityColumns + `
+		FROM federated_identities WHERE organization_id = $1 AND subject = $2;`
+)
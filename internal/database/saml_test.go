@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSAML(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	owner, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "samlowner@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+	member, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email: "samlmember@test.com",
+	})
+	require.NoError(t, err)
+
+	org, err := db.CreateOrganization(ctx, "Acme", owner.ID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = db.pool.Exec("DELETE FROM organizations WHERE id = $1", org.ID)
+	})
+
+	// adding a member keeps the role an existing member already has
+	added, err := db.AddOrganizationMember(ctx, org.ID, member.ID, OrganizationRoleMember)
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleMember, added.Role)
+	added, err = db.AddOrganizationMember(ctx, org.ID, owner.ID, OrganizationRoleMember)
+	require.NoError(t, err)
+	assert.Equal(t, OrganizationRoleOwner, added.Role)
+
+	_, err = db.GetOrganizationSAMLConfig(ctx, org.ID)
+	require.ErrorIs(t, err, ErrOrganizationSAMLConfigNotFound)
+
+	_, err = db.SetOrganizationSAMLConfig(ctx, SetOrganizationSAMLConfigParams{
+		OrganizationID: org.ID,
+		IdPEntityID:    "https://idp.example.com",
+		IdPMetadata:    "<EntityDescriptor/>",
+	})
+	require.NoError(t, err)
+	// setting it again replaces it
+	_, err = db.SetOrganizationSAMLConfig(ctx, SetOrganizationSAMLConfigParams{
+		OrganizationID: org.ID,
+		IdPEntityID:    "https://other-idp.example.com",
+		IdPMetadata:    "<EntityDescriptor/>",
+	})
+	require.NoError(t, err)
+	config, err := db.GetOrganizationSAMLConfig(ctx, org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "https://other-idp.example.com", config.IdPEntityID)
+
+	identity, err := db.CreateFederatedIdentity(ctx, CreateFederatedIdentityParams{
+		AccountID:      member.ID,
+		OrganizationID: org.ID,
+		Subject:        "member-name-id",
+		Email:          "samlmember@test.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, member.ID, identity.AccountID)
+
+	_, err = db.CreateFederatedIdentity(ctx, CreateFederatedIdentityParams{
+		AccountID:      owner.ID,
+		OrganizationID: org.ID,
+		Subject:        "member-name-id",
+	})
+	require.ErrorIs(t, err, ErrFederatedIdentityAlreadyExists)
+
+	got, err := db.GetFederatedIdentity(ctx, org.ID, "member-name-id")
+	require.NoError(t, err)
+	assert.Equal(t, identity.ID, got.ID)
+	_, err = db.GetFederatedIdentity(ctx, org.ID, "unknown-name-id")
+	require.ErrorIs(t, err, ErrFederatedIdentityNotFound)
+
+	require.NoError(t, db.DeleteOrganizationSAMLConfig(ctx, org.ID))
+	require.ErrorIs(t, db.DeleteOrganizationSAMLConfig(ctx, org.ID), ErrOrganizationSAMLConfigNotFound)
+
+	// deleting the account deletes its federated identities
+	require.NoError(t, db.DeleteAccount(ctx, member.ID))
+	_, err = db.GetFederatedIdentity(ctx, org.ID, "member-name-id")
+	require.ErrorIs(t, err, ErrFederatedIdentityNotFound)
+}
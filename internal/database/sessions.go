@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a login and every refresh token issued by refreshing it since
+type Session struct {
+	ID string `db:"id"`
+	// IPAddress and UserAgent are of the client that last refreshed the session
+	IPAddress string    `db:"ip_address"`
+	UserAgent string    `db:"user_agent"`
+	CreatedAt time.Time `db:"created_at"`
+	// LastUsedAt is when the session's newest refresh token was issued
+	LastUsedAt time.Time `db:"last_used_at"`
+}
+
+// ListSessions returns the account's sessions that still have a usable refresh token at the
+// given time, most recently used first
+func (d *DB) ListSessions(ctx context.Context, accountID string, now time.Time) ([]Session, error) {
+	ctx, span := startSpan(ctx, "ListSessions")
+	defer span.End()
+
+	var result []Session
+	err := d.reader().SelectContext(ctx, &result, listSessionsSQL, accountID, now)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+	return result, nil
+}
+
+// DeleteSession deletes every refresh token of one of the account's sessions. It returns
+// ErrSessionNotFound if the account has no such session.
+func (d *DB) DeleteSession(ctx context.Context, accountID, sessionID string) error {
+	ctx, span := startSpan(ctx, "DeleteSession")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, deleteSessionSQL, accountID, sessionID)
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// groupSessions groups an account's refresh tokens into the sessions that still have a usable
+// token at now, most recently used first, for databases that can't do it in SQL
+func groupSessions(tokens []RefreshToken, now time.Time) []Session {
+	sessions := map[string]*Session{}
+	active := map[string]bool{}
+	for _, rt := range tokens {
+		session, ok := sessions[rt.SessionID]
+		if !ok {
+			session = &Session{ID: rt.SessionID, CreatedAt: rt.CreatedAt}
+			sessions[rt.SessionID] = session
+		}
+		if rt.CreatedAt.Before(session.CreatedAt) {
+			session.CreatedAt = rt.CreatedAt
+		}
+		// the client of the newest token is the one that last used the session
+		if !rt.CreatedAt.Before(session.LastUsedAt) {
+			session.LastUsedAt = rt.CreatedAt
+			session.IPAddress = rt.IPAddress
+			session.UserAgent = rt.UserAgent
+		}
+		if rt.ExpiresAt.After(now) && rt.RotatedAt == nil {
+			active[rt.SessionID] = true
+		}
+	}
+
+	var result []Session
+	for id, session := range sessions {
+		if active[id] {
+			result = append(result, *session)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastUsedAt.After(result[j].LastUsedAt)
+	})
+	return result
+}
+
+var (
+	// the client of the newest token is the one that last used the session
+	listSessionsSQL = `
+		SELECT session_id AS id,
+			(ARRAY_AGG(ip_address ORDER BY created_at DESC))[1] AS ip_address,
+			(ARRAY_AGG(user_agent ORDER BY created_at DESC))[1] AS user_agent,
+			MIN(created_at) AS created_at,
+			MAX(created_at) AS last_used_at
+		FROM refresh_tokens
+		WHERE account_id = $1
+		GROUP BY session_id
+		HAVING BOOL_OR(expires_at > $2 AND rotated_at IS NULL)
+		ORDER BY last_used_at DESC;`
+
+	deleteSessionSQL = `
+		DELETE FROM refresh_tokens
+		WHERE account_id = $1 AND session_id = $2;`
+)
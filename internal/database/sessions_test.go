@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "sessionstest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "sessions-test-laptop-1",
+		AccountID: testAccount.ID,
+		ExpiresAt: expiresAt,
+		IPAddress: "203.0.113.1",
+		UserAgent: "laptop",
+	})
+	require.NoError(t, err)
+	laptop, err := db.GetRefreshToken(ctx, "sessions-test-laptop-1")
+	require.NoError(t, err)
+	require.NotEmpty(t, laptop.SessionID)
+
+	_, err = db.RotateRefreshToken(ctx, "sessions-test-laptop-1", time.Now())
+	require.NoError(t, err)
+	err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "sessions-test-laptop-2",
+		AccountID: testAccount.ID,
+		ExpiresAt: expiresAt,
+		SessionID: laptop.SessionID,
+		IPAddress: "203.0.113.2",
+		UserAgent: "laptop",
+	})
+	require.NoError(t, err)
+
+	err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "sessions-test-phone-1",
+		AccountID: testAccount.ID,
+		ExpiresAt: expiresAt,
+		UserAgent: "phone",
+	})
+	require.NoError(t, err)
+
+	sessions, err := db.ListSessions(ctx, testAccount.ID, time.Now())
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "phone", sessions[0].UserAgent)
+	assert.Equal(t, laptop.SessionID, sessions[1].ID)
+	assert.Equal(t, "203.0.113.2", sessions[1].IPAddress)
+
+	sessions, err = db.ListSessions(ctx, testAccount.ID, expiresAt)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	err = db.DeleteSession(ctx, testAccount.ID, laptop.SessionID)
+	require.NoError(t, err)
+	err = db.DeleteSession(ctx, testAccount.ID, laptop.SessionID)
+	require.ErrorIs(t, err, ErrSessionNotFound)
+	err = db.DeleteSession(ctx, testAccount.ID, uuid.NewString())
+	require.ErrorIs(t, err, ErrSessionNotFound)
+
+	sessions, err = db.ListSessions(ctx, testAccount.ID, time.Now())
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "phone", sessions[0].UserAgent)
+}
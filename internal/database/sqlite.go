@@ -0,0 +1,3074 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed sqlite_schema.sql
+var sqliteSchema string
+
+// sqliteTimeLayout is how timestamps are stored. Times are always written in UTC with every
+// fractional digit, so comparing them as text compares them as times.
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000000-07:00"
+
+// SQLiteDB keeps everything in a SQLite database file, for small single instance deployments
+// and integration tests without Postgres. It behaves like DB: changes DB makes in one statement
+// are made in one transaction instead.
+type SQLiteDB struct {
+	pool *sqlx.DB
+	// client runs the queries: the pool, or the transaction of a SQLiteDB handed out by WithTx
+	client querier
+	// tx is the transaction client is, nil outside of WithTx
+	tx *sqlx.Tx
+	// relayMu is held while relaying, like DB's advisory lock. Only one process should use a
+	// database file anyway.
+	relayMu *sync.Mutex
+	timeNow func() time.Time
+}
+
+// NewSQLiteDB opens the SQLite database at path, creating it and its tables if they don't exist
+func NewSQLiteDB(path string) (*SQLiteDB, error) {
+	ctx := context.Background()
+
+	// writers wait for each other rather than failing, and transactions take the write lock up
+	// front so they can't deadlock upgrading to it
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	client, err := sqlx.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	if _, err := client.ExecContext(ctx, sqliteSchema); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to create sqlite schema: %w", err)
+	}
+	if err := addSQLiteColumns(ctx, client); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	return &SQLiteDB{pool: client, client: client, relayMu: &sync.Mutex{}, timeNow: time.Now}, nil
+}
+
+// sqliteAddedColumns were added to the schema after their tables. The schema only creates tables
+// that don't exist, so files created before a column was added get it on open.
+var sqliteAddedColumns = []struct{ table, column, definition string }{
+	{"audit_events", "details", "TEXT"},
+	{"accounts", "display_name", "TEXT NOT NULL DEFAULT ''"},
+	{"accounts", "given_name", "TEXT NOT NULL DEFAULT ''"},
+	{"accounts", "family_name", "TEXT NOT NULL DEFAULT ''"},
+	{"accounts", "timezone", "TEXT NOT NULL DEFAULT ''"},
+	{"accounts", "avatar_url", "TEXT NOT NULL DEFAULT ''"},
+	{"accounts", "user_metadata", "TEXT NOT NULL DEFAULT '{}'"},
+	{"accounts", "app_metadata", "TEXT NOT NULL DEFAULT '{}'"},
+	{"accounts", "username", "TEXT NOT NULL DEFAULT ''"},
+	{"accounts", "erased_at", "TIMESTAMP"},
+	{"refresh_tokens", "scopes", "TEXT NOT NULL DEFAULT '[]'"},
+}
+
+// sqliteAddedIndexes are on sqliteAddedColumns, so they're created once the columns exist
+var sqliteAddedIndexes = []string{
+	// a deleted account's username can be taken again
+	`CREATE UNIQUE INDEX IF NOT EXISTS accounts_username_key ON accounts (lower(username)) WHERE username <> '' AND deleted_at IS NULL;`,
+}
+
+func addSQLiteColumns(ctx context.Context, client *sqlx.DB) error {
+	for _, c := range sqliteAddedColumns {
+		var exists bool
+		err := client.GetContext(ctx, &exists, `SELECT COUNT(*) > 0 FROM pragma_table_info(?1) WHERE name = ?2`, c.table, c.column)
+		if err != nil {
+			return fmt.Errorf("failed to check sqlite schema: %w", err)
+		}
+		if exists {
+			continue
+		}
+		if _, err := client.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return fmt.Errorf("failed to add %s.%s to sqlite schema: %w", c.table, c.column, err)
+		}
+	}
+	for _, index := range sqliteAddedIndexes {
+		if _, err := client.ExecContext(ctx, index); err != nil {
+			return fmt.Errorf("failed to add index to sqlite schema: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteDB) Close() error {
+	return s.pool.Close()
+}
+
+func (s *SQLiteDB) HealthCheck(ctx context.Context) error {
+	return s.pool.PingContext(ctx)
+}
+
+// WithTx runs fn in a transaction, committed if fn returns nil and rolled back otherwise. Like
+// DB's, the Repository fn is given runs everything in the transaction.
+func (s *SQLiteDB) WithTx(ctx context.Context, fn func(tx Repository) error) error {
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		return fn(&SQLiteDB{pool: s.pool, client: tx, tx: tx, relayMu: s.relayMu, timeNow: s.timeNow})
+	})
+}
+
+// now is the current time as it's stored
+func (s *SQLiteDB) now() (time.Time, string) {
+	now := s.timeNow().UTC()
+	return now, sqliteTime(now)
+}
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// sqliteNullTime maps the zero time to NULL for optional query parameters
+func sqliteNullTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	s := sqliteTime(t)
+	return &s
+}
+
+// sqliteKeysetArgs are the query parameters for a "(? IS NULL OR (created_at, id) < (?, ?))"
+// condition and "LIMIT ?", where -1 is no limit
+func sqliteKeysetArgs(k Keyset) (*string, *string, int) {
+	limit := -1
+	if k.Limit > 0 {
+		limit = k.Limit
+	}
+	return sqliteNullTime(k.BeforeCreatedAt), nullString(k.BeforeID), limit
+}
+
+// sqliteJSON encodes a parameter stored as JSON text, or read with json_each
+func sqliteJSON(v any) string {
+	// only maps and slices of strings and bools, and metadata that was decoded from JSON, are
+	// stored, which always encode
+	encoded, _ := json.Marshal(v)
+	return string(encoded)
+}
+
+// sqliteUniqueViolation reports whether err is a unique or primary key constraint failing. SQLite
+// doesn't say which constraint, so callers have to know which one the statement can violate.
+func sqliteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// inTx runs fn in a transaction, committed if it returns nil. Within WithTx it runs in WithTx's
+// transaction.
+func (s *SQLiteDB) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	tx, err := s.pool.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// addAccountOutboxEvent adds an account event to the outbox in the transaction making the change
+func (s *SQLiteDB) addAccountOutboxEvent(ctx context.Context, tx *sqlx.Tx, eventType string, account Account) error {
+	return s.addOutboxEvent(ctx, tx, eventType, account.ID, map[string]string{
+		"account_id": account.ID,
+		"email":      account.Email,
+	})
+}
+
+func (s *SQLiteDB) addOutboxEvent(ctx context.Context, tx *sqlx.Tx, eventType, accountID string, payload map[string]string) error {
+	_, now := s.now()
+	_, err := tx.ExecContext(ctx, sqliteInsertOutboxEventSQL, uuid.NewString(), eventType, accountID, sqliteJSON(payload), now)
+	if err != nil {
+		return fmt.Errorf("error adding outbox event: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CreateAccount(ctx context.Context, params AccountCreationParams) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateAccount")
+	defer span.End()
+
+	_, now := s.now()
+	var verifiedAt *string
+	if params.Verified {
+		verifiedAt = &now
+	}
+
+	var result Account
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		// the unique violation wouldn't say whether it's the email or the username
+		if err := s.checkUsernameAvailable(ctx, tx, params.Username, ""); err != nil {
+			return err
+		}
+		err := tx.GetContext(ctx, &result, sqliteCreateAccountSQL,
+			uuid.NewString(), params.Email, params.Username, params.PasswordHash, params.PreferredLocale, verifiedAt, now)
+		if err != nil {
+			if sqliteUniqueViolation(err) {
+				return ErrAccountAlreadyExists
+			}
+			return fmt.Errorf("error executing create account query: %w", err)
+		}
+		return s.addAccountOutboxEvent(ctx, tx, OutboxEventAccountCreated, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetAccount(ctx context.Context, email string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetAccount")
+	defer span.End()
+
+	var result Account
+	err := s.client.GetContext(ctx, &result, sqliteGetAccountSQL, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error getting account: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetAccountByUsername(ctx context.Context, username string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetAccountByUsername")
+	defer span.End()
+
+	var result Account
+	err := s.client.GetContext(ctx, &result, sqliteGetAccountByUsernameSQL, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error getting account: %w", err)
+	}
+	return &result, nil
+}
+
+// checkUsernameAvailable fails with ErrUsernameTaken when an account other than exceptID has
+// username
+func (s *SQLiteDB) checkUsernameAvailable(ctx context.Context, tx *sqlx.Tx, username, exceptID string) error {
+	if username == "" {
+		return nil
+	}
+	var taken bool
+	if err := tx.GetContext(ctx, &taken, sqliteUsernameTakenSQL, username, exceptID); err != nil {
+		return fmt.Errorf("error checking username: %w", err)
+	}
+	if taken {
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+func (s *SQLiteDB) GetAccountByID(ctx context.Context, id string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetAccountByID")
+	defer span.End()
+
+	var result Account
+	err := s.client.GetContext(ctx, &result, sqliteGetAccountByIDSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error getting account: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetAccountsByIDs(ctx context.Context, ids []string) ([]Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetAccountsByIDs")
+	defer span.End()
+
+	var result []Account
+	err := s.client.SelectContext(ctx, &result, sqliteGetAccountsByIDsSQL, sqliteJSON(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error getting accounts by ID: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) GetAccountsByEmails(ctx context.Context, emails []string) ([]Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetAccountsByEmails")
+	defer span.End()
+
+	var result []Account
+	err := s.client.SelectContext(ctx, &result, sqliteGetAccountsByEmailsSQL, sqliteJSON(emails))
+	if err != nil {
+		return nil, fmt.Errorf("error getting accounts by email: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) ListAccounts(ctx context.Context, params ListAccountsParams) ([]Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListAccounts")
+	defer span.End()
+
+	beforeCreatedAt, beforeID, limit := sqliteKeysetArgs(params.Keyset)
+	var result []Account
+	err := s.client.SelectContext(ctx, &result, sqliteListAccountsSQL,
+		nullString(params.Tag),
+		beforeCreatedAt,
+		beforeID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing accounts: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) UpdatePassword(ctx context.Context, id, passwordHash string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "UpdatePassword")
+	defer span.End()
+
+	_, now := s.now()
+	var result Account
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqliteDeleteRefreshTokensSQL, id); err != nil {
+			return fmt.Errorf("error updating password: %w", err)
+		}
+		if err := tx.GetContext(ctx, &result, sqliteUpdatePasswordSQL, id, passwordHash, now); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error updating password: %w", err)
+		}
+		return s.addAccountOutboxEvent(ctx, tx, OutboxEventAccountPasswordChanged, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) RehashPassword(ctx context.Context, id, oldHash, newHash string) error {
+	ctx, span := startSQLiteSpan(ctx, "RehashPassword")
+	defer span.End()
+
+	if _, err := s.client.ExecContext(ctx, sqliteRehashPasswordSQL, id, oldHash, newHash); err != nil {
+		return fmt.Errorf("error rehashing password: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) AddAccountTags(ctx context.Context, id string, tags []string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "AddAccountTags")
+	defer span.End()
+
+	_, now := s.now()
+	var result Account
+	err := s.client.GetContext(ctx, &result, sqliteAddAccountTagsSQL, id, sqliteJSON(tags), now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error adding account tags: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) RemoveAccountTag(ctx context.Context, id, tag string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "RemoveAccountTag")
+	defer span.End()
+
+	_, now := s.now()
+	var result Account
+	err := s.client.GetContext(ctx, &result, sqliteRemoveAccountTagSQL, id, tag, now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error removing account tag: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) UpdateAccountFeatureFlags(ctx context.Context, id string, set map[string]bool, unset []string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "UpdateAccountFeatureFlags")
+	defer span.End()
+
+	_, now := s.now()
+	var result Account
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var account Account
+		if err := tx.GetContext(ctx, &account, sqliteGetAccountByIDSQL, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error updating account feature flags: %w", err)
+		}
+
+		flags := maps.Clone(account.FeatureFlags)
+		if flags == nil {
+			flags = FeatureFlags{}
+		}
+		for _, name := range unset {
+			delete(flags, name)
+		}
+		maps.Copy(flags, set)
+
+		if err := tx.GetContext(ctx, &result, sqliteUpdateAccountFeatureFlagsSQL, id, sqliteJSON(flags), now); err != nil {
+			return fmt.Errorf("error updating account feature flags: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) UpdateAccountProfile(ctx context.Context, id string, params UpdateAccountProfileParams) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "UpdateAccountProfile")
+	defer span.End()
+
+	_, now := s.now()
+	var result Account
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if params.Username != nil {
+			if err := s.checkUsernameAvailable(ctx, tx, *params.Username, id); err != nil {
+				return err
+			}
+		}
+		return tx.GetContext(ctx, &result, sqliteUpdateAccountProfileSQL, id,
+			params.DisplayName, params.GivenName, params.FamilyName, params.PreferredLocale, params.Timezone, params.AvatarURL, params.Username, now)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		if errors.Is(err, ErrUsernameTaken) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error updating account profile: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) UpdateAccountMetadata(ctx context.Context, id string, params UpdateAccountMetadataParams) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "UpdateAccountMetadata")
+	defer span.End()
+
+	_, now := s.now()
+	var result Account
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var account Account
+		if err := tx.GetContext(ctx, &account, sqliteGetAccountByIDSQL, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error updating account metadata: %w", err)
+		}
+
+		userMetadata := account.UserMetadata.Apply(params.SetUserMetadata, params.UnsetUserMetadata)
+		appMetadata := account.AppMetadata.Apply(params.SetAppMetadata, params.UnsetAppMetadata)
+		err := tx.GetContext(ctx, &result, sqliteUpdateAccountMetadataSQL, id, sqliteJSON(userMetadata), sqliteJSON(appMetadata), now)
+		if err != nil {
+			return fmt.Errorf("error updating account metadata: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) DeleteAccount(ctx context.Context, id string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteAccount")
+	defer span.End()
+
+	_, now := s.now()
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		for _, query := range sqliteDeleteAccountDataSQL {
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return fmt.Errorf("error deleting account: %w", err)
+			}
+		}
+
+		var account Account
+		if err := tx.GetContext(ctx, &account, sqliteDeleteAccountSQL, id, now); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error deleting account: %w", err)
+		}
+		return s.addAccountOutboxEvent(ctx, tx, OutboxEventAccountDeleted, account)
+	})
+}
+
+func (s *SQLiteDB) PurgeDeletedAccounts(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, span := startSQLiteSpan(ctx, "PurgeDeletedAccounts")
+	defer span.End()
+
+	var purged []Account
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.SelectContext(ctx, &purged, sqlitePurgeDeletedAccountsSQL, sqliteTime(deletedBefore)); err != nil {
+			return fmt.Errorf("error purging deleted accounts: %w", err)
+		}
+		for _, account := range purged {
+			if err := s.addAccountOutboxEvent(ctx, tx, OutboxEventAccountPurged, account); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(purged)), nil
+}
+
+func (s *SQLiteDB) EraseAccount(ctx context.Context, id string) error {
+	ctx, span := startSQLiteSpan(ctx, "EraseAccount")
+	defer span.End()
+
+	_, now := s.now()
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var requestID string
+		if err := tx.GetContext(ctx, &requestID, sqliteTakeDeletionRequestSQL, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrDeletionRequestNotFound
+			}
+			return fmt.Errorf("error erasing account: %w", err)
+		}
+
+		for _, query := range slices.Concat(sqliteDeleteAccountDataSQL, sqliteEraseAccountDataSQL) {
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return fmt.Errorf("error erasing account: %w", err)
+			}
+		}
+
+		var account Account
+		if err := tx.GetContext(ctx, &account, sqliteEraseAccountSQL, id, now); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error erasing account: %w", err)
+		}
+		return s.addAccountOutboxEvent(ctx, tx, OutboxEventAccountErased, account)
+	})
+}
+
+func (s *SQLiteDB) CreateDeletionRequest(ctx context.Context, accountID string, eraseAt time.Time) (*DeletionRequest, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateDeletionRequest")
+	defer span.End()
+
+	_, now := s.now()
+	var result DeletionRequest
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var account Account
+		if err := tx.GetContext(ctx, &account, sqliteGetAccountByIDSQL, accountID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error creating deletion request: %w", err)
+		}
+
+		err := tx.GetContext(ctx, &result, sqliteCreateDeletionRequestSQL, accountID, sqliteTime(eraseAt), now)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrDeletionAlreadyRequested
+			}
+			return fmt.Errorf("error creating deletion request: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetDeletionRequest(ctx context.Context, accountID string) (*DeletionRequest, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetDeletionRequest")
+	defer span.End()
+
+	var result DeletionRequest
+	if err := s.client.GetContext(ctx, &result, sqliteGetDeletionRequestSQL, accountID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDeletionRequestNotFound
+		}
+		return nil, fmt.Errorf("error getting deletion request: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) CancelDeletionRequest(ctx context.Context, accountID string) (*DeletionRequest, error) {
+	ctx, span := startSQLiteSpan(ctx, "CancelDeletionRequest")
+	defer span.End()
+
+	var result DeletionRequest
+	if err := s.client.GetContext(ctx, &result, sqliteCancelDeletionRequestSQL, accountID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDeletionRequestNotFound
+		}
+		return nil, fmt.Errorf("error cancelling deletion request: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) ListDueDeletionRequests(ctx context.Context, eraseBefore time.Time, limit int) ([]DeletionRequest, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListDueDeletionRequests")
+	defer span.End()
+
+	result := []DeletionRequest{}
+	if err := s.client.SelectContext(ctx, &result, sqliteListDueDeletionRequestsSQL, sqliteTime(eraseBefore), limit); err != nil {
+		return nil, fmt.Errorf("error listing due deletion requests: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) ListDeletionRemindersDue(ctx context.Context, eraseBefore time.Time, limit int) ([]DeletionRequest, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListDeletionRemindersDue")
+	defer span.End()
+
+	result := []DeletionRequest{}
+	if err := s.client.SelectContext(ctx, &result, sqliteListDeletionRemindersDueSQL, sqliteTime(eraseBefore), limit); err != nil {
+		return nil, fmt.Errorf("error listing due deletion reminders: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) MarkDeletionReminderSent(ctx context.Context, accountID string, at time.Time) error {
+	ctx, span := startSQLiteSpan(ctx, "MarkDeletionReminderSent")
+	defer span.End()
+
+	if _, err := s.client.ExecContext(ctx, sqliteMarkDeletionReminderSentSQL, accountID, sqliteTime(at)); err != nil {
+		return fmt.Errorf("error marking deletion reminder sent: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) error {
+	ctx, span := startSQLiteSpan(ctx, "CreateRefreshToken")
+	defer span.End()
+
+	_, now := s.now()
+	sessionID := params.SessionID
+	if sessionID == "" {
+		sessionID = uuid.NewString()
+	}
+
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, sqliteCreateRefreshTokenSQL,
+			params.Token, params.AccountID, sqliteTime(params.ExpiresAt), sessionID, params.IPAddress, params.UserAgent, now,
+			sqliteJSON(nonNilStrings(params.Scopes)))
+		if err != nil {
+			return fmt.Errorf("error creating refresh token: %w", err)
+		}
+
+		// refreshes continue a session
+		if params.SessionID != "" {
+			return nil
+		}
+		return s.addOutboxEvent(ctx, tx, OutboxEventSessionStarted, params.AccountID, map[string]string{
+			"account_id": params.AccountID,
+			"session_id": sessionID,
+		})
+	})
+}
+
+func (s *SQLiteDB) GetRefreshToken(ctx context.Context, token string) (*RefreshToken, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetRefreshToken")
+	defer span.End()
+
+	var result RefreshToken
+	err := s.client.GetContext(ctx, &result, sqliteGetRefreshTokenSQL, token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("error getting refresh token: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) RotateRefreshToken(ctx context.Context, token string, at time.Time) (*RefreshToken, error) {
+	ctx, span := startSQLiteSpan(ctx, "RotateRefreshToken")
+	defer span.End()
+
+	var result RefreshToken
+	err := s.client.GetContext(ctx, &result, sqliteRotateRefreshTokenSQL, token, sqliteTime(at))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("error rotating refresh token: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) DeleteRefreshTokensByAccount(ctx context.Context, accountID string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteRefreshTokensByAccount")
+	defer span.End()
+
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, sqliteDeleteRefreshTokensSQL, accountID)
+		if err != nil {
+			return fmt.Errorf("error deleting refresh token: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		return s.addOutboxEvent(ctx, tx, OutboxEventSessionsRevoked, accountID, map[string]string{
+			"account_id": accountID,
+		})
+	})
+}
+
+func (s *SQLiteDB) DeleteRefreshTokenByToken(ctx context.Context, token string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteRefreshTokenByToken")
+	defer span.End()
+
+	if _, err := s.client.ExecContext(ctx, sqliteDeleteRefreshTokenByTokenSQL, token); err != nil {
+		return fmt.Errorf("error deleting refresh token: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CountActiveRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := startSQLiteSpan(ctx, "CountActiveRefreshTokens")
+	defer span.End()
+
+	var count int64
+	if err := s.client.GetContext(ctx, &count, sqliteCountActiveRefreshTokensSQL, sqliteTime(now)); err != nil {
+		return 0, fmt.Errorf("error counting active refresh tokens: %w", err)
+	}
+	return count, nil
+}
+
+func (s *SQLiteDB) PurgeExpiredRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := startSQLiteSpan(ctx, "PurgeExpiredRefreshTokens")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqlitePurgeExpiredRefreshTokensSQL, sqliteTime(now))
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired refresh tokens: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired refresh tokens: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteDB) ListSessions(ctx context.Context, accountID string, now time.Time) ([]Session, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListSessions")
+	defer span.End()
+
+	var tokens []RefreshToken
+	if err := s.client.SelectContext(ctx, &tokens, sqliteListRefreshTokensSQL, accountID); err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+	return groupSessions(tokens, now), nil
+}
+
+func (s *SQLiteDB) DeleteSession(ctx context.Context, accountID, sessionID string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteSession")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteDeleteSessionSQL, accountID, sessionID)
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteDB) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ctx, span := startSQLiteSpan(ctx, "RevokeAccessToken")
+	defer span.End()
+
+	_, now := s.now()
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqliteDeleteExpiredAccessTokensSQL, now); err != nil {
+			return fmt.Errorf("error revoking access token: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, sqliteRevokeAccessTokenSQL, tokenID, sqliteTime(expiresAt)); err != nil {
+			return fmt.Errorf("error revoking access token: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteDB) ClaimAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	ctx, span := startSQLiteSpan(ctx, "ClaimAccessToken")
+	defer span.End()
+
+	_, now := s.now()
+	var claimed int64
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqliteDeleteExpiredAccessTokensSQL, now); err != nil {
+			return fmt.Errorf("error claiming access token: %w", err)
+		}
+		result, err := tx.ExecContext(ctx, sqliteRevokeAccessTokenSQL, tokenID, sqliteTime(expiresAt))
+		if err != nil {
+			return fmt.Errorf("error claiming access token: %w", err)
+		}
+		if claimed, err = result.RowsAffected(); err != nil {
+			return fmt.Errorf("error claiming access token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return claimed == 1, nil
+}
+
+func (s *SQLiteDB) AccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	ctx, span := startSQLiteSpan(ctx, "AccessTokenRevoked")
+	defer span.End()
+
+	_, now := s.now()
+	var revoked bool
+	if err := s.client.GetContext(ctx, &revoked, sqliteAccessTokenRevokedSQL, tokenID, now); err != nil {
+		return false, fmt.Errorf("error checking access token revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+func (s *SQLiteDB) CreateAuditEvent(ctx context.Context, params CreateAuditEventParams) error {
+	ctx, span := startSQLiteSpan(ctx, "CreateAuditEvent")
+	defer span.End()
+
+	_, now := s.now()
+	_, err := s.client.ExecContext(ctx, sqliteCreateAuditEventSQL,
+		uuid.NewString(),
+		nullString(params.AccountID),
+		params.EventType,
+		nullString(params.ActorID),
+		params.IPAddress,
+		params.UserAgent,
+		params.RequestID,
+		now,
+		nullString(params.Details),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating audit event: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) ListAuditEvents(ctx context.Context, params ListAuditEventsParams) ([]AuditEvent, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListAuditEvents")
+	defer span.End()
+
+	beforeCreatedAt, beforeID, limit := sqliteKeysetArgs(params.Keyset)
+	var result []AuditEvent
+	err := s.client.SelectContext(ctx, &result, sqliteListAuditEventsSQL,
+		nullString(params.AccountID),
+		beforeCreatedAt,
+		beforeID,
+		limit,
+		sqliteNullTime(params.Since),
+		sqliteNullTime(params.Until),
+		nullString(params.EventType),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing audit events: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) PurgeAuditEvents(ctx context.Context, createdBefore time.Time) (int64, error) {
+	ctx, span := startSQLiteSpan(ctx, "PurgeAuditEvents")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqlitePurgeAuditEventsSQL, sqliteTime(createdBefore))
+	if err != nil {
+		return 0, fmt.Errorf("error purging audit events: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error purging audit events: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteDB) CreateAccountIdentity(ctx context.Context, params CreateAccountIdentityParams) (*AccountIdentity, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateAccountIdentity")
+	defer span.End()
+
+	_, now := s.now()
+	var result AccountIdentity
+	err := s.client.GetContext(ctx, &result, sqliteCreateAccountIdentitySQL,
+		uuid.NewString(), params.AccountID, params.Provider, params.Subject, params.Email, params.Name, now)
+	if err != nil {
+		if sqliteUniqueViolation(err) {
+			return nil, ErrAccountIdentityAlreadyExists
+		}
+		return nil, fmt.Errorf("error creating account identity: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetAccountIdentity(ctx context.Context, provider, subject string) (*AccountIdentity, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetAccountIdentity")
+	defer span.End()
+
+	var result AccountIdentity
+	err := s.client.GetContext(ctx, &result, sqliteGetAccountIdentitySQL, provider, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountIdentityNotFound
+		}
+		return nil, fmt.Errorf("error getting account identity: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) CreateEmailChange(ctx context.Context, params CreateEmailChangeParams) (*EmailChange, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateEmailChange")
+	defer span.End()
+
+	_, now := s.now()
+	var result EmailChange
+	err := s.client.GetContext(ctx, &result, sqliteCreateEmailChangeSQL,
+		uuid.NewString(),
+		params.AccountID,
+		params.NewEmail,
+		params.OldTokenHash,
+		params.NewTokenHash,
+		params.CancelTokenHash,
+		sqliteTime(params.ExpiresAt),
+		now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating email change: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetEmailChangeByTokenHash(ctx context.Context, tokenHash string) (*EmailChange, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetEmailChangeByTokenHash")
+	defer span.End()
+
+	var result EmailChange
+	err := s.client.GetContext(ctx, &result, sqliteGetEmailChangeByTokenHashSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEmailChangeNotFound
+		}
+		return nil, fmt.Errorf("error getting email change: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) ConfirmEmailChange(ctx context.Context, id string, side EmailChangeSide) (*EmailChange, error) {
+	ctx, span := startSQLiteSpan(ctx, "ConfirmEmailChange")
+	defer span.End()
+
+	query := sqliteConfirmOldEmailChangeSQL
+	if side == EmailChangeSideNew {
+		query = sqliteConfirmNewEmailChangeSQL
+	}
+
+	_, now := s.now()
+	var result EmailChange
+	err := s.client.GetContext(ctx, &result, query, id, now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEmailChangeNotFound
+		}
+		return nil, fmt.Errorf("error confirming email change: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) CompleteEmailChange(ctx context.Context, id string) (*EmailChange, error) {
+	ctx, span := startSQLiteSpan(ctx, "CompleteEmailChange")
+	defer span.End()
+
+	_, now := s.now()
+	var change EmailChange
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &change, sqliteDeleteEmailChangeReturningSQL, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrEmailChangeNotFound
+			}
+			return fmt.Errorf("error deleting email change: %w", err)
+		}
+
+		if !change.Confirmed() {
+			return fmt.Errorf("error completing email change: not confirmed by both addresses")
+		}
+
+		var account Account
+		err := tx.GetContext(ctx, &account, sqliteUpdateAccountEmailSQL, change.AccountID, change.NewEmail, now)
+		if errors.Is(err, sql.ErrNoRows) {
+			// the account was deleted in the meantime
+			return nil
+		}
+		if err != nil {
+			if sqliteUniqueViolation(err) {
+				return ErrAccountAlreadyExists
+			}
+			return fmt.Errorf("error updating account email: %w", err)
+		}
+		return s.addAccountOutboxEvent(ctx, tx, OutboxEventAccountEmailChanged, account)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+func (s *SQLiteDB) DeleteEmailChange(ctx context.Context, id string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteEmailChange")
+	defer span.End()
+
+	if _, err := s.client.ExecContext(ctx, sqliteDeleteEmailChangeSQL, id); err != nil {
+		return fmt.Errorf("error deleting email change: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CreateFreezeToken(ctx context.Context, params CreateFreezeTokenParams) error {
+	ctx, span := startSQLiteSpan(ctx, "CreateFreezeToken")
+	defer span.End()
+
+	_, now := s.now()
+	_, err := s.client.ExecContext(ctx, sqliteCreateFreezeTokenSQL,
+		params.TokenHash, params.AccountID, params.Purpose, sqliteTime(params.ExpiresAt), now)
+	if err != nil {
+		return fmt.Errorf("error creating freeze token: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) GetFreezeToken(ctx context.Context, tokenHash string) (*FreezeToken, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetFreezeToken")
+	defer span.End()
+
+	var result FreezeToken
+	err := s.client.GetContext(ctx, &result, sqliteGetFreezeTokenSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFreezeTokenNotFound
+		}
+		return nil, fmt.Errorf("error getting freeze token: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) FreezeAccount(ctx context.Context, id string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "FreezeAccount")
+	defer span.End()
+
+	now, nowText := s.now()
+	var result Account
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqliteDeleteRefreshTokensSQL, id); err != nil {
+			return fmt.Errorf("error freezing account: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, sqliteDeleteFreezeTokensSQL, id); err != nil {
+			return fmt.Errorf("error freezing account: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, sqliteDeleteTrustedDevicesSQL, id); err != nil {
+			return fmt.Errorf("error freezing account: %w", err)
+		}
+		if err := tx.GetContext(ctx, &result, sqliteFreezeAccountSQL, id, nowText); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error freezing account: %w", err)
+		}
+
+		// only accounts frozen just now
+		if result.FrozenAt == nil || !result.FrozenAt.Equal(now) {
+			return nil
+		}
+		return s.addAccountOutboxEvent(ctx, tx, OutboxEventAccountFrozen, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) UnfreezeAccount(ctx context.Context, id, passwordHash string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "UnfreezeAccount")
+	defer span.End()
+
+	_, now := s.now()
+	var result Account
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqliteDeleteFreezeTokensSQL, id); err != nil {
+			return fmt.Errorf("error unfreezing account: %w", err)
+		}
+		if err := tx.GetContext(ctx, &result, sqliteUnfreezeAccountSQL, id, passwordHash, now); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error unfreezing account: %w", err)
+		}
+		return s.addAccountOutboxEvent(ctx, tx, OutboxEventAccountUnfrozen, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) CreateEmailVerification(ctx context.Context, params CreateEmailVerificationParams) error {
+	ctx, span := startSQLiteSpan(ctx, "CreateEmailVerification")
+	defer span.End()
+
+	_, now := s.now()
+	_, err := s.client.ExecContext(ctx, sqliteCreateEmailVerificationSQL,
+		params.TokenHash, params.AccountID, params.Email, sqliteTime(params.ExpiresAt), now)
+	if err != nil {
+		return fmt.Errorf("error creating email verification: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) GetEmailVerification(ctx context.Context, tokenHash string) (*EmailVerification, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetEmailVerification")
+	defer span.End()
+
+	var result EmailVerification
+	err := s.client.GetContext(ctx, &result, sqliteGetEmailVerificationSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEmailVerificationNotFound
+		}
+		return nil, fmt.Errorf("error getting email verification: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) VerifyAccount(ctx context.Context, id string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "VerifyAccount")
+	defer span.End()
+
+	now, nowText := s.now()
+	var result Account
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqliteDeleteEmailVerificationsSQL, id); err != nil {
+			return fmt.Errorf("error verifying account: %w", err)
+		}
+		if err := dropUnverifiedSQLiteFederation(ctx, tx, id); err != nil {
+			return fmt.Errorf("error verifying account: %w", err)
+		}
+		if err := tx.GetContext(ctx, &result, sqliteVerifyAccountSQL, id, nowText); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error verifying account: %w", err)
+		}
+
+		// only accounts verified just now
+		if result.VerifiedAt == nil || !result.VerifiedAt.Equal(now) {
+			return nil
+		}
+		return s.addAccountOutboxEvent(ctx, tx, OutboxEventAccountVerified, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) PurgeExpiredEmailVerifications(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := startSQLiteSpan(ctx, "PurgeExpiredEmailVerifications")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqlitePurgeExpiredEmailVerificationsSQL, sqliteTime(now))
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired email verifications: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired email verifications: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteDB) CreatePasswordResetToken(ctx context.Context, params CreatePasswordResetTokenParams) error {
+	ctx, span := startSQLiteSpan(ctx, "CreatePasswordResetToken")
+	defer span.End()
+
+	_, now := s.now()
+	_, err := s.client.ExecContext(ctx, sqliteCreatePasswordResetTokenSQL,
+		params.TokenHash, params.AccountID, params.Email, sqliteTime(params.ExpiresAt), now)
+	if err != nil {
+		return fmt.Errorf("error creating password reset token: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) GetPasswordResetToken(ctx context.Context, tokenHash string) (*PasswordResetToken, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetPasswordResetToken")
+	defer span.End()
+
+	var result PasswordResetToken
+	err := s.client.GetContext(ctx, &result, sqliteGetPasswordResetTokenSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPasswordResetTokenNotFound
+		}
+		return nil, fmt.Errorf("error getting password reset token: %w", err)
+	}
+	return &result, nil
+}
+
+// dropUnverifiedSQLiteFederation is dropUnverifiedFederationSQL for an account that's about to
+// be verified in the transaction
+func dropUnverifiedSQLiteFederation(ctx context.Context, tx *sqlx.Tx, accountID string) error {
+	if _, err := tx.ExecContext(ctx, sqliteDropUnverifiedMembershipsSQL, accountID, OrganizationRoleOwner); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, sqliteDropUnverifiedFederatedIdentitiesSQL, accountID)
+	return err
+}
+
+func (s *SQLiteDB) ResetPassword(ctx context.Context, id, passwordHash string) (*Account, error) {
+	ctx, span := startSQLiteSpan(ctx, "ResetPassword")
+	defer span.End()
+
+	_, now := s.now()
+	var result Account
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqliteDeleteRefreshTokensSQL, id); err != nil {
+			return fmt.Errorf("error resetting password: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, sqliteDeletePasswordResetTokensSQL, id); err != nil {
+			return fmt.Errorf("error resetting password: %w", err)
+		}
+		if err := dropUnverifiedSQLiteFederation(ctx, tx, id); err != nil {
+			return fmt.Errorf("error resetting password: %w", err)
+		}
+		if err := tx.GetContext(ctx, &result, sqliteResetPasswordSQL, id, passwordHash, now); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrAccountNotFound
+			}
+			return fmt.Errorf("error resetting password: %w", err)
+		}
+		return s.addAccountOutboxEvent(ctx, tx, OutboxEventAccountPasswordChanged, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) PurgeExpiredPasswordResetTokens(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := startSQLiteSpan(ctx, "PurgeExpiredPasswordResetTokens")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqlitePurgeExpiredPasswordResetTokensSQL, sqliteTime(now))
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired password reset tokens: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired password reset tokens: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteDB) SetMFASecret(ctx context.Context, accountID, secret string) error {
+	ctx, span := startSQLiteSpan(ctx, "SetMFASecret")
+	defer span.End()
+
+	_, now := s.now()
+	res, err := s.client.ExecContext(ctx, sqliteSetMFASecretSQL, accountID, secret, now)
+	if err != nil {
+		return fmt.Errorf("error setting MFA secret: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error setting MFA secret: %w", err)
+	}
+	if n == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+func (s *SQLiteDB) GetMFASecret(ctx context.Context, accountID string) (*MFASecret, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetMFASecret")
+	defer span.End()
+
+	var result MFASecret
+	err := s.client.GetContext(ctx, &result, sqliteGetMFASecretSQL, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFASecretNotFound
+		}
+		return nil, fmt.Errorf("error getting MFA secret: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) EnableMFA(ctx context.Context, accountID string, step int64) (*MFASecret, error) {
+	ctx, span := startSQLiteSpan(ctx, "EnableMFA")
+	defer span.End()
+
+	_, now := s.now()
+	var result MFASecret
+	err := s.client.GetContext(ctx, &result, sqliteEnableMFASQL, accountID, step, now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFASecretNotFound
+		}
+		return nil, fmt.Errorf("error enabling MFA: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) UseMFAStep(ctx context.Context, accountID string, step int64) error {
+	ctx, span := startSQLiteSpan(ctx, "UseMFAStep")
+	defer span.End()
+
+	_, now := s.now()
+	res, err := s.client.ExecContext(ctx, sqliteUseMFAStepSQL, accountID, step, now)
+	if err != nil {
+		return fmt.Errorf("error using MFA code: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error using MFA code: %w", err)
+	}
+	if n == 0 {
+		return ErrMFACodeUsed
+	}
+	return nil
+}
+
+func (s *SQLiteDB) SetMFAPhone(ctx context.Context, accountID, phoneNumber string) error {
+	ctx, span := startSQLiteSpan(ctx, "SetMFAPhone")
+	defer span.End()
+
+	_, now := s.now()
+	res, err := s.client.ExecContext(ctx, sqliteSetMFAPhoneSQL, accountID, phoneNumber, now)
+	if err != nil {
+		return fmt.Errorf("error setting MFA phone: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error setting MFA phone: %w", err)
+	}
+	if n == 0 {
+		return ErrMFAPhoneAlreadyVerified
+	}
+	return nil
+}
+
+func (s *SQLiteDB) GetMFAPhone(ctx context.Context, accountID string) (*MFAPhone, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetMFAPhone")
+	defer span.End()
+
+	var result MFAPhone
+	err := s.client.GetContext(ctx, &result, sqliteGetMFAPhoneSQL, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFAPhoneNotFound
+		}
+		return nil, fmt.Errorf("error getting MFA phone: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) VerifyMFAPhone(ctx context.Context, accountID string) (*MFAPhone, error) {
+	ctx, span := startSQLiteSpan(ctx, "VerifyMFAPhone")
+	defer span.End()
+
+	_, now := s.now()
+	var result MFAPhone
+	err := s.client.GetContext(ctx, &result, sqliteVerifyMFAPhoneSQL, accountID, now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFAPhoneNotFound
+		}
+		return nil, fmt.Errorf("error verifying MFA phone: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) SetMFAPhoneCode(ctx context.Context, params SetMFAPhoneCodeParams) error {
+	ctx, span := startSQLiteSpan(ctx, "SetMFAPhoneCode")
+	defer span.End()
+
+	_, now := s.now()
+	res, err := s.client.ExecContext(ctx, sqliteSetMFAPhoneCodeSQL, params.AccountID, params.CodeHash,
+		sqliteTime(params.SentAt), sqliteTime(params.ExpiresAt), sqliteTime(params.LastSentBefore), now)
+	if err != nil {
+		return fmt.Errorf("error setting MFA phone code: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error setting MFA phone code: %w", err)
+	}
+	if n == 0 {
+		return ErrMFAPhoneCodeThrottled
+	}
+	return nil
+}
+
+func (s *SQLiteDB) UseMFAPhoneCode(ctx context.Context, accountID, codeHash string, at time.Time) error {
+	ctx, span := startSQLiteSpan(ctx, "UseMFAPhoneCode")
+	defer span.End()
+
+	_, now := s.now()
+	res, err := s.client.ExecContext(ctx, sqliteUseMFAPhoneCodeSQL, accountID, codeHash, sqliteTime(at), now)
+	if err != nil {
+		return fmt.Errorf("error using MFA phone code: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error using MFA phone code: %w", err)
+	}
+	if n == 0 {
+		return ErrMFAPhoneCodeInvalid
+	}
+	return nil
+}
+
+func (s *SQLiteDB) ReplaceMFARecoveryCodes(ctx context.Context, accountID string, codeHashes []string) error {
+	ctx, span := startSQLiteSpan(ctx, "ReplaceMFARecoveryCodes")
+	defer span.End()
+
+	_, now := s.now()
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqliteDeleteMFARecoveryCodesSQL, accountID); err != nil {
+			return fmt.Errorf("error deleting MFA recovery codes: %w", err)
+		}
+		for _, hash := range codeHashes {
+			if _, err := tx.ExecContext(ctx, sqliteCreateMFARecoveryCodeSQL, accountID, hash, now); err != nil {
+				return fmt.Errorf("error creating MFA recovery codes: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteDB) UseMFARecoveryCode(ctx context.Context, accountID, codeHash string) error {
+	ctx, span := startSQLiteSpan(ctx, "UseMFARecoveryCode")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteUseMFARecoveryCodeSQL, accountID, codeHash)
+	if err != nil {
+		return fmt.Errorf("error using MFA recovery code: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error using MFA recovery code: %w", err)
+	}
+	if n == 0 {
+		return ErrMFARecoveryCodeNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CountMFARecoveryCodes(ctx context.Context, accountID string) (int, error) {
+	ctx, span := startSQLiteSpan(ctx, "CountMFARecoveryCodes")
+	defer span.End()
+
+	var count int
+	if err := s.client.GetContext(ctx, &count, sqliteCountMFARecoveryCodesSQL, accountID); err != nil {
+		return 0, fmt.Errorf("error counting MFA recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+func (s *SQLiteDB) CreateOrganization(ctx context.Context, name, ownerID string) (*Organization, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateOrganization")
+	defer span.End()
+
+	_, now := s.now()
+	var result Organization
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &result, sqliteCreateOrganizationSQL, uuid.NewString(), name, now); err != nil {
+			return fmt.Errorf("error creating organization: %w", err)
+		}
+		_, err := tx.ExecContext(ctx, sqliteAddOrganizationMemberSQL, result.ID, ownerID, OrganizationRoleOwner, now)
+		if err != nil {
+			return fmt.Errorf("error creating organization: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetOrganization(ctx context.Context, id string) (*Organization, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetOrganization")
+	defer span.End()
+
+	var result Organization
+	err := s.client.GetContext(ctx, &result, sqliteGetOrganizationSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("error getting organization: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) ListAccountOrganizations(ctx context.Context, accountID string) ([]Organization, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListAccountOrganizations")
+	defer span.End()
+
+	result := []Organization{}
+	err := s.client.SelectContext(ctx, &result, sqliteListAccountOrganizationsSQL, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing account organizations: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) GetOrganizationMember(ctx context.Context, organizationID, accountID string) (*OrganizationMember, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetOrganizationMember")
+	defer span.End()
+
+	var result OrganizationMember
+	err := s.client.GetContext(ctx, &result, sqliteGetOrganizationMemberSQL, organizationID, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotOrganizationMember
+		}
+		return nil, fmt.Errorf("error getting organization member: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) CreateOrganizationInvitation(ctx context.Context, params CreateOrganizationInvitationParams) error {
+	ctx, span := startSQLiteSpan(ctx, "CreateOrganizationInvitation")
+	defer span.End()
+
+	_, now := s.now()
+	_, err := s.client.ExecContext(ctx, sqliteCreateOrganizationInvitationSQL,
+		params.TokenHash, params.OrganizationID, params.Email, params.Role, sqliteTime(params.ExpiresAt), now)
+	if err != nil {
+		return fmt.Errorf("error creating organization invitation: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) GetOrganizationInvitation(ctx context.Context, tokenHash string) (*OrganizationInvitation, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetOrganizationInvitation")
+	defer span.End()
+
+	var result OrganizationInvitation
+	err := s.client.GetContext(ctx, &result, sqliteGetOrganizationInvitationSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationInvitationNotFound
+		}
+		return nil, fmt.Errorf("error getting organization invitation: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) AcceptOrganizationInvitation(ctx context.Context, tokenHash, accountID string) (*OrganizationMember, error) {
+	ctx, span := startSQLiteSpan(ctx, "AcceptOrganizationInvitation")
+	defer span.End()
+
+	_, now := s.now()
+	var result OrganizationMember
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var invitation OrganizationInvitation
+		if err := tx.GetContext(ctx, &invitation, sqliteDeleteOrganizationInvitationSQL, tokenHash); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrOrganizationInvitationNotFound
+			}
+			return fmt.Errorf("error accepting organization invitation: %w", err)
+		}
+
+		// an account that's already a member keeps its role
+		_, err := tx.ExecContext(ctx, sqliteAddOrganizationMemberSQL+` ON CONFLICT DO NOTHING`,
+			invitation.OrganizationID, accountID, invitation.Role, now)
+		if err != nil {
+			return fmt.Errorf("error accepting organization invitation: %w", err)
+		}
+		if err := tx.GetContext(ctx, &result, sqliteGetOrganizationMemberSQL, invitation.OrganizationID, accountID); err != nil {
+			return fmt.Errorf("error accepting organization invitation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) AddOrganizationMember(ctx context.Context, organizationID, accountID, role string) (*OrganizationMember, error) {
+	ctx, span := startSQLiteSpan(ctx, "AddOrganizationMember")
+	defer span.End()
+
+	_, now := s.now()
+	var result OrganizationMember
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, sqliteAddOrganizationMemberSQL+` ON CONFLICT DO NOTHING`,
+			organizationID, accountID, role, now)
+		if err != nil {
+			return fmt.Errorf("error adding organization member: %w", err)
+		}
+		if err := tx.GetContext(ctx, &result, sqliteGetOrganizationMemberSQL, organizationID, accountID); err != nil {
+			return fmt.Errorf("error adding organization member: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) CreateRole(ctx context.Context, name, description string, permissions []string) (*Role, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateRole")
+	defer span.End()
+
+	_, now := s.now()
+	var result Role
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &result, sqliteCreateRoleSQL, name, description, now); err != nil {
+			if sqliteUniqueViolation(err) {
+				return ErrRoleAlreadyExists
+			}
+			return fmt.Errorf("error creating role: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, sqliteGrantPermissionsSQL, name, sqliteJSON(permissions)); err != nil {
+			return fmt.Errorf("error creating role: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Permissions = StringArray(slices.Compact(slices.Sorted(slices.Values(permissions))))
+	if result.Permissions == nil {
+		result.Permissions = StringArray{}
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetRole(ctx context.Context, name string) (*Role, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetRole")
+	defer span.End()
+
+	var result Role
+	err := s.client.GetContext(ctx, &result, sqliteGetRoleSQL, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, fmt.Errorf("error getting role: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) AssignRole(ctx context.Context, accountID, role string) error {
+	ctx, span := startSQLiteSpan(ctx, "AssignRole")
+	defer span.End()
+
+	_, now := s.now()
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var found bool
+		if err := tx.GetContext(ctx, &found, sqliteRoleExistsSQL, role); err != nil {
+			return fmt.Errorf("error assigning role: %w", err)
+		}
+		if !found {
+			return ErrRoleNotFound
+		}
+		if _, err := tx.ExecContext(ctx, sqliteAssignRoleSQL, accountID, role, now); err != nil {
+			return fmt.Errorf("error assigning role: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteDB) UnassignRole(ctx context.Context, accountID, role string) error {
+	ctx, span := startSQLiteSpan(ctx, "UnassignRole")
+	defer span.End()
+
+	if _, err := s.client.ExecContext(ctx, sqliteUnassignRoleSQL, accountID, role); err != nil {
+		return fmt.Errorf("error unassigning role: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) GetAccountRoles(ctx context.Context, accountID string) ([]string, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetAccountRoles")
+	defer span.End()
+
+	roles := []string{}
+	if err := s.client.SelectContext(ctx, &roles, sqliteGetAccountRolesSQL, accountID); err != nil {
+		return nil, fmt.Errorf("error getting account roles: %w", err)
+	}
+	return roles, nil
+}
+
+func (s *SQLiteDB) CreateWebhookEndpoint(ctx context.Context, params CreateWebhookEndpointParams) (*WebhookEndpoint, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateWebhookEndpoint")
+	defer span.End()
+
+	eventTypes := params.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	_, now := s.now()
+	var result WebhookEndpoint
+	err := s.client.GetContext(ctx, &result, sqliteCreateWebhookEndpointSQL,
+		uuid.NewString(), params.URL, params.Secret, sqliteJSON(eventTypes), now)
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook endpoint: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetWebhookEndpoint(ctx context.Context, id string) (*WebhookEndpoint, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetWebhookEndpoint")
+	defer span.End()
+
+	var result WebhookEndpoint
+	err := s.client.GetContext(ctx, &result, sqliteGetWebhookEndpointSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookEndpointNotFound
+		}
+		return nil, fmt.Errorf("error getting webhook endpoint: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListWebhookEndpoints")
+	defer span.End()
+
+	var result []WebhookEndpoint
+	if err := s.client.SelectContext(ctx, &result, sqliteListWebhookEndpointsSQL); err != nil {
+		return nil, fmt.Errorf("error listing webhook endpoints: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) DeleteWebhookEndpoint(ctx context.Context, id string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteWebhookEndpoint")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteDeleteWebhookEndpointSQL, id)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook endpoint: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrWebhookEndpointNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CreateWebhookDeliveries(ctx context.Context, eventType, payload string) (int64, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateWebhookDeliveries")
+	defer span.End()
+
+	_, now := s.now()
+	var created int64
+	err := s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var endpointIDs []string
+		if err := tx.SelectContext(ctx, &endpointIDs, sqliteSubscribedWebhookEndpointsSQL, eventType); err != nil {
+			return fmt.Errorf("error creating webhook deliveries: %w", err)
+		}
+		for _, endpointID := range endpointIDs {
+			_, err := tx.ExecContext(ctx, sqliteCreateWebhookDeliverySQL, uuid.NewString(), endpointID, eventType, payload, now)
+			if err != nil {
+				return fmt.Errorf("error creating webhook deliveries: %w", err)
+			}
+		}
+		created = int64(len(endpointIDs))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return created, nil
+}
+
+func (s *SQLiteDB) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	ctx, span := startSQLiteSpan(ctx, "ClaimWebhookDeliveries")
+	defer span.End()
+
+	// a single statement holds the write lock throughout, so there's nothing to skip
+	var result []WebhookDelivery
+	err := s.client.SelectContext(ctx, &result, sqliteClaimWebhookDeliveriesSQL, sqliteTime(now), sqliteTime(now.Add(lease)), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) RecordWebhookAttempt(ctx context.Context, id string, attempt WebhookAttempt) error {
+	ctx, span := startSQLiteSpan(ctx, "RecordWebhookAttempt")
+	defer span.End()
+
+	_, err := s.client.ExecContext(ctx, sqliteRecordWebhookAttemptSQL,
+		id,
+		attempt.Status,
+		sqliteTime(attempt.NextAttemptAt),
+		attempt.LastStatusCode,
+		nullString(attempt.LastError),
+		sqliteTime(attempt.At),
+	)
+	if err != nil {
+		return fmt.Errorf("error recording webhook attempt: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetWebhookDelivery")
+	defer span.End()
+
+	var result WebhookDelivery
+	err := s.client.GetContext(ctx, &result, sqliteGetWebhookDeliverySQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, fmt.Errorf("error getting webhook delivery: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListWebhookDeliveries")
+	defer span.End()
+
+	beforeCreatedAt, beforeID, limit := sqliteKeysetArgs(params.Keyset)
+	var result []WebhookDelivery
+	err := s.client.SelectContext(ctx, &result, sqliteListWebhookDeliveriesSQL, params.EndpointID, beforeCreatedAt, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhook deliveries: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) ReplayWebhookDelivery(ctx context.Context, id string, now time.Time) (*WebhookDelivery, error) {
+	ctx, span := startSQLiteSpan(ctx, "ReplayWebhookDelivery")
+	defer span.End()
+
+	var result WebhookDelivery
+	err := s.client.GetContext(ctx, &result, sqliteReplayWebhookDeliverySQL, id, sqliteTime(now))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, fmt.Errorf("error replaying webhook delivery: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) RelayOutboxEvents(ctx context.Context, limit int, publish func(ctx context.Context, events []OutboxEvent) error) (int, error) {
+	ctx, span := startSQLiteSpan(ctx, "RelayOutboxEvents")
+	defer span.End()
+
+	if !s.relayMu.TryLock() {
+		return 0, nil
+	}
+	defer s.relayMu.Unlock()
+
+	// publish outside a transaction so writes aren't blocked while the broker is slow
+	var events []OutboxEvent
+	if err := s.client.SelectContext(ctx, &events, sqliteListUnpublishedOutboxEventsSQL, limit); err != nil {
+		return 0, fmt.Errorf("error listing outbox events: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(ctx, events); err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	_, now := s.now()
+	if _, err := s.client.ExecContext(ctx, sqliteMarkOutboxEventsPublishedSQL, now, sqliteJSON(ids)); err != nil {
+		return 0, fmt.Errorf("error marking outbox events published: %w", err)
+	}
+	return len(events), nil
+}
+
+func (s *SQLiteDB) PurgeOutboxEvents(ctx context.Context, createdBefore time.Time, unpublished bool) (int64, error) {
+	ctx, span := startSQLiteSpan(ctx, "PurgeOutboxEvents")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqlitePurgeOutboxEventsSQL, sqliteTime(createdBefore), unpublished)
+	if err != nil {
+		return 0, fmt.Errorf("error purging outbox events: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error purging outbox events: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteDB) CreateAPIKey(ctx context.Context, params CreateAPIKeyParams) (*APIKey, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateAPIKey")
+	defer span.End()
+
+	scopes := params.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	_, now := s.now()
+	var result APIKey
+	err := s.client.GetContext(ctx, &result, sqliteCreateAPIKeySQL,
+		uuid.NewString(), params.AccountID, params.Name, params.Prefix, params.KeyHash,
+		sqliteJSON(scopes), sqliteNullTime(params.ExpiresAt), now)
+	if err != nil {
+		return nil, fmt.Errorf("error creating api key: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) ListAPIKeys(ctx context.Context, accountID string) ([]APIKey, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListAPIKeys")
+	defer span.End()
+
+	var result []APIKey
+	if err := s.client.SelectContext(ctx, &result, sqliteListAPIKeysSQL, accountID); err != nil {
+		return nil, fmt.Errorf("error listing api keys: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetAPIKeyByHash")
+	defer span.End()
+
+	var result APIKey
+	err := s.client.GetContext(ctx, &result, sqliteGetAPIKeyByHashSQL, keyHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("error getting api key: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	ctx, span := startSQLiteSpan(ctx, "TouchAPIKey")
+	defer span.End()
+
+	if _, err := s.client.ExecContext(ctx, sqliteTouchAPIKeySQL, id, sqliteTime(at)); err != nil {
+		return fmt.Errorf("error touching api key: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) DeleteAPIKey(ctx context.Context, accountID, id string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteAPIKey")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteDeleteAPIKeySQL, accountID, id)
+	if err != nil {
+		return fmt.Errorf("error deleting api key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CreateKnownDevice(ctx context.Context, params CreateKnownDeviceParams) (*KnownDevice, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateKnownDevice")
+	defer span.End()
+
+	_, now := s.now()
+	var result KnownDevice
+	err := s.client.GetContext(ctx, &result, sqliteCreateKnownDeviceSQL,
+		uuid.NewString(), params.AccountID, params.DeviceHash, params.Location, params.IPAddress,
+		params.UserAgent, params.SessionID, params.RevokeTokenHash, now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrKnownDeviceExists
+		}
+		return nil, fmt.Errorf("error creating known device: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) TouchKnownDevice(ctx context.Context, params TouchKnownDeviceParams) error {
+	ctx, span := startSQLiteSpan(ctx, "TouchKnownDevice")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteTouchKnownDeviceSQL,
+		params.AccountID, params.DeviceHash, params.Location, params.IPAddress, params.UserAgent, sqliteTime(params.At))
+	if err != nil {
+		return fmt.Errorf("error touching known device: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrKnownDeviceNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CountKnownDevices(ctx context.Context, accountID string) (int, error) {
+	ctx, span := startSQLiteSpan(ctx, "CountKnownDevices")
+	defer span.End()
+
+	var n int
+	if err := s.client.GetContext(ctx, &n, sqliteCountKnownDevicesSQL, accountID); err != nil {
+		return 0, fmt.Errorf("error counting known devices: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteDB) GetKnownDeviceByRevokeTokenHash(ctx context.Context, tokenHash string) (*KnownDevice, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetKnownDeviceByRevokeTokenHash")
+	defer span.End()
+
+	var result KnownDevice
+	err := s.client.GetContext(ctx, &result, sqliteGetKnownDeviceByRevokeTokenHashSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrKnownDeviceNotFound
+		}
+		return nil, fmt.Errorf("error getting known device: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) DeleteKnownDevice(ctx context.Context, id string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteKnownDevice")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteDeleteKnownDeviceSQL, id)
+	if err != nil {
+		return fmt.Errorf("error deleting known device: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrKnownDeviceNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CreateTrustedDevice(ctx context.Context, params CreateTrustedDeviceParams) (*TrustedDevice, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateTrustedDevice")
+	defer span.End()
+
+	_, now := s.now()
+	var result TrustedDevice
+	err := s.client.GetContext(ctx, &result, sqliteCreateTrustedDeviceSQL,
+		uuid.NewString(), params.AccountID, params.DeviceHash, params.IPAddress, params.UserAgent,
+		sqliteTime(params.ExpiresAt), now)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trusted device: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) UseTrustedDevice(ctx context.Context, params UseTrustedDeviceParams) error {
+	ctx, span := startSQLiteSpan(ctx, "UseTrustedDevice")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteUseTrustedDeviceSQL,
+		params.ID, params.AccountID, params.DeviceHash, sqliteTime(params.At))
+	if err != nil {
+		return fmt.Errorf("error using trusted device: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrTrustedDeviceNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteDB) ListTrustedDevices(ctx context.Context, accountID string, now time.Time) ([]TrustedDevice, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListTrustedDevices")
+	defer span.End()
+
+	var result []TrustedDevice
+	if err := s.client.SelectContext(ctx, &result, sqliteListTrustedDevicesSQL, accountID, sqliteTime(now)); err != nil {
+		return nil, fmt.Errorf("error listing trusted devices: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) DeleteTrustedDevice(ctx context.Context, accountID, id string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteTrustedDevice")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteDeleteTrustedDeviceSQL, accountID, id)
+	if err != nil {
+		return fmt.Errorf("error deleting trusted device: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrTrustedDeviceNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteDB) DeleteTrustedDevices(ctx context.Context, accountID string) (int64, error) {
+	ctx, span := startSQLiteSpan(ctx, "DeleteTrustedDevices")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteDeleteTrustedDevicesSQL, accountID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting trusted devices: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteDB) PurgeExpiredTrustedDevices(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := startSQLiteSpan(ctx, "PurgeExpiredTrustedDevices")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqlitePurgeExpiredTrustedDevicesSQL, sqliteTime(now))
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired trusted devices: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteDB) CreateOAuthClient(ctx context.Context, params CreateOAuthClientParams) (*OAuthClient, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateOAuthClient")
+	defer span.End()
+
+	_, now := s.now()
+	var result OAuthClient
+	err := s.client.GetContext(ctx, &result, sqliteCreateOAuthClientSQL,
+		uuid.NewString(), params.Name, nullString(params.SecretHash), sqliteJSON(nonNilStrings(params.RedirectURIs)),
+		sqliteJSON(nonNilStrings(params.GrantTypes)), sqliteJSON(nonNilStrings(params.Scopes)), now)
+	if err != nil {
+		return nil, fmt.Errorf("error creating oauth client: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetOAuthClient(ctx context.Context, id string) (*OAuthClient, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetOAuthClient")
+	defer span.End()
+
+	var result OAuthClient
+	err := s.client.GetContext(ctx, &result, sqliteGetOAuthClientSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOAuthClientNotFound
+		}
+		return nil, fmt.Errorf("error getting oauth client: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) ListOAuthClients(ctx context.Context) ([]OAuthClient, error) {
+	ctx, span := startSQLiteSpan(ctx, "ListOAuthClients")
+	defer span.End()
+
+	var result []OAuthClient
+	if err := s.client.SelectContext(ctx, &result, sqliteListOAuthClientsSQL); err != nil {
+		return nil, fmt.Errorf("error listing oauth clients: %w", err)
+	}
+	return result, nil
+}
+
+func (s *SQLiteDB) DeleteOAuthClient(ctx context.Context, id string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteOAuthClient")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteDeleteOAuthClientSQL, id)
+	if err != nil {
+		return fmt.Errorf("error deleting oauth client: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CreateOAuthAuthorizationCode(ctx context.Context, params CreateOAuthAuthorizationCodeParams) error {
+	ctx, span := startSQLiteSpan(ctx, "CreateOAuthAuthorizationCode")
+	defer span.End()
+
+	_, now := s.now()
+	return s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqliteDeleteExpiredOAuthAuthorizationCodesSQL, now); err != nil {
+			return fmt.Errorf("error creating oauth authorization code: %w", err)
+		}
+		_, err := tx.ExecContext(ctx, sqliteCreateOAuthAuthorizationCodeSQL, params.CodeHash, params.ClientID,
+			params.AccountID, params.RedirectURI, sqliteJSON(nonNilStrings(params.Scopes)), params.CodeChallenge,
+			params.Nonce, sqliteTime(params.AuthTime), sqliteTime(params.ExpiresAt), now)
+		if err != nil {
+			return fmt.Errorf("error creating oauth authorization code: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteDB) ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (*OAuthAuthorizationCode, error) {
+	ctx, span := startSQLiteSpan(ctx, "ConsumeOAuthAuthorizationCode")
+	defer span.End()
+
+	_, now := s.now()
+	var result OAuthAuthorizationCode
+	err := s.client.GetContext(ctx, &result, sqliteConsumeOAuthAuthorizationCodeSQL, codeHash, now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOAuthAuthorizationCodeNotFound
+		}
+		return nil, fmt.Errorf("error consuming oauth authorization code: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) SetOrganizationSAMLConfig(ctx context.Context, params SetOrganizationSAMLConfigParams) (*OrganizationSAMLConfig, error) {
+	ctx, span := startSQLiteSpan(ctx, "SetOrganizationSAMLConfig")
+	defer span.End()
+
+	_, now := s.now()
+	var result OrganizationSAMLConfig
+	err := s.client.GetContext(ctx, &result, sqliteSetOrganizationSAMLConfigSQL,
+		params.OrganizationID, params.IdPEntityID, params.IdPMetadata, now)
+	if err != nil {
+		return nil, fmt.Errorf("error setting organization saml config: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetOrganizationSAMLConfig(ctx context.Context, organizationID string) (*OrganizationSAMLConfig, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetOrganizationSAMLConfig")
+	defer span.End()
+
+	var result OrganizationSAMLConfig
+	err := s.client.GetContext(ctx, &result, sqliteGetOrganizationSAMLConfigSQL, organizationID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationSAMLConfigNotFound
+		}
+		return nil, fmt.Errorf("error getting organization saml config: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) DeleteOrganizationSAMLConfig(ctx context.Context, organizationID string) error {
+	ctx, span := startSQLiteSpan(ctx, "DeleteOrganizationSAMLConfig")
+	defer span.End()
+
+	res, err := s.client.ExecContext(ctx, sqliteDeleteOrganizationSAMLConfigSQL, organizationID)
+	if err != nil {
+		return fmt.Errorf("error deleting organization saml config: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrOrganizationSAMLConfigNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CreateFederatedIdentity(ctx context.Context, params CreateFederatedIdentityParams) (*FederatedIdentity, error) {
+	ctx, span := startSQLiteSpan(ctx, "CreateFederatedIdentity")
+	defer span.End()
+
+	_, now := s.now()
+	var result FederatedIdentity
+	err := s.client.GetContext(ctx, &result, sqliteCreateFederatedIdentitySQL,
+		uuid.NewString(), params.AccountID, params.OrganizationID, params.Subject, params.Email, now)
+	if err != nil {
+		if sqliteUniqueViolation(err) {
+			return nil, ErrFederatedIdentityAlreadyExists
+		}
+		return nil, fmt.Errorf("error creating federated identity: %w", err)
+	}
+	return &result, nil
+}
+
+func (s *SQLiteDB) GetFederatedIdentity(ctx context.Context, organizationID, subject string) (*FederatedIdentity, error) {
+	ctx, span := startSQLiteSpan(ctx, "GetFederatedIdentity")
+	defer span.End()
+
+	var result FederatedIdentity
+	err := s.client.GetContext(ctx, &result, sqliteGetFederatedIdentitySQL, organizationID, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFederatedIdentityNotFound
+		}
+		return nil, fmt.Errorf("error getting federated identity: %w", err)
+	}
+	return &result, nil
+}
+
+const (
+	sqliteAccountColumns = `id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at`
+
+	sqliteEmailChangeColumns = `id, account_id, new_email, old_token_hash, new_token_hash, cancel_token_hash,
+		old_confirmed_at, new_confirmed_at, expires_at, created_at`
+
+	sqliteWebhookDeliveryColumns = `id, endpoint_id, event_type, payload, status, attempts, next_attempt_at,
+		COALESCE(last_status_code, 0) AS last_status_code, COALESCE(last_error, '') AS last_error, delivered_at, created_at`
+)
+
+// The SQLite versions of the Postgres queries. Parameters are numbered ?NNN since some are used
+// more than once, and lists are passed as JSON arrays read with json_each.
+var (
+	sqliteInsertOutboxEventSQL = `
+		INSERT INTO outbox (id, event_type, account_id, payload, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5);`
+
+	sqliteCreateAccountSQL = `
+		INSERT INTO accounts (id, email, username, password_hash, preferred_locale, verified_at, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, COALESCE(NULLIF(?5, ''), 'en'), ?6, ?7, ?7)
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteGetAccountSQL = `
+		SELECT ` + sqliteAccountColumns + `
+		FROM accounts WHERE email = ?1 AND deleted_at IS NULL;`
+
+	sqliteGetAccountByUsernameSQL = `
+		SELECT ` + sqliteAccountColumns + `
+		FROM accounts WHERE lower(username) = lower(?1) AND username <> '' AND deleted_at IS NULL;`
+
+	sqliteUsernameTakenSQL = `
+		SELECT COUNT(*) > 0 FROM accounts
+		WHERE lower(username) = lower(?1) AND username <> '' AND deleted_at IS NULL AND id <> ?2;`
+
+	sqliteGetAccountByIDSQL = `
+		SELECT ` + sqliteAccountColumns + `
+		FROM accounts WHERE id = ?1 AND deleted_at IS NULL;`
+
+	sqliteGetAccountsByIDsSQL = `
+		SELECT ` + sqliteAccountColumns + `
+		FROM accounts WHERE id IN (SELECT value FROM json_each(?1)) AND deleted_at IS NULL;`
+
+	sqliteGetAccountsByEmailsSQL = `
+		SELECT ` + sqliteAccountColumns + `
+		FROM accounts WHERE email IN (SELECT value FROM json_each(?1)) AND deleted_at IS NULL;`
+
+	sqliteListAccountsSQL = `
+		SELECT ` + sqliteAccountColumns + `
+		FROM accounts
+		WHERE deleted_at IS NULL
+			AND (?1 IS NULL OR EXISTS (SELECT 1 FROM json_each(accounts.tags) WHERE value = ?1))
+			AND (?2 IS NULL OR (created_at, id) < (?2, ?3))
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?4;`
+
+	sqliteUpdatePasswordSQL = `
+		UPDATE accounts
+		SET password_hash = ?2, updated_at = ?3
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteRehashPasswordSQL = `
+		UPDATE accounts
+		SET password_hash = ?3
+		WHERE id = ?1 AND password_hash = ?2 AND deleted_at IS NULL;`
+
+	// tags are kept sorted and distinct so the column reads the same however they were added
+	sqliteAddAccountTagsSQL = `
+		UPDATE accounts
+		SET tags = (
+				SELECT json_group_array(value ORDER BY value)
+				FROM (SELECT value FROM json_each(accounts.tags) UNION SELECT value FROM json_each(?2))
+			),
+			updated_at = ?3
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteRemoveAccountTagSQL = `
+		UPDATE accounts
+		SET tags = (SELECT json_group_array(value ORDER BY value) FROM json_each(accounts.tags) WHERE value <> ?2),
+			updated_at = ?3
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteUpdateAccountFeatureFlagsSQL = `
+		UPDATE accounts
+		SET feature_flags = ?2, updated_at = ?3
+		WHERE id = ?1
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteUpdateAccountProfileSQL = `
+		UPDATE accounts
+		SET display_name = COALESCE(?2, display_name),
+			given_name = COALESCE(?3, given_name),
+			family_name = COALESCE(?4, family_name),
+			preferred_locale = COALESCE(?5, preferred_locale),
+			timezone = COALESCE(?6, timezone),
+			avatar_url = COALESCE(?7, avatar_url),
+			username = COALESCE(?8, username),
+			updated_at = ?9
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteUpdateAccountMetadataSQL = `
+		UPDATE accounts
+		SET user_metadata = ?2, app_metadata = ?3, updated_at = ?4
+		WHERE id = ?1
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteDeleteAccountDataSQL = []string{
+		`DELETE FROM refresh_tokens WHERE account_id = ?1;`,
+		`DELETE FROM account_identities WHERE account_id = ?1;`,
+		`DELETE FROM email_changes WHERE account_id = ?1;`,
+		`DELETE FROM account_freeze_tokens WHERE account_id = ?1;`,
+		`DELETE FROM email_verifications WHERE account_id = ?1;`,
+		`DELETE FROM password_reset_tokens WHERE account_id = ?1;`,
+		`DELETE FROM mfa_secrets WHERE account_id = ?1;`,
+		`DELETE FROM mfa_recovery_codes WHERE account_id = ?1;`,
+		`DELETE FROM mfa_phones WHERE account_id = ?1;`,
+		`DELETE FROM api_keys WHERE account_id = ?1;`,
+		`DELETE FROM oauth_authorization_codes WHERE account_id = ?1;`,
+		`DELETE FROM federated_identities WHERE account_id = ?1;`,
+		`DELETE FROM known_devices WHERE account_id = ?1;`,
+		`DELETE FROM trusted_devices WHERE account_id = ?1;`,
+	}
+
+	sqliteDeleteAccountSQL = `
+		UPDATE accounts
+		SET deleted_at = ?2, updated_at = ?2
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqlitePurgeDeletedAccountsSQL = `
+		DELETE FROM accounts WHERE deleted_at < ?1 AND erased_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	// sqliteEraseAccountDataSQL are run after sqliteDeleteAccountDataSQL when erasing
+	sqliteEraseAccountDataSQL = []string{
+		`DELETE FROM organization_members WHERE account_id = ?1;`,
+		`DELETE FROM account_roles WHERE account_id = ?1;`,
+		`UPDATE audit_events SET ip_address = NULL, user_agent = NULL WHERE account_id = ?1;`,
+	}
+
+	sqliteTakeDeletionRequestSQL = `
+		DELETE FROM account_deletion_requests WHERE account_id = ?1
+		RETURNING account_id;`
+
+	sqliteEraseAccountSQL = `
+		UPDATE accounts
+		SET email = id || '@erased.invalid', username = '', password_hash = '', display_name = '',
+			given_name = '', family_name = '', timezone = '', avatar_url = '', tags = '[]',
+			feature_flags = '{}', user_metadata = '{}', app_metadata = '{}',
+			deleted_at = COALESCE(deleted_at, ?2), erased_at = ?2, updated_at = ?2
+		WHERE id = ?1 AND erased_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteCreateDeletionRequestSQL = `
+		INSERT INTO account_deletion_requests (account_id, erase_at, created_at)
+		VALUES (?1, ?2, ?3)
+		ON CONFLICT (account_id) DO NOTHING
+		RETURNING account_id, erase_at, reminder_sent_at, created_at;`
+
+	sqliteGetDeletionRequestSQL = `
+		SELECT account_id, erase_at, reminder_sent_at, created_at
+		FROM account_deletion_requests
+		WHERE account_id = ?1;`
+
+	sqliteCancelDeletionRequestSQL = `
+		DELETE FROM account_deletion_requests
+		WHERE account_id = ?1
+		RETURNING account_id, erase_at, reminder_sent_at, created_at;`
+
+	sqliteListDueDeletionRequestsSQL = `
+		SELECT account_id, erase_at, reminder_sent_at, created_at
+		FROM account_deletion_requests
+		WHERE erase_at < ?1
+		ORDER BY erase_at
+		LIMIT ?2;`
+
+	sqliteListDeletionRemindersDueSQL = `
+		SELECT account_id, erase_at, reminder_sent_at, created_at
+		FROM account_deletion_requests
+		WHERE erase_at < ?1 AND reminder_sent_at IS NULL
+		ORDER BY erase_at
+		LIMIT ?2;`
+
+	sqliteMarkDeletionReminderSentSQL = `
+		UPDATE account_deletion_requests
+		SET reminder_sent_at = ?2
+		WHERE account_id = ?1;`
+
+	sqliteCreateRefreshTokenSQL = `
+		INSERT INTO refresh_tokens (token, account_id, expires_at, session_id, ip_address, user_agent, created_at, scopes)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+		ON CONFLICT (token)
+		DO UPDATE SET expires_at = excluded.expires_at, created_at = excluded.created_at;`
+
+	sqliteGetRefreshTokenSQL = `
+		SELECT token, account_id, expires_at, created_at, rotated_at, session_id, ip_address, user_agent, scopes
+		FROM refresh_tokens
+		WHERE token = ?1;`
+
+	sqliteRotateRefreshTokenSQL = `
+		UPDATE refresh_tokens
+		SET rotated_at = COALESCE(rotated_at, ?2)
+		WHERE token = ?1
+		RETURNING token, account_id, expires_at, created_at, rotated_at, session_id, ip_address, user_agent, scopes;`
+
+	sqliteDeleteRefreshTokensSQL = `
+		DELETE FROM refresh_tokens WHERE account_id = ?1;`
+
+	sqliteDeleteRefreshTokenByTokenSQL = `
+		DELETE FROM refresh_tokens WHERE token = ?1;`
+
+	sqliteCountActiveRefreshTokensSQL = `
+		SELECT COUNT(*) FROM refresh_tokens WHERE expires_at > ?1 AND rotated_at IS NULL;`
+
+	sqlitePurgeExpiredRefreshTokensSQL = `
+		DELETE FROM refresh_tokens WHERE expires_at <= ?1;`
+
+	sqliteListRefreshTokensSQL = `
+		SELECT token, account_id, expires_at, created_at, rotated_at, session_id, ip_address, user_agent
+		FROM refresh_tokens
+		WHERE account_id = ?1;`
+
+	sqliteDeleteSessionSQL = `
+		DELETE FROM refresh_tokens WHERE account_id = ?1 AND session_id = ?2;`
+
+	sqliteDeleteExpiredAccessTokensSQL = `
+		DELETE FROM revoked_access_tokens WHERE expires_at <= ?1;`
+
+	sqliteRevokeAccessTokenSQL = `
+		INSERT INTO revoked_access_tokens (token_id, expires_at)
+		VALUES (?1, ?2)
+		ON CONFLICT (token_id) DO NOTHING;`
+
+	sqliteAccessTokenRevokedSQL = `
+		SELECT EXISTS (
+			SELECT 1 FROM revoked_access_tokens
+			WHERE token_id = ?1 AND expires_at > ?2
+		);`
+
+	sqliteCreateAuditEventSQL = `
+		INSERT INTO audit_events (id, account_id, event_type, actor_id, ip_address, user_agent, request_id, created_at, details)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9);`
+
+	sqliteListAuditEventsSQL = `
+		SELECT id, COALESCE(account_id, '') AS account_id, event_type, COALESCE(actor_id, '') AS actor_id,
+			COALESCE(ip_address, '') AS ip_address, COALESCE(user_agent, '') AS user_agent,
+			COALESCE(request_id, '') AS request_id, COALESCE(details, '') AS details, created_at
+		FROM audit_events
+		WHERE (?1 IS NULL OR account_id = ?1)
+			AND (?2 IS NULL OR (created_at, id) < (?2, ?3))
+			AND (?5 IS NULL OR created_at >= ?5)
+			AND (?6 IS NULL OR created_at < ?6)
+			AND (?7 IS NULL OR event_type = ?7)
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?4;`
+
+	sqlitePurgeAuditEventsSQL = `
+		DELETE FROM audit_events WHERE created_at < ?1;`
+
+	sqliteCreateAccountIdentitySQL = `
+		INSERT INTO account_identities (id, account_id, provider, subject, email, name, created_at)
+		VALUES (?1, ?2, ?3, ?4, NULLIF(?5, ''), NULLIF(?6, ''), ?7)
+		RETURNING id, account_id, provider, subject, COALESCE(email, '') AS email, COALESCE(name, '') AS name, created_at;`
+
+	sqliteGetAccountIdentitySQL = `
+		SELECT id, account_id, provider, subject, COALESCE(email, '') AS email, COALESCE(name, '') AS name, created_at
+		FROM account_identities WHERE provider = ?1 AND subject = ?2;`
+
+	sqliteCreateEmailChangeSQL = `
+		INSERT INTO email_changes (id, account_id, new_email, old_token_hash, new_token_hash, cancel_token_hash, expires_at, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+		ON CONFLICT (account_id)
+		DO UPDATE SET
+			new_email = excluded.new_email,
+			old_token_hash = excluded.old_token_hash,
+			new_token_hash = excluded.new_token_hash,
+			cancel_token_hash = excluded.cancel_token_hash,
+			old_confirmed_at = NULL,
+			new_confirmed_at = NULL,
+			expires_at = excluded.expires_at,
+			created_at = excluded.created_at
+		RETURNING ` + sqliteEmailChangeColumns + `;`
+
+	sqliteGetEmailChangeByTokenHashSQL = `
+		SELECT ` + sqliteEmailChangeColumns + `
+		FROM email_changes
+		WHERE old_token_hash = ?1 OR new_token_hash = ?1 OR cancel_token_hash = ?1;`
+
+	sqliteConfirmOldEmailChangeSQL = `
+		UPDATE email_changes SET old_confirmed_at = COALESCE(old_confirmed_at, ?2)
+		WHERE id = ?1
+		RETURNING ` + sqliteEmailChangeColumns + `;`
+
+	sqliteConfirmNewEmailChangeSQL = `
+		UPDATE email_changes SET new_confirmed_at = COALESCE(new_confirmed_at, ?2)
+		WHERE id = ?1
+		RETURNING ` + sqliteEmailChangeColumns + `;`
+
+	sqliteDeleteEmailChangeReturningSQL = `
+		DELETE FROM email_changes WHERE id = ?1
+		RETURNING ` + sqliteEmailChangeColumns + `;`
+
+	sqliteDeleteEmailChangeSQL = `
+		DELETE FROM email_changes WHERE id = ?1;`
+
+	sqliteUpdateAccountEmailSQL = `
+		UPDATE accounts SET email = ?2, verified_at = COALESCE(verified_at, ?3), updated_at = ?3
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteCreateFreezeTokenSQL = `
+		INSERT INTO account_freeze_tokens (token_hash, account_id, purpose, expires_at, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5);`
+
+	sqliteGetFreezeTokenSQL = `
+		SELECT token_hash, account_id, purpose, expires_at, created_at
+		FROM account_freeze_tokens
+		WHERE token_hash = ?1;`
+
+	sqliteDeleteFreezeTokensSQL = `
+		DELETE FROM account_freeze_tokens WHERE account_id = ?1;`
+
+	sqliteFreezeAccountSQL = `
+		UPDATE accounts
+		SET frozen_at = COALESCE(frozen_at, ?2), updated_at = ?2
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteUnfreezeAccountSQL = `
+		UPDATE accounts
+		SET frozen_at = NULL, password_hash = COALESCE(NULLIF(?2, ''), password_hash), updated_at = ?3
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqliteCreateEmailVerificationSQL = `
+		INSERT INTO email_verifications (token_hash, account_id, email, expires_at, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5);`
+
+	sqliteGetEmailVerificationSQL = `
+		SELECT token_hash, account_id, email, expires_at, created_at
+		FROM email_verifications
+		WHERE token_hash = ?1;`
+
+	sqliteDeleteEmailVerificationsSQL = `
+		DELETE FROM email_verifications WHERE account_id = ?1;`
+
+	sqliteVerifyAccountSQL = `
+		UPDATE accounts
+		SET verified_at = COALESCE(verified_at, ?2), updated_at = ?2
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqlitePurgeExpiredEmailVerificationsSQL = `
+		DELETE FROM email_verifications WHERE expires_at <= ?1;`
+
+	sqliteCreatePasswordResetTokenSQL = `
+		INSERT INTO password_reset_tokens (token_hash, account_id, email, expires_at, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5);`
+
+	sqliteGetPasswordResetTokenSQL = `
+		SELECT token_hash, account_id, email, expires_at, created_at
+		FROM password_reset_tokens
+		WHERE token_hash = ?1;`
+
+	sqliteDeletePasswordResetTokensSQL = `
+		DELETE FROM password_reset_tokens WHERE account_id = ?1;`
+
+	sqliteDropUnverifiedMembershipsSQL = `
+		DELETE FROM organization_members
+		WHERE account_id = ?1 AND role <> ?2
+			AND organization_id IN (SELECT organization_id FROM federated_identities WHERE account_id = ?1)
+			AND EXISTS (SELECT 1 FROM accounts WHERE id = ?1 AND verified_at IS NULL);`
+
+	sqliteDropUnverifiedFederatedIdentitiesSQL = `
+		DELETE FROM federated_identities
+		WHERE account_id = ?1
+			AND EXISTS (SELECT 1 FROM accounts WHERE id = ?1 AND verified_at IS NULL);`
+
+	sqliteResetPasswordSQL = `
+		UPDATE accounts
+		SET password_hash = ?2, verified_at = COALESCE(verified_at, ?3), updated_at = ?3
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + sqliteAccountColumns + `;`
+
+	sqlitePurgeExpiredPasswordResetTokensSQL = `
+		DELETE FROM password_reset_tokens WHERE expires_at <= ?1;`
+
+	sqliteSetMFASecretSQL = `
+		INSERT INTO mfa_secrets (account_id, secret, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?3)
+		ON CONFLICT (account_id) DO UPDATE
+		SET secret = excluded.secret, last_used_step = 0, created_at = excluded.created_at, updated_at = excluded.updated_at
+		WHERE mfa_secrets.enabled_at IS NULL;`
+
+	sqliteGetMFASecretSQL = `
+		SELECT account_id, secret, enabled_at, last_used_step, created_at, updated_at
+		FROM mfa_secrets
+		WHERE account_id = ?1;`
+
+	sqliteEnableMFASQL = `
+		UPDATE mfa_secrets
+		SET enabled_at = ?3, last_used_step = ?2, updated_at = ?3
+		WHERE account_id = ?1 AND enabled_at IS NULL
+		RETURNING account_id, secret, enabled_at, last_used_step, created_at, updated_at;`
+
+	sqliteUseMFAStepSQL = `
+		UPDATE mfa_secrets
+		SET last_used_step = ?2, updated_at = ?3
+		WHERE account_id = ?1 AND enabled_at IS NOT NULL AND last_used_step < ?2;`
+
+	sqliteSetMFAPhoneSQL = `
+		INSERT INTO mfa_phones (account_id, phone_number, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?3)
+		ON CONFLICT (account_id) DO UPDATE
+		SET phone_number = excluded.phone_number, code_hash = NULL, code_expires_at = NULL,
+			created_at = excluded.created_at, updated_at = excluded.updated_at
+		WHERE mfa_phones.verified_at IS NULL;`
+
+	sqliteGetMFAPhoneSQL = `
+		SELECT ` + mfaPhoneColumns + `
+		FROM mfa_phones
+		WHERE account_id = ?1;`
+
+	sqliteVerifyMFAPhoneSQL = `
+		UPDATE mfa_phones
+		SET verified_at = ?2, updated_at = ?2
+		WHERE account_id = ?1 AND verified_at IS NULL
+		RETURNING ` + mfaPhoneColumns + `;`
+
+	sqliteSetMFAPhoneCodeSQL = `
+		UPDATE mfa_phones
+		SET code_hash = ?2, code_sent_at = ?3, code_expires_at = ?4, updated_at = ?6
+		WHERE account_id = ?1 AND (code_sent_at IS NULL OR code_sent_at <= ?5);`
+
+	sqliteUseMFAPhoneCodeSQL = `
+		UPDATE mfa_phones
+		SET code_hash = NULL, code_expires_at = NULL, updated_at = ?4
+		WHERE account_id = ?1 AND code_hash = ?2 AND code_expires_at > ?3;`
+
+	sqliteDeleteMFARecoveryCodesSQL = `
+		DELETE FROM mfa_recovery_codes WHERE account_id = ?1;`
+
+	sqliteCreateMFARecoveryCodeSQL = `
+		INSERT INTO mfa_recovery_codes (account_id, code_hash, created_at)
+		VALUES (?1, ?2, ?3);`
+
+	sqliteUseMFARecoveryCodeSQL = `
+		DELETE FROM mfa_recovery_codes WHERE account_id = ?1 AND code_hash = ?2;`
+
+	sqliteCountMFARecoveryCodesSQL = `
+		SELECT COUNT(*) FROM mfa_recovery_codes WHERE account_id = ?1;`
+
+	sqliteCreateOrganizationSQL = `
+		INSERT INTO organizations (id, name, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?3)
+		RETURNING id, name, created_at, updated_at;`
+
+	sqliteAddOrganizationMemberSQL = `
+		INSERT INTO organization_members (organization_id, account_id, role, created_at)
+		VALUES (?1, ?2, ?3, ?4)`
+
+	sqliteGetOrganizationSQL = `
+		SELECT id, name, created_at, updated_at
+		FROM organizations WHERE id = ?1;`
+
+	sqliteListAccountOrganizationsSQL = `
+		SELECT o.id, o.name, o.created_at, o.updated_at
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.account_id = ?1
+		ORDER BY o.created_at, o.id;`
+
+	sqliteGetOrganizationMemberSQL = `
+		SELECT organization_id, account_id, role, created_at
+		FROM organization_members WHERE organization_id = ?1 AND account_id = ?2;`
+
+	sqliteCreateOrganizationInvitationSQL = `
+		INSERT INTO organization_invitations (token_hash, organization_id, email, role, expires_at, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6);`
+
+	sqliteGetOrganizationInvitationSQL = `
+		SELECT token_hash, organization_id, email, role, expires_at, created_at
+		FROM organization_invitations
+		WHERE token_hash = ?1;`
+
+	sqliteDeleteOrganizationInvitationSQL = `
+		DELETE FROM organization_invitations WHERE token_hash = ?1
+		RETURNING token_hash, organization_id, email, role, expires_at, created_at;`
+
+	sqliteCreateRoleSQL = `
+		INSERT INTO roles (name, description, created_at)
+		VALUES (?1, ?2, ?3)
+		RETURNING name, description, created_at;`
+
+	sqliteGrantPermissionsSQL = `
+		INSERT INTO permissions (role_name, name)
+		SELECT ?1, value FROM json_each(?2)
+		WHERE true
+		ON CONFLICT DO NOTHING;`
+
+	sqliteGetRoleSQL = `
+		SELECT r.name, r.description, r.created_at,
+			(SELECT json_group_array(p.name ORDER BY p.name) FROM permissions p WHERE p.role_name = r.name) AS permissions
+		FROM roles r WHERE r.name = ?1;`
+
+	sqliteRoleExistsSQL = `
+		SELECT EXISTS (SELECT 1 FROM roles WHERE name = ?1);`
+
+	sqliteAssignRoleSQL = `
+		INSERT INTO account_roles (account_id, role_name, created_at)
+		VALUES (?1, ?2, ?3)
+		ON CONFLICT DO NOTHING;`
+
+	sqliteUnassignRoleSQL = `
+		DELETE FROM account_roles WHERE account_id = ?1 AND role_name = ?2;`
+
+	sqliteGetAccountRolesSQL = `
+		SELECT role_name FROM account_roles WHERE account_id = ?1 ORDER BY role_name;`
+
+	sqliteCreateWebhookEndpointSQL = `
+		INSERT INTO webhook_endpoints (id, url, secret, event_types, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5)
+		RETURNING id, url, secret, event_types, created_at;`
+
+	sqliteGetWebhookEndpointSQL = `
+		SELECT id, url, secret, event_types, created_at
+		FROM webhook_endpoints
+		WHERE id = ?1;`
+
+	sqliteListWebhookEndpointsSQL = `
+		SELECT id, url, secret, event_types, created_at
+		FROM webhook_endpoints
+		ORDER BY created_at, id;`
+
+	sqliteDeleteWebhookEndpointSQL = `
+		DELETE FROM webhook_endpoints WHERE id = ?1;`
+
+	sqliteSubscribedWebhookEndpointsSQL = `
+		SELECT id FROM webhook_endpoints
+		WHERE EXISTS (SELECT 1 FROM json_each(webhook_endpoints.event_types) WHERE value = ?1);`
+
+	// json() rejects payloads that aren't JSON, like the jsonb column does
+	sqliteCreateWebhookDeliverySQL = `
+		INSERT INTO webhook_deliveries (id, endpoint_id, event_type, payload, next_attempt_at, created_at)
+		VALUES (?1, ?2, ?3, json(?4), ?5, ?5);`
+
+	sqliteClaimWebhookDeliveriesSQL = `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = ?2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= ?1
+			ORDER BY next_attempt_at
+			LIMIT ?3
+		)
+		RETURNING ` + sqliteWebhookDeliveryColumns + `;`
+
+	sqliteRecordWebhookAttemptSQL = `
+		UPDATE webhook_deliveries
+		SET status = ?2,
+			attempts = attempts + 1,
+			next_attempt_at = ?3,
+			last_status_code = NULLIF(?4, 0),
+			last_error = ?5,
+			delivered_at = CASE WHEN ?2 = 'delivered' THEN ?6 END
+		WHERE id = ?1;`
+
+	sqliteGetWebhookDeliverySQL = `
+		SELECT ` + sqliteWebhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE id = ?1;`
+
+	sqliteListWebhookDeliveriesSQL = `
+		SELECT ` + sqliteWebhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE endpoint_id = ?1
+			AND (?2 IS NULL OR (created_at, id) < (?2, ?3))
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?4;`
+
+	sqliteReplayWebhookDeliverySQL = `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = ?2
+		WHERE id = ?1
+		RETURNING ` + sqliteWebhookDeliveryColumns + `;`
+
+	sqliteListUnpublishedOutboxEventsSQL = `
+		SELECT id, sequence, event_type, account_id, payload, created_at, published_at
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY sequence
+		LIMIT ?1;`
+
+	sqliteMarkOutboxEventsPublishedSQL = `
+		UPDATE outbox SET published_at = ?1
+		WHERE id IN (SELECT value FROM json_each(?2));`
+
+	sqlitePurgeOutboxEventsSQL = `
+		DELETE FROM outbox
+		WHERE created_at < ?1 AND (published_at IS NOT NULL OR ?2);`
+
+	sqliteCreateAPIKeySQL = `
+		INSERT INTO api_keys (id, account_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+		RETURNING ` + apiKeyColumns + `;`
+
+	sqliteListAPIKeysSQL = `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE account_id = ?1
+		ORDER BY created_at DESC, id DESC;`
+
+	sqliteGetAPIKeyByHashSQL = `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE key_hash = ?1;`
+
+	sqliteTouchAPIKeySQL = `
+		UPDATE api_keys SET last_used_at = ?2 WHERE id = ?1;`
+
+	sqliteDeleteAPIKeySQL = `
+		DELETE FROM api_keys WHERE account_id = ?1 AND id = ?2;`
+
+	sqliteCreateKnownDeviceSQL = `
+		INSERT INTO known_devices (id, account_id, device_hash, location, ip_address, user_agent, session_id, revoke_token_hash, created_at, last_seen_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, NULLIF(?8, ''), ?9, ?9)
+		ON CONFLICT (account_id, device_hash, location) DO NOTHING
+		RETURNING ` + knownDeviceColumns + `;`
+
+	sqliteTouchKnownDeviceSQL = `
+		UPDATE known_devices
+		SET ip_address = ?4, user_agent = ?5, last_seen_at = ?6
+		WHERE account_id = ?1 AND device_hash = ?2 AND location = ?3;`
+
+	sqliteCountKnownDevicesSQL = `
+		SELECT COUNT(*) FROM known_devices WHERE account_id = ?1;`
+
+	sqliteGetKnownDeviceByRevokeTokenHashSQL = `
+		SELECT ` + knownDeviceColumns + `
+		FROM known_devices
+		WHERE revoke_token_hash = ?1;`
+
+	sqliteDeleteKnownDeviceSQL = `
+		DELETE FROM known_devices WHERE id = ?1;`
+
+	sqliteCreateTrustedDeviceSQL = `
+		INSERT INTO trusted_devices (id, account_id, device_hash, ip_address, user_agent, expires_at, created_at, last_used_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?7)
+		RETURNING ` + trustedDeviceColumns + `;`
+
+	sqliteUseTrustedDeviceSQL = `
+		UPDATE trusted_devices
+		SET last_used_at = ?4
+		WHERE id = ?1 AND account_id = ?2 AND device_hash = ?3 AND expires_at > ?4;`
+
+	sqliteListTrustedDevicesSQL = `
+		SELECT ` + trustedDeviceColumns + `
+		FROM trusted_devices
+		WHERE account_id = ?1 AND expires_at > ?2
+		ORDER BY last_used_at DESC;`
+
+	sqliteDeleteTrustedDeviceSQL = `
+		DELETE FROM trusted_devices WHERE account_id = ?1 AND id = ?2;`
+
+	sqliteDeleteTrustedDevicesSQL = `
+		DELETE FROM trusted_devices WHERE account_id = ?1;`
+
+	sqlitePurgeExpiredTrustedDevicesSQL = `
+		DELETE FROM trusted_devices WHERE expires_at <= ?1;`
+
+	sqliteCreateOAuthClientSQL = `
+		INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, grant_types, scopes, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)
+		RETURNING ` + oauthClientColumns + `;`
+
+	sqliteGetOAuthClientSQL = `
+		SELECT ` + oauthClientColumns + `
+		FROM oauth_clients
+		WHERE id = ?1;`
+
+	sqliteListOAuthClientsSQL = `
+		SELECT ` + oauthClientColumns + `
+		FROM oauth_clients
+		ORDER BY created_at DESC, id DESC;`
+
+	sqliteDeleteOAuthClientSQL = `
+		DELETE FROM oauth_clients WHERE id = ?1;`
+
+	sqliteDeleteExpiredOAuthAuthorizationCodesSQL = `
+		DELETE FROM oauth_authorization_codes WHERE expires_at <= ?1;`
+
+	sqliteCreateOAuthAuthorizationCodeSQL = `
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, account_id, redirect_uri, scopes, code_challenge, nonce, auth_time, expires_at, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10);`
+
+	sqliteConsumeOAuthAuthorizationCodeSQL = `
+		DELETE FROM oauth_authorization_codes
+		WHERE code_hash = ?1 AND expires_at > ?2
+		RETURNING ` + oauthAuthorizationCodeColumns + `;`
+
+	sqliteSetOrganizationSAMLConfigSQL = `
+		INSERT INTO organization_saml_configs (organization_id, idp_entity_id, idp_metadata, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?4)
+		ON CONFLICT (organization_id) DO UPDATE
+		SET idp_entity_id = excluded.idp_entity_id, idp_metadata = excluded.idp_metadata, updated_at = excluded.updated_at
+		RETURNING organization_id, idp_entity_id, idp_metadata, created_at, updated_at;`
+
+	sqliteGetOrganizationSAMLConfigSQL = `
+		SELECT organization_id, idp_entity_id, idp_metadata, created_at, updated_at
+		FROM organization_saml_configs WHERE organization_id = ?1;`
+
+	sqliteDeleteOrganizationSAMLConfigSQL = `
+		DELETE FROM organization_saml_configs WHERE organization_id = ?1;`
+
+	sqliteCreateFederatedIdentitySQL = `
+		INSERT INTO federated_identities (id, account_id, organization_id, subject, email, created_at)
+		VALUES (?1, ?2, ?3, ?4, NULLIF(?5, ''), ?6)
+		RETURNING ` + federatedIdentityColumns + `;`
+
+	sqliteGetFederatedIdentitySQL = `
+		SELECT ` + federatedIdentityColumns + `
+		FROM federated_identities WHERE organization_id = ?1 AND subject = ?2;`
+)
@@ -0,0 +1,354 @@
+-- The SQLite schema, the same as the Postgres migrations add up to. It's applied whenever a
+-- SQLite database is opened, so every statement has to be safe to run again. Keep it in sync
+-- with the migrations.
+--
+-- SQLite has no timestamp, uuid, array, or JSON types: timestamps are TEXT in UTC, declared
+-- TIMESTAMP so the driver reads them back as time.Time, IDs are generated by SQLiteDB, and
+-- arrays and objects are JSON text.
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id TEXT PRIMARY KEY,
+    email TEXT NOT NULL,
+    username TEXT NOT NULL DEFAULT '',
+    password_hash TEXT NOT NULL,
+    preferred_locale TEXT NOT NULL DEFAULT 'en',
+    display_name TEXT NOT NULL DEFAULT '',
+    given_name TEXT NOT NULL DEFAULT '',
+    family_name TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT '',
+    avatar_url TEXT NOT NULL DEFAULT '',
+    -- JSON array, sorted and distinct
+    tags TEXT NOT NULL DEFAULT '[]',
+    -- JSON object
+    feature_flags TEXT NOT NULL DEFAULT '{}',
+    -- JSON objects
+    user_metadata TEXT NOT NULL DEFAULT '{}',
+    app_metadata TEXT NOT NULL DEFAULT '{}',
+    frozen_at TIMESTAMP,
+    verified_at TIMESTAMP,
+    deleted_at TIMESTAMP,
+    -- erased accounts are anonymized rather than purged so their audit events keep pointing at them
+    erased_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- a deleted account's email can be registered again
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_email_key ON accounts (email) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS accounts_created_at_idx ON accounts (created_at, id);
+CREATE INDEX IF NOT EXISTS accounts_deleted_at_idx ON accounts (deleted_at) WHERE deleted_at IS NOT NULL;
+-- accounts_username_key is created with the added columns, since files from before username was
+-- added don't have it yet
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    rotated_at TIMESTAMP,
+    session_id TEXT NOT NULL,
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_account_id_idx ON refresh_tokens (account_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_session_id_idx ON refresh_tokens (session_id);
+
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+    token_id TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id TEXT PRIMARY KEY,
+    -- nullable and SET NULL so the audit trail survives account deletion
+    account_id TEXT REFERENCES accounts(id) ON DELETE SET NULL,
+    event_type TEXT NOT NULL,
+    actor_id TEXT,
+    ip_address TEXT,
+    user_agent TEXT,
+    request_id TEXT,
+    created_at TIMESTAMP NOT NULL,
+    details TEXT
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_account_id_created_at_idx ON audit_events (account_id, created_at, id);
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at, id);
+
+CREATE TABLE IF NOT EXISTS account_identities (
+    id TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    name TEXT,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS account_identities_account_id_idx ON account_identities (account_id);
+
+CREATE TABLE IF NOT EXISTS email_changes (
+    id TEXT PRIMARY KEY,
+    -- one pending change per account, a new request replaces the old one
+    account_id TEXT NOT NULL UNIQUE REFERENCES accounts(id) ON DELETE CASCADE,
+    new_email TEXT NOT NULL,
+    old_token_hash TEXT NOT NULL UNIQUE,
+    new_token_hash TEXT NOT NULL UNIQUE,
+    cancel_token_hash TEXT NOT NULL UNIQUE,
+    old_confirmed_at TIMESTAMP,
+    new_confirmed_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS account_freeze_tokens (
+    token_hash TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL CHECK (purpose IN ('freeze', 'unfreeze')),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS account_freeze_tokens_account_id_idx ON account_freeze_tokens (account_id);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    token_hash TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS email_verifications_account_id_idx ON email_verifications (account_id);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    token_hash TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS password_reset_tokens_account_id_idx ON password_reset_tokens (account_id);
+
+CREATE TABLE IF NOT EXISTS mfa_secrets (
+    account_id TEXT PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    enabled_at TIMESTAMP,
+    last_used_step INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (account_id, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS mfa_phones (
+    account_id TEXT PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    phone_number TEXT NOT NULL,
+    verified_at TIMESTAMP,
+    code_hash TEXT,
+    code_expires_at TIMESTAMP,
+    code_sent_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (organization_id, account_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_account_id_idx ON organization_members (account_id);
+
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    token_hash TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS organization_invitations_organization_id_idx ON organization_invitations (organization_id);
+
+CREATE TABLE IF NOT EXISTS roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    role_name TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    PRIMARY KEY (role_name, name)
+);
+
+CREATE TABLE IF NOT EXISTS account_roles (
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    role_name TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (account_id, role_name)
+);
+
+INSERT INTO roles (name, description, created_at)
+VALUES ('admin', 'Manages accounts through the admin endpoints', strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+ON CONFLICT DO NOTHING;
+INSERT INTO permissions (role_name, name) VALUES ('admin', 'accounts:read'), ('admin', 'accounts:write')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    -- JSON array
+    event_types TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    endpoint_id TEXT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status_code INTEGER,
+    last_error TEXT,
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_endpoint_id_created_at_idx ON webhook_deliveries (endpoint_id, created_at, id);
+
+CREATE TABLE IF NOT EXISTS outbox (
+    -- the order events are published in
+    sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+    id TEXT NOT NULL UNIQUE,
+    event_type TEXT NOT NULL,
+    -- no foreign key, events outlive purged accounts
+    account_id TEXT NOT NULL,
+    -- JSON object
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (sequence) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_created_at_idx ON outbox (created_at);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    -- JSON array
+    scopes TEXT NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_account_id_created_at_idx ON api_keys (account_id, created_at);
+
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    secret_hash TEXT,
+    -- JSON arrays
+    redirect_uris TEXT NOT NULL,
+    grant_types TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    -- JSON array
+    scopes TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    nonce TEXT NOT NULL DEFAULT '',
+    auth_time TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS oauth_authorization_codes_expires_at_idx ON oauth_authorization_codes (expires_at);
+
+CREATE TABLE IF NOT EXISTS organization_saml_configs (
+    organization_id TEXT PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    idp_entity_id TEXT NOT NULL,
+    idp_metadata TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS federated_identities (
+    id TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    organization_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (organization_id, subject)
+);
+
+CREATE INDEX IF NOT EXISTS federated_identities_account_id_idx ON federated_identities (account_id);
+
+CREATE TABLE IF NOT EXISTS known_devices (
+    id TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    device_hash TEXT NOT NULL,
+    location TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    session_id TEXT NOT NULL,
+    revoke_token_hash TEXT UNIQUE,
+    created_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    UNIQUE (account_id, device_hash, location)
+);
+
+CREATE TABLE IF NOT EXISTS trusted_devices (
+    id TEXT PRIMARY KEY,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    device_hash TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS trusted_devices_account_id_idx ON trusted_devices (account_id);
+
+CREATE TABLE IF NOT EXISTS account_deletion_requests (
+    account_id TEXT PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    erase_at TIMESTAMP NOT NULL,
+    reminder_sent_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS account_deletion_requests_erase_at_idx ON account_deletion_requests (erase_at);
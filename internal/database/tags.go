@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// StringArray scans a Postgres TEXT[] column, or a JSON array the way SQLite stores them
+type StringArray []string
+
+func (a *StringArray) Scan(src any) error {
+	if raw, ok := jsonArray(src); ok {
+		result := []string{}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return fmt.Errorf("error scanning string array: %w", err)
+		}
+		*a = result
+		return nil
+	}
+
+	var result []string
+	if err := pgtype.NewMap().SQLScanner(&result).Scan(src); err != nil {
+		return fmt.Errorf("error scanning string array: %w", err)
+	}
+	*a = result
+	return nil
+}
+
+// jsonArray returns src if it's a JSON array. Postgres arrays start with { instead.
+func jsonArray(src any) ([]byte, bool) {
+	var raw []byte
+	switch v := src.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	}
+	if len(raw) == 0 || raw[0] != '[' {
+		return nil, false
+	}
+	return raw, true
+}
+
+// ListAccountsParams pages through accounts newest first
+type ListAccountsParams struct {
+	// Tag optionally restricts the listing to accounts with this tag
+	Tag string
+	Keyset
+}
+
+// AddAccountTags adds tags to the account. Tags it already has are ignored.
+func (d *DB) AddAccountTags(ctx context.Context, id string, tags []string) (*Account, error) {
+	ctx, span := startSpan(ctx, "AddAccountTags")
+	defer span.End()
+
+	var result Account
+	err := d.client.GetContext(ctx, &result, addAccountTagsSQL, id, tags)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error adding account tags: %w", err)
+	}
+	return &result, nil
+}
+
+// RemoveAccountTag removes tag from the account. It's not an error if the account doesn't have it.
+func (d *DB) RemoveAccountTag(ctx context.Context, id, tag string) (*Account, error) {
+	ctx, span := startSpan(ctx, "RemoveAccountTag")
+	defer span.End()
+
+	var result Account
+	err := d.client.GetContext(ctx, &result, removeAccountTagSQL, id, tag)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error removing account tag: %w", err)
+	}
+	return &result, nil
+}
+
+func (d *DB) ListAccounts(ctx context.Context, params ListAccountsParams) ([]Account, error) {
+	ctx, span := startSpan(ctx, "ListAccounts")
+	defer span.End()
+
+	beforeCreatedAt, beforeID, limit := params.args()
+	var result []Account
+	err := d.reader().SelectContext(ctx, &result, listAccountsSQL,
+		nullString(params.Tag),
+		beforeCreatedAt,
+		beforeID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing accounts: %w", err)
+	}
+	return result, nil
+}
+
+var (
+	// tags are kept sorted and distinct so the column reads the same however they were added
+	addAccountTagsSQL = `
+		UPDATE accounts
+		SET tags = ARRAY(SELECT DISTINCT t FROM unnest(tags || $2::text[]) AS t ORDER BY t),
+			updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at;`
+
+	removeAccountTagSQL = `
+		UPDATE accounts
+		SET tags = array_remove(tags, $2::text), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at;`
+
+	// tags @> rather than = ANY(tags) so the GIN index is used
+	listAccountsSQL = `
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM accounts
+		WHERE deleted_at IS NULL
+			AND ($1::text IS NULL OR tags @> ARRAY[$1::text])
+			AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3::uuid))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4;`
+)
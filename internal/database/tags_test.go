@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountTags(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "tagtest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, StringArray{}, testAccount.Tags)
+
+	tagged, err := db.AddAccountTags(ctx, testAccount.ID, []string{"enterprise", "beta", "beta"})
+	require.NoError(t, err)
+	assert.Equal(t, StringArray{"beta", "enterprise"}, tagged.Tags)
+
+	accounts, err := db.ListAccounts(ctx, ListAccountsParams{Tag: "enterprise", Keyset: Keyset{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, testAccount.ID, accounts[0].ID)
+
+	untagged, err := db.RemoveAccountTag(ctx, testAccount.ID, "enterprise")
+	require.NoError(t, err)
+	assert.Equal(t, StringArray{"beta"}, untagged.Tags)
+
+	accounts, err = db.ListAccounts(ctx, ListAccountsParams{Tag: "enterprise", Keyset: Keyset{Limit: 10}})
+	require.NoError(t, err)
+	assert.Empty(t, accounts)
+
+	_, err = db.AddAccountTags(ctx, "00000000-0000-0000-0000-000000000000", []string{"beta"})
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
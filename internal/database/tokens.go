@@ -16,9 +16,19 @@ type CreateRefreshTokenParams struct {
 	Token     string    `db:"token"`
 	AccountID string    `db:"account_id"`
 	ExpiresAt time.Time `db:"expires_at"`
+	// SessionID continues the session of the token being refreshed. Empty starts a new one.
+	SessionID string `db:"session_id"`
+	IPAddress string `db:"ip_address"`
+	UserAgent string `db:"user_agent"`
+	// Scopes restrict the access tokens the session gets. Empty doesn't restrict them.
+	Scopes []string `db:"scopes"`
 }
 
 func (d *DB) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) error {
+	ctx, span := startSpan(ctx, "CreateRefreshToken")
+	defer span.End()
+
+	params.Scopes = nonNilStrings(params.Scopes)
 	_, err := d.client.NamedExecContext(ctx, createRefreshTokenSQL, params)
 	if err != nil {
 		return fmt.Errorf("error creating refresh token: %w", err)
@@ -31,11 +41,21 @@ type RefreshToken struct {
 	AccountID string    `db:"account_id"`
 	ExpiresAt time.Time `db:"expires_at"`
 	CreatedAt time.Time `db:"created_at"`
+	// RotatedAt is when the token was first exchanged with rotation enabled, nil until then
+	RotatedAt *time.Time `db:"rotated_at"`
+	SessionID string     `db:"session_id"`
+	IPAddress string     `db:"ip_address"`
+	UserAgent string     `db:"user_agent"`
+	// Scopes are the session's, see CreateRefreshTokenParams
+	Scopes StringArray `db:"scopes"`
 }
 
 func (d *DB) GetRefreshToken(ctx context.Context, token string) (*RefreshToken, error) {
+	ctx, span := startSpan(ctx, "GetRefreshToken")
+	defer span.End()
+
 	var result RefreshToken
-	err := d.client.GetContext(ctx, &result, getRefreshTokenSQL, token)
+	err := d.reader().GetContext(ctx, &result, getRefreshTokenSQL, token)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrRefreshTokenNotFound
@@ -45,30 +65,130 @@ func (d *DB) GetRefreshToken(ctx context.Context, token string) (*RefreshToken,
 	return &result, nil
 }
 
-func (d *DB) DeleteRefreshToken(ctx context.Context, accountID string) error {
-	_, err := d.client.ExecContext(ctx, deleteRefreshTokenSQL, accountID)
+// RotateRefreshToken marks the token as rotated at the given time and returns it. A token that
+// was already rotated keeps its original RotatedAt so callers can tell how long ago it was
+// replaced. The time comes from the caller so it's compared against the same clock later.
+func (d *DB) RotateRefreshToken(ctx context.Context, token string, at time.Time) (*RefreshToken, error) {
+	ctx, span := startSpan(ctx, "RotateRefreshToken")
+	defer span.End()
+
+	var result RefreshToken
+	err := d.client.GetContext(ctx, &result, rotateRefreshTokenSQL, token, at)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("error rotating refresh token: %w", err)
+	}
+	return &result, nil
+}
+
+// DeleteRefreshTokensByAccount deletes every refresh token of the account, logging out all of its
+// sessions. DeleteRefreshTokenByToken logs out one.
+func (d *DB) DeleteRefreshTokensByAccount(ctx context.Context, accountID string) error {
+	ctx, span := startSpan(ctx, "DeleteRefreshTokensByAccount")
+	defer span.End()
+
+	_, err := d.client.ExecContext(ctx, deleteRefreshTokensByAccountSQL, accountID)
+	if err != nil {
+		return fmt.Errorf("error deleting refresh token: %w", err)
+	}
+	return nil
+}
+
+// DeleteRefreshTokenByToken deletes a single refresh token, logging out only its session. It
+// doesn't error if the token doesn't exist.
+func (d *DB) DeleteRefreshTokenByToken(ctx context.Context, token string) error {
+	ctx, span := startSpan(ctx, "DeleteRefreshTokenByToken")
+	defer span.End()
+
+	_, err := d.client.ExecContext(ctx, deleteRefreshTokenByTokenSQL, token)
 	if err != nil {
 		return fmt.Errorf("error deleting refresh token: %w", err)
 	}
 	return nil
 }
 
+// CountActiveRefreshTokens returns how many refresh tokens haven't expired or been rotated at
+// the given time
+func (d *DB) CountActiveRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "CountActiveRefreshTokens")
+	defer span.End()
+
+	var count int64
+	err := d.client.GetContext(ctx, &count, countActiveRefreshTokensSQL, now)
+	if err != nil {
+		return 0, fmt.Errorf("error counting active refresh tokens: %w", err)
+	}
+	return count, nil
+}
+
+// PurgeExpiredRefreshTokens deletes the refresh tokens that expired before now and returns how
+// many were deleted. They can't be used anymore, they only pile up.
+func (d *DB) PurgeExpiredRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "PurgeExpiredRefreshTokens")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, purgeExpiredRefreshTokensSQL, now)
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired refresh tokens: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired refresh tokens: %w", err)
+	}
+	return n, nil
+}
+
 var (
 	createRefreshTokenSQL = `
-		INSERT INTO refresh_tokens (token, account_id, expires_at)
-		VALUES (:token, :account_id, :expires_at)
-		ON CONFLICT (token) 
-		DO UPDATE SET 
-			token = EXCLUDED.token,
-			expires_at = EXCLUDED.expires_at,
-			created_at = NOW();`
+		WITH token AS (
+			INSERT INTO refresh_tokens (token, account_id, expires_at, session_id, ip_address, user_agent, scopes)
+			VALUES (:token, :account_id, :expires_at, COALESCE(NULLIF(:session_id, '')::uuid, gen_random_uuid()), :ip_address, :user_agent, :scopes)
+			ON CONFLICT (token) 
+			DO UPDATE SET 
+				token = EXCLUDED.token,
+				expires_at = EXCLUDED.expires_at,
+				created_at = NOW()
+			RETURNING account_id, session_id
+		)
+		INSERT INTO outbox (event_type, account_id, payload)
+		SELECT '` + OutboxEventSessionStarted + `', account_id, jsonb_build_object('account_id', account_id, 'session_id', session_id)
+		FROM token
+		-- refreshes continue a session
+		WHERE :session_id = '';`
 
 	getRefreshTokenSQL = `
-		SELECT token, account_id, expires_at, created_at
+		SELECT token, account_id, expires_at, created_at, rotated_at, session_id, ip_address, user_agent, scopes
 		FROM refresh_tokens 
 		WHERE token = $1;`
 
-	deleteRefreshTokenSQL = `
-		DELETE FROM refresh_tokens 
-		WHERE account_id = $1;`
+	rotateRefreshTokenSQL = `
+		UPDATE refresh_tokens
+		SET rotated_at = COALESCE(rotated_at, $2)
+		WHERE token = $1
+		RETURNING token, account_id, expires_at, created_at, rotated_at, session_id, ip_address, user_agent, scopes;`
+
+	deleteRefreshTokensByAccountSQL = `
+		WITH deleted AS (
+			DELETE FROM refresh_tokens 
+			WHERE account_id = $1
+			RETURNING account_id
+		)
+		INSERT INTO outbox (event_type, account_id, payload)
+		SELECT DISTINCT '` + OutboxEventSessionsRevoked + `', account_id, jsonb_build_object('account_id', account_id)
+		FROM deleted;`
+
+	deleteRefreshTokenByTokenSQL = `
+		DELETE FROM refresh_tokens
+		WHERE token = $1;`
+
+	countActiveRefreshTokensSQL = `
+		SELECT COUNT(*)
+		FROM refresh_tokens
+		WHERE expires_at > $1 AND rotated_at IS NULL;`
+
+	purgeExpiredRefreshTokensSQL = `
+		DELETE FROM refresh_tokens WHERE expires_at <= $1;`
 )
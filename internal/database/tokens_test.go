@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -74,9 +75,9 @@ func TestCreateRefreshToken(t *testing.T) {
 	}
 
 	t.Cleanup(func() {
-		_, err := db.client.Exec("DELETE FROM refresh_tokens WHERE account_id = $1", testAccount.ID)
+		_, err := db.pool.Exec("DELETE FROM refresh_tokens WHERE account_id = $1", testAccount.ID)
 		require.NoError(t, err)
-		_, err = db.client.Exec("DELETE FROM accounts WHERE email = 'tokentest@test.com'")
+		_, err = db.pool.Exec("DELETE FROM accounts WHERE email = 'tokentest@test.com'")
 		require.NoError(t, err)
 		require.NoError(t, db.Close())
 	})
@@ -118,6 +119,7 @@ func TestGetRefreshToken(t *testing.T) {
 				assert.Equal(t, testAccount.ID, actual.AccountID)
 				assert.WithinDuration(t, testTokenParams.ExpiresAt, actual.ExpiresAt, time.Second)
 				assert.NotZero(t, actual.CreatedAt)
+				assert.Nil(t, actual.RotatedAt)
 			},
 		},
 		{
@@ -150,15 +152,55 @@ func TestGetRefreshToken(t *testing.T) {
 	}
 
 	t.Cleanup(func() {
-		_, err := db.client.Exec("DELETE FROM refresh_tokens WHERE account_id = $1", testAccount.ID)
+		_, err := db.pool.Exec("DELETE FROM refresh_tokens WHERE account_id = $1", testAccount.ID)
 		require.NoError(t, err)
-		_, err = db.client.Exec("DELETE FROM accounts WHERE email = 'gettokentest@test.com'")
+		_, err = db.pool.Exec("DELETE FROM accounts WHERE email = 'gettokentest@test.com'")
 		require.NoError(t, err)
 		require.NoError(t, db.Close())
 	})
 }
 
-func TestDeleteRefreshToken(t *testing.T) {
+func TestRotateRefreshToken(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "rotatetokentest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		// refresh tokens are removed by the cascade
+		_, err := db.pool.Exec("DELETE FROM accounts WHERE email = 'rotatetokentest@test.com'")
+		require.NoError(t, err)
+	})
+
+	require.NoError(t, db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "test-rotate-token-123",
+		AccountID: testAccount.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+
+	rotatedAt := time.Now()
+	rotated, err := db.RotateRefreshToken(ctx, "test-rotate-token-123", rotatedAt)
+	require.NoError(t, err)
+	assert.Equal(t, testAccount.ID, rotated.AccountID)
+	require.NotNil(t, rotated.RotatedAt)
+	assert.WithinDuration(t, rotatedAt, *rotated.RotatedAt, time.Millisecond)
+
+	// rotating again keeps the first rotation time
+	again, err := db.RotateRefreshToken(ctx, "test-rotate-token-123", rotatedAt.Add(time.Minute))
+	require.NoError(t, err)
+	require.NotNil(t, again.RotatedAt)
+	assert.True(t, rotated.RotatedAt.Equal(*again.RotatedAt))
+
+	_, err = db.RotateRefreshToken(ctx, "non-existent-token", rotatedAt)
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+}
+
+func TestDeleteRefreshTokensByAccount(t *testing.T) {
 	db := setupTestDB(t)
 
 	ctx := context.Background()
@@ -220,7 +262,7 @@ func TestDeleteRefreshToken(t *testing.T) {
 				require.NoError(t, err)
 			}
 
-			err := db.DeleteRefreshToken(ctx, tt.accountID)
+			err := db.DeleteRefreshTokensByAccount(ctx, tt.accountID)
 			if tt.shouldError {
 				require.Error(t, err)
 			} else {
@@ -233,9 +275,210 @@ func TestDeleteRefreshToken(t *testing.T) {
 	}
 
 	t.Cleanup(func() {
-		_, err := db.client.Exec("DELETE FROM refresh_tokens WHERE account_id = $1", testAccount.ID)
+		_, err := db.pool.Exec("DELETE FROM refresh_tokens WHERE account_id = $1", testAccount.ID)
+		require.NoError(t, err)
+		_, err = db.pool.Exec("DELETE FROM accounts WHERE email = 'deletetokentest@test.com'")
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+	})
+}
+
+func TestDeleteRefreshTokenByToken(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "deletebytokentest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	for _, token := range []string{"test-delete-by-token-1", "test-delete-by-token-2"} {
+		err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+			Token:     token,
+			AccountID: testAccount.ID,
+			ExpiresAt: time.Now().Add(time.Hour * 24),
+		})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, db.DeleteRefreshTokenByToken(ctx, "test-delete-by-token-1"))
+	// deleting a token that doesn't exist isn't an error
+	require.NoError(t, db.DeleteRefreshTokenByToken(ctx, "test-delete-by-token-1"))
+
+	_, err = db.GetRefreshToken(ctx, "test-delete-by-token-1")
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	// the account's other sessions are left alone
+	_, err = db.GetRefreshToken(ctx, "test-delete-by-token-2")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_, err := db.pool.Exec("DELETE FROM refresh_tokens WHERE account_id = $1", testAccount.ID)
+		require.NoError(t, err)
+		_, err = db.pool.Exec("DELETE FROM accounts WHERE email = 'deletebytokentest@test.com'")
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+	})
+}
+
+func TestCountActiveRefreshTokens(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "countactivetest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	before, err := db.CountActiveRefreshTokens(ctx, time.Now())
+	require.NoError(t, err)
+
+	tokens := map[string]time.Time{
+		"test-count-active":  time.Now().Add(time.Hour),
+		"test-count-rotated": time.Now().Add(time.Hour),
+		"test-count-expired": time.Now().Add(-time.Hour),
+	}
+	for token, expiresAt := range tokens {
+		err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+			Token:     token,
+			AccountID: testAccount.ID,
+			ExpiresAt: expiresAt,
+		})
+		require.NoError(t, err)
+	}
+	_, err = db.RotateRefreshToken(ctx, "test-count-rotated", time.Now())
+	require.NoError(t, err)
+
+	after, err := db.CountActiveRefreshTokens(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, before+1, after)
+
+	t.Cleanup(func() {
+		_, err := db.pool.Exec("DELETE FROM refresh_tokens WHERE account_id = $1", testAccount.ID)
+		require.NoError(t, err)
+		_, err = db.pool.Exec("DELETE FROM accounts WHERE email = 'countactivetest@test.com'")
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+	})
+}
+
+func TestPurgeExpiredRefreshTokens(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "purgetokenstest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	tokens := map[string]time.Time{
+		"test-purge-active":  time.Now().Add(time.Hour),
+		"test-purge-expired": time.Now().Add(-time.Hour),
+	}
+	for token, expiresAt := range tokens {
+		err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+			Token:     token,
+			AccountID: testAccount.ID,
+			ExpiresAt: expiresAt,
+		})
+		require.NoError(t, err)
+	}
+
+	purged, err := db.PurgeExpiredRefreshTokens(ctx, time.Now())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, int64(1))
+
+	_, err = db.GetRefreshToken(ctx, "test-purge-expired")
+	require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+	_, err = db.GetRefreshToken(ctx, "test-purge-active")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_, err := db.pool.Exec("DELETE FROM refresh_tokens WHERE account_id = $1", testAccount.ID)
+		require.NoError(t, err)
+		_, err = db.pool.Exec("DELETE FROM accounts WHERE email = 'purgetokenstest@test.com'")
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+	})
+}
+
+func TestWithTx(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "withtxtest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+
+	err = db.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     "test-tx-old",
+		AccountID: testAccount.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	t.Run("rotation is rolled back with the new token", func(t *testing.T) {
+		errRollback := errors.New("rollback")
+		err := db.WithTx(ctx, func(tx Repository) error {
+			old, err := tx.RotateRefreshToken(ctx, "test-tx-old", time.Now())
+			if err != nil {
+				return err
+			}
+			if err := tx.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+				Token:     "test-tx-new",
+				AccountID: testAccount.ID,
+				ExpiresAt: time.Now().Add(time.Hour),
+				SessionID: old.SessionID,
+			}); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		require.ErrorIs(t, err, errRollback)
+
+		old, err := db.GetRefreshToken(ctx, "test-tx-old")
+		require.NoError(t, err)
+		assert.Nil(t, old.RotatedAt)
+		_, err = db.GetRefreshToken(ctx, "test-tx-new")
+		require.ErrorIs(t, err, ErrRefreshTokenNotFound)
+	})
+
+	t.Run("rotation is committed with the new token", func(t *testing.T) {
+		err := db.WithTx(ctx, func(tx Repository) error {
+			old, err := tx.RotateRefreshToken(ctx, "test-tx-old", time.Now())
+			if err != nil {
+				return err
+			}
+			return tx.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+				Token:     "test-tx-new",
+				AccountID: testAccount.ID,
+				ExpiresAt: time.Now().Add(time.Hour),
+				SessionID: old.SessionID,
+			})
+		})
+		require.NoError(t, err)
+
+		old, err := db.GetRefreshToken(ctx, "test-tx-old")
+		require.NoError(t, err)
+		assert.NotNil(t, old.RotatedAt)
+		created, err := db.GetRefreshToken(ctx, "test-tx-new")
+		require.NoError(t, err)
+		assert.Equal(t, old.SessionID, created.SessionID)
+	})
+
+	t.Cleanup(func() {
+		_, err := db.pool.Exec("DELETE FROM refresh_tokens WHERE account_id = $1", testAccount.ID)
 		require.NoError(t, err)
-		_, err = db.client.Exec("DELETE FROM accounts WHERE email = 'deletetokentest@test.com'")
+		_, err = db.pool.Exec("DELETE FROM accounts WHERE email = 'withtxtest@test.com'")
 		require.NoError(t, err)
 		require.NoError(t, db.Close())
 	})
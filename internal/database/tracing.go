@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/austinwofford/account-management/internal/database")
+
+// startSpan starts a span for a DB method, named after the method so traces read like the
+// code. Callers have to end it.
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "DB."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(method),
+		),
+	)
+}
+
+// startSQLiteSpan is startSpan for SQLiteDB's methods
+func startSQLiteSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "SQLiteDB."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemSqlite,
+			semconv.DBOperationName(method),
+		),
+	)
+}
+
+// spanErrorTracer marks the method's span as failed when one of its queries fails. Rows that
+// aren't found are reported by database/sql rather than pgx, so they don't count.
+type spanErrorTracer struct{}
+
+func (spanErrorTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (spanErrorTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if data.Err == nil {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(data.Err)
+	span.SetStatus(codes.Error, data.Err.Error())
+}
+
+// queryTracers calls every tracer in order
+type queryTracers []pgx.QueryTracer
+
+func (t queryTracers) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	for _, tracer := range t {
+		ctx = tracer.TraceQueryStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (t queryTracers) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	for _, tracer := range t {
+		tracer.TraceQueryEnd(ctx, conn, data)
+	}
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type countingTracer struct {
+	started, ended int
+}
+
+func (c *countingTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	c.started++
+	return ctx
+}
+
+func (c *countingTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {
+	c.ended++
+}
+
+func TestQueryTracing(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	testTracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+
+	counting := &countingTracer{}
+	tracers := queryTracers{spanErrorTracer{}, counting}
+
+	for _, queryErr := range []error{nil, errors.New("duplicate key value")} {
+		ctx, span := testTracer.Start(context.Background(), "DB.CreateAccount")
+		ctx = tracers.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "INSERT INTO accounts"})
+		tracers.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: queryErr})
+		span.End()
+	}
+
+	assert.Equal(t, 2, counting.started)
+	assert.Equal(t, 2, counting.ended)
+
+	ended := spans.Ended()
+	require.Len(t, ended, 2)
+	assert.Equal(t, codes.Unset, ended[0].Status().Code)
+	assert.Equal(t, codes.Error, ended[1].Status().Code)
+	require.Len(t, ended[1].Events(), 1)
+	assert.Contains(t, ended[1].Events()[0].Attributes, attribute.String("exception.message", "duplicate key value"))
+}
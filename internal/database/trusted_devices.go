@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrTrustedDeviceNotFound = errors.New("trusted device not found")
+
+// TrustedDevice is a device an account completed MFA on and chose to trust, so logins from it
+// skip the MFA challenge until ExpiresAt. The device keeps a signed token naming the ID.
+type TrustedDevice struct {
+	ID        string `db:"id"`
+	AccountID string `db:"account_id"`
+	// DeviceHash identifies the device by its user agent, a token used from another device
+	// isn't trusted
+	DeviceHash string `db:"device_hash"`
+	// IPAddress and UserAgent are of the login that trusted the device
+	IPAddress  string    `db:"ip_address"`
+	UserAgent  string    `db:"user_agent"`
+	CreatedAt  time.Time `db:"created_at"`
+	LastUsedAt time.Time `db:"last_used_at"`
+	ExpiresAt  time.Time `db:"expires_at"`
+}
+
+type CreateTrustedDeviceParams struct {
+	AccountID  string
+	DeviceHash string
+	IPAddress  string
+	UserAgent  string
+	ExpiresAt  time.Time
+}
+
+type UseTrustedDeviceParams struct {
+	ID         string
+	AccountID  string
+	DeviceHash string
+	At         time.Time
+}
+
+func (d *DB) CreateTrustedDevice(ctx context.Context, params CreateTrustedDeviceParams) (*TrustedDevice, error) {
+	ctx, span := startSpan(ctx, "CreateTrustedDevice")
+	defer span.End()
+
+	var result TrustedDevice
+	err := d.client.GetContext(ctx, &result, createTrustedDeviceSQL,
+		params.AccountID, params.DeviceHash, params.IPAddress, params.UserAgent, params.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trusted device: %w", err)
+	}
+	return &result, nil
+}
+
+// UseTrustedDevice records a login that skipped MFA on a trusted device. It returns
+// ErrTrustedDeviceNotFound if the account doesn't trust the device, it's expired, or the login
+// is from a different device than the one that was trusted.
+func (d *DB) UseTrustedDevice(ctx context.Context, params UseTrustedDeviceParams) error {
+	ctx, span := startSpan(ctx, "UseTrustedDevice")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, useTrustedDeviceSQL, params.ID, params.AccountID, params.DeviceHash, params.At)
+	if err != nil {
+		return fmt.Errorf("error using trusted device: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrTrustedDeviceNotFound
+	}
+	return nil
+}
+
+// ListTrustedDevices returns the account's devices that are still trusted at now, most
+// recently used first
+func (d *DB) ListTrustedDevices(ctx context.Context, accountID string, now time.Time) ([]TrustedDevice, error) {
+	ctx, span := startSpan(ctx, "ListTrustedDevices")
+	defer span.End()
+
+	var result []TrustedDevice
+	if err := d.reader().SelectContext(ctx, &result, listTrustedDevicesSQL, accountID, now); err != nil {
+		return nil, fmt.Errorf("error listing trusted devices: %w", err)
+	}
+	return result, nil
+}
+
+// DeleteTrustedDevice stops trusting one of the account's devices. It returns
+// ErrTrustedDeviceNotFound if the account has no such device.
+func (d *DB) DeleteTrustedDevice(ctx context.Context, accountID, id string) error {
+	ctx, span := startSpan(ctx, "DeleteTrustedDevice")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, deleteTrustedDeviceSQL, accountID, id)
+	if err != nil {
+		return fmt.Errorf("error deleting trusted device: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrTrustedDeviceNotFound
+	}
+	return nil
+}
+
+// DeleteTrustedDevices stops trusting every device of the account and returns how many it
+// trusted
+func (d *DB) DeleteTrustedDevices(ctx context.Context, accountID string) (int64, error) {
+	ctx, span := startSpan(ctx, "DeleteTrustedDevices")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, deleteTrustedDevicesSQL, accountID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting trusted devices: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// PurgeExpiredTrustedDevices deletes the trusted devices that expired before now and returns
+// how many were deleted
+func (d *DB) PurgeExpiredTrustedDevices(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "PurgeExpiredTrustedDevices")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, purgeExpiredTrustedDevicesSQL, now)
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired trusted devices: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+const trustedDeviceColumns = `id, account_id, device_hash, ip_address, user_agent, created_at, last_used_at, expires_at`
+
+var (
+	createTrustedDeviceSQL = `
+		INSERT INTO trusted_devices (account_id, device_hash, ip_address, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + trustedDeviceColumns + `;`
+
+	useTrustedDeviceSQL = `
+		UPDATE trusted_devices
+		SET last_used_at = $4
+		WHERE id = $1 AND account_id = $2 AND device_hash = $3 AND expires_at > $4;`
+
+	listTrustedDevicesSQL = `
+		SELECT ` + trustedDeviceColumns + `
+		FROM trusted_devices
+		WHERE account_id = $1 AND expires_at > $2
+		ORDER BY last_used_at DESC;`
+
+	deleteTrustedDeviceSQL = `
+		DELETE FROM trusted_devices WHERE account_id = $1 AND id = $2;`
+
+	deleteTrustedDevicesSQL = `
+		DELETE FROM trusted_devices WHERE account_id = $1;`
+
+	purgeExpiredTrustedDevicesSQL = `
+		DELETE FROM trusted_devices WHERE expires_at <= $1;`
+)
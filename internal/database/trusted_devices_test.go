@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedDevices(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, AccountCreationParams{Email: "trusteddevices@test.com"})
+	require.NoError(t, err)
+	other, err := db.CreateAccount(ctx, AccountCreationParams{Email: "trusteddevices-other@test.com"})
+	require.NoError(t, err)
+
+	now := time.Now().Truncate(time.Second)
+	device, err := db.CreateTrustedDevice(ctx, CreateTrustedDeviceParams{
+		AccountID:  account.ID,
+		DeviceHash: "laptop",
+		IPAddress:  "203.0.113.7",
+		UserAgent:  "Firefox",
+		ExpiresAt:  now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "laptop", device.DeviceHash)
+	expired, err := db.CreateTrustedDevice(ctx, CreateTrustedDeviceParams{
+		AccountID:  account.ID,
+		DeviceHash: "phone",
+		ExpiresAt:  now.Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	use := UseTrustedDeviceParams{ID: device.ID, AccountID: account.ID, DeviceHash: "laptop", At: now.Add(time.Minute)}
+	require.NoError(t, db.UseTrustedDevice(ctx, use))
+
+	// another device, another account, or after it expired
+	require.ErrorIs(t, db.UseTrustedDevice(ctx, UseTrustedDeviceParams{ID: device.ID, AccountID: account.ID, DeviceHash: "phone", At: now}), ErrTrustedDeviceNotFound)
+	require.ErrorIs(t, db.UseTrustedDevice(ctx, UseTrustedDeviceParams{ID: device.ID, AccountID: other.ID, DeviceHash: "laptop", At: now}), ErrTrustedDeviceNotFound)
+	require.ErrorIs(t, db.UseTrustedDevice(ctx, UseTrustedDeviceParams{ID: device.ID, AccountID: account.ID, DeviceHash: "laptop", At: now.Add(time.Hour)}), ErrTrustedDeviceNotFound)
+
+	devices, err := db.ListTrustedDevices(ctx, account.ID, now)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, device.ID, devices[0].ID)
+	assert.True(t, use.At.Equal(devices[0].LastUsedAt))
+
+	require.ErrorIs(t, db.DeleteTrustedDevice(ctx, other.ID, device.ID), ErrTrustedDeviceNotFound)
+	require.NoError(t, db.DeleteTrustedDevice(ctx, account.ID, device.ID))
+	require.ErrorIs(t, db.DeleteTrustedDevice(ctx, account.ID, device.ID), ErrTrustedDeviceNotFound)
+
+	purged, err := db.PurgeExpiredTrustedDevices(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	require.ErrorIs(t, db.DeleteTrustedDevice(ctx, account.ID, expired.ID), ErrTrustedDeviceNotFound)
+
+	// freezing the account stops trusting its devices
+	_, err = db.CreateTrustedDevice(ctx, CreateTrustedDeviceParams{AccountID: account.ID, DeviceHash: "laptop", ExpiresAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	_, err = db.FreezeAccount(ctx, account.ID)
+	require.NoError(t, err)
+	deleted, err := db.DeleteTrustedDevices(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	_, err = db.CreateTrustedDevice(ctx, CreateTrustedDeviceParams{AccountID: other.ID, DeviceHash: "laptop", ExpiresAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	deleted, err = db.DeleteTrustedDevices(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
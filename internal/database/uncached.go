@@ -0,0 +1,18 @@
+package database
+
+import "context"
+
+type uncachedReadsKey struct{}
+
+// WithUncachedReads marks lookups made with ctx as ones that have to see the rows as they are
+// now, like a login checking the password hash and whether the account is frozen. Caches in front
+// of a Repository send them straight to it.
+func WithUncachedReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uncachedReadsKey{}, true)
+}
+
+// UncachedReads reports whether lookups made with ctx have to skip caches
+func UncachedReads(ctx context.Context) bool {
+	uncached, _ := ctx.Value(uncachedReadsKey{}).(bool)
+	return uncached
+}
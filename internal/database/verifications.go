@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrEmailVerificationNotFound = errors.New("email verification not found")
+
+type EmailVerification struct {
+	TokenHash string `db:"token_hash"`
+	AccountID string `db:"account_id"`
+	// Email is the address the link was sent to
+	Email     string    `db:"email"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type CreateEmailVerificationParams struct {
+	TokenHash string    `db:"token_hash"`
+	AccountID string    `db:"account_id"`
+	Email     string    `db:"email"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+func (d *DB) CreateEmailVerification(ctx context.Context, params CreateEmailVerificationParams) error {
+	ctx, span := startSpan(ctx, "CreateEmailVerification")
+	defer span.End()
+
+	_, err := d.client.NamedExecContext(ctx, createEmailVerificationSQL, params)
+	if err != nil {
+		return fmt.Errorf("error creating email verification: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetEmailVerification(ctx context.Context, tokenHash string) (*EmailVerification, error) {
+	ctx, span := startSpan(ctx, "GetEmailVerification")
+	defer span.End()
+
+	var result EmailVerification
+	err := d.client.GetContext(ctx, &result, getEmailVerificationSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEmailVerificationNotFound
+		}
+		return nil, fmt.Errorf("error getting email verification: %w", err)
+	}
+	return &result, nil
+}
+
+// VerifyAccount marks the account's email as verified and deletes its outstanding verification
+// links. Verifying a verified account keeps the original VerifiedAt. Newly verified accounts
+// lose the federated identities linked before, along with the organizations they came with.
+func (d *DB) VerifyAccount(ctx context.Context, id string) (*Account, error) {
+	ctx, span := startSpan(ctx, "VerifyAccount")
+	defer span.End()
+
+	var result Account
+	err := d.client.GetContext(ctx, &result, verifyAccountSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error verifying account: %w", err)
+	}
+	return &result, nil
+}
+
+// PurgeExpiredEmailVerifications deletes the verification links that expired before now and
+// returns how many were deleted
+func (d *DB) PurgeExpiredEmailVerifications(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "PurgeExpiredEmailVerifications")
+	defer span.End()
+
+	result, err := d.client.ExecContext(ctx, purgeExpiredEmailVerificationsSQL, now)
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired email verifications: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired email verifications: %w", err)
+	}
+	return n, nil
+}
+
+var (
+	createEmailVerificationSQL = `
+		INSERT INTO email_verifications (token_hash, account_id, email, expires_at)
+		VALUES (:token_hash, :account_id, :email, :expires_at);`
+
+	getEmailVerificationSQL = `
+		SELECT token_hash, account_id, email, expires_at, created_at
+		FROM email_verifications
+		WHERE token_hash = $1;`
+
+	verifyAccountSQL = `
+		WITH ` + dropUnverifiedFederationSQL + `, deleted_verifications AS (
+			DELETE FROM email_verifications WHERE account_id = $1
+		), account AS (
+			UPDATE accounts
+			SET verified_at = COALESCE(verified_at, NOW()), updated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		), newly_verified AS (
+			-- NOW() is when the transaction started, so only accounts verified just now
+			SELECT id, email FROM account WHERE verified_at = NOW()
+		), outbox_event AS (` + insertAccountOutboxEventSQL(OutboxEventAccountVerified, "newly_verified") + `
+		)
+		SELECT id, email, username, password_hash, preferred_locale, display_name, given_name, family_name, timezone, avatar_url, tags, feature_flags, user_metadata, app_metadata, frozen_at, verified_at, created_at, updated_at
+		FROM account;`
+
+	purgeExpiredEmailVerificationsSQL = `
+		DELETE FROM email_verifications WHERE expires_at <= $1;`
+)
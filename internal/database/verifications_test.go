@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailVerifications(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	testAccount, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:        "verifytest@test.com",
+		PasswordHash: "test-password-hash",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, testAccount.VerifiedAt)
+
+	err = db.CreateEmailVerification(ctx, CreateEmailVerificationParams{
+		TokenHash: "verify-test-token-hash",
+		AccountID: testAccount.ID,
+		Email:     testAccount.Email,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	verification, err := db.GetEmailVerification(ctx, "verify-test-token-hash")
+	require.NoError(t, err)
+	assert.Equal(t, testAccount.ID, verification.AccountID)
+	assert.Equal(t, testAccount.Email, verification.Email)
+
+	verified, err := db.VerifyAccount(ctx, testAccount.ID)
+	require.NoError(t, err)
+	require.NotNil(t, verified.VerifiedAt)
+
+	_, err = db.GetEmailVerification(ctx, "verify-test-token-hash")
+	assert.ErrorIs(t, err, ErrEmailVerificationNotFound)
+
+	again, err := db.VerifyAccount(ctx, testAccount.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, *verified.VerifiedAt, *again.VerifiedAt, time.Millisecond)
+
+	preverified, err := db.CreateAccount(ctx, AccountCreationParams{
+		Email:    "verifytest-apple@test.com",
+		Verified: true,
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, preverified.VerifiedAt)
+
+	_, err = db.VerifyAccount(ctx, "00000000-0000-0000-0000-000000000000")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+}
@@ -0,0 +1,294 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	// WebhookDeliveryFailed deliveries ran out of attempts. They can still be replayed.
+	WebhookDeliveryFailed = "failed"
+)
+
+var (
+	ErrWebhookEndpointNotFound = errors.New("webhook endpoint not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// WebhookEndpoint is a URL another service registered to get events posted to
+type WebhookEndpoint struct {
+	ID  string `db:"id"`
+	URL string `db:"url"`
+	// Secret signs every payload posted to the endpoint
+	Secret     string      `db:"secret"`
+	EventTypes StringArray `db:"event_types"`
+	CreatedAt  time.Time   `db:"created_at"`
+}
+
+// WebhookDelivery is one event posted, or still to be posted, to one endpoint
+type WebhookDelivery struct {
+	ID         string `db:"id"`
+	EndpointID string `db:"endpoint_id"`
+	EventType  string `db:"event_type"`
+	// Payload is the JSON body that's posted
+	Payload  string `db:"payload"`
+	Status   string `db:"status"`
+	Attempts int    `db:"attempts"`
+	// NextAttemptAt is when a pending delivery is tried next
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	// LastStatusCode is 0 when the last attempt didn't get a response
+	LastStatusCode int        `db:"last_status_code"`
+	LastError      string     `db:"last_error"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+type CreateWebhookEndpointParams struct {
+	URL        string
+	Secret     string
+	EventTypes []string
+}
+
+// WebhookAttempt is the outcome of posting a delivery
+type WebhookAttempt struct {
+	// Status is WebhookDeliveryDelivered, or WebhookDeliveryPending to try again at
+	// NextAttemptAt, or WebhookDeliveryFailed to give up
+	Status         string
+	NextAttemptAt  time.Time
+	LastStatusCode int
+	LastError      string
+	At             time.Time
+}
+
+// ListWebhookDeliveriesParams pages through an endpoint's deliveries newest first
+type ListWebhookDeliveriesParams struct {
+	EndpointID string
+	Keyset
+}
+
+func (d *DB) CreateWebhookEndpoint(ctx context.Context, params CreateWebhookEndpointParams) (*WebhookEndpoint, error) {
+	ctx, span := startSpan(ctx, "CreateWebhookEndpoint")
+	defer span.End()
+
+	var result WebhookEndpoint
+	err := d.client.GetContext(ctx, &result, createWebhookEndpointSQL, params.URL, params.Secret, params.EventTypes)
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook endpoint: %w", err)
+	}
+	return &result, nil
+}
+
+func (d *DB) GetWebhookEndpoint(ctx context.Context, id string) (*WebhookEndpoint, error) {
+	ctx, span := startSpan(ctx, "GetWebhookEndpoint")
+	defer span.End()
+
+	var result WebhookEndpoint
+	err := d.client.GetContext(ctx, &result, getWebhookEndpointSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookEndpointNotFound
+		}
+		return nil, fmt.Errorf("error getting webhook endpoint: %w", err)
+	}
+	return &result, nil
+}
+
+func (d *DB) ListWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	ctx, span := startSpan(ctx, "ListWebhookEndpoints")
+	defer span.End()
+
+	var result []WebhookEndpoint
+	err := d.reader().SelectContext(ctx, &result, listWebhookEndpointsSQL)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhook endpoints: %w", err)
+	}
+	return result, nil
+}
+
+// DeleteWebhookEndpoint deletes the endpoint and its deliveries
+func (d *DB) DeleteWebhookEndpoint(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "DeleteWebhookEndpoint")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, deleteWebhookEndpointSQL, id)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook endpoint: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrWebhookEndpointNotFound
+	}
+	return nil
+}
+
+// CreateWebhookDeliveries queues the event for every endpoint subscribed to its type and
+// returns how many deliveries were queued
+func (d *DB) CreateWebhookDeliveries(ctx context.Context, eventType, payload string) (int64, error) {
+	ctx, span := startSpan(ctx, "CreateWebhookDeliveries")
+	defer span.End()
+
+	res, err := d.client.ExecContext(ctx, createWebhookDeliveriesSQL, eventType, payload)
+	if err != nil {
+		return 0, fmt.Errorf("error creating webhook deliveries: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error creating webhook deliveries: %w", err)
+	}
+	return n, nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries that are due at now, and holds
+// them for lease by pushing their next attempt back, so other replicas don't post them too
+func (d *DB) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "ClaimWebhookDeliveries")
+	defer span.End()
+
+	var result []WebhookDelivery
+	err := d.client.SelectContext(ctx, &result, claimWebhookDeliveriesSQL, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	return result, nil
+}
+
+// RecordWebhookAttempt stores the outcome of posting a delivery
+func (d *DB) RecordWebhookAttempt(ctx context.Context, id string, attempt WebhookAttempt) error {
+	ctx, span := startSpan(ctx, "RecordWebhookAttempt")
+	defer span.End()
+
+	_, err := d.client.ExecContext(ctx, recordWebhookAttemptSQL,
+		id,
+		attempt.Status,
+		attempt.NextAttemptAt,
+		attempt.LastStatusCode,
+		nullString(attempt.LastError),
+		attempt.At,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording webhook attempt: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "GetWebhookDelivery")
+	defer span.End()
+
+	var result WebhookDelivery
+	err := d.client.GetContext(ctx, &result, getWebhookDeliverySQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, fmt.Errorf("error getting webhook delivery: %w", err)
+	}
+	return &result, nil
+}
+
+func (d *DB) ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "ListWebhookDeliveries")
+	defer span.End()
+
+	beforeCreatedAt, beforeID, limit := params.args()
+	var result []WebhookDelivery
+	err := d.reader().SelectContext(ctx, &result, listWebhookDeliveriesSQL, params.EndpointID, beforeCreatedAt, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhook deliveries: %w", err)
+	}
+	return result, nil
+}
+
+// ReplayWebhookDelivery queues a delivery to be posted again right away, whatever happened
+// to it before. It gets a fresh set of attempts.
+func (d *DB) ReplayWebhookDelivery(ctx context.Context, id string, now time.Time) (*WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "ReplayWebhookDelivery")
+	defer span.End()
+
+	var result WebhookDelivery
+	err := d.client.GetContext(ctx, &result, replayWebhookDeliverySQL, id, now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, fmt.Errorf("error replaying webhook delivery: %w", err)
+	}
+	return &result, nil
+}
+
+const webhookDeliveryColumns = `id, endpoint_id, event_type, payload::text AS payload, status, attempts,
+			next_attempt_at, COALESCE(last_status_code, 0) AS last_status_code,
+			COALESCE(last_error, '') AS last_error, delivered_at, created_at`
+
+var (
+	createWebhookEndpointSQL = `
+		INSERT INTO webhook_endpoints (url, secret, event_types)
+		VALUES ($1, $2, $3)
+		RETURNING id, url, secret, event_types, created_at;`
+
+	getWebhookEndpointSQL = `
+		SELECT id, url, secret, event_types, created_at
+		FROM webhook_endpoints
+		WHERE id = $1;`
+
+	listWebhookEndpointsSQL = `
+		SELECT id, url, secret, event_types, created_at
+		FROM webhook_endpoints
+		ORDER BY created_at, id;`
+
+	deleteWebhookEndpointSQL = `
+		DELETE FROM webhook_endpoints
+		WHERE id = $1;`
+
+	createWebhookDeliveriesSQL = `
+		INSERT INTO webhook_deliveries (endpoint_id, event_type, payload)
+		SELECT id, $1, $2::jsonb
+		FROM webhook_endpoints
+		WHERE $1 = ANY(event_types);`
+
+	claimWebhookDeliveriesSQL = `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + webhookDeliveryColumns + `;`
+
+	recordWebhookAttemptSQL = `
+		UPDATE webhook_deliveries
+		SET status = $2,
+			attempts = attempts + 1,
+			next_attempt_at = $3,
+			last_status_code = NULLIF($4, 0),
+			last_error = $5,
+			delivered_at = CASE WHEN $2 = 'delivered' THEN $6::timestamptz END
+		WHERE id = $1;`
+
+	getWebhookDeliverySQL = `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE id = $1;`
+
+	listWebhookDeliveriesSQL = `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1
+			AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3::uuid))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4;`
+
+	replayWebhookDeliverySQL = `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = $2
+		WHERE id = $1
+		RETURNING ` + webhookDeliveryColumns + `;`
+)
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	db := setupTestDB(t)
+
+	ctx := context.Background()
+
+	endpoint, err := db.CreateWebhookEndpoint(ctx, CreateWebhookEndpointParams{
+		URL:        "https://example.com/hook",
+		Secret:     "secret",
+		EventTypes: []string{"account.created"},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.DeleteWebhookEndpoint(ctx, endpoint.ID)
+	})
+
+	n, err := db.CreateWebhookDeliveries(ctx, "account.created", `{"id":"1"}`)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, int64(1))
+	// nobody is subscribed to this one
+	n, err = db.CreateWebhookDeliveries(ctx, "unsubscribed", `{}`)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, ListWebhookDeliveriesParams{EndpointID: endpoint.ID})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	delivery := deliveries[0]
+	assert.JSONEq(t, `{"id":"1"}`, delivery.Payload)
+	assert.Equal(t, WebhookDeliveryPending, delivery.Status)
+
+	// claimed deliveries aren't claimed again until the lease runs out
+	now := time.Now().Add(time.Second)
+	claimed, err := db.ClaimWebhookDeliveries(ctx, now, time.Minute, 100)
+	require.NoError(t, err)
+	assert.Contains(t, deliveryIDs(claimed), delivery.ID)
+	claimed, err = db.ClaimWebhookDeliveries(ctx, now, time.Minute, 100)
+	require.NoError(t, err)
+	assert.NotContains(t, deliveryIDs(claimed), delivery.ID)
+
+	require.NoError(t, db.RecordWebhookAttempt(ctx, delivery.ID, WebhookAttempt{
+		Status:         WebhookDeliveryDelivered,
+		NextAttemptAt:  now,
+		LastStatusCode: 204,
+		At:             now,
+	}))
+	got, err := db.GetWebhookDelivery(ctx, delivery.ID)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookDeliveryDelivered, got.Status)
+	assert.Equal(t, 1, got.Attempts)
+	assert.Equal(t, 204, got.LastStatusCode)
+	assert.NotNil(t, got.DeliveredAt)
+
+	replayed, err := db.ReplayWebhookDelivery(ctx, delivery.ID, now)
+	require.NoError(t, err)
+	assert.Equal(t, WebhookDeliveryPending, replayed.Status)
+	assert.Zero(t, replayed.Attempts)
+
+	// deleting the endpoint deletes its deliveries
+	require.NoError(t, db.DeleteWebhookEndpoint(ctx, endpoint.ID))
+	require.ErrorIs(t, db.DeleteWebhookEndpoint(ctx, endpoint.ID), ErrWebhookEndpointNotFound)
+	_, err = db.GetWebhookDelivery(ctx, delivery.ID)
+	require.ErrorIs(t, err, ErrWebhookDeliveryNotFound)
+}
+
+func deliveryIDs(deliveries []WebhookDelivery) []string {
+	ids := make([]string, len(deliveries))
+	for i, d := range deliveries {
+		ids[i] = d.ID
+	}
+	return ids
+}
@@ -0,0 +1,293 @@
+package fixtures
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"gopkg.in/yaml.v3"
+)
+
+// Repository is what a scenario needs to be loaded. Both database.DB and
+// database.MemoryDB satisfy it.
+type Repository interface {
+	CreateAccount(ctx context.Context, params database.AccountCreationParams) (*database.Account, error)
+	GetAccount(ctx context.Context, email string) (*database.Account, error)
+	CreateRefreshToken(ctx context.Context, params database.CreateRefreshTokenParams) error
+	DeleteRefreshTokenByToken(ctx context.Context, token string) error
+	CreateAuditEvent(ctx context.Context, params database.CreateAuditEventParams) error
+	CreateOrganization(ctx context.Context, name, ownerID string) (*database.Organization, error)
+	ListAccountOrganizations(ctx context.Context, accountID string) ([]database.Organization, error)
+	AddOrganizationMember(ctx context.Context, organizationID, accountID, role string) (*database.OrganizationMember, error)
+}
+
+// Scenario is a declarative description of data to load into a repository.
+type Scenario struct {
+	Accounts      []Account      `json:"accounts" yaml:"accounts"`
+	Organizations []Organization `json:"organizations" yaml:"organizations"`
+	Sessions      []Session      `json:"sessions" yaml:"sessions"`
+	AuditEvents   []AuditEvent   `json:"audit_events" yaml:"audit_events"`
+}
+
+// Account describes an account to create. Either Password (which is hashed
+// and must satisfy the password rules) or a pre-computed PasswordHash is required.
+type Account struct {
+	Email           string `json:"email" yaml:"email"`
+	Password        string `json:"password" yaml:"password"`
+	PasswordHash    string `json:"password_hash" yaml:"password_hash"`
+	PreferredLocale string `json:"preferred_locale" yaml:"preferred_locale"`
+	// Unverified leaves the email unverified. Accounts are verified by default.
+	Unverified bool `json:"unverified" yaml:"unverified"`
+}
+
+// Organization describes an organization of accounts in the same scenario. Names must be
+// unique within a scenario.
+type Organization struct {
+	Name string `json:"name" yaml:"name"`
+	// Email of the account that owns the organization.
+	Owner   string   `json:"owner" yaml:"owner"`
+	Members []Member `json:"members" yaml:"members"`
+}
+
+// Member describes an account's membership of an organization.
+type Member struct {
+	// Email of the member's account.
+	Account string `json:"account" yaml:"account"`
+	// Role is one of the database.OrganizationRole* roles. Defaults to "member".
+	Role string `json:"role" yaml:"role"`
+}
+
+// Session describes a refresh token for an account in the same scenario.
+type Session struct {
+	// Email of the account the session belongs to.
+	Account string `json:"account" yaml:"account"`
+	Token   string `json:"token" yaml:"token"`
+	// How long from load time until the session expires, e.g. "24h". Defaults to 24h.
+	ExpiresIn string `json:"expires_in" yaml:"expires_in"`
+	// Where the session was started from, shown in the account's session list. Optional.
+	IPAddress string `json:"ip_address" yaml:"ip_address"`
+	UserAgent string `json:"user_agent" yaml:"user_agent"`
+}
+
+// AuditEvent describes an entry in the audit log of an account in the same scenario.
+type AuditEvent struct {
+	// Email of the account the event belongs to.
+	Account string `json:"account" yaml:"account"`
+	// Type is one of the database.AuditEvent* types, e.g. "login".
+	Type      string `json:"type" yaml:"type"`
+	IPAddress string `json:"ip_address" yaml:"ip_address"`
+	UserAgent string `json:"user_agent" yaml:"user_agent"`
+	Details   string `json:"details" yaml:"details"`
+}
+
+const defaultSessionTTL = 24 * time.Hour
+
+// LoadFile reads a scenario from a .yaml, .yml, or .json file.
+func LoadFile(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading fixture file: %w", err)
+	}
+
+	var scenario Scenario
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &scenario)
+	case ".json":
+		err = json.Unmarshal(data, &scenario)
+	default:
+		return nil, fmt.Errorf("unsupported fixture file type %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing fixture file %s: %w", path, err)
+	}
+
+	return &scenario, nil
+}
+
+// Result maps the emails of the loaded accounts and the names of the loaded organizations
+// to their IDs so callers (tests mostly) can refer to generated IDs.
+type Result struct {
+	AccountIDs      map[string]string
+	OrganizationIDs map[string]string
+}
+
+// Load writes the scenario to the repository. It can be loaded repeatedly, e.g. each time a
+// demo environment starts: accounts that already exist are left alone, as are organizations
+// their owner already has one of by that name, and the memberships in them. Sessions are
+// replaced, so they expire as if they'd just been loaded, and audit events are only written
+// for the accounts this load created.
+func Load(ctx context.Context, repo Repository, scenario Scenario) (*Result, error) {
+	result := &Result{AccountIDs: map[string]string{}, OrganizationIDs: map[string]string{}}
+
+	created := map[string]bool{}
+	for _, a := range scenario.Accounts {
+		id, isNew, err := loadAccount(ctx, repo, a)
+		if err != nil {
+			return nil, fmt.Errorf("error loading account %s: %w", a.Email, err)
+		}
+		result.AccountIDs[a.Email] = id
+		created[a.Email] = isNew
+	}
+
+	for _, o := range scenario.Organizations {
+		if _, ok := result.OrganizationIDs[o.Name]; ok {
+			return nil, fmt.Errorf("organization %s is in the scenario more than once", o.Name)
+		}
+		id, err := loadOrganization(ctx, repo, o, result.AccountIDs)
+		if err != nil {
+			return nil, fmt.Errorf("error loading organization %s: %w", o.Name, err)
+		}
+		result.OrganizationIDs[o.Name] = id
+	}
+
+	for _, s := range scenario.Sessions {
+		accountID, ok := result.AccountIDs[s.Account]
+		if !ok {
+			return nil, fmt.Errorf("session %s references account %s which is not in the scenario", s.Token, s.Account)
+		}
+
+		ttl := defaultSessionTTL
+		if s.ExpiresIn != "" {
+			var err error
+			ttl, err = time.ParseDuration(s.ExpiresIn)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expires_in for session %s: %w", s.Token, err)
+			}
+		}
+
+		// the token is fixed, so a session from an earlier load is replaced
+		if err := repo.DeleteRefreshTokenByToken(ctx, s.Token); err != nil {
+			return nil, fmt.Errorf("error loading session %s: %w", s.Token, err)
+		}
+		err := repo.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			Token:     s.Token,
+			AccountID: accountID,
+			ExpiresAt: time.Now().Add(ttl),
+			IPAddress: s.IPAddress,
+			UserAgent: s.UserAgent,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error loading session %s: %w", s.Token, err)
+		}
+	}
+
+	for _, e := range scenario.AuditEvents {
+		accountID, ok := result.AccountIDs[e.Account]
+		if !ok {
+			return nil, fmt.Errorf("audit event %s references account %s which is not in the scenario", e.Type, e.Account)
+		}
+		if !created[e.Account] {
+			// the account's events were written when it was
+			continue
+		}
+
+		err := repo.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+			AccountID: accountID,
+			EventType: e.Type,
+			IPAddress: e.IPAddress,
+			UserAgent: e.UserAgent,
+			Details:   e.Details,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error loading audit event %s for %s: %w", e.Type, e.Account, err)
+		}
+	}
+
+	return result, nil
+}
+
+// loadAccount returns the ID of the account, and whether it was created rather than found
+func loadAccount(ctx context.Context, repo Repository, a Account) (string, bool, error) {
+	existing, err := repo.GetAccount(ctx, a.Email)
+	if err == nil {
+		return existing.ID, false, nil
+	}
+	if !errors.Is(err, database.ErrAccountNotFound) {
+		return "", false, err
+	}
+
+	hash := a.PasswordHash
+	if hash == "" {
+		if a.Password == "" {
+			return "", false, errors.New("either password or password_hash is required")
+		}
+		hash, err = auth.HashPassword(a.Password)
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	created, err := repo.CreateAccount(ctx, database.AccountCreationParams{
+		Email:           a.Email,
+		PasswordHash:    hash,
+		PreferredLocale: a.PreferredLocale,
+		Verified:        !a.Unverified,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	return created.ID, true, nil
+}
+
+func loadOrganization(ctx context.Context, repo Repository, o Organization, accountIDs map[string]string) (string, error) {
+	ownerID, ok := accountIDs[o.Owner]
+	if !ok {
+		return "", fmt.Errorf("owner %s is not in the scenario", o.Owner)
+	}
+
+	type member struct{ accountID, role string }
+	members := make([]member, 0, len(o.Members))
+	for _, m := range o.Members {
+		accountID, ok := accountIDs[m.Account]
+		if !ok {
+			return "", fmt.Errorf("member %s is not in the scenario", m.Account)
+		}
+		role := m.Role
+		if role == "" {
+			role = database.OrganizationRoleMember
+		}
+		switch role {
+		case database.OrganizationRoleOwner, database.OrganizationRoleAdmin, database.OrganizationRoleMember:
+		default:
+			return "", fmt.Errorf("invalid role %q for member %s", m.Role, m.Account)
+		}
+		members = append(members, member{accountID, role})
+	}
+
+	orgs, err := repo.ListAccountOrganizations(ctx, ownerID)
+	if err != nil {
+		return "", err
+	}
+	var id string
+	for _, org := range orgs {
+		if org.Name == o.Name {
+			id = org.ID
+			break
+		}
+	}
+	if id == "" {
+		org, err := repo.CreateOrganization(ctx, o.Name, ownerID)
+		if err != nil {
+			return "", err
+		}
+		id = org.ID
+	}
+
+	// members that are already in the organization keep their role
+	for _, m := range members {
+		if _, err := repo.AddOrganizationMember(ctx, id, m.accountID, m.role); err != nil {
+			return "", fmt.Errorf("error adding member: %w", err)
+		}
+	}
+
+	return id, nil
+}
@@ -0,0 +1,270 @@
+package fixtures
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "scenario.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`
+accounts:
+  - email: yaml@test.com
+    password: Test123!@#
+sessions:
+  - account: yaml@test.com
+    token: yaml-token
+    expires_in: 1h
+`), 0o600))
+
+	jsonPath := filepath.Join(dir, "scenario.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{
+		"accounts": [{"email": "json@test.com", "password_hash": "hash"}]
+	}`), 0o600))
+
+	txtPath := filepath.Join(dir, "scenario.txt")
+	require.NoError(t, os.WriteFile(txtPath, []byte(``), 0o600))
+
+	scenario, err := LoadFile(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, []Account{{Email: "yaml@test.com", Password: "Test123!@#"}}, scenario.Accounts)
+	assert.Equal(t, []Session{{Account: "yaml@test.com", Token: "yaml-token", ExpiresIn: "1h"}}, scenario.Sessions)
+
+	scenario, err = LoadFile(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, []Account{{Email: "json@test.com", PasswordHash: "hash"}}, scenario.Accounts)
+
+	_, err = LoadFile(txtPath)
+	require.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		scenario    Scenario
+		shouldError bool
+		verify      func(t *testing.T, db *database.MemoryDB, result *Result)
+	}{
+		{
+			name: "accounts and sessions",
+			scenario: Scenario{
+				Accounts: []Account{
+					{Email: "alice@test.com", Password: "Test123!@#", PreferredLocale: "es"},
+					{Email: "bob@test.com", PasswordHash: "pre-hashed"},
+				},
+				Sessions: []Session{
+					{Account: "alice@test.com", Token: "alice-token"},
+					{Account: "bob@test.com", Token: "bob-token", ExpiresIn: "-1h"},
+				},
+			},
+			verify: func(t *testing.T, db *database.MemoryDB, result *Result) {
+				alice, err := db.GetAccount(ctx, "alice@test.com")
+				require.NoError(t, err)
+				assert.Equal(t, result.AccountIDs["alice@test.com"], alice.ID)
+				assert.Equal(t, "es", alice.PreferredLocale)
+				assert.True(t, auth.PasswordIsCorrect("Test123!@#", alice.PasswordHash))
+
+				bob, err := db.GetAccount(ctx, "bob@test.com")
+				require.NoError(t, err)
+				assert.Equal(t, "pre-hashed", bob.PasswordHash)
+
+				token, err := db.GetRefreshToken(ctx, "alice-token")
+				require.NoError(t, err)
+				assert.Equal(t, alice.ID, token.AccountID)
+				assert.WithinDuration(t, time.Now().Add(defaultSessionTTL), token.ExpiresAt, time.Minute)
+
+				token, err = db.GetRefreshToken(ctx, "bob-token")
+				require.NoError(t, err)
+				assert.True(t, token.ExpiresAt.Before(time.Now()))
+			},
+		},
+		{
+			name: "audit events",
+			scenario: Scenario{
+				Accounts:    []Account{{Email: "alice@test.com", PasswordHash: "hash"}},
+				AuditEvents: []AuditEvent{{Account: "alice@test.com", Type: database.AuditEventLogin, IPAddress: "192.0.2.1"}},
+			},
+			verify: func(t *testing.T, db *database.MemoryDB, result *Result) {
+				events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: result.AccountIDs["alice@test.com"]})
+				require.NoError(t, err)
+				require.Len(t, events, 1)
+				assert.Equal(t, database.AuditEventLogin, events[0].EventType)
+				assert.Equal(t, "192.0.2.1", events[0].IPAddress)
+			},
+		},
+		{
+			name: "organizations",
+			scenario: Scenario{
+				Accounts: []Account{
+					{Email: "alice@test.com", PasswordHash: "hash"},
+					{Email: "bob@test.com", PasswordHash: "hash"},
+					{Email: "carla@test.com", PasswordHash: "hash"},
+				},
+				Organizations: []Organization{{
+					Name:  "Acme",
+					Owner: "alice@test.com",
+					Members: []Member{
+						{Account: "bob@test.com", Role: database.OrganizationRoleAdmin},
+						{Account: "carla@test.com"},
+					},
+				}},
+			},
+			verify: func(t *testing.T, db *database.MemoryDB, result *Result) {
+				org, err := db.GetOrganization(ctx, result.OrganizationIDs["Acme"])
+				require.NoError(t, err)
+				assert.Equal(t, "Acme", org.Name)
+
+				for email, role := range map[string]string{
+					"alice@test.com": database.OrganizationRoleOwner,
+					"bob@test.com":   database.OrganizationRoleAdmin,
+					"carla@test.com": database.OrganizationRoleMember,
+				} {
+					member, err := db.GetOrganizationMember(ctx, org.ID, result.AccountIDs[email])
+					require.NoError(t, err)
+					assert.Equal(t, role, member.Role, email)
+				}
+			},
+		},
+		{
+			name: "organization member with an invalid role",
+			scenario: Scenario{
+				Accounts: []Account{{Email: "alice@test.com", PasswordHash: "hash"}},
+				Organizations: []Organization{{
+					Name:    "Acme",
+					Owner:   "alice@test.com",
+					Members: []Member{{Account: "alice@test.com", Role: "superuser"}},
+				}},
+			},
+			shouldError: true,
+		},
+		{
+			name: "organization owned by unknown account",
+			scenario: Scenario{
+				Organizations: []Organization{{Name: "Acme", Owner: "ghost@test.com"}},
+			},
+			shouldError: true,
+		},
+		{
+			name: "audit event for unknown account",
+			scenario: Scenario{
+				AuditEvents: []AuditEvent{{Account: "ghost@test.com", Type: database.AuditEventLogin}},
+			},
+			shouldError: true,
+		},
+		{
+			name: "missing password",
+			scenario: Scenario{
+				Accounts: []Account{{Email: "nopassword@test.com"}},
+			},
+			shouldError: true,
+		},
+		{
+			name: "session for unknown account",
+			scenario: Scenario{
+				Sessions: []Session{{Account: "ghost@test.com", Token: "ghost-token"}},
+			},
+			shouldError: true,
+		},
+		{
+			name: "invalid expires_in",
+			scenario: Scenario{
+				Accounts: []Account{{Email: "alice@test.com", PasswordHash: "hash"}},
+				Sessions: []Session{{Account: "alice@test.com", Token: "t", ExpiresIn: "tomorrow"}},
+			},
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := database.NewMemoryDB()
+
+			result, err := Load(ctx, db, tt.scenario)
+			if tt.shouldError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			tt.verify(t, db, result)
+		})
+	}
+}
+
+func TestLoadIsRepeatable(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemoryDB()
+
+	scenario := Scenario{
+		Accounts: []Account{
+			{Email: "repeat@test.com", PasswordHash: "hash"},
+			{Email: "member@test.com", PasswordHash: "hash"},
+		},
+		Organizations: []Organization{{
+			Name:    "Acme",
+			Owner:   "repeat@test.com",
+			Members: []Member{{Account: "member@test.com"}},
+		}},
+		Sessions:    []Session{{Account: "repeat@test.com", Token: "repeat-token", ExpiresIn: "1h"}},
+		AuditEvents: []AuditEvent{{Account: "repeat@test.com", Type: database.AuditEventLogin}},
+	}
+
+	first, err := Load(ctx, db, scenario)
+	require.NoError(t, err)
+
+	// a reload refreshes the session
+	scenario.Sessions[0].ExpiresIn = "2h"
+	second, err := Load(ctx, db, scenario)
+	require.NoError(t, err)
+
+	assert.Equal(t, first.AccountIDs, second.AccountIDs)
+	assert.Equal(t, first.OrganizationIDs, second.OrganizationIDs)
+
+	orgs, err := db.ListAccountOrganizations(ctx, first.AccountIDs["repeat@test.com"])
+	require.NoError(t, err)
+	assert.Len(t, orgs, 1)
+
+	token, err := db.GetRefreshToken(ctx, "repeat-token")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), token.ExpiresAt, time.Minute)
+
+	events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: first.AccountIDs["repeat@test.com"]})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestLoadIsRepeatableWithSQLite(t *testing.T) {
+	// the fixed session tokens are unique in a real database, unlike in MemoryDB
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "fixtures.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	scenario, err := LoadFile("../../fixtures/demo.yaml")
+	require.NoError(t, err)
+
+	first, err := Load(context.Background(), db, *scenario)
+	require.NoError(t, err)
+	second, err := Load(context.Background(), db, *scenario)
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+}
+
+func TestDemoScenario(t *testing.T) {
+	scenario, err := LoadFile("../../fixtures/demo.yaml")
+	require.NoError(t, err)
+
+	_, err = Load(context.Background(), database.NewMemoryDB(), *scenario)
+	require.NoError(t, err)
+}
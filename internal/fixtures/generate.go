@@ -0,0 +1,133 @@
+package fixtures
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/i18n"
+	"github.com/austinwofford/account-management/internal/service/auth"
+)
+
+// GenerateConfig sizes a generated scenario
+type GenerateConfig struct {
+	Accounts           int
+	SessionsPerAccount int
+	// AuditEventsPerAccount includes the account_created event every account starts with
+	AuditEventsPerAccount int
+	// Seed picks the data. The same config always generates the same scenario.
+	Seed uint64
+	// Password is every account's password, so any of them can sign in
+	Password string
+}
+
+func DefaultGenerateConfig() GenerateConfig {
+	return GenerateConfig{
+		Accounts:              100,
+		SessionsPerAccount:    2,
+		AuditEventsPerAccount: 5,
+		Seed:                  1,
+		Password:              "Seeded-Passw0rd!",
+	}
+}
+
+var (
+	firstNames = []string{"ada", "alan", "barbara", "claude", "donald", "edsger", "frances", "grace", "ken", "leslie", "margaret", "niklaus", "radia", "tim"}
+	lastNames  = []string{"allen", "hamilton", "hopper", "knuth", "lamport", "liskov", "lovelace", "perlman", "ritchie", "shannon", "thompson", "turing", "wirth"}
+	userAgents = []string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Mobile Safari/537.36",
+	}
+	// logins are the most common, like in a real audit log
+	eventTypes = []string{
+		database.AuditEventLogin, database.AuditEventLogin, database.AuditEventLogin,
+		database.AuditEventTokenRefreshed, database.AuditEventTokenRefreshed,
+		database.AuditEventLoginFailed, database.AuditEventLogout, database.AuditEventNewSignIn,
+		database.AuditEventPasswordChanged,
+	}
+)
+
+// Generate returns a scenario of made up accounts, each with sessions and audit events. Emails
+// are unique within a scenario and IP addresses are from the ranges reserved for documentation.
+func Generate(cfg GenerateConfig) (*Scenario, error) {
+	// hashed once rather than for every account, hashing is slow on purpose
+	passwordHash, err := auth.HashPassword(cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing password: %w", err)
+	}
+
+	r := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+	scenario := &Scenario{}
+	for i := range cfg.Accounts {
+		email := fmt.Sprintf("%s.%s.%d@example.com", pick(r, firstNames), pick(r, lastNames), i+1)
+		scenario.Accounts = append(scenario.Accounts, Account{
+			Email:           email,
+			PasswordHash:    passwordHash,
+			PreferredLocale: pick(r, i18n.SupportedLocales),
+			// some never clicked the link
+			Unverified: r.IntN(10) == 0,
+		})
+
+		for range cfg.SessionsPerAccount {
+			scenario.Sessions = append(scenario.Sessions, Session{
+				Account:   email,
+				Token:     fmt.Sprintf("seed-%016x%016x", r.Uint64(), r.Uint64()),
+				ExpiresIn: fmt.Sprintf("%dh", 1+r.IntN(30*24)),
+				IPAddress: ipAddress(r),
+				UserAgent: pick(r, userAgents),
+			})
+		}
+
+		for j := range cfg.AuditEventsPerAccount {
+			eventType := pick(r, eventTypes)
+			if j == 0 {
+				eventType = database.AuditEventAccountCreated
+			}
+			scenario.AuditEvents = append(scenario.AuditEvents, AuditEvent{
+				Account:   email,
+				Type:      eventType,
+				IPAddress: ipAddress(r),
+				UserAgent: pick(r, userAgents),
+			})
+		}
+	}
+	return scenario, nil
+}
+
+// Seed loads a generated scenario into repo, failing the test if it can't
+func Seed(tb testing.TB, repo Repository, cfg GenerateConfig) *Result {
+	tb.Helper()
+
+	scenario, err := Generate(cfg)
+	if err != nil {
+		tb.Fatalf("error generating scenario: %v", err)
+	}
+	result, err := Load(context.Background(), repo, *scenario)
+	if err != nil {
+		tb.Fatalf("error loading scenario: %v", err)
+	}
+	return result
+}
+
+func pick(r *rand.Rand, items []string) string {
+	return items[r.IntN(len(items))]
+}
+
+// ipAddress returns an address from TEST-NET-1, 2, or 3 (RFC 5737), or 2001:db8::/32 (RFC 3849)
+func ipAddress(r *rand.Rand) string {
+	switch r.IntN(4) {
+	case 0:
+		return fmt.Sprintf("192.0.2.%d", 1+r.IntN(254))
+	case 1:
+		return fmt.Sprintf("198.51.100.%d", 1+r.IntN(254))
+	case 2:
+		return fmt.Sprintf("203.0.113.%d", 1+r.IntN(254))
+	default:
+		return fmt.Sprintf("2001:db8::%x", 1+r.IntN(0xffff))
+	}
+}
@@ -0,0 +1,72 @@
+package fixtures
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	cfg := DefaultGenerateConfig()
+	cfg.Accounts = 20
+
+	scenario, err := Generate(cfg)
+	require.NoError(t, err)
+	assert.Len(t, scenario.Accounts, 20)
+	assert.Len(t, scenario.Sessions, 20*cfg.SessionsPerAccount)
+	assert.Len(t, scenario.AuditEvents, 20*cfg.AuditEventsPerAccount)
+
+	emails := map[string]bool{}
+	for _, account := range scenario.Accounts {
+		emails[account.Email] = true
+	}
+	assert.Len(t, emails, 20)
+	assert.True(t, auth.PasswordIsCorrect(cfg.Password, scenario.Accounts[0].PasswordHash))
+	assert.Equal(t, database.AuditEventAccountCreated, scenario.AuditEvents[0].Type)
+
+	t.Run("the same seed generates the same data", func(t *testing.T) {
+		again, err := Generate(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, scenario.Sessions, again.Sessions)
+		assert.Equal(t, scenario.AuditEvents, again.AuditEvents)
+		for i := range scenario.Accounts {
+			assert.Equal(t, scenario.Accounts[i].Email, again.Accounts[i].Email)
+		}
+
+		cfg.Seed++
+		other, err := Generate(cfg)
+		require.NoError(t, err)
+		assert.NotEqual(t, scenario.Sessions, other.Sessions)
+	})
+
+	t.Run("password has to satisfy the password rules", func(t *testing.T) {
+		cfg.Password = "short"
+		_, err := Generate(cfg)
+		assert.Error(t, err)
+	})
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemoryDB()
+
+	cfg := DefaultGenerateConfig()
+	cfg.Accounts = 5
+	result := Seed(t, db, cfg)
+	require.Len(t, result.AccountIDs, 5)
+
+	for _, id := range result.AccountIDs {
+		sessions, err := db.ListSessions(ctx, id, time.Now())
+		require.NoError(t, err)
+		assert.Len(t, sessions, cfg.SessionsPerAccount)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: id})
+		require.NoError(t, err)
+		assert.Len(t, events, cfg.AuditEventsPerAccount)
+	}
+}
@@ -0,0 +1,140 @@
+package i18n
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is used when a client doesn't send an Accept-Language header
+// or none of the requested languages are supported.
+const DefaultLocale = "en"
+
+// SupportedLocales are the locales we have translations for.
+var SupportedLocales = []string{"en", "es", "de"}
+
+var ErrInvalidAcceptLanguage = errors.New("invalid Accept-Language header")
+
+// languageTagPattern is a loose check for BCP 47 tags (e.g. en, en-US, zh-Hant-TW)
+var languageTagPattern = regexp.MustCompile(`^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$`)
+
+// LanguageRange is a single entry of an Accept-Language header.
+type LanguageRange struct {
+	Tag     string
+	Quality float64
+}
+
+// ParseAcceptLanguage parses an Accept-Language header value into language ranges
+// sorted by quality (highest first). Ranges with q=0 are dropped.
+func ParseAcceptLanguage(header string) ([]LanguageRange, error) {
+	var ranges []LanguageRange
+
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		if tag != "*" && !languageTagPattern.MatchString(tag) {
+			return nil, ErrInvalidAcceptLanguage
+		}
+
+		quality := 1.0
+		if params != "" {
+			name, value, ok := strings.Cut(strings.TrimSpace(params), "=")
+			if !ok || strings.TrimSpace(name) != "q" {
+				return nil, ErrInvalidAcceptLanguage
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || q < 0 || q > 1 {
+				return nil, ErrInvalidAcceptLanguage
+			}
+			quality = q
+		}
+
+		if quality == 0 {
+			continue
+		}
+
+		ranges = append(ranges, LanguageRange{Tag: strings.ToLower(tag), Quality: quality})
+	}
+
+	// stable so that equal qualities keep the client's ordering
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].Quality > ranges[j].Quality
+	})
+
+	return ranges, nil
+}
+
+// Negotiate picks the best supported locale for an Accept-Language header.
+// Malformed headers fall back to the default locale along with the parse error.
+func Negotiate(header string) (string, error) {
+	ranges, err := ParseAcceptLanguage(header)
+	if err != nil {
+		return DefaultLocale, err
+	}
+
+	for _, r := range ranges {
+		if r.Tag == "*" {
+			return DefaultLocale, nil
+		}
+		if locale, ok := Match(r.Tag); ok {
+			return locale, nil
+		}
+	}
+
+	return DefaultLocale, nil
+}
+
+// Match returns the supported locale for a language tag, matching on the
+// primary language subtag when there's no exact match (en-US -> en).
+func Match(tag string) (string, bool) {
+	tag = strings.ToLower(tag)
+	base, _, _ := strings.Cut(tag, "-")
+
+	for _, locale := range SupportedLocales {
+		if locale == tag || locale == base {
+			return locale, true
+		}
+	}
+
+	return "", false
+}
+
+// IsSupported reports whether a locale is exactly one of the supported locales.
+func IsSupported(locale string) bool {
+	for _, l := range SupportedLocales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+type localeKey struct{}
+
+// WithLocale stores the negotiated locale on the context.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// LocaleFromContext returns the negotiated locale, or the default locale
+// if none was negotiated for this request.
+func LocaleFromContext(ctx context.Context) string {
+	if locale, ok := NegotiatedLocale(ctx); ok {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// NegotiatedLocale returns the locale stored on the context, and false if none was.
+func NegotiatedLocale(ctx context.Context) (string, bool) {
+	locale, ok := ctx.Value(localeKey{}).(string)
+	return locale, ok && locale != ""
+}
@@ -0,0 +1,203 @@
+package i18n
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		expectedRanges []LanguageRange
+		shouldError    bool
+	}{
+		{
+			name:   "single tag",
+			header: "es",
+			expectedRanges: []LanguageRange{
+				{Tag: "es", Quality: 1},
+			},
+		},
+		{
+			name:   "sorted by quality",
+			header: "en;q=0.5, de-DE, es;q=0.8",
+			expectedRanges: []LanguageRange{
+				{Tag: "de-de", Quality: 1},
+				{Tag: "es", Quality: 0.8},
+				{Tag: "en", Quality: 0.5},
+			},
+		},
+		{
+			name:   "zero quality dropped",
+			header: "es;q=0, en",
+			expectedRanges: []LanguageRange{
+				{Tag: "en", Quality: 1},
+			},
+		},
+		{
+			name:   "empty header",
+			header: "",
+		},
+		{
+			name:        "invalid tag",
+			header:      "not a tag!",
+			shouldError: true,
+		},
+		{
+			name:        "invalid quality",
+			header:      "en;q=2",
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := ParseAcceptLanguage(tt.header)
+			if tt.shouldError {
+				require.ErrorIs(t, err, ErrInvalidAcceptLanguage)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedRanges, actual)
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		expectedLocale string
+		shouldError    bool
+	}{
+		{name: "no header", header: "", expectedLocale: DefaultLocale},
+		{name: "exact match", header: "de", expectedLocale: "de"},
+		{name: "region falls back to base", header: "es-MX", expectedLocale: "es"},
+		{name: "first supported wins", header: "fr, de;q=0.9, es;q=0.8", expectedLocale: "de"},
+		{name: "nothing supported", header: "fr, ja", expectedLocale: DefaultLocale},
+		{name: "wildcard", header: "fr, *;q=0.5", expectedLocale: DefaultLocale},
+		{name: "malformed", header: "en;q=abc", expectedLocale: DefaultLocale, shouldError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := Negotiate(tt.header)
+			if tt.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedLocale, actual)
+		})
+	}
+}
+
+func TestLocaleFromContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, DefaultLocale, LocaleFromContext(ctx))
+
+	_, ok := NegotiatedLocale(ctx)
+	assert.False(t, ok)
+
+	ctx = WithLocale(ctx, "es")
+	assert.Equal(t, "es", LocaleFromContext(ctx))
+	locale, ok := NegotiatedLocale(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "es", locale)
+}
+
+func TestTranslate(t *testing.T) {
+	assert.Equal(t, "La contraseña es incorrecta", Translate("es", "incorrect_password", "Password is incorrect"))
+	assert.Equal(t, "Password is incorrect", Translate("en", "incorrect_password", "Password is incorrect"))
+	assert.Equal(t, "fallback", Translate("de", "unknown_type", "fallback"))
+	assert.Equal(t, "Password is incorrect", Translate("en", "incorrect_password", ""))
+}
+
+func TestMessageCatalogs(t *testing.T) {
+	catalogs, err := loadMessages(localeFiles)
+	require.NoError(t, err)
+
+	// every locale translates exactly the error types the English catalog has
+	source := catalogs[DefaultLocale]
+	require.NotEmpty(t, source)
+	for _, locale := range SupportedLocales {
+		require.Len(t, catalogs[locale], len(source), locale)
+		for errType, msg := range catalogs[locale] {
+			assert.Contains(t, source, errType, "%s translates an unknown error type", locale)
+			assert.NotEmpty(t, msg, "%s %s", locale, errType)
+		}
+	}
+}
+
+// dynamicErrorTypes are error types whose messages are built from what went wrong, which a
+// catalog message would hide
+var dynamicErrorTypes = map[string]bool{
+	"validation_error":     true,
+	"invalid_config":       true,
+	"invalid_signing_keys": true,
+	// only sent to the OAuth client's redirect URI, never in an error response
+	"access_denied": true,
+}
+
+func TestEveryErrorTypeHasAMessage(t *testing.T) {
+	catalogs, err := loadMessages(localeFiles)
+	require.NoError(t, err)
+
+	// the errType constants the handlers and middleware answer with
+	errTypes := map[string]string{}
+	err = filepath.WalkDir("..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return err
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return err
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				value := spec.(*ast.ValueSpec)
+				for i, name := range value.Names {
+					if !strings.HasPrefix(name.Name, "errType") || i >= len(value.Values) {
+						continue
+					}
+					lit, ok := value.Values[i].(*ast.BasicLit)
+					if !ok || lit.Kind != token.STRING {
+						continue
+					}
+					errType, err := strconv.Unquote(lit.Value)
+					if err != nil {
+						return err
+					}
+					errTypes[errType] = path
+				}
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, errTypes)
+
+	for errType, path := range errTypes {
+		if dynamicErrorTypes[errType] {
+			continue
+		}
+		for _, locale := range SupportedLocales {
+			assert.Contains(t, catalogs[locale], errType, "%s has no %s message (from %s)", locale, errType, path)
+		}
+	}
+}
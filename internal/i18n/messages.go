@@ -0,0 +1,58 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+)
+
+// localeFiles are the message catalogs, one JSON object per supported locale mapping the stable
+// error type to its message. en.json is the source the others are translated from.
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// messages holds the error messages keyed by locale and then by error type
+var messages = mustLoadMessages(localeFiles)
+
+// loadMessages reads the catalog of every supported locale from fsys
+func loadMessages(fsys fs.FS) (map[string]map[string]string, error) {
+	catalogs := make(map[string]map[string]string, len(SupportedLocales))
+	for _, locale := range SupportedLocales {
+		b, err := fs.ReadFile(fsys, "locales/"+locale+".json")
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s messages: %w", locale, err)
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(b, &catalog); err != nil {
+			return nil, fmt.Errorf("error parsing %s messages: %w", locale, err)
+		}
+		catalogs[locale] = catalog
+	}
+	return catalogs, nil
+}
+
+func mustLoadMessages(fsys fs.FS) map[string]map[string]string {
+	catalogs, err := loadMessages(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return catalogs
+}
+
+// Translate returns the message for an error type in the given locale. If there is no
+// translation the fallback (normally the handler's English message) is returned. English
+// messages don't replace the fallback, handlers can be more specific than the catalog; the
+// catalog's English message is only used when the fallback is empty.
+func Translate(locale, errType, fallback string) string {
+	if locale != DefaultLocale {
+		if msg, ok := messages[locale][errType]; ok {
+			return msg
+		}
+	}
+	if fallback != "" {
+		return fallback
+	}
+	return messages[DefaultLocale][errType]
+}
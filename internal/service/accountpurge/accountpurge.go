@@ -0,0 +1,68 @@
+// Package accountpurge permanently removes deleted accounts once their retention period is over.
+// Deleting an account only soft deletes it, so it can still be investigated or restored by
+// support for a while.
+package accountpurge
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type Config struct {
+	// Retention is how long deleted accounts are kept before they're purged
+	Retention time.Duration
+	// Interval is how often deleted accounts are purged
+	Interval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Retention: 30 * 24 * time.Hour,
+		Interval:  time.Hour,
+	}
+}
+
+// Sweeper purges deleted accounts on an interval
+type Sweeper struct {
+	purge   func(ctx context.Context, deletedBefore time.Time) (int64, error)
+	cfg     Config
+	timeNow func() time.Time
+}
+
+// NewSweeper returns a sweeper that runs purge, usually the database's PurgeDeletedAccounts
+func NewSweeper(purge func(ctx context.Context, deletedBefore time.Time) (int64, error), cfg Config) *Sweeper {
+	return &Sweeper{purge: purge, cfg: cfg, timeNow: time.Now}
+}
+
+// Run purges deleted accounts every interval until ctx is done
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		// a failed sweep is retried on the next tick
+		if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "error purging deleted accounts", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep purges the accounts deleted more than the retention period ago and returns how many
+// were purged
+func (s *Sweeper) Sweep(ctx context.Context) (int64, error) {
+	purged, err := s.purge(ctx, s.timeNow().Add(-s.cfg.Retention))
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		slog.InfoContext(ctx, "purged deleted accounts", "count", purged)
+	}
+	return purged, nil
+}
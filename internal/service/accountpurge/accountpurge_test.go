@@ -0,0 +1,65 @@
+package accountpurge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "purge@test.com"})
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+
+	s := NewSweeper(db.PurgeDeletedAccounts, Config{Retention: time.Hour, Interval: time.Hour})
+
+	// still within the retention period
+	purged, err := s.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	s.timeNow = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	purged, err = s.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	purged, err = s.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+}
+
+func TestRun(t *testing.T) {
+	var sweeps atomic.Int32
+	purge := func(ctx context.Context, deletedBefore time.Time) (int64, error) {
+		sweeps.Add(1)
+		return 0, errors.New("connection refused")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewSweeper(purge, Config{Retention: time.Hour, Interval: 10 * time.Millisecond})
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	// failed sweeps are retried
+	assert.Eventually(t, func() bool { return sweeps.Load() >= 3 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after ctx was done")
+	}
+}
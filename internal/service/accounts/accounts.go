@@ -0,0 +1,212 @@
+// Package accounts is the account business logic behind the transports: registering, logging
+// in, and issuing, refreshing, and revoking tokens. Methods take plain parameters and return
+// domain results and errors; turning those into status codes and response bodies is left to the
+// HTTP handlers, and to any other transport built on the service.
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/featureflags"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/service/metrics"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+)
+
+var (
+	ErrInvalidEmail         = errors.New("invalid email")
+	ErrUnsupportedLocale    = errors.New("unsupported preferred locale")
+	ErrBreachedPassword     = errors.New("password appeared in a data breach")
+	ErrAccountAlreadyExists = errors.New("account already exists")
+	ErrAccountNotFound      = errors.New("account not found")
+	ErrIncorrectPassword    = errors.New("incorrect password")
+	ErrAccountFrozen        = errors.New("account frozen")
+	ErrEmailNotVerified     = errors.New("email not verified")
+	// ErrInvalidMFAChallenge is an MFA challenge that's invalid or expired, or for an account
+	// that no longer has MFA
+	ErrInvalidMFAChallenge = errors.New("invalid MFA challenge")
+	// ErrIncorrectMFACode is a wrong or already used code
+	ErrIncorrectMFACode = errors.New("incorrect MFA code")
+	// ErrSessionExpired is a refresh token that's unknown, expired, rotated out, or revoked
+	ErrSessionExpired = errors.New("session expired")
+	// ErrScopeNotGranted is a refresh asking for scopes its session wasn't granted
+	ErrScopeNotGranted = errors.New("scope not granted")
+)
+
+// LockedOutError is a login refused after too many failed attempts
+type LockedOutError struct {
+	// RetryAfter is how long until the next attempt is allowed
+	RetryAfter time.Duration
+}
+
+func (e *LockedOutError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter)
+}
+
+// Repository defines the DB methods needed by the account service
+type Repository interface {
+	// WithTx runs fn in a transaction. fn has to make its changes with tx for them to be part of it.
+	WithTx(ctx context.Context, fn func(tx database.Repository) error) error
+	GetAccount(ctx context.Context, email string) (*database.Account, error)
+	GetAccountByUsername(ctx context.Context, username string) (*database.Account, error)
+	GetAccountByID(ctx context.Context, id string) (*database.Account, error)
+	GetRefreshToken(ctx context.Context, token string) (*database.RefreshToken, error)
+	CreateRefreshToken(ctx context.Context, params database.CreateRefreshTokenParams) error
+	DeleteRefreshTokensByAccount(ctx context.Context, accountID string) error
+	DeleteRefreshTokenByToken(ctx context.Context, token string) error
+	CreateEmailVerification(ctx context.Context, params database.CreateEmailVerificationParams) error
+	VerifyAccount(ctx context.Context, id string) (*database.Account, error)
+	RehashPassword(ctx context.Context, id, oldHash, newHash string) error
+	GetMFASecret(ctx context.Context, accountID string) (*database.MFASecret, error)
+	UseMFAStep(ctx context.Context, accountID string, step int64) error
+	ReplaceMFARecoveryCodes(ctx context.Context, accountID string, codeHashes []string) error
+	UseMFARecoveryCode(ctx context.Context, accountID, codeHash string) error
+	CountMFARecoveryCodes(ctx context.Context, accountID string) (int, error)
+	SetMFAPhone(ctx context.Context, accountID, phoneNumber string) error
+	GetMFAPhone(ctx context.Context, accountID string) (*database.MFAPhone, error)
+	VerifyMFAPhone(ctx context.Context, accountID string) (*database.MFAPhone, error)
+	SetMFAPhoneCode(ctx context.Context, params database.SetMFAPhoneCodeParams) error
+	UseMFAPhoneCode(ctx context.Context, accountID, codeHash string, now time.Time) error
+	CreateTrustedDevice(ctx context.Context, params database.CreateTrustedDeviceParams) (*database.TrustedDevice, error)
+	UseTrustedDevice(ctx context.Context, params database.UseTrustedDeviceParams) error
+	GetAccountRoles(ctx context.Context, accountID string) ([]string, error)
+	CreateAuditEvent(ctx context.Context, params database.CreateAuditEventParams) error
+	DeleteSession(ctx context.Context, accountID, sessionID string) error
+	CancelDeletionRequest(ctx context.Context, accountID string) (*database.DeletionRequest, error)
+	CreateKnownDevice(ctx context.Context, params database.CreateKnownDeviceParams) (*database.KnownDevice, error)
+	TouchKnownDevice(ctx context.Context, params database.TouchKnownDeviceParams) error
+	CountKnownDevices(ctx context.Context, accountID string) (int, error)
+	GetKnownDeviceByRevokeTokenHash(ctx context.Context, tokenHash string) (*database.KnownDevice, error)
+	DeleteKnownDevice(ctx context.Context, id string) error
+}
+
+// BreachChecker reports whether a password appeared in a known data breach. hibp.Client
+// implements it.
+type BreachChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+type Config struct {
+	DB         Repository
+	AuthClient *auth.Client
+	// Mailer sends new accounts their verification link, and new sign-in emails
+	Mailer mailer.Sender
+	// AppURL is the base URL of the web app that links in emails point to
+	AppURL string
+	// Lockout throttles repeated failed logins. Optional.
+	Lockout *lockout.Guard
+	// FeatureFlags picks the flags that go into access tokens. Optional.
+	FeatureFlags *featureflags.Evaluator
+	// TokenAppMetadataKeys are the app_metadata keys copied into access tokens. Optional.
+	TokenAppMetadataKeys []string
+	// AcceptAnyPassword skips password checks on login. Only for mock mode.
+	AcceptAnyPassword bool
+	// RequireEmailVerification blocks password logins until the account's email is verified
+	RequireEmailVerification bool
+	// RefreshTokenRotation makes refresh tokens single use, once RefreshTokenGracePeriod has
+	// passed
+	RefreshTokenRotation    bool
+	RefreshTokenGracePeriod time.Duration
+	// SignedRefreshTokens issues self-contained refresh tokens that are checked against
+	// Revocations instead of the database. Revocations defaults to an in-memory list.
+	SignedRefreshTokens bool
+	Revocations         *revocation.List
+	// AccessTokenRevocations are the access tokens revoked before they expire. Used magic links
+	// are tracked with them too. Defaults to an in-memory list.
+	AccessTokenRevocations *revocation.AccessTokens
+	// BreachedPasswords checks new passwords against known breaches. Optional. Breached
+	// passwords are only reported unless EnforceBreachedPasswords rejects them.
+	BreachedPasswords        BreachChecker
+	EnforceBreachedPasswords bool
+	// Passwords hashes and verifies passwords. Defaults to auth.DefaultHasherConfig.
+	Passwords *auth.PasswordHasher
+	// PasswordPolicy is the rules new passwords have to follow. Defaults to
+	// auth.DefaultPasswordPolicyConfig.
+	PasswordPolicy *auth.PasswordPolicy
+	// Metrics records password hashing durations and issued tokens. Optional.
+	Metrics *metrics.Metrics
+	// AuditLog records security events. Defaults to writing them to DB.
+	AuditLog audit.Recorder
+	// NewSignInAlerts remembers the devices and locations accounts log in from, and emails
+	// accounts about logins from new ones
+	NewSignInAlerts bool
+	// TrustedDeviceTTL is how long a device trusted after completing MFA skips the MFA
+	// challenge. 0 doesn't let devices be trusted.
+	TrustedDeviceTTL time.Duration
+	// SMS sends MFA codes to phone numbers, which turns them on as a second factor. Optional.
+	SMS *SMSConfig
+	// MagicLinks turns on logging in with a link emailed to the account. Optional.
+	MagicLinks *MagicLinkConfig
+}
+
+// Service registers accounts, logs them in, and manages their tokens
+type Service struct {
+	cfg Config
+}
+
+func NewService(cfg Config) *Service {
+	if cfg.Revocations == nil && cfg.AuthClient != nil {
+		cfg.Revocations = revocation.NewList(lockout.NewMemoryStore(), cfg.AuthClient.RefreshTokenTTL())
+	}
+	if cfg.SMS != nil {
+		smsCfg := *cfg.SMS
+		if smsCfg.CodeLength <= 0 {
+			smsCfg.CodeLength = 6
+		}
+		if smsCfg.TTL <= 0 {
+			smsCfg.TTL = 5 * time.Minute
+		}
+		cfg.SMS = &smsCfg
+	}
+	if cfg.AccessTokenRevocations == nil {
+		cfg.AccessTokenRevocations = revocation.NewAccessTokens(revocation.NewMemoryTokenStore())
+	}
+	if cfg.MagicLinks != nil {
+		magicLinkCfg := *cfg.MagicLinks
+		if magicLinkCfg.TTL <= 0 {
+			magicLinkCfg.TTL = DefaultMagicLinkTTL
+		}
+		if magicLinkCfg.Limiter == nil {
+			magicLinkCfg.Limiter = NewMagicLinkLimiter(lockout.NewMemoryStore(), DefaultMagicLinkLimit)
+		}
+		cfg.MagicLinks = &magicLinkCfg
+	}
+	if cfg.AuditLog == nil && cfg.DB != nil {
+		cfg.AuditLog = audit.Sync(cfg.DB.CreateAuditEvent)
+	}
+	return &Service{cfg: cfg}
+}
+
+// Client is who a request comes from. It's recorded on audit events and the sessions tokens
+// start.
+type Client struct {
+	IPAddress string
+	UserAgent string
+	RequestID string
+	// Location is where the client is, e.g. a country code. Optional.
+	Location string
+	// DeviceToken is the trusted device token a login was sent with, which skips MFA. Optional.
+	DeviceToken string
+	// Confirmation binds new access tokens to a client certificate. Optional.
+	Confirmation *auth.Confirmation
+	// Scopes restrict the session a login starts, or narrow the one a refresh continues, to
+	// some of auth.Scopes. Optional, empty doesn't restrict a new session.
+	Scopes []string
+}
+
+func (s *Service) recordAuditEvent(ctx context.Context, client Client, accountID, eventType string) {
+	s.cfg.AuditLog.Record(ctx, database.CreateAuditEventParams{
+		AccountID: accountID,
+		EventType: eventType,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		RequestID: client.RequestID,
+	})
+}
@@ -0,0 +1,275 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingMailer struct {
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// uncachedReadsDB records whether each account lookup by email asked to skip caches
+type uncachedReadsDB struct {
+	*database.MemoryDB
+	uncached []bool
+}
+
+func (d *uncachedReadsDB) GetAccount(ctx context.Context, email string) (*database.Account, error) {
+	d.uncached = append(d.uncached, database.UncachedReads(ctx))
+	return d.MemoryDB.GetAccount(ctx, email)
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+
+	setup := func(t *testing.T, cfg Config) (*Service, *database.MemoryDB, *recordingMailer) {
+		db := database.NewMemoryDB()
+		mail := &recordingMailer{}
+		cfg.DB = db
+		cfg.AuthClient = authClient
+		cfg.Mailer = mail
+		cfg.AppURL = "https://app.example.com"
+		return NewService(cfg), db, mail
+	}
+
+	register := func(t *testing.T, s *Service) *database.Account {
+		result, err := s.Register(ctx, RegisterParams{Email: "service@test.com", Password: "Test123!@#"}, Client{})
+		require.NoError(t, err)
+		return result.Account
+	}
+
+	eventTypes := func(t *testing.T, db *database.MemoryDB, accountID string) []string {
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: accountID, Keyset: database.Keyset{Limit: 50}})
+		require.NoError(t, err)
+		var types []string
+		for _, e := range events {
+			types = append(types, e.EventType)
+		}
+		return types
+	}
+
+	t.Run("register mails a verification link", func(t *testing.T) {
+		s, db, mail := setup(t, Config{})
+		account := register(t, s)
+
+		require.Len(t, mail.sent, 1)
+		assert.Equal(t, "service@test.com", mail.sent[0].To)
+		assert.Contains(t, mail.sent[0].Body, "https://app.example.com/verify?token=")
+		assert.Contains(t, eventTypes(t, db, account.ID), database.AuditEventAccountCreated)
+
+		_, err := s.Register(ctx, RegisterParams{Email: "service@test.com", Password: "Test123!@#"}, Client{})
+		assert.ErrorIs(t, err, ErrAccountAlreadyExists)
+	})
+
+	t.Run("register validates", func(t *testing.T) {
+		s, _, _ := setup(t, Config{})
+
+		_, err := s.Register(ctx, RegisterParams{Email: "not-an-email", Password: "Test123!@#"}, Client{})
+		assert.ErrorIs(t, err, ErrInvalidEmail)
+
+		_, err = s.Register(ctx, RegisterParams{Email: "service@test.com", Password: "Test123!@#", PreferredLocale: "xx"}, Client{})
+		assert.ErrorIs(t, err, ErrUnsupportedLocale)
+
+		_, err = s.Register(ctx, RegisterParams{Email: "service@test.com", Password: "short"}, Client{})
+		var validationErr auth.ValidationError
+		assert.True(t, errors.As(err, &validationErr), err)
+	})
+
+	t.Run("login", func(t *testing.T) {
+		s, db, _ := setup(t, Config{})
+		account := register(t, s)
+
+		_, err := s.Login(ctx, "missing@test.com", "Test123!@#", Client{})
+		assert.ErrorIs(t, err, ErrAccountNotFound)
+
+		_, err = s.Login(ctx, "service@test.com", "Wrong123!@#", Client{})
+		assert.ErrorIs(t, err, ErrIncorrectPassword)
+
+		result, err := s.Login(ctx, "service@test.com", "Test123!@#", Client{})
+		require.NoError(t, err)
+		require.NotNil(t, result.Tokens)
+		assert.Equal(t, account.ID, result.Tokens.AccountID)
+
+		claims, err := authClient.ParseAccessToken(result.Tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, claims.AccountID)
+
+		types := eventTypes(t, db, account.ID)
+		assert.Contains(t, types, database.AuditEventLoginFailed)
+		assert.Contains(t, types, database.AuditEventLogin)
+	})
+
+	t.Run("login reads the account past caches", func(t *testing.T) {
+		db := &uncachedReadsDB{MemoryDB: database.NewMemoryDB()}
+		s := NewService(Config{DB: db, AuthClient: authClient, Mailer: &recordingMailer{}, AppURL: "https://app.example.com"})
+		register(t, s)
+		db.uncached = nil
+
+		_, err := s.Login(ctx, "service@test.com", "Test123!@#", Client{})
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true}, db.uncached)
+	})
+
+	t.Run("login requires a verified email when configured", func(t *testing.T) {
+		s, _, _ := setup(t, Config{RequireEmailVerification: true})
+		register(t, s)
+
+		_, err := s.Login(ctx, "service@test.com", "Test123!@#", Client{})
+		assert.ErrorIs(t, err, ErrEmailNotVerified)
+	})
+
+	t.Run("refresh and logout", func(t *testing.T) {
+		s, db, _ := setup(t, Config{})
+		account := register(t, s)
+
+		initial, err := s.IssueTokens(ctx, account.ID, Client{})
+		require.NoError(t, err)
+
+		refreshed, err := s.Refresh(ctx, initial.RefreshToken, Client{})
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, refreshed.AccountID)
+
+		_, err = s.Refresh(ctx, "unknown", Client{})
+		assert.ErrorIs(t, err, ErrSessionExpired)
+
+		require.NoError(t, s.Logout(ctx, refreshed.RefreshToken, false, Client{}))
+		_, err = s.Refresh(ctx, refreshed.RefreshToken, Client{})
+		assert.ErrorIs(t, err, ErrSessionExpired)
+
+		// already logged out
+		require.NoError(t, s.Logout(ctx, refreshed.RefreshToken, false, Client{}))
+
+		types := eventTypes(t, db, account.ID)
+		assert.Contains(t, types, database.AuditEventTokenRefreshed)
+		assert.Contains(t, types, database.AuditEventLogout)
+	})
+
+	t.Run("new sign-in alerts", func(t *testing.T) {
+		for _, signed := range []bool{false, true} {
+			s, db, mail := setup(t, Config{NewSignInAlerts: true, SignedRefreshTokens: signed})
+			account := register(t, s)
+			laptop := Client{UserAgent: "Mozilla/5.0 (Macintosh) Firefox/128.0", Location: "US"}
+
+			_, err := s.Login(ctx, "service@test.com", "Test123!@#", laptop)
+			require.NoError(t, err)
+			// a browser update is the same device
+			laptop.UserAgent = "Mozilla/5.0 (Macintosh) Firefox/129.0"
+			_, err = s.Login(ctx, "service@test.com", "Test123!@#", laptop)
+			require.NoError(t, err)
+			require.Len(t, mail.sent, 1, "only the verification email, signed: %v", signed)
+
+			result, err := s.Login(ctx, "service@test.com", "Test123!@#", Client{UserAgent: "curl/8.5.0", Location: "FR"})
+			require.NoError(t, err)
+			require.Len(t, mail.sent, 2, "signed: %v", signed)
+			assert.Contains(t, mail.sent[1].Body, "FR")
+			assert.Contains(t, eventTypes(t, db, account.ID), database.AuditEventNewSignIn)
+
+			match := regexp.MustCompile(`/sign-ins/revoke\?token=([\w-]+)`).FindStringSubmatch(mail.sent[1].Body)
+			require.NotNil(t, match, "signed: %v", signed)
+			require.NoError(t, s.RevokeSignIn(ctx, match[1], Client{}))
+			_, err = s.Refresh(ctx, result.Tokens.RefreshToken, Client{})
+			assert.ErrorIs(t, err, ErrSessionExpired, "signed: %v", signed)
+
+			assert.ErrorIs(t, s.RevokeSignIn(ctx, match[1], Client{}), ErrInvalidSignInLink)
+		}
+	})
+
+	t.Run("logout all", func(t *testing.T) {
+		for _, signed := range []bool{false, true} {
+			s, _, _ := setup(t, Config{SignedRefreshTokens: signed})
+			account := register(t, s)
+
+			first, err := s.IssueTokens(ctx, account.ID, Client{})
+			require.NoError(t, err)
+			second, err := s.IssueTokens(ctx, account.ID, Client{})
+			require.NoError(t, err)
+
+			require.NoError(t, s.LogoutAll(ctx, account.ID, Client{}))
+
+			_, err = s.Refresh(ctx, first.RefreshToken, Client{})
+			assert.ErrorIs(t, err, ErrSessionExpired, "signed: %v", signed)
+			_, err = s.Refresh(ctx, second.RefreshToken, Client{})
+			assert.ErrorIs(t, err, ErrSessionExpired, "signed: %v", signed)
+		}
+	})
+
+	t.Run("login in the same second as logging out everywhere", func(t *testing.T) {
+		s, _, _ := setup(t, Config{SignedRefreshTokens: true})
+		account := register(t, s)
+
+		before, err := s.IssueTokens(ctx, account.ID, Client{})
+		require.NoError(t, err)
+		require.NoError(t, s.LogoutAll(ctx, account.ID, Client{}))
+
+		result, err := s.Login(ctx, "service@test.com", "Test123!@#", Client{})
+		require.NoError(t, err)
+
+		_, err = s.Refresh(ctx, before.RefreshToken, Client{})
+		assert.ErrorIs(t, err, ErrSessionExpired)
+		_, err = s.Refresh(ctx, result.Tokens.RefreshToken, Client{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("erased accounts can't refresh", func(t *testing.T) {
+		for _, signed := range []bool{false, true} {
+			s, db, _ := setup(t, Config{SignedRefreshTokens: signed})
+			account := register(t, s)
+
+			tokens, err := s.IssueTokens(ctx, account.ID, Client{})
+			require.NoError(t, err)
+
+			_, err = db.CreateDeletionRequest(ctx, account.ID, time.Now())
+			require.NoError(t, err)
+			require.NoError(t, db.EraseAccount(ctx, account.ID))
+
+			_, err = s.Refresh(ctx, tokens.RefreshToken, Client{})
+			assert.ErrorIs(t, err, ErrSessionExpired, "signed: %v", signed)
+		}
+	})
+}
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		username    string
+		expectedErr error
+	}{
+		{username: "ada"},
+		{username: "Ada.Lovelace-1815"},
+		{username: "a_b"},
+		{username: "ab", expectedErr: ErrInvalidUsername},
+		{username: "abcdefghijklmnopqrstuvwxyz12345", expectedErr: ErrInvalidUsername},
+		{username: "_ada", expectedErr: ErrInvalidUsername},
+		{username: "ada lovelace", expectedErr: ErrInvalidUsername},
+		{username: "ada@example.com", expectedErr: ErrInvalidUsername},
+		{username: "adä", expectedErr: ErrInvalidUsername},
+		{username: "admin", expectedErr: ErrReservedUsername},
+		{username: "Support", expectedErr: ErrReservedUsername},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			err := ValidateUsername(tt.username)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
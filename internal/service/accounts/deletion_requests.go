@@ -0,0 +1,36 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+)
+
+// cancelDeletionRequest calls off the account's pending deletion request, if it has one.
+// Logging in again before the grace period is over is how an account that asked to be erased
+// changes its mind. Failures are logged rather than failing the login.
+func (s *Service) cancelDeletionRequest(ctx context.Context, accountID string, client Client) {
+	_, err := s.cfg.DB.CancelDeletionRequest(ctx, accountID)
+	if errors.Is(err, database.ErrDeletionRequestNotFound) {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error cancelling deletion request", "error", err)
+		return
+	}
+
+	s.recordAuditEvent(ctx, client, accountID, database.AuditEventDeletionCancelled)
+
+	account, err := s.cfg.DB.GetAccountByID(ctx, accountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting account to send deletion cancelled notice", "error", err)
+		return
+	}
+	err = mailer.SendTemplate(ctx, s.cfg.Mailer, mailer.TemplateDeletionCancelled, account.Email, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "error sending deletion cancelled notice", "error", err)
+	}
+}
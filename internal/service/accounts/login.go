@@ -0,0 +1,294 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/totp"
+)
+
+type LoginResult struct {
+	// Tokens is nil for accounts with MFA enabled, which get MFAChallenge instead
+	Tokens *Tokens
+	// MFAChallenge is traded for tokens with LoginMFA along with a code, before
+	// MFAChallengeExpiresAt
+	MFAChallenge          string
+	MFAChallengeExpiresAt time.Time
+	// MFAMethods are the kinds of code the account can finish the login with, besides recovery
+	// codes: MFAMethodTOTP, and MFAMethodSMS when SendLoginCode can send one
+	MFAMethods []string
+}
+
+// MFA methods
+const (
+	MFAMethodTOTP = "totp"
+	MFAMethodSMS  = "sms"
+)
+
+// Login checks the password of the account with the identifier, its email or its username.
+// Accounts with MFA enabled get an MFA challenge instead of tokens, unless the client sent the
+// token of a device they trust. It fails with a *LockedOutError after too many failures,
+// ErrAccountNotFound, ErrIncorrectPassword, ErrAccountFrozen, or ErrEmailNotVerified.
+func (s *Service) Login(ctx context.Context, identifier, password string, client Client) (*LoginResult, error) {
+	account, err := s.loginAccount(ctx, identifier)
+
+	// failures count against the account's email whichever identifier was used, so logging in
+	// with the username doesn't get an account more attempts
+	lockoutKey := LoginLockoutKey(identifier)
+	if account != nil {
+		lockoutKey = LoginLockoutKey(account.Email)
+	}
+	if wait := s.checkLockout(ctx, lockoutKey); wait > 0 {
+		return nil, &LockedOutError{RetryAfter: wait}
+	}
+
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			s.recordLoginFailure(ctx, lockoutKey)
+			// without an account, so only admins see it
+			s.recordAuditEvent(ctx, client, "", database.AuditEventLoginFailed)
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("error getting account: %w", err)
+	}
+
+	if !s.cfg.AcceptAnyPassword {
+		ok, rehash := s.verifyPassword(password, account.PasswordHash)
+		if !ok {
+			s.recordLoginFailure(ctx, lockoutKey)
+			s.recordAuditEvent(ctx, client, account.ID, database.AuditEventLoginFailed)
+			return nil, ErrIncorrectPassword
+		}
+		if rehash {
+			s.rehashPassword(ctx, account, password)
+		}
+	}
+
+	// only after the password check so a frozen account doesn't tell anyone it exists
+	if account.FrozenAt != nil {
+		return nil, ErrAccountFrozen
+	}
+
+	if s.cfg.RequireEmailVerification && account.VerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	result, err := s.finishLogin(ctx, account.ID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Tokens != nil && s.cfg.Lockout != nil {
+		s.cfg.Lockout.RecordSuccess(ctx, lockoutKey)
+	}
+
+	return result, nil
+}
+
+// loginAccount gets the account an identifier given to Login is for, by username if it can't be
+// an email. It's read past any cache, a stale password hash or freeze would let the wrong logins
+// through.
+func (s *Service) loginAccount(ctx context.Context, identifier string) (*database.Account, error) {
+	ctx = database.WithUncachedReads(ctx)
+	if isUsername(identifier) {
+		return s.cfg.DB.GetAccountByUsername(ctx, identifier)
+	}
+	return s.cfg.DB.GetAccount(ctx, identifier)
+}
+
+// LoginWithIdentity logs in an account an identity provider signed in as, Apple or an
+// organization's SAML IdP. The IdP stands in for the password, not the second factor, so accounts
+// with MFA enabled get an MFA challenge as with Login, unless the client sent the token of a
+// device they trust.
+func (s *Service) LoginWithIdentity(ctx context.Context, accountID string, client Client) (*LoginResult, error) {
+	return s.finishLogin(ctx, accountID, client)
+}
+
+// finishLogin issues tokens to an account that proved it's the account's, e.g. with its
+// password. Accounts with MFA enabled get an MFA challenge instead.
+func (s *Service) finishLogin(ctx context.Context, accountID string, client Client) (*LoginResult, error) {
+	// the first factor alone isn't enough, tokens are only issued once a code is checked too,
+	// unless the login is from a device that already did
+	secret, phone, err := s.mfaFactors(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking whether MFA is enabled: %w", err)
+	}
+	if (secret != nil || phone != nil) && !s.trustedDevice(ctx, accountID, client) {
+		challenge, expiresAt, err := s.cfg.AuthClient.NewMFAChallengeToken(accountID)
+		if err != nil {
+			return nil, fmt.Errorf("error generating MFA challenge: %w", err)
+		}
+		result := &LoginResult{MFAChallenge: challenge, MFAChallengeExpiresAt: expiresAt, MFAMethods: []string{}}
+		if secret != nil {
+			result.MFAMethods = append(result.MFAMethods, MFAMethodTOTP)
+		}
+		if phone != nil && s.cfg.SMS != nil {
+			result.MFAMethods = append(result.MFAMethods, MFAMethodSMS)
+		}
+		return result, nil
+	}
+
+	tokens, err := s.IssueTokens(ctx, accountID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordAuditEvent(ctx, client, accountID, database.AuditEventLogin)
+	s.RecordSignIn(ctx, accountID, tokens, client)
+
+	return &LoginResult{Tokens: tokens}, nil
+}
+
+// LoginMFA finishes a login for an account with MFA enabled, with a TOTP code, the code
+// SendLoginCode sent, or one of the account's recovery codes. Wrong codes count towards the
+// login lockout, and each code works once. It fails with ErrInvalidMFAChallenge, a
+// *LockedOutError, ErrAccountFrozen, or ErrIncorrectMFACode.
+func (s *Service) LoginMFA(ctx context.Context, challenge, code string, client Client) (*Tokens, error) {
+	accountID, err := s.cfg.AuthClient.ParseMFAChallengeToken(challenge)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	account, err := s.cfg.DB.GetAccountByID(ctx, accountID)
+	if err != nil {
+		// deleted since the password was checked
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, fmt.Errorf("error getting account: %w", err)
+	}
+
+	lockoutKey := LoginLockoutKey(account.Email)
+	if wait := s.checkLockout(ctx, lockoutKey); wait > 0 {
+		return nil, &LockedOutError{RetryAfter: wait}
+	}
+
+	// frozen since the password was checked
+	if account.FrozenAt != nil {
+		return nil, ErrAccountFrozen
+	}
+
+	secret, phone, err := s.mfaFactors(ctx, account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking whether MFA is enabled: %w", err)
+	}
+	if secret == nil && phone == nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	// a recovery code is burned as it's checked, so it works once too
+	var ok bool
+	var recoveryCodesLeft *int
+	if recoveryCode := normalizeRecoveryCode(code); recoveryCode != "" {
+		left, used, err := s.useRecoveryCode(ctx, account.ID, recoveryCode)
+		if err != nil {
+			return nil, err
+		}
+		if used {
+			ok, recoveryCodesLeft = true, &left
+		}
+	} else if ok, err = s.checkMFACode(ctx, secret, phone, code); err != nil {
+		return nil, err
+	}
+	if !ok {
+		s.recordLoginFailure(ctx, lockoutKey)
+		s.recordAuditEvent(ctx, client, account.ID, database.AuditEventLoginFailed)
+		return nil, ErrIncorrectMFACode
+	}
+
+	tokens, err := s.IssueTokens(ctx, account.ID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.Lockout != nil {
+		s.cfg.Lockout.RecordSuccess(ctx, lockoutKey)
+	}
+
+	if recoveryCodesLeft != nil {
+		tokens.RecoveryCodesLeft = recoveryCodesLeft
+		s.recordAuditEvent(ctx, client, account.ID, database.AuditEventRecoveryCodeUsed)
+	}
+	s.recordAuditEvent(ctx, client, account.ID, database.AuditEventLogin)
+	s.RecordSignIn(ctx, account.ID, tokens, client)
+
+	return tokens, nil
+}
+
+// LoginLockoutKey counts failures per email so an attacker can't dodge the lockout by
+// spreading attempts across replicas or IPs
+func LoginLockoutKey(email string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func (s *Service) checkLockout(ctx context.Context, key string) time.Duration {
+	if s.cfg.Lockout == nil {
+		return 0
+	}
+	return s.cfg.Lockout.Check(ctx, key)
+}
+
+func (s *Service) recordLoginFailure(ctx context.Context, key string) {
+	if s.cfg.Lockout == nil {
+		return
+	}
+	if wait := s.cfg.Lockout.RecordFailure(ctx, key); wait > 0 {
+		slog.WarnContext(ctx, "login attempts blocked after repeated failures", "retry_after", wait.String())
+	}
+}
+
+// checkMFACode checks a code from the authenticator app of secret, or the last one sent to phone,
+// and burns it. Either can be nil.
+func (s *Service) checkMFACode(ctx context.Context, secret *database.MFASecret, phone *database.MFAPhone, code string) (bool, error) {
+	if secret != nil {
+		if step, ok := totp.Validate(secret.Secret, code, time.Now()); ok {
+			err := s.cfg.DB.UseMFAStep(ctx, secret.AccountID, step)
+			if err != nil && !errors.Is(err, database.ErrMFACodeUsed) {
+				return false, fmt.Errorf("error using MFA code: %w", err)
+			}
+			if err == nil {
+				return true, nil
+			}
+		}
+	}
+
+	// only a code was sent, whether or not SMS is still turned on
+	if phone != nil && phone.CodeHash != nil {
+		err := s.usePhoneCode(ctx, phone.AccountID, code)
+		if err != nil && !errors.Is(err, ErrIncorrectMFACode) {
+			return false, err
+		}
+		return err == nil, nil
+	}
+	return false, nil
+}
+
+// mfaEnabled reports whether the account has to complete MFA to log in
+func (s *Service) mfaEnabled(ctx context.Context, accountID string) (bool, error) {
+	secret, phone, err := s.mfaFactors(ctx, accountID)
+	return secret != nil || phone != nil, err
+}
+
+// mfaFactors returns the account's enabled TOTP secret and verified phone number, either of
+// which is nil if it has none. A phone number stays a factor when SMS is turned off, so turning
+// it off doesn't turn off MFA, the account's recovery codes still work.
+func (s *Service) mfaFactors(ctx context.Context, accountID string) (*database.MFASecret, *database.MFAPhone, error) {
+	secret, err := s.cfg.DB.GetMFASecret(ctx, accountID)
+	if err != nil && !errors.Is(err, database.ErrMFASecretNotFound) {
+		return nil, nil, err
+	}
+	if secret != nil && secret.EnabledAt == nil {
+		secret = nil
+	}
+
+	phone, err := s.verifiedPhone(ctx, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return secret, phone, nil
+}
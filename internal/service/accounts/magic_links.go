@@ -0,0 +1,150 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+)
+
+const (
+	// DefaultMagicLinkTTL is how long emailed login links work by default
+	DefaultMagicLinkTTL = 15 * time.Minute
+	// DefaultMagicLinkLimit is how many login links an email address can be sent per hour by
+	// default
+	DefaultMagicLinkLimit = 5
+)
+
+var (
+	// ErrMagicLinksDisabled is sending or using a login link when they're turned off
+	ErrMagicLinksDisabled = errors.New("magic links are turned off")
+	// ErrInvalidMagicLink is a login link that's invalid, expired, or already used, or was sent
+	// to an address the account no longer has
+	ErrInvalidMagicLink = errors.New("invalid magic link")
+)
+
+// MagicLinkConfig turns on logging in with a single-use link emailed to the account
+type MagicLinkConfig struct {
+	// TTL is how long links work, DefaultMagicLinkTTL by default
+	TTL time.Duration
+	// Limiter throttles the links sent to each email address. Defaults to DefaultMagicLinkLimit
+	// per hour, kept in memory.
+	Limiter *lockout.Guard
+}
+
+// NewMagicLinkLimiter allows limit login links per email address per hour
+func NewMagicLinkLimiter(store lockout.Store, limit int) *lockout.Guard {
+	return lockout.NewGuard(store, lockout.Config{
+		Window:          time.Hour,
+		MaxAttempts:     limit,
+		LockoutDuration: time.Hour,
+	})
+}
+
+// SendMagicLink emails the account a link that logs it in without its password. Nothing is sent
+// to an address without an account, to a frozen account, or to an address that was sent too many
+// links in the last hour, and none of those are errors, so callers can't tell them apart. It
+// fails with ErrMagicLinksDisabled.
+func (s *Service) SendMagicLink(ctx context.Context, email string, client Client) error {
+	if s.cfg.MagicLinks == nil {
+		return ErrMagicLinksDisabled
+	}
+
+	throttleKey := "magic-link:" + strings.ToLower(strings.TrimSpace(email))
+	if s.cfg.MagicLinks.Limiter.Check(ctx, throttleKey) > 0 {
+		return nil
+	}
+	s.cfg.MagicLinks.Limiter.RecordFailure(ctx, throttleKey)
+
+	account, err := s.cfg.DB.GetAccount(ctx, email)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return nil
+		}
+		return fmt.Errorf("error getting account: %w", err)
+	}
+
+	// a frozen account can't log in until it's unfrozen
+	if account.FrozenAt != nil {
+		return nil
+	}
+
+	token, _, err := s.cfg.AuthClient.NewMagicLinkToken(account.ID, account.Email, s.cfg.MagicLinks.TTL)
+	if err != nil {
+		return err
+	}
+
+	s.recordAuditEvent(ctx, client, account.ID, database.AuditEventMagicLinkSent)
+
+	return mailer.SendTemplate(ctx, s.cfg.Mailer, mailer.TemplateMagicLink, account.Email, mailer.Data{
+		"Link":      strings.TrimRight(s.cfg.AppURL, "/") + "/login/magic-link?token=" + url.QueryEscape(token),
+		"ExpiresIn": formatMinutes(s.cfg.MagicLinks.TTL),
+	})
+}
+
+// LoginMagicLink logs in the account a link from SendMagicLink was sent to. The link stands in
+// for the password: accounts with MFA enabled get an MFA challenge instead of tokens, as with
+// Login, and the link proves the email is the account's, so it counts as verified. Each link
+// works once. It fails with ErrMagicLinksDisabled, ErrInvalidMagicLink, or ErrAccountFrozen.
+func (s *Service) LoginMagicLink(ctx context.Context, token string, client Client) (*LoginResult, error) {
+	if s.cfg.MagicLinks == nil {
+		return nil, ErrMagicLinksDisabled
+	}
+
+	link, err := s.cfg.AuthClient.ParseMagicLinkToken(token)
+	if err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// used links are tracked with the revoked access tokens, their IDs can't collide. Claiming
+	// is atomic, so of two requests racing with the same link only one logs in.
+	claimed, err := s.cfg.AccessTokenRevocations.Claim(ctx, link.ID, link.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("error using magic link: %w", err)
+	}
+	if !claimed {
+		return nil, ErrInvalidMagicLink
+	}
+
+	account, err := s.cfg.DB.GetAccountByID(ctx, link.AccountID)
+	if err != nil {
+		// deleted since the link was sent
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return nil, ErrInvalidMagicLink
+		}
+		return nil, fmt.Errorf("error getting account: %w", err)
+	}
+
+	// the link was mailed to an address the account no longer has
+	if !strings.EqualFold(account.Email, link.Email) {
+		return nil, ErrInvalidMagicLink
+	}
+
+	if account.FrozenAt != nil {
+		return nil, ErrAccountFrozen
+	}
+
+	if account.VerifiedAt == nil {
+		if _, err := s.cfg.DB.VerifyAccount(ctx, account.ID); err != nil {
+			return nil, fmt.Errorf("error verifying account: %w", err)
+		}
+		s.recordAuditEvent(ctx, client, account.ID, database.AuditEventEmailVerified)
+	}
+
+	return s.finishLogin(ctx, account.ID, client)
+}
+
+// formatMinutes is a duration of at least a minute for an email, e.g. "15 minutes"
+func formatMinutes(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	if minutes <= 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
@@ -0,0 +1,73 @@
+package accounts
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/metrics"
+)
+
+// HashNewPassword checks a password chosen for the account with the given email against the
+// policy and hashes it. Policy failures are auth.ValidationErrors.
+func (s *Service) HashNewPassword(password, email string) (string, error) {
+	if err := s.cfg.PasswordPolicy.Validate(password, email); err != nil {
+		return "", err
+	}
+	return s.hashPassword(password)
+}
+
+// PasswordIsCorrect checks a password against the account's hash, for checks that don't
+// rehash it
+func (s *Service) PasswordIsCorrect(password, hashedPassword string) bool {
+	ok, _ := s.verifyPassword(password, hashedPassword)
+	return ok
+}
+
+// CheckBreachedPassword checks a new password against known breaches. It returns
+// ErrBreachedPassword when breached passwords are rejected, and otherwise whether to warn that
+// it's breached. The check fails open, a breach API that can't be reached never blocks anyone.
+func (s *Service) CheckBreachedPassword(ctx context.Context, password string) (bool, error) {
+	if s.cfg.BreachedPasswords == nil {
+		return false, nil
+	}
+
+	breached, err := s.cfg.BreachedPasswords.Breached(ctx, password)
+	if err != nil {
+		slog.WarnContext(ctx, "error checking password against breaches, allowing it", "error", err)
+		return false, nil
+	}
+	if breached && s.cfg.EnforceBreachedPasswords {
+		return true, ErrBreachedPassword
+	}
+	return breached, nil
+}
+
+// hashPassword is Passwords.Hash, timed
+func (s *Service) hashPassword(password string) (string, error) {
+	start := time.Now()
+	defer func() { s.cfg.Metrics.ObservePasswordHash(metrics.OperationHash, time.Since(start)) }()
+	return s.cfg.Passwords.Hash(password)
+}
+
+// verifyPassword is Passwords.Verify, timed
+func (s *Service) verifyPassword(password, hashedPassword string) (ok, rehash bool) {
+	start := time.Now()
+	defer func() { s.cfg.Metrics.ObservePasswordHash(metrics.OperationCompare, time.Since(start)) }()
+	return s.cfg.Passwords.Verify(password, hashedPassword)
+}
+
+// rehashPassword upgrades the account's password hash to the configured algorithm and cost after
+// a successful login. Failing only leaves the old hash in place, so errors are logged rather than
+// failing the login.
+func (s *Service) rehashPassword(ctx context.Context, account *database.Account, password string) {
+	passwordHash, err := s.hashPassword(password)
+	if err != nil {
+		slog.ErrorContext(ctx, "error rehashing password", "error", err)
+		return
+	}
+	if err := s.cfg.DB.RehashPassword(ctx, account.ID, account.PasswordHash, passwordHash); err != nil {
+		slog.ErrorContext(ctx, "error saving rehashed password", "error", err)
+	}
+}
@@ -0,0 +1,304 @@
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/service/sms"
+)
+
+var (
+	// ErrSMSDisabled is enrolling or sending codes to a phone when there's no SMS provider
+	ErrSMSDisabled = errors.New("SMS codes are turned off")
+	// ErrInvalidPhoneNumber is a phone number that isn't in E.164 format
+	ErrInvalidPhoneNumber = errors.New("invalid phone number")
+	// ErrInvalidSMSChannel is a channel other than sms.ChannelSMS and sms.ChannelVoice
+	ErrInvalidSMSChannel    = errors.New("invalid SMS channel")
+	ErrPhoneAlreadyVerified = errors.New("phone number is already verified")
+	// ErrPhoneNotSetUp is verifying a phone number that wasn't enrolled, or sending a login code
+	// to an account without a verified one
+	ErrPhoneNotSetUp = errors.New("phone number not set up")
+)
+
+// SMSThrottledError is a code sent again before SMSConfig.ResendInterval has passed
+type SMSThrottledError struct {
+	// RetryAfter is how long until another code can be sent
+	RetryAfter time.Duration
+}
+
+func (e *SMSThrottledError) Error() string {
+	return fmt.Sprintf("code sent too recently, retry after %s", e.RetryAfter)
+}
+
+// SMSConfig turns on phone numbers as a second factor, with codes sent by text message or voice
+// call
+type SMSConfig struct {
+	Sender sms.Sender
+	// CodeLength is how many digits codes have, 6 by default. TTL is how long they work, 5
+	// minutes by default.
+	CodeLength int
+	TTL        time.Duration
+	// ResendInterval is how long until another code can be sent to the same account
+	ResendInterval time.Duration
+}
+
+// PhoneCode is a code sent to a phone number
+type PhoneCode struct {
+	// PhoneNumber is where it was sent, masked to the last digits
+	PhoneNumber string
+	ExpiresAt   time.Time
+}
+
+// e164 is a phone number with its country code, like +14155550123
+var e164 = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+
+// normalizePhoneNumber strips the spaces, dashes, dots, and parentheses people type phone
+// numbers with
+func normalizePhoneNumber(phoneNumber string) (string, bool) {
+	phoneNumber = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "").Replace(phoneNumber)
+	return phoneNumber, e164.MatchString(phoneNumber)
+}
+
+// maskPhoneNumber hides all but the last digits of a phone number for showing it to the
+// account, e.g. +*******0123
+func maskPhoneNumber(phoneNumber string) string {
+	if len(phoneNumber) <= 5 {
+		return phoneNumber
+	}
+	return "+" + strings.Repeat("*", len(phoneNumber)-5) + phoneNumber[len(phoneNumber)-4:]
+}
+
+// EnrollPhone sets a phone number for the account to get MFA codes on and sends it a code. MFA
+// by phone isn't on until the code is entered with VerifyPhone, and enrolling again before that
+// replaces the number. It fails with ErrSMSDisabled, ErrInvalidPhoneNumber,
+// ErrInvalidSMSChannel, ErrPhoneAlreadyVerified, or a *SMSThrottledError.
+func (s *Service) EnrollPhone(ctx context.Context, accountID, phoneNumber string, channel sms.Channel) (*PhoneCode, error) {
+	if s.cfg.SMS == nil {
+		return nil, ErrSMSDisabled
+	}
+	if err := validateSMSChannel(channel); err != nil {
+		return nil, err
+	}
+	phoneNumber, ok := normalizePhoneNumber(phoneNumber)
+	if !ok {
+		return nil, ErrInvalidPhoneNumber
+	}
+
+	if err := s.cfg.DB.SetMFAPhone(ctx, accountID, phoneNumber); err != nil {
+		if errors.Is(err, database.ErrMFAPhoneAlreadyVerified) {
+			return nil, ErrPhoneAlreadyVerified
+		}
+		return nil, fmt.Errorf("error setting MFA phone: %w", err)
+	}
+
+	phone, err := s.cfg.DB.GetMFAPhone(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting MFA phone: %w", err)
+	}
+	return s.sendPhoneCode(ctx, phone, channel)
+}
+
+// VerifyPhone turns on MFA by phone once the code EnrollPhone sent is entered. An account that
+// didn't have MFA before gets its recovery codes, which are returned, and an email about MFA
+// being on. It fails with ErrSMSDisabled, ErrPhoneNotSetUp, ErrPhoneAlreadyVerified, or
+// ErrIncorrectMFACode.
+func (s *Service) VerifyPhone(ctx context.Context, accountID, code string, client Client) ([]string, error) {
+	if s.cfg.SMS == nil {
+		return nil, ErrSMSDisabled
+	}
+
+	phone, err := s.cfg.DB.GetMFAPhone(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, database.ErrMFAPhoneNotFound) {
+			return nil, ErrPhoneNotSetUp
+		}
+		return nil, fmt.Errorf("error getting MFA phone: %w", err)
+	}
+	if phone.VerifiedAt != nil {
+		return nil, ErrPhoneAlreadyVerified
+	}
+
+	hadMFA, err := s.mfaEnabled(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking whether MFA is enabled: %w", err)
+	}
+
+	if err := s.usePhoneCode(ctx, accountID, code); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.cfg.DB.VerifyMFAPhone(ctx, accountID); err != nil {
+		// verified by a racing request
+		if errors.Is(err, database.ErrMFAPhoneNotFound) {
+			return nil, ErrPhoneAlreadyVerified
+		}
+		return nil, fmt.Errorf("error verifying MFA phone: %w", err)
+	}
+
+	s.recordAuditEvent(ctx, client, accountID, database.AuditEventMFAPhoneVerified)
+
+	// the account already has recovery codes and knows MFA is on
+	if hadMFA {
+		return nil, nil
+	}
+
+	// MFA is on either way, the codes can be generated again
+	codes, err := s.GenerateRecoveryCodes(ctx, accountID, client)
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating recovery codes", "error", err)
+	}
+	if account, err := s.cfg.DB.GetAccountByID(ctx, accountID); err == nil {
+		err = mailer.SendTemplate(ctx, s.cfg.Mailer, mailer.TemplateMFAEnabled, account.Email, nil)
+		if err != nil {
+			slog.ErrorContext(ctx, "error sending MFA enabled notice", "error", err)
+		}
+	}
+	return codes, nil
+}
+
+// SendLoginCode sends a code to the verified phone number of the account an MFA challenge is
+// for, to finish the login with LoginMFA. It fails with ErrInvalidMFAChallenge, ErrSMSDisabled,
+// ErrInvalidSMSChannel, a *LockedOutError, ErrAccountFrozen, ErrPhoneNotSetUp, or a
+// *SMSThrottledError.
+func (s *Service) SendLoginCode(ctx context.Context, challenge string, channel sms.Channel) (*PhoneCode, error) {
+	accountID, err := s.cfg.AuthClient.ParseMFAChallengeToken(challenge)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if s.cfg.SMS == nil {
+		return nil, ErrSMSDisabled
+	}
+	if err := validateSMSChannel(channel); err != nil {
+		return nil, err
+	}
+
+	account, err := s.cfg.DB.GetAccountByID(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, fmt.Errorf("error getting account: %w", err)
+	}
+
+	// codes aren't sent for logins that couldn't finish anyway
+	if wait := s.checkLockout(ctx, LoginLockoutKey(account.Email)); wait > 0 {
+		return nil, &LockedOutError{RetryAfter: wait}
+	}
+	if account.FrozenAt != nil {
+		return nil, ErrAccountFrozen
+	}
+
+	phone, err := s.verifiedPhone(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	if phone == nil {
+		return nil, ErrPhoneNotSetUp
+	}
+	return s.sendPhoneCode(ctx, phone, channel)
+}
+
+// verifiedPhone returns the account's phone number if it's verified, or nil
+func (s *Service) verifiedPhone(ctx context.Context, accountID string) (*database.MFAPhone, error) {
+	phone, err := s.cfg.DB.GetMFAPhone(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, database.ErrMFAPhoneNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting MFA phone: %w", err)
+	}
+	if phone.VerifiedAt == nil {
+		return nil, nil
+	}
+	return phone, nil
+}
+
+// sendPhoneCode replaces the code for phone with a new one and sends it, unless the last one
+// was sent less than ResendInterval ago
+func (s *Service) sendPhoneCode(ctx context.Context, phone *database.MFAPhone, channel sms.Channel) (*PhoneCode, error) {
+	now := time.Now()
+	lastSentBefore := now.Add(-s.cfg.SMS.ResendInterval)
+	if phone.CodeSentAt != nil && phone.CodeSentAt.After(lastSentBefore) {
+		return nil, &SMSThrottledError{RetryAfter: phone.CodeSentAt.Sub(lastSentBefore)}
+	}
+
+	code, err := newPhoneCode(s.cfg.SMS.CodeLength)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := now.Add(s.cfg.SMS.TTL)
+
+	err = s.cfg.DB.SetMFAPhoneCode(ctx, database.SetMFAPhoneCodeParams{
+		AccountID:      phone.AccountID,
+		CodeHash:       auth.HashOpaqueToken(code),
+		SentAt:         now,
+		ExpiresAt:      expiresAt,
+		LastSentBefore: lastSentBefore,
+	})
+	if err != nil {
+		// sent by a racing request
+		if errors.Is(err, database.ErrMFAPhoneCodeThrottled) {
+			return nil, &SMSThrottledError{RetryAfter: s.cfg.SMS.ResendInterval}
+		}
+		return nil, fmt.Errorf("error saving phone code: %w", err)
+	}
+
+	msg := sms.Message{
+		To:      phone.PhoneNumber,
+		Body:    fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, int(s.cfg.SMS.TTL.Minutes())),
+		Channel: channel,
+	}
+	if channel == sms.ChannelVoice {
+		// read out digit by digit, twice
+		digits := strings.Join(strings.Split(code, ""), ", ")
+		msg.Body = fmt.Sprintf("Your verification code is %s. Again, your code is %s.", digits, digits)
+	}
+	if err := s.cfg.SMS.Sender.Send(ctx, msg); err != nil {
+		return nil, fmt.Errorf("error sending phone code: %w", err)
+	}
+	return &PhoneCode{PhoneNumber: maskPhoneNumber(phone.PhoneNumber), ExpiresAt: expiresAt}, nil
+}
+
+// usePhoneCode burns the code sent to the account's phone number. It fails with
+// ErrIncorrectMFACode for a code that's wrong, expired, or already used.
+func (s *Service) usePhoneCode(ctx context.Context, accountID, code string) error {
+	err := s.cfg.DB.UseMFAPhoneCode(ctx, accountID, auth.HashOpaqueToken(strings.TrimSpace(code)), time.Now())
+	if err != nil {
+		if errors.Is(err, database.ErrMFAPhoneCodeInvalid) {
+			return ErrIncorrectMFACode
+		}
+		return fmt.Errorf("error using phone code: %w", err)
+	}
+	return nil
+}
+
+func validateSMSChannel(channel sms.Channel) error {
+	if channel != sms.ChannelSMS && channel != sms.ChannelVoice {
+		return ErrInvalidSMSChannel
+	}
+	return nil
+}
+
+// newPhoneCode returns a random code of length digits
+func newPhoneCode(length int) (string, error) {
+	var code strings.Builder
+	for range length {
+		digit, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", fmt.Errorf("error generating phone code: %w", err)
+		}
+		code.WriteString(digit.String())
+	}
+	return code.String(), nil
+}
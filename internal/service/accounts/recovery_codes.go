@@ -0,0 +1,109 @@
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+)
+
+const (
+	// RecoveryCodeCount is how many recovery codes an account gets at a time
+	RecoveryCodeCount = 10
+	// LowRecoveryCodes is how few unused recovery codes are left when logins warn about it
+	LowRecoveryCodes = 3
+
+	// recoveryCodeLength is 16 characters of 5 bits, so the codes are random enough to be
+	// stored with the same fast hash as opaque tokens
+	recoveryCodeLength = 16
+	// recoveryCodeAlphabet leaves out i, l, o, and u so codes aren't misread
+	recoveryCodeAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+)
+
+// ErrMFANotEnabled is generating recovery codes for an account without MFA
+var ErrMFANotEnabled = errors.New("MFA is not enabled")
+
+// GenerateRecoveryCodes replaces the account's recovery codes with RecoveryCodeCount new ones
+// and returns them. Only their hashes are stored, so they can't be shown again. It fails with
+// ErrMFANotEnabled.
+func (s *Service) GenerateRecoveryCodes(ctx context.Context, accountID string, client Client) ([]string, error) {
+	enabled, err := s.mfaEnabled(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking whether MFA is enabled: %w", err)
+	}
+	if !enabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = auth.HashOpaqueToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.cfg.DB.ReplaceMFARecoveryCodes(ctx, accountID, hashes); err != nil {
+		return nil, fmt.Errorf("error saving recovery codes: %w", err)
+	}
+
+	s.recordAuditEvent(ctx, client, accountID, database.AuditEventRecoveryCodesGenerated)
+	return codes, nil
+}
+
+// useRecoveryCode burns one of the account's recovery codes and returns how many are left. ok
+// is false for a code the account doesn't have, including one that was used.
+func (s *Service) useRecoveryCode(ctx context.Context, accountID, code string) (left int, ok bool, err error) {
+	err = s.cfg.DB.UseMFARecoveryCode(ctx, accountID, auth.HashOpaqueToken(code))
+	if err != nil {
+		if errors.Is(err, database.ErrMFARecoveryCodeNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	left, err = s.cfg.DB.CountMFARecoveryCodes(ctx, accountID)
+	if err != nil {
+		return 0, false, fmt.Errorf("error counting recovery codes: %w", err)
+	}
+	return left, true, nil
+}
+
+// newRecoveryCode returns a random code grouped like xxxx-xxxx-xxxx-xxxx for reading it off paper
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating recovery code: %w", err)
+	}
+
+	var code strings.Builder
+	for i, c := range b {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(recoveryCodeAlphabet[int(c)%len(recoveryCodeAlphabet)])
+	}
+	return code.String(), nil
+}
+
+// normalizeRecoveryCode accepts a code typed in any case, with or without the dashes. It returns
+// "" for anything that can't be a recovery code, like a TOTP code.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != recoveryCodeLength {
+		return ""
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(recoveryCodeAlphabet, c) {
+			return ""
+		}
+	}
+	return code
+}
@@ -0,0 +1,145 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/i18n"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+)
+
+// VerificationLinkTTL is how long an emailed verification link works
+const VerificationLinkTTL = 24 * time.Hour
+
+type RegisterParams struct {
+	Email    string
+	Password string
+	// Username is optional, accounts can log in with it as well as their email
+	Username string
+	// PreferredLocale defaults to the locale negotiated for ctx
+	PreferredLocale string
+}
+
+type RegisterResult struct {
+	Account *database.Account
+	// PasswordBreached warns that the password appeared in a data breach, when breached
+	// passwords are allowed
+	PasswordBreached bool
+}
+
+// Register creates an account with a password and emails it a link to verify its email. It
+// fails with ErrInvalidEmail, ErrInvalidUsername, ErrReservedUsername, ErrUnsupportedLocale, an
+// auth.ValidationError for a password against the policy, ErrBreachedPassword,
+// ErrAccountAlreadyExists, or ErrUsernameTaken.
+func (s *Service) Register(ctx context.Context, params RegisterParams, client Client) (*RegisterResult, error) {
+	if !auth.IsValidEmail(params.Email) {
+		return nil, ErrInvalidEmail
+	}
+	if params.Username != "" {
+		if err := ValidateUsername(params.Username); err != nil {
+			return nil, err
+		}
+	}
+
+	preferredLocale := i18n.LocaleFromContext(ctx)
+	if params.PreferredLocale != "" {
+		if !i18n.IsSupported(params.PreferredLocale) {
+			return nil, ErrUnsupportedLocale
+		}
+		preferredLocale = params.PreferredLocale
+	}
+
+	hashedPassword, err := s.HashNewPassword(params.Password, params.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordBreached, err := s.CheckBreachedPassword(ctx, params.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	// the account is only created along with its verification link, so it's never left without
+	// one. The link is mailed once both are committed.
+	var account *database.Account
+	var verificationToken string
+	err = s.cfg.DB.WithTx(ctx, func(tx database.Repository) error {
+		var err error
+		account, err = tx.CreateAccount(ctx, database.AccountCreationParams{
+			Email:           params.Email,
+			Username:        params.Username,
+			PasswordHash:    hashedPassword,
+			PreferredLocale: preferredLocale,
+		})
+		if err != nil {
+			return err
+		}
+		verificationToken, err = createVerificationLink(ctx, tx, account)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrAccountAlreadyExists) {
+			return nil, ErrAccountAlreadyExists
+		}
+		if errors.Is(err, database.ErrUsernameTaken) {
+			return nil, ErrUsernameTaken
+		}
+		return nil, fmt.Errorf("error creating account: %w", err)
+	}
+	s.recordAuditEvent(ctx, client, account.ID, database.AuditEventAccountCreated)
+
+	// the account exists either way, and a new link can be requested
+	if err := s.mailVerificationLink(ctx, account, verificationToken); err != nil {
+		slog.ErrorContext(ctx, "error sending verification link", "error", err)
+	}
+
+	return &RegisterResult{Account: account, PasswordBreached: passwordBreached}, nil
+}
+
+// SendVerificationLink emails the account a new link to verify its email
+func (s *Service) SendVerificationLink(ctx context.Context, account *database.Account) error {
+	token, err := createVerificationLink(ctx, s.cfg.DB, account)
+	if err != nil {
+		return err
+	}
+	return s.mailVerificationLink(ctx, account, token)
+}
+
+// verificationStore is the service's DB or a transaction creating an account
+type verificationStore interface {
+	CreateEmailVerification(ctx context.Context, params database.CreateEmailVerificationParams) error
+}
+
+// createVerificationLink stores a new verification link for the account with db and returns its
+// token
+func createVerificationLink(ctx context.Context, db verificationStore, account *database.Account) (string, error) {
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating verification token: %w", err)
+	}
+
+	err = db.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+		TokenHash: auth.HashOpaqueToken(token),
+		AccountID: account.ID,
+		Email:     account.Email,
+		ExpiresAt: time.Now().Add(VerificationLinkTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *Service) mailVerificationLink(ctx context.Context, account *database.Account, token string) error {
+	link := strings.TrimRight(s.cfg.AppURL, "/") + "/verify?token=" + url.QueryEscape(token)
+	return mailer.SendTemplate(ctx, s.cfg.Mailer, mailer.TemplateVerifyEmail, account.Email, mailer.Data{
+		"Link": link,
+	})
+}
@@ -0,0 +1,151 @@
+package accounts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+)
+
+// ErrInvalidSignInLink is a new sign-in email's revoke link that's unknown or already used
+var ErrInvalidSignInLink = errors.New("invalid sign-in link")
+
+// versionNumbers are left out of the device a user agent identifies, so a browser or OS update
+// isn't a new device
+var versionNumbers = regexp.MustCompile(`\d+([._]\d+)*`)
+
+// deviceHash identifies the device a user agent is sent from
+func deviceHash(userAgent string) string {
+	sum := sha256.Sum256([]byte(versionNumbers.ReplaceAllString(userAgent, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordSignIn is called after every successful login. It cancels the account's pending
+// deletion request, and remembers the device and coarse location the account logged in from
+// when NewSignInAlerts is on. The first login from a device or location the account hasn't been
+// used from gets a new_sign_in audit event and an email with a link that logs its session out.
+// The account's first device is only remembered, there's nothing to compare it to. Failures are
+// logged rather than failing the login.
+func (s *Service) RecordSignIn(ctx context.Context, accountID string, tokens *Tokens, client Client) {
+	s.cancelDeletionRequest(ctx, accountID, client)
+
+	if !s.cfg.NewSignInAlerts {
+		return
+	}
+	if err := s.recordSignIn(ctx, accountID, tokens, client); err != nil {
+		slog.ErrorContext(ctx, "error recording sign-in device", "error", err)
+	}
+}
+
+func (s *Service) recordSignIn(ctx context.Context, accountID string, tokens *Tokens, client Client) error {
+	device := deviceHash(client.UserAgent)
+	err := s.cfg.DB.TouchKnownDevice(ctx, database.TouchKnownDeviceParams{
+		AccountID:  accountID,
+		DeviceHash: device,
+		Location:   client.Location,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+		At:         time.Now(),
+	})
+	if !errors.Is(err, database.ErrKnownDeviceNotFound) {
+		return err
+	}
+
+	params := database.CreateKnownDeviceParams{
+		AccountID:  accountID,
+		DeviceHash: device,
+		Location:   client.Location,
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+		SessionID:  tokens.SessionID,
+	}
+
+	known, err := s.cfg.DB.CountKnownDevices(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("error counting known devices: %w", err)
+	}
+	if known == 0 {
+		_, err := s.cfg.DB.CreateKnownDevice(ctx, params)
+		if err != nil && !errors.Is(err, database.ErrKnownDeviceExists) {
+			return fmt.Errorf("error creating known device: %w", err)
+		}
+		return nil
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("error generating sign-in revoke token: %w", err)
+	}
+	params.RevokeTokenHash = auth.HashOpaqueToken(token)
+
+	if _, err := s.cfg.DB.CreateKnownDevice(ctx, params); err != nil {
+		// a login racing this one sends the email
+		if errors.Is(err, database.ErrKnownDeviceExists) {
+			return nil
+		}
+		return fmt.Errorf("error creating known device: %w", err)
+	}
+
+	s.recordAuditEvent(ctx, client, accountID, database.AuditEventNewSignIn)
+
+	account, err := s.cfg.DB.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("error getting account: %w", err)
+	}
+
+	location := client.Location
+	if location == "" {
+		location = "Unknown"
+	}
+	return mailer.SendTemplate(ctx, s.cfg.Mailer, mailer.TemplateNewSignIn, account.Email, mailer.Data{
+		"Device":    client.UserAgent,
+		"Location":  location,
+		"IPAddress": client.IPAddress,
+		"Time":      time.Now().UTC().Format("2 Jan 2006 15:04 MST"),
+		"Link":      strings.TrimRight(s.cfg.AppURL, "/") + "/sign-ins/revoke?token=" + url.QueryEscape(token),
+	})
+}
+
+// RevokeSignIn logs out the session of a new sign-in email's revoke link and forgets its device,
+// so logging in from it again is another new sign-in. Access tokens already issued to the
+// session keep working until they expire. It fails with ErrInvalidSignInLink.
+func (s *Service) RevokeSignIn(ctx context.Context, token string, client Client) error {
+	device, err := s.cfg.DB.GetKnownDeviceByRevokeTokenHash(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		if errors.Is(err, database.ErrKnownDeviceNotFound) {
+			return ErrInvalidSignInLink
+		}
+		return fmt.Errorf("error getting known device: %w", err)
+	}
+
+	// a session that's already logged out or expired is fine
+	if s.cfg.SignedRefreshTokens {
+		err = s.cfg.Revocations.RevokeFamily(ctx, device.SessionID)
+	} else {
+		err = s.cfg.DB.DeleteSession(ctx, device.AccountID, device.SessionID)
+	}
+	if err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+
+	// a link that's used twice at once is still only used once
+	if err := s.cfg.DB.DeleteKnownDevice(ctx, device.ID); err != nil {
+		if errors.Is(err, database.ErrKnownDeviceNotFound) {
+			return ErrInvalidSignInLink
+		}
+		return fmt.Errorf("error deleting known device: %w", err)
+	}
+
+	s.recordAuditEvent(ctx, client, device.AccountID, database.AuditEventSessionRevoked)
+	return nil
+}
@@ -0,0 +1,350 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/metadata"
+	"github.com/austinwofford/account-management/internal/service/metrics"
+	"github.com/google/uuid"
+)
+
+// Tokens are a new access token and the refresh token that gets more
+type Tokens struct {
+	AccountID            string
+	AccessToken          string
+	AccessTokenExpiresAt time.Time
+	RefreshToken         string
+	// SessionID is the session the tokens belong to: the session of stored refresh tokens, or the
+	// family of signed ones
+	SessionID string
+	// Scopes are the ones the access token is restricted to, empty if it isn't
+	Scopes []string
+	// DeviceToken lets the device skip MFA on later logins until DeviceTokenExpiresAt. It's
+	// only set when the login trusted its device, see TrustDevice.
+	DeviceToken          string
+	DeviceTokenExpiresAt time.Time
+	// RecoveryCodesLeft is how many unused recovery codes the account has. It's only set when
+	// the login used one.
+	RecoveryCodesLeft *int
+}
+
+// refreshStore is the service's DB or a transaction refreshing a session
+type refreshStore interface {
+	CreateRefreshToken(ctx context.Context, params database.CreateRefreshTokenParams) error
+	GetAccountByID(ctx context.Context, id string) (*database.Account, error)
+	GetAccountRoles(ctx context.Context, accountID string) ([]string, error)
+}
+
+// IssueTokens starts a session for an account that's already authenticated, e.g. by an
+// identity provider. It doesn't record an audit event, the caller knows what to record.
+func (s *Service) IssueTokens(ctx context.Context, accountID string, client Client) (*Tokens, error) {
+	return s.issueTokens(ctx, s.cfg.DB, accountID, client, "", nil)
+}
+
+// issueTokens creates new access and refresh tokens for the account, storing the refresh token
+// with db. sessionID is the session a refresh continues, empty starts a new one. parent is the
+// signed refresh token being refreshed, if any, so the new one continues its family.
+func (s *Service) issueTokens(ctx context.Context, db refreshStore, accountID string, client Client, sessionID string, parent *auth.RefreshClaims) (*Tokens, error) {
+	var refreshToken string
+	var err error
+	if s.cfg.SignedRefreshTokens {
+		var refreshClaims *auth.RefreshClaims
+		refreshToken, refreshClaims, err = s.cfg.AuthClient.NewSignedRefreshToken(accountID, client.Scopes, parent)
+		if err == nil {
+			sessionID = refreshClaims.Family
+		}
+	} else {
+		var refreshTokenExpiresAt time.Time
+		refreshToken, refreshTokenExpiresAt = s.cfg.AuthClient.NewRefreshToken()
+		if sessionID == "" {
+			sessionID = uuid.NewString()
+		}
+
+		err = db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			Token:     refreshToken,
+			AccountID: accountID,
+			ExpiresAt: refreshTokenExpiresAt,
+			SessionID: sessionID,
+			IPAddress: client.IPAddress,
+			UserAgent: client.UserAgent,
+			Scopes:    client.Scopes,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating refresh token: %w", err)
+	}
+
+	claims := auth.Claims{
+		AccountID:    accountID,
+		Confirmation: client.Confirmation,
+		Scope:        strings.Join(client.Scopes, " "),
+	}
+
+	claims.Roles, err = db.GetAccountRoles(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting account roles: %w", err)
+	}
+
+	// only look the account up when some flags or metadata go into tokens
+	tokenFlags := s.cfg.FeatureFlags != nil && s.cfg.FeatureFlags.HasTokenFlags()
+	if tokenFlags || len(s.cfg.TokenAppMetadataKeys) > 0 {
+		account, err := db.GetAccountByID(ctx, accountID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting account for access token claims: %w", err)
+		}
+		if tokenFlags {
+			claims.FeatureFlags = s.cfg.FeatureFlags.TokenClaim(account.FeatureFlags)
+		}
+		claims.AppMetadata = metadata.TokenClaim(account.AppMetadata, s.cfg.TokenAppMetadataKeys)
+	}
+
+	accessToken, accessTokenExpiresAt, err := s.cfg.AuthClient.NewAccessToken(claims)
+	if err != nil {
+		return nil, fmt.Errorf("error creating access token: %w", err)
+	}
+
+	s.cfg.Metrics.TokenIssued(metrics.TokenRefresh)
+	s.cfg.Metrics.TokenIssued(metrics.TokenAccess)
+
+	return &Tokens{
+		AccountID:            accountID,
+		SessionID:            sessionID,
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessTokenExpiresAt,
+		RefreshToken:         refreshToken,
+		Scopes:               client.Scopes,
+	}, nil
+}
+
+// errTokensNotIssued rolls back a refresh that failed to issue new tokens
+var errTokensNotIssued = errors.New("tokens not issued")
+
+// Refresh trades a refresh token for new tokens that continue its session. With rotation the
+// old refresh token stops working once the grace period has passed. client.Scopes narrow the
+// session from then on. It fails with ErrSessionExpired, or ErrScopeNotGranted.
+func (s *Service) Refresh(ctx context.Context, refreshToken string, client Client) (*Tokens, error) {
+	if s.cfg.SignedRefreshTokens {
+		return s.refreshSigned(ctx, refreshToken, client)
+	}
+
+	// the old token is rotated out in the transaction creating its replacement, so a failed
+	// refresh doesn't use it up
+	now := time.Now()
+	var token *database.RefreshToken
+	var tokens *Tokens
+	var issueErr error
+	err := s.cfg.DB.WithTx(ctx, func(tx database.Repository) error {
+		var err error
+		if s.cfg.RefreshTokenRotation {
+			token, err = tx.RotateRefreshToken(ctx, refreshToken, now)
+		} else {
+			token, err = tx.GetRefreshToken(ctx, refreshToken)
+		}
+		if err != nil {
+			return err
+		}
+
+		// expired, or replaced by a newer one more than the grace period ago
+		rotatedOut := token.RotatedAt != nil && now.Sub(*token.RotatedAt) > s.cfg.RefreshTokenGracePeriod
+		if token.ExpiresAt.Before(now) || rotatedOut {
+			return ErrSessionExpired
+		}
+
+		client.Scopes, err = narrowScopes(token.Scopes, client.Scopes)
+		if err != nil {
+			return err
+		}
+
+		// the new refresh token continues the session of the one it replaces
+		tokens, issueErr = s.issueTokens(ctx, tx, token.AccountID, client, token.SessionID, nil)
+		if issueErr != nil {
+			return errTokensNotIssued
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRefreshTokenNotFound), errors.Is(err, ErrSessionExpired):
+			return nil, ErrSessionExpired
+		case errors.Is(err, ErrScopeNotGranted):
+			return nil, ErrScopeNotGranted
+		case issueErr != nil:
+			return nil, issueErr
+		default:
+			return nil, fmt.Errorf("error refreshing tokens: %w", err)
+		}
+	}
+
+	s.recordAuditEvent(ctx, client, token.AccountID, database.AuditEventTokenRefreshed)
+
+	return tokens, nil
+}
+
+// refreshSigned refreshes with a signed refresh token. Only the revocation list is consulted,
+// refresh tokens aren't read from or written to the database.
+func (s *Service) refreshSigned(ctx context.Context, refreshToken string, client Client) (*Tokens, error) {
+	claims, err := s.cfg.AuthClient.ParseSignedRefreshToken(refreshToken)
+	if err != nil {
+		return nil, ErrSessionExpired
+	}
+
+	// checked before rotating, so asking for too much doesn't use the token up
+	client.Scopes, err = narrowScopes(claims.Scopes, client.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	// fail closed, a logged out session mustn't come back because the store is down
+	revoked, err := s.cfg.Revocations.FamilyRevoked(ctx, claims.Family)
+	if err != nil {
+		return nil, fmt.Errorf("error checking refresh token revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrSessionExpired
+	}
+
+	// every session of the account ends when it's frozen
+	revokedAt, err := s.cfg.Revocations.AccountRevokedAt(ctx, claims.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking refresh token revocation: %w", err)
+	}
+	// issue times have millisecond precision, so a login right after the revocation, e.g. with
+	// the new password, keeps its session even in the same second
+	if claims.IssuedAt.Before(revokedAt) {
+		return nil, ErrSessionExpired
+	}
+
+	// stored refresh tokens go with a deleted or erased account, signed ones have to be turned
+	// away here
+	if _, err := s.cfg.DB.GetAccountByID(ctx, claims.AccountID); err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return nil, ErrSessionExpired
+		}
+		return nil, fmt.Errorf("error getting account for refresh: %w", err)
+	}
+
+	if s.cfg.RefreshTokenRotation {
+		reused, err := s.cfg.Revocations.Rotate(ctx, claims.Family, claims.Generation, s.cfg.RefreshTokenGracePeriod)
+		if err != nil {
+			return nil, fmt.Errorf("error rotating refresh token: %w", err)
+		}
+		if reused {
+			// a rotated out token coming back means it leaked, so end the whole session
+			slog.WarnContext(ctx, "refresh token reused, revoking its family",
+				"account_id", claims.AccountID, "generation", claims.Generation)
+			if err := s.cfg.Revocations.RevokeFamily(ctx, claims.Family); err != nil {
+				slog.ErrorContext(ctx, "error revoking refresh token family", "error", err)
+			}
+			return nil, ErrSessionExpired
+		}
+	}
+
+	tokens, err := s.issueTokens(ctx, s.cfg.DB, claims.AccountID, client, "", claims)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordAuditEvent(ctx, client, claims.AccountID, database.AuditEventTokenRefreshed)
+
+	return tokens, nil
+}
+
+// narrowScopes are the scopes a refresh asking for requested continues a session granted with,
+// granted when it doesn't ask. A session without scopes can be narrowed to any, the others only
+// to some of theirs. It fails with ErrScopeNotGranted.
+func narrowScopes(granted, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return granted, nil
+	}
+	for _, scope := range requested {
+		if len(granted) > 0 && !slices.Contains(granted, scope) {
+			return nil, ErrScopeNotGranted
+		}
+	}
+	return requested, nil
+}
+
+// Logout ends the refresh token's session, or with allDevices every session of its account.
+// Unknown, invalid, and expired refresh tokens are already logged out, so they aren't an error.
+func (s *Service) Logout(ctx context.Context, refreshToken string, allDevices bool, client Client) error {
+	var accountID string
+	if s.cfg.SignedRefreshTokens {
+		claims, err := s.cfg.AuthClient.ParseSignedRefreshToken(refreshToken)
+		if err != nil {
+			return nil
+		}
+		accountID = claims.AccountID
+
+		// other sessions of the account aren't known, so all devices revokes the account's
+		// tokens issued until now
+		if allDevices {
+			err = s.RevokeSignedRefreshTokens(ctx, claims.AccountID)
+		} else {
+			err = s.cfg.Revocations.RevokeFamily(ctx, claims.Family)
+		}
+		if err != nil {
+			return fmt.Errorf("error revoking refresh token family: %w", err)
+		}
+	} else {
+		token, err := s.cfg.DB.GetRefreshToken(ctx, refreshToken)
+		if err != nil {
+			if errors.Is(err, database.ErrRefreshTokenNotFound) {
+				return nil
+			}
+			return fmt.Errorf("error getting refresh token: %w", err)
+		}
+		accountID = token.AccountID
+
+		if allDevices {
+			err = s.cfg.DB.DeleteRefreshTokensByAccount(ctx, token.AccountID)
+		} else {
+			err = s.cfg.DB.DeleteRefreshTokenByToken(ctx, token.Token)
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting refresh token: %w", err)
+		}
+	}
+
+	if allDevices {
+		s.recordAuditEvent(ctx, client, accountID, database.AuditEventLogoutAll)
+	} else {
+		s.recordAuditEvent(ctx, client, accountID, database.AuditEventLogout)
+	}
+	return nil
+}
+
+// LogoutAll ends every session of the account. Access tokens keep working until they expire,
+// unless the caller revokes them too.
+func (s *Service) LogoutAll(ctx context.Context, accountID string, client Client) error {
+	var err error
+	if s.cfg.SignedRefreshTokens {
+		err = s.RevokeSignedRefreshTokens(ctx, accountID)
+	} else {
+		err = s.cfg.DB.DeleteRefreshTokensByAccount(ctx, accountID)
+	}
+	if err != nil {
+		return fmt.Errorf("error revoking account sessions: %w", err)
+	}
+
+	s.recordAuditEvent(ctx, client, accountID, database.AuditEventLogoutAll)
+	return nil
+}
+
+// RevokeSignedRefreshTokens ends the account's sessions the database doesn't know about. Writes
+// that end an account's sessions, like a password change or freezing it, delete its stored
+// refresh tokens along with them, but signed refresh tokens aren't stored and have to be
+// revoked as well. It does nothing without signed refresh tokens.
+func (s *Service) RevokeSignedRefreshTokens(ctx context.Context, accountID string) error {
+	if !s.cfg.SignedRefreshTokens {
+		return nil
+	}
+	return s.cfg.Revocations.RevokeAccount(ctx, accountID)
+}
@@ -0,0 +1,74 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+)
+
+// ErrDeviceTrustDisabled is trusting a device when TrustedDeviceTTL is 0
+var ErrDeviceTrustDisabled = errors.New("trusted devices are turned off")
+
+// TrustDevice trusts the device of a login that just completed MFA for TrustedDeviceTTL, and
+// sets tokens.DeviceToken to the token the device sends with later logins to skip MFA. The
+// token only works from the same device, identified by its user agent. It fails with
+// ErrDeviceTrustDisabled.
+func (s *Service) TrustDevice(ctx context.Context, tokens *Tokens, client Client) error {
+	if s.cfg.TrustedDeviceTTL <= 0 {
+		return ErrDeviceTrustDisabled
+	}
+
+	expiresAt := time.Now().Add(s.cfg.TrustedDeviceTTL)
+	device, err := s.cfg.DB.CreateTrustedDevice(ctx, database.CreateTrustedDeviceParams{
+		AccountID:  tokens.AccountID,
+		DeviceHash: deviceHash(client.UserAgent),
+		IPAddress:  client.IPAddress,
+		UserAgent:  client.UserAgent,
+		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating trusted device: %w", err)
+	}
+
+	token, err := s.cfg.AuthClient.NewDeviceToken(tokens.AccountID, device.ID, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	s.recordAuditEvent(ctx, client, tokens.AccountID, database.AuditEventDeviceTrusted)
+
+	tokens.DeviceToken = token
+	tokens.DeviceTokenExpiresAt = expiresAt
+	return nil
+}
+
+// trustedDevice reports whether the login is from a device the account trusts, and records
+// that it was used. Anything wrong with the device token means the login completes MFA.
+func (s *Service) trustedDevice(ctx context.Context, accountID string, client Client) bool {
+	if s.cfg.TrustedDeviceTTL <= 0 || client.DeviceToken == "" {
+		return false
+	}
+
+	device, err := s.cfg.AuthClient.ParseDeviceToken(client.DeviceToken)
+	if err != nil || device.AccountID != accountID {
+		return false
+	}
+
+	err = s.cfg.DB.UseTrustedDevice(ctx, database.UseTrustedDeviceParams{
+		ID:         device.ID,
+		AccountID:  accountID,
+		DeviceHash: deviceHash(client.UserAgent),
+		At:         time.Now(),
+	})
+	if err != nil {
+		if !errors.Is(err, database.ErrTrustedDeviceNotFound) {
+			slog.ErrorContext(ctx, "error using trusted device", "error", err)
+		}
+		return false
+	}
+	return true
+}
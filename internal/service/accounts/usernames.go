@@ -0,0 +1,64 @@
+package accounts
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrInvalidUsername is a username not matching the format, see ValidateUsername
+	ErrInvalidUsername = errors.New("invalid username")
+	// ErrReservedUsername is a username nobody can take, e.g. "admin"
+	ErrReservedUsername = errors.New("reserved username")
+	// ErrUsernameTaken is a username another account has, in any case
+	ErrUsernameTaken = errors.New("username taken")
+)
+
+// usernamePattern is 3-30 letters, digits, underscores, dots or hyphens, starting with a letter
+// or digit. Without "@" a username can never be mistaken for an email when logging in.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{2,29}$`)
+
+// reservedUsernames could be mistaken for the service, its operators, or its routes
+var reservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"anonymous":     true,
+	"api":           true,
+	"billing":       true,
+	"help":          true,
+	"info":          true,
+	"internal":      true,
+	"me":            true,
+	"moderator":     true,
+	"noreply":       true,
+	"no-reply":      true,
+	"null":          true,
+	"official":      true,
+	"operator":      true,
+	"postmaster":    true,
+	"root":          true,
+	"security":      true,
+	"staff":         true,
+	"support":       true,
+	"system":        true,
+	"undefined":     true,
+	"webmaster":     true,
+}
+
+// ValidateUsername checks username's format and that it isn't reserved. It fails with
+// ErrInvalidUsername or ErrReservedUsername.
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return ErrInvalidUsername
+	}
+	if reservedUsernames[strings.ToLower(username)] {
+		return ErrReservedUsername
+	}
+	return nil
+}
+
+// isUsername reports whether a login identifier is a username rather than an email
+func isUsername(identifier string) bool {
+	return !strings.Contains(identifier, "@")
+}
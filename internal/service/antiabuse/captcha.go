@@ -0,0 +1,188 @@
+// Package antiabuse decides when requests have to prove a human sent them. Registering and
+// asking for a password reset always take a solved captcha, and logging in takes one once a
+// client IP has failed too many logins.
+package antiabuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/captcha"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+)
+
+// Provider values
+const (
+	ProviderTurnstile = "turnstile"
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderReCAPTCHA = "recaptcha"
+)
+
+const (
+	// DefaultLoginFailures is how many failed logins a client IP gets before its logins need a
+	// captcha
+	DefaultLoginFailures = 3
+	// loginFailureWindow is how long failed logins are counted for, and how long logins need a
+	// captcha once there were too many
+	loginFailureWindow = time.Hour
+)
+
+var (
+	// ErrCaptchaRequired is a request that needs a solved captcha and came without one
+	ErrCaptchaRequired = errors.New("captcha required")
+	// ErrInvalidCaptcha is a captcha that wasn't solved, or was already used or expired
+	ErrInvalidCaptcha = captcha.ErrInvalidResponse
+	// ErrUnknownProvider is a provider other than the Provider values
+	ErrUnknownProvider = errors.New("unknown captcha provider")
+)
+
+// verifyURLs are the siteverify endpoints of the providers. They all take the same request and
+// answer the same way, so one client works for each.
+var verifyURLs = map[string]string{
+	ProviderTurnstile: captcha.DefaultVerifyURL,
+	ProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ProviderReCAPTCHA: "https://www.google.com/recaptcha/api/siteverify",
+}
+
+// Provider verifies the captchas clients solve with its widget
+type Provider interface {
+	// Name is the provider clients load the widget from, one of the Provider values
+	Name() string
+	// Verify checks a captcha response token from the client. A token that isn't valid wraps
+	// ErrInvalidCaptcha; any other error means the provider couldn't be asked.
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+type ProviderConfig struct {
+	// Name is one of the Provider values, ProviderTurnstile by default
+	Name   string
+	Secret string
+	// VerifyURL overrides the provider's siteverify endpoint, e.g. for a proxy. HTTPClient
+	// defaults to http.DefaultClient.
+	VerifyURL  string
+	HTTPClient *http.Client
+}
+
+type siteverifyProvider struct {
+	name string
+	*captcha.Client
+}
+
+func (p *siteverifyProvider) Name() string {
+	return p.name
+}
+
+// NewProvider returns the provider cfg names. It fails with ErrUnknownProvider.
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	if cfg.Name == "" {
+		cfg.Name = ProviderTurnstile
+	}
+	verifyURL, ok := verifyURLs[cfg.Name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, cfg.Name)
+	}
+	if cfg.VerifyURL != "" {
+		verifyURL = cfg.VerifyURL
+	}
+
+	return &siteverifyProvider{
+		name: cfg.Name,
+		Client: captcha.NewClient(captcha.Config{
+			Secret:     cfg.Secret,
+			VerifyURL:  verifyURL,
+			HTTPClient: cfg.HTTPClient,
+		}),
+	}, nil
+}
+
+// Action is what a request that might need a captcha is doing
+type Action string
+
+const (
+	ActionRegister       Action = "register"
+	ActionForgotPassword Action = "forgot_password"
+	ActionLogin          Action = "login"
+)
+
+type CaptchaGateConfig struct {
+	Provider Provider
+	// SiteKey is the public key clients render the provider's widget with
+	SiteKey string
+	// LoginFailures is how many failed logins a client IP gets within an hour before its logins
+	// need a captcha for the rest of it. Defaults to DefaultLoginFailures.
+	LoginFailures int
+	// Store keeps the failed login counts, and should be shared between replicas. Defaults to
+	// memory.
+	Store lockout.Store
+}
+
+// CaptchaGate checks captchas on the requests that need them
+type CaptchaGate struct {
+	provider      Provider
+	siteKey       string
+	loginFailures *lockout.Guard
+}
+
+func NewCaptchaGate(cfg CaptchaGateConfig) *CaptchaGate {
+	if cfg.LoginFailures <= 0 {
+		cfg.LoginFailures = DefaultLoginFailures
+	}
+	if cfg.Store == nil {
+		cfg.Store = lockout.NewMemoryStore()
+	}
+
+	return &CaptchaGate{
+		provider: cfg.Provider,
+		siteKey:  cfg.SiteKey,
+		loginFailures: lockout.NewGuard(cfg.Store, lockout.Config{
+			Window:          loginFailureWindow,
+			MaxAttempts:     cfg.LoginFailures,
+			LockoutDuration: loginFailureWindow,
+		}),
+	}
+}
+
+// ProviderName is the provider clients load the widget from
+func (g *CaptchaGate) ProviderName() string {
+	return g.provider.Name()
+}
+
+// SiteKey is the public key clients render the widget with
+func (g *CaptchaGate) SiteKey() string {
+	return g.siteKey
+}
+
+// Required reports whether a request from remoteIP doing action needs a solved captcha
+func (g *CaptchaGate) Required(ctx context.Context, action Action, remoteIP string) bool {
+	if action != ActionLogin {
+		return true
+	}
+	return g.loginFailures.Check(ctx, loginFailuresKey(remoteIP)) > 0
+}
+
+// Check verifies the captcha token a request from remoteIP doing action came with, when the
+// action needs one. It fails with ErrCaptchaRequired, an error wrapping ErrInvalidCaptcha, or
+// an error asking the provider.
+func (g *CaptchaGate) Check(ctx context.Context, action Action, token, remoteIP string) error {
+	if !g.Required(ctx, action, remoteIP) {
+		return nil
+	}
+	if token == "" {
+		return ErrCaptchaRequired
+	}
+	return g.provider.Verify(ctx, token, remoteIP)
+}
+
+// RecordLoginFailure counts a failed login from remoteIP towards its logins needing a captcha.
+// Successful logins don't clear the count, or logging into an account of their own would let
+// an attacker keep guessing others without one.
+func (g *CaptchaGate) RecordLoginFailure(ctx context.Context, remoteIP string) {
+	g.loginFailures.RecordFailure(ctx, loginFailuresKey(remoteIP))
+}
+
+func loginFailuresKey(remoteIP string) string {
+	return "captcha-login-failures:" + remoteIP
+}
@@ -0,0 +1,84 @@
+package antiabuse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	verified int
+}
+
+func (p *fakeProvider) Name() string {
+	return ProviderHCaptcha
+}
+
+func (p *fakeProvider) Verify(ctx context.Context, token, remoteIP string) error {
+	p.verified++
+	if token != "solved" {
+		return fmt.Errorf("%w: not solved", ErrInvalidCaptcha)
+	}
+	return nil
+}
+
+func TestNewProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		_ = json.NewEncoder(w).Encode(map[string]bool{"success": r.PostForm.Get("response") == "solved"})
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := NewProvider(ProviderConfig{Name: ProviderReCAPTCHA, Secret: "test-secret", VerifyURL: server.URL})
+	require.NoError(t, err)
+	assert.Equal(t, ProviderReCAPTCHA, provider.Name())
+	assert.NoError(t, provider.Verify(context.Background(), "solved", ""))
+	assert.ErrorIs(t, provider.Verify(context.Background(), "not-solved", ""), ErrInvalidCaptcha)
+
+	provider, err = NewProvider(ProviderConfig{Secret: "test-secret"})
+	require.NoError(t, err)
+	assert.Equal(t, ProviderTurnstile, provider.Name())
+
+	_, err = NewProvider(ProviderConfig{Name: "recaptcha-enterprise"})
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestCaptchaGate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("always required to register and reset passwords", func(t *testing.T) {
+		provider := &fakeProvider{}
+		gate := NewCaptchaGate(CaptchaGateConfig{Provider: provider, SiteKey: "site-key"})
+		assert.Equal(t, ProviderHCaptcha, gate.ProviderName())
+		assert.Equal(t, "site-key", gate.SiteKey())
+
+		for _, action := range []Action{ActionRegister, ActionForgotPassword} {
+			assert.ErrorIs(t, gate.Check(ctx, action, "", "203.0.113.7"), ErrCaptchaRequired)
+			assert.ErrorIs(t, gate.Check(ctx, action, "not-solved", "203.0.113.7"), ErrInvalidCaptcha)
+			assert.NoError(t, gate.Check(ctx, action, "solved", "203.0.113.7"))
+		}
+	})
+
+	t.Run("required to log in after failures", func(t *testing.T) {
+		provider := &fakeProvider{}
+		gate := NewCaptchaGate(CaptchaGateConfig{Provider: provider, LoginFailures: 2})
+
+		assert.NoError(t, gate.Check(ctx, ActionLogin, "", "203.0.113.7"))
+		gate.RecordLoginFailure(ctx, "203.0.113.7")
+		assert.NoError(t, gate.Check(ctx, ActionLogin, "", "203.0.113.7"))
+		gate.RecordLoginFailure(ctx, "203.0.113.7")
+
+		assert.ErrorIs(t, gate.Check(ctx, ActionLogin, "", "203.0.113.7"), ErrCaptchaRequired)
+		assert.NoError(t, gate.Check(ctx, ActionLogin, "solved", "203.0.113.7"))
+		// other clients aren't affected
+		assert.NoError(t, gate.Check(ctx, ActionLogin, "", "198.51.100.2"))
+		// the provider is only asked when a captcha is needed
+		assert.Equal(t, 1, provider.verified)
+	})
+}
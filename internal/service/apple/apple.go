@@ -0,0 +1,323 @@
+package apple
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// Issuer is the "iss" of Apple ID tokens and the "aud" of client secrets
+	Issuer = "https://appleid.apple.com"
+
+	defaultTokenURL = "https://appleid.apple.com/auth/token"
+	defaultKeysURL  = "https://appleid.apple.com/auth/keys"
+
+	// client secrets can last up to 6 months but they're cheap to make so keep them short lived
+	clientSecretTTL = 5 * time.Minute
+	// don't hammer Apple's key endpoint when tokens with unknown key IDs show up
+	minKeysRefreshInterval = time.Minute
+)
+
+// ErrInvalidCredential wraps every reason an authorization code or ID token is rejected
+var ErrInvalidCredential = errors.New("invalid apple credential")
+
+type Config struct {
+	// TeamID is the Apple developer team ID
+	TeamID string
+	// ClientID is the Services ID (web) or bundle ID (native apps)
+	ClientID string
+	// KeyID and PrivateKey are the "Sign in with Apple" key used to sign client secrets
+	KeyID      string
+	PrivateKey *ecdsa.PrivateKey
+	// RedirectURL must match the one used to get the authorization code, if any
+	RedirectURL string
+
+	// TokenURL, KeysURL, and HTTPClient default to Apple's endpoints and http.DefaultClient
+	TokenURL   string
+	KeysURL    string
+	HTTPClient *http.Client
+}
+
+// Identity is the verified Apple user
+type Identity struct {
+	// Subject is Apple's stable user ID for this team
+	Subject        string
+	Email          string
+	EmailVerified  bool
+	IsPrivateEmail bool
+}
+
+// Client exchanges Sign in with Apple authorization codes for verified identities
+type Client struct {
+	cfg Config
+
+	mu            sync.Mutex
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+}
+
+func NewClient(cfg Config) *Client {
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = defaultTokenURL
+	}
+	if cfg.KeysURL == "" {
+		cfg.KeysURL = defaultKeysURL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+
+	return &Client{cfg: cfg}
+}
+
+// ParsePrivateKey parses the PKCS #8 .p8 key downloaded from the Apple developer portal
+func ParsePrivateKey(pemBytes []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("error parsing apple private key: no PEM block found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing apple private key: %w", err)
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("error parsing apple private key: not an ECDSA key")
+	}
+
+	return ecKey, nil
+}
+
+// ClientSecret returns the ES256 signed JWT Apple requires in place of a static client secret
+func (c *Client) ClientSecret(now time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Issuer:    c.cfg.TeamID,
+		Subject:   c.cfg.ClientID,
+		Audience:  jwt.ClaimStrings{Issuer},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(clientSecretTTL)),
+	})
+	token.Header["kid"] = c.cfg.KeyID
+
+	secret, err := token.SignedString(c.cfg.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("error signing apple client secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// Authenticate redeems an authorization code with Apple and verifies the returned ID token
+func (c *Client) Authenticate(ctx context.Context, code string) (*Identity, error) {
+	idToken, err := c.exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.VerifyIDToken(ctx, idToken)
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (c *Client) exchange(ctx context.Context, code string) (string, error) {
+	secret, err := c.ClientSecret(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"client_id":     {c.cfg.ClientID},
+		"client_secret": {secret},
+		"code":          {code},
+		"grant_type":    {"authorization_code"},
+	}
+	if c.cfg.RedirectURL != "" {
+		form.Set("redirect_uri", c.cfg.RedirectURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("error creating apple token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling apple token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error decoding apple token response: %w", err)
+	}
+
+	// invalid_grant means the code was bad, expired, or already used; anything else is on us
+	if body.Error == "invalid_grant" {
+		return "", fmt.Errorf("%w: %s", ErrInvalidCredential, body.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("error from apple token endpoint: status %d: %s", resp.StatusCode, body.Error)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("error from apple token endpoint: no id_token in response")
+	}
+
+	return body.IDToken, nil
+}
+
+type idTokenClaims struct {
+	Email          string   `json:"email"`
+	EmailVerified  flexBool `json:"email_verified"`
+	IsPrivateEmail flexBool `json:"is_private_email"`
+	jwt.RegisteredClaims
+}
+
+// VerifyIDToken checks an ID token's signature against Apple's published keys and its
+// issuer, audience, and expiry.
+func (c *Client) VerifyIDToken(ctx context.Context, idToken string) (*Identity, error) {
+	var claims idTokenClaims
+
+	_, err := jwt.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", ErrInvalidCredential)
+	}
+
+	return &Identity{
+		Subject:        claims.Subject,
+		Email:          claims.Email,
+		EmailVerified:  bool(claims.EmailVerified),
+		IsPrivateEmail: bool(claims.IsPrivateEmail),
+	}, nil
+}
+
+// publicKey returns Apple's signing key with the given ID, refreshing the key set when the ID
+// is unknown since Apple rotates keys without notice
+func (c *Client) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(c.keysFetchedAt) < minKeysRefreshInterval {
+		return nil, fmt.Errorf("unknown apple key ID %q", kid)
+	}
+
+	keys, err := c.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.keys = keys
+	c.keysFetchedAt = time.Now()
+
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown apple key ID %q", kid)
+	}
+	return key, nil
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func (c *Client) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.KeysURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating apple keys request: %w", err)
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching apple keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching apple keys: status %d", resp.StatusCode)
+	}
+
+	var set jwks
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("error decoding apple keys: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding apple key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding apple key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
+
+// flexBool accepts both true and "true"; Apple has sent booleans as strings in ID tokens
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package apple
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testTeamID   = "TEAMID1234"
+	testClientID = "com.example.accounts"
+	testKeyID    = "KEYID12345"
+	testSignKID  = "apple-signing-key"
+)
+
+// fakeApple stands in for appleid.apple.com
+type fakeApple struct {
+	server     *httptest.Server
+	signingKey *rsa.PrivateKey
+	secretKey  *ecdsa.PrivateKey
+	// idTokenClaims are returned for the code "valid-code"
+	idTokenClaims jwt.MapClaims
+}
+
+func newFakeApple(t *testing.T) *fakeApple {
+	t.Helper()
+
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	secretKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	f := &fakeApple{signingKey: signingKey, secretKey: secretKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": testSignKID,
+				"n":   base64.RawURLEncoding.EncodeToString(signingKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(signingKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/auth/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+
+		// the client secret must be signed by the configured key
+		var secretClaims jwt.RegisteredClaims
+		_, err := jwt.ParseWithClaims(r.Form.Get("client_secret"), &secretClaims, func(token *jwt.Token) (interface{}, error) {
+			assert.Equal(t, testKeyID, token.Header["kid"])
+			return &secretKey.PublicKey, nil
+		}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithIssuer(testTeamID), jwt.WithAudience(Issuer), jwt.WithSubject(testClientID))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		if r.Form.Get("code") != "valid-code" || r.Form.Get("grant_type") != "authorization_code" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "code expired"})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": f.idToken(t, f.idTokenClaims)})
+	})
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fakeApple) idToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testSignKID
+	signed, err := token.SignedString(f.signingKey)
+	require.NoError(t, err)
+	return signed
+}
+
+func (f *fakeApple) client() *Client {
+	return NewClient(Config{
+		TeamID:     testTeamID,
+		ClientID:   testClientID,
+		KeyID:      testKeyID,
+		PrivateKey: f.secretKey,
+		TokenURL:   f.server.URL + "/auth/token",
+		KeysURL:    f.server.URL + "/auth/keys",
+	})
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":              Issuer,
+		"aud":              testClientID,
+		"sub":              "001234.abcdef",
+		"email":            "user@privaterelay.appleid.com",
+		"email_verified":   "true",
+		"is_private_email": true,
+		"iat":              time.Now().Unix(),
+		"exp":              time.Now().Add(10 * time.Minute).Unix(),
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeApple(t)
+	f.idTokenClaims = validClaims()
+
+	identity, err := f.client().Authenticate(ctx, "valid-code")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Subject:        "001234.abcdef",
+		Email:          "user@privaterelay.appleid.com",
+		EmailVerified:  true,
+		IsPrivateEmail: true,
+	}, identity)
+
+	_, err = f.client().Authenticate(ctx, "expired-code")
+	assert.ErrorIs(t, err, ErrInvalidCredential)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeApple(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		token       func() string
+		expectedErr bool
+	}{
+		{
+			name:  "valid",
+			token: func() string { return f.idToken(t, validClaims()) },
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				claims := validClaims()
+				claims["aud"] = "com.someone.else"
+				return f.idToken(t, claims)
+			},
+			expectedErr: true,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				claims := validClaims()
+				claims["iss"] = "https://evil.example.com"
+				return f.idToken(t, claims)
+			},
+			expectedErr: true,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+				return f.idToken(t, claims)
+			},
+			expectedErr: true,
+		},
+		{
+			name: "signed by someone else",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+				token.Header["kid"] = testSignKID
+				signed, err := token.SignedString(otherKey)
+				require.NoError(t, err)
+				return signed
+			},
+			expectedErr: true,
+		},
+	}
+
+	client := f.client()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.VerifyIDToken(ctx, tt.token())
+			if tt.expectedErr {
+				assert.ErrorIs(t, err, ErrInvalidCredential)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	parsed, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.True(t, key.Equal(parsed))
+
+	_, err = ParsePrivateKey([]byte("not a key"))
+	assert.Error(t, err)
+}
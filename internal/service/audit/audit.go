@@ -0,0 +1,104 @@
+// Package audit records security events to the audit log. Writer writes them in the background
+// so recording an event doesn't add a database round trip to logins and refreshes.
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/austinwofford/account-management/internal/database"
+)
+
+// CreateFunc stores an event, usually the database's CreateAuditEvent
+type CreateFunc func(ctx context.Context, params database.CreateAuditEventParams) error
+
+// Recorder records audit events. Failures are logged rather than returned since the action
+// being audited already happened.
+type Recorder interface {
+	Record(ctx context.Context, event database.CreateAuditEventParams)
+}
+
+// Sync records events before returning, for tests and callers that read them back right away
+type Sync CreateFunc
+
+func (s Sync) Record(ctx context.Context, event database.CreateAuditEventParams) {
+	if err := s(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "error recording audit event", "event_type", event.EventType, "error", err)
+	}
+}
+
+type Config struct {
+	// BufferSize is how many events can wait to be written. Once it's full events are written
+	// by the caller instead, so none are dropped when the database falls behind.
+	BufferSize int
+}
+
+func DefaultConfig() Config {
+	return Config{BufferSize: 1024}
+}
+
+type pendingEvent struct {
+	// ctx is the request's without its cancellation, so the write keeps its trace and logs
+	// keep the request ID
+	ctx   context.Context
+	event database.CreateAuditEventParams
+}
+
+// Writer records events in the background. Events are only written while Run is running.
+type Writer struct {
+	create  CreateFunc
+	pending chan pendingEvent
+	// wg tracks events that were queued but not written yet
+	wg sync.WaitGroup
+}
+
+func NewWriter(create CreateFunc, cfg Config) *Writer {
+	return &Writer{
+		create:  create,
+		pending: make(chan pendingEvent, cfg.BufferSize),
+	}
+}
+
+// Record queues the event to be written, or writes it right away when the queue is full
+func (w *Writer) Record(ctx context.Context, event database.CreateAuditEventParams) {
+	ctx = context.WithoutCancel(ctx)
+
+	w.wg.Add(1)
+	select {
+	case w.pending <- pendingEvent{ctx: ctx, event: event}:
+	default:
+		w.wg.Done()
+		slog.WarnContext(ctx, "audit log buffer is full, writing the event inline")
+		Sync(w.create).Record(ctx, event)
+	}
+}
+
+// Run writes queued events until ctx is done, then writes whatever is still queued
+func (w *Writer) Run(ctx context.Context) {
+	for {
+		select {
+		case p := <-w.pending:
+			w.write(p)
+		case <-ctx.Done():
+			for {
+				select {
+				case p := <-w.pending:
+					w.write(p)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Flush waits until every event recorded so far is written. Run has to be running.
+func (w *Writer) Flush() {
+	w.wg.Wait()
+}
+
+func (w *Writer) write(p pendingEvent) {
+	defer w.wg.Done()
+	Sync(w.create).Record(p.ctx, p.event)
+}
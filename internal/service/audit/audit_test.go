@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(context.Background(), database.AccountCreationParams{Email: "audit@test.com"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := NewWriter(db.CreateAuditEvent, Config{BufferSize: 10})
+	go w.Run(ctx)
+
+	// the request's context is usually cancelled by the time the event is written
+	reqCtx, cancelReq := context.WithCancel(ctx)
+	w.Record(reqCtx, database.CreateAuditEventParams{AccountID: account.ID, EventType: database.AuditEventLogin})
+	cancelReq()
+	w.Record(ctx, database.CreateAuditEventParams{AccountID: account.ID, EventType: database.AuditEventLogout})
+	w.Flush()
+
+	events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestWriterFullBuffer(t *testing.T) {
+	var written []string
+	create := func(ctx context.Context, params database.CreateAuditEventParams) error {
+		written = append(written, params.EventType)
+		return nil
+	}
+
+	// nothing is running to drain the buffer
+	w := NewWriter(create, Config{BufferSize: 1})
+	w.Record(context.Background(), database.CreateAuditEventParams{EventType: "queued"})
+	w.Record(context.Background(), database.CreateAuditEventParams{EventType: "inline"})
+	assert.Equal(t, []string{"inline"}, written, "events aren't dropped when the buffer is full")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.Run(ctx)
+	assert.Equal(t, []string{"inline", "queued"}, written, "queued events are written on shutdown")
+}
+
+func TestSync(t *testing.T) {
+	calls := 0
+	Sync(func(ctx context.Context, params database.CreateAuditEventParams) error {
+		calls++
+		return errors.New("connection refused")
+	}).Record(context.Background(), database.CreateAuditEventParams{EventType: database.AuditEventLogin})
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognize and scan for
+const APIKeyPrefix = "amk_"
+
+// Scopes API keys, OAuth clients, and the account's own access tokens can be restricted to.
+// Access tokens an account logged in for without asking for scopes aren't restricted.
+const (
+	// ScopeAccountRead reads the account, its activity, and its sessions
+	ScopeAccountRead = "account:read"
+	// ScopeAccountWrite changes the account's profile and user metadata
+	ScopeAccountWrite = "account:write"
+	// ScopeSessionsWrite logs the account's sessions out
+	ScopeSessionsWrite = "sessions:write"
+)
+
+// Scopes are all the scopes, in the order they're documented
+var Scopes = []string{ScopeAccountRead, ScopeAccountWrite, ScopeSessionsWrite}
+
+// ErrInvalidAPIKey is an API key that's unknown, revoked, or expired
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKey is the key a request authenticated with
+type APIKey struct {
+	ID        string
+	AccountID string
+	Scopes    []string
+}
+
+// HasScope is whether the key was issued with the scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// NewAPIKey returns a random API key and its prefix, the part that's safe to store and show.
+// Like opaque tokens, store HashOpaqueToken(key), never the key itself.
+func NewAPIKey() (key, prefix string, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", fmt.Errorf("error generating api key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("error generating api key: %w", err)
+	}
+
+	prefix = APIKeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// ValidScopes reports whether every scope is one of Scopes
+func ValidScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
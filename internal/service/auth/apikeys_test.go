@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, prefix, err := NewAPIKey()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(prefix, APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(key, prefix+"_"))
+	// the secret is 32 random bytes
+	assert.Len(t, strings.TrimPrefix(key, prefix+"_"), 43)
+
+	other, otherPrefix, err := NewAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+	assert.NotEqual(t, prefix, otherPrefix)
+}
+
+func TestValidScopes(t *testing.T) {
+	assert.True(t, ValidScopes(nil))
+	assert.True(t, ValidScopes([]string{ScopeAccountRead, ScopeSessionsWrite}))
+	assert.False(t, ValidScopes([]string{ScopeAccountRead, "account:delete"}))
+
+	key := &APIKey{Scopes: []string{ScopeAccountRead}}
+	assert.True(t, key.HasScope(ScopeAccountRead))
+	assert.False(t, key.HasScope(ScopeSessionsWrite))
+}
@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+)
+
+// Confirmation is the "cnf" claim (RFC 8705) binding an access token to the client certificate
+// it was issued to. A bound token is only accepted over a connection using that certificate,
+// so a leaked token is useless on its own.
+type Confirmation struct {
+	X5TS256 string `json:"x5t#S256,omitempty"`
+}
+
+// CertificateThumbprint is the base64url encoded SHA-256 of the DER certificate, as used in
+// Confirmation.X5TS256.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
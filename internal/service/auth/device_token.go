@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidDeviceToken = errors.New("invalid device token")
+
+// deviceTokenType is the JWT "typ" header of trusted device tokens. A device token only lets its
+// device skip MFA after the password is checked, so it must never be accepted as an access token.
+const deviceTokenType = "device+jwt"
+
+// DeviceToken is a verified trusted device token
+type DeviceToken struct {
+	// ID is the token's "jti", the ID the device is trusted under
+	ID        string
+	AccountID string
+}
+
+// NewDeviceToken returns a long-lived token for a device the account completed MFA on and chose
+// to trust, valid until expiresAt. Device tokens signed with a key that's since been retired
+// stop working, their devices have to complete MFA again.
+func (c *Client) NewDeviceToken(accountID, deviceID string, expiresAt time.Time) (string, error) {
+	signedToken, err := c.signToken(jwt.RegisteredClaims{
+		Subject:   accountID,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    issuer,
+		ID:        deviceID,
+	}, deviceTokenType)
+	if err != nil {
+		return "", fmt.Errorf("error signing device token: %w", err)
+	}
+
+	return signedToken, nil
+}
+
+// ParseDeviceToken validates the signature, type, expiry, and issuer of a trusted device token.
+// Any validation failure wraps ErrInvalidDeviceToken. It doesn't check whether the device is
+// still trusted.
+func (c *Client) ParseDeviceToken(tokenString string) (*DeviceToken, error) {
+	var claims jwt.RegisteredClaims
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != deviceTokenType {
+			return nil, errors.New("not a device token")
+		}
+		return c.verificationKey(token)
+	},
+		jwt.WithValidMethods(c.validMethods()),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDeviceToken, err)
+	}
+
+	if claims.Subject == "" || claims.ID == "" {
+		return nil, fmt.Errorf("%w: missing sub or jti claim", ErrInvalidDeviceToken)
+	}
+
+	return &DeviceToken{ID: claims.ID, AccountID: claims.Subject}, nil
+}
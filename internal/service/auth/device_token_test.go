@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceToken(t *testing.T) {
+	client := NewClient(Config{
+		JWTSecretKey:           "test-secret-key",
+		AccessTokenTTLMinutes:  15,
+		RefreshTokenTTLMinutes: 60,
+	})
+
+	token, err := client.NewDeviceToken("account-1", "device-1", time.Now().Add(30*24*time.Hour))
+	require.NoError(t, err)
+
+	device, err := client.ParseDeviceToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, &DeviceToken{ID: "device-1", AccountID: "account-1"}, device)
+
+	t.Run("device tokens aren't access tokens", func(t *testing.T) {
+		_, err := client.ParseAccessToken(token)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("MFA challenges aren't device tokens", func(t *testing.T) {
+		challenge, _, err := client.NewMFAChallengeToken("account-1")
+		require.NoError(t, err)
+		_, err = client.ParseDeviceToken(challenge)
+		assert.ErrorIs(t, err, ErrInvalidDeviceToken)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expired, err := client.NewDeviceToken("account-1", "device-1", time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		_, err = client.ParseDeviceToken(expired)
+		assert.ErrorIs(t, err, ErrInvalidDeviceToken)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		other := NewClient(Config{JWTSecretKey: "other-secret"})
+		_, err := other.ParseDeviceToken(token)
+		assert.ErrorIs(t, err, ErrInvalidDeviceToken)
+	})
+}
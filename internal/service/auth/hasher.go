@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms
+const (
+	HashAlgorithmBcrypt   = "bcrypt"
+	HashAlgorithmArgon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// HasherConfig picks how new passwords are hashed. Hashes made with other settings are still
+// verified, and reported as needing a rehash.
+type HasherConfig struct {
+	// Algorithm is HashAlgorithmBcrypt or HashAlgorithmArgon2id
+	Algorithm string
+	// BcryptCost is the log2 of bcrypt's rounds, between bcrypt.MinCost and bcrypt.MaxCost
+	BcryptCost int
+	// Argon2Memory is the memory Argon2id uses in KiB, Argon2Time its passes over it, and
+	// Argon2Threads how many lanes it runs in parallel
+	Argon2Memory  uint32
+	Argon2Time    uint32
+	Argon2Threads uint8
+}
+
+// DefaultHasherConfig is bcrypt at its default cost, with the Argon2id parameters OWASP
+// recommends for when it's switched to
+func DefaultHasherConfig() HasherConfig {
+	return HasherConfig{
+		Algorithm:     HashAlgorithmBcrypt,
+		BcryptCost:    bcrypt.DefaultCost,
+		Argon2Memory:  64 * 1024,
+		Argon2Time:    3,
+		Argon2Threads: 2,
+	}
+}
+
+// Validate reports whether the config can hash passwords
+func (c HasherConfig) Validate() error {
+	switch c.Algorithm {
+	case HashAlgorithmBcrypt:
+		if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashAlgorithmArgon2id:
+		if c.Argon2Memory == 0 || c.Argon2Time == 0 || c.Argon2Threads == 0 {
+			return errors.New("argon2id memory, time, and threads must be positive")
+		}
+		// argon2 needs 8 KiB of memory per lane
+		if c.Argon2Memory < 8*uint32(c.Argon2Threads) {
+			return errors.New("argon2id memory must be at least 8 KiB per thread")
+		}
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q", c.Algorithm)
+	}
+	return nil
+}
+
+// PasswordHasher hashes passwords with the configured algorithm and verifies them against hashes
+// made with any of the supported ones. A nil *PasswordHasher uses DefaultHasherConfig.
+type PasswordHasher struct {
+	cfg HasherConfig
+}
+
+// NewPasswordHasher returns a hasher for cfg, or an error if it isn't valid
+func NewPasswordHasher(cfg HasherConfig) (*PasswordHasher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &PasswordHasher{cfg: cfg}, nil
+}
+
+// defaultHasher backs HashPassword and PasswordIsCorrect
+var defaultHasher = &PasswordHasher{cfg: DefaultHasherConfig()}
+
+// Hash hashes the password. New passwords should be checked against a PasswordPolicy first;
+// rehashing an existing one shouldn't, it may predate the policy.
+func (p *PasswordHasher) Hash(password string) (string, error) {
+	if p == nil {
+		p = defaultHasher
+	}
+
+	if p.cfg.Algorithm == HashAlgorithmArgon2id {
+		return p.hashArgon2id(password)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), p.cfg.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// Verify reports whether the password matches the hash, and if it does, whether the hash should
+// be replaced with one made with the current config
+func (p *PasswordHasher) Verify(password, hashedPassword string) (ok, rehash bool) {
+	if p == nil {
+		p = defaultHasher
+	}
+	if params, salt, key, err := parseArgon2id(hashedPassword); err == nil {
+		actual := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, false
+		}
+		current := p.cfg.Algorithm == HashAlgorithmArgon2id &&
+			params.memory == p.cfg.Argon2Memory &&
+			params.time == p.cfg.Argon2Time &&
+			params.threads == p.cfg.Argon2Threads &&
+			len(key) == argon2KeyLength
+		return true, !current
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	current := err == nil && p.cfg.Algorithm == HashAlgorithmBcrypt && cost == p.cfg.BcryptCost
+	return true, !current
+}
+
+func (p *PasswordHasher) hashArgon2id(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error generating salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.cfg.Argon2Time, p.cfg.Argon2Memory, p.cfg.Argon2Threads, argon2KeyLength)
+
+	// the PHC string format other argon2 libraries read too
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.cfg.Argon2Memory, p.cfg.Argon2Time, p.cfg.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+var errNotArgon2id = errors.New("not an argon2id hash")
+
+func parseArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != HashAlgorithmArgon2id {
+		return params, nil, nil, errNotArgon2id
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errNotArgon2id
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, errNotArgon2id
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errNotArgon2id
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errNotArgon2id
+	}
+	return params, salt, key, nil
+}
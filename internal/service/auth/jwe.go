@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// EncryptionKeySize is the key length for A256GCM, the only content encryption we issue
+const EncryptionKeySize = 32
+
+// DecodeEncryptionKey decodes a base64 (standard or URL, padded or not) access token
+// encryption key and checks its length.
+func DecodeEncryptionKey(s string) ([]byte, error) {
+	var key []byte
+	var err error
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		key, err = enc.DecodeString(s)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decoding encryption key: %w", err)
+	}
+
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("error decoding encryption key: must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// encryptToken wraps a signed JWT in a JWE (direct encryption with A256GCM) so clients
+// can't read the claims. The inner token is still signed and verified as usual.
+func (c *Client) encryptToken(signedToken string) (string, error) {
+	encrypter, err := jose.NewEncrypter(
+		jose.A256GCM,
+		jose.Recipient{Algorithm: jose.DIRECT, Key: c.encryptionKey},
+		(&jose.EncrypterOptions{}).WithType("JWT").WithContentType("JWT"),
+	)
+	if err != nil {
+		return "", fmt.Errorf("error creating token encrypter: %w", err)
+	}
+
+	obj, err := encrypter.Encrypt([]byte(signedToken))
+	if err != nil {
+		return "", fmt.Errorf("error encrypting token: %w", err)
+	}
+
+	return obj.CompactSerialize()
+}
+
+// decryptToken returns the signed JWT inside an encrypted access token
+func (c *Client) decryptToken(tokenString string) (string, error) {
+	obj, err := jose.ParseEncryptedCompact(tokenString, []jose.KeyAlgorithm{jose.DIRECT}, []jose.ContentEncryption{jose.A256GCM})
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidAccessToken, err)
+	}
+
+	if obj.Header.ExtraHeaders[jose.HeaderContentType] != "JWT" {
+		return "", fmt.Errorf("%w: %w", ErrInvalidAccessToken, errors.New("encrypted token is not a nested JWT"))
+	}
+
+	plaintext, err := obj.Decrypt(c.encryptionKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidAccessToken, err)
+	}
+
+	return string(plaintext), nil
+}
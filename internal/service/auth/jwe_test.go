@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xfb}, EncryptionKeySize)
+
+	tests := []struct {
+		name        string
+		input       string
+		expectedErr bool
+	}{
+		{name: "standard encoding", input: base64.StdEncoding.EncodeToString(key)},
+		{name: "raw url encoding", input: base64.RawURLEncoding.EncodeToString(key)},
+		{name: "not base64", input: "not base64!", expectedErr: true},
+		{name: "wrong length", input: base64.StdEncoding.EncodeToString(key[:16]), expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodeEncryptionKey(tt.input)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, key, decoded)
+		})
+	}
+}
+
+func TestEncryptedAccessToken(t *testing.T) {
+	cfg := Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: 15,
+		EncryptionKey:         bytes.Repeat([]byte{1}, EncryptionKeySize),
+	}
+	client := NewClient(cfg)
+
+	token, _, err := client.NewAccessToken(Claims{AccountID: "test-account-id"})
+	require.NoError(t, err)
+
+	// compact JWE has five parts and the claims aren't readable
+	assert.Len(t, strings.Split(token, "."), 5)
+	assert.NotContains(t, token, base64.RawURLEncoding.EncodeToString([]byte("test-account-id")))
+
+	claims, err := client.ParseAccessToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "test-account-id", claims.AccountID)
+
+	t.Run("wrong encryption key", func(t *testing.T) {
+		other := cfg
+		other.EncryptionKey = bytes.Repeat([]byte{2}, EncryptionKeySize)
+
+		_, err := NewClient(other).ParseAccessToken(token)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("plain JWT rejected when encryption is enabled", func(t *testing.T) {
+		plain := cfg
+		plain.EncryptionKey = nil
+
+		plainToken, _, err := NewClient(plain).NewAccessToken(Claims{AccountID: "test-account-id"})
+		require.NoError(t, err)
+
+		_, err = client.ParseAccessToken(plainToken)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("encrypted token rejected when encryption is disabled", func(t *testing.T) {
+		plain := cfg
+		plain.EncryptionKey = nil
+
+		_, err := NewClient(plain).ParseAccessToken(token)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+}
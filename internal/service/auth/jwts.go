@@ -1,7 +1,13 @@
 package auth
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,57 +18,231 @@ import (
 // and the "auth" client. Should probably be moved/broken up/renamed.
 
 type Client struct {
-	jwtSecretKey           string
-	accessTokenTTLMinutes  int
+	secretMu     sync.RWMutex
+	jwtSecretKey string
+	// previousSecretKey keeps verifying tokens until previousSecretUntil after RotateSecretKey
+	previousSecretKey   string
+	previousSecretUntil time.Time
+
+	// accessTokenTTL is a time.Duration, it can be changed while tokens are being issued
+	accessTokenTTL         atomic.Int64
 	refreshTokenTTLMinutes int
+	deterministic          bool
+	encryptionKey          []byte
+	keys                   *KeyRing
 }
 
 type Config struct {
 	JWTSecretKey           string
 	AccessTokenTTLMinutes  int
 	RefreshTokenTTLMinutes int
+	// Deterministic derives token IDs from the claims and issue time instead of
+	// generating random ones. Only meant for mock mode.
+	Deterministic bool
+	// EncryptionKey, when set, wraps every access token in a JWE so clients can't read the
+	// claims. Only encrypted tokens are accepted by ParseAccessToken once it's set.
+	EncryptionKey []byte
+	// SigningKeys, when set, sign every token instead of JWTSecretKey so other services can
+	// verify them with the public keys from JWKS. Only tokens signed with its keys are accepted.
+	SigningKeys *KeyRing
 }
 
 func NewClient(cfg Config) *Client {
-	return &Client{
+	c := &Client{
 		jwtSecretKey:           cfg.JWTSecretKey,
-		accessTokenTTLMinutes:  cfg.AccessTokenTTLMinutes,
 		refreshTokenTTLMinutes: cfg.RefreshTokenTTLMinutes,
+		deterministic:          cfg.Deterministic,
+		encryptionKey:          cfg.EncryptionKey,
+		keys:                   cfg.SigningKeys,
 	}
+	c.SetAccessTokenTTL(time.Duration(cfg.AccessTokenTTLMinutes) * time.Minute)
+	return c
+}
+
+// AccessTokenTTL is how long access tokens and ID tokens are valid for
+func (c *Client) AccessTokenTTL() time.Duration {
+	return time.Duration(c.accessTokenTTL.Load())
+}
+
+// SetAccessTokenTTL changes how long the access tokens issued from now on are valid for.
+// Tokens that were already issued keep their expiry.
+func (c *Client) SetAccessTokenTTL(ttl time.Duration) {
+	c.accessTokenTTL.Store(int64(ttl))
 }
 
 type Claims struct {
+	// AccountID is empty for tokens an OAuth client got with the client credentials grant
 	AccountID string `json:"account_id"`
+	// Actor is set on delegation tokens an OAuth client got by exchanging the account's token
+	Actor *Actor `json:"act,omitempty"`
+	// AppMetadata are the account's values for the app_metadata keys configured to go into
+	// tokens
+	AppMetadata map[string]json.RawMessage `json:"app_metadata,omitempty"`
+	// ClientID is set on tokens issued to an OAuth client
+	ClientID string `json:"client_id,omitempty"`
+	// Confirmation is set on certificate-bound tokens
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+	// FeatureFlags are the account's values for the flags configured to go into tokens
+	FeatureFlags map[string]bool `json:"flags,omitempty"`
+	// OrgID is set on organization-scoped tokens, issued to members of the organization
+	OrgID string `json:"org_id,omitempty"`
+	// Roles are the account's roles, which grant access to the service's own endpoints
+	Roles []string `json:"roles,omitempty"`
+	// Scope is the space separated scopes an OAuth client was granted, or the account's own
+	// token was restricted to (RFC 6749 section 3.3). The account's tokens without one aren't
+	// restricted.
+	Scope string `json:"scope,omitempty"`
+}
+
+// HasRole is whether the token carries the role
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// HasScope is whether the token was granted the scope
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
+
+// Actor is the "act" claim (RFC 8693 section 4.1) naming the OAuth client acting on the account's
+// behalf. A token exchanged again nests the previous actor, the outermost is the current one.
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+const issuer = "account-management"
+
+var ErrInvalidAccessToken = errors.New("invalid access token")
+
+// accessTokenType is the "typ" header of access tokens, the JWT default they've always had. ID
+// tokens share it but don't have the account_id or client_id claim.
+const accessTokenType = "JWT"
+
+// accessTokenClaims are the full set of claims in an access token
+type accessTokenClaims struct {
+	Claims
+	jwt.RegisteredClaims
 }
 
 // NewAccessToken returns a signed JWT string and the expiration time (or an error)
 func (c *Client) NewAccessToken(claims Claims) (string, time.Time, error) {
+	return c.NewAccessTokenWithTTL(claims, c.AccessTokenTTL())
+}
+
+// NewAccessTokenWithTTL is NewAccessToken for a token valid for ttl instead of the configured
+// access token TTL
+func (c *Client) NewAccessTokenWithTTL(claims Claims, ttl time.Duration) (string, time.Time, error) {
 	now := time.Now()
-	expiresAt := now.Add(time.Minute * time.Duration(c.accessTokenTTLMinutes))
+	expiresAt := now.Add(ttl)
 
-	myClaims := struct {
-		Claims
-		jwt.RegisteredClaims
-	}{
+	tokenID := uuid.NewString()
+	if c.deterministic {
+		// JWT timestamps have second precision so the same account in the same second gets the same token
+		now = now.Truncate(time.Second)
+		expiresAt = expiresAt.Truncate(time.Second)
+		subject := claims.AccountID
+		if claims.ClientID != "" {
+			subject += "|" + claims.ClientID
+		}
+		tokenID = uuid.NewSHA1(mockNamespace, fmt.Appendf(nil, "%s|%d", subject, now.Unix())).String()
+	}
+
+	myClaims := accessTokenClaims{
 		Claims: claims,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(now),
-			Issuer:    "account-management",
-			ID:        uuid.NewString(),
+			Issuer:    issuer,
+			ID:        tokenID,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, myClaims)
-
-	signedToken, err := token.SignedString([]byte(c.jwtSecretKey))
+	signedToken, err := c.signToken(myClaims, accessTokenType)
 	if err != nil {
 		return "", time.Time{}, fmt.Errorf("error signing token: %w", err)
 	}
 
+	if c.encryptionKey != nil {
+		signedToken, err = c.encryptToken(signedToken)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
 	return signedToken, expiresAt, nil
 }
 
+// ParseAccessToken decrypts the token if encryption is configured, validates its signature,
+// type, expiry, and issuer and returns its claims. Any validation failure wraps ErrInvalidAccessToken.
+func (c *Client) ParseAccessToken(tokenString string) (*Claims, error) {
+	claims, err := c.parseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return &claims.Claims, nil
+}
+
+// AccessToken is a validated access token's claims along with its registered claims
+type AccessToken struct {
+	Claims
+	ID        string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// InspectAccessToken validates the token like ParseAccessToken, but also returns its ID and
+// when it was issued and expires
+func (c *Client) InspectAccessToken(tokenString string) (*AccessToken, error) {
+	claims, err := c.parseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &AccessToken{
+		Claims:    claims.Claims,
+		ID:        claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if claims.IssuedAt != nil {
+		token.IssuedAt = claims.IssuedAt.Time
+	}
+	return token, nil
+}
+
+func (c *Client) parseAccessToken(tokenString string) (*accessTokenClaims, error) {
+	if c.encryptionKey != nil {
+		var err error
+		tokenString, err = c.decryptToken(tokenString)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var claims accessTokenClaims
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		// the other tokens signed with the same key and issuer have types of their own
+		if token.Header["typ"] != accessTokenType {
+			return nil, fmt.Errorf("%v tokens aren't access tokens", token.Header["typ"])
+		}
+		return c.verificationKey(token)
+	},
+		jwt.WithValidMethods(c.validMethods()),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAccessToken, err)
+	}
+
+	if claims.AccountID == "" && claims.ClientID == "" {
+		return nil, fmt.Errorf("%w: missing account_id or client_id claim", ErrInvalidAccessToken)
+	}
+
+	return &claims, nil
+}
+
 // NewRefreshToken returns a refresh token and its expiration time
 func (c *Client) NewRefreshToken() (string, time.Time) {
 	return uuid.NewString(), time.Now().Add(time.Duration(c.refreshTokenTTLMinutes) * time.Minute)
@@ -193,3 +193,163 @@ func TestClientWithDifferentTTL(t *testing.T) {
 		})
 	}
 }
+
+func TestSetAccessTokenTTL(t *testing.T) {
+	client := NewClient(Config{JWTSecretKey: "test-secret-key", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	old, _, err := client.NewAccessToken(Claims{AccountID: "test-account"})
+	require.NoError(t, err)
+
+	client.SetAccessTokenTTL(5 * time.Minute)
+	assert.Equal(t, 5*time.Minute, client.AccessTokenTTL())
+	_, expiresAt, err := client.NewAccessToken(Claims{AccountID: "test-account"})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), expiresAt, time.Second)
+
+	// tokens issued before keep their expiry
+	token, err := client.InspectAccessToken(old)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), token.ExpiresAt, time.Second)
+}
+
+func TestParseAccessToken(t *testing.T) {
+	client := NewClient(Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: 15,
+	})
+
+	validToken, _, err := client.NewAccessToken(Claims{AccountID: "test-account-id"})
+	require.NoError(t, err)
+
+	expiredToken, _, err := NewClient(Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: -1,
+	}).NewAccessToken(Claims{AccountID: "test-account-id"})
+	require.NoError(t, err)
+
+	wrongSecretToken, _, err := NewClient(Config{
+		JWTSecretKey:          "wrong-secret",
+		AccessTokenTTLMinutes: 15,
+	}).NewAccessToken(Claims{AccountID: "test-account-id"})
+	require.NoError(t, err)
+
+	wrongIssuerToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims{
+		Claims: Claims{AccountID: "test-account-id"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "someone-else",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString([]byte("test-secret-key"))
+	require.NoError(t, err)
+
+	noneAlgToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, accessTokenClaims{
+		Claims: Claims{AccountID: "test-account-id"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	noAccountToken, _, err := client.NewAccessToken(Claims{})
+	require.NoError(t, err)
+
+	// a refresh token that happens to carry every access token claim
+	refreshTyped := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims{
+		Claims: Claims{AccountID: "test-account-id"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	refreshTyped.Header["typ"] = refreshTokenType
+	refreshTypedToken, err := refreshTyped.SignedString([]byte("test-secret-key"))
+	require.NoError(t, err)
+
+	signedRefreshToken, _, err := client.NewSignedRefreshToken("test-account-id", nil, nil)
+	require.NoError(t, err)
+
+	// only access tokens are accepted, whatever types other tokens have now or later
+	untyped := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims{
+		Claims: Claims{AccountID: "test-account-id"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	delete(untyped.Header, "typ")
+	untypedToken, err := untyped.SignedString([]byte("test-secret-key"))
+	require.NoError(t, err)
+
+	mfaChallengeToken, _, err := client.NewMFAChallengeToken("test-account-id")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		token       string
+		shouldError bool
+	}{
+		{name: "valid token", token: validToken},
+		{name: "expired token", token: expiredToken, shouldError: true},
+		{name: "wrong secret", token: wrongSecretToken, shouldError: true},
+		{name: "wrong issuer", token: wrongIssuerToken, shouldError: true},
+		{name: "none algorithm", token: noneAlgToken, shouldError: true},
+		{name: "missing account id", token: noAccountToken, shouldError: true},
+		{name: "refresh token type", token: refreshTypedToken, shouldError: true},
+		{name: "signed refresh token", token: signedRefreshToken, shouldError: true},
+		{name: "MFA challenge", token: mfaChallengeToken, shouldError: true},
+		{name: "no type", token: untypedToken, shouldError: true},
+		{name: "garbage", token: "not-a-jwt", shouldError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := client.ParseAccessToken(tt.token)
+			if tt.shouldError {
+				require.ErrorIs(t, err, ErrInvalidAccessToken)
+				assert.Nil(t, claims)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "test-account-id", claims.AccountID)
+			}
+		})
+	}
+}
+
+func TestParseAccessTokenForOAuthClient(t *testing.T) {
+	client := NewClient(Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: 15,
+	})
+
+	// client credentials tokens have no account
+	token, _, err := client.NewAccessToken(Claims{ClientID: "test-client-id", Scope: "account:read sessions:write"})
+	require.NoError(t, err)
+
+	claims, err := client.ParseAccessToken(token)
+	require.NoError(t, err)
+	assert.Empty(t, claims.AccountID)
+	assert.Equal(t, "test-client-id", claims.ClientID)
+	assert.True(t, claims.HasScope("account:read"))
+	assert.True(t, claims.HasScope("sessions:write"))
+	assert.False(t, claims.HasScope("account"))
+}
+
+func TestInspectAccessToken(t *testing.T) {
+	client := NewClient(Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: 15,
+	})
+
+	token, expiresAt, err := client.NewAccessToken(Claims{AccountID: "test-account-id"})
+	require.NoError(t, err)
+
+	inspected, err := client.InspectAccessToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "test-account-id", inspected.AccountID)
+	assert.NotEmpty(t, inspected.ID)
+	assert.WithinDuration(t, time.Now(), inspected.IssuedAt, 2*time.Second)
+	assert.Equal(t, expiresAt.Unix(), inspected.ExpiresAt.Unix())
+
+	_, err = client.InspectAccessToken("not-a-token")
+	require.ErrorIs(t, err, ErrInvalidAccessToken)
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrNoSigningKeys = errors.New("tokens are signed with the shared secret, not signing keys")
+
+// ErrSigningKeys is rotating the shared secret when tokens are signed with signing keys
+var ErrSigningKeys = errors.New("tokens are signed with signing keys, not the shared secret")
+
+// KeyRing is the key new tokens are signed with and every key tokens are still verified with.
+// Rotating it swaps the keys without a restart. A key that's rotated out keeps verifying the
+// tokens it signed until they expire, so nobody is logged out.
+type KeyRing struct {
+	mu      sync.RWMutex
+	current *SigningKey
+	// keys are every key tokens are verified with by ID, including current
+	keys map[string]*SigningKey
+	// retired are the keys that were rotated out and when they stop verifying tokens
+	retired map[string]time.Time
+
+	timeNow func() time.Time
+}
+
+// NewKeyRing returns a key ring where the first key signs new tokens and the rest only verify
+func NewKeyRing(keys []*SigningKey) (*KeyRing, error) {
+	r := &KeyRing{
+		retired: map[string]time.Time{},
+		timeNow: time.Now,
+	}
+	if err := r.Rotate(keys, 0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Rotate replaces the keys, the first signs new tokens from now on. Keys that aren't in keys
+// anymore keep verifying tokens for retireAfter, which should be at least as long as tokens
+// last.
+func (r *KeyRing) Rotate(keys []*SigningKey, retireAfter time.Duration) error {
+	if len(keys) == 0 || !keys[0].CanSign() {
+		return errors.New("error rotating signing keys: the first key has to be a private key")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.timeNow()
+	next := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		next[key.id] = key
+		// a retired key that's configured again is back for good
+		delete(r.retired, key.id)
+	}
+
+	for id, key := range r.keys {
+		if _, ok := next[id]; ok {
+			continue
+		}
+		retiredUntil, ok := r.retired[id]
+		if !ok {
+			retiredUntil = now.Add(retireAfter)
+			r.retired[id] = retiredUntil
+		}
+		if !now.Before(retiredUntil) {
+			delete(r.retired, id)
+			continue
+		}
+		next[id] = key
+	}
+
+	r.current = keys[0]
+	r.keys = next
+	return nil
+}
+
+// SigningKeyID is the ID of the key new tokens are signed with
+func (r *KeyRing) SigningKeyID() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current.id
+}
+
+// KeyIDs are the IDs of every key tokens are verified with, sorted
+func (r *KeyRing) KeyIDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.timeNow()
+	var ids []string
+	for id := range r.keys {
+		if r.usable(id, now) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (r *KeyRing) signingKey() *SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// key returns the key with the ID, unless it's unknown or retired long enough ago that every
+// token it signed has expired
+func (r *KeyRing) key(id string) (*SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[id]
+	if !ok || !r.usable(id, r.timeNow()) {
+		return nil, false
+	}
+	return key, true
+}
+
+// usable has to be called with the lock held
+func (r *KeyRing) usable(id string, now time.Time) bool {
+	retiredUntil, retired := r.retired[id]
+	return !retired || now.Before(retiredUntil)
+}
+
+// signToken signs the claims with the current signing key, or the shared secret without one. typ
+// is the "typ" header, if any.
+func (c *Client) signToken(claims jwt.Claims, typ string) (string, error) {
+	if c.keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		if typ != "" {
+			token.Header["typ"] = typ
+		}
+		return token.SignedString([]byte(c.secretKey()))
+	}
+
+	key := c.keys.signingKey()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(key.private)
+}
+
+// validMethods are the algorithms tokens can be signed with
+func (c *Client) validMethods() []string {
+	if c.keys == nil {
+		return []string{jwt.SigningMethodHS256.Alg()}
+	}
+	return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+// verificationKey is the key to check a token's signature with, the one its kid names
+func (c *Client) verificationKey(token *jwt.Token) (any, error) {
+	if c.keys == nil {
+		return c.secretKeys(), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := c.keys.key(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	// a key only verifies its own algorithm
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("signing key %q doesn't sign with %s", kid, token.Method.Alg())
+	}
+	return key.publicKey, nil
+}
+
+// JWKS is the JSON Web Key Set (RFC 7517) of the public keys tokens are verified with, for
+// other services to verify them too. It's empty when tokens are signed with the shared secret.
+func (c *Client) JWKS() jose.JSONWebKeySet {
+	set := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	if c.keys == nil {
+		return set
+	}
+
+	for _, id := range c.keys.KeyIDs() {
+		key, ok := c.keys.key(id)
+		if !ok {
+			continue
+		}
+		set.Keys = append(set.Keys, jose.JSONWebKey{
+			Key:       key.publicKey,
+			KeyID:     key.id,
+			Algorithm: key.method.Alg(),
+			Use:       "sig",
+		})
+	}
+	return set
+}
+
+// RotateSigningKeys replaces the signing keys, see KeyRing.Rotate. Keys rotated out keep
+// verifying tokens until every token they could have signed has expired.
+func (c *Client) RotateSigningKeys(keys []*SigningKey) error {
+	if c.keys == nil {
+		return ErrNoSigningKeys
+	}
+	return c.keys.Rotate(keys, c.longestTokenTTL())
+}
+
+// RotateSecretKey replaces the shared secret tokens are signed with. The previous secret keeps
+// verifying tokens until every token it could have signed has expired. It fails with
+// ErrSigningKeys when tokens are signed with signing keys instead.
+func (c *Client) RotateSecretKey(secret string) error {
+	if c.keys != nil {
+		return ErrSigningKeys
+	}
+
+	c.secretMu.Lock()
+	defer c.secretMu.Unlock()
+	if secret == c.jwtSecretKey {
+		return nil
+	}
+	c.previousSecretKey = c.jwtSecretKey
+	c.previousSecretUntil = time.Now().Add(c.longestTokenTTL())
+	c.jwtSecretKey = secret
+	return nil
+}
+
+func (c *Client) secretKey() string {
+	c.secretMu.RLock()
+	defer c.secretMu.RUnlock()
+	return c.jwtSecretKey
+}
+
+// secretKeys are the current secret and, until its tokens have expired, the one it replaced
+func (c *Client) secretKeys() jwt.VerificationKeySet {
+	c.secretMu.RLock()
+	defer c.secretMu.RUnlock()
+	set := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{[]byte(c.jwtSecretKey)}}
+	if c.previousSecretKey != "" && time.Now().Before(c.previousSecretUntil) {
+		set.Keys = append(set.Keys, []byte(c.previousSecretKey))
+	}
+	return set
+}
+
+// SigningKeys is the key ring tokens are signed with, nil when they're signed with the shared
+// secret
+func (c *Client) SigningKeys() *KeyRing {
+	return c.keys
+}
+
+func (c *Client) longestTokenTTL() time.Duration {
+	return max(
+		c.AccessTokenTTL(),
+		c.RefreshTokenTTL(),
+		MFAChallengeTTL,
+	)
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRingRotation(t *testing.T) {
+	newKey := func(t *testing.T) *SigningKey {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		key, err := NewSigningKey(private)
+		require.NoError(t, err)
+		return key
+	}
+
+	oldKey, newerKey := newKey(t), newKey(t)
+
+	ring, err := NewKeyRing([]*SigningKey{oldKey})
+	require.NoError(t, err)
+	now := time.Now()
+	ring.timeNow = func() time.Time { return now }
+
+	client := NewClient(Config{AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60, SigningKeys: ring})
+	oldToken, _, err := client.NewAccessToken(Claims{AccountID: "account-id"})
+	require.NoError(t, err)
+
+	// publishing the next key first lets verifiers pick it up before any token uses it
+	require.NoError(t, client.RotateSigningKeys([]*SigningKey{oldKey, newerKey}))
+	assert.Equal(t, oldKey.ID(), ring.SigningKeyID())
+	assert.Len(t, client.JWKS().Keys, 2)
+
+	require.NoError(t, client.RotateSigningKeys([]*SigningKey{newerKey}))
+	assert.Equal(t, newerKey.ID(), ring.SigningKeyID())
+
+	newToken, _, err := client.NewAccessToken(Claims{AccountID: "account-id"})
+	require.NoError(t, err)
+	_, err = client.ParseAccessToken(newToken)
+	require.NoError(t, err)
+
+	// the old key isn't configured anymore but still verifies the tokens it signed
+	_, err = client.ParseAccessToken(oldToken)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{newerKey.ID(), oldKey.ID()}, ring.KeyIDs())
+
+	// rotating again doesn't extend the retirement
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, client.RotateSigningKeys([]*SigningKey{newerKey}))
+	_, err = client.ParseAccessToken(oldToken)
+	require.NoError(t, err)
+
+	// once every token it could have signed has expired the old key is dropped
+	now = now.Add(31 * time.Minute)
+	assert.Equal(t, []string{newerKey.ID()}, ring.KeyIDs())
+	assert.Len(t, client.JWKS().Keys, 1)
+
+	t.Run("the signing key has to be private", func(t *testing.T) {
+		public, err := NewVerificationKey(newerKey.publicKey)
+		require.NoError(t, err)
+
+		err = client.RotateSigningKeys([]*SigningKey{public, newerKey})
+		require.Error(t, err)
+		_, err = NewKeyRing(nil)
+		require.Error(t, err)
+	})
+
+	t.Run("there's nothing to rotate with the shared secret", func(t *testing.T) {
+		hmacClient := NewClient(Config{JWTSecretKey: "test-secret"})
+		require.ErrorIs(t, hmacClient.RotateSigningKeys([]*SigningKey{newerKey}), ErrNoSigningKeys)
+	})
+}
+
+func TestSecretKeyRotation(t *testing.T) {
+	client := NewClient(Config{JWTSecretKey: "old-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	oldToken, _, err := client.NewAccessToken(Claims{AccountID: "account-id"})
+	require.NoError(t, err)
+
+	require.NoError(t, client.RotateSecretKey("new-secret"))
+	newToken, _, err := client.NewAccessToken(Claims{AccountID: "account-id"})
+	require.NoError(t, err)
+	_, err = client.ParseAccessToken(newToken)
+	require.NoError(t, err)
+	// tokens signed with the old secret keep working until they've expired
+	_, err = client.ParseAccessToken(oldToken)
+	require.NoError(t, err)
+
+	// re-reading the same secret doesn't retire the previous one again
+	require.NoError(t, client.RotateSecretKey("new-secret"))
+	_, err = client.ParseAccessToken(oldToken)
+	require.NoError(t, err)
+
+	client.previousSecretUntil = time.Now().Add(-time.Second)
+	_, err = client.ParseAccessToken(oldToken)
+	require.Error(t, err)
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := NewSigningKey(private)
+	require.NoError(t, err)
+	ring, err := NewKeyRing([]*SigningKey{key})
+	require.NoError(t, err)
+	keyClient := NewClient(Config{SigningKeys: ring})
+	require.ErrorIs(t, keyClient.RotateSecretKey("new-secret"), ErrSigningKeys)
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted for signing, per NIST SP 800-131A
+const minRSAKeyBits = 2048
+
+// generatedRSAKeyBits is the size of RSA keys GenerateSigningKey makes, good past 2030 per NIST
+// SP 800-57
+const generatedRSAKeyBits = 3072
+
+// Signing key algorithms GenerateSigningKey makes keys for
+const (
+	SigningKeyEd25519 = "ed25519"
+	SigningKeyRSA     = "rsa"
+)
+
+// ParseSigningKeys parses PEM encoded keys for signing tokens: RSA (PKCS #1 or #8) or Ed25519
+// (PKCS #8) private keys, or PKIX public keys that only verify. The first key signs new tokens,
+// so it has to be a private key. The rest verify tokens, to publish a key before it's used or
+// keep accepting tokens signed by a key that was rotated out.
+func ParseSigningKeys(pemBytes []byte) ([]*SigningKey, error) {
+	var keys []*SigningKey
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+		key, err := parseSigningKeyBlock(block)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing signing key %d: %w", len(keys)+1, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("error parsing signing keys: no PEM block found")
+	}
+	if !keys[0].CanSign() {
+		return nil, errors.New("error parsing signing keys: the first key has to be a private key")
+	}
+	return keys, nil
+}
+
+// GenerateSigningKey returns a new private key for signing tokens, PEM encoded as PKCS #8 the
+// way ParseSigningKeys reads it
+func GenerateSigningKey(algorithm string) ([]byte, error) {
+	var key crypto.Signer
+	var err error
+	switch algorithm {
+	case SigningKeyEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case SigningKeyRSA:
+		key, err = rsa.GenerateKey(rand.Reader, generatedRSAKeyBits)
+	default:
+		return nil, fmt.Errorf("unsupported signing key algorithm %q, expected %s or %s", algorithm, SigningKeyEd25519, SigningKeyRSA)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error generating signing key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding signing key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func parseSigningKeyBlock(block *pem.Block) (*SigningKey, error) {
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits, got %d", minRSAKeyBits, key.N.BitLen())
+		}
+		return NewSigningKey(key)
+	case ed25519.PrivateKey:
+		return NewSigningKey(key)
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return NewVerificationKey(key)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, expected RSA or Ed25519", key)
+	}
+}
+
+// SigningKey is an asymmetric key for signing tokens, so other services can verify them with
+// the public key alone. RSA keys sign with RS256 and Ed25519 keys with EdDSA. Keys made from a
+// public key only verify.
+type SigningKey struct {
+	// id is the "kid" header of tokens signed with the key, the key's RFC 7638 thumbprint
+	id        string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	publicKey crypto.PublicKey
+}
+
+func NewSigningKey(signer crypto.Signer) (*SigningKey, error) {
+	key, err := NewVerificationKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.private = signer
+	return key, nil
+}
+
+// NewVerificationKey returns a key that verifies tokens signed with the private half of
+// publicKey, but can't sign any
+func NewVerificationKey(publicKey crypto.PublicKey) (*SigningKey, error) {
+	var method jwt.SigningMethod
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T, expected RSA or Ed25519", publicKey)
+	}
+
+	thumbprint, err := (&jose.JSONWebKey{Key: publicKey}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("error computing signing key ID: %w", err)
+	}
+
+	return &SigningKey{
+		id:        base64.RawURLEncoding.EncodeToString(thumbprint),
+		method:    method,
+		publicKey: publicKey,
+	}, nil
+}
+
+// ID is the "kid" header of tokens signed with the key
+func (k *SigningKey) ID() string {
+	return k.id
+}
+
+// CanSign is whether the key has a private key
+func (k *SigningKey) CanSign() bool {
+	return k.private != nil
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodePKCS8(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// newTestKeyRing returns a key ring where the first key signs
+func newTestKeyRing(t *testing.T, signers ...crypto.Signer) *KeyRing {
+	t.Helper()
+	var keys []*SigningKey
+	for _, signer := range signers {
+		key, err := NewSigningKey(signer)
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+	ring, err := NewKeyRing(keys)
+	require.NoError(t, err)
+	return ring
+}
+
+func TestParseSigningKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		alg     string
+		wantErr string
+	}{
+		{
+			name: "RSA PKCS #8",
+			pem:  encodePKCS8(t, rsaKey),
+			alg:  "RS256",
+		},
+		{
+			name: "RSA PKCS #1",
+			pem:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			alg:  "RS256",
+		},
+		{
+			name: "Ed25519",
+			pem:  encodePKCS8(t, edKey),
+			alg:  "EdDSA",
+		},
+		{
+			name:    "not PEM",
+			pem:     []byte("not a key"),
+			wantErr: "no PEM block",
+		},
+		{
+			name:    "small RSA key",
+			pem:     encodePKCS8(t, smallRSAKey),
+			wantErr: "at least 2048 bits",
+		},
+		{
+			name:    "ECDSA key",
+			pem:     encodePKCS8(t, ecKey),
+			wantErr: "unsupported key type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseSigningKeys(tt.pem)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, keys, 1)
+			assert.Equal(t, tt.alg, keys[0].method.Alg())
+			assert.NotEmpty(t, keys[0].ID())
+			assert.True(t, keys[0].CanSign())
+		})
+	}
+
+	t.Run("keys after the first only verify", func(t *testing.T) {
+		publicDER, err := x509.MarshalPKIXPublicKey(rsaKey.Public())
+		require.NoError(t, err)
+		publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+		keys, err := ParseSigningKeys(append(encodePKCS8(t, edKey), publicPEM...))
+		require.NoError(t, err)
+		require.Len(t, keys, 2)
+		assert.Equal(t, "EdDSA", keys[0].method.Alg())
+		assert.Equal(t, "RS256", keys[1].method.Alg())
+		assert.False(t, keys[1].CanSign())
+
+		// the same key has the same ID whether it's private or public
+		private, err := NewSigningKey(rsaKey)
+		require.NoError(t, err)
+		assert.Equal(t, private.ID(), keys[1].ID())
+
+		_, err = ParseSigningKeys(publicPEM)
+		require.ErrorContains(t, err, "has to be a private key")
+	})
+}
+
+func TestGenerateSigningKey(t *testing.T) {
+	for algorithm, alg := range map[string]string{SigningKeyEd25519: "EdDSA", SigningKeyRSA: "RS256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			keyPEM, err := GenerateSigningKey(algorithm)
+			require.NoError(t, err)
+			keys, err := ParseSigningKeys(keyPEM)
+			require.NoError(t, err)
+			require.Len(t, keys, 1)
+			assert.Equal(t, alg, keys[0].method.Alg())
+			assert.True(t, keys[0].CanSign())
+		})
+	}
+
+	_, err := GenerateSigningKey("ecdsa")
+	assert.ErrorContains(t, err, "unsupported signing key algorithm")
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for name, signer := range map[string]crypto.Signer{"RS256": rsaKey, "EdDSA": edKey} {
+		t.Run(name, func(t *testing.T) {
+			client := NewClient(Config{AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60, SigningKeys: newTestKeyRing(t, signer)})
+
+			accessToken, _, err := client.NewAccessToken(Claims{AccountID: "account-id"})
+			require.NoError(t, err)
+
+			// the token names its key and verifies with the public key from the JWKS
+			var set jose.JSONWebKeySet
+			b, err := json.Marshal(client.JWKS())
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(b, &set))
+			require.Len(t, set.Keys, 1)
+			assert.Equal(t, name, set.Keys[0].Algorithm)
+			assert.Equal(t, "sig", set.Keys[0].Use)
+			assert.True(t, set.Keys[0].IsPublic())
+
+			token, err := jwt.Parse(accessToken, func(token *jwt.Token) (any, error) {
+				keys := set.Key(token.Header["kid"].(string))
+				require.Len(t, keys, 1)
+				return keys[0].Key, nil
+			}, jwt.WithValidMethods([]string{name}))
+			require.NoError(t, err)
+			assert.True(t, token.Valid)
+
+			claims, err := client.ParseAccessToken(accessToken)
+			require.NoError(t, err)
+			assert.Equal(t, "account-id", claims.AccountID)
+
+			refreshToken, _, err := client.NewSignedRefreshToken("account-id", nil, nil)
+			require.NoError(t, err)
+			_, err = client.ParseSignedRefreshToken(refreshToken)
+			require.NoError(t, err)
+
+			challenge, _, err := client.NewMFAChallengeToken("account-id")
+			require.NoError(t, err)
+			_, err = client.ParseMFAChallengeToken(challenge)
+			require.NoError(t, err)
+
+			// tokens signed with the shared secret aren't accepted once there's a signing key
+			hmacClient := NewClient(Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+			hmacToken, _, err := hmacClient.NewAccessToken(Claims{AccountID: "account-id"})
+			require.NoError(t, err)
+			_, err = client.ParseAccessToken(hmacToken)
+			require.ErrorIs(t, err, ErrInvalidAccessToken)
+		})
+	}
+
+	t.Run("other keys aren't accepted", func(t *testing.T) {
+		otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		client := NewClient(Config{AccessTokenTTLMinutes: 15, SigningKeys: newTestKeyRing(t, rsaKey)})
+		otherClient := NewClient(Config{AccessTokenTTLMinutes: 15, SigningKeys: newTestKeyRing(t, otherRSAKey)})
+
+		token, _, err := otherClient.NewAccessToken(Claims{AccountID: "account-id"})
+		require.NoError(t, err)
+		_, err = client.ParseAccessToken(token)
+		require.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("shared secret has no public keys", func(t *testing.T) {
+		client := NewClient(Config{JWTSecretKey: "test-secret"})
+		assert.Empty(t, client.JWKS().Keys)
+	})
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMagicLinkToken(t *testing.T) {
+	client := NewClient(Config{
+		JWTSecretKey:           "test-secret-key",
+		AccessTokenTTLMinutes:  15,
+		RefreshTokenTTLMinutes: 60,
+	})
+
+	token, expiresAt, err := client.NewMagicLinkToken("account-1", "user@example.com", 15*time.Minute)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), expiresAt, time.Second)
+
+	link, err := client.ParseMagicLinkToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "account-1", link.AccountID)
+	assert.Equal(t, "user@example.com", link.Email)
+	assert.NotEmpty(t, link.ID)
+	assert.WithinDuration(t, expiresAt, link.ExpiresAt, time.Second)
+
+	t.Run("magic links aren't access tokens", func(t *testing.T) {
+		_, err := client.ParseAccessToken(token)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("sso login tokens aren't magic links", func(t *testing.T) {
+		ssoToken, err := client.NewSSOLoginToken("account-1")
+		require.NoError(t, err)
+		_, err = client.ParseMagicLinkToken(ssoToken)
+		assert.ErrorIs(t, err, ErrInvalidMagicLink)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expired, _, err := client.NewMagicLinkToken("account-1", "user@example.com", -time.Minute)
+		require.NoError(t, err)
+		_, err = client.ParseMagicLinkToken(expired)
+		assert.ErrorIs(t, err, ErrInvalidMagicLink)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		other := NewClient(Config{JWTSecretKey: "other-secret"})
+		_, err := other.ParseMagicLinkToken(token)
+		assert.ErrorIs(t, err, ErrInvalidMagicLink)
+	})
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidMFAChallenge = errors.New("invalid MFA challenge")
+
+// mfaChallengeTokenType is the JWT "typ" header of MFA challenge tokens. A challenge only
+// proves the password was right, so it must never be accepted as an access token.
+const mfaChallengeTokenType = "mfa+jwt"
+
+// MFAChallengeTTL is how long a login has to complete the second factor
+const MFAChallengeTTL = 5 * time.Minute
+
+// NewMFAChallengeToken returns a short-lived token for an account that passed the password
+// check and still has to complete MFA, and its expiration time
+func (c *Client) NewMFAChallengeToken(accountID string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(MFAChallengeTTL)
+
+	signedToken, err := c.signToken(jwt.RegisteredClaims{
+		Subject:   accountID,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(now),
+		Issuer:    issuer,
+		ID:        uuid.NewString(),
+	}, mfaChallengeTokenType)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error signing MFA challenge: %w", err)
+	}
+
+	return signedToken, expiresAt, nil
+}
+
+// ParseMFAChallengeToken validates the signature, type, expiry, and issuer of an MFA challenge
+// token and returns the account it was issued to. Any validation failure wraps
+// ErrInvalidMFAChallenge.
+func (c *Client) ParseMFAChallengeToken(tokenString string) (string, error) {
+	var claims jwt.RegisteredClaims
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != mfaChallengeTokenType {
+			return nil, errors.New("not an MFA challenge")
+		}
+		return c.verificationKey(token)
+	},
+		jwt.WithValidMethods(c.validMethods()),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidMFAChallenge, err)
+	}
+
+	if claims.Subject == "" {
+		return "", fmt.Errorf("%w: missing sub claim", ErrInvalidMFAChallenge)
+	}
+
+	return claims.Subject, nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFAChallengeToken(t *testing.T) {
+	client := NewClient(Config{
+		JWTSecretKey:           "test-secret-key",
+		AccessTokenTTLMinutes:  15,
+		RefreshTokenTTLMinutes: 60,
+	})
+
+	token, expiresAt, err := client.NewMFAChallengeToken("account-1")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(MFAChallengeTTL), expiresAt, time.Second)
+
+	accountID, err := client.ParseMFAChallengeToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "account-1", accountID)
+
+	t.Run("challenges aren't access tokens", func(t *testing.T) {
+		_, err := client.ParseAccessToken(token)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("challenges aren't refresh tokens", func(t *testing.T) {
+		_, err := client.ParseSignedRefreshToken(token)
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	})
+
+	t.Run("access tokens aren't challenges", func(t *testing.T) {
+		accessToken, _, err := client.NewAccessToken(Claims{AccountID: "account-1"})
+		require.NoError(t, err)
+		_, err = client.ParseMFAChallengeToken(accessToken)
+		assert.ErrorIs(t, err, ErrInvalidMFAChallenge)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		other := NewClient(Config{JWTSecretKey: "other-secret"})
+		_, err := other.ParseMFAChallengeToken(token)
+		assert.ErrorIs(t, err, ErrInvalidMFAChallenge)
+	})
+}
@@ -0,0 +1,16 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// mockNamespace namespaces the name-based UUIDs generated in mock mode
+var mockNamespace = uuid.MustParse("6f1c1e9e-5b1a-4c55-9f0e-3f4f1e2f7a10")
+
+// MockAccountID returns a stable account ID for an email so that mock accounts
+// have the same ID every time the mock server starts.
+func MockAccountID(email string) string {
+	return uuid.NewSHA1(mockNamespace, []byte(strings.ToLower(email))).String()
+}
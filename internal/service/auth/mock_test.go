@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockAccountID(t *testing.T) {
+	id := MockAccountID("user@example.com")
+
+	_, err := uuid.Parse(id)
+	require.NoError(t, err)
+
+	assert.Equal(t, id, MockAccountID("user@example.com"))
+	assert.Equal(t, id, MockAccountID("USER@example.com"))
+	assert.NotEqual(t, id, MockAccountID("admin@example.com"))
+}
+
+func TestNewAccessTokenDeterministic(t *testing.T) {
+	client := NewClient(Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: 15,
+		Deterministic:         true,
+	})
+
+	// retry in the rare case the two calls straddle a second boundary
+	var first, second string
+	for range 3 {
+		var err error
+		first, _, err = client.NewAccessToken(Claims{AccountID: "mock-account"})
+		require.NoError(t, err)
+		second, _, err = client.NewAccessToken(Claims{AccountID: "mock-account"})
+		require.NoError(t, err)
+		if first == second {
+			break
+		}
+	}
+	assert.Equal(t, first, second)
+
+	other, _, err := client.NewAccessToken(Claims{AccountID: "other-account"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other)
+
+	token, err := jwt.Parse(first, func(token *jwt.Token) (interface{}, error) {
+		return []byte("test-secret-key"), nil
+	})
+	require.NoError(t, err)
+	exp, err := token.Claims.GetExpirationTime()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), exp.Time, 2*time.Second)
+}
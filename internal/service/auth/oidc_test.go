@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIDToken(t *testing.T) {
+	client := NewClient(Config{JWTSecretKey: "test-secret-key", AccessTokenTTLMinutes: 15})
+	authTime := time.Now().Add(-time.Hour)
+
+	token, err := client.NewIDToken(IDTokenClaims{
+		Issuer:        "https://accounts.example.com",
+		Subject:       "account-id",
+		Audience:      "client-id",
+		AuthTime:      authTime,
+		Nonce:         "n-0S6_WzA2Mj",
+		Email:         "person@example.com",
+		EmailVerified: true,
+	})
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (any, error) {
+		return []byte("test-secret-key"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://accounts.example.com", claims["iss"])
+	assert.Equal(t, "account-id", claims["sub"])
+	assert.Equal(t, []any{"client-id"}, claims["aud"])
+	assert.Equal(t, float64(authTime.Unix()), claims["auth_time"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.Equal(t, "person@example.com", claims["email"])
+	assert.Equal(t, true, claims["email_verified"])
+
+	// an ID token isn't an access token
+	_, err = client.ParseAccessToken(token)
+	require.ErrorIs(t, err, ErrInvalidAccessToken)
+
+	// without the email scope there's no email
+	token, err = client.NewIDToken(IDTokenClaims{Issuer: "https://accounts.example.com", Subject: "account-id", Audience: "client-id", AuthTime: authTime})
+	require.NoError(t, err)
+	claims = jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (any, error) {
+		return []byte("test-secret-key"), nil
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, claims, "email")
+	assert.NotContains(t, claims, "email_verified")
+	assert.NotContains(t, claims, "nonce")
+}
+
+func TestValidOAuthScopes(t *testing.T) {
+	assert.True(t, ValidOAuthScopes([]string{ScopeOpenID, ScopeEmail, ScopeAccountRead}))
+	assert.False(t, ValidOAuthScopes([]string{ScopeOpenID, "profile"}))
+	// the OpenID Connect scopes are only for OAuth clients
+	assert.False(t, ValidScopes([]string{ScopeOpenID}))
+}
@@ -1,9 +1,11 @@
 package auth
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -69,7 +71,7 @@ func TestValidatePassword(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual := validatePassword(tt.password)
+			actual := defaultPasswordPolicy.Validate(tt.password, "")
 			if tt.wantErr {
 				assert.Error(t, actual)
 				expected := "Validation Error: " + tt.errMsg
@@ -235,3 +237,86 @@ func TestIsValidEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestPasswordHasher(t *testing.T) {
+	password := "Password123!"
+
+	fast := DefaultHasherConfig()
+	fast.BcryptCost = bcrypt.MinCost
+	fast.Argon2Memory = 64
+	fast.Argon2Time = 1
+	fast.Argon2Threads = 1
+
+	bcryptHasher, err := NewPasswordHasher(fast)
+	require.NoError(t, err)
+
+	argon2Config := fast
+	argon2Config.Algorithm = HashAlgorithmArgon2id
+	argon2Hasher, err := NewPasswordHasher(argon2Config)
+	require.NoError(t, err)
+
+	bcryptHash, err := bcryptHasher.Hash(password)
+	require.NoError(t, err)
+	argon2Hash, err := argon2Hasher.Hash(password)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(argon2Hash, "$argon2id$v=19$m=64,t=1,p=1$"), argon2Hash)
+
+	t.Run("current hashes don't need a rehash", func(t *testing.T) {
+		ok, rehash := bcryptHasher.Verify(password, bcryptHash)
+		assert.True(t, ok)
+		assert.False(t, rehash)
+
+		ok, rehash = argon2Hasher.Verify(password, argon2Hash)
+		assert.True(t, ok)
+		assert.False(t, rehash)
+	})
+
+	t.Run("other algorithms are verified and need a rehash", func(t *testing.T) {
+		ok, rehash := bcryptHasher.Verify(password, argon2Hash)
+		assert.True(t, ok)
+		assert.True(t, rehash)
+
+		ok, rehash = argon2Hasher.Verify(password, bcryptHash)
+		assert.True(t, ok)
+		assert.True(t, rehash)
+	})
+
+	t.Run("outdated parameters need a rehash", func(t *testing.T) {
+		costlier := fast
+		costlier.BcryptCost = bcrypt.MinCost + 1
+		h, err := NewPasswordHasher(costlier)
+		require.NoError(t, err)
+		ok, rehash := h.Verify(password, bcryptHash)
+		assert.True(t, ok)
+		assert.True(t, rehash)
+
+		moreMemory := argon2Config
+		moreMemory.Argon2Memory = 128
+		h, err = NewPasswordHasher(moreMemory)
+		require.NoError(t, err)
+		ok, rehash = h.Verify(password, argon2Hash)
+		assert.True(t, ok)
+		assert.True(t, rehash)
+	})
+
+	t.Run("wrong passwords and hashes", func(t *testing.T) {
+		for _, hash := range []string{bcryptHash, argon2Hash, "invalid-hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$"} {
+			ok, rehash := argon2Hasher.Verify("WrongPassword123!", hash)
+			assert.False(t, ok, hash)
+			assert.False(t, rehash, hash)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		invalid := []HasherConfig{
+			{Algorithm: "md5"},
+			{Algorithm: HashAlgorithmBcrypt, BcryptCost: bcrypt.MaxCost + 1},
+			{Algorithm: HashAlgorithmArgon2id, Argon2Memory: 64, Argon2Time: 0, Argon2Threads: 1},
+			{Algorithm: HashAlgorithmArgon2id, Argon2Memory: 8, Argon2Time: 1, Argon2Threads: 2},
+		}
+		for _, cfg := range invalid {
+			_, err := NewPasswordHasher(cfg)
+			assert.Error(t, err, cfg)
+		}
+	})
+}
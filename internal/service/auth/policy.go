@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// PasswordSpecialCharacters are the characters that count as special for RequireSpecial
+const PasswordSpecialCharacters = `!@#$%^&*(),.?":{}|<>`
+
+// maxPasswordLength is the most bcrypt hashes. Argon2id has no limit, but passwords have to fit
+// in bcrypt for them to be rehashed if the algorithm is switched back.
+const maxPasswordLength = 72
+
+// PasswordPolicyConfig is the rules new passwords have to follow
+type PasswordPolicyConfig struct {
+	// MinLength and MaxLength are in bytes. MaxLength can't be more than 72.
+	MinLength int
+	MaxLength int
+	// the character classes a password needs at least one of
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSpecial   bool
+	// DisallowEmail rejects passwords containing the account's email or its local part
+	DisallowEmail bool
+	// BannedPasswords are rejected whatever their case, e.g. a list of common passwords
+	BannedPasswords []string
+}
+
+// DefaultPasswordPolicyConfig is 8 to 72 characters with every character class
+func DefaultPasswordPolicyConfig() PasswordPolicyConfig {
+	return PasswordPolicyConfig{
+		MinLength:        8,
+		MaxLength:        maxPasswordLength,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSpecial:   true,
+	}
+}
+
+// Validate reports whether passwords can follow the config
+func (c PasswordPolicyConfig) Validate() error {
+	if c.MinLength < 1 {
+		return errors.New("password min length must be positive")
+	}
+	if c.MaxLength > maxPasswordLength {
+		return fmt.Errorf("password max length can't be more than %d", maxPasswordLength)
+	}
+	if c.MinLength > c.MaxLength {
+		return errors.New("password min length can't be more than the max length")
+	}
+	return nil
+}
+
+// PasswordPolicy checks new passwords against the configured rules. A nil *PasswordPolicy uses
+// DefaultPasswordPolicyConfig.
+type PasswordPolicy struct {
+	// mu guards the rules, which Update replaces
+	mu     sync.RWMutex
+	cfg    PasswordPolicyConfig
+	banned map[string]struct{}
+}
+
+// NewPasswordPolicy returns the policy for cfg, or an error if it isn't valid
+func NewPasswordPolicy(cfg PasswordPolicyConfig) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{}
+	if err := p.Update(cfg); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+var defaultPasswordPolicy = &PasswordPolicy{cfg: DefaultPasswordPolicyConfig()}
+
+// Update replaces the policy's rules with cfg, or returns an error and keeps the current rules
+// if it isn't valid. Passwords that were already set aren't checked again.
+func (p *PasswordPolicy) Update(cfg PasswordPolicyConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	banned := make(map[string]struct{}, len(cfg.BannedPasswords))
+	for _, password := range cfg.BannedPasswords {
+		banned[strings.ToLower(password)] = struct{}{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg = cfg
+	p.banned = banned
+	return nil
+}
+
+// Config returns the policy's rules
+func (p *PasswordPolicy) Config() PasswordPolicyConfig {
+	if p == nil {
+		p = defaultPasswordPolicy
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cfg
+}
+
+// Validate checks a new password for the account with the given email, which is optional.
+// Failures are ValidationErrors.
+func (p *PasswordPolicy) Validate(password, email string) error {
+	if p == nil {
+		p = defaultPasswordPolicy
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(password) < p.cfg.MinLength {
+		return NewValidationError(fmt.Sprintf("password must be at least %d characters long", p.cfg.MinLength))
+	}
+	if len(password) > p.cfg.MaxLength {
+		return NewValidationError(fmt.Sprintf("password must be less than or equal to %d characters long", p.cfg.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case strings.ContainsRune(PasswordSpecialCharacters, r):
+			hasSpecial = true
+		}
+	}
+	if (p.cfg.RequireUppercase && !hasUpper) || (p.cfg.RequireLowercase && !hasLower) ||
+		(p.cfg.RequireDigit && !hasDigit) || (p.cfg.RequireSpecial && !hasSpecial) {
+		return NewValidationError("password must contain " + joinRequirements(p.characterClasses()))
+	}
+
+	if _, ok := p.banned[strings.ToLower(password)]; ok {
+		return NewValidationError("password is too common")
+	}
+
+	if p.cfg.DisallowEmail && email != "" {
+		lower := strings.ToLower(password)
+		localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+		// a very short local part would rule out too many passwords
+		if len(localPart) >= 3 && strings.Contains(lower, localPart) {
+			return NewValidationError("password must not contain your email address")
+		}
+	}
+
+	return nil
+}
+
+// Explain lists the policy's requirements in sentences a form can show next to the password
+// field
+func (p *PasswordPolicy) Explain() []string {
+	if p == nil {
+		p = defaultPasswordPolicy
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	requirements := []string{
+		fmt.Sprintf("Between %d and %d characters long", p.cfg.MinLength, p.cfg.MaxLength),
+	}
+	if classes := p.characterClasses(); len(classes) > 0 {
+		requirements = append(requirements, "Contains at least one "+joinRequirements(classes))
+	}
+	if len(p.banned) > 0 {
+		requirements = append(requirements, "Isn't a commonly used password")
+	}
+	if p.cfg.DisallowEmail {
+		requirements = append(requirements, "Doesn't contain your email address")
+	}
+	return requirements
+}
+
+func (p *PasswordPolicy) characterClasses() []string {
+	var classes []string
+	if p.cfg.RequireUppercase {
+		classes = append(classes, "uppercase")
+	}
+	if p.cfg.RequireLowercase {
+		classes = append(classes, "lowercase")
+	}
+	if p.cfg.RequireDigit {
+		classes = append(classes, "digit")
+	}
+	if p.cfg.RequireSpecial {
+		classes = append(classes, "special character")
+	}
+	return classes
+}
+
+// joinRequirements joins a list as "a, b, and c"
+func joinRequirements(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	case 2:
+		return items[0] + " and " + items[1]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + ", and " + items[len(items)-1]
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy, err := NewPasswordPolicy(PasswordPolicyConfig{
+		MinLength:       12,
+		MaxLength:       64,
+		RequireDigit:    true,
+		DisallowEmail:   true,
+		BannedPasswords: []string{"correcthorse1battery"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		errMsg   string
+	}{
+		{
+			name:     "valid password",
+			password: "long enough 1",
+			email:    "someone@example.com",
+		},
+		{
+			name:     "too short",
+			password: "short 1",
+			errMsg:   "password must be at least 12 characters long",
+		},
+		{
+			name:     "missing a required class",
+			password: "long enough one",
+			errMsg:   "password must contain digit",
+		},
+		{
+			name:     "banned whatever the case",
+			password: "CorrectHorse1Battery",
+			errMsg:   "password is too common",
+		},
+		{
+			name:     "contains the email",
+			password: "my name is Someone 1",
+			email:    "someone@example.com",
+			errMsg:   "password must not contain your email address",
+		},
+		{
+			name:     "short local parts are allowed",
+			password: "my name is jo 123",
+			email:    "jo@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, tt.email)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.errMsg, validationErr.Message)
+		})
+	}
+
+	assert.Equal(t, []string{
+		"Between 12 and 64 characters long",
+		"Contains at least one digit",
+		"Isn't a commonly used password",
+		"Doesn't contain your email address",
+	}, policy.Explain())
+
+	var defaultPolicy *PasswordPolicy
+	assert.Equal(t, []string{
+		"Between 8 and 72 characters long",
+		"Contains at least one uppercase, lowercase, digit, and special character",
+	}, defaultPolicy.Explain())
+}
+
+func TestPasswordPolicyConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultPasswordPolicyConfig().Validate())
+
+	invalid := []PasswordPolicyConfig{
+		{MinLength: 0, MaxLength: 72},
+		{MinLength: 8, MaxLength: 73},
+		{MinLength: 20, MaxLength: 10},
+	}
+	for _, cfg := range invalid {
+		_, err := NewPasswordPolicy(cfg)
+		assert.Error(t, err, cfg)
+	}
+}
+
+func TestPasswordPolicyUpdate(t *testing.T) {
+	policy, err := NewPasswordPolicy(DefaultPasswordPolicyConfig())
+	require.NoError(t, err)
+	require.NoError(t, policy.Validate("Sh0rt!ish", ""))
+
+	longer := DefaultPasswordPolicyConfig()
+	longer.MinLength = 12
+	longer.BannedPasswords = []string{"correct!horse1"}
+	require.NoError(t, policy.Update(longer))
+	assert.Error(t, policy.Validate("Sh0rt!ish", ""))
+	assert.Error(t, policy.Validate("Correct!Horse1", ""))
+
+	// an invalid config keeps the rules in use
+	assert.Error(t, policy.Update(PasswordPolicyConfig{MinLength: 20, MaxLength: 10}))
+	assert.Equal(t, longer, policy.Config())
+}
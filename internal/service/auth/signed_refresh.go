@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// refreshTokenType is the JWT "typ" header of signed refresh tokens. It keeps them from being
+// accepted anywhere an access token is expected and the other way around.
+const refreshTokenType = "rt+jwt"
+
+// RefreshClaims are what a signed refresh token carries. Every refresh token issued from the
+// same login shares a Family, and Generation counts the refreshes since the login.
+type RefreshClaims struct {
+	AccountID  string
+	Family     string
+	Generation int
+	// Scopes restrict the access tokens the session gets, empty doesn't restrict them
+	Scopes []string
+	// IssuedAt has millisecond precision, so it can be told apart from a revocation in the
+	// same second
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// signedRefreshTokenClaims are the full set of claims in a signed refresh token
+type signedRefreshTokenClaims struct {
+	Family     string `json:"fam"`
+	Generation int    `json:"gen"`
+	Scope      string `json:"scope,omitempty"`
+	// IssuedAtMillis is iat in milliseconds, which the standard claim is too coarse for
+	IssuedAtMillis int64 `json:"iat_ms,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// RefreshTokenTTL is how long refresh tokens are valid for
+func (c *Client) RefreshTokenTTL() time.Duration {
+	return time.Duration(c.refreshTokenTTLMinutes) * time.Minute
+}
+
+// NewSignedRefreshToken returns a self-contained refresh token that can be validated without a
+// database. A nil parent starts a new family; otherwise the token is the next generation of
+// the parent's family. scopes are the ones the session's access tokens are restricted to.
+func (c *Client) NewSignedRefreshToken(accountID string, scopes []string, parent *RefreshClaims) (string, *RefreshClaims, error) {
+	now := time.Now()
+	claims := RefreshClaims{
+		AccountID: accountID,
+		Family:    uuid.NewString(),
+		Scopes:    scopes,
+		IssuedAt:  now.Truncate(time.Millisecond),
+		// JWT timestamps have second precision
+		ExpiresAt: now.Add(c.RefreshTokenTTL()).Truncate(time.Second),
+	}
+	if parent != nil {
+		claims.Family = parent.Family
+		claims.Generation = parent.Generation + 1
+	}
+
+	signedToken, err := c.signToken(signedRefreshTokenClaims{
+		Family:         claims.Family,
+		Generation:     claims.Generation,
+		Scope:          strings.Join(scopes, " "),
+		IssuedAtMillis: claims.IssuedAt.UnixMilli(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   accountID,
+			ExpiresAt: jwt.NewNumericDate(claims.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(claims.IssuedAt),
+			Issuer:    issuer,
+			ID:        uuid.NewString(),
+		},
+	}, refreshTokenType)
+	if err != nil {
+		return "", nil, fmt.Errorf("error signing refresh token: %w", err)
+	}
+
+	return signedToken, &claims, nil
+}
+
+// ParseSignedRefreshToken validates the signature, type, expiry, and issuer of a signed refresh
+// token and returns its claims. Any validation failure wraps ErrInvalidRefreshToken. It doesn't
+// check whether the token was revoked.
+func (c *Client) ParseSignedRefreshToken(tokenString string) (*RefreshClaims, error) {
+	var claims signedRefreshTokenClaims
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != refreshTokenType {
+			return nil, errors.New("not a refresh token")
+		}
+		return c.verificationKey(token)
+	},
+		jwt.WithValidMethods(c.validMethods()),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRefreshToken, err)
+	}
+
+	if claims.Subject == "" || claims.Family == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: missing sub, fam, or iat claim", ErrInvalidRefreshToken)
+	}
+
+	result := &RefreshClaims{
+		AccountID:  claims.Subject,
+		Family:     claims.Family,
+		Generation: claims.Generation,
+		IssuedAt:   claims.IssuedAt.Time,
+		ExpiresAt:  claims.ExpiresAt.Time,
+	}
+	// tokens issued before iat_ms was added only have iat
+	if claims.IssuedAtMillis != 0 {
+		result.IssuedAt = time.UnixMilli(claims.IssuedAtMillis)
+	}
+	if claims.Scope != "" {
+		result.Scopes = strings.Fields(claims.Scope)
+	}
+	return result, nil
+}
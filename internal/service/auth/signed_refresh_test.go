@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedRefreshToken(t *testing.T) {
+	client := NewClient(Config{
+		JWTSecretKey:           "test-secret-key",
+		AccessTokenTTLMinutes:  15,
+		RefreshTokenTTLMinutes: 60,
+	})
+
+	token, claims, err := client.NewSignedRefreshToken("account-1", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, claims.Generation)
+	assert.NotEmpty(t, claims.Family)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), claims.ExpiresAt, 2*time.Second)
+
+	parsed, err := client.ParseSignedRefreshToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, claims, parsed)
+
+	t.Run("next generation keeps the family", func(t *testing.T) {
+		next, nextClaims, err := client.NewSignedRefreshToken("account-1", nil, parsed)
+		require.NoError(t, err)
+		assert.Equal(t, claims.Family, nextClaims.Family)
+		assert.Equal(t, 1, nextClaims.Generation)
+
+		parsed, err := client.ParseSignedRefreshToken(next)
+		require.NoError(t, err)
+		assert.Equal(t, 1, parsed.Generation)
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		scoped, _, err := client.NewSignedRefreshToken("account-1", []string{ScopeAccountRead, ScopeSessionsWrite}, nil)
+		require.NoError(t, err)
+
+		parsed, err := client.ParseSignedRefreshToken(scoped)
+		require.NoError(t, err)
+		assert.Equal(t, []string{ScopeAccountRead, ScopeSessionsWrite}, parsed.Scopes)
+	})
+
+	t.Run("access tokens aren't refresh tokens", func(t *testing.T) {
+		accessToken, _, err := client.NewAccessToken(Claims{AccountID: "account-1"})
+		require.NoError(t, err)
+
+		_, err = client.ParseSignedRefreshToken(accessToken)
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+		_, err = client.ParseAccessToken(token)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		other := NewClient(Config{JWTSecretKey: "other-key", RefreshTokenTTLMinutes: 60})
+		_, err := other.ParseSignedRefreshToken(token)
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expiring := NewClient(Config{JWTSecretKey: "test-secret-key", RefreshTokenTTLMinutes: -1})
+		expired, _, err := expiring.NewSignedRefreshToken("account-1", nil, nil)
+		require.NoError(t, err)
+
+		_, err = client.ParseSignedRefreshToken(expired)
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		_, err := client.ParseSignedRefreshToken("6f1c1e9e-5b1a-4c55-9f0e-3f4f1e2f7a10")
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	})
+}
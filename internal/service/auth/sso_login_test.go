@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSOLoginToken(t *testing.T) {
+	client := NewClient(Config{
+		JWTSecretKey:           "test-secret-key",
+		AccessTokenTTLMinutes:  15,
+		RefreshTokenTTLMinutes: 60,
+	})
+
+	token, err := client.NewSSOLoginToken("account-1")
+	require.NoError(t, err)
+
+	login, err := client.ParseSSOLoginToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "account-1", login.AccountID)
+	assert.NotEmpty(t, login.ID)
+	assert.WithinDuration(t, time.Now().Add(SSOLoginTTL), login.ExpiresAt, time.Second)
+
+	t.Run("sso login tokens aren't access tokens", func(t *testing.T) {
+		_, err := client.ParseAccessToken(token)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("mfa challenges aren't sso login tokens", func(t *testing.T) {
+		challenge, _, err := client.NewMFAChallengeToken("account-1")
+		require.NoError(t, err)
+		_, err = client.ParseSSOLoginToken(challenge)
+		assert.ErrorIs(t, err, ErrInvalidSSOLogin)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		other := NewClient(Config{JWTSecretKey: "other-secret"})
+		_, err := other.ParseSSOLoginToken(token)
+		assert.ErrorIs(t, err, ErrInvalidSSOLogin)
+	})
+}
@@ -0,0 +1,78 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+
+		resp := verifyResponse{}
+		switch {
+		case r.PostForm.Get("secret") != "test-secret":
+			resp.ErrorCodes = []string{"invalid-input-secret"}
+		case r.PostForm.Get("response") == "solved" && r.PostForm.Get("remoteip") == "203.0.113.7":
+			resp.Success = true
+		default:
+			resp.ErrorCodes = []string{"invalid-input-response"}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name          string
+		secret        string
+		token         string
+		expectedError error
+		anyError      bool
+	}{
+		{
+			name:   "solved",
+			secret: "test-secret",
+			token:  "solved",
+		},
+		{
+			name:          "not solved",
+			secret:        "test-secret",
+			token:         "not-solved",
+			expectedError: ErrInvalidResponse,
+		},
+		{
+			name:          "empty token",
+			secret:        "test-secret",
+			expectedError: ErrInvalidResponse,
+		},
+		{
+			name:     "wrong secret isn't the client's fault",
+			secret:   "wrong-secret",
+			token:    "solved",
+			anyError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(Config{Secret: tt.secret, VerifyURL: server.URL})
+
+			err := client.Verify(context.Background(), tt.token, "203.0.113.7")
+			switch {
+			case tt.expectedError != nil:
+				assert.ErrorIs(t, err, tt.expectedError)
+			case tt.anyError:
+				require.Error(t, err)
+				assert.NotErrorIs(t, err, ErrInvalidResponse)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Package degraded detects primary database outages so the service can keep serving what it
+// can without the database (token verification, reads) instead of failing every request.
+package degraded
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Interval is how often the database is checked
+	Interval time.Duration
+	// Timeout bounds each check. Defaults to Interval.
+	Timeout time.Duration
+	// FailureThreshold is how many checks in a row have to fail before the service is
+	// degraded, so a single slow ping doesn't flip it. One successful check recovers.
+	FailureThreshold int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval:         5 * time.Second,
+		FailureThreshold: 3,
+	}
+}
+
+// Monitor tracks whether the primary database is reachable. It's safe for concurrent use.
+type Monitor struct {
+	check func(ctx context.Context) error
+	cfg   Config
+
+	mu            sync.RWMutex
+	failures      int
+	degradedSince time.Time
+}
+
+// NewMonitor returns a monitor that runs check, usually the database's HealthCheck
+func NewMonitor(check func(ctx context.Context) error, cfg Config) *Monitor {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = cfg.Interval
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+	return &Monitor{check: check, cfg: cfg}
+}
+
+// Run checks the database every interval until ctx is done
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+		err := m.check(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		m.Observe(ctx, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Observe records the result of a database check
+func (m *Monitor) Observe(ctx context.Context, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		if !m.degradedSince.IsZero() {
+			slog.InfoContext(ctx, "primary database is back, leaving degraded mode",
+				"degraded_for", time.Since(m.degradedSince).String())
+		}
+		m.failures = 0
+		m.degradedSince = time.Time{}
+		return
+	}
+
+	m.failures++
+	if m.failures >= m.cfg.FailureThreshold && m.degradedSince.IsZero() {
+		m.degradedSince = time.Now()
+		slog.ErrorContext(ctx, "primary database is unavailable, entering degraded mode",
+			"failed_checks", m.failures, "error", err)
+	}
+}
+
+// Degraded reports whether the primary database is considered down, and since when
+func (m *Monitor) Degraded() (bool, time.Time) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return !m.degradedSince.IsZero(), m.degradedSince
+}
+
+// RetryAfter is a reasonable time for clients to wait before retrying a rejected write
+func (m *Monitor) RetryAfter() time.Duration {
+	return m.cfg.Interval * time.Duration(m.cfg.FailureThreshold)
+}
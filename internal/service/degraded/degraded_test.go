@@ -0,0 +1,81 @@
+package degraded
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorObserve(t *testing.T) {
+	ctx := context.Background()
+	m := NewMonitor(nil, Config{Interval: time.Second, FailureThreshold: 3})
+
+	outage := errors.New("connection refused")
+
+	// a couple of failed checks aren't an outage yet
+	m.Observe(ctx, outage)
+	m.Observe(ctx, outage)
+	degraded, _ := m.Degraded()
+	assert.False(t, degraded)
+
+	// nor is a blip that recovers
+	m.Observe(ctx, nil)
+	m.Observe(ctx, outage)
+	m.Observe(ctx, outage)
+	degraded, _ = m.Degraded()
+	assert.False(t, degraded)
+
+	m.Observe(ctx, outage)
+	degraded, since := m.Degraded()
+	assert.True(t, degraded)
+	assert.WithinDuration(t, time.Now(), since, time.Second)
+
+	// further failures keep the original start
+	m.Observe(ctx, outage)
+	_, stillSince := m.Degraded()
+	assert.Equal(t, since, stillSince)
+
+	m.Observe(ctx, nil)
+	degraded, since = m.Degraded()
+	assert.False(t, degraded)
+	assert.True(t, since.IsZero())
+}
+
+func TestMonitorRun(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+
+	m := NewMonitor(func(ctx context.Context) error {
+		if down.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, Config{Interval: 5 * time.Millisecond, FailureThreshold: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	require.Eventually(t, func() bool {
+		degraded, _ := m.Degraded()
+		return degraded
+	}, time.Second, time.Millisecond)
+
+	down.Store(false)
+	require.Eventually(t, func() bool {
+		degraded, _ := m.Degraded()
+		return !degraded
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,142 @@
+// Package erasure carries out the deletion requests accounts make. An account that asked to be
+// erased is reminded a while before its grace period is over, then anonymized for good. Logging
+// in before then cancels the request, so it's never picked up here.
+package erasure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+)
+
+// Store is what the worker needs from the database
+type Store interface {
+	ListDueDeletionRequests(ctx context.Context, eraseBefore time.Time, limit int) ([]database.DeletionRequest, error)
+	ListDeletionRemindersDue(ctx context.Context, eraseBefore time.Time, limit int) ([]database.DeletionRequest, error)
+	MarkDeletionReminderSent(ctx context.Context, accountID string, at time.Time) error
+	GetAccountByID(ctx context.Context, id string) (*database.Account, error)
+	EraseAccount(ctx context.Context, id string) error
+}
+
+type Config struct {
+	// ReminderBefore is how long before an account is erased it's emailed a reminder. 0 sends
+	// no reminders.
+	ReminderBefore time.Duration
+	// Interval is how often due requests are carried out
+	Interval time.Duration
+	// BatchSize is how many accounts are erased, and reminded, at a time
+	BatchSize int
+	// AppURL is the base URL of the web app, reminders link to its login page
+	AppURL string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ReminderBefore: 7 * 24 * time.Hour,
+		Interval:       time.Hour,
+		BatchSize:      100,
+	}
+}
+
+// Worker erases accounts whose deletion requests are due, and reminds the ones that soon will be
+type Worker struct {
+	store    Store
+	mail     mailer.Sender
+	auditLog audit.Recorder
+	cfg      Config
+	timeNow  func() time.Time
+}
+
+func NewWorker(store Store, mail mailer.Sender, auditLog audit.Recorder, cfg Config) *Worker {
+	return &Worker{store: store, mail: mail, auditLog: auditLog, cfg: cfg, timeNow: time.Now}
+}
+
+// Run carries out due deletion requests every interval until ctx is done
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		// a failed sweep is retried on the next tick
+		if _, err := w.Sweep(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "error carrying out deletion requests", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep erases the accounts whose grace period is over, then reminds the ones that end within
+// ReminderBefore. It returns how many accounts were erased.
+func (w *Worker) Sweep(ctx context.Context) (int, error) {
+	now := w.timeNow()
+
+	due, err := w.store.ListDueDeletionRequests(ctx, now, w.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	erased := 0
+	for _, request := range due {
+		if err := w.store.EraseAccount(ctx, request.AccountID); err != nil {
+			// cancelled by a login since it was listed
+			if errors.Is(err, database.ErrDeletionRequestNotFound) {
+				continue
+			}
+			slog.ErrorContext(ctx, "error erasing account", "account_id", request.AccountID, "error", err)
+			continue
+		}
+		erased++
+		w.auditLog.Record(ctx, database.CreateAuditEventParams{
+			AccountID: request.AccountID,
+			EventType: database.AuditEventAccountErased,
+		})
+	}
+	if erased > 0 {
+		slog.InfoContext(ctx, "erased accounts", "count", erased)
+	}
+
+	if w.cfg.ReminderBefore <= 0 {
+		return erased, nil
+	}
+	reminders, err := w.store.ListDeletionRemindersDue(ctx, now.Add(w.cfg.ReminderBefore), w.cfg.BatchSize)
+	if err != nil {
+		return erased, err
+	}
+	for _, request := range reminders {
+		if err := w.remind(ctx, request); err != nil {
+			slog.ErrorContext(ctx, "error sending deletion reminder", "account_id", request.AccountID, "error", err)
+			continue
+		}
+		if err := w.store.MarkDeletionReminderSent(ctx, request.AccountID, now); err != nil {
+			return erased, err
+		}
+	}
+	return erased, nil
+}
+
+// remind emails the account that it's about to be erased. An account deleted since it asked to
+// be erased isn't reminded, there's no way for it to log in and cancel.
+func (w *Worker) remind(ctx context.Context, request database.DeletionRequest) error {
+	account, err := w.store.GetAccountByID(ctx, request.AccountID)
+	if errors.Is(err, database.ErrAccountNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return mailer.SendTemplate(ctx, w.mail, mailer.TemplateDeletionReminder, account.Email, mailer.Data{
+		"EraseAt": request.EraseAt.UTC().Format("2 Jan 2006"),
+		"Link":    strings.TrimRight(w.cfg.AppURL, "/") + "/login",
+	})
+}
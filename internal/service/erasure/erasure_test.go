@@ -0,0 +1,81 @@
+package erasure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingMailer struct {
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	mail := &recordingMailer{}
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "erase@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	kept, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "keep@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	_, err = db.CreateDeletionRequest(ctx, account.ID, time.Now().Add(10*24*time.Hour))
+	require.NoError(t, err)
+
+	w := NewWorker(db, mail, audit.Sync(db.CreateAuditEvent), Config{
+		ReminderBefore: 7 * 24 * time.Hour,
+		Interval:       time.Hour,
+		BatchSize:      10,
+		AppURL:         "https://app.example.com/",
+	})
+
+	// too early for anything
+	erased, err := w.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, erased)
+	assert.Empty(t, mail.sent)
+
+	// a week before, the account is reminded once
+	w.timeNow = func() time.Time { return time.Now().Add(4 * 24 * time.Hour) }
+	for range 2 {
+		erased, err = w.Sweep(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, erased)
+	}
+	require.Len(t, mail.sent, 1)
+	assert.Equal(t, "erase@test.com", mail.sent[0].To)
+	assert.Contains(t, mail.sent[0].Body, "https://app.example.com/login")
+
+	// then it's erased
+	w.timeNow = func() time.Time { return time.Now().Add(11 * 24 * time.Hour) }
+	erased, err = w.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, erased)
+
+	_, err = db.GetAccountByID(ctx, account.ID)
+	require.ErrorIs(t, err, database.ErrAccountNotFound)
+	_, err = db.GetAccountByID(ctx, kept.ID)
+	require.NoError(t, err)
+	events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{
+		AccountID: account.ID,
+		EventType: database.AuditEventAccountErased,
+		Keyset:    database.Keyset{Limit: 10},
+	})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	erased, err = w.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, erased)
+}
@@ -0,0 +1,69 @@
+// Package featureflags resolves per-account feature flags. Each account can override the
+// deployment-wide defaults, and a configured subset of flags is copied into access tokens so
+// downstream services can gate features without calling back.
+package featureflags
+
+import (
+	"maps"
+	"regexp"
+)
+
+// MaxFlagsPerAccount caps how many overrides a single account can have. The flags are stored on
+// the account row and some are copied into every access token, so they need to stay small.
+const MaxFlagsPerAccount = 50
+
+// flag names share the tag format so they're safe in URLs and JWT claims
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// ValidName reports whether name can be used as a flag name
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+type Config struct {
+	// Defaults apply to accounts that don't override the flag. Flags missing from both are off.
+	Defaults map[string]bool
+	// TokenFlags are the flags included in access tokens
+	TokenFlags []string
+}
+
+type Evaluator struct {
+	defaults   map[string]bool
+	tokenFlags []string
+}
+
+func NewEvaluator(cfg Config) *Evaluator {
+	return &Evaluator{
+		defaults:   maps.Clone(cfg.Defaults),
+		tokenFlags: cfg.TokenFlags,
+	}
+}
+
+// Evaluate returns every flag that's set for the account: the defaults with the account's
+// overrides applied on top
+func (e *Evaluator) Evaluate(overrides map[string]bool) map[string]bool {
+	result := make(map[string]bool, len(e.defaults)+len(overrides))
+	maps.Copy(result, e.defaults)
+	maps.Copy(result, overrides)
+	return result
+}
+
+// TokenClaim returns the evaluated value of each token flag, or nil if no flags are configured
+// for tokens
+func (e *Evaluator) TokenClaim(overrides map[string]bool) map[string]bool {
+	if len(e.tokenFlags) == 0 {
+		return nil
+	}
+
+	evaluated := e.Evaluate(overrides)
+	result := make(map[string]bool, len(e.tokenFlags))
+	for _, name := range e.tokenFlags {
+		result[name] = evaluated[name]
+	}
+	return result
+}
+
+// HasTokenFlags reports whether any flags go into access tokens
+func (e *Evaluator) HasTokenFlags() bool {
+	return len(e.tokenFlags) > 0
+}
@@ -0,0 +1,57 @@
+package featureflags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluator(t *testing.T) {
+	e := NewEvaluator(Config{
+		Defaults:   map[string]bool{"new-dashboard": true, "beta-search": false},
+		TokenFlags: []string{"new-dashboard", "exports"},
+	})
+
+	tests := []struct {
+		name          string
+		overrides     map[string]bool
+		expected      map[string]bool
+		expectedClaim map[string]bool
+	}{
+		{
+			name:          "defaults only",
+			overrides:     nil,
+			expected:      map[string]bool{"new-dashboard": true, "beta-search": false},
+			expectedClaim: map[string]bool{"new-dashboard": true, "exports": false},
+		},
+		{
+			name:          "overrides win over defaults",
+			overrides:     map[string]bool{"new-dashboard": false, "exports": true},
+			expected:      map[string]bool{"new-dashboard": false, "beta-search": false, "exports": true},
+			expectedClaim: map[string]bool{"new-dashboard": false, "exports": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, e.Evaluate(tt.overrides))
+			assert.Equal(t, tt.expectedClaim, e.TokenClaim(tt.overrides))
+		})
+	}
+}
+
+func TestEvaluatorWithoutTokenFlags(t *testing.T) {
+	e := NewEvaluator(Config{Defaults: map[string]bool{"new-dashboard": true}})
+
+	assert.False(t, e.HasTokenFlags())
+	assert.Nil(t, e.TokenClaim(map[string]bool{"new-dashboard": false}))
+	assert.Equal(t, map[string]bool{}, NewEvaluator(Config{}).Evaluate(nil))
+}
+
+func TestValidName(t *testing.T) {
+	assert.True(t, ValidName("new-dashboard"))
+	assert.True(t, ValidName("beta_search2"))
+	assert.False(t, ValidName(""))
+	assert.False(t, ValidName("New Dashboard"))
+	assert.False(t, ValidName("-leading-dash"))
+}
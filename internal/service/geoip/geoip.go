@@ -0,0 +1,188 @@
+// Package geoip looks up the country of IP addresses in a MaxMind DB file, such as GeoLite2
+// Country or GeoIP2 City. Only what country lookups need of the format is implemented:
+// https://maxmind.github.io/MaxMind-DB/
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+)
+
+// metadataStart marks the start of the metadata at the end of the file
+var metadataStart = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the 16 zero bytes between the search tree and the data section
+const dataSectionSeparator = 16
+
+var (
+	// ErrInvalidDatabase is a file that isn't a MaxMind DB, or is one this package can't read
+	ErrInvalidDatabase = errors.New("invalid MaxMind DB")
+	// ErrNotFound is an address the database has no country for, like a private one
+	ErrNotFound = errors.New("country not found")
+)
+
+// Reader looks up countries in a MaxMind DB loaded into memory. It's safe for concurrent use.
+type Reader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// treeSize is the size of the search tree, the data section starts after it and the separator
+	treeSize uint
+	// ipv4Start is the node IPv4 addresses start from in an IPv6 tree, ::/96
+	ipv4Start uint
+}
+
+// Open reads the database at path
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading MaxMind DB: %w", err)
+	}
+	return New(buf)
+}
+
+// New reads a database from the contents of its file
+func New(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataStart)
+	if start < 0 {
+		return nil, fmt.Errorf("%w: no metadata", ErrInvalidDatabase)
+	}
+	start += len(metadataStart)
+
+	d := decoder{buf: buf[start:]}
+	value, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDatabase, err)
+	}
+	metadata, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata isn't a map", ErrInvalidDatabase)
+	}
+
+	r := &Reader{buf: buf}
+	for key, field := range map[string]*uint{
+		"node_count":  &r.nodeCount,
+		"record_size": &r.recordSize,
+		"ip_version":  &r.ipVersion,
+	} {
+		v, ok := metadata[key].(uint64)
+		if !ok {
+			return nil, fmt.Errorf("%w: metadata has no %s", ErrInvalidDatabase, key)
+		}
+		*field = uint(v)
+	}
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", ErrInvalidDatabase, r.ipVersion)
+	}
+
+	r.treeSize = r.nodeCount * r.recordSize / 4
+	if r.treeSize+dataSectionSeparator > uint(len(buf)) {
+		return nil, fmt.Errorf("%w: search tree is larger than the file", ErrInvalidDatabase)
+	}
+
+	if r.ipVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country addr is in, e.g. "US". It fails
+// with ErrNotFound.
+func (r *Reader) Country(addr netip.Addr) (string, error) {
+	record, err := r.lookup(addr.Unmap())
+	if err != nil {
+		return "", err
+	}
+
+	// registered_country is where the network is registered, which is all some addresses have
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := record[key].(map[string]any)
+		if code, ok := country["iso_code"].(string); ok && code != "" {
+			return code, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// lookup returns the data record for addr
+func (r *Reader) lookup(addr netip.Addr) (map[string]any, error) {
+	if !addr.IsValid() {
+		return nil, ErrNotFound
+	}
+
+	var ip []byte
+	node := uint(0)
+	switch {
+	case addr.Is4() && r.ipVersion == 6:
+		b := addr.As4()
+		ip = b[:]
+		node = r.ipv4Start
+	case addr.Is4():
+		b := addr.As4()
+		ip = b[:]
+	case r.ipVersion == 4:
+		// an IPv4 database has no IPv6 addresses
+		return nil, ErrNotFound
+	default:
+		b := addr.As16()
+		ip = b[:]
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+
+	if node == r.nodeCount {
+		return nil, ErrNotFound
+	}
+	if node < r.nodeCount {
+		return nil, fmt.Errorf("%w: search tree is deeper than the address", ErrInvalidDatabase)
+	}
+
+	// records point past the search tree and separator into the data section
+	offset := node - r.nodeCount - dataSectionSeparator
+	d := decoder{buf: r.buf[r.treeSize+dataSectionSeparator:]}
+	value, _, err := d.decode(offset)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDatabase, err)
+	}
+	record, ok := value.(map[string]any)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node
+func (r *Reader) record(node, bit uint) uint {
+	nodeSize := r.recordSize / 4
+	b := r.buf[node*nodeSize : (node+1)*nodeSize]
+
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		// the middle byte holds the high nibble of both records
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
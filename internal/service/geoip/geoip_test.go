@@ -0,0 +1,203 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDB builds MaxMind DBs with the networks given to insert
+type testDB struct {
+	ipVersion  int
+	recordSize int
+	// nodes are pairs of records: a child node, a data offset, or -1 for nothing
+	nodes [][2]record
+	data  []byte
+}
+
+type record struct {
+	node, data int
+}
+
+var empty = record{node: -1, data: -1}
+
+func newTestDB(ipVersion, recordSize int) *testDB {
+	return &testDB{ipVersion: ipVersion, recordSize: recordSize, nodes: [][2]record{{empty, empty}}}
+}
+
+// insert points prefix at value, which is encoded in the data section
+func (db *testDB) insert(t *testing.T, prefix string, value []byte) {
+	p := netip.MustParsePrefix(prefix)
+	ip := p.Addr().AsSlice()
+	bits := p.Bits()
+	if db.ipVersion == 6 && p.Addr().Is4() {
+		// IPv4 addresses are ::a.b.c.d in IPv6 databases
+		ip = append(make([]byte, 12), ip...)
+		bits += 96
+	}
+
+	offset := len(db.data)
+	db.data = append(db.data, value...)
+
+	node := 0
+	for i := range bits {
+		bit := ip[i/8] >> (7 - i%8) & 1
+		if i == bits-1 {
+			db.nodes[node][bit] = record{node: -1, data: offset}
+			return
+		}
+		next := db.nodes[node][bit].node
+		if next < 0 {
+			next = len(db.nodes)
+			db.nodes = append(db.nodes, [2]record{empty, empty})
+			db.nodes[node][bit] = record{node: next, data: -1}
+		}
+		node = next
+	}
+}
+
+func (db *testDB) bytes() []byte {
+	var buf bytes.Buffer
+	nodeCount := len(db.nodes)
+	value := func(r record) uint32 {
+		switch {
+		case r.node >= 0:
+			return uint32(r.node)
+		case r.data >= 0:
+			return uint32(nodeCount + dataSectionSeparator + r.data)
+		default:
+			return uint32(nodeCount)
+		}
+	}
+
+	for _, n := range db.nodes {
+		left, right := value(n[0]), value(n[1])
+		switch db.recordSize {
+		case 24:
+			buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(left>>20)&0xf0 | byte(right>>24)&0x0f, byte(right >> 16), byte(right >> 8), byte(right)})
+		default:
+			buf.Write(binary.BigEndian.AppendUint32(nil, left))
+			buf.Write(binary.BigEndian.AppendUint32(nil, right))
+		}
+	}
+
+	buf.Write(make([]byte, dataSectionSeparator))
+	buf.Write(db.data)
+	buf.Write(metadataStart)
+	buf.Write(encodeMap(
+		"node_count", encodeUint(typeUint32, uint64(nodeCount)),
+		"record_size", encodeUint(typeUint16, uint64(db.recordSize)),
+		"ip_version", encodeUint(typeUint16, uint64(db.ipVersion)),
+		"database_type", encodeString("Test-Country"),
+	))
+	return buf.Bytes()
+}
+
+func control(typ int, size int) []byte {
+	if typ >= 8 {
+		return []byte{byte(size), byte(typ - 7)}
+	}
+	return []byte{byte(typ<<5 | size)}
+}
+
+func encodeString(s string) []byte {
+	return append(control(typeString, len(s)), s...)
+}
+
+func encodeUint(typ int, v uint64) []byte {
+	b := bytes.TrimLeft(binary.BigEndian.AppendUint64(nil, v), "\x00")
+	return append(control(typ, len(b)), b...)
+}
+
+func encodePointer(offset int) []byte {
+	return []byte{byte(typePointer<<5 | offset>>8), byte(offset)}
+}
+
+// encodeMap encodes alternating keys and encoded values
+func encodeMap(pairs ...any) []byte {
+	b := control(typeMap, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		b = append(b, encodeString(pairs[i].(string))...)
+		b = append(b, pairs[i+1].([]byte)...)
+	}
+	return b
+}
+
+func country(key, code string) []byte {
+	return encodeMap(key, encodeMap("iso_code", encodeString(code), "geoname_id", encodeUint(typeUint32, 2635167)))
+}
+
+func TestCountry(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		db := newTestDB(6, recordSize)
+		db.insert(t, "81.2.69.0/24", country("country", "GB"))
+		db.insert(t, "2001:db8::/32", country("registered_country", "DE"))
+		// a record shared through a pointer to the first one
+		db.insert(t, "198.51.100.0/24", encodePointer(0))
+
+		r, err := New(db.bytes())
+		require.NoError(t, err, recordSize)
+
+		tests := map[string]string{
+			"81.2.69.142":        "GB",
+			"::ffff:81.2.69.142": "GB",
+			"2001:db8:1::1":      "DE",
+			"198.51.100.7":       "GB",
+			"10.0.0.1":           "",
+			"2001:db9::1":        "",
+		}
+		for addr, expected := range tests {
+			code, err := r.Country(netip.MustParseAddr(addr))
+			if expected == "" {
+				assert.ErrorIs(t, err, ErrNotFound, addr)
+				continue
+			}
+			require.NoError(t, err, addr)
+			assert.Equal(t, expected, code, addr)
+		}
+	}
+}
+
+func TestIPv4Database(t *testing.T) {
+	db := newTestDB(4, 28)
+	db.insert(t, "203.0.113.0/24", country("country", "AU"))
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	require.NoError(t, os.WriteFile(path, db.bytes(), 0o600))
+	r, err := Open(path)
+	require.NoError(t, err)
+
+	code, err := r.Country(netip.MustParseAddr("203.0.113.9"))
+	require.NoError(t, err)
+	assert.Equal(t, "AU", code)
+
+	_, err = r.Country(netip.MustParseAddr("2001:db8::1"))
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestInvalidDatabase(t *testing.T) {
+	_, err := New([]byte("not a database"))
+	assert.ErrorIs(t, err, ErrInvalidDatabase)
+
+	db := newTestDB(6, 20)
+	_, err = New(db.bytes())
+	assert.ErrorIs(t, err, ErrInvalidDatabase)
+
+	// metadata claiming more nodes than there are
+	b := append(make([]byte, 32), metadataStart...)
+	b = append(b, encodeMap(
+		"node_count", encodeUint(typeUint32, 1000),
+		"record_size", encodeUint(typeUint16, 24),
+		"ip_version", encodeUint(typeUint16, 6),
+	)...)
+	_, err = New(b)
+	assert.ErrorIs(t, err, ErrInvalidDatabase)
+}
@@ -0,0 +1,92 @@
+// Package hibp checks passwords against the Have I Been Pwned Pwned Passwords range API. Only the
+// first five characters of the password's SHA-1 hash are sent (k-anonymity), and responses are
+// padded so their size doesn't give away the prefix either.
+package hibp
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRangeURL = "https://api.pwnedpasswords.com/range/"
+	DefaultTimeout  = 2 * time.Second
+)
+
+type Config struct {
+	// RangeURL is the range endpoint the hash prefix is appended to
+	RangeURL string
+	// Timeout bounds each check so a slow API doesn't hold up registrations
+	Timeout time.Duration
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Client checks passwords against known breaches
+type Client struct {
+	cfg Config
+}
+
+func NewClient(cfg Config) *Client {
+	if cfg.RangeURL == "" {
+		cfg.RangeURL = DefaultRangeURL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+
+	return &Client{cfg: cfg}
+}
+
+// Breached reports whether the password appears in a known data breach. An error means the API
+// couldn't be asked, and says nothing about the password.
+func (c *Client) Breached(ctx context.Context, password string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.RangeURL+prefix, nil)
+	if err != nil {
+		return false, fmt.Errorf("error creating range request: %w", err)
+	}
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("error calling range endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("error from range endpoint: status %d", resp.StatusCode)
+	}
+
+	// each line is a hash suffix and how often it was seen, "SUFFIX:COUNT"
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lineSuffix, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		// padding lines have a count of 0
+		n, err := strconv.Atoi(count)
+		return err == nil && n > 0, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("error reading range response: %w", err)
+	}
+	return false, nil
+}
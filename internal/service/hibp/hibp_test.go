@@ -0,0 +1,61 @@
+package hibp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreached(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8, "Test123!@#" isn't listed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.Header.Get("Add-Padding"))
+		switch r.URL.Path {
+		case "/range/5BAA6":
+			fmt.Fprint(w, "003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n")
+		default:
+			// padding for a hash that's only there to make responses the same size
+			fmt.Fprint(w, "0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n")
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient(Config{RangeURL: server.URL + "/range/"})
+
+	breached, err := client.Breached(context.Background(), "password")
+	require.NoError(t, err)
+	assert.True(t, breached)
+
+	breached, err = client.Breached(context.Background(), "Test123!@#")
+	require.NoError(t, err)
+	assert.False(t, breached)
+}
+
+func TestBreachedErrors(t *testing.T) {
+	t.Run("error status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(server.Close)
+
+		_, err := NewClient(Config{RangeURL: server.URL + "/"}).Breached(context.Background(), "password")
+		assert.Error(t, err)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		t.Cleanup(server.Close)
+
+		client := NewClient(Config{RangeURL: server.URL + "/", Timeout: 10 * time.Millisecond})
+		_, err := client.Breached(context.Background(), "password")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,105 @@
+package hmacauth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	keys := map[string][]byte{"billing": []byte("billing-secret")}
+	now := time.Now()
+
+	newSigned := func(t *testing.T) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/internal/accounts/lookup?x=1", strings.NewReader(`{"ids":[]}`))
+		require.NoError(t, Sign(req, "billing", keys["billing"], now))
+		return req
+	}
+
+	tests := []struct {
+		name        string
+		tamper      func(req *http.Request)
+		verifyAt    time.Time
+		expectedErr error
+	}{
+		{
+			name:     "valid",
+			verifyAt: now,
+		},
+		{
+			name:     "within skew",
+			verifyAt: now.Add(4 * time.Minute),
+		},
+		{
+			name:        "too old",
+			verifyAt:    now.Add(6 * time.Minute),
+			expectedErr: ErrStaleTimestamp,
+		},
+		{
+			name:        "from the future",
+			verifyAt:    now.Add(-6 * time.Minute),
+			expectedErr: ErrStaleTimestamp,
+		},
+		{
+			name:        "missing headers",
+			tamper:      func(req *http.Request) { req.Header.Del(HeaderSignature) },
+			verifyAt:    now,
+			expectedErr: ErrMissingHeaders,
+		},
+		{
+			name:        "unknown key",
+			tamper:      func(req *http.Request) { req.Header.Set(HeaderKeyID, "someone") },
+			verifyAt:    now,
+			expectedErr: ErrUnknownKey,
+		},
+		{
+			name:        "body changed",
+			tamper:      func(req *http.Request) { req.Body = io.NopCloser(strings.NewReader(`{"ids":["x"]}`)) },
+			verifyAt:    now,
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name:        "query changed",
+			tamper:      func(req *http.Request) { req.URL.RawQuery = "x=2" },
+			verifyAt:    now,
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name: "timestamp changed",
+			tamper: func(req *http.Request) {
+				req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix()+1, 10))
+			},
+			verifyAt:    now,
+			expectedErr: ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newSigned(t)
+			if tt.tamper != nil {
+				tt.tamper(req)
+			}
+
+			keyID, err := Verify(req, keys, tt.verifyAt, 5*time.Minute)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "billing", keyID)
+
+			// the body is still readable after verification
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, `{"ids":[]}`, string(body))
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Package idempotency keeps the responses to requests sent with an Idempotency-Key, so a client
+// retrying one after a dropped connection gets the original response instead of registering
+// twice or rotating its tokens again.
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// PendingTTL is how long a key stays claimed by a request that's still being handled. It
+// outlasts any request, and frees the key if the replica handling it went away.
+const PendingTTL = time.Minute
+
+// Record is what's kept for a key: the request it was first used with and, once that request
+// was handled, its response
+type Record struct {
+	// RequestHash identifies the request, retries have to send the same one
+	RequestHash string `json:"request_hash"`
+	// Done is false while the first request is still being handled
+	Done   bool        `json:"done"`
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Store keeps the records. Implementations must be safe for concurrent use, and the Redis
+// implementation must be used when running more than one replica so a retry landing on another
+// replica is still recognized.
+type Store interface {
+	// Claim saves record for key if the key has none and returns nil. Otherwise it returns the
+	// key's record and leaves it as it is.
+	Claim(ctx context.Context, key string, record Record, ttl time.Duration) (*Record, error)
+	// Save replaces key's record, keeping it for ttl
+	Save(ctx context.Context, key string, record Record, ttl time.Duration) error
+	// Release forgets key, so the request it was used with can be tried again
+	Release(ctx context.Context, key string) error
+}
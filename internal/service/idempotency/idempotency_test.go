@@ -0,0 +1,73 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+
+	stores := map[string]func(t *testing.T) (Store, func(time.Duration)){
+		"memory": func(t *testing.T) (Store, func(time.Duration)) {
+			store := NewMemoryStore()
+			now := time.Now()
+			store.timeNow = func() time.Time { return now }
+			return store, func(d time.Duration) { now = now.Add(d) }
+		},
+		"redis": func(t *testing.T) (Store, func(time.Duration)) {
+			mr := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { _ = client.Close() })
+			return NewRedisStore(client), mr.FastForward
+		},
+	}
+
+	for name, setup := range stores {
+		t.Run(name, func(t *testing.T) {
+			store, advance := setup(t)
+
+			existing, err := store.Claim(ctx, "key", Record{RequestHash: "hash"}, PendingTTL)
+			require.NoError(t, err)
+			assert.Nil(t, existing)
+
+			// claimed, but not done yet
+			existing, err = store.Claim(ctx, "key", Record{RequestHash: "other"}, PendingTTL)
+			require.NoError(t, err)
+			require.NotNil(t, existing)
+			assert.Equal(t, Record{RequestHash: "hash"}, *existing)
+
+			done := Record{
+				RequestHash: "hash",
+				Done:        true,
+				Status:      http.StatusCreated,
+				Header:      http.Header{"Content-Type": {"application/json"}},
+				Body:        []byte(`{"id":"1"}`),
+			}
+			require.NoError(t, store.Save(ctx, "key", done, time.Hour))
+			existing, err = store.Claim(ctx, "key", Record{RequestHash: "hash"}, PendingTTL)
+			require.NoError(t, err)
+			require.NotNil(t, existing)
+			assert.Equal(t, done, *existing)
+
+			// forgotten after the window
+			advance(time.Hour + time.Second)
+			existing, err = store.Claim(ctx, "key", Record{RequestHash: "hash"}, PendingTTL)
+			require.NoError(t, err)
+			assert.Nil(t, existing)
+
+			// and once released
+			require.NoError(t, store.Release(ctx, "key"))
+			existing, err = store.Claim(ctx, "key", Record{RequestHash: "hash"}, PendingTTL)
+			require.NoError(t, err)
+			assert.Nil(t, existing)
+		})
+	}
+}
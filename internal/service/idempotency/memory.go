@@ -0,0 +1,68 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many claims go by between dropping expired records
+const sweepEvery = 1024
+
+// MemoryStore is a Store for a single instance. Records aren't shared between replicas.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+	claims  int
+	timeNow func() time.Time
+}
+
+type memoryRecord struct {
+	record    Record
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: map[string]memoryRecord{},
+		timeNow: time.Now,
+	}
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, key string, record Record, ttl time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timeNow()
+
+	s.claims++
+	if s.claims%sweepEvery == 0 {
+		for k, other := range s.records {
+			if !now.Before(other.expiresAt) {
+				delete(s.records, k)
+			}
+		}
+	}
+
+	if existing, ok := s.records[key]; ok && now.Before(existing.expiresAt) {
+		return &existing.record, nil
+	}
+	s.records[key] = memoryRecord{record: record, expiresAt: now.Add(ttl)}
+	return nil, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, key string, record Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = memoryRecord{record: record, expiresAt: s.timeNow().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
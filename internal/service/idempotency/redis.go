@@ -0,0 +1,71 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore is a Store shared by every replica pointed at the same Redis
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client, prefix: "idempotency:"}
+}
+
+func (s *RedisStore) Claim(ctx context.Context, key string, record Record, ttl time.Duration) (*Record, error) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding idempotency record: %w", err)
+	}
+
+	// the record can expire between the two calls, then it's claimed on the next try
+	for range 3 {
+		claimed, err := s.client.SetNX(ctx, s.prefix+key, value, ttl).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error claiming idempotency key: %w", err)
+		}
+		if claimed {
+			return nil, nil
+		}
+
+		existing, err := s.client.Get(ctx, s.prefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting idempotency record: %w", err)
+		}
+		var result Record
+		if err := json.Unmarshal(existing, &result); err != nil {
+			return nil, fmt.Errorf("error decoding idempotency record: %w", err)
+		}
+		return &result, nil
+	}
+	return nil, errors.New("error claiming idempotency key: it keeps expiring")
+}
+
+func (s *RedisStore) Save(ctx context.Context, key string, record Record, ttl time.Duration) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding idempotency record: %w", err)
+	}
+	if err := s.client.Set(ctx, s.prefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("error saving idempotency record: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, s.prefix+key).Err(); err != nil {
+		return fmt.Errorf("error releasing idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Package ipfilter decides which client IPs are let in, by CIDR range and by the country the
+// address is in.
+package ipfilter
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// CountryLookup returns the ISO 3166-1 alpha-2 code of the country an address is in.
+// geoip.Reader implements it.
+type CountryLookup interface {
+	Country(addr netip.Addr) (string, error)
+}
+
+// ErrNoCountryLookup is a config with country rules and no CountryLookup to apply them with
+var ErrNoCountryLookup = errors.New("country rules need a country lookup")
+
+type Config struct {
+	// Allow and AllowCountries, when either is set, are the only addresses let in. An address
+	// in either is allowed.
+	Allow          []netip.Prefix
+	AllowCountries []string
+	// Deny and DenyCountries are never let in, even when they're allowed
+	Deny          []netip.Prefix
+	DenyCountries []string
+	// Countries looks up the country of addresses for the country rules
+	Countries CountryLookup
+}
+
+// Filter checks client IPs against a Config
+type Filter struct {
+	cfg Config
+}
+
+// New returns a filter for cfg. Country codes are matched in any case. It fails with
+// ErrNoCountryLookup.
+func New(cfg Config) (*Filter, error) {
+	if (len(cfg.AllowCountries) > 0 || len(cfg.DenyCountries) > 0) && cfg.Countries == nil {
+		return nil, ErrNoCountryLookup
+	}
+
+	cfg.AllowCountries = upper(cfg.AllowCountries)
+	cfg.DenyCountries = upper(cfg.DenyCountries)
+	return &Filter{cfg: cfg}, nil
+}
+
+// Allowed reports whether addr is let in. Addresses without a known country, like private
+// ones, aren't held to the country rules so health checks and internal callers get through.
+func (f *Filter) Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	country := ""
+	if len(f.cfg.AllowCountries) > 0 || len(f.cfg.DenyCountries) > 0 {
+		// a lookup error is an address the database doesn't know
+		country, _ = f.cfg.Countries.Country(addr)
+	}
+
+	if contains(f.cfg.Deny, addr) || (country != "" && slices.Contains(f.cfg.DenyCountries, country)) {
+		return false
+	}
+
+	if len(f.cfg.Allow) == 0 && len(f.cfg.AllowCountries) == 0 {
+		return true
+	}
+	if contains(f.cfg.Allow, addr) {
+		return true
+	}
+	if len(f.cfg.AllowCountries) > 0 && (country == "" || slices.Contains(f.cfg.AllowCountries, country)) {
+		return true
+	}
+	return false
+}
+
+// ParsePrefixes parses CIDR ranges like 203.0.113.0/24 or 2001:db8::/32. Single addresses are
+// ranges of one.
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address %q: %w", value, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q: %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func upper(codes []string) []string {
+	out := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			out = append(out, code)
+		}
+	}
+	return out
+}
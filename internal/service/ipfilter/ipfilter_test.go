@@ -0,0 +1,117 @@
+package ipfilter
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/service/geoip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCountries map[string]string
+
+func (c fakeCountries) Country(addr netip.Addr) (string, error) {
+	code, ok := c[addr.String()]
+	if !ok {
+		return "", geoip.ErrNotFound
+	}
+	return code, nil
+}
+
+func TestFilter(t *testing.T) {
+	countries := fakeCountries{
+		"81.2.69.142":  "GB",
+		"203.0.113.9":  "AU",
+		"198.51.100.7": "KP",
+	}
+
+	prefixes := func(values ...string) []netip.Prefix {
+		p, err := ParsePrefixes(values)
+		require.NoError(t, err)
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		allowed map[string]bool
+	}{
+		{
+			name: "no rules",
+			allowed: map[string]bool{
+				"81.2.69.142": true,
+				"2001:db8::1": true,
+			},
+		},
+		{
+			name: "denylist",
+			cfg:  Config{Deny: prefixes("81.2.69.0/24", "2001:db8::1")},
+			allowed: map[string]bool{
+				"81.2.69.142":        false,
+				"::ffff:81.2.69.142": false,
+				"2001:db8::1":        false,
+				"2001:db8::2":        true,
+				"203.0.113.9":        true,
+			},
+		},
+		{
+			name: "allowlist",
+			cfg:  Config{Allow: prefixes("10.0.0.0/8"), Deny: prefixes("10.0.0.13")},
+			allowed: map[string]bool{
+				"10.1.2.3":    true,
+				"10.0.0.13":   false,
+				"81.2.69.142": false,
+			},
+		},
+		{
+			name: "country denylist",
+			cfg:  Config{DenyCountries: []string{"kp"}, Countries: countries},
+			allowed: map[string]bool{
+				"198.51.100.7": false,
+				"81.2.69.142":  true,
+				"10.0.0.1":     true,
+			},
+		},
+		{
+			name: "country allowlist",
+			cfg:  Config{AllowCountries: []string{"GB"}, Allow: prefixes("203.0.113.0/24"), Countries: countries},
+			allowed: map[string]bool{
+				"81.2.69.142":  true,
+				"203.0.113.9":  true,
+				"198.51.100.7": false,
+				// unknown countries aren't held to the country rules
+				"10.0.0.1": true,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := New(tc.cfg)
+			require.NoError(t, err)
+			for addr, allowed := range tc.allowed {
+				assert.Equal(t, allowed, filter.Allowed(netip.MustParseAddr(addr)), addr)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{DenyCountries: []string{"KP"}})
+	assert.ErrorIs(t, err, ErrNoCountryLookup)
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{" 203.0.113.7/24", "2001:db8::1", ""})
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("203.0.113.0/24"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	}, prefixes)
+
+	_, err = ParsePrefixes([]string{"203.0.113.0/33"})
+	assert.Error(t, err)
+	_, err = ParsePrefixes([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package lockout
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// Store keeps failure counters and blocks. Implementations must be safe for concurrent use,
+// and the Redis implementation must be used when running more than one replica so every
+// replica sees the same counts.
+type Store interface {
+	// Increment bumps the failure count for key and returns the new count. The count expires
+	// window after the first failure.
+	Increment(ctx context.Context, key string, window time.Duration) (int64, error)
+	// Block prevents attempts for key for d.
+	Block(ctx context.Context, key string, d time.Duration) error
+	// BlockedFor returns how much longer key is blocked for, or 0.
+	BlockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Reset clears the count and any block for key.
+	Reset(ctx context.Context, key string) error
+}
+
+type Config struct {
+	// Failures are counted within this window.
+	Window time.Duration
+	// After this many failures each further failure blocks attempts for an exponentially
+	// growing delay starting at BaseDelay.
+	BackoffThreshold int
+	BaseDelay        time.Duration
+	// After this many failures attempts are blocked for LockoutDuration.
+	MaxAttempts     int
+	LockoutDuration time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Window:           15 * time.Minute,
+		BackoffThreshold: 3,
+		BaseDelay:        time.Second,
+		MaxAttempts:      10,
+		LockoutDuration:  15 * time.Minute,
+	}
+}
+
+// Guard applies progressive backoff and lockout to repeated failures (e.g. wrong passwords).
+// Store errors are logged and otherwise ignored: failing open keeps logins working if Redis is down.
+type Guard struct {
+	store Store
+	cfg   Config
+}
+
+func NewGuard(store Store, cfg Config) *Guard {
+	return &Guard{store: store, cfg: cfg}
+}
+
+// Check returns how long the caller must wait before another attempt for key, or 0 if allowed.
+func (g *Guard) Check(ctx context.Context, key string) time.Duration {
+	d, err := g.store.BlockedFor(ctx, key)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking lockout, allowing attempt", "error", err)
+		return 0
+	}
+	return d
+}
+
+// RecordFailure counts a failed attempt and blocks key if it crossed the backoff or lockout
+// thresholds. It returns how long key is now blocked for.
+func (g *Guard) RecordFailure(ctx context.Context, key string) time.Duration {
+	count, err := g.store.Increment(ctx, key, g.cfg.Window)
+	if err != nil {
+		slog.ErrorContext(ctx, "error recording failed attempt", "error", err)
+		return 0
+	}
+
+	delay := g.delay(count)
+	if delay == 0 {
+		return 0
+	}
+
+	if err := g.store.Block(ctx, key, delay); err != nil {
+		slog.ErrorContext(ctx, "error blocking attempts", "error", err)
+		return 0
+	}
+
+	return delay
+}
+
+// RecordSuccess clears the failures for key.
+func (g *Guard) RecordSuccess(ctx context.Context, key string) {
+	if err := g.store.Reset(ctx, key); err != nil {
+		slog.ErrorContext(ctx, "error resetting failed attempts", "error", err)
+	}
+}
+
+func (g *Guard) delay(count int64) time.Duration {
+	if g.cfg.MaxAttempts > 0 && count >= int64(g.cfg.MaxAttempts) {
+		return g.cfg.LockoutDuration
+	}
+	if g.cfg.BackoffThreshold <= 0 || count < int64(g.cfg.BackoffThreshold) {
+		return 0
+	}
+
+	// BaseDelay, 2*BaseDelay, 4*BaseDelay, ... capped at the lockout duration
+	exp := count - int64(g.cfg.BackoffThreshold)
+	delay := time.Duration(float64(g.cfg.BaseDelay) * math.Pow(2, float64(exp)))
+	if g.cfg.LockoutDuration > 0 && (delay > g.cfg.LockoutDuration || delay <= 0) {
+		delay = g.cfg.LockoutDuration
+	}
+	return delay
+}
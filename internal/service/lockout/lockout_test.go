@@ -0,0 +1,139 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuardDelay(t *testing.T) {
+	g := NewGuard(NewMemoryStore(), Config{
+		Window:           time.Hour,
+		BackoffThreshold: 3,
+		BaseDelay:        time.Second,
+		MaxAttempts:      6,
+		LockoutDuration:  time.Minute,
+	})
+
+	tests := []struct {
+		count    int64
+		expected time.Duration
+	}{
+		{count: 1, expected: 0},
+		{count: 2, expected: 0},
+		{count: 3, expected: time.Second},
+		{count: 4, expected: 2 * time.Second},
+		{count: 5, expected: 4 * time.Second},
+		{count: 6, expected: time.Minute},
+		{count: 100, expected: time.Minute},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, g.delay(tt.count), "count %d", tt.count)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Now()
+	store.timeNow = func() time.Time { return now }
+
+	g := NewGuard(store, Config{
+		Window:           time.Hour,
+		BackoffThreshold: 2,
+		BaseDelay:        time.Second,
+		MaxAttempts:      4,
+		LockoutDuration:  time.Minute,
+	})
+
+	assert.Zero(t, g.RecordFailure(ctx, "key"))
+	assert.Zero(t, g.Check(ctx, "key"))
+
+	assert.Equal(t, time.Second, g.RecordFailure(ctx, "key"))
+	assert.Equal(t, time.Second, g.Check(ctx, "key"))
+
+	// other keys are unaffected
+	assert.Zero(t, g.Check(ctx, "other-key"))
+
+	// once the backoff passes attempts are allowed again
+	now = now.Add(time.Second)
+	assert.Zero(t, g.Check(ctx, "key"))
+
+	assert.Equal(t, 2*time.Second, g.RecordFailure(ctx, "key"))
+	assert.Equal(t, time.Minute, g.RecordFailure(ctx, "key"))
+	assert.Equal(t, time.Minute, g.Check(ctx, "key"))
+
+	g.RecordSuccess(ctx, "key")
+	assert.Zero(t, g.Check(ctx, "key"))
+	assert.Zero(t, g.RecordFailure(ctx, "key"))
+}
+
+func TestMemoryStoreWindowExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Now()
+	store.timeNow = func() time.Time { return now }
+
+	count, _ := store.Increment(ctx, "key", time.Minute)
+	assert.Equal(t, int64(1), count)
+	count, _ = store.Increment(ctx, "key", time.Minute)
+	assert.Equal(t, int64(2), count)
+
+	now = now.Add(time.Minute)
+	count, _ = store.Increment(ctx, "key", time.Minute)
+	assert.Equal(t, int64(1), count)
+}
+
+type failingStore struct{}
+
+func (failingStore) Increment(context.Context, string, time.Duration) (int64, error) {
+	return 0, errors.New("store down")
+}
+func (failingStore) Block(context.Context, string, time.Duration) error {
+	return errors.New("store down")
+}
+func (failingStore) BlockedFor(context.Context, string) (time.Duration, error) {
+	return 0, errors.New("store down")
+}
+func (failingStore) Reset(context.Context, string) error { return errors.New("store down") }
+
+func TestMemoryStoreSweepsExpiredEntries(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Now()
+	store.timeNow = func() time.Time { return now }
+
+	// keys written once and never read again, like the HMAC replay cache's
+	for i := range sweepEvery / 2 {
+		_, _ = store.Increment(ctx, fmt.Sprintf("count-%d", i), time.Minute)
+		_ = store.Block(ctx, fmt.Sprintf("block-%d", i), time.Minute)
+	}
+	_ = store.Block(ctx, "long", time.Hour)
+	assert.Len(t, store.counts, sweepEvery/2)
+	assert.Len(t, store.blocks, sweepEvery/2+1)
+
+	now = now.Add(2 * time.Minute)
+	for range sweepEvery {
+		_, _ = store.Increment(ctx, "active", time.Minute)
+	}
+	assert.Len(t, store.counts, 1)
+	assert.Len(t, store.blocks, 1, "only the unexpired block is left")
+	blocked, _ := store.BlockedFor(ctx, "long")
+	assert.Equal(t, 58*time.Minute, blocked)
+}
+
+func TestGuardFailsOpen(t *testing.T) {
+	ctx := context.Background()
+	g := NewGuard(failingStore{}, DefaultConfig())
+
+	for i := 0; i < 20; i++ {
+		assert.Zero(t, g.RecordFailure(ctx, "key"))
+	}
+	assert.Zero(t, g.Check(ctx, "key"))
+	g.RecordSuccess(ctx, "key")
+}
@@ -0,0 +1,103 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many writes go by between dropping expired counts and blocks
+const sweepEvery = 1024
+
+// MemoryStore is a Store for a single instance. Counts aren't shared between replicas. Expired
+// entries are dropped as it's written to, keys that are never read again included.
+type MemoryStore struct {
+	mu      sync.Mutex
+	counts  map[string]memoryCount
+	blocks  map[string]time.Time
+	writes  int
+	timeNow func() time.Time
+}
+
+type memoryCount struct {
+	count     int64
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counts:  map[string]memoryCount{},
+		blocks:  map[string]time.Time{},
+		timeNow: time.Now,
+	}
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timeNow()
+	s.sweep(now)
+	c, ok := s.counts[key]
+	if !ok || !now.Before(c.expiresAt) {
+		c = memoryCount{expiresAt: now.Add(window)}
+	}
+	c.count++
+	s.counts[key] = c
+
+	return c.count, nil
+}
+
+func (s *MemoryStore) Block(ctx context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timeNow()
+	s.sweep(now)
+	s.blocks[key] = now.Add(d)
+	return nil
+}
+
+func (s *MemoryStore) BlockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.blocks[key]
+	if !ok {
+		return 0, nil
+	}
+
+	remaining := until.Sub(s.timeNow())
+	if remaining <= 0 {
+		delete(s.blocks, key)
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counts, key)
+	delete(s.blocks, key)
+	return nil
+}
+
+// sweep drops the expired entries every sweepEvery writes. s.mu has to be held.
+func (s *MemoryStore) sweep(now time.Time) {
+	s.writes++
+	if s.writes%sweepEvery != 0 {
+		return
+	}
+	for key, c := range s.counts {
+		if !now.Before(c.expiresAt) {
+			delete(s.counts, key)
+		}
+	}
+	for key, until := range s.blocks {
+		if !now.Before(until) {
+			delete(s.blocks, key)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// incrementScript increments the counter and sets its expiry on the first failure in one
+// atomic step, so concurrent failures across replicas can't leave a counter without a TTL.
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// RedisStore is a Store shared by every replica pointed at the same Redis.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client, prefix: "lockout:"}
+}
+
+func (s *RedisStore) countKey(key string) string { return s.prefix + "count:" + key }
+func (s *RedisStore) blockKey(key string) string { return s.prefix + "block:" + key }
+
+func (s *RedisStore) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	count, err := incrementScript.Run(ctx, s.client, []string{s.countKey(key)}, window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("error incrementing failure count: %w", err)
+	}
+	return count, nil
+}
+
+func (s *RedisStore) Block(ctx context.Context, key string, d time.Duration) error {
+	if err := s.client.Set(ctx, s.blockKey(key), 1, d).Err(); err != nil {
+		return fmt.Errorf("error setting block: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) BlockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, s.blockKey(key)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error getting block: %w", err)
+	}
+	// negative values mean the key doesn't exist (-2) or has no expiry (-1, never set by us)
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, s.countKey(key), s.blockKey(key)).Err(); err != nil {
+		return fmt.Errorf("error resetting failure count: %w", err)
+	}
+	return nil
+}
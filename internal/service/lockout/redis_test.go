@@ -0,0 +1,106 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return NewRedisStore(client), mr
+}
+
+func TestRedisStoreIncrement(t *testing.T) {
+	ctx := context.Background()
+	store, mr := setupRedisStore(t)
+
+	for i := int64(1); i <= 3; i++ {
+		count, err := store.Increment(ctx, "key", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, i, count)
+	}
+
+	// the window starts at the first failure and isn't extended by later ones
+	assert.Equal(t, time.Minute, mr.TTL("lockout:count:key"))
+
+	mr.FastForward(time.Minute)
+
+	count, err := store.Increment(ctx, "key", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestRedisStoreBlock(t *testing.T) {
+	ctx := context.Background()
+	store, mr := setupRedisStore(t)
+
+	d, err := store.BlockedFor(ctx, "key")
+	require.NoError(t, err)
+	assert.Zero(t, d)
+
+	require.NoError(t, store.Block(ctx, "key", 30*time.Second))
+
+	d, err = store.BlockedFor(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, d)
+
+	mr.FastForward(30 * time.Second)
+
+	d, err = store.BlockedFor(ctx, "key")
+	require.NoError(t, err)
+	assert.Zero(t, d)
+}
+
+func TestRedisStoreReset(t *testing.T) {
+	ctx := context.Background()
+	store, _ := setupRedisStore(t)
+
+	_, err := store.Increment(ctx, "key", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, store.Block(ctx, "key", time.Minute))
+
+	require.NoError(t, store.Reset(ctx, "key"))
+
+	d, err := store.BlockedFor(ctx, "key")
+	require.NoError(t, err)
+	assert.Zero(t, d)
+
+	count, err := store.Increment(ctx, "key", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestGuardSharedAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	// two guards with their own clients stand in for two replicas
+	newReplica := func() *Guard {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { _ = client.Close() })
+		return NewGuard(NewRedisStore(client), Config{
+			Window:          time.Hour,
+			MaxAttempts:     4,
+			LockoutDuration: time.Minute,
+		})
+	}
+	a, b := newReplica(), newReplica()
+
+	a.RecordFailure(ctx, "key")
+	b.RecordFailure(ctx, "key")
+	a.RecordFailure(ctx, "key")
+	assert.Equal(t, time.Minute, b.RecordFailure(ctx, "key"))
+
+	assert.Equal(t, time.Minute, a.Check(ctx, "key"))
+}
@@ -0,0 +1,58 @@
+// Package mailer sends the service's emails. Messages are rendered from the embedded templates
+// and delivered by a Sender: SMTP, SendGrid's API, or a log-only sender for development. Queue
+// sends them in the background and retries failed deliveries.
+package mailer
+
+import (
+	"context"
+	"log/slog"
+	"net/mail"
+)
+
+// Message is an outbound email.
+type Message struct {
+	To      string
+	Subject string
+	// Body is the plain text body. HTMLBody is optional and sent as an alternative to it.
+	Body     string
+	HTMLBody string
+}
+
+// Sender delivers email messages.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Checker is implemented by senders that can check their provider is reachable without sending
+// a message. Senders that aren't Checkers have nothing to check.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// LogSender "sends" email by logging it. Used for local development where we
+// don't want to hit a real mail provider.
+type LogSender struct {
+	logger *slog.Logger
+}
+
+func NewLogSender(logger *slog.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	s.logger.InfoContext(ctx, "email not sent (log only mailer)",
+		"to", msg.To,
+		"subject", msg.Subject,
+		"body", msg.Body,
+	)
+	return nil
+}
+
+// parseAddress returns the bare address of "Name <address>" or "address"
+func parseAddress(address string) (string, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Address, nil
+}
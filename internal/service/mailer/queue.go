@@ -0,0 +1,128 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type QueueConfig struct {
+	// Size is how many messages can wait to be sent. Once it's full messages are sent by the
+	// caller instead, so none are dropped when the provider falls behind.
+	Size int
+	// MaxAttempts is how many times a message is tried before it's given up on
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled after every failed attempt
+	Backoff time.Duration
+}
+
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Size:        100,
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+	}
+}
+
+type pendingMessage struct {
+	// ctx is the request's without its cancellation, so the send keeps its trace and logs keep
+	// the request ID
+	ctx context.Context
+	msg Message
+}
+
+// Queue sends messages in the background with sender, retrying failed sends, so a slow or
+// flaky provider doesn't hold up requests. Messages are only sent while Run is running.
+type Queue struct {
+	sender  Sender
+	cfg     QueueConfig
+	pending chan pendingMessage
+	// wg tracks messages that were queued but not sent or given up on yet
+	wg sync.WaitGroup
+}
+
+func NewQueue(sender Sender, cfg QueueConfig) *Queue {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+
+	return &Queue{
+		sender:  sender,
+		cfg:     cfg,
+		pending: make(chan pendingMessage, cfg.Size),
+	}
+}
+
+// Send queues the message, or sends it right away when the queue is full. Errors are only
+// returned for messages sent right away; queued messages that can't be sent are logged.
+func (q *Queue) Send(ctx context.Context, msg Message) error {
+	ctx = context.WithoutCancel(ctx)
+
+	q.wg.Add(1)
+	select {
+	case q.pending <- pendingMessage{ctx: ctx, msg: msg}:
+		return nil
+	default:
+		q.wg.Done()
+		slog.WarnContext(ctx, "mail queue is full, sending the message inline")
+		return q.sender.Send(ctx, msg)
+	}
+}
+
+// Check checks the sender the queue delivers with, when it's a Checker
+func (q *Queue) Check(ctx context.Context) error {
+	if checker, ok := q.sender.(Checker); ok {
+		return checker.Check(ctx)
+	}
+	return nil
+}
+
+// Run sends queued messages until ctx is done, then tries whatever is still queued once
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		select {
+		case p := <-q.pending:
+			q.deliver(ctx, p)
+		case <-ctx.Done():
+			for {
+				select {
+				case p := <-q.pending:
+					q.deliver(ctx, p)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Flush waits until every message queued so far is sent or given up on. Run has to be running.
+func (q *Queue) Flush() {
+	q.wg.Wait()
+}
+
+// deliver sends p, retrying with backoff until it's sent, it's out of attempts, or runCtx is
+// done
+func (q *Queue) deliver(runCtx context.Context, p pendingMessage) {
+	defer q.wg.Done()
+
+	backoff := q.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		err := q.sender.Send(p.ctx, p.msg)
+		if err == nil {
+			return
+		}
+		if attempt >= q.cfg.MaxAttempts || runCtx.Err() != nil {
+			slog.ErrorContext(p.ctx, "error sending email, giving up", "subject", p.msg.Subject, "attempts", attempt, "error", err)
+			return
+		}
+		slog.WarnContext(p.ctx, "error sending email, retrying", "subject", p.msg.Subject, "attempt", attempt, "retry_in", backoff, "error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-runCtx.Done():
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakySender fails its first `failures` sends
+type flakySender struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	sent     []Message
+}
+
+func (s *flakySender) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts++
+	if s.attempts <= s.failures {
+		return errors.New("connection refused")
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sender := &flakySender{failures: 2}
+	q := NewQueue(sender, QueueConfig{Size: 10, MaxAttempts: 3, Backoff: time.Millisecond})
+	go q.Run(ctx)
+
+	// the request's context is usually cancelled by the time the message is sent
+	reqCtx, cancelReq := context.WithCancel(ctx)
+	require.NoError(t, q.Send(reqCtx, Message{To: "someone@example.com", Subject: "retried"}))
+	cancelReq()
+	q.Flush()
+
+	assert.Equal(t, 3, sender.attempts)
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "retried", sender.sent[0].Subject)
+}
+
+func TestQueueGivesUp(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sender := &flakySender{failures: 10}
+	q := NewQueue(sender, QueueConfig{Size: 10, MaxAttempts: 2, Backoff: time.Millisecond})
+	go q.Run(ctx)
+
+	require.NoError(t, q.Send(ctx, Message{Subject: "dropped"}))
+	q.Flush()
+
+	assert.Equal(t, 2, sender.attempts)
+	assert.Empty(t, sender.sent)
+}
+
+func TestQueueFull(t *testing.T) {
+	sender := &flakySender{}
+
+	// nothing is running to drain the queue
+	q := NewQueue(sender, QueueConfig{Size: 1, MaxAttempts: 3, Backoff: time.Hour})
+	require.NoError(t, q.Send(context.Background(), Message{Subject: "queued"}))
+	require.NoError(t, q.Send(context.Background(), Message{Subject: "inline"}))
+	require.Len(t, sender.sent, 1, "messages aren't dropped when the queue is full")
+	assert.Equal(t, "inline", sender.sent[0].Subject)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.Run(ctx)
+	require.Len(t, sender.sent, 2, "queued messages are sent on shutdown")
+	assert.Equal(t, "queued", sender.sent[1].Subject)
+}
@@ -0,0 +1,124 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+)
+
+const DefaultSendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+type SendGridConfig struct {
+	APIKey string
+	// From is the sender address, e.g. "Account Management <no-reply@example.com>"
+	From string
+	// URL and HTTPClient default to SendGrid's v3 mail send endpoint and http.DefaultClient
+	URL        string
+	HTTPClient *http.Client
+}
+
+// SendGridSender delivers email with SendGrid's v3 mail send API
+type SendGridSender struct {
+	cfg SendGridConfig
+}
+
+func NewSendGridSender(cfg SendGridConfig) *SendGridSender {
+	if cfg.URL == "" {
+		cfg.URL = DefaultSendGridURL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+
+	return &SendGridSender{cfg: cfg}
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridRequest struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+func (s *SendGridSender) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("error parsing from address: %w", err)
+	}
+
+	// SendGrid wants text/plain before text/html
+	content := []sendGridContent{{Type: "text/plain", Value: msg.Body}}
+	if msg.HTMLBody != "" {
+		content = append(content, sendGridContent{Type: "text/html", Value: msg.HTMLBody})
+	}
+
+	body, err := json.Marshal(sendGridRequest{
+		Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: msg.To}}}},
+		From:             sendGridAddress{Email: from.Address, Name: from.Name},
+		Subject:          msg.Subject,
+		Content:          content,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding SendGrid request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating SendGrid request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling SendGrid: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 202 Accepted means the message was queued for delivery
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error from SendGrid: status %d: %s", resp.StatusCode, detail)
+	}
+	return nil
+}
+
+// Check makes sure SendGrid's API is reachable and accepts the API key, without sending anything
+func (s *SendGridSender) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.cfg.URL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating SendGrid request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.APIKey)
+
+	resp, err := s.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling SendGrid: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// the send endpoint doesn't take HEAD requests, any answer but these means it's up and the
+	// key is fine
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden || resp.StatusCode >= 500 {
+		return fmt.Errorf("error from SendGrid: status %d", resp.StatusCode)
+	}
+	return nil
+}
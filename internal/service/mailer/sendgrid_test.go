@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendGridSender(t *testing.T) {
+	var received sendGridRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errors":[{"message":"The provided authorization grant is invalid"}]}`))
+			return
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+
+	msg := Message{To: "someone@example.com", Subject: "Verify your email", Body: "text", HTMLBody: "<p>html</p>"}
+
+	sender := NewSendGridSender(SendGridConfig{APIKey: "test-key", From: "Accounts <no-reply@example.com>", URL: server.URL})
+	require.NoError(t, sender.Send(context.Background(), msg))
+
+	assert.Equal(t, sendGridRequest{
+		Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: "someone@example.com"}}}},
+		From:             sendGridAddress{Email: "no-reply@example.com", Name: "Accounts"},
+		Subject:          "Verify your email",
+		Content: []sendGridContent{
+			{Type: "text/plain", Value: "text"},
+			{Type: "text/html", Value: "<p>html</p>"},
+		},
+	}, received)
+
+	sender = NewSendGridSender(SendGridConfig{APIKey: "wrong-key", From: "no-reply@example.com", URL: server.URL})
+	err := sender.Send(context.Background(), msg)
+	assert.ErrorContains(t, err, "status 401")
+}
+
+func TestSendGridSenderCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	t.Cleanup(server.Close)
+
+	sender := NewSendGridSender(SendGridConfig{APIKey: "test-key", From: "no-reply@example.com", URL: server.URL})
+	assert.NoError(t, sender.Check(context.Background()))
+
+	sender = NewSendGridSender(SendGridConfig{APIKey: "wrong-key", From: "no-reply@example.com", URL: server.URL})
+	assert.ErrorContains(t, sender.Check(context.Background()), "status 401")
+}
@@ -0,0 +1,168 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTPServer accepts one message without TLS or auth and returns its envelope and data
+func fakeSMTPServer(t *testing.T) (host string, port int, received chan []string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received = make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+		reply("220 fake ESMTP")
+
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250 fake")
+			case strings.HasPrefix(line, "MAIL FROM"), strings.HasPrefix(line, "RCPT TO"):
+				lines = append(lines, line)
+				reply("250 OK")
+			case line == "DATA":
+				reply("354 go ahead")
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					lines = append(lines, strings.TrimRight(dataLine, "\r\n"))
+				}
+				reply("250 queued")
+			case line == "QUIT":
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+func TestSMTPSender(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+
+	sender := NewSMTPSender(SMTPConfig{Host: host, Port: port, From: "Accounts <no-reply@example.com>"})
+	err := sender.Send(context.Background(), Message{
+		To:       "someone@example.com",
+		Subject:  "Verify your email",
+		Body:     "Follow this link:\nhttps://app.example.com/verify?token=abc\n",
+		HTMLBody: "<p>Verify</p>",
+	})
+	require.NoError(t, err)
+
+	lines := <-received
+	require.GreaterOrEqual(t, len(lines), 2)
+	assert.Equal(t, "MAIL FROM:<no-reply@example.com>", lines[0])
+	assert.Equal(t, "RCPT TO:<someone@example.com>", lines[1])
+
+	msg, err := mail.ReadMessage(strings.NewReader(strings.Join(lines[2:], "\r\n")))
+	require.NoError(t, err)
+	assert.Equal(t, "Accounts <no-reply@example.com>", msg.Header.Get("From"))
+	assert.Equal(t, "Verify your email", msg.Header.Get("Subject"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		b, err := io.ReadAll(part)
+		require.NoError(t, err)
+		bodies = append(bodies, part.Header.Get("Content-Type")+": "+string(b))
+	}
+	assert.Equal(t, []string{
+		"text/plain; charset=utf-8: Follow this link:\r\nhttps://app.example.com/verify?token=abc\r\n",
+		"text/html; charset=utf-8: <p>Verify</p>",
+	}, bodies)
+}
+
+func TestSMTPSenderUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+
+	sender := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", Port: port, From: "no-reply@example.com"})
+	err = sender.Send(context.Background(), Message{To: "someone@example.com", Subject: "Hi", Body: "Hi"})
+	assert.ErrorContains(t, err, "error connecting to SMTP server")
+}
+
+func TestSMTPSenderCheck(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+
+	sender := NewSMTPSender(SMTPConfig{Host: host, Port: port, From: "no-reply@example.com"})
+	require.NoError(t, sender.Check(context.Background()))
+	assert.Empty(t, <-received, "nothing is sent")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+
+	sender = NewSMTPSender(SMTPConfig{Host: "127.0.0.1", Port: closedPort, From: "no-reply@example.com"})
+	assert.ErrorContains(t, sender.Check(context.Background()), "error connecting to SMTP server")
+}
+
+func TestBuildMIMEPlainText(t *testing.T) {
+	data, err := buildMIME("no-reply@example.com", Message{To: "someone@example.com", Subject: "Grüße", Body: "Hello"})
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", msg.Header.Get("Content-Type"))
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Grüße", subject)
+	assert.Equal(t, "Hello", readAll(t, msg.Body))
+}
+
+func readAll(t *testing.T, r io.Reader) string {
+	t.Helper()
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
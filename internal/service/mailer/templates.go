@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates of the emails the service sends. Each is a text template in templates/<name>.txt
+// defining the subject and the plain text body, and an HTML template in templates/<name>.html
+// defining the content of the HTML layout.
+const (
+	TemplateVerifyEmail            = "verify_email"
+	TemplatePasswordReset          = "password_reset"
+	TemplatePasswordChanged        = "password_changed"
+	TemplateEmailChangeOld         = "email_change_old"
+	TemplateEmailChangeNew         = "email_change_new"
+	TemplateMFAEnabled             = "mfa_enabled"
+	TemplateFreezeLink             = "freeze_link"
+	TemplateAccountFrozen          = "account_frozen"
+	TemplateAccountDeleted         = "account_deleted"
+	TemplateOrganizationInvitation = "organization_invitation"
+	TemplateNewSignIn              = "new_sign_in"
+	TemplateMagicLink              = "magic_link"
+	TemplateDeletionRequested      = "deletion_requested"
+	TemplateDeletionReminder       = "deletion_reminder"
+	TemplateDeletionCancelled      = "deletion_cancelled"
+)
+
+// Data is what a template is rendered with, e.g. {"Link": "https://..."}
+type Data map[string]string
+
+//go:embed templates
+var templateFS embed.FS
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// templates are parsed once so a broken template fails at startup rather than when it's sent
+var templates = mustParseTemplates(templateFS)
+
+func mustParseTemplates(fsys fs.FS) map[string]emailTemplate {
+	names, err := fs.Glob(fsys, "templates/*.txt")
+	if err != nil {
+		panic(err)
+	}
+
+	parsed := make(map[string]emailTemplate, len(names))
+	for _, textFile := range names {
+		name := strings.TrimSuffix(path.Base(textFile), ".txt")
+		htmlFile := "templates/" + name + ".html"
+
+		// a missing key is a bug in the caller, not something to send as "<no value>"
+		text := texttemplate.Must(texttemplate.New(name).Option("missingkey=error").ParseFS(fsys, textFile))
+		html := htmltemplate.Must(htmltemplate.New(name).Option("missingkey=error").ParseFS(fsys, "templates/layout.html", textFile, htmlFile))
+		parsed[name] = emailTemplate{text: text, html: html}
+	}
+	return parsed
+}
+
+// Render renders the named template into a message to the given address
+func Render(name, to string, data Data) (Message, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, body, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s subject: %w", name, err)
+	}
+	if err := tmpl.text.ExecuteTemplate(&body, "body", data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s body: %w", name, err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout.html", data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s HTML body: %w", name, err)
+	}
+
+	return Message{
+		To:       to,
+		Subject:  subject.String(),
+		Body:     body.String(),
+		HTMLBody: html.String(),
+	}, nil
+}
+
+// SendTemplate renders the named template and sends it with s
+func SendTemplate(ctx context.Context, s Sender, name, to string, data Data) error {
+	msg, err := Render(name, to, data)
+	if err != nil {
+		return err
+	}
+	return s.Send(ctx, msg)
+}
@@ -0,0 +1,82 @@
+package mailer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	msg, err := Render(TemplateOrganizationInvitation, "invitee@example.com", Data{
+		"OrganizationName": "Acme <Tools>",
+		"Link":             "https://app.example.com/invitations/accept?token=abc&x=1",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "invitee@example.com", msg.To)
+	assert.Equal(t, "You're invited to join Acme <Tools>", msg.Subject)
+	assert.Contains(t, msg.Body, "You've been invited to join Acme <Tools>.\n\nTo accept, follow this link:\nhttps://app.example.com/invitations/accept?token=abc&x=1\n")
+	// the HTML body is escaped
+	assert.Contains(t, msg.HTMLBody, "Acme &lt;Tools&gt;")
+	assert.Contains(t, msg.HTMLBody, `href="https://app.example.com/invitations/accept?token=abc&amp;x=1"`)
+	assert.Contains(t, msg.HTMLBody, "<title>You're invited to join Acme &lt;Tools&gt;</title>")
+
+	_, err = Render(TemplateVerifyEmail, "someone@example.com", Data{})
+	assert.Error(t, err, "missing data isn't rendered as <no value>")
+
+	_, err = Render("missing", "someone@example.com", Data{})
+	assert.Error(t, err)
+}
+
+func TestEveryTemplateRenders(t *testing.T) {
+	data := Data{
+		"Link":             "https://app.example.com/link?token=abc",
+		"ConfirmLink":      "https://app.example.com/confirm?token=abc",
+		"CancelLink":       "https://app.example.com/cancel?token=abc",
+		"NewEmail":         "new@example.com",
+		"OrganizationName": "Acme",
+		"Device":           "Firefox on Linux",
+		"Location":         "NL",
+		"IPAddress":        "203.0.113.7",
+		"Time":             "2 Jan 2026 15:04 UTC",
+		"ExpiresIn":        "15 minutes",
+		"EraseAt":          "2 Feb 2026",
+	}
+
+	names := []string{
+		TemplateVerifyEmail, TemplatePasswordReset, TemplatePasswordChanged, TemplateEmailChangeOld,
+		TemplateEmailChangeNew, TemplateMFAEnabled, TemplateFreezeLink, TemplateAccountFrozen,
+		TemplateAccountDeleted, TemplateOrganizationInvitation, TemplateNewSignIn, TemplateMagicLink,
+		TemplateDeletionRequested, TemplateDeletionReminder, TemplateDeletionCancelled,
+	}
+	assert.Len(t, templates, len(names), "every template has a constant")
+
+	for _, name := range names {
+		msg, err := Render(name, "someone@example.com", data)
+		require.NoError(t, err, name)
+		assert.NotEmpty(t, msg.Subject, name)
+		assert.NotEmpty(t, msg.Body, name)
+		assert.Contains(t, msg.HTMLBody, "<html>", name)
+	}
+}
+
+func TestSendTemplate(t *testing.T) {
+	var sent []Message
+	sender := senderFunc(func(ctx context.Context, msg Message) error {
+		sent = append(sent, msg)
+		return nil
+	})
+
+	require.NoError(t, SendTemplate(context.Background(), sender, TemplatePasswordChanged, "someone@example.com", nil))
+	require.Len(t, sent, 1)
+	assert.Equal(t, "Your password was changed", sent[0].Subject)
+}
+
+// senderFunc is a Sender that calls itself
+type senderFunc func(ctx context.Context, msg Message) error
+
+func (f senderFunc) Send(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
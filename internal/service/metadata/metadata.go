@@ -0,0 +1,125 @@
+// Package metadata applies changes to the JSON metadata integrating applications keep on
+// accounts. user_metadata is the account's own to change, app_metadata only changes through
+// the internal and admin APIs, so it's safe to make decisions on. Selected app_metadata keys
+// are copied into access tokens.
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/austinwofford/account-management/internal/database"
+)
+
+// MaxBytes caps the encoded size of each of an account's metadata objects. They're stored on
+// the account row and app_metadata keys can be copied into every access token.
+const MaxBytes = 16 * 1024
+
+// keys are safe in JWT claims and JSON paths
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var (
+	ErrInvalidKey = errors.New("metadata keys must be 1-64 letters, digits, hyphens or underscores")
+	ErrTooLarge   = fmt.Errorf("metadata can be at most %d bytes", MaxBytes)
+)
+
+// ValidKey reports whether key can be used as a metadata key
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// Patch is a change to a metadata object, like a JSON merge patch one level deep: keys set to
+// null are removed and the rest replace the account's values
+type Patch map[string]json.RawMessage
+
+// Update is the changes to an account's metadata. A nil Patch leaves its object as it is.
+type Update struct {
+	User Patch
+	App  Patch
+}
+
+// Store is the DB methods Apply needs
+type Store interface {
+	GetAccountByID(ctx context.Context, id string) (*database.Account, error)
+	UpdateAccountMetadata(ctx context.Context, id string, params database.UpdateAccountMetadataParams) (*database.Account, error)
+}
+
+// Apply validates the update and makes it. It fails with ErrInvalidKey, ErrTooLarge, or
+// database.ErrAccountNotFound.
+func Apply(ctx context.Context, db Store, accountID string, update Update) (*database.Account, error) {
+	var params database.UpdateAccountMetadataParams
+	var err error
+	params.SetUserMetadata, params.UnsetUserMetadata, err = update.User.split()
+	if err != nil {
+		return nil, err
+	}
+	params.SetAppMetadata, params.UnsetAppMetadata, err = update.App.split()
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := db.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// like the tag and feature flag limits this is checked up front, so concurrent updates can
+	// overshoot it slightly
+	userMetadata := account.UserMetadata.Apply(params.SetUserMetadata, params.UnsetUserMetadata)
+	appMetadata := account.AppMetadata.Apply(params.SetAppMetadata, params.UnsetAppMetadata)
+	for _, m := range []database.Metadata{userMetadata, appMetadata} {
+		encoded, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding metadata: %w", err)
+		}
+		if len(encoded) > MaxBytes {
+			return nil, ErrTooLarge
+		}
+	}
+
+	return db.UpdateAccountMetadata(ctx, accountID, params)
+}
+
+// split returns the values the patch sets, compacted, and the keys it removes
+func (p Patch) split() (set database.Metadata, unset []string, err error) {
+	for key, value := range p {
+		if !ValidKey(key) {
+			return nil, nil, ErrInvalidKey
+		}
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			unset = append(unset, key)
+			continue
+		}
+
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, value); err != nil {
+			return nil, nil, fmt.Errorf("error compacting metadata: %w", err)
+		}
+		if set == nil {
+			set = database.Metadata{}
+		}
+		set[key] = compact.Bytes()
+	}
+	return set, unset, nil
+}
+
+// TokenClaim returns the account's values for the app_metadata keys that go into access
+// tokens, or nil if it has none of them
+func TokenClaim(appMetadata database.Metadata, keys []string) map[string]json.RawMessage {
+	var result map[string]json.RawMessage
+	for _, key := range keys {
+		value, ok := appMetadata[key]
+		if !ok {
+			continue
+		}
+		if result == nil {
+			result = map[string]json.RawMessage{}
+		}
+		result[key] = value
+	}
+	return result
+}
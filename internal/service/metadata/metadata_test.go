@@ -0,0 +1,85 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		update        Update
+		expectedUser  database.Metadata
+		expectedApp   database.Metadata
+		expectedError error
+	}{
+		{
+			name: "sets and removes keys",
+			update: Update{
+				User: Patch{"theme": json.RawMessage(`null`), "language": json.RawMessage(`"de"`)},
+				App:  Patch{"plan": json.RawMessage(`{ "name": "pro", "seats": 5 }`)},
+			},
+			expectedUser: database.Metadata{"language": json.RawMessage(`"de"`)},
+			expectedApp:  database.Metadata{"plan": json.RawMessage(`{"name":"pro","seats":5}`), "customer": json.RawMessage(`"cus_123"`)},
+		},
+		{
+			name:         "leaves an object without a patch alone",
+			update:       Update{App: Patch{"customer": json.RawMessage(`null`)}},
+			expectedUser: database.Metadata{"theme": json.RawMessage(`"dark"`)},
+			expectedApp:  database.Metadata{},
+		},
+		{
+			name:          "invalid key",
+			update:        Update{User: Patch{"has space": json.RawMessage(`1`)}},
+			expectedError: ErrInvalidKey,
+		},
+		{
+			name:          "too large",
+			update:        Update{App: Patch{"notes": json.RawMessage(`"` + strings.Repeat("a", MaxBytes) + `"`)}},
+			expectedError: ErrTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := database.NewMemoryDB()
+			account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "metadata@test.com"})
+			require.NoError(t, err)
+			_, err = db.UpdateAccountMetadata(ctx, account.ID, database.UpdateAccountMetadataParams{
+				SetUserMetadata: database.Metadata{"theme": json.RawMessage(`"dark"`)},
+				SetAppMetadata:  database.Metadata{"customer": json.RawMessage(`"cus_123"`)},
+			})
+			require.NoError(t, err)
+
+			updated, err := Apply(ctx, db, account.ID, tt.update)
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedUser, updated.UserMetadata)
+			assert.Equal(t, tt.expectedApp, updated.AppMetadata)
+		})
+	}
+
+	t.Run("missing account", func(t *testing.T) {
+		_, err := Apply(ctx, database.NewMemoryDB(), "missing", Update{User: Patch{"theme": json.RawMessage(`"dark"`)}})
+		require.ErrorIs(t, err, database.ErrAccountNotFound)
+	})
+}
+
+func TestTokenClaim(t *testing.T) {
+	appMetadata := database.Metadata{"plan": json.RawMessage(`"pro"`), "customer": json.RawMessage(`"cus_123"`)}
+
+	assert.Equal(t, map[string]json.RawMessage{"plan": json.RawMessage(`"pro"`)}, TokenClaim(appMetadata, []string{"plan", "seats"}))
+	assert.Nil(t, TokenClaim(appMetadata, []string{"seats"}))
+	assert.Nil(t, TokenClaim(appMetadata, nil))
+}
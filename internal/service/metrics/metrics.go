@@ -0,0 +1,217 @@
+// Package metrics holds the service's Prometheus collectors. Collectors are registered on the
+// registry passed to New rather than the global one, so tests and multiple routers in one
+// process each get their own.
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "account_management"
+
+// Password hashing operations
+const (
+	OperationHash    = "hash"
+	OperationCompare = "compare"
+)
+
+// Token types counted by TokenIssued
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+// Databases queries are sent to, labelling db_query_duration_seconds
+const (
+	TargetPrimary = "primary"
+	TargetReplica = "replica"
+)
+
+// Metrics records the service's metrics. A nil *Metrics records nothing, so handlers and
+// tests that don't care about metrics can leave it unset.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests         *prometheus.CounterVec
+	httpRequestDuration  *prometheus.HistogramVec
+	dbQueryDuration      *prometheus.HistogramVec
+	passwordHashDuration *prometheus.HistogramVec
+	tokensIssued         *prometheus.CounterVec
+	rowsPurged           *prometheus.CounterVec
+	cacheLookups         *prometheus.CounterVec
+	replicaFallbacks     *prometheus.CounterVec
+	deprecatedRequests   *prometheus.CounterVec
+}
+
+// New registers the service's collectors on reg. Registering twice on the same registry panics,
+// so every router gets its own, usually from prometheus.NewRegistry.
+func New(reg *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		registry: reg,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern, and status code.",
+		}, []string{"method", "route", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route pattern, and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		dbQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Database query latency by target (primary or replica) and statement type.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"target", "operation"}),
+		// bcrypt is deliberately slow, so the buckets start higher than the HTTP ones
+		passwordHashDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "password_hash_duration_seconds",
+			Help:      "bcrypt latency by operation (hash or compare).",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation"}),
+		tokensIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_issued_total",
+			Help:      "Tokens issued by type (access or refresh).",
+		}, []string{"type"}),
+		rowsPurged: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rows_purged_total",
+			Help:      "Rows deleted by the background cleanup jobs by table.",
+		}, []string{"table"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Redis cache lookups by cache and result (hit, miss, or error).",
+		}, []string{"cache", "result"}),
+		replicaFallbacks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_replica_fallbacks_total",
+			Help:      "Reads meant for the read replica that went to the primary by reason (unavailable, error, or not_found).",
+		}, []string{"reason"}),
+		deprecatedRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "deprecated_requests_total",
+			Help:      "Requests to deprecated routes by method and route pattern.",
+		}, []string{"method", "route"}),
+	}
+
+	reg.MustRegister(
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.dbQueryDuration,
+		m.passwordHashDuration,
+		m.tokensIssued,
+		m.rowsPurged,
+		m.cacheLookups,
+		m.replicaFallbacks,
+		m.deprecatedRequests,
+	)
+
+	return m
+}
+
+// RegisterActiveRefreshTokens adds a gauge of the refresh tokens that haven't expired or been
+// rotated. count is called on every scrape, usually with the database's
+// CountActiveRefreshTokens.
+func (m *Metrics) RegisterActiveRefreshTokens(count func(ctx context.Context, now time.Time) (int64, error)) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_refresh_tokens",
+		Help:      "Refresh tokens that haven't expired or been rotated.",
+	}, func() float64 {
+		// a scrape shouldn't hang on a slow database
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		n, err := count(ctx, time.Now())
+		if err != nil {
+			slog.ErrorContext(ctx, "error counting active refresh tokens", "error", err)
+			return 0
+		}
+		return float64(n)
+	}))
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTPRequest records a served request. route should be the matched route pattern so
+// path parameters don't create a series per ID.
+func (m *Metrics) ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, code).Inc()
+	m.httpRequestDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// ObserveDBQuery records how long a database statement took on the primary or the replica
+func (m *Metrics) ObserveDBQuery(target, operation string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.dbQueryDuration.WithLabelValues(target, operation).Observe(duration.Seconds())
+}
+
+// ObservePasswordHash records how long hashing or comparing a password took
+func (m *Metrics) ObservePasswordHash(operation string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.passwordHashDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// TokenIssued counts an issued access or refresh token
+func (m *Metrics) TokenIssued(tokenType string) {
+	if m == nil {
+		return
+	}
+	m.tokensIssued.WithLabelValues(tokenType).Inc()
+}
+
+// RowsPurged counts rows deleted from table by a background cleanup job
+func (m *Metrics) RowsPurged(table string, n int64) {
+	if m == nil {
+		return
+	}
+	m.rowsPurged.WithLabelValues(table).Add(float64(n))
+}
+
+// CacheLookup counts a cache lookup and whether it was a hit, a miss, or Redis failed
+func (m *Metrics) CacheLookup(cache, result string) {
+	if m == nil {
+		return
+	}
+	m.cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// ReplicaFallback counts a read meant for the read replica that went to the primary
+func (m *Metrics) ReplicaFallback(reason string) {
+	if m == nil {
+		return
+	}
+	m.replicaFallbacks.WithLabelValues(reason).Inc()
+}
+
+// DeprecatedRequest counts a request to a deprecated route. route should be the matched route
+// pattern, as with ObserveHTTPRequest.
+func (m *Metrics) DeprecatedRequest(method, route string) {
+	if m == nil {
+		return
+	}
+	m.deprecatedRequests.WithLabelValues(method, route).Inc()
+}
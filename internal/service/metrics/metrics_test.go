@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+
+	m.TokenIssued(TokenAccess)
+	m.TokenIssued(TokenAccess)
+	m.TokenIssued(TokenRefresh)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.tokensIssued.WithLabelValues(TokenAccess)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.tokensIssued.WithLabelValues(TokenRefresh)))
+
+	m.ObservePasswordHash(OperationHash, 50*time.Millisecond)
+	m.ObservePasswordHash(OperationCompare, 50*time.Millisecond)
+	assert.Equal(t, 2, testutil.CollectAndCount(m.passwordHashDuration))
+
+	m.RowsPurged("refresh_tokens", 3)
+	m.RowsPurged("refresh_tokens", 0)
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.rowsPurged.WithLabelValues("refresh_tokens")))
+
+	// a second set of collectors can't share the registry
+	assert.Panics(t, func() { New(reg) })
+}
+
+func TestActiveRefreshTokens(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+
+	count, err := int64(3), error(nil)
+	m.RegisterActiveRefreshTokens(func(ctx context.Context, now time.Time) (int64, error) {
+		return count, err
+	})
+
+	expected := `
+		# HELP account_management_active_refresh_tokens Refresh tokens that haven't expired or been rotated.
+		# TYPE account_management_active_refresh_tokens gauge
+		account_management_active_refresh_tokens %s
+	`
+	gather := func(value string) error {
+		return testutil.GatherAndCompare(m.registry, strings.NewReader(strings.ReplaceAll(expected, "%s", value)),
+			"account_management_active_refresh_tokens")
+	}
+
+	require.NoError(t, gather("3"))
+
+	// scrapes still work while the database is down
+	err = errors.New("connection refused")
+	require.NoError(t, gather("0"))
+}
+
+func TestQueryTracer(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+	tracer := NewQueryTracer(m, TargetPrimary)
+	replicaTracer := NewQueryTracer(m, TargetReplica)
+
+	for _, sql := range []string{
+		"\n\t\tSELECT id FROM accounts WHERE email = $1;",
+		"select 1",
+		"WITH deleted AS (DELETE FROM refresh_tokens) UPDATE accounts SET deleted_at = NOW()",
+		"LISTEN events",
+	} {
+		ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	}
+	// a query that was never started isn't recorded
+	tracer.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{})
+
+	ctx := replicaTracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	replicaTracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	assert.Equal(t, 4, testutil.CollectAndCount(m.dbQueryDuration))
+	assert.Equal(t, uint64(2), histogramCount(t, m.dbQueryDuration.WithLabelValues(TargetPrimary, "select")))
+	assert.Equal(t, uint64(1), histogramCount(t, m.dbQueryDuration.WithLabelValues(TargetPrimary, "with")))
+	assert.Equal(t, uint64(1), histogramCount(t, m.dbQueryDuration.WithLabelValues(TargetPrimary, "other")))
+	assert.Equal(t, uint64(1), histogramCount(t, m.dbQueryDuration.WithLabelValues(TargetReplica, "select")))
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+
+	// nothing to assert, none of these should panic
+	m.ObserveHTTPRequest("GET", "/health", 200, time.Millisecond)
+	m.ObserveDBQuery(TargetPrimary, "select", time.Millisecond)
+	m.ObservePasswordHash(OperationHash, time.Millisecond)
+	m.TokenIssued(TokenAccess)
+	m.RowsPurged("refresh_tokens", 1)
+	m.ReplicaFallback("error")
+}
+
+func histogramCount(t *testing.T, o prometheus.Observer) uint64 {
+	t.Helper()
+
+	metric, ok := o.(prometheus.Metric)
+	require.True(t, ok)
+
+	var out dto.Metric
+	require.NoError(t, metric.Write(&out))
+	return out.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	operation string
+	at        time.Time
+}
+
+// QueryTracer records the duration of every query as a pgx tracer. Queries are labelled by
+// their statement type (select, insert, update, delete, with) so the label stays small.
+type QueryTracer struct {
+	metrics *Metrics
+	target  string
+}
+
+// NewQueryTracer returns a tracer for database.DBConfig.Tracer, or ReplicaTracer with
+// TargetReplica
+func NewQueryTracer(m *Metrics, target string) *QueryTracer {
+	return &QueryTracer{metrics: m, target: target}
+}
+
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{
+		operation: statementType(data.SQL),
+		at:        time.Now(),
+	})
+}
+
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	t.metrics.ObserveDBQuery(t.target, start.operation, time.Since(start.at))
+}
+
+// statementType returns the lowercased first keyword of the statement
+func statementType(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+
+	switch keyword := strings.ToLower(fields[0]); keyword {
+	case "select", "insert", "update", "delete", "with":
+		return keyword
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,141 @@
+// Package ops has the maintenance tasks the binary's admin subcommands run against the
+// database and key files, so operators don't need hand-written SQL.
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+)
+
+// commandDetails is the details of audit events recorded by the subcommands, so they can be
+// told apart from what accounts did themselves
+const commandDetails = "from the command line"
+
+var (
+	ErrInvalidEmail    = errors.New("invalid email address")
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+type CreateAdminResult struct {
+	Account *database.Account
+	// Password is the new account's generated password. Empty when the account already existed
+	// and kept its password.
+	Password string
+	// AlreadyAdmin is whether the account already had the admin role
+	AlreadyAdmin bool
+}
+
+// CreateAdmin gives the account with the email the admin role, first creating it with a
+// generated password and a verified email if there's none
+func CreateAdmin(ctx context.Context, db database.Repository, passwords *auth.PasswordHasher, email string) (*CreateAdminResult, error) {
+	if !auth.IsValidEmail(email) {
+		return nil, ErrInvalidEmail
+	}
+
+	result := &CreateAdminResult{}
+	account, err := db.GetAccount(ctx, email)
+	switch {
+	case errors.Is(err, database.ErrAccountNotFound):
+		// the password is only shown once, so it's as strong as a token
+		result.Password, err = auth.NewOpaqueToken()
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, fmt.Errorf("error getting account: %w", err)
+	default:
+		roles, err := db.GetAccountRoles(ctx, account.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting account roles: %w", err)
+		}
+		if slices.Contains(roles, database.RoleAdmin) {
+			return &CreateAdminResult{Account: account, AlreadyAdmin: true}, nil
+		}
+	}
+
+	var passwordHash string
+	if result.Password != "" {
+		passwordHash, err = passwords.Hash(result.Password)
+		if err != nil {
+			return nil, fmt.Errorf("error hashing password: %w", err)
+		}
+	}
+
+	err = db.WithTx(ctx, func(tx database.Repository) error {
+		var err error
+		if account == nil {
+			account, err = tx.CreateAccount(ctx, database.AccountCreationParams{
+				Email:        email,
+				PasswordHash: passwordHash,
+				Verified:     true,
+			})
+			if err != nil {
+				return fmt.Errorf("error creating account: %w", err)
+			}
+			err = tx.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+				AccountID: account.ID,
+				EventType: database.AuditEventAccountCreated,
+				Details:   commandDetails,
+			})
+			if err != nil {
+				return fmt.Errorf("error recording audit event: %w", err)
+			}
+		}
+
+		if err := tx.AssignRole(ctx, account.ID, database.RoleAdmin); err != nil {
+			return fmt.Errorf("error assigning admin role: %w", err)
+		}
+		err = tx.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+			AccountID: account.ID,
+			EventType: database.AuditEventRoleAssigned,
+			Details:   database.RoleAdmin + " " + commandDetails,
+		})
+		if err != nil {
+			return fmt.Errorf("error recording audit event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Account = account
+	return result, nil
+}
+
+// RevokeSessions ends every session of the account, like logging out everywhere. revocations
+// revokes the account's signed refresh tokens, leave it nil without SIGNED_REFRESH_TOKENS.
+// Access tokens keep working until they expire.
+func RevokeSessions(ctx context.Context, db database.Repository, revocations *revocation.List, accountID string) error {
+	if _, err := db.GetAccountByID(ctx, accountID); err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return ErrAccountNotFound
+		}
+		return fmt.Errorf("error getting account: %w", err)
+	}
+
+	if err := db.DeleteRefreshTokensByAccount(ctx, accountID); err != nil {
+		return fmt.Errorf("error deleting refresh tokens: %w", err)
+	}
+	if revocations != nil {
+		if err := revocations.RevokeAccount(ctx, accountID); err != nil {
+			return fmt.Errorf("error revoking signed refresh tokens: %w", err)
+		}
+	}
+
+	err := db.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		AccountID: accountID,
+		EventType: database.AuditEventLogoutAll,
+		Details:   commandDetails,
+	})
+	if err != nil {
+		return fmt.Errorf("error recording audit event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package ops
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAdmin(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemoryDB()
+	passwords, err := auth.NewPasswordHasher(auth.DefaultHasherConfig())
+	require.NoError(t, err)
+
+	result, err := CreateAdmin(ctx, db, passwords, "ops@test.com")
+	require.NoError(t, err)
+	require.NotEmpty(t, result.Password)
+	assert.False(t, result.AlreadyAdmin)
+	assert.NotNil(t, result.Account.VerifiedAt)
+	assert.True(t, auth.PasswordIsCorrect(result.Password, result.Account.PasswordHash))
+	roles, err := db.GetAccountRoles(ctx, result.Account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{database.RoleAdmin}, roles)
+
+	events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: result.Account.ID})
+	require.NoError(t, err)
+	var types []string
+	for _, e := range events {
+		types = append(types, e.EventType)
+	}
+	assert.ElementsMatch(t, []string{database.AuditEventAccountCreated, database.AuditEventRoleAssigned}, types)
+
+	t.Run("an existing admin is left alone", func(t *testing.T) {
+		again, err := CreateAdmin(ctx, db, passwords, "ops@test.com")
+		require.NoError(t, err)
+		assert.True(t, again.AlreadyAdmin)
+		assert.Empty(t, again.Password)
+		assert.Equal(t, result.Account.ID, again.Account.ID)
+	})
+
+	t.Run("an existing account keeps its password", func(t *testing.T) {
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "user@test.com", PasswordHash: "hash"})
+		require.NoError(t, err)
+
+		promoted, err := CreateAdmin(ctx, db, passwords, "user@test.com")
+		require.NoError(t, err)
+		assert.Empty(t, promoted.Password)
+		assert.False(t, promoted.AlreadyAdmin)
+		assert.Equal(t, account.ID, promoted.Account.ID)
+		assert.Equal(t, "hash", promoted.Account.PasswordHash)
+		roles, err := db.GetAccountRoles(ctx, account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{database.RoleAdmin}, roles)
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		_, err := CreateAdmin(ctx, db, passwords, "not an email")
+		assert.ErrorIs(t, err, ErrInvalidEmail)
+	})
+}
+
+func TestRevokeSessions(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemoryDB()
+	revocations := revocation.NewList(lockout.NewMemoryStore(), time.Hour)
+
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "revoked@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	require.NoError(t, db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     "refresh-token",
+		AccountID: account.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+
+	require.NoError(t, RevokeSessions(ctx, db, revocations, account.ID))
+
+	_, err = db.GetRefreshToken(ctx, "refresh-token")
+	assert.ErrorIs(t, err, database.ErrRefreshTokenNotFound)
+	revokedAt, err := revocations.AccountRevokedAt(ctx, account.ID)
+	require.NoError(t, err)
+	assert.False(t, revokedAt.IsZero())
+	events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, EventType: database.AuditEventLogoutAll})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	err = RevokeSessions(ctx, db, nil, "7b2a2a5e-2f0c-4b7e-9a56-3c3f0c1d2e4f")
+	assert.ErrorIs(t, err, ErrAccountNotFound)
+}
@@ -0,0 +1,154 @@
+package ops
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+)
+
+// The signing key functions take JWT_SIGNING_KEY_FILE through the steps of rotating to a new
+// key: AddSigningKey publishes it, PromoteSigningKey signs with it, and RetireSigningKeys drops
+// the old ones. Replicas pick up each change when their signing keys are reloaded.
+
+// signingKeyFile is the PEM blocks of a key file and the keys they hold, in the same order
+type signingKeyFile struct {
+	blocks []*pem.Block
+	keys   []*auth.SigningKey
+}
+
+// AddSigningKey generates a key and appends it to the file, creating the file if it doesn't
+// exist. It returns the new key's ID. A new file's key signs right away, otherwise the key only
+// verifies until it's promoted.
+func AddSigningKey(path, algorithm string) (string, error) {
+	file, err := readSigningKeyFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	keyPEM, err := auth.GenerateSigningKey(algorithm)
+	if err != nil {
+		return "", err
+	}
+	key, err := auth.ParseSigningKeys(keyPEM)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(keyPEM)
+
+	file.blocks = append(file.blocks, block)
+	file.keys = append(file.keys, key[0])
+	if err := file.write(path); err != nil {
+		return "", err
+	}
+	return key[0].ID(), nil
+}
+
+// PromoteSigningKey moves the file's last key to the front so it signs new tokens. The key that
+// signed them until now stays in the file to verify the tokens it signed. It returns the ID of
+// the promoted key.
+func PromoteSigningKey(path string) (string, error) {
+	file, err := readSigningKeyFile(path)
+	if err != nil {
+		return "", err
+	}
+	last := len(file.keys) - 1
+	if last == 0 {
+		return "", errors.New("error promoting signing key: the file only has the key that already signs, add one first")
+	}
+	if !file.keys[last].CanSign() {
+		return "", errors.New("error promoting signing key: the last key in the file is a public key")
+	}
+
+	file.blocks = append([]*pem.Block{file.blocks[last]}, file.blocks[:last]...)
+	file.keys = append([]*auth.SigningKey{file.keys[last]}, file.keys[:last]...)
+	if err := file.write(path); err != nil {
+		return "", err
+	}
+	return file.keys[0].ID(), nil
+}
+
+// RetireSigningKeys removes every key but the one that signs. Tokens the removed keys signed
+// stop verifying on replicas that restart, so it should wait until they've expired. It returns
+// the IDs of the removed keys.
+func RetireSigningKeys(path string) ([]string, error) {
+	file, err := readSigningKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var retired []string
+	for _, key := range file.keys[1:] {
+		retired = append(retired, key.ID())
+	}
+	file.blocks, file.keys = file.blocks[:1], file.keys[:1]
+	if err := file.write(path); err != nil {
+		return nil, err
+	}
+	return retired, nil
+}
+
+func readSigningKeyFile(path string) (signingKeyFile, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return signingKeyFile{}, fmt.Errorf("error reading signing key file: %w", err)
+	}
+	keys, err := auth.ParseSigningKeys(contents)
+	if err != nil {
+		return signingKeyFile{}, err
+	}
+
+	file := signingKeyFile{keys: keys}
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			break
+		}
+		file.blocks = append(file.blocks, block)
+	}
+	return file, nil
+}
+
+// write replaces the file in one rename, so replicas reloading it never read half of it. The
+// file keeps its permissions, a new one is only readable by its owner.
+func (f signingKeyFile) write(path string) error {
+	var contents bytes.Buffer
+	for _, block := range f.blocks {
+		if err := pem.Encode(&contents, block); err != nil {
+			return fmt.Errorf("error encoding signing keys: %w", err)
+		}
+	}
+
+	mode := fs.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing signing key file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing signing key file: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing signing key file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing signing key file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing signing key file: %w", err)
+	}
+	return nil
+}
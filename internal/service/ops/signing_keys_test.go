@@ -0,0 +1,63 @@
+package ops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateSigningKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing-keys.pem")
+	keyIDs := func() []string {
+		t.Helper()
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		keys, err := auth.ParseSigningKeys(contents)
+		require.NoError(t, err)
+		ids := make([]string, len(keys))
+		for i, key := range keys {
+			ids[i] = key.ID()
+		}
+		return ids
+	}
+
+	first, err := AddSigningKey(path, auth.SigningKeyEd25519)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first}, keyIDs())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	_, err = PromoteSigningKey(path)
+	assert.ErrorContains(t, err, "add one first")
+
+	// published, but the first key still signs
+	second, err := AddSigningKey(path, auth.SigningKeyRSA)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first, second}, keyIDs())
+
+	promoted, err := PromoteSigningKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, second, promoted)
+	assert.Equal(t, []string{second, first}, keyIDs())
+
+	retired, err := RetireSigningKeys(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first}, retired)
+	assert.Equal(t, []string{second}, keyIDs())
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		_, err := AddSigningKey(path, "hs256")
+		assert.Error(t, err)
+		assert.Equal(t, []string{second}, keyIDs())
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := PromoteSigningKey(filepath.Join(t.TempDir(), "missing.pem"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
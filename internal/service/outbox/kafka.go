@@ -0,0 +1,55 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type KafkaConfig struct {
+	// Brokers are the host:port addresses to bootstrap from
+	Brokers []string
+	// Topic every event is published to. It has to exist already.
+	Topic string
+}
+
+// KafkaPublisher publishes to a Kafka topic, keyed by account ID so each account's events land on
+// the same partition in order
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(cfg KafkaConfig) *KafkaPublisher {
+	return &KafkaPublisher{writer: &kafka.Writer{
+		Addr:     kafka.TCP(cfg.Brokers...),
+		Topic:    cfg.Topic,
+		Balancer: &kafka.Hash{},
+		// the relay hands over whole batches, so don't wait around for more
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: kafka.RequireAll,
+	}}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, messages []Message) error {
+	return p.writer.WriteMessages(ctx, kafkaMessages(messages)...)
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+func kafkaMessages(messages []Message) []kafka.Message {
+	result := make([]kafka.Message, len(messages))
+	for i, m := range messages {
+		result[i] = kafka.Message{
+			Key:   []byte(m.Key),
+			Value: m.Body,
+			Headers: []kafka.Header{
+				{Key: HeaderEventID, Value: []byte(m.ID)},
+				{Key: HeaderEventType, Value: []byte(m.Type)},
+			},
+		}
+	}
+	return result
+}
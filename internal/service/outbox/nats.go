@@ -0,0 +1,65 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type NATSConfig struct {
+	URL string
+	// SubjectPrefix is prepended to the event type, e.g. accounts.account.created. A JetStream
+	// stream has to capture the subjects, e.g. accounts.>
+	SubjectPrefix string
+}
+
+// NATSPublisher publishes to JetStream, which acknowledges every message once it's stored and
+// drops the duplicates of a retry by event ID
+type NATSPublisher struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	prefix string
+}
+
+func NewNATSPublisher(cfg NATSConfig) (*NATSPublisher, error) {
+	conn, err := nats.Connect(cfg.URL, nats.Name("account-management"))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to NATS: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error creating JetStream context: %w", err)
+	}
+
+	return &NATSPublisher{conn: conn, js: js, prefix: cfg.SubjectPrefix}, nil
+}
+
+// Publish publishes the messages one at a time so they're stored in order
+func (p *NATSPublisher) Publish(ctx context.Context, messages []Message) error {
+	for _, m := range messages {
+		if _, err := p.js.PublishMsg(ctx, natsMsg(p.prefix, m), jetstream.WithMsgID(m.ID)); err != nil {
+			return fmt.Errorf("error publishing event %s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
+
+func natsMsg(prefix string, m Message) *nats.Msg {
+	subject := m.Type
+	if prefix != "" {
+		subject = prefix + "." + m.Type
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = m.Body
+	msg.Header.Set(HeaderEventID, m.ID)
+	msg.Header.Set(HeaderEventType, m.Type)
+	return msg
+}
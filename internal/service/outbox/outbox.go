@@ -0,0 +1,189 @@
+// Package outbox publishes account and session events to a message broker, Kafka or NATS.
+//
+// The database writes every event to its outbox table in the same statement as the change it
+// describes, so an event exists if and only if the change was committed. A Relay then publishes
+// the events in order and marks them published. Events are published at least once: consumers
+// should dedupe on the event ID.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+)
+
+// Headers every message is published with, for consumers that route on them without decoding the
+// body
+const (
+	HeaderEventID   = "Event-Id"
+	HeaderEventType = "Event-Type"
+)
+
+// Store is what the relay needs from the database
+type Store interface {
+	RelayOutboxEvents(ctx context.Context, limit int, publish func(ctx context.Context, events []database.OutboxEvent) error) (int, error)
+	PurgeOutboxEvents(ctx context.Context, createdBefore time.Time, unpublished bool) (int64, error)
+}
+
+// Publisher sends messages to a broker. Publish returns nil only once the broker has every one
+// of them.
+type Publisher interface {
+	Publish(ctx context.Context, messages []Message) error
+	Close() error
+}
+
+// Message is what's published for an event
+type Message struct {
+	// ID identifies the event so consumers can dedupe
+	ID   string
+	Type string
+	// Key is the account ID. Brokers that partition keep one account's events in order.
+	Key string
+	// Body is the JSON encoded Envelope
+	Body []byte
+}
+
+// Envelope is the JSON body of every message
+type Envelope struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	AccountID string `json:"account_id"`
+	// Sequence orders the events. It only ever goes up, though not always by one.
+	Sequence  int64           `json:"sequence"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewMessage wraps an outbox event in an Envelope
+func NewMessage(e database.OutboxEvent) (Message, error) {
+	body, err := json.Marshal(Envelope{
+		ID:        e.ID,
+		Type:      e.EventType,
+		AccountID: e.AccountID,
+		Sequence:  e.Sequence,
+		CreatedAt: e.CreatedAt.UTC(),
+		Data:      json.RawMessage(e.Payload),
+	})
+	if err != nil {
+		return Message{}, fmt.Errorf("error encoding outbox event %s: %w", e.ID, err)
+	}
+	return Message{ID: e.ID, Type: e.EventType, Key: e.AccountID, Body: body}, nil
+}
+
+type Config struct {
+	// Interval is how often new events are published
+	Interval time.Duration
+	// BatchSize is how many events are published at a time
+	BatchSize int
+	// Retention is how long events are kept after they're written. Published events are purged
+	// after it, and without a publisher unpublished ones are too.
+	Retention time.Duration
+	// PurgeInterval is how often old events are purged
+	PurgeInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval:      time.Second,
+		BatchSize:     100,
+		Retention:     72 * time.Hour,
+		PurgeInterval: time.Hour,
+	}
+}
+
+// Relay publishes outbox events and purges old ones
+type Relay struct {
+	store     Store
+	publisher Publisher
+	cfg       Config
+	timeNow   func() time.Time
+}
+
+// NewRelay returns a relay that publishes the store's events with publisher. With a nil
+// publisher it only purges, so the outbox doesn't grow forever when nothing consumes it.
+func NewRelay(store Store, publisher Publisher, cfg Config) *Relay {
+	return &Relay{store: store, publisher: publisher, cfg: cfg, timeNow: time.Now}
+}
+
+// Run publishes new events every interval and purges old ones every purge interval until ctx is
+// done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	var lastPurge time.Time
+	for {
+		// failed batches are retried on the next tick
+		if _, err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "error publishing outbox events", "error", err)
+		}
+
+		if r.timeNow().Sub(lastPurge) >= r.cfg.PurgeInterval {
+			if _, err := r.Purge(ctx); err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "error purging outbox events", "error", err)
+			} else {
+				lastPurge = r.timeNow()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes batches of events until they're all published and returns how many
+// were published
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	if r.publisher == nil {
+		return 0, nil
+	}
+
+	total := 0
+	for {
+		n, err := r.store.RelayOutboxEvents(ctx, r.cfg.BatchSize, r.publish)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		// a short batch was the last one, or another replica is relaying
+		if n < r.cfg.BatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, events []database.OutboxEvent) error {
+	messages := make([]Message, 0, len(events))
+	for _, e := range events {
+		m, err := NewMessage(e)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, m)
+	}
+
+	if err := r.publisher.Publish(ctx, messages); err != nil {
+		return fmt.Errorf("error publishing outbox events: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes the events written more than the retention period ago and returns how many were
+// deleted
+func (r *Relay) Purge(ctx context.Context) (int64, error) {
+	purged, err := r.store.PurgeOutboxEvents(ctx, r.timeNow().Add(-r.cfg.Retention), r.publisher == nil)
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		slog.InfoContext(ctx, "purged outbox events", "count", purged)
+	}
+	return purged, nil
+}
@@ -0,0 +1,122 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePublisher struct {
+	published []Message
+	err       error
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, messages []Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, messages...)
+	return nil
+}
+
+func (p *fakePublisher) Close() error { return nil }
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "outbox@test.com"})
+	require.NoError(t, err)
+	_, err = db.VerifyAccount(ctx, account.ID)
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteAccount(ctx, account.ID))
+
+	publisher := &fakePublisher{err: errors.New("broker unavailable")}
+	cfg := DefaultConfig()
+	cfg.BatchSize = 2
+	r := NewRelay(db, publisher, cfg)
+
+	// nothing is marked published when publishing fails
+	n, err := r.RelayPending(ctx)
+	require.Error(t, err)
+	assert.Zero(t, n)
+
+	publisher.err = nil
+	n, err = r.RelayPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	var types []string
+	for _, m := range publisher.published {
+		types = append(types, m.Type)
+		assert.Equal(t, account.ID, m.Key)
+
+		var envelope Envelope
+		require.NoError(t, json.Unmarshal(m.Body, &envelope))
+		assert.Equal(t, m.ID, envelope.ID)
+		assert.JSONEq(t, `{"account_id":"`+account.ID+`","email":"outbox@test.com"}`, string(envelope.Data))
+	}
+	assert.Equal(t, []string{
+		database.OutboxEventAccountCreated,
+		database.OutboxEventAccountVerified,
+		database.OutboxEventAccountDeleted,
+	}, types)
+
+	// already published
+	n, err = r.RelayPending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	_, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "published@test.com"})
+	require.NoError(t, err)
+
+	cfg := Config{BatchSize: 10, Retention: time.Hour}
+	r := NewRelay(db, &fakePublisher{}, cfg)
+	_, err = r.RelayPending(ctx)
+	require.NoError(t, err)
+	_, err = db.CreateAccount(ctx, database.AccountCreationParams{Email: "unpublished@test.com"})
+	require.NoError(t, err)
+
+	// still within the retention period
+	purged, err := r.Purge(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	// unpublished events are kept while there's a publisher
+	r.timeNow = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	purged, err = r.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	r = NewRelay(db, nil, cfg)
+	r.timeNow = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	purged, err = r.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+}
+
+func TestBrokerMessages(t *testing.T) {
+	m := Message{ID: "event-id", Type: database.OutboxEventAccountCreated, Key: "account-id", Body: []byte(`{}`)}
+
+	k := kafkaMessages([]Message{m})
+	require.Len(t, k, 1)
+	assert.Equal(t, []byte("account-id"), k[0].Key)
+	assert.Equal(t, HeaderEventID, k[0].Headers[0].Key)
+	assert.Equal(t, []byte("event-id"), k[0].Headers[0].Value)
+
+	n := natsMsg("accounts", m)
+	assert.Equal(t, "accounts.account.created", n.Subject)
+	assert.Equal(t, "event-id", n.Header.Get(HeaderEventID))
+	assert.Equal(t, database.OutboxEventAccountCreated, n.Header.Get(HeaderEventType))
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many takes go by between dropping full buckets, which behave the same as
+// missing ones
+const sweepEvery = 1024
+
+// MemoryStore is a Store for a single instance. Buckets aren't shared between replicas.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]memoryBucket
+	takes   int
+	timeNow func() time.Time
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	fullAt  time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]memoryBucket{},
+		timeNow: time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.validate(); err != nil {
+		return Result{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timeNow()
+	rate := limit.perMillisecond()
+	burst := float64(limit.burst())
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = memoryBucket{tokens: burst, updated: now}
+	}
+	elapsed := float64(now.Sub(b.updated).Milliseconds())
+	b.tokens = math.Min(burst, b.tokens+math.Max(0, elapsed)*rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	res := limit.result(allowed, b.tokens)
+	b.fullAt = now.Add(res.ResetAfter)
+	s.buckets[key] = b
+
+	s.takes++
+	if s.takes%sweepEvery == 0 {
+		for k, other := range s.buckets {
+			if !now.Before(other.fullAt) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,165 @@
+// Package ratelimit limits how often clients can call routes with token buckets. A bucket holds
+// up to Burst requests and refills at Requests per Period, so short bursts are allowed while the
+// long-run rate is capped.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Store keeps the buckets. Implementations must be safe for concurrent use, and the Redis
+// implementation must be used when running more than one replica so every replica sees the
+// same buckets.
+type Store interface {
+	// Take takes a token from key's bucket if it has one.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type Limit struct {
+	// Requests are refilled every Period
+	Requests int
+	Period   time.Duration
+	// Burst is the bucket size. Defaults to Requests.
+	Burst int
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// perMillisecond is the refill rate
+func (l Limit) perMillisecond() float64 {
+	return float64(l.Requests) / float64(l.Period.Milliseconds())
+}
+
+// result works out what the caller is told from the tokens left after taking (or failing to
+// take) one
+func (l Limit) result(allowed bool, tokens float64) Result {
+	rate := l.perMillisecond()
+	burst := l.burst()
+
+	res := Result{
+		Allowed:    allowed,
+		Limit:      burst,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration(math.Ceil((float64(burst)-tokens)/rate)) * time.Millisecond,
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration(math.Ceil((1-tokens)/rate)) * time.Millisecond
+	}
+	return res
+}
+
+type Result struct {
+	Allowed bool
+	// Limit is the bucket size
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request is allowed. 0 when Allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// ParseLimit parses "<requests>/<period>", e.g. "10/1m" for ten requests a minute
+func ParseLimit(s string) (Limit, error) {
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<period>", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, requests must be a positive number", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d < time.Millisecond {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, period must be a duration like 1m", s)
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// Rule limits one route
+type Rule struct {
+	Method string
+	Path   string
+	Limit  Limit
+	// PerAccount keys buckets by the authenticated account instead of the client IP. Requests
+	// without a valid access token fall back to the client IP.
+	PerAccount bool
+}
+
+const perAccountSuffix = "/account"
+
+// ParseRules parses rules keyed by route, e.g. "POST /v1/accounts/login" = "10/1m". Limits
+// ending in "/account" are per account, e.g. "5/1m/account".
+func ParseRules(rules map[string]string) ([]Rule, error) {
+	var parsed []Rule
+	for route, value := range rules {
+		method, path, ok := strings.Cut(strings.TrimSpace(route), " ")
+		path = strings.TrimSpace(path)
+		if !ok || method == "" || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid rate limit route %q, expected e.g. \"POST /v1/accounts/login\"", route)
+		}
+
+		rule := Rule{Method: strings.ToUpper(method), Path: path}
+		value, rule.PerAccount = strings.CutSuffix(strings.TrimSpace(value), perAccountSuffix)
+
+		limit, err := ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing rate limit for %s: %w", route, err)
+		}
+		rule.Limit = limit
+
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
+
+// RuleSet is the rules in use, keyed by route. Replace swaps them all at once, so they can be
+// changed while requests are being limited.
+type RuleSet struct {
+	byRoute atomic.Pointer[map[string]Rule]
+}
+
+func NewRuleSet(rules []Rule) *RuleSet {
+	s := &RuleSet{}
+	s.Replace(rules)
+	return s
+}
+
+// Replace swaps the rules for new ones. Buckets are kept, a route's bucket is refilled at its
+// new limit from the next request on.
+func (s *RuleSet) Replace(rules []Rule) {
+	byRoute := make(map[string]Rule, len(rules))
+	for _, rule := range rules {
+		byRoute[rule.Method+" "+rule.Path] = rule
+	}
+	s.byRoute.Store(&byRoute)
+}
+
+// Lookup returns the rule for a route, e.g. "POST /v1/accounts/login"
+func (s *RuleSet) Lookup(route string) (Rule, bool) {
+	rule, ok := (*s.byRoute.Load())[route]
+	return rule, ok
+}
+
+var errInvalidLimit = errors.New("rate limit must have positive requests and period")
+
+func (l Limit) validate() error {
+	if l.Requests <= 0 || l.Period < time.Millisecond {
+		return errInvalidLimit
+	}
+	return nil
+}
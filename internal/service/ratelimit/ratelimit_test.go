@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in          string
+		expected    Limit
+		shouldError bool
+	}{
+		{in: "10/1m", expected: Limit{Requests: 10, Period: time.Minute}},
+		{in: "1/30s", expected: Limit{Requests: 1, Period: 30 * time.Second}},
+		{in: "10", shouldError: true},
+		{in: "0/1m", shouldError: true},
+		{in: "-1/1m", shouldError: true},
+		{in: "ten/1m", shouldError: true},
+		{in: "10/minute", shouldError: true},
+		{in: "10/0s", shouldError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			limit, err := ParseLimit(tt.in)
+			if tt.shouldError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, limit)
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(map[string]string{
+		"POST /v1/accounts/login":           "10/1m",
+		"post /v1/accounts/password/change": "5/1h/account",
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []Rule{
+		{Method: "POST", Path: "/v1/accounts/login", Limit: Limit{Requests: 10, Period: time.Minute}},
+		{Method: "POST", Path: "/v1/accounts/password/change", Limit: Limit{Requests: 5, Period: time.Hour}, PerAccount: true},
+	}, rules)
+
+	for _, bad := range []map[string]string{
+		{"/v1/accounts/login": "10/1m"},
+		{"POST v1/accounts/login": "10/1m"},
+		{"POST /v1/accounts/login": "10"},
+		{"POST /v1/accounts/login": "10/1m/everyone"},
+	} {
+		_, err := ParseRules(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRuleSet(t *testing.T) {
+	login := Rule{Method: "POST", Path: "/v1/accounts/login", Limit: Limit{Requests: 10, Period: time.Minute}}
+	rules := NewRuleSet([]Rule{login})
+
+	rule, ok := rules.Lookup("POST /v1/accounts/login")
+	require.True(t, ok)
+	assert.Equal(t, login, rule)
+	_, ok = rules.Lookup("GET /v1/accounts/login")
+	assert.False(t, ok)
+
+	register := Rule{Method: "POST", Path: "/v1/accounts/register", Limit: Limit{Requests: 5, Period: time.Minute}}
+	rules.Replace([]Rule{register})
+	_, ok = rules.Lookup("POST /v1/accounts/login")
+	assert.False(t, ok)
+	rule, ok = rules.Lookup("POST /v1/accounts/register")
+	require.True(t, ok)
+	assert.Equal(t, register, rule)
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Now()
+	store.timeNow = func() time.Time { return now }
+
+	limit := Limit{Requests: 2, Period: time.Minute}
+
+	// a full bucket allows a burst
+	for remaining := 1; remaining >= 0; remaining-- {
+		res, err := store.Take(ctx, "key", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 2, res.Limit)
+		assert.Equal(t, remaining, res.Remaining)
+	}
+
+	res, err := store.Take(ctx, "key", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 30*time.Second, res.RetryAfter, "a token is refilled every 30s")
+	assert.Equal(t, time.Minute, res.ResetAfter)
+
+	// other keys have their own bucket
+	res, err = store.Take(ctx, "other", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	now = now.Add(30 * time.Second)
+	res, err = store.Take(ctx, "key", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = store.Take(ctx, "key", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	// buckets don't fill past the burst
+	now = now.Add(time.Hour)
+	for range 2 {
+		res, err = store.Take(ctx, "key", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	res, err = store.Take(ctx, "key", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	_, err = store.Take(ctx, "key", Limit{})
+	assert.Error(t, err)
+}
+
+func TestMemoryStoreBurst(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	limit := Limit{Requests: 1, Period: time.Hour, Burst: 3}
+	for range 3 {
+		res, err := store.Take(ctx, "key", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+	}
+
+	res, err := store.Take(ctx, "key", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from the bucket in one atomic step so concurrent requests across
+// replicas can't both take the last token. The bucket expires once it would be full again,
+// since a missing bucket is a full one.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil or updated == nil then
+	tokens = burst
+	updated = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate) + 1)
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore is a Store shared by every replica pointed at the same Redis. Refills are timed by
+// each replica's clock, so keep them in sync.
+type RedisStore struct {
+	client  redis.UniversalClient
+	prefix  string
+	timeNow func() time.Time
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client, prefix: "ratelimit:", timeNow: time.Now}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.validate(); err != nil {
+		return Result{}, err
+	}
+
+	reply, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.perMillisecond(), limit.burst(), s.timeNow().UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+	if len(reply) != 2 {
+		return Result{}, fmt.Errorf("error taking rate limit token: unexpected reply %v", reply)
+	}
+
+	allowed, _ := reply[0].(int64)
+	tokensString, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(tokensString, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+
+	return limit.result(allowed == 1, tokens), nil
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return NewRedisStore(client), mr
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	store, mr := setupRedisStore(t)
+	now := time.Now()
+	store.timeNow = func() time.Time { return now }
+
+	limit := Limit{Requests: 2, Period: time.Minute}
+
+	for remaining := 1; remaining >= 0; remaining-- {
+		res, err := store.Take(ctx, "key", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, remaining, res.Remaining)
+	}
+
+	res, err := store.Take(ctx, "key", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 30*time.Second, res.RetryAfter)
+
+	// the bucket is dropped once it would be full again
+	assert.InDelta(t, time.Minute, mr.TTL("ratelimit:key"), float64(time.Second))
+
+	now = now.Add(30 * time.Second)
+	res, err = store.Take(ctx, "key", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = store.Take(ctx, "key", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	res, err = store.Take(ctx, "other", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestRedisStoreUnavailable(t *testing.T) {
+	store, mr := setupRedisStore(t)
+	mr.Close()
+
+	_, err := store.Take(context.Background(), "key", Limit{Requests: 1, Period: time.Minute})
+	assert.Error(t, err)
+}
@@ -0,0 +1,114 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TokenStore keeps the IDs (jti) of revoked access tokens until the tokens expire. database.DB
+// keeps them in Postgres so every replica sees them, MemoryTokenStore only in the process.
+type TokenStore interface {
+	RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// ClaimAccessToken revokes the token ID and reports whether it wasn't revoked already. It's
+	// atomic: of concurrent claims for the same ID, only one succeeds.
+	ClaimAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error)
+	AccessTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+// AccessTokens revokes individual access tokens before they expire, e.g. the one a client
+// logged out with. Only the revoked tokens are stored, and only until they'd have expired.
+type AccessTokens struct {
+	store   TokenStore
+	timeNow func() time.Time
+}
+
+func NewAccessTokens(store TokenStore) *AccessTokens {
+	return &AccessTokens{store: store, timeNow: time.Now}
+}
+
+// Revoke revokes the access token with the ID until it expires
+func (a *AccessTokens) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	// expired tokens aren't accepted anyway
+	if tokenID == "" || !expiresAt.After(a.timeNow()) {
+		return nil
+	}
+	if err := a.store.RevokeAccessToken(ctx, tokenID, expiresAt); err != nil {
+		return fmt.Errorf("error revoking access token: %w", err)
+	}
+	return nil
+}
+
+// Claim revokes the token with the ID until it expires and reports whether it was this call that
+// did, so a token that may be used once is used by only one of any concurrent requests. Expired
+// tokens can't be claimed.
+func (a *AccessTokens) Claim(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	if tokenID == "" || !expiresAt.After(a.timeNow()) {
+		return false, nil
+	}
+	claimed, err := a.store.ClaimAccessToken(ctx, tokenID, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("error claiming token: %w", err)
+	}
+	return claimed, nil
+}
+
+// Revoked reports whether the access token with the ID was revoked
+func (a *AccessTokens) Revoked(ctx context.Context, tokenID string) (bool, error) {
+	if tokenID == "" {
+		return false, nil
+	}
+	revoked, err := a.store.AccessTokenRevoked(ctx, tokenID)
+	if err != nil {
+		return false, fmt.Errorf("error checking access token revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+// MemoryTokenStore is a TokenStore for a single process
+type MemoryTokenStore struct {
+	mu sync.Mutex
+	// tokens are the revoked token IDs and when the tokens expire
+	tokens  map[string]time.Time
+	timeNow func() time.Time
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens:  map[string]time.Time{},
+		timeNow: time.Now,
+	}
+}
+
+func (s *MemoryTokenStore) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	_, err := s.ClaimAccessToken(ctx, tokenID, expiresAt)
+	return err
+}
+
+func (s *MemoryTokenStore) ClaimAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// revocations are rare enough to clean up after on every one
+	now := s.timeNow()
+	for id, tokenExpiresAt := range s.tokens {
+		if !now.Before(tokenExpiresAt) {
+			delete(s.tokens, id)
+		}
+	}
+
+	if _, ok := s.tokens[tokenID]; ok {
+		return false, nil
+	}
+	s.tokens[tokenID] = expiresAt
+	return true, nil
+}
+
+func (s *MemoryTokenStore) AccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.tokens[tokenID]
+	return ok && s.timeNow().Before(expiresAt), nil
+}
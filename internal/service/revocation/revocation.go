@@ -0,0 +1,117 @@
+// Package revocation tracks revoked and already used signed refresh tokens, and revoked access
+// tokens. Entries expire with the tokens they cover, so the list stays small however many
+// tokens are issued.
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Store keeps keys that expire. lockout.Store satisfies it, so the list is shared between
+// replicas whenever the lockout counters are.
+type Store interface {
+	Block(ctx context.Context, key string, d time.Duration) error
+	BlockedFor(ctx context.Context, key string) (time.Duration, error)
+}
+
+type List struct {
+	store Store
+	// tokenTTL is the refresh token lifetime. Entries are kept this long so they outlive every
+	// token they cover.
+	tokenTTL time.Duration
+	timeNow  func() time.Time
+}
+
+func NewList(store Store, tokenTTL time.Duration) *List {
+	return &List{store: store, tokenTTL: tokenTTL, timeNow: time.Now}
+}
+
+func familyKey(family string) string {
+	return "refresh-family:" + family
+}
+
+func usedKey(family string, generation int) string {
+	return fmt.Sprintf("refresh-used:%s:%d", family, generation)
+}
+
+func graceKey(family string, generation int) string {
+	return fmt.Sprintf("refresh-grace:%s:%d", family, generation)
+}
+
+func accountKey(accountID string) string {
+	return "refresh-account:" + accountID
+}
+
+// RevokeFamily revokes every token of a family
+func (l *List) RevokeFamily(ctx context.Context, family string) error {
+	// the newest token in the family was issued no later than now, so it's expired by then
+	if err := l.store.Block(ctx, familyKey(family), l.tokenTTL); err != nil {
+		return fmt.Errorf("error revoking refresh token family: %w", err)
+	}
+	return nil
+}
+
+// FamilyRevoked reports whether the family was revoked
+func (l *List) FamilyRevoked(ctx context.Context, family string) (bool, error) {
+	d, err := l.store.BlockedFor(ctx, familyKey(family))
+	if err != nil {
+		return false, fmt.Errorf("error checking refresh token family: %w", err)
+	}
+	return d > 0, nil
+}
+
+// RevokeAccount revokes every token issued to the account up to now. Tokens issued afterwards
+// aren't affected.
+func (l *List) RevokeAccount(ctx context.Context, accountID string) error {
+	if err := l.store.Block(ctx, accountKey(accountID), l.tokenTTL); err != nil {
+		return fmt.Errorf("error revoking account refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// AccountRevokedAt returns when the account's tokens were last revoked, or the zero time if
+// they weren't within a token lifetime. Tokens issued before then are revoked.
+func (l *List) AccountRevokedAt(ctx context.Context, accountID string) (time.Time, error) {
+	remaining, err := l.store.BlockedFor(ctx, accountKey(accountID))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error checking account refresh tokens: %w", err)
+	}
+	if remaining <= 0 {
+		return time.Time{}, nil
+	}
+	// the store only keeps the expiry, which is a token lifetime after the revocation
+	return l.timeNow().Add(remaining - l.tokenTTL), nil
+}
+
+// Rotate marks a generation of a family as used until it expires. It reports reused if the
+// generation was already used more than grace ago, i.e. someone other than the client that
+// rotated it is holding the token.
+//
+// Checking and marking aren't atomic. Two refreshes racing each other can both succeed, which
+// is what the grace period allows for anyway.
+func (l *List) Rotate(ctx context.Context, family string, generation int, grace time.Duration) (reused bool, err error) {
+	used, err := l.store.BlockedFor(ctx, usedKey(family, generation))
+	if err != nil {
+		return false, fmt.Errorf("error checking refresh token use: %w", err)
+	}
+
+	if used > 0 {
+		inGrace, err := l.store.BlockedFor(ctx, graceKey(family, generation))
+		if err != nil {
+			return false, fmt.Errorf("error checking refresh token use: %w", err)
+		}
+		return inGrace == 0, nil
+	}
+
+	if grace > 0 {
+		if err := l.store.Block(ctx, graceKey(family, generation), grace); err != nil {
+			return false, fmt.Errorf("error marking refresh token used: %w", err)
+		}
+	}
+	if err := l.store.Block(ctx, usedKey(family, generation), l.tokenTTL); err != nil {
+		return false, fmt.Errorf("error marking refresh token used: %w", err)
+	}
+	return false, nil
+}
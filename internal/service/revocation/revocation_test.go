@@ -0,0 +1,142 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokeFamily(t *testing.T) {
+	ctx := context.Background()
+	list := NewList(lockout.NewMemoryStore(), time.Hour)
+
+	revoked, err := list.FamilyRevoked(ctx, "family-1")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, list.RevokeFamily(ctx, "family-1"))
+
+	revoked, err = list.FamilyRevoked(ctx, "family-1")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = list.FamilyRevoked(ctx, "family-2")
+	require.NoError(t, err)
+	assert.False(t, revoked, "other families aren't affected")
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		grace          time.Duration
+		wait           time.Duration
+		expectedReused bool
+	}{
+		{
+			name:           "reuse within the grace period",
+			grace:          time.Minute,
+			expectedReused: false,
+		},
+		{
+			name:           "reuse after the grace period",
+			grace:          time.Millisecond,
+			wait:           5 * time.Millisecond,
+			expectedReused: true,
+		},
+		{
+			name:           "reuse without a grace period",
+			expectedReused: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := NewList(lockout.NewMemoryStore(), time.Hour)
+
+			reused, err := list.Rotate(ctx, "family-1", 0, tt.grace)
+			require.NoError(t, err)
+			assert.False(t, reused, "first use")
+
+			time.Sleep(tt.wait)
+
+			reused, err = list.Rotate(ctx, "family-1", 0, tt.grace)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedReused, reused)
+
+			reused, err = list.Rotate(ctx, "family-1", 1, tt.grace)
+			require.NoError(t, err)
+			assert.False(t, reused, "the next generation is unused")
+		})
+	}
+}
+
+func TestRevokeAccount(t *testing.T) {
+	ctx := context.Background()
+	list := NewList(lockout.NewMemoryStore(), time.Hour)
+
+	revokedAt, err := list.AccountRevokedAt(ctx, "account-1")
+	require.NoError(t, err)
+	assert.True(t, revokedAt.IsZero())
+
+	require.NoError(t, list.RevokeAccount(ctx, "account-1"))
+
+	revokedAt, err = list.AccountRevokedAt(ctx, "account-1")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), revokedAt, time.Second)
+
+	revokedAt, err = list.AccountRevokedAt(ctx, "account-2")
+	require.NoError(t, err)
+	assert.True(t, revokedAt.IsZero(), "other accounts aren't affected")
+}
+
+func TestAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTokenStore()
+	tokens := NewAccessTokens(store)
+
+	now := time.Now()
+	require.NoError(t, tokens.Revoke(ctx, "token-1", now.Add(time.Minute)))
+	// an expired token is never stored
+	require.NoError(t, tokens.Revoke(ctx, "token-2", now.Add(-time.Minute)))
+
+	revoked, err := tokens.Revoked(ctx, "token-1")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = tokens.Revoked(ctx, "token-2")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	assert.NotContains(t, store.tokens, "token-2")
+
+	revoked, err = tokens.Revoked(ctx, "")
+	require.NoError(t, err)
+	assert.False(t, revoked, "tokens without an ID can't be revoked")
+
+	claimed, err := tokens.Claim(ctx, "token-4", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = tokens.Claim(ctx, "token-4", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed, "a token can only be claimed once")
+	claimed, err = tokens.Claim(ctx, "token-1", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed, "revoked tokens can't be claimed")
+	claimed, err = tokens.Claim(ctx, "token-5", now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed, "expired tokens can't be claimed")
+
+	// revocations are forgotten once the token expires
+	store.timeNow = func() time.Time { return now.Add(2 * time.Minute) }
+	revoked, err = tokens.Revoked(ctx, "token-1")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, store.RevokeAccessToken(ctx, "token-3", now.Add(time.Hour)))
+	assert.NotContains(t, store.tokens, "token-1", "expired revocations are cleaned up")
+}
@@ -0,0 +1,249 @@
+// Package saml signs accounts in through their organization's SAML 2.0 identity provider. This
+// service is the service provider (SP), with a separate entity ID, metadata, and assertion
+// consumer service (ACS) URL for each organization.
+package saml
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+const (
+	nameIDFormatEmail = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	// the NameID format requested from IdPs: a stable ID the IdP keeps for the user
+	nameIDFormatPersistent = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+)
+
+// emailAttributes are the attribute names IdPs commonly send the user's email as, in the order
+// they're looked for
+var emailAttributes = []string{
+	"email",
+	"mail",
+	"emailaddress",
+	"urn:oid:0.9.2342.19200300.100.1.3",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+}
+
+var (
+	// ErrInvalidMetadata is IdP metadata that can't be used to sign in
+	ErrInvalidMetadata = errors.New("invalid saml identity provider metadata")
+	// ErrInvalidResponse wraps every reason a SAML response is rejected
+	ErrInvalidResponse = errors.New("invalid saml response")
+)
+
+type Config struct {
+	// BaseURL is this service's public URL. An organization's SP URLs are under
+	// BaseURL + "/v1/saml/{organization ID}".
+	BaseURL string
+}
+
+// Identity is the user an IdP signed in
+type Identity struct {
+	// Subject is the NameID, the IdP's ID for the user
+	Subject string
+	// Email is empty if the IdP didn't send one
+	Email string
+}
+
+// Client builds SAML requests and validates the responses for each organization's IdP
+type Client struct {
+	baseURL string
+}
+
+func NewClient(cfg Config) *Client {
+	return &Client{baseURL: strings.TrimRight(cfg.BaseURL, "/")}
+}
+
+// ParseIdPMetadata checks that the metadata XML describes an IdP that can sign accounts in,
+// and returns its entity ID. It needs an HTTP-Redirect single sign on service and a signing
+// certificate.
+func ParseIdPMetadata(metadata string) (entityID string, err error) {
+	descriptor, err := parseIdPMetadata(metadata)
+	if err != nil {
+		return "", err
+	}
+	return descriptor.EntityID, nil
+}
+
+func parseIdPMetadata(metadata string) (*saml.EntityDescriptor, error) {
+	descriptor, err := samlsp.ParseMetadata([]byte(metadata))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	if descriptor.EntityID == "" {
+		return nil, fmt.Errorf("%w: missing entityID", ErrInvalidMetadata)
+	}
+
+	sp := saml.ServiceProvider{IDPMetadata: descriptor}
+	if sp.GetSSOBindingLocation(saml.HTTPRedirectBinding) == "" {
+		return nil, fmt.Errorf("%w: no HTTP-Redirect single sign on service", ErrInvalidMetadata)
+	}
+	hasSigningCert := false
+	for _, idp := range descriptor.IDPSSODescriptors {
+		for _, key := range idp.KeyDescriptors {
+			if (key.Use == "" || key.Use == "signing") && len(key.KeyInfo.X509Data.X509Certificates) > 0 {
+				hasSigningCert = true
+			}
+		}
+	}
+	if !hasSigningCert {
+		return nil, fmt.Errorf("%w: no signing certificate", ErrInvalidMetadata)
+	}
+
+	return descriptor, nil
+}
+
+// EntityID is this service's SAML entity ID for the organization, which is also the URL of its
+// metadata
+func (c *Client) EntityID(organizationID string) string {
+	return c.baseURL + "/v1/saml/" + url.PathEscape(organizationID) + "/metadata"
+}
+
+// ACSURL is where the organization's IdP posts its responses
+func (c *Client) ACSURL(organizationID string) string {
+	return c.baseURL + "/v1/saml/" + url.PathEscape(organizationID) + "/acs"
+}
+
+// LoginURL is where the web app sends the browser to sign in through the organization's IdP
+func (c *Client) LoginURL(organizationID string) string {
+	return c.baseURL + "/v1/saml/" + url.PathEscape(organizationID) + "/login"
+}
+
+// Metadata returns this service's SP metadata XML for the organization, for its IdP admins to
+// register the service with
+func (c *Client) Metadata(organizationID string) ([]byte, error) {
+	sp, err := c.serviceProvider(organizationID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := sp.Metadata()
+	// responses are only accepted posted to the ACS, artifacts aren't resolved
+	for i := range metadata.SPSSODescriptors {
+		descriptor := &metadata.SPSSODescriptors[i]
+		descriptor.AssertionConsumerServices = descriptor.AssertionConsumerServices[:1]
+	}
+
+	body, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding saml metadata: %w", err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// NewAuthnRequest returns the URL to send the user to to sign in at the organization's IdP, and
+// the request's ID, which the response has to be for
+func (c *Client) NewAuthnRequest(organizationID, idpMetadata string) (redirectURL, requestID string, err error) {
+	descriptor, err := parseIdPMetadata(idpMetadata)
+	if err != nil {
+		return "", "", err
+	}
+	sp, err := c.serviceProvider(organizationID, descriptor)
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", fmt.Errorf("error making saml authn request: %w", err)
+	}
+	redirect, err := req.Redirect("", sp)
+	if err != nil {
+		return "", "", fmt.Errorf("error making saml authn request: %w", err)
+	}
+
+	return redirect.String(), req.ID, nil
+}
+
+// ParseResponse validates a base64 SAMLResponse the organization's IdP posted to the ACS and
+// returns who it signed in. The response or its assertion has to be signed by the IdP, addressed
+// to this service, current, and in response to the request with the ID. Any validation failure
+// wraps ErrInvalidResponse.
+func (c *Client) ParseResponse(organizationID, idpMetadata, samlResponse, requestID string) (*Identity, error) {
+	descriptor, err := parseIdPMetadata(idpMetadata)
+	if err != nil {
+		return nil, err
+	}
+	sp, err := c.serviceProvider(organizationID, descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	assertion, err := sp.ParseXMLResponse(decoded, []string{requestID}, sp.AcsURL)
+	if err != nil {
+		// the error says nothing on purpose, the reason is in PrivateErr
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) && invalid.PrivateErr != nil {
+			err = invalid.PrivateErr
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, fmt.Errorf("%w: missing NameID", ErrInvalidResponse)
+	}
+
+	identity := &Identity{Subject: assertion.Subject.NameID.Value, Email: assertionEmail(assertion)}
+	return identity, nil
+}
+
+func (c *Client) serviceProvider(organizationID string, idpMetadata *saml.EntityDescriptor) (*saml.ServiceProvider, error) {
+	metadataURL, err := url.Parse(c.EntityID(organizationID))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing saml metadata url: %w", err)
+	}
+	acsURL, err := url.Parse(c.ACSURL(organizationID))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing saml acs url: %w", err)
+	}
+
+	return &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: nameIDFormatPersistent,
+		// every sign in starts here so it can be tied to the browser that started it
+		AllowIDPInitiated: false,
+	}, nil
+}
+
+// assertionEmail finds the user's email in the assertion's attributes, falling back to the
+// NameID when it's an email address
+func assertionEmail(assertion *saml.Assertion) string {
+	values := map[string]string{}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if len(attribute.Values) == 0 {
+				continue
+			}
+			for _, name := range []string{attribute.Name, attribute.FriendlyName} {
+				if name != "" {
+					values[strings.ToLower(name)] = strings.TrimSpace(attribute.Values[0].Value)
+				}
+			}
+		}
+	}
+	for _, name := range emailAttributes {
+		if email := values[name]; email != "" {
+			return email
+		}
+	}
+
+	if nameID := assertion.Subject.NameID; nameID.Format == nameIDFormatEmail {
+		return strings.TrimSpace(nameID.Value)
+	}
+	return ""
+}
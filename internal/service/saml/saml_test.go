@@ -0,0 +1,198 @@
+package saml
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOrganizationID = "0b9f4c3e-7d0a-4d8e-9a43-2f9c1f5e6a01"
+
+// testIdP is an identity provider that signs in whoever the test says
+type testIdP struct {
+	idp *saml.IdentityProvider
+	sp  *saml.EntityDescriptor
+}
+
+func newTestIdP(t *testing.T, spMetadata []byte) *testIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	var sp saml.EntityDescriptor
+	require.NoError(t, xml.Unmarshal(spMetadata, &sp))
+
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	test := &testIdP{sp: &sp}
+	test.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: test,
+	}
+	return test
+}
+
+func (i *testIdP) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if serviceProviderID != i.sp.EntityID {
+		return nil, os.ErrNotExist
+	}
+	return i.sp, nil
+}
+
+func (i *testIdP) metadata(t *testing.T) string {
+	t.Helper()
+	metadata, err := xml.Marshal(i.idp.Metadata())
+	require.NoError(t, err)
+	return string(metadata)
+}
+
+// respond signs the session in, in response to the authn request the redirect URL carries, and
+// returns the base64 SAMLResponse
+func (i *testIdP) respond(t *testing.T, redirectURL string, session *saml.Session) string {
+	t.Helper()
+
+	req, err := saml.NewIdpAuthnRequest(i.idp, httptest.NewRequest(http.MethodGet, redirectURL, nil))
+	require.NoError(t, err)
+	require.NoError(t, req.Validate())
+	require.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(req, session))
+	require.NoError(t, req.MakeAssertionEl())
+	form, err := req.PostBinding()
+	require.NoError(t, err)
+	return form.SAMLResponse
+}
+
+func TestServiceProvider(t *testing.T) {
+	client := NewClient(Config{BaseURL: "https://accounts.example.com/"})
+
+	spMetadata, err := client.Metadata(testOrganizationID)
+	require.NoError(t, err)
+	var sp saml.EntityDescriptor
+	require.NoError(t, xml.Unmarshal(spMetadata, &sp))
+	assert.Equal(t, "https://accounts.example.com/v1/saml/"+testOrganizationID+"/metadata", sp.EntityID)
+	require.Len(t, sp.SPSSODescriptors, 1)
+	require.Len(t, sp.SPSSODescriptors[0].AssertionConsumerServices, 1)
+	assert.Equal(t, saml.HTTPPostBinding, sp.SPSSODescriptors[0].AssertionConsumerServices[0].Binding)
+	assert.Equal(t, client.ACSURL(testOrganizationID), sp.SPSSODescriptors[0].AssertionConsumerServices[0].Location)
+	assert.Equal(t, "https://accounts.example.com/v1/saml/"+testOrganizationID+"/login", client.LoginURL(testOrganizationID))
+
+	idp := newTestIdP(t, spMetadata)
+	idpMetadata := idp.metadata(t)
+
+	entityID, err := ParseIdPMetadata(idpMetadata)
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.example.com/metadata", entityID)
+
+	session := &saml.Session{
+		ID:           "session-1",
+		CreateTime:   time.Now(),
+		ExpireTime:   time.Now().Add(time.Hour),
+		NameID:       "user-1",
+		NameIDFormat: nameIDFormatPersistent,
+		UserEmail:    "user@example.com",
+	}
+
+	t.Run("signed response to our request", func(t *testing.T) {
+		redirectURL, requestID, err := client.NewAuthnRequest(testOrganizationID, idpMetadata)
+		require.NoError(t, err)
+		assert.Contains(t, redirectURL, "https://idp.example.com/sso?SAMLRequest=")
+		assert.NotEmpty(t, requestID)
+
+		response := idp.respond(t, redirectURL, session)
+		identity, err := client.ParseResponse(testOrganizationID, idpMetadata, response, requestID)
+		require.NoError(t, err)
+		assert.Equal(t, &Identity{Subject: "user-1", Email: "user@example.com"}, identity)
+	})
+
+	t.Run("response to another request", func(t *testing.T) {
+		redirectURL, _, err := client.NewAuthnRequest(testOrganizationID, idpMetadata)
+		require.NoError(t, err)
+
+		response := idp.respond(t, redirectURL, session)
+		_, err = client.ParseResponse(testOrganizationID, idpMetadata, response, "id-other")
+		assert.ErrorIs(t, err, ErrInvalidResponse)
+	})
+
+	t.Run("response signed by another idp", func(t *testing.T) {
+		redirectURL, requestID, err := client.NewAuthnRequest(testOrganizationID, idpMetadata)
+		require.NoError(t, err)
+
+		// same entity ID and URLs, different key
+		other := newTestIdP(t, spMetadata)
+		response := other.respond(t, redirectURL, session)
+		_, err = client.ParseResponse(testOrganizationID, idpMetadata, response, requestID)
+		assert.ErrorIs(t, err, ErrInvalidResponse)
+	})
+
+	t.Run("response for another organization", func(t *testing.T) {
+		redirectURL, requestID, err := client.NewAuthnRequest(testOrganizationID, idpMetadata)
+		require.NoError(t, err)
+
+		response := idp.respond(t, redirectURL, session)
+		_, err = client.ParseResponse("4d1e2f3a-0000-4000-8000-000000000000", idpMetadata, response, requestID)
+		assert.ErrorIs(t, err, ErrInvalidResponse)
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		_, err := client.ParseResponse(testOrganizationID, idpMetadata, "not base64!", "id-1")
+		assert.ErrorIs(t, err, ErrInvalidResponse)
+	})
+}
+
+func TestParseIdPMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata string
+	}{
+		{name: "not xml", metadata: "idp"},
+		{
+			name: "no signing certificate",
+			metadata: `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com">
+				<IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+					<SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+				</IDPSSODescriptor>
+			</EntityDescriptor>`,
+		},
+		{
+			name: "no redirect binding",
+			metadata: `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" entityID="https://idp.example.com">
+				<IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+					<KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>MIIB</ds:X509Certificate></ds:X509Data></ds:KeyInfo></KeyDescriptor>
+					<SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso"/>
+				</IDPSSODescriptor>
+			</EntityDescriptor>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseIdPMetadata(tt.metadata)
+			assert.ErrorIs(t, err, ErrInvalidMetadata)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Package scheduler runs the service's background jobs on intervals. Stopping it cancels the jobs
+// and waits for the ones running to finish, so a shutdown doesn't cut a purge off halfway.
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Job is run every Interval, and once right away when the scheduler starts
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Run does one round of the job. A failed round is logged and retried on the next tick.
+	Run func(ctx context.Context) error
+}
+
+// Scheduler runs jobs until it's stopped
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    []Job
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add adds a job. Jobs added after Start aren't run.
+func (s *Scheduler) Add(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+}
+
+// Start runs every job in its own goroutine until Stop is called or ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, job := range s.jobs {
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			run(ctx, job)
+		}()
+	}
+}
+
+// Stop cancels the jobs and waits for them to return, or for ctx to be done
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func run(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job.Run(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "error running scheduled job", "job", job.Name, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
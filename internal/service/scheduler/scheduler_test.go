@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler(t *testing.T) {
+	var ok, failing atomic.Int32
+	s := New()
+	s.Add(Job{Name: "ok", Interval: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+		ok.Add(1)
+		return nil
+	}})
+	s.Add(Job{Name: "failing", Interval: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+		failing.Add(1)
+		return errors.New("connection refused")
+	}})
+
+	s.Start(context.Background())
+
+	// every job runs on its interval, failed runs are retried
+	assert.Eventually(t, func() bool { return ok.Load() >= 3 && failing.Load() >= 3 }, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Stop(ctx))
+
+	// nothing runs after Stop returns
+	runs := ok.Load()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, runs, ok.Load())
+}
+
+func TestStopWaitsForRunningJobs(t *testing.T) {
+	started := make(chan struct{})
+	var finished atomic.Bool
+	s := New()
+	s.Add(Job{Name: "slow", Interval: time.Hour, Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+		return ctx.Err()
+	}})
+
+	s.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Stop(ctx))
+	assert.True(t, finished.Load())
+}
+
+func TestStopTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	s := New()
+	s.Add(Job{Name: "stuck", Interval: time.Hour, Run: func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}})
+
+	s.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Stop(ctx), context.DeadlineExceeded)
+}
@@ -0,0 +1,146 @@
+// Package secrets resolves settings that reference secrets kept outside the environment instead
+// of holding them: files mounted into the container, HashiCorp Vault, and AWS Secrets Manager.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	SchemeFile  = "file"
+	SchemeVault = "vault"
+	SchemeAWS   = "awssm"
+)
+
+var (
+	// ErrNoProvider is a reference to a provider that isn't configured
+	ErrNoProvider = errors.New("secrets provider isn't configured")
+	// ErrKeyNotFound is a reference to a key the secret doesn't have
+	ErrKeyNotFound = errors.New("secret has no such key")
+)
+
+// Reference points to a secret, written as scheme://path#key:
+//
+//	file:///run/secrets/jwt-secret-key
+//	vault://secret/data/account-management#jwt_secret_key
+//	awssm://prod/account-management#jwt_secret_key
+//
+// Key picks one value out of a secret holding several. It's required for Vault, and for AWS
+// names a field of a JSON secret. Files are the whole secret, less a trailing new line.
+type Reference struct {
+	Scheme string
+	Path   string
+	Key    string
+}
+
+// ParseReference parses a setting's value as a reference. ok is false for plain values.
+func ParseReference(value string) (ref Reference, ok bool) {
+	scheme, rest, found := strings.Cut(value, "://")
+	if !found {
+		return Reference{}, false
+	}
+	switch scheme {
+	case SchemeFile, SchemeVault, SchemeAWS:
+	default:
+		return Reference{}, false
+	}
+
+	ref.Scheme = scheme
+	ref.Path = rest
+	if i := strings.LastIndexByte(rest, '#'); i >= 0 {
+		ref.Path, ref.Key = rest[:i], rest[i+1:]
+	}
+	return ref, ref.Path != ""
+}
+
+func (r Reference) String() string {
+	s := r.Scheme + "://" + r.Path
+	if r.Key != "" {
+		s += "#" + r.Key
+	}
+	return s
+}
+
+// Provider fetches secrets from one place
+type Provider interface {
+	Fetch(ctx context.Context, ref Reference) (string, error)
+}
+
+// Resolver fetches references from the provider for their scheme
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// Config configures the providers. Files can always be read, Vault needs VaultAddress, and AWS
+// Secrets Manager AWS.Region.
+type Config struct {
+	Vault VaultConfig
+	AWS   AWSConfig
+}
+
+func NewResolver(cfg Config) *Resolver {
+	r := &Resolver{providers: map[string]Provider{SchemeFile: FileProvider{}}}
+	if cfg.Vault.Address != "" {
+		r.providers[SchemeVault] = NewVaultProvider(cfg.Vault)
+	}
+	if cfg.AWS.Region != "" {
+		r.providers[SchemeAWS] = NewAWSProvider(cfg.AWS)
+	}
+	return r
+}
+
+// Resolve returns the secret a reference points to. It fails with ErrNoProvider when the
+// reference's provider isn't configured.
+func (r *Resolver) Resolve(ctx context.Context, ref Reference) (string, error) {
+	provider, ok := r.providers[ref.Scheme]
+	if !ok {
+		return "", fmt.Errorf("error resolving %s: %w", ref, ErrNoProvider)
+	}
+	secret, err := provider.Fetch(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("error resolving %s: %w", ref, err)
+	}
+	return secret, nil
+}
+
+// FileProvider reads secrets from files, like the ones Kubernetes mounts. file:///abs/path is
+// absolute, file://rel/path relative to the working directory.
+type FileProvider struct{}
+
+func (FileProvider) Fetch(ctx context.Context, ref Reference) (string, error) {
+	b, err := os.ReadFile(ref.Path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimRight(string(b), "\r\n")
+	if ref.Key != "" {
+		return jsonKey(secret, ref.Key)
+	}
+	return secret, nil
+}
+
+// jsonKey is the key of a JSON object secret. Values that aren't strings are returned as JSON.
+func jsonKey(secret, key string) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret with a key isn't a JSON object: %w", err)
+	}
+	return field(fields, key)
+}
+
+func field(fields map[string]json.RawMessage, key string) (string, error) {
+	raw, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,153 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := map[string]Reference{
+		"file:///run/secrets/jwt":                               {Scheme: SchemeFile, Path: "/run/secrets/jwt"},
+		"vault://secret/data/account-management#jwt_secret_key": {Scheme: SchemeVault, Path: "secret/data/account-management", Key: "jwt_secret_key"},
+		"awssm://arn:aws:secretsmanager:us-east-1:123456789012:secret:prod#psql_url": {
+			Scheme: SchemeAWS, Path: "arn:aws:secretsmanager:us-east-1:123456789012:secret:prod", Key: "psql_url",
+		},
+	}
+	for value, want := range tests {
+		ref, ok := ParseReference(value)
+		require.True(t, ok, value)
+		assert.Equal(t, want, ref)
+		assert.Equal(t, value, ref.String())
+	}
+
+	for _, value := range []string{"a-plain-secret", "postgres://localhost/accounts", "file://", ""} {
+		_, ok := ParseReference(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "jwt"), []byte("mounted-secret\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db.json"), []byte(`{"url": "postgres://db/accounts", "port": 5432}`), 0o600))
+
+	resolver := NewResolver(Config{})
+	ctx := context.Background()
+
+	secret, err := resolver.Resolve(ctx, Reference{Scheme: SchemeFile, Path: filepath.Join(dir, "jwt")})
+	require.NoError(t, err)
+	assert.Equal(t, "mounted-secret", secret)
+
+	secret, err = resolver.Resolve(ctx, Reference{Scheme: SchemeFile, Path: filepath.Join(dir, "db.json"), Key: "url"})
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://db/accounts", secret)
+	secret, err = resolver.Resolve(ctx, Reference{Scheme: SchemeFile, Path: filepath.Join(dir, "db.json"), Key: "port"})
+	require.NoError(t, err)
+	assert.Equal(t, "5432", secret)
+
+	_, err = resolver.Resolve(ctx, Reference{Scheme: SchemeFile, Path: filepath.Join(dir, "db.json"), Key: "password"})
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = resolver.Resolve(ctx, Reference{Scheme: SchemeFile, Path: filepath.Join(dir, "missing")})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	// the other providers need configuring
+	_, err = resolver.Resolve(ctx, Reference{Scheme: SchemeVault, Path: "secret/data/x", Key: "y"})
+	assert.ErrorIs(t, err, ErrNoProvider)
+}
+
+func TestResolveVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/account-management":
+			w.Write([]byte(`{"data": {"data": {"jwt_secret_key": "from-kv2"}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/account-management":
+			w.Write([]byte(`{"data": {"jwt_secret_key": "from-kv1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(Config{Vault: VaultConfig{Address: server.URL + "/", Token: "vault-token", Namespace: "team"}})
+	ctx := context.Background()
+
+	secret, err := resolver.Resolve(ctx, Reference{Scheme: SchemeVault, Path: "secret/data/account-management", Key: "jwt_secret_key"})
+	require.NoError(t, err)
+	assert.Equal(t, "from-kv2", secret)
+
+	secret, err = resolver.Resolve(ctx, Reference{Scheme: SchemeVault, Path: "kv/account-management", Key: "jwt_secret_key"})
+	require.NoError(t, err)
+	assert.Equal(t, "from-kv1", secret)
+
+	_, err = resolver.Resolve(ctx, Reference{Scheme: SchemeVault, Path: "kv/missing", Key: "jwt_secret_key"})
+	assert.ErrorContains(t, err, "status 404")
+	_, err = resolver.Resolve(ctx, Reference{Scheme: SchemeVault, Path: "kv/account-management"})
+	assert.ErrorContains(t, err, "#key")
+}
+
+func TestResolveAWS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "session-token", r.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20260101/eu-west-1/secretsmanager/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, Signature="))
+
+		var req struct{ SecretId string }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		switch req.SecretId {
+		case "prod/account-management":
+			w.Write([]byte(`{"Name": "prod/account-management", "SecretString": "{\"jwt_secret_key\": \"from-aws\"}"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ResourceNotFoundException", "message": "Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(Config{AWS: AWSConfig{
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "session-token",
+		Endpoint:        server.URL,
+		now:             func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}})
+	ctx := context.Background()
+
+	secret, err := resolver.Resolve(ctx, Reference{Scheme: SchemeAWS, Path: "prod/account-management", Key: "jwt_secret_key"})
+	require.NoError(t, err)
+	assert.Equal(t, "from-aws", secret)
+
+	secret, err = resolver.Resolve(ctx, Reference{Scheme: SchemeAWS, Path: "prod/account-management"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"jwt_secret_key": "from-aws"}`, secret)
+
+	_, err = resolver.Resolve(ctx, Reference{Scheme: SchemeAWS, Path: "staging/account-management"})
+	assert.ErrorContains(t, err, "ResourceNotFoundException")
+}
+
+func TestSignV4(t *testing.T) {
+	// the get-vanilla case from the AWS Signature Version 4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	signV4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
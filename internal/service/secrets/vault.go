@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds each fetch so a slow secrets store doesn't hold up startup forever
+const DefaultTimeout = 10 * time.Second
+
+type VaultConfig struct {
+	// Address is the Vault server, e.g. "https://vault.internal:8200"
+	Address string
+	Token   string
+	// Namespace is the Vault Enterprise namespace, if any
+	Namespace string
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// VaultProvider reads keys of secrets from Vault's KV secrets engine, version 1 or 2. The path is
+// the API path after /v1/, which for version 2 includes data/, e.g.
+// vault://secret/data/account-management#jwt_secret_key.
+type VaultProvider struct {
+	cfg VaultConfig
+}
+
+func NewVaultProvider(cfg VaultConfig) *VaultProvider {
+	cfg.Address = strings.TrimSuffix(cfg.Address, "/")
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return &VaultProvider{cfg: cfg}
+}
+
+func (p *VaultProvider) Fetch(ctx context.Context, ref Reference) (string, error) {
+	if ref.Key == "" {
+		return "", errors.New("vault references need a #key")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Address+"/v1/"+strings.TrimPrefix(ref.Path, "/"), nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.cfg.Token)
+	if p.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.cfg.Namespace)
+	}
+
+	resp, err := p.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error from vault: status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error decoding vault response: %w", err)
+	}
+
+	// version 2 nests the secret's keys under data.data, next to data.metadata
+	fields := body.Data
+	if nested, ok := fields["data"]; ok {
+		if _, versioned := fields["metadata"]; versioned {
+			fields = nil
+			if err := json.Unmarshal(nested, &fields); err != nil {
+				return "", fmt.Errorf("error decoding vault response: %w", err)
+			}
+		}
+	}
+	return field(fields, ref.Key)
+}
@@ -0,0 +1,48 @@
+// Package sms sends one-time codes to phones, as text messages or voice calls. Messages are
+// delivered by a Sender: Twilio's API, or a log-only sender for development.
+package sms
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Channel is how a message reaches the phone
+type Channel string
+
+const (
+	ChannelSMS   Channel = "sms"
+	ChannelVoice Channel = "voice"
+)
+
+// Message is an outbound text message, or the words a voice call reads out.
+type Message struct {
+	// To is the phone number in E.164 format, e.g. "+14155550123"
+	To      string
+	Body    string
+	Channel Channel
+}
+
+// Sender delivers messages to phones.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender "sends" messages by logging them. Used for local development where we don't want
+// to hit a real SMS provider.
+type LogSender struct {
+	logger *slog.Logger
+}
+
+func NewLogSender(logger *slog.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	s.logger.InfoContext(ctx, "message not sent (log only SMS provider)",
+		"to", msg.To,
+		"channel", string(msg.Channel),
+		"body", msg.Body,
+	)
+	return nil
+}
@@ -0,0 +1,81 @@
+package sms
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultTwilioURL = "https://api.twilio.com/2010-04-01"
+
+type TwilioConfig struct {
+	AccountSID string
+	AuthToken  string
+	// From is the Twilio phone number messages and calls come from, in E.164 format
+	From string
+	// URL and HTTPClient default to Twilio's 2010-04-01 API and http.DefaultClient
+	URL        string
+	HTTPClient *http.Client
+}
+
+// TwilioSender delivers text messages with Twilio's Messages API and voice calls with its
+// Calls API
+type TwilioSender struct {
+	cfg TwilioConfig
+}
+
+func NewTwilioSender(cfg TwilioConfig) *TwilioSender {
+	if cfg.URL == "" {
+		cfg.URL = DefaultTwilioURL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+
+	return &TwilioSender{cfg: cfg}
+}
+
+type twilioSay struct {
+	XMLName xml.Name `xml:"Response"`
+	Say     string   `xml:"Say"`
+}
+
+func (s *TwilioSender) Send(ctx context.Context, msg Message) error {
+	form := url.Values{"To": {msg.To}, "From": {s.cfg.From}}
+	resource := "Messages.json"
+	if msg.Channel == ChannelVoice {
+		twiml, err := xml.Marshal(twilioSay{Say: msg.Body})
+		if err != nil {
+			return fmt.Errorf("error encoding TwiML: %w", err)
+		}
+		form.Set("Twiml", string(twiml))
+		resource = "Calls.json"
+	} else {
+		form.Set("Body", msg.Body)
+	}
+
+	endpoint := strings.TrimRight(s.cfg.URL, "/") + "/Accounts/" + url.PathEscape(s.cfg.AccountSID) + "/" + resource
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating Twilio request: %w", err)
+	}
+	req.SetBasicAuth(s.cfg.AccountSID, s.cfg.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling Twilio: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 201 Created means the message or call was queued
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error from Twilio: status %d: %s", resp.StatusCode, detail)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package sms
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwilioSender(t *testing.T) {
+	var path string
+	var received url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "AC123" || pass != "test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code":20003,"message":"Authenticate"}`))
+			return
+		}
+		require.NoError(t, r.ParseForm())
+		path, received = r.URL.Path, r.PostForm
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(server.Close)
+
+	sender := NewTwilioSender(TwilioConfig{AccountSID: "AC123", AuthToken: "test-token", From: "+15005550006", URL: server.URL})
+
+	t.Run("text message", func(t *testing.T) {
+		require.NoError(t, sender.Send(context.Background(), Message{To: "+14155550123", Body: "Your code is 123456", Channel: ChannelSMS}))
+
+		assert.Equal(t, "/Accounts/AC123/Messages.json", path)
+		assert.Equal(t, url.Values{
+			"To":   {"+14155550123"},
+			"From": {"+15005550006"},
+			"Body": {"Your code is 123456"},
+		}, received)
+	})
+
+	t.Run("voice call", func(t *testing.T) {
+		require.NoError(t, sender.Send(context.Background(), Message{To: "+14155550123", Body: "Your code is 1 2 3 & 4", Channel: ChannelVoice}))
+
+		assert.Equal(t, "/Accounts/AC123/Calls.json", path)
+		assert.Equal(t, "<Response><Say>Your code is 1 2 3 &amp; 4</Say></Response>", received.Get("Twiml"))
+		assert.Empty(t, received.Get("Body"))
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		sender := NewTwilioSender(TwilioConfig{AccountSID: "AC123", AuthToken: "wrong-token", From: "+15005550006", URL: server.URL})
+		err := sender.Send(context.Background(), Message{To: "+14155550123", Body: "Your code is 123456"})
+		assert.ErrorContains(t, err, "status 401")
+	})
+}
@@ -0,0 +1,80 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are created with the global tracer
+// provider, which records nothing until Setup installs one that exports over OTLP.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+type Config struct {
+	// Endpoint is the URL of the OTLP/HTTP collector, e.g. "http://otel-collector:4318". Spans
+	// are sent to its /v1/traces. Tracing is off without it.
+	Endpoint string
+	// Headers are sent with every export, e.g. an API key for a hosted collector
+	Headers map[string]string
+	// ServiceName identifies this service in traces
+	ServiceName string
+	// SampleRatio is the share of new traces that are recorded, from 0 to 1. Requests that
+	// already carry a sampled trace are always recorded.
+	SampleRatio float64
+}
+
+// Setup installs an OTLP exporting tracer provider and W3C trace context propagation as the
+// globals. The returned function flushes buffered spans and has to be called on shutdown.
+// With no endpoint nothing is installed and spans are dropped.
+func Setup(ctx context.Context, cfg Config) (func(ctx context.Context) error, error) {
+	// incoming trace context is propagated even when we don't export, so downstream services
+	// still see one trace
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// like OTEL_EXPORTER_OTLP_ENDPOINT, the endpoint is the collector's base URL
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("error parsing OTLP endpoint %q: expected a URL like http://otel-collector:4318", cfg.Endpoint)
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint.JoinPath("v1", "traces").String())}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error creating tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.ForceFlush(ctx), provider.Shutdown(ctx))
+	}, nil
+}
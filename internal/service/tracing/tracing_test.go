@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("nothing is exported without an endpoint", func(t *testing.T) {
+		shutdown, err := Setup(ctx, Config{ServiceName: "test"})
+		require.NoError(t, err)
+		require.NoError(t, shutdown(ctx))
+	})
+
+	t.Run("endpoint has to be a URL", func(t *testing.T) {
+		_, err := Setup(ctx, Config{Endpoint: "otel-collector:4318", ServiceName: "test"})
+		require.Error(t, err)
+	})
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&buf, nil))).With("service", "test")
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+
+	logger.InfoContext(ctx, "in a span")
+	logger.InfoContext(context.Background(), "no span")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var inSpan, noSpan map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &inSpan))
+	require.NoError(t, json.Unmarshal(lines[1], &noSpan))
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", inSpan["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", inSpan["span_id"])
+	assert.Equal(t, "test", inSpan["service"])
+	assert.NotContains(t, noSpan, "trace_id")
+}
@@ -0,0 +1,146 @@
+// Package webhooks posts account events to the endpoints other services registered for them.
+//
+// Events are queued as rows in webhook_deliveries and a Worker posts them, retrying failures with
+// exponential backoff. Every post is signed so receivers can check it came from here:
+//
+//	X-Webhook-Id:        the delivery's ID, the same on every retry so receivers can dedupe
+//	X-Webhook-Event:     the event type, e.g. account.created
+//	X-Webhook-Timestamp: unix seconds when the attempt was signed
+//	X-Webhook-Signature: hex HMAC-SHA256 of "<timestamp>.<body>" with the endpoint's secret
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/google/uuid"
+)
+
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Event types endpoints can subscribe to. These are part of the webhook contract so keep them
+// stable.
+const (
+	EventAccountCreated  = "account.created"
+	EventAccountDeleted  = "account.deleted"
+	EventLoginFailed     = "login.failed"
+	EventPasswordChanged = "password.changed"
+)
+
+// EventTypes are every event type endpoints can subscribe to
+var EventTypes = []string{EventAccountCreated, EventAccountDeleted, EventLoginFailed, EventPasswordChanged}
+
+// ValidEventType reports whether endpoints can subscribe to eventType
+func ValidEventType(eventType string) bool {
+	return slices.Contains(EventTypes, eventType)
+}
+
+// auditEventTypes maps the audit events that are also webhook events
+var auditEventTypes = map[string]string{
+	database.AuditEventAccountCreated:  EventAccountCreated,
+	database.AuditEventAccountDeleted:  EventAccountDeleted,
+	database.AuditEventLoginFailed:     EventLoginFailed,
+	database.AuditEventPasswordChanged: EventPasswordChanged,
+	database.AuditEventPasswordReset:   EventPasswordChanged,
+}
+
+// Payload is the JSON body posted to endpoints
+type Payload struct {
+	// ID identifies the event. Every endpoint subscribed to it gets the same ID.
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      PayloadData `json:"data"`
+}
+
+type PayloadData struct {
+	// AccountID is empty for failed logins with an email that has no account
+	AccountID string `json:"account_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Publisher queues events for the endpoints subscribed to them
+type Publisher struct {
+	createDeliveries func(ctx context.Context, eventType, payload string) (int64, error)
+	timeNow          func() time.Time
+}
+
+// NewPublisher returns a publisher that queues deliveries with createDeliveries, usually the
+// database's CreateWebhookDeliveries
+func NewPublisher(createDeliveries func(ctx context.Context, eventType, payload string) (int64, error)) *Publisher {
+	return &Publisher{createDeliveries: createDeliveries, timeNow: time.Now}
+}
+
+// Publish queues the event for every endpoint subscribed to its type
+func (p *Publisher) Publish(ctx context.Context, eventType string, data PayloadData) error {
+	payload, err := json.Marshal(Payload{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		CreatedAt: p.timeNow().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding webhook payload: %w", err)
+	}
+
+	if _, err := p.createDeliveries(ctx, eventType, string(payload)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromAuditEvents wraps create, usually the database's CreateAuditEvent, so audit events that
+// are also webhook events get published once they're recorded. Wrap the audit log writer's
+// create so publishing happens in the background too.
+func (p *Publisher) FromAuditEvents(create audit.CreateFunc) audit.CreateFunc {
+	return func(ctx context.Context, params database.CreateAuditEventParams) error {
+		if err := create(ctx, params); err != nil {
+			return err
+		}
+
+		eventType, ok := auditEventTypes[params.EventType]
+		if !ok {
+			return nil
+		}
+		return p.Publish(ctx, eventType, PayloadData{
+			AccountID: params.AccountID,
+			RequestID: params.RequestID,
+		})
+	}
+}
+
+// Sign returns the X-Webhook-Signature for body signed at timestamp
+func Sign(secret []byte, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature the way receivers should: in constant time, and only for posts
+// signed within maxSkew of now
+func Verify(secret []byte, timestampHeader, signature string, body []byte, now time.Time, maxSkew time.Duration) bool {
+	unix, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return false
+	}
+	timestamp := time.Unix(unix, 0)
+	if now.Sub(timestamp).Abs() > maxSkew {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
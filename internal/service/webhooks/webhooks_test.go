@@ -0,0 +1,148 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret := []byte("webhook-secret")
+	now := time.Now()
+	body := []byte(`{"type":"account.created"}`)
+
+	sig := Sign(secret, now, body)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	assert.True(t, Verify(secret, ts, sig, body, now, time.Minute))
+	assert.False(t, Verify([]byte("other-secret"), ts, sig, body, now, time.Minute))
+	assert.False(t, Verify(secret, ts, sig, []byte(`{"type":"account.deleted"}`), now, time.Minute))
+	assert.False(t, Verify(secret, ts, sig, body, now.Add(time.Hour), time.Minute), "stale signatures are replays")
+	assert.False(t, Verify(secret, "not-a-timestamp", sig, body, now, time.Minute))
+}
+
+func TestFromAuditEvents(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemoryDB()
+
+	endpoint, err := db.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{
+		URL:        "https://hooks.example.com",
+		Secret:     "secret",
+		EventTypes: []string{EventAccountCreated, EventPasswordChanged},
+	})
+	require.NoError(t, err)
+
+	create := NewPublisher(db.CreateWebhookDeliveries).FromAuditEvents(db.CreateAuditEvent)
+	for _, eventType := range []string{database.AuditEventAccountCreated, database.AuditEventLogin, database.AuditEventPasswordReset, database.AuditEventLoginFailed} {
+		require.NoError(t, create(ctx, database.CreateAuditEventParams{AccountID: "account-id", EventType: eventType, RequestID: "req-1"}))
+	}
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{EndpointID: endpoint.ID})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2, "only the subscribed webhook events are queued")
+
+	var types []string
+	for _, d := range deliveries {
+		types = append(types, d.EventType)
+		var payload Payload
+		require.NoError(t, json.Unmarshal([]byte(d.Payload), &payload))
+		assert.Equal(t, d.EventType, payload.Type)
+		assert.Equal(t, "account-id", payload.Data.AccountID)
+		assert.Equal(t, "req-1", payload.Data.RequestID)
+	}
+	assert.ElementsMatch(t, []string{EventAccountCreated, EventPasswordChanged}, types)
+}
+
+func TestWorker(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemoryDB()
+
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, r)
+		bodies = append(bodies, body)
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	endpoint, err := db.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{
+		URL:        server.URL,
+		Secret:     "secret",
+		EventTypes: []string{EventAccountDeleted},
+	})
+	require.NoError(t, err)
+	require.NoError(t, NewPublisher(db.CreateWebhookDeliveries).Publish(ctx, EventAccountDeleted, PayloadData{AccountID: "account-id"}))
+
+	now := time.Now()
+	cfg := Config{Interval: time.Second, BatchSize: 10, Timeout: time.Second, MaxAttempts: 3, BaseBackoff: time.Minute, MaxBackoff: time.Hour}
+	worker := NewWorker(db, cfg)
+	worker.timeNow = func() time.Time { return now }
+
+	delivery := func() database.WebhookDelivery {
+		deliveries, err := db.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{EndpointID: endpoint.ID})
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		return deliveries[0]
+	}
+
+	n, err := worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	require.Len(t, received, 1)
+	req := received[0]
+	assert.Equal(t, EventAccountDeleted, req.Header.Get(HeaderEvent))
+	assert.Equal(t, delivery().ID, req.Header.Get(HeaderID))
+	assert.True(t, Verify([]byte("secret"), req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderSignature), bodies[0], now, time.Minute))
+
+	failed := delivery()
+	assert.Equal(t, database.WebhookDeliveryPending, failed.Status)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, failed.LastStatusCode)
+	assert.True(t, now.Add(time.Minute).Equal(failed.NextAttemptAt))
+
+	// not due again until the backoff is over
+	n, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	now = now.Add(time.Minute)
+	_, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.True(t, now.Add(2*time.Minute).Equal(delivery().NextAttemptAt), "the backoff doubles")
+
+	now = now.Add(2 * time.Minute)
+	_, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, database.WebhookDeliveryFailed, delivery().Status, "gives up after MaxAttempts")
+
+	// replaying gets it through once the endpoint is back
+	failing = false
+	_, err = db.ReplayWebhookDelivery(ctx, delivery().ID, now)
+	require.NoError(t, err)
+	_, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+
+	delivered := delivery()
+	assert.Equal(t, database.WebhookDeliveryDelivered, delivered.Status)
+	assert.Equal(t, http.StatusOK, delivered.LastStatusCode)
+	assert.NotNil(t, delivered.DeliveredAt)
+	assert.Len(t, received, 4)
+}
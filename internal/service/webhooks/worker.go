@@ -0,0 +1,177 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+)
+
+// Store is what the worker needs from the database
+type Store interface {
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]database.WebhookDelivery, error)
+	GetWebhookEndpoint(ctx context.Context, id string) (*database.WebhookEndpoint, error)
+	RecordWebhookAttempt(ctx context.Context, id string, attempt database.WebhookAttempt) error
+}
+
+type Config struct {
+	// Interval is how often due deliveries are posted
+	Interval time.Duration
+	// BatchSize is how many deliveries are claimed at a time
+	BatchSize int
+	// Timeout is how long an endpoint has to answer
+	Timeout time.Duration
+	// MaxAttempts is how many times a delivery is tried before it's marked failed
+	MaxAttempts int
+	// The wait before retrying doubles after every failed attempt, starting at BaseBackoff and
+	// up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval:    time.Second,
+		BatchSize:   20,
+		Timeout:     10 * time.Second,
+		MaxAttempts: 8,
+		BaseBackoff: 30 * time.Second,
+		MaxBackoff:  6 * time.Hour,
+	}
+}
+
+// Worker posts queued deliveries to their endpoints
+type Worker struct {
+	store   Store
+	client  *http.Client
+	cfg     Config
+	timeNow func() time.Time
+}
+
+func NewWorker(store Store, cfg Config) *Worker {
+	return &Worker{
+		store:   store,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		cfg:     cfg,
+		timeNow: time.Now,
+	}
+}
+
+// Run posts due deliveries every interval until ctx is done
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		// failed claims are retried on the next tick
+		if _, err := w.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "error delivering webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue posts the deliveries that are due and returns how many were attempted
+func (w *Worker) DeliverDue(ctx context.Context) (int, error) {
+	// claimed deliveries aren't claimed again until every one of them had its chance to time out
+	lease := w.cfg.Timeout*time.Duration(w.cfg.BatchSize) + time.Minute
+	deliveries, err := w.store.ClaimWebhookDeliveries(ctx, w.timeNow(), lease, w.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range deliveries {
+		w.deliver(ctx, delivery)
+	}
+	return len(deliveries), nil
+}
+
+func (w *Worker) deliver(ctx context.Context, delivery database.WebhookDelivery) {
+	log := slog.With("delivery_id", delivery.ID, "endpoint_id", delivery.EndpointID, "event_type", delivery.EventType)
+
+	endpoint, err := w.store.GetWebhookEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		// deleted endpoints take their deliveries with them, so this is a database error. The
+		// lease runs out and it's claimed again.
+		log.ErrorContext(ctx, "error getting webhook endpoint", "error", err)
+		return
+	}
+
+	statusCode, err := w.post(ctx, endpoint, delivery)
+
+	now := w.timeNow()
+	attempt := database.WebhookAttempt{
+		Status:         database.WebhookDeliveryDelivered,
+		NextAttemptAt:  now,
+		LastStatusCode: statusCode,
+		At:             now,
+	}
+	if err != nil {
+		attempt.LastError = err.Error()
+		attempt.Status = database.WebhookDeliveryPending
+		attempt.NextAttemptAt = now.Add(w.backoff(delivery.Attempts + 1))
+		if delivery.Attempts+1 >= w.cfg.MaxAttempts {
+			attempt.Status = database.WebhookDeliveryFailed
+		}
+		log.WarnContext(ctx, "webhook delivery failed", "attempt", delivery.Attempts+1, "status", attempt.Status, "error", err)
+	}
+
+	if err := w.store.RecordWebhookAttempt(ctx, delivery.ID, attempt); err != nil {
+		log.ErrorContext(ctx, "error recording webhook attempt", "error", err)
+	}
+}
+
+// post sends the delivery and returns the response's status code, 0 without a response. Any
+// status but 2xx is an error.
+func (w *Worker) post(ctx context.Context, endpoint *database.WebhookEndpoint, delivery database.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error building request: %w", err)
+	}
+
+	now := w.timeNow()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign([]byte(endpoint.Secret), now, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain a little so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.New("endpoint answered " + resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is how long to wait before the attempt after the given one
+func (w *Worker) backoff(attempt int) time.Duration {
+	wait := w.cfg.BaseBackoff
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if wait >= w.cfg.MaxBackoff {
+			return w.cfg.MaxBackoff
+		}
+	}
+	return wait
+}
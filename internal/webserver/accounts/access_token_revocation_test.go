@@ -0,0 +1,83 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessTokenRevocation(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	db := database.NewMemoryDB()
+	_, err = db.CreateAccount(ctx, database.AccountCreationParams{Email: "revoke@test.com", PasswordHash: hashedPassword})
+	require.NoError(t, err)
+
+	h := NewHandler(HandlerDeps{
+		DB:                     db,
+		AuthClient:             authClient,
+		Mailer:                 &recordingMailer{},
+		AccessTokenRevocations: revocation.NewAccessTokens(revocation.NewMemoryTokenStore()),
+	})
+
+	do := func(method, path, accessToken, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, jsonBody(body))
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	login := func(t *testing.T, password string) loginOrRefreshResponse {
+		w := do(http.MethodPost, "/login", "", `{"email":"revoke@test.com","password":"`+password+`"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, http.StatusOK, do(http.MethodGet, "/me", resp.AccessToken, "").Code)
+		return resp
+	}
+
+	t.Run("logout revokes the access token it's sent with", func(t *testing.T) {
+		session := login(t, "Test123!@#")
+		other := login(t, "Test123!@#")
+
+		w := do(http.MethodPost, "/logout", session.AccessToken, `{"refresh_token":"`+session.RefreshToken+`"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/me", session.AccessToken, "").Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/me", other.AccessToken, "").Code, "other sessions aren't affected")
+	})
+
+	t.Run("logout everywhere revokes the caller's access token", func(t *testing.T) {
+		session := login(t, "Test123!@#")
+
+		w := do(http.MethodPost, "/logout-all", session.AccessToken, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/me", session.AccessToken, "").Code)
+	})
+
+	t.Run("changing the password revokes the caller's access token", func(t *testing.T) {
+		session := login(t, "Test123!@#")
+
+		w := do(http.MethodPost, "/password/change", session.AccessToken, `{"current_password":"Test123!@#","new_password":"NewTest123!@#"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/me", session.AccessToken, "").Code)
+		login(t, "NewTest123!@#")
+	})
+}
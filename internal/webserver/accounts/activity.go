@@ -0,0 +1,109 @@
+package accounts
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/webserver/auditexport"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	chimiddleware "github.com/go-chi/chi/middleware"
+)
+
+// activityPageLimits are how many events a page of activity has
+var activityPageLimits = httputils.PageLimits{Default: 20, Max: 100}
+
+type activityEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type activityResponse struct {
+	Activity   []activityEvent `json:"activity"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// exportActivity streams the authenticated account's full audit history, see auditexport.Stream
+func (h *handler) exportActivity(w http.ResponseWriter, r *http.Request) {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+	auditexport.Stream(w, r, h.db, claims.AccountID)
+}
+
+// activity returns the authenticated account's recent security activity, newest first.
+func (h *handler) activity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	page, err := httputils.ParsePageRequest(r, activityPageLimits)
+	if err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    err.Error(),
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	params := database.ListAuditEventsParams{
+		AccountID: claims.AccountID,
+		Keyset: database.Keyset{
+			BeforeCreatedAt: page.After.CreatedAt,
+			BeforeID:        page.After.ID,
+			// fetch one extra to know if there's another page
+			Limit: page.Limit + 1,
+		},
+	}
+
+	events, err := h.db.ListAuditEvents(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing audit events", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error getting account activity",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	response := activityResponse{Activity: []activityEvent{}}
+	events, response.NextCursor = httputils.Paginate(events, page.Limit, func(e database.AuditEvent) httputils.Cursor {
+		return httputils.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+
+	for _, e := range events {
+		response.Activity = append(response.Activity, activityEvent{
+			ID:        e.ID,
+			Type:      e.EventType,
+			ActorID:   e.ActorID,
+			IPAddress: e.IPAddress,
+			UserAgent: e.UserAgent,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, response)
+}
+
+// recordAuditEvent records a security event for the account. Failures are logged but never
+// fail the request since the action itself already happened.
+func (h *handler) recordAuditEvent(ctx context.Context, r *http.Request, accountID, eventType string) {
+	auditLog := h.auditLog
+	if auditLog == nil {
+		auditLog = audit.Sync(h.db.CreateAuditEvent)
+	}
+	auditLog.Record(ctx, database.CreateAuditEventParams{
+		AccountID: accountID,
+		EventType: eventType,
+		IPAddress: httputils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: chimiddleware.GetReqID(ctx),
+	})
+}
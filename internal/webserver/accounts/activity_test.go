@@ -0,0 +1,235 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivity(t *testing.T) {
+	now := time.Now().UTC()
+	eventIDs := []string{uuid.NewString(), uuid.NewString(), uuid.NewString()}
+
+	events := func(n int) []database.AuditEvent {
+		var result []database.AuditEvent
+		for i := 0; i < n; i++ {
+			result = append(result, database.AuditEvent{
+				ID:        eventIDs[i],
+				AccountID: "test-account-id",
+				EventType: database.AuditEventLogin,
+				IPAddress: "127.0.0.1",
+				CreatedAt: now.Add(-time.Duration(i) * time.Minute),
+			})
+		}
+		return result
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		setupMocks       func(*mockDBRepository)
+		expectedStatus   int
+		expectedResponse func(t *testing.T, body []byte)
+	}{
+		{
+			name:  "first page with more results",
+			query: "?limit=2",
+			setupMocks: func(repo *mockDBRepository) {
+				repo.listAuditEventsFn = func(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error) {
+					assert.Equal(t, "test-account-id", params.AccountID)
+					assert.Equal(t, 3, params.Limit)
+					assert.True(t, params.BeforeCreatedAt.IsZero())
+					return events(3), nil
+				}
+			},
+			expectedStatus: http.StatusOK,
+			expectedResponse: func(t *testing.T, body []byte) {
+				var resp activityResponse
+				require.NoError(t, json.Unmarshal(body, &resp))
+				require.Len(t, resp.Activity, 2)
+				assert.Equal(t, database.AuditEventLogin, resp.Activity[0].Type)
+
+				cursor, err := httputils.DecodeCursor(resp.NextCursor)
+				require.NoError(t, err)
+				assert.Equal(t, eventIDs[1], cursor.ID)
+				assert.True(t, now.Add(-time.Minute).Equal(cursor.CreatedAt))
+			},
+		},
+		{
+			name:  "next page from cursor",
+			query: "?cursor=" + httputils.Cursor{CreatedAt: now, ID: eventIDs[0]}.Encode(),
+			setupMocks: func(repo *mockDBRepository) {
+				repo.listAuditEventsFn = func(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error) {
+					assert.True(t, now.Equal(params.BeforeCreatedAt))
+					assert.Equal(t, eventIDs[0], params.BeforeID)
+					assert.Equal(t, activityPageLimits.Default+1, params.Limit)
+					return events(1), nil
+				}
+			},
+			expectedStatus: http.StatusOK,
+			expectedResponse: func(t *testing.T, body []byte) {
+				var resp activityResponse
+				require.NoError(t, json.Unmarshal(body, &resp))
+				assert.Len(t, resp.Activity, 1)
+				assert.Empty(t, resp.NextCursor)
+			},
+		},
+		{
+			name:           "no activity",
+			expectedStatus: http.StatusOK,
+			expectedResponse: func(t *testing.T, body []byte) {
+				assert.JSONEq(t, `{"activity":[]}`, string(body))
+			},
+		},
+		{
+			name:           "invalid limit",
+			query:          "?limit=1000",
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "invalid cursor",
+			query:          "?cursor=garbage!",
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "database error",
+			setupMocks: func(repo *mockDBRepository) {
+				repo.listAuditEventsFn = func(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error) {
+					return nil, errors.New("database error")
+				}
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedResponse: func(t *testing.T, body []byte) {
+				var resp httputils.ErrorResponse
+				require.NoError(t, json.Unmarshal(body, &resp))
+				assert.Contains(t, resp.Message, "unexpected error")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockDBRepository{}
+
+			if tt.setupMocks != nil {
+				tt.setupMocks(repo)
+			}
+
+			h := createTestHandler(repo)
+
+			req := httptest.NewRequest(http.MethodGet, "/me/activity"+tt.query, nil)
+			req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: "test-account-id"}))
+			w := httptest.NewRecorder()
+
+			h.activity(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedResponse != nil {
+				tt.expectedResponse(t, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestLoginRecordsAuditEvent(t *testing.T) {
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	var recorded []database.CreateAuditEventParams
+	repo := &mockDBRepository{
+		getAccountFn: func(ctx context.Context, email string) (*database.Account, error) {
+			return &database.Account{ID: "test-account-id", Email: email, PasswordHash: hashedPassword}, nil
+		},
+		createAuditEventFn: func(ctx context.Context, params database.CreateAuditEventParams) error {
+			recorded = append(recorded, params)
+			return nil
+		},
+	}
+
+	h := createTestHandler(repo)
+
+	req := httptest.NewRequest(http.MethodPost, "/login", jsonBody(`{"email":"test@example.com","password":"Test123!@#"}`))
+	req.Header.Set("User-Agent", "test-agent")
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+
+	h.login(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, database.CreateAuditEventParams{
+		AccountID: "test-account-id",
+		EventType: database.AuditEventLogin,
+		IPAddress: "10.0.0.1",
+		UserAgent: "test-agent",
+	}, recorded[0])
+}
+
+func TestFailedLoginRecordsAuditEvent(t *testing.T) {
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	var recorded []database.CreateAuditEventParams
+	repo := &mockDBRepository{
+		getAccountFn: func(ctx context.Context, email string) (*database.Account, error) {
+			if email != "test@example.com" {
+				return nil, database.ErrAccountNotFound
+			}
+			return &database.Account{ID: "test-account-id", Email: email, PasswordHash: hashedPassword}, nil
+		},
+		createAuditEventFn: func(ctx context.Context, params database.CreateAuditEventParams) error {
+			recorded = append(recorded, params)
+			return nil
+		},
+	}
+
+	h := createTestHandler(repo)
+
+	for _, body := range []string{
+		`{"email":"test@example.com","password":"Wrong123!@#"}`,
+		`{"email":"nobody@example.com","password":"Test123!@#"}`,
+	} {
+		w := httptest.NewRecorder()
+		h.login(w, httptest.NewRequest(http.MethodPost, "/login", jsonBody(body)))
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	require.Len(t, recorded, 2)
+	assert.Equal(t, database.AuditEventLoginFailed, recorded[0].EventType)
+	assert.Equal(t, "test-account-id", recorded[0].AccountID)
+	assert.Equal(t, database.AuditEventLoginFailed, recorded[1].EventType)
+	assert.Empty(t, recorded[1].AccountID, "there's no account to attach it to")
+}
+
+func TestExportActivity(t *testing.T) {
+	var listed database.ListAuditEventsParams
+	repo := &mockDBRepository{
+		listAuditEventsFn: func(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error) {
+			listed = params
+			return nil, nil
+		},
+	}
+	h := createTestHandler(repo)
+
+	req := httptest.NewRequest(http.MethodGet, "/me/activity/export?format=ndjson", nil)
+	req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: "test-account-id"}))
+	w := httptest.NewRecorder()
+	h.exportActivity(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, "test-account-id", listed.AccountID)
+}
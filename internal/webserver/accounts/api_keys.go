@@ -0,0 +1,251 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	errTypeAPIKeyNotFound = "api_key_not_found"
+
+	unexpectedAPIKeyError = "There was an unexpected error managing API keys"
+
+	maxAPIKeyNameLength = 255
+	// apiKeyTouchInterval is how often a key's last use is recorded, so busy keys don't write
+	// on every request
+	apiKeyTouchInterval = time.Minute
+)
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is optional, keys without it don't expire
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type apiKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type createAPIKeyResponse struct {
+	apiKey
+	// Key is only ever returned here
+	Key string `json:"key"`
+}
+
+type listAPIKeysResponse struct {
+	APIKeys []apiKey `json:"api_keys"`
+}
+
+// createAPIKey issues the caller a long-lived API key restricted to the requested scopes. The
+// key is only in this response, it's stored hashed.
+func (h *handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	var reqBody createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	name := strings.TrimSpace(reqBody.Name)
+	scopes := slices.Compact(slices.Sorted(slices.Values(reqBody.Scopes)))
+	var validationMessage string
+	switch {
+	case name == "" || len(name) > maxAPIKeyNameLength:
+		validationMessage = "The API key needs a name of at most 255 characters"
+	case len(scopes) == 0:
+		validationMessage = "The API key needs at least one scope"
+	case !auth.ValidScopes(scopes):
+		validationMessage = "The API key scopes must be from: " + strings.Join(auth.Scopes, ", ")
+	case reqBody.ExpiresAt != nil && !reqBody.ExpiresAt.After(time.Now()):
+		validationMessage = "The API key expiry must be in the future"
+	}
+	if validationMessage != "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    validationMessage,
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	key, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating api key", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedAPIKeyError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	params := database.CreateAPIKeyParams{
+		AccountID: claims.AccountID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashOpaqueToken(key),
+		Scopes:    scopes,
+	}
+	if reqBody.ExpiresAt != nil {
+		params.ExpiresAt = *reqBody.ExpiresAt
+	}
+	created, err := h.db.CreateAPIKey(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating api key", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedAPIKeyError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, claims.AccountID, database.AuditEventAPIKeyCreated)
+
+	httputils.WriteJSONResponse(w, r, http.StatusCreated, createAPIKeyResponse{
+		apiKey: toAPIKey(*created),
+		Key:    key,
+	})
+}
+
+// listAPIKeys lists the caller's API keys, newest first, without the keys themselves
+func (h *handler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	keys, err := h.db.ListAPIKeys(ctx, claims.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing api keys", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedAPIKeyError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	response := listAPIKeysResponse{APIKeys: make([]apiKey, 0, len(keys))}
+	for _, key := range keys {
+		response.APIKeys = append(response.APIKeys, toAPIKey(key))
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, response)
+}
+
+// revokeAPIKey deletes one of the caller's API keys. It stops working right away.
+func (h *handler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeAPIKeyNotFound(w, r)
+		return
+	}
+
+	// another account's key isn't found either, so IDs can't be probed
+	if err := h.db.DeleteAPIKey(ctx, claims.AccountID, id); err != nil {
+		if errors.Is(err, database.ErrAPIKeyNotFound) {
+			writeAPIKeyNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error revoking api key", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedAPIKeyError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, claims.AccountID, database.AuditEventAPIKeyRevoked)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
+		"message": "API key revoked",
+	})
+}
+
+// AuthenticateAPIKey implements middleware.APIKeyAuthenticator. Keys of frozen accounts are
+// rejected like expired ones.
+func (h *handler) AuthenticateAPIKey(ctx context.Context, key string) (*auth.APIKey, error) {
+	if !strings.HasPrefix(key, auth.APIKeyPrefix) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	stored, err := h.db.GetAPIKeyByHash(ctx, auth.HashOpaqueToken(key))
+	if err != nil {
+		if errors.Is(err, database.ErrAPIKeyNotFound) {
+			return nil, auth.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if stored.ExpiresAt != nil && !stored.ExpiresAt.After(now) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	account, err := h.db.GetAccountByID(ctx, stored.AccountID)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return nil, auth.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if account.FrozenAt != nil {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) >= apiKeyTouchInterval {
+		if err := h.db.TouchAPIKey(ctx, stored.ID, now); err != nil {
+			// the key still works, only its last use is out of date
+			slog.WarnContext(ctx, "error recording api key use", "error", err)
+		}
+	}
+
+	return &auth.APIKey{ID: stored.ID, AccountID: stored.AccountID, Scopes: stored.Scopes}, nil
+}
+
+func toAPIKey(key database.APIKey) apiKey {
+	return apiKey{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+func writeAPIKeyNotFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "API key not found",
+		Type:       errTypeAPIKeyNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
@@ -0,0 +1,156 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*handler, *database.MemoryDB, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "apikeys@test.com"})
+		require.NoError(t, err)
+		return withService(&handler{db: db, mailer: &recordingMailer{}}), db, account
+	}
+
+	create := func(h *handler, accountID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/me/api-keys", strings.NewReader(body))
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		h.createAPIKey(w, req)
+		return w
+	}
+
+	list := func(h *handler, accountID string) []apiKey {
+		req := httptest.NewRequest(http.MethodGet, "/me/api-keys", nil)
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		h.listAPIKeys(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp listAPIKeysResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.APIKeys
+	}
+
+	revoke := func(h *handler, accountID, id string) *httptest.ResponseRecorder {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req := httptest.NewRequest(http.MethodDelete, "/me/api-keys/"+id, nil)
+		reqCtx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		req = req.WithContext(middleware.WithClaims(reqCtx, &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		h.revokeAPIKey(w, req)
+		return w
+	}
+
+	t.Run("created keys authenticate until they're revoked", func(t *testing.T) {
+		h, db, account := setup(t)
+
+		w := create(h, account.ID, `{"name":" ci ","scopes":["sessions:write","account:read","account:read"]}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created createAPIKeyResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, "ci", created.Name)
+		assert.True(t, strings.HasPrefix(created.Key, created.Prefix+"_"))
+		assert.Equal(t, []string{auth.ScopeAccountRead, auth.ScopeSessionsWrite}, created.Scopes)
+		assert.Nil(t, created.ExpiresAt)
+
+		// only the hash is stored
+		stored, err := db.GetAPIKeyByHash(ctx, auth.HashOpaqueToken(created.Key))
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, stored.AccountID)
+
+		key, err := h.AuthenticateAPIKey(ctx, created.Key)
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, key.AccountID)
+		assert.True(t, key.HasScope(auth.ScopeSessionsWrite))
+
+		keys := list(h, account.ID)
+		require.Len(t, keys, 1)
+		assert.Equal(t, created.ID, keys[0].ID)
+		assert.NotNil(t, keys[0].LastUsedAt, "authenticating records the key's use")
+
+		// other accounts can't see or revoke it
+		assert.Empty(t, list(h, "other-account"))
+		assert.Equal(t, http.StatusNotFound, revoke(h, "other-account", created.ID).Code)
+
+		w = revoke(h, account.ID, created.ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		_, err = h.AuthenticateAPIKey(ctx, created.Key)
+		require.ErrorIs(t, err, auth.ErrInvalidAPIKey)
+
+		w = revoke(h, account.ID, created.ID)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = revoke(h, account.ID, "not-a-uuid")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		h, _, account := setup(t)
+
+		past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+		for name, body := range map[string]string{
+			"no name":         `{"name":"","scopes":["account:read"]}`,
+			"no scopes":       `{"name":"ci","scopes":[]}`,
+			"unknown scope":   `{"name":"ci","scopes":["account:delete"]}`,
+			"already expired": `{"name":"ci","scopes":["account:read"],"expires_at":"` + past + `"}`,
+		} {
+			t.Run(name, func(t *testing.T) {
+				w := create(h, account.ID, body)
+				require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+				var resp httputils.ErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, errTypeValidationError, resp.Type)
+			})
+		}
+
+		w := create(h, account.ID, `{"name":`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("expired keys and frozen accounts are rejected", func(t *testing.T) {
+		h, db, account := setup(t)
+
+		expiring, _, err := auth.NewAPIKey()
+		require.NoError(t, err)
+		_, err = db.CreateAPIKey(ctx, database.CreateAPIKeyParams{
+			AccountID: account.ID,
+			Name:      "expired",
+			KeyHash:   auth.HashOpaqueToken(expiring),
+			Scopes:    []string{auth.ScopeAccountRead},
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		require.NoError(t, err)
+		_, err = h.AuthenticateAPIKey(ctx, expiring)
+		require.ErrorIs(t, err, auth.ErrInvalidAPIKey)
+
+		w := create(h, account.ID, `{"name":"ci","scopes":["account:read"]}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created createAPIKeyResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+		_, err = db.FreezeAccount(ctx, account.ID)
+		require.NoError(t, err)
+		_, err = h.AuthenticateAPIKey(ctx, created.Key)
+		require.ErrorIs(t, err, auth.ErrInvalidAPIKey)
+
+		_, err = h.AuthenticateAPIKey(ctx, "not-an-api-key")
+		require.ErrorIs(t, err, auth.ErrInvalidAPIKey)
+	})
+}
@@ -0,0 +1,184 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/i18n"
+	"github.com/austinwofford/account-management/internal/service/apple"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeInvalidAppleCredential = "invalid_apple_credential"
+
+// AppleAuthenticator verifies Sign in with Apple authorization codes. apple.Client implements it.
+type AppleAuthenticator interface {
+	Authenticate(ctx context.Context, code string) (*apple.Identity, error)
+}
+
+type appleLoginRequest struct {
+	// Code is the authorization code from Apple
+	Code string `json:"code"`
+	// User is only sent by Apple the first time a user authorizes the app, so the name has
+	// to be captured then or never
+	User *appleUser `json:"user"`
+	// DeviceToken is from an earlier login that trusted the device, it skips MFA
+	DeviceToken string `json:"device_token"`
+}
+
+type appleUser struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+}
+
+func (u *appleUser) fullName() string {
+	if u == nil {
+		return ""
+	}
+	return strings.TrimSpace(u.Name.FirstName + " " + u.Name.LastName)
+}
+
+// loginWithApple signs in with an Apple authorization code. The Apple user is matched to an
+// account by their Apple ID, then by verified email (linking the existing account), and
+// otherwise a new passwordless account is created. Accounts with MFA enabled get an MFA challenge.
+func (h *handler) loginWithApple(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody appleLoginRequest
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil || reqBody.Code == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	identity, err := h.apple.Authenticate(ctx, reqBody.Code)
+	if err != nil {
+		if errors.Is(err, apple.ErrInvalidCredential) {
+			slog.InfoContext(ctx, "rejected apple credential", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The Apple credential is invalid or expired",
+				Type:       errTypeInvalidAppleCredential,
+				StatusCode: http.StatusUnauthorized,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error authenticating with apple", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedLoginError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	accountID, errResponse := h.accountForAppleIdentity(ctx, r, identity, reqBody.User.fullName())
+	if errResponse != nil {
+		httputils.WriteErrorResponse(w, r, *errResponse)
+		return
+	}
+
+	account, err := h.db.GetAccountByID(ctx, accountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting account for apple login", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedLoginError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+	if account.FrozenAt != nil {
+		writeAccountFrozen(w, r)
+		return
+	}
+
+	client := h.client(r)
+	client.DeviceToken = reqBody.DeviceToken
+	h.writeIdentityLogin(w, r, accountID, client)
+}
+
+func (h *handler) accountForAppleIdentity(ctx context.Context, r *http.Request, identity *apple.Identity, name string) (string, *httputils.ErrorResponse) {
+	unexpectedErr := &httputils.ErrorResponse{
+		Message:    unexpectedLoginError,
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	existing, err := h.db.GetAccountIdentity(ctx, database.IdentityProviderApple, identity.Subject)
+	if err == nil {
+		return existing.AccountID, nil
+	}
+	if !errors.Is(err, database.ErrAccountIdentityNotFound) {
+		slog.ErrorContext(ctx, "error getting apple identity", "error", err)
+		return "", unexpectedErr
+	}
+
+	// first sign in with this Apple ID
+	if identity.Email == "" {
+		return "", &httputils.ErrorResponse{
+			Message:    "Apple did not share an email address for this account",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		}
+	}
+
+	account, err := h.db.GetAccount(ctx, identity.Email)
+	switch {
+	case err == nil:
+		// only link to an existing account when Apple vouches for the email, otherwise anyone
+		// could take over an account by claiming its address. The account's email has to be
+		// verified too: anyone can register an address they don't own and wait for its owner to
+		// sign in with Apple, and their password would keep working on the linked account.
+		if !identity.EmailVerified || account.VerifiedAt == nil {
+			return "", &httputils.ErrorResponse{
+				Message:    "An account with this email already exists",
+				Type:       errTypeAccountAlreadyExists,
+				StatusCode: http.StatusConflict,
+			}
+		}
+	case errors.Is(err, database.ErrAccountNotFound):
+		// no password: the account can only sign in with Apple until one is set
+		account, err = h.db.CreateAccount(ctx, database.AccountCreationParams{
+			Email:           identity.Email,
+			PreferredLocale: i18n.LocaleFromContext(ctx),
+			Verified:        identity.EmailVerified,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "error creating account for apple identity", "error", err)
+			return "", unexpectedErr
+		}
+		h.recordAuditEvent(ctx, r, account.ID, database.AuditEventAccountCreated)
+	default:
+		slog.ErrorContext(ctx, "error getting account for apple identity", "error", err)
+		return "", unexpectedErr
+	}
+
+	_, err = h.db.CreateAccountIdentity(ctx, database.CreateAccountIdentityParams{
+		AccountID: account.ID,
+		Provider:  database.IdentityProviderApple,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		Name:      name,
+	})
+	if err != nil {
+		// a concurrent first sign in won the race, use whatever it linked
+		if errors.Is(err, database.ErrAccountIdentityAlreadyExists) {
+			if existing, err := h.db.GetAccountIdentity(ctx, database.IdentityProviderApple, identity.Subject); err == nil {
+				return existing.AccountID, nil
+			}
+		}
+		slog.ErrorContext(ctx, "error linking apple identity", "error", err)
+		return "", unexpectedErr
+	}
+	h.recordAuditEvent(ctx, r, account.ID, database.AuditEventIdentityLinked)
+
+	return account.ID, nil
+}
@@ -0,0 +1,155 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/apple"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/totp"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeApple returns the identity registered for a code
+type fakeApple map[string]*apple.Identity
+
+func (f fakeApple) Authenticate(ctx context.Context, code string) (*apple.Identity, error) {
+	identity, ok := f[code]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown code", apple.ErrInvalidCredential)
+	}
+	return identity, nil
+}
+
+func TestLoginWithApple(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	existing, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "existing@test.com", PasswordHash: "hash", Verified: true})
+	require.NoError(t, err)
+	// registered by someone who doesn't own the address
+	_, err = db.CreateAccount(ctx, database.AccountCreationParams{Email: "pending@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	h := withService(&handler{
+		db:         db,
+		authClient: auth.NewClient(auth.Config{JWTSecretKey: "test-secret-key", AccessTokenTTLMinutes: 15}),
+		apple: fakeApple{
+			"new-user":            {Subject: "apple-new", Email: "new@test.com", EmailVerified: true},
+			"existing-verified":   {Subject: "apple-existing", Email: "existing@test.com", EmailVerified: true},
+			"existing-unverified": {Subject: "apple-unverified", Email: "existing@test.com"},
+			"pending":             {Subject: "apple-pending", Email: "pending@test.com", EmailVerified: true},
+			"no-email":            {Subject: "apple-no-email"},
+			"mfa":                 {Subject: "apple-mfa", Email: "mfa@test.com", EmailVerified: true},
+		},
+	})
+
+	login := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login/apple", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.loginWithApple(w, req)
+		return w
+	}
+
+	accountID := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.AccessToken)
+		assert.NotEmpty(t, resp.RefreshToken)
+		return resp.AccountID
+	}
+
+	errorType := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		var resp httputils.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Type
+	}
+
+	t.Run("first sign in creates an account and captures the name", func(t *testing.T) {
+		w := login(`{"code":"new-user","user":{"name":{"firstName":"Jane","lastName":"Appleseed"}}}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		id := accountID(t, w)
+
+		account, err := db.GetAccount(ctx, "new@test.com")
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, id)
+		assert.Empty(t, account.PasswordHash)
+
+		identity, err := db.GetAccountIdentity(ctx, database.IdentityProviderApple, "apple-new")
+		require.NoError(t, err)
+		assert.Equal(t, "Jane Appleseed", identity.Name)
+
+		// later sign ins find the same account without the user payload
+		w = login(`{"code":"new-user"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, id, accountID(t, w))
+	})
+
+	t.Run("verified email links an existing account", func(t *testing.T) {
+		w := login(`{"code":"existing-verified"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, existing.ID, accountID(t, w))
+	})
+
+	t.Run("unverified email doesn't link an existing account", func(t *testing.T) {
+		w := login(`{"code":"existing-unverified"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, errTypeAccountAlreadyExists, errorType(t, w))
+	})
+
+	t.Run("doesn't link an account whose email isn't verified", func(t *testing.T) {
+		w := login(`{"code":"pending"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, errTypeAccountAlreadyExists, errorType(t, w))
+
+		_, err := db.GetAccountIdentity(ctx, database.IdentityProviderApple, "apple-pending")
+		assert.ErrorIs(t, err, database.ErrAccountIdentityNotFound)
+		account, err := db.GetAccount(ctx, "pending@test.com")
+		require.NoError(t, err)
+		assert.Nil(t, account.VerifiedAt)
+	})
+
+	t.Run("MFA still has to be completed", func(t *testing.T) {
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "mfa@test.com", PasswordHash: "hash", Verified: true})
+		require.NoError(t, err)
+		secret, err := totp.GenerateSecret()
+		require.NoError(t, err)
+		require.NoError(t, db.SetMFASecret(ctx, account.ID, secret))
+		_, err = db.EnableMFA(ctx, account.ID, totp.Step(time.Now())-1)
+		require.NoError(t, err)
+
+		w := login(`{"code":"mfa"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp mfaChallengeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.MFARequired)
+		assert.NotEmpty(t, resp.MFAChallenge)
+		assert.Equal(t, []string{"totp"}, resp.MFAMethods)
+	})
+
+	t.Run("missing email", func(t *testing.T) {
+		w := login(`{"code":"no-email"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		w := login(`{"code":"made-up"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, errTypeInvalidAppleCredential, errorType(t, w))
+	})
+
+	t.Run("missing code", func(t *testing.T) {
+		w := login(`{}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,189 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/captcha"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const (
+	errTypeCaptchaRequired = "captcha_required"
+	errTypeInvalidCaptcha  = "invalid_captcha"
+	errTypeRateLimited     = "rate_limited"
+
+	// DefaultEmailAvailabilityLimit is how many availability checks a client IP gets per minute
+	DefaultEmailAvailabilityLimit = 10
+)
+
+// CaptchaVerifier checks a captcha response from the client. captcha.Client implements it.
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// NewEmailAvailabilityLimiter allows limit availability checks per client per minute
+func NewEmailAvailabilityLimiter(store lockout.Store, limit int) *lockout.Guard {
+	return lockout.NewGuard(store, lockout.Config{
+		Window:          time.Minute,
+		MaxAttempts:     limit,
+		LockoutDuration: time.Minute,
+	})
+}
+
+type emailAvailabilityResponse struct {
+	Email     string `json:"email"`
+	Available bool   `json:"available"`
+}
+
+type usernameAvailabilityResponse struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+}
+
+// emailAvailability tells signup forms whether an email is already taken. Every check counts
+// against the client's rate limit. A captcha response in captcha_token is verified when a
+// captcha is configured, and in enumeration-safe mode the answer is only given with one.
+func (h *handler) emailAvailability(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	if !auth.IsValidEmail(email) {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The provided email address is invalid",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	if !h.allowAvailabilityCheck(w, r, "email") {
+		return
+	}
+
+	available := false
+	_, err := h.db.GetAccount(ctx, email)
+	if err != nil {
+		if !errors.Is(err, database.ErrAccountNotFound) {
+			slog.ErrorContext(ctx, "error getting account for availability check", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "There was an unexpected error checking the email",
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		available = true
+	}
+
+	// the answer changes as accounts are created, and shouldn't sit in shared caches
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.WriteJSONResponse(w, r, http.StatusOK, emailAvailabilityResponse{
+		Email:     email,
+		Available: available,
+	})
+}
+
+// usernameAvailability tells signup and profile forms whether a username can be taken. Reserved
+// and badly formatted usernames get a validation error rather than "unavailable", so the form
+// can say why. Checks are limited like emailAvailability's, out of the same budget.
+func (h *handler) usernameAvailability(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	username := strings.TrimSpace(r.URL.Query().Get("username"))
+	if err := accounts.ValidateUsername(username); err != nil {
+		writeInvalidUsername(w, r, err)
+		return
+	}
+
+	if !h.allowAvailabilityCheck(w, r, "username") {
+		return
+	}
+
+	available := false
+	_, err := h.db.GetAccountByUsername(ctx, username)
+	if err != nil {
+		if !errors.Is(err, database.ErrAccountNotFound) {
+			slog.ErrorContext(ctx, "error getting account for username availability check", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "There was an unexpected error checking the username",
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		available = true
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.WriteJSONResponse(w, r, http.StatusOK, usernameAvailabilityResponse{
+		Username:  username,
+		Available: available,
+	})
+}
+
+// allowAvailabilityCheck counts a check of whether an email or username (what) is available
+// against the client's rate limit, and verifies its captcha. It writes the error response and
+// returns false when the check can't be answered.
+func (h *handler) allowAvailabilityCheck(w http.ResponseWriter, r *http.Request, what string) bool {
+	ctx := r.Context()
+
+	// emails and usernames share a budget, so the limit doesn't double for enumerating accounts
+	throttleKey := "email-availability:" + httputils.ClientIP(r)
+	if wait := h.availabilityLimiter.Check(ctx, throttleKey); wait > 0 {
+		writeRateLimited(w, r, wait)
+		return false
+	}
+	h.availabilityLimiter.RecordFailure(ctx, throttleKey)
+
+	captchaToken := r.URL.Query().Get("captcha_token")
+	verified := false
+	if h.captcha != nil && captchaToken != "" {
+		err := h.captcha.Verify(ctx, captchaToken, httputils.ClientIP(r))
+		if err != nil {
+			if errors.Is(err, captcha.ErrInvalidResponse) {
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "The captcha is invalid or has expired",
+					Type:       errTypeInvalidCaptcha,
+					StatusCode: http.StatusBadRequest,
+				})
+				return false
+			}
+			slog.ErrorContext(ctx, "error verifying captcha", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "There was an unexpected error verifying the captcha",
+				StatusCode: http.StatusInternalServerError,
+			})
+			return false
+		}
+		verified = true
+	}
+
+	if h.emailAvailabilityRequireCaptcha && !verified {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "Solve the captcha to check whether this " + what + " is available",
+			Type:       errTypeCaptchaRequired,
+			StatusCode: http.StatusForbidden,
+		})
+		return false
+	}
+
+	return true
+}
+
+func writeRateLimited(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Too many requests, try again later",
+		Type:       errTypeRateLimited,
+		StatusCode: http.StatusTooManyRequests,
+	})
+}
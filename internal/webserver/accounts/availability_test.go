@@ -0,0 +1,242 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/captcha"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCaptcha struct{}
+
+func (fakeCaptcha) Verify(ctx context.Context, token, remoteIP string) error {
+	switch token {
+	case "solved":
+		return nil
+	case "provider-down":
+		return errors.New("connection refused")
+	default:
+		return fmt.Errorf("%w: not solved", captcha.ErrInvalidResponse)
+	}
+}
+
+func TestEmailAvailability(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	_, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "taken@test.com"})
+	require.NoError(t, err)
+
+	check := func(h *handler, email, captchaToken string) *httptest.ResponseRecorder {
+		query := url.Values{"email": {email}}
+		if captchaToken != "" {
+			query.Set("captcha_token", captchaToken)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/availability?"+query.Encode(), nil)
+		w := httptest.NewRecorder()
+		h.emailAvailability(w, req)
+		return w
+	}
+
+	newHandler := func(requireCaptcha bool) *handler {
+		return withService(&handler{
+			db:                              db,
+			captcha:                         fakeCaptcha{},
+			availabilityLimiter:             NewEmailAvailabilityLimiter(lockout.NewMemoryStore(), 100),
+			emailAvailabilityRequireCaptcha: requireCaptcha,
+		})
+	}
+
+	tests := []struct {
+		name              string
+		requireCaptcha    bool
+		email             string
+		captchaToken      string
+		expectedStatus    int
+		expectedAvailable bool
+		expectedType      string
+	}{
+		{
+			name:              "available",
+			email:             "new@test.com",
+			expectedStatus:    http.StatusOK,
+			expectedAvailable: true,
+		},
+		{
+			name:           "taken",
+			email:          "taken@test.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid email",
+			email:          "not-an-email",
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "enumeration-safe mode without a captcha",
+			requireCaptcha: true,
+			email:          "taken@test.com",
+			expectedStatus: http.StatusForbidden,
+			expectedType:   errTypeCaptchaRequired,
+		},
+		{
+			name:           "enumeration-safe mode with a solved captcha",
+			requireCaptcha: true,
+			email:          "taken@test.com",
+			captchaToken:   "solved",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unsolved captcha",
+			email:          "taken@test.com",
+			captchaToken:   "not-solved",
+			expectedStatus: http.StatusBadRequest,
+			expectedType:   errTypeInvalidCaptcha,
+		},
+		{
+			name:           "captcha provider error",
+			requireCaptcha: true,
+			email:          "taken@test.com",
+			captchaToken:   "provider-down",
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := check(newHandler(tt.requireCaptcha), tt.email, tt.captchaToken)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			if tt.expectedType != "" {
+				assert.Contains(t, w.Body.String(), tt.expectedType)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				var resp emailAvailabilityResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.email, resp.Email)
+				assert.Equal(t, tt.expectedAvailable, resp.Available)
+				assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+
+	t.Run("enumeration-safe mode without a captcha configured", func(t *testing.T) {
+		h := newHandler(true)
+		h.captcha = nil
+
+		w := check(h, "taken@test.com", "solved")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("rate limited per client", func(t *testing.T) {
+		h := newHandler(false)
+		h.availabilityLimiter = NewEmailAvailabilityLimiter(lockout.NewMemoryStore(), 3)
+
+		for i := range 3 {
+			w := check(h, fmt.Sprintf("user%d@test.com", i), "")
+			require.Equal(t, http.StatusOK, w.Code)
+		}
+
+		w := check(h, "user4@test.com", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeRateLimited)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+}
+
+func TestUsernameAvailability(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	_, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "taken@test.com", Username: "Taken_Name"})
+	require.NoError(t, err)
+
+	limiter := NewEmailAvailabilityLimiter(lockout.NewMemoryStore(), 100)
+	h := withService(&handler{db: db, captcha: fakeCaptcha{}, availabilityLimiter: limiter})
+
+	check := func(h *handler, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/username-available?"+query, nil)
+		w := httptest.NewRecorder()
+		h.usernameAvailability(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name              string
+		username          string
+		expectedStatus    int
+		expectedAvailable bool
+	}{
+		{
+			name:              "available",
+			username:          "new.user",
+			expectedStatus:    http.StatusOK,
+			expectedAvailable: true,
+		},
+		{
+			name:           "taken in another case",
+			username:       "taken_name",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "reserved",
+			username:       "Admin",
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "too short",
+			username:       "ab",
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "looks like an email",
+			username:       "ada@test.com",
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := check(h, url.Values{"username": {tt.username}}.Encode())
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+				var resp usernameAvailabilityResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedAvailable, resp.Available)
+			}
+		})
+	}
+
+	t.Run("enumeration-safe mode", func(t *testing.T) {
+		h := withService(&handler{db: db, captcha: fakeCaptcha{}, availabilityLimiter: limiter, emailAvailabilityRequireCaptcha: true})
+
+		w := check(h, "username=taken_name")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = check(h, "username=taken_name&captcha_token=solved")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("shares the email checks' rate limit", func(t *testing.T) {
+		h := withService(&handler{db: db, availabilityLimiter: NewEmailAvailabilityLimiter(lockout.NewMemoryStore(), 2)})
+
+		req := httptest.NewRequest(http.MethodGet, "/availability?email=new@test.com", nil)
+		h.emailAvailability(httptest.NewRecorder(), req)
+		require.Equal(t, http.StatusOK, check(h, "username=new.user").Code)
+
+		w := check(h, "username=new.user")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+}
@@ -0,0 +1,35 @@
+package accounts
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeBreachedPassword = "breached_password"
+
+// BreachChecker reports whether a password appeared in a known data breach. hibp.Client
+// implements it.
+type BreachChecker = accounts.BreachChecker
+
+// checkBreachedPassword checks a new password against known breaches. In enforce mode a breached
+// password is rejected and ok is false once the error response is written; otherwise breached
+// tells the caller to warn the client.
+func (h *handler) checkBreachedPassword(w http.ResponseWriter, r *http.Request, password string) (breached, ok bool) {
+	breached, err := h.service.CheckBreachedPassword(r.Context(), password)
+	if errors.Is(err, accounts.ErrBreachedPassword) {
+		writeBreachedPassword(w, r)
+		return true, false
+	}
+	return breached, true
+}
+
+func writeBreachedPassword(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "This password has appeared in a data breach, choose a different one",
+		Type:       errTypeBreachedPassword,
+		StatusCode: http.StatusUnprocessableEntity,
+	})
+}
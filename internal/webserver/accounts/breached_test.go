@@ -0,0 +1,106 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBreachChecker reports the passwords in breached, or err for every password
+type fakeBreachChecker struct {
+	breached map[string]bool
+	err      error
+}
+
+func (f fakeBreachChecker) Breached(ctx context.Context, password string) (bool, error) {
+	return f.breached[password], f.err
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	ctx := context.Background()
+	checker := fakeBreachChecker{breached: map[string]bool{"Password1!": true}}
+
+	newHandler := func(checker BreachChecker, enforce bool) (*handler, *database.MemoryDB) {
+		db := database.NewMemoryDB()
+		return withService(&handler{
+			db:                       db,
+			mailer:                   &recordingMailer{},
+			authClient:               auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60}),
+			breachedPasswords:        checker,
+			enforceBreachedPasswords: enforce,
+		}), db
+	}
+
+	register := func(h *handler, password string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(registerRequest{Email: "breach@test.com", Password: password})
+		w := httptest.NewRecorder()
+		h.register(w, httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(b)))
+		return w
+	}
+
+	t.Run("enforce rejects breached passwords", func(t *testing.T) {
+		h, db := newHandler(checker, true)
+
+		w := register(h, "Password1!")
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		var resp httputils.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, errTypeBreachedPassword, resp.Type)
+
+		_, err := db.GetAccount(ctx, "breach@test.com")
+		assert.ErrorIs(t, err, database.ErrAccountNotFound)
+
+		w = register(h, "Test123!@#")
+		require.Equal(t, http.StatusCreated, w.Code)
+		var created registerResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.False(t, created.PasswordBreached)
+	})
+
+	t.Run("warn flags breached passwords", func(t *testing.T) {
+		h, _ := newHandler(checker, false)
+
+		w := register(h, "Password1!")
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp registerResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.PasswordBreached)
+	})
+
+	t.Run("checks that fail let the password through", func(t *testing.T) {
+		h, _ := newHandler(fakeBreachChecker{err: errors.New("timeout")}, true)
+
+		w := register(h, "Password1!")
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("password change", func(t *testing.T) {
+		h, db := newHandler(checker, true)
+		hashedPassword, err := auth.HashPassword("Test123!@#")
+		require.NoError(t, err)
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "breach@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+
+		b, _ := json.Marshal(changePasswordRequest{CurrentPassword: "Test123!@#", NewPassword: "Password1!"})
+		req := httptest.NewRequest(http.MethodPost, "/password/change", bytes.NewReader(b))
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: account.ID}))
+		w := httptest.NewRecorder()
+		h.changePassword(w, req)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		unchanged, err := db.GetAccountByID(ctx, account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, hashedPassword, unchanged.PasswordHash)
+	})
+}
@@ -0,0 +1,71 @@
+package accounts
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/service/antiabuse"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+type captchaConfigResponse struct {
+	// Provider is the widget to render: turnstile, hcaptcha, or recaptcha
+	Provider string `json:"provider"`
+	SiteKey  string `json:"site_key"`
+	// Required are the actions that always need a solved captcha. Logins only need one after
+	// too many failures, which they answer with captcha_required.
+	Required []antiabuse.Action `json:"required"`
+}
+
+// captchaConfig tells clients which captcha widget to render and when to send its response
+func (h *handler) captchaConfig(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteJSONResponse(w, r, http.StatusOK, captchaConfigResponse{
+		Provider: h.captchaGate.ProviderName(),
+		SiteKey:  h.captchaGate.SiteKey(),
+		Required: []antiabuse.Action{antiabuse.ActionRegister, antiabuse.ActionForgotPassword},
+	})
+}
+
+// checkCaptcha verifies the captcha a request came with when the action needs one, and writes
+// the error response when it doesn't pass. Without a captcha gate every request passes.
+func (h *handler) checkCaptcha(w http.ResponseWriter, r *http.Request, action antiabuse.Action, token string) bool {
+	if h.captchaGate == nil {
+		return true
+	}
+
+	ctx := r.Context()
+
+	err := h.captchaGate.Check(ctx, action, token, httputils.ClientIP(r))
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, antiabuse.ErrCaptchaRequired):
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "Solve the captcha to continue",
+			Type:       errTypeCaptchaRequired,
+			StatusCode: http.StatusForbidden,
+		})
+	case errors.Is(err, antiabuse.ErrInvalidCaptcha):
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The captcha is invalid or has expired",
+			Type:       errTypeInvalidCaptcha,
+			StatusCode: http.StatusBadRequest,
+		})
+	default:
+		slog.ErrorContext(ctx, "error verifying captcha", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error verifying the captcha",
+			StatusCode: http.StatusInternalServerError,
+		})
+	}
+	return false
+}
+
+// recordCaptchaLoginFailure counts a failed login towards the client's logins needing a captcha
+func (h *handler) recordCaptchaLoginFailure(r *http.Request) {
+	if h.captchaGate == nil {
+		return
+	}
+	h.captchaGate.RecordLoginFailure(r.Context(), httputils.ClientIP(r))
+}
@@ -0,0 +1,115 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/antiabuse"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCaptchaProvider struct {
+	fakeCaptcha
+}
+
+func (fakeCaptchaProvider) Name() string {
+	return antiabuse.ProviderHCaptcha
+}
+
+func TestCaptchaGate(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) *handler {
+		db := database.NewMemoryDB()
+		_, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "captcha@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+
+		return withService(&handler{
+			db:                   db,
+			mailer:               &recordingMailer{},
+			authClient:           authClient,
+			appURL:               "https://app.example.com",
+			passwordResetLimiter: NewPasswordResetLimiter(lockout.NewMemoryStore(), DefaultPasswordResetLimit),
+			captchaGate: antiabuse.NewCaptchaGate(antiabuse.CaptchaGateConfig{
+				Provider:      fakeCaptchaProvider{},
+				SiteKey:       "site-key",
+				LoginFailures: 2,
+			}),
+		})
+	}
+
+	post := func(handle http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		handle(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		return w
+	}
+
+	t.Run("config", func(t *testing.T) {
+		h := setup(t)
+
+		w := httptest.NewRecorder()
+		h.captchaConfig(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp captchaConfigResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, antiabuse.ProviderHCaptcha, resp.Provider)
+		assert.Equal(t, "site-key", resp.SiteKey)
+		assert.ElementsMatch(t, []antiabuse.Action{antiabuse.ActionRegister, antiabuse.ActionForgotPassword}, resp.Required)
+	})
+
+	t.Run("register", func(t *testing.T) {
+		h := setup(t)
+
+		w := post(h.register, registerRequest{Email: "new@test.com", Password: "Test123!@#"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeCaptchaRequired)
+
+		w = post(h.register, registerRequest{Email: "new@test.com", Password: "Test123!@#", CaptchaToken: "not-solved"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidCaptcha)
+
+		w = post(h.register, registerRequest{Email: "new@test.com", Password: "Test123!@#", CaptchaToken: "solved"})
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	})
+
+	t.Run("forgot password", func(t *testing.T) {
+		h := setup(t)
+
+		w := post(h.forgotPassword, forgotPasswordRequest{Email: "captcha@test.com"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeCaptchaRequired)
+
+		w = post(h.forgotPassword, forgotPasswordRequest{Email: "captcha@test.com", CaptchaToken: "solved"})
+		assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	})
+
+	t.Run("login after failures", func(t *testing.T) {
+		h := setup(t)
+
+		w := post(h.login, loginRequest{Email: "captcha@test.com", Password: "wrong"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = post(h.login, loginRequest{Email: "nobody@test.com", Password: "wrong"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// the right password doesn't get past the captcha either
+		w = post(h.login, loginRequest{Email: "captcha@test.com", Password: "Test123!@#"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeCaptchaRequired)
+
+		w = post(h.login, loginRequest{Email: "captcha@test.com", Password: "Test123!@#", CaptchaToken: "solved"})
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	})
+}
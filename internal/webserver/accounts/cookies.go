@@ -0,0 +1,86 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+// RefreshTokenCookie holds the refresh token in cookie mode. It's HttpOnly so scripts can't read
+// it.
+const RefreshTokenCookie = "refresh_token"
+
+// SessionCookieConfig is how the session cookies are set in cookie mode
+type SessionCookieConfig struct {
+	// Domain is optional, the cookies are host-only without it. Set it to the parent domain when
+	// the web app is served from a different subdomain than the API, so its scripts can read
+	// the CSRF cookie.
+	Domain string
+	// Path limits where the browser sends the refresh token cookie. Defaults to "/".
+	Path string
+	// Secure only sends the cookies over HTTPS. Only turn it off for local development.
+	Secure   bool
+	SameSite http.SameSite
+	// CSRF issues the double-submit token along with the refresh token cookie. Its Protect
+	// middleware has to wrap the handler, refresh and logout don't check the token themselves.
+	CSRF *middleware.CSRF
+}
+
+// setSessionCookies sets the refresh token and a new CSRF token as cookies
+func (h *handler) setSessionCookies(w http.ResponseWriter, tokens *accounts.Tokens) error {
+	if _, err := h.sessionCookies.CSRF.IssueToken(w); err != nil {
+		return err
+	}
+	http.SetCookie(w, h.refreshTokenCookie(tokens.RefreshToken, int(h.authClient.RefreshTokenTTL().Seconds())))
+	return nil
+}
+
+// clearSessionCookies tells the browser to drop the session cookies
+func (h *handler) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, h.refreshTokenCookie("", -1))
+	h.sessionCookies.CSRF.ClearToken(w)
+}
+
+func (h *handler) refreshTokenCookie(value string, maxAge int) *http.Cookie {
+	path := h.sessionCookies.Path
+	if path == "" {
+		path = "/"
+	}
+	return &http.Cookie{
+		Name:     RefreshTokenCookie,
+		Value:    value,
+		Domain:   h.sessionCookies.Domain,
+		Path:     path,
+		MaxAge:   maxAge,
+		Secure:   h.sessionCookies.Secure,
+		HttpOnly: true,
+		SameSite: h.sessionCookies.SameSite,
+	}
+}
+
+// decodeSessionRequest decodes a refresh or logout request body. In cookie mode the body is
+// optional since the refresh token comes from the cookie.
+func (h *handler) decodeSessionRequest(r *http.Request, v any) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if errors.Is(err, io.EOF) && h.sessionCookies != nil {
+		return nil
+	}
+	return err
+}
+
+// refreshTokenFromCookie returns the refresh token cookie of a request that didn't send one in
+// the body. Without a cookie, or outside cookie mode, it's empty.
+func (h *handler) refreshTokenFromCookie(r *http.Request) string {
+	if h.sessionCookies == nil {
+		return ""
+	}
+	cookie, err := r.Cookie(RefreshTokenCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
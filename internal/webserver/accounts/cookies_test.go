@@ -0,0 +1,201 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionCookies(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+
+	setup := func(t *testing.T) *handler {
+		db := database.NewMemoryDB()
+		_, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "cookies@test.com"})
+		require.NoError(t, err)
+
+		return withService(&handler{
+			db:                db,
+			authClient:        authClient,
+			acceptAnyPassword: true,
+			sessionCookies: &SessionCookieConfig{
+				Path:     "/v1/accounts",
+				Secure:   true,
+				SameSite: http.SameSiteStrictMode,
+				CSRF: middleware.NewCSRF(middleware.CSRFConfig{
+					SessionCookie: RefreshTokenCookie,
+					Secure:        true,
+					SameSite:      http.SameSiteStrictMode,
+					TTL:           authClient.RefreshTokenTTL(),
+				}),
+			},
+		})
+	}
+
+	cookies := func(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+		byName := map[string]*http.Cookie{}
+		for _, c := range w.Result().Cookies() {
+			byName[c.Name] = c
+		}
+		return byName
+	}
+
+	login := func(t *testing.T, h *handler) map[string]*http.Cookie {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"cookies@test.com","password":"Test123!@#"}`))
+		w := httptest.NewRecorder()
+		h.login(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.AccessToken)
+		assert.Empty(t, resp.RefreshToken, "the refresh token is only in the cookie")
+		return cookies(w)
+	}
+
+	// withSession sends the session cookies, and the CSRF header unless it's empty
+	withSession := func(req *http.Request, session map[string]*http.Cookie, csrfHeader string) *http.Request {
+		req.AddCookie(&http.Cookie{Name: RefreshTokenCookie, Value: session[RefreshTokenCookie].Value})
+		req.AddCookie(&http.Cookie{Name: middleware.CSRFCookie, Value: session[middleware.CSRFCookie].Value})
+		if csrfHeader != "" {
+			req.Header.Set(middleware.CSRFHeader, csrfHeader)
+		}
+		return req
+	}
+
+	t.Run("login sets the cookies", func(t *testing.T) {
+		session := login(t, setup(t))
+
+		refreshCookie := session[RefreshTokenCookie]
+		require.NotNil(t, refreshCookie)
+		assert.NotEmpty(t, refreshCookie.Value)
+		assert.True(t, refreshCookie.HttpOnly)
+		assert.True(t, refreshCookie.Secure)
+		assert.Equal(t, http.SameSiteStrictMode, refreshCookie.SameSite)
+		assert.Equal(t, "/v1/accounts", refreshCookie.Path)
+		assert.Equal(t, 3600, refreshCookie.MaxAge)
+
+		csrfCookie := session[middleware.CSRFCookie]
+		require.NotNil(t, csrfCookie)
+		assert.NotEmpty(t, csrfCookie.Value)
+		assert.False(t, csrfCookie.HttpOnly, "scripts have to read the CSRF token")
+		assert.Equal(t, "/", csrfCookie.Path)
+	})
+
+	t.Run("refresh reads the cookie", func(t *testing.T) {
+		h := setup(t)
+		session := login(t, h)
+
+		req := withSession(httptest.NewRequest(http.MethodPost, "/refresh", nil), session, session[middleware.CSRFCookie].Value)
+		w := httptest.NewRecorder()
+		h.refresh(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.AccessToken)
+		assert.Empty(t, resp.RefreshToken)
+
+		refreshed := cookies(w)
+		require.NotNil(t, refreshed[RefreshTokenCookie])
+		assert.NotEqual(t, session[RefreshTokenCookie].Value, refreshed[RefreshTokenCookie].Value)
+		assert.NotEqual(t, session[middleware.CSRFCookie].Value, refreshed[middleware.CSRFCookie].Value, "the CSRF token is renewed with the session")
+	})
+
+	t.Run("refresh requires the CSRF token with the cookie", func(t *testing.T) {
+		h := setup(t)
+		session := login(t, h)
+		protected := h.sessionCookies.CSRF.Protect(http.HandlerFunc(h.refresh))
+
+		for name, header := range map[string]string{"missing": "", "mismatched": "not-the-token"} {
+			req := withSession(httptest.NewRequest(http.MethodPost, "/refresh", nil), session, header)
+			w := httptest.NewRecorder()
+			protected.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusForbidden, w.Code, name)
+			assert.Contains(t, w.Body.String(), "csrf_validation_failed", name)
+		}
+	})
+
+	t.Run("a refresh token in the body doesn't need the CSRF token", func(t *testing.T) {
+		h := setup(t)
+		session := login(t, h)
+
+		body := `{"refresh_token":"` + session[RefreshTokenCookie].Value + `"}`
+		w := httptest.NewRecorder()
+		h.refresh(w, httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(body)))
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	})
+
+	t.Run("an expired cookie is cleared", func(t *testing.T) {
+		h := setup(t)
+
+		req := httptest.NewRequest(http.MethodPost, "/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: RefreshTokenCookie, Value: "unknown"})
+		req.AddCookie(&http.Cookie{Name: middleware.CSRFCookie, Value: "csrf"})
+		req.Header.Set(middleware.CSRFHeader, "csrf")
+		w := httptest.NewRecorder()
+		h.refresh(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+		assert.Negative(t, cookies(w)[RefreshTokenCookie].MaxAge)
+	})
+
+	t.Run("logout ends the cookie's session and clears it", func(t *testing.T) {
+		h := setup(t)
+		session := login(t, h)
+
+		req := withSession(httptest.NewRequest(http.MethodPost, "/logout", nil), session, session[middleware.CSRFCookie].Value)
+		w := httptest.NewRecorder()
+		h.logout(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		cleared := cookies(w)
+		assert.Negative(t, cleared[RefreshTokenCookie].MaxAge)
+		assert.Negative(t, cleared[middleware.CSRFCookie].MaxAge)
+
+		req = withSession(httptest.NewRequest(http.MethodPost, "/refresh", nil), session, session[middleware.CSRFCookie].Value)
+		w = httptest.NewRecorder()
+		h.refresh(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+	})
+
+	t.Run("logout requires the CSRF token with the cookie", func(t *testing.T) {
+		h := setup(t)
+		session := login(t, h)
+
+		req := withSession(httptest.NewRequest(http.MethodPost, "/logout", nil), session, "")
+		w := httptest.NewRecorder()
+		h.sessionCookies.CSRF.Protect(http.HandlerFunc(h.logout)).ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	})
+
+	t.Run("without cookie mode", func(t *testing.T) {
+		h := setup(t)
+		h.sessionCookies = nil
+
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"cookies@test.com","password":"Test123!@#"}`))
+		w := httptest.NewRecorder()
+		h.login(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Empty(t, w.Result().Cookies())
+
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.RefreshToken)
+
+		// the body is still required
+		w = httptest.NewRecorder()
+		h.refresh(w, httptest.NewRequest(http.MethodPost, "/refresh", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,72 @@
+package accounts
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+// deleteMe deletes the authenticated account and logs out every session. The account is only
+// soft deleted here; it's purged for good once the retention period is over.
+func (h *handler) deleteMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	unexpectedErr := httputils.ErrorResponse{
+		Message:    "There was an unexpected error deleting the account",
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	account, err := h.db.GetAccountByID(ctx, claims.AccountID)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The account was not found",
+				Type:       errTypeAccountNotFound,
+				StatusCode: http.StatusNotFound,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account to delete", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	// a frozen account's credentials may be stolen, so it can't be deleted until its owner
+	// unfreezes it
+	if account.FrozenAt != nil {
+		writeAccountFrozen(w, r)
+		return
+	}
+
+	// recorded first so the event still points at the account until it's purged
+	h.recordAuditEvent(ctx, r, account.ID, database.AuditEventAccountDeleted)
+
+	if err := h.db.DeleteAccount(ctx, account.ID); err != nil {
+		slog.ErrorContext(ctx, "error deleting account", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if err := h.service.RevokeSignedRefreshTokens(ctx, account.ID); err != nil {
+		slog.ErrorContext(ctx, "error revoking sessions after account deletion", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	// the account is deleted either way
+	err = mailer.SendTemplate(ctx, h.mailer, mailer.TemplateAccountDeleted, account.Email, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "error sending account deleted notice", "error", err)
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
+		"message": "Your account has been deleted",
+	})
+}
@@ -0,0 +1,111 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteMe(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (*handler, *database.MemoryDB, *recordingMailer, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "delete@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+
+		mail := &recordingMailer{}
+		h := withService(&handler{db: db, mailer: mail, authClient: authClient})
+		return h, db, mail, account
+	}
+
+	deleteMe := func(h *handler, accountID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/me", nil)
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		h.deleteMe(w, req)
+		return w
+	}
+
+	post := func(handle http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		handle(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		return w
+	}
+
+	t.Run("delete", func(t *testing.T) {
+		h, db, mail, account := setup(t)
+
+		session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+		require.NoError(t, err)
+
+		w := deleteMe(h, account.ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		_, err = db.GetAccountByID(ctx, account.ID)
+		assert.ErrorIs(t, err, database.ErrAccountNotFound)
+
+		assert.Equal(t, http.StatusUnauthorized, post(h.refresh, refreshRequest{RefreshToken: session.RefreshToken}).Code)
+		assert.Equal(t, http.StatusUnauthorized, post(h.login, loginRequest{Email: "delete@test.com", Password: "Test123!@#"}).Code)
+
+		require.Len(t, mail.sent, 1)
+		assert.Equal(t, "delete@test.com", mail.sent[0].To)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		assert.Equal(t, database.AuditEventAccountDeleted, events[0].EventType)
+
+		// the token outlives the account
+		assert.Equal(t, http.StatusNotFound, deleteMe(h, account.ID).Code)
+
+		// the email is free again
+		w = post(h.register, registerRequest{Email: "delete@test.com", Password: "Test123!@#"})
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	})
+
+	t.Run("signed sessions are revoked", func(t *testing.T) {
+		h, _, _, account := setup(t)
+		h.signedRefreshTokens = true
+		h.revocations = revocation.NewList(lockout.NewMemoryStore(), time.Hour)
+		h = withService(h)
+
+		session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+		require.NoError(t, err)
+
+		w := deleteMe(h, account.ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, post(h.refresh, refreshRequest{RefreshToken: session.RefreshToken}).Code)
+	})
+
+	t.Run("frozen accounts can't be deleted", func(t *testing.T) {
+		h, db, _, account := setup(t)
+		_, err := db.FreezeAccount(ctx, account.ID)
+		require.NoError(t, err)
+
+		w := deleteMe(h, account.ID)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		_, err = db.GetAccountByID(ctx, account.ID)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,114 @@
+package accounts
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+const (
+	// DefaultDeletionGracePeriod is how long an account that asked to be erased has to change
+	// its mind
+	DefaultDeletionGracePeriod = 30 * 24 * time.Hour
+
+	errTypeDeletionAlreadyRequested = "deletion_already_requested"
+
+	unexpectedDeletionRequestError = "There was an unexpected error requesting the account's deletion"
+)
+
+type deletionRequestResponse struct {
+	Message string    `json:"message"`
+	EraseAt time.Time `json:"erase_at"`
+}
+
+// requestDeletion schedules the caller's account to be erased once the grace period is over and
+// logs out every session. Logging in again before then cancels the request, unlike DELETE /me
+// which deletes the account right away.
+func (h *handler) requestDeletion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	account, err := h.db.GetAccountByID(ctx, claims.AccountID)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The account was not found",
+				Type:       errTypeAccountNotFound,
+				StatusCode: http.StatusNotFound,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account to request deletion", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedDeletionRequestError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	// like deleting it, a frozen account's credentials may be stolen
+	if account.FrozenAt != nil {
+		writeAccountFrozen(w, r)
+		return
+	}
+
+	request, err := h.db.CreateDeletionRequest(ctx, account.ID, time.Now().Add(h.deletionGracePeriod))
+	if err != nil {
+		if errors.Is(err, database.ErrDeletionAlreadyRequested) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "This account's deletion was already requested. Log in again to cancel it",
+				Type:       errTypeDeletionAlreadyRequested,
+				StatusCode: http.StatusConflict,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error creating deletion request", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedDeletionRequestError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, account.ID, database.AuditEventDeletionRequested)
+
+	// the next login cancels the request, so every session ends here, the caller's access
+	// token included
+	err = h.revokeAccessToken(ctx)
+	if err == nil {
+		err = h.service.LogoutAll(ctx, account.ID, h.client(r))
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error revoking sessions after deletion request", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedDeletionRequestError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+	if h.sessionCookies != nil {
+		h.clearSessionCookies(w)
+	}
+
+	// the request stands either way
+	err = mailer.SendTemplate(ctx, h.mailer, mailer.TemplateDeletionRequested, account.Email, mailer.Data{
+		"EraseAt": request.EraseAt.UTC().Format("2 Jan 2006"),
+		"Link":    strings.TrimRight(h.appURL, "/") + "/login",
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error sending deletion request confirmation", "error", err)
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusAccepted, deletionRequestResponse{
+		Message: "Your account will be erased. Log in again before then to cancel it",
+		EraseAt: request.EraseAt,
+	})
+}
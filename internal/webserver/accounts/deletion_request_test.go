@@ -0,0 +1,108 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestDeletion(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (*handler, *database.MemoryDB, *recordingMailer, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "erase@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+
+		mail := &recordingMailer{}
+		h := withService(&handler{db: db, mailer: mail, authClient: authClient, deletionGracePeriod: DefaultDeletionGracePeriod})
+		return h, db, mail, account
+	}
+
+	requestDeletion := func(h *handler, accountID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/me/deletion-request", nil)
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		h.requestDeletion(w, req)
+		return w
+	}
+
+	post := func(handle http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		handle(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		return w
+	}
+
+	t.Run("request and cancel by logging in", func(t *testing.T) {
+		h, db, mail, account := setup(t)
+
+		session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+		require.NoError(t, err)
+
+		w := requestDeletion(h, account.ID)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+		var resp deletionRequestResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.WithinDuration(t, time.Now().Add(DefaultDeletionGracePeriod), resp.EraseAt, time.Minute)
+
+		// every session ends
+		assert.Equal(t, http.StatusUnauthorized, post(h.refresh, refreshRequest{RefreshToken: session.RefreshToken}).Code)
+
+		require.Len(t, mail.sent, 1)
+		assert.Equal(t, "erase@test.com", mail.sent[0].To)
+
+		assert.Equal(t, http.StatusConflict, requestDeletion(h, account.ID).Code)
+
+		w = post(h.login, loginRequest{Email: "erase@test.com", Password: "Test123!@#"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		_, err = db.GetDeletionRequest(ctx, account.ID)
+		assert.ErrorIs(t, err, database.ErrDeletionRequestNotFound)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		var eventTypes []string
+		for _, event := range events {
+			eventTypes = append(eventTypes, event.EventType)
+		}
+		assert.Contains(t, eventTypes, database.AuditEventDeletionRequested)
+		assert.Contains(t, eventTypes, database.AuditEventDeletionCancelled)
+
+		// it can be requested again
+		assert.Equal(t, http.StatusAccepted, requestDeletion(h, account.ID).Code)
+	})
+
+	t.Run("frozen accounts can't request deletion", func(t *testing.T) {
+		h, db, _, account := setup(t)
+		_, err := db.FreezeAccount(ctx, account.ID)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusForbidden, requestDeletion(h, account.ID).Code)
+
+		_, err = db.GetDeletionRequest(ctx, account.ID)
+		assert.ErrorIs(t, err, database.ErrDeletionRequestNotFound)
+	})
+
+	t.Run("account no longer exists", func(t *testing.T) {
+		h, _, _, _ := setup(t)
+
+		assert.Equal(t, http.StatusNotFound, requestDeletion(h, "missing").Code)
+	})
+}
@@ -0,0 +1,128 @@
+package accounts
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const errTypeTrustedDeviceNotFound = "trusted_device_not_found"
+
+type trustedDevice struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+type listTrustedDevicesResponse struct {
+	Devices []trustedDevice `json:"devices"`
+}
+
+// listTrustedDevices lists the devices the caller trusted when completing MFA, which skip it
+// until they expire, most recently used first
+func (h *handler) listTrustedDevices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	devices, err := h.db.ListTrustedDevices(ctx, claims.AccountID, time.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing trusted devices", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error listing trusted devices",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	response := listTrustedDevicesResponse{Devices: make([]trustedDevice, 0, len(devices))}
+	for _, d := range devices {
+		response.Devices = append(response.Devices, trustedDevice{
+			ID:         d.ID,
+			CreatedAt:  d.CreatedAt,
+			LastUsedAt: d.LastUsedAt,
+			ExpiresAt:  d.ExpiresAt,
+			IPAddress:  d.IPAddress,
+			UserAgent:  d.UserAgent,
+		})
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, response)
+}
+
+// removeTrustedDevice stops trusting one of the caller's devices, so its next login has to
+// complete MFA again. Its sessions stay logged in.
+func (h *handler) removeTrustedDevice(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeTrustedDeviceNotFound(w, r)
+		return
+	}
+
+	// another account's device isn't found either, so IDs can't be probed
+	if err := h.db.DeleteTrustedDevice(ctx, claims.AccountID, id); err != nil {
+		if errors.Is(err, database.ErrTrustedDeviceNotFound) {
+			writeTrustedDeviceNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error removing trusted device", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error removing the trusted device",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, claims.AccountID, database.AuditEventTrustedDeviceRemoved)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
+		"message": "Trusted device removed",
+	})
+}
+
+// removeTrustedDevices stops trusting every device of the caller
+func (h *handler) removeTrustedDevices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	removed, err := h.db.DeleteTrustedDevices(ctx, claims.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error removing trusted devices", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error removing trusted devices",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	if removed > 0 {
+		h.recordAuditEvent(ctx, r, claims.AccountID, database.AuditEventTrustedDeviceRemoved)
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
+		"message": "Trusted devices removed",
+	})
+}
+
+func writeTrustedDeviceNotFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Trusted device not found",
+		Type:       errTypeTrustedDeviceNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
@@ -0,0 +1,110 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedDevices(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*handler, *database.MemoryDB, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "devices@test.com"})
+		require.NoError(t, err)
+		return withService(&handler{db: db}), db, account
+	}
+
+	trust := func(t *testing.T, db *database.MemoryDB, accountID string) *database.TrustedDevice {
+		device, err := db.CreateTrustedDevice(ctx, database.CreateTrustedDeviceParams{
+			AccountID:  accountID,
+			DeviceHash: "laptop",
+			IPAddress:  "203.0.113.7",
+			UserAgent:  "Firefox",
+			ExpiresAt:  time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+		return device
+	}
+
+	do := func(handle http.HandlerFunc, method, accountID, id string) *httptest.ResponseRecorder {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req := httptest.NewRequest(method, "/me/devices", nil)
+		reqCtx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		req = req.WithContext(middleware.WithClaims(reqCtx, &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		handle(w, req)
+		return w
+	}
+
+	list := func(t *testing.T, h *handler, accountID string) []trustedDevice {
+		w := do(h.listTrustedDevices, http.MethodGet, accountID, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp listTrustedDevicesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Devices
+	}
+
+	t.Run("list", func(t *testing.T) {
+		h, db, account := setup(t)
+
+		w := do(h.listTrustedDevices, http.MethodGet, account.ID, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"devices":[]}`, w.Body.String())
+
+		device := trust(t, db, account.ID)
+		devices := list(t, h, account.ID)
+		require.Len(t, devices, 1)
+		assert.Equal(t, device.ID, devices[0].ID)
+		assert.Equal(t, "Firefox", devices[0].UserAgent)
+	})
+
+	t.Run("remove one", func(t *testing.T) {
+		h, db, account := setup(t)
+		device := trust(t, db, account.ID)
+		other, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "other@test.com"})
+		require.NoError(t, err)
+
+		for _, id := range []string{"not-a-uuid", uuid.NewString()} {
+			w := do(h.removeTrustedDevice, http.MethodDelete, account.ID, id)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Contains(t, w.Body.String(), errTypeTrustedDeviceNotFound)
+		}
+
+		// another account's device isn't found
+		w := do(h.removeTrustedDevice, http.MethodDelete, other.ID, device.ID)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = do(h.removeTrustedDevice, http.MethodDelete, account.ID, device.ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Empty(t, list(t, h, account.ID))
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		assert.Equal(t, database.AuditEventTrustedDeviceRemoved, events[0].EventType)
+	})
+
+	t.Run("remove all", func(t *testing.T) {
+		h, db, account := setup(t)
+		trust(t, db, account.ID)
+		trust(t, db, account.ID)
+
+		w := do(h.removeTrustedDevices, http.MethodDelete, account.ID, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Empty(t, list(t, h, account.ID))
+	})
+}
@@ -0,0 +1,337 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+const (
+	emailChangeTTL = 24 * time.Hour
+
+	errTypeInvalidEmailChangeToken = "invalid_email_change_token"
+
+	emailChangeStatusPending   = "pending"
+	emailChangeStatusCompleted = "completed"
+	emailChangeStatusCancelled = "cancelled"
+
+	unexpectedEmailChangeError = "There was an unexpected error changing the email address"
+)
+
+type emailChangeRequest struct {
+	NewEmail string `json:"new_email"`
+	// Password is the current password. Not needed for accounts without one (e.g. Sign in with Apple).
+	Password string `json:"password"`
+}
+
+type emailChangeResponse struct {
+	Message   string    `json:"message"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// requestEmailChange starts an email change. Nothing changes until links emailed to both the
+// current and the new address are followed, and the current address can cancel the change,
+// so a stolen session alone can't take over the account by changing its email.
+func (h *handler) requestEmailChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	var reqBody emailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	unexpectedErr := httputils.ErrorResponse{
+		Message:    unexpectedEmailChangeError,
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	account, err := h.db.GetAccountByID(ctx, claims.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting account for email change", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if !auth.IsValidEmail(reqBody.NewEmail) || strings.EqualFold(reqBody.NewEmail, account.Email) {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The new email address is invalid",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	if account.PasswordHash != "" && !h.service.PasswordIsCorrect(reqBody.Password, account.PasswordHash) {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "Password is incorrect",
+			Type:       errTypeIncorrectPassword,
+			StatusCode: http.StatusUnauthorized,
+		})
+		return
+	}
+	reqBody.Password = ""
+
+	_, err = h.db.GetAccount(ctx, reqBody.NewEmail)
+	if err == nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "An account with this email already exists",
+			Type:       errTypeAccountAlreadyExists,
+			StatusCode: http.StatusConflict,
+		})
+		return
+	}
+	if !errors.Is(err, database.ErrAccountNotFound) {
+		slog.ErrorContext(ctx, "error checking new email for email change", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	tokens := make([]string, 3)
+	for i := range tokens {
+		tokens[i], err = auth.NewOpaqueToken()
+		if err != nil {
+			slog.ErrorContext(ctx, "error generating email change token", "error", err)
+			httputils.WriteErrorResponse(w, r, unexpectedErr)
+			return
+		}
+	}
+	oldToken, newToken, cancelToken := tokens[0], tokens[1], tokens[2]
+
+	change, err := h.db.CreateEmailChange(ctx, database.CreateEmailChangeParams{
+		AccountID:       account.ID,
+		NewEmail:        reqBody.NewEmail,
+		OldTokenHash:    auth.HashOpaqueToken(oldToken),
+		NewTokenHash:    auth.HashOpaqueToken(newToken),
+		CancelTokenHash: auth.HashOpaqueToken(cancelToken),
+		ExpiresAt:       time.Now().Add(emailChangeTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating email change", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if err := h.sendEmailChangeEmails(ctx, account.Email, reqBody.NewEmail, oldToken, newToken, cancelToken); err != nil {
+		slog.ErrorContext(ctx, "error sending email change emails", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, account.ID, database.AuditEventEmailChangeRequested)
+
+	httputils.WriteJSONResponse(w, r, http.StatusAccepted, emailChangeResponse{
+		Message:   "Confirm the change using the links sent to both email addresses",
+		ExpiresAt: change.ExpiresAt,
+	})
+}
+
+func (h *handler) sendEmailChangeEmails(ctx context.Context, oldEmail, newEmail, oldToken, newToken, cancelToken string) error {
+	err := mailer.SendTemplate(ctx, h.mailer, mailer.TemplateEmailChangeOld, oldEmail, mailer.Data{
+		"NewEmail":    newEmail,
+		"ConfirmLink": h.emailLink("/email-change/confirm", oldToken),
+		"CancelLink":  h.emailLink("/email-change/cancel", cancelToken),
+	})
+	if err != nil {
+		return err
+	}
+
+	return mailer.SendTemplate(ctx, h.mailer, mailer.TemplateEmailChangeNew, newEmail, mailer.Data{
+		"Link": h.emailLink("/email-change/confirm", newToken),
+	})
+}
+
+func (h *handler) emailLink(path, token string) string {
+	return strings.TrimRight(h.appURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+type emailChangeTokenRequest struct {
+	Token string `json:"token"`
+}
+
+type emailChangeStatusResponse struct {
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// confirmEmailChange records a confirmation from one of the addresses and switches the
+// account's email once both have confirmed
+func (h *handler) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	change, token, ok := h.emailChangeFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var side database.EmailChangeSide
+	switch auth.HashOpaqueToken(token) {
+	case change.OldTokenHash:
+		side = database.EmailChangeSideOld
+	case change.NewTokenHash:
+		side = database.EmailChangeSideNew
+	default:
+		// the cancel token can't confirm
+		writeInvalidEmailChangeToken(w, r)
+		return
+	}
+
+	change, err := h.db.ConfirmEmailChange(ctx, change.ID, side)
+	if err != nil {
+		if errors.Is(err, database.ErrEmailChangeNotFound) {
+			writeInvalidEmailChangeToken(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error confirming email change", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedEmailChangeError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	if !change.Confirmed() {
+		httputils.WriteJSONResponse(w, r, http.StatusOK, emailChangeStatusResponse{
+			Message: "Confirmed. The change takes effect once the other address confirms too",
+			Status:  emailChangeStatusPending,
+		})
+		return
+	}
+
+	_, err = h.db.CompleteEmailChange(ctx, change.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountAlreadyExists) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "An account with this email already exists",
+				Type:       errTypeAccountAlreadyExists,
+				StatusCode: http.StatusConflict,
+			})
+			return
+		}
+		if errors.Is(err, database.ErrEmailChangeNotFound) {
+			writeInvalidEmailChangeToken(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error completing email change", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedEmailChangeError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	// sign out everywhere so any session opened with the old email has to log in again
+	err = h.db.DeleteRefreshTokensByAccount(ctx, change.AccountID)
+	if err == nil {
+		err = h.service.RevokeSignedRefreshTokens(ctx, change.AccountID)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error revoking sessions after email change", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedEmailChangeError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, change.AccountID, database.AuditEventEmailChanged)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, emailChangeStatusResponse{
+		Message: "Your email address has been changed",
+		Status:  emailChangeStatusCompleted,
+	})
+}
+
+// cancelEmailChange stops a pending email change using the cancel link sent to the old address
+func (h *handler) cancelEmailChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	change, token, ok := h.emailChangeFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if auth.HashOpaqueToken(token) != change.CancelTokenHash {
+		writeInvalidEmailChangeToken(w, r)
+		return
+	}
+
+	if err := h.db.DeleteEmailChange(ctx, change.ID); err != nil {
+		slog.ErrorContext(ctx, "error cancelling email change", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedEmailChangeError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, change.AccountID, database.AuditEventEmailChangeCancelled)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, emailChangeStatusResponse{
+		Message: "The email address change has been cancelled",
+		Status:  emailChangeStatusCancelled,
+	})
+}
+
+// emailChangeFromRequest reads the token from the body and looks up its unexpired change. It
+// writes the error response itself when it returns false.
+func (h *handler) emailChangeFromRequest(w http.ResponseWriter, r *http.Request) (*database.EmailChange, string, bool) {
+	ctx := r.Context()
+
+	var reqBody emailChangeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Token == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return nil, "", false
+	}
+
+	change, err := h.db.GetEmailChangeByTokenHash(ctx, auth.HashOpaqueToken(reqBody.Token))
+	if err != nil {
+		if errors.Is(err, database.ErrEmailChangeNotFound) {
+			writeInvalidEmailChangeToken(w, r)
+			return nil, "", false
+		}
+		slog.ErrorContext(ctx, "error getting email change", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedEmailChangeError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return nil, "", false
+	}
+
+	if time.Now().After(change.ExpiresAt) {
+		if err := h.db.DeleteEmailChange(ctx, change.ID); err != nil {
+			slog.ErrorContext(ctx, "error deleting expired email change", "error", err)
+		}
+		writeInvalidEmailChangeToken(w, r)
+		return nil, "", false
+	}
+
+	return change, reqBody.Token, true
+}
+
+func writeInvalidEmailChangeToken(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "This link is invalid or has expired",
+		Type:       errTypeInvalidEmailChangeToken,
+		StatusCode: http.StatusBadRequest,
+	})
+}
@@ -0,0 +1,217 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMailer keeps sent messages so tests can follow the links in them
+type recordingMailer struct {
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`https://app\.example\.com(/[\w/-]+)\?token=(\S+)`)
+
+// links returns the path -> token of every link in the last message sent to the address
+func (m *recordingMailer) links(t *testing.T, to string) map[string]string {
+	t.Helper()
+
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To != to {
+			continue
+		}
+		links := map[string]string{}
+		for _, match := range linkPattern.FindAllStringSubmatch(m.sent[i].Body, -1) {
+			token, err := url.QueryUnescape(match[2])
+			require.NoError(t, err)
+			links[match[1]] = token
+		}
+		return links
+	}
+
+	t.Fatalf("no email sent to %s", to)
+	return nil
+}
+
+func TestEmailChange(t *testing.T) {
+	ctx := context.Background()
+
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (*handler, *database.MemoryDB, *recordingMailer, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "old@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+		_, err = db.CreateAccount(ctx, database.AccountCreationParams{Email: "taken@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+
+		mail := &recordingMailer{}
+		h := withService(&handler{db: db, mailer: mail, appURL: "https://app.example.com/"})
+		return h, db, mail, account
+	}
+
+	requestChange := func(h *handler, accountID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/me/email", bytes.NewReader([]byte(body)))
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		h.requestEmailChange(w, req)
+		return w
+	}
+
+	post := func(handle http.HandlerFunc, token string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(emailChangeTokenRequest{Token: token})
+		req := httptest.NewRequest(http.MethodPost, "/email-change", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handle(w, req)
+		return w
+	}
+
+	status := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		var resp emailChangeStatusResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Status
+	}
+
+	t.Run("both addresses confirm", func(t *testing.T) {
+		h, db, mail, account := setup(t)
+		require.NoError(t, db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "session", AccountID: account.ID}))
+
+		w := requestChange(h, account.ID, `{"new_email":"new@test.com","password":"Test123!@#"}`)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+		oldLinks := mail.links(t, "old@test.com")
+		newLinks := mail.links(t, "new@test.com")
+		require.Contains(t, oldLinks, "/email-change/cancel")
+
+		w = post(h.confirmEmailChange, newLinks["/email-change/confirm"])
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, emailChangeStatusPending, status(t, w))
+
+		// nothing changes until the old address confirms too
+		_, err := db.GetAccount(ctx, "old@test.com")
+		require.NoError(t, err)
+
+		w = post(h.confirmEmailChange, oldLinks["/email-change/confirm"])
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, emailChangeStatusCompleted, status(t, w))
+
+		updated, err := db.GetAccountByID(ctx, account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "new@test.com", updated.Email)
+
+		// sessions are revoked
+		_, err = db.GetRefreshToken(ctx, "session")
+		assert.ErrorIs(t, err, database.ErrRefreshTokenNotFound)
+
+		// the links are single use
+		w = post(h.confirmEmailChange, oldLinks["/email-change/confirm"])
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("signed sessions are revoked", func(t *testing.T) {
+		h, _, mail, account := setup(t)
+		h.authClient = auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+		h.signedRefreshTokens = true
+		h.revocations = revocation.NewList(lockout.NewMemoryStore(), time.Hour)
+		h = withService(h)
+
+		session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+		require.NoError(t, err)
+
+		w := requestChange(h, account.ID, `{"new_email":"new@test.com","password":"Test123!@#"}`)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		w = post(h.confirmEmailChange, mail.links(t, "new@test.com")["/email-change/confirm"])
+		require.Equal(t, http.StatusOK, w.Code)
+		w = post(h.confirmEmailChange, mail.links(t, "old@test.com")["/email-change/confirm"])
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, emailChangeStatusCompleted, status(t, w))
+
+		b, _ := json.Marshal(refreshRequest{RefreshToken: session.RefreshToken})
+		w = httptest.NewRecorder()
+		h.refresh(w, httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewReader(b)))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("old address cancels", func(t *testing.T) {
+		h, db, mail, account := setup(t)
+
+		w := requestChange(h, account.ID, `{"new_email":"attacker@test.com","password":"Test123!@#"}`)
+		require.Equal(t, http.StatusAccepted, w.Code)
+
+		oldLinks := mail.links(t, "old@test.com")
+		newLinks := mail.links(t, "attacker@test.com")
+
+		// the cancel token can't be used to confirm
+		w = post(h.confirmEmailChange, oldLinks["/email-change/cancel"])
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		// and confirm tokens can't cancel
+		w = post(h.cancelEmailChange, newLinks["/email-change/confirm"])
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = post(h.cancelEmailChange, oldLinks["/email-change/cancel"])
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, emailChangeStatusCancelled, status(t, w))
+
+		w = post(h.confirmEmailChange, newLinks["/email-change/confirm"])
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		unchanged, err := db.GetAccountByID(ctx, account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "old@test.com", unchanged.Email)
+	})
+
+	t.Run("request validation", func(t *testing.T) {
+		h, _, mail, account := setup(t)
+
+		tests := []struct {
+			name         string
+			body         string
+			expectedCode int
+			expectedType string
+		}{
+			{name: "wrong password", body: `{"new_email":"new@test.com","password":"Wrong123!@#"}`, expectedCode: http.StatusUnauthorized, expectedType: errTypeIncorrectPassword},
+			{name: "invalid email", body: `{"new_email":"not-an-email","password":"Test123!@#"}`, expectedCode: http.StatusUnprocessableEntity, expectedType: errTypeValidationError},
+			{name: "same email", body: `{"new_email":"OLD@test.com","password":"Test123!@#"}`, expectedCode: http.StatusUnprocessableEntity, expectedType: errTypeValidationError},
+			{name: "email taken", body: `{"new_email":"taken@test.com","password":"Test123!@#"}`, expectedCode: http.StatusConflict, expectedType: errTypeAccountAlreadyExists},
+			{name: "malformed body", body: `{"new_email":`, expectedCode: http.StatusBadRequest},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := requestChange(h, account.ID, tt.body)
+				assert.Equal(t, tt.expectedCode, w.Code)
+
+				var resp httputils.ErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedType, resp.Type)
+			})
+		}
+
+		assert.Empty(t, mail.sent)
+	})
+}
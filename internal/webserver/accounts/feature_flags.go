@@ -0,0 +1,35 @@
+package accounts
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+type featureFlagsResponse struct {
+	FeatureFlags map[string]bool `json:"feature_flags"`
+}
+
+// featureFlags returns the authenticated account's evaluated feature flags: the deployment
+// defaults with the account's overrides applied
+func (h *handler) featureFlags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	account, err := h.db.GetAccountByID(ctx, claims.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting account feature flags", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error getting feature flags",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, featureFlagsResponse{
+		FeatureFlags: h.flags.Evaluate(account.FeatureFlags),
+	})
+}
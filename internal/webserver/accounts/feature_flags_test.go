@@ -0,0 +1,90 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/featureflags"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "flags@test.com"})
+	require.NoError(t, err)
+	_, err = db.UpdateAccountFeatureFlags(ctx, account.ID, map[string]bool{"new-dashboard": false, "exports": true}, nil)
+	require.NoError(t, err)
+
+	h := withService(&handler{
+		db: db,
+		flags: featureflags.NewEvaluator(featureflags.Config{
+			Defaults:   map[string]bool{"new-dashboard": true, "beta-search": true},
+			TokenFlags: []string{"new-dashboard", "beta-search"},
+		}),
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/me/feature-flags", nil)
+	req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: account.ID}))
+	w := httptest.NewRecorder()
+	h.featureFlags(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp featureFlagsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, map[string]bool{"new-dashboard": false, "beta-search": true, "exports": true}, resp.FeatureFlags)
+}
+
+func TestFeatureFlagsInAccessToken(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "flags@test.com"})
+	require.NoError(t, err)
+	_, err = db.UpdateAccountFeatureFlags(ctx, account.ID, map[string]bool{"exports": true, "beta-search": true}, nil)
+	require.NoError(t, err)
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+
+	tests := []struct {
+		name           string
+		flags          *featureflags.Evaluator
+		expectedClaims map[string]bool
+	}{
+		{
+			name: "configured flags are included",
+			flags: featureflags.NewEvaluator(featureflags.Config{
+				Defaults:   map[string]bool{"new-dashboard": true},
+				TokenFlags: []string{"new-dashboard", "exports"},
+			}),
+			expectedClaims: map[string]bool{"new-dashboard": true, "exports": true},
+		},
+		{
+			name:           "no token flags configured",
+			flags:          featureflags.NewEvaluator(featureflags.Config{}),
+			expectedClaims: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := withService(&handler{db: db, authClient: authClient, flags: tt.flags})
+
+			resp, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+			require.NoError(t, err)
+
+			claims, err := authClient.ParseAccessToken(resp.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedClaims, claims.FeatureFlags)
+		})
+	}
+}
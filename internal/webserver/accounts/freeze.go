@@ -0,0 +1,322 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+const (
+	freezeLinkTTL   = time.Hour
+	unfreezeLinkTTL = 24 * time.Hour
+
+	errTypeAccountFrozen      = "account_frozen"
+	errTypeInvalidFreezeToken = "invalid_freeze_token"
+
+	unexpectedFreezeError = "There was an unexpected error freezing the account"
+)
+
+type freezeResponse struct {
+	Message  string    `json:"message"`
+	FrozenAt time.Time `json:"frozen_at"`
+}
+
+// freezeMe freezes the caller's account right away: every session is logged out and logins
+// are blocked until the account is unfrozen with the link emailed to it
+func (h *handler) freezeMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	account, err := h.freezeAccount(ctx, r, claims.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error freezing account", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedFreezeError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, freezeResponse{
+		Message:  "Your account is frozen. Follow the link we emailed you to unfreeze it",
+		FrozenAt: *account.FrozenAt,
+	})
+}
+
+type freezeLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// requestFreezeLink emails a freeze link, for when the account's credentials are stolen and
+// its owner can't log in to freeze it. A frozen account is sent a new unfreeze link instead.
+// The response is the same whether or not the account exists.
+func (h *handler) requestFreezeLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody freezeLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Email == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := h.sendFreezeLink(ctx, reqBody.Email); err != nil {
+		slog.ErrorContext(ctx, "error sending freeze link", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedFreezeError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusAccepted, map[string]string{
+		"message": "If an account exists for this email, we've sent it a link",
+	})
+}
+
+func (h *handler) sendFreezeLink(ctx context.Context, email string) error {
+	// the link is mailed to an address anyone can type in, so don't let it be flooded
+	throttleKey := "freeze-link:" + strings.ToLower(strings.TrimSpace(email))
+	if h.checkLockout(ctx, throttleKey) > 0 {
+		return nil
+	}
+	if h.lockout != nil {
+		h.lockout.RecordFailure(ctx, throttleKey)
+	}
+
+	account, err := h.db.GetAccount(ctx, email)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return nil
+		}
+		return fmt.Errorf("error getting account: %w", err)
+	}
+
+	if account.FrozenAt != nil {
+		return h.sendUnfreezeLink(ctx, account)
+	}
+
+	token, err := h.createFreezeToken(ctx, account.ID, database.FreezeTokenPurposeFreeze, freezeLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	return mailer.SendTemplate(ctx, h.mailer, mailer.TemplateFreezeLink, account.Email, mailer.Data{
+		"Link": h.emailLink("/freeze/confirm", token),
+	})
+}
+
+type freezeTokenRequest struct {
+	Token string `json:"token"`
+}
+
+// confirmFreeze freezes the account of an emailed freeze link
+func (h *handler) confirmFreeze(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody freezeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Token == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	token, ok := h.freezeTokenFromRequest(w, r, reqBody.Token, database.FreezeTokenPurposeFreeze)
+	if !ok {
+		return
+	}
+
+	account, err := h.freezeAccount(ctx, r, token.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error freezing account", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedFreezeError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, freezeResponse{
+		Message:  "Your account is frozen. Follow the link we emailed you to unfreeze it",
+		FrozenAt: *account.FrozenAt,
+	})
+}
+
+type unfreezeRequest struct {
+	Token string `json:"token"`
+	// NewPassword replaces the password, which may be what was stolen. Not needed for accounts
+	// without one (e.g. Sign in with Apple).
+	NewPassword string `json:"new_password"`
+}
+
+// unfreeze unfreezes the account of an emailed unfreeze link and sets its new password
+func (h *handler) unfreeze(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody unfreezeRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Token == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	unexpectedErr := httputils.ErrorResponse{
+		Message:    "There was an unexpected error unfreezing the account",
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	token, ok := h.freezeTokenFromRequest(w, r, reqBody.Token, database.FreezeTokenPurposeUnfreeze)
+	if !ok {
+		return
+	}
+
+	account, err := h.db.GetAccountByID(ctx, token.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting account to unfreeze", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	var passwordHash string
+	if reqBody.NewPassword != "" || account.PasswordHash != "" {
+		passwordHash, err = h.service.HashNewPassword(reqBody.NewPassword, account.Email)
+		if err != nil {
+			var validationErr auth.ValidationError
+			if errors.As(err, &validationErr) {
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    validationErr.Error(),
+					Type:       errTypeValidationError,
+					StatusCode: http.StatusUnprocessableEntity,
+				})
+				return
+			}
+			slog.ErrorContext(ctx, "error hashing new password", "error", err)
+			httputils.WriteErrorResponse(w, r, unexpectedErr)
+			return
+		}
+	}
+	reqBody.NewPassword = ""
+
+	if _, err := h.db.UnfreezeAccount(ctx, account.ID, passwordHash); err != nil {
+		slog.ErrorContext(ctx, "error unfreezing account", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, account.ID, database.AuditEventAccountUnfrozen)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
+		"message": "Your account has been unfrozen",
+	})
+}
+
+// freezeAccount freezes the account, revokes its sessions, and emails it an unfreeze link
+func (h *handler) freezeAccount(ctx context.Context, r *http.Request, accountID string) (*database.Account, error) {
+	account, err := h.db.FreezeAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.service.RevokeSignedRefreshTokens(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	h.recordAuditEvent(ctx, r, accountID, database.AuditEventAccountFrozen)
+
+	// the account is frozen either way, and a new link can be requested
+	if err := h.sendUnfreezeLink(ctx, account); err != nil {
+		slog.ErrorContext(ctx, "error sending unfreeze link", "error", err)
+	}
+
+	return account, nil
+}
+
+func (h *handler) sendUnfreezeLink(ctx context.Context, account *database.Account) error {
+	token, err := h.createFreezeToken(ctx, account.ID, database.FreezeTokenPurposeUnfreeze, unfreezeLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	return mailer.SendTemplate(ctx, h.mailer, mailer.TemplateAccountFrozen, account.Email, mailer.Data{
+		"Link": h.emailLink("/unfreeze", token),
+	})
+}
+
+func (h *handler) createFreezeToken(ctx context.Context, accountID string, purpose database.FreezeTokenPurpose, ttl time.Duration) (string, error) {
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating freeze token: %w", err)
+	}
+
+	err = h.db.CreateFreezeToken(ctx, database.CreateFreezeTokenParams{
+		TokenHash: auth.HashOpaqueToken(token),
+		AccountID: accountID,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// freezeTokenFromRequest looks up an unexpired token for purpose. It writes the error response
+// itself when it returns false.
+func (h *handler) freezeTokenFromRequest(w http.ResponseWriter, r *http.Request, token string, purpose database.FreezeTokenPurpose) (*database.FreezeToken, bool) {
+	ctx := r.Context()
+
+	freezeToken, err := h.db.GetFreezeToken(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		if errors.Is(err, database.ErrFreezeTokenNotFound) {
+			writeInvalidFreezeToken(w, r)
+			return nil, false
+		}
+		slog.ErrorContext(ctx, "error getting freeze token", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    unexpectedFreezeError,
+			StatusCode: http.StatusInternalServerError,
+		})
+		return nil, false
+	}
+
+	if freezeToken.Purpose != purpose || time.Now().After(freezeToken.ExpiresAt) {
+		writeInvalidFreezeToken(w, r)
+		return nil, false
+	}
+
+	return freezeToken, true
+}
+
+func writeInvalidFreezeToken(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "This link is invalid or has expired",
+		Type:       errTypeInvalidFreezeToken,
+		StatusCode: http.StatusBadRequest,
+	})
+}
+
+func writeAccountFrozen(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "This account is frozen. Follow the link we emailed you to unfreeze it",
+		Type:       errTypeAccountFrozen,
+		StatusCode: http.StatusForbidden,
+	})
+}
@@ -0,0 +1,164 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountFreeze(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (*handler, *database.MemoryDB, *recordingMailer, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "freeze@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+
+		mail := &recordingMailer{}
+		h := withService(&handler{db: db, mailer: mail, authClient: authClient, appURL: "https://app.example.com"})
+		return h, db, mail, account
+	}
+
+	post := func(handle http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		handle(w, req)
+		return w
+	}
+
+	login := func(h *handler, password string) *httptest.ResponseRecorder {
+		return post(h.login, loginRequest{Email: "freeze@test.com", Password: password})
+	}
+
+	freezeMe := func(h *handler, accountID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/me/freeze", nil)
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		h.freezeMe(w, req)
+		return w
+	}
+
+	t.Run("freeze and unfreeze", func(t *testing.T) {
+		h, db, mail, account := setup(t)
+
+		session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+		require.NoError(t, err)
+
+		w := freezeMe(h, account.ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		// every session is logged out and logins are blocked
+		w = post(h.refresh, refreshRequest{RefreshToken: session.RefreshToken})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = login(h, "Test123!@#")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeAccountFrozen)
+
+		// a wrong password doesn't reveal the freeze
+		w = login(h, "wrong")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		unfreezeToken := mail.links(t, "freeze@test.com")["/unfreeze"]
+		require.NotEmpty(t, unfreezeToken)
+
+		// a new password is required since the old one may be what was stolen
+		w = post(h.unfreeze, unfreezeRequest{Token: unfreezeToken})
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+		w = post(h.unfreeze, unfreezeRequest{Token: unfreezeToken, NewPassword: "NewPass123!@#"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, login(h, "Test123!@#").Code)
+		assert.Equal(t, http.StatusOK, login(h, "NewPass123!@#").Code)
+
+		// the link only works once
+		w = post(h.unfreeze, unfreezeRequest{Token: unfreezeToken, NewPassword: "Other123!@#"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		var types []string
+		for _, e := range events {
+			types = append(types, e.EventType)
+		}
+		assert.Contains(t, types, database.AuditEventAccountFrozen)
+		assert.Contains(t, types, database.AuditEventAccountUnfrozen)
+	})
+
+	t.Run("freeze by email link", func(t *testing.T) {
+		h, _, mail, account := setup(t)
+
+		w := post(h.requestFreezeLink, freezeLinkRequest{Email: "freeze@test.com"})
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+		freezeToken := mail.links(t, "freeze@test.com")["/freeze/confirm"]
+		require.NotEmpty(t, freezeToken)
+
+		// a freeze link can't unfreeze
+		w = post(h.unfreeze, unfreezeRequest{Token: freezeToken, NewPassword: "NewPass123!@#"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = post(h.confirmFreeze, freezeTokenRequest{Token: freezeToken})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, http.StatusForbidden, login(h, "Test123!@#").Code)
+
+		// asking again while frozen sends a new unfreeze link
+		mail.sent = nil
+		w = post(h.requestFreezeLink, freezeLinkRequest{Email: account.Email})
+		require.Equal(t, http.StatusAccepted, w.Code)
+		assert.NotEmpty(t, mail.links(t, "freeze@test.com")["/unfreeze"])
+	})
+
+	t.Run("unknown email", func(t *testing.T) {
+		h, _, mail, _ := setup(t)
+
+		w := post(h.requestFreezeLink, freezeLinkRequest{Email: "nobody@test.com"})
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Empty(t, mail.sent)
+	})
+
+	t.Run("freeze link requests are throttled", func(t *testing.T) {
+		h, _, mail, _ := setup(t)
+		h.lockout = lockout.NewGuard(lockout.NewMemoryStore(), lockout.DefaultConfig())
+		h = withService(h)
+
+		for range 5 {
+			w := post(h.requestFreezeLink, freezeLinkRequest{Email: "freeze@test.com"})
+			assert.Equal(t, http.StatusAccepted, w.Code)
+		}
+		assert.Len(t, mail.sent, lockout.DefaultConfig().BackoffThreshold)
+	})
+
+	t.Run("signed refresh tokens are revoked", func(t *testing.T) {
+		h, _, _, account := setup(t)
+		h.signedRefreshTokens = true
+		h.revocations = revocation.NewList(lockout.NewMemoryStore(), authClient.RefreshTokenTTL())
+		h = withService(h)
+
+		session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusOK, freezeMe(h, account.ID).Code)
+
+		w := post(h.refresh, refreshRequest{RefreshToken: session.RefreshToken})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
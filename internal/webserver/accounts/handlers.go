@@ -4,35 +4,265 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/antiabuse"
+	"github.com/austinwofford/account-management/internal/service/audit"
 	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/featureflags"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/service/metrics"
+	"github.com/austinwofford/account-management/internal/service/revocation"
 	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	chimiddleware "github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 )
 
 // Repository defines the DB methods needed by account handlers
 type Repository interface {
+	// WithTx runs fn in a transaction. fn has to make its changes with tx for them to be part of it.
+	WithTx(ctx context.Context, fn func(tx database.Repository) error) error
 	CreateAccount(ctx context.Context, params database.AccountCreationParams) (*database.Account, error)
 	GetAccount(ctx context.Context, email string) (*database.Account, error)
+	GetAccountByUsername(ctx context.Context, username string) (*database.Account, error)
+	GetAccountByID(ctx context.Context, id string) (*database.Account, error)
 	CreateRefreshToken(ctx context.Context, params database.CreateRefreshTokenParams) error
 	GetRefreshToken(ctx context.Context, token string) (*database.RefreshToken, error)
-	DeleteRefreshToken(ctx context.Context, accountID string) error
+	RotateRefreshToken(ctx context.Context, token string, at time.Time) (*database.RefreshToken, error)
+	DeleteRefreshTokensByAccount(ctx context.Context, accountID string) error
+	DeleteRefreshTokenByToken(ctx context.Context, token string) error
+	CreateAuditEvent(ctx context.Context, params database.CreateAuditEventParams) error
+	ListAuditEvents(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error)
+	CreateAccountIdentity(ctx context.Context, params database.CreateAccountIdentityParams) (*database.AccountIdentity, error)
+	GetAccountIdentity(ctx context.Context, provider, subject string) (*database.AccountIdentity, error)
+	CreateEmailChange(ctx context.Context, params database.CreateEmailChangeParams) (*database.EmailChange, error)
+	GetEmailChangeByTokenHash(ctx context.Context, tokenHash string) (*database.EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, id string, side database.EmailChangeSide) (*database.EmailChange, error)
+	CompleteEmailChange(ctx context.Context, id string) (*database.EmailChange, error)
+	DeleteEmailChange(ctx context.Context, id string) error
+	CreateFreezeToken(ctx context.Context, params database.CreateFreezeTokenParams) error
+	GetFreezeToken(ctx context.Context, tokenHash string) (*database.FreezeToken, error)
+	FreezeAccount(ctx context.Context, id string) (*database.Account, error)
+	UnfreezeAccount(ctx context.Context, id, passwordHash string) (*database.Account, error)
+	CreateEmailVerification(ctx context.Context, params database.CreateEmailVerificationParams) error
+	GetEmailVerification(ctx context.Context, tokenHash string) (*database.EmailVerification, error)
+	VerifyAccount(ctx context.Context, id string) (*database.Account, error)
+	CreatePasswordResetToken(ctx context.Context, params database.CreatePasswordResetTokenParams) error
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (*database.PasswordResetToken, error)
+	ResetPassword(ctx context.Context, id, passwordHash string) (*database.Account, error)
+	UpdatePassword(ctx context.Context, id, passwordHash string) (*database.Account, error)
+	RehashPassword(ctx context.Context, id, oldHash, newHash string) error
+	UpdateAccountProfile(ctx context.Context, id string, params database.UpdateAccountProfileParams) (*database.Account, error)
+	UpdateAccountMetadata(ctx context.Context, id string, params database.UpdateAccountMetadataParams) (*database.Account, error)
+	DeleteAccount(ctx context.Context, id string) error
+	CreateDeletionRequest(ctx context.Context, accountID string, eraseAt time.Time) (*database.DeletionRequest, error)
+	CancelDeletionRequest(ctx context.Context, accountID string) (*database.DeletionRequest, error)
+	SetMFASecret(ctx context.Context, accountID, secret string) error
+	GetMFASecret(ctx context.Context, accountID string) (*database.MFASecret, error)
+	EnableMFA(ctx context.Context, accountID string, step int64) (*database.MFASecret, error)
+	UseMFAStep(ctx context.Context, accountID string, step int64) error
+	SetMFAPhone(ctx context.Context, accountID, phoneNumber string) error
+	GetMFAPhone(ctx context.Context, accountID string) (*database.MFAPhone, error)
+	VerifyMFAPhone(ctx context.Context, accountID string) (*database.MFAPhone, error)
+	SetMFAPhoneCode(ctx context.Context, params database.SetMFAPhoneCodeParams) error
+	UseMFAPhoneCode(ctx context.Context, accountID, codeHash string, now time.Time) error
+	ReplaceMFARecoveryCodes(ctx context.Context, accountID string, codeHashes []string) error
+	UseMFARecoveryCode(ctx context.Context, accountID, codeHash string) error
+	CountMFARecoveryCodes(ctx context.Context, accountID string) (int, error)
+	CreateTrustedDevice(ctx context.Context, params database.CreateTrustedDeviceParams) (*database.TrustedDevice, error)
+	UseTrustedDevice(ctx context.Context, params database.UseTrustedDeviceParams) error
+	ListTrustedDevices(ctx context.Context, accountID string, now time.Time) ([]database.TrustedDevice, error)
+	DeleteTrustedDevice(ctx context.Context, accountID, id string) error
+	DeleteTrustedDevices(ctx context.Context, accountID string) (int64, error)
+	ListSessions(ctx context.Context, accountID string, now time.Time) ([]database.Session, error)
+	DeleteSession(ctx context.Context, accountID, sessionID string) error
+	GetAccountRoles(ctx context.Context, accountID string) ([]string, error)
+	CreateAPIKey(ctx context.Context, params database.CreateAPIKeyParams) (*database.APIKey, error)
+	ListAPIKeys(ctx context.Context, accountID string) ([]database.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*database.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+	DeleteAPIKey(ctx context.Context, accountID, id string) error
+	CreateKnownDevice(ctx context.Context, params database.CreateKnownDeviceParams) (*database.KnownDevice, error)
+	TouchKnownDevice(ctx context.Context, params database.TouchKnownDeviceParams) error
+	CountKnownDevices(ctx context.Context, accountID string) (int, error)
+	GetKnownDeviceByRevokeTokenHash(ctx context.Context, tokenHash string) (*database.KnownDevice, error)
+	DeleteKnownDevice(ctx context.Context, id string) error
 }
 
 type handler struct {
 	db         Repository
 	authClient *auth.Client
-
-	http.Handler
+	mailer     mailer.Sender
+	lockout    *lockout.Guard
+	apple      AppleAuthenticator
+	appURL     string
+	flags      *featureflags.Evaluator
+	// tokenAppMetadataKeys are the app_metadata keys copied into access tokens
+	tokenAppMetadataKeys []string
+
+	// acceptAnyPassword skips password checks on login (mock mode only!)
+	acceptAnyPassword bool
+	// requireEmailVerification blocks logins until the account's email is verified
+	requireEmailVerification bool
+	// bindTokensToClientCert binds access tokens to the caller's verified client certificate
+	bindTokensToClientCert bool
+	// refreshTokenRotation invalidates refresh tokens once they're used, after
+	// refreshTokenGracePeriod
+	refreshTokenRotation    bool
+	refreshTokenGracePeriod time.Duration
+	// signedRefreshTokens issues self-contained refresh tokens that are checked against
+	// revocations instead of the database
+	signedRefreshTokens bool
+	revocations         *revocation.List
+	// accessTokenRevocations are the access tokens revoked before they expire
+	accessTokenRevocations *revocation.AccessTokens
+	// captcha is optional. emailAvailabilityRequireCaptcha only answers availability checks
+	// with a solved captcha so emails and usernames can't be enumerated.
+	captcha                         CaptchaVerifier
+	captchaGate                     *antiabuse.CaptchaGate
+	availabilityLimiter             *lockout.Guard
+	emailAvailabilityRequireCaptcha bool
+	passwordResetLimiter            *lockout.Guard
+	// breachedPasswords is optional. enforceBreachedPasswords rejects breached passwords
+	// instead of warning about them.
+	breachedPasswords        BreachChecker
+	enforceBreachedPasswords bool
+	// totpIssuer is the name authenticator apps show for the account
+	totpIssuer string
+	// passwords hashes new passwords, nil uses auth.DefaultHasherConfig
+	passwords *auth.PasswordHasher
+	// passwordPolicy checks new passwords, nil uses auth.DefaultPasswordPolicyConfig
+	passwordPolicy *auth.PasswordPolicy
+	// metrics is optional, a nil *metrics.Metrics records nothing
+	metrics *metrics.Metrics
+	// auditLog is optional, events are written to db before responding without it
+	auditLog audit.Recorder
+	// sessionCookies turns on cookie mode, nil keeps refresh tokens in response bodies
+	sessionCookies *SessionCookieConfig
+	// newSignInAlerts emails accounts about logins from new devices and locations.
+	// locationHeader is the request header with the client's location, empty if there's none.
+	newSignInAlerts bool
+	locationHeader  string
+	// trustedDeviceTTL is how long devices trusted after MFA skip it, 0 doesn't trust devices
+	trustedDeviceTTL time.Duration
+	// sms sends MFA codes to phone numbers, nil turns them off
+	sms *SMSConfig
+	// magicLinks log accounts in with emailed links, nil turns them off
+	magicLinks *MagicLinkConfig
+	// deletionGracePeriod is how long after asking to be erased an account is erased
+	deletionGracePeriod time.Duration
+
+	// service is the account business logic the handlers adapt to HTTP
+	service *accounts.Service
+
+	// a chi.Router rather than an http.Handler so the route catalog can walk the routes
+	chi.Router
 }
 
 type HandlerDeps struct {
-	DB         *database.DB
+	DB         Repository
 	AuthClient *auth.Client
+	Mailer     mailer.Sender
+	// Lockout throttles repeated failed logins. Optional.
+	Lockout *lockout.Guard
+	// Apple enables Sign in with Apple. Optional.
+	Apple AppleAuthenticator
+	// SSOLogin accepts the SSO login tokens the /v1/saml routes hand the web app. Set it when
+	// SAML SSO is on.
+	SSOLogin bool
+	// AppURL is the base URL of the web app that links in emails point to
+	AppURL string
+	// FeatureFlags evaluates per-account feature flags. Defaults to every flag off.
+	FeatureFlags *featureflags.Evaluator
+	// TokenAppMetadataKeys are the keys of the account's app_metadata copied into access
+	// tokens, as the "app_metadata" claim. Optional.
+	TokenAppMetadataKeys []string
+	// AcceptAnyPassword skips password checks on login. Only for mock mode.
+	AcceptAnyPassword bool
+	// RequireEmailVerification blocks password logins until the account follows the
+	// verification link emailed when it registered.
+	RequireEmailVerification bool
+	// BindTokensToClientCert issues certificate-bound access tokens (RFC 8705) to callers that
+	// authenticated the connection with a client certificate.
+	BindTokensToClientCert bool
+	// RefreshTokenRotation makes refresh tokens single use: each refresh returns a new refresh
+	// token and the old one stops working once RefreshTokenGracePeriod has passed. The grace
+	// period lets racing requests from the same client (several tabs, retries on a flaky
+	// network) all succeed.
+	RefreshTokenRotation    bool
+	RefreshTokenGracePeriod time.Duration
+	// SignedRefreshTokens issues signed, self-contained refresh tokens so refreshing doesn't
+	// read or write refresh tokens in the database. Logouts and, with rotation, used tokens are
+	// tracked in Revocations instead.
+	SignedRefreshTokens bool
+	// Revocations should be shared between replicas when SignedRefreshTokens is set. Defaults to
+	// an in-memory list.
+	Revocations *revocation.List
+	// AccessTokenRevocations are the access tokens revoked by logging out or changing the
+	// password, and rejected from then on. It should be shared between replicas. Defaults to an
+	// in-memory list.
+	AccessTokenRevocations *revocation.AccessTokens
+	// Captcha verifies captcha responses. Optional.
+	Captcha CaptchaVerifier
+	// CaptchaGate makes registering and forgot password requests always take a solved captcha,
+	// and logins once the client IP failed too many. Optional.
+	CaptchaGate *antiabuse.CaptchaGate
+	// BreachedPasswords checks new passwords on registration and password change against known
+	// breaches. Optional. Breached passwords are only flagged in the response unless
+	// EnforceBreachedPasswords rejects them.
+	BreachedPasswords        BreachChecker
+	EnforceBreachedPasswords bool
+	// EmailAvailabilityLimiter rate limits email availability checks per client IP. Defaults
+	// to DefaultEmailAvailabilityLimit per minute, kept in memory.
+	EmailAvailabilityLimiter *lockout.Guard
+	// EmailAvailabilityRequireCaptcha is the enumeration-safe mode: availability is only
+	// revealed after a captcha is verified.
+	EmailAvailabilityRequireCaptcha bool
+	// PasswordResetLimiter rate limits forgot password requests per client IP. Defaults to
+	// DefaultPasswordResetLimit per hour, kept in memory.
+	PasswordResetLimiter *lockout.Guard
+	// TOTPIssuer is the name authenticator apps show next to the account. Defaults to
+	// DefaultTOTPIssuer.
+	TOTPIssuer string
+	// Passwords hashes and verifies passwords. Defaults to auth.DefaultHasherConfig.
+	Passwords *auth.PasswordHasher
+	// PasswordPolicy is the rules new passwords have to follow. Defaults to
+	// auth.DefaultPasswordPolicyConfig.
+	PasswordPolicy *auth.PasswordPolicy
+	// Metrics records password hashing durations and issued tokens. Optional.
+	Metrics *metrics.Metrics
+	// AuditLog records security events. Defaults to writing them to DB before responding.
+	AuditLog audit.Recorder
+	// SessionCookies is cookie mode for browser clients: refresh tokens are set as HttpOnly
+	// cookies instead of returned in response bodies, and refresh and logout read them back.
+	// Optional, wrap the handler in its CSRF middleware when it's set.
+	SessionCookies *SessionCookieConfig
+	// NewSignInAlerts remembers the devices and locations accounts log in from. A login from a
+	// new one is audited and emailed to the account with a link that logs its session out.
+	NewSignInAlerts bool
+	// LocationHeader is a header a trusted proxy or CDN sets to the client's coarse location,
+	// e.g. CF-IPCountry. Without it only new devices are told apart.
+	LocationHeader string
+	// TrustedDeviceTTL is how long a device the account chose to trust when it completed MFA
+	// skips the MFA challenge on later logins. 0 doesn't let devices be trusted.
+	TrustedDeviceTTL time.Duration
+	// SMS turns on phone numbers as a second factor, with codes sent by text message or voice
+	// call. Optional.
+	SMS *SMSConfig
+	// MagicLinks turns on logging in with a single-use link emailed to the account. Optional.
+	MagicLinks *MagicLinkConfig
+	// DeletionGracePeriod is how long after POST /me/deletion-request the account is erased,
+	// unless it logs in again before then. Defaults to DefaultDeletionGracePeriod.
+	DeletionGracePeriod time.Duration
 }
 
 func NewHandler(deps HandlerDeps) http.Handler {
@@ -41,14 +271,165 @@ func NewHandler(deps HandlerDeps) http.Handler {
 	h := handler{
 		db:         deps.DB,
 		authClient: deps.AuthClient,
+		mailer:     deps.Mailer,
+		lockout:    deps.Lockout,
+		apple:      deps.Apple,
+		appURL:     deps.AppURL,
+		flags:      deps.FeatureFlags,
+
+		tokenAppMetadataKeys:     deps.TokenAppMetadataKeys,
+		acceptAnyPassword:        deps.AcceptAnyPassword,
+		requireEmailVerification: deps.RequireEmailVerification,
+		bindTokensToClientCert:   deps.BindTokensToClientCert,
+
+		refreshTokenRotation:    deps.RefreshTokenRotation,
+		refreshTokenGracePeriod: deps.RefreshTokenGracePeriod,
+		signedRefreshTokens:     deps.SignedRefreshTokens,
+		revocations:             deps.Revocations,
+		accessTokenRevocations:  deps.AccessTokenRevocations,
+
+		captcha:                         deps.Captcha,
+		captchaGate:                     deps.CaptchaGate,
+		availabilityLimiter:             deps.EmailAvailabilityLimiter,
+		emailAvailabilityRequireCaptcha: deps.EmailAvailabilityRequireCaptcha,
+		passwordResetLimiter:            deps.PasswordResetLimiter,
+		breachedPasswords:               deps.BreachedPasswords,
+		enforceBreachedPasswords:        deps.EnforceBreachedPasswords,
+		totpIssuer:                      deps.TOTPIssuer,
+		passwords:                       deps.Passwords,
+		passwordPolicy:                  deps.PasswordPolicy,
+		metrics:                         deps.Metrics,
+		auditLog:                        deps.AuditLog,
+		sessionCookies:                  deps.SessionCookies,
+		newSignInAlerts:                 deps.NewSignInAlerts,
+		locationHeader:                  deps.LocationHeader,
+		trustedDeviceTTL:                deps.TrustedDeviceTTL,
+		sms:                             deps.SMS,
+		magicLinks:                      deps.MagicLinks,
+		deletionGracePeriod:             deps.DeletionGracePeriod,
+	}
+
+	if h.flags == nil {
+		h.flags = featureflags.NewEvaluator(featureflags.Config{})
+	}
+	if h.revocations == nil && h.authClient != nil {
+		h.revocations = revocation.NewList(lockout.NewMemoryStore(), h.authClient.RefreshTokenTTL())
+	}
+	if h.accessTokenRevocations == nil {
+		h.accessTokenRevocations = revocation.NewAccessTokens(revocation.NewMemoryTokenStore())
+	}
+	if h.availabilityLimiter == nil {
+		h.availabilityLimiter = NewEmailAvailabilityLimiter(lockout.NewMemoryStore(), DefaultEmailAvailabilityLimit)
 	}
+	if h.passwordResetLimiter == nil {
+		h.passwordResetLimiter = NewPasswordResetLimiter(lockout.NewMemoryStore(), DefaultPasswordResetLimit)
+	}
+	if h.totpIssuer == "" {
+		h.totpIssuer = DefaultTOTPIssuer
+	}
+	if h.deletionGracePeriod == 0 {
+		h.deletionGracePeriod = DefaultDeletionGracePeriod
+	}
+	h.service = h.newService()
 
 	mux.Post("/register", h.register)
 	mux.Post("/login", h.login)
+	mux.Post("/login/mfa", h.loginMFA)
 	mux.Post("/refresh", h.refresh)
 	mux.Post("/logout", h.logout)
+	if h.sessionCookies != nil {
+		mux.Get("/csrf-token", h.sessionCookies.CSRF.TokenHandler)
+	}
+	mux.Get("/availability", h.emailAvailability)
+	mux.Get("/username-available", h.usernameAvailability)
+	mux.Get("/password-policy", h.passwordPolicyRequirements)
+	if deps.CaptchaGate != nil {
+		mux.Get("/captcha", h.captchaConfig)
+	}
+
+	mux.Post("/verify", h.verify)
+	mux.Post("/verify/resend", h.resendVerification)
+
+	mux.Post("/password/forgot", h.forgotPassword)
+	mux.Post("/password/reset", h.resetPassword)
+
+	mux.Post("/email-change/confirm", h.confirmEmailChange)
+	mux.Post("/email-change/cancel", h.cancelEmailChange)
+
+	mux.Post("/freeze/request", h.requestFreezeLink)
+	mux.Post("/freeze/confirm", h.confirmFreeze)
+	mux.Post("/unfreeze", h.unfreeze)
+
+	mux.Post("/sign-ins/revoke", h.revokeSignIn)
+
+	if deps.Apple != nil {
+		mux.Post("/login/apple", h.loginWithApple)
+	}
+	if deps.SSOLogin {
+		mux.Post("/login/sso", h.loginSSO)
+	}
+	if deps.SMS != nil {
+		mux.Post("/login/mfa/sms", h.sendLoginCode)
+	}
+	if deps.MagicLinks != nil {
+		mux.Post("/login/magic-link", h.requestMagicLink)
+		mux.Post("/login/magic-link/verify", h.verifyMagicLink)
+	}
+
+	// changing the account, its credentials, or API keys takes an access token
+	mux.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(deps.AuthClient, h.accessTokenRevocations))
+		r.Delete("/me", h.deleteMe)
+		r.Post("/me/deletion-request", h.requestDeletion)
+		r.Post("/me/email", h.requestEmailChange)
+		r.Post("/me/freeze", h.freezeMe)
+		r.Post("/password/change", h.changePassword)
+		r.Post("/mfa/totp/setup", h.setupTOTP)
+		r.Post("/mfa/totp/verify", h.verifyTOTP)
+		r.Post("/mfa/recovery-codes", h.regenerateRecoveryCodes)
+		if deps.SMS != nil {
+			r.Post("/mfa/sms/setup", h.setupPhone)
+			r.Post("/mfa/sms/verify", h.verifyPhone)
+		}
+		r.Post("/me/api-keys", h.createAPIKey)
+		r.Get("/me/api-keys", h.listAPIKeys)
+		r.Delete("/me/api-keys/{id}", h.revokeAPIKey)
+		r.Get("/me/devices", h.listTrustedDevices)
+		r.Delete("/me/devices", h.removeTrustedDevices)
+		r.Delete("/me/devices/{id}", h.removeTrustedDevice)
+	})
 
-	h.Handler = mux
+	// the rest take an API key, or an access token, with the right scope too
+	mux.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuthOrAPIKey(deps.AuthClient, h.accessTokenRevocations, &h))
+
+		r.With(middleware.RequireScope(auth.ScopeAccountRead)).Group(func(r chi.Router) {
+			r.Get("/me", h.me)
+			r.Get("/me/activity", h.activity)
+			r.Get("/me/audit", h.activity)
+			r.Get("/me/activity/export", h.exportActivity)
+			r.Get("/me/feature-flags", h.featureFlags)
+			// signed refresh tokens aren't stored, so there are no sessions to list
+			if !deps.SignedRefreshTokens {
+				r.Get("/sessions", h.listSessions)
+			}
+		})
+
+		r.With(middleware.RequireScope(auth.ScopeAccountWrite)).Group(func(r chi.Router) {
+			r.Patch("/me", h.updateMe)
+			r.Patch("/me/metadata", h.updateMetadata)
+		})
+
+		r.With(middleware.RequireScope(auth.ScopeSessionsWrite)).Group(func(r chi.Router) {
+			r.Post("/logout-all", h.logoutAll)
+			r.Post("/sessions/revoke-all", h.logoutAll)
+			if !deps.SignedRefreshTokens {
+				r.Delete("/sessions/{id}", h.revokeSession)
+			}
+		})
+	})
+
+	h.Router = mux
 
 	return h
 }
@@ -58,22 +439,32 @@ const (
 
 	unexpectedAccountCreationErrorMessage = "There was an unexpected error creating the account"
 	unexpectedLoginError                  = "There was an unexpected error logging in"
+	unexpectedLogoutError                 = "There was an unexpected error logging out"
 
 	errTypeAccountAlreadyExists = "account_already_exists"
 	errTypeAccountNotFound      = "account_not_found"
 	errTypeIncorrectPassword    = "incorrect_password"
 	errTypeInvalidRefreshToken  = "invalid_refresh_token"
 	errTypeValidationError      = "validation_error"
+	errTypeTooManyAttempts      = "too_many_attempts"
 )
 
 type registerRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Username is optional
+	Username        string `json:"username"`
+	PreferredLocale string `json:"preferred_locale"`
+	// CaptchaToken is the captcha provider's response token, when a captcha is configured
+	CaptchaToken string `json:"captcha_token"`
 }
 
 type registerResponse struct {
 	Message   string `json:"message"`
 	AccountID string `json:"account_id"`
+	// PasswordBreached warns that the password appeared in a data breach, when breached
+	// passwords are allowed
+	PasswordBreached bool `json:"password_breached,omitempty"`
 }
 
 func (h *handler) register(w http.ResponseWriter, r *http.Request) {
@@ -91,80 +482,124 @@ func (h *handler) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !auth.IsValidEmail(reqBody.Email) {
-		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
-			Message:    "The provided email address is invalid",
-			Type:       errTypeValidationError,
-			StatusCode: http.StatusUnprocessableEntity,
-		})
+	if !h.checkCaptcha(w, r, antiabuse.ActionRegister, reqBody.CaptchaToken) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(reqBody.Password)
+	result, err := h.service.Register(ctx, accounts.RegisterParams{
+		Email:           reqBody.Email,
+		Password:        reqBody.Password,
+		Username:        strings.TrimSpace(reqBody.Username),
+		PreferredLocale: reqBody.PreferredLocale,
+	}, h.client(r))
+	// unset the plaintext password
+	reqBody.Password = ""
 	if err != nil {
 		var validationErr auth.ValidationError
-		if errors.As(err, &validationErr) {
+		switch {
+		case errors.Is(err, accounts.ErrInvalidEmail):
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The provided email address is invalid",
+				Type:       errTypeValidationError,
+				StatusCode: http.StatusUnprocessableEntity,
+			})
+		case errors.Is(err, accounts.ErrInvalidUsername), errors.Is(err, accounts.ErrReservedUsername):
+			writeInvalidUsername(w, r, err)
+		case errors.Is(err, accounts.ErrUnsupportedLocale):
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The provided preferred locale is not supported",
+				Type:       errTypeValidationError,
+				StatusCode: http.StatusUnprocessableEntity,
+			})
+		case errors.As(err, &validationErr):
 			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
 				Message:    err.Error(),
 				Type:       errTypeValidationError,
 				StatusCode: http.StatusUnprocessableEntity,
 			})
-			return
-		}
-		slog.ErrorContext(ctx, "error hashing password", "error", err)
-		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
-			Message:    unexpectedAccountCreationErrorMessage,
-			StatusCode: http.StatusInternalServerError,
-		})
-		return
-	}
-
-	// unset the plaintext password
-	reqBody.Password = ""
-
-	// check if account already exists, if so return err
-	// add account to db
-	createdAccount, err := h.db.CreateAccount(ctx, database.AccountCreationParams{
-		Email:        reqBody.Email,
-		PasswordHash: hashedPassword,
-	})
-	if err != nil {
-		if errors.Is(err, database.ErrAccountAlreadyExists) {
+		case errors.Is(err, accounts.ErrBreachedPassword):
+			writeBreachedPassword(w, r)
+		case errors.Is(err, accounts.ErrAccountAlreadyExists):
 			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
 				Message:    "An account with this email already exists",
 				Type:       errTypeAccountAlreadyExists,
 				StatusCode: http.StatusConflict,
 			})
-			return
+		case errors.Is(err, accounts.ErrUsernameTaken):
+			writeUsernameTaken(w, r)
+		default:
+			slog.ErrorContext(ctx, "error registering account", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    unexpectedAccountCreationErrorMessage,
+				StatusCode: http.StatusInternalServerError,
+			})
 		}
-
-		slog.ErrorContext(ctx, "error persisting new account to the db", "error", err)
-		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
-			Message:    unexpectedAccountCreationErrorMessage,
-			StatusCode: http.StatusInternalServerError,
-		})
 		return
 	}
-	// return user ID
+
 	httputils.WriteJSONResponse(w, r, http.StatusCreated, registerResponse{
-		Message:   "Account created successfully",
-		AccountID: createdAccount.ID,
+		Message:          "Account created successfully",
+		AccountID:        result.Account.ID,
+		PasswordBreached: result.PasswordBreached,
 	})
 }
 
+// loginRequest identifies the account by email or by username, whichever is set
 type loginRequest struct {
 	Email    string `json:"email"`
+	Username string `json:"username"`
 	Password string `json:"password"`
+	// DeviceToken is from an earlier login that trusted the device, it skips MFA
+	DeviceToken string `json:"device_token"`
+	// CaptchaToken is the captcha provider's response token, needed once the client failed too
+	// many logins
+	CaptchaToken string `json:"captcha_token"`
+	// Scopes restrict the session's access tokens, e.g. for handing them to an integration.
+	// Optional.
+	Scopes []string `json:"scopes"`
 }
 
 // loginOrRefreshResponse is used for both login and refresh responses
 type loginOrRefreshResponse struct {
-	Message      string `json:"message"`
-	AccountID    string `json:"account_id"`
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	Message     string `json:"message"`
+	AccountID   string `json:"account_id"`
+	AccessToken string `json:"access_token"`
+	// RefreshToken is left out in cookie mode, it's only in the cookie
+	RefreshToken string `json:"refresh_token,omitempty"`
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int    `json:"expires_in"`
+	// Scopes are the ones the access token is restricted to, left out when it isn't
+	Scopes []string `json:"scopes,omitempty"`
+	// DeviceToken is only set when an MFA login trusted its device
+	DeviceToken          string `json:"device_token,omitempty"`
+	DeviceTokenExpiresIn int    `json:"device_token_expires_in,omitempty"`
+	// RecoveryCodesRemaining is only set when an MFA login used a recovery code, and Warning
+	// when few are left
+	RecoveryCodesRemaining *int   `json:"recovery_codes_remaining,omitempty"`
+	Warning                string `json:"warning,omitempty"`
+}
+
+func newLoginOrRefreshResponse(tokens *accounts.Tokens) loginOrRefreshResponse {
+	response := loginOrRefreshResponse{
+		Message:      "Success",
+		AccountID:    tokens.AccountID,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		TokenType:    tokenTypeBearer,
+		ExpiresIn:    int(time.Until(tokens.AccessTokenExpiresAt).Seconds()),
+		Scopes:       tokens.Scopes,
+	}
+	if tokens.DeviceToken != "" {
+		response.DeviceToken = tokens.DeviceToken
+		response.DeviceTokenExpiresIn = int(time.Until(tokens.DeviceTokenExpiresAt).Seconds())
+	}
+	if tokens.RecoveryCodesLeft != nil {
+		response.RecoveryCodesRemaining = tokens.RecoveryCodesLeft
+		if *tokens.RecoveryCodesLeft <= accounts.LowRecoveryCodes {
+			response.Warning = fmt.Sprintf("You have %d recovery codes left, generate new ones before you run out", *tokens.RecoveryCodesLeft)
+		}
+	}
+	return response
 }
 
 func (h *handler) login(w http.ResponseWriter, r *http.Request) {
@@ -182,49 +617,71 @@ func (h *handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// check email and password
-	account, err := h.db.GetAccount(ctx, reqBody.Email)
-	if err != nil {
-		if errors.Is(err, database.ErrAccountNotFound) {
-			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
-				Message:    "No account was found matching this email",
-				Type:       errTypeAccountNotFound,
-				StatusCode: http.StatusUnauthorized,
-			})
-			return
-		}
-		slog.ErrorContext(ctx, "error getting account for login", "error", err)
-		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
-			Message:    unexpectedLoginError,
-			StatusCode: http.StatusInternalServerError,
-		})
+	scopes, ok := tokenScopes(reqBody.Scopes)
+	if !ok {
+		writeInvalidScope(w, r)
 		return
 	}
 
-	if !auth.PasswordIsCorrect(reqBody.Password, account.PasswordHash) {
-		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
-			Message:    "Password is incorrect",
-			Type:       errTypeIncorrectPassword,
-			StatusCode: http.StatusUnauthorized,
-		})
+	if !h.checkCaptcha(w, r, antiabuse.ActionLogin, reqBody.CaptchaToken) {
 		return
 	}
 
+	client := h.client(r)
+	client.DeviceToken = reqBody.DeviceToken
+	client.Scopes = scopes
+	identifier := reqBody.Email
+	if identifier == "" {
+		identifier = reqBody.Username
+	}
+	result, err := h.service.Login(ctx, identifier, reqBody.Password, client)
 	// unset the plaintext password
 	reqBody.Password = ""
+	if err != nil {
+		var lockedOut *accounts.LockedOutError
+		switch {
+		case errors.As(err, &lockedOut):
+			writeTooManyAttempts(w, r, lockedOut.RetryAfter)
+		case errors.Is(err, accounts.ErrAccountNotFound):
+			h.recordCaptchaLoginFailure(r)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "No account was found matching this email or username",
+				Type:       errTypeAccountNotFound,
+				StatusCode: http.StatusUnauthorized,
+			})
+		case errors.Is(err, accounts.ErrIncorrectPassword):
+			h.recordCaptchaLoginFailure(r)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "Password is incorrect",
+				Type:       errTypeIncorrectPassword,
+				StatusCode: http.StatusUnauthorized,
+			})
+		case errors.Is(err, accounts.ErrAccountFrozen):
+			writeAccountFrozen(w, r)
+		case errors.Is(err, accounts.ErrEmailNotVerified):
+			writeEmailNotVerified(w, r)
+		default:
+			slog.ErrorContext(ctx, "error logging in", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    unexpectedLoginError,
+				StatusCode: http.StatusInternalServerError,
+			})
+		}
+		return
+	}
 
-	// Generate and persist tokens
-	response, errResponse := h.generateAndPersistTokens(ctx, account.ID)
-	if errResponse != nil {
-		httputils.WriteErrorResponse(w, r, *errResponse)
+	if result.Tokens == nil {
+		writeMFAChallenge(w, r, result)
 		return
 	}
 
-	httputils.WriteJSONResponse(w, r, http.StatusOK, *response)
+	h.writeTokens(w, r, result.Tokens)
 }
 
 type refreshRequest struct {
 	RefreshToken string `json:"refresh_token"`
+	// Scopes narrow the session to some of the scopes it has. Optional.
+	Scopes []string `json:"scopes"`
 }
 
 func (h *handler) refresh(w http.ResponseWriter, r *http.Request) {
@@ -232,7 +689,7 @@ func (h *handler) refresh(w http.ResponseWriter, r *http.Request) {
 
 	var reqBody refreshRequest
 
-	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	err := h.decodeSessionRequest(r, &reqBody)
 	if err != nil {
 		slog.ErrorContext(ctx, "error decoding login request body", "error", err.Error())
 		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
@@ -242,19 +699,39 @@ func (h *handler) refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// if validation fails, return a 401
-	token, err := h.db.GetRefreshToken(ctx, reqBody.RefreshToken)
+	scopes, ok := tokenScopes(reqBody.Scopes)
+	if !ok {
+		writeInvalidScope(w, r)
+		return
+	}
+
+	fromCookie := false
+	if reqBody.RefreshToken == "" {
+		reqBody.RefreshToken = h.refreshTokenFromCookie(r)
+		fromCookie = reqBody.RefreshToken != ""
+	}
+
+	client := h.client(r)
+	client.Scopes = scopes
+	tokens, err := h.service.Refresh(ctx, reqBody.RefreshToken, client)
 	if err != nil {
-		if errors.Is(err, database.ErrRefreshTokenNotFound) {
+		if errors.Is(err, accounts.ErrScopeNotGranted) {
 			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
-				Message:    "Your session has expired",
-				Type:       errTypeInvalidRefreshToken,
-				StatusCode: http.StatusUnauthorized,
+				Message:    "The session wasn't granted the requested scopes",
+				Type:       errTypeInvalidScope,
+				StatusCode: http.StatusBadRequest,
 			})
 			return
 		}
-
-		slog.ErrorContext(ctx, "error getting refresh token from db")
+		if errors.Is(err, accounts.ErrSessionExpired) {
+			// so the browser stops sending the dead session
+			if fromCookie {
+				h.clearSessionCookies(w)
+			}
+			writeSessionExpired(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error refreshing tokens", "error", err)
 		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
 			Message:    "Error validating session",
 			StatusCode: http.StatusInternalServerError,
@@ -262,28 +739,13 @@ func (h *handler) refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// if the refresh token is expired, return a 401
-	if token.ExpiresAt.Before(time.Now()) {
-		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
-			Message:    "Your session has expired",
-			Type:       errTypeInvalidRefreshToken,
-			StatusCode: http.StatusUnauthorized,
-		})
-		return
-	}
-
-	// Generate and persist new tokens
-	response, errResponse := h.generateAndPersistTokens(ctx, token.AccountID)
-	if errResponse != nil {
-		httputils.WriteErrorResponse(w, r, *errResponse)
-		return
-	}
-
-	httputils.WriteJSONResponse(w, r, http.StatusOK, *response)
+	h.writeTokens(w, r, tokens)
 }
 
 type logoutRequest struct {
 	RefreshToken string `json:"refresh_token"`
+	// AllDevices ends every session of the token's account instead of only the token's
+	AllDevices bool `json:"all_devices"`
 }
 
 func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
@@ -291,7 +753,7 @@ func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
 
 	var reqBody logoutRequest
 
-	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	err := h.decodeSessionRequest(r, &reqBody)
 	if err != nil {
 		slog.ErrorContext(ctx, "error decoding logout request body", "error", err.Error())
 		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
@@ -301,80 +763,223 @@ func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the refresh token to find the account ID
-	token, err := h.db.GetRefreshToken(ctx, reqBody.RefreshToken)
+	if reqBody.RefreshToken == "" {
+		reqBody.RefreshToken = h.refreshTokenFromCookie(r)
+	}
+
+	err = h.revokeBearerToken(r)
+	if err == nil {
+		err = h.service.Logout(ctx, reqBody.RefreshToken, reqBody.AllDevices, h.client(r))
+	}
 	if err != nil {
-		if errors.Is(err, database.ErrRefreshTokenNotFound) {
-			// Token doesn't exist, but that's okay for logout
-			httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
-				"message": "Logged out successfully",
-			})
-			return
-		}
-		slog.ErrorContext(ctx, "error getting refresh token for logout", "error", err)
+		slog.ErrorContext(ctx, "error logging out", "error", err)
 		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
-			Message:    "There was an unexpected error logging out",
+			Message:    unexpectedLogoutError,
 			StatusCode: http.StatusInternalServerError,
 		})
 		return
 	}
 
-	// Delete the refresh token to revoke the session
-	// (prevents using the refresh token to get a new access token without another login)
-	err = h.db.DeleteRefreshToken(ctx, token.AccountID)
+	if h.sessionCookies != nil {
+		h.clearSessionCookies(w)
+	}
+
+	if reqBody.AllDevices {
+		httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
+			"message": "Logged out of every session",
+		})
+		return
+	}
+	httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
+		"message": "Logged out successfully",
+	})
+}
+
+// logoutAll ends every session of the caller's account, on every device
+func (h *handler) logoutAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	// the caller's access token stops working right away, the others when they expire
+	err := h.revokeAccessToken(ctx)
+	if err == nil {
+		err = h.service.LogoutAll(ctx, claims.AccountID, h.client(r))
+	}
 	if err != nil {
-		slog.ErrorContext(ctx, "error deleting refresh token", "error", err)
+		slog.ErrorContext(ctx, "error revoking account sessions", "error", err)
 		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
-			Message:    "There was an unexpected error logging out",
+			Message:    unexpectedLogoutError,
 			StatusCode: http.StatusInternalServerError,
 		})
 		return
 	}
 
+	if h.sessionCookies != nil {
+		h.clearSessionCookies(w)
+	}
+
 	httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
-		"message": "Logged out successfully",
+		"message": "Logged out of every session",
 	})
 }
 
-// generateAndPersistTokens creates new access and refresh tokens for the given account
-func (h *handler) generateAndPersistTokens(ctx context.Context, accountID string) (*loginOrRefreshResponse, *httputils.ErrorResponse) {
-	// Create a refresh token and persist in the db
-	refreshToken, refreshTokenExpiresAt := h.authClient.NewRefreshToken()
+// revokeAccessToken revokes the access token the caller authenticated with, so it stops
+// working before it expires. Contexts without one are left alone.
+func (h *handler) revokeAccessToken(ctx context.Context) error {
+	token, ok := middleware.AccessTokenFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return h.accessTokenRevocations.Revoke(ctx, token.ID, token.ExpiresAt)
+}
 
-	err := h.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		AccountID: accountID,
-		ExpiresAt: refreshTokenExpiresAt,
-	})
+// revokeBearerToken revokes the access token sent along with a request that doesn't require
+// one, like logout. Invalid tokens don't work anyway and are ignored.
+func (h *handler) revokeBearerToken(r *http.Request) error {
+	tokenString, ok := middleware.BearerToken(r)
+	if !ok {
+		return nil
+	}
+	token, err := h.authClient.InspectAccessToken(tokenString)
 	if err != nil {
-		slog.ErrorContext(ctx, "error creating refresh token", "error", err)
-		return nil, &httputils.ErrorResponse{
-			Message:    "Error creating new token",
-			StatusCode: http.StatusInternalServerError,
-		}
+		return nil
 	}
+	return h.accessTokenRevocations.Revoke(r.Context(), token.ID, token.ExpiresAt)
+}
 
-	// Create access token
-	accessToken, accessTokenExpiresAt, err := h.authClient.NewAccessToken(auth.Claims{
-		AccountID: accountID,
-	})
+// writeIdentityLogin logs in an account an identity provider signed in as and responds with its
+// tokens, or an MFA challenge for accounts with MFA enabled
+func (h *handler) writeIdentityLogin(w http.ResponseWriter, r *http.Request, accountID string, client accounts.Client) {
+	result, err := h.service.LoginWithIdentity(r.Context(), accountID, client)
 	if err != nil {
-		slog.ErrorContext(ctx, "error creating new access token", "error", err)
-		return nil, &httputils.ErrorResponse{
+		slog.ErrorContext(r.Context(), "error issuing tokens", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
 			Message:    "Error creating new token",
 			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	if result.Tokens == nil {
+		writeMFAChallenge(w, r, result)
+		return
+	}
+
+	h.writeTokens(w, r, result.Tokens)
+}
+
+// writeTokens responds with new tokens. In cookie mode the refresh token is set as a cookie
+// instead of returned.
+func (h *handler) writeTokens(w http.ResponseWriter, r *http.Request, tokens *accounts.Tokens) {
+	response := newLoginOrRefreshResponse(tokens)
+	if h.sessionCookies != nil {
+		if err := h.setSessionCookies(w, tokens); err != nil {
+			slog.ErrorContext(r.Context(), "error setting session cookies", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "Error creating new token",
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
 		}
+		response.RefreshToken = ""
 	}
+	httputils.WriteJSONResponse(w, r, http.StatusOK, response)
+}
 
-	now := time.Now()
-	accessTokenExpiresIn := accessTokenExpiresAt.Sub(now).Seconds()
+func (h *handler) checkLockout(ctx context.Context, key string) time.Duration {
+	if h.lockout == nil {
+		return 0
+	}
+	return h.lockout.Check(ctx, key)
+}
 
-	return &loginOrRefreshResponse{
-		Message:      "Success",
-		AccountID:    accountID,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		TokenType:    tokenTypeBearer,
-		ExpiresIn:    int(accessTokenExpiresIn),
-	}, nil
+func (h *handler) recordLoginFailure(ctx context.Context, key string) {
+	if h.lockout == nil {
+		return
+	}
+	if wait := h.lockout.RecordFailure(ctx, key); wait > 0 {
+		slog.WarnContext(ctx, "login attempts blocked after repeated failures", "retry_after", wait.String())
+	}
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	// round up so clients never retry a moment too early
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Too many failed login attempts, try again later",
+		Type:       errTypeTooManyAttempts,
+		StatusCode: http.StatusTooManyRequests,
+	})
+}
+
+// newService builds the account service behind the handlers from the handler's dependencies
+func (h *handler) newService() *accounts.Service {
+	return accounts.NewService(accounts.Config{
+		DB:                       h.db,
+		AuthClient:               h.authClient,
+		Mailer:                   h.mailer,
+		AppURL:                   h.appURL,
+		Lockout:                  h.lockout,
+		FeatureFlags:             h.flags,
+		TokenAppMetadataKeys:     h.tokenAppMetadataKeys,
+		AcceptAnyPassword:        h.acceptAnyPassword,
+		RequireEmailVerification: h.requireEmailVerification,
+		RefreshTokenRotation:     h.refreshTokenRotation,
+		RefreshTokenGracePeriod:  h.refreshTokenGracePeriod,
+		SignedRefreshTokens:      h.signedRefreshTokens,
+		Revocations:              h.revocations,
+		AccessTokenRevocations:   h.accessTokenRevocations,
+		BreachedPasswords:        h.breachedPasswords,
+		EnforceBreachedPasswords: h.enforceBreachedPasswords,
+		Passwords:                h.passwords,
+		PasswordPolicy:           h.passwordPolicy,
+		Metrics:                  h.metrics,
+		AuditLog:                 h.auditLog,
+		NewSignInAlerts:          h.newSignInAlerts,
+		TrustedDeviceTTL:         h.trustedDeviceTTL,
+		SMS:                      h.sms,
+		MagicLinks:               h.magicLinks,
+	})
+}
+
+// client is who the request comes from, for the service
+func (h *handler) client(r *http.Request) accounts.Client {
+	return accounts.Client{
+		IPAddress:    httputils.ClientIP(r),
+		UserAgent:    r.UserAgent(),
+		RequestID:    chimiddleware.GetReqID(r.Context()),
+		Location:     h.clientLocation(r),
+		Confirmation: h.tokenConfirmation(r),
+	}
+}
+
+// clientLocation is the location the trusted proxy put in locationHeader, if any
+func (h *handler) clientLocation(r *http.Request) string {
+	if h.locationHeader == "" {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get(h.locationHeader))
+}
+
+// tokenConfirmation returns the claim binding new access tokens to the caller's client
+// certificate, or nil if binding is off or there's no verified certificate
+func (h *handler) tokenConfirmation(r *http.Request) *auth.Confirmation {
+	if !h.bindTokensToClientCert {
+		return nil
+	}
+	cert, ok := middleware.VerifiedClientCertificate(r)
+	if !ok {
+		return nil
+	}
+	return &auth.Confirmation{X5TS256: auth.CertificateThumbprint(cert)}
+}
+
+func writeSessionExpired(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Your session has expired",
+		Type:       errTypeInvalidRefreshToken,
+		StatusCode: http.StatusUnauthorized,
+	})
 }
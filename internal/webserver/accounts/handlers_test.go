@@ -11,18 +11,40 @@ import (
 	"time"
 
 	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/i18n"
+	"github.com/austinwofford/account-management/internal/service/accounts"
 	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/revocation"
 	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Mock implementations
 type mockDBRepository struct {
+	// the methods that aren't stubbed panic, the embedded interface only lets WithTx hand the
+	// mock to its fn
+	database.Repository
+
 	createAccountFn      func(ctx context.Context, params database.AccountCreationParams) (*database.Account, error)
 	getAccountFn         func(ctx context.Context, email string) (*database.Account, error)
 	createRefreshTokenFn func(ctx context.Context, params database.CreateRefreshTokenParams) error
 	getRefreshTokenFn    func(ctx context.Context, token string) (*database.RefreshToken, error)
 	deleteRefreshTokenFn func(ctx context.Context, accountID string) error
+	deleteByTokenFn      func(ctx context.Context, token string) error
+	createAuditEventFn   func(ctx context.Context, params database.CreateAuditEventParams) error
+	listAuditEventsFn    func(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error)
+	createIdentityFn     func(ctx context.Context, params database.CreateAccountIdentityParams) (*database.AccountIdentity, error)
+	getIdentityFn        func(ctx context.Context, provider, subject string) (*database.AccountIdentity, error)
+	getAccountByIDFn     func(ctx context.Context, id string) (*database.Account, error)
+	createVerificationFn func(ctx context.Context, params database.CreateEmailVerificationParams) error
+	rehashPasswordFn     func(ctx context.Context, id, oldHash, newHash string) error
+}
+
+func (m *mockDBRepository) WithTx(ctx context.Context, fn func(tx database.Repository) error) error {
+	return fn(m)
 }
 
 func (m *mockDBRepository) CreateAccount(ctx context.Context, params database.AccountCreationParams) (*database.Account, error) {
@@ -39,6 +61,13 @@ func (m *mockDBRepository) GetAccount(ctx context.Context, email string) (*datab
 	return &database.Account{ID: "test-id", Email: email, PasswordHash: "hashed-password"}, nil
 }
 
+func (m *mockDBRepository) GetAccountByID(ctx context.Context, id string) (*database.Account, error) {
+	if m.getAccountByIDFn != nil {
+		return m.getAccountByIDFn(ctx, id)
+	}
+	return &database.Account{ID: id, Email: "test@example.com", PasswordHash: "hashed-password"}, nil
+}
+
 func (m *mockDBRepository) CreateRefreshToken(ctx context.Context, params database.CreateRefreshTokenParams) error {
 	if m.createRefreshTokenFn != nil {
 		return m.createRefreshTokenFn(ctx, params)
@@ -57,28 +86,192 @@ func (m *mockDBRepository) GetRefreshToken(ctx context.Context, token string) (*
 	}, nil
 }
 
-func (m *mockDBRepository) DeleteRefreshToken(ctx context.Context, accountID string) error {
+func (m *mockDBRepository) RotateRefreshToken(ctx context.Context, token string, at time.Time) (*database.RefreshToken, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockDBRepository) DeleteRefreshTokensByAccount(ctx context.Context, accountID string) error {
 	if m.deleteRefreshTokenFn != nil {
 		return m.deleteRefreshTokenFn(ctx, accountID)
 	}
 	return nil
 }
 
+func (m *mockDBRepository) DeleteRefreshTokenByToken(ctx context.Context, token string) error {
+	if m.deleteByTokenFn != nil {
+		return m.deleteByTokenFn(ctx, token)
+	}
+	return nil
+}
+
+func (m *mockDBRepository) CreateAuditEvent(ctx context.Context, params database.CreateAuditEventParams) error {
+	if m.createAuditEventFn != nil {
+		return m.createAuditEventFn(ctx, params)
+	}
+	return nil
+}
+
+func (m *mockDBRepository) ListAuditEvents(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error) {
+	if m.listAuditEventsFn != nil {
+		return m.listAuditEventsFn(ctx, params)
+	}
+	return nil, nil
+}
+
+func (m *mockDBRepository) CreateAccountIdentity(ctx context.Context, params database.CreateAccountIdentityParams) (*database.AccountIdentity, error) {
+	if m.createIdentityFn != nil {
+		return m.createIdentityFn(ctx, params)
+	}
+	return &database.AccountIdentity{ID: "test-identity-id", AccountID: params.AccountID}, nil
+}
+
+func (m *mockDBRepository) GetAccountIdentity(ctx context.Context, provider, subject string) (*database.AccountIdentity, error) {
+	if m.getIdentityFn != nil {
+		return m.getIdentityFn(ctx, provider, subject)
+	}
+	return nil, database.ErrAccountIdentityNotFound
+}
+
+// email changes are tested against the in-memory database so these are just stubs
+func (m *mockDBRepository) CreateEmailChange(ctx context.Context, params database.CreateEmailChangeParams) (*database.EmailChange, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockDBRepository) GetEmailChangeByTokenHash(ctx context.Context, tokenHash string) (*database.EmailChange, error) {
+	return nil, database.ErrEmailChangeNotFound
+}
+
+func (m *mockDBRepository) ConfirmEmailChange(ctx context.Context, id string, side database.EmailChangeSide) (*database.EmailChange, error) {
+	return nil, database.ErrEmailChangeNotFound
+}
+
+func (m *mockDBRepository) CompleteEmailChange(ctx context.Context, id string) (*database.EmailChange, error) {
+	return nil, database.ErrEmailChangeNotFound
+}
+
+func (m *mockDBRepository) DeleteEmailChange(ctx context.Context, id string) error {
+	return nil
+}
+
+// freezes are tested against the in-memory database too
+func (m *mockDBRepository) CreateFreezeToken(ctx context.Context, params database.CreateFreezeTokenParams) error {
+	return errors.New("not implemented")
+}
+
+func (m *mockDBRepository) GetFreezeToken(ctx context.Context, tokenHash string) (*database.FreezeToken, error) {
+	return nil, database.ErrFreezeTokenNotFound
+}
+
+func (m *mockDBRepository) FreezeAccount(ctx context.Context, id string) (*database.Account, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockDBRepository) UnfreezeAccount(ctx context.Context, id, passwordHash string) (*database.Account, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockDBRepository) CreateEmailVerification(ctx context.Context, params database.CreateEmailVerificationParams) error {
+	if m.createVerificationFn != nil {
+		return m.createVerificationFn(ctx, params)
+	}
+	return nil
+}
+
+func (m *mockDBRepository) GetEmailVerification(ctx context.Context, tokenHash string) (*database.EmailVerification, error) {
+	return nil, database.ErrEmailVerificationNotFound
+}
+
+func (m *mockDBRepository) VerifyAccount(ctx context.Context, id string) (*database.Account, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockDBRepository) CreatePasswordResetToken(ctx context.Context, params database.CreatePasswordResetTokenParams) error {
+	return errors.New("not implemented")
+}
+
+func (m *mockDBRepository) GetPasswordResetToken(ctx context.Context, tokenHash string) (*database.PasswordResetToken, error) {
+	return nil, database.ErrPasswordResetTokenNotFound
+}
+
+func (m *mockDBRepository) ResetPassword(ctx context.Context, id, passwordHash string) (*database.Account, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockDBRepository) UpdatePassword(ctx context.Context, id, passwordHash string) (*database.Account, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockDBRepository) RehashPassword(ctx context.Context, id, oldHash, newHash string) error {
+	if m.rehashPasswordFn != nil {
+		return m.rehashPasswordFn(ctx, id, oldHash, newHash)
+	}
+	return nil
+}
+
+func (m *mockDBRepository) DeleteAccount(ctx context.Context, id string) error {
+	return errors.New("not implemented")
+}
+
+// every login cancels a pending deletion request, and the mocked accounts never have one
+func (m *mockDBRepository) CancelDeletionRequest(ctx context.Context, accountID string) (*database.DeletionRequest, error) {
+	return nil, database.ErrDeletionRequestNotFound
+}
+
+func (m *mockDBRepository) SetMFASecret(ctx context.Context, accountID, secret string) error {
+	return errors.New("not implemented")
+}
+
+func (m *mockDBRepository) GetMFASecret(ctx context.Context, accountID string) (*database.MFASecret, error) {
+	return nil, database.ErrMFASecretNotFound
+}
+
+func (m *mockDBRepository) EnableMFA(ctx context.Context, accountID string, step int64) (*database.MFASecret, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockDBRepository) UseMFAStep(ctx context.Context, accountID string, step int64) error {
+	return errors.New("not implemented")
+}
+
+func (m *mockDBRepository) GetMFAPhone(ctx context.Context, accountID string) (*database.MFAPhone, error) {
+	return nil, database.ErrMFAPhoneNotFound
+}
+
+func (m *mockDBRepository) ListSessions(ctx context.Context, accountID string, now time.Time) ([]database.Session, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockDBRepository) DeleteSession(ctx context.Context, accountID, sessionID string) error {
+	return errors.New("not implemented")
+}
+
+func (m *mockDBRepository) GetAccountRoles(ctx context.Context, accountID string) ([]string, error) {
+	return nil, nil
+}
+
 func createTestHandler(repo Repository) *handler {
 	if repo == nil {
 		repo = &mockDBRepository{}
 	}
 
-	return &handler{
+	return withService(&handler{
 		db:         repo,
 		authClient: &auth.Client{},
-	}
+		mailer:     &recordingMailer{},
+	})
+}
+
+// withService builds the account service of a handler set up without NewHandler
+func withService(h *handler) *handler {
+	h.service = h.newService()
+	return h
 }
 
 func TestRegister(t *testing.T) {
 	tests := []struct {
 		name             string
 		body             string
+		locale           string
 		setupMocks       func(*mockDBRepository)
 		expectedStatus   int
 		expectedResponse func(t *testing.T, body []byte)
@@ -94,6 +287,77 @@ func TestRegister(t *testing.T) {
 				assert.NotEmpty(t, resp.AccountID)
 			},
 		},
+		{
+			name:   "preferred locale defaults to negotiated locale",
+			body:   `{"email":"test@example.com","password":"Test123!@#"}`,
+			locale: "de",
+			setupMocks: func(repo *mockDBRepository) {
+				repo.createAccountFn = func(ctx context.Context, params database.AccountCreationParams) (*database.Account, error) {
+					assert.Equal(t, "de", params.PreferredLocale)
+					return &database.Account{ID: "test-id", Email: params.Email}, nil
+				}
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "explicit preferred locale overrides negotiated locale",
+			body:   `{"email":"test@example.com","password":"Test123!@#","preferred_locale":"es"}`,
+			locale: "de",
+			setupMocks: func(repo *mockDBRepository) {
+				repo.createAccountFn = func(ctx context.Context, params database.AccountCreationParams) (*database.Account, error) {
+					assert.Equal(t, "es", params.PreferredLocale)
+					return &database.Account{ID: "test-id", Email: params.Email}, nil
+				}
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "unsupported preferred locale",
+			body:           `{"email":"test@example.com","password":"Test123!@#","preferred_locale":"xx"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedResponse: func(t *testing.T, body []byte) {
+				var resp httputils.ErrorResponse
+				assert.NoError(t, json.Unmarshal(body, &resp))
+				assert.Equal(t, errTypeValidationError, resp.Type)
+			},
+		},
+		{
+			name: "with a username",
+			body: `{"email":"test@example.com","password":"Test123!@#","username":" ada_l "}`,
+			setupMocks: func(repo *mockDBRepository) {
+				repo.createAccountFn = func(ctx context.Context, params database.AccountCreationParams) (*database.Account, error) {
+					assert.Equal(t, "ada_l", params.Username)
+					return &database.Account{ID: "test-id", Email: params.Email, Username: params.Username}, nil
+				}
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "reserved username",
+			body:           `{"email":"test@example.com","password":"Test123!@#","username":"Admin"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedResponse: func(t *testing.T, body []byte) {
+				var resp httputils.ErrorResponse
+				assert.NoError(t, json.Unmarshal(body, &resp))
+				assert.Equal(t, errTypeValidationError, resp.Type)
+				assert.Equal(t, "This username is reserved", resp.Message)
+			},
+		},
+		{
+			name: "username taken",
+			body: `{"email":"test@example.com","password":"Test123!@#","username":"ada_l"}`,
+			setupMocks: func(repo *mockDBRepository) {
+				repo.createAccountFn = func(ctx context.Context, params database.AccountCreationParams) (*database.Account, error) {
+					return nil, database.ErrUsernameTaken
+				}
+			},
+			expectedStatus: http.StatusConflict,
+			expectedResponse: func(t *testing.T, body []byte) {
+				var resp httputils.ErrorResponse
+				assert.NoError(t, json.Unmarshal(body, &resp))
+				assert.Equal(t, errTypeUsernameTaken, resp.Type)
+			},
+		},
 		{
 			name:           "invalid JSON",
 			body:           `{"email":"test@example.com","password":}`,
@@ -139,6 +403,23 @@ func TestRegister(t *testing.T) {
 				assert.Equal(t, errTypeAccountAlreadyExists, resp.Type)
 			},
 		},
+		{
+			name:   "account already exists localized",
+			body:   `{"email":"test@example.com","password":"Test123!@#"}`,
+			locale: "es",
+			setupMocks: func(repo *mockDBRepository) {
+				repo.createAccountFn = func(ctx context.Context, params database.AccountCreationParams) (*database.Account, error) {
+					return nil, database.ErrAccountAlreadyExists
+				}
+			},
+			expectedStatus: http.StatusConflict,
+			expectedResponse: func(t *testing.T, body []byte) {
+				var resp httputils.ErrorResponse
+				assert.NoError(t, json.Unmarshal(body, &resp))
+				assert.Equal(t, errTypeAccountAlreadyExists, resp.Type)
+				assert.Equal(t, "Ya existe una cuenta con este correo electrónico", resp.Message)
+			},
+		},
 		{
 			name: "database error",
 			body: `{"email":"test@example.com","password":"Test123!@#"}`,
@@ -154,6 +435,17 @@ func TestRegister(t *testing.T) {
 				assert.Contains(t, resp.Message, "unexpected error")
 			},
 		},
+		{
+			// the account is rolled back with the link
+			name: "verification link not stored",
+			body: `{"email":"test@example.com","password":"Test123!@#"}`,
+			setupMocks: func(repo *mockDBRepository) {
+				repo.createVerificationFn = func(ctx context.Context, params database.CreateEmailVerificationParams) error {
+					return errors.New("database connection failed")
+				}
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
 	}
 
 	for _, tt := range tests {
@@ -168,6 +460,9 @@ func TestRegister(t *testing.T) {
 
 			req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader([]byte(tt.body)))
 			req.Header.Set("Content-Type", "application/json")
+			if tt.locale != "" {
+				req = req.WithContext(i18n.WithLocale(req.Context(), tt.locale))
+			}
 			w := httptest.NewRecorder()
 
 			h.register(w, req)
@@ -183,11 +478,12 @@ func TestRegister(t *testing.T) {
 
 func TestLogin(t *testing.T) {
 	tests := []struct {
-		name             string
-		body             string
-		setupMocks       func(*mockDBRepository)
-		expectedStatus   int
-		expectedResponse func(t *testing.T, body []byte)
+		name              string
+		body              string
+		acceptAnyPassword bool
+		setupMocks        func(*mockDBRepository)
+		expectedStatus    int
+		expectedResponse  func(t *testing.T, body []byte)
 	}{
 		{
 			name: "valid login",
@@ -248,6 +544,12 @@ func TestLogin(t *testing.T) {
 				assert.Equal(t, errTypeIncorrectPassword, resp.Type)
 			},
 		},
+		{
+			name:              "any password accepted in mock mode",
+			body:              `{"email": "test@example.com", "password": "wrongpassword"}`,
+			acceptAnyPassword: true,
+			expectedStatus:    http.StatusOK,
+		},
 		{
 			name: "database error",
 			body: `{"email":"test@example.com","password":"Test123!@#"}`,
@@ -269,6 +571,8 @@ func TestLogin(t *testing.T) {
 			}
 
 			h := createTestHandler(repo)
+			h.acceptAnyPassword = tt.acceptAnyPassword
+			h = withService(h)
 
 			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader([]byte(tt.body)))
 			req.Header.Set("Content-Type", "application/json")
@@ -285,6 +589,163 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+func TestLoginRehashesPassword(t *testing.T) {
+	passwords, err := auth.NewPasswordHasher(auth.HasherConfig{
+		Algorithm:     auth.HashAlgorithmArgon2id,
+		Argon2Memory:  64,
+		Argon2Time:    1,
+		Argon2Threads: 1,
+	})
+	require.NoError(t, err)
+
+	login := func(t *testing.T, passwordHash string, rehashErr error) (int, []string) {
+		var rehashed []string
+		repo := &mockDBRepository{
+			getAccountFn: func(ctx context.Context, email string) (*database.Account, error) {
+				return &database.Account{ID: "test-account-id", Email: email, PasswordHash: passwordHash}, nil
+			},
+			rehashPasswordFn: func(ctx context.Context, id, oldHash, newHash string) error {
+				assert.Equal(t, "test-account-id", id)
+				assert.Equal(t, passwordHash, oldHash)
+				rehashed = append(rehashed, newHash)
+				return rehashErr
+			},
+		}
+		h := createTestHandler(repo)
+		h.passwords = passwords
+		h = withService(h)
+
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader([]byte(`{"email":"test@example.com","password":"Test123!@#"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.login(w, req)
+		return w.Code, rehashed
+	}
+
+	bcryptHash, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	t.Run("outdated hashes are replaced", func(t *testing.T) {
+		status, rehashed := login(t, bcryptHash, nil)
+		assert.Equal(t, http.StatusOK, status)
+		require.Len(t, rehashed, 1)
+		ok, rehash := passwords.Verify("Test123!@#", rehashed[0])
+		assert.True(t, ok)
+		assert.False(t, rehash)
+	})
+
+	t.Run("current hashes are kept", func(t *testing.T) {
+		argon2Hash, err := passwords.Hash("Test123!@#")
+		require.NoError(t, err)
+
+		status, rehashed := login(t, argon2Hash, nil)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Empty(t, rehashed)
+	})
+
+	t.Run("failing to save the new hash doesn't fail the login", func(t *testing.T) {
+		status, rehashed := login(t, bcryptHash, errors.New("db error"))
+		assert.Equal(t, http.StatusOK, status)
+		assert.Len(t, rehashed, 1)
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	assert.NoError(t, err)
+
+	repo := &mockDBRepository{
+		getAccountFn: func(ctx context.Context, email string) (*database.Account, error) {
+			return &database.Account{
+				ID:           "test-account-id",
+				Email:        email,
+				PasswordHash: hashedPassword,
+			}, nil
+		},
+	}
+
+	h := createTestHandler(repo)
+	h.lockout = lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{
+		Window:          time.Hour,
+		MaxAttempts:     3,
+		LockoutDuration: time.Minute,
+	})
+	h = withService(h)
+
+	login := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.login(w, req)
+		return w
+	}
+
+	wrongPassword := `{"email":"test@example.com","password":"Wrong123!@#"}`
+	for i := 0; i < 3; i++ {
+		w := login(wrongPassword)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// even the correct password is rejected while locked out
+	w := login(`{"email":"TEST@example.com","password":"Test123!@#"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	var resp httputils.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, errTypeTooManyAttempts, resp.Type)
+
+	// other accounts are unaffected
+	w = login(`{"email":"other@example.com","password":"Test123!@#"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLoginWithUsername(t *testing.T) {
+	ctx := context.Background()
+
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+	db := database.NewMemoryDB()
+	_, err = db.CreateAccount(ctx, database.AccountCreationParams{Email: "ada@example.com", Username: "Ada_L", PasswordHash: hashedPassword})
+	require.NoError(t, err)
+
+	h := createTestHandler(db)
+	h.lockout = lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{
+		Window:          time.Hour,
+		MaxAttempts:     3,
+		LockoutDuration: time.Minute,
+	})
+	h = withService(h)
+
+	login := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.login(w, req)
+		return w
+	}
+
+	// usernames are compared regardless of case
+	w := login(`{"username":"ada_l","password":"Test123!@#"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = login(`{"username":"grace_h","password":"Test123!@#"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), errTypeAccountNotFound)
+
+	// failures with the username and the email count against the same lockout
+	for _, body := range []string{
+		`{"username":"ada_l","password":"Wrong123!@#"}`,
+		`{"email":"ada@example.com","password":"Wrong123!@#"}`,
+		`{"username":"ADA_L","password":"Wrong123!@#"}`,
+	} {
+		w = login(body)
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	w = login(`{"email":"ada@example.com","password":"Test123!@#"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
 func TestRefresh(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -333,6 +794,16 @@ func TestRefresh(t *testing.T) {
 			},
 			expectedStatus: http.StatusUnauthorized,
 		},
+		{
+			name: "new token not stored",
+			body: `{"refresh_token":"valid-refresh-token"}`,
+			setupMocks: func(repo *mockDBRepository) {
+				repo.createRefreshTokenFn = func(ctx context.Context, params database.CreateRefreshTokenParams) error {
+					return errors.New("database connection failed")
+				}
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
 	}
 
 	for _, tt := range tests {
@@ -399,10 +870,47 @@ func TestLogout(t *testing.T) {
 			},
 		},
 		{
-			name: "delete error",
+			name: "only the presented token is deleted",
 			body: `{"refresh_token":"valid-token"}`,
 			setupMocks: func(repo *mockDBRepository) {
+				repo.deleteByTokenFn = func(ctx context.Context, token string) error {
+					if token != "valid-token" {
+						return errors.New("deleted the wrong token")
+					}
+					return nil
+				}
+				repo.deleteRefreshTokenFn = func(ctx context.Context, accountID string) error {
+					return errors.New("logout shouldn't end every session")
+				}
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "all devices ends every session of the account",
+			body: `{"refresh_token":"valid-token","all_devices":true}`,
+			setupMocks: func(repo *mockDBRepository) {
+				repo.deleteByTokenFn = func(ctx context.Context, token string) error {
+					return errors.New("all devices should delete every token")
+				}
 				repo.deleteRefreshTokenFn = func(ctx context.Context, accountID string) error {
+					if accountID != "test-account-id" {
+						return errors.New("logged out the wrong account")
+					}
+					return nil
+				}
+			},
+			expectedStatus: http.StatusOK,
+			expectedResponse: func(t *testing.T, body []byte) {
+				var resp map[string]string
+				assert.NoError(t, json.Unmarshal(body, &resp))
+				assert.Equal(t, "Logged out of every session", resp["message"])
+			},
+		},
+		{
+			name: "delete error",
+			body: `{"refresh_token":"valid-token"}`,
+			setupMocks: func(repo *mockDBRepository) {
+				repo.deleteByTokenFn = func(ctx context.Context, token string) error {
 					return errors.New("database error")
 				}
 			},
@@ -434,3 +942,66 @@ func TestLogout(t *testing.T) {
 		})
 	}
 }
+
+func TestLogoutAll(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+
+	for _, signed := range []bool{false, true} {
+		name := "stored refresh tokens"
+		if signed {
+			name = "signed refresh tokens"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			db := database.NewMemoryDB()
+			account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "logoutall@test.com"})
+			require.NoError(t, err)
+
+			h := withService(&handler{
+				db:                  db,
+				authClient:          authClient,
+				signedRefreshTokens: signed,
+				revocations:         revocation.NewList(lockout.NewMemoryStore(), authClient.RefreshTokenTTL()),
+			})
+
+			refresh := func(token string) int {
+				w := httptest.NewRecorder()
+				h.refresh(w, httptest.NewRequest(http.MethodPost, "/refresh", jsonBody(`{"refresh_token":"`+token+`"}`)))
+				return w.Code
+			}
+
+			var sessions []*accounts.Tokens
+			for range 3 {
+				session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+				require.NoError(t, err)
+				sessions = append(sessions, session)
+			}
+
+			// logging out one device leaves the others logged in
+			w := httptest.NewRecorder()
+			h.logout(w, httptest.NewRequest(http.MethodPost, "/logout", jsonBody(`{"refresh_token":"`+sessions[0].RefreshToken+`"}`)))
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, http.StatusUnauthorized, refresh(sessions[0].RefreshToken))
+			assert.Equal(t, http.StatusOK, refresh(sessions[1].RefreshToken))
+
+			req := httptest.NewRequest(http.MethodPost, "/logout-all", nil)
+			req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: account.ID}))
+			w = httptest.NewRecorder()
+			h.logoutAll(w, req)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			assert.Equal(t, http.StatusUnauthorized, refresh(sessions[2].RefreshToken))
+
+			events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 1}})
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, database.AuditEventLogoutAll, events[0].EventType)
+		})
+	}
+}
+
+func jsonBody(body string) *bytes.Reader {
+	return bytes.NewReader([]byte(body))
+}
@@ -0,0 +1,106 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeInvalidMagicLink = "invalid_magic_link"
+
+// MagicLinkConfig turns on logging in with a single-use link emailed to the account
+type MagicLinkConfig = accounts.MagicLinkConfig
+
+// NewMagicLinkLimiter allows limit login links per email address per hour
+func NewMagicLinkLimiter(store lockout.Store, limit int) *lockout.Guard {
+	return accounts.NewMagicLinkLimiter(store, limit)
+}
+
+type magicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// requestMagicLink emails a link that logs the account in without its password. The response is
+// the same whether or not the account exists, and links are throttled per email address so the
+// endpoint can't be used to flood inboxes or probe for accounts.
+func (h *handler) requestMagicLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody magicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Email == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := h.service.SendMagicLink(ctx, reqBody.Email, h.client(r)); err != nil {
+		slog.ErrorContext(ctx, "error sending magic link", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error sending the login link",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusAccepted, map[string]string{
+		"message": "If an account exists for this email, we've sent it a link to log in",
+	})
+}
+
+type verifyMagicLinkRequest struct {
+	Token string `json:"token"`
+	// DeviceToken is from an earlier login that trusted the device, it skips MFA
+	DeviceToken string `json:"device_token"`
+}
+
+// verifyMagicLink trades the token from an emailed login link for tokens, or an MFA challenge
+// for accounts with MFA enabled. Each link works once.
+func (h *handler) verifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody verifyMagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Token == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	client := h.client(r)
+	client.DeviceToken = reqBody.DeviceToken
+	result, err := h.service.LoginMagicLink(ctx, reqBody.Token, client)
+	if err != nil {
+		switch {
+		case errors.Is(err, accounts.ErrInvalidMagicLink):
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "This link is invalid, expired, or already used",
+				Type:       errTypeInvalidMagicLink,
+				StatusCode: http.StatusUnauthorized,
+			})
+		case errors.Is(err, accounts.ErrAccountFrozen):
+			writeAccountFrozen(w, r)
+		default:
+			slog.ErrorContext(ctx, "error logging in with magic link", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    unexpectedLoginError,
+				StatusCode: http.StatusInternalServerError,
+			})
+		}
+		return
+	}
+
+	if result.Tokens == nil {
+		writeMFAChallenge(w, r, result)
+		return
+	}
+
+	h.writeTokens(w, r, result.Tokens)
+}
@@ -0,0 +1,207 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/service/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowTokenStore answers whether a token was revoked slowly, by which time it may have been
+type slowTokenStore struct {
+	*revocation.MemoryTokenStore
+}
+
+func (s slowTokenStore) AccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	revoked, err := s.MemoryTokenStore.AccessTokenRevoked(ctx, tokenID)
+	time.Sleep(20 * time.Millisecond)
+	return revoked, err
+}
+
+func TestMagicLink(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (*handler, *database.MemoryDB, *recordingMailer, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "magic@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+
+		mail := &recordingMailer{}
+		h := withService(&handler{
+			db:                       db,
+			mailer:                   mail,
+			authClient:               authClient,
+			appURL:                   "https://app.example.com",
+			requireEmailVerification: true,
+			totpIssuer:               DefaultTOTPIssuer,
+			magicLinks: &MagicLinkConfig{
+				TTL:     time.Minute,
+				Limiter: NewMagicLinkLimiter(lockout.NewMemoryStore(), 2),
+			},
+		})
+		return h, db, mail, account
+	}
+
+	post := func(handle http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		handle(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		return w
+	}
+
+	request := func(t *testing.T, h *handler, mail *recordingMailer) string {
+		w := post(h.requestMagicLink, magicLinkRequest{Email: "magic@test.com"})
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		token := mail.links(t, "magic@test.com")["/login/magic-link"]
+		require.NotEmpty(t, token)
+		return token
+	}
+
+	t.Run("request and verify", func(t *testing.T) {
+		h, db, mail, account := setup(t)
+
+		token := request(t, h, mail)
+		assert.Contains(t, mail.sent[0].Body, "1 minute")
+
+		w := post(h.verifyMagicLink, verifyMagicLinkRequest{Token: token})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, account.ID, resp.AccountID)
+		assert.NotEmpty(t, resp.AccessToken)
+		assert.NotEmpty(t, resp.RefreshToken)
+
+		// the link proved the email is the account's
+		account, err := db.GetAccountByID(ctx, account.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, account.VerifiedAt)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		assert.Equal(t, database.AuditEventLogin, events[0].EventType)
+		assert.Equal(t, database.AuditEventEmailVerified, events[1].EventType)
+		assert.Equal(t, database.AuditEventMagicLinkSent, events[2].EventType)
+
+		// each link works once
+		w = post(h.verifyMagicLink, verifyMagicLinkRequest{Token: token})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidMagicLink)
+	})
+
+	t.Run("concurrent verifies get one session", func(t *testing.T) {
+		h, _, mail, _ := setup(t)
+		// widen the window between checking a link and using it up, if there is one
+		h.accessTokenRevocations = revocation.NewAccessTokens(slowTokenStore{revocation.NewMemoryTokenStore()})
+		h = withService(h)
+		token := request(t, h, mail)
+
+		const attempts = 10
+		codes := make(chan int, attempts)
+		var wg sync.WaitGroup
+		for range attempts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes <- post(h.verifyMagicLink, verifyMagicLinkRequest{Token: token}).Code
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		logins := 0
+		for code := range codes {
+			if code == http.StatusOK {
+				logins++
+			} else {
+				assert.Equal(t, http.StatusUnauthorized, code)
+			}
+		}
+		assert.Equal(t, 1, logins)
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		h, _, _, account := setup(t)
+
+		w := post(h.verifyMagicLink, verifyMagicLinkRequest{Token: "not-a-token"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// other signed tokens aren't links
+		challenge, _, err := authClient.NewMFAChallengeToken(account.ID)
+		require.NoError(t, err)
+		w = post(h.verifyMagicLink, verifyMagicLinkRequest{Token: challenge})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		expired, _, err := authClient.NewMagicLinkToken(account.ID, account.Email, -time.Minute)
+		require.NoError(t, err)
+		w = post(h.verifyMagicLink, verifyMagicLinkRequest{Token: expired})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// sent to an address the account no longer has
+		stale, _, err := authClient.NewMagicLinkToken(account.ID, "old@test.com", time.Minute)
+		require.NoError(t, err)
+		w = post(h.verifyMagicLink, verifyMagicLinkRequest{Token: stale})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("unknown and frozen accounts aren't sent links", func(t *testing.T) {
+		h, db, mail, account := setup(t)
+
+		w := post(h.requestMagicLink, magicLinkRequest{Email: "nobody@test.com"})
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		_, err := db.FreezeAccount(ctx, account.ID)
+		require.NoError(t, err)
+		w = post(h.requestMagicLink, magicLinkRequest{Email: "magic@test.com"})
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		assert.Empty(t, mail.sent)
+	})
+
+	t.Run("throttled per email", func(t *testing.T) {
+		h, _, mail, _ := setup(t)
+
+		request(t, h, mail)
+		request(t, h, mail)
+
+		w := post(h.requestMagicLink, magicLinkRequest{Email: "magic@test.com"})
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Len(t, mail.sent, 2)
+	})
+
+	t.Run("MFA still has to be completed", func(t *testing.T) {
+		h, _, mail, account := setup(t)
+
+		_, err := h.db.VerifyAccount(ctx, account.ID)
+		require.NoError(t, err)
+		secret, err := totp.GenerateSecret()
+		require.NoError(t, err)
+		require.NoError(t, h.db.SetMFASecret(ctx, account.ID, secret))
+		_, err = h.db.EnableMFA(ctx, account.ID, totp.Step(time.Now())-1)
+		require.NoError(t, err)
+
+		w := post(h.verifyMagicLink, verifyMagicLinkRequest{Token: request(t, h, mail)})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp mfaChallengeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.MFARequired)
+		assert.NotEmpty(t, resp.MFAChallenge)
+		assert.Equal(t, []string{"totp"}, resp.MFAMethods)
+	})
+}
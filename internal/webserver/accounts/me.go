@@ -0,0 +1,77 @@
+package accounts
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+type meResponse struct {
+	AccountID       string            `json:"account_id"`
+	Email           string            `json:"email"`
+	Username        string            `json:"username"`
+	PreferredLocale string            `json:"preferred_locale"`
+	DisplayName     string            `json:"display_name"`
+	GivenName       string            `json:"given_name"`
+	FamilyName      string            `json:"family_name"`
+	Timezone        string            `json:"timezone"`
+	AvatarURL       string            `json:"avatar_url"`
+	UserMetadata    database.Metadata `json:"user_metadata"`
+	EmailVerified   bool              `json:"email_verified"`
+	VerifiedAt      *time.Time        `json:"verified_at,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+func toMeResponse(account *database.Account) meResponse {
+	return meResponse{
+		AccountID:       account.ID,
+		Email:           account.Email,
+		Username:        account.Username,
+		PreferredLocale: account.PreferredLocale,
+		DisplayName:     account.DisplayName,
+		GivenName:       account.GivenName,
+		FamilyName:      account.FamilyName,
+		Timezone:        account.Timezone,
+		AvatarURL:       account.AvatarURL,
+		UserMetadata:    nonNilMetadata(account.UserMetadata),
+		EmailVerified:   account.VerifiedAt != nil,
+		VerifiedAt:      account.VerifiedAt,
+		CreatedAt:       account.CreatedAt,
+		UpdatedAt:       account.UpdatedAt,
+	}
+}
+
+// me returns the authenticated account
+func (h *handler) me(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	account, err := h.db.GetAccountByID(ctx, claims.AccountID)
+	if err != nil {
+		// the token outlived the account
+		if errors.Is(err, database.ErrAccountNotFound) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The account was not found",
+				Type:       errTypeAccountNotFound,
+				StatusCode: http.StatusNotFound,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error getting the account",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.WriteJSONResponse(w, r, http.StatusOK, toMeResponse(account))
+}
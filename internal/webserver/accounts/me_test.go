@@ -0,0 +1,86 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMe(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	unverified, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "me@test.com", PreferredLocale: "de"})
+	require.NoError(t, err)
+	verified, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "verified@test.com", Verified: true})
+	require.NoError(t, err)
+
+	h := withService(&handler{db: db})
+
+	tests := []struct {
+		name             string
+		accountID        string
+		expectedStatus   int
+		expectedResponse *meResponse
+	}{
+		{
+			name:           "unverified account",
+			accountID:      unverified.ID,
+			expectedStatus: http.StatusOK,
+			expectedResponse: &meResponse{
+				AccountID:       unverified.ID,
+				Email:           "me@test.com",
+				PreferredLocale: "de",
+				CreatedAt:       unverified.CreatedAt,
+			},
+		},
+		{
+			name:           "verified account",
+			accountID:      verified.ID,
+			expectedStatus: http.StatusOK,
+			expectedResponse: &meResponse{
+				AccountID:       verified.ID,
+				Email:           "verified@test.com",
+				PreferredLocale: verified.PreferredLocale,
+				EmailVerified:   true,
+				VerifiedAt:      verified.VerifiedAt,
+				CreatedAt:       verified.CreatedAt,
+			},
+		},
+		{
+			name:           "account no longer exists",
+			accountID:      "missing",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: tt.accountID}))
+			w := httptest.NewRecorder()
+			h.me(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			if tt.expectedResponse != nil {
+				var resp meResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedResponse.AccountID, resp.AccountID)
+				assert.Equal(t, tt.expectedResponse.Email, resp.Email)
+				assert.Equal(t, tt.expectedResponse.PreferredLocale, resp.PreferredLocale)
+				assert.Equal(t, tt.expectedResponse.EmailVerified, resp.EmailVerified)
+				assert.Equal(t, tt.expectedResponse.VerifiedAt != nil, resp.VerifiedAt != nil)
+				assert.WithinDuration(t, tt.expectedResponse.CreatedAt, resp.CreatedAt, 0)
+				assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/metadata"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+// updateMetadataRequest changes the keys in user_metadata, keys set to null are removed. The
+// account can't change its app_metadata.
+type updateMetadataRequest struct {
+	UserMetadata metadata.Patch `json:"user_metadata"`
+}
+
+type userMetadataResponse struct {
+	UserMetadata database.Metadata `json:"user_metadata"`
+}
+
+// updateMetadata changes the authenticated account's user_metadata
+func (h *handler) updateMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	var reqBody updateMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if len(reqBody.UserMetadata) == 0 {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The request needs at least one user_metadata key to change",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	account, err := metadata.Apply(ctx, h.db, claims.AccountID, metadata.Update{User: reqBody.UserMetadata})
+	if err != nil {
+		switch {
+		case errors.Is(err, metadata.ErrInvalidKey), errors.Is(err, metadata.ErrTooLarge):
+			writeInvalidMetadata(w, r, err)
+		// the token outlived the account
+		case errors.Is(err, database.ErrAccountNotFound):
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The account was not found",
+				Type:       errTypeAccountNotFound,
+				StatusCode: http.StatusNotFound,
+			})
+		default:
+			slog.ErrorContext(ctx, "error updating account metadata", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "There was an unexpected error updating the account",
+				StatusCode: http.StatusInternalServerError,
+			})
+		}
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, account.ID, database.AuditEventMetadataChanged)
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.WriteJSONResponse(w, r, http.StatusOK, userMetadataResponse{UserMetadata: nonNilMetadata(account.UserMetadata)})
+}
+
+func writeInvalidMetadata(w http.ResponseWriter, r *http.Request, err error) {
+	message := "Metadata keys must be 1-64 letters, digits, hyphens or underscores"
+	if errors.Is(err, metadata.ErrTooLarge) {
+		message = fmt.Sprintf("Metadata can be at most %d bytes", metadata.MaxBytes)
+	}
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    message,
+		Type:       errTypeValidationError,
+		StatusCode: http.StatusUnprocessableEntity,
+	})
+}
+
+// nonNilMetadata encodes an account without metadata as an empty object rather than null
+func nonNilMetadata(m database.Metadata) database.Metadata {
+	if m == nil {
+		return database.Metadata{}
+	}
+	return m
+}
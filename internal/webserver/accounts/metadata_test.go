@@ -0,0 +1,142 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "metadata@test.com"})
+	require.NoError(t, err)
+	_, err = db.UpdateAccountMetadata(ctx, account.ID, database.UpdateAccountMetadataParams{
+		SetAppMetadata: database.Metadata{"plan": json.RawMessage(`"pro"`)},
+	})
+	require.NoError(t, err)
+
+	h := withService(&handler{db: db})
+
+	tests := []struct {
+		name             string
+		accountID        string
+		body             string
+		expectedStatus   int
+		expectedMetadata database.Metadata
+	}{
+		{
+			name:             "sets keys",
+			accountID:        account.ID,
+			body:             `{"user_metadata":{"theme":"dark","language":"de"}}`,
+			expectedStatus:   http.StatusOK,
+			expectedMetadata: database.Metadata{"theme": json.RawMessage(`"dark"`), "language": json.RawMessage(`"de"`)},
+		},
+		{
+			name:             "null removes a key",
+			accountID:        account.ID,
+			body:             `{"user_metadata":{"language":null}}`,
+			expectedStatus:   http.StatusOK,
+			expectedMetadata: database.Metadata{"theme": json.RawMessage(`"dark"`)},
+		},
+		{
+			name:           "app metadata can't be changed",
+			accountID:      account.ID,
+			body:           `{"app_metadata":{"plan":"enterprise"}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "invalid key",
+			accountID:      account.ID,
+			body:           `{"user_metadata":{"favourite colour":"blue"}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "malformed body",
+			accountID:      account.ID,
+			body:           `{"user_metadata":[]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "account no longer exists",
+			accountID:      "missing",
+			body:           `{"user_metadata":{"theme":"light"}}`,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/me/metadata", strings.NewReader(tt.body))
+			req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: tt.accountID}))
+			w := httptest.NewRecorder()
+			h.updateMetadata(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			if tt.expectedMetadata != nil {
+				var resp userMetadataResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedMetadata, resp.UserMetadata)
+			}
+		})
+	}
+
+	actual, err := db.GetAccountByID(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, database.Metadata{"plan": json.RawMessage(`"pro"`)}, actual.AppMetadata)
+}
+
+func TestAppMetadataInAccessToken(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "metadata@test.com"})
+	require.NoError(t, err)
+	_, err = db.UpdateAccountMetadata(ctx, account.ID, database.UpdateAccountMetadataParams{
+		SetUserMetadata: database.Metadata{"theme": json.RawMessage(`"dark"`)},
+		SetAppMetadata:  database.Metadata{"plan": json.RawMessage(`"pro"`), "customer": json.RawMessage(`"cus_123"`)},
+	})
+	require.NoError(t, err)
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+
+	tests := []struct {
+		name           string
+		keys           []string
+		expectedClaims map[string]json.RawMessage
+	}{
+		{
+			name:           "configured keys are included",
+			keys:           []string{"plan", "theme"},
+			expectedClaims: map[string]json.RawMessage{"plan": json.RawMessage(`"pro"`)},
+		},
+		{
+			name:           "no keys configured",
+			expectedClaims: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := withService(&handler{db: db, authClient: authClient, tokenAppMetadataKeys: tt.keys})
+
+			resp, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+			require.NoError(t, err)
+
+			claims, err := authClient.ParseAccessToken(resp.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedClaims, claims.AppMetadata)
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/service/totp"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+const (
+	// DefaultTOTPIssuer is the name authenticator apps show next to the account
+	DefaultTOTPIssuer = "Account Management"
+
+	errTypeInvalidMFAChallenge = "invalid_mfa_challenge"
+	errTypeInvalidMFACode      = "invalid_mfa_code"
+	errTypeMFAAlreadyEnabled   = "mfa_already_enabled"
+	errTypeMFANotSetUp         = "mfa_not_set_up"
+
+	unexpectedMFAError = "There was an unexpected error setting up MFA"
+)
+
+type mfaChallengeResponse struct {
+	Message      string `json:"message"`
+	MFARequired  bool   `json:"mfa_required"`
+	MFAChallenge string `json:"mfa_challenge"`
+	ExpiresIn    int    `json:"expires_in"`
+	// MFAMethods are the kinds of code the login can be finished with besides a recovery code.
+	// An sms code has to be sent with /login/mfa/sms first.
+	MFAMethods []string `json:"mfa_methods"`
+}
+
+// writeMFAChallenge answers a login with the right password for an account with MFA enabled.
+// The challenge is traded for tokens at /login/mfa along with a code.
+func writeMFAChallenge(w http.ResponseWriter, r *http.Request, result *accounts.LoginResult) {
+	httputils.WriteJSONResponse(w, r, http.StatusOK, mfaChallengeResponse{
+		Message:      "Enter a code from your authenticator app or phone, or a recovery code, to finish logging in",
+		MFARequired:  true,
+		MFAChallenge: result.MFAChallenge,
+		ExpiresIn:    int(time.Until(result.MFAChallengeExpiresAt).Seconds()),
+		MFAMethods:   result.MFAMethods,
+	})
+}
+
+type loginMFARequest struct {
+	MFAChallenge string `json:"mfa_challenge"`
+	Code         string `json:"code"`
+	// TrustDevice returns a device token that skips MFA on later logins from the device
+	TrustDevice bool `json:"trust_device"`
+	// Scopes restrict the session's access tokens, like the login's. Optional.
+	Scopes []string `json:"scopes"`
+}
+
+// loginMFA finishes a login for an account with MFA enabled. Wrong codes count towards the
+// login lockout, and each code works once. The device can be trusted to skip MFA from then on,
+// a login that can't trust it still succeeds.
+func (h *handler) loginMFA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody loginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	scopes, ok := tokenScopes(reqBody.Scopes)
+	if !ok {
+		writeInvalidScope(w, r)
+		return
+	}
+
+	client := h.client(r)
+	client.Scopes = scopes
+	tokens, err := h.service.LoginMFA(ctx, reqBody.MFAChallenge, reqBody.Code, client)
+	if err != nil {
+		var lockedOut *accounts.LockedOutError
+		switch {
+		case errors.Is(err, accounts.ErrInvalidMFAChallenge):
+			writeInvalidMFAChallenge(w, r)
+		case errors.As(err, &lockedOut):
+			writeTooManyAttempts(w, r, lockedOut.RetryAfter)
+		case errors.Is(err, accounts.ErrAccountFrozen):
+			writeAccountFrozen(w, r)
+		case errors.Is(err, accounts.ErrIncorrectMFACode):
+			writeInvalidMFACode(w, r)
+		default:
+			slog.ErrorContext(ctx, "error logging in with MFA", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    unexpectedLoginError,
+				StatusCode: http.StatusInternalServerError,
+			})
+		}
+		return
+	}
+
+	if reqBody.TrustDevice {
+		err := h.service.TrustDevice(ctx, tokens, client)
+		if err != nil && !errors.Is(err, accounts.ErrDeviceTrustDisabled) {
+			slog.ErrorContext(ctx, "error trusting device", "error", err)
+		}
+	}
+
+	h.writeTokens(w, r, tokens)
+}
+
+type totpSetupResponse struct {
+	// Secret is for typing into authenticator apps that can't scan the QR code
+	Secret string `json:"secret"`
+	// ProvisioningURI is the QR code payload
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// setupTOTP generates a new TOTP secret for the authenticated account. MFA isn't enabled until
+// a code from it is verified, and setting up again before that replaces the secret.
+func (h *handler) setupTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	unexpectedErr := httputils.ErrorResponse{
+		Message:    unexpectedMFAError,
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	account, err := h.db.GetAccountByID(ctx, claims.AccountID)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The account was not found",
+				Type:       errTypeAccountNotFound,
+				StatusCode: http.StatusNotFound,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account for MFA setup", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating TOTP secret", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if err := h.db.SetMFASecret(ctx, account.ID, secret); err != nil {
+		if errors.Is(err, database.ErrMFAAlreadyEnabled) {
+			writeMFAAlreadyEnabled(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error saving TOTP secret", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.WriteJSONResponse(w, r, http.StatusOK, totpSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(h.totpIssuer, account.Email, secret),
+	})
+}
+
+type verifyTOTPRequest struct {
+	Code string `json:"code"`
+}
+
+// verifyTOTP enables MFA once the authenticated account proves its authenticator app has the
+// secret from setupTOTP
+func (h *handler) verifyTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	var reqBody verifyTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	unexpectedErr := httputils.ErrorResponse{
+		Message:    unexpectedMFAError,
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	secret, err := h.db.GetMFASecret(ctx, claims.AccountID)
+	if err != nil {
+		if errors.Is(err, database.ErrMFASecretNotFound) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "Set up an authenticator app first",
+				Type:       errTypeMFANotSetUp,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error getting MFA secret", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if secret.EnabledAt != nil {
+		writeMFAAlreadyEnabled(w, r)
+		return
+	}
+
+	step, ok := totp.Validate(secret.Secret, reqBody.Code, time.Now())
+	if !ok {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The code is incorrect, check the time on your device",
+			Type:       errTypeInvalidMFACode,
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	if _, err := h.db.EnableMFA(ctx, claims.AccountID, step); err != nil {
+		// enabled by a racing request
+		if errors.Is(err, database.ErrMFASecretNotFound) {
+			writeMFAAlreadyEnabled(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error enabling MFA", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, claims.AccountID, database.AuditEventMFAEnabled)
+
+	// MFA is enabled either way
+	if account, err := h.db.GetAccountByID(ctx, claims.AccountID); err == nil {
+		err = mailer.SendTemplate(ctx, h.mailer, mailer.TemplateMFAEnabled, account.Email, nil)
+		if err != nil {
+			slog.ErrorContext(ctx, "error sending MFA enabled notice", "error", err)
+		}
+	}
+
+	// MFA is on without them, they can be generated again
+	codes, err := h.service.GenerateRecoveryCodes(ctx, claims.AccountID, h.client(r))
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating recovery codes", "error", err)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.WriteJSONResponse(w, r, http.StatusOK, recoveryCodesResponse{
+		Message:       "Two-factor authentication is on. Logins now need a code from your authenticator app",
+		RecoveryCodes: codes,
+	})
+}
+
+type recoveryCodesResponse struct {
+	Message string `json:"message"`
+	// RecoveryCodes each finish one MFA login in place of a code. They're only shown once.
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// regenerateRecoveryCodes replaces the caller's recovery codes with new ones, so the old ones
+// stop working
+func (h *handler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	codes, err := h.service.GenerateRecoveryCodes(ctx, claims.AccountID, h.client(r))
+	if err != nil {
+		if errors.Is(err, accounts.ErrMFANotEnabled) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "Turn on two-factor authentication first",
+				Type:       errTypeMFANotSetUp,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error generating recovery codes", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error generating recovery codes",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.WriteJSONResponse(w, r, http.StatusOK, recoveryCodesResponse{
+		Message:       "Store these recovery codes somewhere safe, each one logs in once if you lose your authenticator app. Your old codes no longer work",
+		RecoveryCodes: codes,
+	})
+}
+
+func writeInvalidMFAChallenge(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "The login has expired, log in again",
+		Type:       errTypeInvalidMFAChallenge,
+		StatusCode: http.StatusUnauthorized,
+	})
+}
+
+func writeInvalidMFACode(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "The code is incorrect or has already been used",
+		Type:       errTypeInvalidMFACode,
+		StatusCode: http.StatusUnauthorized,
+	})
+}
+
+func writeMFAAlreadyEnabled(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Two-factor authentication is already on",
+		Type:       errTypeMFAAlreadyEnabled,
+		StatusCode: http.StatusConflict,
+	})
+}
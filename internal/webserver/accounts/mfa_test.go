@@ -0,0 +1,324 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/totp"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTP(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (*handler, *database.MemoryDB, *recordingMailer, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "mfa@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+
+		mail := &recordingMailer{}
+		h := withService(&handler{db: db, mailer: mail, authClient: authClient, totpIssuer: DefaultTOTPIssuer})
+		return h, db, mail, account
+	}
+
+	authenticated := func(handle http.HandlerFunc, accountID string, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		handle(w, req)
+		return w
+	}
+
+	post := func(handle http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		handle(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		return w
+	}
+
+	code := func(t *testing.T, secret string, at time.Time) string {
+		c, err := totp.Code(secret, totp.Step(at))
+		require.NoError(t, err)
+		return c
+	}
+
+	// enable sets up and verifies MFA with the current code and returns the secret and the code
+	enable := func(t *testing.T, h *handler, accountID string) (string, string) {
+		w := authenticated(h.setupTOTP, accountID, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp totpSetupResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		used := code(t, resp.Secret, time.Now())
+		w = authenticated(h.verifyTOTP, accountID, verifyTOTPRequest{Code: used})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return resp.Secret, used
+	}
+
+	challenge := func(t *testing.T, h *handler) string {
+		w := post(h.login, loginRequest{Email: "mfa@test.com", Password: "Test123!@#"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp mfaChallengeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.True(t, resp.MFARequired)
+		require.NotEmpty(t, resp.MFAChallenge)
+		return resp.MFAChallenge
+	}
+
+	t.Run("set up and verify", func(t *testing.T) {
+		h, db, mail, account := setup(t)
+
+		w := authenticated(h.setupTOTP, account.ID, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		var resp totpSetupResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.Secret)
+		assert.Contains(t, resp.ProvisioningURI, "otpauth://totp/")
+		assert.Contains(t, resp.ProvisioningURI, "secret="+resp.Secret)
+
+		// logins aren't challenged until the secret is verified
+		w = post(h.login, loginRequest{Email: "mfa@test.com", Password: "Test123!@#"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "mfa_challenge")
+
+		w = authenticated(h.verifyTOTP, account.ID, verifyTOTPRequest{Code: code(t, resp.Secret, time.Now().Add(time.Hour))})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidMFACode)
+
+		w = authenticated(h.verifyTOTP, account.ID, verifyTOTPRequest{Code: code(t, resp.Secret, time.Now())})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		var codesResp recoveryCodesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &codesResp))
+		assert.Len(t, codesResp.RecoveryCodes, 10)
+
+		require.Len(t, mail.sent, 1)
+		assert.Equal(t, "mfa@test.com", mail.sent[0].To)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, len(events), 2)
+		assert.Equal(t, database.AuditEventRecoveryCodesGenerated, events[0].EventType)
+		assert.Equal(t, database.AuditEventMFAEnabled, events[1].EventType)
+
+		// an enabled secret can't be replaced
+		w = authenticated(h.setupTOTP, account.ID, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = authenticated(h.verifyTOTP, account.ID, verifyTOTPRequest{Code: code(t, resp.Secret, time.Now())})
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("verify without setting up", func(t *testing.T) {
+		h, _, _, account := setup(t)
+
+		w := authenticated(h.verifyTOTP, account.ID, verifyTOTPRequest{Code: "123456"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeMFANotSetUp)
+	})
+
+	t.Run("two step login", func(t *testing.T) {
+		h, _, _, account := setup(t)
+		secret, used := enable(t, h, account.ID)
+
+		mfaChallenge := challenge(t, h)
+
+		// the code used to enable MFA can't be used again
+		w := post(h.loginMFA, loginMFARequest{MFAChallenge: mfaChallenge, Code: used})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidMFACode)
+
+		next := code(t, secret, time.Now().Add(totp.Period))
+		w = post(h.loginMFA, loginMFARequest{MFAChallenge: mfaChallenge, Code: next})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, account.ID, resp.AccountID)
+		assert.NotEmpty(t, resp.AccessToken)
+
+		w = post(h.refresh, refreshRequest{RefreshToken: resp.RefreshToken})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// nor the one that just logged in
+		w = post(h.loginMFA, loginMFARequest{MFAChallenge: mfaChallenge, Code: next})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("recovery codes", func(t *testing.T) {
+		h, db, _, account := setup(t)
+
+		w := authenticated(h.regenerateRecoveryCodes, account.ID, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeMFANotSetUp)
+
+		enable(t, h, account.ID)
+
+		w = authenticated(h.regenerateRecoveryCodes, account.ID, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		var codesResp recoveryCodesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &codesResp))
+		require.Len(t, codesResp.RecoveryCodes, 10)
+		codes := codesResp.RecoveryCodes
+
+		// typed without the dashes, in any case
+		typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+		w = post(h.loginMFA, loginMFARequest{MFAChallenge: challenge(t, h), Code: typed})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotEmpty(t, resp.AccessToken)
+		require.NotNil(t, resp.RecoveryCodesRemaining)
+		assert.Equal(t, 9, *resp.RecoveryCodesRemaining)
+		assert.Empty(t, resp.Warning)
+
+		// each code works once
+		w = post(h.loginMFA, loginMFARequest{MFAChallenge: challenge(t, h), Code: codes[0]})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidMFACode)
+
+		for _, c := range codes[1:7] {
+			w = post(h.loginMFA, loginMFARequest{MFAChallenge: challenge(t, h), Code: c})
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		}
+		resp = loginOrRefreshResponse{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, 3, *resp.RecoveryCodesRemaining)
+		assert.Contains(t, resp.Warning, "3 recovery codes left")
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 1}})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, database.AuditEventLogin, events[0].EventType)
+
+		// regenerating replaces the codes that are left
+		w = authenticated(h.regenerateRecoveryCodes, account.ID, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = post(h.loginMFA, loginMFARequest{MFAChallenge: challenge(t, h), Code: codes[7]})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("trusted devices skip MFA", func(t *testing.T) {
+		h, db, _, account := setup(t)
+		h.trustedDeviceTTL = 30 * 24 * time.Hour
+		h = withService(h)
+		secret, _ := enable(t, h, account.ID)
+
+		postFrom := func(handle http.HandlerFunc, userAgent string, body any) *httptest.ResponseRecorder {
+			b, _ := json.Marshal(body)
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+			req.Header.Set("User-Agent", userAgent)
+			w := httptest.NewRecorder()
+			handle(w, req)
+			return w
+		}
+
+		w := postFrom(h.loginMFA, "Firefox/128.0", loginMFARequest{
+			MFAChallenge: challenge(t, h),
+			Code:         code(t, secret, time.Now().Add(totp.Period)),
+			TrustDevice:  true,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotEmpty(t, resp.DeviceToken)
+		assert.InDelta(t, 30*24*time.Hour.Seconds(), resp.DeviceTokenExpiresIn, 5)
+
+		// a browser update is the same device
+		w = postFrom(h.login, "Firefox/129.0", loginRequest{Email: "mfa@test.com", Password: "Test123!@#", DeviceToken: resp.DeviceToken})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NotContains(t, w.Body.String(), "mfa_challenge")
+		assert.NotContains(t, w.Body.String(), "device_token")
+
+		// the token doesn't work from another device
+		w = postFrom(h.login, "curl/8.5.0", loginRequest{Email: "mfa@test.com", Password: "Test123!@#", DeviceToken: resp.DeviceToken})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "mfa_challenge")
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 20}})
+		require.NoError(t, err)
+		var types []string
+		for _, e := range events {
+			types = append(types, e.EventType)
+		}
+		assert.Contains(t, types, database.AuditEventDeviceTrusted)
+
+		// nor once the device is removed
+		_, err = db.DeleteTrustedDevices(ctx, account.ID)
+		require.NoError(t, err)
+		w = postFrom(h.login, "Firefox/129.0", loginRequest{Email: "mfa@test.com", Password: "Test123!@#", DeviceToken: resp.DeviceToken})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "mfa_challenge")
+	})
+
+	t.Run("devices aren't trusted when it's turned off", func(t *testing.T) {
+		h, _, _, account := setup(t)
+		secret, _ := enable(t, h, account.ID)
+
+		w := post(h.loginMFA, loginMFARequest{MFAChallenge: challenge(t, h), Code: code(t, secret, time.Now().Add(totp.Period)), TrustDevice: true})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NotContains(t, w.Body.String(), "device_token")
+	})
+
+	t.Run("challenges aren't access tokens", func(t *testing.T) {
+		h, _, _, account := setup(t)
+		enable(t, h, account.ID)
+
+		_, err := authClient.ParseAccessToken(challenge(t, h))
+		assert.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+
+		accessToken, _, err := authClient.NewAccessToken(auth.Claims{AccountID: account.ID})
+		require.NoError(t, err)
+		w := post(h.loginMFA, loginMFARequest{MFAChallenge: accessToken, Code: "123456"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidMFAChallenge)
+	})
+
+	t.Run("wrong codes count towards the login lockout", func(t *testing.T) {
+		h, _, _, account := setup(t)
+		h.lockout = lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{
+			Window:          time.Hour,
+			MaxAttempts:     2,
+			LockoutDuration: time.Hour,
+		})
+		h = withService(h)
+		secret, _ := enable(t, h, account.ID)
+		mfaChallenge := challenge(t, h)
+
+		for range 2 {
+			w := post(h.loginMFA, loginMFARequest{MFAChallenge: mfaChallenge, Code: code(t, secret, time.Now().Add(time.Hour))})
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+
+		w := post(h.loginMFA, loginMFARequest{MFAChallenge: mfaChallenge, Code: code(t, secret, time.Now().Add(totp.Period))})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("frozen after the password check", func(t *testing.T) {
+		h, db, _, account := setup(t)
+		secret, _ := enable(t, h, account.ID)
+		mfaChallenge := challenge(t, h)
+
+		_, err := db.FreezeAccount(ctx, account.ID)
+		require.NoError(t, err)
+
+		w := post(h.loginMFA, loginMFARequest{MFAChallenge: mfaChallenge, Code: code(t, secret, time.Now().Add(totp.Period))})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,133 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+type changePasswordRequest struct {
+	// CurrentPassword isn't needed by accounts without a password (e.g. Sign in with Apple),
+	// which set their first one this way
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type changePasswordResponse struct {
+	Message string `json:"message"`
+	// PasswordBreached warns that the new password appeared in a data breach, when breached
+	// passwords are allowed
+	PasswordBreached bool `json:"password_breached,omitempty"`
+}
+
+// changePassword replaces the authenticated account's password after checking the current
+// one, and logs out every session. Wrong current passwords count towards the login lockout
+// so a stolen access token can't be used to guess the password.
+func (h *handler) changePassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	var reqBody changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	unexpectedErr := httputils.ErrorResponse{
+		Message:    "There was an unexpected error changing the password",
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	account, err := h.db.GetAccountByID(ctx, claims.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting account to change password", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	lockoutKey := accounts.LoginLockoutKey(account.Email)
+	if wait := h.checkLockout(ctx, lockoutKey); wait > 0 {
+		writeTooManyAttempts(w, r, wait)
+		return
+	}
+
+	if account.PasswordHash != "" && !h.acceptAnyPassword && !h.service.PasswordIsCorrect(reqBody.CurrentPassword, account.PasswordHash) {
+		h.recordLoginFailure(ctx, lockoutKey)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "Current password is incorrect",
+			Type:       errTypeIncorrectPassword,
+			StatusCode: http.StatusForbidden,
+		})
+		return
+	}
+	reqBody.CurrentPassword = ""
+
+	passwordHash, err := h.service.HashNewPassword(reqBody.NewPassword, account.Email)
+	if err != nil {
+		var validationErr auth.ValidationError
+		if errors.As(err, &validationErr) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    validationErr.Error(),
+				Type:       errTypeValidationError,
+				StatusCode: http.StatusUnprocessableEntity,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error hashing new password", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+	passwordBreached, ok := h.checkBreachedPassword(w, r, reqBody.NewPassword)
+	if !ok {
+		return
+	}
+	reqBody.NewPassword = ""
+
+	if _, err := h.db.UpdatePassword(ctx, account.ID, passwordHash); err != nil {
+		slog.ErrorContext(ctx, "error updating password", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if err := h.service.RevokeSignedRefreshTokens(ctx, account.ID); err != nil {
+		slog.ErrorContext(ctx, "error revoking sessions after password change", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	// the caller logs in again with the new password too
+	if err := h.revokeAccessToken(ctx); err != nil {
+		slog.ErrorContext(ctx, "error revoking access token after password change", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if h.lockout != nil {
+		h.lockout.RecordSuccess(ctx, lockoutKey)
+	}
+
+	h.recordAuditEvent(ctx, r, account.ID, database.AuditEventPasswordChanged)
+
+	// the password is changed either way
+	err = mailer.SendTemplate(ctx, h.mailer, mailer.TemplatePasswordChanged, account.Email, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "error sending password changed notice", "error", err)
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, changePasswordResponse{
+		Message:          "Your password has been changed. Log in again with your new password",
+		PasswordBreached: passwordBreached,
+	})
+}
@@ -0,0 +1,143 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T, passwordHash string) (*handler, *database.MemoryDB, *recordingMailer, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "change@test.com", PasswordHash: passwordHash})
+		require.NoError(t, err)
+
+		mail := &recordingMailer{}
+		h := withService(&handler{db: db, mailer: mail, authClient: authClient})
+		return h, db, mail, account
+	}
+
+	changePassword := func(h *handler, accountID string, body changePasswordRequest) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/password/change", bytes.NewReader(b))
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		h.changePassword(w, req)
+		return w
+	}
+
+	refresh := func(h *handler, token string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(refreshRequest{RefreshToken: token})
+		w := httptest.NewRecorder()
+		h.refresh(w, httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewReader(b)))
+		return w
+	}
+
+	t.Run("change password", func(t *testing.T) {
+		h, db, mail, account := setup(t, hashedPassword)
+
+		session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+		require.NoError(t, err)
+
+		w := changePassword(h, account.ID, changePasswordRequest{CurrentPassword: "Test123!@#", NewPassword: "NewPass123!@#"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		updated, err := db.GetAccountByID(ctx, account.ID)
+		require.NoError(t, err)
+		assert.True(t, auth.PasswordIsCorrect("NewPass123!@#", updated.PasswordHash))
+
+		// every session has to log in again
+		assert.Equal(t, http.StatusUnauthorized, refresh(h, session.RefreshToken).Code)
+
+		require.Len(t, mail.sent, 1)
+		assert.Equal(t, "change@test.com", mail.sent[0].To)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		assert.Equal(t, database.AuditEventPasswordChanged, events[0].EventType)
+	})
+
+	t.Run("signed sessions are revoked", func(t *testing.T) {
+		h, _, _, account := setup(t, hashedPassword)
+		h.signedRefreshTokens = true
+		h.revocations = revocation.NewList(lockout.NewMemoryStore(), time.Hour)
+		h = withService(h)
+
+		session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+		require.NoError(t, err)
+
+		w := changePassword(h, account.ID, changePasswordRequest{CurrentPassword: "Test123!@#", NewPassword: "NewPass123!@#"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, refresh(h, session.RefreshToken).Code)
+	})
+
+	t.Run("wrong current password", func(t *testing.T) {
+		h, db, mail, account := setup(t, hashedPassword)
+
+		w := changePassword(h, account.ID, changePasswordRequest{CurrentPassword: "Wrong123!@#", NewPassword: "NewPass123!@#"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeIncorrectPassword)
+
+		unchanged, err := db.GetAccountByID(ctx, account.ID)
+		require.NoError(t, err)
+		assert.Equal(t, hashedPassword, unchanged.PasswordHash)
+		assert.Empty(t, mail.sent)
+	})
+
+	t.Run("wrong current passwords count towards the login lockout", func(t *testing.T) {
+		h, _, _, account := setup(t, hashedPassword)
+		h.lockout = lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{
+			Window:          time.Hour,
+			MaxAttempts:     2,
+			LockoutDuration: time.Hour,
+		})
+		h = withService(h)
+
+		for range 2 {
+			w := changePassword(h, account.ID, changePasswordRequest{CurrentPassword: "Wrong123!@#", NewPassword: "NewPass123!@#"})
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		}
+
+		w := changePassword(h, account.ID, changePasswordRequest{CurrentPassword: "Test123!@#", NewPassword: "NewPass123!@#"})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("weak new password", func(t *testing.T) {
+		h, _, _, account := setup(t, hashedPassword)
+
+		w := changePassword(h, account.ID, changePasswordRequest{CurrentPassword: "Test123!@#", NewPassword: "weak"})
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	t.Run("accounts without a password set their first one", func(t *testing.T) {
+		h, db, _, account := setup(t, "")
+
+		w := changePassword(h, account.ID, changePasswordRequest{NewPassword: "NewPass123!@#"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		updated, err := db.GetAccountByID(ctx, account.ID)
+		require.NoError(t, err)
+		assert.True(t, auth.PasswordIsCorrect("NewPass123!@#", updated.PasswordHash))
+	})
+}
@@ -0,0 +1,42 @@
+package accounts
+
+import (
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+type passwordPolicyResponse struct {
+	MinLength        int  `json:"min_length"`
+	MaxLength        int  `json:"max_length"`
+	RequireUppercase bool `json:"require_uppercase"`
+	RequireLowercase bool `json:"require_lowercase"`
+	RequireDigit     bool `json:"require_digit"`
+	RequireSpecial   bool `json:"require_special"`
+	// SpecialCharacters are the characters that count as special
+	SpecialCharacters       string `json:"special_characters"`
+	DisallowEmail           bool   `json:"disallow_email"`
+	DisallowCommonPasswords bool   `json:"disallow_common_passwords"`
+	// Requirements explain the policy in sentences forms can show as they are
+	Requirements []string `json:"requirements"`
+}
+
+// passwordPolicyRequirements describes the rules new passwords have to follow so forms can show
+// them before the password is submitted
+func (h *handler) passwordPolicyRequirements(w http.ResponseWriter, r *http.Request) {
+	cfg := h.passwordPolicy.Config()
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, passwordPolicyResponse{
+		MinLength:               cfg.MinLength,
+		MaxLength:               cfg.MaxLength,
+		RequireUppercase:        cfg.RequireUppercase,
+		RequireLowercase:        cfg.RequireLowercase,
+		RequireDigit:            cfg.RequireDigit,
+		RequireSpecial:          cfg.RequireSpecial,
+		SpecialCharacters:       auth.PasswordSpecialCharacters,
+		DisallowEmail:           cfg.DisallowEmail,
+		DisallowCommonPasswords: len(cfg.BannedPasswords) > 0,
+		Requirements:            h.passwordPolicy.Explain(),
+	})
+}
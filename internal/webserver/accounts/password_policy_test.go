@@ -0,0 +1,70 @@
+package accounts
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy, err := auth.NewPasswordPolicy(auth.PasswordPolicyConfig{
+		MinLength:       10,
+		MaxLength:       64,
+		RequireDigit:    true,
+		DisallowEmail:   true,
+		BannedPasswords: []string{"password123"},
+	})
+	require.NoError(t, err)
+
+	h := withService(&handler{db: database.NewMemoryDB(), mailer: &recordingMailer{}, passwordPolicy: policy})
+
+	t.Run("describes the policy", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.passwordPolicyRequirements(w, httptest.NewRequest(http.MethodGet, "/password-policy", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp passwordPolicyResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, 10, resp.MinLength)
+		assert.Equal(t, 64, resp.MaxLength)
+		assert.True(t, resp.RequireDigit)
+		assert.False(t, resp.RequireUppercase)
+		assert.True(t, resp.DisallowEmail)
+		assert.True(t, resp.DisallowCommonPasswords)
+		assert.Equal(t, policy.Explain(), resp.Requirements)
+	})
+
+	register := func(password string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(registerRequest{Email: "someone@example.com", Password: password})
+		w := httptest.NewRecorder()
+		h.register(w, httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(b)))
+		return w
+	}
+
+	t.Run("registration follows the policy", func(t *testing.T) {
+		for password, message := range map[string]string{
+			"short 1":            "password must be at least 10 characters long",
+			"Password123":        "password is too common",
+			"hi someone 1234":    "password must not contain your email address",
+			"no digits anywhere": "password must contain digit",
+		} {
+			w := register(password)
+			require.Equal(t, http.StatusUnprocessableEntity, w.Code, password)
+			var resp httputils.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, errTypeValidationError, resp.Type)
+			assert.Contains(t, resp.Message, message)
+		}
+
+		// no special character or uppercase needed under this policy
+		assert.Equal(t, http.StatusCreated, register("long enough 42").Code)
+	})
+}
@@ -0,0 +1,233 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/antiabuse"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const (
+	passwordResetLinkTTL = time.Hour
+
+	errTypeInvalidPasswordResetToken = "invalid_password_reset_token"
+
+	// DefaultPasswordResetLimit is how many password reset emails a client IP can ask for per hour
+	DefaultPasswordResetLimit = 10
+)
+
+// NewPasswordResetLimiter allows limit forgot password requests per client per hour
+func NewPasswordResetLimiter(store lockout.Store, limit int) *lockout.Guard {
+	return lockout.NewGuard(store, lockout.Config{
+		Window:          time.Hour,
+		MaxAttempts:     limit,
+		LockoutDuration: time.Hour,
+	})
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+	// CaptchaToken is the captcha provider's response token, when a captcha is configured
+	CaptchaToken string `json:"captcha_token"`
+}
+
+// forgotPassword emails a password reset link. The response is the same whether or not the
+// account exists, and requests are rate limited per client so the endpoint can't be used to
+// flood inboxes or probe for accounts.
+func (h *handler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Email == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	if !h.checkCaptcha(w, r, antiabuse.ActionForgotPassword, reqBody.CaptchaToken) {
+		return
+	}
+
+	throttleKey := "password-forgot:" + httputils.ClientIP(r)
+	if wait := h.passwordResetLimiter.Check(ctx, throttleKey); wait > 0 {
+		writeRateLimited(w, r, wait)
+		return
+	}
+	h.passwordResetLimiter.RecordFailure(ctx, throttleKey)
+
+	if err := h.sendPasswordResetLink(ctx, reqBody.Email); err != nil {
+		slog.ErrorContext(ctx, "error sending password reset link", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error sending the password reset link",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusAccepted, map[string]string{
+		"message": "If an account exists for this email, we've sent it a link to reset the password",
+	})
+}
+
+func (h *handler) sendPasswordResetLink(ctx context.Context, email string) error {
+	// the client limit doesn't stop one address being flooded from many clients
+	throttleKey := "password-reset-link:" + strings.ToLower(strings.TrimSpace(email))
+	if h.checkLockout(ctx, throttleKey) > 0 {
+		return nil
+	}
+	if h.lockout != nil {
+		h.lockout.RecordFailure(ctx, throttleKey)
+	}
+
+	account, err := h.db.GetAccount(ctx, email)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return nil
+		}
+		return fmt.Errorf("error getting account: %w", err)
+	}
+
+	// a frozen account gets a new password from its unfreeze link
+	if account.FrozenAt != nil {
+		return nil
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("error generating password reset token: %w", err)
+	}
+
+	err = h.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashOpaqueToken(token),
+		AccountID: account.ID,
+		Email:     account.Email,
+		ExpiresAt: time.Now().Add(passwordResetLinkTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return mailer.SendTemplate(ctx, h.mailer, mailer.TemplatePasswordReset, account.Email, mailer.Data{
+		"Link": h.emailLink("/password/reset", token),
+	})
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// resetPassword sets a new password with an emailed reset link and logs out every session
+func (h *handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Token == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	unexpectedErr := httputils.ErrorResponse{
+		Message:    "There was an unexpected error resetting the password",
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	token, err := h.db.GetPasswordResetToken(ctx, auth.HashOpaqueToken(reqBody.Token))
+	if err != nil {
+		if errors.Is(err, database.ErrPasswordResetTokenNotFound) {
+			writeInvalidPasswordResetToken(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error getting password reset token", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		writeInvalidPasswordResetToken(w, r)
+		return
+	}
+
+	account, err := h.db.GetAccountByID(ctx, token.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting account for password reset", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	// the link was mailed to an address the account no longer has
+	if !strings.EqualFold(account.Email, token.Email) {
+		writeInvalidPasswordResetToken(w, r)
+		return
+	}
+
+	if account.FrozenAt != nil {
+		writeAccountFrozen(w, r)
+		return
+	}
+
+	passwordHash, err := h.service.HashNewPassword(reqBody.NewPassword, account.Email)
+	if err != nil {
+		var validationErr auth.ValidationError
+		if errors.As(err, &validationErr) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    validationErr.Error(),
+				Type:       errTypeValidationError,
+				StatusCode: http.StatusUnprocessableEntity,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error hashing new password", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+	reqBody.NewPassword = ""
+
+	if _, err := h.db.ResetPassword(ctx, account.ID, passwordHash); err != nil {
+		slog.ErrorContext(ctx, "error resetting password", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if err := h.service.RevokeSignedRefreshTokens(ctx, account.ID); err != nil {
+		slog.ErrorContext(ctx, "error revoking sessions after password reset", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	// whoever was locked out of logging in can use the new password right away
+	if h.lockout != nil {
+		h.lockout.RecordSuccess(ctx, accounts.LoginLockoutKey(account.Email))
+	}
+
+	h.recordAuditEvent(ctx, r, account.ID, database.AuditEventPasswordReset)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
+		"message": "Your password has been reset. Log in with your new password",
+	})
+}
+
+func writeInvalidPasswordResetToken(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "This link is invalid or has expired",
+		Type:       errTypeInvalidPasswordResetToken,
+		StatusCode: http.StatusBadRequest,
+	})
+}
@@ -0,0 +1,179 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (*handler, *database.MemoryDB, *recordingMailer, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "reset@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+
+		mail := &recordingMailer{}
+		h := withService(&handler{
+			db:                   db,
+			mailer:               mail,
+			authClient:           authClient,
+			appURL:               "https://app.example.com",
+			passwordResetLimiter: NewPasswordResetLimiter(lockout.NewMemoryStore(), DefaultPasswordResetLimit),
+		})
+		return h, db, mail, account
+	}
+
+	post := func(handle http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		handle(w, req)
+		return w
+	}
+
+	login := func(h *handler, password string) *httptest.ResponseRecorder {
+		return post(h.login, loginRequest{Email: "reset@test.com", Password: password})
+	}
+
+	forgot := func(t *testing.T, h *handler, mail *recordingMailer) string {
+		w := post(h.forgotPassword, forgotPasswordRequest{Email: "reset@test.com"})
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		token := mail.links(t, "reset@test.com")["/password/reset"]
+		require.NotEmpty(t, token)
+		return token
+	}
+
+	t.Run("forgot and reset", func(t *testing.T) {
+		h, db, mail, account := setup(t)
+
+		session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+		require.NoError(t, err)
+
+		token := forgot(t, h, mail)
+
+		w := post(h.resetPassword, resetPasswordRequest{Token: token, NewPassword: "weak"})
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+		w = post(h.resetPassword, resetPasswordRequest{Token: token, NewPassword: "NewPass123!@#"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, login(h, "Test123!@#").Code)
+		assert.Equal(t, http.StatusOK, login(h, "NewPass123!@#").Code)
+
+		// every session is logged out
+		w = post(h.refresh, refreshRequest{RefreshToken: session.RefreshToken})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// the link only works once
+		w = post(h.resetPassword, resetPasswordRequest{Token: token, NewPassword: "Other123!@#"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidPasswordResetToken)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		var types []string
+		for _, e := range events {
+			types = append(types, e.EventType)
+		}
+		assert.Contains(t, types, database.AuditEventPasswordReset)
+	})
+
+	t.Run("signed sessions are revoked", func(t *testing.T) {
+		h, _, mail, account := setup(t)
+		h.signedRefreshTokens = true
+		h.revocations = revocation.NewList(lockout.NewMemoryStore(), time.Hour)
+		h = withService(h)
+
+		session, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+		require.NoError(t, err)
+
+		token := forgot(t, h, mail)
+		w := post(h.resetPassword, resetPasswordRequest{Token: token, NewPassword: "NewPass123!@#"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = post(h.refresh, refreshRequest{RefreshToken: session.RefreshToken})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("unknown emails get the same answer", func(t *testing.T) {
+		h, _, mail, _ := setup(t)
+
+		w := post(h.forgotPassword, forgotPasswordRequest{Email: "nobody@test.com"})
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Empty(t, mail.sent)
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		h, db, _, account := setup(t)
+
+		token, err := auth.NewOpaqueToken()
+		require.NoError(t, err)
+		require.NoError(t, db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+			TokenHash: auth.HashOpaqueToken(token),
+			AccountID: account.ID,
+			Email:     account.Email,
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}))
+
+		w := post(h.resetPassword, resetPasswordRequest{Token: token, NewPassword: "NewPass123!@#"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("link for an email the account no longer has", func(t *testing.T) {
+		h, db, _, account := setup(t)
+
+		token, err := auth.NewOpaqueToken()
+		require.NoError(t, err)
+		require.NoError(t, db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+			TokenHash: auth.HashOpaqueToken(token),
+			AccountID: account.ID,
+			Email:     "old@test.com",
+			ExpiresAt: time.Now().Add(time.Hour),
+		}))
+
+		w := post(h.resetPassword, resetPasswordRequest{Token: token, NewPassword: "NewPass123!@#"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("frozen accounts aren't sent links", func(t *testing.T) {
+		h, db, mail, account := setup(t)
+		_, err := db.FreezeAccount(ctx, account.ID)
+		require.NoError(t, err)
+
+		w := post(h.forgotPassword, forgotPasswordRequest{Email: "reset@test.com"})
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Empty(t, mail.sent)
+	})
+
+	t.Run("clients are rate limited", func(t *testing.T) {
+		h, _, _, _ := setup(t)
+		h.passwordResetLimiter = NewPasswordResetLimiter(lockout.NewMemoryStore(), 2)
+
+		for range 2 {
+			w := post(h.forgotPassword, forgotPasswordRequest{Email: "nobody@test.com"})
+			assert.Equal(t, http.StatusAccepted, w.Code)
+		}
+
+		w := post(h.forgotPassword, forgotPasswordRequest{Email: "nobody@test.com"})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+}
@@ -0,0 +1,233 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/sms"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+const (
+	errTypePhoneAlreadyVerified = "mfa_phone_already_verified"
+	errTypeSMSCodeThrottled     = "sms_code_throttled"
+)
+
+// SMSConfig turns on phone numbers as a second factor, with codes sent by text message or voice
+// call
+type SMSConfig = accounts.SMSConfig
+
+type setupPhoneRequest struct {
+	PhoneNumber string `json:"phone_number"`
+	// Channel is sms or voice, sms by default
+	Channel string `json:"channel"`
+}
+
+type phoneCodeSentResponse struct {
+	Message string `json:"message"`
+	// PhoneNumber is masked to the last digits
+	PhoneNumber string `json:"phone_number"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// setupPhone sends a code to a phone number for the authenticated account to get MFA codes on.
+// MFA by phone isn't on until the code is verified, and setting up again before that replaces
+// the number.
+func (h *handler) setupPhone(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	var reqBody setupPhoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	sent, err := h.service.EnrollPhone(ctx, claims.AccountID, reqBody.PhoneNumber, smsChannel(reqBody.Channel))
+	if err != nil {
+		var throttled *accounts.SMSThrottledError
+		switch {
+		case errors.Is(err, accounts.ErrInvalidPhoneNumber):
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "Enter the phone number with its country code, e.g. +14155550123",
+				Type:       errTypeValidationError,
+				StatusCode: http.StatusUnprocessableEntity,
+			})
+		case errors.Is(err, accounts.ErrInvalidSMSChannel):
+			writeInvalidSMSChannel(w, r)
+		case errors.Is(err, accounts.ErrPhoneAlreadyVerified):
+			writePhoneAlreadyVerified(w, r)
+		case errors.As(err, &throttled):
+			writeSMSCodeThrottled(w, r, throttled.RetryAfter)
+		default:
+			slog.ErrorContext(ctx, "error setting up MFA phone", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    unexpectedMFAError,
+				StatusCode: http.StatusInternalServerError,
+			})
+		}
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, phoneCodeSentResponse{
+		Message:     "Enter the code we sent to your phone to turn on two-factor authentication",
+		PhoneNumber: sent.PhoneNumber,
+		ExpiresIn:   int(time.Until(sent.ExpiresAt).Seconds()),
+	})
+}
+
+type verifyPhoneRequest struct {
+	Code string `json:"code"`
+}
+
+// verifyPhone turns on MFA by phone once the authenticated account enters the code setupPhone
+// sent. An account that didn't have MFA yet gets its recovery codes.
+func (h *handler) verifyPhone(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	var reqBody verifyPhoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	codes, err := h.service.VerifyPhone(ctx, claims.AccountID, reqBody.Code, h.client(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, accounts.ErrPhoneNotSetUp):
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "Set up a phone number first",
+				Type:       errTypeMFANotSetUp,
+				StatusCode: http.StatusBadRequest,
+			})
+		case errors.Is(err, accounts.ErrPhoneAlreadyVerified):
+			writePhoneAlreadyVerified(w, r)
+		case errors.Is(err, accounts.ErrIncorrectMFACode):
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The code is incorrect or has expired",
+				Type:       errTypeInvalidMFACode,
+				StatusCode: http.StatusBadRequest,
+			})
+		default:
+			slog.ErrorContext(ctx, "error verifying MFA phone", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    unexpectedMFAError,
+				StatusCode: http.StatusInternalServerError,
+			})
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.WriteJSONResponse(w, r, http.StatusOK, recoveryCodesResponse{
+		Message:       "Two-factor authentication by phone is on. Logins can be finished with a code sent to your phone",
+		RecoveryCodes: codes,
+	})
+}
+
+type sendLoginCodeRequest struct {
+	MFAChallenge string `json:"mfa_challenge"`
+	// Channel is sms or voice, sms by default
+	Channel string `json:"channel"`
+}
+
+// sendLoginCode sends a code to the verified phone number of the account an MFA challenge is
+// for, which finishes the login at /login/mfa
+func (h *handler) sendLoginCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody sendLoginCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	sent, err := h.service.SendLoginCode(ctx, reqBody.MFAChallenge, smsChannel(reqBody.Channel))
+	if err != nil {
+		var lockedOut *accounts.LockedOutError
+		var throttled *accounts.SMSThrottledError
+		switch {
+		case errors.Is(err, accounts.ErrInvalidMFAChallenge):
+			writeInvalidMFAChallenge(w, r)
+		case errors.Is(err, accounts.ErrInvalidSMSChannel):
+			writeInvalidSMSChannel(w, r)
+		case errors.As(err, &lockedOut):
+			writeTooManyAttempts(w, r, lockedOut.RetryAfter)
+		case errors.Is(err, accounts.ErrAccountFrozen):
+			writeAccountFrozen(w, r)
+		case errors.Is(err, accounts.ErrPhoneNotSetUp):
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The account has no phone number for two-factor authentication",
+				Type:       errTypeMFANotSetUp,
+				StatusCode: http.StatusBadRequest,
+			})
+		case errors.As(err, &throttled):
+			writeSMSCodeThrottled(w, r, throttled.RetryAfter)
+		default:
+			slog.ErrorContext(ctx, "error sending MFA login code", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    unexpectedLoginError,
+				StatusCode: http.StatusInternalServerError,
+			})
+		}
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, phoneCodeSentResponse{
+		Message:     "Enter the code we sent to your phone to finish logging in",
+		PhoneNumber: sent.PhoneNumber,
+		ExpiresIn:   int(time.Until(sent.ExpiresAt).Seconds()),
+	})
+}
+
+// smsChannel is the channel a request asked for, sms when it didn't
+func smsChannel(channel string) sms.Channel {
+	if channel == "" {
+		return sms.ChannelSMS
+	}
+	return sms.Channel(channel)
+}
+
+func writeInvalidSMSChannel(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "channel must be sms or voice",
+		Type:       errTypeValidationError,
+		StatusCode: http.StatusUnprocessableEntity,
+	})
+}
+
+func writePhoneAlreadyVerified(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Two-factor authentication by phone is already on",
+		Type:       errTypePhoneAlreadyVerified,
+		StatusCode: http.StatusConflict,
+	})
+}
+
+func writeSMSCodeThrottled(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "A code was sent moments ago, wait before asking for another",
+		Type:       errTypeSMSCodeThrottled,
+		StatusCode: http.StatusTooManyRequests,
+	})
+}
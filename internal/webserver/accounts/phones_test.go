@@ -0,0 +1,213 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/sms"
+	"github.com/austinwofford/account-management/internal/service/totp"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSMSSender struct {
+	sent []sms.Message
+}
+
+func (s *recordingSMSSender) Send(ctx context.Context, msg sms.Message) error {
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+// code is the code in the last message sent
+func (s *recordingSMSSender) code(t *testing.T) string {
+	t.Helper()
+	require.NotEmpty(t, s.sent)
+	c := regexp.MustCompile(`\d{6}`).FindString(s.sent[len(s.sent)-1].Body)
+	require.NotEmpty(t, c)
+	return c
+}
+
+func TestPhoneMFA(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T, resend time.Duration) (*handler, *database.MemoryDB, *recordingSMSSender, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "sms@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+
+		sender := &recordingSMSSender{}
+		h := withService(&handler{
+			db:         db,
+			mailer:     &recordingMailer{},
+			authClient: authClient,
+			totpIssuer: DefaultTOTPIssuer,
+			sms:        &SMSConfig{Sender: sender, ResendInterval: resend},
+		})
+		return h, db, sender, account
+	}
+
+	authenticated := func(handle http.HandlerFunc, accountID string, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		handle(w, req)
+		return w
+	}
+
+	post := func(handle http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		handle(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		return w
+	}
+
+	// enroll sets up and verifies a phone number for the account
+	enroll := func(t *testing.T, h *handler, sender *recordingSMSSender, accountID string) {
+		w := authenticated(h.setupPhone, accountID, setupPhoneRequest{PhoneNumber: "+14155550123"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		w = authenticated(h.verifyPhone, accountID, verifyPhoneRequest{Code: sender.code(t)})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	t.Run("set up and verify", func(t *testing.T) {
+		h, db, sender, account := setup(t, 0)
+
+		w := authenticated(h.setupPhone, account.ID, setupPhoneRequest{PhoneNumber: "+1 (415) 555-0123"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp phoneCodeSentResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "+*******0123", resp.PhoneNumber)
+		assert.InDelta(t, 300, resp.ExpiresIn, 1)
+		require.Len(t, sender.sent, 1)
+		assert.Equal(t, "+14155550123", sender.sent[0].To)
+		assert.Equal(t, sms.ChannelSMS, sender.sent[0].Channel)
+
+		// logins aren't challenged until the phone is verified
+		w = post(h.login, loginRequest{Email: "sms@test.com", Password: "Test123!@#"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "mfa_challenge")
+
+		w = authenticated(h.verifyPhone, account.ID, verifyPhoneRequest{Code: "000000"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidMFACode)
+
+		w = authenticated(h.verifyPhone, account.ID, verifyPhoneRequest{Code: sender.code(t)})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		var codesResp recoveryCodesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &codesResp))
+		assert.Len(t, codesResp.RecoveryCodes, 10)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, len(events), 2)
+		assert.Equal(t, database.AuditEventRecoveryCodesGenerated, events[0].EventType)
+		assert.Equal(t, database.AuditEventMFAPhoneVerified, events[1].EventType)
+
+		// a verified number can't be replaced
+		w = authenticated(h.setupPhone, account.ID, setupPhoneRequest{PhoneNumber: "+14155550199"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), errTypePhoneAlreadyVerified)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		h, _, sender, account := setup(t, 0)
+
+		w := authenticated(h.setupPhone, account.ID, setupPhoneRequest{PhoneNumber: "4155550123"})
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		w = authenticated(h.setupPhone, account.ID, setupPhoneRequest{PhoneNumber: "+14155550123", Channel: "fax"})
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Empty(t, sender.sent)
+
+		w = authenticated(h.verifyPhone, account.ID, verifyPhoneRequest{Code: "123456"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeMFANotSetUp)
+	})
+
+	t.Run("resend throttling", func(t *testing.T) {
+		h, _, sender, account := setup(t, time.Minute)
+
+		w := authenticated(h.setupPhone, account.ID, setupPhoneRequest{PhoneNumber: "+14155550123", Channel: "voice"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Len(t, sender.sent, 1)
+		assert.Equal(t, sms.ChannelVoice, sender.sent[0].Channel)
+
+		w = authenticated(h.setupPhone, account.ID, setupPhoneRequest{PhoneNumber: "+14155550123"})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeSMSCodeThrottled)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		assert.Len(t, sender.sent, 1)
+	})
+
+	t.Run("two step login", func(t *testing.T) {
+		h, _, sender, account := setup(t, 0)
+		enroll(t, h, sender, account.ID)
+
+		w := post(h.login, loginRequest{Email: "sms@test.com", Password: "Test123!@#"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var challengeResp mfaChallengeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &challengeResp))
+		require.True(t, challengeResp.MFARequired)
+		assert.Equal(t, []string{"sms"}, challengeResp.MFAMethods)
+
+		w = post(h.sendLoginCode, sendLoginCodeRequest{MFAChallenge: "not-a-challenge"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = post(h.sendLoginCode, sendLoginCodeRequest{MFAChallenge: challengeResp.MFAChallenge})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		code := sender.code(t)
+
+		w = post(h.loginMFA, loginMFARequest{MFAChallenge: challengeResp.MFAChallenge, Code: code})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, account.ID, resp.AccountID)
+		assert.NotEmpty(t, resp.AccessToken)
+
+		// each code works once
+		w = post(h.loginMFA, loginMFARequest{MFAChallenge: challengeResp.MFAChallenge, Code: code})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidMFACode)
+	})
+
+	t.Run("login code without a phone", func(t *testing.T) {
+		h, _, sender, account := setup(t, 0)
+
+		// MFA by authenticator app only
+		w := authenticated(h.setupTOTP, account.ID, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var setupResp totpSetupResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &setupResp))
+		c, err := totp.Code(setupResp.Secret, totp.Step(time.Now()))
+		require.NoError(t, err)
+		w = authenticated(h.verifyTOTP, account.ID, verifyTOTPRequest{Code: c})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = post(h.login, loginRequest{Email: "sms@test.com", Password: "Test123!@#"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var challengeResp mfaChallengeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &challengeResp))
+		assert.Equal(t, []string{"totp"}, challengeResp.MFAMethods)
+
+		w = post(h.sendLoginCode, sendLoginCodeRequest{MFAChallenge: challengeResp.MFAChallenge})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeMFANotSetUp)
+		assert.Empty(t, sender.sent)
+	})
+}
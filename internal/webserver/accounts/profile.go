@@ -0,0 +1,147 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/i18n"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+const (
+	maxProfileNameLength = 100
+	maxAvatarURLLength   = 2048
+)
+
+// updateMeRequest is a partial update, the fields that are left out aren't changed. An empty
+// string clears a field, except preferred_locale, which always has to be a supported locale.
+type updateMeRequest struct {
+	Username        *string `json:"username"`
+	DisplayName     *string `json:"display_name"`
+	GivenName       *string `json:"given_name"`
+	FamilyName      *string `json:"family_name"`
+	PreferredLocale *string `json:"preferred_locale"`
+	Timezone        *string `json:"timezone"`
+	AvatarURL       *string `json:"avatar_url"`
+}
+
+// updateMe changes the authenticated account's profile
+func (h *handler) updateMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	var reqBody updateMeRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	params, validationMessage := profileParams(reqBody)
+	if validationMessage != "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    validationMessage,
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	account, err := h.db.UpdateAccountProfile(ctx, claims.AccountID, params)
+	if err != nil {
+		// the token outlived the account
+		if errors.Is(err, database.ErrAccountNotFound) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The account was not found",
+				Type:       errTypeAccountNotFound,
+				StatusCode: http.StatusNotFound,
+			})
+			return
+		}
+		if errors.Is(err, database.ErrUsernameTaken) {
+			writeUsernameTaken(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error updating account profile", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error updating the account",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, account.ID, database.AuditEventProfileUpdated)
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.WriteJSONResponse(w, r, http.StatusOK, toMeResponse(account))
+}
+
+// profileParams validates the request and trims the names, username and avatar URL. It returns a
+// message for the client when the request isn't valid.
+func profileParams(req updateMeRequest) (database.UpdateAccountProfileParams, string) {
+	params := database.UpdateAccountProfileParams{
+		Username:        trimmed(req.Username),
+		DisplayName:     trimmed(req.DisplayName),
+		GivenName:       trimmed(req.GivenName),
+		FamilyName:      trimmed(req.FamilyName),
+		PreferredLocale: req.PreferredLocale,
+		Timezone:        req.Timezone,
+		AvatarURL:       trimmed(req.AvatarURL),
+	}
+
+	if params == (database.UpdateAccountProfileParams{}) {
+		return params, "The request needs at least one profile field to change"
+	}
+	// "" removes it, usernames are optional
+	if params.Username != nil && *params.Username != "" {
+		if err := accounts.ValidateUsername(*params.Username); err != nil {
+			return params, invalidUsernameMessage(err)
+		}
+	}
+	for _, name := range []*string{params.DisplayName, params.GivenName, params.FamilyName} {
+		if name != nil && utf8.RuneCountInString(*name) > maxProfileNameLength {
+			return params, "Names can be at most 100 characters"
+		}
+	}
+	if params.PreferredLocale != nil && !i18n.IsSupported(*params.PreferredLocale) {
+		return params, "The preferred locale must be one of: " + strings.Join(i18n.SupportedLocales, ", ")
+	}
+	// "" clears it, and "Local" is the server's time zone rather than the client's
+	if tz := params.Timezone; tz != nil && *tz != "" {
+		if _, err := time.LoadLocation(*tz); err != nil || *tz == "Local" {
+			return params, "The timezone must be an IANA time zone, e.g. Europe/Berlin"
+		}
+	}
+	if params.AvatarURL != nil && *params.AvatarURL != "" && !validAvatarURL(*params.AvatarURL) {
+		return params, "The avatar URL must be an https URL of at most 2048 characters"
+	}
+	return params, ""
+}
+
+func validAvatarURL(s string) bool {
+	if len(s) > maxAvatarURLLength {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != "" && u.User == nil
+}
+
+func trimmed(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*s)
+	return &t
+}
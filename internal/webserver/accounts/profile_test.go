@@ -0,0 +1,221 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateMe(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		missing        bool
+		body           string
+		expectedStatus int
+		expectedType   string
+		// checked against the response and the stored account when the update succeeds
+		expected func(t *testing.T, resp meResponse)
+	}{
+		{
+			name:           "sets the fields that are in the request",
+			body:           `{"display_name": " Ada ", "given_name": "Ada", "family_name": "Lovelace", "preferred_locale": "de", "timezone": "Europe/London", "avatar_url": "https://cdn.example.com/ada.png"}`,
+			expectedStatus: http.StatusOK,
+			expected: func(t *testing.T, resp meResponse) {
+				assert.Equal(t, "Ada", resp.DisplayName)
+				assert.Equal(t, "Ada", resp.GivenName)
+				assert.Equal(t, "Lovelace", resp.FamilyName)
+				assert.Equal(t, "de", resp.PreferredLocale)
+				assert.Equal(t, "Europe/London", resp.Timezone)
+				assert.Equal(t, "https://cdn.example.com/ada.png", resp.AvatarURL)
+			},
+		},
+		{
+			name:           "leaves the fields that are left out",
+			body:           `{"timezone": "America/New_York"}`,
+			expectedStatus: http.StatusOK,
+			expected: func(t *testing.T, resp meResponse) {
+				assert.Equal(t, "America/New_York", resp.Timezone)
+				assert.Equal(t, "Grace", resp.DisplayName)
+				assert.Equal(t, "es", resp.PreferredLocale)
+				assert.Equal(t, "grace_h", resp.Username)
+			},
+		},
+		{
+			name:           "empty strings clear fields",
+			body:           `{"display_name": "", "avatar_url": ""}`,
+			expectedStatus: http.StatusOK,
+			expected: func(t *testing.T, resp meResponse) {
+				assert.Empty(t, resp.DisplayName)
+				assert.Empty(t, resp.AvatarURL)
+				assert.Equal(t, "Hopper", resp.FamilyName)
+			},
+		},
+		{
+			name:           "sets the username",
+			body:           `{"username": " Ada.L "}`,
+			expectedStatus: http.StatusOK,
+			expected: func(t *testing.T, resp meResponse) {
+				assert.Equal(t, "Ada.L", resp.Username)
+			},
+		},
+		{
+			name:           "empty username removes it",
+			body:           `{"username": ""}`,
+			expectedStatus: http.StatusOK,
+			expected: func(t *testing.T, resp meResponse) {
+				assert.Empty(t, resp.Username)
+			},
+		},
+		{
+			name:           "username taken in another case",
+			body:           `{"username": "TAKEN_NAME"}`,
+			expectedStatus: http.StatusConflict,
+			expectedType:   errTypeUsernameTaken,
+		},
+		{
+			name:           "reserved username",
+			body:           `{"username": "support"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "username with an @",
+			body:           `{"username": "ada@lovelace"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "nothing to change",
+			body:           `{}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "name too long",
+			body:           `{"given_name": "` + strings.Repeat("a", maxProfileNameLength+1) + `"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "unsupported locale",
+			body:           `{"preferred_locale": "fr"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "locale can't be cleared",
+			body:           `{"preferred_locale": ""}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "unknown timezone",
+			body:           `{"timezone": "Mars/Olympus_Mons"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "server's local timezone",
+			body:           `{"timezone": "Local"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "avatar url isn't https",
+			body:           `{"avatar_url": "http://cdn.example.com/ada.png"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "avatar url isn't absolute",
+			body:           `{"avatar_url": "/ada.png"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedType:   errTypeValidationError,
+		},
+		{
+			name:           "malformed body",
+			body:           `{"display_name": 1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "account no longer exists",
+			missing:        true,
+			body:           `{"display_name": "Ada"}`,
+			expectedStatus: http.StatusNotFound,
+			expectedType:   errTypeAccountNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := database.NewMemoryDB()
+			account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "me@test.com", Username: "grace_h", PreferredLocale: "es"})
+			require.NoError(t, err)
+			_, err = db.CreateAccount(ctx, database.AccountCreationParams{Email: "other@test.com", Username: "Taken_Name"})
+			require.NoError(t, err)
+			displayName, familyName, avatarURL := "Grace", "Hopper", "https://cdn.example.com/grace.png"
+			_, err = db.UpdateAccountProfile(ctx, account.ID, database.UpdateAccountProfileParams{
+				DisplayName: &displayName,
+				FamilyName:  &familyName,
+				AvatarURL:   &avatarURL,
+			})
+			require.NoError(t, err)
+			before, err := db.GetAccountByID(ctx, account.ID)
+			require.NoError(t, err)
+
+			accountID := account.ID
+			if tt.missing {
+				accountID = "missing"
+			}
+
+			h := withService(&handler{db: db})
+
+			req := httptest.NewRequest(http.MethodPatch, "/me", strings.NewReader(tt.body))
+			req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+			w := httptest.NewRecorder()
+			h.updateMe(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			if tt.expectedType != "" {
+				var resp map[string]any
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedType, resp["type"])
+			}
+
+			events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+			require.NoError(t, err)
+			if tt.expected == nil {
+				assert.Empty(t, events)
+				after, err := db.GetAccountByID(ctx, account.ID)
+				require.NoError(t, err)
+				assert.Equal(t, before, after)
+				return
+			}
+
+			var resp meResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			tt.expected(t, resp)
+			assert.True(t, resp.UpdatedAt.After(before.UpdatedAt))
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+			stored, err := db.GetAccountByID(ctx, account.ID)
+			require.NoError(t, err)
+			assert.Equal(t, stored.DisplayName, resp.DisplayName)
+			assert.Equal(t, stored.Timezone, resp.Timezone)
+
+			require.Len(t, events, 1)
+			assert.Equal(t, database.AuditEventProfileUpdated, events[0].EventType)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+
+	tests := []struct {
+		name        string
+		rotation    bool
+		gracePeriod time.Duration
+		// expectedReuseStatus is the status when the first refresh token is used a second time
+		expectedReuseStatus int
+	}{
+		{
+			name:                "rotation disabled",
+			rotation:            false,
+			expectedReuseStatus: http.StatusOK,
+		},
+		{
+			name:                "reuse within the grace period",
+			rotation:            true,
+			gracePeriod:         time.Minute,
+			expectedReuseStatus: http.StatusOK,
+		},
+		{
+			name:                "reuse after the grace period",
+			rotation:            true,
+			gracePeriod:         0,
+			expectedReuseStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := database.NewMemoryDB()
+			account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "rotation@test.com"})
+			require.NoError(t, err)
+
+			h := withService(&handler{
+				db:                      db,
+				authClient:              authClient,
+				refreshTokenRotation:    tt.rotation,
+				refreshTokenGracePeriod: tt.gracePeriod,
+			})
+
+			initial, err := h.service.IssueTokens(ctx, account.ID, accounts.Client{})
+			require.NoError(t, err)
+
+			refresh := func(token string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(`{"refresh_token":"`+token+`"}`))
+				w := httptest.NewRecorder()
+				h.refresh(w, req)
+				return w
+			}
+
+			w := refresh(initial.RefreshToken)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var rotated loginOrRefreshResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+			assert.NotEqual(t, initial.RefreshToken, rotated.RefreshToken)
+
+			w = refresh(initial.RefreshToken)
+			assert.Equal(t, tt.expectedReuseStatus, w.Code, w.Body.String())
+
+			// the replacement token works either way
+			w = refresh(rotated.RefreshToken)
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package accounts
+
+import (
+	"context"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRolesInAccessToken(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	admin, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "admin@test.com"})
+	require.NoError(t, err)
+	require.NoError(t, db.AssignRole(ctx, admin.ID, database.RoleAdmin))
+	other, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "other@test.com"})
+	require.NoError(t, err)
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	h := withService(&handler{db: db, authClient: authClient})
+
+	resp, err := h.service.IssueTokens(ctx, admin.ID, accounts.Client{})
+	require.NoError(t, err)
+	claims, err := authClient.ParseAccessToken(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, []string{database.RoleAdmin}, claims.Roles)
+	assert.True(t, claims.HasRole(database.RoleAdmin))
+
+	resp, err = h.service.IssueTokens(ctx, other.ID, accounts.Client{})
+	require.NoError(t, err)
+	claims, err = authClient.ParseAccessToken(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Empty(t, claims.Roles)
+	assert.False(t, claims.HasRole(database.RoleAdmin))
+}
@@ -0,0 +1,28 @@
+package accounts
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeInvalidScope = "invalid_scope"
+
+// tokenScopes sorts and dedupes the scopes a login or refresh asked for, and reports whether
+// they're all auth.Scopes
+func tokenScopes(requested []string) ([]string, bool) {
+	scopes := slices.Compact(slices.Sorted(slices.Values(requested)))
+	return scopes, auth.ValidScopes(scopes)
+}
+
+func writeInvalidScope(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    fmt.Sprintf("scopes must be some of %s", strings.Join(auth.Scopes, ", ")),
+		Type:       errTypeInvalidScope,
+		StatusCode: http.StatusBadRequest,
+	})
+}
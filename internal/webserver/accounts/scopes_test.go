@@ -0,0 +1,93 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopedAccessTokens(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	for name, signedRefreshTokens := range map[string]bool{"stored refresh tokens": false, "signed refresh tokens": true} {
+		t.Run(name, func(t *testing.T) {
+			db := database.NewMemoryDB()
+			_, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "scoped@test.com", PasswordHash: hashedPassword})
+			require.NoError(t, err)
+
+			h := NewHandler(HandlerDeps{
+				DB:                  db,
+				AuthClient:          authClient,
+				Mailer:              &recordingMailer{},
+				SignedRefreshTokens: signedRefreshTokens,
+			})
+
+			do := func(method, path, accessToken, body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, jsonBody(body))
+				if accessToken != "" {
+					req.Header.Set("Authorization", "Bearer "+accessToken)
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				return w
+			}
+
+			tokens := func(t *testing.T, w *httptest.ResponseRecorder) loginOrRefreshResponse {
+				require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+				var resp loginOrRefreshResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				return resp
+			}
+
+			w := do(http.MethodPost, "/login", "", `{"email":"scoped@test.com","password":"Test123!@#","scopes":["sessions:write","account:read","account:read"]}`)
+			resp := tokens(t, w)
+			assert.Equal(t, []string{auth.ScopeAccountRead, auth.ScopeSessionsWrite}, resp.Scopes)
+
+			claims, err := authClient.ParseAccessToken(resp.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, "account:read sessions:write", claims.Scope)
+
+			// only the endpoints its scopes allow
+			assert.Equal(t, http.StatusOK, do(http.MethodGet, "/me", resp.AccessToken, "").Code)
+			assert.Equal(t, http.StatusForbidden, do(http.MethodPatch, "/me", resp.AccessToken, `{"display_name":"Ada"}`).Code)
+			assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/me/api-keys", resp.AccessToken, "").Code)
+
+			// refreshing keeps the scopes
+			resp = tokens(t, do(http.MethodPost, "/refresh", "", `{"refresh_token":"`+resp.RefreshToken+`"}`))
+			assert.Equal(t, []string{auth.ScopeAccountRead, auth.ScopeSessionsWrite}, resp.Scopes)
+
+			// and can narrow them, but not add any
+			w = do(http.MethodPost, "/refresh", "", `{"refresh_token":"`+resp.RefreshToken+`","scopes":["account:write"]}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), errTypeInvalidScope)
+
+			resp = tokens(t, do(http.MethodPost, "/refresh", "", `{"refresh_token":"`+resp.RefreshToken+`","scopes":["account:read"]}`))
+			assert.Equal(t, []string{auth.ScopeAccountRead}, resp.Scopes)
+			resp = tokens(t, do(http.MethodPost, "/refresh", "", `{"refresh_token":"`+resp.RefreshToken+`"}`))
+			assert.Equal(t, []string{auth.ScopeAccountRead}, resp.Scopes)
+			assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/logout-all", resp.AccessToken, "").Code)
+
+			// unknown scopes
+			w = do(http.MethodPost, "/login", "", `{"email":"scoped@test.com","password":"Test123!@#","scopes":["admin"]}`)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), errTypeInvalidScope)
+
+			// without scopes the tokens aren't restricted
+			resp = tokens(t, do(http.MethodPost, "/login", "", `{"email":"scoped@test.com","password":"Test123!@#"}`))
+			assert.Empty(t, resp.Scopes)
+			assert.Equal(t, http.StatusOK, do(http.MethodPatch, "/me", resp.AccessToken, `{"display_name":"Ada"}`).Code)
+			assert.Equal(t, http.StatusOK, do(http.MethodGet, "/me/api-keys", resp.AccessToken, "").Code)
+		})
+	}
+}
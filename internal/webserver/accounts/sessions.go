@@ -0,0 +1,101 @@
+package accounts
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const errTypeSessionNotFound = "session_not_found"
+
+type session struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+type listSessionsResponse struct {
+	Sessions []session `json:"sessions"`
+}
+
+// listSessions lists the caller's logged in sessions, most recently used first. A session
+// starts at login and lasts through every refresh until it's logged out or expires.
+func (h *handler) listSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	sessions, err := h.db.ListSessions(ctx, claims.AccountID, time.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing sessions", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error listing sessions",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	response := listSessionsResponse{Sessions: make([]session, 0, len(sessions))}
+	for _, s := range sessions {
+		response.Sessions = append(response.Sessions, session{
+			ID:         s.ID,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			IPAddress:  s.IPAddress,
+			UserAgent:  s.UserAgent,
+		})
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, response)
+}
+
+// revokeSession logs one of the caller's sessions out. Access tokens already issued to it
+// keep working until they expire.
+func (h *handler) revokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeSessionNotFound(w, r)
+		return
+	}
+
+	// another account's session isn't found either, so IDs can't be probed
+	if err := h.db.DeleteSession(ctx, claims.AccountID, id); err != nil {
+		if errors.Is(err, database.ErrSessionNotFound) {
+			writeSessionNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error revoking session", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error revoking the session",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	h.recordAuditEvent(ctx, r, claims.AccountID, database.AuditEventSessionRevoked)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
+		"message": "Session revoked",
+	})
+}
+
+func writeSessionNotFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Session not found",
+		Type:       errTypeSessionNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
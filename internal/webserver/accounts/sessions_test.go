@@ -0,0 +1,144 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	hashedPassword, err := auth.HashPassword("Test123!@#")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (*handler, *database.Account) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "sessions@test.com", PasswordHash: hashedPassword})
+		require.NoError(t, err)
+		return withService(&handler{db: db, mailer: &recordingMailer{}, authClient: authClient}), account
+	}
+
+	login := func(h *handler, userAgent string) loginOrRefreshResponse {
+		b, _ := json.Marshal(loginRequest{Email: "sessions@test.com", Password: "Test123!@#"})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(b))
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		h.login(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	refresh := func(h *handler, refreshToken, userAgent string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(refreshRequest{RefreshToken: refreshToken})
+		req := httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewReader(b))
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		h.refresh(w, req)
+		return w
+	}
+
+	listSessions := func(h *handler, accountID string) []session {
+		req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+		req = req.WithContext(middleware.WithClaims(req.Context(), &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		h.listSessions(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp listSessionsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Sessions
+	}
+
+	revokeSession := func(h *handler, accountID, sessionID string) *httptest.ResponseRecorder {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", sessionID)
+		req := httptest.NewRequest(http.MethodDelete, "/sessions/"+sessionID, nil)
+		reqCtx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		req = req.WithContext(middleware.WithClaims(reqCtx, &auth.Claims{AccountID: accountID}))
+		w := httptest.NewRecorder()
+		h.revokeSession(w, req)
+		return w
+	}
+
+	t.Run("logins are listed as sessions and refreshing continues them", func(t *testing.T) {
+		h, account := setup(t)
+
+		laptop := login(h, "laptop")
+		login(h, "phone")
+
+		sessions := listSessions(h, account.ID)
+		require.Len(t, sessions, 2)
+		assert.Equal(t, "phone", sessions[0].UserAgent)
+		assert.Equal(t, "laptop", sessions[1].UserAgent)
+		assert.Equal(t, "192.0.2.1", sessions[1].IPAddress)
+
+		// the session's client is the one that refreshed it last
+		w := refresh(h, laptop.RefreshToken, "laptop, updated")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		sessions = listSessions(h, account.ID)
+		require.Len(t, sessions, 2)
+		assert.Equal(t, "laptop, updated", sessions[0].UserAgent)
+	})
+
+	t.Run("revoking a session logs only it out", func(t *testing.T) {
+		h, account := setup(t)
+
+		laptop := login(h, "laptop")
+		phone := login(h, "phone")
+
+		sessions := listSessions(h, account.ID)
+		require.Len(t, sessions, 2)
+		require.Equal(t, "laptop", sessions[1].UserAgent)
+
+		w := revokeSession(h, account.ID, sessions[1].ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		events, err := h.db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		assert.Equal(t, database.AuditEventSessionRevoked, events[0].EventType)
+
+		assert.Equal(t, http.StatusUnauthorized, refresh(h, laptop.RefreshToken, "laptop").Code)
+		assert.Equal(t, http.StatusOK, refresh(h, phone.RefreshToken, "phone").Code)
+
+		sessions = listSessions(h, account.ID)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "phone", sessions[0].UserAgent)
+	})
+
+	t.Run("unknown and other accounts' sessions aren't found", func(t *testing.T) {
+		h, account := setup(t)
+
+		login(h, "laptop")
+		sessions := listSessions(h, account.ID)
+		require.Len(t, sessions, 1)
+
+		for _, w := range []*httptest.ResponseRecorder{
+			revokeSession(h, account.ID, "not-a-uuid"),
+			revokeSession(h, account.ID, uuid.NewString()),
+			revokeSession(h, uuid.NewString(), sessions[0].ID),
+		} {
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Contains(t, w.Body.String(), errTypeSessionNotFound)
+		}
+
+		assert.Len(t, listSessions(h, account.ID), 1)
+	})
+}
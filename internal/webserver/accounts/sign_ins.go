@@ -0,0 +1,54 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeInvalidSignInToken = "invalid_sign_in_token"
+
+type revokeSignInRequest struct {
+	Token string `json:"token"`
+}
+
+// revokeSignIn logs out the session of a new sign-in email's "this wasn't me" link. The link
+// works once, and the device it was sent about is forgotten so logging in from it is a new
+// sign-in again.
+func (h *handler) revokeSignIn(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody revokeSignInRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Token == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := h.service.RevokeSignIn(ctx, reqBody.Token, h.client(r)); err != nil {
+		if errors.Is(err, accounts.ErrInvalidSignInLink) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "This link is invalid or has already been used",
+				Type:       errTypeInvalidSignInToken,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "error revoking sign-in", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error logging out the session",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, map[string]string{
+		"message": "The session has been logged out. Change your password if you think someone else has it",
+	})
+}
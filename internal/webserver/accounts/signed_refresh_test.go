@@ -0,0 +1,136 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+
+	setup := func(t *testing.T, rotation bool) (*handler, *database.MemoryDB, string) {
+		db := database.NewMemoryDB()
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "signed@test.com"})
+		require.NoError(t, err)
+
+		h := withService(&handler{
+			db:                   db,
+			authClient:           authClient,
+			refreshTokenRotation: rotation,
+			signedRefreshTokens:  true,
+			revocations:          revocation.NewList(lockout.NewMemoryStore(), authClient.RefreshTokenTTL()),
+		})
+		return h, db, account.ID
+	}
+
+	post := func(h *handler, handlerFunc http.HandlerFunc, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"refresh_token":"`+token+`"}`))
+		w := httptest.NewRecorder()
+		handlerFunc(w, req)
+		return w
+	}
+
+	refreshed := func(t *testing.T, w *httptest.ResponseRecorder) loginOrRefreshResponse {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	t.Run("refresh doesn't use the database", func(t *testing.T) {
+		h, db, accountID := setup(t, false)
+
+		initial, err := h.service.IssueTokens(ctx, accountID, accounts.Client{})
+		require.NoError(t, err)
+
+		_, err = db.GetRefreshToken(ctx, initial.RefreshToken)
+		assert.ErrorIs(t, err, database.ErrRefreshTokenNotFound)
+
+		resp := refreshed(t, post(h, h.refresh, initial.RefreshToken))
+		assert.Equal(t, accountID, resp.AccountID)
+
+		claims, err := authClient.ParseSignedRefreshToken(resp.RefreshToken)
+		require.NoError(t, err)
+		assert.Equal(t, 1, claims.Generation)
+
+		// without rotation the old token keeps working
+		refreshed(t, post(h, h.refresh, initial.RefreshToken))
+	})
+
+	t.Run("logout revokes the family", func(t *testing.T) {
+		h, _, accountID := setup(t, false)
+
+		initial, err := h.service.IssueTokens(ctx, accountID, accounts.Client{})
+		require.NoError(t, err)
+		next := refreshed(t, post(h, h.refresh, initial.RefreshToken))
+
+		other, err := h.service.IssueTokens(ctx, accountID, accounts.Client{})
+		require.NoError(t, err)
+
+		w := post(h, h.logout, next.RefreshToken)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, post(h, h.refresh, initial.RefreshToken).Code)
+		assert.Equal(t, http.StatusUnauthorized, post(h, h.refresh, next.RefreshToken).Code)
+		refreshed(t, post(h, h.refresh, other.RefreshToken))
+	})
+
+	t.Run("logout from all devices revokes the account", func(t *testing.T) {
+		h, _, accountID := setup(t, false)
+
+		initial, err := h.service.IssueTokens(ctx, accountID, accounts.Client{})
+		require.NoError(t, err)
+		other, err := h.service.IssueTokens(ctx, accountID, accounts.Client{})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"refresh_token":"`+initial.RefreshToken+`","all_devices":true}`))
+		w := httptest.NewRecorder()
+		h.logout(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, http.StatusUnauthorized, post(h, h.refresh, initial.RefreshToken).Code)
+		assert.Equal(t, http.StatusUnauthorized, post(h, h.refresh, other.RefreshToken).Code)
+	})
+
+	t.Run("reuse after rotation revokes the family", func(t *testing.T) {
+		h, _, accountID := setup(t, true)
+
+		initial, err := h.service.IssueTokens(ctx, accountID, accounts.Client{})
+		require.NoError(t, err)
+		next := refreshed(t, post(h, h.refresh, initial.RefreshToken))
+
+		assert.Equal(t, http.StatusUnauthorized, post(h, h.refresh, initial.RefreshToken).Code)
+		assert.Equal(t, http.StatusUnauthorized, post(h, h.refresh, next.RefreshToken).Code,
+			"the newest token of a leaked family should stop working too")
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		h, db, accountID := setup(t, false)
+
+		// a database refresh token isn't accepted in signed mode
+		require.NoError(t, db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "stored-token", AccountID: accountID}))
+
+		for _, token := range []string{"stored-token", "garbage", ""} {
+			w := post(h, h.refresh, token)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, token)
+			assert.Contains(t, w.Body.String(), errTypeInvalidRefreshToken)
+		}
+
+		w := post(h, h.logout, "garbage")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
@@ -0,0 +1,87 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeInvalidSSOLogin = "invalid_sso_login"
+
+type ssoLoginRequest struct {
+	// Token is the SSO login token the web app got at /sso/callback
+	Token string `json:"token"`
+	// DeviceToken is from an earlier login that trusted the device, it skips MFA
+	DeviceToken string `json:"device_token"`
+}
+
+// loginSSO trades the SSO login token from a sign in at an organization's identity provider
+// for tokens, or an MFA challenge for accounts with MFA enabled. Each SSO login token works once.
+func (h *handler) loginSSO(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody ssoLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	unexpectedErr := httputils.ErrorResponse{
+		Message:    unexpectedLoginError,
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	login, err := h.authClient.ParseSSOLoginToken(reqBody.Token)
+	if err != nil {
+		writeInvalidSSOLogin(w, r)
+		return
+	}
+
+	// used tokens are tracked with the revoked access tokens, their IDs can't collide. Claiming
+	// is atomic, so of two requests racing with the same token only one logs in.
+	claimed, err := h.accessTokenRevocations.Claim(ctx, login.ID, login.ExpiresAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "error using SSO login token", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+	if !claimed {
+		writeInvalidSSOLogin(w, r)
+		return
+	}
+
+	account, err := h.db.GetAccountByID(ctx, login.AccountID)
+	if err != nil {
+		// deleted since signing in at the IdP
+		if errors.Is(err, database.ErrAccountNotFound) {
+			writeInvalidSSOLogin(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account for SSO login", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+	if account.FrozenAt != nil {
+		writeAccountFrozen(w, r)
+		return
+	}
+
+	client := h.client(r)
+	client.DeviceToken = reqBody.DeviceToken
+	h.writeIdentityLogin(w, r, account.ID, client)
+}
+
+func writeInvalidSSOLogin(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "The SSO login is invalid, expired, or already used",
+		Type:       errTypeInvalidSSOLogin,
+		StatusCode: http.StatusUnauthorized,
+	})
+}
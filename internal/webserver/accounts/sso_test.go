@@ -0,0 +1,159 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/service/totp"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginSSO(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "sso@test.com"})
+	require.NoError(t, err)
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret-key", AccessTokenTTLMinutes: 15})
+	h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient, SSOLogin: true})
+
+	login := func(token string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(ssoLoginRequest{Token: token})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/login/sso", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	errorType := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		var resp httputils.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Type
+	}
+
+	t.Run("tokens work once", func(t *testing.T) {
+		token, err := authClient.NewSSOLoginToken(account.ID)
+		require.NoError(t, err)
+
+		w := login(token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp loginOrRefreshResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, account.ID, resp.AccountID)
+		assert.NotEmpty(t, resp.AccessToken)
+		assert.NotEmpty(t, resp.RefreshToken)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, database.AuditEventLogin, events[0].EventType)
+
+		w = login(token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, errTypeInvalidSSOLogin, errorType(t, w))
+	})
+
+	t.Run("concurrent logins get one session", func(t *testing.T) {
+		h := NewHandler(HandlerDeps{
+			DB:                     db,
+			AuthClient:             authClient,
+			SSOLogin:               true,
+			AccessTokenRevocations: revocation.NewAccessTokens(slowTokenStore{revocation.NewMemoryTokenStore()}),
+		})
+		token, err := authClient.NewSSOLoginToken(account.ID)
+		require.NoError(t, err)
+
+		const attempts = 10
+		codes := make(chan int, attempts)
+		var wg sync.WaitGroup
+		for range attempts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				body, _ := json.Marshal(ssoLoginRequest{Token: token})
+				req := httptest.NewRequest(http.MethodPost, "/login/sso", bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				codes <- w.Code
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		logins := 0
+		for code := range codes {
+			if code == http.StatusOK {
+				logins++
+			} else {
+				assert.Equal(t, http.StatusUnauthorized, code)
+			}
+		}
+		assert.Equal(t, 1, logins)
+	})
+
+	t.Run("MFA still has to be completed", func(t *testing.T) {
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "sso-mfa@test.com"})
+		require.NoError(t, err)
+		secret, err := totp.GenerateSecret()
+		require.NoError(t, err)
+		require.NoError(t, db.SetMFASecret(ctx, account.ID, secret))
+		_, err = db.EnableMFA(ctx, account.ID, totp.Step(time.Now())-1)
+		require.NoError(t, err)
+
+		token, err := authClient.NewSSOLoginToken(account.ID)
+		require.NoError(t, err)
+		w := login(token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp mfaChallengeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.MFARequired)
+		assert.NotEmpty(t, resp.MFAChallenge)
+		assert.Equal(t, []string{"totp"}, resp.MFAMethods)
+	})
+
+	t.Run("other tokens aren't accepted", func(t *testing.T) {
+		accessToken, _, err := authClient.NewAccessToken(auth.Claims{AccountID: account.ID})
+		require.NoError(t, err)
+
+		for _, token := range []string{"", "not-a-token", accessToken} {
+			w := login(token)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, token)
+			assert.Equal(t, errTypeInvalidSSOLogin, errorType(t, w))
+		}
+	})
+
+	t.Run("frozen accounts can't sign in", func(t *testing.T) {
+		_, err := db.FreezeAccount(ctx, account.ID)
+		require.NoError(t, err)
+		t.Cleanup(func() { _, _ = db.UnfreezeAccount(ctx, account.ID, "") })
+
+		token, err := authClient.NewSSOLoginToken(account.ID)
+		require.NoError(t, err)
+		w := login(token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, errTypeAccountFrozen, errorType(t, w))
+	})
+
+	t.Run("off without saml", func(t *testing.T) {
+		h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient})
+		req := httptest.NewRequest(http.MethodPost, "/login/sso", bytes.NewReader([]byte(`{}`)))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
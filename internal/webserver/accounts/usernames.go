@@ -0,0 +1,35 @@
+package accounts
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/service/accounts"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeUsernameTaken = "username_taken"
+
+func writeInvalidUsername(w http.ResponseWriter, r *http.Request, err error) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    invalidUsernameMessage(err),
+		Type:       errTypeValidationError,
+		StatusCode: http.StatusUnprocessableEntity,
+	})
+}
+
+// invalidUsernameMessage explains an accounts.ValidateUsername error to the client
+func invalidUsernameMessage(err error) string {
+	if errors.Is(err, accounts.ErrReservedUsername) {
+		return "This username is reserved"
+	}
+	return "Usernames are 3-30 letters, digits, underscores, dots or hyphens, starting with a letter or digit"
+}
+
+func writeUsernameTaken(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "An account with this username already exists",
+		Type:       errTypeUsernameTaken,
+		StatusCode: http.StatusConflict,
+	})
+}
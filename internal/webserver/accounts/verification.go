@@ -0,0 +1,174 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const (
+	errTypeEmailNotVerified         = "email_not_verified"
+	errTypeInvalidVerificationToken = "invalid_verification_token"
+
+	unexpectedVerificationError = "There was an unexpected error verifying the email"
+)
+
+type verifyRequest struct {
+	Token string `json:"token"`
+}
+
+type verifyResponse struct {
+	Message    string    `json:"message"`
+	AccountID  string    `json:"account_id"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+// verify confirms the email of an emailed verification link. Verifying an already verified
+// account is fine, so following the link twice doesn't show an error.
+func (h *handler) verify(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody verifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Token == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	unexpectedErr := httputils.ErrorResponse{
+		Message:    unexpectedVerificationError,
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	verification, err := h.db.GetEmailVerification(ctx, auth.HashOpaqueToken(reqBody.Token))
+	if err != nil {
+		if errors.Is(err, database.ErrEmailVerificationNotFound) {
+			writeInvalidVerificationToken(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error getting email verification", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if time.Now().After(verification.ExpiresAt) {
+		writeInvalidVerificationToken(w, r)
+		return
+	}
+
+	account, err := h.db.GetAccountByID(ctx, verification.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting account to verify", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	// the link proves the old address, not the one the account has now
+	if !strings.EqualFold(account.Email, verification.Email) {
+		writeInvalidVerificationToken(w, r)
+		return
+	}
+
+	wasVerified := account.VerifiedAt != nil
+
+	account, err = h.db.VerifyAccount(ctx, account.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error verifying account", "error", err)
+		httputils.WriteErrorResponse(w, r, unexpectedErr)
+		return
+	}
+
+	if !wasVerified {
+		h.recordAuditEvent(ctx, r, account.ID, database.AuditEventEmailVerified)
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, verifyResponse{
+		Message:    "Your email has been verified",
+		AccountID:  account.ID,
+		VerifiedAt: *account.VerifiedAt,
+	})
+}
+
+type resendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+// resendVerification emails a new verification link. The response is the same whether or not
+// the account exists or is already verified.
+func (h *handler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody resendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Email == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := h.resendVerificationLink(ctx, reqBody.Email); err != nil {
+		slog.ErrorContext(ctx, "error resending verification link", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error sending the verification link",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusAccepted, map[string]string{
+		"message": "If an unverified account exists for this email, we've sent it a new link",
+	})
+}
+
+func (h *handler) resendVerificationLink(ctx context.Context, email string) error {
+	// the link is mailed to an address anyone can type in, so don't let it be flooded
+	throttleKey := "verify-resend:" + strings.ToLower(strings.TrimSpace(email))
+	if h.checkLockout(ctx, throttleKey) > 0 {
+		return nil
+	}
+	if h.lockout != nil {
+		h.lockout.RecordFailure(ctx, throttleKey)
+	}
+
+	account, err := h.db.GetAccount(ctx, email)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			return nil
+		}
+		return fmt.Errorf("error getting account: %w", err)
+	}
+
+	if account.VerifiedAt != nil {
+		return nil
+	}
+
+	return h.service.SendVerificationLink(ctx, account)
+}
+
+func writeInvalidVerificationToken(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "This link is invalid or has expired",
+		Type:       errTypeInvalidVerificationToken,
+		StatusCode: http.StatusBadRequest,
+	})
+}
+
+func writeEmailNotVerified(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Verify your email before logging in. Follow the link we emailed you",
+		Type:       errTypeEmailNotVerified,
+		StatusCode: http.StatusForbidden,
+	})
+}
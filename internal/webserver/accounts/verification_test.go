@@ -0,0 +1,184 @@
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailVerification(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+
+	setup := func(t *testing.T) (*handler, *database.MemoryDB, *recordingMailer) {
+		db := database.NewMemoryDB()
+		mail := &recordingMailer{}
+		h := withService(&handler{
+			db:                       db,
+			mailer:                   mail,
+			authClient:               authClient,
+			appURL:                   "https://app.example.com",
+			requireEmailVerification: true,
+		})
+		return h, db, mail
+	}
+
+	post := func(handle http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		handle(w, req)
+		return w
+	}
+
+	register := func(h *handler) string {
+		w := post(h.register, registerRequest{Email: "verify@test.com", Password: "Test123!@#"})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp registerResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.AccountID
+	}
+
+	login := func(h *handler) *httptest.ResponseRecorder {
+		return post(h.login, loginRequest{Email: "verify@test.com", Password: "Test123!@#"})
+	}
+
+	t.Run("register, verify, and log in", func(t *testing.T) {
+		h, db, mail := setup(t)
+		accountID := register(h)
+
+		w := login(h)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeEmailNotVerified)
+
+		token := mail.links(t, "verify@test.com")["/verify"]
+		require.NotEmpty(t, token)
+
+		w = post(h.verify, verifyRequest{Token: token})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp verifyResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, accountID, resp.AccountID)
+
+		assert.Equal(t, http.StatusOK, login(h).Code)
+
+		// the link only works once
+		w = post(h.verify, verifyRequest{Token: token})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidVerificationToken)
+
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: accountID, Keyset: database.Keyset{Limit: 10}})
+		require.NoError(t, err)
+		var types []string
+		for _, e := range events {
+			types = append(types, e.EventType)
+		}
+		assert.Contains(t, types, database.AuditEventEmailVerified)
+	})
+
+	t.Run("wrong password doesn't reveal the account is unverified", func(t *testing.T) {
+		h, _, _ := setup(t)
+		register(h)
+
+		w := post(h.login, loginRequest{Email: "verify@test.com", Password: "Wrong123!@#"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("logins are allowed when verification isn't required", func(t *testing.T) {
+		h, _, _ := setup(t)
+		h.requireEmailVerification = false
+		h = withService(h)
+		register(h)
+
+		assert.Equal(t, http.StatusOK, login(h).Code)
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		h, db, _ := setup(t)
+		accountID := register(h)
+
+		token, err := auth.NewOpaqueToken()
+		require.NoError(t, err)
+		require.NoError(t, db.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+			TokenHash: auth.HashOpaqueToken(token),
+			AccountID: accountID,
+			Email:     "verify@test.com",
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}))
+
+		w := post(h.verify, verifyRequest{Token: token})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("link for an email the account no longer has", func(t *testing.T) {
+		h, db, _ := setup(t)
+		accountID := register(h)
+
+		token, err := auth.NewOpaqueToken()
+		require.NoError(t, err)
+		require.NoError(t, db.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+			TokenHash: auth.HashOpaqueToken(token),
+			AccountID: accountID,
+			Email:     "old@test.com",
+			ExpiresAt: time.Now().Add(time.Hour),
+		}))
+
+		w := post(h.verify, verifyRequest{Token: token})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, http.StatusForbidden, login(h).Code)
+	})
+
+	t.Run("resend", func(t *testing.T) {
+		h, _, mail := setup(t)
+		register(h)
+		first := mail.links(t, "verify@test.com")["/verify"]
+
+		w := post(h.resendVerification, resendVerificationRequest{Email: "verify@test.com"})
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		second := mail.links(t, "verify@test.com")["/verify"]
+		assert.NotEqual(t, first, second)
+
+		// unknown emails get the same answer
+		sent := len(mail.sent)
+		w = post(h.resendVerification, resendVerificationRequest{Email: "nobody@test.com"})
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Len(t, mail.sent, sent)
+
+		// either link verifies the account, and verified accounts aren't sent more
+		w = post(h.verify, verifyRequest{Token: first})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = post(h.resendVerification, resendVerificationRequest{Email: "verify@test.com"})
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Len(t, mail.sent, sent)
+	})
+
+	t.Run("resend is throttled", func(t *testing.T) {
+		h, _, mail := setup(t)
+		h.lockout = lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{
+			MaxAttempts:     1,
+			Window:          time.Hour,
+			LockoutDuration: time.Hour,
+		})
+		h = withService(h)
+		register(h)
+		sent := len(mail.sent)
+
+		for range 3 {
+			w := post(h.resendVerification, resendVerificationRequest{Email: "verify@test.com"})
+			assert.Equal(t, http.StatusAccepted, w.Code)
+		}
+		assert.Len(t, mail.sent, sent+1)
+	})
+}
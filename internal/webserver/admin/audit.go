@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/webserver/auditexport"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const errTypeValidationError = "validation_error"
+
+// auditPageLimits are how many events a page of the audit log has
+var auditPageLimits = httputils.PageLimits{Default: 50, Max: 200}
+
+// event types are snake_case constants, see the database.AuditEvent* types
+var eventTypePattern = regexp.MustCompile(`^[a-z_]{1,64}$`)
+
+type auditEvent struct {
+	ID        string    `json:"id"`
+	AccountID string    `json:"account_id,omitempty"`
+	Type      string    `json:"type"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type auditResponse struct {
+	Events     []auditEvent `json:"events"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// listAuditEvents pages through every account's audit events newest first, optionally only
+// one account's or one type's
+func (h *handler) listAuditEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	accountID := r.URL.Query().Get("account_id")
+	if accountID != "" {
+		if _, err := uuid.Parse(accountID); err != nil {
+			writeValidationError(w, r, "account_id must be a UUID")
+			return
+		}
+	}
+
+	eventType := r.URL.Query().Get("type")
+	if eventType != "" && !eventTypePattern.MatchString(eventType) {
+		writeValidationError(w, r, "type is not an event type")
+		return
+	}
+
+	page, err := httputils.ParsePageRequest(r, auditPageLimits)
+	if err != nil {
+		writeValidationError(w, r, err.Error())
+		return
+	}
+
+	events, err := h.db.ListAuditEvents(ctx, database.ListAuditEventsParams{
+		AccountID: accountID,
+		EventType: eventType,
+		Keyset: database.Keyset{
+			BeforeCreatedAt: page.After.CreatedAt,
+			BeforeID:        page.After.ID,
+			// fetch one extra to know if there's another page
+			Limit: page.Limit + 1,
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing audit events", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error listing audit events",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	resp := auditResponse{Events: []auditEvent{}}
+	events, resp.NextCursor = httputils.Paginate(events, page.Limit, func(e database.AuditEvent) httputils.Cursor {
+		return httputils.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+
+	for _, e := range events {
+		resp.Events = append(resp.Events, auditEvent{
+			ID:        e.ID,
+			AccountID: e.AccountID,
+			Type:      e.EventType,
+			ActorID:   e.ActorID,
+			IPAddress: e.IPAddress,
+			UserAgent: e.UserAgent,
+			RequestID: e.RequestID,
+			Details:   e.Details,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, resp)
+}
+
+// exportAccountActivity streams an account's full audit history, for answering compliance
+// requests about it, see auditexport.Stream
+func (h *handler) exportAccountActivity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeAccountNotFound(w, r)
+		return
+	}
+
+	if _, err := h.db.GetAccountByID(ctx, id); err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			writeAccountNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error getting the account",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	auditexport.Stream(w, r, h.db, id)
+}
+
+func writeValidationError(w http.ResponseWriter, r *http.Request, message string) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    message,
+		Type:       errTypeValidationError,
+		StatusCode: http.StatusUnprocessableEntity,
+	})
+}
@@ -0,0 +1,147 @@
+package admin
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListAuditEvents(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	db := database.NewMemoryDB()
+	h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient})
+
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "audited@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	for _, eventType := range []string{database.AuditEventAccountCreated, database.AuditEventLoginFailed, database.AuditEventLogin} {
+		require.NoError(t, db.CreateAuditEvent(ctx, database.CreateAuditEventParams{AccountID: account.ID, EventType: eventType}))
+	}
+	// a failed login for an email without an account
+	require.NoError(t, db.CreateAuditEvent(ctx, database.CreateAuditEventParams{EventType: database.AuditEventLoginFailed}))
+
+	token := func(roles ...string) string {
+		accessToken, _, err := authClient.NewAccessToken(auth.Claims{AccountID: account.ID, Roles: roles})
+		require.NoError(t, err)
+		return accessToken
+	}
+	admin := token(database.RoleAdmin)
+
+	list := func(accessToken, query string) (*httptest.ResponseRecorder, auditResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/audit?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		var resp auditResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	t.Run("every account's events", func(t *testing.T) {
+		w, resp := list(admin, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Len(t, resp.Events, 4)
+		assert.Empty(t, resp.NextCursor)
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		_, resp := list(admin, "type="+database.AuditEventLoginFailed)
+		assert.Len(t, resp.Events, 2)
+
+		_, resp = list(admin, "type="+database.AuditEventLoginFailed+"&account_id="+account.ID)
+		require.Len(t, resp.Events, 1)
+		assert.Equal(t, account.ID, resp.Events[0].AccountID)
+	})
+
+	t.Run("paged", func(t *testing.T) {
+		_, first := list(admin, "limit=3")
+		require.Len(t, first.Events, 3)
+		require.NotEmpty(t, first.NextCursor)
+
+		_, second := list(admin, "limit=3&cursor="+first.NextCursor)
+		require.Len(t, second.Events, 1)
+		assert.Empty(t, second.NextCursor)
+	})
+
+	t.Run("invalid filters", func(t *testing.T) {
+		for _, query := range []string{"account_id=not-a-uuid", "type=Login!", "limit=0", "cursor=garbage"} {
+			w, _ := list(admin, query)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, query)
+		}
+	})
+
+	t.Run("admins only", func(t *testing.T) {
+		w, _ := list(token(), "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w, _ = list("", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestExportAccountActivity(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	db := database.NewMemoryDB()
+	h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient})
+
+	operator, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "operator@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "customer@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	for _, eventType := range []string{database.AuditEventAccountCreated, database.AuditEventLogin} {
+		require.NoError(t, db.CreateAuditEvent(ctx, database.CreateAuditEventParams{AccountID: account.ID, EventType: eventType}))
+	}
+	// the operator's own events aren't in the export
+	require.NoError(t, db.CreateAuditEvent(ctx, database.CreateAuditEventParams{AccountID: operator.ID, EventType: database.AuditEventLogin}))
+
+	token := func(roles ...string) string {
+		accessToken, _, err := authClient.NewAccessToken(auth.Claims{AccountID: operator.ID, Roles: roles})
+		require.NoError(t, err)
+		return accessToken
+	}
+	admin := token(database.RoleAdmin)
+
+	export := func(accessToken, id, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/accounts/"+id+"/activity/export"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := export(admin, account.ID, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3, "the header and the account's two events")
+	assert.Equal(t, database.AuditEventLogin, records[1][1])
+	assert.Equal(t, database.AuditEventAccountCreated, records[2][1])
+
+	w = export(admin, account.ID, "?format=xml")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = export(admin, uuid.NewString(), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = export(admin, "not-a-uuid", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// only admins
+	w = export(token(), account.ID, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,77 @@
+// Package admin serves the /v1/admin routes for accounts with the admin role
+package admin
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// Repository defines the DB methods needed by admin handlers
+type Repository interface {
+	ListAuditEvents(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error)
+	CreateAuditEvent(ctx context.Context, params database.CreateAuditEventParams) error
+	GetAccountByID(ctx context.Context, id string) (*database.Account, error)
+	ListAccounts(ctx context.Context, params database.ListAccountsParams) ([]database.Account, error)
+	AddAccountTags(ctx context.Context, id string, tags []string) (*database.Account, error)
+	RemoveAccountTag(ctx context.Context, id, tag string) (*database.Account, error)
+	UpdateAccountMetadata(ctx context.Context, id string, params database.UpdateAccountMetadataParams) (*database.Account, error)
+}
+
+type handler struct {
+	db       Repository
+	auditLog audit.Recorder
+	logLevel *slog.LevelVar
+
+	chi.Router
+}
+
+type HandlerDeps struct {
+	DB         Repository
+	AuthClient *auth.Client
+	// AccessTokenRevocations are the access tokens that are rejected before they expire.
+	// Optional.
+	AccessTokenRevocations *revocation.AccessTokens
+	// AuditLog records changes admins make. Defaults to writing them to DB before responding.
+	AuditLog audit.Recorder
+	// LogLevel is the level the service logs at. Optional, /loglevel is only served when it's
+	// set.
+	LogLevel *slog.LevelVar
+}
+
+func NewHandler(deps HandlerDeps) http.Handler {
+	mux := chi.NewMux()
+
+	auditLog := deps.AuditLog
+	if auditLog == nil {
+		auditLog = audit.Sync(deps.DB.CreateAuditEvent)
+	}
+
+	h := handler{db: deps.DB, auditLog: auditLog, logLevel: deps.LogLevel}
+
+	mux.Use(middleware.RequireAuth(deps.AuthClient, deps.AccessTokenRevocations))
+	mux.Use(middleware.RequireRole(database.RoleAdmin))
+
+	mux.Get("/audit", h.listAuditEvents)
+	mux.Get("/accounts", h.listAccounts)
+	mux.Post("/accounts/{id}/tags", h.addAccountTags)
+	mux.Delete("/accounts/{id}/tags/{tag}", h.removeAccountTag)
+	mux.Get("/accounts/{id}/activity/export", h.exportAccountActivity)
+	mux.Get("/accounts/{id}/metadata", h.accountMetadata)
+	mux.Patch("/accounts/{id}/metadata", h.updateAccountMetadata)
+	if h.logLevel != nil {
+		mux.Get("/loglevel", h.getLogLevel)
+		mux.Put("/loglevel", h.setLogLevel)
+	}
+
+	h.Router = mux
+
+	return h
+}
@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	chimiddleware "github.com/go-chi/chi/middleware"
+)
+
+// logLevels are the levels the log level can be set to, the same ones LOG_LEVEL takes
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+type logLevelResponse struct {
+	Level string `json:"level"`
+}
+
+// getLogLevel returns the level the service is logging at
+func (h *handler) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteJSONResponse(w, r, http.StatusOK, logLevelResponse{Level: levelName(h.logLevel.Level())})
+}
+
+// setLogLevel changes the level the service logs at until it restarts, or LOG_LEVEL is changed
+// and the config reloaded
+func (h *handler) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody logLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	level, ok := logLevels[strings.ToLower(reqBody.Level)]
+	if !ok {
+		writeValidationError(w, r, "level must be one of debug, info, warn, or error")
+		return
+	}
+
+	old := h.logLevel.Level()
+	h.logLevel.Set(level)
+	if level != old {
+		claims, _ := middleware.ClaimsFromContext(ctx)
+		h.auditLog.Record(ctx, database.CreateAuditEventParams{
+			EventType: database.AuditEventLogLevelChanged,
+			ActorID:   claims.AccountID,
+			UserAgent: r.UserAgent(),
+			RequestID: chimiddleware.GetReqID(ctx),
+			Details:   levelName(old) + " -> " + levelName(level),
+		})
+		slog.InfoContext(ctx, "changed log level", "from", levelName(old), "to", levelName(level))
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, logLevelResponse{Level: levelName(level)})
+}
+
+// levelName writes a level the way LOG_LEVEL is written, e.g. "debug"
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevel(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	db := database.NewMemoryDB()
+	logLevel := new(slog.LevelVar)
+	h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient, LogLevel: logLevel})
+
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "operator@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	token := func(roles ...string) string {
+		accessToken, _, err := authClient.NewAccessToken(auth.Claims{AccountID: account.ID, Roles: roles})
+		require.NoError(t, err)
+		return accessToken
+	}
+	admin := token(database.RoleAdmin)
+
+	do := func(accessToken, method, body string) (*httptest.ResponseRecorder, logLevelResponse) {
+		req := httptest.NewRequest(method, "/loglevel", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		var resp logLevelResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	w, resp := do(admin, http.MethodGet, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "info", resp.Level)
+
+	w, resp = do(admin, http.MethodPut, `{"level":"DEBUG"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "debug", resp.Level)
+	assert.Equal(t, slog.LevelDebug, logLevel.Level())
+
+	events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{EventType: database.AuditEventLogLevelChanged})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, account.ID, events[0].ActorID)
+	assert.Equal(t, "info -> debug", events[0].Details)
+
+	t.Run("setting the same level isn't audited", func(t *testing.T) {
+		w, _ := do(admin, http.MethodPut, `{"level":"debug"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{EventType: database.AuditEventLogLevelChanged})
+		require.NoError(t, err)
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("invalid levels", func(t *testing.T) {
+		for _, body := range []string{`{"level":"trace"}`, `{}`} {
+			w, _ := do(admin, http.MethodPut, body)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+		}
+		w, _ := do(admin, http.MethodPut, `not json`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, slog.LevelDebug, logLevel.Level())
+	})
+
+	t.Run("admins only", func(t *testing.T) {
+		w, _ := do(token(), http.MethodPut, `{"level":"error"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, slog.LevelDebug, logLevel.Level())
+	})
+
+	t.Run("not served without a level", func(t *testing.T) {
+		h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient})
+		req := httptest.NewRequest(http.MethodGet, "/loglevel", nil)
+		req.Header.Set("Authorization", "Bearer "+admin)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/metadata"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const errTypeAccountNotFound = "account_not_found"
+
+// updateMetadataRequest changes the keys in either object, keys set to null are removed. Keys
+// not in the request are left as they are.
+type updateMetadataRequest struct {
+	UserMetadata metadata.Patch `json:"user_metadata"`
+	AppMetadata  metadata.Patch `json:"app_metadata"`
+}
+
+type metadataResponse struct {
+	UserMetadata database.Metadata `json:"user_metadata"`
+	AppMetadata  database.Metadata `json:"app_metadata"`
+}
+
+// accountMetadata returns an account's user and app metadata
+func (h *handler) accountMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeAccountNotFound(w, r)
+		return
+	}
+
+	account, err := h.db.GetAccountByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			writeAccountNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error getting the account",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, newMetadataResponse(account))
+}
+
+// updateAccountMetadata changes an account's user and app metadata, recording the admin as the
+// actor
+func (h *handler) updateAccountMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeAccountNotFound(w, r)
+		return
+	}
+
+	var reqBody updateMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if len(reqBody.UserMetadata) == 0 && len(reqBody.AppMetadata) == 0 {
+		writeValidationError(w, r, "The request needs at least one user_metadata or app_metadata key to change")
+		return
+	}
+
+	account, err := metadata.Apply(ctx, h.db, id, metadata.Update{User: reqBody.UserMetadata, App: reqBody.AppMetadata})
+	if err != nil {
+		switch {
+		case errors.Is(err, metadata.ErrInvalidKey):
+			writeValidationError(w, r, "Metadata keys must be 1-64 letters, digits, hyphens or underscores")
+		case errors.Is(err, metadata.ErrTooLarge):
+			writeValidationError(w, r, fmt.Sprintf("Metadata can be at most %d bytes", metadata.MaxBytes))
+		case errors.Is(err, database.ErrAccountNotFound):
+			writeAccountNotFound(w, r)
+		default:
+			slog.ErrorContext(ctx, "error updating account metadata", "error", err)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "There was an unexpected error updating the account",
+				StatusCode: http.StatusInternalServerError,
+			})
+		}
+		return
+	}
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+	h.auditLog.Record(ctx, database.CreateAuditEventParams{
+		AccountID: account.ID,
+		EventType: database.AuditEventMetadataChanged,
+		ActorID:   claims.AccountID,
+		UserAgent: r.UserAgent(),
+		RequestID: chimiddleware.GetReqID(ctx),
+	})
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, newMetadataResponse(account))
+}
+
+func newMetadataResponse(account *database.Account) metadataResponse {
+	resp := metadataResponse{UserMetadata: account.UserMetadata, AppMetadata: account.AppMetadata}
+	if resp.UserMetadata == nil {
+		resp.UserMetadata = database.Metadata{}
+	}
+	if resp.AppMetadata == nil {
+		resp.AppMetadata = database.Metadata{}
+	}
+	return resp
+}
+
+func writeAccountNotFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "The account was not found",
+		Type:       errTypeAccountNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	db := database.NewMemoryDB()
+	h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient})
+
+	operator, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "operator@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "customer@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	token := func(roles ...string) string {
+		accessToken, _, err := authClient.NewAccessToken(auth.Claims{AccountID: operator.ID, Roles: roles})
+		require.NoError(t, err)
+		return accessToken
+	}
+	admin := token(database.RoleAdmin)
+
+	do := func(accessToken, method, path, body string) (*httptest.ResponseRecorder, metadataResponse) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		var resp metadataResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+	path := "/accounts/" + account.ID + "/metadata"
+
+	w, resp := do(admin, http.MethodPatch, path, `{"app_metadata":{"plan":"pro"},"user_metadata":{"theme":"dark"}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, database.Metadata{"plan": json.RawMessage(`"pro"`)}, resp.AppMetadata)
+	assert.Equal(t, database.Metadata{"theme": json.RawMessage(`"dark"`)}, resp.UserMetadata)
+
+	w, resp = do(admin, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, database.Metadata{"plan": json.RawMessage(`"pro"`)}, resp.AppMetadata)
+
+	events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, EventType: database.AuditEventMetadataChanged})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, operator.ID, events[0].ActorID)
+
+	w, _ = do(admin, http.MethodPatch, path, `{"app_metadata":{"billing plan":"pro"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w, _ = do(admin, http.MethodPatch, path, `{}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w, _ = do(admin, http.MethodPatch, "/accounts/"+uuid.NewString()+"/metadata", `{"app_metadata":{"plan":"pro"}}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// only admins
+	w, _ = do(token(), http.MethodPatch, path, `{"app_metadata":{"plan":"enterprise"}}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
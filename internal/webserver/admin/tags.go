@@ -0,0 +1,245 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// MaxAccountTags caps how many tags a single account can have
+const MaxAccountTags = 20
+
+// listPageLimits are how many accounts a page of the account listing has
+var listPageLimits = httputils.PageLimits{Default: 50, Max: 200}
+
+// tags are short lowercase slugs so they're safe to put in URLs and compare exactly
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+type addTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type accountResponse struct {
+	ID              string     `json:"id"`
+	Email           string     `json:"email"`
+	PreferredLocale string     `json:"preferred_locale"`
+	Tags            []string   `json:"tags"`
+	FrozenAt        *time.Time `json:"frozen_at,omitempty"`
+	VerifiedAt      *time.Time `json:"verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+func newAccountResponse(a database.Account) accountResponse {
+	tags := []string(a.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+	return accountResponse{
+		ID:              a.ID,
+		Email:           a.Email,
+		PreferredLocale: a.PreferredLocale,
+		Tags:            tags,
+		FrozenAt:        a.FrozenAt,
+		VerifiedAt:      a.VerifiedAt,
+		CreatedAt:       a.CreatedAt,
+	}
+}
+
+type listAccountsResponse struct {
+	Accounts   []accountResponse `json:"accounts"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// listAccounts pages through accounts newest first, optionally only those with a tag
+func (h *handler) listAccounts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tag := r.URL.Query().Get("tag")
+	if tag != "" && !tagPattern.MatchString(tag) {
+		writeInvalidTags(w, r)
+		return
+	}
+
+	page, err := httputils.ParsePageRequest(r, listPageLimits)
+	if err != nil {
+		writeValidationError(w, r, err.Error())
+		return
+	}
+
+	params := database.ListAccountsParams{
+		Tag: tag,
+		Keyset: database.Keyset{
+			BeforeCreatedAt: page.After.CreatedAt,
+			BeforeID:        page.After.ID,
+			// fetch one extra to know if there's another page
+			Limit: page.Limit + 1,
+		},
+	}
+
+	accounts, err := h.db.ListAccounts(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing accounts", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error listing accounts",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	resp := listAccountsResponse{Accounts: []accountResponse{}}
+	accounts, resp.NextCursor = httputils.Paginate(accounts, page.Limit, func(a database.Account) httputils.Cursor {
+		return httputils.Cursor{CreatedAt: a.CreatedAt, ID: a.ID}
+	})
+
+	for _, a := range accounts {
+		resp.Accounts = append(resp.Accounts, newAccountResponse(a))
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, resp)
+}
+
+// addAccountTags adds tags to an account and returns the updated profile. Adding a tag the
+// account already has is a no-op.
+func (h *handler) addAccountTags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeAccountNotFound(w, r)
+		return
+	}
+
+	var reqBody addTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	if len(reqBody.Tags) == 0 {
+		writeInvalidTags(w, r)
+		return
+	}
+	for _, tag := range reqBody.Tags {
+		if !tagPattern.MatchString(tag) {
+			writeInvalidTags(w, r)
+			return
+		}
+	}
+	var tags []string
+	for _, tag := range reqBody.Tags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	account, err := h.db.GetAccountByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			writeAccountNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account", "error", err)
+		writeUnexpectedTagsError(w, r)
+		return
+	}
+
+	// the limit is checked up front rather than in the query, so two concurrent requests can
+	// overshoot it slightly. That's fine for admin-set labels.
+	total := len(account.Tags)
+	for _, tag := range tags {
+		if !slices.Contains(account.Tags, tag) {
+			total++
+		}
+	}
+	if total > MaxAccountTags {
+		writeValidationError(w, r, fmt.Sprintf("An account can have at most %d tags", MaxAccountTags))
+		return
+	}
+
+	account, err = h.db.AddAccountTags(ctx, id, tags)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			writeAccountNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error adding account tags", "error", err)
+		writeUnexpectedTagsError(w, r)
+		return
+	}
+
+	h.recordTagsChanged(r, account.ID)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, newAccountResponse(*account))
+}
+
+// removeAccountTag removes a tag from an account and returns the updated profile. Removing a
+// tag the account doesn't have is a no-op.
+func (h *handler) removeAccountTag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeAccountNotFound(w, r)
+		return
+	}
+
+	tag := chi.URLParam(r, "tag")
+	if !tagPattern.MatchString(tag) {
+		writeInvalidTags(w, r)
+		return
+	}
+
+	account, err := h.db.RemoveAccountTag(ctx, id, tag)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			writeAccountNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error removing account tag", "error", err)
+		writeUnexpectedTagsError(w, r)
+		return
+	}
+
+	h.recordTagsChanged(r, account.ID)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, newAccountResponse(*account))
+}
+
+// recordTagsChanged records a tag change with the admin who made it as the actor
+func (h *handler) recordTagsChanged(r *http.Request, accountID string) {
+	ctx := r.Context()
+	claims, _ := middleware.ClaimsFromContext(ctx)
+	h.auditLog.Record(ctx, database.CreateAuditEventParams{
+		AccountID: accountID,
+		EventType: database.AuditEventTagsChanged,
+		ActorID:   claims.AccountID,
+		UserAgent: r.UserAgent(),
+		RequestID: chimiddleware.GetReqID(ctx),
+	})
+}
+
+func writeInvalidTags(w http.ResponseWriter, r *http.Request) {
+	writeValidationError(w, r, "Tags must be 1-50 lowercase letters, digits, hyphens or underscores")
+}
+
+func writeUnexpectedTagsError(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "There was an unexpected error updating the account's tags",
+		StatusCode: http.StatusInternalServerError,
+	})
+}
@@ -0,0 +1,223 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountTags(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	db := database.NewMemoryDB()
+	h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient})
+
+	operator, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "operator@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "tags@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	token := func(roles ...string) string {
+		accessToken, _, err := authClient.NewAccessToken(auth.Claims{AccountID: operator.ID, Roles: roles})
+		require.NoError(t, err)
+		return accessToken
+	}
+	admin := token(database.RoleAdmin)
+
+	tooMany := make([]string, MaxAccountTags+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag-%d", i)
+	}
+	tooManyBody, _ := json.Marshal(addTagsRequest{Tags: tooMany})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedTags   []string
+	}{
+		{
+			name:           "add tags",
+			method:         http.MethodPost,
+			path:           "/accounts/" + account.ID + "/tags",
+			body:           `{"tags":["enterprise","beta","beta"]}`,
+			expectedStatus: http.StatusOK,
+			expectedTags:   []string{"beta", "enterprise"},
+		},
+		{
+			name:           "adding an existing tag is a no-op",
+			method:         http.MethodPost,
+			path:           "/accounts/" + account.ID + "/tags",
+			body:           `{"tags":["beta"]}`,
+			expectedStatus: http.StatusOK,
+			expectedTags:   []string{"beta", "enterprise"},
+		},
+		{
+			name:           "invalid tag",
+			method:         http.MethodPost,
+			path:           "/accounts/" + account.ID + "/tags",
+			body:           `{"tags":["Not A Slug"]}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "no tags",
+			method:         http.MethodPost,
+			path:           "/accounts/" + account.ID + "/tags",
+			body:           `{"tags":[]}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "too many tags",
+			method:         http.MethodPost,
+			path:           "/accounts/" + account.ID + "/tags",
+			body:           string(tooManyBody),
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "add to missing account",
+			method:         http.MethodPost,
+			path:           "/accounts/" + uuid.NewString() + "/tags",
+			body:           `{"tags":["beta"]}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "add with malformed account ID",
+			method:         http.MethodPost,
+			path:           "/accounts/not-a-uuid/tags",
+			body:           `{"tags":["beta"]}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "remove tag",
+			method:         http.MethodDelete,
+			path:           "/accounts/" + account.ID + "/tags/enterprise",
+			expectedStatus: http.StatusOK,
+			expectedTags:   []string{"beta"},
+		},
+		{
+			name:           "removing a missing tag is a no-op",
+			method:         http.MethodDelete,
+			path:           "/accounts/" + account.ID + "/tags/enterprise",
+			expectedStatus: http.StatusOK,
+			expectedTags:   []string{"beta"},
+		},
+		{
+			name:           "remove from missing account",
+			method:         http.MethodDelete,
+			path:           "/accounts/" + uuid.NewString() + "/tags/beta",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+admin)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+
+			if tt.expectedTags != nil {
+				var resp accountResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, account.ID, resp.ID)
+				assert.Equal(t, tt.expectedTags, resp.Tags)
+			}
+		})
+	}
+
+	t.Run("changes are recorded with the admin as the actor", func(t *testing.T) {
+		events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, EventType: database.AuditEventTagsChanged})
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		assert.Equal(t, operator.ID, events[0].ActorID)
+	})
+
+	t.Run("only admins", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/accounts/"+account.ID+"/tags", strings.NewReader(`{"tags":["beta"]}`))
+		req.Header.Set("Authorization", "Bearer "+token())
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestListAccounts(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	db := database.NewMemoryDB()
+	var betaIDs []string
+	for i := range 5 {
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: fmt.Sprintf("list%d@test.com", i)})
+		require.NoError(t, err)
+		if i%2 == 0 {
+			_, err = db.AddAccountTags(ctx, account.ID, []string{"beta"})
+			require.NoError(t, err)
+			betaIDs = append(betaIDs, account.ID)
+		}
+	}
+
+	h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient})
+	admin, _, err := authClient.NewAccessToken(auth.Claims{AccountID: betaIDs[0], Roles: []string{database.RoleAdmin}})
+	require.NoError(t, err)
+
+	list := func(t *testing.T, query string) (int, listAccountsResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/accounts?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+admin)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		var resp listAccountsResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w.Code, resp
+	}
+
+	t.Run("all accounts", func(t *testing.T) {
+		status, resp := list(t, "")
+		require.Equal(t, http.StatusOK, status)
+		assert.Len(t, resp.Accounts, 5)
+		assert.Empty(t, resp.NextCursor)
+	})
+
+	t.Run("pages through accounts with a tag", func(t *testing.T) {
+		var seen []string
+		query := "tag=beta&limit=2"
+		for {
+			status, resp := list(t, query)
+			require.Equal(t, http.StatusOK, status)
+			for _, a := range resp.Accounts {
+				assert.Contains(t, a.Tags, "beta")
+				seen = append(seen, a.ID)
+			}
+			if resp.NextCursor == "" {
+				break
+			}
+			query = "tag=beta&limit=2&cursor=" + resp.NextCursor
+		}
+		assert.ElementsMatch(t, betaIDs, seen)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"tag=Not%20A%20Slug", "limit=0", "limit=1000", "cursor=garbage"} {
+			status, _ := list(t, query)
+			assert.Equal(t, http.StatusUnprocessableEntity, status, query)
+		}
+	})
+}
@@ -0,0 +1,191 @@
+// Package auditexport streams an account's audit history as a file, for the account's own
+// export and for admins answering compliance requests about it.
+package auditexport
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const (
+	errTypeValidationError = "validation_error"
+
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+
+	// how many events are read from the database at a time while streaming
+	exportPageSize         = 500
+	exportPageWriteTimeout = 30 * time.Second
+)
+
+var exportCSVHeader = []string{"id", "type", "actor_id", "ip_address", "user_agent", "request_id", "created_at"}
+
+type exportEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Repository defines the DB methods needed to export audit events
+type Repository interface {
+	ListAuditEvents(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error)
+}
+
+// Stream writes an account's audit events as CSV or NDJSON (?format=), optionally
+// restricted to ?from= and ?to= (RFC 3339, from inclusive and to exclusive). Events are
+// read a page at a time and flushed as they're written so large histories don't get
+// buffered in memory.
+func Stream(w http.ResponseWriter, r *http.Request, db Repository, accountID string) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = exportFormatCSV
+	}
+	if format != exportFormatCSV && format != exportFormatNDJSON {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "format must be csv or ndjson",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	since, err := parseOptionalTime(query.Get("from"))
+	if err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "from must be an RFC 3339 timestamp",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+	until, err := parseOptionalTime(query.Get("to"))
+	if err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "to must be an RFC 3339 timestamp",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+	if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "from must be before to",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	params := database.ListAuditEventsParams{
+		AccountID: accountID,
+		Since:     since,
+		Until:     until,
+		Keyset:    database.Keyset{Limit: exportPageSize},
+	}
+
+	// read the first page before committing to a 200 so database errors still get a proper error response
+	events, err := db.ListAuditEvents(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing audit events for export", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error exporting account activity",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+
+	contentType := "text/csv"
+	if format == exportFormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="activity-%s.%s"`, accountID, format))
+	w.WriteHeader(http.StatusOK)
+
+	csvWriter := csv.NewWriter(w)
+	jsonEncoder := json.NewEncoder(w)
+	rc := http.NewResponseController(w)
+
+	if format == exportFormatCSV {
+		_ = csvWriter.Write(exportCSVHeader)
+	}
+
+	for {
+		// long histories can take longer than the server's write timeout, so extend it per page
+		_ = rc.SetWriteDeadline(time.Now().Add(exportPageWriteTimeout))
+
+		for _, e := range events {
+			if format == exportFormatCSV {
+				err = csvWriter.Write([]string{
+					csvCell(e.ID), csvCell(e.EventType), csvCell(e.ActorID), csvCell(e.IPAddress),
+					csvCell(e.UserAgent), csvCell(e.RequestID), e.CreatedAt.UTC().Format(time.RFC3339Nano),
+				})
+			} else {
+				err = jsonEncoder.Encode(exportEvent{
+					ID:        e.ID,
+					Type:      e.EventType,
+					ActorID:   e.ActorID,
+					IPAddress: e.IPAddress,
+					UserAgent: e.UserAgent,
+					RequestID: e.RequestID,
+					CreatedAt: e.CreatedAt,
+				})
+			}
+			if err != nil {
+				// the client most likely went away, nothing else we can do mid-stream
+				slog.ErrorContext(ctx, "error writing audit export", "error", err)
+				return
+			}
+		}
+
+		csvWriter.Flush()
+		_ = rc.Flush()
+
+		if len(events) < exportPageSize {
+			return
+		}
+
+		last := events[len(events)-1]
+		params.BeforeCreatedAt = last.CreatedAt
+		params.BeforeID = last.ID
+
+		events, err = db.ListAuditEvents(ctx, params)
+		if err != nil {
+			// headers are already sent so all we can do is stop; the truncated file is logged
+			slog.ErrorContext(ctx, "error listing audit events mid-export", "error", err)
+			return
+		}
+	}
+}
+
+// csvCell defuses a value the client sent, like its user agent, that a spreadsheet opening the
+// export would run as a formula. Prefixing a quote makes it text.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
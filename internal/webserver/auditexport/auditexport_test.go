@@ -0,0 +1,191 @@
+package auditexport
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type listAuditEventsFn func(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error)
+
+func (fn listAuditEventsFn) ListAuditEvents(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error) {
+	return fn(ctx, params)
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+
+	// enough events to need more than one page
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "export@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	for i := 0; i < exportPageSize+5; i++ {
+		require.NoError(t, db.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+			AccountID: account.ID,
+			EventType: database.AuditEventLogin,
+			IPAddress: "127.0.0.1",
+			UserAgent: "agent, with a comma",
+		}))
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		repo             Repository
+		expectedStatus   int
+		expectedResponse func(t *testing.T, w *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "csv by default",
+			repo:           db,
+			expectedStatus: http.StatusOK,
+			expectedResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+				assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+				records, err := csv.NewReader(w.Body).ReadAll()
+				require.NoError(t, err)
+				require.Len(t, records, exportPageSize+5+1)
+				assert.Equal(t, exportCSVHeader, records[0])
+				assert.Equal(t, database.AuditEventLogin, records[1][1])
+				assert.Equal(t, "agent, with a comma", records[1][4])
+			},
+		},
+		{
+			name:           "ndjson",
+			query:          "?format=ndjson",
+			repo:           db,
+			expectedStatus: http.StatusOK,
+			expectedResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+				ids := map[string]bool{}
+				scanner := bufio.NewScanner(w.Body)
+				for scanner.Scan() {
+					var e exportEvent
+					require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+					assert.Equal(t, database.AuditEventLogin, e.Type)
+					ids[e.ID] = true
+				}
+				// every event exactly once across pages
+				assert.Len(t, ids, exportPageSize+5)
+			},
+		},
+		{
+			name:           "date range excludes everything",
+			query:          "?format=ndjson&to=" + time.Now().Add(-time.Hour).Format(time.RFC3339),
+			repo:           db,
+			expectedStatus: http.StatusOK,
+			expectedResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Empty(t, strings.TrimSpace(w.Body.String()))
+			},
+		},
+		{
+			name:  "date range is passed through",
+			query: "?from=2025-01-01T00:00:00Z&to=2025-02-01T00:00:00Z",
+			repo: listAuditEventsFn(func(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error) {
+				assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), params.Since.UTC())
+				assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), params.Until.UTC())
+				return nil, nil
+			}),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid format",
+			query:          "?format=xml",
+			repo:           db,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "invalid from",
+			query:          "?from=yesterday",
+			repo:           db,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "from after to",
+			query:          "?from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z",
+			repo:           db,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "database error",
+			repo: listAuditEventsFn(func(ctx context.Context, params database.ListAuditEventsParams) ([]database.AuditEvent, error) {
+				return nil, errors.New("database error")
+			}),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/export"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			Stream(w, req, tt.repo, account.ID)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedResponse != nil {
+				tt.expectedResponse(t, w)
+			}
+		})
+	}
+}
+
+func TestStreamDefusesFormulas(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "export@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	userAgents := map[string]string{
+		`=HYPERLINK("https://evil.example.com","click")`: `'=HYPERLINK("https://evil.example.com","click")`,
+		"+1+1":        "'+1+1",
+		"-2+3":        "'-2+3",
+		"@SUM(A1:A2)": "'@SUM(A1:A2)",
+		"\t=1+1":      "'\t=1+1",
+		"Mozilla/5.0": "Mozilla/5.0",
+	}
+	for userAgent := range userAgents {
+		require.NoError(t, db.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+			AccountID: account.ID,
+			EventType: database.AuditEventLogin,
+			UserAgent: userAgent,
+		}))
+	}
+
+	w := httptest.NewRecorder()
+	Stream(w, httptest.NewRequest(http.MethodGet, "/export", nil), db, account.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, len(userAgents)+1)
+	var exported []string
+	for _, record := range records[1:] {
+		exported = append(exported, record[4])
+	}
+	var expected []string
+	for _, userAgent := range userAgents {
+		expected = append(expected, userAgent)
+	}
+	assert.ElementsMatch(t, expected, exported)
+
+	// the JSON export isn't opened in spreadsheets, it keeps the values as they were
+	w = httptest.NewRecorder()
+	Stream(w, httptest.NewRequest(http.MethodGet, "/export?format=ndjson", nil), db, account.ID)
+	assert.Contains(t, w.Body.String(), `"user_agent":"+1+1"`)
+}
@@ -0,0 +1,47 @@
+package webserver
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/metrics"
+	"github.com/austinwofford/account-management/internal/service/scheduler"
+)
+
+// addCleanupJobs schedules purging the rows that can't be used anymore: expired refresh tokens,
+// expired verification and password reset links, expired trusted devices, and audit events past
+// their retention
+func addCleanupJobs(jobs *scheduler.Scheduler, cfg config.Config, db database.Repository, m *metrics.Metrics) {
+	interval := time.Duration(cfg.CleanupIntervalMinutes) * time.Minute
+
+	jobs.Add(purgeJob("refresh_tokens", interval, db.PurgeExpiredRefreshTokens, 0, m))
+	jobs.Add(purgeJob("email_verifications", interval, db.PurgeExpiredEmailVerifications, 0, m))
+	jobs.Add(purgeJob("password_reset_tokens", interval, db.PurgeExpiredPasswordResetTokens, 0, m))
+	jobs.Add(purgeJob("trusted_devices", interval, db.PurgeExpiredTrustedDevices, 0, m))
+	if cfg.AuditLogRetentionDays > 0 {
+		retention := time.Duration(cfg.AuditLogRetentionDays) * 24 * time.Hour
+		jobs.Add(purgeJob("audit_events", interval, db.PurgeAuditEvents, retention, m))
+	}
+}
+
+// purgeJob returns a job purging table's rows older than retention, counting them in m
+func purgeJob(table string, interval time.Duration, purge func(ctx context.Context, before time.Time) (int64, error), retention time.Duration, m *metrics.Metrics) scheduler.Job {
+	return scheduler.Job{
+		Name:     "purge " + table,
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			purged, err := purge(ctx, time.Now().Add(-retention))
+			if err != nil {
+				return err
+			}
+			m.RowsPurged(table, purged)
+			if purged > 0 {
+				slog.InfoContext(ctx, "purged expired rows", "table", table, "count", purged)
+			}
+			return nil
+		},
+	}
+}
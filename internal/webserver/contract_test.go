@@ -0,0 +1,554 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/docs"
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contractStep is a single request replayed through the router. Its response must
+// match both the expected status and the OpenAPI document served at /docs/api/api.yml.
+type contractStep struct {
+	name   string
+	method string
+	path   string
+	// pathFrom builds the path from captured values instead, e.g. for IDs in the path
+	pathFrom       func(state map[string]string) string
+	body           func(state map[string]string) string
+	expectedStatus int
+	// capture pulls values out of the response body for later steps
+	capture func(t *testing.T, body []byte, state map[string]string)
+	// invalidRequest skips request validation for steps that intentionally send bad input
+	invalidRequest bool
+	// authenticated sends the last captured access token as a bearer token
+	authenticated bool
+	// withAPIKey sends the last captured API key instead
+	withAPIKey bool
+}
+
+// TestContract replays the main account flows through the real router (backed by the
+// in-memory database) and validates every request and response against the OpenAPI
+// spec, so drift between docs/api and handler behavior fails the build.
+func TestContract(t *testing.T) {
+	ctx := context.Background()
+
+	specRouter := loadSpecRouter(t)
+
+	router, err := NewRouter(config.Config{
+		DevMode:                true,
+		JWTSecretKey:           "contract-test-secret",
+		AccessTokenTTLMinutes:  15,
+		RefreshTokenTTLMinutes: 60,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+	require.NoError(t, err)
+
+	steps := []contractStep{
+		{
+			name:           "register",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/register",
+			body:           static(`{"email":"contract@test.com","password":"Test123!@#"}`),
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "register duplicate",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/register",
+			body:           static(`{"email":"contract@test.com","password":"Test123!@#"}`),
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "email availability",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/availability?email=contract@test.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "register weak password",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/register",
+			body:           static(`{"email":"weak@test.com","password":"weakpassword"}`),
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "register malformed body",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/register",
+			body:           static(`{"email":`),
+			expectedStatus: http.StatusBadRequest,
+			invalidRequest: true,
+		},
+		{
+			name:           "verify with invalid token",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/verify",
+			body:           static(`{"token":"not-a-real-token"}`),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "resend verification",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/verify/resend",
+			body:           static(`{"email":"contract@test.com"}`),
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "forgot password",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/password/forgot",
+			body:           static(`{"email":"contract@test.com"}`),
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "reset password with invalid token",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/password/reset",
+			body:           static(`{"token":"not-a-real-token","new_password":"NewPass123!@#"}`),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "login wrong password",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/login",
+			body:           static(`{"email":"contract@test.com","password":"Wrong123!@#"}`),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "login unknown account",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/login",
+			body:           static(`{"email":"nobody@test.com","password":"Test123!@#"}`),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "login",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/login",
+			body:           static(`{"email":"contract@test.com","password":"Test123!@#"}`),
+			expectedStatus: http.StatusOK,
+			capture:        captureTokens,
+		},
+		{
+			name:           "refresh",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/refresh",
+			body:           withRefreshToken,
+			expectedStatus: http.StatusOK,
+			capture:        captureTokens,
+		},
+		{
+			name:           "refresh unknown token",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/refresh",
+			body:           static(`{"refresh_token":"not-a-real-token"}`),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "me",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me",
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "me unauthenticated",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "create api key",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/me/api-keys",
+			body:           static(`{"name":"contract","scopes":["account:read"]}`),
+			authenticated:  true,
+			expectedStatus: http.StatusCreated,
+			capture: func(t *testing.T, body []byte, state map[string]string) {
+				var resp struct {
+					ID  string `json:"id"`
+					Key string `json:"key"`
+				}
+				require.NoError(t, json.Unmarshal(body, &resp))
+				state["api_key_id"] = resp.ID
+				state["api_key"] = resp.Key
+			},
+		},
+		{
+			name:           "create api key with unknown scope",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/me/api-keys",
+			body:           static(`{"name":"contract","scopes":["account:delete"]}`),
+			authenticated:  true,
+			expectedStatus: http.StatusUnprocessableEntity,
+			invalidRequest: true,
+		},
+		{
+			name:           "list api keys",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me/api-keys",
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "me with api key",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me",
+			withAPIKey:     true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "revoke every session with read only api key",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/sessions/revoke-all",
+			withAPIKey:     true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "revoke api key",
+			method:         http.MethodDelete,
+			pathFrom:       func(state map[string]string) string { return "/v1/accounts/me/api-keys/" + state["api_key_id"] },
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "me with revoked api key",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me",
+			withAPIKey:     true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "revoke unknown api key",
+			method:         http.MethodDelete,
+			path:           "/v1/accounts/me/api-keys/00000000-0000-0000-0000-000000000000",
+			authenticated:  true,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "change password with wrong current password",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/password/change",
+			body:           static(`{"current_password":"Wrong123!@#","new_password":"NewPass123!@#"}`),
+			authenticated:  true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "totp setup",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/mfa/totp/setup",
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "totp verify with wrong code",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/mfa/totp/verify",
+			body:           static(`{"code":"not-a-code"}`),
+			authenticated:  true,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "login mfa with invalid challenge",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/login/mfa",
+			body:           static(`{"mfa_challenge":"not-a-challenge","code":"123456"}`),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "activity",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me/activity?limit=2",
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "activity unauthenticated",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me/activity",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "feature flags",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me/feature-flags",
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "request email change",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/me/email",
+			body:           static(`{"new_email":"contract-new@test.com","password":"Test123!@#"}`),
+			authenticated:  true,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "confirm email change with unknown token",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/email-change/confirm",
+			body:           static(`{"token":"not-a-real-token"}`),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "sessions",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/sessions",
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "revoke unknown session",
+			method:         http.MethodDelete,
+			path:           "/v1/accounts/sessions/00000000-0000-0000-0000-000000000000",
+			authenticated:  true,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "create organization",
+			method:         http.MethodPost,
+			path:           "/v1/orgs",
+			body:           static(`{"name":"Contract Co"}`),
+			authenticated:  true,
+			expectedStatus: http.StatusCreated,
+			capture: func(t *testing.T, body []byte, state map[string]string) {
+				var resp struct {
+					ID string `json:"id"`
+				}
+				require.NoError(t, json.Unmarshal(body, &resp))
+				state["org_id"] = resp.ID
+			},
+		},
+		{
+			name:           "create organization without a name",
+			method:         http.MethodPost,
+			path:           "/v1/orgs",
+			body:           static(`{"name":""}`),
+			authenticated:  true,
+			expectedStatus: http.StatusUnprocessableEntity,
+			invalidRequest: true,
+		},
+		{
+			name:           "get organization",
+			method:         http.MethodGet,
+			pathFrom:       func(state map[string]string) string { return "/v1/orgs/" + state["org_id"] },
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "get unknown organization",
+			method:         http.MethodGet,
+			path:           "/v1/orgs/00000000-0000-0000-0000-000000000000",
+			authenticated:  true,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "organization token",
+			method:         http.MethodPost,
+			pathFrom:       func(state map[string]string) string { return "/v1/orgs/" + state["org_id"] + "/token" },
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invite to organization",
+			method:         http.MethodPost,
+			pathFrom:       func(state map[string]string) string { return "/v1/orgs/" + state["org_id"] + "/invitations" },
+			body:           static(`{"email":"invitee@example.com","role":"admin"}`),
+			authenticated:  true,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "accept unknown invitation",
+			method:         http.MethodPost,
+			path:           "/v1/invitations/accept",
+			body:           static(`{"token":"not-an-invitation","password":"Password1234!"}`),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "logout",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/logout",
+			body:           withRefreshToken,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "refresh after logout",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/refresh",
+			body:           withRefreshToken,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "logout everywhere",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/logout-all",
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "me after logout everywhere",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me",
+			authenticated:  true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "login after logout everywhere",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/login",
+			body:           static(`{"email":"contract@test.com","password":"Test123!@#"}`),
+			expectedStatus: http.StatusOK,
+			capture:        captureTokens,
+		},
+		{
+			name:           "revoke every session",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/sessions/revoke-all",
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "login after revoking every session",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/login",
+			body:           static(`{"email":"contract@test.com","password":"Test123!@#"}`),
+			expectedStatus: http.StatusOK,
+			capture:        captureTokens,
+		},
+		{
+			name:           "delete account",
+			method:         http.MethodDelete,
+			path:           "/v1/accounts/me",
+			authenticated:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "me after delete",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me",
+			authenticated:  true,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	state := map[string]string{}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			var body string
+			if step.body != nil {
+				body = step.body(state)
+			}
+
+			path := step.path
+			if step.pathFrom != nil {
+				path = step.pathFrom(state)
+			}
+
+			newRequest := func() *http.Request {
+				req := httptest.NewRequest(step.method, path, bytes.NewReader([]byte(body)))
+				if body != "" {
+					req.Header.Set("Content-Type", "application/json")
+				}
+				if step.authenticated {
+					req.Header.Set("Authorization", "Bearer "+state["access_token"])
+				}
+				if step.withAPIKey {
+					req.Header.Set("X-API-Key", state["api_key"])
+				}
+				return req
+			}
+
+			req := newRequest()
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, step.expectedStatus, w.Code, w.Body.String())
+
+			// the handler consumed the body so validate against a fresh copy of the request
+			validationReq := newRequest()
+
+			route, pathParams, err := specRouter.FindRoute(validationReq)
+			require.NoError(t, err, "route is not documented in the OpenAPI spec")
+
+			requestInput := &openapi3filter.RequestValidationInput{
+				Request:    validationReq,
+				PathParams: pathParams,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					// whether the token is valid is the router's job, not the spec's
+					AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+				},
+			}
+
+			if !step.invalidRequest {
+				require.NoError(t, openapi3filter.ValidateRequest(ctx, requestInput))
+			}
+
+			err = openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: requestInput,
+				Status:                 w.Code,
+				Header:                 w.Header(),
+				Body:                   io.NopCloser(bytes.NewReader(w.Body.Bytes())),
+				Options: &openapi3filter.Options{
+					IncludeResponseStatus: true,
+				},
+			})
+			assert.NoError(t, err, "response does not match the OpenAPI spec: %s", w.Body.String())
+
+			if step.capture != nil {
+				step.capture(t, w.Body.Bytes(), state)
+			}
+		})
+	}
+}
+
+func loadSpecRouter(t *testing.T) routers.Router {
+	t.Helper()
+
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(docs.OpenAPISpec)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(loader.Context))
+
+	// match requests regardless of host
+	doc.Servers = openapi3.Servers{{URL: "/"}}
+
+	router, err := gorillamux.NewRouter(doc)
+	require.NoError(t, err)
+
+	return router
+}
+
+func static(body string) func(map[string]string) string {
+	return func(map[string]string) string { return body }
+}
+
+func withRefreshToken(state map[string]string) string {
+	b, _ := json.Marshal(map[string]string{"refresh_token": state["refresh_token"]})
+	return string(b)
+}
+
+func captureTokens(t *testing.T, body []byte, state map[string]string) {
+	var resp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	require.NoError(t, json.Unmarshal(body, &resp))
+	state["access_token"] = resp.AccessToken
+	state["refresh_token"] = resp.RefreshToken
+}
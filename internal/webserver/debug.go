@@ -0,0 +1,35 @@
+package webserver
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/config"
+)
+
+// NewDebugServer returns the server for DebugAddress with net/http/pprof at /debug/pprof/ and
+// expvar's memory stats and command line at /debug/vars, or nil without one. It's kept off the
+// API's listener since there's no authentication, and CPU profiles and traces take longer than
+// the API's write timeout.
+func NewDebugServer(cfg config.Config) *http.Server {
+	if !cfg.DebugEnabled || cfg.DebugAddress == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return &http.Server{
+		Addr:              cfg.DebugAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+}
@@ -0,0 +1,50 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugServer(t *testing.T) {
+	assert.Nil(t, NewDebugServer(config.Config{DebugAddress: "127.0.0.1:6060"}), "debug isn't enabled")
+	assert.Nil(t, NewDebugServer(config.Config{DebugEnabled: true}), "no address")
+
+	srv := NewDebugServer(config.Config{DebugEnabled: true, DebugAddress: "127.0.0.1:6060"})
+	require.NotNil(t, srv)
+	assert.Equal(t, "127.0.0.1:6060", srv.Addr)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	t.Run("pprof", func(t *testing.T) {
+		w := get("/debug/pprof/")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "goroutine")
+
+		w = get("/debug/pprof/goroutine?debug=1")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "TestDebugServer")
+	})
+
+	t.Run("expvar", func(t *testing.T) {
+		w := get("/debug/vars")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var vars map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &vars))
+		assert.Contains(t, vars, "memstats")
+	})
+
+	t.Run("the API isn't served", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/v1/accounts/me").Code)
+	})
+}
@@ -0,0 +1,336 @@
+// Package debugcapture records recent requests and responses, with credentials stripped, so
+// client integration problems can be diagnosed without packet captures. It's only meant to be
+// turned on while debugging: even sanitized, the captures contain account data.
+package debugcapture
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/go-chi/chi/middleware"
+)
+
+const (
+	// MaxBodyBytes is how much of each request and response body is kept. Longer bodies are
+	// dropped rather than cut off since a truncated body can't be sanitized reliably.
+	MaxBodyBytes = 16 << 10
+
+	redacted = "[REDACTED]"
+)
+
+// Exchange is one captured request and its response
+type Exchange struct {
+	RequestID       string              `json:"request_id,omitempty"`
+	Time            time.Time           `json:"time"`
+	Method          string              `json:"method"`
+	Path            string              `json:"path"`
+	Query           string              `json:"query,omitempty"`
+	RequestHeaders  map[string][]string `json:"request_headers"`
+	RequestBody     json.RawMessage     `json:"request_body,omitempty"`
+	Status          int                 `json:"status"`
+	ResponseHeaders map[string][]string `json:"response_headers"`
+	ResponseBody    json.RawMessage     `json:"response_body,omitempty"`
+	DurationMS      float64             `json:"duration_ms"`
+	// Note explains bodies that weren't captured
+	Note string `json:"note,omitempty"`
+}
+
+// Buffer keeps the most recent exchanges. It's safe for concurrent use.
+type Buffer struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	next      int
+	full      bool
+}
+
+func NewBuffer(size int) *Buffer {
+	if size < 1 {
+		size = 1
+	}
+	return &Buffer{exchanges: make([]Exchange, size)}
+}
+
+func (b *Buffer) add(e Exchange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.exchanges[b.next] = e
+	b.next = (b.next + 1) % len(b.exchanges)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Exchanges returns the captured exchanges, newest first
+func (b *Buffer) Exchanges() []Exchange {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := b.next
+	if b.full {
+		count = len(b.exchanges)
+	}
+
+	result := make([]Exchange, 0, count)
+	for i := 1; i <= count; i++ {
+		result = append(result, b.exchanges[(b.next-i+len(b.exchanges))%len(b.exchanges)])
+	}
+	return result
+}
+
+// Middleware captures every request that passes through it into buf, except for the debug
+// endpoints themselves so viewing the captures doesn't push them out of the buffer
+func Middleware(buf *Buffer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/debug/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+
+			// read up to the limit and put it back in front of the rest so the handler sees the
+			// whole body
+			var requestBody []byte
+			if r.Body != nil && r.Body != http.NoBody {
+				var err error
+				requestBody, err = io.ReadAll(io.LimitReader(r.Body, MaxBodyBytes+1))
+				if err != nil {
+					// let the handler deal with the broken body
+					requestBody = nil
+				}
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(requestBody), r.Body), r.Body}
+			}
+
+			cw := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(cw, r)
+
+			e := Exchange{
+				RequestID:       middleware.GetReqID(r.Context()),
+				Time:            start,
+				Method:          r.Method,
+				Path:            r.URL.Path,
+				Query:           sanitizeQuery(r.URL.Query()),
+				RequestHeaders:  sanitizeHeaders(r.Header),
+				Status:          cw.status,
+				ResponseHeaders: sanitizeHeaders(w.Header()),
+				DurationMS:      float64(time.Since(start).Microseconds()) / 1000,
+			}
+
+			var notes []string
+			if body, note := sanitizeBody(requestBody); note != "" {
+				notes = append(notes, "request "+note)
+			} else {
+				e.RequestBody = body
+			}
+			if body, note := sanitizeBody(cw.body.Bytes()); note != "" {
+				notes = append(notes, "response "+note)
+			} else {
+				e.ResponseBody = body
+			}
+			e.Note = strings.Join(notes, "; ")
+
+			buf.add(e)
+		})
+	}
+}
+
+type capturesResponse struct {
+	Captures []Exchange `json:"captures"`
+}
+
+// Handler serves the captured exchanges, newest first
+func Handler(buf *Buffer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		httputils.WriteJSONResponse(w, r, http.StatusOK, capturesResponse{Captures: buf.Exchanges()})
+	}
+}
+
+// readCloser reads from the replayed body but closes the original one
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// captureWriter records the status and the first MaxBodyBytes+1 bytes of the body
+type captureWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *captureWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	if room := MaxBodyBytes + 1 - w.body.Len(); room > 0 {
+		w.body.Write(p[:min(room, len(p))])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the real writer, e.g. to flush streamed responses
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// sensitiveHeaders are replaced outright
+var sensitiveHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+	"X-Signature":   true,
+	"X-Api-Key":     true,
+	"X-Csrf-Token":  true,
+}
+
+// urlHeaders hold URLs, which can carry credentials in their query or fragment, e.g. the SSO
+// login token a SAML sign-in redirects back with
+var urlHeaders = map[string]bool{
+	"Location":         true,
+	"Content-Location": true,
+}
+
+func sanitizeHeaders(h http.Header) map[string][]string {
+	result := make(map[string][]string, len(h))
+	for name, values := range h {
+		canonical := http.CanonicalHeaderKey(name)
+		if sensitiveHeaders[canonical] {
+			result[name] = []string{redacted}
+			continue
+		}
+		result[name] = append([]string(nil), values...)
+		if urlHeaders[canonical] {
+			for i, value := range result[name] {
+				result[name][i] = sanitizeURL(value)
+			}
+		}
+	}
+	return result
+}
+
+// sanitizeURL redacts the credentials in a URL's query and in a fragment of parameters, e.g. the
+// code in an OAuth redirect or the token an SSO callback is sent
+func sanitizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	u.RawQuery = sanitizeQuery(u.Query())
+	if !strings.Contains(u.Fragment, "=") {
+		return u.String()
+	}
+
+	fragment, err := url.ParseQuery(u.Fragment)
+	u.Fragment, u.RawFragment = "", ""
+	if err != nil {
+		return u.String() + "#" + redacted
+	}
+	return u.String() + "#" + sanitizeQuery(fragment)
+}
+
+func sanitizeQuery(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+	for key := range q {
+		if sensitiveKey(key) {
+			q[key] = []string{redacted}
+		}
+	}
+	return q.Encode()
+}
+
+// sanitizeBody returns the JSON body with sensitive values redacted, or a note saying why the
+// body wasn't kept
+func sanitizeBody(body []byte) (json.RawMessage, string) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, ""
+	}
+	if len(body) > MaxBodyBytes {
+		return nil, "body too large to capture"
+	}
+
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		// only JSON can be sanitized, anything else might hold credentials we can't find
+		return nil, "body isn't JSON"
+	}
+
+	sanitized, err := json.Marshal(redact(v))
+	if err != nil {
+		return nil, "body couldn't be sanitized"
+	}
+	return sanitized, ""
+}
+
+func redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			raw, isString := value.(string)
+			switch {
+			case sensitiveKey(key):
+				v[key] = redacted
+			case isString && urlKey(key):
+				v[key] = sanitizeURL(raw)
+			default:
+				v[key] = redact(value)
+			}
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// sensitiveFields are credentials whose field names don't say so: a new API key, the
+// provisioning URI holding a TOTP secret, the token of an MFA challenge, and recovery codes
+var sensitiveFields = map[string]bool{
+	"code":             true,
+	"otp":              true,
+	"code_verifier":    true,
+	"key":              true,
+	"provisioning_uri": true,
+	"mfa_challenge":    true,
+	"recovery_codes":   true,
+}
+
+// urlKey matches the field names of URLs, e.g. the redirect_uri an authorization responds with
+func urlKey(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasSuffix(key, "uri") || strings.HasSuffix(key, "url") || key == "location"
+}
+
+// sensitiveKey matches the field names that carry credentials: passwords, every kind of token,
+// secrets, and authorization codes
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range []string{"password", "token", "secret", "cursor"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return sensitiveFields[key]
+}
@@ -0,0 +1,198 @@
+package debugcapture
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	buf := NewBuffer(10)
+	var handlerBody string
+	handler := Middleware(buf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		handlerBody = string(body)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"access_token":"at","account":{"email":"a@example.com"},"items":[{"refresh_token":"rt"}]}`))
+	}))
+
+	requestBody := `{"email":"a@example.com","password":"hunter2","nested":{"new_password":"x","client_secret":"s"}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/accounts/login?token=abc&page=2", strings.NewReader(requestBody))
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("X-API-Key", "key")
+	req.Header.Set("X-CSRF-Token", "csrf")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, requestBody, handlerBody, "handler should still get the whole body")
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	captures := buf.Exchanges()
+	require.Len(t, captures, 1)
+	e := captures[0]
+
+	assert.Equal(t, http.MethodPost, e.Method)
+	assert.Equal(t, "/v1/accounts/login", e.Path)
+	assert.Equal(t, http.StatusCreated, e.Status)
+	assert.Equal(t, "page=2&token=%5BREDACTED%5D", e.Query)
+	assert.Equal(t, []string{redacted}, e.RequestHeaders["Authorization"])
+	assert.Equal(t, []string{redacted}, e.RequestHeaders["X-Api-Key"])
+	assert.Equal(t, []string{redacted}, e.RequestHeaders["X-Csrf-Token"])
+	assert.Equal(t, []string{"application/json"}, e.RequestHeaders["Content-Type"])
+	assert.Equal(t, []string{redacted}, e.ResponseHeaders["Set-Cookie"])
+
+	assert.JSONEq(t, `{"email":"a@example.com","password":"[REDACTED]","nested":{"new_password":"[REDACTED]","client_secret":"[REDACTED]"}}`, string(e.RequestBody))
+	assert.JSONEq(t, `{"access_token":"[REDACTED]","account":{"email":"a@example.com"},"items":[{"refresh_token":"[REDACTED]"}]}`, string(e.ResponseBody))
+	assert.Empty(t, e.Note)
+}
+
+func TestRedactCredentialFields(t *testing.T) {
+	body := `{
+		"id": "key-1",
+		"key": "am_live_secret",
+		"key_ids": ["key-1"],
+		"provisioning_uri": "otpauth://totp/Accounts:a@example.com?secret=JBSWY3DPEHPK3PXP",
+		"mfa_challenge": "challenge",
+		"recovery_codes": ["aaaa-bbbb", "cccc-dddd"],
+		"code_verifier": "verifier"
+	}`
+
+	sanitized, note := sanitizeBody([]byte(body))
+	require.Empty(t, note)
+	assert.JSONEq(t, `{
+		"id": "key-1",
+		"key": "[REDACTED]",
+		"key_ids": ["key-1"],
+		"provisioning_uri": "[REDACTED]",
+		"mfa_challenge": "[REDACTED]",
+		"recovery_codes": "[REDACTED]",
+		"code_verifier": "[REDACTED]"
+	}`, string(sanitized))
+}
+
+func TestRedactURLs(t *testing.T) {
+	capture := func(t *testing.T, handler http.HandlerFunc) Exchange {
+		buf := NewBuffer(10)
+		Middleware(buf)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+		captures := buf.Exchanges()
+		require.Len(t, captures, 1)
+		return captures[0]
+	}
+
+	t.Run("SAML sign-in redirect", func(t *testing.T) {
+		e := capture(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "https://app.example.com/sso/callback#token=sso-login-token", http.StatusSeeOther)
+		})
+		assert.Equal(t, []string{"https://app.example.com/sso/callback#token=%5BREDACTED%5D"}, e.ResponseHeaders["Location"])
+	})
+
+	t.Run("OAuth authorization", func(t *testing.T) {
+		e := capture(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"redirect_uri":"https://client.example.com/cb?code=auth-code&state=xyz"}`))
+		})
+		assert.JSONEq(t, `{"redirect_uri":"https://client.example.com/cb?code=%5BREDACTED%5D&state=xyz"}`, string(e.ResponseBody))
+	})
+
+	t.Run("URLs without credentials", func(t *testing.T) {
+		assert.Equal(t, "/v1/accounts?page=2", sanitizeURL("/v1/accounts?page=2"))
+		assert.Equal(t, "https://app.example.com/docs#errors", sanitizeURL("https://app.example.com/docs#errors"))
+		assert.Equal(t, "https://app.example.com/cb#access_token=%5BREDACTED%5D&expires_in=900",
+			sanitizeURL("https://app.example.com/cb#access_token=at&expires_in=900"))
+	})
+}
+
+func TestMiddlewareUncapturedBodies(t *testing.T) {
+	tests := []struct {
+		name         string
+		requestBody  string
+		responseBody string
+		expectedNote string
+	}{
+		{
+			name:         "not JSON",
+			requestBody:  "password=hunter2",
+			responseBody: `{}`,
+			expectedNote: "request body isn't JSON",
+		},
+		{
+			name:         "too large",
+			requestBody:  `{}`,
+			responseBody: `"` + strings.Repeat("a", MaxBodyBytes) + `"`,
+			expectedNote: "response body too large to capture",
+		},
+		{
+			name:         "empty",
+			requestBody:  "",
+			responseBody: "",
+			expectedNote: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := NewBuffer(1)
+			handler := Middleware(buf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(tt.responseBody))
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.requestBody))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			captures := buf.Exchanges()
+			require.Len(t, captures, 1)
+			assert.Equal(t, tt.expectedNote, captures[0].Note)
+			assert.Equal(t, http.StatusOK, captures[0].Status)
+		})
+	}
+}
+
+func TestMiddlewareSkipsDebugEndpoints(t *testing.T) {
+	buf := NewBuffer(1)
+	handler := Middleware(buf)(Handler(buf))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/debug/captures", nil))
+	assert.Empty(t, buf.Exchanges())
+}
+
+func TestBuffer(t *testing.T) {
+	buf := NewBuffer(3)
+	assert.Empty(t, buf.Exchanges())
+
+	for i := range 5 {
+		buf.add(Exchange{Path: fmt.Sprintf("/%d", i)})
+	}
+
+	var paths []string
+	for _, e := range buf.Exchanges() {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"/4", "/3", "/2"}, paths, "should keep the newest, newest first")
+}
+
+func TestHandler(t *testing.T) {
+	buf := NewBuffer(2)
+	buf.add(Exchange{Path: "/v1/accounts/me", Status: http.StatusOK})
+
+	w := httptest.NewRecorder()
+	Handler(buf).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/captures", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var resp capturesResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Len(t, resp.Captures, 1)
+	assert.Equal(t, "/v1/accounts/me", resp.Captures[0].Path)
+}
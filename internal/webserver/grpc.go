@@ -0,0 +1,28 @@
+package webserver
+
+import (
+	"crypto/tls"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// NewGRPCServer returns the server for GRPCAddress, or nil without one. Unlike the HTTP server,
+// a verified client certificate is required to connect at all since every gRPC method is an
+// internal one; the certificate also has to be mapped to a service identity.
+func NewGRPCServer(cfg config.Config, tlsConfig *tls.Config) *grpc.Server {
+	if cfg.GRPCAddress == "" {
+		return nil
+	}
+
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	tlsConfig.NextProtos = []string{"h2"}
+
+	return grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.UnaryInterceptor(middleware.RequireClientCertGRPC(cfg.MTLSClientIdentities)),
+	)
+}
@@ -0,0 +1,109 @@
+package webserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+type healthResponse struct {
+	// Status is "ok", "degraded" (the primary database is down but the service is still
+	// answering what it can), or "unavailable"
+	Status        string     `json:"status"`
+	DegradedSince *time.Time `json:"degraded_since,omitempty"`
+}
+
+// healthCheck reports the database's health. With outage detection on (state isn't nil) a
+// degraded service still answers 200 so load balancers keep sending it the requests it can
+// serve; without it a failed database check is a 503.
+func healthCheck(check func(ctx context.Context) error, state middleware.DegradedState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		if state != nil {
+			if degraded, since := state.Degraded(); degraded {
+				httputils.WriteJSONResponse(w, r, http.StatusOK, healthResponse{Status: "degraded", DegradedSince: &since})
+				return
+			}
+			httputils.WriteJSONResponse(w, r, http.StatusOK, healthResponse{Status: "ok"})
+			return
+		}
+
+		if err := check(r.Context()); err != nil {
+			httputils.WriteJSONResponse(w, r, http.StatusServiceUnavailable, healthResponse{Status: "unavailable"})
+			return
+		}
+		httputils.WriteJSONResponse(w, r, http.StatusOK, healthResponse{Status: "ok"})
+	}
+}
+
+// readinessTimeout bounds each dependency check of /readyz, within the request's own deadline
+const readinessTimeout = 2 * time.Second
+
+// dependency is something the service needs to serve requests, checked by /readyz
+type dependency struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// migrationChecker is implemented by databases with migrations, Postgres
+type migrationChecker interface {
+	CheckMigrations(ctx context.Context) error
+}
+
+type dependencyStatus struct {
+	// Status is "ok" or "unavailable"
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	// Status is "ok" when every dependency is, "unavailable" otherwise
+	Status string                      `json:"status"`
+	Checks map[string]dependencyStatus `json:"checks"`
+}
+
+// liveness answers 200 as long as the process is serving requests. It doesn't check anything
+// else so a database outage doesn't get every replica restarted.
+func liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	httputils.WriteJSONResponse(w, r, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// readiness checks the dependencies at the same time, each with readinessTimeout, and answers
+// 503 if any of them is down
+func readiness(dependencies ...dependency) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		statuses := make([]dependencyStatus, len(dependencies))
+		var wg sync.WaitGroup
+		for i, dep := range dependencies {
+			wg.Go(func() {
+				ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+				defer cancel()
+
+				statuses[i] = dependencyStatus{Status: "ok"}
+				if err := dep.check(ctx); err != nil {
+					statuses[i] = dependencyStatus{Status: "unavailable", Error: err.Error()}
+				}
+			})
+		}
+		wg.Wait()
+
+		resp := readinessResponse{Status: "ok", Checks: make(map[string]dependencyStatus, len(dependencies))}
+		status := http.StatusOK
+		for i, dep := range dependencies {
+			resp.Checks[dep.name] = statuses[i]
+			if statuses[i].Status != "ok" {
+				resp.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+			}
+		}
+		httputils.WriteJSONResponse(w, r, status, resp)
+	}
+}
@@ -0,0 +1,155 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/degraded"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCheck(t *testing.T) {
+	ctx := context.Background()
+
+	healthy := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	outage := degraded.NewMonitor(down, degraded.Config{Interval: time.Second, FailureThreshold: 1})
+	outage.Observe(ctx, errors.New("connection refused"))
+
+	tests := []struct {
+		name           string
+		check          func(ctx context.Context) error
+		monitor        *degraded.Monitor
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "healthy",
+			check:          healthy,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ok",
+		},
+		{
+			name:           "database down without outage detection",
+			check:          down,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "unavailable",
+		},
+		{
+			name:           "healthy with outage detection",
+			check:          down,
+			monitor:        degraded.NewMonitor(healthy, degraded.DefaultConfig()),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ok",
+		},
+		{
+			name:           "degraded",
+			check:          down,
+			monitor:        outage,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "degraded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := healthCheck(tt.check, nil)
+			if tt.monitor != nil {
+				handler = healthCheck(tt.check, tt.monitor)
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var resp healthResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedBody, resp.Status)
+			assert.Equal(t, tt.expectedBody == "degraded", resp.DegradedSince != nil)
+		})
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	w := httptest.NewRecorder()
+	liveness(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadiness(t *testing.T) {
+	healthy := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+	hangs := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name           string
+		dependencies   []dependency
+		expectedStatus int
+		expectedBody   readinessResponse
+	}{
+		{
+			name: "ready",
+			dependencies: []dependency{
+				{name: "database", check: healthy},
+				{name: "mailer", check: healthy},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: readinessResponse{Status: "ok", Checks: map[string]dependencyStatus{
+				"database": {Status: "ok"},
+				"mailer":   {Status: "ok"},
+			}},
+		},
+		{
+			name: "a dependency is down",
+			dependencies: []dependency{
+				{name: "database", check: healthy},
+				{name: "migrations", check: down},
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: readinessResponse{Status: "unavailable", Checks: map[string]dependencyStatus{
+				"database":   {Status: "ok"},
+				"migrations": {Status: "unavailable", Error: "connection refused"},
+			}},
+		},
+		{
+			name: "a check times out with the request",
+			dependencies: []dependency{
+				{name: "mailer", check: hangs},
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: readinessResponse{Status: "unavailable", Checks: map[string]dependencyStatus{
+				"mailer": {Status: "unavailable", Error: context.DeadlineExceeded.Error()},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			w := httptest.NewRecorder()
+			readiness(tt.dependencies...)(w, httptest.NewRequest(http.MethodGet, "/readyz", nil).WithContext(ctx))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+			var resp readinessResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedBody, resp)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package httputils
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP records the address of the client that sent a request, found behind any trusted
+// proxies
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP is the address of the client that sent the request. Behind trusted proxies it's the
+// one they forwarded the request for, see middleware.ClientIP, otherwise the connection's.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return RemoteIP(r)
+}
+
+// RemoteIP is the address of the connection the request came in on, which is a proxy's when
+// there's one in front
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
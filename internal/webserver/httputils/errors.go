@@ -2,10 +2,13 @@ package httputils
 
 import (
 	"encoding/json"
-	"fmt"
 	"log/slog"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/austinwofford/account-management/internal/i18n"
 	"github.com/go-chi/chi/middleware"
 )
 
@@ -27,21 +30,104 @@ type ErrorResponse struct {
 	RequestID string `json:"request_id,omitempty"`
 }
 
+// ProblemDetails is the RFC 9457 form of ErrorResponse, sent to clients that ask for
+// application/problem+json
+type ProblemDetails struct {
+	// Type identifies the kind of error. It's built from ErrorResponse.Type, or about:blank
+	// when the error has no type.
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+const (
+	contentTypeJSON        = "application/json"
+	contentTypeProblemJSON = "application/problem+json"
+
+	// problemTypePrefix turns an error type into the URI that problem+json requires
+	problemTypePrefix = "urn:account-management:problem:"
+)
+
 // WriteErrorResponse writes a standard error response body. Failures to JSON encode the body
 // will be logged and otherwise ignored. Status codes will still be written.
+// The message is translated into the request's negotiated locale when a translation exists for the error type,
+// negotiating it from Accept-Language if the locale middleware hasn't. The type is never translated.
+// Clients that accept application/problem+json get the error as RFC 9457 problem details instead,
+// and so do all requests to v2 of the API onwards.
 func WriteErrorResponse(w http.ResponseWriter, r *http.Request, httpErr ErrorResponse) {
 	if httpErr.StatusCode == 0 {
 		httpErr.StatusCode = 500
 	}
 
+	locale := errorLocale(r)
+	if httpErr.Type != "" {
+		httpErr.Message = i18n.Translate(locale, httpErr.Type, httpErr.Message)
+	}
+
 	httpErr.Status = http.StatusText(httpErr.StatusCode)
-	httpErr.RequestID = fmt.Sprint(r.Context().Value(middleware.RequestIDKey))
+	httpErr.RequestID = middleware.GetReqID(r.Context())
+
+	var body any = httpErr
+	contentType := contentTypeJSON
+	if acceptsProblemJSON(r) || APIVersion(r.Context()) >= 2 {
+		body = newProblemDetails(httpErr)
+		contentType = contentTypeProblemJSON
+	}
 
-	w.Header().Set("Content-Type", "application/json")
+	// headers have to be set before WriteHeader, anything set after is silently dropped
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
 	w.WriteHeader(httpErr.StatusCode)
 
-	if err := json.NewEncoder(w).Encode(httpErr); err != nil {
+	if err := json.NewEncoder(w).Encode(body); err != nil {
 		ctx := r.Context()
 		slog.ErrorContext(ctx, "failed to encode JSON error response", "error", err.Error())
 	}
 }
+
+// errorLocale is the locale negotiated for the request by the middleware, or negotiated from its
+// Accept-Language header for errors written before the middleware ran
+func errorLocale(r *http.Request) string {
+	if locale, ok := i18n.NegotiatedLocale(r.Context()); ok {
+		return locale
+	}
+	locale, _ := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	return locale
+}
+
+func newProblemDetails(httpErr ErrorResponse) ProblemDetails {
+	problemType := "about:blank"
+	if httpErr.Type != "" {
+		problemType = problemTypePrefix + httpErr.Type
+	}
+	return ProblemDetails{
+		Type:      problemType,
+		Title:     httpErr.Status,
+		Status:    httpErr.StatusCode,
+		Detail:    httpErr.Message,
+		RequestID: httpErr.RequestID,
+	}
+}
+
+// acceptsProblemJSON reports whether the Accept header explicitly lists application/problem+json.
+// Wildcards don't count so existing clients keep getting the plain JSON errors.
+func acceptsProblemJSON(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || mediaType != contentTypeProblemJSON {
+				continue
+			}
+			if q, ok := params["q"]; ok {
+				if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+					continue
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/i18n"
+	"github.com/go-chi/chi/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteErrorResponse(t *testing.T) {
+	httpErr := ErrorResponse{
+		Message:    "The account was not found",
+		Type:       "account_not_found",
+		StatusCode: http.StatusNotFound,
+	}
+
+	tests := []struct {
+		name                string
+		accept              string
+		apiVersion          int
+		expectedContentType string
+	}{
+		{name: "no accept header", accept: "", expectedContentType: "application/json"},
+		{name: "json", accept: "application/json", expectedContentType: "application/json"},
+		{name: "wildcard", accept: "*/*", expectedContentType: "application/json"},
+		{name: "problem json", accept: "application/problem+json", expectedContentType: "application/problem+json"},
+		{name: "problem json among others", accept: "application/json;q=0.5, application/problem+json", expectedContentType: "application/problem+json"},
+		{name: "problem json refused", accept: "application/problem+json;q=0", expectedContentType: "application/json"},
+		{name: "v1", apiVersion: 1, expectedContentType: "application/json"},
+		{name: "v2", apiVersion: 2, expectedContentType: "application/problem+json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, "req-123"))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if tt.apiVersion != 0 {
+				req = req.WithContext(WithAPIVersion(req.Context(), tt.apiVersion))
+			}
+			w := httptest.NewRecorder()
+
+			WriteErrorResponse(w, req, httpErr)
+
+			res := w.Result()
+			assert.Equal(t, http.StatusNotFound, res.StatusCode)
+			assert.Equal(t, tt.expectedContentType, res.Header.Get("Content-Type"))
+			assert.NotEmpty(t, res.Header.Get("Content-Language"))
+
+			if tt.expectedContentType == "application/problem+json" {
+				var problem ProblemDetails
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+				assert.Equal(t, ProblemDetails{
+					Type:      "urn:account-management:problem:account_not_found",
+					Title:     "Not Found",
+					Status:    http.StatusNotFound,
+					Detail:    "The account was not found",
+					RequestID: "req-123",
+				}, problem)
+				return
+			}
+
+			var resp ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, ErrorResponse{
+				Message:   "The account was not found",
+				Type:      "account_not_found",
+				Status:    "Not Found",
+				RequestID: "req-123",
+			}, resp)
+		})
+	}
+}
+
+func TestWriteErrorResponseDefaults(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/problem+json")
+	w := httptest.NewRecorder()
+
+	WriteErrorResponse(w, req, ErrorResponse{Message: "boom"})
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var problem ProblemDetails
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "about:blank", problem.Type)
+	assert.Equal(t, "Internal Server Error", problem.Title)
+	// without the request ID middleware there's no request ID to report
+	assert.Empty(t, problem.RequestID)
+}
+
+func TestWriteErrorResponseLocalization(t *testing.T) {
+	httpErr := ErrorResponse{
+		Message:    "Your session has expired",
+		Type:       "invalid_refresh_token",
+		StatusCode: http.StatusUnauthorized,
+	}
+
+	tests := []struct {
+		name            string
+		acceptLanguage  string
+		negotiated      string
+		expectedLocale  string
+		expectedMessage string
+	}{
+		{name: "english", acceptLanguage: "en-US", expectedLocale: "en", expectedMessage: "Your session has expired"},
+		{name: "spanish", acceptLanguage: "es-MX, en;q=0.5", expectedLocale: "es", expectedMessage: "Tu sesión ha expirado"},
+		{name: "german", acceptLanguage: "de", expectedLocale: "de", expectedMessage: "Deine Sitzung ist abgelaufen"},
+		{name: "unsupported", acceptLanguage: "fr", expectedLocale: "en", expectedMessage: "Your session has expired"},
+		{name: "negotiated by the middleware", acceptLanguage: "es", negotiated: "de", expectedLocale: "de", expectedMessage: "Deine Sitzung ist abgelaufen"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			if tt.negotiated != "" {
+				req = req.WithContext(i18n.WithLocale(req.Context(), tt.negotiated))
+			}
+			w := httptest.NewRecorder()
+
+			WriteErrorResponse(w, req, httpErr)
+
+			assert.Equal(t, tt.expectedLocale, w.Header().Get("Content-Language"))
+			assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
+
+			var resp ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedMessage, resp.Message)
+			// the type is the contract and never translated
+			assert.Equal(t, "invalid_refresh_token", resp.Type)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package httputils
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Cursor is where a page of a list sorted newest first by created_at then ID ends: the last
+// item's created_at and ID. The zero Cursor is the start of the list.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// IsZero is whether the cursor is the start of the list
+func (c Cursor) IsZero() bool {
+	return c.CreatedAt.IsZero() && c.ID == ""
+}
+
+// Encode returns the cursor as it's given to clients. Cursors are opaque to clients:
+// base64("<created_at RFC3339Nano>|<id>")
+func (c Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+var errInvalidCursor = errors.New("The cursor is invalid")
+
+// DecodeCursor parses a cursor from Cursor.Encode
+func DecodeCursor(cursor string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Cursor{}, errInvalidCursor
+	}
+
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return Cursor{}, errInvalidCursor
+	}
+	// the ID is cast to uuid in the query
+	if _, err := uuid.Parse(id); err != nil {
+		return Cursor{}, errInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return Cursor{}, errInvalidCursor
+	}
+
+	return Cursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// PageLimits are how many items a page of a list endpoint has without a limit, and at most
+type PageLimits struct {
+	Default int
+	Max     int
+}
+
+// PageRequest is the page a client asked for
+type PageRequest struct {
+	Limit int
+	// After is the cursor of the previous page, zero for the first page
+	After Cursor
+}
+
+// ParsePageRequest reads the "limit" and "cursor" query parameters. The error's message is
+// meant for the client, answer it with a 422 validation error.
+func ParsePageRequest(r *http.Request, limits PageLimits) (PageRequest, error) {
+	page := PageRequest{Limit: limits.Default}
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > limits.Max {
+			return PageRequest{}, fmt.Errorf("limit must be between 1 and %d", limits.Max)
+		}
+		page.Limit = parsed
+	}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			return PageRequest{}, err
+		}
+		page.After = after
+	}
+
+	return page, nil
+}
+
+// Paginate cuts items, fetched with a limit of one more than the page's so there's a way to
+// tell if another page follows, down to the page. nextCursor is the cursor for the
+// "next_cursor" of the response, empty on the last page. cursor returns an item's cursor.
+func Paginate[T any](items []T, limit int, cursor func(T) Cursor) (page []T, nextCursor string) {
+	if len(items) <= limit {
+		return items, ""
+	}
+
+	items = items[:limit]
+	return items, cursor(items[len(items)-1]).Encode()
+}
@@ -0,0 +1,70 @@
+package httputils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2025, 3, 1, 12, 0, 0, 123456000, time.UTC), ID: uuid.NewString()}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.ID, decoded.ID)
+	assert.False(t, decoded.IsZero())
+	assert.True(t, Cursor{}.IsZero())
+
+	for _, garbage := range []string{"garbage", Cursor{CreatedAt: time.Now(), ID: "not-a-uuid"}.Encode(), "bm8tc2VwYXJhdG9y"} {
+		_, err := DecodeCursor(garbage)
+		assert.Error(t, err, garbage)
+	}
+}
+
+func TestParsePageRequest(t *testing.T) {
+	limits := PageLimits{Default: 20, Max: 100}
+	cursor := Cursor{CreatedAt: time.Now().UTC(), ID: uuid.NewString()}
+
+	parse := func(query string) (PageRequest, error) {
+		return ParsePageRequest(httptest.NewRequest(http.MethodGet, "/?"+query, nil), limits)
+	}
+
+	page, err := parse("")
+	require.NoError(t, err)
+	assert.Equal(t, 20, page.Limit)
+	assert.True(t, page.After.IsZero())
+
+	page, err = parse("limit=5&cursor=" + cursor.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, 5, page.Limit)
+	assert.Equal(t, cursor.ID, page.After.ID)
+
+	for _, query := range []string{"limit=0", "limit=101", "limit=abc", "cursor=garbage"} {
+		_, err := parse(query)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	now := time.Now()
+	items := []Cursor{
+		{CreatedAt: now, ID: uuid.NewString()},
+		{CreatedAt: now.Add(-time.Minute), ID: uuid.NewString()},
+		{CreatedAt: now.Add(-2 * time.Minute), ID: uuid.NewString()},
+	}
+	self := func(c Cursor) Cursor { return c }
+
+	page, next := Paginate(items, 2, self)
+	assert.Len(t, page, 2)
+	assert.Equal(t, items[1].Encode(), next)
+
+	page, next = Paginate(items, 3, self)
+	assert.Len(t, page, 3)
+	assert.Empty(t, next, "no cursor on the last page")
+}
@@ -0,0 +1,18 @@
+package httputils
+
+import "context"
+
+type apiVersionKey struct{}
+
+// WithAPIVersion records the version of the public API a request was routed to, so responses can
+// take the shape of that version
+func WithAPIVersion(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, apiVersionKey{}, version)
+}
+
+// APIVersion is the version of the public API the request was routed to, like 2 for /v2. It's 0
+// for routes outside the versioned API, like /internal and /.well-known.
+func APIVersion(ctx context.Context) int {
+	version, _ := ctx.Value(apiVersionKey{}).(int)
+	return version
+}
@@ -0,0 +1,51 @@
+package internalapi
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeInvalidConfig = "invalid_config"
+
+// ConfigChange is a setting a config reload changed
+type ConfigChange struct {
+	Setting string `json:"setting"`
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
+
+type configReloadResponse struct {
+	Changed []ConfigChange `json:"changed"`
+	// RestartRequired are settings that are different from the running config but only change
+	// on a restart
+	RestartRequired []string `json:"restart_required"`
+}
+
+// reloadConfig loads the config again and applies the settings that can change without a
+// restart. Every replica has to be reloaded.
+func (h *handler) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	changed, restartRequired, err := h.reloadCfg(ctx)
+	if err != nil {
+		// nothing is applied, so a bad config doesn't take the service down
+		slog.ErrorContext(ctx, "error reloading config", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The config couldn't be loaded, the current one is still in use: " + err.Error(),
+			Type:       errTypeInvalidConfig,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	response := configReloadResponse{Changed: changed, RestartRequired: restartRequired}
+	if response.Changed == nil {
+		response.Changed = []ConfigChange{}
+	}
+	if response.RestartRequired == nil {
+		response.RestartRequired = []string{}
+	}
+	httputils.WriteJSONResponse(w, r, http.StatusOK, response)
+}
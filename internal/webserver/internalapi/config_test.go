@@ -0,0 +1,50 @@
+package internalapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadConfig(t *testing.T) {
+	var reloadErr error
+	h := NewHandler(HandlerDeps{
+		DB:   database.NewMemoryDB(),
+		Auth: passthrough,
+		ReloadConfig: func(ctx context.Context) ([]ConfigChange, []string, error) {
+			if reloadErr != nil {
+				return nil, nil, reloadErr
+			}
+			return []ConfigChange{{Setting: "LOG_LEVEL", Old: "info", New: "debug"}}, []string{"HTTP_ADDRESS"}, nil
+		},
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config/reload", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp configReloadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []ConfigChange{{Setting: "LOG_LEVEL", Old: "info", New: "debug"}}, resp.Changed)
+	assert.Equal(t, []string{"HTTP_ADDRESS"}, resp.RestartRequired)
+
+	reloadErr = errors.New("invalid config, 1 problem:\n  - LOG_LEVEL: must be debug, info, warn, or error")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config/reload", nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), errTypeInvalidConfig)
+	assert.Contains(t, w.Body.String(), "LOG_LEVEL")
+
+	t.Run("not served without a reloader", func(t *testing.T) {
+		h := NewHandler(HandlerDeps{DB: database.NewMemoryDB(), Auth: passthrough})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config/reload", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
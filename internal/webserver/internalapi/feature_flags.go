@@ -0,0 +1,156 @@
+package internalapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/featureflags"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// updateFeatureFlagsRequest sets the overrides that are true or false and removes the ones
+// that are null, so the account falls back to the default
+type updateFeatureFlagsRequest struct {
+	FeatureFlags map[string]*bool `json:"feature_flags"`
+}
+
+type featureFlagsResponse struct {
+	// FeatureFlags are the evaluated flags, defaults included
+	FeatureFlags map[string]bool `json:"feature_flags"`
+	// Overrides are the flags set on the account itself
+	Overrides map[string]bool `json:"overrides"`
+}
+
+// accountFeatureFlags evaluates an account's feature flags
+func (h *handler) accountFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeAccountNotFound(w, r)
+		return
+	}
+
+	account, err := h.db.GetAccountByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			writeAccountNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, h.newFeatureFlagsResponse(account))
+}
+
+// updateAccountFeatureFlags sets or clears an account's flag overrides. Flags not in the
+// request are left as they are.
+func (h *handler) updateAccountFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeAccountNotFound(w, r)
+		return
+	}
+
+	var reqBody updateFeatureFlagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	if len(reqBody.FeatureFlags) == 0 {
+		writeInvalidFeatureFlags(w, r)
+		return
+	}
+
+	set := map[string]bool{}
+	var unset []string
+	for name, value := range reqBody.FeatureFlags {
+		if !featureflags.ValidName(name) {
+			writeInvalidFeatureFlags(w, r)
+			return
+		}
+		if value == nil {
+			unset = append(unset, name)
+		} else {
+			set[name] = *value
+		}
+	}
+
+	account, err := h.db.GetAccountByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			writeAccountNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	// like the tag limit this is checked up front, so concurrent updates can overshoot it slightly
+	merged := maps.Clone(account.FeatureFlags)
+	if merged == nil {
+		merged = database.FeatureFlags{}
+	}
+	for _, name := range unset {
+		delete(merged, name)
+	}
+	maps.Copy(merged, set)
+	if len(merged) > featureflags.MaxFlagsPerAccount {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    fmt.Sprintf("An account can override at most %d feature flags", featureflags.MaxFlagsPerAccount),
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	account, err = h.db.UpdateAccountFeatureFlags(ctx, id, set, unset)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			writeAccountNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error updating account feature flags", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	h.recordAuditEvent(r, account.ID, database.AuditEventFeatureFlagsChanged)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, h.newFeatureFlagsResponse(account))
+}
+
+func (h *handler) newFeatureFlagsResponse(account *database.Account) featureFlagsResponse {
+	overrides := map[string]bool(account.FeatureFlags)
+	if overrides == nil {
+		overrides = map[string]bool{}
+	}
+	return featureFlagsResponse{
+		FeatureFlags: h.flags.Evaluate(account.FeatureFlags),
+		Overrides:    overrides,
+	}
+}
+
+func writeInvalidFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Feature flag names must be 1-50 lowercase letters, digits, hyphens or underscores",
+		Type:       errTypeValidationError,
+		StatusCode: http.StatusUnprocessableEntity,
+	})
+}
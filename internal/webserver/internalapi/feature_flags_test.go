@@ -0,0 +1,118 @@
+package internalapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/featureflags"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountFeatureFlags(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "flags@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	h := NewHandler(HandlerDeps{
+		DB:           db,
+		Auth:         passthrough,
+		FeatureFlags: featureflags.NewEvaluator(featureflags.Config{Defaults: map[string]bool{"new-dashboard": true}}),
+	})
+
+	path := "/accounts/" + account.ID + "/feature-flags"
+
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		body             string
+		expectedStatus   int
+		expectedResponse *featureFlagsResponse
+	}{
+		{
+			name:           "defaults before any overrides",
+			method:         http.MethodGet,
+			path:           path,
+			expectedStatus: http.StatusOK,
+			expectedResponse: &featureFlagsResponse{
+				FeatureFlags: map[string]bool{"new-dashboard": true},
+				Overrides:    map[string]bool{},
+			},
+		},
+		{
+			name:           "set overrides",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"feature_flags":{"new-dashboard":false,"exports":true}}`,
+			expectedStatus: http.StatusOK,
+			expectedResponse: &featureFlagsResponse{
+				FeatureFlags: map[string]bool{"new-dashboard": false, "exports": true},
+				Overrides:    map[string]bool{"new-dashboard": false, "exports": true},
+			},
+		},
+		{
+			name:           "null clears an override",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"feature_flags":{"new-dashboard":null}}`,
+			expectedStatus: http.StatusOK,
+			expectedResponse: &featureFlagsResponse{
+				FeatureFlags: map[string]bool{"new-dashboard": true, "exports": true},
+				Overrides:    map[string]bool{"exports": true},
+			},
+		},
+		{
+			name:           "invalid flag name",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"feature_flags":{"New Dashboard":true}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "no flags",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"feature_flags":{}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "malformed body",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"feature_flags":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing account",
+			method:         http.MethodGet,
+			path:           "/accounts/" + uuid.NewString() + "/feature-flags",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+
+			if tt.expectedResponse != nil {
+				var resp featureFlagsResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, *tt.expectedResponse, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package internalapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/austinwofford/account-management/pkg/accountspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// RegisterGRPC registers the gRPC versions of the internal routes on s, for services that call
+// this one over gRPC: accountspb.AccountLookup is POST /accounts/lookup.
+func RegisterGRPC(s *grpc.Server, db Repository) {
+	accountspb.RegisterAccountLookupServer(s, &lookupServer{db: db})
+}
+
+type lookupServer struct {
+	accountspb.UnimplementedAccountLookupServer
+
+	db Repository
+}
+
+func (s *lookupServer) LookupAccounts(ctx context.Context, req *accountspb.LookupAccountsRequest) (*accountspb.LookupAccountsResponse, error) {
+	result, err := lookup(ctx, s.db, req.GetIds(), req.GetEmails())
+	if errors.Is(err, errLookupBatchSize) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error looking up accounts", "error", err)
+		return nil, status.Error(codes.Internal, "there was an unexpected error")
+	}
+
+	resp := &accountspb.LookupAccountsResponse{
+		MissingIds:    result.missingIDs,
+		MissingEmails: result.missingEmails,
+	}
+	for _, a := range result.accounts {
+		resp.Accounts = append(resp.Accounts, &accountspb.AccountProfile{
+			Id:              a.ID,
+			Email:           a.Email,
+			PreferredLocale: a.PreferredLocale,
+			Tags:            a.Tags,
+			FrozenAt:        timestampOrNil(a.FrozenAt),
+			VerifiedAt:      timestampOrNil(a.VerifiedAt),
+			CreatedAt:       timestamppb.New(a.CreatedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func timestampOrNil(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,73 @@
+package internalapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/pkg/accountspb"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestLookupAccountsGRPC(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	alice, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "alice@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	bob, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "bob@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	_, err = db.VerifyAccount(ctx, bob.ID)
+	require.NoError(t, err)
+
+	// the client certificate check is the server's interceptor, see webserver.NewGRPCServer
+	ln := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	RegisterGRPC(srv, db)
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	client := accountspb.NewAccountLookupClient(conn)
+
+	missingID := uuid.NewString()
+	resp, err := client.LookupAccounts(ctx, &accountspb.LookupAccountsRequest{
+		Ids:    []string{alice.ID, missingID},
+		Emails: []string{"bob@test.com", "alice@test.com", "nobody@test.com"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, resp.Accounts, 2)
+	assert.Equal(t, alice.ID, resp.Accounts[0].Id)
+	assert.Equal(t, "alice@test.com", resp.Accounts[0].Email)
+	assert.Equal(t, alice.CreatedAt.UTC(), resp.Accounts[0].CreatedAt.AsTime())
+	assert.Nil(t, resp.Accounts[0].VerifiedAt)
+	assert.Equal(t, bob.ID, resp.Accounts[1].Id)
+	assert.NotNil(t, resp.Accounts[1].VerifiedAt)
+	assert.Equal(t, []string{missingID}, resp.MissingIds)
+	assert.Equal(t, []string{"nobody@test.com"}, resp.MissingEmails)
+
+	_, err = client.LookupAccounts(ctx, &accountspb.LookupAccountsRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	tooMany := make([]string, MaxLookupBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("user%d@test.com", i)
+	}
+	_, err = client.LookupAccounts(ctx, &accountspb.LookupAccountsRequest{Emails: tooMany})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,120 @@
+// Package internalapi serves the /internal routes for trusted backend services. None of these
+// routes are reachable without service authentication.
+package internalapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/featureflags"
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// Repository defines the DB methods needed by internal handlers
+type Repository interface {
+	GetAccountsByIDs(ctx context.Context, ids []string) ([]database.Account, error)
+	GetAccountsByEmails(ctx context.Context, emails []string) ([]database.Account, error)
+	GetAccountByID(ctx context.Context, id string) (*database.Account, error)
+	UpdateAccountFeatureFlags(ctx context.Context, id string, set map[string]bool, unset []string) (*database.Account, error)
+	UpdateAccountMetadata(ctx context.Context, id string, params database.UpdateAccountMetadataParams) (*database.Account, error)
+	CreateAuditEvent(ctx context.Context, params database.CreateAuditEventParams) error
+	CreateWebhookEndpoint(ctx context.Context, params database.CreateWebhookEndpointParams) (*database.WebhookEndpoint, error)
+	GetWebhookEndpoint(ctx context.Context, id string) (*database.WebhookEndpoint, error)
+	ListWebhookEndpoints(ctx context.Context) ([]database.WebhookEndpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, id string) error
+	GetWebhookDelivery(ctx context.Context, id string) (*database.WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, params database.ListWebhookDeliveriesParams) ([]database.WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, id string, now time.Time) (*database.WebhookDelivery, error)
+}
+
+type handler struct {
+	db          Repository
+	flags       *featureflags.Evaluator
+	signingKeys *auth.KeyRing
+	reloadKeys  func() error
+	reloadCfg   func(ctx context.Context) ([]ConfigChange, []string, error)
+	auditLog    audit.Recorder
+
+	chi.Router
+}
+
+type HandlerDeps struct {
+	DB Repository
+	// Auth authenticates the calling service
+	Auth func(http.Handler) http.Handler
+	// FeatureFlags evaluates per-account feature flags. Defaults to every flag off.
+	FeatureFlags *featureflags.Evaluator
+	// SigningKeys are the keys tokens are signed with and ReloadSigningKeys reads them again
+	// and rotates to them. Optional, the signing key routes aren't served without them.
+	SigningKeys       *auth.KeyRing
+	ReloadSigningKeys func() error
+	// ReloadConfig loads the config again and applies the settings that can change without a
+	// restart, returning the ones it changed and the ones that need a restart. Optional, the
+	// reload route isn't served without it.
+	ReloadConfig func(ctx context.Context) (changed []ConfigChange, restartRequired []string, err error)
+	// AuditLog records changes made to accounts. Defaults to writing them to DB before
+	// responding.
+	AuditLog audit.Recorder
+}
+
+func NewHandler(deps HandlerDeps) http.Handler {
+	mux := chi.NewMux()
+
+	h := handler{
+		db:          deps.DB,
+		flags:       deps.FeatureFlags,
+		signingKeys: deps.SigningKeys,
+		reloadKeys:  deps.ReloadSigningKeys,
+		reloadCfg:   deps.ReloadConfig,
+		auditLog:    deps.AuditLog,
+	}
+
+	if h.flags == nil {
+		h.flags = featureflags.NewEvaluator(featureflags.Config{})
+	}
+	if h.auditLog == nil {
+		h.auditLog = audit.Sync(deps.DB.CreateAuditEvent)
+	}
+
+	mux.Use(deps.Auth)
+
+	mux.Post("/accounts/lookup", h.lookupAccounts)
+	mux.Get("/accounts/{id}/feature-flags", h.accountFeatureFlags)
+	mux.Patch("/accounts/{id}/feature-flags", h.updateAccountFeatureFlags)
+	mux.Get("/accounts/{id}/metadata", h.accountMetadata)
+	mux.Patch("/accounts/{id}/metadata", h.updateAccountMetadata)
+
+	mux.Get("/webhooks", h.listWebhooks)
+	mux.Post("/webhooks", h.createWebhook)
+	mux.Delete("/webhooks/{id}", h.deleteWebhook)
+	mux.Get("/webhooks/{id}/deliveries", h.listWebhookDeliveries)
+	mux.Post("/webhooks/{id}/deliveries/{deliveryID}/replay", h.replayWebhookDelivery)
+
+	if h.signingKeys != nil && h.reloadKeys != nil {
+		mux.Get("/signing-keys", h.listSigningKeys)
+		mux.Post("/signing-keys/reload", h.reloadSigningKeys)
+	}
+	if h.reloadCfg != nil {
+		mux.Post("/config/reload", h.reloadConfig)
+	}
+
+	h.Router = mux
+
+	return h
+}
+
+// recordAuditEvent records a change a service made to the account
+func (h *handler) recordAuditEvent(r *http.Request, accountID, eventType string) {
+	ctx := r.Context()
+	h.auditLog.Record(ctx, database.CreateAuditEventParams{
+		AccountID: accountID,
+		EventType: eventType,
+		UserAgent: r.UserAgent(),
+		RequestID: chimiddleware.GetReqID(ctx),
+	})
+}
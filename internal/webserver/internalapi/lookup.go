@@ -0,0 +1,210 @@
+package internalapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/google/uuid"
+)
+
+// MaxLookupBatchSize caps the IDs plus emails in a single lookup
+const MaxLookupBatchSize = 100
+
+const (
+	errTypeValidationError = "validation_error"
+	errTypeAccountNotFound = "account_not_found"
+)
+
+type lookupRequest struct {
+	IDs    []string `json:"ids"`
+	Emails []string `json:"emails"`
+}
+
+// accountProfile is what other services get to see about an account
+type accountProfile struct {
+	ID              string     `json:"id"`
+	Email           string     `json:"email"`
+	PreferredLocale string     `json:"preferred_locale"`
+	Tags            []string   `json:"tags"`
+	FrozenAt        *time.Time `json:"frozen_at,omitempty"`
+	VerifiedAt      *time.Time `json:"verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+func newAccountProfile(a database.Account) accountProfile {
+	tags := []string(a.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+	return accountProfile{
+		ID:              a.ID,
+		Email:           a.Email,
+		PreferredLocale: a.PreferredLocale,
+		Tags:            tags,
+		FrozenAt:        a.FrozenAt,
+		VerifiedAt:      a.VerifiedAt,
+		CreatedAt:       a.CreatedAt,
+	}
+}
+
+// lookupResponse has the accounts that were found. Lookups are partial: IDs and emails without
+// an account are listed in the missing fields rather than failing the whole request.
+type lookupResponse struct {
+	Accounts      []accountProfile `json:"accounts"`
+	MissingIDs    []string         `json:"missing_ids"`
+	MissingEmails []string         `json:"missing_emails"`
+}
+
+// lookupAccounts resolves a batch of account IDs and/or emails in one call so services rendering
+// lists of accounts don't need a request per account
+func (h *handler) lookupAccounts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody lookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	result, err := lookup(ctx, h.db, reqBody.IDs, reqBody.Emails)
+	if errors.Is(err, errLookupBatchSize) {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    fmt.Sprintf("Between 1 and %d IDs and emails can be looked up at once", MaxLookupBatchSize),
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error looking up accounts", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	resp := lookupResponse{
+		Accounts:      []accountProfile{},
+		MissingIDs:    append([]string{}, result.missingIDs...),
+		MissingEmails: append([]string{}, result.missingEmails...),
+	}
+	for _, a := range result.accounts {
+		resp.Accounts = append(resp.Accounts, newAccountProfile(a))
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, resp)
+}
+
+var errLookupBatchSize = fmt.Errorf("between 1 and %d IDs and emails can be looked up at once", MaxLookupBatchSize)
+
+type lookupResult struct {
+	// accounts follow the request order, with each account included once
+	accounts      []database.Account
+	missingIDs    []string
+	missingEmails []string
+}
+
+// lookup resolves account IDs and emails with a query for each kind rather than one per account,
+// for both the HTTP and gRPC lookups. It's errLookupBatchSize when there are none or too many.
+func lookup(ctx context.Context, db Repository, ids, emails []string) (lookupResult, error) {
+	ids = dedupe(ids)
+	emails = dedupe(emails)
+
+	if len(ids)+len(emails) == 0 || len(ids)+len(emails) > MaxLookupBatchSize {
+		return lookupResult{}, errLookupBatchSize
+	}
+
+	// something that isn't a UUID can't be an account ID, and would fail the query
+	var validIDs []string
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err == nil {
+			validIDs = append(validIDs, id)
+		}
+	}
+
+	byID := map[string]database.Account{}
+	byEmail := map[string]database.Account{}
+
+	if len(validIDs) > 0 {
+		accounts, err := db.GetAccountsByIDs(ctx, validIDs)
+		if err != nil {
+			return lookupResult{}, fmt.Errorf("error looking up accounts by ID: %w", err)
+		}
+		for _, a := range accounts {
+			byID[a.ID] = a
+		}
+	}
+
+	if len(emails) > 0 {
+		accounts, err := db.GetAccountsByEmails(ctx, emails)
+		if err != nil {
+			return lookupResult{}, fmt.Errorf("error looking up accounts by email: %w", err)
+		}
+		for _, a := range accounts {
+			byEmail[a.Email] = a
+		}
+	}
+
+	var result lookupResult
+	seen := map[string]bool{}
+	add := func(a database.Account) {
+		if seen[a.ID] {
+			return
+		}
+		seen[a.ID] = true
+		result.accounts = append(result.accounts, a)
+	}
+
+	for _, id := range ids {
+		if a, ok := byID[id]; ok {
+			add(a)
+		} else {
+			result.missingIDs = append(result.missingIDs, id)
+		}
+	}
+	for _, email := range emails {
+		if a, ok := byEmail[email]; ok {
+			add(a)
+		} else {
+			result.missingEmails = append(result.missingEmails, email)
+		}
+	}
+
+	return result, nil
+}
+
+func dedupe(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
+
+func writeUnexpectedError(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "There was an unexpected error",
+		StatusCode: http.StatusInternalServerError,
+	})
+}
+
+func writeAccountNotFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "The account was not found",
+		Type:       errTypeAccountNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
@@ -0,0 +1,122 @@
+package internalapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func passthrough(next http.Handler) http.Handler { return next }
+
+func TestLookupAccounts(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	alice, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "alice@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	bob, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "bob@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	h := NewHandler(HandlerDeps{DB: db, Auth: passthrough})
+
+	missingID := uuid.NewString()
+
+	tooMany := make([]string, MaxLookupBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("user%d@test.com", i)
+	}
+	tooManyBody, _ := json.Marshal(lookupRequest{Emails: tooMany})
+
+	tests := []struct {
+		name             string
+		body             string
+		expectedStatus   int
+		expectedResponse *lookupResponse
+	}{
+		{
+			name:           "partial results",
+			body:           fmt.Sprintf(`{"ids":[%q,%q,"not-a-uuid"],"emails":["bob@test.com","nobody@test.com"]}`, alice.ID, missingID),
+			expectedStatus: http.StatusOK,
+			expectedResponse: &lookupResponse{
+				Accounts: []accountProfile{
+					{ID: alice.ID, Email: alice.Email, PreferredLocale: "en", Tags: []string{}, CreatedAt: alice.CreatedAt},
+					{ID: bob.ID, Email: bob.Email, PreferredLocale: "en", Tags: []string{}, CreatedAt: bob.CreatedAt},
+				},
+				MissingIDs:    []string{missingID, "not-a-uuid"},
+				MissingEmails: []string{"nobody@test.com"},
+			},
+		},
+		{
+			name:           "same account by ID and email is returned once",
+			body:           fmt.Sprintf(`{"ids":[%q,%q],"emails":["alice@test.com"]}`, alice.ID, alice.ID),
+			expectedStatus: http.StatusOK,
+			expectedResponse: &lookupResponse{
+				Accounts:      []accountProfile{{ID: alice.ID, Email: alice.Email, PreferredLocale: "en", Tags: []string{}, CreatedAt: alice.CreatedAt}},
+				MissingIDs:    []string{},
+				MissingEmails: []string{},
+			},
+		},
+		{
+			name:           "empty batch",
+			body:           `{"ids":[],"emails":[]}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "batch too large",
+			body:           string(tooManyBody),
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "malformed body",
+			body:           `{"ids":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/accounts/lookup", bytes.NewReader([]byte(tt.body)))
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+
+			if tt.expectedResponse != nil {
+				var resp lookupResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				for i := range resp.Accounts {
+					// JSON drops the monotonic clock reading
+					resp.Accounts[i].CreatedAt = tt.expectedResponse.Accounts[i].CreatedAt
+				}
+				assert.Equal(t, *tt.expectedResponse, resp)
+			}
+		})
+	}
+}
+
+func TestLookupAccountsRequiresAuth(t *testing.T) {
+	deny := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}
+
+	h := NewHandler(HandlerDeps{DB: database.NewMemoryDB(), Auth: deny})
+
+	req := httptest.NewRequest(http.MethodPost, "/accounts/lookup", strings.NewReader(`{"emails":["a@test.com"]}`))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,120 @@
+package internalapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/metadata"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// updateMetadataRequest changes the keys in either object, keys set to null are removed. Keys
+// not in the request are left as they are.
+type updateMetadataRequest struct {
+	UserMetadata metadata.Patch `json:"user_metadata"`
+	AppMetadata  metadata.Patch `json:"app_metadata"`
+}
+
+type metadataResponse struct {
+	UserMetadata database.Metadata `json:"user_metadata"`
+	AppMetadata  database.Metadata `json:"app_metadata"`
+}
+
+// accountMetadata returns an account's user and app metadata
+func (h *handler) accountMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeAccountNotFound(w, r)
+		return
+	}
+
+	account, err := h.db.GetAccountByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrAccountNotFound) {
+			writeAccountNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error getting account", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, newMetadataResponse(account))
+}
+
+// updateAccountMetadata changes an account's user and app metadata
+func (h *handler) updateAccountMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeAccountNotFound(w, r)
+		return
+	}
+
+	var reqBody updateMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+	if len(reqBody.UserMetadata) == 0 && len(reqBody.AppMetadata) == 0 {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The request needs at least one user_metadata or app_metadata key to change",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	account, err := metadata.Apply(ctx, h.db, id, metadata.Update{User: reqBody.UserMetadata, App: reqBody.AppMetadata})
+	if err != nil {
+		switch {
+		case errors.Is(err, metadata.ErrInvalidKey), errors.Is(err, metadata.ErrTooLarge):
+			writeInvalidMetadata(w, r, err)
+		case errors.Is(err, database.ErrAccountNotFound):
+			writeAccountNotFound(w, r)
+		default:
+			slog.ErrorContext(ctx, "error updating account metadata", "error", err)
+			writeUnexpectedError(w, r)
+		}
+		return
+	}
+
+	h.recordAuditEvent(r, account.ID, database.AuditEventMetadataChanged)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, newMetadataResponse(account))
+}
+
+func newMetadataResponse(account *database.Account) metadataResponse {
+	resp := metadataResponse{UserMetadata: account.UserMetadata, AppMetadata: account.AppMetadata}
+	if resp.UserMetadata == nil {
+		resp.UserMetadata = database.Metadata{}
+	}
+	if resp.AppMetadata == nil {
+		resp.AppMetadata = database.Metadata{}
+	}
+	return resp
+}
+
+func writeInvalidMetadata(w http.ResponseWriter, r *http.Request, err error) {
+	message := "Metadata keys must be 1-64 letters, digits, hyphens or underscores"
+	if errors.Is(err, metadata.ErrTooLarge) {
+		message = fmt.Sprintf("Metadata can be at most %d bytes", metadata.MaxBytes)
+	}
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    message,
+		Type:       errTypeValidationError,
+		StatusCode: http.StatusUnprocessableEntity,
+	})
+}
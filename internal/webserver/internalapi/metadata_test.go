@@ -0,0 +1,126 @@
+package internalapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/metadata"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "metadata@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+
+	h := NewHandler(HandlerDeps{DB: db, Auth: passthrough})
+
+	path := "/accounts/" + account.ID + "/metadata"
+
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		body             string
+		expectedStatus   int
+		expectedResponse *metadataResponse
+	}{
+		{
+			name:           "empty before any is set",
+			method:         http.MethodGet,
+			path:           path,
+			expectedStatus: http.StatusOK,
+			expectedResponse: &metadataResponse{
+				UserMetadata: database.Metadata{},
+				AppMetadata:  database.Metadata{},
+			},
+		},
+		{
+			name:           "set keys",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"user_metadata":{"theme":"dark"},"app_metadata":{"plan":"pro","seats":5}}`,
+			expectedStatus: http.StatusOK,
+			expectedResponse: &metadataResponse{
+				UserMetadata: database.Metadata{"theme": json.RawMessage(`"dark"`)},
+				AppMetadata:  database.Metadata{"plan": json.RawMessage(`"pro"`), "seats": json.RawMessage(`5`)},
+			},
+		},
+		{
+			name:           "null removes a key",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"app_metadata":{"seats":null}}`,
+			expectedStatus: http.StatusOK,
+			expectedResponse: &metadataResponse{
+				UserMetadata: database.Metadata{"theme": json.RawMessage(`"dark"`)},
+				AppMetadata:  database.Metadata{"plan": json.RawMessage(`"pro"`)},
+			},
+		},
+		{
+			name:           "invalid key",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"app_metadata":{"billing plan":"pro"}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "too large",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"user_metadata":{"notes":"` + strings.Repeat("a", metadata.MaxBytes) + `"}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "nothing to change",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"app_metadata":{}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "malformed body",
+			method:         http.MethodPatch,
+			path:           path,
+			body:           `{"app_metadata":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing account",
+			method:         http.MethodPatch,
+			path:           "/accounts/" + uuid.NewString() + "/metadata",
+			body:           `{"app_metadata":{"plan":"pro"}}`,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+
+			if tt.expectedResponse != nil {
+				var resp metadataResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, *tt.expectedResponse, resp)
+			}
+		})
+	}
+
+	events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{AccountID: account.ID, EventType: database.AuditEventMetadataChanged})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
@@ -0,0 +1,53 @@
+package internalapi
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeInvalidSigningKeys = "invalid_signing_keys"
+
+type signingKeysResponse struct {
+	// SigningKeyID is the key new tokens are signed with
+	SigningKeyID string `json:"signing_key_id"`
+	// KeyIDs are every key tokens are verified with, including keys that were rotated out and
+	// still verify the tokens they signed
+	KeyIDs []string `json:"key_ids"`
+}
+
+func (h *handler) newSigningKeysResponse() signingKeysResponse {
+	return signingKeysResponse{
+		SigningKeyID: h.signingKeys.SigningKeyID(),
+		KeyIDs:       h.signingKeys.KeyIDs(),
+	}
+}
+
+// listSigningKeys lists the token signing keys in use
+func (h *handler) listSigningKeys(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteJSONResponse(w, r, http.StatusOK, h.newSigningKeysResponse())
+}
+
+// reloadSigningKeys reads the signing keys again and rotates to them without a restart. Keys
+// that were removed keep verifying the tokens they signed until those expire. Every replica has
+// to be reloaded.
+func (h *handler) reloadSigningKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := h.reloadKeys(); err != nil {
+		// the keys in use are kept, so a bad key file doesn't take tokens down
+		slog.ErrorContext(ctx, "error reloading signing keys", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The signing keys couldn't be loaded, the current keys are still in use: " + err.Error(),
+			Type:       errTypeInvalidSigningKeys,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	response := h.newSigningKeysResponse()
+	slog.InfoContext(ctx, "reloaded signing keys", "signing_key_id", response.SigningKeyID, "key_ids", response.KeyIDs)
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,82 @@
+package internalapi
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigningKeys(t *testing.T) {
+	generateKey := func(t *testing.T) *auth.SigningKey {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		key, err := auth.NewSigningKey(private)
+		require.NoError(t, err)
+		return key
+	}
+
+	oldKey, newKey := generateKey(t), generateKey(t)
+	signingKeys, err := auth.NewKeyRing([]*auth.SigningKey{oldKey})
+	require.NoError(t, err)
+	authClient := auth.NewClient(auth.Config{AccessTokenTTLMinutes: 15, SigningKeys: signingKeys})
+
+	// what the key file holds
+	configured := []*auth.SigningKey{newKey}
+	var reloadErr error
+
+	h := NewHandler(HandlerDeps{
+		DB:          database.NewMemoryDB(),
+		Auth:        passthrough,
+		SigningKeys: signingKeys,
+		ReloadSigningKeys: func() error {
+			if reloadErr != nil {
+				return reloadErr
+			}
+			return authClient.RotateSigningKeys(configured)
+		},
+	})
+
+	do := func(method, path string) (*httptest.ResponseRecorder, signingKeysResponse) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		var resp signingKeysResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	w, resp := do(http.MethodGet, "/signing-keys")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, oldKey.ID(), resp.SigningKeyID)
+	assert.Equal(t, []string{oldKey.ID()}, resp.KeyIDs)
+
+	// the old key is rotated out but still verifies its tokens
+	w, resp = do(http.MethodPost, "/signing-keys/reload")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, newKey.ID(), resp.SigningKeyID)
+	assert.ElementsMatch(t, []string{oldKey.ID(), newKey.ID()}, resp.KeyIDs)
+
+	// a bad key file leaves the keys alone
+	reloadErr = errors.New("error reading JWT_SIGNING_KEY_FILE")
+	w, _ = do(http.MethodPost, "/signing-keys/reload")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), errTypeInvalidSigningKeys)
+	assert.Equal(t, newKey.ID(), signingKeys.SigningKeyID())
+
+	t.Run("not served without signing keys", func(t *testing.T) {
+		h := NewHandler(HandlerDeps{DB: database.NewMemoryDB(), Auth: passthrough})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/signing-keys/reload", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,306 @@
+package internalapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/webhooks"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	errTypeWebhookNotFound         = "webhook_not_found"
+	errTypeWebhookDeliveryNotFound = "webhook_delivery_not_found"
+)
+
+// deliveryPageLimits are how many deliveries a page of an endpoint's deliveries has
+var deliveryPageLimits = httputils.PageLimits{Default: 50, Max: 200}
+
+type createWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+type webhookResponse struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Secret verifies the payloads' signatures. It's only returned when the endpoint is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+func newWebhookResponse(e database.WebhookEndpoint) webhookResponse {
+	return webhookResponse{
+		ID:         e.ID,
+		URL:        e.URL,
+		EventTypes: e.EventTypes,
+		CreatedAt:  e.CreatedAt,
+	}
+}
+
+type listWebhooksResponse struct {
+	Webhooks []webhookResponse `json:"webhooks"`
+}
+
+type webhookDeliveryResponse struct {
+	ID             string          `json:"id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+func newWebhookDeliveryResponse(d database.WebhookDelivery) webhookDeliveryResponse {
+	resp := webhookDeliveryResponse{
+		ID:             d.ID,
+		EventType:      d.EventType,
+		Payload:        json.RawMessage(d.Payload),
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		DeliveredAt:    d.DeliveredAt,
+		CreatedAt:      d.CreatedAt,
+	}
+	// only pending deliveries are tried again
+	if d.Status == database.WebhookDeliveryPending {
+		resp.NextAttemptAt = &d.NextAttemptAt
+	}
+	return resp
+}
+
+type listWebhookDeliveriesResponse struct {
+	Deliveries []webhookDeliveryResponse `json:"deliveries"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+}
+
+// createWebhook registers an endpoint for events. The response has the secret the endpoint's
+// payloads are signed with, which isn't shown again.
+func (h *handler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	u, err := url.Parse(reqBody.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		writeWebhookValidationError(w, r, "url must be an absolute http or https URL")
+		return
+	}
+
+	if len(reqBody.EventTypes) == 0 {
+		writeWebhookValidationError(w, r, "event_types must list at least one event type")
+		return
+	}
+	for _, eventType := range reqBody.EventTypes {
+		if !webhooks.ValidEventType(eventType) {
+			writeWebhookValidationError(w, r, fmt.Sprintf("event_types must be some of %s", strings.Join(webhooks.EventTypes, ", ")))
+			return
+		}
+	}
+	eventTypes := slices.Clone(reqBody.EventTypes)
+	slices.Sort(eventTypes)
+	eventTypes = slices.Compact(eventTypes)
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		slog.ErrorContext(ctx, "error generating webhook secret", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	endpoint, err := h.db.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{
+		URL:        u.String(),
+		Secret:     hex.EncodeToString(secret),
+		EventTypes: eventTypes,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating webhook endpoint", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	resp := newWebhookResponse(*endpoint)
+	resp.Secret = endpoint.Secret
+	httputils.WriteJSONResponse(w, r, http.StatusCreated, resp)
+}
+
+// listWebhooks lists the registered endpoints, oldest first
+func (h *handler) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	endpoints, err := h.db.ListWebhookEndpoints(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing webhook endpoints", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	resp := listWebhooksResponse{Webhooks: []webhookResponse{}}
+	for _, e := range endpoints {
+		resp.Webhooks = append(resp.Webhooks, newWebhookResponse(e))
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, resp)
+}
+
+// deleteWebhook unregisters an endpoint. Its deliveries are deleted too, including the pending
+// ones.
+func (h *handler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeWebhookNotFound(w, r)
+		return
+	}
+
+	if err := h.db.DeleteWebhookEndpoint(ctx, id); err != nil {
+		if errors.Is(err, database.ErrWebhookEndpointNotFound) {
+			writeWebhookNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error deleting webhook endpoint", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveries pages through an endpoint's deliveries newest first
+func (h *handler) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeWebhookNotFound(w, r)
+		return
+	}
+
+	page, err := httputils.ParsePageRequest(r, deliveryPageLimits)
+	if err != nil {
+		writeWebhookValidationError(w, r, err.Error())
+		return
+	}
+
+	if _, err := h.db.GetWebhookEndpoint(ctx, id); err != nil {
+		if errors.Is(err, database.ErrWebhookEndpointNotFound) {
+			writeWebhookNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error getting webhook endpoint", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	deliveries, err := h.db.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{
+		EndpointID: id,
+		Keyset: database.Keyset{
+			BeforeCreatedAt: page.After.CreatedAt,
+			BeforeID:        page.After.ID,
+			// fetch one extra to know if there's another page
+			Limit: page.Limit + 1,
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing webhook deliveries", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	resp := listWebhookDeliveriesResponse{Deliveries: []webhookDeliveryResponse{}}
+	deliveries, resp.NextCursor = httputils.Paginate(deliveries, page.Limit, func(d database.WebhookDelivery) httputils.Cursor {
+		return httputils.Cursor{CreatedAt: d.CreatedAt, ID: d.ID}
+	})
+
+	for _, d := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, newWebhookDeliveryResponse(d))
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, resp)
+}
+
+// replayWebhookDelivery posts a delivery again, e.g. once a failed one's endpoint is fixed
+func (h *handler) replayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	endpointID := chi.URLParam(r, "id")
+	deliveryID := chi.URLParam(r, "deliveryID")
+	if _, err := uuid.Parse(deliveryID); err != nil {
+		writeWebhookDeliveryNotFound(w, r)
+		return
+	}
+
+	delivery, err := h.db.GetWebhookDelivery(ctx, deliveryID)
+	if err != nil && !errors.Is(err, database.ErrWebhookDeliveryNotFound) {
+		slog.ErrorContext(ctx, "error getting webhook delivery", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+	if delivery == nil || delivery.EndpointID != endpointID {
+		writeWebhookDeliveryNotFound(w, r)
+		return
+	}
+
+	delivery, err = h.db.ReplayWebhookDelivery(ctx, deliveryID, time.Now())
+	if err != nil {
+		if errors.Is(err, database.ErrWebhookDeliveryNotFound) {
+			writeWebhookDeliveryNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error replaying webhook delivery", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusAccepted, newWebhookDeliveryResponse(*delivery))
+}
+
+func writeWebhookValidationError(w http.ResponseWriter, r *http.Request, message string) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    message,
+		Type:       errTypeValidationError,
+		StatusCode: http.StatusUnprocessableEntity,
+	})
+}
+
+func writeWebhookNotFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "The webhook was not found",
+		Type:       errTypeWebhookNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
+
+func writeWebhookDeliveryNotFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "The webhook delivery was not found",
+		Type:       errTypeWebhookDeliveryNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
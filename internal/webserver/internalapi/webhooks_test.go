@@ -0,0 +1,131 @@
+package internalapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/webhooks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	h := NewHandler(HandlerDeps{DB: db, Auth: passthrough})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		tests := []struct {
+			name string
+			body string
+		}{
+			{name: "relative url", body: `{"url":"/hook","event_types":["account.created"]}`},
+			{name: "unsupported scheme", body: `{"url":"ftp://example.com/hook","event_types":["account.created"]}`},
+			{name: "no event types", body: `{"url":"https://example.com/hook","event_types":[]}`},
+			{name: "unknown event type", body: `{"url":"https://example.com/hook","event_types":["account.renamed"]}`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rr := do(http.MethodPost, "/webhooks", tt.body)
+				assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+			})
+		}
+	})
+
+	rr := do(http.MethodPost, "/webhooks", `{"url":"https://example.com/hook","event_types":["login.failed","account.created","login.failed"]}`)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var created webhookResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.NotEmpty(t, created.Secret)
+	assert.Equal(t, []string{"account.created", "login.failed"}, created.EventTypes)
+
+	t.Run("list hides secrets", func(t *testing.T) {
+		rr := do(http.MethodGet, "/webhooks", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), created.Secret)
+
+		var resp listWebhooksResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.Len(t, resp.Webhooks, 1)
+		assert.Equal(t, created.ID, resp.Webhooks[0].ID)
+	})
+
+	n, err := db.CreateWebhookDeliveries(ctx, webhooks.EventLoginFailed, `{"id":"1"}`)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+	_, err = db.CreateWebhookDeliveries(ctx, webhooks.EventLoginFailed, `{"id":"2"}`)
+	require.NoError(t, err)
+
+	var deliveries []webhookDeliveryResponse
+	t.Run("list deliveries", func(t *testing.T) {
+		rr := do(http.MethodGet, "/webhooks/"+created.ID+"/deliveries?limit=1", "")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var resp listWebhookDeliveriesResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.Len(t, resp.Deliveries, 1)
+		require.NotEmpty(t, resp.NextCursor)
+		assert.JSONEq(t, `{"id":"2"}`, string(resp.Deliveries[0].Payload))
+		deliveries = append(deliveries, resp.Deliveries...)
+
+		rr = do(http.MethodGet, "/webhooks/"+created.ID+"/deliveries?limit=1&cursor="+resp.NextCursor, "")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		resp = listWebhookDeliveriesResponse{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.Len(t, resp.Deliveries, 1)
+		assert.Empty(t, resp.NextCursor)
+		deliveries = append(deliveries, resp.Deliveries...)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		require.Len(t, deliveries, 2)
+		id := deliveries[0].ID
+		require.NoError(t, db.RecordWebhookAttempt(ctx, id, database.WebhookAttempt{
+			Status:         database.WebhookDeliveryFailed,
+			LastStatusCode: http.StatusInternalServerError,
+			LastError:      "endpoint answered 500 Internal Server Error",
+			At:             time.Now(),
+		}))
+
+		rr := do(http.MethodPost, "/webhooks/"+created.ID+"/deliveries/"+id+"/replay", "")
+		require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+
+		var resp webhookDeliveryResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		assert.Equal(t, database.WebhookDeliveryPending, resp.Status)
+		assert.Zero(t, resp.Attempts)
+
+		rr = do(http.MethodPost, "/webhooks/"+uuid.NewString()+"/deliveries/"+id+"/replay", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		rr := do(http.MethodDelete, "/webhooks/"+created.ID, "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = do(http.MethodDelete, "/webhooks/"+created.ID, "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = do(http.MethodGet, "/webhooks/"+created.ID+"/deliveries", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		_, err := db.GetWebhookDelivery(ctx, deliveries[0].ID)
+		assert.ErrorIs(t, err, database.ErrWebhookDeliveryNotFound)
+	})
+}
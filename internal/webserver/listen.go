@@ -0,0 +1,25 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/austinwofford/account-management/internal/config"
+)
+
+// Listen opens the server's TCP listener. With ListenReusePort several processes can listen on
+// the same address at once, so a deploy can start the new binary, wait for it to be ready, and
+// only then stop the old one, which stops accepting and drains its open connections.
+func Listen(ctx context.Context, cfg config.Config) (net.Listener, error) {
+	var lc net.ListenConfig
+	if cfg.ListenReusePort {
+		lc.Control = reusePortControl
+	}
+
+	ln, err := lc.Listen(ctx, "tcp", cfg.HTTPAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %w", cfg.HTTPAddress, err)
+	}
+	return ln, nil
+}
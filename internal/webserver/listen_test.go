@@ -0,0 +1,39 @@
+//go:build unix && !solaris
+
+package webserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("address in use without reuseport", func(t *testing.T) {
+		first, err := Listen(ctx, config.Config{HTTPAddress: "127.0.0.1:0"})
+		require.NoError(t, err)
+		defer first.Close()
+
+		_, err = Listen(ctx, config.Config{HTTPAddress: first.Addr().String()})
+		assert.Error(t, err)
+	})
+
+	t.Run("second process can listen with reuseport", func(t *testing.T) {
+		cfg := config.Config{HTTPAddress: "127.0.0.1:0", ListenReusePort: true}
+		first, err := Listen(ctx, cfg)
+		require.NoError(t, err)
+		defer first.Close()
+
+		cfg.HTTPAddress = first.Addr().String()
+		second, err := Listen(ctx, cfg)
+		require.NoError(t, err)
+		defer second.Close()
+
+		assert.Equal(t, first.Addr().String(), second.Addr().String())
+	})
+}
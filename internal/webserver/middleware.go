@@ -5,7 +5,7 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/go-chi/chi/middleware"
+	"github.com/austinwofford/account-management/internal/i18n"
 )
 
 // slogMiddleware logs http requests using slog
@@ -15,18 +15,36 @@ func slogMiddleware() func(http.Handler) http.Handler {
 			start := time.Now()
 			ww := &wrapWriter{ResponseWriter: w, code: http.StatusOK}
 			next.ServeHTTP(ww, r)
-			slog.Info("http_request",
+			slog.InfoContext(r.Context(), "http_request",
 				slog.String("http_method", r.Method),
 				slog.String("path", r.URL.Path),
 				slog.Int("status_code", ww.code),
 				slog.Duration("duration", time.Since(start)),
 				slog.String("remote_addr", r.RemoteAddr),
-				slog.Any("request_id", r.Context().Value(middleware.RequestIDKey)),
 			)
 		})
 	}
 }
 
+// localeMiddleware negotiates the response locale from the Accept-Language header
+// and stores it on the request context. Malformed headers fall back to the default locale.
+func localeMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Accept-Language")
+
+			locale, err := i18n.Negotiate(header)
+			if err != nil {
+				slog.DebugContext(r.Context(), "ignoring invalid Accept-Language header",
+					"accept_language", header, "error", err)
+			}
+
+			w.Header().Add("Vary", "Accept-Language")
+			next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+		})
+	}
+}
+
 type wrapWriter struct {
 	http.ResponseWriter
 	code int
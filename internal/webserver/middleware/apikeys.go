@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+// APIKeyHeader carries an API key in place of a bearer access token
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator looks up the account an API key was issued to. It returns
+// auth.ErrInvalidAPIKey for keys that are unknown, revoked, or expired.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*auth.APIKey, error)
+}
+
+type apiKeyKey struct{}
+
+// APIKeyFromContext returns the API key the caller authenticated with, if they used one
+// rather than an access token
+func APIKeyFromContext(ctx context.Context) (*auth.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey{}).(*auth.APIKey)
+	return key, ok
+}
+
+// WithAPIKey puts an API key and its account's claims on the context the same way
+// RequireAuthOrAPIKey does. Mostly useful for tests.
+func WithAPIKey(ctx context.Context, key *auth.APIKey) context.Context {
+	return context.WithValue(WithClaims(ctx, &auth.Claims{AccountID: key.AccountID}), apiKeyKey{}, key)
+}
+
+// RequireAuthOrAPIKey is RequireAuth that also accepts an "X-API-Key" header instead of the
+// bearer token, access tokens an account granted an OAuth client, and the account's own tokens
+// restricted by scope. API key callers get claims with only their account ID, so routes behind
+// it should check the key's or token's scopes with RequireScope.
+func RequireAuthOrAPIKey(parser AccessTokenInspector, revocations *revocation.AccessTokens, keys APIKeyAuthenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		bearer := requireAccessToken(parser, revocations, true, next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(APIKeyHeader)
+			if key == "" {
+				bearer.ServeHTTP(w, r)
+				return
+			}
+
+			apiKey, err := keys.AuthenticateAPIKey(r.Context(), key)
+			if err != nil {
+				if errors.Is(err, auth.ErrInvalidAPIKey) {
+					slog.DebugContext(r.Context(), "rejected api key")
+					writeUnauthorized(w, r, "The API key is invalid, revoked, or expired")
+					return
+				}
+				slog.ErrorContext(r.Context(), "error authenticating api key", "error", err)
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "There was an unexpected error checking the API key",
+					StatusCode: http.StatusInternalServerError,
+				})
+				return
+			}
+
+			setLogAccountID(r.Context(), apiKey.AccountID)
+			next.ServeHTTP(w, r.WithContext(WithAPIKey(r.Context(), apiKey)))
+		})
+	}
+}
+
+// RequireScope only lets through API keys and access tokens granted the scope. The account's
+// own access tokens are only restricted when it logged in for some scopes. It goes after
+// RequireAuthOrAPIKey.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key, ok := APIKeyFromContext(r.Context()); ok && !key.HasScope(scope) {
+				slog.DebugContext(r.Context(), "rejected api key without the required scope", "scope", scope)
+				writeInsufficientScope(w, r, "The API key is not allowed to call this endpoint")
+				return
+			}
+			if claims, ok := ClaimsFromContext(r.Context()); ok && claims.ClientID != "" && !claims.HasScope(scope) {
+				slog.DebugContext(r.Context(), "rejected oauth client access token without the required scope", "scope", scope)
+				writeInsufficientScope(w, r, "The OAuth client was not granted access to this endpoint")
+				return
+			}
+			if claims, ok := ClaimsFromContext(r.Context()); ok && claims.ClientID == "" && claims.Scope != "" && !claims.HasScope(scope) {
+				slog.DebugContext(r.Context(), "rejected access token without the required scope", "scope", scope)
+				writeInsufficientScope(w, r, "The access token is not allowed to call this endpoint")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAPIKeys map[string]*auth.APIKey
+
+func (f fakeAPIKeys) AuthenticateAPIKey(ctx context.Context, key string) (*auth.APIKey, error) {
+	if key == "broken" {
+		return nil, errors.New("database is down")
+	}
+	apiKey, ok := f[key]
+	if !ok {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	return apiKey, nil
+}
+
+func TestRequireAuthOrAPIKey(t *testing.T) {
+	client := auth.NewClient(auth.Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: 15,
+	})
+	validToken, _, err := client.NewAccessToken(auth.Claims{AccountID: "test-account-id"})
+	require.NoError(t, err)
+	oauthToken, _, err := client.NewAccessToken(auth.Claims{AccountID: "test-account-id", ClientID: "client-id", Scope: auth.ScopeAccountRead})
+	require.NoError(t, err)
+	clientCredentialsToken, _, err := client.NewAccessToken(auth.Claims{ClientID: "client-id", Scope: auth.ScopeAccountRead})
+	require.NoError(t, err)
+
+	keys := fakeAPIKeys{
+		"amk_valid": {ID: "key-id", AccountID: "test-account-id", Scopes: []string{auth.ScopeAccountRead}},
+	}
+
+	tests := []struct {
+		name           string
+		authorization  string
+		apiKey         string
+		expectedStatus int
+		expectedKey    bool
+	}{
+		{name: "valid api key", apiKey: "amk_valid", expectedStatus: http.StatusOK, expectedKey: true},
+		{name: "api key is used over a bearer token", authorization: "Bearer not-a-jwt", apiKey: "amk_valid", expectedStatus: http.StatusOK, expectedKey: true},
+		{name: "bearer token", authorization: "Bearer " + validToken, expectedStatus: http.StatusOK},
+		{name: "oauth client token for an account", authorization: "Bearer " + oauthToken, expectedStatus: http.StatusOK},
+		{name: "client credentials token", authorization: "Bearer " + clientCredentialsToken, expectedStatus: http.StatusForbidden},
+		{name: "invalid api key", apiKey: "amk_invalid", expectedStatus: http.StatusUnauthorized},
+		{name: "error checking api key", apiKey: "broken", expectedStatus: http.StatusInternalServerError},
+		{name: "neither", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var claims *auth.Claims
+			var key *auth.APIKey
+			h := RequireAuthOrAPIKey(client, nil, keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, _ = ClaimsFromContext(r.Context())
+				key, _ = APIKeyFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				assert.Nil(t, claims)
+				return
+			}
+			require.NotNil(t, claims)
+			assert.Equal(t, "test-account-id", claims.AccountID)
+			if tt.expectedKey {
+				require.NotNil(t, key)
+				assert.Equal(t, "key-id", key.ID)
+			} else {
+				assert.Nil(t, key)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name           string
+		ctx            func(ctx context.Context) context.Context
+		expectedStatus int
+	}{
+		{
+			name: "api key with the scope",
+			ctx: func(ctx context.Context) context.Context {
+				return WithAPIKey(ctx, &auth.APIKey{AccountID: "account-id", Scopes: []string{auth.ScopeAccountRead}})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "api key without the scope",
+			ctx: func(ctx context.Context) context.Context {
+				return WithAPIKey(ctx, &auth.APIKey{AccountID: "account-id", Scopes: []string{auth.ScopeSessionsWrite}})
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "access token",
+			ctx: func(ctx context.Context) context.Context {
+				return WithClaims(ctx, &auth.Claims{AccountID: "account-id"})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "access token with the scope",
+			ctx: func(ctx context.Context) context.Context {
+				return WithClaims(ctx, &auth.Claims{AccountID: "account-id", Scope: "account:read account:write"})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "access token without the scope",
+			ctx: func(ctx context.Context) context.Context {
+				return WithClaims(ctx, &auth.Claims{AccountID: "account-id", Scope: auth.ScopeAccountWrite})
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "oauth client token with the scope",
+			ctx: func(ctx context.Context) context.Context {
+				return WithClaims(ctx, &auth.Claims{AccountID: "account-id", ClientID: "client-id", Scope: "sessions:write account:read"})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "oauth client token without the scope",
+			ctx: func(ctx context.Context) context.Context {
+				return WithClaims(ctx, &auth.Claims{AccountID: "account-id", ClientID: "client-id", Scope: auth.ScopeSessionsWrite})
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RequireScope(auth.ScopeAccountRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req = req.WithContext(tt.ctx(req.Context()))
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				var resp httputils.ErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, errTypeInsufficientScope, resp.Type)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const (
+	errTypeUnauthorized      = "unauthorized"
+	errTypeInsufficientScope = "insufficient_scope"
+)
+
+// AccessTokenParser validates access tokens. auth.Client implements it.
+type AccessTokenParser interface {
+	ParseAccessToken(tokenString string) (*auth.Claims, error)
+}
+
+// AccessTokenInspector validates access tokens and returns their ID and lifetime too.
+// auth.Client implements it.
+type AccessTokenInspector interface {
+	InspectAccessToken(tokenString string) (*auth.AccessToken, error)
+}
+
+type claimsKey struct{}
+
+type accessTokenKey struct{}
+
+// ClaimsFromContext returns the claims of the authenticated caller, if RequireAuth ran.
+func ClaimsFromContext(ctx context.Context) (*auth.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*auth.Claims)
+	return claims, ok
+}
+
+// WithClaims puts claims on the context the same way RequireAuth does. Mostly useful for tests.
+func WithClaims(ctx context.Context, claims *auth.Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// AccessTokenFromContext returns the access token the caller authenticated with, if RequireAuth
+// ran. Unlike the claims, it has the token's ID and expiry, e.g. to revoke it.
+func AccessTokenFromContext(ctx context.Context) (*auth.AccessToken, bool) {
+	token, ok := ctx.Value(accessTokenKey{}).(*auth.AccessToken)
+	return token, ok
+}
+
+// RequireAuth rejects requests without a valid "Authorization: Bearer <access token>" header
+// and puts the token's claims on the request context for the next handler. Certificate-bound
+// tokens are only accepted over a connection using the certificate they were issued to.
+// Tokens revoked in revocations are rejected too, a nil revocations doesn't check. Tokens
+// issued to OAuth clients, and the account's own tokens restricted by scope, are rejected;
+// RequireAuthOrAPIKey accepts them.
+func RequireAuth(parser AccessTokenInspector, revocations *revocation.AccessTokens) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return requireAccessToken(parser, revocations, false, next)
+	}
+}
+
+// RequireOAuthClient is RequireAuth for routes only OAuth clients call on an account's behalf,
+// like OpenID Connect's userinfo. It only accepts access tokens an account granted an OAuth
+// client, check their scopes with RequireScope.
+func RequireOAuthClient(parser AccessTokenInspector, revocations *revocation.AccessTokens) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return requireAccessToken(parser, revocations, true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims, _ := ClaimsFromContext(r.Context()); claims.ClientID == "" {
+				slog.DebugContext(r.Context(), "rejected access token not issued to an oauth client")
+				writeInsufficientScope(w, r, "Only access tokens issued to OAuth clients can call this endpoint")
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// requireAccessToken is RequireAuth's handler, optionally accepting the tokens restricted by
+// scope: the ones OAuth clients got for an account, and the account's own scoped tokens. Client
+// credentials tokens have no account and are never accepted.
+func requireAccessToken(parser AccessTokenInspector, revocations *revocation.AccessTokens, allowScoped bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, ok := BearerToken(r)
+		if !ok {
+			writeUnauthorized(w, r, "A bearer access token is required")
+			return
+		}
+
+		token, err := parser.InspectAccessToken(tokenString)
+		if err != nil {
+			slog.DebugContext(r.Context(), "rejected access token", "error", err)
+			writeUnauthorized(w, r, "The access token is invalid or expired")
+			return
+		}
+		claims := &token.Claims
+
+		if revocations != nil {
+			revoked, err := revocations.Revoked(r.Context(), token.ID)
+			if err != nil {
+				// fail closed, a revoked token mustn't work again because the store is down
+				slog.ErrorContext(r.Context(), "error checking access token revocation", "error", err)
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "There was an unexpected error checking the access token",
+					StatusCode: http.StatusInternalServerError,
+				})
+				return
+			}
+			if revoked {
+				slog.DebugContext(r.Context(), "rejected revoked access token")
+				writeUnauthorized(w, r, "The access token is invalid or expired")
+				return
+			}
+		}
+
+		if claims.Confirmation != nil && claims.Confirmation.X5TS256 != "" && !certificateMatches(r, claims.Confirmation) {
+			slog.DebugContext(r.Context(), "rejected certificate-bound access token presented without its certificate")
+			writeUnauthorized(w, r, "The access token is bound to a different client certificate")
+			return
+		}
+
+		if claims.ClientID != "" && (!allowScoped || claims.AccountID == "") {
+			slog.DebugContext(r.Context(), "rejected oauth client access token", "client_id", claims.ClientID)
+			writeInsufficientScope(w, r, "Access tokens issued to OAuth clients can't call this endpoint")
+			return
+		}
+		if claims.ClientID == "" && claims.Scope != "" && !allowScoped {
+			slog.DebugContext(r.Context(), "rejected access token restricted by scope", "scope", claims.Scope)
+			writeInsufficientScope(w, r, "Access tokens restricted by scope can't call this endpoint")
+			return
+		}
+
+		setLogAccountID(r.Context(), claims.AccountID)
+		ctx := context.WithValue(WithClaims(r.Context(), claims), accessTokenKey{}, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// BearerToken returns the token from the request's "Authorization: Bearer" header, if any
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func writeInsufficientScope(w http.ResponseWriter, r *http.Request, message string) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    message,
+		Type:       errTypeInsufficientScope,
+		StatusCode: http.StatusForbidden,
+	})
+}
+
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="account-management"`)
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    message,
+		Type:       errTypeUnauthorized,
+		StatusCode: http.StatusUnauthorized,
+	})
+}
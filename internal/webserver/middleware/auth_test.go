@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireAuth(t *testing.T) {
+	client := auth.NewClient(auth.Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: 15,
+	})
+
+	validToken, _, err := client.NewAccessToken(auth.Claims{AccountID: "test-account-id"})
+	require.NoError(t, err)
+
+	revocations := revocation.NewAccessTokens(revocation.NewMemoryTokenStore())
+	revokedToken, _, err := client.NewAccessToken(auth.Claims{AccountID: "test-account-id"})
+	require.NoError(t, err)
+	revoked, err := client.InspectAccessToken(revokedToken)
+	require.NoError(t, err)
+	require.NoError(t, revocations.Revoke(context.Background(), revoked.ID, revoked.ExpiresAt))
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "valid token", authorization: "Bearer " + validToken, expectedStatus: http.StatusOK},
+		{name: "lowercase scheme", authorization: "bearer " + validToken, expectedStatus: http.StatusOK},
+		{name: "missing header", authorization: "", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", authorization: "Basic " + validToken, expectedStatus: http.StatusUnauthorized},
+		{name: "empty token", authorization: "Bearer ", expectedStatus: http.StatusUnauthorized},
+		{name: "invalid token", authorization: "Bearer not-a-jwt", expectedStatus: http.StatusUnauthorized},
+		{name: "revoked token", authorization: "Bearer " + revokedToken, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var claims *auth.Claims
+			var token *auth.AccessToken
+			h := RequireAuth(client, revocations)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, _ = ClaimsFromContext(r.Context())
+				token, _ = AccessTokenFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				require.NotNil(t, claims)
+				assert.Equal(t, "test-account-id", claims.AccountID)
+				require.NotNil(t, token)
+				assert.NotEmpty(t, token.ID)
+				return
+			}
+
+			assert.Nil(t, claims)
+			assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			var resp httputils.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, errTypeUnauthorized, resp.Type)
+		})
+	}
+}
+
+func TestRequireAuthRejectsScopedTokens(t *testing.T) {
+	client := auth.NewClient(auth.Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: 15,
+	})
+
+	for name, claims := range map[string]auth.Claims{
+		"granted by an account": {AccountID: "test-account-id", ClientID: "client-id", Scope: auth.ScopeAccountRead},
+		"client credentials":    {ClientID: "client-id", Scope: auth.ScopeAccountRead},
+		"restricted by scope":   {AccountID: "test-account-id", Scope: auth.ScopeAccountRead},
+	} {
+		t.Run(name, func(t *testing.T) {
+			token, _, err := client.NewAccessToken(claims)
+			require.NoError(t, err)
+
+			h := RequireAuth(client, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			var resp httputils.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, errTypeInsufficientScope, resp.Type)
+		})
+	}
+}
+
+func TestRequireOAuthClient(t *testing.T) {
+	client := auth.NewClient(auth.Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: 15,
+	})
+
+	tests := []struct {
+		name           string
+		claims         auth.Claims
+		expectedStatus int
+	}{
+		{
+			name:           "granted by an account",
+			claims:         auth.Claims{AccountID: "test-account-id", ClientID: "client-id", Scope: auth.ScopeOpenID},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "client credentials",
+			claims:         auth.Claims{ClientID: "client-id", Scope: auth.ScopeOpenID},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "the account's own token",
+			claims:         auth.Claims{AccountID: "test-account-id"},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := client.NewAccessToken(tt.claims)
+			require.NoError(t, err)
+
+			h := RequireOAuthClient(client, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+// ClientIP finds the address of the client behind the trusted proxies, for httputils.ClientIP.
+// Requests from a trusted proxy are followed back through X-Forwarded-For, right to left, to the
+// first address that isn't a trusted proxy; the entries before it were sent by the client and
+// can say anything. Requests from anywhere else are the client's own, whatever they forward.
+func ClientIP(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := forwardedFor(r, trustedProxies)
+			next.ServeHTTP(w, r.WithContext(httputils.WithClientIP(r.Context(), ip)))
+		})
+	}
+}
+
+func forwardedFor(r *http.Request, trustedProxies []netip.Prefix) string {
+	ip := httputils.RemoteIP(r)
+	if len(trustedProxies) == 0 {
+		return ip
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && trusted(ip, trustedProxies); i-- {
+		// a proxy that forwarded garbage is the closest to the client we know
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = addr.String()
+	}
+	return ip
+}
+
+func trusted(ip string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
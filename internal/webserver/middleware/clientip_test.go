@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/ratelimit"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::1/128")}
+
+	tests := []struct {
+		name           string
+		trustedProxies []netip.Prefix
+		remoteAddr     string
+		forwardedFor   []string
+		expected       string
+	}{
+		{
+			name:       "no proxy",
+			remoteAddr: "203.0.113.7:1234",
+			expected:   "203.0.113.7",
+		},
+		{
+			name:         "forwarded headers aren't trusted without proxies",
+			remoteAddr:   "203.0.113.7:1234",
+			forwardedFor: []string{"198.51.100.1"},
+			expected:     "203.0.113.7",
+		},
+		{
+			name:           "forwarded headers from anywhere else aren't trusted",
+			trustedProxies: proxies,
+			remoteAddr:     "203.0.113.7:1234",
+			forwardedFor:   []string{"198.51.100.1"},
+			expected:       "203.0.113.7",
+		},
+		{
+			name:           "trusted proxy",
+			trustedProxies: proxies,
+			remoteAddr:     "10.0.0.2:1234",
+			forwardedFor:   []string{"198.51.100.1"},
+			expected:       "198.51.100.1",
+		},
+		{
+			name:           "addresses the client sent are skipped",
+			trustedProxies: proxies,
+			remoteAddr:     "10.0.0.2:1234",
+			forwardedFor:   []string{"192.0.2.99, 198.51.100.1, 10.0.0.3"},
+			expected:       "198.51.100.1",
+		},
+		{
+			name:           "across several headers",
+			trustedProxies: proxies,
+			remoteAddr:     "[2001:db8::1]:1234",
+			forwardedFor:   []string{"192.0.2.99", "198.51.100.1,10.0.0.3"},
+			expected:       "198.51.100.1",
+		},
+		{
+			name:           "garbage stops at the proxy",
+			trustedProxies: proxies,
+			remoteAddr:     "10.0.0.2:1234",
+			forwardedFor:   []string{"198.51.100.1, unknown"},
+			expected:       "10.0.0.2",
+		},
+		{
+			name:           "only proxies",
+			trustedProxies: proxies,
+			remoteAddr:     "10.0.0.2:1234",
+			forwardedFor:   []string{"10.0.0.4, 10.0.0.3"},
+			expected:       "10.0.0.4",
+		},
+		{
+			name:           "proxy without a header",
+			trustedProxies: proxies,
+			remoteAddr:     "10.0.0.2:1234",
+			expected:       "10.0.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := ClientIP(tt.trustedProxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = httputils.ClientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestRateLimitBehindProxy(t *testing.T) {
+	// clients behind the same proxy get buckets of their own
+	rules := ratelimit.NewRuleSet([]ratelimit.Rule{
+		{Method: http.MethodPost, Path: "/v1/accounts/login", Limit: ratelimit.Limit{Requests: 1, Period: time.Minute}},
+	})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := ClientIP([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})(RateLimit(ratelimit.NewMemoryStore(), nil, rules)(next))
+
+	request := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/accounts/login", nil)
+		req.RemoteAddr = "10.0.0.2:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, request("198.51.100.1"))
+	assert.Equal(t, http.StatusOK, request("198.51.100.2"))
+}
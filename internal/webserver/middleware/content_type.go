@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeUnsupportedMediaType = "unsupported_media_type"
+
+// RequireJSON answers POST, PUT, and PATCH requests with a body in anything but JSON with a 415,
+// so a form post gets a clear error instead of a confusing decoding one. JSON with a charset
+// and +json types are accepted. Requests without a Content-Type are let through for clients
+// that never set it.
+func RequireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		if r.ContentLength == 0 || contentType == "" || isJSON(contentType) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "Request bodies have to be JSON, with Content-Type application/json",
+			Type:       errTypeUnsupportedMediaType,
+			StatusCode: http.StatusUnsupportedMediaType,
+		})
+	})
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireJSON(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "json",
+			method:         http.MethodPost,
+			contentType:    "application/json",
+			body:           `{}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "json with a charset",
+			method:         http.MethodPut,
+			contentType:    "application/json; charset=utf-8",
+			body:           `{}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "json suffix",
+			method:         http.MethodPatch,
+			contentType:    "application/merge-patch+json",
+			body:           `{}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "no content type",
+			method:         http.MethodPost,
+			body:           `{}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "no body",
+			method:         http.MethodPost,
+			contentType:    "text/plain",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "reads aren't checked",
+			method:         http.MethodGet,
+			contentType:    "text/plain",
+			body:           "hello",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "form",
+			method:         http.MethodPost,
+			contentType:    "application/x-www-form-urlencoded",
+			body:           "email=test@example.com",
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "malformed content type",
+			method:         http.MethodPost,
+			contentType:    "application/json; charset",
+			body:           `{}`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/accounts/login", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			RequireJSON(next).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusUnsupportedMediaType {
+				assert.Contains(t, w.Body.String(), errTypeUnsupportedMediaType)
+			}
+		})
+	}
+}
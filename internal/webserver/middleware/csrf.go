@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const (
+	// CSRFCookie holds the double-submit token. Scripts read it and send it back in CSRFHeader,
+	// which a cross-site page can't do.
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+
+	errTypeCSRFValidationFailed = "csrf_validation_failed"
+)
+
+type CSRFConfig struct {
+	// SessionCookie is the cookie that authenticates requests. Requests carrying it are always
+	// checked, even with a bearer token.
+	SessionCookie string
+	// Domain is optional, the cookie is host-only without it
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+	// TTL is how long the token cookie lasts, usually as long as the session
+	TTL time.Duration
+}
+
+// CSRF is double-submit CSRF protection for cookie sessions. The token is set as a cookie
+// scripts can read, and state-changing requests have to send it back in a header.
+type CSRF struct {
+	cfg CSRFConfig
+}
+
+func NewCSRF(cfg CSRFConfig) *CSRF {
+	return &CSRF{cfg: cfg}
+}
+
+// IssueToken sets a new CSRF token cookie, e.g. when a session starts
+func (c *CSRF) IssueToken(w http.ResponseWriter) (string, error) {
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, c.cookie(token, int(c.cfg.TTL.Seconds())))
+	return token, nil
+}
+
+// ClearToken tells the browser to drop the CSRF token cookie
+func (c *CSRF) ClearToken(w http.ResponseWriter) {
+	http.SetCookie(w, c.cookie("", -1))
+}
+
+func (c *CSRF) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:   CSRFCookie,
+		Value:  value,
+		Domain: c.cfg.Domain,
+		// the web app's scripts have to read it, from whatever page they're on
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   c.cfg.Secure,
+		HttpOnly: false,
+		SameSite: c.cfg.SameSite,
+	}
+}
+
+type csrfTokenResponse struct {
+	CSRFToken string `json:"csrf_token"`
+}
+
+// TokenHandler responds with the caller's CSRF token, issuing one if it doesn't have one yet.
+// Web apps that can't read the cookie, e.g. on another domain, get it from the response.
+func (c *CSRF) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	// the existing token is kept so other tabs' copies keep working
+	if cookie, err := r.Cookie(CSRFCookie); err == nil && cookie.Value != "" {
+		httputils.WriteJSONResponse(w, r, http.StatusOK, csrfTokenResponse{CSRFToken: cookie.Value})
+		return
+	}
+
+	token, err := c.IssueToken(w)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error issuing CSRF token", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "Error issuing CSRF token",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+	httputils.WriteJSONResponse(w, r, http.StatusOK, csrfTokenResponse{CSRFToken: token})
+}
+
+// Protect rejects state-changing requests without a CSRFHeader matching the CSRF cookie. GET,
+// HEAD, and OPTIONS requests are let through, as are pure bearer token or API key requests,
+// since a cross-site page can't set those headers and they don't carry the session cookie.
+func (c *CSRF) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.credentialsInHeaders(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(CSRFCookie)
+		header := r.Header.Get(CSRFHeader)
+		if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+			slog.DebugContext(r.Context(), "rejected request without a matching CSRF token", "path", r.URL.Path)
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The CSRF token is missing or doesn't match",
+				Type:       errTypeCSRFValidationFailed,
+				StatusCode: http.StatusForbidden,
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// credentialsInHeaders reports whether the request authenticates with only a bearer token or
+// API key
+func (c *CSRF) credentialsInHeaders(r *http.Request) bool {
+	_, bearer := BearerToken(r)
+	if !bearer && r.Header.Get(APIKeyHeader) == "" {
+		return false
+	}
+	if c.cfg.SessionCookie == "" {
+		return true
+	}
+	_, err := r.Cookie(c.cfg.SessionCookie)
+	return err != nil
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSRF(t *testing.T) {
+	csrf := NewCSRF(CSRFConfig{
+		SessionCookie: "refresh_token",
+		Secure:        true,
+		SameSite:      http.SameSiteStrictMode,
+		TTL:           time.Hour,
+	})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		cookies        map[string]string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "reads don't need a token",
+			method:         http.MethodGet,
+			cookies:        map[string]string{"refresh_token": "refresh"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "matching token",
+			method:         http.MethodPost,
+			cookies:        map[string]string{"refresh_token": "refresh", CSRFCookie: "token"},
+			headers:        map[string]string{CSRFHeader: "token"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing header",
+			method:         http.MethodPost,
+			cookies:        map[string]string{"refresh_token": "refresh", CSRFCookie: "token"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "mismatched header",
+			method:         http.MethodDelete,
+			cookies:        map[string]string{CSRFCookie: "token"},
+			headers:        map[string]string{CSRFHeader: "other"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "header without a cookie",
+			method:         http.MethodPut,
+			headers:        map[string]string{CSRFHeader: "token"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "pure bearer token requests are exempt",
+			method:         http.MethodPost,
+			headers:        map[string]string{"Authorization": "Bearer access"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "API key requests are exempt",
+			method:         http.MethodPatch,
+			headers:        map[string]string{APIKeyHeader: "key"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "bearer token requests with the session cookie are checked",
+			method:         http.MethodPost,
+			cookies:        map[string]string{"refresh_token": "refresh"},
+			headers:        map[string]string{"Authorization": "Bearer access"},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/accounts/logout", nil)
+			for name, value := range tt.cookies {
+				req.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+
+			csrf.Protect(next).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.Contains(t, w.Body.String(), errTypeCSRFValidationFailed)
+			}
+		})
+	}
+
+	t.Run("token endpoint", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		csrf.TokenHandler(w, httptest.NewRequest(http.MethodGet, "/v1/accounts/csrf-token", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp csrfTokenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotEmpty(t, resp.CSRFToken)
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, CSRFCookie, cookies[0].Name)
+		assert.Equal(t, resp.CSRFToken, cookies[0].Value)
+		assert.False(t, cookies[0].HttpOnly)
+		assert.True(t, cookies[0].Secure)
+		assert.Equal(t, 3600, cookies[0].MaxAge)
+
+		// an existing token is kept
+		req := httptest.NewRequest(http.MethodGet, "/v1/accounts/csrf-token", nil)
+		req.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+		csrf.TokenHandler(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, cookies[0].Value, resp.CSRFToken)
+		assert.Empty(t, w.Result().Cookies())
+	})
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeServiceDegraded = "service_degraded"
+
+// DegradedState reports whether the service is degraded. degraded.Monitor implements it.
+type DegradedState interface {
+	Degraded() (bool, time.Time)
+}
+
+// RejectWritesWhenDegraded answers requests that would write to the database with a 503 while
+// the primary database is down, so clients get a clear retry-later instead of whatever error
+// the write fails with. GET, HEAD, and OPTIONS requests are let through, as are the allowed
+// paths, for POSTs that only read or don't need the database at all.
+func RejectWritesWhenDegraded(state DegradedState, retryAfter time.Duration, allowed ...string) func(http.Handler) http.Handler {
+	allowedPaths := map[string]bool{}
+	for _, path := range allowed {
+		allowedPaths[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if degraded, _ := state.Degraded(); !degraded || allowedPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			seconds := int((retryAfter + time.Second - 1) / time.Second)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "The service is temporarily read-only, try again later",
+				Type:       errTypeServiceDegraded,
+				StatusCode: http.StatusServiceUnavailable,
+			})
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDegradedState bool
+
+func (f fakeDegradedState) Degraded() (bool, time.Time) {
+	return bool(f), time.Time{}
+}
+
+func TestRejectWritesWhenDegraded(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		degraded       bool
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "writes work while healthy",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/register",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "writes are rejected while degraded",
+			degraded:       true,
+			method:         http.MethodPost,
+			path:           "/v1/accounts/register",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "deletes are rejected while degraded",
+			degraded:       true,
+			method:         http.MethodDelete,
+			path:           "/internal/accounts/123/tags/beta",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "reads keep working while degraded",
+			degraded:       true,
+			method:         http.MethodGet,
+			path:           "/v1/accounts/me/activity",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "allowed paths keep working while degraded",
+			degraded:       true,
+			method:         http.MethodPost,
+			path:           "/internal/accounts/lookup",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RejectWritesWhenDegraded(fakeDegradedState(tt.degraded), 15*time.Second, "/internal/accounts/lookup")(next)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusServiceUnavailable {
+				assert.Equal(t, "15", w.Header().Get("Retry-After"))
+				assert.Contains(t, w.Body.String(), errTypeServiceDegraded)
+			}
+		})
+	}
+}
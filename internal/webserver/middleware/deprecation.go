@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/metrics"
+)
+
+// Deprecation is route metadata describing an endpoint that is being retired.
+type Deprecation struct {
+	// When the endpoint was deprecated. Sent as the Deprecation header (RFC 9745).
+	Since time.Time
+	// When the endpoint will stop working. Sent as the Sunset header (RFC 8594) if set.
+	Sunset time.Time
+	// Documentation for migrating off the endpoint (or its replacement). Sent as a Link header if set.
+	Link string
+}
+
+// Deprecated marks the routes it wraps as deprecated. Every response gets the Deprecation,
+// Sunset, and Link headers and each request is counted in m and logged so that clients still
+// calling the endpoint can be found and migrated. Routers mounted below it are still matching
+// when it runs, so the route pattern is only read once the request is done.
+func Deprecated(d Deprecation, m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+			if !d.Sunset.IsZero() {
+				w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if d.Link != "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"; type="text/html"`, d.Link))
+			}
+
+			next.ServeHTTP(w, r)
+
+			route := matchedRoute(r)
+			m.DeprecatedRequest(r.Method, route)
+			slog.WarnContext(r.Context(), "deprecated endpoint called",
+				"method", r.Method,
+				"route", route,
+				"user_agent", r.UserAgent(),
+			)
+		})
+	}
+}
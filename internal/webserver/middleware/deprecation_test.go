@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/metrics"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeprecated(t *testing.T) {
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		deprecation     Deprecation
+		expectedHeaders map[string]string
+	}{
+		{
+			name: "all metadata",
+			deprecation: Deprecation{
+				Since:  since,
+				Sunset: sunset,
+				Link:   "https://example.com/migrate",
+			},
+			expectedHeaders: map[string]string{
+				"Deprecation": "@1735689600",
+				"Sunset":      "Mon, 30 Jun 2025 00:00:00 GMT",
+				"Link":        `<https://example.com/migrate>; rel="deprecation"; type="text/html"`,
+			},
+		},
+		{
+			name:        "deprecation only",
+			deprecation: Deprecation{Since: since},
+			expectedHeaders: map[string]string{
+				"Deprecation": "@1735689600",
+				"Sunset":      "",
+				"Link":        "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.With(Deprecated(tt.deprecation, nil)).Get("/old/{id}", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/old/123", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			for header, expected := range tt.expectedHeaders {
+				assert.Equal(t, expected, w.Header().Get(header), header)
+			}
+		})
+	}
+}
+
+func TestDeprecatedCountsMountedRoutes(t *testing.T) {
+	m := metrics.New(prometheus.NewRegistry())
+
+	accounts := chi.NewRouter()
+	accounts.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	accounts.Post("/{id}/emails", func(w http.ResponseWriter, r *http.Request) {})
+
+	r := chi.NewRouter()
+	r.With(Deprecated(Deprecation{Since: time.Now()}, m)).Mount("/v1/accounts", accounts)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/v1/accounts/1", nil),
+		httptest.NewRequest(http.MethodGet, "/v1/accounts/2", nil),
+		httptest.NewRequest(http.MethodPost, "/v1/accounts/1/emails", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+
+	// counted by the pattern the mounted router matched, not the mount point
+	assert.Contains(t, body, `account_management_deprecated_requests_total{method="GET",route="/v1/accounts/{id}"} 2`)
+	assert.Contains(t, body, `account_management_deprecated_requests_total{method="POST",route="/v1/accounts/{id}/emails"} 1`)
+	assert.NotContains(t, body, `route="/v1/accounts/*"`)
+}
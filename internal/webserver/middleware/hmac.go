@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/hmacauth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const (
+	errTypeInvalidSignature = "invalid_signature"
+	errTypeReplayedRequest  = "replayed_request"
+
+	// hmacMaxSkew is how far a signed timestamp may be from our clock
+	hmacMaxSkew = 5 * time.Minute
+)
+
+// ReplayStore counts how many times a key has been seen within a window. lockout.Store
+// implements it, so signatures are shared between replicas when Redis is configured.
+type ReplayStore interface {
+	Increment(ctx context.Context, key string, window time.Duration) (int64, error)
+}
+
+// RequireHMAC only lets through requests signed (see hmacauth) with one of keys (key ID ->
+// secret). Each signature is accepted once: the timestamp must be within 5 minutes and
+// signatures seen in that time are rejected as replays. The key ID is put on the request
+// context as the client identity.
+func RequireHMAC(keys map[string][]byte, replay ReplayStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			keyID, err := hmacauth.Verify(r, keys, time.Now(), hmacMaxSkew)
+			if err != nil {
+				slog.InfoContext(ctx, "rejected request signature", "key_id", r.Header.Get(hmacauth.HeaderKeyID), "error", err)
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "The request signature is missing, invalid, or expired",
+					Type:       errTypeInvalidSignature,
+					StatusCode: http.StatusUnauthorized,
+				})
+				return
+			}
+
+			// timestamps are accepted up to hmacMaxSkew either side of now, so remember
+			// signatures for the whole span
+			count, err := replay.Increment(ctx, "hmac:"+r.Header.Get(hmacauth.HeaderSignature), 2*hmacMaxSkew)
+			if err != nil {
+				// fail closed, replay protection is the point
+				slog.ErrorContext(ctx, "error checking for replayed request", "error", err)
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "There was an unexpected error",
+					StatusCode: http.StatusInternalServerError,
+				})
+				return
+			}
+			if count > 1 {
+				slog.WarnContext(ctx, "rejected replayed request", "key_id", keyID)
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "This request has already been received",
+					Type:       errTypeReplayedRequest,
+					StatusCode: http.StatusUnauthorized,
+				})
+				return
+			}
+
+			ctx = context.WithValue(ctx, clientIdentityKey{}, keyID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireServiceAuth accepts either of the internal service authentication methods: signed
+// requests (when the signature headers are present) or a mapped client certificate.
+func RequireServiceAuth(hmac, clientCert func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		signed := hmac(next)
+		withCert := clientCert(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(hmacauth.HeaderSignature) != "" || r.Header.Get(hmacauth.HeaderKeyID) != "" {
+				signed.ServeHTTP(w, r)
+				return
+			}
+			withCert.ServeHTTP(w, r)
+		})
+	}
+}
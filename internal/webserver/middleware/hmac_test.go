@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/hmacauth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireHMAC(t *testing.T) {
+	keys := map[string][]byte{"provisioning": []byte("provisioning-secret")}
+
+	var identity string
+	h := RequireHMAC(keys, lockout.NewMemoryStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ = ClientIdentityFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(req *http.Request) int {
+		identity = ""
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	signed := func(t *testing.T, secret string, at time.Time) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/internal/accounts/lookup", strings.NewReader(`{"ids":[]}`))
+		require.NoError(t, hmacauth.Sign(req, "provisioning", []byte(secret), at))
+		return req
+	}
+
+	req := signed(t, "provisioning-secret", time.Now())
+	replay := req.Clone(req.Context())
+	replay.Body = signed(t, "provisioning-secret", time.Now()).Body
+
+	assert.Equal(t, http.StatusOK, send(req))
+	assert.Equal(t, "provisioning", identity)
+
+	// the exact same signed request can't be sent twice
+	assert.Equal(t, http.StatusUnauthorized, send(replay))
+
+	assert.Equal(t, http.StatusUnauthorized, send(signed(t, "wrong-secret", time.Now())))
+	assert.Equal(t, http.StatusUnauthorized, send(signed(t, "provisioning-secret", time.Now().Add(-time.Hour))))
+	assert.Equal(t, http.StatusUnauthorized, send(httptest.NewRequest(http.MethodPost, "/internal/accounts/lookup", nil)))
+	assert.Empty(t, identity)
+}
+
+func TestRequireServiceAuth(t *testing.T) {
+	handledBy := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Handled-By", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	h := RequireServiceAuth(handledBy("hmac"), handledBy("cert"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	signed := httptest.NewRequest(http.MethodPost, "/", nil)
+	signed.Header.Set(hmacauth.HeaderKeyID, "provisioning")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, signed)
+	assert.Equal(t, "hmac", w.Header().Get("Handled-By"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, "cert", w.Header().Get("Handled-By"))
+}
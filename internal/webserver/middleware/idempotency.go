@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/idempotency"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const (
+	// IdempotencyKeyHeader names the key a client sends to make a POST safe to retry
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// maxIdempotencyKeyLength keeps keys to UUIDs and the like
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodyBytes is the largest request and response kept for a key
+	maxIdempotentBodyBytes = 1 << 20
+
+	errTypeInvalidIdempotencyKey  = "invalid_idempotency_key"
+	errTypeIdempotencyKeyReused   = "idempotency_key_reused"
+	errTypeIdempotencyKeyInFlight = "idempotency_request_in_progress"
+	errTypeRequestTooLarge        = "request_too_large"
+)
+
+// Idempotency makes POSTs sent with an Idempotency-Key header safe to retry. The first request
+// with a key is handled as usual and its response kept for window; a retry with the same key
+// and request gets that response again, marked with Idempotent-Replayed, without being handled
+// twice. Reusing a key for a different request gets a 422, and retrying while the first request
+// is still being handled a 409. Keys are separate per credential (Authorization, X-API-Key, and
+// cookies, which hold the refresh token in cookie session mode), so one caller's key can't
+// replay another's response. Cookies the response set aren't replayed, a retry never gets a
+// session it didn't already have. Server errors aren't kept, the retry is handled again. Store
+// errors are logged and the request is handled without a key, so the store going down doesn't
+// take the service with it.
+func Idempotency(store idempotency.Store, window time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := r.Context()
+
+			if len(key) > maxIdempotencyKeyLength {
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "The Idempotency-Key header can be at most " + strconv.Itoa(maxIdempotencyKeyLength) + " characters",
+					Type:       errTypeInvalidIdempotencyKey,
+					StatusCode: http.StatusBadRequest,
+				})
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodyBytes+1))
+			if err != nil {
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "The request body couldn't be read",
+					StatusCode: http.StatusBadRequest,
+				})
+				return
+			}
+			if len(body) > maxIdempotentBodyBytes {
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "Requests with an Idempotency-Key can be at most 1MB",
+					Type:       errTypeRequestTooLarge,
+					StatusCode: http.StatusRequestEntityTooLarge,
+				})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			storeKey := idempotencyStoreKey(r, key)
+			requestHash := idempotencyRequestHash(r, body)
+
+			existing, err := store.Claim(ctx, storeKey, idempotency.Record{RequestHash: requestHash}, idempotency.PendingTTL)
+			if err != nil {
+				slog.ErrorContext(ctx, "error claiming idempotency key, handling request without it", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.RequestHash != requestHash:
+					httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+						Message:    "The Idempotency-Key was already used for a different request",
+						Type:       errTypeIdempotencyKeyReused,
+						StatusCode: http.StatusUnprocessableEntity,
+					})
+				case !existing.Done:
+					w.Header().Set("Retry-After", "1")
+					httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+						Message:    "A request with this Idempotency-Key is still being handled, try again shortly",
+						Type:       errTypeIdempotencyKeyInFlight,
+						StatusCode: http.StatusConflict,
+					})
+				default:
+					replay(w, existing)
+				}
+				return
+			}
+
+			before := w.Header().Clone()
+			rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError || rec.body.Len() > maxIdempotentBodyBytes {
+				if err := store.Release(ctx, storeKey); err != nil {
+					slog.ErrorContext(ctx, "error releasing idempotency key", "error", err)
+				}
+				return
+			}
+			err = store.Save(ctx, storeKey, idempotency.Record{
+				RequestHash: requestHash,
+				Done:        true,
+				Status:      rec.status,
+				Header:      changedHeaders(before, w.Header()),
+				Body:        rec.body.Bytes(),
+			}, window)
+			if err != nil {
+				slog.ErrorContext(ctx, "error saving idempotent response", "error", err)
+			}
+		})
+	}
+}
+
+// idempotencyStoreKey keeps each credential's keys apart
+func idempotencyStoreKey(r *http.Request, key string) string {
+	h := sha256.New()
+	for _, credential := range []string{
+		r.Header.Get("Authorization"),
+		r.Header.Get(APIKeyHeader),
+		strings.Join(r.Header.Values("Cookie"), "; "),
+		key,
+	} {
+		h.Write([]byte(credential + "\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotencyRequestHash identifies a request by its route and body
+func idempotencyRequestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\x00"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// changedHeaders are the headers the handler set, the ones set before it (like the request ID)
+// belong to the request they were set for. Cookies are left out.
+func changedHeaders(before, after http.Header) http.Header {
+	changed := http.Header{}
+	for name, values := range after {
+		if name == "Set-Cookie" {
+			continue
+		}
+		if !slices.Equal(before[name], values) {
+			changed[name] = values
+		}
+	}
+	return changed
+}
+
+func replay(w http.ResponseWriter, record *idempotency.Record) {
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
+
+// recordingWriter records the status and up to maxIdempotentBodyBytes+1 bytes of the body
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	if room := maxIdempotentBodyBytes + 1 - w.body.Len(); room > 0 {
+		w.body.Write(p[:min(room, len(p))])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
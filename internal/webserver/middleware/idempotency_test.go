@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/idempotency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingIdempotencyStore struct{}
+
+func (failingIdempotencyStore) Claim(ctx context.Context, key string, record idempotency.Record, ttl time.Duration) (*idempotency.Record, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingIdempotencyStore) Save(ctx context.Context, key string, record idempotency.Record, ttl time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingIdempotencyStore) Release(ctx context.Context, key string) error {
+	return errors.New("connection refused")
+}
+
+func TestIdempotency(t *testing.T) {
+	var calls atomic.Int64
+	status := http.StatusCreated
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.FormatInt(n, 10)})
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"call":` + strconv.FormatInt(n, 10) + `,"body":` + string(body) + `}`))
+	})
+
+	request := func(handler http.Handler, method, key, token, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/accounts/register", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		// set before the middleware, it mustn't be replayed
+		w.Header().Set("X-Request-ID", "request-"+strconv.FormatInt(calls.Load(), 10))
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("retries get the first response", func(t *testing.T) {
+		calls.Store(0)
+		handler := Idempotency(idempotency.NewMemoryStore(), time.Hour)(next)
+
+		first := request(handler, http.MethodPost, "key-1", "", `{"email":"a@test.com"}`)
+		require.Equal(t, http.StatusCreated, first.Code)
+		assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+		retry := request(handler, http.MethodPost, "key-1", "", `{"email":"a@test.com"}`)
+		require.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.NotEmpty(t, first.Header().Get("Set-Cookie"))
+		assert.Empty(t, retry.Header().Get("Set-Cookie"), "cookies aren't replayed")
+		assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+		assert.Equal(t, "request-1", retry.Header().Get("X-Request-ID"))
+		assert.EqualValues(t, 1, calls.Load())
+
+		// a different body under the same key
+		w := request(handler, http.MethodPost, "key-1", "", `{"email":"b@test.com"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeIdempotencyKeyReused)
+
+		// the key is the caller's own
+		w = request(handler, http.MethodPost, "key-1", "token", `{"email":"a@test.com"}`)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+		assert.EqualValues(t, 2, calls.Load())
+	})
+
+	t.Run("the key is separate per session cookie", func(t *testing.T) {
+		calls.Store(0)
+		handler := Idempotency(idempotency.NewMemoryStore(), time.Hour)(next)
+		session := &http.Cookie{Name: "refresh_token", Value: "victim"}
+
+		w := request(handler, http.MethodPost, "key-1", "", `{}`, session)
+		require.Equal(t, http.StatusCreated, w.Code)
+		w = request(handler, http.MethodPost, "key-1", "", `{}`, session)
+		assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+
+		// without the cookie, or with another one, the response isn't someone else's to get
+		w = request(handler, http.MethodPost, "key-1", "", `{}`)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+		w = request(handler, http.MethodPost, "key-1", "", `{}`, &http.Cookie{Name: "refresh_token", Value: "attacker"})
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+		assert.EqualValues(t, 3, calls.Load())
+	})
+
+	t.Run("without a key or for other methods", func(t *testing.T) {
+		calls.Store(0)
+		handler := Idempotency(idempotency.NewMemoryStore(), time.Hour)(next)
+
+		request(handler, http.MethodPost, "", "", `{}`)
+		request(handler, http.MethodPost, "", "", `{}`)
+		request(handler, http.MethodPatch, "key-1", "", `{}`)
+		request(handler, http.MethodPatch, "key-1", "", `{}`)
+		assert.EqualValues(t, 4, calls.Load())
+	})
+
+	t.Run("request still being handled", func(t *testing.T) {
+		handler := Idempotency(claimedStore{Store: idempotency.NewMemoryStore()}, time.Hour)(next)
+
+		w := request(handler, http.MethodPost, "key-1", "", `{}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		assert.Contains(t, w.Body.String(), errTypeIdempotencyKeyInFlight)
+	})
+
+	t.Run("server errors aren't kept", func(t *testing.T) {
+		calls.Store(0)
+		status = http.StatusInternalServerError
+		t.Cleanup(func() { status = http.StatusCreated })
+		handler := Idempotency(idempotency.NewMemoryStore(), time.Hour)(next)
+
+		request(handler, http.MethodPost, "key-1", "", `{}`)
+		w := request(handler, http.MethodPost, "key-1", "", `{}`)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+		assert.EqualValues(t, 2, calls.Load())
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		handler := Idempotency(idempotency.NewMemoryStore(), time.Hour)(next)
+
+		w := request(handler, http.MethodPost, strings.Repeat("k", maxIdempotencyKeyLength+1), "", `{}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidIdempotencyKey)
+	})
+
+	t.Run("store errors let requests through", func(t *testing.T) {
+		calls.Store(0)
+		handler := Idempotency(failingIdempotencyStore{}, time.Hour)(next)
+
+		request(handler, http.MethodPost, "key-1", "", `{}`)
+		w := request(handler, http.MethodPost, "key-1", "", `{}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.EqualValues(t, 2, calls.Load())
+	})
+}
+
+// claimedStore answers every claim as if another request with the same key were being handled
+type claimedStore struct {
+	idempotency.Store
+}
+
+func (claimedStore) Claim(ctx context.Context, key string, record idempotency.Record, ttl time.Duration) (*idempotency.Record, error) {
+	return &record, nil
+}
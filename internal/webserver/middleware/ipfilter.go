@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/service/ipfilter"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	chimiddleware "github.com/go-chi/chi/middleware"
+)
+
+const errTypeIPBlocked = "ip_blocked"
+
+// IPFilter rejects requests from client IPs the filter doesn't let in with a 403. Blocked
+// requests are logged, and recorded as audit events when auditLog is set. Behind a proxy the
+// client IP is only the real one when the proxy is trusted, see ClientIP.
+func IPFilter(filter *ipfilter.Filter, auditLog audit.Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := httputils.ClientIP(r)
+			addr, err := netip.ParseAddr(ip)
+			if err == nil && filter.Allowed(addr) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			slog.WarnContext(ctx, "request blocked by IP filter", "ip", ip, "path", r.URL.Path)
+			if auditLog != nil {
+				auditLog.Record(ctx, database.CreateAuditEventParams{
+					EventType: database.AuditEventRequestBlocked,
+					IPAddress: ip,
+					UserAgent: r.UserAgent(),
+					RequestID: chimiddleware.GetReqID(ctx),
+				})
+			}
+
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "Requests from your network aren't allowed",
+				Type:       errTypeIPBlocked,
+				StatusCode: http.StatusForbidden,
+			})
+		})
+	}
+}
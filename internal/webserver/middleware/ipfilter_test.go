@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/ipfilter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingAuditLog struct {
+	events []database.CreateAuditEventParams
+}
+
+func (l *recordingAuditLog) Record(ctx context.Context, event database.CreateAuditEventParams) {
+	l.events = append(l.events, event)
+}
+
+func TestIPFilter(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	filter, err := ipfilter.New(ipfilter.Config{
+		Allow: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("2001:db8::/32")},
+		Deny:  []netip.Prefix{netip.MustParsePrefix("192.0.2.66/32")},
+	})
+	require.NoError(t, err)
+	auditLog := &recordingAuditLog{}
+	handler := IPFilter(filter, auditLog)(next)
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/admin/audit", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("User-Agent", "test-agent")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("192.0.2.1:1234").Code)
+	assert.Equal(t, http.StatusOK, request("[2001:db8::1]:1234").Code)
+	assert.Empty(t, auditLog.events)
+
+	w := request("192.0.2.66:1234")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), errTypeIPBlocked)
+
+	assert.Equal(t, http.StatusForbidden, request("198.51.100.7:1234").Code)
+	// an address that can't be parsed isn't let in
+	assert.Equal(t, http.StatusForbidden, request("not-an-address").Code)
+
+	require.Len(t, auditLog.events, 3)
+	assert.Equal(t, database.AuditEventRequestBlocked, auditLog.events[0].EventType)
+	assert.Equal(t, "192.0.2.66", auditLog.events[0].IPAddress)
+	assert.Equal(t, "test-agent", auditLog.events[0].UserAgent)
+	assert.Empty(t, auditLog.events[0].AccountID)
+}
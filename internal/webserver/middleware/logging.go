@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+type requestLogKey struct{}
+
+// requestLog holds what's learned about a request while it's handled, so log lines written
+// with the context the request started with (like the access log) see it too
+type requestLog struct {
+	mu        sync.Mutex
+	accountID string
+}
+
+// RequestLog lets LogHandler add the authenticated account to every log line of the request,
+// including the ones written by middleware that runs before RequireAuth. It should run right
+// after chi's RequestID.
+func RequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestLogKey{}, &requestLog{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// setLogAccountID records the authenticated account for the rest of the request's log lines
+func setLogAccountID(ctx context.Context, accountID string) {
+	rl, ok := ctx.Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.accountID = accountID
+}
+
+func logAccountID(ctx context.Context) string {
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		return claims.AccountID
+	}
+	rl, ok := ctx.Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return ""
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.accountID
+}
+
+// LogHandler adds the request_id, account_id, and route pattern of the request in the
+// record's context, so handlers don't have to pass them to every log call. Only logs written
+// with the *Context slog functions have a context.
+type LogHandler struct {
+	slog.Handler
+}
+
+func NewLogHandler(h slog.Handler) *LogHandler {
+	return &LogHandler{Handler: h}
+}
+
+func (h *LogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := chimiddleware.GetReqID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	if accountID := logAccountID(ctx); accountID != "" {
+		record.AddAttrs(slog.String("account_id", accountID))
+	}
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			record.AddAttrs(slog.String("route", pattern))
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithGroup(name)}
+}
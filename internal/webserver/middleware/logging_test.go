@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogHandler(t *testing.T) {
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	token, _, err := authClient.NewAccessToken(auth.Claims{AccountID: "account-1"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&buf, nil)))
+
+	// logs after the handler, like the access log, with the context the request started with
+	accessLog := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			logger.InfoContext(r.Context(), "access")
+		})
+	}
+
+	r := chi.NewRouter()
+	r.Use(chimiddleware.RequestID, RequestLog, accessLog)
+	r.Route("/v1/accounts", func(r chi.Router) {
+		r.With(RequireAuth(authClient, nil)).Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			logger.InfoContext(r.Context(), "handler")
+		})
+		r.Get("/public", func(w http.ResponseWriter, r *http.Request) {
+			logger.InfoContext(r.Context(), "handler")
+		})
+	})
+
+	lines := func(t *testing.T, path string, authenticated bool) map[string]map[string]any {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authenticated {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		byMessage := map[string]map[string]any{}
+		for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+			var record map[string]any
+			require.NoError(t, json.Unmarshal(line, &record))
+			byMessage[record["msg"].(string)] = record
+		}
+		return byMessage
+	}
+
+	t.Run("authenticated request", func(t *testing.T) {
+		logs := lines(t, "/v1/accounts/123", true)
+		require.Contains(t, logs, "handler")
+		require.Contains(t, logs, "access")
+
+		for _, record := range logs {
+			assert.NotEmpty(t, record["request_id"])
+			assert.Equal(t, "account-1", record["account_id"])
+			assert.Equal(t, "/v1/accounts/{id}", record["route"])
+		}
+		assert.Equal(t, logs["handler"]["request_id"], logs["access"]["request_id"])
+	})
+
+	t.Run("anonymous request", func(t *testing.T) {
+		logs := lines(t, "/v1/accounts/public", false)
+		require.Contains(t, logs, "handler")
+
+		assert.NotEmpty(t, logs["handler"]["request_id"])
+		assert.NotContains(t, logs["handler"], "account_id")
+		assert.Equal(t, "/v1/accounts/public", logs["handler"]["route"])
+	})
+
+	t.Run("logs without a request", func(t *testing.T) {
+		buf.Reset()
+		logger.Info("startup")
+
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		assert.NotContains(t, record, "request_id")
+		assert.NotContains(t, record, "route")
+	})
+}
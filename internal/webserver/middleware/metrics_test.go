@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/service/metrics"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New(prometheus.NewRegistry())
+
+	r := chi.NewRouter()
+	r.Use(Metrics(m))
+	r.Get("/accounts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	r.Get("/ok", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	for _, path := range []string{"/accounts/1", "/accounts/2", "/ok", "/nope/1", "/nope/2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+
+	// requests are labelled by route pattern, not path
+	assert.Contains(t, body, `account_management_http_requests_total{method="GET",route="/accounts/{id}",status="418"} 2`)
+	assert.Contains(t, body, `account_management_http_requests_total{method="GET",route="/ok",status="200"} 1`)
+	assert.Contains(t, body, `account_management_http_requests_total{method="GET",route="unmatched",status="404"} 2`)
+	assert.Contains(t, body, `account_management_http_request_duration_seconds_count{method="GET",route="/ok",status="200"} 1`)
+	assert.False(t, strings.Contains(body, "/accounts/1"))
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Metrics(nil))
+	r.Get("/ok", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
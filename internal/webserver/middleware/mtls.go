@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	errTypeClientCertificateRequired = "client_certificate_required"
+	errTypeForbidden                 = "forbidden"
+)
+
+type clientIdentityKey struct{}
+
+// ClientIdentityFromContext returns the internal service identity of the caller, if
+// RequireClientCert ran.
+func ClientIdentityFromContext(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(clientIdentityKey{}).(string)
+	return identity, ok
+}
+
+// RequireClientCert only lets through internal callers that presented a client certificate
+// verified against the configured CA (see webserver.NewTLSConfig). The certificate's SANs
+// (DNS names, URIs such as SPIFFE IDs, and emails) are looked up in identities, which maps
+// SAN -> service identity; the first match is put on the request context.
+func RequireClientCert(identities map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cert, ok := VerifiedClientCertificate(r)
+			if !ok {
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "A client certificate is required",
+					Type:       errTypeClientCertificateRequired,
+					StatusCode: http.StatusUnauthorized,
+				})
+				return
+			}
+
+			identity, ok := identityForCertificate(cert, identities)
+			if !ok {
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "The client certificate is not allowed to call this endpoint",
+					Type:       errTypeForbidden,
+					StatusCode: http.StatusForbidden,
+				})
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), clientIdentityKey{}, identity)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireClientCertGRPC is RequireClientCert for gRPC calls. The gRPC server requires verified
+// client certificates at the TLS layer, so this only checks the certificate is mapped to an
+// identity.
+func RequireClientCertGRPC(identities map[string]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var cert *x509.Certificate
+		if p, ok := peer.FromContext(ctx); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok &&
+				len(tlsInfo.State.VerifiedChains) > 0 && len(tlsInfo.State.VerifiedChains[0]) > 0 {
+				cert = tlsInfo.State.VerifiedChains[0][0]
+			}
+		}
+		if cert == nil {
+			return nil, status.Error(codes.Unauthenticated, "a client certificate is required")
+		}
+
+		identity, ok := identityForCertificate(cert, identities)
+		if !ok {
+			return nil, status.Error(codes.PermissionDenied, "the client certificate is not allowed to call this method")
+		}
+
+		return handler(context.WithValue(ctx, clientIdentityKey{}, identity), req)
+	}
+}
+
+// VerifiedClientCertificate returns the leaf client certificate of the request's TLS
+// connection if it was verified against the client CA.
+func VerifiedClientCertificate(r *http.Request) (*x509.Certificate, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return r.TLS.VerifiedChains[0][0], true
+}
+
+func identityForCertificate(cert *x509.Certificate, identities map[string]string) (string, bool) {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+
+	for _, san := range sans {
+		if identity, ok := identities[san]; ok {
+			return identity, true
+		}
+	}
+	return "", false
+}
+
+// certificateMatches reports whether a certificate-bound token was presented over a connection
+// using the certificate it was bound to
+func certificateMatches(r *http.Request, cnf *auth.Confirmation) bool {
+	cert, ok := VerifiedClientCertificate(r)
+	if !ok {
+		return false
+	}
+	return auth.CertificateThumbprint(cert) == cnf.X5TS256
+}
@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func newTestCertificate(t *testing.T, dnsNames []string, uris []string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+	}
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		require.NoError(t, err)
+		template.URIs = append(template.URIs, parsed)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+// withClientCert makes the request look like it arrived over mTLS with a verified certificate
+func withClientCert(r *http.Request, cert *x509.Certificate) *http.Request {
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	return r
+}
+
+func TestRequireClientCert(t *testing.T) {
+	identities := map[string]string{
+		"spiffe://internal/billing": "billing",
+		"reports.internal":          "reporting",
+	}
+
+	tests := []struct {
+		name             string
+		cert             *x509.Certificate
+		unverified       bool
+		expectedStatus   int
+		expectedIdentity string
+	}{
+		{
+			name:             "URI SAN",
+			cert:             newTestCertificate(t, nil, []string{"spiffe://internal/billing"}),
+			expectedStatus:   http.StatusOK,
+			expectedIdentity: "billing",
+		},
+		{
+			name:             "DNS SAN",
+			cert:             newTestCertificate(t, []string{"reports.internal"}, nil),
+			expectedStatus:   http.StatusOK,
+			expectedIdentity: "reporting",
+		},
+		{
+			name:           "no certificate",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unverified certificate",
+			cert:           newTestCertificate(t, []string{"reports.internal"}, nil),
+			unverified:     true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown SAN",
+			cert:           newTestCertificate(t, []string{"someone.else"}, nil),
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var identity string
+			h := RequireClientCert(identities)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				identity, _ = ClientIdentityFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/internal", nil)
+			if tt.cert != nil {
+				req = withClientCert(req, tt.cert)
+				if tt.unverified {
+					req.TLS.VerifiedChains = nil
+				}
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedIdentity, identity)
+		})
+	}
+}
+
+func TestRequireClientCertGRPC(t *testing.T) {
+	interceptor := RequireClientCertGRPC(map[string]string{"spiffe://internal/billing": "billing"})
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		identity, _ := ClientIdentityFromContext(ctx)
+		return identity, nil
+	}
+	call := func(cert *x509.Certificate) (any, error) {
+		ctx := context.Background()
+		if cert != nil {
+			ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			}}})
+		}
+		return interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}, handler)
+	}
+
+	identity, err := call(newTestCertificate(t, nil, []string{"spiffe://internal/billing"}))
+	require.NoError(t, err)
+	assert.Equal(t, "billing", identity)
+
+	_, err = call(nil)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = call(newTestCertificate(t, []string{"someone.else"}, nil))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestRequireAuthCertificateBound(t *testing.T) {
+	client := auth.NewClient(auth.Config{
+		JWTSecretKey:          "test-secret-key",
+		AccessTokenTTLMinutes: 15,
+	})
+
+	cert := newTestCertificate(t, []string{"client.internal"}, nil)
+	otherCert := newTestCertificate(t, []string{"client.internal"}, nil)
+
+	boundToken, _, err := client.NewAccessToken(auth.Claims{
+		AccountID:    "test-account-id",
+		Confirmation: &auth.Confirmation{X5TS256: auth.CertificateThumbprint(cert)},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		cert           *x509.Certificate
+		expectedStatus int
+	}{
+		{name: "same certificate", cert: cert, expectedStatus: http.StatusOK},
+		{name: "different certificate", cert: otherCert, expectedStatus: http.StatusUnauthorized},
+		{name: "no certificate", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RequireAuth(client, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+boundToken)
+			if tt.cert != nil {
+				req = withClientCert(req, tt.cert)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/ratelimit"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeRateLimited = "rate_limited"
+
+// RateLimit limits the routes that have a rule, per client IP or, for per account rules, per
+// authenticated account. Responses on limited routes carry X-RateLimit-Limit,
+// X-RateLimit-Remaining, and X-RateLimit-Reset (seconds until the bucket is full), and rejected
+// requests get a 429 with Retry-After. Store errors are logged and the request is let through,
+// so rate limiting going down doesn't take the service with it. Rules replaced in the set apply
+// from the next request. Rules name the /v1 route and cover it in every version of the API, with
+// the versions sharing a bucket.
+func RateLimit(store ratelimit.Store, parser AccessTokenParser, rules *ratelimit.RuleSet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.Method + " " + v1Path(r)
+			rule, ok := rules.Lookup(route)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := route + "|ip:" + httputils.ClientIP(r)
+			if rule.PerAccount {
+				if accountID, ok := accountID(r, parser); ok {
+					key = route + "|account:" + accountID
+				}
+			}
+
+			res, err := store.Take(r.Context(), key, rule.Limit)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "error checking rate limit, allowing request", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(roundUpSeconds(res.ResetAfter)))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(roundUpSeconds(res.RetryAfter)))
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "Too many requests, try again later",
+					Type:       errTypeRateLimited,
+					StatusCode: http.StatusTooManyRequests,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// accountID is the account of a valid bearer token. RequireAuth still checks the token (and
+// its certificate binding) on the way to the handler.
+func accountID(r *http.Request, parser AccessTokenParser) (string, bool) {
+	if parser == nil {
+		return "", false
+	}
+	tokenString, ok := BearerToken(r)
+	if !ok {
+		return "", false
+	}
+	claims, err := parser.ParseAccessToken(tokenString)
+	if err != nil {
+		return "", false
+	}
+	// client credentials tokens have no account
+	return claims.AccountID, claims.AccountID != ""
+}
+
+// roundUpSeconds rounds up so clients never retry a moment too early
+func roundUpSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rules := []ratelimit.Rule{
+		{Method: http.MethodPost, Path: "/v1/accounts/login", Limit: ratelimit.Limit{Requests: 2, Period: time.Minute}},
+		{Method: http.MethodPost, Path: "/v1/accounts/password/change", Limit: ratelimit.Limit{Requests: 1, Period: time.Minute}, PerAccount: true},
+	}
+
+	request := func(handler http.Handler, method, path, remoteAddr, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("per IP", func(t *testing.T) {
+		handler := RateLimit(ratelimit.NewMemoryStore(), authClient, ratelimit.NewRuleSet(rules))(next)
+
+		for remaining := 1; remaining >= 0; remaining-- {
+			w := request(handler, http.MethodPost, "/v1/accounts/login", "192.0.2.1:1234", "")
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+			assert.Equal(t, strconv.Itoa(remaining), w.Header().Get("X-RateLimit-Remaining"))
+			assert.NotEmpty(t, w.Header().Get("X-RateLimit-Reset"))
+		}
+
+		w := request(handler, http.MethodPost, "/v1/accounts/login", "192.0.2.1:5678", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+		assert.Contains(t, w.Body.String(), errTypeRateLimited)
+
+		// other clients aren't affected
+		w = request(handler, http.MethodPost, "/v1/accounts/login", "192.0.2.2:1234", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// nor are routes without a rule
+		w = request(handler, http.MethodGet, "/v1/accounts/login", "192.0.2.1:1234", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+	})
+
+	t.Run("per account", func(t *testing.T) {
+		handler := RateLimit(ratelimit.NewMemoryStore(), authClient, ratelimit.NewRuleSet(rules))(next)
+
+		first, _, err := authClient.NewAccessToken(auth.Claims{AccountID: "account-1"})
+		require.NoError(t, err)
+		second, _, err := authClient.NewAccessToken(auth.Claims{AccountID: "account-2"})
+		require.NoError(t, err)
+
+		w := request(handler, http.MethodPost, "/v1/accounts/password/change", "192.0.2.1:1234", first)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// from another IP too
+		w = request(handler, http.MethodPost, "/v1/accounts/password/change", "192.0.2.2:1234", first)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+		// other accounts behind the same IP aren't affected
+		w = request(handler, http.MethodPost, "/v1/accounts/password/change", "192.0.2.1:1234", second)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// requests without a valid token are limited by IP
+		w = request(handler, http.MethodPost, "/v1/accounts/password/change", "192.0.2.3:1234", "not-a-token")
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = request(handler, http.MethodPost, "/v1/accounts/password/change", "192.0.2.3:1234", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("versions share a bucket", func(t *testing.T) {
+		store := ratelimit.NewMemoryStore()
+		v1 := RateLimit(store, authClient, ratelimit.NewRuleSet(rules))(next)
+		v2 := APIVersion(2)(RateLimit(store, authClient, ratelimit.NewRuleSet(rules))(next))
+
+		w := request(v1, http.MethodPost, "/v1/accounts/login", "192.0.2.1:1234", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		w = request(v2, http.MethodPost, "/v2/accounts/login", "192.0.2.1:1234", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+		w = request(v2, http.MethodPost, "/v2/accounts/login", "192.0.2.1:1234", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("store errors let requests through", func(t *testing.T) {
+		handler := RateLimit(failingRateLimitStore{}, authClient, ratelimit.NewRuleSet(rules))(next)
+
+		for range 3 {
+			w := request(handler, http.MethodPost, "/v1/accounts/login", "192.0.2.1:1234", "")
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+	})
+}
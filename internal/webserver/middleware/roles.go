@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+// RequireRole only lets through callers whose access token carries the role. It goes after
+// RequireAuth, requests without claims on the context are rejected as unauthenticated.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeUnauthorized(w, r, "A bearer access token is required")
+				return
+			}
+
+			if !claims.HasRole(role) {
+				slog.DebugContext(r.Context(), "rejected access token without the required role", "role", role)
+				httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+					Message:    "The account is not allowed to call this endpoint",
+					Type:       errTypeForbidden,
+					StatusCode: http.StatusForbidden,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
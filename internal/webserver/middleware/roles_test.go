@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name           string
+		claims         *auth.Claims
+		expectedStatus int
+		expectedType   string
+	}{
+		{
+			name:           "has the role",
+			claims:         &auth.Claims{AccountID: "account-id", Roles: []string{"support", "admin"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "other roles",
+			claims:         &auth.Claims{AccountID: "account-id", Roles: []string{"support"}},
+			expectedStatus: http.StatusForbidden,
+			expectedType:   errTypeForbidden,
+		},
+		{
+			name:           "no roles",
+			claims:         &auth.Claims{AccountID: "account-id"},
+			expectedStatus: http.StatusForbidden,
+			expectedType:   errTypeForbidden,
+		},
+		{
+			name:           "not authenticated",
+			expectedStatus: http.StatusUnauthorized,
+			expectedType:   errTypeUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RequireRole("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.claims != nil {
+				req = req.WithContext(WithClaims(req.Context(), tt.claims))
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				return
+			}
+			var resp httputils.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedType, resp.Type)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/austinwofford/account-management/internal/webserver"
+
+// Tracing starts a server span for every request, continuing the caller's trace when the
+// request carries a traceparent header. Like Metrics it has to run before routing, the span is
+// renamed to the route pattern once the request is done.
+func Tracing() func(http.Handler) http.Handler {
+	tracer := otel.Tracer(tracerName)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.URLPath(r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			route := matchedRoute(r)
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(
+				semconv.HTTPRoute(route),
+				semconv.HTTPResponseStatusCode(sw.code),
+			)
+			// 4xx are the client's problem, not an error in this service
+			if sw.code >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(sw.code))
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+// APIVersion routes the requests it wraps to a version of the public API, see
+// httputils.APIVersion
+func APIVersion(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(httputils.WithAPIVersion(r.Context(), version)))
+		})
+	}
+}
+
+// v1Path is the request's path with a later version's prefix swapped for /v1, so settings keyed
+// by route, like rate limits, name a route once for every version
+func v1Path(r *http.Request) string {
+	version := httputils.APIVersion(r.Context())
+	if version < 2 {
+		return r.URL.Path
+	}
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/v"+strconv.Itoa(version)+"/"); ok {
+		return "/v1/" + rest
+	}
+	return r.URL.Path
+}
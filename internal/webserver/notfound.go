@@ -0,0 +1,65 @@
+package webserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	errTypeNotFound         = "not_found"
+	errTypeMethodNotAllowed = "method_not_allowed"
+)
+
+// routeMethods are the methods checked for the Allow header of a 405
+var routeMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// notFound replaces chi's plain text 404 with the usual JSON error
+func notFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Not found",
+		Type:       errTypeNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
+
+// methodNotAllowed replaces chi's empty 405 with the usual JSON error. chi only passes the
+// allowed methods to its own handler, so they're found again by matching the path against
+// routes, which has to be the root router.
+func methodNotAllowed(routes chi.Routes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range routeMethods {
+			if routes.Match(chi.NewRouteContext(), method, r.URL.Path) {
+				allowed = append(allowed, method)
+			}
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "Method not allowed",
+			Type:       errTypeMethodNotAllowed,
+			StatusCode: http.StatusMethodNotAllowed,
+		})
+	}
+}
+
+// mount mounts h at pattern on r with root's 404 and 405 handlers. chi only passes them on to
+// a mounted *chi.Mux, not the handlers that embed one.
+func mount(root *chi.Mux, r chi.Router, pattern string, h http.Handler) {
+	if sub, ok := h.(chi.Router); ok {
+		sub.NotFound(root.NotFoundHandler())
+		sub.MethodNotAllowed(root.MethodNotAllowedHandler())
+	}
+	r.Mount(pattern, h)
+}
@@ -0,0 +1,99 @@
+package webserver
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingErrors(t *testing.T) {
+	router, err := NewRouter(config.Config{
+		DevMode:      true,
+		JWTSecretKey: "routing-test-secret",
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedType   string
+		expectedAllow  string
+	}{
+		{
+			name:           "unknown route",
+			method:         http.MethodGet,
+			path:           "/v1/nope",
+			expectedStatus: http.StatusNotFound,
+			expectedType:   errTypeNotFound,
+		},
+		{
+			name:           "unknown route in a mounted router",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/nope",
+			expectedStatus: http.StatusNotFound,
+			expectedType:   errTypeNotFound,
+		},
+		{
+			name:           "wrong method",
+			method:         http.MethodGet,
+			path:           "/v1/accounts/login",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedType:   errTypeMethodNotAllowed,
+			expectedAllow:  "POST",
+		},
+		{
+			name:           "wrong method on a route with several",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/me",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedType:   errTypeMethodNotAllowed,
+			expectedAllow:  "GET, PATCH, DELETE",
+		},
+		{
+			name:           "form body",
+			method:         http.MethodPost,
+			path:           "/v1/accounts/login",
+			contentType:    "application/x-www-form-urlencoded",
+			body:           "email=test@example.com&password=Test123!@#",
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedType:   "unsupported_media_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req := httptest.NewRequest(tt.method, tt.path, body)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.expectedAllow, w.Header().Get("Allow"))
+
+			var resp httputils.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedType, resp.Type)
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/google/uuid"
+)
+
+// authorizationCodeTTL is how long a client has to trade an authorization code for a token.
+// RFC 6749 recommends at most 10 minutes.
+const authorizationCodeTTL = 10 * time.Minute
+
+// The authorization endpoint's error codes (RFC 6749 section 4.1.2.1)
+const (
+	errTypeUnsupportedResponseType = "unsupported_response_type"
+	errTypeInvalidScope            = "invalid_scope"
+	errTypeUnauthorizedClient      = "unauthorized_client"
+	errTypeAccessDenied            = "access_denied"
+)
+
+// authorizationRequest is an OAuth client's request for an authorization code (RFC 6749 section
+// 4.1.1). The web app gets it in the query string of the client's redirect to its consent page.
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	// Nonce is passed through to the ID token (OpenID Connect Core section 3.1.2.1)
+	Nonce string `json:"nonce"`
+}
+
+type authorizeRequest struct {
+	authorizationRequest
+	// Approved is the account's answer on the consent page
+	Approved bool `json:"approved"`
+}
+
+type consentClient struct {
+	ClientID string `json:"client_id"`
+	Name     string `json:"name"`
+}
+
+// consentResponse is what the consent page shows the account
+type consentResponse struct {
+	Client      consentClient `json:"client"`
+	Scopes      []string      `json:"scopes"`
+	RedirectURI string        `json:"redirect_uri"`
+	State       string        `json:"state,omitempty"`
+}
+
+// authorizeResponse is where the web app sends the browser next, back to the client
+type authorizeResponse struct {
+	RedirectURI string `json:"redirect_uri"`
+}
+
+// validatedAuthorization is an authorization request that checked out
+type validatedAuthorization struct {
+	client *database.OAuthClient
+	scopes []string
+}
+
+// getAuthorization checks an authorization request for the consent page and returns what the
+// account is being asked to approve. The web app renders the page, this service only vouches
+// for the client and its redirect URI.
+func (h *handler) getAuthorization(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := authorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+		Nonce:               query.Get("nonce"),
+	}
+
+	validated, ok := h.validateAuthorization(w, r, req)
+	if !ok {
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, consentResponse{
+		Client:      consentClient{ClientID: validated.client.ID, Name: validated.client.Name},
+		Scopes:      validated.scopes,
+		RedirectURI: req.RedirectURI,
+		State:       req.State,
+	})
+}
+
+// authorize records the account's answer to an authorization request. Either way the response
+// has the client's redirect URI to send the browser to, with an authorization code if the
+// account approved and an access_denied error if it didn't.
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+	accountToken, _ := middleware.AccessTokenFromContext(ctx)
+
+	var reqBody authorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	validated, ok := h.validateAuthorization(w, r, reqBody.authorizationRequest)
+	if !ok {
+		return
+	}
+
+	params := url.Values{}
+	if reqBody.State != "" {
+		params.Set("state", reqBody.State)
+	}
+
+	if !reqBody.Approved {
+		params.Set("error", errTypeAccessDenied)
+		httputils.WriteJSONResponse(w, r, http.StatusOK, authorizeResponse{RedirectURI: withQuery(reqBody.RedirectURI, params)})
+		return
+	}
+
+	code, err := auth.NewOpaqueToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating oauth authorization code", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	err = h.db.CreateOAuthAuthorizationCode(ctx, database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashOpaqueToken(code),
+		ClientID:      validated.client.ID,
+		AccountID:     claims.AccountID,
+		RedirectURI:   reqBody.RedirectURI,
+		Scopes:        validated.scopes,
+		CodeChallenge: reqBody.CodeChallenge,
+		Nonce:         reqBody.Nonce,
+		// the account's access token is the closest thing to when it signed in. Refreshed tokens
+		// make it later than the actual sign in.
+		AuthTime:  accountToken.IssuedAt,
+		ExpiresAt: time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating oauth authorization code", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	params.Set("code", code)
+	httputils.WriteJSONResponse(w, r, http.StatusOK, authorizeResponse{RedirectURI: withQuery(reqBody.RedirectURI, params)})
+}
+
+// validateAuthorization checks an authorization request, writing an error if it's no good. The
+// client and redirect URI are checked first, since nothing can be sent back to a redirect URI
+// that isn't the client's (RFC 6749 section 4.1.2.1).
+func (h *handler) validateAuthorization(w http.ResponseWriter, r *http.Request, req authorizationRequest) (*validatedAuthorization, bool) {
+	ctx := r.Context()
+
+	if _, err := uuid.Parse(req.ClientID); err != nil {
+		writeClientNotFound(w, r)
+		return nil, false
+	}
+	client, err := h.db.GetOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, database.ErrOAuthClientNotFound) {
+			writeClientNotFound(w, r)
+			return nil, false
+		}
+		slog.ErrorContext(ctx, "error getting oauth client", "error", err)
+		writeUnexpectedError(w, r)
+		return nil, false
+	}
+
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		writeAuthorizationError(w, r, errTypeInvalidRequest, "redirect_uri must be one of the client's registered redirect URIs")
+		return nil, false
+	}
+	if req.ResponseType != "code" {
+		writeAuthorizationError(w, r, errTypeUnsupportedResponseType, "response_type must be code")
+		return nil, false
+	}
+	if !slices.Contains(client.GrantTypes, grantTypeAuthorizationCode) {
+		writeAuthorizationError(w, r, errTypeUnauthorizedClient, "The client isn't registered for the authorization_code grant")
+		return nil, false
+	}
+	// PKCE is required of every client, confidential ones too (RFC 9700 section 2.1.1)
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != 43 {
+		writeAuthorizationError(w, r, errTypeInvalidRequest, "A code_challenge with code_challenge_method S256 is required")
+		return nil, false
+	}
+
+	scopes, ok := requestedScopes(req.Scope, client)
+	if !ok {
+		writeAuthorizationError(w, r, errTypeInvalidScope, "The client isn't allowed the requested scope")
+		return nil, false
+	}
+
+	return &validatedAuthorization{client: client, scopes: scopes}, true
+}
+
+// withQuery adds params to a redirect URI, keeping any query it already has
+func withQuery(redirectURI string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	return redirectURI + separator + params.Encode()
+}
+
+func writeAuthorizationError(w http.ResponseWriter, r *http.Request, errType, message string) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    message,
+		Type:       errType,
+		StatusCode: http.StatusBadRequest,
+	})
+}
@@ -0,0 +1,228 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	errTypeValidationError     = "validation_error"
+	errTypeOAuthClientNotFound = "oauth_client_not_found"
+
+	maxClientNameLength = 255
+)
+
+// The grant types clients can be registered for
+const (
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+var grantTypes = []string{grantTypeClientCredentials, grantTypeAuthorizationCode, grantTypeTokenExchange}
+
+type createClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+	// Public clients, like mobile and single page apps, can't keep a secret. They only get the
+	// authorization code grant, secured with PKCE.
+	Public bool `json:"public"`
+}
+
+type clientResponse struct {
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	Public       bool      `json:"public"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"created_at"`
+	// ClientSecret is only returned when a confidential client is registered
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func newClientResponse(c database.OAuthClient) clientResponse {
+	return clientResponse{
+		ClientID:     c.ID,
+		Name:         c.Name,
+		Public:       c.SecretHash == nil,
+		RedirectURIs: c.RedirectURIs,
+		GrantTypes:   c.GrantTypes,
+		Scopes:       c.Scopes,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+type listClientsResponse struct {
+	Clients []clientResponse `json:"clients"`
+}
+
+// createClient registers an OAuth client. Confidential clients get their secret in the
+// response, it isn't shown again.
+func (h *handler) createClient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody createClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	name := strings.TrimSpace(reqBody.Name)
+	if name == "" || len(name) > maxClientNameLength {
+		writeClientValidationError(w, r, "name is required and can be at most 255 characters")
+		return
+	}
+
+	clientGrantTypes := slices.Compact(slices.Sorted(slices.Values(reqBody.GrantTypes)))
+	if len(clientGrantTypes) == 0 {
+		writeClientValidationError(w, r, "grant_types must list at least one grant type")
+		return
+	}
+	for _, grantType := range clientGrantTypes {
+		if !slices.Contains(grantTypes, grantType) {
+			writeClientValidationError(w, r, fmt.Sprintf("grant_types must be some of %s", strings.Join(grantTypes, ", ")))
+			return
+		}
+	}
+	if reqBody.Public && (slices.Contains(clientGrantTypes, grantTypeClientCredentials) || slices.Contains(clientGrantTypes, grantTypeTokenExchange)) {
+		writeClientValidationError(w, r, "public clients can't use the client_credentials or token exchange grants")
+		return
+	}
+
+	scopes := slices.Compact(slices.Sorted(slices.Values(reqBody.Scopes)))
+	// the OpenID Connect scopes are only offered with OpenID Connect on
+	allowedScopes, valid := auth.Scopes, auth.ValidScopes(scopes)
+	if h.issuer != "" {
+		allowedScopes, valid = auth.OAuthScopes, auth.ValidOAuthScopes(scopes)
+	}
+	if len(scopes) == 0 || !valid {
+		writeClientValidationError(w, r, fmt.Sprintf("scopes must be some of %s", strings.Join(allowedScopes, ", ")))
+		return
+	}
+
+	if slices.Contains(clientGrantTypes, grantTypeAuthorizationCode) && len(reqBody.RedirectURIs) == 0 {
+		writeClientValidationError(w, r, "redirect_uris is required for the authorization_code grant")
+		return
+	}
+	for _, redirectURI := range reqBody.RedirectURIs {
+		// custom schemes are allowed for native apps (RFC 8252), fragments never are (RFC 6749 section 3.1.2)
+		u, err := url.Parse(redirectURI)
+		if err != nil || !u.IsAbs() || u.Fragment != "" || (u.Scheme == "http" && !isLoopback(u)) {
+			writeClientValidationError(w, r, "redirect_uris must be absolute URIs without a fragment, http only for loopback addresses")
+			return
+		}
+	}
+
+	params := database.CreateOAuthClientParams{
+		Name:         name,
+		RedirectURIs: reqBody.RedirectURIs,
+		GrantTypes:   clientGrantTypes,
+		Scopes:       scopes,
+	}
+	var secret string
+	if !reqBody.Public {
+		var err error
+		secret, err = auth.NewOpaqueToken()
+		if err != nil {
+			slog.ErrorContext(ctx, "error generating oauth client secret", "error", err)
+			writeUnexpectedError(w, r)
+			return
+		}
+		params.SecretHash = auth.HashOpaqueToken(secret)
+	}
+
+	client, err := h.db.CreateOAuthClient(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating oauth client", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	resp := newClientResponse(*client)
+	resp.ClientSecret = secret
+	httputils.WriteJSONResponse(w, r, http.StatusCreated, resp)
+}
+
+// listClients lists the registered OAuth clients, newest first
+func (h *handler) listClients(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	clients, err := h.db.ListOAuthClients(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing oauth clients", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	resp := listClientsResponse{Clients: make([]clientResponse, 0, len(clients))}
+	for _, client := range clients {
+		resp.Clients = append(resp.Clients, newClientResponse(client))
+	}
+	httputils.WriteJSONResponse(w, r, http.StatusOK, resp)
+}
+
+// deleteClient removes an OAuth client. It can't get new tokens, and tokens it already has stop
+// being active in introspection.
+func (h *handler) deleteClient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeClientNotFound(w, r)
+		return
+	}
+
+	if err := h.db.DeleteOAuthClient(ctx, id); err != nil {
+		if errors.Is(err, database.ErrOAuthClientNotFound) {
+			writeClientNotFound(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error deleting oauth client", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isLoopback reports whether the URI points at the machine it's opened on, where native apps
+// listen for the redirect (RFC 8252 section 7.3)
+func isLoopback(u *url.URL) bool {
+	host := u.Hostname()
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+func writeClientValidationError(w http.ResponseWriter, r *http.Request, message string) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    message,
+		Type:       errTypeValidationError,
+		StatusCode: http.StatusUnprocessableEntity,
+	})
+}
+
+func writeClientNotFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "The OAuth client was not found",
+		Type:       errTypeOAuthClientNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
@@ -0,0 +1,132 @@
+package oauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClients(t *testing.T) {
+	db := database.NewMemoryDB()
+	h := NewHandler(HandlerDeps{
+		DB:         db,
+		AuthClient: auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15}),
+		Auth:       passthrough,
+	})
+
+	do := func(t *testing.T, method, path string, body any) *httptest.ResponseRecorder {
+		var reqBody bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&reqBody).Encode(body))
+		}
+		req := httptest.NewRequest(method, path, &reqBody)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	var confidential clientResponse
+	t.Run("register a confidential client", func(t *testing.T) {
+		w := do(t, http.MethodPost, "/clients", map[string]any{
+			"name":          "reporting",
+			"grant_types":   []string{"client_credentials", "authorization_code", "client_credentials"},
+			"scopes":        []string{auth.ScopeSessionsWrite, auth.ScopeAccountRead},
+			"redirect_uris": []string{"https://reporting.example.com/callback"},
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &confidential))
+		assert.NotEmpty(t, confidential.ClientID)
+		assert.NotEmpty(t, confidential.ClientSecret)
+		assert.False(t, confidential.Public)
+		assert.Equal(t, []string{"authorization_code", "client_credentials"}, confidential.GrantTypes)
+		assert.Equal(t, []string{auth.ScopeAccountRead, auth.ScopeSessionsWrite}, confidential.Scopes)
+
+		// only the hash is stored
+		stored, err := db.GetOAuthClient(t.Context(), confidential.ClientID)
+		require.NoError(t, err)
+		require.NotNil(t, stored.SecretHash)
+		assert.Equal(t, auth.HashOpaqueToken(confidential.ClientSecret), *stored.SecretHash)
+	})
+
+	t.Run("register a public client", func(t *testing.T) {
+		w := do(t, http.MethodPost, "/clients", map[string]any{
+			"name":          "mobile",
+			"public":        true,
+			"grant_types":   []string{"authorization_code"},
+			"scopes":        []string{auth.ScopeAccountRead},
+			"redirect_uris": []string{"com.example.app:/callback", "http://127.0.0.1:8080/callback"},
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp clientResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.Public)
+		assert.Empty(t, resp.ClientSecret)
+	})
+
+	t.Run("invalid clients", func(t *testing.T) {
+		valid := func() map[string]any {
+			return map[string]any{
+				"name":          "app",
+				"grant_types":   []string{"authorization_code"},
+				"scopes":        []string{auth.ScopeAccountRead},
+				"redirect_uris": []string{"https://app.example.com/callback"},
+			}
+		}
+		tests := map[string]func(body map[string]any){
+			"no name":              func(body map[string]any) { body["name"] = " " },
+			"no grant types":       func(body map[string]any) { delete(body, "grant_types") },
+			"unknown grant type":   func(body map[string]any) { body["grant_types"] = []string{"password"} },
+			"public and secretive": func(body map[string]any) { body["public"] = true; body["grant_types"] = []string{"client_credentials"} },
+			"no scopes":            func(body map[string]any) { delete(body, "scopes") },
+			"unknown scope":        func(body map[string]any) { body["scopes"] = []string{"account:delete"} },
+			"openid without oidc":  func(body map[string]any) { body["scopes"] = []string{auth.ScopeOpenID} },
+			"no redirect uris":     func(body map[string]any) { delete(body, "redirect_uris") },
+			"relative redirect":    func(body map[string]any) { body["redirect_uris"] = []string{"/callback"} },
+			"redirect fragment":    func(body map[string]any) { body["redirect_uris"] = []string{"https://app.example.com/callback#x"} },
+			"plain http redirect":  func(body map[string]any) { body["redirect_uris"] = []string{"http://app.example.com/callback"} },
+		}
+		for name, modify := range tests {
+			t.Run(name, func(t *testing.T) {
+				body := valid()
+				modify(body)
+				w := do(t, http.MethodPost, "/clients", body)
+				require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+				var resp httputils.ErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, errTypeValidationError, resp.Type)
+			})
+		}
+	})
+
+	t.Run("list clients", func(t *testing.T) {
+		w := do(t, http.MethodGet, "/clients", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp listClientsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp.Clients, 2)
+		for _, client := range resp.Clients {
+			assert.Empty(t, client.ClientSecret)
+		}
+	})
+
+	t.Run("delete a client", func(t *testing.T) {
+		w := do(t, http.MethodDelete, "/clients/"+confidential.ClientID, nil)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		for _, id := range []string{confidential.ClientID, "not-a-uuid"} {
+			w = do(t, http.MethodDelete, "/clients/"+id, nil)
+			require.Equal(t, http.StatusNotFound, w.Code)
+			var resp httputils.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, errTypeOAuthClientNotFound, resp.Type)
+		}
+	})
+}
@@ -0,0 +1,117 @@
+// Package oauth serves the /v1/oauth routes: the OAuth 2.0 endpoints other services call about
+// tokens issued here, and a lightweight authorization server for registered OAuth clients
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// Repository defines the DB methods needed by OAuth handlers
+type Repository interface {
+	GetAccountByID(ctx context.Context, id string) (*database.Account, error)
+	CreateOAuthClient(ctx context.Context, params database.CreateOAuthClientParams) (*database.OAuthClient, error)
+	GetOAuthClient(ctx context.Context, id string) (*database.OAuthClient, error)
+	ListOAuthClients(ctx context.Context) ([]database.OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, id string) error
+	CreateOAuthAuthorizationCode(ctx context.Context, params database.CreateOAuthAuthorizationCodeParams) error
+	ConsumeOAuthAuthorizationCode(ctx context.Context, codeHash string) (*database.OAuthAuthorizationCode, error)
+}
+
+type handler struct {
+	db          Repository
+	authClient  *auth.Client
+	revocations *revocation.List
+	// accessTokenRevocations are the access tokens revoked before they expire
+	accessTokenRevocations *revocation.AccessTokens
+	// issuer is the OpenID Connect issuer, empty when OpenID Connect is off
+	issuer string
+	// tokenExchangeTTL is how long delegation tokens last at most
+	tokenExchangeTTL time.Duration
+
+	chi.Router
+}
+
+type HandlerDeps struct {
+	DB         Repository
+	AuthClient *auth.Client
+	// Auth authenticates the calling service, for introspection and registering clients
+	Auth func(http.Handler) http.Handler
+	// Revocations are the accounts whose tokens were revoked, the same list the accounts
+	// handler revokes them in. Defaults to an in-memory list.
+	Revocations *revocation.List
+	// AccessTokenRevocations are the access tokens revoked by the accounts handler. Defaults to an
+	// in-memory list.
+	AccessTokenRevocations *revocation.AccessTokens
+	// Issuer is the OpenID Connect issuer URL. When set, clients can be registered for the openid
+	// and email scopes, get ID tokens, and call userinfo.
+	Issuer string
+	// TokenExchangeTTL is how long tokens issued by token exchange last at most. Defaults to
+	// DefaultTokenExchangeTTL.
+	TokenExchangeTTL time.Duration
+}
+
+func NewHandler(deps HandlerDeps) http.Handler {
+	mux := chi.NewMux()
+
+	h := handler{
+		db:          deps.DB,
+		authClient:  deps.AuthClient,
+		revocations: deps.Revocations,
+
+		accessTokenRevocations: deps.AccessTokenRevocations,
+		issuer:                 deps.Issuer,
+		tokenExchangeTTL:       deps.TokenExchangeTTL,
+	}
+
+	if h.revocations == nil {
+		h.revocations = revocation.NewList(lockout.NewMemoryStore(), h.authClient.RefreshTokenTTL())
+	}
+	if h.tokenExchangeTTL == 0 {
+		h.tokenExchangeTTL = DefaultTokenExchangeTTL
+	}
+	if h.accessTokenRevocations == nil {
+		h.accessTokenRevocations = revocation.NewAccessTokens(revocation.NewMemoryTokenStore())
+	}
+
+	// for other services
+	mux.Group(func(r chi.Router) {
+		r.Use(deps.Auth)
+		r.Post("/introspect", h.introspect)
+		r.Post("/clients", h.createClient)
+		r.Get("/clients", h.listClients)
+		r.Delete("/clients/{id}", h.deleteClient)
+	})
+
+	// for the web app's consent page, on behalf of the signed in account
+	mux.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(h.authClient, h.accessTokenRevocations))
+		r.Get("/authorize", h.getAuthorization)
+		r.Post("/authorize", h.authorize)
+	})
+
+	// OAuth clients authenticate themselves
+	mux.Post("/token", h.token)
+
+	// OpenID Connect clients ask about the account that signed in
+	if h.issuer != "" {
+		mux.Group(func(r chi.Router) {
+			r.Use(middleware.RequireOAuthClient(h.authClient, h.accessTokenRevocations))
+			r.Use(middleware.RequireScope(auth.ScopeOpenID))
+			r.Get("/userinfo", h.userinfo)
+			r.Post("/userinfo", h.userinfo)
+		})
+	}
+
+	h.Router = mux
+
+	return h
+}
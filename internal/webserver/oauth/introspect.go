@@ -0,0 +1,160 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeInvalidRequest = "invalid_request"
+
+// introspectionResponse is the RFC 7662 token introspection response. Everything but Active is
+// left out for inactive tokens, so callers can't learn anything about them.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	TokenID   string `json:"jti,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	// OrgID is set for organization-scoped tokens
+	OrgID string `json:"org_id,omitempty"`
+	// Roles are the account's roles when the token was issued
+	Roles []string `json:"roles,omitempty"`
+	// ClientID and Scope are set for tokens issued to OAuth clients
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// Actor is set for delegation tokens, naming the client acting on the account's behalf
+	Actor *auth.Actor `json:"act,omitempty"`
+	// Confirmation is set for certificate-bound tokens (RFC 8705), the caller has to check the
+	// client presented the certificate
+	Confirmation *auth.Confirmation `json:"cnf,omitempty"`
+}
+
+// introspect tells a service whether an access token is still good (RFC 7662), see
+// activeAccessToken. The token is sent form encoded like the RFC has it.
+// token_type_hint is accepted but only access tokens are ever active.
+func (h *handler) introspect(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "A token is required",
+			Type:       errTypeInvalidRequest,
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	// the answer changes as soon as the token is revoked
+	w.Header().Set("Cache-Control", "no-store")
+
+	claims, active, err := h.activeAccessToken(ctx, token)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking token for introspection", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+	if !active {
+		writeInactive(w, r)
+		return
+	}
+
+	// client credentials tokens have no account, the client is the subject
+	subject := claims.ClientID
+	if claims.AccountID != "" {
+		subject = claims.AccountID
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, introspectionResponse{
+		Active:       true,
+		Subject:      subject,
+		ClientID:     claims.ClientID,
+		Scope:        claims.Scope,
+		ExpiresAt:    claims.ExpiresAt.Unix(),
+		IssuedAt:     claims.IssuedAt.Unix(),
+		TokenID:      claims.ID,
+		TokenType:    "Bearer",
+		OrgID:        claims.OrgID,
+		Roles:        claims.Roles,
+		Actor:        claims.Actor,
+		Confirmation: claims.Confirmation,
+	})
+}
+
+// activeAccessToken parses an access token and reports whether it's still good: its signature
+// and expiry are valid, it wasn't revoked, the account still exists and isn't frozen, and the
+// account's tokens weren't revoked since it was issued (only tracked with signed refresh tokens).
+// Tokens issued to an OAuth client also need the client to still be registered.
+func (h *handler) activeAccessToken(ctx context.Context, tokenString string) (*auth.AccessToken, bool, error) {
+	token, err := h.authClient.InspectAccessToken(tokenString)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	revoked, err := h.accessTokenRevocations.Revoked(ctx, token.ID)
+	if err != nil || revoked {
+		return nil, false, err
+	}
+
+	// tokens stop working with the client they were issued to
+	if token.ClientID != "" {
+		registered, err := h.clientRegistered(ctx, token.ClientID)
+		if err != nil || !registered {
+			return nil, false, err
+		}
+	}
+
+	if token.AccountID != "" {
+		active, err := h.accountTokenActive(ctx, token)
+		if err != nil || !active {
+			return nil, false, err
+		}
+	}
+	return token, true, nil
+}
+
+// accountTokenActive reports whether the account a token was issued to still exists, isn't
+// frozen, and hasn't had its tokens revoked since
+func (h *handler) accountTokenActive(ctx context.Context, token *auth.AccessToken) (bool, error) {
+	active, err := h.accountActive(ctx, token.AccountID)
+	if err != nil || !active {
+		return false, err
+	}
+
+	revokedAt, err := h.revocations.AccountRevokedAt(ctx, token.AccountID)
+	if err != nil {
+		// fail closed rather than vouch for a token that may have been revoked
+		return false, err
+	}
+	// iat only has second precision, so tokens issued in the same second as the revocation (like
+	// the ones a password change hands out) stay active
+	return !token.IssuedAt.Before(revokedAt.Truncate(time.Second)), nil
+}
+
+// clientRegistered reports whether the OAuth client wasn't deleted
+func (h *handler) clientRegistered(ctx context.Context, clientID string) (bool, error) {
+	_, err := h.db.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, database.ErrOAuthClientNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func writeInactive(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteJSONResponse(w, r, http.StatusOK, introspectionResponse{})
+}
+
+func writeUnexpectedError(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "There was an unexpected error",
+		StatusCode: http.StatusInternalServerError,
+	})
+}
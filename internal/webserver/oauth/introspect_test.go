@@ -0,0 +1,184 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func passthrough(next http.Handler) http.Handler { return next }
+
+func TestIntrospect(t *testing.T) {
+	ctx := context.Background()
+
+	const secret = "test-secret"
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: secret, AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	db := database.NewMemoryDB()
+	revocations := revocation.NewList(lockout.NewMemoryStore(), time.Hour)
+	accessTokenRevocations := revocation.NewAccessTokens(revocation.NewMemoryTokenStore())
+
+	h := NewHandler(HandlerDeps{
+		DB:                     db,
+		AuthClient:             authClient,
+		Auth:                   passthrough,
+		Revocations:            revocations,
+		AccessTokenRevocations: accessTokenRevocations,
+	})
+
+	newAccount := func(t *testing.T, email string) (*database.Account, string) {
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: email, PasswordHash: "hash"})
+		require.NoError(t, err)
+		token, _, err := authClient.NewAccessToken(auth.Claims{AccountID: account.ID})
+		require.NoError(t, err)
+		return account, token
+	}
+
+	introspect := func(t *testing.T, form url.Values) (*httptest.ResponseRecorder, introspectionResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		var resp introspectionResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		}
+		return w, resp
+	}
+
+	t.Run("active token", func(t *testing.T) {
+		account, token := newAccount(t, "active@test.com")
+		claims, err := authClient.InspectAccessToken(token)
+		require.NoError(t, err)
+
+		w, resp := introspect(t, url.Values{"token": {token}, "token_type_hint": {"access_token"}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, introspectionResponse{
+			Active:    true,
+			Subject:   account.ID,
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+			TokenID:   claims.ID,
+			TokenType: "Bearer",
+		}, resp)
+	})
+
+	t.Run("inactive tokens", func(t *testing.T) {
+		frozen, frozenToken := newAccount(t, "frozen@test.com")
+		_, err := db.FreezeAccount(ctx, frozen.ID)
+		require.NoError(t, err)
+
+		deleted, deletedToken := newAccount(t, "deleted@test.com")
+		require.NoError(t, db.DeleteAccount(ctx, deleted.ID))
+
+		expiredToken, _, err := auth.NewClient(auth.Config{JWTSecretKey: secret, AccessTokenTTLMinutes: -1}).
+			NewAccessToken(auth.Claims{AccountID: frozen.ID})
+		require.NoError(t, err)
+
+		// issued before the account logged out everywhere
+		revoked, _ := newAccount(t, "revoked@test.com")
+		revokedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"account_id": revoked.ID,
+			"iss":        "account-management",
+			"iat":        time.Now().Add(-time.Minute).Unix(),
+			"exp":        time.Now().Add(time.Minute).Unix(),
+		}).SignedString([]byte(secret))
+		require.NoError(t, err)
+		require.NoError(t, revocations.RevokeAccount(ctx, revoked.ID))
+
+		_, loggedOutToken := newAccount(t, "loggedout@test.com")
+		loggedOut, err := authClient.InspectAccessToken(loggedOutToken)
+		require.NoError(t, err)
+		require.NoError(t, accessTokenRevocations.Revoke(ctx, loggedOut.ID, loggedOut.ExpiresAt))
+
+		refreshToken, _, err := authClient.NewSignedRefreshToken(revoked.ID, nil, nil)
+		require.NoError(t, err)
+
+		tokens := map[string]string{
+			"frozen account":  frozenToken,
+			"deleted account": deletedToken,
+			"expired":         expiredToken,
+			"account revoked": revokedToken,
+			"token revoked":   loggedOutToken,
+			"refresh token":   refreshToken,
+			"garbage":         "not-a-token",
+		}
+		for name, token := range tokens {
+			t.Run(name, func(t *testing.T) {
+				w, resp := introspect(t, url.Values{"token": {token}})
+				require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+				assert.JSONEq(t, `{"active":false}`, w.Body.String())
+				assert.False(t, resp.Active)
+			})
+		}
+	})
+
+	t.Run("tokens issued after the revocation are active", func(t *testing.T) {
+		account, _ := newAccount(t, "relogin@test.com")
+		require.NoError(t, revocations.RevokeAccount(ctx, account.ID))
+		token, _, err := authClient.NewAccessToken(auth.Claims{AccountID: account.ID})
+		require.NoError(t, err)
+
+		_, resp := introspect(t, url.Values{"token": {token}})
+		assert.True(t, resp.Active)
+	})
+
+	t.Run("oauth client tokens", func(t *testing.T) {
+		client, err := db.CreateOAuthClient(ctx, database.CreateOAuthClientParams{
+			Name:       "reporting",
+			SecretHash: "secret-hash",
+			GrantTypes: []string{grantTypeClientCredentials},
+			Scopes:     []string{auth.ScopeAccountRead},
+		})
+		require.NoError(t, err)
+		clientToken, _, err := authClient.NewAccessToken(auth.Claims{ClientID: client.ID, Scope: auth.ScopeAccountRead})
+		require.NoError(t, err)
+
+		// client credentials tokens are the client's own
+		_, resp := introspect(t, url.Values{"token": {clientToken}})
+		assert.True(t, resp.Active)
+		assert.Equal(t, client.ID, resp.Subject)
+		assert.Equal(t, client.ID, resp.ClientID)
+		assert.Equal(t, auth.ScopeAccountRead, resp.Scope)
+
+		account, _ := newAccount(t, "oauthclient@test.com")
+		grantedToken, _, err := authClient.NewAccessToken(auth.Claims{
+			AccountID: account.ID,
+			ClientID:  client.ID,
+			Scope:     auth.ScopeAccountRead,
+			Actor:     &auth.Actor{Subject: client.ID},
+		})
+		require.NoError(t, err)
+		_, resp = introspect(t, url.Values{"token": {grantedToken}})
+		assert.True(t, resp.Active)
+		assert.Equal(t, account.ID, resp.Subject)
+		assert.Equal(t, client.ID, resp.ClientID)
+		assert.Equal(t, &auth.Actor{Subject: client.ID}, resp.Actor)
+
+		// deleting the client deactivates its tokens
+		require.NoError(t, db.DeleteOAuthClient(ctx, client.ID))
+		for _, token := range []string{clientToken, grantedToken} {
+			_, resp = introspect(t, url.Values{"token": {token}})
+			assert.False(t, resp.Active)
+		}
+	})
+
+	t.Run("token is required", func(t *testing.T) {
+		w, _ := introspect(t, url.Values{})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,300 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/google/uuid"
+)
+
+// The token endpoint's error codes (RFC 6749 section 5.2)
+const (
+	tokenErrInvalidRequest       = "invalid_request"
+	tokenErrInvalidClient        = "invalid_client"
+	tokenErrInvalidGrant         = "invalid_grant"
+	tokenErrUnauthorizedClient   = "unauthorized_client"
+	tokenErrUnsupportedGrantType = "unsupported_grant_type"
+	tokenErrInvalidScope         = "invalid_scope"
+	tokenErrServerError          = "server_error"
+)
+
+// tokenResponse is a successful token response (RFC 6749 section 5.1). OAuth clients don't get
+// refresh tokens, they go through the grant again.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+	// IssuedTokenType is set for token exchanges (RFC 8693 section 2.2.1)
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	// IDToken is issued when the account granted the openid scope (OpenID Connect Core section 3.1.3.3)
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// tokenErrorResponse is the RFC 6749 error response, which clients' OAuth libraries expect
+// instead of the usual error body
+type tokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// token issues an access token to an OAuth client (RFC 6749 section 3.2). Confidential clients
+// authenticate with HTTP Basic or client_id and client_secret form parameters, public clients
+// send only client_id. Supported grants are client_credentials, for a client acting on its own
+// behalf, authorization_code with PKCE (RFC 7636), for a client an account approved, and token
+// exchange (RFC 8693), for a confidential client acting on behalf of an account that sent it its
+// access token.
+func (h *handler) token(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// tokens mustn't be cached by anything in between
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidRequest, "The request body must be form encoded")
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	switch {
+	case grantType == "":
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidRequest, "grant_type is required")
+		return
+	case !slices.Contains(grantTypes, grantType):
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrUnsupportedGrantType, "grant_type must be one of "+strings.Join(grantTypes, ", "))
+		return
+	case !slices.Contains(client.GrantTypes, grantType):
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrUnauthorizedClient, "The client isn't registered for this grant type")
+		return
+	}
+
+	var claims auth.Claims
+	var redeemed *database.OAuthAuthorizationCode
+	ttl := h.authClient.AccessTokenTTL()
+	switch grantType {
+	case grantTypeClientCredentials:
+		scopes, ok := requestedScopes(r.PostForm.Get("scope"), client)
+		if !ok {
+			writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidScope, "The client isn't allowed the requested scope")
+			return
+		}
+		claims = auth.Claims{ClientID: client.ID, Scope: strings.Join(scopes, " ")}
+	case grantTypeAuthorizationCode:
+		redeemed, ok = h.redeemAuthorizationCode(w, r, client)
+		if !ok {
+			return
+		}
+		claims = auth.Claims{
+			AccountID: redeemed.AccountID,
+			ClientID:  client.ID,
+			Scope:     strings.Join(redeemed.Scopes, " "),
+		}
+	case grantTypeTokenExchange:
+		claims, ttl, ok = h.exchangeToken(w, r, client)
+		if !ok {
+			return
+		}
+	}
+
+	accessToken, expiresAt, err := h.authClient.NewAccessTokenWithTTL(claims, ttl)
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating oauth access token", "error", err)
+		writeTokenError(w, r, http.StatusInternalServerError, tokenErrServerError, "")
+		return
+	}
+
+	response := tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(expiresAt).Round(time.Second).Seconds()),
+		Scope:       claims.Scope,
+	}
+	if grantType == grantTypeTokenExchange {
+		response.IssuedTokenType = tokenTypeAccessToken
+	}
+	if redeemed != nil && h.issuer != "" && slices.Contains(redeemed.Scopes, auth.ScopeOpenID) {
+		response.IDToken, err = h.newIDToken(ctx, client, redeemed)
+		if err != nil {
+			slog.ErrorContext(ctx, "error creating oauth id token", "error", err)
+			writeTokenError(w, r, http.StatusInternalServerError, tokenErrServerError, "")
+			return
+		}
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, response)
+}
+
+// authenticateClient returns the client calling the token endpoint, writing an invalid_client
+// error if it can't be authenticated
+func (h *handler) authenticateClient(w http.ResponseWriter, r *http.Request) (*database.OAuthClient, bool) {
+	ctx := r.Context()
+
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// the credentials are form encoded before they're put in the header (RFC 6749 section 2.3.1)
+		var idErr, secretErr error
+		clientID, idErr = url.QueryUnescape(clientID)
+		secret, secretErr = url.QueryUnescape(secret)
+		if idErr != nil || secretErr != nil {
+			writeInvalidClient(w, r)
+			return nil, false
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if _, err := uuid.Parse(clientID); err != nil {
+		writeInvalidClient(w, r)
+		return nil, false
+	}
+
+	client, err := h.db.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, database.ErrOAuthClientNotFound) {
+			writeInvalidClient(w, r)
+			return nil, false
+		}
+		slog.ErrorContext(ctx, "error getting oauth client", "error", err)
+		writeTokenError(w, r, http.StatusInternalServerError, tokenErrServerError, "")
+		return nil, false
+	}
+
+	if client.SecretHash == nil {
+		// a public client sending a secret is misconfigured, better to say so than ignore it
+		if secret != "" {
+			writeInvalidClient(w, r)
+			return nil, false
+		}
+		return client, true
+	}
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(auth.HashOpaqueToken(secret)), []byte(*client.SecretHash)) != 1 {
+		writeInvalidClient(w, r)
+		return nil, false
+	}
+	return client, true
+}
+
+// redeemAuthorizationCode uses up an authorization code, writing an error if it can't be used
+func (h *handler) redeemAuthorizationCode(w http.ResponseWriter, r *http.Request, client *database.OAuthClient) (*database.OAuthAuthorizationCode, bool) {
+	ctx := r.Context()
+
+	code := r.PostForm.Get("code")
+	redirectURI := r.PostForm.Get("redirect_uri")
+	verifier := r.PostForm.Get("code_verifier")
+	if code == "" || redirectURI == "" || verifier == "" {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidRequest, "code, redirect_uri, and code_verifier are required")
+		return nil, false
+	}
+
+	// the code is used up even if the rest doesn't check out, so a stolen code can't be retried
+	stored, err := h.db.ConsumeOAuthAuthorizationCode(ctx, auth.HashOpaqueToken(code))
+	if err != nil {
+		if errors.Is(err, database.ErrOAuthAuthorizationCodeNotFound) {
+			writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidGrant, "The authorization code is invalid, used, or expired")
+			return nil, false
+		}
+		slog.ErrorContext(ctx, "error consuming oauth authorization code", "error", err)
+		writeTokenError(w, r, http.StatusInternalServerError, tokenErrServerError, "")
+		return nil, false
+	}
+
+	if stored.ClientID != client.ID || stored.RedirectURI != redirectURI || !pkceMatches(verifier, stored.CodeChallenge) {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidGrant, "The authorization code is invalid, used, or expired")
+		return nil, false
+	}
+
+	active, err := h.accountActive(ctx, stored.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting account for oauth authorization code", "error", err)
+		writeTokenError(w, r, http.StatusInternalServerError, tokenErrServerError, "")
+		return nil, false
+	}
+	if !active {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidGrant, "The account that approved the client can't sign in")
+		return nil, false
+	}
+
+	return stored, true
+}
+
+// newIDToken returns the ID token for a redeemed authorization code. The email is only in it
+// when the account granted the email scope.
+func (h *handler) newIDToken(ctx context.Context, client *database.OAuthClient, redeemed *database.OAuthAuthorizationCode) (string, error) {
+	claims := auth.IDTokenClaims{
+		Issuer:   h.issuer,
+		Subject:  redeemed.AccountID,
+		Audience: client.ID,
+		AuthTime: redeemed.AuthTime,
+		Nonce:    redeemed.Nonce,
+	}
+	if slices.Contains(redeemed.Scopes, auth.ScopeEmail) {
+		account, err := h.db.GetAccountByID(ctx, redeemed.AccountID)
+		if err != nil {
+			return "", err
+		}
+		claims.Email = account.Email
+		claims.EmailVerified = account.VerifiedAt != nil
+	}
+	return h.authClient.NewIDToken(claims)
+}
+
+// accountActive reports whether the account exists and isn't frozen
+func (h *handler) accountActive(ctx context.Context, accountID string) (bool, error) {
+	account, err := h.db.GetAccountByID(ctx, accountID)
+	if errors.Is(err, database.ErrAccountNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return account.FrozenAt == nil, nil
+}
+
+// requestedScopes parses a space separated scope parameter, defaulting to everything the client
+// is allowed. It's false if the client isn't allowed one of them.
+func requestedScopes(scope string, client *database.OAuthClient) ([]string, bool) {
+	scopes := slices.Compact(slices.Sorted(slices.Values(strings.Fields(scope))))
+	if len(scopes) == 0 {
+		return client.Scopes, true
+	}
+	for _, s := range scopes {
+		if !slices.Contains(client.Scopes, s) {
+			return nil, false
+		}
+	}
+	return scopes, true
+}
+
+// pkceMatches checks a code verifier against its S256 challenge (RFC 7636 section 4.6)
+func pkceMatches(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+func writeInvalidClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="account-management"`)
+	writeTokenError(w, r, http.StatusUnauthorized, tokenErrInvalidClient, "The client is unknown or its credentials are wrong")
+}
+
+func writeTokenError(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+	httputils.WriteJSONResponse(w, r, status, tokenErrorResponse{Error: code, ErrorDescription: description})
+}
@@ -0,0 +1,106 @@
+package oauth
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+)
+
+const (
+	// DefaultTokenExchangeTTL is how long delegation tokens last. They're kept shorter than the
+	// account's own tokens, a service only needs one for the calls it makes on the account's
+	// behalf.
+	DefaultTokenExchangeTTL = 5 * time.Minute
+
+	// tokenTypeAccessToken is the only token type that can be exchanged, and the one issued
+	// (RFC 8693 section 3)
+	tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// exchangeToken checks a token exchange request (RFC 8693 section 2.1) and returns the claims and
+// TTL of the delegation token, writing an error if the subject token can't be exchanged. The
+// subject token has to be an active access token of an account. The delegation token is issued
+// to the client for the same account, with an act claim naming the client, and gets at most the
+// scopes both the client and the subject token were granted: the scope parameter can narrow
+// them but not add any. Roles and organizations aren't carried over, and it expires with the
+// subject token if that's sooner than the exchange TTL.
+func (h *handler) exchangeToken(w http.ResponseWriter, r *http.Request, client *database.OAuthClient) (auth.Claims, time.Duration, bool) {
+	ctx := r.Context()
+
+	subjectToken := r.PostForm.Get("subject_token")
+	if subjectToken == "" || r.PostForm.Get("subject_token_type") == "" {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidRequest, "subject_token and subject_token_type are required")
+		return auth.Claims{}, 0, false
+	}
+	if r.PostForm.Get("subject_token_type") != tokenTypeAccessToken {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidRequest, "subject_token_type must be "+tokenTypeAccessToken)
+		return auth.Claims{}, 0, false
+	}
+	if requested := r.PostForm.Get("requested_token_type"); requested != "" && requested != tokenTypeAccessToken {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidRequest, "requested_token_type must be "+tokenTypeAccessToken)
+		return auth.Claims{}, 0, false
+	}
+	// the authenticated client is always the actor
+	if r.PostForm.Get("actor_token") != "" {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidRequest, "actor_token isn't supported, the client is the actor")
+		return auth.Claims{}, 0, false
+	}
+
+	subject, active, err := h.activeAccessToken(ctx, subjectToken)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking subject token for token exchange", "error", err)
+		writeTokenError(w, r, http.StatusInternalServerError, tokenErrServerError, "")
+		return auth.Claims{}, 0, false
+	}
+	if !active {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidGrant, "The subject token is invalid, expired, or revoked")
+		return auth.Claims{}, 0, false
+	}
+	if subject.AccountID == "" {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidGrant, "The subject token wasn't issued to an account")
+		return auth.Claims{}, 0, false
+	}
+
+	scopes, ok := delegatedScopes(r.PostForm.Get("scope"), client, &subject.Claims)
+	if !ok {
+		writeTokenError(w, r, http.StatusBadRequest, tokenErrInvalidScope, "The requested scope wasn't granted to both the client and the subject token")
+		return auth.Claims{}, 0, false
+	}
+
+	claims := auth.Claims{
+		AccountID: subject.AccountID,
+		ClientID:  client.ID,
+		Scope:     strings.Join(scopes, " "),
+		Actor:     &auth.Actor{Subject: client.ID, Actor: subject.Actor},
+	}
+	return claims, min(h.tokenExchangeTTL, time.Until(subject.ExpiresAt)), true
+}
+
+// delegatedScopes parses the space separated scope parameter of a token exchange, defaulting to
+// every account scope both the client and the subject token were granted. An account's token
+// without a scope isn't restricted. It's false if one of them wasn't granted or none are left.
+func delegatedScopes(scope string, client *database.OAuthClient, subject *auth.Claims) ([]string, bool) {
+	unrestricted := subject.ClientID == "" && subject.Scope == ""
+	var granted []string
+	for _, s := range auth.Scopes {
+		if slices.Contains(client.Scopes, s) && (unrestricted || subject.HasScope(s)) {
+			granted = append(granted, s)
+		}
+	}
+
+	scopes := slices.Compact(slices.Sorted(slices.Values(strings.Fields(scope))))
+	if len(scopes) == 0 {
+		return granted, len(granted) > 0
+	}
+	for _, s := range scopes {
+		if !slices.Contains(granted, s) {
+			return nil, false
+		}
+	}
+	return scopes, true
+}
@@ -0,0 +1,129 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenExchange(t *testing.T) {
+	s := newTokenTestServer(t)
+	ctx := context.Background()
+
+	account, err := s.db.CreateAccount(ctx, database.AccountCreationParams{Email: "delegate@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	client := s.newClient(t, "client-secret", grantTypeTokenExchange)
+	basic := func(r *http.Request) { r.SetBasicAuth(client.ID, "client-secret") }
+
+	accountToken := func(t *testing.T, claims auth.Claims) string {
+		token, _, err := s.authClient.NewAccessToken(claims)
+		require.NoError(t, err)
+		return token
+	}
+	exchange := func(subjectToken string, extra url.Values) url.Values {
+		form := url.Values{
+			"grant_type":         {grantTypeTokenExchange},
+			"subject_token":      {subjectToken},
+			"subject_token_type": {tokenTypeAccessToken},
+		}
+		for k, v := range extra {
+			form[k] = v
+		}
+		return form
+	}
+
+	t.Run("delegation token", func(t *testing.T) {
+		w, resp, _ := s.token(t, exchange(accountToken(t, auth.Claims{AccountID: account.ID, Roles: []string{"admin"}}), nil), basic)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, tokenTypeAccessToken, resp.IssuedTokenType)
+		assert.InDelta(t, DefaultTokenExchangeTTL.Seconds(), resp.ExpiresIn, 1)
+		assert.Equal(t, "account:read sessions:write", resp.Scope)
+
+		claims, err := s.authClient.ParseAccessToken(resp.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, claims.AccountID)
+		assert.Equal(t, client.ID, claims.ClientID)
+		assert.Equal(t, &auth.Actor{Subject: client.ID}, claims.Actor)
+		assert.Empty(t, claims.Roles)
+
+		// exchanged again, the previous actor is kept
+		other := s.newClient(t, "other-secret", grantTypeTokenExchange)
+		w, resp, _ = s.token(t, exchange(resp.AccessToken, url.Values{"scope": {auth.ScopeAccountRead}}), func(r *http.Request) { r.SetBasicAuth(other.ID, "other-secret") })
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, auth.ScopeAccountRead, resp.Scope)
+
+		claims, err = s.authClient.ParseAccessToken(resp.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, &auth.Actor{Subject: other.ID, Actor: &auth.Actor{Subject: client.ID}}, claims.Actor)
+	})
+
+	t.Run("scopes are narrowed to the subject token's", func(t *testing.T) {
+		subject := accountToken(t, auth.Claims{AccountID: account.ID, Scope: "account:read account:write"})
+		w, resp, _ := s.token(t, exchange(subject, nil), basic)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, auth.ScopeAccountRead, resp.Scope)
+
+		w, _, errResp := s.token(t, exchange(subject, url.Values{"scope": {auth.ScopeSessionsWrite}}), basic)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tokenErrInvalidScope, errResp.Error)
+
+		w, _, errResp = s.token(t, exchange(accountToken(t, auth.Claims{AccountID: account.ID, Scope: auth.ScopeAccountWrite}), nil), basic)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tokenErrInvalidScope, errResp.Error)
+	})
+
+	t.Run("doesn't outlive the subject token", func(t *testing.T) {
+		subject, _, err := s.authClient.NewAccessTokenWithTTL(auth.Claims{AccountID: account.ID}, time.Minute)
+		require.NoError(t, err)
+		w, resp, _ := s.token(t, exchange(subject, nil), basic)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.InDelta(t, 60, resp.ExpiresIn, 1)
+	})
+
+	tests := []struct {
+		name          string
+		form          url.Values
+		expectedError string
+	}{
+		{name: "no subject token", form: url.Values{"grant_type": {grantTypeTokenExchange}, "subject_token_type": {tokenTypeAccessToken}}, expectedError: tokenErrInvalidRequest},
+		{name: "unsupported subject token type", form: exchange("token", url.Values{"subject_token_type": {"urn:ietf:params:oauth:token-type:refresh_token"}}), expectedError: tokenErrInvalidRequest},
+		{name: "unsupported requested token type", form: exchange(accountToken(t, auth.Claims{AccountID: account.ID}), url.Values{"requested_token_type": {"urn:ietf:params:oauth:token-type:id_token"}}), expectedError: tokenErrInvalidRequest},
+		{name: "actor token", form: exchange(accountToken(t, auth.Claims{AccountID: account.ID}), url.Values{"actor_token": {"token"}}), expectedError: tokenErrInvalidRequest},
+		{name: "invalid subject token", form: exchange("not-a-token", nil), expectedError: tokenErrInvalidGrant},
+		{name: "client credentials subject token", form: exchange(accountToken(t, auth.Claims{ClientID: client.ID, Scope: auth.ScopeAccountRead}), nil), expectedError: tokenErrInvalidGrant},
+		{name: "scope the client isn't allowed", form: exchange(accountToken(t, auth.Claims{AccountID: account.ID}), url.Values{"scope": {auth.ScopeAccountWrite}}), expectedError: tokenErrInvalidScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _, errResp := s.token(t, tt.form, basic)
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.Equal(t, tt.expectedError, errResp.Error)
+		})
+	}
+
+	t.Run("frozen account", func(t *testing.T) {
+		frozen, err := s.db.CreateAccount(ctx, database.AccountCreationParams{Email: "frozen@test.com", PasswordHash: "hash"})
+		require.NoError(t, err)
+		subject := accountToken(t, auth.Claims{AccountID: frozen.ID})
+		_, err = s.db.FreezeAccount(ctx, frozen.ID)
+		require.NoError(t, err)
+
+		w, _, errResp := s.token(t, exchange(subject, nil), basic)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tokenErrInvalidGrant, errResp.Error)
+	})
+
+	t.Run("client not registered for the grant", func(t *testing.T) {
+		other := s.newClient(t, "other-secret", grantTypeClientCredentials)
+		w, _, errResp := s.token(t, exchange(accountToken(t, auth.Claims{AccountID: account.ID}), nil), func(r *http.Request) { r.SetBasicAuth(other.ID, "other-secret") })
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tokenErrUnauthorizedClient, errResp.Error)
+	})
+}
@@ -0,0 +1,327 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testVerifier = "dBjftJeZ4CVP-mJ0ZRVJ4AoHbXTiBuRwN0XwNwImJRHwd1Q"
+
+func testChallenge() string {
+	sum := sha256.Sum256([]byte(testVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type tokenTestServer struct {
+	h          http.Handler
+	db         *database.MemoryDB
+	authClient *auth.Client
+}
+
+func newTokenTestServer(t *testing.T) *tokenTestServer {
+	return newTokenTestServerWithIssuer(t, "")
+}
+
+func newTokenTestServerWithIssuer(t *testing.T, issuer string) *tokenTestServer {
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	db := database.NewMemoryDB()
+	return &tokenTestServer{
+		h:          NewHandler(HandlerDeps{DB: db, AuthClient: authClient, Auth: passthrough, Issuer: issuer}),
+		db:         db,
+		authClient: authClient,
+	}
+}
+
+func (s *tokenTestServer) newClient(t *testing.T, secret string, grantTypes ...string) *database.OAuthClient {
+	params := database.CreateOAuthClientParams{
+		Name:         "app",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+		GrantTypes:   grantTypes,
+		Scopes:       []string{auth.ScopeAccountRead, auth.ScopeSessionsWrite},
+	}
+	if secret != "" {
+		params.SecretHash = auth.HashOpaqueToken(secret)
+	}
+	client, err := s.db.CreateOAuthClient(context.Background(), params)
+	require.NoError(t, err)
+	return client
+}
+
+func (s *tokenTestServer) token(t *testing.T, form url.Values, setAuth func(r *http.Request)) (*httptest.ResponseRecorder, tokenResponse, tokenErrorResponse) {
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if setAuth != nil {
+		setAuth(req)
+	}
+	w := httptest.NewRecorder()
+	s.h.ServeHTTP(w, req)
+
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var resp tokenResponse
+	var errResp tokenErrorResponse
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	} else {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	}
+	return w, resp, errResp
+}
+
+func TestTokenClientCredentials(t *testing.T) {
+	s := newTokenTestServer(t)
+	client := s.newClient(t, "client-secret", grantTypeClientCredentials)
+	basic := func(id, secret string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(url.QueryEscape(id), url.QueryEscape(secret)) }
+	}
+
+	t.Run("basic auth", func(t *testing.T) {
+		w, resp, _ := s.token(t, url.Values{"grant_type": {"client_credentials"}}, basic(client.ID, "client-secret"))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "Bearer", resp.TokenType)
+		assert.InDelta(t, 15*60, resp.ExpiresIn, 1)
+		assert.Equal(t, "account:read sessions:write", resp.Scope)
+
+		claims, err := s.authClient.ParseAccessToken(resp.AccessToken)
+		require.NoError(t, err)
+		assert.Empty(t, claims.AccountID)
+		assert.Equal(t, client.ID, claims.ClientID)
+	})
+
+	t.Run("form credentials and a narrower scope", func(t *testing.T) {
+		w, resp, _ := s.token(t, url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {client.ID},
+			"client_secret": {"client-secret"},
+			"scope":         {auth.ScopeAccountRead},
+		}, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, auth.ScopeAccountRead, resp.Scope)
+	})
+
+	tests := []struct {
+		name           string
+		form           url.Values
+		setAuth        func(r *http.Request)
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "wrong secret", form: url.Values{"grant_type": {"client_credentials"}}, setAuth: basic(client.ID, "wrong"), expectedStatus: http.StatusUnauthorized, expectedError: tokenErrInvalidClient},
+		{name: "no secret", form: url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ID}}, expectedStatus: http.StatusUnauthorized, expectedError: tokenErrInvalidClient},
+		{name: "unknown client", form: url.Values{"grant_type": {"client_credentials"}}, setAuth: basic("00000000-0000-0000-0000-000000000000", "client-secret"), expectedStatus: http.StatusUnauthorized, expectedError: tokenErrInvalidClient},
+		{name: "no grant type", form: url.Values{}, setAuth: basic(client.ID, "client-secret"), expectedStatus: http.StatusBadRequest, expectedError: tokenErrInvalidRequest},
+		{name: "unsupported grant type", form: url.Values{"grant_type": {"password"}}, setAuth: basic(client.ID, "client-secret"), expectedStatus: http.StatusBadRequest, expectedError: tokenErrUnsupportedGrantType},
+		{name: "grant type the client isn't registered for", form: url.Values{"grant_type": {"authorization_code"}}, setAuth: basic(client.ID, "client-secret"), expectedStatus: http.StatusBadRequest, expectedError: tokenErrUnauthorizedClient},
+		{name: "scope the client isn't allowed", form: url.Values{"grant_type": {"client_credentials"}, "scope": {"account:read account:delete"}}, setAuth: basic(client.ID, "client-secret"), expectedStatus: http.StatusBadRequest, expectedError: tokenErrInvalidScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _, errResp := s.token(t, tt.form, tt.setAuth)
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			assert.Equal(t, tt.expectedError, errResp.Error)
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	s := newTokenTestServer(t)
+	ctx := context.Background()
+
+	account, err := s.db.CreateAccount(ctx, database.AccountCreationParams{Email: "oauth@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	accountToken, _, err := s.authClient.NewAccessToken(auth.Claims{AccountID: account.ID})
+	require.NoError(t, err)
+
+	public := s.newClient(t, "", grantTypeAuthorizationCode)
+
+	authorizationQuery := func(client *database.OAuthClient) url.Values {
+		return url.Values{
+			"response_type":         {"code"},
+			"client_id":             {client.ID},
+			"redirect_uri":          {"https://app.example.com/callback"},
+			"scope":                 {auth.ScopeAccountRead},
+			"state":                 {"xyz"},
+			"code_challenge":        {testChallenge()},
+			"code_challenge_method": {"S256"},
+		}
+	}
+
+	getAuthorization := func(t *testing.T, query url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/authorize?"+query.Encode(), nil)
+		req.Header.Set("Authorization", "Bearer "+accountToken)
+		w := httptest.NewRecorder()
+		s.h.ServeHTTP(w, req)
+		return w
+	}
+
+	authorize := func(t *testing.T, query url.Values, approved bool) *url.URL {
+		body := map[string]any{"approved": approved}
+		for key := range query {
+			body[key] = query.Get(key)
+		}
+		encoded, err := json.Marshal(body)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/authorize", bytes.NewReader(encoded))
+		req.Header.Set("Authorization", "Bearer "+accountToken)
+		w := httptest.NewRecorder()
+		s.h.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp authorizeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		redirect, err := url.Parse(resp.RedirectURI)
+		require.NoError(t, err)
+		assert.Equal(t, "app.example.com", redirect.Host)
+		assert.Equal(t, "xyz", redirect.Query().Get("state"))
+		return redirect
+	}
+
+	redeem := func(t *testing.T, code, verifier string) (*httptest.ResponseRecorder, tokenResponse, tokenErrorResponse) {
+		return s.token(t, url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {public.ID},
+			"code":          {code},
+			"redirect_uri":  {"https://app.example.com/callback"},
+			"code_verifier": {verifier},
+		}, nil)
+	}
+
+	t.Run("consent details", func(t *testing.T) {
+		w := getAuthorization(t, authorizationQuery(public))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp consentResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, public.ID, resp.Client.ClientID)
+		assert.Equal(t, "app", resp.Client.Name)
+		assert.Equal(t, []string{auth.ScopeAccountRead}, resp.Scopes)
+		assert.Equal(t, "xyz", resp.State)
+	})
+
+	t.Run("consent requires the account", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/authorize?"+authorizationQuery(public).Encode(), nil)
+		w := httptest.NewRecorder()
+		s.h.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("invalid authorization requests", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			modify        func(query url.Values)
+			expectedCode  int
+			expectedError string
+		}{
+			{name: "unknown client", modify: func(q url.Values) { q.Set("client_id", "00000000-0000-0000-0000-000000000000") }, expectedCode: http.StatusNotFound, expectedError: errTypeOAuthClientNotFound},
+			{name: "unregistered redirect uri", modify: func(q url.Values) { q.Set("redirect_uri", "https://evil.example.com/callback") }, expectedCode: http.StatusBadRequest, expectedError: errTypeInvalidRequest},
+			{name: "token response type", modify: func(q url.Values) { q.Set("response_type", "token") }, expectedCode: http.StatusBadRequest, expectedError: errTypeUnsupportedResponseType},
+			{name: "no pkce", modify: func(q url.Values) { q.Del("code_challenge") }, expectedCode: http.StatusBadRequest, expectedError: errTypeInvalidRequest},
+			{name: "plain pkce", modify: func(q url.Values) { q.Set("code_challenge_method", "plain") }, expectedCode: http.StatusBadRequest, expectedError: errTypeInvalidRequest},
+			{name: "scope the client isn't allowed", modify: func(q url.Values) { q.Set("scope", "account:delete") }, expectedCode: http.StatusBadRequest, expectedError: errTypeInvalidScope},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				query := authorizationQuery(public)
+				tt.modify(query)
+				w := getAuthorization(t, query)
+				require.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+				var resp httputils.ErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedError, resp.Type)
+			})
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		redirect := authorize(t, authorizationQuery(public), false)
+		assert.Equal(t, errTypeAccessDenied, redirect.Query().Get("error"))
+		assert.Empty(t, redirect.Query().Get("code"))
+	})
+
+	t.Run("approved", func(t *testing.T) {
+		redirect := authorize(t, authorizationQuery(public), true)
+		code := redirect.Query().Get("code")
+		require.NotEmpty(t, code)
+
+		w, resp, _ := redeem(t, code, testVerifier)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, auth.ScopeAccountRead, resp.Scope)
+
+		claims, err := s.authClient.ParseAccessToken(resp.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, claims.AccountID)
+		assert.Equal(t, public.ID, claims.ClientID)
+		assert.True(t, claims.HasScope(auth.ScopeAccountRead))
+		assert.False(t, claims.HasScope(auth.ScopeSessionsWrite))
+
+		// codes are single use
+		w, _, errResp := redeem(t, code, testVerifier)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tokenErrInvalidGrant, errResp.Error)
+	})
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		code := authorize(t, authorizationQuery(public), true).Query().Get("code")
+		w, _, errResp := redeem(t, code, strings.Repeat("a", 43))
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tokenErrInvalidGrant, errResp.Error)
+
+		// and the code is used up
+		w, _, errResp = redeem(t, code, testVerifier)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tokenErrInvalidGrant, errResp.Error)
+	})
+
+	t.Run("code of another client", func(t *testing.T) {
+		other := s.newClient(t, "", grantTypeAuthorizationCode)
+		code := authorize(t, authorizationQuery(other), true).Query().Get("code")
+		w, _, errResp := redeem(t, code, testVerifier)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tokenErrInvalidGrant, errResp.Error)
+	})
+
+	t.Run("frozen account", func(t *testing.T) {
+		code := authorize(t, authorizationQuery(public), true).Query().Get("code")
+		_, err := s.db.FreezeAccount(ctx, account.ID)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := s.db.UnfreezeAccount(ctx, account.ID, "hash")
+			require.NoError(t, err)
+		})
+
+		w, _, errResp := redeem(t, code, testVerifier)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tokenErrInvalidGrant, errResp.Error)
+	})
+
+	t.Run("public client sending a secret", func(t *testing.T) {
+		w, _, errResp := s.token(t, url.Values{"grant_type": {"authorization_code"}, "client_id": {public.ID}, "client_secret": {"guess"}}, nil)
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, tokenErrInvalidClient, errResp.Error)
+	})
+
+	t.Run("account tokens can't approve for an oauth client", func(t *testing.T) {
+		oauthToken, _, err := s.authClient.NewAccessToken(auth.Claims{AccountID: account.ID, ClientID: public.ID, Scope: auth.ScopeAccountRead})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/authorize?"+authorizationQuery(public).Encode(), nil)
+		req.Header.Set("Authorization", "Bearer "+oauthToken)
+		w := httptest.NewRecorder()
+		s.h.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
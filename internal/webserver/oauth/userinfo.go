@@ -0,0 +1,79 @@
+package oauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+const errTypeInvalidToken = "invalid_token"
+
+// userinfoResponse is the OpenID Connect UserInfo response (OpenID Connect Core section 5.3.2).
+// The email claims are only in it when the account granted the email scope.
+type userinfoResponse struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// userinfo tells an OpenID Connect client about the account that granted its access token. Like
+// introspection, the token stops working when the client is deleted, or the account is frozen,
+// deleted, or had its tokens revoked.
+func (h *handler) userinfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	token, _ := middleware.AccessTokenFromContext(ctx)
+
+	registered, err := h.clientRegistered(ctx, token.ClientID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting oauth client for userinfo", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+	active, err := h.accountTokenActive(ctx, token)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking account for userinfo", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+	if !registered || !active {
+		writeInvalidToken(w, r)
+		return
+	}
+
+	response := userinfoResponse{Subject: token.AccountID}
+	if token.HasScope(auth.ScopeEmail) {
+		account, err := h.db.GetAccountByID(ctx, token.AccountID)
+		if err != nil {
+			if errors.Is(err, database.ErrAccountNotFound) {
+				writeInvalidToken(w, r)
+				return
+			}
+			slog.ErrorContext(ctx, "error getting account for userinfo", "error", err)
+			writeUnexpectedError(w, r)
+			return
+		}
+		verified := account.VerifiedAt != nil
+		response.Email = account.Email
+		response.EmailVerified = &verified
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, response)
+}
+
+// writeInvalidToken is the bearer token error OpenID Connect clients expect (RFC 6750 section 3.1)
+func writeInvalidToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="account-management", error="invalid_token"`)
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "The access token is invalid or expired",
+		Type:       errTypeInvalidToken,
+		StatusCode: http.StatusUnauthorized,
+	})
+}
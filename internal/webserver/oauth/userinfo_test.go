@@ -0,0 +1,138 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenIDConnect(t *testing.T) {
+	s := newTokenTestServerWithIssuer(t, "https://accounts.example.com")
+	ctx := context.Background()
+
+	account, err := s.db.CreateAccount(ctx, database.AccountCreationParams{Email: "oidc@test.com", PasswordHash: "hash", Verified: true})
+	require.NoError(t, err)
+	signedInAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	accountToken, _, err := s.authClient.NewAccessToken(auth.Claims{AccountID: account.ID})
+	require.NoError(t, err)
+
+	client, err := s.db.CreateOAuthClient(ctx, database.CreateOAuthClientParams{
+		Name:         "app",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+		GrantTypes:   []string{grantTypeAuthorizationCode},
+		Scopes:       []string{auth.ScopeAccountRead, auth.ScopeEmail, auth.ScopeOpenID},
+	})
+	require.NoError(t, err)
+
+	// signIn runs the authorization code flow and returns the token response
+	signIn := func(t *testing.T, scope string) tokenResponse {
+		body, err := json.Marshal(map[string]any{
+			"approved":              true,
+			"response_type":         "code",
+			"client_id":             client.ID,
+			"redirect_uri":          "https://app.example.com/callback",
+			"scope":                 scope,
+			"nonce":                 "n-0S6_WzA2Mj",
+			"code_challenge":        testChallenge(),
+			"code_challenge_method": "S256",
+		})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/authorize", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+accountToken)
+		w := httptest.NewRecorder()
+		s.h.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var authorized authorizeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &authorized))
+		redirect, err := url.Parse(authorized.RedirectURI)
+		require.NoError(t, err)
+
+		w, resp, _ := s.token(t, url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {client.ID},
+			"code":          {redirect.Query().Get("code")},
+			"redirect_uri":  {"https://app.example.com/callback"},
+			"code_verifier": {testVerifier},
+		}, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return resp
+	}
+
+	parseIDToken := func(t *testing.T, idToken string) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (any, error) {
+			return []byte("test-secret"), nil
+		})
+		require.NoError(t, err)
+		return claims
+	}
+
+	userinfo := func(t *testing.T, accessToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		s.h.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("id token and userinfo with the email scope", func(t *testing.T) {
+		resp := signIn(t, "openid email")
+		require.NotEmpty(t, resp.IDToken)
+
+		claims := parseIDToken(t, resp.IDToken)
+		assert.Equal(t, "https://accounts.example.com", claims["iss"])
+		assert.Equal(t, account.ID, claims["sub"])
+		assert.Equal(t, []any{client.ID}, claims["aud"])
+		assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+		assert.Equal(t, "oidc@test.com", claims["email"])
+		assert.Equal(t, true, claims["email_verified"])
+		assert.GreaterOrEqual(t, claims["auth_time"], float64(signedInAt.Unix()))
+
+		w := userinfo(t, resp.AccessToken)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.JSONEq(t, `{"sub":"`+account.ID+`","email":"oidc@test.com","email_verified":true}`, w.Body.String())
+	})
+
+	t.Run("only the subject without the email scope", func(t *testing.T) {
+		resp := signIn(t, "openid")
+		claims := parseIDToken(t, resp.IDToken)
+		assert.NotContains(t, claims, "email")
+
+		w := userinfo(t, resp.AccessToken)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.JSONEq(t, `{"sub":"`+account.ID+`"}`, w.Body.String())
+	})
+
+	t.Run("no id token or userinfo without the openid scope", func(t *testing.T) {
+		resp := signIn(t, auth.ScopeAccountRead)
+		assert.Empty(t, resp.IDToken)
+
+		w := userinfo(t, resp.AccessToken)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("userinfo rejects the account's own tokens", func(t *testing.T) {
+		w := userinfo(t, accountToken)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("userinfo stops working when the client is deleted", func(t *testing.T) {
+		resp := signIn(t, "openid")
+		require.NoError(t, s.db.DeleteOAuthClient(ctx, client.ID))
+
+		w := userinfo(t, resp.AccessToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+	})
+}
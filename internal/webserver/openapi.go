@@ -0,0 +1,24 @@
+package webserver
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/austinwofford/account-management/docs"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+// openAPIJSON serves the OpenAPI document as JSON
+func openAPIJSON(w http.ResponseWriter, r *http.Request) {
+	spec, err := docs.OpenAPIJSON()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error serving OpenAPI spec", "error", err)
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There was an unexpected error serving the API spec",
+			StatusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(spec)
+}
@@ -0,0 +1,137 @@
+package webserver
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/docs"
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// documentedPrefixes are the routes the OpenAPI spec covers, the rest (docs, metrics, health)
+// aren't part of the API
+var documentedPrefixes = []string{"/v1/", "/internal/", "/.well-known/", "/debug/"}
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	router, err := NewRouter(config.Config{
+		DevMode:          true,
+		DebugEnabled:     true,
+		SessionCookies:   true,
+		JWTSecretKey:     "openapi-test-secret",
+		InternalHMACKeys: map[string]string{"ops": "ops-secret"},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+	require.NoError(t, err)
+
+	routes, err := Routes(router)
+	require.NoError(t, err)
+
+	served := map[string]bool{}
+	servedPaths := map[string]bool{}
+	for _, route := range routes {
+		path := strings.TrimSuffix(route.Pattern, "/")
+		if !documented(path) {
+			continue
+		}
+		served[route.Method+" "+path] = true
+		servedPaths[path] = true
+	}
+
+	doc := loadSpec(t)
+
+	specified := map[string]bool{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			specified[method+" "+path] = true
+		}
+	}
+
+	var undocumented []string
+	for route := range served {
+		if !specified[route] {
+			undocumented = append(undocumented, route)
+		}
+	}
+	sort.Strings(undocumented)
+	assert.Empty(t, undocumented, "routes missing from docs/api/api.yml")
+
+	// optional features (Apple, OIDC, SAML, ...) are off here, so only paths the router serves
+	// are checked for documented methods it doesn't
+	var unserved []string
+	for route := range specified {
+		_, path, _ := strings.Cut(route, " ")
+		if servedPaths[path] && !served[route] {
+			unserved = append(unserved, route)
+		}
+	}
+	sort.Strings(unserved)
+	assert.Empty(t, unserved, "operations in docs/api/api.yml the router doesn't serve")
+}
+
+func TestDocs(t *testing.T) {
+	router, err := NewRouter(config.Config{
+		DevMode:      true,
+		JWTSecretKey: "openapi-test-secret",
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+	require.NoError(t, err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	t.Run("openapi json", func(t *testing.T) {
+		w := get("/docs/openapi.json")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		loader := openapi3.NewLoader()
+		fromJSON, err := loader.LoadFromData(w.Body.Bytes())
+		require.NoError(t, err)
+		require.NoError(t, fromJSON.Validate(loader.Context))
+		assert.Equal(t, loadSpec(t).Paths.Len(), fromJSON.Paths.Len())
+	})
+
+	t.Run("swagger ui", func(t *testing.T) {
+		w := get("/docs")
+		require.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/docs/", w.Header().Get("Location"))
+
+		w = get("/docs/")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "swagger-ui")
+		assert.Contains(t, w.Body.String(), "openapi.json")
+	})
+
+	t.Run("redoc", func(t *testing.T) {
+		w := get("/docs/api/")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "redoc")
+	})
+}
+
+func documented(path string) bool {
+	for _, prefix := range documentedPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(docs.OpenAPISpec)
+	require.NoError(t, err)
+	return doc
+}
@@ -0,0 +1,124 @@
+// Package orgs serves the /v1/orgs routes: organizations that accounts belong to as members,
+// invitations to join them, and access tokens scoped to one of them. It also serves the
+// /v1/invitations routes for accepting an invitation.
+package orgs
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// Repository defines the DB methods needed by organization handlers
+type Repository interface {
+	CreateOrganization(ctx context.Context, name, ownerID string) (*database.Organization, error)
+	GetOrganization(ctx context.Context, id string) (*database.Organization, error)
+	GetOrganizationMember(ctx context.Context, organizationID, accountID string) (*database.OrganizationMember, error)
+	CreateOrganizationInvitation(ctx context.Context, params database.CreateOrganizationInvitationParams) error
+	GetOrganizationInvitation(ctx context.Context, tokenHash string) (*database.OrganizationInvitation, error)
+	AcceptOrganizationInvitation(ctx context.Context, tokenHash, accountID string) (*database.OrganizationMember, error)
+	SetOrganizationSAMLConfig(ctx context.Context, params database.SetOrganizationSAMLConfigParams) (*database.OrganizationSAMLConfig, error)
+	GetOrganizationSAMLConfig(ctx context.Context, organizationID string) (*database.OrganizationSAMLConfig, error)
+	DeleteOrganizationSAMLConfig(ctx context.Context, organizationID string) error
+	GetAccount(ctx context.Context, email string) (*database.Account, error)
+	CreateAccount(ctx context.Context, params database.AccountCreationParams) (*database.Account, error)
+	CreateAuditEvent(ctx context.Context, params database.CreateAuditEventParams) error
+}
+
+type handler struct {
+	db         Repository
+	authClient *auth.Client
+	mailer     mailer.Sender
+	appURL     string
+	auditLog   audit.Recorder
+	// passwords hashes invited accounts' passwords, nil uses auth.DefaultHasherConfig
+	passwords *auth.PasswordHasher
+	// passwordPolicy checks them, nil uses auth.DefaultPasswordPolicyConfig
+	passwordPolicy *auth.PasswordPolicy
+	// saml is nil when SAML SSO is off
+	saml SAMLServiceProvider
+
+	chi.Router
+}
+
+type HandlerDeps struct {
+	DB         Repository
+	AuthClient *auth.Client
+	// Mailer sends invitations
+	Mailer mailer.Sender
+	// AppURL is the base URL of the web app that links in emails point to
+	AppURL string
+	// AccessTokenRevocations are the access tokens that are rejected before they expire.
+	// Optional.
+	AccessTokenRevocations *revocation.AccessTokens
+	// AuditLog records security events. Defaults to writing them to DB before responding.
+	AuditLog audit.Recorder
+	// Passwords hashes the passwords of accounts created by accepting an invitation. Defaults
+	// to auth.DefaultHasherConfig.
+	Passwords *auth.PasswordHasher
+	// PasswordPolicy is the rules those passwords have to follow. Defaults to
+	// auth.DefaultPasswordPolicyConfig.
+	PasswordPolicy *auth.PasswordPolicy
+	// SAML turns on the /{id}/saml routes that configure the organization's IdP. Optional.
+	SAML SAMLServiceProvider
+}
+
+func NewHandler(deps HandlerDeps) http.Handler {
+	mux := chi.NewMux()
+
+	h := newHandler(deps)
+
+	mux.Use(middleware.RequireAuth(deps.AuthClient, deps.AccessTokenRevocations))
+
+	mux.Post("/", h.createOrganization)
+	mux.Get("/{id}", h.getOrganization)
+	mux.Post("/{id}/token", h.organizationToken)
+	mux.Post("/{id}/invitations", h.createInvitation)
+	if h.saml != nil {
+		mux.Put("/{id}/saml", h.setSAMLConfig)
+		mux.Get("/{id}/saml", h.getSAMLConfig)
+		mux.Delete("/{id}/saml", h.deleteSAMLConfig)
+	}
+
+	h.Router = mux
+
+	return h
+}
+
+// NewInvitationHandler serves the /v1/invitations routes. They're for people who got an
+// invitation email, who might not have an account yet, so they don't require authentication.
+func NewInvitationHandler(deps HandlerDeps) http.Handler {
+	mux := chi.NewMux()
+
+	h := newHandler(deps)
+
+	mux.Post("/accept", h.acceptInvitation)
+
+	h.Router = mux
+
+	return h
+}
+
+func newHandler(deps HandlerDeps) handler {
+	h := handler{
+		db:             deps.DB,
+		authClient:     deps.AuthClient,
+		mailer:         deps.Mailer,
+		appURL:         deps.AppURL,
+		auditLog:       deps.AuditLog,
+		passwords:      deps.Passwords,
+		passwordPolicy: deps.PasswordPolicy,
+		saml:           deps.SAML,
+	}
+	if h.auditLog == nil {
+		h.auditLog = audit.Sync(deps.DB.CreateAuditEvent)
+	}
+	return h
+}
@@ -0,0 +1,307 @@
+package orgs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/i18n"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	chimiddleware "github.com/go-chi/chi/middleware"
+)
+
+const (
+	invitationTTL = 7 * 24 * time.Hour
+
+	errTypeForbidden              = "forbidden"
+	errTypeInvalidInvitationToken = "invalid_invitation_token"
+	errTypePasswordRequired       = "password_required"
+	errTypeAccountAlreadyExists   = "account_already_exists"
+)
+
+type createInvitationRequest struct {
+	Email string `json:"email"`
+	// Role defaults to member
+	Role string `json:"role"`
+}
+
+type invitationResponse struct {
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// createInvitation emails an invitation to join the organization. Only its owners and admins
+// can invite, and they can't invite owners.
+func (h *handler) createInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, member, ok := h.memberOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	if member.Role != database.OrganizationRoleOwner && member.Role != database.OrganizationRoleAdmin {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "Only owners and admins can invite people to the organization",
+			Type:       errTypeForbidden,
+			StatusCode: http.StatusForbidden,
+		})
+		return
+	}
+
+	var reqBody createInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	email := strings.TrimSpace(reqBody.Email)
+	if !auth.IsValidEmail(email) {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The provided email address is invalid",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	role := reqBody.Role
+	if role == "" {
+		role = database.OrganizationRoleMember
+	}
+	if role != database.OrganizationRoleMember && role != database.OrganizationRoleAdmin {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    fmt.Sprintf("Invitations are for the %q or %q role", database.OrganizationRoleMember, database.OrganizationRoleAdmin),
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating invitation token", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	expiresAt := time.Now().Add(invitationTTL)
+	err = h.db.CreateOrganizationInvitation(ctx, database.CreateOrganizationInvitationParams{
+		TokenHash:      auth.HashOpaqueToken(token),
+		OrganizationID: org.ID,
+		Email:          email,
+		Role:           role,
+		ExpiresAt:      expiresAt,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating organization invitation", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	err = mailer.SendTemplate(ctx, h.mailer, mailer.TemplateOrganizationInvitation, email, mailer.Data{
+		"OrganizationName": org.Name,
+		"Link":             h.invitationLink(token),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error sending organization invitation", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusCreated, invitationResponse{
+		Email:     email,
+		Role:      role,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (h *handler) invitationLink(token string) string {
+	return strings.TrimRight(h.appURL, "/") + "/invitations/accept?token=" + url.QueryEscape(token)
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token"`
+	// Password creates the account when there's none for the invited email yet
+	Password string `json:"password"`
+}
+
+type acceptInvitationResponse struct {
+	AccountID string `json:"account_id"`
+	// AccountCreated is whether accepting created the account
+	AccountCreated bool                 `json:"account_created"`
+	Organization   organizationResponse `json:"organization"`
+}
+
+// acceptInvitation makes the invited account a member of the organization. The invitation was
+// emailed, so whoever has its token controls the address: an existing account for it joins
+// straight away, and otherwise one is created with the password, its email already verified.
+// Without a password it answers password_required so the client can ask for one.
+func (h *handler) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var reqBody acceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Token == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	tokenHash := auth.HashOpaqueToken(reqBody.Token)
+	invitation, err := h.db.GetOrganizationInvitation(ctx, tokenHash)
+	if errors.Is(err, database.ErrOrganizationInvitationNotFound) {
+		writeInvalidInvitationToken(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting organization invitation", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		writeInvalidInvitationToken(w, r)
+		return
+	}
+
+	account, err := h.db.GetAccount(ctx, invitation.Email)
+	created := false
+	if errors.Is(err, database.ErrAccountNotFound) {
+		var ok bool
+		account, ok = h.createInvitedAccount(w, r, invitation.Email, reqBody.Password)
+		if !ok {
+			return
+		}
+		created = true
+	} else if err != nil {
+		slog.ErrorContext(ctx, "error getting invited account", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	h.accept(w, r, tokenHash, account, created)
+}
+
+// createInvitedAccount registers the invited email. It writes the error response when ok is false.
+func (h *handler) createInvitedAccount(w http.ResponseWriter, r *http.Request, email, password string) (*database.Account, bool) {
+	ctx := r.Context()
+
+	if password == "" {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "There's no account for this email yet, choose a password to create one",
+			Type:       errTypePasswordRequired,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return nil, false
+	}
+
+	err := h.passwordPolicy.Validate(password, email)
+	var passwordHash string
+	if err == nil {
+		passwordHash, err = h.passwords.Hash(password)
+	}
+	if err != nil {
+		var validationErr auth.ValidationError
+		if errors.As(err, &validationErr) {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    validationErr.Error(),
+				Type:       errTypeValidationError,
+				StatusCode: http.StatusUnprocessableEntity,
+			})
+			return nil, false
+		}
+		slog.ErrorContext(ctx, "error hashing password", "error", err)
+		writeUnexpectedError(w, r)
+		return nil, false
+	}
+
+	account, err := h.db.CreateAccount(ctx, database.AccountCreationParams{
+		Email:           email,
+		PasswordHash:    passwordHash,
+		PreferredLocale: i18n.LocaleFromContext(ctx),
+		Verified:        true,
+	})
+	if errors.Is(err, database.ErrAccountAlreadyExists) {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "An account with this email already exists",
+			Type:       errTypeAccountAlreadyExists,
+			StatusCode: http.StatusConflict,
+		})
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating invited account", "error", err)
+		writeUnexpectedError(w, r)
+		return nil, false
+	}
+	h.recordAccountCreated(ctx, r, account.ID)
+
+	return account, true
+}
+
+// accept uses up the invitation for the account and writes the response. created is whether
+// the account was just created for it.
+func (h *handler) accept(w http.ResponseWriter, r *http.Request, tokenHash string, account *database.Account, created bool) {
+	ctx := r.Context()
+
+	member, err := h.db.AcceptOrganizationInvitation(ctx, tokenHash, account.ID)
+	if errors.Is(err, database.ErrOrganizationInvitationNotFound) {
+		// accepted by a concurrent request
+		writeInvalidInvitationToken(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error accepting organization invitation", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	org, err := h.db.GetOrganization(ctx, member.OrganizationID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting organization", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	httputils.WriteJSONResponse(w, r, status, acceptInvitationResponse{
+		AccountID:      account.ID,
+		AccountCreated: created,
+		Organization:   newOrganizationResponse(org, member),
+	})
+}
+
+func (h *handler) recordAccountCreated(ctx context.Context, r *http.Request, accountID string) {
+	h.auditLog.Record(ctx, database.CreateAuditEventParams{
+		AccountID: accountID,
+		EventType: database.AuditEventAccountCreated,
+		IPAddress: httputils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: chimiddleware.GetReqID(ctx),
+	})
+}
+
+func writeInvalidInvitationToken(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "This invitation is invalid or has expired",
+		Type:       errTypeInvalidInvitationToken,
+		StatusCode: http.StatusBadRequest,
+	})
+}
@@ -0,0 +1,177 @@
+package orgs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMailer keeps sent messages so tests can follow the links in them
+type recordingMailer struct {
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var invitationLinkPattern = regexp.MustCompile(`https://app\.example\.com/invitations/accept\?token=(\S+)`)
+
+// invitationToken returns the token of the last invitation sent to the address
+func (m *recordingMailer) invitationToken(t *testing.T, to string) string {
+	t.Helper()
+
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To != to {
+			continue
+		}
+		match := invitationLinkPattern.FindStringSubmatch(m.sent[i].Body)
+		require.NotNil(t, match, "no invitation link in %q", m.sent[i].Body)
+		token, err := url.QueryUnescape(match[1])
+		require.NoError(t, err)
+		return token
+	}
+	t.Fatalf("no email sent to %s", to)
+	return ""
+}
+
+func TestInvitations(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	db := database.NewMemoryDB()
+	mail := &recordingMailer{}
+	deps := HandlerDeps{DB: db, AuthClient: authClient, Mailer: mail, AppURL: "https://app.example.com"}
+	orgsHandler := NewHandler(deps)
+	invitationHandler := NewInvitationHandler(deps)
+
+	newAccount := func(t *testing.T, email string) (*database.Account, string) {
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: email, PasswordHash: "hash"})
+		require.NoError(t, err)
+		token, _, err := authClient.NewAccessToken(auth.Claims{AccountID: account.ID})
+		require.NoError(t, err)
+		return account, token
+	}
+	owner, ownerToken := newAccount(t, "owner@test.com")
+	org, err := db.CreateOrganization(ctx, "Acme", owner.ID)
+	require.NoError(t, err)
+
+	invite := func(accessToken, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/"+org.ID+"/invitations", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		orgsHandler.ServeHTTP(w, req)
+		return w
+	}
+	accept := func(body string) (*httptest.ResponseRecorder, acceptInvitationResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/accept", bytes.NewReader([]byte(body)))
+		w := httptest.NewRecorder()
+		invitationHandler.ServeHTTP(w, req)
+
+		var resp acceptInvitationResponse
+		if w.Code < 300 {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	t.Run("existing accounts join", func(t *testing.T) {
+		invited, _ := newAccount(t, "existing@test.com")
+
+		w := invite(ownerToken, `{"email":"existing@test.com","role":"admin"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created invitationResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, database.OrganizationRoleAdmin, created.Role)
+
+		token := mail.invitationToken(t, "existing@test.com")
+		w, resp := accept(`{"token":"` + token + `"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, invited.ID, resp.AccountID)
+		assert.False(t, resp.AccountCreated)
+		assert.Equal(t, org.ID, resp.Organization.ID)
+		assert.Equal(t, database.OrganizationRoleAdmin, resp.Organization.Role)
+
+		// invitations are used up
+		w, _ = accept(`{"token":"` + token + `"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidInvitationToken)
+	})
+
+	t.Run("new accounts register and join", func(t *testing.T) {
+		w := invite(ownerToken, `{"email":"new@test.com"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		token := mail.invitationToken(t, "new@test.com")
+
+		w, _ = accept(`{"token":"` + token + `"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), errTypePasswordRequired)
+
+		w, resp := accept(`{"token":"` + token + `","password":"Password1234!"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.True(t, resp.AccountCreated)
+		assert.Equal(t, database.OrganizationRoleMember, resp.Organization.Role)
+
+		account, err := db.GetAccount(ctx, "new@test.com")
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, resp.AccountID)
+		assert.NotNil(t, account.VerifiedAt, "the invitation link verifies the email")
+		assert.True(t, auth.PasswordIsCorrect("Password1234!", account.PasswordHash))
+	})
+
+	t.Run("expired invitations", func(t *testing.T) {
+		require.NoError(t, db.CreateOrganizationInvitation(ctx, database.CreateOrganizationInvitationParams{
+			TokenHash:      auth.HashOpaqueToken("expired-token"),
+			OrganizationID: org.ID,
+			Email:          "late@test.com",
+			Role:           database.OrganizationRoleMember,
+			ExpiresAt:      time.Now().Add(-time.Minute),
+		}))
+
+		w, _ := accept(`{"token":"expired-token","password":"Password1234!"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeInvalidInvitationToken)
+	})
+
+	t.Run("only owners and admins invite", func(t *testing.T) {
+		member, memberToken := newAccount(t, "member@test.com")
+		require.NoError(t, db.CreateOrganizationInvitation(ctx, database.CreateOrganizationInvitationParams{
+			TokenHash:      auth.HashOpaqueToken("member-token"),
+			OrganizationID: org.ID,
+			Email:          member.Email,
+			Role:           database.OrganizationRoleMember,
+			ExpiresAt:      time.Now().Add(time.Hour),
+		}))
+		_, err := db.AcceptOrganizationInvitation(ctx, auth.HashOpaqueToken("member-token"), member.ID)
+		require.NoError(t, err)
+
+		w := invite(memberToken, `{"email":"friend@test.com"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		_, outsiderToken := newAccount(t, "outsider@test.com")
+		w = invite(outsiderToken, `{"email":"friend@test.com"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("invitations are validated", func(t *testing.T) {
+		for _, body := range []string{`{"email":"not-an-email"}`, `{"email":"friend@test.com","role":"owner"}`} {
+			w := invite(ownerToken, body)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+		}
+		w, _ := accept(`{}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,149 @@
+package orgs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// MaxNameLength is the longest organization name, in characters
+const MaxNameLength = 255
+
+const (
+	errTypeValidationError      = "validation_error"
+	errTypeOrganizationNotFound = "organization_not_found"
+)
+
+type createOrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+// organizationResponse is an organization as seen by one of its members
+type organizationResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Role is the caller's role in the organization
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newOrganizationResponse(org *database.Organization, member *database.OrganizationMember) organizationResponse {
+	return organizationResponse{
+		ID:        org.ID,
+		Name:      org.Name,
+		Role:      member.Role,
+		CreatedAt: org.CreatedAt,
+	}
+}
+
+// createOrganization creates an organization with the caller as its owner
+func (h *handler) createOrganization(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	var reqBody createOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	name := strings.TrimSpace(reqBody.Name)
+	if name == "" || utf8.RuneCountInString(name) > MaxNameLength {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    fmt.Sprintf("Organization names are between 1 and %d characters", MaxNameLength),
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	org, err := h.db.CreateOrganization(ctx, name, claims.AccountID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating organization", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusCreated, newOrganizationResponse(org, &database.OrganizationMember{
+		Role: database.OrganizationRoleOwner,
+	}))
+}
+
+// getOrganization returns an organization the caller is a member of
+func (h *handler) getOrganization(w http.ResponseWriter, r *http.Request) {
+	org, member, ok := h.memberOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, newOrganizationResponse(org, member))
+}
+
+// memberOrganization looks up the organization in the URL and the caller's membership of it.
+// Organizations the caller isn't a member of are reported as not found, so their IDs can't be
+// probed. It writes the error response when ok is false.
+func (h *handler) memberOrganization(w http.ResponseWriter, r *http.Request) (*database.Organization, *database.OrganizationMember, bool) {
+	ctx := r.Context()
+
+	claims, _ := middleware.ClaimsFromContext(ctx)
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeOrganizationNotFound(w, r)
+		return nil, nil, false
+	}
+
+	member, err := h.db.GetOrganizationMember(ctx, id, claims.AccountID)
+	if errors.Is(err, database.ErrNotOrganizationMember) {
+		writeOrganizationNotFound(w, r)
+		return nil, nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting organization member", "error", err)
+		writeUnexpectedError(w, r)
+		return nil, nil, false
+	}
+
+	org, err := h.db.GetOrganization(ctx, id)
+	if errors.Is(err, database.ErrOrganizationNotFound) {
+		writeOrganizationNotFound(w, r)
+		return nil, nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting organization", "error", err)
+		writeUnexpectedError(w, r)
+		return nil, nil, false
+	}
+
+	return org, member, true
+}
+
+func writeOrganizationNotFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Organization not found",
+		Type:       errTypeOrganizationNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
+
+func writeUnexpectedError(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "There was an unexpected error",
+		StatusCode: http.StatusInternalServerError,
+	})
+}
@@ -0,0 +1,93 @@
+package orgs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizations(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	db := database.NewMemoryDB()
+	h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient})
+
+	newAccount := func(t *testing.T, email string) string {
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: email, PasswordHash: "hash"})
+		require.NoError(t, err)
+		token, _, err := authClient.NewAccessToken(auth.Claims{AccountID: account.ID, FeatureFlags: map[string]bool{"beta": true}})
+		require.NoError(t, err)
+		return token
+	}
+	owner := newAccount(t, "owner@test.com")
+	outsider := newAccount(t, "outsider@test.com")
+
+	do := func(method, path, accessToken, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/", owner, `{"name":"  Acme  "}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created organizationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "Acme", created.Name)
+	assert.Equal(t, database.OrganizationRoleOwner, created.Role)
+
+	t.Run("members can get the organization", func(t *testing.T) {
+		w := do(http.MethodGet, "/"+created.ID, owner, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp organizationResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, created, resp)
+	})
+
+	t.Run("other accounts can't tell it exists", func(t *testing.T) {
+		for _, path := range []string{"/" + created.ID, "/" + uuid.NewString(), "/not-a-uuid"} {
+			w := do(http.MethodGet, path, outsider, "")
+			assert.Equal(t, http.StatusNotFound, w.Code, path)
+			assert.Contains(t, w.Body.String(), errTypeOrganizationNotFound)
+		}
+		w := do(http.MethodPost, "/"+created.ID+"/token", outsider, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("members get organization-scoped tokens", func(t *testing.T) {
+		w := do(http.MethodPost, "/"+created.ID+"/token", owner, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp organizationTokenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, created.ID, resp.OrgID)
+		assert.Positive(t, resp.ExpiresIn)
+
+		claims, err := authClient.ParseAccessToken(resp.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, claims.OrgID)
+		assert.True(t, claims.FeatureFlags["beta"], "the caller's claims are kept")
+	})
+
+	t.Run("names are validated", func(t *testing.T) {
+		for _, body := range []string{`{"name":"   "}`, `{}`, `{"name":"` + string(bytes.Repeat([]byte("a"), MaxNameLength+1)) + `"}`} {
+			w := do(http.MethodPost, "/", owner, body)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+		}
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/", owner, `{"name":`).Code)
+	})
+
+	t.Run("requires authentication", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/"+created.ID, "", "").Code)
+	})
+}
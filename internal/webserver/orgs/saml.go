@@ -0,0 +1,170 @@
+package orgs
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/saml"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+const errTypeSAMLNotConfigured = "saml_not_configured"
+
+// SAMLServiceProvider is this service's SAML URLs for each organization, which the
+// organization's IdP admins register it with. saml.Client implements it.
+type SAMLServiceProvider interface {
+	EntityID(organizationID string) string
+	ACSURL(organizationID string) string
+	LoginURL(organizationID string) string
+}
+
+type setSAMLConfigRequest struct {
+	// IdPMetadata is the IdP's SAML metadata XML
+	IdPMetadata string `json:"idp_metadata"`
+}
+
+type samlConfigResponse struct {
+	IdPEntityID string `json:"idp_entity_id"`
+	IdPMetadata string `json:"idp_metadata"`
+	// SPEntityID is this service's entity ID for the organization, also the URL of its metadata
+	SPEntityID string `json:"sp_entity_id"`
+	ACSURL     string `json:"acs_url"`
+	// LoginURL is where to send the browser to sign in through the IdP
+	LoginURL  string    `json:"login_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (h *handler) newSAMLConfigResponse(config *database.OrganizationSAMLConfig) samlConfigResponse {
+	return samlConfigResponse{
+		IdPEntityID: config.IdPEntityID,
+		IdPMetadata: config.IdPMetadata,
+		SPEntityID:  h.saml.EntityID(config.OrganizationID),
+		ACSURL:      h.saml.ACSURL(config.OrganizationID),
+		LoginURL:    h.saml.LoginURL(config.OrganizationID),
+		CreatedAt:   config.CreatedAt,
+		UpdatedAt:   config.UpdatedAt,
+	}
+}
+
+// setSAMLConfig sets the organization's IdP, replacing any it had
+func (h *handler) setSAMLConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, ok := h.samlAdminOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	var reqBody setSAMLConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "error reading request body",
+			StatusCode: http.StatusBadRequest,
+		})
+		return
+	}
+
+	metadata := strings.TrimSpace(reqBody.IdPMetadata)
+	entityID, err := saml.ParseIdPMetadata(metadata)
+	if err != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The IdP metadata needs an entity ID, an HTTP-Redirect single sign on service, and a signing certificate",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	config, err := h.db.SetOrganizationSAMLConfig(ctx, database.SetOrganizationSAMLConfigParams{
+		OrganizationID: org.ID,
+		IdPEntityID:    entityID,
+		IdPMetadata:    metadata,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error setting organization saml config", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, h.newSAMLConfigResponse(config))
+}
+
+// getSAMLConfig returns the organization's IdP
+func (h *handler) getSAMLConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, ok := h.samlAdminOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	config, err := h.db.GetOrganizationSAMLConfig(ctx, org.ID)
+	if errors.Is(err, database.ErrOrganizationSAMLConfigNotFound) {
+		writeSAMLNotConfigured(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting organization saml config", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, h.newSAMLConfigResponse(config))
+}
+
+// deleteSAMLConfig turns SAML sign in off for the organization. Accounts it provisioned keep
+// their membership and can still sign in any other way they have.
+func (h *handler) deleteSAMLConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, ok := h.samlAdminOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.db.DeleteOrganizationSAMLConfig(ctx, org.ID)
+	if errors.Is(err, database.ErrOrganizationSAMLConfigNotFound) {
+		writeSAMLNotConfigured(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error deleting organization saml config", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// samlAdminOrganization is memberOrganization for the owners and admins who manage its IdP
+func (h *handler) samlAdminOrganization(w http.ResponseWriter, r *http.Request) (*database.Organization, bool) {
+	org, member, ok := h.memberOrganization(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if member.Role != database.OrganizationRoleOwner && member.Role != database.OrganizationRoleAdmin {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "Only owners and admins can manage the organization's SAML configuration",
+			Type:       errTypeForbidden,
+			StatusCode: http.StatusForbidden,
+		})
+		return nil, false
+	}
+
+	return org, true
+}
+
+func writeSAMLNotConfigured(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "SAML isn't configured for the organization",
+		Type:       errTypeSAMLNotConfigured,
+		StatusCode: http.StatusNotFound,
+	})
+}
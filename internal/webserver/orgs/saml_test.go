@@ -0,0 +1,125 @@
+package orgs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/saml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIdPMetadata = `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" entityID="https://idp.example.com">
+	<IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+		<KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>MIIB</ds:X509Certificate></ds:X509Data></ds:KeyInfo></KeyDescriptor>
+		<SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+	</IDPSSODescriptor>
+</EntityDescriptor>`
+
+func TestSAMLConfig(t *testing.T) {
+	ctx := context.Background()
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	db := database.NewMemoryDB()
+	h := NewHandler(HandlerDeps{
+		DB:         db,
+		AuthClient: authClient,
+		SAML:       saml.NewClient(saml.Config{BaseURL: "https://accounts.example.com"}),
+	})
+
+	newAccount := func(t *testing.T, email string) (*database.Account, string) {
+		account, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: email, PasswordHash: "hash"})
+		require.NoError(t, err)
+		token, _, err := authClient.NewAccessToken(auth.Claims{AccountID: account.ID})
+		require.NoError(t, err)
+		return account, token
+	}
+	owner, ownerToken := newAccount(t, "owner@test.com")
+	admin, adminToken := newAccount(t, "admin@test.com")
+	member, memberToken := newAccount(t, "member@test.com")
+	org, err := db.CreateOrganization(ctx, "Acme", owner.ID)
+	require.NoError(t, err)
+	_, err = db.AddOrganizationMember(ctx, org.ID, admin.ID, database.OrganizationRoleAdmin)
+	require.NoError(t, err)
+	_, err = db.AddOrganizationMember(ctx, org.ID, member.ID, database.OrganizationRoleMember)
+	require.NoError(t, err)
+
+	do := func(method, accessToken, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/"+org.ID+"/saml", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	setBody := func(metadata string) string {
+		body, err := json.Marshal(setSAMLConfigRequest{IdPMetadata: metadata})
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	t.Run("not configured yet", func(t *testing.T) {
+		w := do(http.MethodGet, ownerToken, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), errTypeSAMLNotConfigured)
+	})
+
+	t.Run("owners and admins configure the idp", func(t *testing.T) {
+		w := do(http.MethodPut, adminToken, setBody(testIdPMetadata))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp samlConfigResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "https://idp.example.com", resp.IdPEntityID)
+		assert.Equal(t, testIdPMetadata, resp.IdPMetadata)
+		assert.Equal(t, "https://accounts.example.com/v1/saml/"+org.ID+"/metadata", resp.SPEntityID)
+		assert.Equal(t, "https://accounts.example.com/v1/saml/"+org.ID+"/acs", resp.ACSURL)
+		assert.Equal(t, "https://accounts.example.com/v1/saml/"+org.ID+"/login", resp.LoginURL)
+
+		w = do(http.MethodGet, ownerToken, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var got samlConfigResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		assert.Equal(t, resp, got)
+	})
+
+	t.Run("metadata is validated", func(t *testing.T) {
+		for _, metadata := range []string{"", "<EntityDescriptor/>", `<EntityDescriptor entityID="https://idp.example.com"/>`} {
+			w := do(http.MethodPut, ownerToken, setBody(metadata))
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, metadata)
+			assert.Contains(t, w.Body.String(), errTypeValidationError)
+		}
+	})
+
+	t.Run("members can't see or change it", func(t *testing.T) {
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			w := do(method, memberToken, setBody(testIdPMetadata))
+			assert.Equal(t, http.StatusForbidden, w.Code, method)
+			assert.Contains(t, w.Body.String(), errTypeForbidden)
+		}
+	})
+
+	t.Run("deleting turns saml off", func(t *testing.T) {
+		w := do(http.MethodDelete, ownerToken, "")
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		_, err := db.GetOrganizationSAMLConfig(ctx, org.ID)
+		require.ErrorIs(t, err, database.ErrOrganizationSAMLConfigNotFound)
+
+		w = do(http.MethodDelete, ownerToken, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("the routes are off without saml", func(t *testing.T) {
+		h := NewHandler(HandlerDeps{DB: db, AuthClient: authClient})
+		req := httptest.NewRequest(http.MethodGet, "/"+org.ID+"/saml", nil)
+		req.Header.Set("Authorization", "Bearer "+ownerToken)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,47 @@
+package orgs
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+)
+
+type organizationTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	OrgID       string `json:"org_id"`
+}
+
+// organizationToken issues the caller an access token scoped to an organization they're a
+// member of: the claims of the token they called with plus org_id. There's no refresh token,
+// clients ask for a new one when it expires.
+func (h *handler) organizationToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, _, ok := h.memberOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	callerClaims, _ := middleware.ClaimsFromContext(ctx)
+	claims := *callerClaims
+	claims.OrgID = org.ID
+
+	accessToken, expiresAt, err := h.authClient.NewAccessToken(claims)
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating organization access token", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	httputils.WriteJSONResponse(w, r, http.StatusOK, organizationTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(expiresAt).Seconds()),
+		OrgID:       org.ID,
+	})
+}
@@ -0,0 +1,215 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/ratelimit"
+	"github.com/austinwofford/account-management/internal/webserver/internalapi"
+	chimiddleware "github.com/go-chi/chi/middleware"
+)
+
+// passwordPolicySettings are the settings auth.PasswordPolicy is built from
+var passwordPolicySettings = []string{
+	"PASSWORD_MIN_LENGTH",
+	"PASSWORD_MAX_LENGTH",
+	"PASSWORD_REQUIRE_UPPERCASE",
+	"PASSWORD_REQUIRE_LOWERCASE",
+	"PASSWORD_REQUIRE_DIGIT",
+	"PASSWORD_REQUIRE_SPECIAL",
+	"PASSWORD_DISALLOW_EMAIL",
+	"PASSWORD_BANNED_LIST_FILE",
+}
+
+// Reloader loads the config again and applies the settings that are safe to change while
+// requests are being served: LOG_LEVEL, RATE_LIMITS, ACCESS_TOKEN_TTL_MINUTES, and the password
+// policy. The rest only change on a restart. REFRESH_TOKEN_TTL_MINUTES is one of them, revoked
+// refresh tokens and session cookies are kept for as long as it was when they were issued.
+type Reloader struct {
+	load     func() (*config.Config, error)
+	logLevel *slog.LevelVar
+
+	// mu makes reloads take turns
+	mu sync.Mutex
+	// started is the config the service started with and current the last one loaded. A
+	// setting that needs a restart is compared with started, so it's reported until there is one.
+	started config.Config
+	current config.Config
+
+	// set by NewRouter, nil when the service doesn't use them
+	authClient     *auth.Client
+	rateLimits     *ratelimit.RuleSet
+	passwordPolicy *auth.PasswordPolicy
+	auditLog       audit.Recorder
+}
+
+// NewReloader returns a Reloader for the service started with cfg. load reads the config again,
+// with the same overrides, and logLevel is the level the service's logger logs at.
+func NewReloader(cfg config.Config, load func() (*config.Config, error), logLevel *slog.LevelVar) *Reloader {
+	return &Reloader{load: load, logLevel: logLevel, started: cfg, current: cfg}
+}
+
+func (r *Reloader) attach(authClient *auth.Client, rateLimits *ratelimit.RuleSet, passwordPolicy *auth.PasswordPolicy, auditLog audit.Recorder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.authClient = authClient
+	r.rateLimits = rateLimits
+	r.passwordPolicy = passwordPolicy
+	r.auditLog = auditLog
+}
+
+// Reload loads the config and applies the reloadable settings that changed, recording them in
+// the audit log. A config that fails to load or validate isn't applied at all. It returns the
+// settings it changed, and the settings that are different from the running config but need a
+// restart.
+func (r *Reloader) Reload(ctx context.Context) (changed []config.Change, restartRequired []string, err error) {
+	next, err := r.load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// dev mode makes up a JWT key on every load, tokens are still signed with the first one
+	if next.DevMode && r.started.DevMode {
+		next.JWTSecretKey = r.started.JWTSecretKey
+	}
+
+	// everything is prepared before anything is applied, so a reload applies all or nothing
+	var rules []ratelimit.Rule
+	if r.rateLimits != nil {
+		rules, err = ratelimit.ParseRules(next.RateLimits)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing RATE_LIMITS: %w", err)
+		}
+	}
+	var policyCfg auth.PasswordPolicyConfig
+	if r.passwordPolicy != nil {
+		policyCfg, err = passwordPolicyConfig(*next)
+		if err == nil {
+			err = policyCfg.Validate()
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error configuring the password policy: %w", err)
+		}
+	}
+
+	for _, change := range r.current.Diff(*next) {
+		if r.reloadable(change.Setting) {
+			changed = append(changed, change)
+		}
+	}
+	// the banned passwords can change without the file's path changing
+	if r.passwordPolicy != nil && !slices.ContainsFunc(changed, isSetting("PASSWORD_BANNED_LIST_FILE")) {
+		banned := r.passwordPolicy.Config().BannedPasswords
+		if !slices.Equal(banned, policyCfg.BannedPasswords) {
+			changed = append(changed, config.Change{
+				Setting: "PASSWORD_BANNED_LIST_FILE",
+				Old:     fmt.Sprintf("%s (%d passwords)", next.PasswordBannedListFile, len(banned)),
+				New:     fmt.Sprintf("%s (%d passwords)", next.PasswordBannedListFile, len(policyCfg.BannedPasswords)),
+			})
+			slices.SortFunc(changed, func(a, b config.Change) int { return strings.Compare(a.Setting, b.Setting) })
+		}
+	}
+	for _, change := range r.started.Diff(*next) {
+		// secrets that are refreshed are rotated, or warned about, by the secret refresh job
+		_, refreshed := next.SecretRefs[change.Setting]
+		if !r.reloadable(change.Setting) && !(refreshed && next.SecretsRefreshSeconds > 0) {
+			restartRequired = append(restartRequired, change.Setting)
+		}
+	}
+
+	// only when LOG_LEVEL changed, so a level set through the admin API outlasts other reloads
+	if r.logLevel != nil && slices.ContainsFunc(changed, isSetting("LOG_LEVEL")) {
+		r.logLevel.Set(next.SlogLevel())
+	}
+	if r.rateLimits != nil {
+		r.rateLimits.Replace(rules)
+	}
+	if r.authClient != nil {
+		r.authClient.SetAccessTokenTTL(time.Duration(next.AccessTokenTTLMinutes) * time.Minute)
+	}
+	if r.passwordPolicy != nil {
+		// it was validated above
+		if err := r.passwordPolicy.Update(policyCfg); err != nil {
+			return nil, nil, fmt.Errorf("error configuring the password policy: %w", err)
+		}
+	}
+	r.current = *next
+
+	if len(changed) > 0 {
+		r.record(ctx, changed)
+	}
+	slog.InfoContext(ctx, "reloaded config", "changed", settingNames(changed))
+	if len(restartRequired) > 0 {
+		slog.WarnContext(ctx, "settings changed that need a restart", "settings", restartRequired)
+	}
+	return changed, restartRequired, nil
+}
+
+// reloadable reports whether a setting is applied by Reload. Settings for something the service
+// isn't using, e.g. RATE_LIMITS with rate limiting off, need a restart to start using it.
+func (r *Reloader) reloadable(setting string) bool {
+	switch {
+	case setting == "LOG_LEVEL":
+		return r.logLevel != nil
+	case setting == "RATE_LIMITS":
+		return r.rateLimits != nil
+	case setting == "ACCESS_TOKEN_TTL_MINUTES":
+		return r.authClient != nil
+	case slices.Contains(passwordPolicySettings, setting):
+		return r.passwordPolicy != nil
+	}
+	return false
+}
+
+// record writes the changes to the audit log, e.g. "ACCESS_TOKEN_TTL_MINUTES: 15 -> 5"
+func (r *Reloader) record(ctx context.Context, changes []config.Change) {
+	if r.auditLog == nil {
+		return
+	}
+	details := make([]string, len(changes))
+	for i, change := range changes {
+		details[i] = change.Setting + ": " + change.Old + " -> " + change.New
+	}
+	r.auditLog.Record(ctx, database.CreateAuditEventParams{
+		EventType: database.AuditEventConfigReloaded,
+		RequestID: chimiddleware.GetReqID(ctx),
+		Details:   strings.Join(details, "; "),
+	})
+}
+
+// reloadConfig is Reload for the internal API
+func (r *Reloader) reloadConfig(ctx context.Context) ([]internalapi.ConfigChange, []string, error) {
+	changes, restartRequired, err := r.Reload(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	changed := make([]internalapi.ConfigChange, len(changes))
+	for i, change := range changes {
+		changed[i] = internalapi.ConfigChange{Setting: change.Setting, Old: change.Old, New: change.New}
+	}
+	return changed, restartRequired, nil
+}
+
+func isSetting(setting string) func(config.Change) bool {
+	return func(change config.Change) bool { return change.Setting == setting }
+}
+
+func settingNames(changes []config.Change) []string {
+	names := make([]string, len(changes))
+	for i, change := range changes {
+		names[i] = change.Setting
+	}
+	return names
+}
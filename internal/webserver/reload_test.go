@@ -0,0 +1,100 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader(t *testing.T) {
+	t.Setenv("PSQL_URL", "postgres://localhost/accounts")
+	t.Setenv("JWT_SECRET_KEY", "Zr8sQv2LkP0xW6nT4bYh1cJm9eGd3fUa")
+	started, err := config.Load(config.Overrides{})
+	require.NoError(t, err)
+
+	// what the config file holds
+	next := *started
+	var loadErr error
+	logLevel := new(slog.LevelVar)
+	reloads := NewReloader(*started, func() (*config.Config, error) {
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		cfg := next
+		return &cfg, nil
+	}, logLevel)
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: started.JWTSecretKey, AccessTokenTTLMinutes: started.AccessTokenTTLMinutes})
+	rules, err := ratelimit.ParseRules(started.RateLimits)
+	require.NoError(t, err)
+	rateLimits := ratelimit.NewRuleSet(rules)
+	policy, err := newPasswordPolicy(*started)
+	require.NoError(t, err)
+	db := database.NewMemoryDB()
+	reloads.attach(authClient, rateLimits, policy, audit.Sync(db.CreateAuditEvent))
+	ctx := context.Background()
+
+	next.LogLevel = "debug"
+	next.AccessTokenTTLMinutes = 5
+	next.RateLimits = map[string]string{"POST /v1/accounts/login": "3/1m"}
+	next.PasswordMinLength = 12
+	next.HTTPAddress = ":9090"
+	changed, restartRequired, err := reloads.Reload(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ACCESS_TOKEN_TTL_MINUTES", "LOG_LEVEL", "PASSWORD_MIN_LENGTH", "RATE_LIMITS"}, settingNames(changed))
+	assert.Equal(t, []string{"HTTP_ADDRESS"}, restartRequired)
+
+	assert.Equal(t, slog.LevelDebug, logLevel.Level())
+	assert.Equal(t, 5*time.Minute, authClient.AccessTokenTTL())
+	rule, ok := rateLimits.Lookup("POST /v1/accounts/login")
+	require.True(t, ok)
+	assert.Equal(t, 3, rule.Limit.Requests)
+	_, ok = rateLimits.Lookup("POST /v1/accounts/register")
+	assert.False(t, ok)
+	assert.Equal(t, 12, policy.Config().MinLength)
+
+	events, err := db.ListAuditEvents(ctx, database.ListAuditEventsParams{EventType: database.AuditEventConfigReloaded})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Empty(t, events[0].AccountID)
+	assert.Contains(t, events[0].Details, "ACCESS_TOKEN_TTL_MINUTES: 15 -> 5; LOG_LEVEL: info -> debug; PASSWORD_MIN_LENGTH: 8 -> 12")
+
+	// nothing changed since, but the address still needs a restart. The level set through the
+	// admin API is kept.
+	logLevel.Set(slog.LevelWarn)
+	changed, restartRequired, err = reloads.Reload(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, slog.LevelWarn, logLevel.Level())
+	assert.Equal(t, []string{"HTTP_ADDRESS"}, restartRequired)
+	events, err = db.ListAuditEvents(ctx, database.ListAuditEventsParams{EventType: database.AuditEventConfigReloaded})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	t.Run("a config that doesn't load changes nothing", func(t *testing.T) {
+		next.AccessTokenTTLMinutes = 30
+		loadErr = errors.New("invalid config, 1 problem")
+		_, _, err := reloads.Reload(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, 5*time.Minute, authClient.AccessTokenTTL())
+	})
+
+	t.Run("a bad password policy changes nothing", func(t *testing.T) {
+		loadErr = nil
+		next.AccessTokenTTLMinutes = 30
+		next.PasswordBannedListFile = "/does/not/exist"
+		_, _, err := reloads.Reload(ctx)
+		assert.ErrorContains(t, err, "PASSWORD_BANNED_LIST_FILE")
+		assert.Equal(t, 5*time.Minute, authClient.AccessTokenTTL())
+	})
+}
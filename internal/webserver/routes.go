@@ -0,0 +1,108 @@
+package webserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/go-chi/chi/v5"
+)
+
+// Route is one method and pattern served by the router, with the middleware that runs in front
+// of it, outermost first
+type Route struct {
+	Method      string   `json:"method"`
+	Pattern     string   `json:"pattern"`
+	Middlewares []string `json:"middlewares"`
+}
+
+// Routes walks the router, including mounted subrouters, and returns every route sorted by
+// pattern and method
+func Routes(h http.Handler) ([]Route, error) {
+	router, ok := h.(chi.Routes)
+	if !ok {
+		return nil, fmt.Errorf("error listing routes: %T isn't a chi router", h)
+	}
+
+	var routes []Route
+	err := chi.Walk(router, func(method, route string, _ http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		names := make([]string, 0, len(middlewares))
+		for _, mw := range middlewares {
+			names = append(names, middlewareName(mw))
+		}
+		routes = append(routes, Route{
+			Method:      method,
+			Pattern:     route,
+			Middlewares: names,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing routes: %w", err)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes, nil
+}
+
+// WriteRoutes prints the routes as a table
+func WriteRoutes(w io.Writer, routes []Route) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATTERN\tMIDDLEWARE")
+	for _, route := range routes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", route.Method, route.Pattern, strings.Join(route.Middlewares, ", "))
+	}
+	return tw.Flush()
+}
+
+type routesResponse struct {
+	Routes []Route `json:"routes"`
+}
+
+// routeCatalog serves the routes of router so operators can audit what a build exposes
+func routeCatalog(router http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		routes, err := Routes(router)
+		if err != nil {
+			httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+				Message:    "There was an unexpected error listing routes",
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		httputils.WriteJSONResponse(w, r, http.StatusOK, routesResponse{Routes: routes})
+	}
+}
+
+// closureSuffix matches what Go appends to the names of closures, e.g. ".func1", ".func1.2", or
+// just ".1" once the function that returns the closure has been inlined
+var closureSuffix = regexp.MustCompile(`(\.func\d+|\.\d+)+$`)
+
+// middlewareName is the package qualified name of the function that built the middleware,
+// e.g. "middleware.RequireAuth"
+func middlewareName(mw func(http.Handler) http.Handler) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(mw).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+
+	name := closureSuffix.ReplaceAllString(fn.Name(), "")
+	// drop the import path, keeping the package name
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
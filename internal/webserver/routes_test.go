@@ -0,0 +1,154 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/service/hmacauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutes(t *testing.T) {
+	router, err := NewRouter(config.Config{
+		DevMode:          true,
+		DebugEnabled:     true,
+		JWTSecretKey:     "routes-test-secret",
+		InternalHMACKeys: map[string]string{"ops": "ops-secret"},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+	require.NoError(t, err)
+
+	routes, err := Routes(router)
+	require.NoError(t, err)
+
+	byRoute := map[string]Route{}
+	for _, route := range routes {
+		byRoute[route.Method+" "+route.Pattern] = route
+	}
+
+	// routes in mounted routers are listed with their full path
+	require.Contains(t, byRoute, "POST /v1/accounts/login")
+	require.Contains(t, byRoute, "GET /v1/accounts/me/activity")
+	require.Contains(t, byRoute, "POST /internal/accounts/lookup")
+	require.Contains(t, byRoute, "POST /v1/oauth/introspect")
+	require.Contains(t, byRoute, "POST /v1/orgs/{id}/invitations")
+	require.Contains(t, byRoute, "POST /v1/invitations/accept")
+	require.Contains(t, byRoute, "GET /debug/routes")
+	assert.NotContains(t, byRoute, "POST /v1/accounts/login/apple", "Apple isn't configured")
+
+	assert.Contains(t, byRoute["GET /v1/accounts/me/activity"].Middlewares, "middleware.RequireAuthOrAPIKey")
+	assert.Contains(t, byRoute["GET /v1/accounts/me/activity"].Middlewares, "middleware.RequireScope")
+	assert.Contains(t, byRoute["POST /v1/accounts/me/api-keys"].Middlewares, "middleware.RequireAuth")
+	assert.NotContains(t, byRoute["POST /v1/accounts/login"].Middlewares, "middleware.RequireAuth")
+	assert.Contains(t, byRoute["POST /v1/orgs/{id}/invitations"].Middlewares, "middleware.RequireAuth")
+	assert.NotContains(t, byRoute["POST /v1/invitations/accept"].Middlewares, "middleware.RequireAuth")
+	assert.Contains(t, byRoute["POST /internal/accounts/lookup"].Middlewares, "middleware.RequireServiceAuth")
+	assert.Contains(t, byRoute["POST /v1/oauth/introspect"].Middlewares, "middleware.RequireServiceAuth")
+	assert.Contains(t, byRoute["POST /v1/oauth/clients"].Middlewares, "middleware.RequireServiceAuth")
+	assert.Contains(t, byRoute["GET /v1/oauth/authorize"].Middlewares, "middleware.RequireAuth")
+	assert.NotContains(t, byRoute["POST /v1/oauth/token"].Middlewares, "middleware.RequireServiceAuth")
+	assert.NotContains(t, byRoute["POST /v1/oauth/token"].Middlewares, "middleware.RequireAuth")
+	assert.Contains(t, byRoute["POST /v1/accounts/login"].Middlewares, "middleware.RequestID")
+
+	var table bytes.Buffer
+	require.NoError(t, WriteRoutes(&table, routes))
+	assert.Regexp(t, `(?m)^POST +/v1/accounts/login +middleware\.RequestID`, table.String())
+
+	t.Run("endpoint requires service auth", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("endpoint lists routes", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+		require.NoError(t, hmacauth.Sign(req, "ops", []byte("ops-secret"), time.Now()))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp routesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, routes, resp.Routes)
+	})
+}
+
+func TestRoutesWithoutDebug(t *testing.T) {
+	router, err := NewRouter(config.Config{
+		DevMode:      true,
+		JWTSecretKey: "routes-test-secret",
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	router, err := NewRouter(config.Config{
+		DevMode:                true,
+		MetricsEnabled:         true,
+		JWTSecretKey:           "metrics-test-secret",
+		AccessTokenTTLMinutes:  15,
+		RefreshTokenTTLMinutes: 60,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+	require.NoError(t, err)
+
+	credentials := `{"email":"metrics@test.com","password":"Test123!@#"}`
+	for _, path := range []string{"/v1/accounts/register", "/v1/accounts/login"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(credentials))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Less(t, w.Code, 300, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+
+	assert.Contains(t, body, `account_management_http_requests_total{method="POST",route="/v1/accounts/login",status="200"} 1`)
+	assert.Contains(t, body, `account_management_tokens_issued_total{type="access"} 1`)
+	assert.Contains(t, body, `account_management_active_refresh_tokens 1`)
+	assert.Contains(t, body, `account_management_password_hash_duration_seconds_count{operation="hash"} 1`)
+	assert.Contains(t, body, `account_management_password_hash_duration_seconds_count{operation="compare"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestIPFilters(t *testing.T) {
+	router, err := NewRouter(config.Config{
+		DevMode:          true,
+		JWTSecretKey:     "routes-test-secret",
+		IPDenylist:       []string{"192.0.2.0/24"},
+		AdminIPAllowlist: []string{"10.0.0.0/8"},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+	require.NoError(t, err)
+
+	request := func(path, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// the global denylist covers every route
+	assert.Equal(t, http.StatusForbidden, request("/healthz", "192.0.2.1:1234"))
+	assert.Equal(t, http.StatusForbidden, request("/v1/accounts/password-policy", "192.0.2.1:1234"))
+	assert.Equal(t, http.StatusOK, request("/v1/accounts/password-policy", "198.51.100.1:1234"))
+
+	// the admin allowlist only covers the admin API
+	assert.Equal(t, http.StatusForbidden, request("/v1/admin/audit", "198.51.100.1:1234"))
+	assert.Equal(t, http.StatusUnauthorized, request("/v1/admin/audit", "10.1.2.3:1234"))
+}
@@ -0,0 +1,89 @@
+// Package saml serves the /v1/saml routes: single sign on through an organization's SAML 2.0
+// identity provider. Accounts the IdP signs in for the first time are provisioned just in time
+// and linked to the IdP's NameID.
+package saml
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/audit"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/saml"
+	"github.com/go-chi/chi/v5"
+)
+
+// Repository defines the DB methods needed by SAML handlers
+type Repository interface {
+	GetOrganization(ctx context.Context, id string) (*database.Organization, error)
+	GetOrganizationMember(ctx context.Context, organizationID, accountID string) (*database.OrganizationMember, error)
+	AddOrganizationMember(ctx context.Context, organizationID, accountID, role string) (*database.OrganizationMember, error)
+	GetOrganizationSAMLConfig(ctx context.Context, organizationID string) (*database.OrganizationSAMLConfig, error)
+	CreateFederatedIdentity(ctx context.Context, params database.CreateFederatedIdentityParams) (*database.FederatedIdentity, error)
+	GetFederatedIdentity(ctx context.Context, organizationID, subject string) (*database.FederatedIdentity, error)
+	GetAccount(ctx context.Context, email string) (*database.Account, error)
+	GetAccountByID(ctx context.Context, id string) (*database.Account, error)
+	CreateAccount(ctx context.Context, params database.AccountCreationParams) (*database.Account, error)
+	CreateAuditEvent(ctx context.Context, params database.CreateAuditEventParams) error
+}
+
+// ServiceProvider builds SAML requests and validates the responses for each organization's IdP.
+// saml.Client implements it.
+type ServiceProvider interface {
+	Metadata(organizationID string) ([]byte, error)
+	NewAuthnRequest(organizationID, idpMetadata string) (redirectURL, requestID string, err error)
+	ParseResponse(organizationID, idpMetadata, samlResponse, requestID string) (*saml.Identity, error)
+}
+
+type handler struct {
+	db         Repository
+	sp         ServiceProvider
+	authClient *auth.Client
+	appURL     string
+	auditLog   audit.Recorder
+	// secureCookies is whether this service is served over https
+	secureCookies bool
+
+	chi.Router
+}
+
+type HandlerDeps struct {
+	DB              Repository
+	ServiceProvider ServiceProvider
+	// AuthClient signs the SSO login tokens the web app trades for tokens
+	AuthClient *auth.Client
+	// AppURL is the base URL of the web app, which gets the SSO login token at /sso/callback
+	AppURL string
+	// AuditLog records security events. Defaults to writing them to DB before responding.
+	AuditLog audit.Recorder
+	// SecureCookies marks the cookie that ties a sign in to the browser Secure and SameSite=None,
+	// so it's sent with the IdP's cross-site post. Set it when this service is served over https.
+	SecureCookies bool
+}
+
+func NewHandler(deps HandlerDeps) http.Handler {
+	mux := chi.NewMux()
+
+	h := handler{
+		db:         deps.DB,
+		sp:         deps.ServiceProvider,
+		authClient: deps.AuthClient,
+		appURL:     deps.AppURL,
+		auditLog:   deps.AuditLog,
+
+		secureCookies: deps.SecureCookies,
+	}
+	if h.auditLog == nil {
+		h.auditLog = audit.Sync(deps.DB.CreateAuditEvent)
+	}
+
+	// the browser is sent to these by the web app and the IdP, so they don't take an access token
+	mux.Get("/{orgID}/metadata", h.metadata)
+	mux.Get("/{orgID}/login", h.login)
+	mux.Post("/{orgID}/acs", h.acs)
+
+	h.Router = mux
+
+	return h
+}
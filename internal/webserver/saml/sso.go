@@ -0,0 +1,332 @@
+package saml
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/i18n"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/saml"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// requestCookie holds the ID of the authn request the browser was sent to the IdP with, so
+	// only a response to it is accepted, and only from that browser
+	requestCookie = "saml_request"
+	// requestTTL is how long the user has to sign in at the IdP
+	requestTTL = 10 * time.Minute
+
+	errTypeOrganizationNotFound = "organization_not_found"
+	errTypeSAMLNotConfigured    = "saml_not_configured"
+	errTypeInvalidSAMLResponse  = "invalid_saml_response"
+	errTypeAccountAlreadyExists = "account_already_exists"
+	errTypeAccountFrozen        = "account_frozen"
+	errTypeValidationError      = "validation_error"
+
+	unexpectedSAMLError = "There was an unexpected error signing in with SAML"
+)
+
+// metadata serves this service's SP metadata for the organization. IdP admins need it before
+// SAML is configured, so it's served for every organization.
+func (h *handler) metadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, ok := h.organization(w, r)
+	if !ok {
+		return
+	}
+
+	metadata, err := h.sp.Metadata(org.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error building saml metadata", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(metadata)
+}
+
+// login sends the browser to sign in at the organization's IdP
+func (h *handler) login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, config, ok := h.samlConfig(w, r)
+	if !ok {
+		return
+	}
+
+	redirectURL, requestID, err := h.sp.NewAuthnRequest(org.ID, config.IdPMetadata)
+	if err != nil {
+		slog.ErrorContext(ctx, "error making saml authn request", "error", err, "organization_id", org.ID)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	http.SetCookie(w, h.requestCookie(org.ID, requestID, int(requestTTL.Seconds())))
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// acs is the assertion consumer service the IdP posts its response to. The account it signs in
+// is found by its federated identity, or linked the first time. The browser is sent on to the web
+// app with a short-lived SSO login token for POST /v1/accounts/login/sso.
+func (h *handler) acs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	org, config, ok := h.samlConfig(w, r)
+	if !ok {
+		return
+	}
+
+	cookie, err := r.Cookie(requestCookie)
+	samlResponse := r.PostFormValue("SAMLResponse")
+	if err != nil || cookie.Value == "" || samlResponse == "" {
+		writeInvalidSAMLResponse(w, r)
+		return
+	}
+	// the request is answered whether or not the response is valid
+	http.SetCookie(w, h.requestCookie(org.ID, "", -1))
+
+	identity, err := h.sp.ParseResponse(org.ID, config.IdPMetadata, samlResponse, cookie.Value)
+	if err != nil {
+		if errors.Is(err, saml.ErrInvalidResponse) || errors.Is(err, saml.ErrInvalidMetadata) {
+			slog.InfoContext(ctx, "rejected saml response", "error", err, "organization_id", org.ID)
+			writeInvalidSAMLResponse(w, r)
+			return
+		}
+		slog.ErrorContext(ctx, "error parsing saml response", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	account, errResponse := h.accountForIdentity(ctx, r, org.ID, identity)
+	if errResponse != nil {
+		httputils.WriteErrorResponse(w, r, *errResponse)
+		return
+	}
+	if account.FrozenAt != nil {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "This account is frozen. Follow the link we emailed you to unfreeze it",
+			Type:       errTypeAccountFrozen,
+			StatusCode: http.StatusForbidden,
+		})
+		return
+	}
+
+	token, err := h.authClient.NewSSOLoginToken(account.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating sso login token", "error", err)
+		writeUnexpectedError(w, r)
+		return
+	}
+
+	// a fragment so the token isn't sent on to the web app's server or logged with the URL
+	http.Redirect(w, r, strings.TrimRight(h.appURL, "/")+"/sso/callback#token="+url.QueryEscape(token), http.StatusSeeOther)
+}
+
+// accountForIdentity returns the account linked to the IdP's user. The first time the user signs
+// in, it's linked to the account with their email if that account is already a member of the
+// organization, and otherwise a passwordless account is created and added as a member.
+func (h *handler) accountForIdentity(ctx context.Context, r *http.Request, organizationID string, identity *saml.Identity) (*database.Account, *httputils.ErrorResponse) {
+	unexpectedErr := &httputils.ErrorResponse{
+		Message:    unexpectedSAMLError,
+		StatusCode: http.StatusInternalServerError,
+	}
+
+	existing, err := h.db.GetFederatedIdentity(ctx, organizationID, identity.Subject)
+	if err == nil {
+		account, err := h.db.GetAccountByID(ctx, existing.AccountID)
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting account for federated identity", "error", err)
+			return nil, unexpectedErr
+		}
+		return account, nil
+	}
+	if !errors.Is(err, database.ErrFederatedIdentityNotFound) {
+		slog.ErrorContext(ctx, "error getting federated identity", "error", err)
+		return nil, unexpectedErr
+	}
+
+	// first sign in through this IdP
+	if !auth.IsValidEmail(identity.Email) {
+		return nil, &httputils.ErrorResponse{
+			Message:    "The identity provider did not send a valid email address",
+			Type:       errTypeValidationError,
+			StatusCode: http.StatusUnprocessableEntity,
+		}
+	}
+
+	account, err := h.db.GetAccount(ctx, identity.Email)
+	switch {
+	case err == nil:
+		// an organization's IdP can claim any email, so it can only link accounts that already
+		// joined the organization. Otherwise its admins could take over anyone's account.
+		_, err := h.db.GetOrganizationMember(ctx, organizationID, account.ID)
+		if errors.Is(err, database.ErrNotOrganizationMember) {
+			return nil, &httputils.ErrorResponse{
+				Message:    "An account with this email already exists. Accept an invitation to the organization to sign in with SAML",
+				Type:       errTypeAccountAlreadyExists,
+				StatusCode: http.StatusConflict,
+			}
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting organization member for federated identity", "error", err)
+			return nil, unexpectedErr
+		}
+	case errors.Is(err, database.ErrAccountNotFound):
+		// no password: the account can only sign in through the IdP until one is set. The email
+		// isn't verified, the IdP only vouches for it within the organization.
+		account, err = h.db.CreateAccount(ctx, database.AccountCreationParams{
+			Email:           identity.Email,
+			PreferredLocale: i18n.LocaleFromContext(ctx),
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "error creating account for federated identity", "error", err)
+			return nil, unexpectedErr
+		}
+		h.recordAuditEvent(ctx, r, account.ID, database.AuditEventAccountCreated)
+
+		if _, err := h.db.AddOrganizationMember(ctx, organizationID, account.ID, database.OrganizationRoleMember); err != nil {
+			slog.ErrorContext(ctx, "error adding federated account to organization", "error", err)
+			return nil, unexpectedErr
+		}
+	default:
+		slog.ErrorContext(ctx, "error getting account for federated identity", "error", err)
+		return nil, unexpectedErr
+	}
+
+	_, err = h.db.CreateFederatedIdentity(ctx, database.CreateFederatedIdentityParams{
+		AccountID:      account.ID,
+		OrganizationID: organizationID,
+		Subject:        identity.Subject,
+		Email:          identity.Email,
+	})
+	if err != nil {
+		// a concurrent first sign in won the race, use whatever it linked
+		if errors.Is(err, database.ErrFederatedIdentityAlreadyExists) {
+			if existing, err := h.db.GetFederatedIdentity(ctx, organizationID, identity.Subject); err == nil {
+				if linked, err := h.db.GetAccountByID(ctx, existing.AccountID); err == nil {
+					return linked, nil
+				}
+			}
+		}
+		slog.ErrorContext(ctx, "error linking federated identity", "error", err)
+		return nil, unexpectedErr
+	}
+	h.recordAuditEvent(ctx, r, account.ID, database.AuditEventIdentityLinked)
+
+	return account, nil
+}
+
+// organization looks up the organization in the URL. It writes the error response when ok is
+// false.
+func (h *handler) organization(w http.ResponseWriter, r *http.Request) (*database.Organization, bool) {
+	ctx := r.Context()
+
+	id := chi.URLParam(r, "orgID")
+	if _, err := uuid.Parse(id); err != nil {
+		writeOrganizationNotFound(w, r)
+		return nil, false
+	}
+
+	org, err := h.db.GetOrganization(ctx, id)
+	if errors.Is(err, database.ErrOrganizationNotFound) {
+		writeOrganizationNotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting organization", "error", err)
+		writeUnexpectedError(w, r)
+		return nil, false
+	}
+	return org, true
+}
+
+// samlConfig looks up the organization in the URL and its IdP. It writes the error response
+// when ok is false.
+func (h *handler) samlConfig(w http.ResponseWriter, r *http.Request) (*database.Organization, *database.OrganizationSAMLConfig, bool) {
+	ctx := r.Context()
+
+	org, ok := h.organization(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	config, err := h.db.GetOrganizationSAMLConfig(ctx, org.ID)
+	if errors.Is(err, database.ErrOrganizationSAMLConfigNotFound) {
+		httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+			Message:    "The organization has not set up SAML sign in",
+			Type:       errTypeSAMLNotConfigured,
+			StatusCode: http.StatusNotFound,
+		})
+		return nil, nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting organization saml config", "error", err)
+		writeUnexpectedError(w, r)
+		return nil, nil, false
+	}
+	return org, config, true
+}
+
+// requestCookie is only sent back to the organization's ACS. The IdP posts to it from another
+// site, which browsers only send SameSite=None cookies with, and those have to be Secure.
+func (h *handler) requestCookie(organizationID, requestID string, maxAge int) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     requestCookie,
+		Value:    requestID,
+		Path:     "/v1/saml/" + organizationID + "/acs",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if h.secureCookies {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+func (h *handler) recordAuditEvent(ctx context.Context, r *http.Request, accountID, eventType string) {
+	h.auditLog.Record(ctx, database.CreateAuditEventParams{
+		AccountID: accountID,
+		EventType: eventType,
+		IPAddress: httputils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: chimiddleware.GetReqID(ctx),
+	})
+}
+
+func writeOrganizationNotFound(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "Organization not found",
+		Type:       errTypeOrganizationNotFound,
+		StatusCode: http.StatusNotFound,
+	})
+}
+
+func writeInvalidSAMLResponse(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    "The SAML response is invalid or has expired. Start signing in again",
+		Type:       errTypeInvalidSAMLResponse,
+		StatusCode: http.StatusBadRequest,
+	})
+}
+
+func writeUnexpectedError(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    unexpectedSAMLError,
+		StatusCode: http.StatusInternalServerError,
+	})
+}
@@ -0,0 +1,230 @@
+package saml
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/saml"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServiceProvider accepts the responses registered for a request ID
+type fakeServiceProvider struct {
+	requestID string
+	// responses are the identities keyed by SAMLResponse
+	responses map[string]*saml.Identity
+}
+
+func (f *fakeServiceProvider) Metadata(organizationID string) ([]byte, error) {
+	return []byte(`<EntityDescriptor entityID="` + organizationID + `"/>`), nil
+}
+
+func (f *fakeServiceProvider) NewAuthnRequest(organizationID, idpMetadata string) (string, string, error) {
+	return "https://idp.example.com/sso?SAMLRequest=request", f.requestID, nil
+}
+
+func (f *fakeServiceProvider) ParseResponse(organizationID, idpMetadata, samlResponse, requestID string) (*saml.Identity, error) {
+	identity, ok := f.responses[samlResponse]
+	if !ok || requestID != f.requestID {
+		return nil, fmt.Errorf("%w: unknown response", saml.ErrInvalidResponse)
+	}
+	return identity, nil
+}
+
+func TestSSO(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemoryDB()
+	owner, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "owner@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	outsider, err := db.CreateAccount(ctx, database.AccountCreationParams{Email: "outsider@test.com", PasswordHash: "hash"})
+	require.NoError(t, err)
+	org, err := db.CreateOrganization(ctx, "Acme", owner.ID)
+	require.NoError(t, err)
+	unconfigured, err := db.CreateOrganization(ctx, "Initech", owner.ID)
+	require.NoError(t, err)
+	_, err = db.SetOrganizationSAMLConfig(ctx, database.SetOrganizationSAMLConfigParams{
+		OrganizationID: org.ID,
+		IdPEntityID:    "https://idp.example.com",
+		IdPMetadata:    "<EntityDescriptor/>",
+	})
+	require.NoError(t, err)
+
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret-key", AccessTokenTTLMinutes: 15})
+	h := NewHandler(HandlerDeps{
+		DB: db,
+		ServiceProvider: &fakeServiceProvider{
+			requestID: "id-request",
+			responses: map[string]*saml.Identity{
+				"new-user": {Subject: "idp-new", Email: "new@test.com"},
+				"squatter": {Subject: "idp-squatter", Email: "victim@test.com"},
+				"owner":    {Subject: "idp-owner", Email: "owner@test.com"},
+				"outsider": {Subject: "idp-outsider", Email: "outsider@test.com"},
+				"no-email": {Subject: "idp-no-email"},
+			},
+		},
+		AuthClient:    authClient,
+		AppURL:        "https://app.example.com/",
+		SecureCookies: true,
+	})
+
+	acs := func(orgID, samlResponse, requestID string) *httptest.ResponseRecorder {
+		form := url.Values{"SAMLResponse": {samlResponse}}
+		req := httptest.NewRequest(http.MethodPost, "/"+orgID+"/acs", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if requestID != "" {
+			req.AddCookie(&http.Cookie{Name: requestCookie, Value: requestID})
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// signedIn returns the account the SSO login token the browser was sent on with is for
+	signedIn := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+		location := w.Header().Get("Location")
+		require.True(t, strings.HasPrefix(location, "https://app.example.com/sso/callback#token="), location)
+		token, err := url.QueryUnescape(strings.TrimPrefix(location, "https://app.example.com/sso/callback#token="))
+		require.NoError(t, err)
+		login, err := authClient.ParseSSOLoginToken(token)
+		require.NoError(t, err)
+		return login.AccountID
+	}
+
+	errorType := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		var resp httputils.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Type
+	}
+
+	t.Run("metadata is served before saml is configured", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+unconfigured.ID+"/metadata", nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "application/samlmetadata+xml", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), unconfigured.ID)
+
+		for _, id := range []string{uuid.NewString(), "not-a-uuid"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+id+"/metadata", nil))
+			assert.Equal(t, http.StatusNotFound, w.Code, id)
+		}
+	})
+
+	t.Run("login redirects to the idp and remembers the request", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+org.ID+"/login", nil))
+		require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+		assert.Equal(t, "https://idp.example.com/sso?SAMLRequest=request", w.Header().Get("Location"))
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, requestCookie, cookies[0].Name)
+		assert.Equal(t, "id-request", cookies[0].Value)
+		assert.Equal(t, "/v1/saml/"+org.ID+"/acs", cookies[0].Path)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.True(t, cookies[0].Secure)
+		assert.Equal(t, http.SameSiteNoneMode, cookies[0].SameSite)
+	})
+
+	t.Run("login needs saml configured", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+unconfigured.ID+"/login", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, errTypeSAMLNotConfigured, errorType(t, w))
+	})
+
+	t.Run("first sign in provisions an account in the organization", func(t *testing.T) {
+		w := acs(org.ID, "new-user", "id-request")
+		id := signedIn(t, w)
+
+		account, err := db.GetAccount(ctx, "new@test.com")
+		require.NoError(t, err)
+		assert.Equal(t, account.ID, id)
+		assert.Empty(t, account.PasswordHash)
+		assert.Nil(t, account.VerifiedAt)
+
+		member, err := db.GetOrganizationMember(ctx, org.ID, id)
+		require.NoError(t, err)
+		assert.Equal(t, database.OrganizationRoleMember, member.Role)
+
+		identity, err := db.GetFederatedIdentity(ctx, org.ID, "idp-new")
+		require.NoError(t, err)
+		assert.Equal(t, id, identity.AccountID)
+
+		// the request cookie is cleared
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Negative(t, cookies[0].MaxAge)
+
+		// and the next sign in finds the same account
+		assert.Equal(t, id, signedIn(t, acs(org.ID, "new-user", "id-request")))
+	})
+
+	t.Run("provisioned accounts are cut off from the idp once the email's owner claims them", func(t *testing.T) {
+		id := signedIn(t, acs(org.ID, "squatter", "id-request"))
+
+		// the real owner of the address resets the password on the account provisioned for it
+		_, err := db.ResetPassword(ctx, id, "new-hash")
+		require.NoError(t, err)
+
+		_, err = db.GetFederatedIdentity(ctx, org.ID, "idp-squatter")
+		require.ErrorIs(t, err, database.ErrFederatedIdentityNotFound)
+		_, err = db.GetOrganizationMember(ctx, org.ID, id)
+		require.ErrorIs(t, err, database.ErrNotOrganizationMember)
+
+		w := acs(org.ID, "squatter", "id-request")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, errTypeAccountAlreadyExists, errorType(t, w))
+	})
+
+	t.Run("members' existing accounts are linked", func(t *testing.T) {
+		assert.Equal(t, owner.ID, signedIn(t, acs(org.ID, "owner", "id-request")))
+		_, err := db.GetFederatedIdentity(ctx, org.ID, "idp-owner")
+		require.NoError(t, err)
+	})
+
+	t.Run("other existing accounts aren't taken over", func(t *testing.T) {
+		w := acs(org.ID, "outsider", "id-request")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, errTypeAccountAlreadyExists, errorType(t, w))
+		_, err := db.GetOrganizationMember(ctx, org.ID, outsider.ID)
+		require.ErrorIs(t, err, database.ErrNotOrganizationMember)
+	})
+
+	t.Run("first sign in needs an email", func(t *testing.T) {
+		w := acs(org.ID, "no-email", "id-request")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, errTypeValidationError, errorType(t, w))
+	})
+
+	t.Run("responses need the browser's request", func(t *testing.T) {
+		for _, requestID := range []string{"", "id-other"} {
+			w := acs(org.ID, "owner", requestID)
+			assert.Equal(t, http.StatusBadRequest, w.Code, requestID)
+			assert.Equal(t, errTypeInvalidSAMLResponse, errorType(t, w))
+		}
+	})
+
+	t.Run("frozen accounts can't sign in", func(t *testing.T) {
+		_, err := db.FreezeAccount(ctx, owner.ID)
+		require.NoError(t, err)
+		t.Cleanup(func() { _, _ = db.UnfreezeAccount(ctx, owner.ID, "hash") })
+
+		w := acs(org.ID, "owner", "id-request")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, errTypeAccountFrozen, errorType(t, w))
+	})
+}
@@ -0,0 +1,75 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/scheduler"
+	"github.com/austinwofford/account-management/internal/service/secrets"
+)
+
+// addSecretRefreshJob re-reads the settings that are secret references every
+// SECRETS_REFRESH_SECONDS. A new JWT_SECRET_KEY or JWT_SIGNING_KEY is rotated in; the rest are
+// only read on startup, so a change to them is logged as needing a restart.
+func addSecretRefreshJob(jobs *scheduler.Scheduler, cfg config.Config, authClient *auth.Client) {
+	if cfg.SecretsRefreshSeconds <= 0 || len(cfg.SecretRefs) == 0 {
+		return
+	}
+
+	resolver := secrets.NewResolver(cfg.SecretsConfig())
+	// only the job's goroutine uses it
+	current := cfg.SecretValues()
+	jobs.Add(scheduler.Job{
+		Name:     "refresh secrets",
+		Interval: time.Duration(cfg.SecretsRefreshSeconds) * time.Second,
+		Run: func(ctx context.Context) error {
+			var errs []error
+			for name, ref := range cfg.SecretRefs {
+				secret, err := resolver.Resolve(ctx, ref)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				if secret == current[name] {
+					continue
+				}
+
+				if err := applySecret(ctx, name, secret, authClient); err != nil {
+					errs = append(errs, fmt.Errorf("error rotating %s: %w", name, err))
+					continue
+				}
+				current[name] = secret
+			}
+			return errors.Join(errs...)
+		},
+	})
+}
+
+// applySecret puts a setting's new secret to use, if it can be without a restart
+func applySecret(ctx context.Context, name, secret string, authClient *auth.Client) error {
+	switch name {
+	case "JWT_SECRET_KEY":
+		if err := authClient.RotateSecretKey(secret); err != nil {
+			return err
+		}
+	case "JWT_SIGNING_KEY":
+		keys, err := auth.ParseSigningKeys([]byte(secret))
+		if err != nil {
+			return err
+		}
+		if err := authClient.RotateSigningKeys(keys); err != nil {
+			return err
+		}
+	default:
+		slog.WarnContext(ctx, "secret changed, restart to use it", "setting", name)
+		return nil
+	}
+
+	slog.InfoContext(ctx, "rotated secret", "setting", name)
+	return nil
+}
@@ -0,0 +1,49 @@
+package webserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/scheduler"
+	"github.com/austinwofford/account-management/internal/service/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretRefreshJob(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt-secret-key")
+	require.NoError(t, os.WriteFile(path, []byte("old-secret\n"), 0o600))
+	ref, _ := secrets.ParseReference("file://" + path)
+
+	cfg := config.Config{
+		JWTSecretKey:          "old-secret",
+		AccessTokenTTLMinutes: 15,
+		SecretsRefreshSeconds: 1,
+		SecretRefs:            map[string]secrets.Reference{"JWT_SECRET_KEY": ref},
+	}
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: cfg.JWTSecretKey, AccessTokenTTLMinutes: 15})
+	oldToken, _, err := authClient.NewAccessToken(auth.Claims{AccountID: "account-id"})
+	require.NoError(t, err)
+
+	jobs := scheduler.New()
+	addSecretRefreshJob(jobs, cfg, authClient)
+	require.NoError(t, os.WriteFile(path, []byte("new-secret\n"), 0o600))
+	jobs.Start(context.Background())
+	defer jobs.Stop(context.Background())
+
+	// new tokens are signed with the new secret, the old ones still verify
+	rotated := auth.NewClient(auth.Config{JWTSecretKey: "new-secret", AccessTokenTTLMinutes: 15})
+	assert.Eventually(t, func() bool {
+		token, _, err := authClient.NewAccessToken(auth.Claims{AccountID: "account-id"})
+		require.NoError(t, err)
+		_, err = rotated.ParseAccessToken(token)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = authClient.ParseAccessToken(oldToken)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,138 @@
+package webserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// cipherSuites are the TLS 1.2 suites the server accepts: forward secret AEAD ones only. TLS
+// 1.3 suites aren't configurable and are all fine. HTTP/2 requires the AES-128-GCM ones.
+var cipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// NewCertManager returns the ACME client getting certificates for TLSAutocertDomains, or nil
+// without autocert
+func NewCertManager(cfg config.Config) *autocert.Manager {
+	if len(cfg.TLSAutocertDomains) == 0 {
+		return nil
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertDomains...),
+		Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+		Email:      cfg.TLSAutocertEmail,
+	}
+	if cfg.TLSAutocertDirectoryURL != "" {
+		manager.Client = &acme.Client{DirectoryURL: cfg.TLSAutocertDirectoryURL}
+	}
+	return manager
+}
+
+// NewTLSConfig returns the server's TLS config, or nil if TLS isn't configured. Certificates
+// come from the configured files, or from certs with autocert. With a client CA, certificates
+// are verified when presented but not required so public endpoints keep working; internal
+// routes require one with middleware.RequireClientCert.
+func NewTLSConfig(cfg config.Config, certs *autocert.Manager) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		CipherSuites: cipherSuites,
+	}
+
+	switch {
+	case certs != nil:
+		tlsConfig.GetCertificate = certs.GetCertificate
+		// http.Server adds h2 and http/1.1 for certificate files, the CA's TLS-ALPN-01
+		// challenges need theirs too
+		tlsConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	case cfg.TLSCertFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	default:
+		return nil, nil
+	}
+
+	if cfg.MTLSClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.MTLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("error reading client CA file: no PEM certificates found")
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
+
+// Serve serves srv on ln, over TLS when it has a TLS config. HTTP/2 is negotiated over TLS.
+func Serve(srv *http.Server, ln net.Listener) error {
+	if srv.TLSConfig != nil {
+		// the certificate is already in the TLS config
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
+
+// NewRedirectServer returns the plain HTTP server on HTTPRedirectAddress that redirects to the
+// HTTPS server on HTTPAddress. With certs it answers the CA's HTTP-01 challenges too.
+func NewRedirectServer(cfg config.Config, certs *autocert.Manager) *http.Server {
+	// the default port is left out of the redirects
+	_, port, _ := net.SplitHostPort(cfg.HTTPAddress)
+	if port == "443" {
+		port = ""
+	}
+
+	var h http.Handler = redirectToHTTPS(port)
+	if certs != nil {
+		h = certs.HTTPHandler(h)
+	}
+
+	return &http.Server{
+		Addr:              cfg.HTTPRedirectAddress,
+		Handler:           h,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+}
+
+// redirectToHTTPS permanently redirects requests to the same URL over HTTPS, keeping the
+// method and body
+func redirectToHTTPS(port string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	}
+}
@@ -0,0 +1,167 @@
+package webserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+)
+
+// writeTestCertificate writes a self-signed certificate for localhost and its key to dir
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestTLS(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("not configured", func(t *testing.T) {
+		cfg := config.Config{}
+		assert.Nil(t, NewCertManager(cfg))
+
+		tlsConfig, err := NewTLSConfig(cfg, nil)
+		require.NoError(t, err)
+		assert.Nil(t, tlsConfig)
+	})
+
+	t.Run("certificate files over HTTP/2", func(t *testing.T) {
+		certFile, keyFile := writeTestCertificate(t, t.TempDir())
+		cfg := config.Config{HTTPAddress: "127.0.0.1:0", TLSCertFile: certFile, TLSKeyFile: keyFile}
+
+		tlsConfig, err := NewTLSConfig(cfg, nil)
+		require.NoError(t, err)
+		require.NotNil(t, tlsConfig)
+		assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+		assert.NotContains(t, tlsConfig.CipherSuites, tls.TLS_RSA_WITH_AES_128_GCM_SHA256, "suites without forward secrecy")
+
+		srv := NewHTTPServer(cfg.HTTPAddress, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}))
+		srv.TLSConfig = tlsConfig
+		ln, err := Listen(ctx, cfg)
+		require.NoError(t, err)
+		go Serve(srv, ln)
+		defer srv.Close()
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		}}
+		resp, err := client.Get("https://" + ln.Addr().String())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, 2, resp.ProtoMajor)
+
+		// TLS 1.1 is refused
+		oldClient := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS11},
+		}}
+		_, err = oldClient.Get("https://" + ln.Addr().String())
+		assert.Error(t, err)
+	})
+
+	t.Run("autocert", func(t *testing.T) {
+		cfg := config.Config{
+			TLSAutocertDomains:  []string{"accounts.example.com"},
+			TLSAutocertCacheDir: t.TempDir(),
+		}
+		certs := NewCertManager(cfg)
+		require.NotNil(t, certs)
+
+		tlsConfig, err := NewTLSConfig(cfg, certs)
+		require.NoError(t, err)
+		assert.NotNil(t, tlsConfig.GetCertificate)
+		assert.Contains(t, tlsConfig.NextProtos, acme.ALPNProto)
+		assert.Contains(t, tlsConfig.NextProtos, "h2")
+
+		// other hosts never get a certificate requested
+		_, err = certs.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"})
+		assert.Error(t, err)
+	})
+}
+
+func TestRedirectServer(t *testing.T) {
+	tests := []struct {
+		name             string
+		httpAddress      string
+		target           string
+		expectedLocation string
+	}{
+		{
+			name:             "default port",
+			httpAddress:      ":443",
+			target:           "http://accounts.example.com/v1/accounts/login?next=%2F",
+			expectedLocation: "https://accounts.example.com/v1/accounts/login?next=%2F",
+		},
+		{
+			name:             "other port",
+			httpAddress:      ":8443",
+			target:           "http://accounts.example.com:8080/health",
+			expectedLocation: "https://accounts.example.com:8443/health",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewRedirectServer(config.Config{HTTPAddress: tt.httpAddress, HTTPRedirectAddress: ":80"}, nil)
+			assert.Equal(t, ":80", srv.Addr)
+
+			w := httptest.NewRecorder()
+			srv.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(`{}`)))
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+		})
+	}
+
+	t.Run("ACME challenges aren't redirected", func(t *testing.T) {
+		cfg := config.Config{
+			HTTPAddress:         ":443",
+			HTTPRedirectAddress: ":80",
+			TLSAutocertDomains:  []string{"accounts.example.com"},
+			TLSAutocertCacheDir: t.TempDir(),
+		}
+		srv := NewRedirectServer(cfg, NewCertManager(cfg))
+
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://accounts.example.com/.well-known/acme-challenge/unknown", nil))
+		// no challenge is pending, but the request reached the certificate manager
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,100 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/austinwofford/account-management/internal/service/metrics"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+const errTypeAPIVersionRetired = "api_version_retired"
+
+// apiVersionNumbers are every version of the public API there's been, oldest first. Each one
+// mounts the same handlers over the same service layer, and responses that change shape between
+// versions check httputils.APIVersion. v2 sends errors as RFC 9457 problem details.
+var apiVersionNumbers = []int{1, 2}
+
+// versionedRoutes are mounted under every version. The OAuth and SAML routes are left out, their
+// URLs are fixed by the standards and registered with clients and identity providers, so they
+// stay under /v1.
+var versionedRoutes = []string{"/accounts", "/orgs", "/invitations", "/admin"}
+
+// apiVersion is a version of the public API, served under /v<number>
+type apiVersion struct {
+	number int
+	// deprecation is set once the version is being retired
+	deprecation *middleware.Deprecation
+	// disabled versions were retired, their routes answer 410
+	disabled bool
+}
+
+func (v apiVersion) name() string {
+	return "v" + strconv.Itoa(v.number)
+}
+
+func (v apiVersion) prefix() string {
+	return "/" + v.name()
+}
+
+// router routes the requests to r through the version, with Deprecation and Sunset headers once
+// it's being retired, counted in m
+func (v apiVersion) router(r chi.Router, m *metrics.Metrics) chi.Router {
+	router := r.With(middleware.APIVersion(v.number))
+	if v.deprecation != nil {
+		router = router.With(middleware.Deprecated(*v.deprecation, m))
+	}
+	return router
+}
+
+// retired answers every request to a disabled version
+func (v apiVersion) retired(w http.ResponseWriter, r *http.Request) {
+	httputils.WriteErrorResponse(w, r, httputils.ErrorResponse{
+		Message:    fmt.Sprintf("API %s was retired, use a later version", v.name()),
+		Type:       errTypeAPIVersionRetired,
+		StatusCode: http.StatusGone,
+	})
+}
+
+// newAPIVersions are the versions of the public API with API_VERSIONS_DISABLED and
+// API_VERSION_DEPRECATIONS applied
+func newAPIVersions(cfg config.Config) ([]apiVersion, error) {
+	deprecations, err := cfg.ParseAPIVersionDeprecations()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing API_VERSION_DEPRECATIONS: %w", err)
+	}
+
+	var versions []apiVersion
+	enabled := 0
+	for _, number := range apiVersionNumbers {
+		v := apiVersion{number: number}
+		if d, ok := deprecations[v.name()]; ok {
+			v.deprecation = &middleware.Deprecation{Since: d.Since, Sunset: d.Sunset}
+			delete(deprecations, v.name())
+		}
+		v.disabled = slices.Contains(cfg.APIVersionsDisabled, v.name())
+		if !v.disabled {
+			enabled++
+		}
+		versions = append(versions, v)
+	}
+
+	for name := range deprecations {
+		return nil, fmt.Errorf("API_VERSION_DEPRECATIONS: there's no API version %q", name)
+	}
+	for _, name := range cfg.APIVersionsDisabled {
+		if !slices.ContainsFunc(versions, func(v apiVersion) bool { return v.name() == name }) {
+			return nil, fmt.Errorf("API_VERSIONS_DISABLED: there's no API version %q", name)
+		}
+	}
+	if enabled == 0 {
+		return nil, errors.New("API_VERSIONS_DISABLED can't retire every API version")
+	}
+	return versions, nil
+}
@@ -0,0 +1,113 @@
+package webserver
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIVersions(t *testing.T) {
+	newRouter := func(t *testing.T, cfg config.Config) http.Handler {
+		cfg.DevMode = true
+		cfg.JWTSecretKey = "versions-test-secret"
+		router, err := NewRouter(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+		require.NoError(t, err)
+		return router
+	}
+	request := func(router http.Handler, method, path string) *httptest.ResponseRecorder {
+		var body io.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader(`{}`)
+		}
+		req := httptest.NewRequest(method, path, body)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("every version serves the public API", func(t *testing.T) {
+		router := newRouter(t, config.Config{})
+
+		routes, err := Routes(router)
+		require.NoError(t, err)
+		byRoute := map[string]Route{}
+		for _, route := range routes {
+			byRoute[route.Method+" "+route.Pattern] = route
+		}
+		for _, route := range []string{"POST /v1/accounts/login", "POST /v2/accounts/login", "POST /v2/orgs/", "POST /v2/invitations/accept", "GET /v2/admin/audit"} {
+			assert.Contains(t, byRoute, route)
+		}
+		assert.Contains(t, byRoute, "POST /v1/oauth/token")
+		assert.NotContains(t, byRoute, "POST /v2/oauth/token", "OAuth isn't versioned")
+	})
+
+	t.Run("v2 errors are problem details", func(t *testing.T) {
+		router := newRouter(t, config.Config{})
+
+		w := request(router, http.MethodGet, "/v1/accounts/me")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		w = request(router, http.MethodGet, "/v2/accounts/me")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), `"status":401`)
+	})
+
+	t.Run("deprecated versions say so", func(t *testing.T) {
+		router := newRouter(t, config.Config{
+			APIVersionDeprecations: map[string]string{"v1": "2026-10-01/2027-04-01"},
+		})
+
+		w := request(router, http.MethodGet, "/v1/accounts/me")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "@1790812800", w.Header().Get("Deprecation"))
+		assert.Equal(t, "Thu, 01 Apr 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+
+		w = request(router, http.MethodGet, "/v2/accounts/me")
+		assert.Empty(t, w.Header().Get("Deprecation"))
+	})
+
+	t.Run("disabled versions are gone", func(t *testing.T) {
+		router := newRouter(t, config.Config{APIVersionsDisabled: []string{"v1"}})
+
+		for _, path := range []string{"/v1/accounts", "/v1/accounts/login", "/v1/orgs/1/members", "/v1/admin/accounts"} {
+			w := request(router, http.MethodPost, path)
+			assert.Equal(t, http.StatusGone, w.Code, path)
+			assert.Contains(t, w.Body.String(), errTypeAPIVersionRetired, path)
+		}
+
+		w := request(router, http.MethodGet, "/v2/accounts/me")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		// the OAuth routes stay under /v1
+		w = request(router, http.MethodPost, "/v1/oauth/token")
+		assert.NotEqual(t, http.StatusGone, w.Code)
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		tests := map[string]config.Config{
+			"unknown disabled version":   {APIVersionsDisabled: []string{"v9"}},
+			"unknown deprecated version": {APIVersionDeprecations: map[string]string{"v9": "2026-10-01"}},
+			"every version disabled":     {APIVersionsDisabled: []string{"v1", "v2"}},
+			"invalid deprecation":        {APIVersionDeprecations: map[string]string{"v1": "soon"}},
+		}
+		for name, cfg := range tests {
+			t.Run(name, func(t *testing.T) {
+				cfg.DevMode = true
+				cfg.JWTSecretKey = "versions-test-secret"
+				_, err := NewRouter(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, nil)
+				assert.Error(t, err)
+			})
+		}
+	})
+}
@@ -2,17 +2,54 @@ package webserver
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/austinwofford/account-management/docs"
 	"github.com/austinwofford/account-management/internal/config"
 	"github.com/austinwofford/account-management/internal/database"
+	"github.com/austinwofford/account-management/internal/database/cache"
+	"github.com/austinwofford/account-management/internal/fixtures"
+	"github.com/austinwofford/account-management/internal/service/accountpurge"
+	"github.com/austinwofford/account-management/internal/service/antiabuse"
+	"github.com/austinwofford/account-management/internal/service/apple"
+	"github.com/austinwofford/account-management/internal/service/audit"
 	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/service/degraded"
+	"github.com/austinwofford/account-management/internal/service/erasure"
+	"github.com/austinwofford/account-management/internal/service/featureflags"
+	"github.com/austinwofford/account-management/internal/service/geoip"
+	"github.com/austinwofford/account-management/internal/service/hibp"
+	"github.com/austinwofford/account-management/internal/service/idempotency"
+	"github.com/austinwofford/account-management/internal/service/ipfilter"
+	"github.com/austinwofford/account-management/internal/service/lockout"
+	"github.com/austinwofford/account-management/internal/service/mailer"
+	"github.com/austinwofford/account-management/internal/service/metrics"
+	"github.com/austinwofford/account-management/internal/service/outbox"
+	"github.com/austinwofford/account-management/internal/service/ratelimit"
+	"github.com/austinwofford/account-management/internal/service/revocation"
+	"github.com/austinwofford/account-management/internal/service/saml"
+	"github.com/austinwofford/account-management/internal/service/scheduler"
+	"github.com/austinwofford/account-management/internal/service/sms"
+	"github.com/austinwofford/account-management/internal/service/webhooks"
 	"github.com/austinwofford/account-management/internal/webserver/accounts"
-	"github.com/go-chi/chi/middleware"
+	"github.com/austinwofford/account-management/internal/webserver/admin"
+	"github.com/austinwofford/account-management/internal/webserver/debugcapture"
+	"github.com/austinwofford/account-management/internal/webserver/internalapi"
+	"github.com/austinwofford/account-management/internal/webserver/middleware"
+	"github.com/austinwofford/account-management/internal/webserver/oauth"
+	"github.com/austinwofford/account-management/internal/webserver/orgs"
+	samlhandlers "github.com/austinwofford/account-management/internal/webserver/saml"
+	chimiddleware "github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
 )
 
 func NewHTTPServer(addr string, h http.Handler) *http.Server {
@@ -26,42 +63,859 @@ func NewHTTPServer(addr string, h http.Handler) *http.Server {
 	}
 }
 
-func NewRouter(cfg config.Config, logger *slog.Logger) (http.Handler, error) {
+// NewRouter builds the service's routes. The background cleanup and secret refresh jobs are added
+// to jobs for the caller to start and stop with the server; nil doesn't schedule them. reloads is
+// given what a config reload changes, nil leaves the settings as they are until a restart. The
+// gRPC versions of the internal routes are registered on grpcServer, nil doesn't serve them.
+func NewRouter(cfg config.Config, logger *slog.Logger, jobs *scheduler.Scheduler, reloads *Reloader, grpcServer *grpc.Server) (http.Handler, error) {
 	r := chi.NewRouter()
 
-	r.Use(middleware.RequestID)
+	trustedProxies, err := ipfilter.ParsePrefixes(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing TRUSTED_PROXIES: %w", err)
+	}
+
+	r.Use(chimiddleware.RequestID)
+	// before anything that looks at the client's address
+	r.Use(middleware.ClientIP(trustedProxies))
+	r.Use(middleware.RequestLog)
+	// before the request log so it has the trace ID
+	r.Use(middleware.Tracing())
 	r.Use(slogMiddleware())
+	r.Use(localeMiddleware())
 	//TODO: Maybe use chi's logging middleware instead of mine?
-	//r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	//r.Use(chimiddleware.Logger)
+	r.Use(chimiddleware.Recoverer)
+
+	// JSON errors instead of chi's plain text, mount passes them on to the mounted routers
+	r.NotFound(notFound)
+	r.MethodNotAllowed(methodNotAllowed(r))
+
+	// every router gets its own registry so tests can build as many as they like. A nil
+	// *metrics.Metrics records nothing.
+	var appMetrics *metrics.Metrics
+	if cfg.MetricsEnabled {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+		appMetrics = metrics.New(registry)
+		r.Use(middleware.Metrics(appMetrics))
+	}
+
+	// captures have to be set up before any routes are added
+	var captures *debugcapture.Buffer
+	if cfg.DebugEnabled && cfg.DebugCaptureSize > 0 {
+		captures = debugcapture.NewBuffer(cfg.DebugCaptureSize)
+		r.Use(debugcapture.Middleware(captures))
+	}
 
 	ctx := context.Background()
 
-	db, err := database.NewDB(cfg.PostgresURL)
+	versions, err := newAPIVersions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := newStorage(cfg, appMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	redisClient, err := newRedisClient(cfg)
 	if err != nil {
 		return nil, err
 	}
+	// readiness checks the database itself rather than through the cache
+	storage := db
+	db = newCache(cfg, db, redisClient, appMetrics)
 
-	// healthcheck
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		err := db.HealthCheck(ctx)
+	// signed refresh tokens aren't stored so there's nothing to count
+	if appMetrics != nil && !cfg.SignedRefreshTokens {
+		appMetrics.RegisterActiveRefreshTokens(db.CountActiveRefreshTokens)
+	}
+
+	// keep serving what doesn't need the primary database while it's down. The in-memory
+	// database can't go down.
+	var outages *degraded.Monitor
+	if !inMemory(cfg) && cfg.DBHealthCheckIntervalSeconds > 0 {
+		outageCfg := degraded.DefaultConfig()
+		outageCfg.Interval = time.Duration(cfg.DBHealthCheckIntervalSeconds) * time.Second
+		outageCfg.FailureThreshold = cfg.DBHealthCheckFailures
+		outages = degraded.NewMonitor(db.HealthCheck, outageCfg)
+		go outages.Run(ctx)
+
+		// these POSTs only read, or don't touch the database with signed refresh tokens
+		allowed := []string{"/internal/accounts/lookup"}
+		if cfg.SignedRefreshTokens {
+			for _, version := range versions {
+				allowed = append(allowed, version.prefix()+"/accounts/refresh", version.prefix()+"/accounts/logout")
+			}
+		}
+		r.Use(middleware.RejectWritesWhenDegraded(outages, outages.RetryAfter(), allowed...))
+	}
+
+	if cfg.DeletedAccountRetentionDays > 0 {
+		purgeCfg := accountpurge.DefaultConfig()
+		purgeCfg.Retention = time.Duration(cfg.DeletedAccountRetentionDays) * 24 * time.Hour
+		go accountpurge.NewSweeper(db.PurgeDeletedAccounts, purgeCfg).Run(ctx)
+	}
+
+	if jobs != nil {
+		addCleanupJobs(jobs, cfg, db, appMetrics)
+	}
+
+	// the database writes account and session events to the outbox, the relay publishes them
+	outboxPublisher, err := newOutboxPublisher(cfg)
+	if err != nil {
+		return nil, err
+	}
+	outboxCfg := outbox.DefaultConfig()
+	outboxCfg.Retention = time.Duration(cfg.OutboxRetentionHours) * time.Hour
+	go outbox.NewRelay(db, outboxPublisher, outboxCfg).Run(ctx)
+
+	// webhook events are queued with the audit events they come from
+	createAuditEvent := audit.CreateFunc(db.CreateAuditEvent)
+	if cfg.WebhooksEnabled {
+		createAuditEvent = webhooks.NewPublisher(db.CreateWebhookDeliveries).FromAuditEvents(createAuditEvent)
+		go webhooks.NewWorker(db, webhooks.DefaultConfig()).Run(ctx)
+	}
+
+	// audit events are written in the background so they don't slow down logins
+	var auditLog audit.Recorder = audit.Sync(createAuditEvent)
+	if cfg.AuditLogBufferSize > 0 {
+		writer := audit.NewWriter(createAuditEvent, audit.Config{BufferSize: cfg.AuditLogBufferSize})
+		go writer.Run(ctx)
+		auditLog = writer
+	}
+
+	if cfg.MockMode {
+		if err := loadMockAccounts(ctx, db, cfg.MockAccounts); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.FixturesPath != "" {
+		scenario, err := fixtures.LoadFile(cfg.FixturesPath)
+		if err != nil {
+			return nil, err
+		}
+		result, err := fixtures.Load(ctx, db, *scenario)
+		if err != nil {
+			return nil, fmt.Errorf("error loading fixtures: %w", err)
+		}
+		logger.InfoContext(ctx, "loaded fixtures", "path", cfg.FixturesPath, "accounts", len(result.AccountIDs),
+			"organizations", len(result.OrganizationIDs))
+	}
+
+	// the IP filter has to be in front of every route, so it's added before the first one
+	ipFilter, adminIPFilter, err := newIPFilters(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if ipFilter != nil {
+		r.Use(middleware.IPFilter(ipFilter, auditLog))
+	}
+
+	mail := newMailer(ctx, cfg, logger)
+
+	// accounts that asked to be erased are reminded, then erased once the grace period is over
+	erasureCfg := erasure.DefaultConfig()
+	erasureCfg.ReminderBefore = time.Duration(cfg.DeletionReminderDays) * 24 * time.Hour
+	erasureCfg.AppURL = cfg.AppURL
+	go erasure.NewWorker(db, mail, auditLog, erasureCfg).Run(ctx)
+
+	var encryptionKey []byte
+	if cfg.JWTEncryptionKey != "" {
+		encryptionKey, err = auth.DecodeEncryptionKey(cfg.JWTEncryptionKey)
 		if err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
+			return nil, fmt.Errorf("error parsing JWT_ENCRYPTION_KEY: %w", err)
 		}
-		w.WriteHeader(http.StatusOK)
+	}
+
+	signingKeys, err := newKeyRing(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	appleClient, err := newAppleClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutStore := newLockoutStore(redisClient)
+	lockoutCfg := lockout.DefaultConfig()
+	lockoutCfg.MaxAttempts = cfg.LockoutMaxAttempts
+	lockoutCfg.LockoutDuration = time.Duration(cfg.LockoutDurationMinutes) * time.Minute
+
+	flags := featureflags.NewEvaluator(featureflags.Config{
+		Defaults:   cfg.FeatureFlagDefaults,
+		TokenFlags: cfg.TokenFeatureFlags,
 	})
 
-	// docs
+	// healthcheck, a typed nil monitor would still count as outage detection being on
+	if outages != nil {
+		r.Get("/health", healthCheck(db.HealthCheck, outages))
+	} else {
+		r.Get("/health", healthCheck(db.HealthCheck, nil))
+	}
+	r.Get("/healthz", liveness)
+	r.Get("/readyz", readiness(dependencies(storage, mail)...))
+
+	// lets password managers deep link to the change password page
+	r.Get("/.well-known/change-password", changePasswordRedirect(cfg.ChangePasswordURL))
+
+	// docs, Swagger UI at /docs/, Redoc at /docs/api/, and the config file schema at
+	// /docs/config.schema.json
+	r.Get("/docs", http.RedirectHandler("/docs/", http.StatusMovedPermanently).ServeHTTP)
+	r.Get("/docs/openapi.json", openAPIJSON)
 	r.Handle("/docs/*", http.StripPrefix("/docs/", docs.Handler))
 
-	r.Mount("/v1/accounts", accounts.NewHandler(accounts.HandlerDeps{
-		DB: db,
-		AuthClient: auth.NewClient(auth.Config{
-			JWTSecretKey:           cfg.JWTSecretKey,
-			AccessTokenTTLMinutes:  cfg.AccessTokenTTLMinutes,
-			RefreshTokenTTLMinutes: cfg.RefreshTokenTTLMinutes,
-		}),
+	if appMetrics != nil {
+		r.Handle("/metrics", appMetrics.Handler())
+	}
+
+	authClient := auth.NewClient(auth.Config{
+		JWTSecretKey:           cfg.JWTSecretKey,
+		AccessTokenTTLMinutes:  cfg.AccessTokenTTLMinutes,
+		RefreshTokenTTLMinutes: cfg.RefreshTokenTTLMinutes,
+		Deterministic:          cfg.MockMode,
+		EncryptionKey:          encryptionKey,
+		SigningKeys:            signingKeys,
+	})
+
+	if jobs != nil {
+		addSecretRefreshJob(jobs, cfg, authClient)
+	}
+
+	// public keys for other services to verify tokens with
+	r.Get("/.well-known/jwks.json", jwks(authClient))
+
+	// lets OpenID Connect client libraries configure themselves from the issuer URL
+	r.Get("/.well-known/openid-configuration", openIDConfiguration(cfg.OIDCIssuer, cfg.OIDCAuthorizationURL, authClient))
+
+	// shared by the accounts handler revoking tokens and introspection checking them
+	revocations := revocation.NewList(lockoutStore, authClient.RefreshTokenTTL())
+	accessTokenRevocations := revocation.NewAccessTokens(db)
+
+	// a nil hasher hashes with auth.DefaultHasherConfig, for configs that weren't loaded
+	var passwords *auth.PasswordHasher
+	if cfg.PasswordHashAlgorithm != "" {
+		passwords, err = auth.NewPasswordHasher(cfg.PasswordHasherConfig())
+		if err != nil {
+			return nil, fmt.Errorf("error configuring password hashing: %w", err)
+		}
+	}
+
+	passwordPolicy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := accounts.HandlerDeps{
+		DB:                       db,
+		Mailer:                   mail,
+		AuthClient:               authClient,
+		Lockout:                  lockout.NewGuard(lockoutStore, lockoutCfg),
+		AcceptAnyPassword:        cfg.MockMode,
+		RequireEmailVerification: cfg.RequireEmailVerification,
+		NewSignInAlerts:          cfg.NewSignInAlerts,
+		LocationHeader:           cfg.LocationHeader,
+		TrustedDeviceTTL:         time.Duration(cfg.TrustedDeviceDays) * 24 * time.Hour,
+		DeletionGracePeriod:      time.Duration(cfg.DeletionGracePeriodDays) * 24 * time.Hour,
+		BindTokensToClientCert:   cfg.MTLSBindTokens,
+		RefreshTokenRotation:     cfg.RefreshTokenRotation,
+		RefreshTokenGracePeriod:  time.Duration(cfg.RefreshTokenGraceSeconds) * time.Second,
+		SignedRefreshTokens:      cfg.SignedRefreshTokens,
+		Revocations:              revocations,
+		AccessTokenRevocations:   accessTokenRevocations,
+		AppURL:                   cfg.AppURL,
+		FeatureFlags:             flags,
+		TokenAppMetadataKeys:     cfg.TokenAppMetadataKeys,
+		TOTPIssuer:               cfg.TOTPIssuer,
+		Passwords:                passwords,
+		PasswordPolicy:           passwordPolicy,
+		Metrics:                  appMetrics,
+		AuditLog:                 auditLog,
+
+		EmailAvailabilityLimiter:        accounts.NewEmailAvailabilityLimiter(lockoutStore, cfg.EmailAvailabilityLimit),
+		EmailAvailabilityRequireCaptcha: cfg.EmailAvailabilityRequireCaptcha,
+		PasswordResetLimiter:            accounts.NewPasswordResetLimiter(lockoutStore, cfg.PasswordResetLimit),
+	}
+
+	// a nil *apple.Client in the interface would still count as configured
+	if appleClient != nil {
+		deps.Apple = appleClient
+	}
+	// a config that wasn't loaded leaves the check empty, which is off too
+	if cfg.BreachedPasswordCheck != "" && cfg.BreachedPasswordCheck != config.BreachedPasswordCheckOff {
+		deps.BreachedPasswords = hibp.NewClient(hibp.Config{
+			RangeURL: cfg.HIBPRangeURL,
+			Timeout:  time.Duration(cfg.HIBPTimeoutMillis) * time.Millisecond,
+		})
+		deps.EnforceBreachedPasswords = cfg.BreachedPasswordCheck == config.BreachedPasswordCheckEnforce
+	}
+	deps.SSOLogin = cfg.SAMLBaseURL != ""
+	var csrf *middleware.CSRF
+	if cfg.SessionCookies {
+		csrf = middleware.NewCSRF(middleware.CSRFConfig{
+			SessionCookie: accounts.RefreshTokenCookie,
+			Domain:        cfg.SessionCookieDomain,
+			Secure:        cfg.SessionCookieSecure,
+			SameSite:      sameSite(cfg.SessionCookieSameSite),
+			TTL:           authClient.RefreshTokenTTL(),
+		})
+		deps.SessionCookies = &accounts.SessionCookieConfig{
+			Domain: cfg.SessionCookieDomain,
+			// refresh and logout are the only routes that read the refresh token, each version
+			// sets its own below
+			Path:     "/v1/accounts",
+			Secure:   cfg.SessionCookieSecure,
+			SameSite: sameSite(cfg.SessionCookieSameSite),
+			CSRF:     csrf,
+		}
+	}
+	if sender := newSMSSender(cfg, logger); sender != nil {
+		deps.SMS = &accounts.SMSConfig{
+			Sender:         sender,
+			CodeLength:     cfg.SMSCodeLength,
+			TTL:            time.Duration(cfg.SMSCodeTTLSeconds) * time.Second,
+			ResendInterval: time.Duration(cfg.SMSResendSeconds) * time.Second,
+		}
+	}
+	if cfg.MagicLinkLogin {
+		deps.MagicLinks = &accounts.MagicLinkConfig{
+			TTL:     time.Duration(cfg.MagicLinkTTLMinutes) * time.Minute,
+			Limiter: accounts.NewMagicLinkLimiter(lockoutStore, cfg.MagicLinkLimit),
+		}
+	}
+	if cfg.CaptchaSecret != "" {
+		provider, err := antiabuse.NewProvider(antiabuse.ProviderConfig{
+			Name:      cfg.CaptchaProvider,
+			Secret:    cfg.CaptchaSecret,
+			VerifyURL: cfg.CaptchaVerifyURL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating captcha provider: %w", err)
+		}
+		deps.Captcha = provider
+		deps.CaptchaGate = antiabuse.NewCaptchaGate(antiabuse.CaptchaGateConfig{
+			Provider:      provider,
+			SiteKey:       cfg.CaptchaSiteKey,
+			LoginFailures: cfg.CaptchaLoginFailures,
+			Store:         lockoutStore,
+		})
+	}
+
+	// only the public API is rate limited, internal callers are authenticated services
+	var rateLimits *ratelimit.RuleSet
+	var rateLimitStore ratelimit.Store
+	if cfg.RateLimitEnabled {
+		rules, err := ratelimit.ParseRules(cfg.RateLimits)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing RATE_LIMITS: %w", err)
+		}
+		rateLimits = ratelimit.NewRuleSet(rules)
+		rateLimitStore = newRateLimitStore(redisClient)
+	}
+	rateLimited := func(router chi.Router) chi.Router {
+		if rateLimits == nil {
+			return router
+		}
+		return router.With(middleware.RateLimit(rateLimitStore, authClient, rateLimits))
+	}
+	if reloads != nil {
+		reloads.attach(authClient, rateLimits, passwordPolicy, auditLog)
+	}
+	var idempotencyStore idempotency.Store
+	if cfg.IdempotencyWindowMinutes > 0 {
+		idempotencyStore = newIdempotencyStore(redisClient)
+	}
+
+	orgsDeps := orgs.HandlerDeps{
+		DB:                     db,
+		AuthClient:             authClient,
+		Mailer:                 mail,
+		AppURL:                 cfg.AppURL,
+		AccessTokenRevocations: accessTokenRevocations,
+		AuditLog:               auditLog,
+		Passwords:              passwords,
+		PasswordPolicy:         passwordPolicy,
+	}
+	if cfg.SAMLBaseURL != "" {
+		samlClient := saml.NewClient(saml.Config{BaseURL: cfg.SAMLBaseURL})
+		orgsDeps.SAML = samlClient
+		// SAML responses are forms posted cross-site by the identity provider, so they're left
+		// out of the JSON and CSRF checks. Identity providers are configured with these URLs, so
+		// they aren't versioned.
+		mount(r, rateLimited(r), "/v1/saml", samlhandlers.NewHandler(samlhandlers.HandlerDeps{
+			DB:              db,
+			ServiceProvider: samlClient,
+			AuthClient:      authClient,
+			AppURL:          cfg.AppURL,
+			AuditLog:        auditLog,
+			SecureCookies:   strings.HasPrefix(cfg.SAMLBaseURL, "https://"),
+		}))
+	}
+	adminDeps := admin.HandlerDeps{
+		DB:                     db,
+		AuthClient:             authClient,
+		AccessTokenRevocations: accessTokenRevocations,
+		AuditLog:               auditLog,
+	}
+	if reloads != nil {
+		adminDeps.LogLevel = reloads.logLevel
+	}
+
+	// every version of the public API gets its own handlers over the same dependencies
+	for _, version := range versions {
+		if version.disabled {
+			for _, route := range versionedRoutes {
+				r.Handle(version.prefix()+route, http.HandlerFunc(version.retired))
+				r.Handle(version.prefix()+route+"/*", http.HandlerFunc(version.retired))
+			}
+			continue
+		}
+
+		// the public API takes JSON, and in cookie mode state-changing requests have to prove
+		// they came from the web app
+		protectedRouter := rateLimited(version.router(r, appMetrics)).With(middleware.RequireJSON)
+		if csrf != nil {
+			protectedRouter = protectedRouter.With(csrf.Protect)
+		}
+		// retries of requests the checks above let through get the first response
+		if idempotencyStore != nil {
+			window := time.Duration(cfg.IdempotencyWindowMinutes) * time.Minute
+			protectedRouter = protectedRouter.With(middleware.Idempotency(idempotencyStore, window))
+		}
+
+		versionDeps := deps
+		if deps.SessionCookies != nil {
+			// each version's refresh token cookie is only sent to its own routes
+			cookies := *deps.SessionCookies
+			cookies.Path = version.prefix() + "/accounts"
+			versionDeps.SessionCookies = &cookies
+		}
+		mount(r, protectedRouter, version.prefix()+"/accounts", accounts.NewHandler(versionDeps))
+		mount(r, protectedRouter, version.prefix()+"/orgs", orgs.NewHandler(orgsDeps))
+		mount(r, protectedRouter, version.prefix()+"/invitations", orgs.NewInvitationHandler(orgsDeps))
+		adminRouter := protectedRouter
+		if adminIPFilter != nil {
+			adminRouter = adminRouter.With(middleware.IPFilter(adminIPFilter, auditLog))
+		}
+		mount(r, adminRouter, version.prefix()+"/admin", admin.NewHandler(adminDeps))
+	}
+
+	// backend-to-backend routes, only for services that sign their requests or have a known
+	// client certificate. The lockout store doubles as the replay cache.
+	hmacKeys := map[string][]byte{}
+	for keyID, secret := range cfg.InternalHMACKeys {
+		hmacKeys[keyID] = []byte(secret)
+	}
+	serviceAuth := middleware.RequireServiceAuth(
+		middleware.RequireHMAC(hmacKeys, lockoutStore),
+		middleware.RequireClientCert(cfg.MTLSClientIdentities),
+	)
+	internalDeps := internalapi.HandlerDeps{
+		DB:           db,
+		Auth:         serviceAuth,
+		FeatureFlags: flags,
+		AuditLog:     auditLog,
+	}
+	if signingKeys != nil {
+		internalDeps.SigningKeys = signingKeys
+		internalDeps.ReloadSigningKeys = func() error {
+			keys, err := loadSigningKeys(cfg)
+			if err != nil {
+				return err
+			}
+			return authClient.RotateSigningKeys(keys)
+		}
+	}
+	if reloads != nil {
+		internalDeps.ReloadConfig = reloads.reloadConfig
+	}
+	mount(r, r.With(middleware.RequireJSON), "/internal", internalapi.NewHandler(internalDeps))
+	if grpcServer != nil {
+		internalapi.RegisterGRPC(grpcServer, db)
+	}
+
+	// token introspection (RFC 7662) for services that can't verify tokens themselves, and the
+	// OAuth 2.0 and OpenID Connect provider for registered clients
+	mount(r, r, "/v1/oauth", oauth.NewHandler(oauth.HandlerDeps{
+		DB:          db,
+		AuthClient:  authClient,
+		Auth:        serviceAuth,
+		Revocations: revocations,
+
+		AccessTokenRevocations: accessTokenRevocations,
+		Issuer:                 cfg.OIDCIssuer,
+		TokenExchangeTTL:       time.Duration(cfg.TokenExchangeTTLMinutes) * time.Minute,
 	}))
 
+	// operator tooling, also limited to internal services
+	if cfg.DebugEnabled {
+		r.With(serviceAuth).Get("/debug/routes", routeCatalog(r))
+		if captures != nil {
+			r.With(serviceAuth).Get("/debug/captures", debugcapture.Handler(captures))
+		}
+	}
+
 	return r, nil
 }
+
+// sameSite maps SESSION_COOKIE_SAME_SITE to the cookie attribute, strict unless it says
+// otherwise
+func sameSite(mode string) http.SameSite {
+	switch mode {
+	case config.SameSiteLax:
+		return http.SameSiteLaxMode
+	case config.SameSiteNone:
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+// inMemory reports whether data is kept in memory instead of a database
+func inMemory(cfg config.Config) bool {
+	return cfg.DevMode || cfg.Storage == config.StorageMemory
+}
+
+// OpenStorage opens the database the server stores its data in, for the admin subcommands to
+// work on. It migrates it first with AUTO_MIGRATE like the server would.
+func OpenStorage(cfg config.Config) (database.Repository, error) {
+	return newStorage(cfg, nil)
+}
+
+// newStorage connects to Postgres, opens the SQLite file with DB_DRIVER=sqlite, or returns an
+// in-memory database with STORAGE=memory or in dev mode. Postgres queries are timed when m isn't
+// nil.
+func newStorage(cfg config.Config, m *metrics.Metrics) (database.Repository, error) {
+	if cfg.MockMode {
+		// stable IDs so mock accounts are the same across restarts
+		return database.NewMemoryDBWithConfig(database.MemoryDBConfig{
+			AccountID: auth.MockAccountID,
+		}), nil
+	}
+	if inMemory(cfg) {
+		return database.NewMemoryDB(), nil
+	}
+	if cfg.DBDriver == config.DBDriverSQLite {
+		// the schema is applied when the file is opened, there's nothing to migrate
+		return database.NewSQLiteDB(cfg.SQLitePath)
+	}
+	dbCfg := database.DBConfig{URL: cfg.PostgresURL}
+	// configs that weren't loaded get the default
+	if cfg.DBMaxAttempts > 0 {
+		retry := database.DefaultRetryConfig()
+		retry.MaxAttempts = cfg.DBMaxAttempts
+		dbCfg.Retry = &retry
+	}
+	if cfg.PostgresReplicaURL != "" {
+		dbCfg.ReplicaURL = cfg.PostgresReplicaURL
+		dbCfg.OnReplicaFallback = m.ReplicaFallback
+	}
+	if m != nil {
+		dbCfg.Tracer = metrics.NewQueryTracer(m, metrics.TargetPrimary)
+		dbCfg.ReplicaTracer = metrics.NewQueryTracer(m, metrics.TargetReplica)
+	}
+	db, err := database.NewDBWithConfig(dbCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.AutoMigrate {
+		applied, err := db.Migrate(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("error migrating database: %w", err)
+		}
+		slog.Info("migrated database", "applied", applied)
+	}
+	return db, nil
+}
+
+// newKeyRing returns nil when tokens are signed with JWT_SECRET_KEY
+func newKeyRing(cfg config.Config) (*auth.KeyRing, error) {
+	keys, err := loadSigningKeys(cfg)
+	if err != nil || keys == nil {
+		return nil, err
+	}
+	return auth.NewKeyRing(keys)
+}
+
+// loadSigningKeys reads the signing keys from JWT_SIGNING_KEY_FILE, or JWT_SIGNING_KEY. It's
+// called again to reload them, so only the file can change without a restart.
+func loadSigningKeys(cfg config.Config) ([]*auth.SigningKey, error) {
+	keyPEM := []byte(cfg.JWTSigningKey)
+	if cfg.JWTSigningKeyFile != "" {
+		var err error
+		keyPEM, err = os.ReadFile(cfg.JWTSigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading JWT_SIGNING_KEY_FILE: %w", err)
+		}
+	}
+	if len(keyPEM) == 0 {
+		return nil, nil
+	}
+
+	return auth.ParseSigningKeys(keyPEM)
+}
+
+// dependencies returns what /readyz checks: the database, that it's migrated when it's
+// Postgres, and the mail provider when it can be checked
+func dependencies(db database.Repository, mail mailer.Sender) []dependency {
+	deps := []dependency{{name: "database", check: db.HealthCheck}}
+	if migrated, ok := db.(migrationChecker); ok {
+		deps = append(deps, dependency{name: "migrations", check: migrated.CheckMigrations})
+	}
+	if checker, ok := mail.(mailer.Checker); ok {
+		deps = append(deps, dependency{name: "mailer", check: checker.Check})
+	}
+	return deps
+}
+
+// newMailer returns the configured mail provider, sending in the background when
+// MAIL_QUEUE_SIZE is set. Dev mode only logs emails.
+func newMailer(ctx context.Context, cfg config.Config, logger *slog.Logger) mailer.Sender {
+	var sender mailer.Sender
+	switch {
+	case cfg.DevMode || cfg.MailProvider == config.MailProviderLog:
+		sender = mailer.NewLogSender(logger)
+	case cfg.MailProvider == config.MailProviderSMTP:
+		sender = mailer.NewSMTPSender(mailer.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+	case cfg.MailProvider == config.MailProviderSendGrid:
+		sender = mailer.NewSendGridSender(mailer.SendGridConfig{
+			APIKey: cfg.SendGridAPIKey,
+			From:   cfg.MailFrom,
+		})
+	default:
+		// a config that wasn't loaded
+		sender = mailer.NewLogSender(logger)
+	}
+
+	if cfg.MailQueueSize == 0 {
+		return sender
+	}
+	queueCfg := mailer.DefaultQueueConfig()
+	queueCfg.Size = cfg.MailQueueSize
+	queueCfg.MaxAttempts = cfg.MailMaxAttempts
+	queue := mailer.NewQueue(sender, queueCfg)
+	go queue.Run(ctx)
+	return queue
+}
+
+// newSMSSender returns the configured SMS provider, or nil when SMS_PROVIDER is empty. Dev mode
+// only logs codes.
+func newSMSSender(cfg config.Config, logger *slog.Logger) sms.Sender {
+	switch {
+	case cfg.SMSProvider == "":
+		return nil
+	case cfg.DevMode || cfg.SMSProvider == config.SMSProviderLog:
+		return sms.NewLogSender(logger)
+	case cfg.SMSProvider == config.SMSProviderTwilio:
+		return sms.NewTwilioSender(sms.TwilioConfig{
+			AccountSID: cfg.TwilioAccountSID,
+			AuthToken:  cfg.TwilioAuthToken,
+			From:       cfg.TwilioFrom,
+		})
+	default:
+		// a config that wasn't loaded
+		return nil
+	}
+}
+
+// newPasswordPolicy returns nil, the default policy, for configs that weren't loaded
+func newPasswordPolicy(cfg config.Config) (*auth.PasswordPolicy, error) {
+	if cfg.PasswordMaxLength == 0 {
+		return nil, nil
+	}
+
+	policyCfg, err := passwordPolicyConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := auth.NewPasswordPolicy(policyCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring the password policy: %w", err)
+	}
+	return policy, nil
+}
+
+// passwordPolicyConfig is the password policy with the banned passwords read from
+// PASSWORD_BANNED_LIST_FILE
+func passwordPolicyConfig(cfg config.Config) (auth.PasswordPolicyConfig, error) {
+	policyCfg := cfg.PasswordPolicyConfig()
+	if cfg.PasswordBannedListFile != "" {
+		list, err := os.ReadFile(cfg.PasswordBannedListFile)
+		if err != nil {
+			return auth.PasswordPolicyConfig{}, fmt.Errorf("error reading PASSWORD_BANNED_LIST_FILE: %w", err)
+		}
+		for _, line := range strings.Split(string(list), "\n") {
+			if password := strings.TrimSpace(line); password != "" {
+				policyCfg.BannedPasswords = append(policyCfg.BannedPasswords, password)
+			}
+		}
+	}
+	return policyCfg, nil
+}
+
+// newIPFilters returns the filters for every route and for the admin API, each nil when it has
+// no rules
+func newIPFilters(cfg config.Config) (global, admin *ipfilter.Filter, err error) {
+	var countries ipfilter.CountryLookup
+	if cfg.GeoIPDBFile != "" {
+		reader, err := geoip.Open(cfg.GeoIPDBFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error loading GEOIP_DB_FILE: %w", err)
+		}
+		countries = reader
+	}
+
+	newFilter := func(allow, deny, allowCountries, denyCountries []string) (*ipfilter.Filter, error) {
+		if len(allow)+len(deny)+len(allowCountries)+len(denyCountries) == 0 {
+			return nil, nil
+		}
+		allowPrefixes, err := ipfilter.ParsePrefixes(allow)
+		if err != nil {
+			return nil, err
+		}
+		denyPrefixes, err := ipfilter.ParsePrefixes(deny)
+		if err != nil {
+			return nil, err
+		}
+		return ipfilter.New(ipfilter.Config{
+			Allow:          allowPrefixes,
+			Deny:           denyPrefixes,
+			AllowCountries: allowCountries,
+			DenyCountries:  denyCountries,
+			Countries:      countries,
+		})
+	}
+
+	global, err = newFilter(cfg.IPAllowlist, cfg.IPDenylist, cfg.CountryAllowlist, cfg.CountryDenylist)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring the IP filter: %w", err)
+	}
+	admin, err = newFilter(cfg.AdminIPAllowlist, cfg.AdminIPDenylist, cfg.AdminCountryAllowlist, cfg.AdminCountryDenylist)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring the admin IP filter: %w", err)
+	}
+	return global, admin, nil
+}
+
+// newAppleClient returns nil when Sign in with Apple isn't configured
+func newAppleClient(cfg config.Config) (*apple.Client, error) {
+	if cfg.AppleClientID == "" {
+		return nil, nil
+	}
+
+	keyPEM, err := os.ReadFile(cfg.ApplePrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading APPLE_PRIVATE_KEY_FILE: %w", err)
+	}
+	key, err := apple.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return apple.NewClient(apple.Config{
+		TeamID:      cfg.AppleTeamID,
+		ClientID:    cfg.AppleClientID,
+		KeyID:       cfg.AppleKeyID,
+		PrivateKey:  key,
+		RedirectURL: cfg.AppleRedirectURL,
+	}), nil
+}
+
+// newOutboxPublisher returns nil when no broker is configured
+func newOutboxPublisher(cfg config.Config) (outbox.Publisher, error) {
+	switch cfg.OutboxBroker {
+	case "kafka":
+		return outbox.NewKafkaPublisher(outbox.KafkaConfig{
+			Brokers: cfg.KafkaBrokers,
+			Topic:   cfg.KafkaTopic,
+		}), nil
+	case "nats":
+		return outbox.NewNATSPublisher(outbox.NATSConfig{
+			URL:           cfg.NATSURL,
+			SubjectPrefix: cfg.NATSSubjectPrefix,
+		})
+	}
+	return nil, nil
+}
+
+// newRedisClient returns nil when Redis isn't configured
+func newRedisClient(cfg config.Config) (redis.UniversalClient, error) {
+	if cfg.RedisURL == "" {
+		return nil, nil
+	}
+
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing REDIS_URL: %w", err)
+	}
+	return redis.NewClient(opts), nil
+}
+
+// newCache puts the Redis cache in front of db when it's configured. The in-memory database
+// is faster than Redis.
+func newCache(cfg config.Config, db database.Repository, client redis.UniversalClient, m *metrics.Metrics) database.Repository {
+	if client == nil || inMemory(cfg) || cfg.CacheAccountTTLSeconds == 0 {
+		return db
+	}
+
+	cacheCfg := cache.DefaultConfig()
+	cacheCfg.AccountTTL = time.Duration(cfg.CacheAccountTTLSeconds) * time.Second
+	cacheCfg.Observe = m.CacheLookup
+	return cache.New(db, client, cacheCfg)
+}
+
+// newLockoutStore uses Redis when it's configured so every replica shares the same counters
+func newLockoutStore(client redis.UniversalClient) lockout.Store {
+	if client == nil {
+		return lockout.NewMemoryStore()
+	}
+	return lockout.NewRedisStore(client)
+}
+
+// newRateLimitStore uses Redis when it's configured so every replica shares the same buckets
+func newRateLimitStore(client redis.UniversalClient) ratelimit.Store {
+	if client == nil {
+		return ratelimit.NewMemoryStore()
+	}
+	return ratelimit.NewRedisStore(client)
+}
+
+// newIdempotencyStore uses Redis when it's configured so a retry landing on another replica
+// still gets the first response
+func newIdempotencyStore(client redis.UniversalClient) idempotency.Store {
+	if client == nil {
+		return idempotency.NewMemoryStore()
+	}
+	return idempotency.NewRedisStore(client)
+}
+
+// loadMockAccounts creates the configured fake accounts. Their passwords are never
+// checked in mock mode so the hash is a placeholder.
+func loadMockAccounts(ctx context.Context, db database.Repository, emails []string) error {
+	var scenario fixtures.Scenario
+	for _, email := range emails {
+		scenario.Accounts = append(scenario.Accounts, fixtures.Account{
+			Email:        email,
+			PasswordHash: "mock-mode-accepts-any-password",
+		})
+	}
+
+	if _, err := fixtures.Load(ctx, db, scenario); err != nil {
+		return fmt.Errorf("error loading mock accounts: %w", err)
+	}
+	return nil
+}
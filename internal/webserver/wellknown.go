@@ -0,0 +1,90 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/internal/webserver/httputils"
+)
+
+// changePasswordRedirect serves https://w3c.github.io/webappsec-change-password-url/. Password
+// managers request the well-known URL and follow the redirect to wherever the user can change
+// their password.
+func changePasswordRedirect(changePasswordURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if changePasswordURL == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		// the spec allows 302 or 303; 302 is what browsers and password managers expect
+		http.Redirect(w, r, changePasswordURL, http.StatusFound)
+	}
+}
+
+// jwksMaxAge is how long verifiers may cache the key set. Keep it short enough that a new
+// signing key is picked up soon after it's deployed.
+const jwksMaxAge = "300"
+
+// jwks serves the public keys tokens are signed with as a JSON Web Key Set (RFC 7517), so other
+// services can verify tokens without sharing a secret. It 404s when tokens are signed with the
+// shared secret, there's nothing public to verify them with.
+func jwks(authClient *auth.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys := authClient.JWKS()
+		if len(keys.Keys) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age="+jwksMaxAge)
+		httputils.WriteJSONResponse(w, r, http.StatusOK, keys)
+	}
+}
+
+// openIDProviderMetadata is the OpenID Connect discovery document (OpenID Connect Discovery
+// section 3)
+type openIDProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// openIDConfiguration serves the OpenID Connect discovery document for the issuer. Clients send
+// browsers to the web app's consent page at authorizationURL, everything else is served here.
+// It 404s when OpenID Connect is off.
+func openIDConfiguration(issuer, authorizationURL string, authClient *auth.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if issuer == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age="+jwksMaxAge)
+		httputils.WriteJSONResponse(w, r, http.StatusOK, openIDProviderMetadata{
+			Issuer:                            issuer,
+			AuthorizationEndpoint:             authorizationURL,
+			TokenEndpoint:                     issuer + "/v1/oauth/token",
+			UserinfoEndpoint:                  issuer + "/v1/oauth/userinfo",
+			JWKSURI:                           issuer + "/.well-known/jwks.json",
+			ScopesSupported:                   auth.OAuthScopes,
+			ResponseTypesSupported:            []string{"code"},
+			GrantTypesSupported:               []string{"authorization_code", "client_credentials", "urn:ietf:params:oauth:grant-type:token-exchange"},
+			SubjectTypesSupported:             []string{"public"},
+			IDTokenSigningAlgValuesSupported:  authClient.SigningAlgorithms(),
+			TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+			ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified"},
+			CodeChallengeMethodsSupported:     []string{"S256"},
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package webserver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/pkg/tokenverify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangePasswordRedirect(t *testing.T) {
+	tests := []struct {
+		name             string
+		url              string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name:             "redirects to the configured page",
+			url:              "https://accounts.example.com/settings/password",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://accounts.example.com/settings/password",
+		},
+		{
+			name:           "not found when unconfigured",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/.well-known/change-password", nil)
+			w := httptest.NewRecorder()
+
+			changePasswordRedirect(tt.url)(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	t.Run("not found with the shared secret", func(t *testing.T) {
+		authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret"})
+
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		w := httptest.NewRecorder()
+		jwks(authClient)(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("other services verify tokens with the published keys", func(t *testing.T) {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		signingKey, err := auth.NewSigningKey(private)
+		require.NoError(t, err)
+		signingKeys, err := auth.NewKeyRing([]*auth.SigningKey{signingKey})
+		require.NoError(t, err)
+		authClient := auth.NewClient(auth.Config{AccessTokenTTLMinutes: 15, SigningKeys: signingKeys})
+
+		server := httptest.NewServer(jwks(authClient))
+		defer server.Close()
+
+		verifier, err := tokenverify.New(tokenverify.Config{JWKSURL: server.URL})
+		require.NoError(t, err)
+
+		token, _, err := authClient.NewAccessToken(auth.Claims{AccountID: "account-id"})
+		require.NoError(t, err)
+
+		claims, err := verifier.Verify(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "account-id", claims.AccountID)
+	})
+}
+
+func TestOpenIDConfiguration(t *testing.T) {
+	authClient := auth.NewClient(auth.Config{JWTSecretKey: "test-secret"})
+
+	t.Run("not found when OpenID Connect is off", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+		w := httptest.NewRecorder()
+		openIDConfiguration("", "", authClient)(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("describes the issuer's endpoints", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+		w := httptest.NewRecorder()
+		openIDConfiguration("https://accounts.example.com", "https://app.example.com/oauth/authorize", authClient)(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var metadata openIDProviderMetadata
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metadata))
+		assert.Equal(t, "https://accounts.example.com", metadata.Issuer)
+		assert.Equal(t, "https://app.example.com/oauth/authorize", metadata.AuthorizationEndpoint)
+		assert.Equal(t, "https://accounts.example.com/v1/oauth/token", metadata.TokenEndpoint)
+		assert.Equal(t, "https://accounts.example.com/v1/oauth/userinfo", metadata.UserinfoEndpoint)
+		assert.Equal(t, "https://accounts.example.com/.well-known/jwks.json", metadata.JWKSURI)
+		assert.Contains(t, metadata.ScopesSupported, auth.ScopeOpenID)
+		assert.Equal(t, []string{"S256"}, metadata.CodeChallengeMethodsSupported)
+	})
+}
@@ -0,0 +1,312 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: accountmanagement/v1/lookup.proto
+
+package accountspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LookupAccountsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ids           []string               `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	Emails        []string               `protobuf:"bytes,2,rep,name=emails,proto3" json:"emails,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupAccountsRequest) Reset() {
+	*x = LookupAccountsRequest{}
+	mi := &file_accountmanagement_v1_lookup_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupAccountsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupAccountsRequest) ProtoMessage() {}
+
+func (x *LookupAccountsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_accountmanagement_v1_lookup_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupAccountsRequest.ProtoReflect.Descriptor instead.
+func (*LookupAccountsRequest) Descriptor() ([]byte, []int) {
+	return file_accountmanagement_v1_lookup_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LookupAccountsRequest) GetIds() []string {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+func (x *LookupAccountsRequest) GetEmails() []string {
+	if x != nil {
+		return x.Emails
+	}
+	return nil
+}
+
+type LookupAccountsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// accounts follow the request order, each account once
+	Accounts      []*AccountProfile `protobuf:"bytes,1,rep,name=accounts,proto3" json:"accounts,omitempty"`
+	MissingIds    []string          `protobuf:"bytes,2,rep,name=missing_ids,json=missingIds,proto3" json:"missing_ids,omitempty"`
+	MissingEmails []string          `protobuf:"bytes,3,rep,name=missing_emails,json=missingEmails,proto3" json:"missing_emails,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupAccountsResponse) Reset() {
+	*x = LookupAccountsResponse{}
+	mi := &file_accountmanagement_v1_lookup_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupAccountsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupAccountsResponse) ProtoMessage() {}
+
+func (x *LookupAccountsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_accountmanagement_v1_lookup_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupAccountsResponse.ProtoReflect.Descriptor instead.
+func (*LookupAccountsResponse) Descriptor() ([]byte, []int) {
+	return file_accountmanagement_v1_lookup_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LookupAccountsResponse) GetAccounts() []*AccountProfile {
+	if x != nil {
+		return x.Accounts
+	}
+	return nil
+}
+
+func (x *LookupAccountsResponse) GetMissingIds() []string {
+	if x != nil {
+		return x.MissingIds
+	}
+	return nil
+}
+
+func (x *LookupAccountsResponse) GetMissingEmails() []string {
+	if x != nil {
+		return x.MissingEmails
+	}
+	return nil
+}
+
+// AccountProfile is what other services get to see about an account
+type AccountProfile struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Email           string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	PreferredLocale string                 `protobuf:"bytes,3,opt,name=preferred_locale,json=preferredLocale,proto3" json:"preferred_locale,omitempty"`
+	Tags            []string               `protobuf:"bytes,4,rep,name=tags,proto3" json:"tags,omitempty"`
+	FrozenAt        *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=frozen_at,json=frozenAt,proto3" json:"frozen_at,omitempty"`
+	VerifiedAt      *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=verified_at,json=verifiedAt,proto3" json:"verified_at,omitempty"`
+	CreatedAt       *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *AccountProfile) Reset() {
+	*x = AccountProfile{}
+	mi := &file_accountmanagement_v1_lookup_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccountProfile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccountProfile) ProtoMessage() {}
+
+func (x *AccountProfile) ProtoReflect() protoreflect.Message {
+	mi := &file_accountmanagement_v1_lookup_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccountProfile.ProtoReflect.Descriptor instead.
+func (*AccountProfile) Descriptor() ([]byte, []int) {
+	return file_accountmanagement_v1_lookup_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AccountProfile) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AccountProfile) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *AccountProfile) GetPreferredLocale() string {
+	if x != nil {
+		return x.PreferredLocale
+	}
+	return ""
+}
+
+func (x *AccountProfile) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *AccountProfile) GetFrozenAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FrozenAt
+	}
+	return nil
+}
+
+func (x *AccountProfile) GetVerifiedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.VerifiedAt
+	}
+	return nil
+}
+
+func (x *AccountProfile) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+var File_accountmanagement_v1_lookup_proto protoreflect.FileDescriptor
+
+const file_accountmanagement_v1_lookup_proto_rawDesc = "" +
+	"\n" +
+	"!accountmanagement/v1/lookup.proto\x12\x14accountmanagement.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"A\n" +
+	"\x15LookupAccountsRequest\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\tR\x03ids\x12\x16\n" +
+	"\x06emails\x18\x02 \x03(\tR\x06emails\"\xa2\x01\n" +
+	"\x16LookupAccountsResponse\x12@\n" +
+	"\baccounts\x18\x01 \x03(\v2$.accountmanagement.v1.AccountProfileR\baccounts\x12\x1f\n" +
+	"\vmissing_ids\x18\x02 \x03(\tR\n" +
+	"missingIds\x12%\n" +
+	"\x0emissing_emails\x18\x03 \x03(\tR\rmissingEmails\"\xa6\x02\n" +
+	"\x0eAccountProfile\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\x12)\n" +
+	"\x10preferred_locale\x18\x03 \x01(\tR\x0fpreferredLocale\x12\x12\n" +
+	"\x04tags\x18\x04 \x03(\tR\x04tags\x127\n" +
+	"\tfrozen_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\bfrozenAt\x12;\n" +
+	"\vverified_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"verifiedAt\x129\n" +
+	"\n" +
+	"created_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt2|\n" +
+	"\rAccountLookup\x12k\n" +
+	"\x0eLookupAccounts\x12+.accountmanagement.v1.LookupAccountsRequest\x1a,.accountmanagement.v1.LookupAccountsResponseB<Z:github.com/austinwofford/account-management/pkg/accountspbb\x06proto3"
+
+var (
+	file_accountmanagement_v1_lookup_proto_rawDescOnce sync.Once
+	file_accountmanagement_v1_lookup_proto_rawDescData []byte
+)
+
+func file_accountmanagement_v1_lookup_proto_rawDescGZIP() []byte {
+	file_accountmanagement_v1_lookup_proto_rawDescOnce.Do(func() {
+		file_accountmanagement_v1_lookup_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_accountmanagement_v1_lookup_proto_rawDesc), len(file_accountmanagement_v1_lookup_proto_rawDesc)))
+	})
+	return file_accountmanagement_v1_lookup_proto_rawDescData
+}
+
+var file_accountmanagement_v1_lookup_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_accountmanagement_v1_lookup_proto_goTypes = []any{
+	(*LookupAccountsRequest)(nil),  // 0: accountmanagement.v1.LookupAccountsRequest
+	(*LookupAccountsResponse)(nil), // 1: accountmanagement.v1.LookupAccountsResponse
+	(*AccountProfile)(nil),         // 2: accountmanagement.v1.AccountProfile
+	(*timestamppb.Timestamp)(nil),  // 3: google.protobuf.Timestamp
+}
+var file_accountmanagement_v1_lookup_proto_depIdxs = []int32{
+	2, // 0: accountmanagement.v1.LookupAccountsResponse.accounts:type_name -> accountmanagement.v1.AccountProfile
+	3, // 1: accountmanagement.v1.AccountProfile.frozen_at:type_name -> google.protobuf.Timestamp
+	3, // 2: accountmanagement.v1.AccountProfile.verified_at:type_name -> google.protobuf.Timestamp
+	3, // 3: accountmanagement.v1.AccountProfile.created_at:type_name -> google.protobuf.Timestamp
+	0, // 4: accountmanagement.v1.AccountLookup.LookupAccounts:input_type -> accountmanagement.v1.LookupAccountsRequest
+	1, // 5: accountmanagement.v1.AccountLookup.LookupAccounts:output_type -> accountmanagement.v1.LookupAccountsResponse
+	5, // [5:6] is the sub-list for method output_type
+	4, // [4:5] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_accountmanagement_v1_lookup_proto_init() }
+func file_accountmanagement_v1_lookup_proto_init() {
+	if File_accountmanagement_v1_lookup_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_accountmanagement_v1_lookup_proto_rawDesc), len(file_accountmanagement_v1_lookup_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_accountmanagement_v1_lookup_proto_goTypes,
+		DependencyIndexes: file_accountmanagement_v1_lookup_proto_depIdxs,
+		MessageInfos:      file_accountmanagement_v1_lookup_proto_msgTypes,
+	}.Build()
+	File_accountmanagement_v1_lookup_proto = out.File
+	file_accountmanagement_v1_lookup_proto_goTypes = nil
+	file_accountmanagement_v1_lookup_proto_depIdxs = nil
+}
@@ -0,0 +1,94 @@
+// Package grpcverify validates account-management access tokens in gRPC servers. Callers send
+// the token as "authorization: Bearer <access token>" metadata:
+//
+//	server := grpc.NewServer(
+//		grpc.UnaryInterceptor(grpcverify.UnaryServerInterceptor(verifier)),
+//		grpc.StreamInterceptor(grpcverify.StreamServerInterceptor(verifier)),
+//	)
+//
+// Handlers get the caller's claims with tokenverify.FromContext.
+package grpcverify
+
+import (
+	"context"
+
+	"github.com/austinwofford/account-management/pkg/tokenverify"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor rejects calls without a valid access token with Unauthenticated and
+// puts the token's claims on the context for the handler.
+func UnaryServerInterceptor(v *tokenverify.Verifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls
+func StreamServerInterceptor(v *tokenverify.Verifier) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), v)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, v *tokenverify.Verifier) (context.Context, error) {
+	var tokenString string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			if token, ok := tokenverify.BearerToken(value); ok {
+				tokenString = token
+				break
+			}
+		}
+	}
+	if tokenString == "" {
+		return nil, status.Error(codes.Unauthenticated, "a bearer access token is required")
+	}
+
+	claims, err := v.Verify(ctx, tokenString)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "the access token is invalid or expired")
+	}
+
+	if !claims.CertificateMatches(peerCertificate(ctx)) {
+		return nil, status.Error(codes.Unauthenticated, "the access token is bound to a different client certificate")
+	}
+
+	return tokenverify.NewContext(ctx, claims), nil
+}
+
+// peerCertificate returns the raw client certificate of a TLS connection, nil otherwise
+func peerCertificate(ctx context.Context) []byte {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil
+	}
+	return tlsInfo.State.PeerCertificates[0].Raw
+}
+
+// serverStream replaces the context of a stream with the authenticated one
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
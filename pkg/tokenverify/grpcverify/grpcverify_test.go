@@ -0,0 +1,68 @@
+package grpcverify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/austinwofford/account-management/pkg/tokenverify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	issuer := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	validToken, _, err := issuer.NewAccessToken(auth.Claims{AccountID: "account-1"})
+	require.NoError(t, err)
+
+	v, err := tokenverify.New(tokenverify.Config{HMACSecret: []byte("test-secret")})
+	require.NoError(t, err)
+	interceptor := UnaryServerInterceptor(v)
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		claims, ok := tokenverify.FromContext(ctx)
+		require.True(t, ok)
+		return claims.AccountID, nil
+	}
+
+	tests := []struct {
+		name          string
+		md            metadata.MD
+		expectedError bool
+	}{
+		{
+			name: "valid token",
+			md:   metadata.Pairs("authorization", "Bearer "+validToken),
+		},
+		{
+			name:          "missing metadata",
+			expectedError: true,
+		},
+		{
+			name:          "invalid token",
+			md:            metadata.Pairs("authorization", "Bearer not-a-token"),
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+
+			resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}, handler)
+			if tt.expectedError {
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "account-1", resp)
+		})
+	}
+}
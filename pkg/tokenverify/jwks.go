@@ -0,0 +1,116 @@
+package tokenverify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// jwksAlgorithms are the asymmetric signing algorithms accepted with JWKS keys
+var jwksAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// minRefetchInterval limits how often an unknown key ID can trigger a fetch, so tokens with
+// made up key IDs can't be used to hammer the JWKS endpoint
+const minRefetchInterval = 10 * time.Second
+
+// maxJWKSBytes is the largest JWKS document that will be read
+const maxJWKSBytes = 1 << 20
+
+// keySet fetches and caches the public keys published at a JWKS URL
+type keySet struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        jose.JSONWebKeySet
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func newKeySet(url string, client *http.Client, refreshInterval time.Duration) *keySet {
+	return &keySet{url: url, client: client, refreshInterval: refreshInterval}
+}
+
+// key returns the public key with the ID kid for verifying alg. Keys are fetched again once
+// they're older than the refresh interval, or sooner when kid isn't known (the service may
+// have rotated to a new key).
+func (s *keySet) key(ctx context.Context, kid, alg string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cached := s.lookup(kid, alg)
+	if cached != nil && time.Since(s.fetchedAt) < s.refreshInterval {
+		return cached, nil
+	}
+
+	if time.Since(s.attemptedAt) >= minRefetchInterval {
+		if err := s.fetch(ctx); err != nil {
+			// keep verifying with the keys we have rather than failing every request
+			if cached != nil {
+				return cached, nil
+			}
+			return nil, err
+		}
+	}
+
+	if key := s.lookup(kid, alg); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no signing key %q for %s", kid, alg)
+}
+
+func (s *keySet) lookup(kid, alg string) interface{} {
+	for _, key := range s.keys.Key(kid) {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if key.Algorithm != "" && key.Algorithm != alg {
+			continue
+		}
+		if !key.IsPublic() {
+			continue
+		}
+		return key.Key
+	}
+	return nil
+}
+
+func (s *keySet) fetch(ctx context.Context) error {
+	s.attemptedAt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error fetching JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(&keys); err != nil {
+		return fmt.Errorf("error decoding JWKS: %w", err)
+	}
+	if len(keys.Keys) == 0 {
+		return errors.New("error fetching JWKS: no keys")
+	}
+
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,94 @@
+package tokenverify
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type claimsKey struct{}
+
+// FromContext returns the claims of the authenticated caller, if Middleware or one of the
+// grpcverify interceptors ran.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// NewContext puts claims on the context the same way Middleware does. Mostly useful for tests.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// BearerToken returns the token of an "Authorization: Bearer <token>" header value
+func BearerToken(authorization string) (string, bool) {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// CertificateMatches reports whether a certificate-bound token was presented with the client
+// certificate it's bound to. Unbound tokens always match.
+func (c *Claims) CertificateMatches(rawCert []byte) bool {
+	if c.CertificateThumbprint == "" {
+		return true
+	}
+	if rawCert == nil {
+		return false
+	}
+	sum := sha256.Sum256(rawCert)
+	thumbprint := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(thumbprint), []byte(c.CertificateThumbprint)) == 1
+}
+
+// Middleware rejects requests without a valid "Authorization: Bearer <access token>" header
+// with a 401 and puts the token's claims on the request context for the next handler.
+// Certificate-bound tokens are only accepted over a TLS connection using their certificate.
+func Middleware(v *Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString, ok := BearerToken(r.Header.Get("Authorization"))
+			if !ok {
+				writeUnauthorized(w, "A bearer access token is required")
+				return
+			}
+
+			claims, err := v.Verify(r.Context(), tokenString)
+			if err != nil {
+				writeUnauthorized(w, "The access token is invalid or expired")
+				return
+			}
+
+			var rawCert []byte
+			if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+				rawCert = r.TLS.PeerCertificates[0].Raw
+			}
+			if !claims.CertificateMatches(rawCert) {
+				writeUnauthorized(w, "The access token is bound to a different client certificate")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+// writeUnauthorized writes the same error body account-management itself responds with
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"message":     message,
+		"type":        "unauthorized",
+		"http_status": http.StatusText(http.StatusUnauthorized),
+	})
+}
@@ -0,0 +1,88 @@
+package tokenverify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	issuer := auth.NewClient(auth.Config{JWTSecretKey: "test-secret", AccessTokenTTLMinutes: 15})
+	validToken, _, err := issuer.NewAccessToken(auth.Claims{AccountID: "account-1"})
+	require.NoError(t, err)
+	boundToken, _, err := issuer.NewAccessToken(auth.Claims{AccountID: "account-1", Confirmation: &auth.Confirmation{X5TS256: "thumbprint"}})
+	require.NoError(t, err)
+
+	v, err := New(Config{HMACSecret: []byte("test-secret")})
+	require.NoError(t, err)
+
+	handler := Middleware(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := FromContext(r.Context())
+		require.True(t, ok)
+		_, _ = w.Write([]byte(claims.AccountID))
+	}))
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "valid token",
+			authorization:  "Bearer " + validToken,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "account-1",
+		},
+		{
+			name:           "scheme is case insensitive",
+			authorization:  "bearer " + validToken,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "account-1",
+		},
+		{
+			name:           "missing header",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `"type":"unauthorized"`,
+		},
+		{
+			name:           "wrong scheme",
+			authorization:  "Basic " + validToken,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "invalid token",
+			authorization:  "Bearer not-a-token",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "invalid or expired",
+		},
+		{
+			name:           "certificate-bound token without a certificate",
+			authorization:  "Bearer " + boundToken,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "different client certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
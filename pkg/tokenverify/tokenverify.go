@@ -0,0 +1,268 @@
+// Package tokenverify validates account-management access tokens in other Go services.
+//
+// A Verifier checks a token's signature, expiry, and issuer and returns its claims. Tokens are
+// verified either with the service's shared HMAC secret or with the public keys it publishes
+// as a JWKS, and unwrapped first when the deployment encrypts access tokens:
+//
+//	verifier, err := tokenverify.New(tokenverify.Config{
+//		JWKSURL: "https://accounts.example.com/.well-known/jwks.json",
+//	})
+//	...
+//	mux.Handle("/orders", tokenverify.Middleware(verifier)(ordersHandler))
+//
+// Handlers behind Middleware get the caller's claims with FromContext. gRPC servers can use the
+// interceptors in the grpcverify subpackage.
+//
+// The package only depends on public modules so it can be imported without this service's
+// internal packages.
+package tokenverify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultIssuer is the "iss" claim of tokens issued by account-management
+const DefaultIssuer = "account-management"
+
+var (
+	ErrInvalidToken = errors.New("invalid access token")
+	ErrNoKeys       = errors.New("tokenverify: an HMAC secret or a JWKS URL is required")
+)
+
+// refreshTokenType is the "typ" header of signed refresh tokens, which are never accepted as
+// access tokens
+const refreshTokenType = "rt+jwt"
+
+// Claims are the claims of a verified access token
+type Claims struct {
+	// AccountID is empty for tokens an OAuth client got with the client credentials grant
+	AccountID string
+	// ClientID is the OAuth client the token was issued to, empty for the account's own tokens
+	ClientID string
+	// Scope is the space separated scopes granted to the OAuth client, or the account's own
+	// token was restricted to. The account's tokens without one aren't restricted.
+	Scope string
+	// Actors are the OAuth clients acting on the account's behalf for tokens issued by token
+	// exchange, the one the token was issued to first and the one it was exchanged from after it
+	Actors []string
+	// FeatureFlags are the account's values for the flags the service copies into tokens
+	FeatureFlags map[string]bool
+	// OrgID is the organization an organization-scoped token was issued for, empty otherwise
+	OrgID string
+	// Roles are the account's roles in the account management service
+	Roles []string
+	// CertificateThumbprint is the base64url SHA-256 of the client certificate the token is
+	// bound to (the "x5t#S256" confirmation), empty for unbound tokens
+	CertificateThumbprint string
+	TokenID               string
+	IssuedAt              time.Time
+	ExpiresAt             time.Time
+}
+
+// Flag returns the value of a feature flag, false if the token doesn't carry it
+func (c *Claims) Flag(name string) bool {
+	return c.FeatureFlags[name]
+}
+
+// HasRole is whether the token carries the role
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// HasScope is whether the token was granted the scope
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
+
+type Config struct {
+	// HMACSecret is the service's JWT_SECRET_KEY, for deployments that sign with HS256
+	HMACSecret []byte
+	// JWKSURL is where the service publishes its public signing keys, for deployments that
+	// sign with asymmetric keys. Keys are fetched on first use and cached.
+	JWKSURL string
+	// JWKSRefreshInterval is how long fetched keys are used before they're fetched again.
+	// Defaults to 5 minutes. A token signed with an unknown key triggers an early fetch.
+	JWKSRefreshInterval time.Duration
+	// HTTPClient fetches the JWKS. Defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+	// EncryptionKey is the service's JWT_ENCRYPTION_KEY (decoded), for deployments that
+	// encrypt access tokens. Once set only encrypted tokens are accepted.
+	EncryptionKey []byte
+	// Issuer is the expected "iss" claim. Defaults to DefaultIssuer.
+	Issuer string
+	// Leeway allows for clock skew when checking expiry
+	Leeway time.Duration
+}
+
+// Verifier validates access tokens. It's safe for concurrent use.
+type Verifier struct {
+	hmacSecret    []byte
+	keys          *keySet
+	encryptionKey []byte
+	issuer        string
+	leeway        time.Duration
+}
+
+func New(cfg Config) (*Verifier, error) {
+	if len(cfg.HMACSecret) == 0 && cfg.JWKSURL == "" {
+		return nil, ErrNoKeys
+	}
+	if cfg.EncryptionKey != nil && len(cfg.EncryptionKey) != 32 {
+		return nil, fmt.Errorf("tokenverify: encryption key must be 32 bytes, got %d", len(cfg.EncryptionKey))
+	}
+
+	v := &Verifier{
+		hmacSecret:    cfg.HMACSecret,
+		encryptionKey: cfg.EncryptionKey,
+		issuer:        cfg.Issuer,
+		leeway:        cfg.Leeway,
+	}
+	if v.issuer == "" {
+		v.issuer = DefaultIssuer
+	}
+
+	if cfg.JWKSURL != "" {
+		client := cfg.HTTPClient
+		if client == nil {
+			client = &http.Client{Timeout: 10 * time.Second}
+		}
+		refresh := cfg.JWKSRefreshInterval
+		if refresh <= 0 {
+			refresh = 5 * time.Minute
+		}
+		v.keys = newKeySet(cfg.JWKSURL, client, refresh)
+	}
+
+	return v, nil
+}
+
+// tokenClaims are the claims in an access token
+type tokenClaims struct {
+	AccountID    string      `json:"account_id"`
+	Actor        *tokenActor `json:"act,omitempty"`
+	ClientID     string      `json:"client_id,omitempty"`
+	Confirmation *struct {
+		X5TS256 string `json:"x5t#S256"`
+	} `json:"cnf,omitempty"`
+	FeatureFlags map[string]bool `json:"flags,omitempty"`
+	OrgID        string          `json:"org_id,omitempty"`
+	Roles        []string        `json:"roles,omitempty"`
+	Scope        string          `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// tokenActor is the "act" claim of a delegation token (RFC 8693 section 4.1)
+type tokenActor struct {
+	Subject string      `json:"sub"`
+	Actor   *tokenActor `json:"act,omitempty"`
+}
+
+// Verify validates an access token and returns its claims. Any validation failure wraps
+// ErrInvalidToken. The context bounds fetching signing keys, if that's needed.
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	if v.encryptionKey != nil {
+		var err error
+		tokenString, err = v.decrypt(tokenString)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+	}
+
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return v.key(ctx, token)
+	},
+		jwt.WithValidMethods(v.methods()),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.leeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if claims.AccountID == "" && claims.ClientID == "" {
+		return nil, fmt.Errorf("%w: missing account_id or client_id claim", ErrInvalidToken)
+	}
+
+	result := &Claims{
+		AccountID:    claims.AccountID,
+		ClientID:     claims.ClientID,
+		Scope:        claims.Scope,
+		FeatureFlags: claims.FeatureFlags,
+		OrgID:        claims.OrgID,
+		Roles:        claims.Roles,
+		TokenID:      claims.ID,
+		ExpiresAt:    claims.ExpiresAt.Time,
+	}
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Time
+	}
+	for actor := claims.Actor; actor != nil; actor = actor.Actor {
+		result.Actors = append(result.Actors, actor.Subject)
+	}
+	if claims.Confirmation != nil {
+		result.CertificateThumbprint = claims.Confirmation.X5TS256
+	}
+
+	return result, nil
+}
+
+// key picks the verification key for a token from its algorithm
+func (v *Verifier) key(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	if token.Header["typ"] == refreshTokenType {
+		return nil, errors.New("refresh tokens aren't access tokens")
+	}
+
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(v.hmacSecret) == 0 {
+			return nil, errors.New("HMAC signed token but no HMAC secret is configured")
+		}
+		return v.hmacSecret, nil
+	}
+
+	if v.keys == nil {
+		return nil, errors.New("asymmetrically signed token but no JWKS URL is configured")
+	}
+	kid, _ := token.Header["kid"].(string)
+	return v.keys.key(ctx, kid, token.Method.Alg())
+}
+
+func (v *Verifier) methods() []string {
+	var methods []string
+	if len(v.hmacSecret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if v.keys != nil {
+		methods = append(methods, jwksAlgorithms...)
+	}
+	return methods
+}
+
+// decrypt returns the signed JWT inside an encrypted access token
+func (v *Verifier) decrypt(tokenString string) (string, error) {
+	obj, err := jose.ParseEncryptedCompact(tokenString, []jose.KeyAlgorithm{jose.DIRECT}, []jose.ContentEncryption{jose.A256GCM})
+	if err != nil {
+		return "", err
+	}
+
+	if obj.Header.ExtraHeaders[jose.HeaderContentType] != "JWT" {
+		return "", errors.New("encrypted token is not a nested JWT")
+	}
+
+	plaintext, err := obj.Decrypt(v.encryptionKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
@@ -0,0 +1,224 @@
+package tokenverify
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/austinwofford/account-management/internal/service/auth"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyHMAC(t *testing.T) {
+	ctx := context.Background()
+
+	secret := "test-secret"
+	encryptionKey := make([]byte, 32)
+	_, err := rand.Read(encryptionKey)
+	require.NoError(t, err)
+
+	// tokens come from the service's own issuer so the two can't drift apart
+	issuer := auth.NewClient(auth.Config{JWTSecretKey: secret, AccessTokenTTLMinutes: 15, RefreshTokenTTLMinutes: 60})
+	encryptingIssuer := auth.NewClient(auth.Config{JWTSecretKey: secret, AccessTokenTTLMinutes: 15, EncryptionKey: encryptionKey})
+	expiredIssuer := auth.NewClient(auth.Config{JWTSecretKey: secret, AccessTokenTTLMinutes: -1})
+
+	newToken := func(t *testing.T, c *auth.Client, claims auth.Claims) string {
+		token, _, err := c.NewAccessToken(claims)
+		require.NoError(t, err)
+		return token
+	}
+
+	refreshToken, _, err := issuer.NewSignedRefreshToken("account-1", nil, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		config        Config
+		token         string
+		expectedError bool
+		verifyClaims  func(t *testing.T, claims *Claims)
+	}{
+		{
+			name:   "valid token",
+			config: Config{HMACSecret: []byte(secret)},
+			token: newToken(t, issuer, auth.Claims{
+				AccountID:    "account-1",
+				FeatureFlags: map[string]bool{"new-dashboard": true},
+				Confirmation: &auth.Confirmation{X5TS256: "thumbprint"},
+				Actor:        &auth.Actor{Subject: "client-2", Actor: &auth.Actor{Subject: "client-1"}},
+			}),
+			verifyClaims: func(t *testing.T, claims *Claims) {
+				assert.Equal(t, "account-1", claims.AccountID)
+				assert.Equal(t, []string{"client-2", "client-1"}, claims.Actors)
+				assert.True(t, claims.Flag("new-dashboard"))
+				assert.False(t, claims.Flag("unknown"))
+				assert.Equal(t, "thumbprint", claims.CertificateThumbprint)
+				assert.NotEmpty(t, claims.TokenID)
+				assert.WithinDuration(t, time.Now().Add(15*time.Minute), claims.ExpiresAt, 5*time.Second)
+			},
+		},
+		{
+			name:   "encrypted token",
+			config: Config{HMACSecret: []byte(secret), EncryptionKey: encryptionKey},
+			token:  newToken(t, encryptingIssuer, auth.Claims{AccountID: "account-1"}),
+			verifyClaims: func(t *testing.T, claims *Claims) {
+				assert.Equal(t, "account-1", claims.AccountID)
+			},
+		},
+		{
+			name:   "oauth client token",
+			config: Config{HMACSecret: []byte(secret)},
+			token:  newToken(t, issuer, auth.Claims{ClientID: "client-1", Scope: "account:read sessions:write"}),
+			verifyClaims: func(t *testing.T, claims *Claims) {
+				assert.Empty(t, claims.AccountID)
+				assert.Equal(t, "client-1", claims.ClientID)
+				assert.True(t, claims.HasScope("sessions:write"))
+				assert.False(t, claims.HasScope("account:delete"))
+			},
+		},
+		{
+			name:          "no account or client",
+			config:        Config{HMACSecret: []byte(secret)},
+			token:         newToken(t, issuer, auth.Claims{}),
+			expectedError: true,
+		},
+		{
+			name:          "unencrypted token when encryption is configured",
+			config:        Config{HMACSecret: []byte(secret), EncryptionKey: encryptionKey},
+			token:         newToken(t, issuer, auth.Claims{AccountID: "account-1"}),
+			expectedError: true,
+		},
+		{
+			name:          "wrong secret",
+			config:        Config{HMACSecret: []byte("other-secret")},
+			token:         newToken(t, issuer, auth.Claims{AccountID: "account-1"}),
+			expectedError: true,
+		},
+		{
+			name:          "expired",
+			config:        Config{HMACSecret: []byte(secret)},
+			token:         newToken(t, expiredIssuer, auth.Claims{AccountID: "account-1"}),
+			expectedError: true,
+		},
+		{
+			name:          "wrong issuer",
+			config:        Config{HMACSecret: []byte(secret), Issuer: "someone-else"},
+			token:         newToken(t, issuer, auth.Claims{AccountID: "account-1"}),
+			expectedError: true,
+		},
+		{
+			name:          "refresh token",
+			config:        Config{HMACSecret: []byte(secret)},
+			token:         refreshToken,
+			expectedError: true,
+		},
+		{
+			name:          "garbage",
+			config:        Config{HMACSecret: []byte(secret)},
+			token:         "not-a-token",
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := New(tt.config)
+			require.NoError(t, err)
+
+			claims, err := v.Verify(ctx, tt.token)
+			if tt.expectedError {
+				require.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+			require.NoError(t, err)
+			tt.verifyClaims(t, claims)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{})
+	assert.ErrorIs(t, err, ErrNoKeys)
+
+	_, err = New(Config{HMACSecret: []byte("secret"), EncryptionKey: []byte("too-short")})
+	assert.Error(t, err)
+}
+
+func TestVerifyJWKS(t *testing.T) {
+	ctx := context.Background()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	published := atomic.Value{}
+	published.Store(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: rsaKey.Public(), KeyID: "rsa-1", Algorithm: "RS256", Use: "sig"},
+	}})
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(published.Load())
+	}))
+	t.Cleanup(server.Close)
+
+	sign := func(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{
+			"account_id": "account-1",
+			"iss":        DefaultIssuer,
+			"iat":        time.Now().Unix(),
+			"exp":        time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	v, err := New(Config{JWKSURL: server.URL})
+	require.NoError(t, err)
+
+	claims, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey))
+	require.NoError(t, err)
+	assert.Equal(t, "account-1", claims.AccountID)
+
+	// keys are cached
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// a key can't be used with another algorithm than the one it's published for
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodPS256, "rsa-1", rsaKey))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// HMAC tokens aren't accepted without an HMAC secret, even when signed with public key material
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodHS256, "rsa-1", []byte("public-key-bytes")))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// a token signed with a newly published key triggers a fetch
+	published.Store(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: rsaKey.Public(), KeyID: "rsa-1", Algorithm: "RS256", Use: "sig"},
+		{Key: edKey.Public(), KeyID: "ed-1", Algorithm: "EdDSA", Use: "sig"},
+	}})
+	v.keys.attemptedAt = time.Time{}
+	claims, err = v.Verify(ctx, sign(t, jwt.SigningMethodEdDSA, "ed-1", edKey))
+	require.NoError(t, err)
+	assert.Equal(t, "account-1", claims.AccountID)
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// unknown key IDs don't fetch again right away
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodEdDSA, "ed-unknown", edKey))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, int32(2), fetches.Load())
+}